@@ -57,6 +57,8 @@ let package = Package(
                 // Streams download bodies to disk off the cooperative pool.
                 // NonBlockingFileIO is deprecated in favor of this.
                 .product(name: "_NIOFileSystem", package: "swift-nio"),
+                // The object gateway's S3 listener.
+                .product(name: "NIOHTTP1", package: "swift-nio"),
                 .product(name: "NIOSSL", package: "swift-nio-ssl"),
                 .product(name: "AsyncHTTPClient", package: "async-http-client"),
             ],
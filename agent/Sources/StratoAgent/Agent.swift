@@ -81,6 +81,18 @@ actor Agent {
     private var networkService: (any NetworkServiceProtocol)?
     private var imageCacheService: ImageCacheService?
     private var storageBackend: (any StorageBackend)?
+    // Volume migration: the mTLS copy channel for detached volumes, and the
+    // NBD exports that serve attached ones to a VM on another host (nil
+    // unless `volume_nbd_address` is set on a real host).
+    private var volumeCopyTransfer: VolumeCopyTransfer?
+    private var nbdExports: NBDExportManager?
+    // Managed NFS file shares (nil unless `file_share_dir` is set on a real
+    // Linux host with OVN networking).
+    private var fileShares: FileShareManager?
+    // The S3-compatible object gateway and its listener (nil unless
+    // `object_gateway_dir` and `object_gateway_listen` are set on a real host).
+    private var objectGateway: ObjectGateway?
+    private var objectGatewayTask: Task<Void, Never>?
     private var consoleSocketManager: ConsoleSocketManager?
     private var reconnectTask: Task<Void, Never>?
     private var isRunning = false
@@ -178,11 +190,31 @@ actor Agent {
     // Last-known balloon memory stats per VM (issue #567), maintained by the
     // same slow poll with the same lifecycle as `guestInfoCache`.
     private var memoryStatsCache: [String: VMMemoryStats] = [:]
+    // Each VM's last vCPU-time reading, and the utilization between it and
+    // the one before — same slow poll, same lifecycle. A VM needs two polls
+    // before it reports a utilization.
+    private var vcpuReadings: [String: GuestCPUSampler.Reading] = [:]
+    private var cpuUtilizationCache: [String: Double] = [:]
+    // The memory overcommit policy last applied (wire v26): KSM, free-page
+    // reporting for new VMs, and the pressure reclaim the slow poll runs.
+    // Nil until a v26 control plane sends one; kept across syncs that carry
+    // none, which are "no opinion".
+    private var memoryOvercommit: MemoryOvercommitPolicy?
+    private let ksmTuner = KSMTuner()
     /// When the guest-info cache was last refreshed, to throttle probing to the
     /// slow-poll cadence regardless of how often reports/heartbeats fire.
     private var lastGuestInfoRefresh: ContinuousClock.Instant?
     /// Minimum spacing between guest-info refreshes.
     private static let guestInfoRefreshInterval: Duration = .seconds(30)
+    // Application health checks (wire v31): each desired-running VM's check
+    // and spec as of the last sync, the tracker that turns probe results
+    // into health, and the loop that runs due probes.
+    private var desiredHealthChecks: [String: (check: VMHealthCheck, spec: VMSpec)] = [:]
+    private var healthTracker = VMHealthTracker()
+    private var healthCheckTask: Task<Void, Never>?
+    /// How often the health loop looks for due probes. Each check's own
+    /// interval decides when it actually runs.
+    private static let healthCheckTick: Duration = .seconds(5)
 
     private let networkMode: NetworkMode?
     // Chassis-level OVN settings (ovn-remote/encap external_ids) the network
@@ -219,6 +251,22 @@ actor Agent {
     // Root of the managed-volume tree for the filesystem storage backend and
     // the host preflight's writability probe.
     private let volumeStoragePath: String
+    // Operator attestation that the volume tree is on encrypted storage,
+    // advertised so encryption-requiring volume types can be placed here.
+    private let volumeStorageEncrypted: Bool
+    // Storage-network address and port range for NBD exports (volume
+    // migration targets). A nil address leaves NBD off and `nbd_export`
+    // unadvertised.
+    private let volumeNBDAddress: String?
+    private let volumeNBDPortRange: ClosedRange<Int>
+    // Root of the file-share tree; nil leaves file shares off and
+    // `nfs_file_share` unadvertised.
+    private let fileShareStoragePath: String?
+    // Object gateway storage root, listen address and advertised endpoint;
+    // nil root leaves the gateway off and `object_gateway` unadvertised.
+    private let objectGatewayStoragePath: String?
+    private let objectGatewayListen: String?
+    private let objectGatewayEndpoint: String?
     private let qemuBinaryPath: String
     // Operator-configured EDK2 firmware paths (issue #565): the split
     // CODE/VARS pairs and the legacy monolithic image.
@@ -226,6 +274,9 @@ actor Agent {
     // `swtpm`, when this host has it. Nil keeps the TPM capability dark at
     // registration, so the scheduler never places a vTPM VM here.
     private let swtpmBinaryPath: String?
+    // `virt-fw-vars`, when this host has it. Nil keeps custom Secure Boot key
+    // enrollment dark at registration (wire v29).
+    private let virtFwVarsBinaryPath: String?
     private let firecrackerBinaryPath: String
     private let firecrackerSocketDir: String
     // Where the sandbox guest base image (issue #419) is installed; its
@@ -257,6 +308,13 @@ actor Agent {
     private let simulation: SimulationConfig?
     private var isSimulationMode: Bool { simulation?.enabled ?? false }
 
+    /// Where VMs' TPM state keys are installed (wire v32), or nil when this
+    /// host runs no swtpm to hand them to.
+    private var tpmKeyDirectory: String? {
+        guard !isSimulationMode, swtpmBinaryPath != nil else { return nil }
+        return SwtpmSupervisor.keyDirectory(runtimeDirectory: qemuSocketDir)
+    }
+
     // SPIFFE/SPIRE support
     private let spiffeConfig: SPIFFEConfig?
     private var svidManager: SVIDManager?
@@ -298,9 +356,17 @@ actor Agent {
         sandboxImageCacheMaxSizeBytes: Int64? = nil,
         vmStoragePath: String,
         volumeStoragePath: String = FileSystemStorageBackend.defaultStoragePath,
+        volumeStorageEncrypted: Bool = false,
+        volumeNBDAddress: String? = nil,
+        volumeNBDPortRange: ClosedRange<Int> = 10809...10899,
+        fileShareStoragePath: String? = nil,
+        objectGatewayStoragePath: String? = nil,
+        objectGatewayListen: String? = nil,
+        objectGatewayEndpoint: String? = nil,
         qemuBinaryPath: String,
         firmware: FirmwareOverrides = FirmwareOverrides(),
         swtpmBinaryPath: String? = nil,
+        virtFwVarsBinaryPath: String? = nil,
         firecrackerBinaryPath: String = "/usr/bin/firecracker",
         firecrackerSocketDir: String = "/tmp/firecracker",
         sandboxGuestImagePath: String? = nil,
@@ -331,9 +397,17 @@ actor Agent {
         self.sandboxImageCacheMaxSizeBytes = sandboxImageCacheMaxSizeBytes
         self.vmStoragePath = vmStoragePath
         self.volumeStoragePath = volumeStoragePath
+        self.volumeStorageEncrypted = volumeStorageEncrypted
+        self.volumeNBDAddress = volumeNBDAddress
+        self.volumeNBDPortRange = volumeNBDPortRange
+        self.fileShareStoragePath = fileShareStoragePath
+        self.objectGatewayStoragePath = objectGatewayStoragePath
+        self.objectGatewayListen = objectGatewayListen
+        self.objectGatewayEndpoint = objectGatewayEndpoint
         self.qemuBinaryPath = qemuBinaryPath
         self.firmware = firmware
         self.swtpmBinaryPath = swtpmBinaryPath
+        self.virtFwVarsBinaryPath = virtFwVarsBinaryPath
         self.firecrackerBinaryPath = firecrackerBinaryPath
         self.firecrackerSocketDir = firecrackerSocketDir
         self.sandboxGuestImagePath = sandboxGuestImagePath
@@ -488,6 +562,62 @@ actor Agent {
         }
         self.storageBackend = storageBackend
 
+        // Detached-volume migration streams disk files through the control
+        // plane over SVID mTLS, like snapshot artifacts. The simulated backend
+        // exports an empty file, so simulation still exercises the flow
+        // without moving real bytes.
+        let volumeDownloader = makeMTLSArtifactDownloader()
+        volumeCopyTransfer = VolumeCopyTransfer(
+            controlPlaneBaseURL: controlPlaneHTTPBase,
+            downloadFile: { url, destination in
+                try await volumeDownloader.downloadSnapshotArtifact(url: url, to: destination)
+            },
+            uploadFile: { url, source in
+                try await volumeDownloader.uploadFile(url: url, fromFile: source)
+            }
+        )
+        if !isSimulationMode, let volumeNBDAddress {
+            let exports = NBDExportManager(
+                stateDirectory: volumeStoragePath,
+                advertiseHost: volumeNBDAddress,
+                bindAddress: volumeNBDAddress,
+                portRange: volumeNBDPortRange,
+                logger: logger
+            )
+            // Exports outlive the agent (qemu-nbd forks), but not a host
+            // reboot; bring back any whose process is gone before a remote VM
+            // notices.
+            await exports.restore()
+            nbdExports = exports
+        }
+        // File shares need a real OVN port for their NFS server, so they are
+        // only hosted alongside the Linux network service.
+        if !isSimulationMode, let fileShareStoragePath,
+            let shareNetwork = networkService as? any FileShareNetworking
+        {
+            let manager = FileShareManager(root: fileShareStoragePath, network: shareNetwork, logger: logger)
+            await manager.restore()
+            fileShares = manager
+        }
+        if !isSimulationMode, let objectGatewayStoragePath, let objectGatewayListen,
+            let address = ObjectGatewayServer.parseListenAddress(objectGatewayListen)
+        {
+            let gateway = ObjectGateway(
+                root: objectGatewayStoragePath, endpoint: objectGatewayEndpoint, logger: logger)
+            let server = ObjectGatewayServer(
+                host: address.host, port: address.port, gateway: gateway, logger: logger)
+            let logger = logger
+            objectGatewayTask = Task {
+                do {
+                    try await server.run()
+                } catch is CancellationError {
+                } catch {
+                    logger.error("Object gateway listener failed: \(error)")
+                }
+            }
+            objectGateway = gateway
+        }
+
         if isSimulationMode {
             // One mock backend per hypervisor type, so the agent is eligible for
             // both QEMU and Firecracker placements. The mock tracks specs and
@@ -523,7 +653,8 @@ actor Agent {
             hypervisorServices[.qemu] = QEMUService(
                 logger: logger, storage: storageBackend,
                 vmStoragePath: vmStoragePath, qemuBinaryPath: qemuBinaryPath, firmware: firmware,
-                swtpmBinaryPath: swtpmBinaryPath,
+                swtpmBinaryPath: swtpmBinaryPath, swtpmKeyDirectory: tpmKeyDirectory,
+                virtFwVarsBinaryPath: virtFwVarsBinaryPath,
                 hardwareAccelerationEnabled: hardwareAccelerationEnabled)
             #else
             hypervisorServices[.qemu] = MockHypervisorService(logger: logger, hypervisorType: .qemu)
@@ -655,6 +786,9 @@ actor Agent {
         // lanes; all hypervisor side effects go through this agent (the
         // actuator), so it must exist before the message consumer starts.
         reconciler = Reconciler(actuator: self, queue: messageQueue, logger: logger)
+        healthCheckTask = Task { [weak self] in
+            await self?.runHealthCheckLoop()
+        }
 
         logger.info("Initializing console socket manager")
         consoleSocketManager = ConsoleSocketManager(logger: logger, eventLoopGroup: eventLoopGroup)
@@ -787,6 +921,12 @@ actor Agent {
         sandboxLogPumpTask?.cancel()
         sandboxLogPumpTask = nil
 
+        objectGatewayTask?.cancel()
+        objectGatewayTask = nil
+
+        healthCheckTask?.cancel()
+        healthCheckTask = nil
+
         // Unregister from control plane — but not when restarting into an
         // updated binary: the agent re-registers seconds later, and the
         // unregister both marks it offline and fails the control plane's
@@ -1012,11 +1152,13 @@ actor Agent {
         // withholding it would make simulated fleets unusable for scale-testing
         // Windows-shaped placement.
         var swtpmAvailable = isSimulationMode
+        var keyEnrollmentAvailable = isSimulationMode
         if isSimulationMode {
             hypervisors = simulatedHypervisorSupport()
         } else {
             let preflight = runHostPreflight()
             swtpmAvailable = preflight.swtpmAvailable
+            keyEnrollmentAvailable = preflight.secureBootKeyEnrollmentAvailable
             logHostPreflight(preflight)
             let probed = preflight.gate(
                 HypervisorProbe.probeAll(
@@ -1076,6 +1218,39 @@ actor Agent {
         if swtpmAvailable {
             capabilities.append(Self.vtpmCapabilityName)
         }
+        // Custom Secure Boot keys (wire v29): unlike vTPM there is no typed
+        // flag — the scheduler keys on this string, as storage does on its
+        // capabilities.
+        if keyEnrollmentAvailable {
+            capabilities.append(MachineCapability.secureBootKeyEnrollment)
+        }
+
+        // Encrypted volume storage is an operator attestation, not a probe;
+        // the control plane keys encryption-requiring volume types on it.
+        if volumeStorageEncrypted {
+            capabilities.append(StorageCapability.encryptedVolumeStorage)
+        }
+        if nbdExports != nil {
+            capabilities.append(StorageCapability.nbdExport)
+        }
+        if fileShares != nil {
+            capabilities.append(StorageCapability.nfsFileShare)
+        }
+        if objectGateway != nil {
+            capabilities.append(StorageCapability.objectGateway)
+        }
+
+        // Guest CPU models (wire v28): what the accelerator runs in full,
+        // from a throwaway QEMU. Simulation advertises the known baselines
+        // so named-model placement can be exercised against a dummy fleet.
+        let cpuModels: [String]?
+        if isSimulationMode {
+            cpuModels = GuestCPUModels.simulatedModels
+        } else if let qemu = hypervisorServices[.qemu] as? QEMUService {
+            cpuModels = await qemu.probeCPUModels(hostVendor: HostInfoProbe.cpuVendor())
+        } else {
+            cpuModels = nil
+        }
 
         let message = AgentRegisterMessage(
             agentId: initialAgentID,
@@ -1090,7 +1265,7 @@ actor Agent {
             sandboxCapable: sandboxCapable,
             tpmCapable: swtpmAvailable,
             operatingSystem: OperatingSystem.current,
-            hostInfo: HostInfoProbe.gather()
+            hostInfo: HostInfoProbe.gather(supportedCPUModels: cpuModels)
         )
 
         if let client = websocketClient {
@@ -1395,6 +1570,7 @@ actor Agent {
                 firecrackerSocketDirectory: firecrackerSocketDirectory,
                 firmwarePath: resolvedFirmwarePath,
                 swtpmBinaryPath: swtpmBinaryPath,
+                virtFwVarsBinaryPath: virtFwVarsBinaryPath,
                 ovnMode: effectiveNetworkMode == .ovn,
                 ovnNBConnection: ovnNorthbound ?? "unix:/var/run/ovn/ovnnb_db.sock",
                 ovnNBTLSFilePaths: ovnNorthboundTLS?.configuredFilePaths ?? []
@@ -1678,6 +1854,8 @@ actor Agent {
         guard !qemuVMIds.isEmpty else {
             guestInfoCache = [:]
             memoryStatsCache = [:]
+            vcpuReadings = [:]
+            cpuUtilizationCache = [:]
             return
         }
 
@@ -1689,6 +1867,15 @@ actor Agent {
             }
             guestInfoCache = observations.guestInfo
             memoryStatsCache = observations.memoryStats
+            let previousReadings = vcpuReadings
+            vcpuReadings = observations.vcpuReadings
+            cpuUtilizationCache = observations.vcpuReadings.reduce(into: [:]) { result, entry in
+                guard let previous = previousReadings[entry.key] else { return }
+                result[entry.key] = GuestCPUSampler.utilization(from: previous, to: entry.value)
+            }
+            // Reclaim decisions ride the same cadence, so each pass sees the
+            // stats its previous step produced.
+            await reclaimMemoryUnderPressure(using: qemu)
         } catch {
             // A whole-pass timeout leaves the previous caches in place; the
             // next slow poll retries. Individual probes already degrade to nil.
@@ -1696,28 +1883,218 @@ actor Agent {
         }
     }
 
-    /// Concurrently probes each VM's guest agent and balloon device (each
-    /// probe bounded inside `QEMUService`), returning only the VMs that
-    /// answered. A VM must be observed running before we probe — qga on a
-    /// stopped VM just times out, and a stopped VM has no stats socket.
+    /// Concurrently probes each VM's guest agent, balloon device and vCPU
+    /// threads (each probe bounded inside `QEMUService`), returning only the
+    /// VMs that answered. A VM must be observed running before we probe — qga
+    /// on a stopped VM just times out, and a stopped VM has no stats socket.
     private static func probeGuestObservations(
         vmIds: [String], using qemu: QEMUService
-    ) async -> (guestInfo: [String: GuestInfo], memoryStats: [String: VMMemoryStats]) {
-        await withTaskGroup(of: (String, GuestInfo?, VMMemoryStats?).self) { group in
+    ) async -> (
+        guestInfo: [String: GuestInfo], memoryStats: [String: VMMemoryStats],
+        vcpuReadings: [String: GuestCPUSampler.Reading]
+    ) {
+        await withTaskGroup(of: (String, GuestInfo?, VMMemoryStats?, GuestCPUSampler.Reading?).self) { group in
             for vmId in vmIds {
                 group.addTask {
                     let status = (try? await qemu.getVMStatus(vmId: vmId)) ?? .unknown
-                    guard status == .running else { return (vmId, nil, nil) }
-                    return (vmId, await qemu.guestInfo(vmId: vmId), await qemu.memoryStats(vmId: vmId))
+                    guard status == .running else { return (vmId, nil, nil, nil) }
+                    return (
+                        vmId, await qemu.guestInfo(vmId: vmId), await qemu.memoryStats(vmId: vmId),
+                        await qemu.vcpuReading(vmId: vmId)
+                    )
                 }
             }
             var guestInfo: [String: GuestInfo] = [:]
             var memoryStats: [String: VMMemoryStats] = [:]
-            for await (vmId, info, stats) in group {
+            var vcpuReadings: [String: GuestCPUSampler.Reading] = [:]
+            for await (vmId, info, stats, reading) in group {
                 if let info { guestInfo[vmId] = info }
                 if let stats { memoryStats[vmId] = stats }
+                if let reading { vcpuReadings[vmId] = reading }
+            }
+            return (guestInfo, memoryStats, vcpuReadings)
+        }
+    }
+
+    // MARK: - Application health checks (wire v31)
+
+    /// Runs due health checks until the agent stops.
+    private func runHealthCheckLoop() async {
+        while !shutdownRequested {
+            await runDueHealthChecks()
+            do {
+                try await Task.sleep(for: Self.healthCheckTick)
+            } catch {
+                return  // cancelled (agent stopping)
+            }
+        }
+    }
+
+    /// One pass of the health loop. Only VMs observed running are checked:
+    /// one that stopped drops out of the tracker and starts over, grace
+    /// period included, when it runs again. Probes run concurrently, each
+    /// bounded by its check's timeout; a VM whose health flipped is reported
+    /// at once, so the control plane's action doesn't wait for a heartbeat.
+    private func runDueHealthChecks() async {
+        var running: [String: VMHealthCheck] = [:]
+        var targets: [String: (service: any HypervisorService, spec: VMSpec)] = [:]
+        for (vmId, desired) in desiredHealthChecks {
+            guard let entry = managedVMs[vmId], let service = hypervisorServices[entry.hypervisorType],
+                (try? await service.getVMStatus(vmId: vmId)) == .running
+            else { continue }
+            running[vmId] = desired.check
+            targets[vmId] = (service, desired.spec)
+        }
+        healthTracker.configure(running, now: Date())
+
+        let due = healthTracker.due(at: Date())
+        guard !due.isEmpty else { return }
+        let results = await withTaskGroup(of: (String, String?).self) { group in
+            for (vmId, check) in due {
+                guard let target = targets[vmId] else { continue }
+                group.addTask { (vmId, await Self.probeHealth(vmId: vmId, check: check, target: target)) }
+            }
+            var results: [(String, String?)] = []
+            for await result in group { results.append(result) }
+            return results
+        }
+
+        var changed = false
+        for (vmId, failure) in results {
+            guard healthTracker.record(vmId: vmId, failure: failure, at: Date()) else { continue }
+            changed = true
+            logger.info(
+                "VM health changed",
+                metadata: [
+                    "vmId": .string(vmId),
+                    "status": .string(healthTracker.observation(for: vmId)?.status.rawValue ?? "unknown"),
+                    "reason": .string(failure ?? "check passed"),
+                ])
+        }
+        if changed {
+            await sendObservedStateReport()
+        }
+    }
+
+    /// Probes one VM's check. Nil on a pass, otherwise why it failed.
+    private static func probeHealth(
+        vmId: String, check: VMHealthCheck, target: (service: any HypervisorService, spec: VMSpec)
+    ) async -> String? {
+        guard check.kind == .exec else {
+            guard let address = VMHealthProber.targetAddress(of: target.spec) else {
+                return "The VM has no allocated address to probe"
+            }
+            return await VMHealthProber.probe(check, address: address)
+        }
+        guard let qemu = target.service as? QEMUService else {
+            return "exec checks need the QEMU guest agent"
+        }
+        do {
+            let result = try await qemu.guestExec(
+                vmId: vmId, command: check.command ?? [], timeoutSeconds: check.timeoutSeconds)
+            if result.succeeded { return nil }
+            let ending = result.exitCode.map { "exited \($0)" } ?? "killed by signal \(result.signal ?? 0)"
+            return result.output.isEmpty ? "Command \(ending)" : "Command \(ending): \(result.output)"
+        } catch {
+            return "Command could not run: \(error.localizedDescription)"
+        }
+    }
+
+    // MARK: - vTPM state keys (wire v32)
+
+    /// Installs the TPM state key of every desired VM that carries one.
+    /// Re-sent on every sync and unchanged keys are not rewritten, so this is
+    /// what restores the keys after a host reboot empties the runtime
+    /// directory. A key that fails to install is logged and the VM left to
+    /// its swtpm as is; keys of VMs no longer desired go with their delete.
+    private func installTPMStateKeys(_ vms: [DesiredVMState]) {
+        guard let tpmKeyDirectory else { return }
+        for vm in vms {
+            guard let key = vm.tpmStateKey else { continue }
+            let vmId = vm.vmId.uuidString
+            do {
+                if try SwtpmSupervisor.installKey(key, vmId: vmId, keyDirectory: tpmKeyDirectory) {
+                    logger.info("Installed TPM state key", metadata: ["vmId": .string(vmId)])
+                }
+            } catch {
+                logger.error(
+                    "Failed to install TPM state key",
+                    metadata: ["vmId": .string(vmId), "error": .string("\(error)")])
+            }
+        }
+    }
+
+    // MARK: - Memory overcommit (wire v26)
+
+    /// Applies a new overcommit policy: KSM now, free-page reporting for VMs
+    /// spawned from here on, and — when the policy drops pressure reclaim —
+    /// every reclaimed balloon handed back. Re-sent on every sync, so an
+    /// unchanged policy is a no-op, and a KSM write that failed is retried
+    /// only when the policy changes (a host without KSM stays without it).
+    private func applyMemoryOvercommit(_ policy: MemoryOvercommitPolicy) async {
+        guard policy != memoryOvercommit else { return }
+        let previous = memoryOvercommit
+        memoryOvercommit = policy
+        logger.info(
+            "Applying memory overcommit policy",
+            metadata: [
+                "ratio": .stringConvertible(policy.ratio),
+                "ksm": .stringConvertible(policy.ksm != nil),
+                "freePageReporting": .stringConvertible(policy.freePageReporting),
+                "pressureReclaim": .stringConvertible(policy.pressureReclaim != nil),
+            ])
+
+        if !isSimulationMode, policy.ksm != previous?.ksm {
+            if ksmTuner.isAvailable {
+                do {
+                    try ksmTuner.apply(policy.ksm)
+                } catch {
+                    logger.warning(
+                        "KSM settings could not be applied",
+                        metadata: ["error": .string(error.localizedDescription)])
+                }
+            } else if policy.ksm != nil {
+                logger.warning("Overcommit policy enables KSM, but this kernel has no \(KSMTuner.sysfsPath)")
             }
-            return (guestInfo, memoryStats)
+        }
+
+        guard let qemu = hypervisorServices[.qemu] as? QEMUService else { return }
+        await qemu.setFreePageReporting(policy.freePageReporting)
+        if policy.pressureReclaim == nil {
+            for vmId in await qemu.currentReclaimTargets().keys.sorted() {
+                await qemu.setReclaimTarget(vmId: vmId, bytes: nil)
+            }
+        }
+    }
+
+    /// One pass of pressure-aware reclaim: reads the host's memory PSI, asks
+    /// `MemoryPressureController` which idle guests to squeeze or release,
+    /// and applies the result. Does nothing without a reclaim policy, or on
+    /// a kernel without PSI.
+    private func reclaimMemoryUnderPressure(using qemu: QEMUService) async {
+        guard !isSimulationMode, let policy = memoryOvercommit?.pressureReclaim,
+            let pressure = MemoryPressure.read()
+        else { return }
+
+        let reclaimTargets = await qemu.currentReclaimTargets()
+        let inputs = managedVMs.compactMap { vmId, entry -> MemoryPressureController.VMInput? in
+            guard entry.hypervisorType == .qemu, let stats = memoryStatsCache[vmId] else { return nil }
+            return MemoryPressureController.VMInput(
+                vmId: vmId, memoryBytes: entry.spec.memoryBytes,
+                operatorTargetBytes: entry.spec.balloonTargetBytes, floorBytes: entry.spec.memoryFloorBytes,
+                stats: stats, reclaimTargetBytes: reclaimTargets[vmId])
+        }
+        let changes = MemoryPressureController.plan(pressure: pressure, policy: policy, vms: inputs)
+        for (vmId, target) in changes.sorted(by: { $0.key < $1.key }) {
+            await qemu.setReclaimTarget(vmId: vmId, bytes: target)
+        }
+        if !changes.isEmpty {
+            logger.info(
+                "Adjusted balloons for host memory pressure",
+                metadata: [
+                    "psiSomeAvg10": .stringConvertible(pressure.someAvg10),
+                    "vms": .stringConvertible(changes.count),
+                ])
         }
     }
 
@@ -1737,8 +2114,9 @@ actor Agent {
         }
 
         // Resources committed to VMs currently managed on this host. We report
-        // available = total - reserved (1:1, no overcommit) so the scheduler treats
-        // CPU/memory as hard constraints; overcommit ratios can be layered on later.
+        // available = total - reserved (1:1) so the scheduler treats CPU/memory
+        // as hard constraints; a memory overcommit ratio is applied by the
+        // scheduler against the unclamped `committedMemory` reported below.
         var reservedCPU = 0
         var reservedMemory: Int64 = 0
 
@@ -1813,7 +2191,8 @@ actor Agent {
             totalMemory: totalMemory,
             availableMemory: availableMemory,
             totalDisk: totalDisk,
-            availableDisk: availableDisk
+            availableDisk: availableDisk,
+            committedMemory: reservedMemory
         )
     }
 
@@ -1962,13 +2341,46 @@ extension Agent {
                 // control plane older than the sandbox protocol (v5) omits
                 // `sandboxes` (decoded as []), which must NOT be read as
                 // "tear down all sandboxes" under full-list semantics.
+                // TPM state keys (wire v32) before the reconciler, so a VM
+                // this sync creates or boots starts its swtpm with its key.
+                installTPMStateKeys(message.vms)
                 await reconciler?.apply(
                     message, includeSandboxes: WireProtocol.supportsSandboxSync(envelope.senderVersion))
+                // Health checks (wire v31) ride every sync; an older control
+                // plane never sends one, so no gate is needed.
+                desiredHealthChecks = message.vms.reduce(into: [:]) { checks, vm in
+                    guard vm.desiredStatus == .running, let check = vm.healthCheck else { return }
+                    checks[vm.vmId.uuidString] = (check, vm.spec)
+                }
                 // Declarative agent self-update (issue #434), after the
                 // reconciler so freshly enqueued work items are visible to the
                 // precondition gate — the update only runs on a sync that
                 // arrives with the lanes already drained.
                 await handleDesiredAgentUpdate(message.desiredAgentUpdate)
+                // File shares (wire v24): nil is "no opinion", never "delete
+                // every share". Converged off the lane — a snapshot copy can
+                // take minutes — and reported as soon as the pass settles.
+                if WireProtocol.supportsFileShares(envelope.senderVersion), let desiredShares = message.fileShares,
+                    let fileShares
+                {
+                    Task { [weak self] in
+                        await fileShares.submit(desiredShares)
+                        await self?.sendObservedStateReport()
+                    }
+                }
+                // Memory overcommit policy (wire v26): nil is "no opinion".
+                if WireProtocol.supportsMemoryOvercommit(envelope.senderVersion),
+                    let policy = message.memoryOvercommit
+                {
+                    await applyMemoryOvercommit(policy)
+                }
+                // Buckets, grants and credentials (wire v25): nil is "no
+                // opinion". Applying is quick, so it stays on the lane.
+                if WireProtocol.supportsObjectStorage(envelope.senderVersion),
+                    let desiredStorage = message.objectStorage, let objectGateway
+                {
+                    await objectGateway.submit(desiredStorage)
+                }
             case .networkCreate:
                 let message = try envelope.decode(as: NetworkCreateMessage.self)
                 await handleNetworkCreate(message)
@@ -2050,6 +2462,28 @@ extension Agent {
             case .volumeInfo:
                 let message = try envelope.decode(as: VolumeInfoMessage.self)
                 await handleVolumeInfo(message)
+            case .volumeExport:
+                let message = try envelope.decode(as: VolumeExportMessage.self)
+                await handleVolumeExport(message)
+            case .volumeImport:
+                let message = try envelope.decode(as: VolumeImportMessage.self)
+                await handleVolumeImport(message)
+            case .volumeNBDExport:
+                let message = try envelope.decode(as: VolumeNBDExportMessage.self)
+                await handleVolumeNBDExport(message)
+            case .volumeNBDUnexport:
+                let message = try envelope.decode(as: VolumeNBDUnexportMessage.self)
+                await handleVolumeNBDUnexport(message)
+            case .volumeMirror:
+                let message = try envelope.decode(as: VolumeMirrorMessage.self)
+                await handleVolumeMirror(message)
+            // Image builds (wire v33)
+            case .vmGuestExec:
+                let message = try envelope.decode(as: VMGuestExecMessage.self)
+                await handleVMGuestExec(message)
+            case .vmDiskExport:
+                let message = try envelope.decode(as: VMDiskExportMessage.self)
+                await handleVMDiskExport(message)
             case .success:
                 // ACK to a control-plane-initiated request (incl. every heartbeat).
                 // Logged at debug so it stops surfacing as "unknown message type".
@@ -3148,6 +3582,9 @@ extension Agent {
         }
 
         do {
+            // A migrated volume may still be served to a VM elsewhere; stop
+            // serving it before its file goes away.
+            await nbdExports?.unexport(volumeId: message.volumeId)
             try await storageBackend.deleteVolume(volumeId: message.volumeId)
             await sendSuccess(for: message.requestId, message: "Volume deleted successfully")
             logger.info("Volume deleted successfully", metadata: ["volumeId": .string(message.volumeId)])
@@ -3183,7 +3620,9 @@ extension Agent {
                 volumeId: message.volumeId,
                 volumePath: message.volumePath,
                 deviceName: message.deviceName,
-                readonly: message.readonly
+                readonly: message.readonly,
+                qos: message.qos,
+                shared: message.shared
             )
 
             let response = VolumeStatusResponse(
@@ -3514,6 +3953,256 @@ extension Agent {
                 ])
         }
     }
+
+    // MARK: - Image Build Handlers (wire v33)
+
+    /// Runs one provisioner command in a build VM. The command's own failure
+    /// is a `success` carrying its exit status: only a command that could not
+    /// run, or outlived its timeout, is an `error`.
+    private func handleVMGuestExec(_ message: VMGuestExecMessage) async {
+        guard let qemu = getHypervisorServiceForVM(vmId: message.vmId) as? QEMUService else {
+            await sendError(for: message.requestId, error: "Guest commands need the QEMU guest agent")
+            return
+        }
+        do {
+            let result = try await qemu.guestExec(
+                vmId: message.vmId, command: message.command, timeoutSeconds: message.timeoutSeconds)
+            let response = VMGuestExecResponse(exitCode: result.exitCode, signal: result.signal, output: result.output)
+            let data = try AnyCodableValue(response)
+            await sendSuccess(for: message.requestId, message: "Guest command finished", data: data)
+        } catch {
+            await sendError(
+                for: message.requestId, error: "Guest command could not run: \(error.localizedDescription)")
+            logger.warning(
+                "Guest command failed to run",
+                metadata: [
+                    "vmId": .string(message.vmId),
+                    "error": .string(error.localizedDescription),
+                ])
+        }
+    }
+
+    /// Flattens a stopped build VM's boot disk and uploads it. The VM must
+    /// have been observed shut down: a running or paused guest's QEMU still
+    /// holds the overlay open for writing.
+    private func handleVMDiskExport(_ message: VMDiskExportMessage) async {
+        logger.info("Exporting VM boot disk", metadata: ["vmId": .string(message.vmId)])
+
+        guard let storageBackend = storageBackend, let transfer = volumeCopyTransfer else {
+            await sendError(for: message.requestId, error: "Storage backend not available")
+            return
+        }
+        guard let service = getHypervisorServiceForVM(vmId: message.vmId) else {
+            await sendError(for: message.requestId, error: "VM \(message.vmId) is not managed by this agent")
+            return
+        }
+
+        do {
+            let status = try await service.getVMStatus(vmId: message.vmId)
+            guard status == .shutdown else {
+                await sendError(
+                    for: message.requestId, error: "VM \(message.vmId) must be stopped to export its disk (\(status))")
+                return
+            }
+            let diskPath = "\(vmStoragePath)/\(message.vmId)/disk.qcow2"
+            try await storageBackend.exportBootDisk(vmId: message.vmId, diskPath: diskPath) { filePath in
+                try await transfer.upload(volumeId: message.vmId, filePath: filePath, to: message.uploadURL)
+            }
+            await sendSuccess(for: message.requestId, message: "VM disk exported successfully")
+            logger.info("VM boot disk exported", metadata: ["vmId": .string(message.vmId)])
+        } catch {
+            await sendError(for: message.requestId, error: "Failed to export VM disk: \(error.localizedDescription)")
+            logger.error(
+                "Failed to export VM boot disk",
+                metadata: [
+                    "vmId": .string(message.vmId),
+                    "error": .string(error.localizedDescription),
+                ])
+        }
+    }
+
+    // MARK: - Volume Migration Handlers
+
+    private func handleVolumeExport(_ message: VolumeExportMessage) async {
+        logger.info(
+            "Exporting volume for migration",
+            metadata: [
+                "volumeId": .string(message.volumeId),
+                "volumePath": .string(message.volumePath),
+            ])
+
+        guard let storageBackend = storageBackend, let transfer = volumeCopyTransfer else {
+            await sendError(for: message.requestId, error: "Storage backend not available")
+            return
+        }
+
+        do {
+            try await storageBackend.exportVolume(volumeId: message.volumeId, volumePath: message.volumePath) {
+                filePath in
+                try await transfer.upload(volumeId: message.volumeId, filePath: filePath, to: message.uploadURL)
+            }
+            await sendSuccess(for: message.requestId, message: "Volume exported successfully")
+            logger.info("Volume exported successfully", metadata: ["volumeId": .string(message.volumeId)])
+        } catch {
+            await sendError(for: message.requestId, error: "Failed to export volume: \(error.localizedDescription)")
+            logger.error(
+                "Failed to export volume",
+                metadata: [
+                    "volumeId": .string(message.volumeId),
+                    "error": .string(error.localizedDescription),
+                ])
+        }
+    }
+
+    private func handleVolumeImport(_ message: VolumeImportMessage) async {
+        logger.info(
+            "Importing migrated volume",
+            metadata: [
+                "volumeId": .string(message.volumeId),
+                "format": .string(message.format),
+                "sizeBytes": .stringConvertible(message.sizeBytes),
+            ])
+
+        guard let storageBackend = storageBackend, let transfer = volumeCopyTransfer else {
+            await sendError(for: message.requestId, error: "Storage backend not available")
+            return
+        }
+
+        guard let format = DiskFormat(rawValue: message.format) else {
+            await sendError(for: message.requestId, error: "Unsupported volume format: \(message.format)")
+            return
+        }
+
+        do {
+            let attachment = try await storageBackend.importVolume(volumeId: message.volumeId, format: format) {
+                stagingPath in
+                try await transfer.download(message, to: stagingPath)
+            }
+
+            let response = VolumeStatusResponse(
+                volumeId: message.volumeId,
+                status: "available",
+                storagePath: attachment.path
+            )
+            let data = try AnyCodableValue(response)
+            await sendSuccess(for: message.requestId, message: "Volume imported successfully", data: data)
+            logger.info(
+                "Volume imported successfully",
+                metadata: [
+                    "volumeId": .string(message.volumeId),
+                    "path": .string(attachment.path),
+                ])
+        } catch {
+            await sendError(for: message.requestId, error: "Failed to import volume: \(error.localizedDescription)")
+            logger.error(
+                "Failed to import volume",
+                metadata: [
+                    "volumeId": .string(message.volumeId),
+                    "error": .string(error.localizedDescription),
+                ])
+        }
+    }
+
+    private func handleVolumeNBDExport(_ message: VolumeNBDExportMessage) async {
+        logger.info(
+            "Exporting volume over NBD",
+            metadata: [
+                "volumeId": .string(message.volumeId),
+                "size": .stringConvertible(message.size),
+            ])
+
+        guard let storageBackend = storageBackend else {
+            await sendError(for: message.requestId, error: "Storage backend not available")
+            return
+        }
+        guard let nbdExports else {
+            await sendError(
+                for: message.requestId,
+                error: "NBD exports are not configured on this agent (set volume_nbd_address)")
+            return
+        }
+
+        do {
+            // A retry must not recreate the file under a mirror that may
+            // already be writing into it.
+            let path: String
+            if let record = await nbdExports.record(for: message.volumeId) {
+                path = record.path
+            } else {
+                path = try await storageBackend.createVolume(
+                    volumeId: message.volumeId, sizeBytes: message.size, format: .raw
+                ).path
+            }
+            let endpoint = try await nbdExports.export(volumeId: message.volumeId, path: path)
+
+            let response = VolumeNBDExportResponse(volumeId: message.volumeId, storagePath: path, endpoint: endpoint)
+            let data = try AnyCodableValue(response)
+            await sendSuccess(for: message.requestId, message: "Volume exported over NBD", data: data)
+            logger.info(
+                "Volume exported over NBD",
+                metadata: [
+                    "volumeId": .string(message.volumeId),
+                    "endpoint": .string(endpoint.uri),
+                ])
+        } catch {
+            await sendError(
+                for: message.requestId, error: "Failed to export volume over NBD: \(error.localizedDescription)")
+            logger.error(
+                "Failed to export volume over NBD",
+                metadata: [
+                    "volumeId": .string(message.volumeId),
+                    "error": .string(error.localizedDescription),
+                ])
+        }
+    }
+
+    private func handleVolumeNBDUnexport(_ message: VolumeNBDUnexportMessage) async {
+        logger.info("Stopping NBD export", metadata: ["volumeId": .string(message.volumeId)])
+        await nbdExports?.unexport(volumeId: message.volumeId)
+        await sendSuccess(for: message.requestId, message: "Volume NBD export stopped")
+    }
+
+    private func handleVolumeMirror(_ message: VolumeMirrorMessage) async {
+        logger.info(
+            "Mirroring attached volume",
+            metadata: [
+                "volumeId": .string(message.volumeId),
+                "vmId": .string(message.vmId),
+                "target": .string(message.target.uri),
+            ])
+
+        // Block mirroring is QEMU-only; the control plane gates on it, so
+        // anything else reaching here is a stale or misrouted request.
+        guard let qemu = getHypervisorServiceForVM(vmId: message.vmId) as? QEMUService else {
+            await sendError(for: message.requestId, error: "Volume mirroring requires a QEMU VM")
+            return
+        }
+
+        do {
+            try await qemu.mirrorDisk(
+                vmId: message.vmId,
+                volumeId: message.volumeId,
+                volumePath: message.volumePath,
+                target: message.target
+            )
+            await sendSuccess(for: message.requestId, message: "Volume mirrored successfully")
+            logger.info(
+                "Volume mirrored successfully",
+                metadata: [
+                    "volumeId": .string(message.volumeId),
+                    "vmId": .string(message.vmId),
+                ])
+        } catch {
+            await sendError(for: message.requestId, error: "Failed to mirror volume: \(error.localizedDescription)")
+            logger.error(
+                "Failed to mirror volume",
+                metadata: [
+                    "volumeId": .string(message.volumeId),
+                    "vmId": .string(message.vmId),
+                    "error": .string(error.localizedDescription),
+                ])
+        }
+    }
 }
 
 // MARK: - Reconciliation (issue #260)
@@ -3547,10 +4236,16 @@ extension Agent: ReconcileActuator {
         managedVMs.mapValues {
             VMSizing(
                 cpus: $0.spec.cpus, memoryBytes: $0.spec.memoryBytes,
-                balloonTargetBytes: $0.spec.balloonTargetBytes)
+                balloonTargetBytes: $0.spec.balloonTargetBytes, memoryFloorBytes: $0.spec.memoryFloorBytes)
         }
     }
 
+    /// The replacement count each VM was created at, orphans included, so
+    /// a replacement asked of an orphan isn't lost behind its re-adoption.
+    func observedReplacements() async -> [String: Int64] {
+        managedVMs.merging(orphanedVMs) { managed, _ in managed }.mapValues(\.replacementCount)
+    }
+
     func adoptVM(_ item: ReconcileWorkItem) async throws -> VMStatus {
         guard let entry = orphanedVMs[item.vmId] else {
             // A replayed sync may race re-adoption; if the VM is already
@@ -3585,7 +4280,8 @@ extension Agent: ReconcileActuator {
             return .created
         }
 
-        managedVMs[item.vmId] = VMManifestEntry(hypervisorType: entry.hypervisorType, spec: spec)
+        managedVMs[item.vmId] = VMManifestEntry(
+            hypervisorType: entry.hypervisorType, spec: spec, replacementCount: entry.replacementCount)
         orphanedVMs.removeValue(forKey: item.vmId)
         persistManifest()
 
@@ -3677,7 +4373,7 @@ extension Agent: ReconcileActuator {
         case .create:
             try await reconcileCreate(item)
         case .boot:
-            try await reconcileService(for: item.vmId).bootVM(vmId: item.vmId)
+            try await reconcileBoot(item)
         case .pause:
             try await reconcileService(for: item.vmId).pauseVM(vmId: item.vmId)
         case .resume:
@@ -3688,6 +4384,8 @@ extension Agent: ReconcileActuator {
             try await reconcileService(for: item.vmId).shutdownVM(vmId: item.vmId)
         case .delete:
             try await reconcileDelete(item)
+        case .replace:
+            try await reconcileReplace(item)
         }
     }
 
@@ -3724,7 +4422,9 @@ extension Agent: ReconcileActuator {
             throw error
         }
 
-        managedVMs[item.vmId] = VMManifestEntry(hypervisorType: desired.hypervisorType, spec: desired.spec)
+        managedVMs[item.vmId] = VMManifestEntry(
+            hypervisorType: desired.hypervisorType, spec: desired.spec,
+            replacementCount: desired.replacementCount ?? 0)
         orphanedVMs.removeValue(forKey: item.vmId)
         persistManifest()
         await sendVMLog(
@@ -3732,6 +4432,25 @@ extension Agent: ReconcileActuator {
             message: "VM created by reconciliation", operation: "create", newStatus: .created)
     }
 
+    /// Replaces a VM from its image (wire v31): deletes it like an undesired
+    /// VM, discards its boot disk so materialization can't reuse it, and
+    /// creates it again, recording the new replacement count. Attached
+    /// volumes are untouched — only what the image provides starts over.
+    private func reconcileReplace(_ item: ReconcileWorkItem) async throws {
+        guard let desired = item.desired else {
+            throw HypervisorServiceError.invalidConfiguration("replace work item without a desired entry")
+        }
+        guard let service = getHypervisorService(for: desired.hypervisorType) else {
+            throw HypervisorServiceError.hypervisorNotInstalled(desired.hypervisorType.rawValue)
+        }
+        try await reconcileDelete(item)
+        try await service.discardBootDisk(vmId: item.vmId)
+        try await reconcileCreate(item)
+        await sendVMLog(
+            vmId: item.vmId, level: .warning, eventType: .operation,
+            message: "VM replaced from its image", operation: "replace")
+    }
+
     /// Applies a running VM's new vCPU/memory sizing (issue #568) and records
     /// it in the manifest, so the next sync diffs against what the VM is now
     /// actually running with instead of re-planning the same resize forever.
@@ -3739,6 +4458,17 @@ extension Agent: ReconcileActuator {
     /// The manifest write happens only after the driver reports success:
     /// recording the new sizing first would make a failed resize look applied
     /// and silently strand the VM at its old size.
+    /// Boots a VM, first bringing its variable store in line with the
+    /// desired spec's Secure Boot keys (wire v29): keys change only while a
+    /// VM is stopped, and the boot that follows is when they must hold.
+    private func reconcileBoot(_ item: ReconcileWorkItem) async throws {
+        let service = try reconcileService(for: item.vmId)
+        if let spec = item.desired?.spec, spec.effectiveMachine.secureBoot {
+            try await service.updateSecureBootKeys(vmId: item.vmId, spec: spec)
+        }
+        try await service.bootVM(vmId: item.vmId)
+    }
+
     private func reconcileResize(_ item: ReconcileWorkItem) async throws {
         guard let desired = item.desired else {
             throw HypervisorServiceError.invalidConfiguration("resize work item without a desired entry")
@@ -3749,7 +4479,8 @@ extension Agent: ReconcileActuator {
         let service = try reconcileService(for: item.vmId)
         try await service.resizeVM(vmId: item.vmId, spec: desired.spec)
 
-        managedVMs[item.vmId] = VMManifestEntry(hypervisorType: entry.hypervisorType, spec: desired.spec)
+        managedVMs[item.vmId] = VMManifestEntry(
+            hypervisorType: entry.hypervisorType, spec: desired.spec, replacementCount: entry.replacementCount)
         persistManifest()
         await sendVMLog(
             vmId: item.vmId, level: .info, eventType: .operation,
@@ -3832,7 +4563,7 @@ extension Agent: ReconcileActuator {
             try await requireSandboxRuntime().shutdownSandbox(sandboxId: item.id)
         case .delete:
             try await sandboxReconcileDelete(item)
-        case .pause, .resume, .resize:
+        case .pause, .resume, .resize, .replace:
             // Not in the sandbox step vocabulary (v1); the planner never
             // emits these for sandbox items.
             throw SandboxRuntimeError.unsupportedStep(String(describing: step))
@@ -3941,11 +4672,14 @@ extension Agent: ReconcileActuator {
                     convergencePhase: await reconciler.convergencePhase(for: vmId),
                     lastError: await reconciler.lastError(for: vmId),
                     failedGeneration: await reconciler.failedGeneration(for: vmId),
-                    // Last-known guest-agent view (issue #563) and balloon
-                    // memory stats (issue #567); nil until the slow poll first
-                    // sees a responsive qga / reporting balloon on this VM.
+                    // Last-known guest-agent view (issue #563), balloon
+                    // memory stats (issue #567) and vCPU utilization; nil
+                    // until the slow poll first sees a responsive qga /
+                    // reporting balloon / second vCPU reading on this VM.
                     guestInfo: guestInfoCache[vmId],
-                    memoryStats: memoryStatsCache[vmId]
+                    memoryStats: memoryStatsCache[vmId],
+                    cpuUtilization: cpuUtilizationCache[vmId],
+                    health: healthTracker.observation(for: vmId)
                 ))
             reported.insert(vmId)
         }
@@ -4008,7 +4742,9 @@ extension Agent: ReconcileActuator {
             vms: observed,
             sandboxes: await observedSandboxStates(reconciler: reconciler),
             resources: await getAgentResources(),
-            agentUpdateStatus: autoUpdateStatus
+            agentUpdateStatus: autoUpdateStatus,
+            fileShares: await fileShares?.observedStates() ?? [],
+            buckets: await objectGateway?.observedStates() ?? []
         )
         // A newer report started while this one was assembling — which is
         // exactly what happens when this one overran its budget and was
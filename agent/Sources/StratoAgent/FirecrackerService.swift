@@ -277,6 +277,16 @@ actor FirecrackerService: HypervisorService {
         logger.info("Firecracker VM deleted", metadata: ["vmId": .string(vmId)])
     }
 
+    func discardBootDisk(vmId: String) async throws {
+        guard vmManagers[vmId] == nil else {
+            throw HypervisorServiceError.invalidConfiguration("VM \(vmId) must be deleted before its disk is discarded")
+        }
+        let rootfsPath = "\(vmStoragePath)/\(vmId)/rootfs.raw"
+        guard FileManager.default.fileExists(atPath: rootfsPath) else { return }
+        try FileManager.default.removeItem(atPath: rootfsPath)
+        logger.info("Discarded Firecracker VM rootfs", metadata: ["vmId": .string(vmId)])
+    }
+
     func getVMStatus(vmId: String) async throws -> VMStatus {
         // An absent entry means this service does not manage the VM at all; report
         // that honestly instead of fabricating `.shutdown` (see QEMUService).
@@ -392,8 +402,10 @@ actor FirecrackerService: HypervisorService {
     }
 
     /// Firecracker does not support hot-plugging drives into a running microVM.
-    func attachDisk(vmId: String, volumeId: String, volumePath: String, deviceName: String, readonly: Bool) async throws
-    {
+    func attachDisk(
+        vmId: String, volumeId: String, volumePath: String, deviceName: String, readonly: Bool, qos: VolumeQoS?,
+        shared: Bool
+    ) async throws {
         guard vmManagers[vmId] != nil else {
             throw HypervisorServiceError.vmNotFound(vmId)
         }
@@ -472,8 +484,10 @@ actor FirecrackerService: HypervisorService {
         throw HypervisorServiceError.notSupported("Firecracker is only available on Linux")
     }
 
-    func attachDisk(vmId: String, volumeId: String, volumePath: String, deviceName: String, readonly: Bool) async throws
-    {
+    func attachDisk(
+        vmId: String, volumeId: String, volumePath: String, deviceName: String, readonly: Bool, qos: VolumeQoS?,
+        shared: Bool
+    ) async throws {
         throw HypervisorServiceError.notSupported("Firecracker is only available on Linux")
     }
 
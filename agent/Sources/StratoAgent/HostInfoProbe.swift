@@ -1,4 +1,5 @@
 import Foundation
+import StratoAgentCore
 import StratoShared
 
 #if canImport(Glibc)
@@ -12,14 +13,16 @@ import Darwin
 /// a value that can't be read (missing file, unsupported sysctl, parse miss)
 /// stays `nil` rather than failing the whole gather, since none of it is load
 /// bearing — the scheduler uses the typed `CPUArchitecture`/`HypervisorSupport`
-/// fields, not this.
+/// fields, not this. The exception is `supportedCPUModels` (wire v28), which
+/// the caller probes through QEMU and passes in: placement of guests with a
+/// named CPU model keys on it.
 ///
 /// Reads are cheap and the values are effectively static for the process's
 /// lifetime, but the agent re-probes on every (re)registration alongside its
 /// other capability probes so a kernel upgrade or hardware change is reflected
 /// after the next reconnect.
 enum HostInfoProbe {
-    static func gather() -> HostInfo {
+    static func gather(supportedCPUModels: [String]? = nil) -> HostInfo {
         HostInfo(
             osName: osName(),
             kernelVersion: kernelVersion(),
@@ -29,7 +32,9 @@ enum HostInfoProbe {
             logicalCoreCount: ProcessInfo.processInfo.activeProcessorCount,
             totalMemoryBytes: Int64(clamping: ProcessInfo.processInfo.physicalMemory),
             machineModel: machineModel(),
-            bootTime: bootTime()
+            bootTime: bootTime(),
+            cpuFlags: cpuFlags(),
+            supportedCPUModels: supportedCPUModels
         )
     }
 
@@ -65,10 +70,18 @@ enum HostInfoProbe {
         firstCPUInfoValue(key: "model name")
     }
 
-    private static func cpuVendor() -> String? {
+    static func cpuVendor() -> String? {
         firstCPUInfoValue(key: "vendor_id")
     }
 
+    private static func cpuFlags() -> [String]? {
+        guard let contents = try? String(contentsOfFile: "/proc/cpuinfo", encoding: .utf8) else {
+            return nil
+        }
+        let flags = GuestCPUModels.flags(cpuinfo: contents)
+        return flags.isEmpty ? nil : flags
+    }
+
     /// Distinct physical cores across all sockets: count unique
     /// (physical id, core id) pairs in /proc/cpuinfo. Falls back to `nil` when
     /// the fields are absent (e.g. some ARM hosts), letting the UI show only
@@ -175,7 +188,7 @@ enum HostInfoProbe {
         sysctlString("machdep.cpu.brand_string")
     }
 
-    private static func cpuVendor() -> String? {
+    static func cpuVendor() -> String? {
         // Populated on Intel; empty on Apple Silicon, where the vendor is Apple.
         if let vendor = sysctlString("machdep.cpu.vendor"), !vendor.isEmpty {
             return vendor
@@ -183,6 +196,12 @@ enum HostInfoProbe {
         return CPUArchitecture.current == .arm64 ? "Apple" : nil
     }
 
+    private static func cpuFlags() -> [String]? {
+        // Intel Macs only; Apple Silicon exposes no equivalent list.
+        guard let features = sysctlString("machdep.cpu.features") else { return nil }
+        return Set(features.lowercased().split(separator: " ").map(String.init)).sorted()
+    }
+
     private static func physicalCoreCount() -> Int? {
         sysctlInt("hw.physicalcpu")
     }
@@ -223,7 +242,7 @@ enum HostInfoProbe {
 
     private static func osName() -> String? { nil }
     private static func cpuModel() -> String? { nil }
-    private static func cpuVendor() -> String? { nil }
+    static func cpuVendor() -> String? { nil }
     private static func physicalCoreCount() -> Int? { nil }
     private static func machineModel() -> String? { nil }
     private static func bootTime() -> Date? { nil }
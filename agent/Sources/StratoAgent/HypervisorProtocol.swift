@@ -87,10 +87,15 @@ public protocol HypervisorService: Actor, Sendable {
     ///   console mechanism at all
     func consoleEndpoint(vmId: String) async throws -> ConsoleEndpoint?
 
-    /// Attaches a disk to a running VM (hot-plug)
+    /// Attaches a disk to a running VM (hot-plug), throttled to `qos` when the
+    /// volume's type sets I/O limits, and opened without an exclusive image
+    /// lock when `shared` (a multi-attach volume other VMs also hold)
     /// - Throws: `HypervisorServiceError.notSupported` if this backend cannot
     ///   hot-plug disks
-    func attachDisk(vmId: String, volumeId: String, volumePath: String, deviceName: String, readonly: Bool) async throws
+    func attachDisk(
+        vmId: String, volumeId: String, volumePath: String, deviceName: String, readonly: Bool, qos: VolumeQoS?,
+        shared: Bool
+    ) async throws
 
     /// Detaches a disk from a running VM (hot-unplug)
     /// - Throws: `HypervisorServiceError.notSupported` if this backend cannot
@@ -105,10 +110,20 @@ public protocol HypervisorService: Actor, Sendable {
     ///   resize a running VM at all
     func resizeVM(vmId: String, spec: VMSpec) async throws
 
+    /// Enrolls the Secure Boot keys in `spec` into a stopped VM's variable
+    /// store (wire v29), so its next boot enforces them. Called before every
+    /// reconciled boot; a no-op when the store already holds those keys.
+    func updateSecureBootKeys(vmId: String, spec: VMSpec) async throws
+
     /// Sum of vCPUs and memory (in bytes) committed to VMs this service manages.
     /// Used to compute accurate available-resource figures for the scheduler.
     func reservedResources() async -> (vcpus: Int, memoryBytes: Int64)
 
+    /// Removes a deleted VM's boot disk, so the next create materializes it
+    /// afresh from the image instead of reusing it. Replacing a VM (wire v31)
+    /// is delete, this, then create.
+    func discardBootDisk(vmId: String) async throws
+
     /// Re-adopts a VM whose hypervisor process survived an agent restart
     /// (reconciliation phase 2, issue #260): reconnects the control session
     /// and returns the VM's observed status. Backends without a reattachable
@@ -127,6 +142,17 @@ public extension HypervisorService {
             "\(hypervisorType.displayName) does not support resizing a running VM")
     }
 
+    /// Backends without a UEFI variable store have no keys to enroll; the
+    /// scheduler only sends custom keys to agents that advertise enrollment.
+    func updateSecureBootKeys(vmId: String, spec: VMSpec) async throws {}
+
+    /// Backends must opt in to replacement; without an explicit
+    /// implementation a replace fails rather than recreate the old disk.
+    func discardBootDisk(vmId: String) async throws {
+        throw HypervisorServiceError.notSupported(
+            "\(hypervisorType.displayName) does not support replacing a VM from its image")
+    }
+
     /// Backends must opt in to orphan re-adoption; without an explicit
     /// implementation an orphan cannot be reattached.
     func adoptVM(vmId: String, spec: VMSpec) async throws -> VMStatus {
@@ -118,8 +118,10 @@ actor MockHypervisorService: HypervisorService {
         )
     }
 
-    func attachDisk(vmId: String, volumeId: String, volumePath: String, deviceName: String, readonly: Bool) async throws
-    {
+    func attachDisk(
+        vmId: String, volumeId: String, volumePath: String, deviceName: String, readonly: Bool, qos: VolumeQoS?,
+        shared: Bool
+    ) async throws {
         logger.info(
             "Mock: attaching disk to VM (mock mode)",
             metadata: [
@@ -88,6 +88,11 @@ actor NetworkServiceLinux: NetworkServiceProtocol {
     static let externalRoleKey = "strato-role"
     static let externalRoleValue = "external"
 
+    /// Marks a BYOIP prefix's `discard` static route, the one the router
+    /// announces the whole prefix with. Static routes are otherwise left to
+    /// their own owners, so only rows carrying this key are converged.
+    static let advertisedPrefixKey = "strato-advertised-prefix"
+
     /// Whether an OVN object's external-ids mark it as created by this reconciler.
     static func isManaged(_ externalIDs: [String: String]?) -> Bool {
         externalIDs?[managedKey] == managedValue
@@ -205,7 +210,8 @@ actor NetworkServiceLinux: NetworkServiceProtocol {
         // would split the network. Failing is safe: the VM's reconcile lane
         // retries after the controller's level-triggered sync realizes it.
         if topologyAuthority {
-            _ = try await findOrCreateLogicalSwitch(name: switchName, subnet: config.subnet ?? "10.0.0.0/24")
+            _ = try await findOrCreateLogicalSwitch(
+                name: switchName, subnet: config.subnet ?? config.subnet6 ?? "10.0.0.0/24")
         } else if try await ovnManager?.getLogicalSwitch(named: switchName) == nil {
             // Waiting, not failing: the reconciler must not report this as an
             // error (that would fail the pending create operation before the
@@ -995,9 +1001,13 @@ actor NetworkServiceLinux: NetworkServiceProtocol {
                 networkName: config.networkName, subnet: subnet, gateway: gateway,
                 dnsServers: config.dnsServers, domainName: config.domainName, leaseTime: config.leaseTime)
         } else {
-            logger.warning(
-                "DHCP enabled but subnet/gateway unknown; using static guest config",
-                metadata: ["network": .string(config.networkName)])
+            // An IPv6-only network has no v4 side to serve; only a network
+            // with neither family known is worth a warning.
+            if config.subnet6 == nil {
+                logger.warning(
+                    "DHCP enabled but subnet/gateway unknown; using static guest config",
+                    metadata: ["network": .string(config.networkName)])
+            }
             v4 = nil
         }
 
@@ -1218,7 +1228,7 @@ extension NetworkServiceLinux {
                 try await removeDHCPOptions(networkName: network.name)
                 return
             }
-            if let gateway = network.gateway, let cidr = IPv4CIDR(network.subnet) {
+            if let gateway = network.gateway, let cidr = network.subnet.flatMap(IPv4CIDR.init) {
                 // Masked, so the row key matches what the NIC path derives
                 // from ip+netmask (the stored subnet may carry host bits).
                 _ = try await ensureDHCPOptions(
@@ -1634,8 +1644,15 @@ extension NetworkServiceLinux: NetworkActuator {
             // Router: enable + what to redistribute. `withoutDynamicRouting()`
             // first, so an option removed from the config (e.g. vrf_name) is
             // dropped rather than lingering.
-            let redistribute = Set(
+            var redistribute = Set(
                 config.redistribute.compactMap { OVNDynamicRoutingRedistribute(rawValue: $0) })
+            // BYOIP prefixes are announced as static routes, so a router
+            // carrying one redistributes `static` whatever the config says.
+            if !router.advertisedPrefixes.isEmpty,
+                let staticRoutes = OVNDynamicRoutingRedistribute(rawValue: "static")
+            {
+                redistribute.insert(staticRoutes)
+            }
             let desired = lr.withoutDynamicRouting().withDynamicRouting(
                 enabled: true, redistribute: redistribute, vrfName: config.vrfName)
             if (lr.options ?? [:]) != (desired.options ?? [:]) {
@@ -1660,6 +1677,7 @@ extension NetworkServiceLinux: NetworkActuator {
                     try await ovnManager.updateLogicalRouterPort(uuid: portUUID, desiredPort)
                 }
             }
+            try await convergeAdvertisedPrefixes(router: router.name, desired: router.advertisedPrefixes)
         } else {
             // Converge off: strip any dynamic-routing options this agent set
             // earlier. The row encoder omits nil maps (which would leave the
@@ -1684,10 +1702,50 @@ extension NetworkServiceLinux: NetworkActuator {
                             options: strippedPortOptions ?? [:]))
                 }
             }
+            try await convergeAdvertisedPrefixes(router: router.name, desired: [])
         }
         #endif
     }
 
+    #if os(Linux)
+    /// Make the router's BYOIP `discard` routes exactly `desired`. A discard
+    /// route never carries traffic for an attached floating IP — its
+    /// `dnat_and_snat` rule answers first — so it only gives `static`
+    /// redistribution the aggregate to announce, and drops traffic for the
+    /// prefix's unattached addresses at the edge rather than the uplink.
+    private func convergeAdvertisedPrefixes(router routerName: String, desired: [String]) async throws {
+        guard let ovnManager else {
+            throw NetworkError.notConnected("OVN manager not connected")
+        }
+        let existing = try await staticRoutes(onRouter: routerName).filter {
+            Self.isManaged($0.external_ids) && $0.external_ids?[Self.advertisedPrefixKey] != nil
+        }
+        var present = Set<String>()
+        for route in existing {
+            let prefix = route.external_ids?[Self.advertisedPrefixKey] ?? ""
+            if desired.contains(prefix), route.ip_prefix == prefix, route.nexthop == "discard",
+                !present.contains(prefix)
+            {
+                present.insert(prefix)
+                continue
+            }
+            if let uuid = route.uuid { try await ovnManager.deleteStaticRoute(uuid: uuid) }
+            logger.info(
+                "Withdrew BYOIP prefix from router",
+                metadata: ["router": .string(routerName), "prefix": .string(prefix)])
+        }
+        for prefix in desired where !present.contains(prefix) {
+            let route = OVNLogicalRouterStaticRoute(
+                ip_prefix: prefix, nexthop: "discard",
+                external_ids: [Self.managedKey: Self.managedValue, Self.advertisedPrefixKey: prefix])
+            _ = try await ovnManager.createStaticRoute(route, onRouter: routerName)
+            logger.info(
+                "Announcing BYOIP prefix from router",
+                metadata: ["router": .string(routerName), "prefix": .string(prefix)])
+        }
+    }
+    #endif
+
     func removeSwitchRouterPort(name: String) async throws {
         #if os(Linux)
         try? await ovnManager?.deleteLogicalSwitchPort(named: name)
@@ -2061,6 +2119,99 @@ extension NetworkServiceLinux {
 }
 #endif
 
+// MARK: - File-share server ports
+
+extension NetworkServiceLinux: FileShareNetworking {
+    /// Realizes a file share's NFS server port the way Neutron does its DHCP
+    /// ports: an OVN logical switch port with the share's MAC and address,
+    /// bound to an OVS internal interface that lives in the share's own
+    /// network namespace. The server process runs in that namespace, so it
+    /// is reachable only on the project network — never on the host's.
+    func ensureServerPort(shareId: UUID, endpoint: NetworkSpec) async throws -> String {
+        #if os(Linux)
+        guard isConnected, let ovnManager else {
+            throw NetworkError.notConnected("Network service is not connected")
+        }
+        guard let networkId = endpoint.networkId, let ipAddress = endpoint.ipAddress,
+            let prefix = endpoint.netmask.flatMap(IPv4Address.init)?.prefixLength
+        else {
+            throw NetworkError.invalidConfiguration("File share endpoint for \(shareId) lacks a network address")
+        }
+        let switchName = OVNNaming.switchName(networkId: networkId)
+        guard try await ovnManager.getLogicalSwitch(named: switchName) != nil else {
+            // Same wait as a VM NIC on a network not realized yet (issue #343).
+            throw DependencyPendingError(
+                "logical switch \(switchName) does not exist yet; waiting for it to be realized")
+        }
+
+        let portName = OVNNaming.fileSharePortName(shareId: shareId)
+        let macAddress = endpoint.macAddress ?? generateMACAddress()
+        if try await ovnManager.getLogicalSwitchPort(named: portName) == nil {
+            let logicalPort = OVNLogicalSwitchPort(
+                name: portName,
+                addresses: [Self.portAddressEntry(mac: macAddress, ips: [ipAddress])],
+                port_security: [Self.portSecurityEntry(mac: macAddress, ips: [ipAddress])],
+                external_ids: [
+                    "file-share-id": shareId.uuidString,
+                    "network-name": endpoint.network,
+                    "description": "File share NFS server",
+                ]
+            )
+            _ = try await ovnManager.createLogicalSwitchPort(logicalPort, onSwitch: switchName)
+        }
+
+        let namespace = OVNNaming.fileShareNamespace(shareId: shareId)
+        let interface = OVNNaming.fileShareInterfaceName(shareId: shareId)
+        if try runProcess("ip", ["netns", "pids", namespace]).status != 0 {
+            try run("ip", ["netns", "add", namespace])
+        }
+        try run(
+            "ovs-vsctl",
+            [
+                "--timeout=\(Self.ovsCommandTimeoutSeconds)",
+                "--may-exist", "add-port", Self.ovnIntegrationBridge, interface,
+                "--", "set", "Interface", interface, "type=internal", "external_ids:iface-id=\(portName)",
+            ])
+        // OVS creates the internal device in the host namespace; move it once.
+        if tapDeviceExists(interface) {
+            try run("ip", ["link", "set", interface, "netns", namespace])
+        }
+        try run("ip", ["-n", namespace, "link", "set", interface, "address", macAddress])
+        try run("ip", ["-n", namespace, "addr", "replace", "\(ipAddress)/\(prefix)", "dev", interface])
+        try run("ip", ["-n", namespace, "link", "set", "lo", "up"])
+        try run("ip", ["-n", namespace, "link", "set", interface, "up"])
+        if let gateway = endpoint.gateway {
+            try run("ip", ["-n", namespace, "route", "replace", "default", "via", gateway])
+        }
+        return namespace
+        #else
+        throw NetworkError.invalidConfiguration("File shares require Linux networking")
+        #endif
+    }
+
+    func removeServerPort(shareId: UUID) async {
+        #if os(Linux)
+        let portName = OVNNaming.fileSharePortName(shareId: shareId)
+        do {
+            try await ovnManager?.deleteLogicalSwitchPort(named: portName)
+        } catch {
+            logger.warning(
+                "Failed to delete file share switch port",
+                metadata: ["portName": .string(portName), "error": .string(error.localizedDescription)])
+        }
+        let interface = OVNNaming.fileShareInterfaceName(shareId: shareId)
+        _ = try? runProcess(
+            "ovs-vsctl",
+            [
+                "--timeout=\(Self.ovsCommandTimeoutSeconds)",
+                "--if-exists", "del-port", Self.ovnIntegrationBridge, interface,
+            ])
+        // Deleting the namespace destroys the internal device inside it.
+        _ = try? runProcess("ip", ["netns", "delete", OVNNaming.fileShareNamespace(shareId: shareId)])
+        #endif
+    }
+}
+
 // MARK: - Network Error Types
 
 enum NetworkError: Error, LocalizedError, Sendable {
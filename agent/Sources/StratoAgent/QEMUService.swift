@@ -21,6 +21,13 @@ actor QEMUService: HypervisorService {
     /// never advertises the TPM capability, so a spec asking for one here means
     /// the placement gate was bypassed and the create must fail loudly.
     private let swtpm: SwtpmSupervisor?
+    /// Where the agent installs VMs' TPM state keys (wire v32); a deleted
+    /// VM's key goes with its state.
+    private let swtpmKeyDirectory: String?
+    /// Enrolls custom Secure Boot keys (wire v29), or nil on a host without
+    /// `virt-fw-vars` — which never advertises key enrollment, so keys in a
+    /// spec here fail the create rather than boot with the template's.
+    private let virtFwVarsBinaryPath: String?
     /// Whether to back VMs with hardware acceleration (KVM on Linux, HVF on
     /// macOS). Resolved from `enable_kvm`/`enable_hvf` config; when false, VMs
     /// run under TCG emulation.
@@ -48,11 +55,26 @@ actor QEMUService: HypervisorService {
     private var vmConsoleSocketPaths: [String: String] = [:]
     private var vmSerialSocketPaths: [String: String] = [:]
     private var pendingVMs: Set<String> = []  // Track VMs being created (to handle concurrent boot requests)
+    /// Whether VMs spawned from now on get virtio-balloon free-page
+    /// reporting, from the agent's memory overcommit policy (wire v26). A
+    /// device property fixed at spawn, so running VMs keep what they booted
+    /// with until their next restart.
+    private var freePageReporting = false
+    /// Balloon targets set by the agent's own pressure reclaim, on top of any
+    /// operator target (see `effectiveBalloonTarget`). Cleared when the VM's
+    /// process respawns — a fresh balloon starts deflated — and on delete.
+    private var reclaimTargets: [String: Int64] = [:]
+    /// Named CPU models the accelerator runs in full, from the registration
+    /// probe (wire v28), and the host vendor; together they resolve a
+    /// `host-model` guest to a baseline. Empty until the probe succeeds.
+    private var usableCPUModels: Set<String> = []
+    private var hostCPUVendor: String?
 
     init(
         logger: Logger,
         storage: (any StorageBackend)? = nil, vmStoragePath: String, qemuBinaryPath: String,
         firmware: FirmwareOverrides = FirmwareOverrides(), swtpmBinaryPath: String? = nil,
+        swtpmKeyDirectory: String? = nil, virtFwVarsBinaryPath: String? = nil,
         hardwareAccelerationEnabled: Bool = true
     ) {
         self.logger = logger
@@ -60,7 +82,11 @@ actor QEMUService: HypervisorService {
         self.vmStoragePath = vmStoragePath
         self.qemuBinaryPath = qemuBinaryPath
         self.firmware = firmware
-        self.swtpm = swtpmBinaryPath.map { SwtpmSupervisor(binaryPath: $0, logger: logger) }
+        self.swtpm = swtpmBinaryPath.map {
+            SwtpmSupervisor(binaryPath: $0, keyDirectory: swtpmKeyDirectory, logger: logger)
+        }
+        self.swtpmKeyDirectory = swtpmKeyDirectory
+        self.virtFwVarsBinaryPath = virtFwVarsBinaryPath
         self.hardwareAccelerationEnabled = hardwareAccelerationEnabled
 
         #if os(Linux)
@@ -135,7 +161,18 @@ actor QEMUService: HypervisorService {
                         artifactKind: .diskImage
                     )
                 }
-                disks = [ResolvedDisk(path: attachment.path, format: attachment.format, readonly: false)]
+                disks = [
+                    ResolvedDisk(
+                        path: attachment.path, format: attachment.format, readonly: false, qos: nil,
+                        deviceName: nil, shared: false)
+                ]
+                // Control-plane volumes attached at create (they carry a
+                // volume ID, unlike the legacy disk-path entry) follow the
+                // boot disk as data disks.
+                disks += spec.volumes.compactMap { volume in
+                    guard volume.volumeId != nil else { return nil }
+                    return ResolvedDisk(volume: volume)
+                }
             } catch {
                 logger.error(
                     "Failed to materialize boot disk from image, falling back to spec volumes",
@@ -148,14 +185,10 @@ actor QEMUService: HypervisorService {
         }
 
         if disks.isEmpty {
-            disks = spec.volumes.compactMap { volume in
-                volume.storagePath.map {
-                    ResolvedDisk(path: $0, format: DiskFormat(volumePath: $0), readonly: volume.readonly)
-                }
-            }
+            disks = spec.volumes.compactMap { ResolvedDisk(volume: $0) }
 
             // Create disk images from base if they don't exist
-            for disk in disks {
+            for disk in disks where !disk.remote {
                 let diskPath = disk.path
                 let fileManager = FileManager.default
 
@@ -330,7 +363,10 @@ actor QEMUService: HypervisorService {
         // A fresh QEMU process starts with a fully deflated balloon, so a VM
         // whose spec carries an operator target must have it re-applied here
         // — the reconciler cannot see the difference, since its notion of
-        // applied sizing is the spec this VM was created with.
+        // applied sizing is the spec this VM was created with. Any reclaim
+        // is dropped with the old balloon; the pressure controller starts
+        // this guest over from its ceiling.
+        reclaimTargets.removeValue(forKey: vmId)
         if let spec = vmSpecs[vmId], spec.balloonTargetBytes != nil {
             await applyBalloonTarget(vmId: vmId, spec: spec)
         }
@@ -433,6 +469,7 @@ actor QEMUService: HypervisorService {
         activeVMs.removeValue(forKey: vmId)
         vmSpecs.removeValue(forKey: vmId)
         vmSpawnSizing.removeValue(forKey: vmId)
+        reclaimTargets.removeValue(forKey: vmId)
         vmConfigs.removeValue(forKey: vmId)
 
         // Clean up console socket
@@ -467,10 +504,25 @@ actor QEMUService: HypervisorService {
             atPath: Self.nvramPath(vmStoragePath: vmStoragePath, vmId: vmId))
         try? FileManager.default.removeItem(
             atPath: SwtpmSupervisor.stateDirectory(vmDirectory: vmDir))
+        if let swtpmKeyDirectory {
+            SwtpmSupervisor.removeKey(vmId: vmId, keyDirectory: swtpmKeyDirectory)
+        }
 
         logger.info("QEMU VM deleted", metadata: ["vmId": .string(vmId)])
     }
 
+    /// Removes the VM's overlay disk; the cached base image it was created
+    /// from stays, so the recreate only re-links a fresh overlay.
+    func discardBootDisk(vmId: String) async throws {
+        guard activeVMs[vmId] == nil else {
+            throw HypervisorServiceError.invalidConfiguration("VM \(vmId) must be deleted before its disk is discarded")
+        }
+        let diskPath = "\(vmStoragePath)/\(vmId)/disk.qcow2"
+        guard FileManager.default.fileExists(atPath: diskPath) else { return }
+        try FileManager.default.removeItem(atPath: diskPath)
+        logger.info("Discarded VM boot disk", metadata: ["vmId": .string(vmId)])
+    }
+
     /// Returns the console socket path for a VM
     /// The path is computed deterministically from vmStoragePath and vmId
     /// Returns nil if the socket file doesn't exist (VM not running or not created)
@@ -893,8 +945,9 @@ actor QEMUService: HypervisorService {
         vmSpecs[vmId] = spec
     }
 
-    /// Drives the VM's balloon to `spec.balloonTargetBytes` — or back to its
-    /// full grant when the spec carries no target (issue #567 phase 2).
+    /// Drives the VM's balloon to `effectiveBalloonTarget` — the operator's
+    /// `spec.balloonTargetBytes` or any lower reclaim target, or back to its
+    /// full grant when there is neither (issue #567 phase 2).
     ///
     /// Best-effort by design, and never fatal to the caller: a VM created
     /// before the balloon device existed has nothing to drive, and a guest
@@ -906,7 +959,7 @@ actor QEMUService: HypervisorService {
     private func applyBalloonTarget(vmId: String, spec: VMSpec) async {
         // Clearing a target means deflating all the way back to the grant,
         // which is a real command and not a no-op.
-        let target = min(spec.balloonTargetBytes ?? spec.memoryBytes, spec.memoryBytes)
+        let target = effectiveBalloonTarget(vmId: vmId, spec: spec)
         do {
             try await controlled("qmp-balloon-target", vmId: vmId) {
                 try await self.requireProbeClient(vmId: vmId).setBalloonTarget(bytes: target)
@@ -924,6 +977,82 @@ actor QEMUService: HypervisorService {
         }
     }
 
+    /// The lowest of the operator's target, the agent's reclaim target, and
+    /// the grant: the operator's choice is a ceiling reclaim never raises.
+    private func effectiveBalloonTarget(vmId: String, spec: VMSpec) -> Int64 {
+        min(spec.balloonTargetBytes ?? spec.memoryBytes, reclaimTargets[vmId] ?? spec.memoryBytes, spec.memoryBytes)
+    }
+
+    // MARK: - CPU models (wire v28)
+
+    /// Starts a QEMU that builds no machine, asks it which named CPU models
+    /// this host runs without missing features, and remembers the answer for
+    /// resolving `host-model`. Nil without an accelerator — under TCG every
+    /// model is emulated, so none is a promise about the host — or when the
+    /// probe fails; the agent then advertises no models and the scheduler
+    /// sends it only passthrough guests.
+    func probeCPUModels(hostVendor: String?) async -> [String]? {
+        hostCPUVendor = hostVendor
+        guard hardwareAccelerationEnabled else { return nil }
+        let socketPath = vmStoragePath + "/cpu-model-probe.qmp"
+        try? FileManager.default.removeItem(atPath: socketPath)
+        defer { try? FileManager.default.removeItem(atPath: socketPath) }
+
+        // The runner's timeout reaps the process if `quit` never lands.
+        let binary = URL(fileURLWithPath: qemuBinaryPath)
+        let arguments = GuestCPUModels.probeArguments(qmpSocketPath: socketPath)
+        let process = Task {
+            try await ProcessRunner.run(
+                executableURL: binary, arguments: arguments, timeout: GuestCPUModels.probeTimeout)
+        }
+        defer { process.cancel() }
+
+        let client = QMPProbeClient(transport: NIOQGATransport(socketPath: socketPath, logger: logger), logger: logger)
+        do {
+            let models = try await StageBudget.run(
+                seconds: StageBudget.hypervisorSpawnSeconds, stage: "qmp-cpu-models", onTimeout: .abandon
+            ) {
+                // QEMU creates the socket a moment after it starts.
+                for _ in 0..<100 where !FileManager.default.fileExists(atPath: socketPath) {
+                    try await Task.sleep(for: .milliseconds(50))
+                }
+                let models = try await client.usableCPUModels()
+                try? await client.quit()
+                return models
+            }
+            usableCPUModels = Set(models)
+            logger.info("Probed guest CPU models", metadata: ["usable": .stringConvertible(models.count)])
+            return models
+        } catch {
+            logger.warning(
+                "Guest CPU model probe failed; advertising none",
+                metadata: ["error": .string(error.localizedDescription)])
+            return nil
+        }
+    }
+
+    // MARK: - Memory overcommit (wire v26)
+
+    func setFreePageReporting(_ enabled: Bool) {
+        freePageReporting = enabled
+    }
+
+    /// The reclaim target currently applied to each VM that has one.
+    func currentReclaimTargets() -> [String: Int64] {
+        reclaimTargets
+    }
+
+    /// Sets (or, with nil, releases) the pressure controller's reclaim
+    /// target for a running VM and drives its balloon to the result.
+    /// Best-effort like an operator target: a VM this service no longer runs
+    /// is skipped, and a guest that ignores the request shows up in the next
+    /// stats poll rather than as an error.
+    func setReclaimTarget(vmId: String, bytes: Int64?) async {
+        guard activeVMs[vmId] != nil, let spec = vmSpecs[vmId] else { return }
+        reclaimTargets[vmId] = bytes
+        await applyBalloonTarget(vmId: vmId, spec: spec)
+    }
+
     /// A probe client on the VM's dedicated stats monitor, which is also the
     /// only free QMP socket for hot-plug commands. Throws when the VM predates
     /// the socket (created before issue #567) rather than hanging on a connect.
@@ -974,6 +1103,28 @@ actor QEMUService: HypervisorService {
         }
     }
 
+    /// Reads the summed CPU time of the VM's vCPU threads, located through
+    /// the stats monitor's `query-cpus-fast`. Nil for a VM this service does
+    /// not manage, one without a stats socket, or any probe failure — a
+    /// missing sample only costs the rightsizing history one point.
+    func vcpuReading(vmId: String) async -> GuestCPUSampler.Reading? {
+        guard activeVMs[vmId] != nil else { return nil }
+        let socketPath = Self.statsSocketPath(vmStoragePath: vmStoragePath, vmId: vmId)
+        guard FileManager.default.fileExists(atPath: socketPath) else { return nil }
+        let transport = NIOQGATransport(socketPath: socketPath, logger: logger)
+        let client = QMPProbeClient(transport: transport, logger: logger)
+        do {
+            let threadIDs = try await StageBudget.run(
+                seconds: StageBudget.guestAgentSeconds, stage: "qmp-vcpu-threads", onTimeout: .abandon
+            ) {
+                try await client.vcpuThreadIDs()
+            }
+            return GuestCPUSampler.read(threadIDs: threadIDs, at: ProcessInfo.processInfo.systemUptime)
+        } catch {
+            return nil
+        }
+    }
+
     /// Probes the guest agent for hostname and configured network interfaces.
     /// Returns nil for a VM this service does not manage, one with no qga
     /// socket, or a guest that did not answer within the short budget — all the
@@ -991,6 +1142,24 @@ actor QEMUService: HypervisorService {
         }
     }
 
+    /// Runs a command inside a running VM through qga — a health check, or
+    /// an image build's provisioner — bounded by `timeoutSeconds`. Throws
+    /// when the VM has no guest agent channel, qga doesn't answer, or the
+    /// command outlives its budget.
+    func guestExec(vmId: String, command: [String], timeoutSeconds: Int) async throws -> GuestExecResult {
+        guard let path = command.first else {
+            throw HypervisorServiceError.invalidConfiguration("Guest command is empty")
+        }
+        guard activeVMs[vmId] != nil, let client = qgaClient(vmId: vmId) else {
+            throw HypervisorServiceError.vmNotRunning(vmId)
+        }
+        return try await StageBudget.run(
+            seconds: timeoutSeconds, stage: "qga-exec", onTimeout: .abandon
+        ) {
+            try await client.exec(path: path, arguments: Array(command.dropFirst()))
+        }
+    }
+
     /// Re-adopts a VM whose QEMU process survived an agent restart by
     /// attaching to its deterministic QMP socket, and returns the observed
     /// status. Fails (leaving the VM orphaned) when the socket is missing —
@@ -1077,9 +1246,17 @@ actor QEMUService: HypervisorService {
 
     /// Attaches a disk to a running VM using QMP hot-plug
     /// This uses QEMU's blockdev-add and device_add commands via SwiftQEMU
-    func attachDisk(vmId: String, volumeId: String, volumePath: String, deviceName: String, readonly: Bool = false)
-        async throws
-    {
+    ///
+    /// A volume type's I/O limits (`qos`) are applied right after the device
+    /// exists. If throttling fails the disk is unplugged again: reporting the
+    /// attach as done would leave the volume running without the limits the
+    /// API says it has. A `shared` (multi-attach) disk is plugged through the
+    /// stats monitor instead, because only there can the device be given
+    /// `share-rw`.
+    func attachDisk(
+        vmId: String, volumeId: String, volumePath: String, deviceName: String, readonly: Bool, qos: VolumeQoS?,
+        shared: Bool
+    ) async throws {
         guard let manager = activeVMs[vmId] else {
             throw QEMUServiceError.vmNotFound("VM \(vmId) not found")
         }
@@ -1092,11 +1269,21 @@ actor QEMUService: HypervisorService {
                 "deviceName": .string(deviceName),
                 "volumePath": .string(volumePath),
                 "readonly": .stringConvertible(readonly),
+                "shared": .stringConvertible(shared),
             ])
 
         do {
-            try await controlled("qmp-attach-disk", vmId: vmId) {
-                try await manager.attachDisk(path: volumePath, deviceName: deviceName, readOnly: readonly)
+            if shared {
+                let client = try requireProbeClient(vmId: vmId)
+                let format = DiskFormat(volumePath: volumePath).rawValue
+                try await controlled("qmp-attach-shared-disk", vmId: vmId) {
+                    try await client.plugSharedDisk(
+                        deviceID: deviceName, path: volumePath, format: format, readOnly: readonly)
+                }
+            } else {
+                try await controlled("qmp-attach-disk", vmId: vmId) {
+                    try await manager.attachDisk(path: volumePath, deviceName: deviceName, readOnly: readonly)
+                }
             }
             logger.info(
                 "Disk attached successfully",
@@ -1115,6 +1302,28 @@ actor QEMUService: HypervisorService {
                 ])
             throw QEMUServiceError.hotPlugFailed("Failed to attach disk: \(error)")
         }
+
+        guard let qos, qos.isLimited else { return }
+        do {
+            let client = try requireProbeClient(vmId: vmId)
+            try await StageBudget.run(
+                seconds: StageBudget.guestAgentSeconds, stage: "qmp-block-throttle", onTimeout: .abandon
+            ) {
+                try await client.setBlockIOThrottle(qdevID: deviceName, qos: qos)
+            }
+        } catch {
+            logger.error(
+                "Failed to apply volume I/O limits; unplugging the disk",
+                metadata: [
+                    "vmId": .string(vmId),
+                    "volumeId": .string(volumeId),
+                    "error": .string(error.localizedDescription),
+                ])
+            try? await controlled("qmp-detach-disk", vmId: vmId) {
+                try await manager.detachDisk(deviceName: deviceName)
+            }
+            throw QEMUServiceError.hotPlugFailed("Failed to apply volume I/O limits: \(error)")
+        }
     }
 
     /// Detaches a disk from a running VM using QMP hot-unplug
@@ -1155,6 +1364,33 @@ actor QEMUService: HypervisorService {
         }
     }
 
+    /// Moves an attached volume's disk onto another agent's NBD export while
+    /// the guest runs (volume migration), pivoting the guest onto it. The
+    /// mirror copies the whole disk, so it runs under its own budget rather
+    /// than the hypervisor-control envelope; `QMPProbeClient.mirrorDisk`
+    /// cancels the job on any failure, leaving the guest on its source disk.
+    func mirrorDisk(vmId: String, volumeId: String, volumePath: String, target: NBDExportEndpoint) async throws {
+        guard activeVMs[vmId] != nil else {
+            throw QEMUServiceError.vmNotFound("VM \(vmId) not found")
+        }
+        let client = try requireProbeClient(vmId: vmId)
+
+        logger.info(
+            "Mirroring disk to NBD export",
+            metadata: [
+                "vmId": .string(vmId),
+                "volumeId": .string(volumeId),
+                "volumePath": .string(volumePath),
+                "target": .string(target.uri),
+            ])
+        try await controlled("qmp-block-mirror", vmId: vmId, seconds: StageBudget.volumeMirrorSeconds) {
+            try await client.mirrorDisk(sourcePath: volumePath, target: target, jobID: "migrate-\(volumeId)")
+        }
+        logger.info(
+            "Disk mirrored and pivoted",
+            metadata: ["vmId": .string(vmId), "volumeId": .string(volumeId)])
+    }
+
     // MARK: - Private Configuration Methods
 
     // MARK: - Firmware and NVRAM (issue #565)
@@ -1175,27 +1411,194 @@ actor QEMUService: HypervisorService {
     /// would reset the guest's boot order and wipe enrolled Secure Boot keys.
     /// An existing VM gains its NVRAM file the first time it respawns under
     /// this code.
-    private func ensureNVRAM(vmId: String, from template: String) throws -> String {
+    ///
+    /// With custom `keys` (wire v29) the store is instead generated from the
+    /// template with those keys enrolled, and regenerated whenever they
+    /// change; the fingerprint marker beside it records which keys it holds.
+    /// A store that held custom keys goes back to the template's when the
+    /// spec drops them. Either rebuild resets the guest's boot entries, which
+    /// UEFI guests recreate from their default boot path.
+    private func ensureNVRAM(vmId: String, from template: String, keys: SecureBootKeys?) async throws -> String {
         let path = Self.nvramPath(vmStoragePath: vmStoragePath, vmId: vmId)
-        guard !FileManager.default.fileExists(atPath: path) else { return path }
+        let markerPath = ((path as NSString).deletingLastPathComponent as NSString)
+            .appendingPathComponent(SecureBootEnrollment.markerFileName)
+        let marker = (try? String(contentsOfFile: markerPath, encoding: .utf8))?
+            .trimmingCharacters(in: .whitespacesAndNewlines)
+        let exists = FileManager.default.fileExists(atPath: path)
+
+        guard let keys else {
+            guard !exists || marker != nil else { return path }
+            do {
+                try? FileManager.default.removeItem(atPath: path)
+                try FileManager.default.copyItem(atPath: template, toPath: path)
+                try? FileManager.default.removeItem(atPath: markerPath)
+            } catch {
+                throw QEMUServiceError.configurationError(
+                    "failed to initialize UEFI variable store for VM \(vmId) from \(template): "
+                        + error.localizedDescription)
+            }
+            logger.info(
+                "Initialized UEFI variable store",
+                metadata: ["vmId": .string(vmId), "nvram": .string(path), "template": .string(template)])
+            return path
+        }
+
+        let fingerprint = SecureBootEnrollment.fingerprint(keys)
+        guard !exists || marker != fingerprint else { return path }
+        try await enrollSecureBootKeys(keys, vmId: vmId, template: template, into: path)
         do {
-            try FileManager.default.copyItem(atPath: template, toPath: path)
+            try fingerprint.write(toFile: markerPath, atomically: true, encoding: .utf8)
         } catch {
             throw QEMUServiceError.configurationError(
-                "failed to initialize UEFI variable store for VM \(vmId) from \(template): "
-                    + error.localizedDescription)
+                "failed to record Secure Boot keys for VM \(vmId): \(error.localizedDescription)")
         }
         logger.info(
-            "Initialized UEFI variable store",
-            metadata: ["vmId": .string(vmId), "nvram": .string(path), "template": .string(template)])
+            "Enrolled custom Secure Boot keys",
+            metadata: [
+                "vmId": .string(vmId), "nvram": .string(path), "fingerprint": .string(fingerprint),
+                "db": .stringConvertible(keys.signatureDatabase.count),
+                "dbx": .stringConvertible(keys.forbiddenSignatures.count),
+            ])
         return path
     }
 
+    /// Writes a variable store enrolled with `keys` to `path`, via a scratch
+    /// file so a failed enrollment leaves the previous store in place.
+    private func enrollSecureBootKeys(
+        _ keys: SecureBootKeys, vmId: String, template: String, into path: String
+    ) async throws {
+        guard let virtFwVarsBinaryPath else {
+            throw QEMUServiceError.configurationError(
+                "VM \(vmId) asks for custom Secure Boot keys, but this host has no virt-fw-vars. "
+                    + "Install python3-virt-firmware or set virt_fw_vars_binary_path.")
+        }
+        let vmDir = (path as NSString).deletingLastPathComponent
+        let scratch = (vmDir as NSString).appendingPathComponent("secure-boot-keys")
+        let staged = path + ".new"
+        defer {
+            try? FileManager.default.removeItem(atPath: scratch)
+            try? FileManager.default.removeItem(atPath: staged)
+        }
+        do {
+            let plan = try SecureBootEnrollment.plan(
+                keys: keys, template: template, output: staged, scratchDirectory: scratch)
+            try? FileManager.default.removeItem(atPath: scratch)
+            try FileManager.default.createDirectory(atPath: scratch, withIntermediateDirectories: true)
+            for (file, contents) in plan.files {
+                try contents.write(to: URL(fileURLWithPath: file))
+            }
+            let result = try await ProcessRunner.run(
+                executableURL: URL(fileURLWithPath: virtFwVarsBinaryPath), arguments: plan.arguments,
+                timeout: SecureBootEnrollment.enrollTimeout)
+            guard result.terminationStatus == 0 else {
+                throw QEMUServiceError.configurationError(
+                    "virt-fw-vars failed (exit \(result.terminationStatus)): "
+                        + result.combinedOutput.trimmingCharacters(in: .whitespacesAndNewlines))
+            }
+            if FileManager.default.fileExists(atPath: path) {
+                _ = try FileManager.default.replaceItemAt(
+                    URL(fileURLWithPath: path), withItemAt: URL(fileURLWithPath: staged))
+            } else {
+                try FileManager.default.moveItem(atPath: staged, toPath: path)
+            }
+        } catch let error as QEMUServiceError {
+            throw error
+        } catch {
+            throw QEMUServiceError.configurationError(
+                "failed to enroll Secure Boot keys for VM \(vmId): \(error)")
+        }
+    }
+
+    /// Brings a stopped VM's variable store in line with the Secure Boot keys
+    /// in `spec` (wire v29), so its next boot — a respawn from the stored
+    /// configuration, which keeps pointing at the same `nvram.fd` — enforces
+    /// them. A no-op when the store already holds them, and refused while
+    /// the VM's process runs: QEMU holds the store open, and the guest would
+    /// overwrite the change on its next variable write.
+    func updateSecureBootKeys(vmId: String, spec: VMSpec) async throws {
+        let machine = spec.effectiveMachine
+        guard machine.secureBoot, case .disk(let perVMFirmware) = spec.boot else { return }
+        if activeVMs[vmId] != nil, let status = try? await getVMStatus(vmId: vmId),
+            status == .running || status == .paused
+        {
+            throw QEMUServiceError.configurationError(
+                "VM \(vmId) must be stopped before its Secure Boot keys can change")
+        }
+        guard case .pflash(_, let varsTemplate) = try FirmwareResolver.resolve(
+            secureBoot: true, perVMPath: perVMFirmware, overrides: firmware)
+        else { return }
+        _ = try await ensureNVRAM(vmId: vmId, from: varsTemplate, keys: machine.secureBootKeys)
+    }
+
     /// A disk realized on this host: the agent-resolved path plus attach options.
     private struct ResolvedDisk {
         let path: String
         let format: DiskFormat
         let readonly: Bool
+        /// The volume type's I/O limits, if any.
+        let qos: VolumeQoS?
+        /// The spec's device name; nil for the image-materialized boot disk.
+        let deviceName: String?
+        /// A multi-attach volume other VMs may hold open too.
+        let shared: Bool
+        /// `path` is the `nbd://` URI of a replica another agent serves,
+        /// not a file on this host.
+        let remote: Bool
+
+        init(
+            path: String, format: DiskFormat, readonly: Bool, qos: VolumeQoS?, deviceName: String?, shared: Bool,
+            remote: Bool = false
+        ) {
+            self.path = path
+            self.format = format
+            self.readonly = readonly
+            self.qos = qos
+            self.deviceName = deviceName
+            self.shared = shared
+            self.remote = remote
+        }
+
+        /// The disk for a spec volume: its NBD export when the replica lives
+        /// on another agent (always raw — the export serves guest-visible
+        /// bytes), else its local path. Nil when the spec has neither.
+        init?(volume: VolumeSpec) {
+            if let nbd = volume.nbd {
+                self.init(
+                    path: nbd.uri, format: .raw, readonly: volume.readonly, qos: volume.qos,
+                    deviceName: volume.deviceName, shared: volume.shared, remote: true)
+            } else if let path = volume.storagePath {
+                self.init(
+                    path: path, format: DiskFormat(volumePath: path), readonly: volume.readonly, qos: volume.qos,
+                    deviceName: volume.deviceName, shared: volume.shared)
+            } else {
+                return nil
+            }
+        }
+
+        /// Whether SwiftQEMU's `QEMUDisk` can express this disk.
+        var needsRawArguments: Bool { qos?.isLimited == true || shared || remote }
+    }
+
+    /// The arguments for a disk `QEMUDisk` can't express. Throttled disks use
+    /// QEMU's `throttling.*` drive options. `share-rw` is a property of the
+    /// guest device rather than the drive, so a shared disk is declared as a
+    /// backend-only drive plus an explicit virtio-blk device, named after the
+    /// volume's device the way a hot-plugged disk is.
+    private static func driveArguments(for disk: ResolvedDisk) -> [String] {
+        var drive = "file=\(disk.path),format=\(disk.format.rawValue)"
+        var device: [String] = []
+        if disk.shared, let deviceName = disk.deviceName {
+            drive += ",if=none,id=drive-\(deviceName)"
+            device = ["-device", "virtio-blk-pci,drive=drive-\(deviceName),id=\(deviceName),share-rw=on"]
+        } else {
+            drive += ",if=virtio"
+        }
+        if disk.readonly { drive += ",readonly=on" }
+        if let qos = disk.qos, qos.isLimited {
+            if let iops = qos.maxIOPS { drive += ",throttling.iops-total=\(iops)" }
+            if let bytes = qos.maxBytesPerSecond { drive += ",throttling.bps-total=\(bytes)" }
+        }
+        return ["-drive", drive] + device
     }
 
     private func convertToQEMUConfiguration(
@@ -1239,8 +1642,11 @@ actor QEMUService: HypervisorService {
         // only valid with a hardware accelerator (KVM/HVF); QEMU rejects it under
         // TCG ("CPU model 'host' requires KVM or HVF"). When acceleration is
         // disabled we fall back to `max`, a TCG-safe model that exposes the most
-        // features the emulator can provide.
-        let cpuType = hardwareAccelerationEnabled ? "host" : "max"
+        // features the emulator can provide. A spec's `cpuModel` (wire v28)
+        // narrows this to a named baseline; see `GuestCPUModels`.
+        let cpuType = GuestCPUModels.qemuCPUArgument(
+            model: spec.cpuModel, accelerated: hardwareAccelerationEnabled,
+            usable: usableCPUModels, vendor: hostCPUVendor)
 
         // Configure machine type based on architecture and boot mode.
         //
@@ -1277,14 +1683,25 @@ actor QEMUService: HypervisorService {
         // overwhelmingly common case carries none of its risk.
         appendHotAddHeadroom(&qemuConfig, spec: spec)
 
-        // Configure disks
-        qemuConfig.disks = disks.map { disk in
-            QEMUDisk(
-                path: disk.path,
-                format: disk.format.rawValue,
-                interface: "virtio",
-                readonly: disk.readonly
-            )
+        // Configure disks. When any disk carries volume-type I/O limits, is
+        // shared with other VMs, or is served over NBD, every disk is spelled out as raw arguments
+        // instead, so the guest still enumerates them in spec order (virtio
+        // devices number in argument order, and `QEMUDisk` entries are
+        // emitted ahead of additional args).
+        if disks.contains(where: \.needsRawArguments) {
+            for disk in disks {
+                qemuConfig.additionalArgs.append(contentsOf: Self.driveArguments(for: disk))
+            }
+            logger.debug("Configuring \(disks.count) disks with volume I/O limits, sharing, or NBD")
+        } else {
+            qemuConfig.disks = disks.map { disk in
+                QEMUDisk(
+                    path: disk.path,
+                    format: disk.format.rawValue,
+                    interface: "virtio",
+                    readonly: disk.readonly
+                )
+            }
         }
 
         // Configure networking: translate each resolved attachment into its
@@ -1350,7 +1767,8 @@ actor QEMUService: HypervisorService {
 
             switch firmwareSet {
             case .pflash(let code, let varsTemplate):
-                let nvram = try ensureNVRAM(vmId: vmId, from: varsTemplate)
+                let nvram = try await ensureNVRAM(
+                    vmId: vmId, from: varsTemplate, keys: machine.secureBoot ? machine.secureBootKeys : nil)
                 qemuConfig.additionalArgs.append(contentsOf: [
                     "-drive", "if=pflash,format=raw,unit=0,readonly=on,file=\(code)",
                     "-drive", "if=pflash,format=raw,unit=1,file=\(nvram)",
@@ -1488,9 +1906,14 @@ actor QEMUService: HypervisorService {
         // and once one does, free-page hinting lets the host drop guest-freed
         // pages (shrinking host RSS) while `guest-stats` gives the agent real
         // memory usage to report. `deflate-on-oom` stays at its default (off).
-        qemuConfig.additionalArgs.append(contentsOf: [
-            "-device", "virtio-balloon-pci,id=\(Self.balloonDeviceID),free-page-hint=on",
-        ])
+        // Free-page reporting goes further — the guest hands pages back as it
+        // frees them, not only during migration — and is on when the agent's
+        // overcommit policy asks for it.
+        var balloonDevice = "virtio-balloon-pci,id=\(Self.balloonDeviceID),free-page-hint=on"
+        if freePageReporting {
+            balloonDevice += ",free-page-reporting=on"
+        }
+        qemuConfig.additionalArgs.append(contentsOf: ["-device", balloonDevice])
 
         // Third QMP monitor, dedicated to balloon-stats probes (issue #567):
         // each QMP server socket admits one client at a time, and the two
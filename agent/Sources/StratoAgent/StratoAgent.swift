@@ -146,6 +146,7 @@ private func launchAgent(options: AgentOptions) async throws {
         monolithicPath: finalMonolithicFirmwarePath
     )
     let finalSwtpmBinaryPath = config.swtpmBinaryPath ?? AgentConfig.defaultSwtpmBinaryPath
+    let finalVirtFwVarsBinaryPath = config.virtFwVarsBinaryPath ?? AgentConfig.defaultVirtFwVarsBinaryPath
 
     // Resolve Firecracker configuration (Linux only)
     let finalFirecrackerBinaryPath =
@@ -214,6 +215,7 @@ private func launchAgent(options: AgentOptions) async throws {
             "firmwarePath": .string(finalMonolithicFirmwarePath ?? "(platform default)"),
             "firmwareCodePath": .string(config.firmwareCodePath ?? "(platform default)"),
             "swtpmBinaryPath": .string(finalSwtpmBinaryPath ?? "(not installed)"),
+            "virtFwVarsBinaryPath": .string(finalVirtFwVarsBinaryPath ?? "(not installed)"),
             "firecrackerBinaryPath": .string(finalFirecrackerBinaryPath),
             "firecrackerSocketDir": .string(finalFirecrackerSocketDir),
             "sandboxGuestImagePath": .string(finalSandboxGuestImagePath),
@@ -268,9 +270,17 @@ private func launchAgent(options: AgentOptions) async throws {
         sandboxImageCacheMaxSizeBytes: config.sandboxImageCacheMaxSizeBytes,
         vmStoragePath: finalVMStoragePath,
         volumeStoragePath: finalVolumeStoragePath,
+        volumeStorageEncrypted: config.volumeStorageEncrypted ?? false,
+        volumeNBDAddress: config.volumeNBDAddress,
+        volumeNBDPortRange: (config.volumeNBDPortMin ?? 10809)...(config.volumeNBDPortMax ?? 10899),
+        fileShareStoragePath: config.fileShareDir,
+        objectGatewayStoragePath: config.objectGatewayDir,
+        objectGatewayListen: config.objectGatewayListen,
+        objectGatewayEndpoint: config.objectGatewayEndpoint,
         qemuBinaryPath: finalQemuBinaryPath,
         firmware: finalFirmware,
         swtpmBinaryPath: finalSwtpmBinaryPath,
+        virtFwVarsBinaryPath: finalVirtFwVarsBinaryPath,
         firecrackerBinaryPath: finalFirecrackerBinaryPath,
         firecrackerSocketDir: finalFirecrackerSocketDir,
         sandboxGuestImagePath: finalSandboxGuestImagePath,
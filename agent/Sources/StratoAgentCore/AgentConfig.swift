@@ -255,6 +255,36 @@ public struct AgentConfig: Codable {
     /// platform default (`/var/lib/strato/volumes` on Linux) — see
     /// `FileSystemStorageBackend.defaultStoragePath`.
     public let volumeStoragePath: String?
+    /// Operator attestation that `volume_storage_dir` sits on encrypted
+    /// storage (LUKS, encrypted ZFS, a self-encrypting array, ...). The agent
+    /// cannot verify this itself; it only advertises it, and the control plane
+    /// places volumes whose type requires encryption on such agents only.
+    /// Default false.
+    public let volumeStorageEncrypted: Bool?
+    /// Storage-network address this agent serves volumes on over NBD, the
+    /// destination side of an attached-volume migration. NBD is
+    /// unauthenticated, so this must not be reachable from tenant networks.
+    /// Unset disables NBD exports, and the agent does not advertise
+    /// `nbd_export`.
+    public let volumeNBDAddress: String?
+    /// Port range for NBD exports, one port per exported volume. Both ends
+    /// must be set together; unset means 10809-10899.
+    public let volumeNBDPortMin: Int?
+    public let volumeNBDPortMax: Int?
+    /// Root directory for managed NFS file shares: one filesystem image per
+    /// share, served by `ganesha.nfsd` on the owner project's network. Unset
+    /// disables file shares, and the agent does not advertise
+    /// `nfs_file_share`. Requires OVN networking.
+    public let fileShareDir: String?
+    /// Root directory for the S3-compatible object gateway's buckets. Set
+    /// together with `objectGatewayListen`; unset disables the gateway, and
+    /// the agent does not advertise `object_gateway`.
+    public let objectGatewayDir: String?
+    /// `host:port` the object gateway's plain-HTTP listener binds.
+    public let objectGatewayListen: String?
+    /// The URL clients reach the gateway at (typically a TLS front end
+    /// proxying to the listener), reported on each bucket. Optional.
+    public let objectGatewayEndpoint: String?
     /// Where downloaded VM images (disk images, kernels, rootfs artifacts)
     /// are cached between VM launches. Nil means the platform default
     /// (`/var/cache/strato/images` on Linux).
@@ -290,6 +320,10 @@ public struct AgentConfig: Codable {
     /// The `swtpm` binary backing guest vTPMs. Its presence is what makes the
     /// agent advertise the TPM capability at registration (issue #565).
     public let swtpmBinaryPath: String?
+    /// The `virt-fw-vars` tool (python3-virt-firmware) that enrolls a VM's
+    /// custom Secure Boot keys into its variable store. Its presence is what
+    /// makes the agent advertise key enrollment at registration (wire v29).
+    public let virtFwVarsBinaryPath: String?
     public let spiffe: SPIFFEConfig?
     public let firecrackerBinaryPath: String?
     public let firecrackerSocketDir: String?
@@ -343,6 +377,14 @@ public struct AgentConfig: Codable {
         case enableKVM = "enable_kvm"
         case vmStoragePath = "vm_storage_dir"
         case volumeStoragePath = "volume_storage_dir"
+        case volumeStorageEncrypted = "volume_storage_encrypted"
+        case volumeNBDAddress = "volume_nbd_address"
+        case volumeNBDPortMin = "volume_nbd_port_min"
+        case volumeNBDPortMax = "volume_nbd_port_max"
+        case fileShareDir = "file_share_dir"
+        case objectGatewayDir = "object_gateway_dir"
+        case objectGatewayListen = "object_gateway_listen"
+        case objectGatewayEndpoint = "object_gateway_endpoint"
         case imageCacheDir = "image_cache_dir"
         case imageCacheMaxSizeGB = "image_cache_max_size_gb"
         case sandboxImageCacheDir = "sandbox_image_cache_dir"
@@ -355,6 +397,7 @@ public struct AgentConfig: Codable {
         case secureBootFirmwareCodePath = "secure_boot_firmware_code_path"
         case secureBootFirmwareVarsTemplate = "secure_boot_firmware_vars_template"
         case swtpmBinaryPath = "swtpm_binary_path"
+        case virtFwVarsBinaryPath = "virt_fw_vars_binary_path"
         case spiffe
         case firecrackerBinaryPath = "firecracker_binary_path"
         case firecrackerSocketDir = "firecracker_socket_dir"
@@ -386,6 +429,14 @@ public struct AgentConfig: Codable {
         enableKVM: Bool? = nil,
         vmStoragePath: String? = nil,
         volumeStoragePath: String? = nil,
+        volumeStorageEncrypted: Bool? = nil,
+        volumeNBDAddress: String? = nil,
+        volumeNBDPortMin: Int? = nil,
+        volumeNBDPortMax: Int? = nil,
+        fileShareDir: String? = nil,
+        objectGatewayDir: String? = nil,
+        objectGatewayListen: String? = nil,
+        objectGatewayEndpoint: String? = nil,
         imageCacheDir: String? = nil,
         imageCacheMaxSizeGB: Int? = nil,
         sandboxImageCacheDir: String? = nil,
@@ -398,6 +449,7 @@ public struct AgentConfig: Codable {
         secureBootFirmwareCodePath: String? = nil,
         secureBootFirmwareVarsTemplate: String? = nil,
         swtpmBinaryPath: String? = nil,
+        virtFwVarsBinaryPath: String? = nil,
         spiffe: SPIFFEConfig? = nil,
         firecrackerBinaryPath: String? = nil,
         firecrackerSocketDir: String? = nil,
@@ -427,6 +479,14 @@ public struct AgentConfig: Codable {
         self.enableKVM = enableKVM
         self.vmStoragePath = vmStoragePath
         self.volumeStoragePath = volumeStoragePath
+        self.volumeStorageEncrypted = volumeStorageEncrypted
+        self.volumeNBDAddress = volumeNBDAddress
+        self.volumeNBDPortMin = volumeNBDPortMin
+        self.volumeNBDPortMax = volumeNBDPortMax
+        self.fileShareDir = fileShareDir
+        self.objectGatewayDir = objectGatewayDir
+        self.objectGatewayListen = objectGatewayListen
+        self.objectGatewayEndpoint = objectGatewayEndpoint
         self.imageCacheDir = imageCacheDir
         self.imageCacheMaxSizeGB = imageCacheMaxSizeGB
         self.sandboxImageCacheDir = sandboxImageCacheDir
@@ -439,6 +499,7 @@ public struct AgentConfig: Codable {
         self.secureBootFirmwareCodePath = secureBootFirmwareCodePath
         self.secureBootFirmwareVarsTemplate = secureBootFirmwareVarsTemplate
         self.swtpmBinaryPath = swtpmBinaryPath
+        self.virtFwVarsBinaryPath = virtFwVarsBinaryPath
         self.spiffe = spiffe
         self.firecrackerBinaryPath = firecrackerBinaryPath
         self.firecrackerSocketDir = firecrackerSocketDir
@@ -545,6 +606,30 @@ public struct AgentConfig: Codable {
         let enableKVM = tomlData.bool("enable_kvm")
         let vmStoragePath = tomlData.string("vm_storage_dir")
         let volumeStoragePath = tomlData.string("volume_storage_dir")
+        let volumeStorageEncrypted = tomlData.bool("volume_storage_encrypted")
+        let volumeNBDAddress = tomlData.string("volume_nbd_address")
+        let volumeNBDPortMin = try Self.positiveInt(tomlData, key: "volume_nbd_port_min")
+        let volumeNBDPortMax = try Self.positiveInt(tomlData, key: "volume_nbd_port_max")
+        guard (volumeNBDPortMin == nil) == (volumeNBDPortMax == nil) else {
+            throw AgentConfigError.invalidConfiguration(
+                "volume_nbd_port_min and volume_nbd_port_max must be set together")
+        }
+        if let min = volumeNBDPortMin, let max = volumeNBDPortMax, min > max || max > 65535 {
+            throw AgentConfigError.invalidConfiguration(
+                "volume_nbd_port_min..volume_nbd_port_max must be a valid port range, got \(min)-\(max)")
+        }
+        let fileShareDir = tomlData.string("file_share_dir")
+        let objectGatewayDir = tomlData.string("object_gateway_dir")
+        let objectGatewayListen = tomlData.string("object_gateway_listen")
+        let objectGatewayEndpoint = tomlData.string("object_gateway_endpoint")
+        guard (objectGatewayDir == nil) == (objectGatewayListen == nil) else {
+            throw AgentConfigError.invalidConfiguration(
+                "object_gateway_dir and object_gateway_listen must be set together")
+        }
+        if let listen = objectGatewayListen, ObjectGatewayServer.parseListenAddress(listen) == nil {
+            throw AgentConfigError.invalidConfiguration(
+                "object_gateway_listen must be host:port, got \(listen)")
+        }
         let imageCacheDir = tomlData.string("image_cache_dir")
         let sandboxImageCacheDir = tomlData.string("sandbox_image_cache_dir")
         // Cache budgets must be positive: 0 would mean "evict everything, every
@@ -571,6 +656,7 @@ public struct AgentConfig: Codable {
                 "secure_boot_firmware_code_path and secure_boot_firmware_vars_template must be set together")
         }
         let swtpmBinaryPath = tomlData.string("swtpm_binary_path")
+        let virtFwVarsBinaryPath = tomlData.string("virt_fw_vars_binary_path")
         let firecrackerBinaryPath = tomlData.string("firecracker_binary_path")
         let firecrackerSocketDir = tomlData.string("firecracker_socket_dir")
         let sandboxGuestImagePath = tomlData.string("sandbox_guest_image_path")
@@ -798,6 +884,14 @@ public struct AgentConfig: Codable {
             enableKVM: enableKVM,
             vmStoragePath: vmStoragePath,
             volumeStoragePath: volumeStoragePath,
+            volumeStorageEncrypted: volumeStorageEncrypted,
+            volumeNBDAddress: volumeNBDAddress,
+            volumeNBDPortMin: volumeNBDPortMin,
+            volumeNBDPortMax: volumeNBDPortMax,
+            fileShareDir: fileShareDir,
+            objectGatewayDir: objectGatewayDir,
+            objectGatewayListen: objectGatewayListen,
+            objectGatewayEndpoint: objectGatewayEndpoint,
             imageCacheDir: imageCacheDir,
             imageCacheMaxSizeGB: imageCacheMaxSizeGB,
             sandboxImageCacheDir: sandboxImageCacheDir,
@@ -810,6 +904,7 @@ public struct AgentConfig: Codable {
             secureBootFirmwareCodePath: secureBootFirmwareCodePath,
             secureBootFirmwareVarsTemplate: secureBootFirmwareVarsTemplate,
             swtpmBinaryPath: swtpmBinaryPath,
+            virtFwVarsBinaryPath: virtFwVarsBinaryPath,
             spiffe: spiffeConfig,
             firecrackerBinaryPath: firecrackerBinaryPath,
             firecrackerSocketDir: firecrackerSocketDir,
@@ -993,6 +1088,18 @@ public struct AgentConfig: Codable {
         return paths.first { FileManager.default.isExecutableFile(atPath: $0) }
     }
 
+    /// Default `virt-fw-vars` path, or nil when none is installed. Nil keeps
+    /// VMs with custom Secure Boot keys off this host; Secure Boot with the
+    /// template's own keys is unaffected.
+    public static var defaultVirtFwVarsBinaryPath: String? {
+        let paths = [
+            "/usr/bin/virt-fw-vars",
+            "/usr/local/bin/virt-fw-vars",
+            "/opt/homebrew/bin/virt-fw-vars",
+        ]
+        return paths.first { FileManager.default.isExecutableFile(atPath: $0) }
+    }
+
     /// Default Firecracker binary path (Linux only)
     public static var defaultFirecrackerBinaryPath: String {
         #if os(Linux)
@@ -464,6 +464,9 @@ public struct CloudInitProvisioner {
             // Every v6 line below is gated on this so v4-only NICs render
             // byte-identical config to pre-IPv6 agents.
             let hasIPv6 = nic.ip6Address != nil
+            // An IPv6-only NIC (no v4 allocation on a network that has v6)
+            // gets no v4 config at all: nothing on its network answers DHCPv4.
+            let ipv6Only = nic.ipAddress == nil && hasIPv6
 
             if nic.dhcpEnabled {
                 // OVN's DHCP responder delivers IP, gateway, and DNS; just bring
@@ -472,7 +475,7 @@ public struct CloudInitProvisioner {
                 // default route; the guest's link-local address must be EUI-64
                 // (derived from the MAC) or OVN port_security — which lists
                 // exactly that address — drops its NDP and DHCPv6 traffic.
-                section += "\n    dhcp4: true"
+                section += ipv6Only ? "\n    dhcp4: false" : "\n    dhcp4: true"
                 if hasIPv6 {
                     section += "\n    dhcp6: true"
                     section += "\n    accept-ra: true"
@@ -482,13 +485,16 @@ public struct CloudInitProvisioner {
                 continue
             }
 
-            // Static path: needs a control-plane IP + netmask. Skip NICs without
-            // one (the guest keeps its default DHCP behavior).
-            guard let ipAddress = nic.ipAddress,
-                let prefix = nic.netmask.flatMap({ IPv4Address($0)?.prefixLength })
-            else { continue }
-
-            section += "\n    addresses:\n      - \(ipAddress)/\(prefix)"
+            // Static path: needs a control-plane IP + netmask, or a v6 address
+            // on an IPv6-only NIC. Skip NICs without one (the guest keeps its
+            // default DHCP behavior).
+            section += "\n    addresses:"
+            if !ipv6Only {
+                guard let ipAddress = nic.ipAddress,
+                    let prefix = nic.netmask.flatMap({ IPv4Address($0)?.prefixLength })
+                else { continue }
+                section += "\n      - \(ipAddress)/\(prefix)"
+            }
             if let ip6Address = nic.ip6Address {
                 section += "\n      - \(ip6Address)/\(nic.prefixLength6 ?? 64)"
             }
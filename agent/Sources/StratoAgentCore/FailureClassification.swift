@@ -46,8 +46,8 @@ extension StorageBackendError: ClassifiableError {
         switch self {
         case .hostMisconfiguration, .unsupportedFormat, .imageSourceUnavailable:
             return .permanent
-        case .createFailed, .deleteFailed, .resizeFailed, .snapshotFailed, .cloneFailed, .infoFailed,
-            .volumeNotFound:
+        case .createFailed, .deleteFailed, .resizeFailed, .snapshotFailed, .cloneFailed, .importFailed,
+            .exportFailed, .infoFailed, .volumeNotFound:
             return .transient
         }
     }
@@ -0,0 +1,627 @@
+import Foundation
+import Logging
+import StratoShared
+
+#if os(Linux)
+import Glibc
+#else
+import Darwin
+#endif
+
+/// The host-network seam the file-share manager depends on: giving a share's
+/// NFS server its own port on the project network. Production adapter: the
+/// Linux network service (an OVN logical switch port bound to an OVS internal
+/// port inside a per-share network namespace). Test adapter: an in-memory
+/// fake, so convergence is testable without OVN or root.
+public protocol FileShareNetworking: Sendable {
+    /// Realizes the server's port described by `endpoint` and returns the
+    /// network namespace it lives in. Idempotent. Throws
+    /// `DependencyPendingError` while the network's switch is not realized
+    /// yet.
+    func ensureServerPort(shareId: UUID, endpoint: NetworkSpec) async throws -> String
+    /// Tears the port and its namespace down. Idempotent.
+    func removeServerPort(shareId: UUID) async
+}
+
+/// Hosts managed NFS file shares: one ext4 filesystem image per share on the
+/// agent's share storage, loop-mounted and served by its own `ganesha.nfsd`
+/// inside the share's network namespace, so the server answers only on the
+/// share's address on the owner project's network.
+///
+/// State lives in the share directory:
+///
+/// ```
+/// <root>/file-shares.json                  share → applied generation, size, clients
+/// <root>/<shareId>/share.img               sparse ext4 image (the share's capacity)
+/// <root>/<shareId>/data/                   its mount point — the read-write export
+/// <root>/<shareId>/snapshots/<id>.img      reflink (or full) copy of the image
+/// <root>/<shareId>/snapshots/<id>/         its read-only mount point
+/// <root>/<shareId>/ganesha.conf            exports and client rules
+/// <root>/<shareId>/ganesha.pid
+/// ```
+///
+/// Convergence is level-triggered and latest-wins: `submit(_:)` records the
+/// full desired list and runs passes until no newer list arrived meanwhile,
+/// so a long snapshot copy never queues up a backlog of stale syncs. Like
+/// qemu-nbd, ganesha daemonizes and outlives the agent; `restore()` remounts
+/// and respawns what a host reboot took down.
+public actor FileShareManager {
+    /// Runs a command to completion. Injectable so tests can assert the
+    /// invocations without mkfs, mount or ganesha on the host.
+    public typealias Runner = @Sendable (_ executable: String, _ arguments: [String]) async throws -> ProcessResult
+
+    /// What the manager last applied for a share, persisted so a restarted
+    /// agent reports the right generation and knows which shares it hosts.
+    public struct Record: Codable, Equatable, Sendable {
+        public var generation: Int64
+        public var sizeBytes: Int64
+        public var allowedClients: [String]
+        public var snapshots: [UUID]
+        public var serverAddress: String
+        public var namespace: String?
+
+        public init(
+            generation: Int64, sizeBytes: Int64, allowedClients: [String], snapshots: [UUID],
+            serverAddress: String, namespace: String?
+        ) {
+            self.generation = generation
+            self.sizeBytes = sizeBytes
+            self.allowedClients = allowedClients
+            self.snapshots = snapshots
+            self.serverAddress = serverAddress
+            self.namespace = namespace
+        }
+    }
+
+    public enum ShareError: Error, LocalizedError, Sendable {
+        case commandFailed(command: String, status: Int32, output: String)
+        case shrinkRefused(current: Int64, requested: Int64)
+
+        public var errorDescription: String? {
+            switch self {
+            case .commandFailed(let command, let status, let output):
+                return "`\(command)` failed (exit \(status)): \(output)"
+            case .shrinkRefused(let current, let requested):
+                return "refusing to shrink file share from \(current) to \(requested) bytes"
+            }
+        }
+    }
+
+    private struct Failure {
+        let generation: Int64
+        let error: String
+    }
+
+    private let root: String
+    private let ganeshaBinary: String
+    private let network: any FileShareNetworking
+    private let run: Runner
+    private let logger: Logger
+
+    private var records: [UUID: Record]
+    private var failures: [UUID: Failure] = [:]
+    private var phases: [UUID: String] = [:]
+    private var pending: [DesiredFileShareState]?
+    private var passRunning = false
+
+    public init(
+        root: String,
+        ganeshaBinary: String = "ganesha.nfsd",
+        network: any FileShareNetworking,
+        logger: Logger,
+        run: @escaping Runner = { executable, arguments in
+            try await ProcessRunner.run(
+                executableURL: URL(fileURLWithPath: "/usr/bin/env"), arguments: [executable] + arguments,
+                timeout: .seconds(1800))
+        }
+    ) {
+        self.root = root
+        self.ganeshaBinary = ganeshaBinary
+        self.network = network
+        self.run = run
+        self.logger = logger
+        self.records = Self.loadTable(at: (root as NSString).appendingPathComponent("file-shares.json"))
+    }
+
+    // MARK: - Paths
+
+    private var tablePath: String {
+        (root as NSString).appendingPathComponent("file-shares.json")
+    }
+
+    func directory(for shareId: UUID) -> String {
+        (root as NSString).appendingPathComponent(shareId.uuidString.lowercased())
+    }
+
+    func imagePath(for shareId: UUID) -> String {
+        (directory(for: shareId) as NSString).appendingPathComponent("share.img")
+    }
+
+    func dataPath(for shareId: UUID) -> String {
+        (directory(for: shareId) as NSString).appendingPathComponent("data")
+    }
+
+    func snapshotImagePath(shareId: UUID, snapshotId: UUID) -> String {
+        ((directory(for: shareId) as NSString).appendingPathComponent("snapshots") as NSString)
+            .appendingPathComponent("\(snapshotId.uuidString.lowercased()).img")
+    }
+
+    func snapshotMountPath(shareId: UUID, snapshotId: UUID) -> String {
+        ((directory(for: shareId) as NSString).appendingPathComponent("snapshots") as NSString)
+            .appendingPathComponent(snapshotId.uuidString.lowercased())
+    }
+
+    private func configPath(for shareId: UUID) -> String {
+        (directory(for: shareId) as NSString).appendingPathComponent("ganesha.conf")
+    }
+
+    private func pidFilePath(for shareId: UUID) -> String {
+        (directory(for: shareId) as NSString).appendingPathComponent("ganesha.pid")
+    }
+
+    // MARK: - Convergence
+
+    /// The shares this agent hosts, for the desired-state reconciler and tests.
+    public var hostedShareIDs: Set<UUID> {
+        Set(records.keys)
+    }
+
+    /// Records `shares` as the full desired list and converges on it. Returns
+    /// once no newer list is waiting; a call arriving mid-pass returns at once
+    /// and its list is picked up by the running pass.
+    public func submit(_ shares: [DesiredFileShareState]) async {
+        pending = shares
+        guard !passRunning else { return }
+        passRunning = true
+        while let next = pending {
+            pending = nil
+            await converge(next)
+        }
+        passRunning = false
+    }
+
+    private func converge(_ desired: [DesiredFileShareState]) async {
+        let wanted = Dictionary(
+            desired.filter { $0.desiredStatus == .present }.map { ($0.shareId, $0) },
+            uniquingKeysWith: { first, _ in first })
+
+        // Anything hosted here that the control plane no longer wants —
+        // absent, or missing from the full list — is torn down.
+        for shareId in records.keys where wanted[shareId] == nil {
+            do {
+                try await teardown(shareId)
+                failures.removeValue(forKey: shareId)
+            } catch {
+                recordFailure(shareId, generation: records[shareId]?.generation ?? 0, error: error)
+            }
+        }
+        // A create that never produced a share leaves nothing to tear down,
+        // only bookkeeping that would keep reporting it.
+        phases = phases.filter { wanted[$0.key] != nil }
+        failures = failures.filter { wanted[$0.key] != nil || records[$0.key] != nil }
+        for (shareId, share) in wanted.sorted(by: { $0.key.uuidString < $1.key.uuidString }) {
+            if let record = records[shareId], record.generation >= share.generation,
+                record.allowedClients == share.allowedClients, serverIsRunning(shareId)
+            {
+                continue
+            }
+            if let failure = failures[shareId], failure.generation == share.generation,
+                records[shareId]?.allowedClients == share.allowedClients
+            {
+                // Same generation already failed: wait for a new one rather
+                // than re-run the doomed attempt on every sync.
+                continue
+            }
+            do {
+                try await apply(share)
+                failures.removeValue(forKey: shareId)
+                phases.removeValue(forKey: shareId)
+            } catch let error as DependencyPendingError {
+                // Not a failure: the next sync re-drives the share once the
+                // network lands, and the report shows it still converging.
+                phases[shareId] = error.reason
+            } catch {
+                recordFailure(shareId, generation: share.generation, error: error)
+                phases.removeValue(forKey: shareId)
+            }
+        }
+    }
+
+    private func recordFailure(_ shareId: UUID, generation: Int64, error: any Error) {
+        let message = (error as? LocalizedError)?.errorDescription ?? "\(error)"
+        logger.error(
+            "File share convergence failed",
+            metadata: ["shareId": .string(shareId.uuidString), "error": .string(message)])
+        failures[shareId] = Failure(generation: generation, error: message)
+    }
+
+    /// Brings one share to its desired state: storage, size, snapshots,
+    /// network port, then the exports.
+    private func apply(_ share: DesiredFileShareState) async throws {
+        let shareId = share.shareId
+        let image = imagePath(for: shareId)
+        let data = dataPath(for: shareId)
+        let fileManager = FileManager.default
+
+        phases[shareId] = "provisioning"
+        try fileManager.createDirectory(atPath: data, withIntermediateDirectories: true)
+        if !fileManager.fileExists(atPath: image) {
+            try Self.allocateSparse(at: image, size: share.sizeBytes)
+            try await check("mkfs.ext4", ["-q", "-F", "-m", "0", "-E", "nodiscard", image])
+        }
+        if try await !isMounted(data) {
+            try await check("mount", ["-o", "loop", image, data])
+        }
+
+        let currentSize = Self.fileSize(at: image)
+        if share.sizeBytes > currentSize {
+            phases[shareId] = "resizing"
+            try Self.allocateSparse(at: image, size: share.sizeBytes)
+            let device = try await loopDevice(backing: data)
+            try await check("losetup", ["-c", device])
+            try await check("resize2fs", [device])
+        } else if share.sizeBytes < currentSize {
+            throw ShareError.shrinkRefused(current: currentSize, requested: share.sizeBytes)
+        }
+
+        try await convergeSnapshots(share)
+
+        phases[shareId] = "exporting"
+        let namespace = try await network.ensureServerPort(shareId: shareId, endpoint: share.endpoint)
+        let config = Self.ganeshaConfig(
+            shareId: shareId,
+            serverAddress: share.endpoint.ipAddress ?? "",
+            dataPath: data,
+            snapshots: share.snapshots.map { ($0, snapshotMountPath(shareId: shareId, snapshotId: $0)) },
+            allowedClients: share.allowedClients,
+            stateDirectory: directory(for: shareId)
+        )
+        let previous = try? String(contentsOfFile: configPath(for: shareId), encoding: .utf8)
+        if previous != config {
+            try config.write(toFile: configPath(for: shareId), atomically: true, encoding: .utf8)
+        }
+        if let pid = runningPID(shareId) {
+            // Ganesha re-reads its exports on SIGHUP, so a client-list or
+            // snapshot change does not drop mounted clients.
+            if previous != config {
+                kill(pid, SIGHUP)
+            }
+        } else {
+            try await check(
+                "ip",
+                ["netns", "exec", namespace, ganeshaBinary] + Self.ganeshaArguments(
+                    configPath: configPath(for: shareId), pidFilePath: pidFilePath(for: shareId),
+                    logPath: (directory(for: shareId) as NSString).appendingPathComponent("ganesha.log")))
+        }
+
+        records[shareId] = Record(
+            generation: share.generation,
+            sizeBytes: share.sizeBytes,
+            allowedClients: share.allowedClients,
+            snapshots: share.snapshots,
+            serverAddress: share.endpoint.ipAddress ?? "",
+            namespace: namespace
+        )
+        persist()
+        logger.info(
+            "File share converged",
+            metadata: [
+                "shareId": .string(shareId.uuidString),
+                "generation": .stringConvertible(share.generation),
+                "clients": .stringConvertible(share.allowedClients.count),
+            ])
+    }
+
+    /// Takes snapshots the share's list gained and drops those it lost. A new
+    /// snapshot freezes the filesystem for the copy, so it is crash-consistent
+    /// with respect to in-flight NFS writes.
+    private func convergeSnapshots(_ share: DesiredFileShareState) async throws {
+        let shareId = share.shareId
+        let wanted = Set(share.snapshots)
+        let snapshotDirectory = (directory(for: shareId) as NSString).appendingPathComponent("snapshots")
+        try FileManager.default.createDirectory(atPath: snapshotDirectory, withIntermediateDirectories: true)
+
+        for snapshotId in presentSnapshots(shareId) where !wanted.contains(snapshotId) {
+            try await removeSnapshot(shareId: shareId, snapshotId: snapshotId)
+        }
+        for snapshotId in share.snapshots {
+            let image = snapshotImagePath(shareId: shareId, snapshotId: snapshotId)
+            let mount = snapshotMountPath(shareId: shareId, snapshotId: snapshotId)
+            if !FileManager.default.fileExists(atPath: image) {
+                phases[shareId] = "snapshotting"
+                let partial = image + ".partial"
+                try await check("fsfreeze", ["-f", dataPath(for: shareId)])
+                let copied: Result<Void, any Error>
+                do {
+                    try await check(
+                        "cp", ["--reflink=auto", "--sparse=always", imagePath(for: shareId), partial])
+                    copied = .success(())
+                } catch {
+                    copied = .failure(error)
+                }
+                try await check("fsfreeze", ["-u", dataPath(for: shareId)])
+                try copied.get()
+                try FileManager.default.moveItem(atPath: partial, toPath: image)
+            }
+            try FileManager.default.createDirectory(atPath: mount, withIntermediateDirectories: true)
+            if try await !isMounted(mount) {
+                // `noload` skips journal replay, which a read-only mount of a
+                // copy taken from a live filesystem would otherwise need.
+                try await check("mount", ["-o", "loop,ro,noload", image, mount])
+            }
+        }
+    }
+
+    private func removeSnapshot(shareId: UUID, snapshotId: UUID) async throws {
+        let mount = snapshotMountPath(shareId: shareId, snapshotId: snapshotId)
+        if try await isMounted(mount) {
+            try await check("umount", [mount])
+        }
+        try? FileManager.default.removeItem(atPath: mount)
+        try? FileManager.default.removeItem(atPath: snapshotImagePath(shareId: shareId, snapshotId: snapshotId))
+    }
+
+    /// Stops the server, unmounts everything and deletes the share's data.
+    private func teardown(_ shareId: UUID) async throws {
+        logger.info("Removing file share", metadata: ["shareId": .string(shareId.uuidString)])
+        await stopServer(shareId)
+        for snapshotId in presentSnapshots(shareId) {
+            try await removeSnapshot(shareId: shareId, snapshotId: snapshotId)
+        }
+        if try await isMounted(dataPath(for: shareId)) {
+            try await check("umount", [dataPath(for: shareId)])
+        }
+        await network.removeServerPort(shareId: shareId)
+        try? FileManager.default.removeItem(atPath: directory(for: shareId))
+        records.removeValue(forKey: shareId)
+        persist()
+    }
+
+    /// Remounts every recorded share and restarts servers a host reboot took
+    /// down, by re-applying what was last converged.
+    public func restore() async {
+        for (shareId, record) in records where !serverIsRunning(shareId) {
+            guard FileManager.default.fileExists(atPath: imagePath(for: shareId)) else {
+                logger.warning(
+                    "Dropping file share whose image is gone",
+                    metadata: ["shareId": .string(shareId.uuidString)])
+                records.removeValue(forKey: shareId)
+                continue
+            }
+            // The port spec is not persisted; the first sync after
+            // registration re-realizes the network port and restarts the
+            // server. Remount now so local state is whole before it arrives.
+            do {
+                if try await !isMounted(dataPath(for: shareId)) {
+                    try await check("mount", ["-o", "loop", imagePath(for: shareId), dataPath(for: shareId)])
+                }
+            } catch {
+                recordFailure(shareId, generation: record.generation, error: error)
+            }
+        }
+        persist()
+    }
+
+    // MARK: - Observation
+
+    /// Every share this agent holds, plus shares still converging toward
+    /// first existence or whose first convergence failed — full-list
+    /// semantics, like the VM report.
+    public func observedStates() -> [ObservedFileShareState] {
+        var ids = Set(records.keys)
+        ids.formUnion(phases.keys)
+        ids.formUnion(failures.keys)
+        return ids.sorted { $0.uuidString < $1.uuidString }.map { shareId in
+            let record = records[shareId]
+            let failure = failures[shareId]
+            let status: ObservedFileShareStatus
+            if failure != nil {
+                status = .error
+            } else if record != nil, serverIsRunning(shareId) {
+                status = .available
+            } else {
+                status = .provisioning
+            }
+            return ObservedFileShareState(
+                shareId: shareId,
+                status: status,
+                observedGeneration: record?.generation ?? 0,
+                sizeBytes: record?.sizeBytes ?? 0,
+                usedBytes: record == nil ? nil : Self.usedBytes(mountedAt: dataPath(for: shareId)),
+                snapshots: (record?.snapshots ?? []).compactMap { snapshotId in
+                    let image = snapshotImagePath(shareId: shareId, snapshotId: snapshotId)
+                    guard FileManager.default.fileExists(atPath: image) else { return nil }
+                    return ObservedFileShareSnapshot(snapshotId: snapshotId, sizeBytes: Self.allocatedBytes(at: image))
+                },
+                convergencePhase: phases[shareId],
+                lastError: failure?.error,
+                failedGeneration: failure?.generation
+            )
+        }
+    }
+
+    // MARK: - Ganesha
+
+    /// The ganesha configuration for one share: NFSv4 only, bound to the
+    /// share's address, with the read-write export and one read-only export
+    /// per snapshot. An empty client list writes no CLIENT block, so the
+    /// export admits nobody. Split out so tests can assert the shape.
+    public static func ganeshaConfig(
+        shareId: UUID,
+        serverAddress: String,
+        dataPath: String,
+        snapshots: [(id: UUID, path: String)],
+        allowedClients: [String],
+        stateDirectory: String
+    ) -> String {
+        func export(id: Int, path: String, pseudo: String, access: String) -> String {
+            var block = """
+                EXPORT {
+                    Export_Id = \(id);
+                    Path = "\(path)";
+                    Pseudo = "\(pseudo)";
+                    Protocols = 4;
+                    Access_Type = None;
+                    Squash = No_Root_Squash;
+                    SecType = sys;
+                    FSAL { Name = VFS; }
+
+                """
+            if !allowedClients.isEmpty {
+                block += """
+                        CLIENT {
+                            Clients = \(allowedClients.joined(separator: ", "));
+                            Access_Type = \(access);
+                        }
+
+                    """
+            }
+            return block + "}\n"
+        }
+
+        var config = """
+            # Managed by strato-agent for file share \(shareId.uuidString.lowercased()); do not edit.
+            NFS_CORE_PARAM {
+                Protocols = 4;
+                Bind_addr = \(serverAddress);
+                Enable_NLM = false;
+                Enable_RQUOTA = false;
+            }
+            NFSV4 {
+                RecoveryBackend = fs;
+                RecoveryRoot = "\(stateDirectory)/recovery";
+            }
+
+            """
+        config += export(id: 1, path: dataPath, pseudo: FileShareExport.path(shareId: shareId), access: "RW")
+        for (index, snapshot) in snapshots.enumerated() {
+            config += export(
+                id: index + 2, path: snapshot.path,
+                pseudo: FileShareExport.snapshotPath(shareId: shareId, snapshotId: snapshot.id), access: "RO")
+        }
+        return config
+    }
+
+    /// The ganesha invocation for one share (daemonizes by default).
+    public static func ganeshaArguments(configPath: String, pidFilePath: String, logPath: String) -> [String] {
+        ["-f", configPath, "-p", pidFilePath, "-L", logPath]
+    }
+
+    private func stopServer(_ shareId: UUID) async {
+        if let pid = runningPID(shareId) {
+            kill(pid, SIGTERM)
+            for _ in 0..<50 {
+                if !processIsAlive(pid) { break }
+                try? await Task.sleep(nanoseconds: 100_000_000)
+            }
+            if processIsAlive(pid) {
+                kill(pid, SIGKILL)
+            }
+        }
+        try? FileManager.default.removeItem(atPath: pidFilePath(for: shareId))
+    }
+
+    private func serverIsRunning(_ shareId: UUID) -> Bool {
+        runningPID(shareId) != nil
+    }
+
+    func runningPID(_ shareId: UUID) -> pid_t? {
+        guard let contents = try? String(contentsOfFile: pidFilePath(for: shareId), encoding: .utf8),
+            let pid = pid_t(contents.trimmingCharacters(in: .whitespacesAndNewlines)),
+            pid > 0,
+            processIsAlive(pid)
+        else {
+            return nil
+        }
+        return pid
+    }
+
+    private func processIsAlive(_ pid: pid_t) -> Bool {
+        if kill(pid, 0) == 0 { return true }
+        return errno == EPERM
+    }
+
+    // MARK: - Host helpers
+
+    @discardableResult
+    private func check(_ executable: String, _ arguments: [String]) async throws -> String {
+        let result = try await run(executable, arguments)
+        guard result.terminationStatus == 0 else {
+            throw ShareError.commandFailed(
+                command: ([executable] + arguments).joined(separator: " "),
+                status: result.terminationStatus,
+                output: result.combinedOutput.trimmingCharacters(in: .whitespacesAndNewlines))
+        }
+        return String(data: result.standardOutput, encoding: .utf8) ?? ""
+    }
+
+    private func isMounted(_ path: String) async throws -> Bool {
+        try await run("mountpoint", ["-q", path]).terminationStatus == 0
+    }
+
+    private func loopDevice(backing mountPath: String) async throws -> String {
+        try await check("findmnt", ["-n", "-o", "SOURCE", mountPath])
+            .trimmingCharacters(in: .whitespacesAndNewlines)
+    }
+
+    private func presentSnapshots(_ shareId: UUID) -> [UUID] {
+        let snapshotDirectory = (directory(for: shareId) as NSString).appendingPathComponent("snapshots")
+        let entries = (try? FileManager.default.contentsOfDirectory(atPath: snapshotDirectory)) ?? []
+        return entries.compactMap { entry in
+            entry.hasSuffix(".img") ? UUID(uuidString: String(entry.dropLast(4))) : nil
+        }
+    }
+
+    /// Creates or grows a sparse file to `size` bytes.
+    static func allocateSparse(at path: String, size: Int64) throws {
+        if !FileManager.default.fileExists(atPath: path) {
+            FileManager.default.createFile(atPath: path, contents: nil)
+        }
+        let handle = try FileHandle(forWritingTo: URL(fileURLWithPath: path))
+        defer { try? handle.close() }
+        try handle.truncate(atOffset: UInt64(size))
+    }
+
+    static func fileSize(at path: String) -> Int64 {
+        let attributes = try? FileManager.default.attributesOfItem(atPath: path)
+        return (attributes?[.size] as? NSNumber)?.int64Value ?? 0
+    }
+
+    /// Bytes a sparse file actually occupies on disk.
+    static func allocatedBytes(at path: String) -> Int64 {
+        var info = stat()
+        guard stat(path, &info) == 0 else { return 0 }
+        return Int64(info.st_blocks) * 512
+    }
+
+    static func usedBytes(mountedAt path: String) -> Int64? {
+        guard let attributes = try? FileManager.default.attributesOfFileSystem(forPath: path),
+            let total = (attributes[.systemSize] as? NSNumber)?.int64Value,
+            let free = (attributes[.systemFreeSize] as? NSNumber)?.int64Value
+        else {
+            return nil
+        }
+        return max(total - free, 0)
+    }
+
+    private func persist() {
+        do {
+            try FileManager.default.createDirectory(atPath: root, withIntermediateDirectories: true)
+            let table = Dictionary(uniqueKeysWithValues: records.map { ($0.key.uuidString, $0.value) })
+            let data = try JSONEncoder().encode(table)
+            try data.write(to: URL(fileURLWithPath: tablePath), options: .atomic)
+        } catch {
+            logger.error("Failed to write file share table at \(tablePath): \(error)")
+        }
+    }
+
+    private static func loadTable(at path: String) -> [UUID: Record] {
+        guard let data = FileManager.default.contents(atPath: path),
+            let table = try? JSONDecoder().decode([String: Record].self, from: data)
+        else {
+            return [:]
+        }
+        return Dictionary(
+            uniqueKeysWithValues: table.compactMap { key, value in UUID(uuidString: key).map { ($0, value) } })
+    }
+}
@@ -440,6 +440,101 @@ public actor FileSystemStorageBackend: StorageBackend {
         return DiskAttachment(path: targetPath, format: format)
     }
 
+    // MARK: - Migration
+
+    /// The disk file already is the export: detached volumes are quiescent,
+    /// so it is streamed in place.
+    public func exportVolume(
+        volumeId: String, volumePath: String, send: @Sendable (String) async throws -> Void
+    ) async throws {
+        guard FileManager.default.fileExists(atPath: volumePath) else {
+            throw StorageBackendError.volumeNotFound(volumeId)
+        }
+        logger.info(
+            "Exporting volume",
+            metadata: ["volumeId": .string(volumeId), "path": .string(volumePath)])
+        try await send(volumePath)
+    }
+
+    /// Stages the incoming bytes inside the volume's own directory, so the
+    /// publishing rename never crosses a filesystem. A qcow2 copy must not
+    /// name a backing file: migrated bytes are tenant data, and a header
+    /// pointing elsewhere on this host would let them read it.
+    public func importVolume(
+        volumeId: String, format: DiskFormat, receive: @Sendable (String) async throws -> Void
+    ) async throws -> DiskAttachment {
+        let path = volumePath(volumeId: volumeId, format: format)
+        let stagingPath = path + ".import"
+
+        logger.info(
+            "Importing volume",
+            metadata: ["volumeId": .string(volumeId), "format": .string(format.rawValue)])
+
+        try FileManager.default.createDirectory(
+            atPath: volumeDirectory(volumeId: volumeId),
+            withIntermediateDirectories: true,
+            attributes: nil
+        )
+        try? FileManager.default.removeItem(atPath: stagingPath)
+
+        do {
+            try await receive(stagingPath)
+            let info = try await queryImageInfo(path: stagingPath)
+            guard info.format == format.rawValue else {
+                throw StorageBackendError.importFailed(
+                    "expected a \(format.rawValue) image, received \(info.format)")
+            }
+            guard info.backingFilename == nil else {
+                throw StorageBackendError.importFailed("the received image references a backing file")
+            }
+            guard rename(stagingPath, path) == 0 else {
+                let code = errno
+                throw StorageBackendError.importFailed(
+                    "publishing failed: \(String(cString: strerror(code)))")
+            }
+        } catch {
+            try? FileManager.default.removeItem(atPath: stagingPath)
+            throw error
+        }
+
+        logger.info(
+            "Volume imported successfully",
+            metadata: ["volumeId": .string(volumeId), "path": .string(path)])
+        return DiskAttachment(path: path, format: format)
+    }
+
+    // MARK: - Boot Disk Export
+
+    /// Flattens the overlay and its backing chain with `qemu-img convert`,
+    /// staged beside the disk so the copy lands on the same filesystem.
+    /// The VM must be stopped: a running QEMU would be writing the overlay
+    /// while it is read.
+    public func exportBootDisk(
+        vmId: String, diskPath: String, send: @Sendable (String) async throws -> Void
+    ) async throws {
+        guard FileManager.default.fileExists(atPath: diskPath) else {
+            throw StorageBackendError.exportFailed("VM \(vmId) has no boot disk at \(diskPath)")
+        }
+        let stagingPath = diskPath + ".export"
+        try? FileManager.default.removeItem(atPath: stagingPath)
+        defer { try? FileManager.default.removeItem(atPath: stagingPath) }
+
+        logger.info(
+            "Flattening boot disk for export",
+            metadata: ["vmId": .string(vmId), "path": .string(diskPath)])
+
+        let result = try await runQemuImg(["convert", "-O", DiskFormat.qcow2.rawValue, diskPath, stagingPath])
+        if result.terminationStatus != 0 {
+            let output = result.combinedOutput
+            logger.error(
+                "qemu-img flatten failed",
+                metadata: ["vmId": .string(vmId), "output": .string(output)])
+            throw qemuImgFailure(
+                output: output, context: "qemu-img flatten", fallback: StorageBackendError.exportFailed)
+        }
+        try await send(stagingPath)
+    }
+
     // MARK: - Volume Info
 
     public func volumeInfo(volumePath: String) async throws -> VolumeInfoResult {
@@ -0,0 +1,85 @@
+import Foundation
+import StratoShared
+
+/// What the agent needs to honor `VMSpec.cpuModel` (wire v28): the host CPU
+/// flags it reports in `HostInfo`, the command line of the throwaway QEMU it
+/// asks which named models this host can run, the baseline `host-model`
+/// resolves to, and the final `-cpu` value. Pure, so the choices are testable
+/// without KVM.
+public enum GuestCPUModels {
+    /// Budget for the probe QEMU to start, answer and exit.
+    public static let probeTimeout: Duration = .seconds(10)
+
+    /// Named baselines `host-model` tries, newest first, per vendor. QEMU has
+    /// no `host-model` of its own; the agent picks the newest named model the
+    /// host runs in full, so the guest sees a stable, migratable CPU rather
+    /// than whatever stepping this host happens to have.
+    static let intelBaselines = [
+        "GraniteRapids", "SapphireRapids", "Icelake-Server", "Cascadelake-Server", "Skylake-Server",
+        "Skylake-Client", "Broadwell", "Haswell", "IvyBridge", "SandyBridge", "Westmere", "Nehalem",
+    ]
+    static let amdBaselines = ["EPYC-Genoa", "EPYC-Milan", "EPYC-Rome", "EPYC"]
+
+    /// What a simulated agent advertises: every known baseline.
+    public static var simulatedModels: [String] {
+        (intelBaselines + amdBaselines).sorted()
+    }
+
+    /// The CPU flags of the first processor in `/proc/cpuinfo` contents —
+    /// `flags` on x86, `Features` on ARM — sorted and de-duplicated. Every
+    /// core of a host reports the same set, so one block is enough.
+    public static func flags(cpuinfo: String) -> [String] {
+        for line in cpuinfo.split(separator: "\n") {
+            let parts = line.split(separator: ":", maxSplits: 1)
+            guard parts.count == 2 else { continue }
+            let key = parts[0].trimmingCharacters(in: .whitespaces)
+            guard key == "flags" || key == "Features" else { continue }
+            return Set(parts[1].split(separator: " ").map(String.init)).sorted()
+        }
+        return []
+    }
+
+    /// Arguments for a QEMU that builds no machine and only answers QMP on
+    /// `qmpSocketPath`, so `query-cpu-definitions` reports what the
+    /// accelerator can offer. It needs `quit` (or the runner's timeout) to
+    /// exit.
+    public static func probeArguments(qmpSocketPath: String) -> [String] {
+        #if os(macOS)
+        let accelerator = "hvf"
+        #else
+        let accelerator = "kvm"
+        #endif
+        return [
+            "-machine", "none", "-accel", accelerator, "-nodefaults", "-display", "none", "-S",
+            "-qmp", "unix:\(qmpSocketPath),server=on,wait=off",
+        ]
+    }
+
+    /// The newest known baseline among `usable`, trying the host vendor's
+    /// line first. Nil when none is usable — an ARM host, where KVM runs
+    /// only the host's own CPU, or one whose probe failed.
+    public static func hostModel(usable: Set<String>, vendor: String?) -> String? {
+        let lines = vendor == "AuthenticAMD" ? amdBaselines + intelBaselines : intelBaselines + amdBaselines
+        return lines.first { usable.contains($0) }
+    }
+
+    /// The `-cpu` value for `model`. Without an accelerator every model is
+    /// emulated, and QEMU rejects `host` under TCG, so passthrough and
+    /// `host-model` both become `max`. With one, no model (a spec from before
+    /// v28) means passthrough, and `host-model` falls back to passthrough
+    /// when the host has no known baseline. A named model is passed as is;
+    /// the scheduler only sends one to an agent that reported it usable.
+    public static func qemuCPUArgument(
+        model: GuestCPUModel?, accelerated: Bool, usable: Set<String>, vendor: String?
+    ) -> String {
+        switch model {
+        case .named(let name):
+            return name
+        case .hostModel:
+            guard accelerated else { return "max" }
+            return hostModel(usable: usable, vendor: vendor) ?? "host"
+        case .hostPassthrough, nil:
+            return accelerated ? "host" : "max"
+        }
+    }
+}
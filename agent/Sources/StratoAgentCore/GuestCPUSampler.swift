@@ -0,0 +1,75 @@
+import Foundation
+
+/// Turns the CPU time of a VM's vCPU threads into a utilization figure for
+/// the observed-state report (and, from there, the control plane's
+/// rightsizing history).
+///
+/// A vCPU is a host thread, so the time the guest spent running on it is
+/// that thread's `utime + stime` in `/proc/<tid>/stat`. Utilization is the
+/// growth of that sum between two readings, over the wall time between them
+/// times the vCPU count: 0 for an idle guest, 1 for one with every vCPU
+/// saturated. Pure apart from `read`, so the arithmetic is testable without
+/// a running VM.
+public enum GuestCPUSampler {
+    /// One reading of a VM's vCPU time.
+    public struct Reading: Equatable, Sendable {
+        /// Summed `utime + stime` of every vCPU thread, in clock ticks.
+        public let ticks: UInt64
+        /// How many vCPU threads contributed, which bounds the utilization.
+        public let vcpus: Int
+        /// When the reading was taken, in seconds on a monotonic clock.
+        public let at: Double
+
+        public init(ticks: UInt64, vcpus: Int, at: Double) {
+            self.ticks = ticks
+            self.vcpus = vcpus
+            self.at = at
+        }
+    }
+
+    /// `USER_HZ`, the unit of `/proc/<tid>/stat` times. Fixed at 100 by the
+    /// kernel ABI on every architecture the agent ships for.
+    public static let ticksPerSecond: Double = 100
+
+    /// `utime + stime` from one `/proc/<tid>/stat` line. The command name in
+    /// field 2 is parenthesized and may itself contain spaces or parens
+    /// (QEMU names vCPU threads `CPU 0/KVM`), so fields are counted from the
+    /// last `)`.
+    public static func ticks(statLine: String) -> UInt64? {
+        guard let close = statLine.lastIndex(of: ")") else { return nil }
+        // After the comm: state is field 3, utime field 14, stime field 15.
+        let fields = statLine[statLine.index(after: close)...].split(separator: " ")
+        guard fields.count > 12, let utime = UInt64(fields[11]), let stime = UInt64(fields[12]) else {
+            return nil
+        }
+        return utime + stime
+    }
+
+    /// Reads the summed vCPU time of `threadIDs` under `procRoot`. Nil when
+    /// any thread is unreadable — a vCPU that vanished mid-read (an unplug, a
+    /// VM stopping) makes the sum meaningless rather than merely smaller.
+    public static func read(threadIDs: [Int], at: Double, procRoot: String = "/proc") -> Reading? {
+        guard !threadIDs.isEmpty else { return nil }
+        var total: UInt64 = 0
+        for tid in threadIDs {
+            guard let line = try? String(contentsOfFile: "\(procRoot)/\(tid)/stat", encoding: .utf8),
+                let ticks = ticks(statLine: line)
+            else { return nil }
+            total += ticks
+        }
+        return Reading(ticks: total, vcpus: threadIDs.count, at: at)
+    }
+
+    /// The utilization between two readings, clamped to 0...1. Nil when the
+    /// pair can't be compared: no time elapsed, the vCPU count changed (a
+    /// hot-add mid-window), or the counter went backwards (the VM restarted
+    /// and its threads are new).
+    public static func utilization(from previous: Reading, to current: Reading) -> Double? {
+        let elapsed = current.at - previous.at
+        guard elapsed > 0, current.vcpus == previous.vcpus, current.vcpus > 0,
+            current.ticks >= previous.ticks
+        else { return nil }
+        let busySeconds = Double(current.ticks - previous.ticks) / ticksPerSecond
+        return min(max(busySeconds / (elapsed * Double(current.vcpus)), 0), 1)
+    }
+}
@@ -31,6 +31,7 @@ public enum HostPreflight {
         case qemuImgBinary = "qemu-img"
         case uefiFirmware = "uefi_firmware"
         case swtpmBinary = "swtpm"
+        case virtFwVarsBinary = "virt-fw-vars"
         case ovnDatabaseSocket = "ovn_nb_socket"
         case ovnDatabaseTLSFiles = "ovn_nb_tls_files"
         case ovsDatabaseSocket = "ovsdb_socket"
@@ -85,6 +86,9 @@ public enum HostPreflight {
         /// (issue #565); its absence is advisory, since only VMs that ask for
         /// a vTPM are affected.
         public var swtpmBinaryPath: String?
+        /// The configured `virt-fw-vars` tool, or nil when none was found.
+        /// Advisory like swtpm: only VMs with custom Secure Boot keys need it.
+        public var virtFwVarsBinaryPath: String?
         /// Whether the agent runs with OVN networking (enables the OVN/OVS
         /// socket and tool checks).
         public var ovnMode: Bool
@@ -111,6 +115,7 @@ public enum HostPreflight {
             firecrackerSocketDirectory: String? = nil,
             firmwarePath: String? = nil,
             swtpmBinaryPath: String? = nil,
+            virtFwVarsBinaryPath: String? = nil,
             ovnMode: Bool = false,
             ovnNBConnection: String = "unix:/var/run/ovn/ovnnb_db.sock",
             ovnNBTLSFilePaths: [String] = [],
@@ -126,6 +131,7 @@ public enum HostPreflight {
             self.firecrackerSocketDirectory = firecrackerSocketDirectory
             self.firmwarePath = firmwarePath
             self.swtpmBinaryPath = swtpmBinaryPath
+            self.virtFwVarsBinaryPath = virtFwVarsBinaryPath
             self.ovnMode = ovnMode
             self.ovnNBConnection = ovnNBConnection
             self.ovnNBTLSFilePaths = ovnNBTLSFilePaths
@@ -179,6 +185,12 @@ public enum HostPreflight {
             check(.swtpmBinary)?.passed ?? false
         }
 
+        /// Whether this host can enroll custom Secure Boot keys into a VM's
+        /// variable store (wire v29).
+        public var secureBootKeyEnrollmentAvailable: Bool {
+            check(.virtFwVarsBinary)?.passed ?? false
+        }
+
         /// Whether the OVN-specific host dependencies (database sockets and
         /// CLI tools) all passed. Only meaningful when the preflight ran in
         /// OVN mode.
@@ -241,6 +253,7 @@ public enum HostPreflight {
         checks.append(checkQemuImg(inputs.qemuImgPath))
         checks.append(checkFirmware(inputs.firmwarePath))
         checks.append(checkSwtpm(inputs.swtpmBinaryPath))
+        checks.append(checkVirtFwVars(inputs.virtFwVarsBinaryPath))
 
         if inputs.ovnMode {
             if inputs.ovnNBConnection.hasPrefix("unix:") {
@@ -355,6 +368,21 @@ public enum HostPreflight {
         return .pass(.swtpmBinary, severity: .advisory)
     }
 
+    /// virt-fw-vars writes custom Secure Boot keys into a VM's variable
+    /// store. Advisory: Secure Boot with the template's own keys needs no
+    /// tool, and the scheduler keeps custom-key VMs away via the reported
+    /// capability.
+    static func checkVirtFwVars(_ path: String?) -> Check {
+        guard let path, FileManager.default.isExecutableFile(atPath: path) else {
+            return .fail(
+                .virtFwVarsBinary, severity: .advisory,
+                "virt-fw-vars not found\(path.map { " at \($0)" } ?? "") — this host cannot run VMs with "
+                    + "custom Secure Boot keys. Install it (Debian/Ubuntu: `apt install python3-virt-firmware`, "
+                    + "or `pip install virt-firmware`) or set virt_fw_vars_binary_path in the agent configuration.")
+        }
+        return .pass(.virtFwVarsBinary, severity: .advisory)
+    }
+
     /// All PEM files configured for the ssl: NB endpoint must exist.
     static func checkTLSFiles(_ paths: [String]) -> Check {
         let missing = paths.filter { !FileManager.default.fileExists(atPath: $0) }
@@ -0,0 +1,44 @@
+import Foundation
+import StratoShared
+
+/// Applies an overcommit policy's KSM settings to the kernel's sysfs knobs
+/// (`/sys/kernel/mm/ksm`). QEMU already marks guest RAM mergeable, so turning
+/// the scanner on is all KSM needs from the agent.
+public struct KSMTuner: Sendable {
+    public static let sysfsPath = "/sys/kernel/mm/ksm"
+
+    /// The sysfs directory written to; a temp directory in tests.
+    public let root: String
+
+    public init(root: String = sysfsPath) {
+        self.root = root
+    }
+
+    /// Whether this host's kernel has KSM at all.
+    public var isAvailable: Bool {
+        FileManager.default.fileExists(atPath: (root as NSString).appendingPathComponent("run"))
+    }
+
+    /// The files and values that realize `tuning`, in write order: the scan
+    /// rate is set before the scanner starts. Nil turns the scanner off with
+    /// `run=0`, which leaves already-merged pages merged — `run=2` would
+    /// unmerge them all at once, a memory spike on exactly the host that
+    /// needed the savings.
+    public static func settings(for tuning: KSMTuning?) -> [(file: String, value: String)] {
+        guard let tuning else { return [("run", "0")] }
+        return [
+            ("pages_to_scan", String(tuning.pagesToScan)),
+            ("sleep_millisecs", String(tuning.sleepMilliseconds)),
+            ("run", "1"),
+        ]
+    }
+
+    /// Writes `settings(for:)`, stopping at the first failure (typically a
+    /// kernel without KSM, or an agent without permission to tune it).
+    public func apply(_ tuning: KSMTuning?) throws {
+        for (file, value) in Self.settings(for: tuning) {
+            let path = (root as NSString).appendingPathComponent(file)
+            try value.write(toFile: path, atomically: false, encoding: .utf8)
+        }
+    }
+}
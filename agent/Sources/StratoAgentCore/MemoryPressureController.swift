@@ -0,0 +1,152 @@
+import Foundation
+import StratoShared
+
+/// The host's memory pressure as the kernel's pressure-stall information
+/// reports it (`/proc/pressure/memory`): the percentage of recent wall time
+/// in which at least one task (`some`) or every task (`full`) stalled waiting
+/// for memory.
+public struct MemoryPressure: Equatable, Sendable {
+    /// `some avg10` — the figure the reclaim thresholds compare against.
+    public let someAvg10: Double
+    /// `full avg10`, for logging; nil when the kernel reports no `full` line.
+    public let fullAvg10: Double?
+
+    public init(someAvg10: Double, fullAvg10: Double? = nil) {
+        self.someAvg10 = someAvg10
+        self.fullAvg10 = fullAvg10
+    }
+
+    public static let procPath = "/proc/pressure/memory"
+
+    /// Parses the PSI file's two lines:
+    ///
+    ///     some avg10=1.52 avg60=0.80 avg300=0.20 total=123456
+    ///     full avg10=0.00 avg60=0.00 avg300=0.00 total=0
+    ///
+    /// Nil when there is no `some` line with an `avg10` field.
+    public static func parse(_ text: String) -> MemoryPressure? {
+        var averages: [String: Double] = [:]
+        for line in text.split(whereSeparator: \.isNewline) {
+            let fields = line.split(separator: " ")
+            guard let kind = fields.first else { continue }
+            for field in fields.dropFirst() where field.hasPrefix("avg10=") {
+                averages[String(kind)] = Double(field.dropFirst("avg10=".count))
+            }
+        }
+        guard let some = averages["some"] else { return nil }
+        return MemoryPressure(someAvg10: some, fullAvg10: averages["full"])
+    }
+
+    /// Reads the host's current pressure. Nil on kernels built without PSI
+    /// (or booted with `psi=0`), which leaves reclaim idle rather than
+    /// guessing.
+    public static func read(path: String = procPath) -> MemoryPressure? {
+        guard let text = try? String(contentsOfFile: path, encoding: .utf8) else { return nil }
+        return parse(text)
+    }
+}
+
+/// Decides, one pass at a time, how far to inflate each VM's balloon to give
+/// memory back to a host under pressure. Pure: the agent feeds it the host's
+/// PSI and what it knows of each running VM, and applies the targets it
+/// returns.
+///
+/// The controller only ever squeezes *idle* guests — those with a large share
+/// of their memory sitting available — and moves each balloon by at most
+/// `stepBytes` per pass, so a guest that wakes up is never left more than a
+/// step short. A reclaim target never rises above the operator's own balloon
+/// target (the operator's choice is the ceiling) and never drops below the
+/// VM's floor. Busy guests, and every guest once pressure subsides, are
+/// handed memory back a step at a time until their reclaim is released.
+public enum MemoryPressureController {
+    /// What the controller needs to know about one running VM.
+    public struct VMInput: Equatable, Sendable {
+        public let vmId: String
+        public let memoryBytes: Int64
+        /// The operator's balloon target; nil when none is set.
+        public let operatorTargetBytes: Int64?
+        /// The VM's own floor; nil takes the policy's default fraction.
+        public let floorBytes: Int64?
+        /// The guest's last balloon stats; nil when its driver never
+        /// reported, in which case the VM is never squeezed.
+        public let stats: VMMemoryStats?
+        /// The reclaim target currently applied; nil when none is.
+        public let reclaimTargetBytes: Int64?
+
+        public init(
+            vmId: String,
+            memoryBytes: Int64,
+            operatorTargetBytes: Int64? = nil,
+            floorBytes: Int64? = nil,
+            stats: VMMemoryStats?,
+            reclaimTargetBytes: Int64? = nil
+        ) {
+            self.vmId = vmId
+            self.memoryBytes = memoryBytes
+            self.operatorTargetBytes = operatorTargetBytes
+            self.floorBytes = floorBytes
+            self.stats = stats
+            self.reclaimTargetBytes = reclaimTargetBytes
+        }
+
+        /// What the guest may hold with no reclaim: the operator's target,
+        /// or its whole grant.
+        var ceilingBytes: Int64 {
+            min(operatorTargetBytes ?? memoryBytes, memoryBytes)
+        }
+    }
+
+    /// No floor goes below this, whatever the policy's fraction says — the
+    /// same bound the control plane puts on an operator's balloon target.
+    public static let minimumFloorBytes: Int64 = 128 * 1024 * 1024
+
+    /// The reclaim targets that should change this pass: a number is a new
+    /// target, nil releases the VM's reclaim entirely. VMs absent from the
+    /// result keep what they have.
+    public static func plan(
+        pressure: MemoryPressure, policy: PressureReclaimPolicy, vms: [VMInput]
+    ) -> [String: Int64?] {
+        let squeeze = pressure.someAvg10 >= policy.pressureThresholdPercent
+        let release = pressure.someAvg10 <= policy.releaseThresholdPercent
+
+        var changes: [String: Int64?] = [:]
+        for vm in vms {
+            let ceiling = vm.ceilingBytes
+            let floor = min(floorBytes(for: vm, policy: policy), ceiling)
+            let current = vm.reclaimTargetBytes.map { min($0, ceiling) }
+
+            if squeeze, isIdle(vm, policy: policy) {
+                let next = max((current ?? ceiling) - policy.stepBytes, floor)
+                if next < (current ?? ceiling) {
+                    changes[vm.vmId] = .some(next)
+                } else if let current, current < floor {
+                    // The floor moved above what was reclaimed.
+                    changes[vm.vmId] = .some(floor)
+                }
+                continue
+            }
+
+            // A busy guest is handed memory back even while the host is still
+            // under pressure: squeezing a working set turns host pressure into
+            // guest swapping, which helps nobody.
+            guard let current, release || !isIdle(vm, policy: policy) else { continue }
+            let next = current + policy.stepBytes
+            changes[vm.vmId] = next >= ceiling ? .some(nil) : .some(max(next, floor))
+        }
+        return changes
+    }
+
+    /// The VM's own floor, or the policy's fraction of its grant, and never
+    /// below `minimumFloorBytes`.
+    static func floorBytes(for vm: VMInput, policy: PressureReclaimPolicy) -> Int64 {
+        let floor = vm.floorBytes ?? Int64(Double(vm.memoryBytes) * policy.defaultFloorFraction)
+        return max(floor, minimumFloorBytes)
+    }
+
+    /// Whether the guest has at least the policy's idle fraction of what it
+    /// can see available. A guest that never reported stats is never idle.
+    static func isIdle(_ vm: VMInput, policy: PressureReclaimPolicy) -> Bool {
+        guard let stats = vm.stats, stats.totalBytes > 0 else { return false }
+        return Double(stats.availableBytes) / Double(stats.totalBytes) >= policy.idleAvailableFraction
+    }
+}
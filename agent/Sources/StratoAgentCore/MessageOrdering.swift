@@ -105,6 +105,12 @@ extension MessageEnvelope {
             raws = [fields?.volumeId, fields?.vmId]
         case .volumeCreate, .volumeDelete, .volumeResize, .volumeSnapshot, .volumeSnapshotDelete, .volumeInfo:
             raws = [fields?.volumeId]
+        case .volumeExport, .volumeImport, .volumeNBDExport, .volumeNBDUnexport, .volumeMirror:
+            // Migration steps copy a whole disk and can run for hours. A mirror drives the
+            // VM's QEMU but deliberately stays off its lane: parking the VM's lifecycle and
+            // reconcile work behind the copy would be worse than a stop racing it, which
+            // just fails the mirror and leaves the guest on its source disk.
+            raws = [fields?.volumeId]
         case .networkAttach:
             // Attaching a VM to a network acts on both the VM and the named network (the
             // handler may find-or-create the logical switch), so serialize against both.
@@ -130,6 +136,12 @@ extension MessageEnvelope {
             // is never serialized behind (or stuck waiting on) a slow VM operation, while
             // still ordering console frames for the same VM among themselves.
             raws = [fields?.vmId.map { "console:\($0)" }]
+        case .vmGuestExec:
+            // An image build's provisioner can run for many minutes inside the guest. Like a
+            // volume mirror it stays off the VM's lane, so the build's stop (and any reconcile
+            // of the VM) never queues behind a command that will not return; a per-VM guest
+            // lane still runs one build's provisioners strictly in order.
+            raws = [fields?.vmId.map { "guest-exec:\($0)" }]
         case .sandboxExecStart, .sandboxExecInput, .sandboxExecResize, .sandboxExecClose:
             // Interactive exec I/O gets a per-session lane for the same reason as console
             // frames: input/resize/close for a session are applied strictly after its start
@@ -197,6 +197,56 @@ public actor MockStorageBackend: StorageBackend {
         persist()
     }
 
+    // MARK: - Migration
+
+    /// Sends an empty file: a simulated volume has no bytes, and a zero-length
+    /// export is the honest transfer for it (the same reasoning as
+    /// `volumeInfo`'s zero `actualSize`).
+    public func exportVolume(
+        volumeId: String, volumePath: String, send: @Sendable (String) async throws -> Void
+    ) async throws {
+        guard volumes[volumeId] != nil else {
+            throw StorageBackendError.volumeNotFound(volumeId)
+        }
+        logger.info("Exporting mock volume (mock mode)", metadata: ["volumeId": .string(volumeId)])
+        let placeholder = FileManager.default.temporaryDirectory
+            .appendingPathComponent("mock-volume-export-\(UUID().uuidString)").path
+        FileManager.default.createFile(atPath: placeholder, contents: Data())
+        defer { try? FileManager.default.removeItem(atPath: placeholder) }
+        try await send(placeholder)
+    }
+
+    /// Receives into a throwaway file and records the volume. The size is
+    /// unknown to a simulated import, so it is recorded as zero until a
+    /// resize says otherwise.
+    public func importVolume(
+        volumeId: String, format: DiskFormat, receive: @Sendable (String) async throws -> Void
+    ) async throws -> DiskAttachment {
+        logger.info("Importing mock volume (mock mode)", metadata: ["volumeId": .string(volumeId)])
+        let staging = FileManager.default.temporaryDirectory
+            .appendingPathComponent("mock-volume-import-\(UUID().uuidString)").path
+        defer { try? FileManager.default.removeItem(atPath: staging) }
+        try await receive(staging)
+
+        let path = volumePath(volumeId: volumeId, format: format)
+        volumes[volumeId] = MockVolume(path: path, format: format, sizeBytes: 0)
+        persist()
+        return DiskAttachment(path: path, format: format)
+    }
+
+    /// Sends an empty file, as `exportVolume` does: a simulated VM's disk
+    /// has no bytes.
+    public func exportBootDisk(
+        vmId: String, diskPath: String, send: @Sendable (String) async throws -> Void
+    ) async throws {
+        logger.info("Exporting mock boot disk (mock mode)", metadata: ["vmId": .string(vmId)])
+        let placeholder = FileManager.default.temporaryDirectory
+            .appendingPathComponent("mock-disk-export-\(UUID().uuidString)").path
+        FileManager.default.createFile(atPath: placeholder, contents: Data())
+        defer { try? FileManager.default.removeItem(atPath: placeholder) }
+        try await send(placeholder)
+    }
+
     // MARK: - Clone / info
 
     public func cloneVolume(sourceVolumeId: String, sourcePath: String, targetVolumeId: String) async throws
@@ -0,0 +1,278 @@
+import Foundation
+import Logging
+import StratoShared
+
+#if os(Linux)
+import Glibc
+#else
+import Darwin
+#endif
+
+/// Serves volumes over NBD with one `qemu-nbd` per exported volume — the
+/// destination side of an attached-volume migration, and afterwards the
+/// remote disk the migrated VM keeps running on.
+///
+/// State lives in the agent's storage directory:
+///
+/// ```
+/// <stateDirectory>/nbd-exports.json     volume → (path, port); the port
+///                                       assignment the control plane recorded
+/// <stateDirectory>/nbd/<volumeId>.pid   pid file of that volume's qemu-nbd
+/// ```
+///
+/// ## Lifetime, and what happens across an agent restart
+///
+/// qemu-nbd is started with `--fork`, so like swtpm it reparents to init and
+/// outlives the agent: a VM on another host stays connected while this agent
+/// restarts or upgrades. The export table is persisted because the port is
+/// part of the endpoint the control plane handed to that VM's QEMU — an
+/// export that came back on a different port would strand it. `restore()`
+/// respawns any recorded export whose process is gone, on its recorded port.
+///
+/// NBD has no authentication. Exports bind to the configured storage-network
+/// address only, and must never be reachable from tenant networks.
+public actor NBDExportManager {
+    /// Runs the qemu-nbd binary with the given arguments. Injectable so tests
+    /// can assert the invocation without qemu-nbd on the host.
+    public typealias Launcher = @Sendable (_ binaryPath: String, _ arguments: [String]) async throws -> ProcessResult
+
+    public struct Record: Codable, Equatable, Sendable {
+        public let path: String
+        public let port: Int
+
+        public init(path: String, port: Int) {
+            self.path = path
+            self.port = port
+        }
+    }
+
+    public enum ExportError: Error, LocalizedError, Sendable {
+        case noFreePort(ClosedRange<Int>)
+        case launchFailed(volumeId: String, reason: String)
+
+        public var errorDescription: String? {
+            switch self {
+            case .noFreePort(let range):
+                return "no free NBD export port in \(range.lowerBound)-\(range.upperBound)"
+            case .launchFailed(let volumeId, let reason):
+                return "failed to export volume \(volumeId) over NBD: \(reason)"
+            }
+        }
+    }
+
+    private let stateDirectory: String
+    private let advertiseHost: String
+    private let bindAddress: String
+    private let portRange: ClosedRange<Int>
+    private let binaryPath: String
+    private let launch: Launcher
+    private let logger: Logger
+    private var exports: [String: Record]
+
+    public init(
+        stateDirectory: String,
+        advertiseHost: String,
+        bindAddress: String,
+        portRange: ClosedRange<Int>,
+        binaryPath: String = "qemu-nbd",
+        logger: Logger,
+        launch: @escaping Launcher = { binaryPath, arguments in
+            try await ProcessRunner.run(
+                executableURL: URL(fileURLWithPath: binaryPath), arguments: arguments, timeout: .seconds(30))
+        }
+    ) {
+        self.stateDirectory = stateDirectory
+        self.advertiseHost = advertiseHost
+        self.bindAddress = bindAddress
+        self.portRange = portRange
+        self.binaryPath = binaryPath
+        self.launch = launch
+        self.logger = logger
+        self.exports = Self.loadTable(at: (stateDirectory as NSString).appendingPathComponent("nbd-exports.json"))
+    }
+
+    // MARK: - Paths
+
+    private var tablePath: String {
+        (stateDirectory as NSString).appendingPathComponent("nbd-exports.json")
+    }
+
+    func pidFilePath(volumeId: String) -> String {
+        ((stateDirectory as NSString).appendingPathComponent("nbd") as NSString)
+            .appendingPathComponent("\(volumeId).pid")
+    }
+
+    // MARK: - Exports
+
+    /// The endpoint a volume is served on, if it is exported.
+    public func endpoint(for volumeId: String) -> NBDExportEndpoint? {
+        exports[volumeId].map { NBDExportEndpoint(host: advertiseHost, port: $0.port, exportName: volumeId) }
+    }
+
+    /// The recorded export of a volume, if any.
+    public func record(for volumeId: String) -> Record? {
+        exports[volumeId]
+    }
+
+    /// Serves the raw disk at `path` as export `volumeId` and returns its
+    /// endpoint. Idempotent: a volume already exported with a live process
+    /// keeps its endpoint.
+    public func export(volumeId: String, path: String) async throws -> NBDExportEndpoint {
+        if let record = exports[volumeId], record.path == path, runningPID(volumeId: volumeId) != nil {
+            return NBDExportEndpoint(host: advertiseHost, port: record.port, exportName: volumeId)
+        }
+
+        // A stale record, or one serving another file: its process (if any)
+        // must let go of the port before it is reused.
+        await stopProcess(volumeId: volumeId)
+        let port = try exports[volumeId]?.port ?? freePort()
+        try await spawn(volumeId: volumeId, record: Record(path: path, port: port))
+        exports[volumeId] = Record(path: path, port: port)
+        persist()
+        return NBDExportEndpoint(host: advertiseHost, port: port, exportName: volumeId)
+    }
+
+    /// Stops serving a volume. Idempotent; the disk file is left alone.
+    public func unexport(volumeId: String) async {
+        await stopProcess(volumeId: volumeId)
+        if exports.removeValue(forKey: volumeId) != nil {
+            persist()
+        }
+    }
+
+    private func stopProcess(volumeId: String) async {
+        if let pid = runningPID(volumeId: volumeId) {
+            logger.info(
+                "Stopping NBD export",
+                metadata: ["volumeId": .string(volumeId), "pid": .stringConvertible(pid)])
+            kill(pid, SIGTERM)
+            for _ in 0..<20 {
+                if !processIsAlive(pid) { break }
+                try? await Task.sleep(nanoseconds: 100_000_000)
+            }
+            if processIsAlive(pid) {
+                kill(pid, SIGKILL)
+            }
+        }
+        try? FileManager.default.removeItem(atPath: pidFilePath(volumeId: volumeId))
+    }
+
+    /// Respawns every recorded export whose qemu-nbd is gone — after a host
+    /// reboot, say — on the port its clients were told about. Exports whose
+    /// disk no longer exists are dropped.
+    public func restore() async {
+        for (volumeId, record) in exports where runningPID(volumeId: volumeId) == nil {
+            guard FileManager.default.fileExists(atPath: record.path) else {
+                logger.warning(
+                    "Dropping NBD export whose disk is gone",
+                    metadata: ["volumeId": .string(volumeId), "path": .string(record.path)])
+                exports.removeValue(forKey: volumeId)
+                continue
+            }
+            do {
+                try await spawn(volumeId: volumeId, record: record)
+            } catch {
+                logger.error(
+                    "Failed to restore NBD export",
+                    metadata: ["volumeId": .string(volumeId), "error": .string("\(error)")])
+            }
+        }
+        persist()
+    }
+
+    /// The qemu-nbd invocation for one export. Split out so tests can assert
+    /// the argument shape without qemu-nbd on the host.
+    public static func arguments(
+        volumeId: String, record: Record, bindAddress: String, pidFilePath: String
+    ) -> [String] {
+        [
+            "--fork",
+            "--persistent",
+            "--shared=8",
+            "--format=raw",
+            "--cache=none",
+            "--export-name=\(volumeId)",
+            "--bind=\(bindAddress)",
+            "--port=\(record.port)",
+            "--pid-file=\(pidFilePath)",
+            record.path,
+        ]
+    }
+
+    // MARK: - Internals
+
+    private func spawn(volumeId: String, record: Record) async throws {
+        let pidFile = pidFilePath(volumeId: volumeId)
+        try FileManager.default.createDirectory(
+            atPath: (pidFile as NSString).deletingLastPathComponent, withIntermediateDirectories: true)
+        try? FileManager.default.removeItem(atPath: pidFile)
+
+        logger.info(
+            "Starting NBD export",
+            metadata: [
+                "volumeId": .string(volumeId),
+                "path": .string(record.path),
+                "port": .stringConvertible(record.port),
+            ])
+
+        let result: ProcessResult
+        do {
+            // `--fork` returns once the export is serving, so this is not a
+            // long-lived wait.
+            result = try await launch(
+                binaryPath,
+                Self.arguments(volumeId: volumeId, record: record, bindAddress: bindAddress, pidFilePath: pidFile))
+        } catch {
+            throw ExportError.launchFailed(volumeId: volumeId, reason: "\(error)")
+        }
+        guard result.terminationStatus == 0 else {
+            throw ExportError.launchFailed(
+                volumeId: volumeId,
+                reason: "\(binaryPath) exited \(result.terminationStatus): "
+                    + result.combinedOutput.trimmingCharacters(in: .whitespacesAndNewlines))
+        }
+    }
+
+    private func freePort() throws -> Int {
+        let taken = Set(exports.values.map(\.port))
+        guard let port = portRange.first(where: { !taken.contains($0) }) else {
+            throw ExportError.noFreePort(portRange)
+        }
+        return port
+    }
+
+    func runningPID(volumeId: String) -> pid_t? {
+        guard let contents = try? String(contentsOfFile: pidFilePath(volumeId: volumeId), encoding: .utf8),
+            let pid = pid_t(contents.trimmingCharacters(in: .whitespacesAndNewlines)),
+            pid > 0,
+            processIsAlive(pid)
+        else {
+            return nil
+        }
+        return pid
+    }
+
+    private func processIsAlive(_ pid: pid_t) -> Bool {
+        if kill(pid, 0) == 0 { return true }
+        return errno == EPERM
+    }
+
+    private func persist() {
+        do {
+            try FileManager.default.createDirectory(atPath: stateDirectory, withIntermediateDirectories: true)
+            let data = try JSONEncoder().encode(exports)
+            try data.write(to: URL(fileURLWithPath: tablePath), options: .atomic)
+        } catch {
+            logger.error("Failed to write NBD export table at \(tablePath): \(error)")
+        }
+    }
+
+    private static func loadTable(at path: String) -> [String: Record] {
+        guard let data = FileManager.default.contents(atPath: path),
+            let table = try? JSONDecoder().decode([String: Record].self, from: data)
+        else {
+            return [:]
+        }
+        return table
+    }
+}
@@ -75,6 +75,33 @@ public enum OVNNaming {
         nicIndex == 0 ? "vm-\(vmId)" : "vm-\(vmId)-\(nicIndex)"
     }
 
+    /// OVN logical switch port of a file share's NFS server. The `fs-` prefix
+    /// keeps share ports disjoint from VM ports (`vm-`).
+    public static func fileSharePortName(shareId: UUID) -> String {
+        "fs-\(shareId.uuidString.lowercased())"
+    }
+
+    /// The network namespace a file share's NFS server runs in.
+    public static func fileShareNamespace(shareId: UUID) -> String {
+        "strato-fs-\(shareId.uuidString.lowercased())"
+    }
+
+    /// The OVS internal interface backing a share's port. Kernel interface
+    /// names are capped at 15 bytes, so it takes the first 13 hex digits of
+    /// the id; within one host that is unique in practice.
+    public static func fileShareInterfaceName(shareId: UUID) -> String {
+        "fs" + String(shareId.uuidString.lowercased().replacingOccurrences(of: "-", with: "").prefix(13))
+    }
+
+    /// The router-port MAC for a network with no IPv4 gateway to derive one
+    /// from (an IPv6-only network, wire v30). The `02:02:` prefix keeps it
+    /// disjoint from `routerPortMAC` and `floatingIPMAC`; the low four octets
+    /// are the start of the network id, which is as stable as the port.
+    public static func routerPortMAC(networkId: UUID) -> String {
+        let bytes = networkId.uuid
+        return String(format: "02:02:%02x:%02x:%02x:%02x", bytes.0, bytes.1, bytes.2, bytes.3)
+    }
+
     /// A stable, locally-administered unicast MAC for a floating IP, derived
     /// from the floating address itself (floating IPs are unique per site, so
     /// the MAC is too). Used as the `dnat_and_snat` rule's `external_mac`, the
@@ -96,6 +123,8 @@ public enum OVNNaming {
 public struct DesiredSwitch: Equatable, Sendable {
     /// The UUID-derived OVN switch name (`OVNNaming.switchName`).
     public let name: String
+    /// The IPv4 subnet, or the /64 on an IPv6-only network. Informational —
+    /// recorded on the switch, never used to address anything.
     public let subnet: String
     /// The network's user-facing name, i.e. the switch name older agents used
     /// before UUID naming. The actuator renames such a legacy switch in place to
@@ -169,16 +198,22 @@ public struct DesiredRouter: Equatable, Sendable {
     public let snatSubnets: [String]
     /// Floating IPs to realize as `dnat_and_snat` rules on this router.
     public let dnatRules: [DesiredDNATRule]
+    /// BYOIP prefixes (canonical IPv4 CIDRs, sorted) with a floating IP
+    /// attached on this router. Announced under dynamic routing as `discard`
+    /// static routes; converged with the router's dynamic-routing options,
+    /// not by teardown.
+    public let advertisedPrefixes: [String]
 
     public init(
         name: String, routerKey: String, ports: [DesiredRouterPort], snatSubnets: [String],
-        dnatRules: [DesiredDNATRule] = []
+        dnatRules: [DesiredDNATRule] = [], advertisedPrefixes: [String] = []
     ) {
         self.name = name
         self.routerKey = routerKey
         self.ports = ports
         self.snatSubnets = snatSubnets
         self.dnatRules = dnatRules
+        self.advertisedPrefixes = advertisedPrefixes
     }
 
     /// Whether this router needs an external uplink attachment (any NAT — a
@@ -363,7 +398,9 @@ public enum NetworkReconciler {
     ///   with a gateway contributes a router port (its L3 gateway) — this is
     ///   what gives cross-switch east-west within a project.
     /// * A network with a gateway and `externalAccess` contributes a SNAT subnet
-    ///   on its router — outbound internet.
+    ///   on its router — outbound internet. An IPv6-only network egresses over
+    ///   IPv6 alone; nothing translates its traffic to IPv4.
+    /// * A BYOIP floating IP adds its prefix to the router's announced set.
     /// * A router-key group with no gatewayed network yields no router (nothing
     ///   to route). Output is fully sorted, so the plan is deterministic.
     public static func plan(networks: [DesiredNetworkState]) -> NetworkTopologyPlan {
@@ -371,7 +408,8 @@ public enum NetworkReconciler {
 
         let switches = sorted.map {
             DesiredSwitch(
-                name: OVNNaming.switchName(networkId: $0.networkId), subnet: $0.subnet, legacyName: $0.name)
+                name: OVNNaming.switchName(networkId: $0.networkId), subnet: $0.subnet ?? $0.subnet6 ?? "",
+                legacyName: $0.name)
         }
 
         // Group by router key, preserving deterministic order.
@@ -384,22 +422,29 @@ public enum NetworkReconciler {
             var ports: [DesiredRouterPort] = []
             var snatSubnets: [String] = []
             var dnatRules: [DesiredDNATRule] = []
+            var advertisedPrefixes = Set<String>()
 
             for network in members {
                 // L3 needs a gateway (the router-port IP) and a prefix from the
                 // subnet CIDR; a network missing either is switch-only. The MAC
-                // stays derived from the v4 gateway (v4 remains mandatory) —
+                // stays derived from the v4 gateway wherever there is one —
                 // rederiving it would rewrite every existing port's MAC on
                 // upgrade and invalidate guest neighbor caches.
-                guard let gateway = network.gateway,
-                    let prefix = prefixLength(ofCIDR: network.subnet),
-                    let mac = OVNNaming.routerPortMAC(gateway: gateway)
-                else { continue }
+                var cidrs: [String] = []
+                var mac: String?
+                if let subnet = network.subnet {
+                    guard let gateway = network.gateway,
+                        let prefix = prefixLength(ofCIDR: subnet),
+                        let mac4 = OVNNaming.routerPortMAC(gateway: gateway)
+                    else { continue }
+                    cidrs.append("\(gateway)/\(prefix)")
+                    mac = mac4
+                }
 
                 // Dual-stack: the same port carries the v6 gateway and sends
                 // RAs. Unparsable v6 config degrades the port to v4-only —
-                // never drops it (v4 service must survive a bad v6 edit).
-                var cidrs = ["\(gateway)/\(prefix)"]
+                // never drops it (v4 service must survive a bad v6 edit) —
+                // but on an IPv6-only network it leaves nothing to route.
                 var raConfigs: [String: String]?
                 var snatSubnet6: String?
                 if let subnet6 = network.subnet6, let gateway6 = network.gateway6,
@@ -409,7 +454,17 @@ public enum NetworkReconciler {
                     cidrs.append("\(gw6)/\(cidr6.prefix)")
                     raConfigs = ipv6RAConfigs
                     snatSubnet6 = cidr6.description
+                    if network.subnet == nil {
+                        mac = OVNNaming.routerPortMAC(networkId: network.networkId)
+                        // Guests without a DHCPv6 client still learn their
+                        // resolvers, from the RA itself (RFC 8106).
+                        let resolvers6 = (network.dnsServers ?? []).filter { IPv6Address($0) != nil }
+                        if !resolvers6.isEmpty {
+                            raConfigs?["rdnss"] = resolvers6.joined(separator: ",")
+                        }
+                    }
                 }
+                guard let mac else { continue }
 
                 ports.append(
                     DesiredRouterPort(
@@ -428,7 +483,7 @@ public enum NetworkReconciler {
                 // `[ovn_uplink]` at all. Canonical (RFC 5952, masked) form, so
                 // the key matches what OVN reports back and never churns.
                 if network.externalAccess {
-                    snatSubnets.append(network.subnet)
+                    if let subnet = network.subnet { snatSubnets.append(subnet) }
                     if let snatSubnet6 { snatSubnets.append(snatSubnet6) }
 
                     // Floating IPs (issue #344): each attachment becomes a
@@ -445,6 +500,9 @@ public enum NetworkReconciler {
                                 logicalPort: OVNNaming.vmPortName(
                                     vmId: fip.vmId.uuidString, nicIndex: fip.nicIndex),
                                 externalMAC: OVNNaming.floatingIPMAC(externalIP: fip.externalIP)))
+                        if let prefix = fip.advertisedPrefix.flatMap(IPv4CIDR.init) {
+                            advertisedPrefixes.insert("\(prefix.networkAddress)/\(prefix.prefix)")
+                        }
                     }
                 }
             }
@@ -458,7 +516,8 @@ public enum NetworkReconciler {
                     routerKey: routerKey,
                     ports: ports,
                     snatSubnets: snatSubnets,
-                    dnatRules: dnatRules.sorted { $0.externalIP < $1.externalIP }))
+                    dnatRules: dnatRules.sorted { $0.externalIP < $1.externalIP },
+                    advertisedPrefixes: advertisedPrefixes.sorted()))
         }
 
         return NetworkTopologyPlan(switches: switches, routers: routers)
@@ -482,10 +541,12 @@ public enum NetworkReconciler {
             protected.routerPortNames.insert(OVNNaming.externalRouterPortName(routerKey: network.routerKey))
             protected.switchRouterPortNames.insert(
                 OVNNaming.externalSwitchRouterPortName(routerKey: network.routerKey))
-            protected.snatRules.insert(SNATRuleKey(router: routerName, logicalIP: network.subnet))
-            // Protect the v6 SNAT rule on the same terms. Keyed off `subnet6`
-            // parsing alone — a superset of the condition that plans the rule —
-            // because over-protecting only defers a teardown, while
+            if let subnet = network.subnet {
+                protected.snatRules.insert(SNATRuleKey(router: routerName, logicalIP: subnet))
+            }
+            // Protect the v6 SNAT rule on the same terms. Keyed off
+            // `subnet6` parsing alone — a superset of the condition that plans
+            // the rule — because over-protecting only defers a teardown, while
             // under-protecting drops a stale network's live egress.
             if let subnet6 = network.subnet6, let cidr6 = IPv6CIDR(subnet6) {
                 protected.snatRules.insert(SNATRuleKey(router: routerName, logicalIP: cidr6.description))
@@ -598,7 +659,9 @@ public protocol NetworkActuator: Sendable {
     /// enabled *and* the uplink is realized, and strip them otherwise —
     /// including `uplinkReady == false`, so a withdrawn/broken uplink still
     /// clears previously applied options (there is no gateway to advertise
-    /// through anymore). No-op on platforms/configs without the feature.
+    /// through anymore). The router's BYOIP `discard` routes converge with
+    /// the options: present exactly while they are applied. No-op on
+    /// platforms/configs without the feature.
     func ensureDynamicRouting(for router: DesiredRouter, uplinkReady: Bool) async throws
     func removeSwitchRouterPort(name: String) async throws
     func removeRouterPort(name: String) async throws
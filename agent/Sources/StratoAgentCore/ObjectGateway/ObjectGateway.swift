@@ -0,0 +1,1065 @@
+import Crypto
+import Foundation
+import Logging
+import NIOFileSystem
+import StratoShared
+
+/// One S3 request as the gateway handles it: decoded, with its body (if any)
+/// already spooled to disk by the HTTP server. Keeping the transport out of
+/// the type lets tests drive the gateway without a socket.
+public struct ObjectGatewayRequest: Sendable {
+    /// A request body spooled to a file under the gateway's spool directory.
+    /// The gateway moves the file into place when it becomes an object or a
+    /// part; the server removes whatever is left after the response.
+    public struct Body: Sendable {
+        public let path: String
+        public let size: Int64
+        /// Lowercase hex SHA-256, checked against `x-amz-content-sha256`.
+        public let sha256: String
+        /// Raw MD5, the object's ETag and the `Content-MD5` check.
+        public let md5: Data
+
+        public init(path: String, size: Int64, sha256: String, md5: Data) {
+            self.path = path
+            self.size = size
+            self.sha256 = sha256
+            self.md5 = md5
+        }
+    }
+
+    public var method: String
+    /// The percent-decoded request path, e.g. `/bucket/photos/a b.jpg`.
+    public var path: String
+    public var query: [(name: String, value: String)]
+    public var headers: [(name: String, value: String)]
+    public var body: Body?
+
+    public init(
+        method: String, path: String, query: [(name: String, value: String)] = [],
+        headers: [(name: String, value: String)] = [], body: Body? = nil
+    ) {
+        self.method = method
+        self.path = path
+        self.query = query
+        self.headers = headers
+        self.body = body
+    }
+
+    func header(_ name: String) -> String? {
+        SigV4.header(name.lowercased(), in: headers)
+    }
+
+    func queryValue(_ name: String) -> String? {
+        SigV4.queryValue(name, in: query)
+    }
+
+    func hasQuery(_ name: String) -> Bool {
+        query.contains { $0.name == name }
+    }
+}
+
+public struct ObjectGatewayResponse: Sendable {
+    public enum Body: Sendable {
+        case empty
+        case data(Data)
+        /// A byte range of an object's data file, streamed by the server.
+        case file(path: String, range: Range<Int64>)
+    }
+
+    public var status: Int
+    public var headers: [(name: String, value: String)]
+    public var body: Body
+
+    public init(status: Int, headers: [(name: String, value: String)] = [], body: Body = .empty) {
+        self.status = status
+        self.headers = headers
+        self.body = body
+    }
+
+    func header(_ name: String) -> String? {
+        SigV4.header(name.lowercased(), in: headers)
+    }
+}
+
+/// The agent's S3-compatible object gateway: it stores the buckets the
+/// control plane places here and answers S3 requests for them, authenticated
+/// with SigV4 and authorized by the grants each sync compiles from Cedar
+/// policy. No request is forwarded to the control plane.
+///
+/// State lives in the gateway directory:
+///
+/// ```
+/// <root>/object-gateway.json                    bucket → name, generation, quota
+/// <root>/<bucketId>/objects/<sha256(key)>.json  object metadata (key, size, ETag, …)
+/// <root>/<bucketId>/objects/<dataFile>          object bytes, a fresh name per write
+/// <root>/<bucketId>/uploads/<uploadId>/         multipart upload and its parts
+/// <root>/.spool/                                request bodies in flight
+/// ```
+///
+/// Every write lands in a new data file and the metadata is swapped
+/// atomically, so a reader that opened the old data file keeps a consistent
+/// object. Secrets and grants are held in memory only: after a restart every
+/// request is denied until the first sync re-delivers them.
+public actor ObjectGateway {
+    /// What the gateway last applied for a bucket, persisted so a restarted
+    /// agent reports the right generation and knows which buckets it holds.
+    public struct Record: Codable, Equatable, Sendable {
+        public var name: String
+        public var generation: Int64
+        public var quotaBytes: Int64?
+        public var createdAt: Date
+    }
+
+    struct ObjectInfo: Codable, Sendable {
+        let key: String
+        let size: Int64
+        /// The ETag without quotes: hex MD5, or `<md5 of part MD5s>-<parts>`.
+        let etag: String
+        let contentType: String
+        let lastModified: Date
+        let metadata: [String: String]
+        let dataFile: String
+    }
+
+    struct Upload: Codable, Sendable {
+        let key: String
+        let contentType: String
+        let metadata: [String: String]
+        let initiated: Date
+    }
+
+    struct Part: Codable, Sendable {
+        let etag: String
+        let size: Int64
+    }
+
+    /// An S3 error response: HTTP status, S3 error code and message.
+    struct S3Error: Error, Equatable {
+        let status: Int
+        let code: String
+        let message: String
+
+        static func accessDenied(_ message: String = "Access Denied") -> S3Error {
+            S3Error(status: 403, code: "AccessDenied", message: message)
+        }
+        static let noSuchBucket = S3Error(
+            status: 404, code: "NoSuchBucket", message: "The specified bucket does not exist")
+        static let noSuchKey = S3Error(status: 404, code: "NoSuchKey", message: "The specified key does not exist.")
+        static let noSuchUpload = S3Error(
+            status: 404, code: "NoSuchUpload", message: "The specified multipart upload does not exist.")
+        static let methodNotAllowed = S3Error(
+            status: 405, code: "MethodNotAllowed", message: "The specified method is not allowed against this resource.")
+        static let malformedXML = S3Error(
+            status: 400, code: "MalformedXML", message: "The XML you provided was not well-formed.")
+        static func notImplemented(_ what: String) -> S3Error {
+            S3Error(status: 501, code: "NotImplemented", message: "\(what) is not supported by this gateway.")
+        }
+        static func invalidArgument(_ message: String) -> S3Error {
+            S3Error(status: 400, code: "InvalidArgument", message: message)
+        }
+    }
+
+    private struct Failure {
+        let generation: Int64
+        let error: String
+    }
+
+    /// The largest single PUT S3 accepts; bigger objects need multipart.
+    public static let maximumPutSize: Int64 = 5 << 30
+    /// The smallest a multipart part other than the last may be.
+    public static let minimumPartSize: Int64 = 5 << 20
+    public static let maximumPartNumber = 10_000
+    public static let maximumKeyLength = 1024
+    static let maximumListKeys = 1000
+
+    private let root: String
+    private let endpoint: String?
+    private let logger: Logger
+    private let now: @Sendable () -> Date
+
+    private var records: [UUID: Record]
+    private var bucketsByName: [String: UUID] = [:]
+    private var objects: [UUID: [String: ObjectInfo]] = [:]
+    private var grants: [UUID: [String: Set<ObjectPermission>]] = [:]
+    private var secrets: [String: String] = [:]
+    private var failures: [UUID: Failure] = [:]
+    /// Uploads whose completion is assembling the object right now.
+    private var completing: Set<String> = []
+
+    public init(
+        root: String,
+        endpoint: String?,
+        logger: Logger,
+        now: @escaping @Sendable () -> Date = { Date() }
+    ) {
+        self.root = root
+        self.endpoint = endpoint
+        self.logger = logger
+        self.now = now
+        let records = Self.loadTable(at: (root as NSString).appendingPathComponent("object-gateway.json"))
+        self.records = records
+        self.bucketsByName = Dictionary(records.map { ($0.value.name, $0.key) }, uniquingKeysWith: { first, _ in first })
+        for bucketId in records.keys {
+            self.objects[bucketId] = Self.loadIndex(
+                at: ((root as NSString).appendingPathComponent(bucketId.uuidString.lowercased()) as NSString)
+                    .appendingPathComponent("objects"))
+        }
+    }
+
+    // MARK: - Paths
+
+    private var tablePath: String {
+        (root as NSString).appendingPathComponent("object-gateway.json")
+    }
+
+    /// Where the server spools request bodies: inside the gateway directory,
+    /// so moving a finished body into a bucket is a rename.
+    public nonisolated var spoolDirectory: String {
+        (root as NSString).appendingPathComponent(".spool")
+    }
+
+    func directory(for bucketId: UUID) -> String {
+        (root as NSString).appendingPathComponent(bucketId.uuidString.lowercased())
+    }
+
+    private func objectsDirectory(_ bucketId: UUID) -> String {
+        (directory(for: bucketId) as NSString).appendingPathComponent("objects")
+    }
+
+    private func uploadDirectory(_ bucketId: UUID, _ uploadId: String) -> String {
+        ((directory(for: bucketId) as NSString).appendingPathComponent("uploads") as NSString)
+            .appendingPathComponent(uploadId)
+    }
+
+    private func metadataPath(_ bucketId: UUID, key: String) -> String {
+        let digest = SigV4.hex(SHA256.hash(data: Data(key.utf8)))
+        return (objectsDirectory(bucketId) as NSString).appendingPathComponent("\(digest).json")
+    }
+
+    private func dataPath(_ bucketId: UUID, _ info: ObjectInfo) -> String {
+        (objectsDirectory(bucketId) as NSString).appendingPathComponent(info.dataFile)
+    }
+
+    // MARK: - Convergence
+
+    /// The buckets this gateway holds, for tests and the reconciler.
+    public var hostedBucketIDs: Set<UUID> {
+        Set(records.keys)
+    }
+
+    /// Applies the full desired list: creates new buckets, deletes buckets
+    /// that are absent or missing from it, and replaces every grant and
+    /// credential wholesale.
+    public func submit(_ desired: DesiredObjectStorageState) {
+        secrets = Dictionary(
+            desired.credentials.map { ($0.accessKeyId, $0.secretAccessKey) }, uniquingKeysWith: { first, _ in first })
+        let wanted = Dictionary(
+            desired.buckets.filter { $0.desiredStatus == .present }.map { ($0.bucketId, $0) },
+            uniquingKeysWith: { first, _ in first })
+
+        for bucketId in records.keys where wanted[bucketId] == nil {
+            logger.info("Removing bucket", metadata: ["bucketId": .string(bucketId.uuidString)])
+            do {
+                if FileManager.default.fileExists(atPath: directory(for: bucketId)) {
+                    try FileManager.default.removeItem(atPath: directory(for: bucketId))
+                }
+                records.removeValue(forKey: bucketId)
+                objects.removeValue(forKey: bucketId)
+                failures.removeValue(forKey: bucketId)
+            } catch {
+                recordFailure(bucketId, generation: records[bucketId]?.generation ?? 0, error: error)
+            }
+        }
+        failures = failures.filter { wanted[$0.key] != nil || records[$0.key] != nil }
+        grants = grants.filter { wanted[$0.key] != nil }
+
+        for (bucketId, bucket) in wanted {
+            var permissions: [String: Set<ObjectPermission>] = [:]
+            for grant in bucket.grants {
+                permissions[grant.accessKeyId, default: []].formUnion(grant.permissions)
+            }
+            grants[bucketId] = permissions
+
+            if let record = records[bucketId], record.generation >= bucket.generation {
+                continue
+            }
+            do {
+                try FileManager.default.createDirectory(
+                    atPath: objectsDirectory(bucketId), withIntermediateDirectories: true)
+                try FileManager.default.createDirectory(
+                    atPath: (directory(for: bucketId) as NSString).appendingPathComponent("uploads"),
+                    withIntermediateDirectories: true)
+                records[bucketId] = Record(
+                    name: bucket.name,
+                    generation: bucket.generation,
+                    quotaBytes: bucket.quotaBytes,
+                    createdAt: records[bucketId]?.createdAt ?? now()
+                )
+                if objects[bucketId] == nil {
+                    objects[bucketId] = [:]
+                }
+                failures.removeValue(forKey: bucketId)
+            } catch {
+                recordFailure(bucketId, generation: bucket.generation, error: error)
+            }
+        }
+        bucketsByName = Dictionary(
+            records.map { ($0.value.name, $0.key) }, uniquingKeysWith: { first, _ in first })
+        persist()
+    }
+
+    private func recordFailure(_ bucketId: UUID, generation: Int64, error: any Error) {
+        let message = (error as? LocalizedError)?.errorDescription ?? "\(error)"
+        logger.error(
+            "Bucket convergence failed",
+            metadata: ["bucketId": .string(bucketId.uuidString), "error": .string(message)])
+        failures[bucketId] = Failure(generation: generation, error: message)
+    }
+
+    // MARK: - Observation
+
+    /// Every bucket this gateway holds, plus buckets whose first convergence
+    /// failed — full-list semantics, like the VM report.
+    public func observedStates() -> [ObservedBucketState] {
+        var ids = Set(records.keys)
+        ids.formUnion(failures.keys)
+        return ids.sorted { $0.uuidString < $1.uuidString }.map { bucketId in
+            let record = records[bucketId]
+            let failure = failures[bucketId]
+            let index = objects[bucketId] ?? [:]
+            return ObservedBucketState(
+                bucketId: bucketId,
+                status: failure != nil ? .error : (record != nil ? .available : .provisioning),
+                observedGeneration: record?.generation ?? 0,
+                usedBytes: index.values.reduce(0) { $0 + $1.size },
+                objectCount: Int64(index.count),
+                endpoint: endpoint,
+                lastError: failure?.error,
+                failedGeneration: failure?.generation
+            )
+        }
+    }
+
+    // MARK: - Requests
+
+    /// Answers one S3 request. Never throws: every failure becomes an S3
+    /// error document.
+    public func handle(_ request: ObjectGatewayRequest) async -> ObjectGatewayResponse {
+        let requestId = String(UUID().uuidString.replacingOccurrences(of: "-", with: "").prefix(16))
+        var response: ObjectGatewayResponse
+        do {
+            let accessKeyId = try authenticate(request)
+            response = try await dispatch(request, accessKeyId: accessKeyId)
+        } catch let error as S3Error {
+            response = Self.errorResponse(error, resource: request.path, requestId: requestId)
+        } catch {
+            logger.error(
+                "Object gateway request failed",
+                metadata: ["method": .string(request.method), "path": .string(request.path), "error": "\(error)"])
+            response = Self.errorResponse(
+                S3Error(status: 500, code: "InternalError", message: "We encountered an internal error. Please try again."),
+                resource: request.path, requestId: requestId)
+        }
+        response.headers.append(("x-amz-request-id", requestId))
+        return response
+    }
+
+    static func errorResponse(_ error: S3Error, resource: String, requestId: String) -> ObjectGatewayResponse {
+        ObjectGatewayResponse(
+            status: error.status,
+            headers: [("Content-Type", "application/xml")],
+            body: .data(ObjectGatewayXML.error(
+                code: error.code, message: error.message, resource: resource, requestId: requestId))
+        )
+    }
+
+    /// Verifies the request's signature and payload claims and returns the
+    /// access key it was signed with.
+    private func authenticate(_ request: ObjectGatewayRequest) throws -> String {
+        let input = SigV4.CanonicalInput(
+            method: request.method, path: request.path, query: request.query, headers: request.headers)
+        let claim: SigV4.Claim
+        do {
+            claim = try SigV4.claim(of: input)
+        } catch SigV4.AuthError.missing {
+            throw S3Error.accessDenied("Anonymous access is not allowed.")
+        } catch SigV4.AuthError.unsupportedAlgorithm(let algorithm) {
+            throw S3Error.invalidArgument("Unsupported authorization algorithm \(algorithm); use AWS4-HMAC-SHA256.")
+        } catch {
+            throw S3Error(status: 400, code: "AuthorizationHeaderMalformed", message: "\(error)")
+        }
+
+        let accessKeyId = claim.credential.accessKeyId
+        guard let secret = secrets[accessKeyId] else {
+            throw S3Error(
+                status: 403, code: "InvalidAccessKeyId",
+                message: "The AWS Access Key Id you provided does not exist in our records.")
+        }
+        do {
+            try SigV4.verify(claim, request: input, secretAccessKey: secret, now: now())
+        } catch SigV4.AuthError.timeSkewed {
+            throw S3Error(
+                status: 403, code: "RequestTimeTooSkewed",
+                message: "The difference between the request time and the current time is too large.")
+        } catch SigV4.AuthError.expired {
+            throw S3Error.accessDenied("Request has expired")
+        } catch SigV4.AuthError.signatureMismatch {
+            throw S3Error(
+                status: 403, code: "SignatureDoesNotMatch",
+                message: "The request signature we calculated does not match the signature you provided.")
+        } catch {
+            throw S3Error(status: 400, code: "AuthorizationHeaderMalformed", message: "\(error)")
+        }
+
+        // The signature covers the payload hash the client claimed; check the
+        // claim against the bytes that actually arrived.
+        if claim.payloadHash.hasPrefix("STREAMING-") {
+            throw S3Error.notImplemented("aws-chunked payload signing")
+        }
+        if claim.payloadHash != SigV4.unsignedPayload {
+            let actual = request.body?.sha256 ?? SigV4.emptyPayloadHash
+            guard actual == claim.payloadHash.lowercased() else {
+                throw S3Error(
+                    status: 400, code: "XAmzContentSHA256Mismatch",
+                    message: "The provided 'x-amz-content-sha256' header does not match what was computed.")
+            }
+        }
+        if let contentMD5 = request.header("content-md5") {
+            let actual = request.body?.md5 ?? Data(Insecure.MD5.hash(data: Data()))
+            guard Data(base64Encoded: contentMD5) == actual else {
+                throw S3Error(
+                    status: 400, code: "BadDigest",
+                    message: "The Content-MD5 you specified did not match what we received.")
+            }
+        }
+        return accessKeyId
+    }
+
+    private func dispatch(_ request: ObjectGatewayRequest, accessKeyId: String) async throws -> ObjectGatewayResponse {
+        let (bucketName, key) = Self.split(request.path)
+        guard let bucketName else {
+            guard request.method == "GET" else { throw S3Error.methodNotAllowed }
+            return listBuckets(accessKeyId: accessKeyId)
+        }
+        guard let bucketId = bucketsByName[bucketName], records[bucketId] != nil else {
+            if request.method == "PUT", key == nil {
+                throw S3Error.accessDenied("Buckets are created through the Strato API.")
+            }
+            throw S3Error.noSuchBucket
+        }
+        let permissions = grants[bucketId]?[accessKeyId] ?? []
+        guard !permissions.isEmpty else { throw S3Error.accessDenied() }
+        func require(_ permission: ObjectPermission) throws {
+            guard permissions.contains(permission) else { throw S3Error.accessDenied() }
+        }
+
+        guard let key else {
+            switch request.method {
+            case "HEAD":
+                return ObjectGatewayResponse(status: 200)
+            case "GET" where request.hasQuery("location"):
+                return ObjectGatewayResponse(
+                    status: 200, headers: [("Content-Type", "application/xml")],
+                    body: .data(Data((ObjectGatewayXML.declaration + "\n<LocationConstraint xmlns=\"\(ObjectGatewayXML.namespace)\"/>").utf8)))
+            case "GET" where request.hasQuery("uploads"):
+                throw S3Error.notImplemented("ListMultipartUploads")
+            case "GET":
+                try require(.list)
+                return try listObjects(bucketId, name: bucketName, request: request)
+            case "POST" where request.hasQuery("delete"):
+                try require(.delete)
+                return try deleteObjects(bucketId, request: request)
+            case "PUT":
+                throw S3Error(
+                    status: 409, code: "BucketAlreadyOwnedByYou",
+                    message: "Your previous request to create the named bucket succeeded and you already own it.")
+            case "DELETE":
+                throw S3Error.accessDenied("Buckets are deleted through the Strato API.")
+            default:
+                throw S3Error.methodNotAllowed
+            }
+        }
+
+        guard key.utf8.count <= Self.maximumKeyLength else {
+            throw S3Error(status: 400, code: "KeyTooLongError", message: "Your key is too long")
+        }
+        switch request.method {
+        case "PUT" where request.hasQuery("uploadId"):
+            try require(.write)
+            return try uploadPart(bucketId, key: key, request: request)
+        case "PUT" where request.header("x-amz-copy-source") != nil:
+            throw S3Error.notImplemented("CopyObject")
+        case "PUT":
+            try require(.write)
+            return try putObject(bucketId, key: key, request: request)
+        case "GET" where request.hasQuery("uploadId"):
+            throw S3Error.notImplemented("ListParts")
+        case "GET", "HEAD":
+            try require(.read)
+            return try getObject(bucketId, key: key, request: request)
+        case "DELETE" where request.hasQuery("uploadId"):
+            try require(.write)
+            return try abortUpload(bucketId, key: key, request: request)
+        case "DELETE":
+            try require(.delete)
+            try deleteObject(bucketId, key: key)
+            return ObjectGatewayResponse(status: 204)
+        case "POST" where request.hasQuery("uploads"):
+            try require(.write)
+            return try createUpload(bucketId, name: bucketName, key: key, request: request)
+        case "POST" where request.hasQuery("uploadId"):
+            try require(.write)
+            return try await completeUpload(bucketId, name: bucketName, key: key, request: request)
+        default:
+            throw S3Error.methodNotAllowed
+        }
+    }
+
+    /// `/bucket/key/with/slashes` → (`bucket`, `key/with/slashes`). Path-style
+    /// addressing only: bucket names with dots make virtual-hosted style need
+    /// wildcard certificates per name, and every S3 SDK can be told to use
+    /// path style.
+    static func split(_ path: String) -> (bucket: String?, key: String?) {
+        var trimmed = path[...]
+        while trimmed.first == "/" { trimmed = trimmed.dropFirst() }
+        guard !trimmed.isEmpty else { return (nil, nil) }
+        guard let slash = trimmed.firstIndex(of: "/") else { return (String(trimmed), nil) }
+        let key = trimmed[trimmed.index(after: slash)...]
+        return (String(trimmed[..<slash]), key.isEmpty ? nil : String(key))
+    }
+
+    // MARK: - Buckets
+
+    private func listBuckets(accessKeyId: String) -> ObjectGatewayResponse {
+        let visible = records
+            .filter { !(grants[$0.key]?[accessKeyId] ?? []).isEmpty }
+            .map(\.value)
+            .sorted { $0.name < $1.name }
+        let buckets = visible.map { record in
+            "<Bucket>" + ObjectGatewayXML.element("Name", record.name)
+                + ObjectGatewayXML.element("CreationDate", ObjectGatewayXML.timestamp(record.createdAt)) + "</Bucket>"
+        }
+        return Self.xml(
+            "ListAllMyBucketsResult",
+            [
+                "<Owner>" + ObjectGatewayXML.element("ID", accessKeyId) + ObjectGatewayXML.element("DisplayName", accessKeyId)
+                    + "</Owner>",
+                "<Buckets>" + buckets.joined() + "</Buckets>",
+            ])
+    }
+
+    /// ListObjectsV2 (`list-type=2`) and the original ListObjects, which
+    /// differ only in how a page names where the next one starts.
+    private func listObjects(_ bucketId: UUID, name: String, request: ObjectGatewayRequest) throws -> ObjectGatewayResponse {
+        let isV2 = request.queryValue("list-type") == "2"
+        let prefix = request.queryValue("prefix") ?? ""
+        let delimiter = request.queryValue("delimiter").flatMap { $0.isEmpty ? nil : $0 }
+        let urlEncoded = request.queryValue("encoding-type") == "url"
+        var maxKeys = Self.maximumListKeys
+        if let value = request.queryValue("max-keys") {
+            guard let parsed = Int(value), parsed >= 0 else {
+                throw S3Error.invalidArgument("max-keys must be a non-negative integer")
+            }
+            maxKeys = min(parsed, Self.maximumListKeys)
+        }
+
+        let marker: String?
+        if isV2 {
+            if let token = request.queryValue("continuation-token") {
+                guard let data = Data(base64Encoded: token), let decoded = String(data: data, encoding: .utf8) else {
+                    throw S3Error.invalidArgument("The continuation token provided is incorrect")
+                }
+                marker = decoded
+            } else {
+                marker = request.queryValue("start-after")
+            }
+        } else {
+            marker = request.queryValue("marker")
+        }
+        // A page that ended on a rolled-up common prefix resumes past every
+        // key under it, not at its first key.
+        let skippedPrefix: String? = marker.flatMap { marker in
+            guard let delimiter, marker.hasPrefix(prefix), marker.hasSuffix(delimiter),
+                marker.dropFirst(prefix.count).contains(delimiter)
+            else { return nil }
+            return marker
+        }
+
+        let index = objects[bucketId] ?? [:]
+        let candidates = index.keys
+            .filter { key in
+                guard key.hasPrefix(prefix) else { return false }
+                if let skippedPrefix, key.hasPrefix(skippedPrefix) { return false }
+                if let marker { return Self.utf8Less(marker, key) }
+                return true
+            }
+            .sorted(by: Self.utf8Less)
+
+        var contents: [ObjectInfo] = []
+        var commonPrefixes: [String] = []
+        var last: String?
+        var truncated = false
+        for key in candidates {
+            var entry = key
+            var isPrefix = false
+            if let delimiter, let range = key.dropFirst(prefix.count).range(of: delimiter) {
+                entry = String(key[..<range.upperBound])
+                isPrefix = true
+                if commonPrefixes.last == entry { continue }
+            }
+            if contents.count + commonPrefixes.count == maxKeys {
+                truncated = true
+                break
+            }
+            if isPrefix {
+                commonPrefixes.append(entry)
+            } else if let info = index[key] {
+                contents.append(info)
+            }
+            last = entry
+        }
+
+        func encode(_ value: String) -> String {
+            urlEncoded ? SigV4.uriEncode(value, encodeSlash: false) : value
+        }
+        var children = [
+            ObjectGatewayXML.element("Name", name),
+            ObjectGatewayXML.element("Prefix", encode(prefix)),
+            ObjectGatewayXML.element("MaxKeys", String(maxKeys)),
+            ObjectGatewayXML.element("IsTruncated", truncated ? "true" : "false"),
+        ]
+        if let delimiter {
+            children.append(ObjectGatewayXML.element("Delimiter", encode(delimiter)))
+        }
+        if urlEncoded {
+            children.append(ObjectGatewayXML.element("EncodingType", "url"))
+        }
+        if isV2 {
+            children.append(ObjectGatewayXML.element("KeyCount", String(contents.count + commonPrefixes.count)))
+            if let token = request.queryValue("continuation-token") {
+                children.append(ObjectGatewayXML.element("ContinuationToken", token))
+            }
+            if let startAfter = request.queryValue("start-after") {
+                children.append(ObjectGatewayXML.element("StartAfter", encode(startAfter)))
+            }
+            if truncated, let last {
+                children.append(
+                    ObjectGatewayXML.element("NextContinuationToken", Data(last.utf8).base64EncodedString()))
+            }
+        } else {
+            children.append(ObjectGatewayXML.element("Marker", encode(marker ?? "")))
+            if truncated, let last {
+                children.append(ObjectGatewayXML.element("NextMarker", encode(last)))
+            }
+        }
+        for info in contents {
+            children.append(
+                "<Contents>" + ObjectGatewayXML.element("Key", encode(info.key))
+                    + ObjectGatewayXML.element("LastModified", ObjectGatewayXML.timestamp(info.lastModified))
+                    + ObjectGatewayXML.element("ETag", "\"\(info.etag)\"")
+                    + ObjectGatewayXML.element("Size", String(info.size))
+                    + ObjectGatewayXML.element("StorageClass", "STANDARD") + "</Contents>")
+        }
+        for commonPrefix in commonPrefixes {
+            children.append(
+                "<CommonPrefixes>" + ObjectGatewayXML.element("Prefix", encode(commonPrefix)) + "</CommonPrefixes>")
+        }
+        return Self.xml("ListBucketResult", children)
+    }
+
+    /// S3 orders keys by their UTF-8 bytes.
+    static func utf8Less(_ lhs: String, _ rhs: String) -> Bool {
+        lhs.utf8.lexicographicallyPrecedes(rhs.utf8)
+    }
+
+    // MARK: - Objects
+
+    private func putObject(_ bucketId: UUID, key: String, request: ObjectGatewayRequest) throws -> ObjectGatewayResponse {
+        guard let body = request.body else {
+            throw S3Error(status: 411, code: "MissingContentLength", message: "You must provide the Content-Length HTTP header.")
+        }
+        guard body.size <= Self.maximumPutSize else {
+            throw S3Error(
+                status: 400, code: "EntityTooLarge",
+                message: "Your proposed upload exceeds the maximum allowed size; use a multipart upload.")
+        }
+        try checkQuota(bucketId, adding: body.size, replacing: key)
+        let info = ObjectInfo(
+            key: key,
+            size: body.size,
+            etag: SigV4.hex(body.md5),
+            contentType: request.header("content-type") ?? "binary/octet-stream",
+            lastModified: now(),
+            metadata: Self.userMetadata(request),
+            dataFile: UUID().uuidString.lowercased()
+        )
+        try commit(info, from: body.path, in: bucketId)
+        return ObjectGatewayResponse(status: 200, headers: [("ETag", "\"\(info.etag)\"")])
+    }
+
+    private func getObject(_ bucketId: UUID, key: String, request: ObjectGatewayRequest) throws -> ObjectGatewayResponse {
+        guard let info = objects[bucketId]?[key] else { throw S3Error.noSuchKey }
+        var headers: [(name: String, value: String)] = [
+            ("ETag", "\"\(info.etag)\""),
+            ("Last-Modified", ObjectGatewayXML.httpDate(info.lastModified)),
+            ("Content-Type", info.contentType),
+            ("Accept-Ranges", "bytes"),
+        ]
+        headers += info.metadata.sorted { $0.key < $1.key }.map { ("x-amz-meta-\($0.key)", $0.value) }
+
+        if let ifMatch = request.header("if-match"), !Self.etagList(ifMatch, contains: info.etag) {
+            throw S3Error(
+                status: 412, code: "PreconditionFailed",
+                message: "At least one of the pre-conditions you specified did not hold")
+        }
+        if let ifNoneMatch = request.header("if-none-match"), Self.etagList(ifNoneMatch, contains: info.etag) {
+            return ObjectGatewayResponse(status: 304, headers: headers)
+        }
+
+        var status = 200
+        var range: Range<Int64> = 0..<info.size
+        if let rangeHeader = request.header("range") {
+            guard let requested = Self.byteRange(rangeHeader, size: info.size) else {
+                throw S3Error(status: 416, code: "InvalidRange", message: "The requested range is not satisfiable")
+            }
+            range = requested
+            status = 206
+            headers.append(("Content-Range", "bytes \(range.lowerBound)-\(range.upperBound - 1)/\(info.size)"))
+        }
+        headers.append(("Content-Length", String(range.count)))
+        let body: ObjectGatewayResponse.Body =
+            request.method == "HEAD" ? .empty : .file(path: dataPath(bucketId, info), range: range)
+        return ObjectGatewayResponse(status: status, headers: headers, body: body)
+    }
+
+    private func deleteObject(_ bucketId: UUID, key: String) throws {
+        guard let info = objects[bucketId]?[key] else { return }
+        try FileManager.default.removeItem(atPath: metadataPath(bucketId, key: key))
+        objects[bucketId]?.removeValue(forKey: key)
+        try? FileManager.default.removeItem(atPath: dataPath(bucketId, info))
+    }
+
+    private func deleteObjects(_ bucketId: UUID, request: ObjectGatewayRequest) throws -> ObjectGatewayResponse {
+        guard let parsed = try Self.readSmallBody(request.body).flatMap(ObjectGatewayXML.deleteRequest(in:)),
+            parsed.keys.count <= Self.maximumListKeys
+        else {
+            throw S3Error.malformedXML
+        }
+        var results: [String] = []
+        for key in parsed.keys {
+            do {
+                try deleteObject(bucketId, key: key)
+                if !parsed.quiet {
+                    results.append("<Deleted>" + ObjectGatewayXML.element("Key", key) + "</Deleted>")
+                }
+            } catch {
+                results.append(
+                    "<Error>" + ObjectGatewayXML.element("Key", key) + ObjectGatewayXML.element("Code", "InternalError")
+                        + ObjectGatewayXML.element("Message", "\(error)") + "</Error>")
+            }
+        }
+        return Self.xml("DeleteResult", results)
+    }
+
+    /// Moves a finished body into place as `info` and swaps the metadata, so
+    /// readers see either the old object or the new one, never a mix.
+    private func commit(_ info: ObjectInfo, from source: String, in bucketId: UUID) throws {
+        let destination = dataPath(bucketId, info)
+        try FileManager.default.moveItem(atPath: source, toPath: destination)
+        do {
+            let data = try JSONEncoder().encode(info)
+            try data.write(to: URL(fileURLWithPath: metadataPath(bucketId, key: info.key)), options: .atomic)
+        } catch {
+            try? FileManager.default.removeItem(atPath: destination)
+            throw error
+        }
+        let previous = objects[bucketId]?[info.key]
+        objects[bucketId, default: [:]][info.key] = info
+        if let previous {
+            try? FileManager.default.removeItem(atPath: dataPath(bucketId, previous))
+        }
+    }
+
+    private func checkQuota(_ bucketId: UUID, adding size: Int64, replacing key: String) throws {
+        guard let quota = records[bucketId]?.quotaBytes else { return }
+        let index = objects[bucketId] ?? [:]
+        let used = index.values.reduce(0) { $0 + $1.size } - (index[key]?.size ?? 0)
+        guard used + size <= quota else {
+            throw S3Error(
+                status: 403, code: "QuotaExceeded",
+                message: "The bucket's quota of \(quota) bytes does not leave room for this object.")
+        }
+    }
+
+    // MARK: - Multipart uploads
+
+    private func createUpload(
+        _ bucketId: UUID, name: String, key: String, request: ObjectGatewayRequest
+    ) throws -> ObjectGatewayResponse {
+        let uploadId = UUID().uuidString.replacingOccurrences(of: "-", with: "").lowercased()
+        let upload = Upload(
+            key: key,
+            contentType: request.header("content-type") ?? "binary/octet-stream",
+            metadata: Self.userMetadata(request),
+            initiated: now()
+        )
+        let directory = uploadDirectory(bucketId, uploadId)
+        try FileManager.default.createDirectory(atPath: directory, withIntermediateDirectories: true)
+        try JSONEncoder().encode(upload).write(
+            to: URL(fileURLWithPath: (directory as NSString).appendingPathComponent("upload.json")), options: .atomic)
+        return Self.xml(
+            "InitiateMultipartUploadResult",
+            [
+                ObjectGatewayXML.element("Bucket", name),
+                ObjectGatewayXML.element("Key", key),
+                ObjectGatewayXML.element("UploadId", uploadId),
+            ])
+    }
+
+    private func loadUpload(_ bucketId: UUID, key: String, request: ObjectGatewayRequest) throws -> (id: String, upload: Upload) {
+        guard let uploadId = request.queryValue("uploadId"), !uploadId.contains("/"), !uploadId.hasPrefix("."),
+            let data = FileManager.default.contents(
+                atPath: (uploadDirectory(bucketId, uploadId) as NSString).appendingPathComponent("upload.json")),
+            let upload = try? JSONDecoder().decode(Upload.self, from: data),
+            upload.key == key
+        else {
+            throw S3Error.noSuchUpload
+        }
+        if completing.contains(uploadId) {
+            throw S3Error(
+                status: 409, code: "OperationAborted",
+                message: "The multipart upload is being completed by another request.")
+        }
+        return (uploadId, upload)
+    }
+
+    private func uploadPart(_ bucketId: UUID, key: String, request: ObjectGatewayRequest) throws -> ObjectGatewayResponse {
+        let (uploadId, _) = try loadUpload(bucketId, key: key, request: request)
+        guard let number = request.queryValue("partNumber").flatMap({ Int($0) }),
+            (1...Self.maximumPartNumber).contains(number)
+        else {
+            throw S3Error.invalidArgument("Part number must be an integer between 1 and \(Self.maximumPartNumber)")
+        }
+        guard let body = request.body else {
+            throw S3Error(status: 411, code: "MissingContentLength", message: "You must provide the Content-Length HTTP header.")
+        }
+        guard body.size <= Self.maximumPutSize else {
+            throw S3Error(status: 400, code: "EntityTooLarge", message: "Your proposed upload exceeds the maximum part size.")
+        }
+        // A part alone over quota can never complete; refuse it early.
+        try checkQuota(bucketId, adding: body.size, replacing: key)
+
+        let directory = uploadDirectory(bucketId, uploadId)
+        let partPath = (directory as NSString).appendingPathComponent("part-\(number)")
+        let part = Part(etag: SigV4.hex(body.md5), size: body.size)
+        if FileManager.default.fileExists(atPath: partPath) {
+            try FileManager.default.removeItem(atPath: partPath)
+        }
+        try FileManager.default.moveItem(atPath: body.path, toPath: partPath)
+        try JSONEncoder().encode(part).write(to: URL(fileURLWithPath: partPath + ".json"), options: .atomic)
+        return ObjectGatewayResponse(status: 200, headers: [("ETag", "\"\(part.etag)\"")])
+    }
+
+    private func abortUpload(_ bucketId: UUID, key: String, request: ObjectGatewayRequest) throws -> ObjectGatewayResponse {
+        let (uploadId, _) = try loadUpload(bucketId, key: key, request: request)
+        try FileManager.default.removeItem(atPath: uploadDirectory(bucketId, uploadId))
+        return ObjectGatewayResponse(status: 204)
+    }
+
+    /// Validates the client's part list, concatenates the parts into one data
+    /// file and commits it. The concatenation runs off the actor's critical
+    /// path: other requests proceed while a multi-gigabyte object assembles.
+    private func completeUpload(
+        _ bucketId: UUID, name: String, key: String, request: ObjectGatewayRequest
+    ) async throws -> ObjectGatewayResponse {
+        let (uploadId, upload) = try loadUpload(bucketId, key: key, request: request)
+        guard let listed = try Self.readSmallBody(request.body).flatMap(ObjectGatewayXML.completedParts(in:)),
+            !listed.isEmpty
+        else {
+            throw S3Error.malformedXML
+        }
+
+        let directory = uploadDirectory(bucketId, uploadId)
+        var partPaths: [String] = []
+        var digests = Data()
+        var total: Int64 = 0
+        for (position, listedPart) in listed.enumerated() {
+            if position > 0, listedPart.number <= listed[position - 1].number {
+                throw S3Error(
+                    status: 400, code: "InvalidPartOrder", message: "The list of parts was not in ascending order.")
+            }
+            let partPath = (directory as NSString).appendingPathComponent("part-\(listedPart.number)")
+            guard let data = FileManager.default.contents(atPath: partPath + ".json"),
+                let part = try? JSONDecoder().decode(Part.self, from: data),
+                part.etag == listedPart.etag.lowercased()
+            else {
+                throw S3Error(
+                    status: 400, code: "InvalidPart",
+                    message: "One or more of the specified parts could not be found or its ETag did not match.")
+            }
+            if position < listed.count - 1, part.size < Self.minimumPartSize {
+                throw S3Error(
+                    status: 400, code: "EntityTooSmall",
+                    message: "Your proposed upload is smaller than the minimum allowed object size.")
+            }
+            partPaths.append(partPath)
+            digests.append(Self.bytes(fromHex: part.etag))
+            total += part.size
+        }
+        try checkQuota(bucketId, adding: total, replacing: key)
+
+        completing.insert(uploadId)
+        defer { completing.remove(uploadId) }
+        let assembled = (directory as NSString).appendingPathComponent("assembled")
+        try await Self.concatenate(partPaths, into: assembled)
+
+        // The bucket may have been deleted while the parts were copied.
+        guard records[bucketId] != nil else { throw S3Error.noSuchBucket }
+        try checkQuota(bucketId, adding: total, replacing: key)
+        let info = ObjectInfo(
+            key: key,
+            size: total,
+            etag: "\(SigV4.hex(Insecure.MD5.hash(data: digests)))-\(listed.count)",
+            contentType: upload.contentType,
+            lastModified: now(),
+            metadata: upload.metadata,
+            dataFile: UUID().uuidString.lowercased()
+        )
+        try commit(info, from: assembled, in: bucketId)
+        try? FileManager.default.removeItem(atPath: directory)
+
+        var location = "/\(name)/\(SigV4.uriEncode(key, encodeSlash: false))"
+        if let endpoint {
+            location = endpoint.trimmingCharacters(in: CharacterSet(charactersIn: "/")) + location
+        }
+        return Self.xml(
+            "CompleteMultipartUploadResult",
+            [
+                ObjectGatewayXML.element("Location", location),
+                ObjectGatewayXML.element("Bucket", name),
+                ObjectGatewayXML.element("Key", key),
+                ObjectGatewayXML.element("ETag", "\"\(info.etag)\""),
+            ])
+    }
+
+    static func concatenate(_ sources: [String], into destination: String) async throws {
+        try await FileSystem.shared.withFileHandle(
+            forWritingAt: FilePath(destination),
+            options: .newFile(replaceExisting: true)
+        ) { output in
+            try await output.withBufferedWriter { writer in
+                for source in sources {
+                    try await FileSystem.shared.withFileHandle(forReadingAt: FilePath(source)) { input in
+                        for try await chunk in input.readChunks() {
+                            _ = try await writer.write(contentsOf: chunk)
+                        }
+                    }
+                }
+            }
+        }
+    }
+
+    // MARK: - Helpers
+
+    private static func xml(_ root: String, _ children: [String]) -> ObjectGatewayResponse {
+        ObjectGatewayResponse(
+            status: 200, headers: [("Content-Type", "application/xml")],
+            body: .data(ObjectGatewayXML.document(root, children)))
+    }
+
+    /// `x-amz-meta-*` headers, keyed by the lowercased suffix.
+    static func userMetadata(_ request: ObjectGatewayRequest) -> [String: String] {
+        var metadata: [String: String] = [:]
+        for (name, value) in request.headers {
+            let lowered = name.lowercased()
+            if lowered.hasPrefix("x-amz-meta-") {
+                metadata[String(lowered.dropFirst("x-amz-meta-".count))] = value
+            }
+        }
+        return metadata
+    }
+
+    /// The range a `Range: bytes=…` header selects, or nil when it is not
+    /// satisfiable. Only a single range is supported, as in S3.
+    static func byteRange(_ header: String, size: Int64) -> Range<Int64>? {
+        guard header.hasPrefix("bytes="), !header.contains(",") else { return nil }
+        let spec = header.dropFirst("bytes=".count)
+        guard let dash = spec.firstIndex(of: "-") else { return nil }
+        let start = spec[..<dash].trimmingCharacters(in: .whitespaces)
+        let end = spec[spec.index(after: dash)...].trimmingCharacters(in: .whitespaces)
+        if start.isEmpty {
+            guard let suffix = Int64(end), suffix > 0, size > 0 else { return nil }
+            return max(size - suffix, 0)..<size
+        }
+        guard let first = Int64(start), first < size else { return nil }
+        if end.isEmpty {
+            return first..<size
+        }
+        guard let last = Int64(end), last >= first else { return nil }
+        return first..<min(last + 1, size)
+    }
+
+    private static func etagList(_ header: String, contains etag: String) -> Bool {
+        header.split(separator: ",").contains { candidate in
+            let trimmed = candidate.trimmingCharacters(in: CharacterSet(charactersIn: "\" "))
+            return trimmed == "*" || trimmed == etag
+        }
+    }
+
+    /// Reads an XML request body, refusing anything over 2 MiB — the largest
+    /// CompleteMultipartUpload (10,000 parts) fits well within that.
+    private static func readSmallBody(_ body: ObjectGatewayRequest.Body?) throws -> String? {
+        guard let body, body.size <= 2 << 20,
+            let data = FileManager.default.contents(atPath: body.path)
+        else {
+            return nil
+        }
+        return String(data: data, encoding: .utf8)
+    }
+
+    static func bytes(fromHex hex: String) -> Data {
+        var data = Data()
+        var iterator = hex.makeIterator()
+        while let high = iterator.next(), let low = iterator.next() {
+            if let byte = UInt8(String([high, low]), radix: 16) {
+                data.append(byte)
+            }
+        }
+        return data
+    }
+
+    private func persist() {
+        do {
+            try FileManager.default.createDirectory(atPath: root, withIntermediateDirectories: true)
+            let table = Dictionary(uniqueKeysWithValues: records.map { ($0.key.uuidString, $0.value) })
+            let data = try JSONEncoder().encode(table)
+            try data.write(to: URL(fileURLWithPath: tablePath), options: .atomic)
+        } catch {
+            logger.error("Failed to write bucket table at \(tablePath): \(error)")
+        }
+    }
+
+    private static func loadTable(at path: String) -> [UUID: Record] {
+        guard let data = FileManager.default.contents(atPath: path),
+            let table = try? JSONDecoder().decode([String: Record].self, from: data)
+        else {
+            return [:]
+        }
+        return Dictionary(
+            uniqueKeysWithValues: table.compactMap { key, value in UUID(uuidString: key).map { ($0, value) } })
+    }
+
+    private static func loadIndex(at directory: String) -> [String: ObjectInfo] {
+        let entries = (try? FileManager.default.contentsOfDirectory(atPath: directory)) ?? []
+        var index: [String: ObjectInfo] = [:]
+        for entry in entries where entry.hasSuffix(".json") {
+            guard let data = FileManager.default.contents(atPath: (directory as NSString).appendingPathComponent(entry)),
+                let info = try? JSONDecoder().decode(ObjectInfo.self, from: data)
+            else {
+                continue
+            }
+            index[info.key] = info
+        }
+        return index
+    }
+}
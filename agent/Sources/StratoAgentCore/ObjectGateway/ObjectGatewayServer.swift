@@ -0,0 +1,226 @@
+import Crypto
+import Foundation
+import Logging
+import NIOCore
+import NIOFileSystem
+import NIOHTTP1
+import NIOPosix
+
+/// The HTTP/1.1 listener in front of `ObjectGateway`. It decodes each
+/// request, spools any body to disk while hashing it (SHA-256 for the SigV4
+/// payload check, MD5 for the ETag), hands the request to the gateway, and
+/// streams the response back — object data straight from its file.
+///
+/// Plain HTTP: TLS belongs to whatever the operator puts in front of the
+/// gateway (the advertised `object_gateway_endpoint` is that front door).
+public struct ObjectGatewayServer: Sendable {
+    private let host: String
+    private let port: Int
+    private let gateway: ObjectGateway
+    private let logger: Logger
+
+    public init(host: String, port: Int, gateway: ObjectGateway, logger: Logger) {
+        self.host = host
+        self.port = port
+        self.gateway = gateway
+        self.logger = logger
+    }
+
+    /// Parses `host:port` (IPv6 hosts bracketed, e.g. `[::]:9000`).
+    public static func parseListenAddress(_ address: String) -> (host: String, port: Int)? {
+        guard let colon = address.lastIndex(of: ":"), let port = Int(address[address.index(after: colon)...]),
+            (1...65535).contains(port)
+        else {
+            return nil
+        }
+        var host = String(address[..<colon])
+        if host.hasPrefix("["), host.hasSuffix("]") {
+            host = String(host.dropFirst().dropLast())
+        }
+        return host.isEmpty ? nil : (host, port)
+    }
+
+    /// Binds and serves until the surrounding task is cancelled.
+    public func run() async throws {
+        try FileManager.default.createDirectory(atPath: gateway.spoolDirectory, withIntermediateDirectories: true)
+        // Bodies left by a crash mid-upload are never resumed.
+        for entry in (try? FileManager.default.contentsOfDirectory(atPath: gateway.spoolDirectory)) ?? [] {
+            try? FileManager.default.removeItem(
+                atPath: (gateway.spoolDirectory as NSString).appendingPathComponent(entry))
+        }
+
+        let server = try await ServerBootstrap(group: MultiThreadedEventLoopGroup.singleton)
+            .serverChannelOption(.backlog, value: 256)
+            .serverChannelOption(.socketOption(.so_reuseaddr), value: 1)
+            .bind(host: host, port: port) { channel in
+                channel.eventLoop.makeCompletedFuture {
+                    try channel.pipeline.syncOperations.configureHTTPServerPipeline()
+                    return try NIOAsyncChannel<HTTPServerRequestPart, HTTPServerResponsePart>(
+                        wrappingChannelSynchronously: channel)
+                }
+            }
+        logger.info("Object gateway listening", metadata: ["address": .string("\(host):\(port)")])
+
+        try await withThrowingDiscardingTaskGroup { group in
+            try await server.executeThenClose { connections in
+                for try await connection in connections {
+                    group.addTask {
+                        do {
+                            try await serve(connection)
+                        } catch {
+                            logger.debug("Object gateway connection ended: \(error)")
+                        }
+                    }
+                }
+            }
+        }
+    }
+
+    private func serve(_ connection: NIOAsyncChannel<HTTPServerRequestPart, HTTPServerResponsePart>) async throws {
+        try await connection.executeThenClose { inbound, outbound in
+            var parts = inbound.makeAsyncIterator()
+            while let part = try await parts.next() {
+                guard case .head(let head) = part else { continue }
+
+                var body: ObjectGatewayRequest.Body?
+                if Self.hasBody(head) {
+                    if head.headers[canonicalForm: "expect"].contains(where: { $0.lowercased() == "100-continue" }) {
+                        try await outbound.write(.head(HTTPResponseHead(version: head.version, status: .continue)))
+                    }
+                    body = try await spool(&parts)
+                } else {
+                    // Drain to the end of the request.
+                    while let next = try await parts.next() {
+                        if case .end = next { break }
+                    }
+                }
+                defer {
+                    if let body { try? FileManager.default.removeItem(atPath: body.path) }
+                }
+
+                let request = Self.makeRequest(head, body: body)
+                let response = await gateway.handle(request)
+                try await write(response, for: head, to: outbound)
+                if !head.isKeepAlive { break }
+            }
+        }
+    }
+
+    private static func hasBody(_ head: HTTPRequestHead) -> Bool {
+        if let length = head.headers.first(name: "content-length"), let value = Int64(length) {
+            return value > 0 || head.method == .PUT || head.method == .POST
+        }
+        return head.headers.contains(name: "transfer-encoding")
+    }
+
+    /// Writes the body parts up to `.end` into a new spool file, hashing as
+    /// it goes.
+    private func spool(
+        _ parts: inout NIOAsyncChannelInboundStream<HTTPServerRequestPart>.AsyncIterator
+    ) async throws -> ObjectGatewayRequest.Body {
+        let path = (gateway.spoolDirectory as NSString).appendingPathComponent(UUID().uuidString.lowercased())
+        var sha256 = SHA256()
+        var md5 = Insecure.MD5()
+        var size: Int64 = 0
+        do {
+            try await FileSystem.shared.withFileHandle(
+                forWritingAt: FilePath(path),
+                options: .newFile(replaceExisting: true)
+            ) { handle in
+                try await handle.withBufferedWriter { writer in
+                    while let part = try await parts.next() {
+                        switch part {
+                        case .body(let buffer):
+                            buffer.withUnsafeReadableBytes { bytes in
+                                sha256.update(bufferPointer: bytes)
+                                md5.update(bufferPointer: bytes)
+                            }
+                            size += Int64(buffer.readableBytes)
+                            _ = try await writer.write(contentsOf: buffer)
+                        case .end:
+                            return
+                        case .head:
+                            continue
+                        }
+                    }
+                }
+            }
+        } catch {
+            try? FileManager.default.removeItem(atPath: path)
+            throw error
+        }
+        return ObjectGatewayRequest.Body(
+            path: path, size: size, sha256: SigV4.hex(sha256.finalize()), md5: Data(md5.finalize()))
+    }
+
+    /// Splits the request target into a decoded path and query. Query items
+    /// keep their order; a name without `=` has an empty value (`?uploads`).
+    static func makeRequest(_ head: HTTPRequestHead, body: ObjectGatewayRequest.Body?) -> ObjectGatewayRequest {
+        let target = head.uri
+        let pathPart: Substring
+        let queryPart: Substring
+        if let question = target.firstIndex(of: "?") {
+            pathPart = target[..<question]
+            queryPart = target[target.index(after: question)...]
+        } else {
+            pathPart = target[...]
+            queryPart = ""
+        }
+        let query: [(name: String, value: String)] = queryPart.split(separator: "&").map { item in
+            let pieces = item.split(separator: "=", maxSplits: 1, omittingEmptySubsequences: false)
+            return (decode(pieces[0]), pieces.count > 1 ? decode(pieces[1]) : "")
+        }
+        return ObjectGatewayRequest(
+            method: head.method.rawValue,
+            path: String(pathPart).removingPercentEncoding ?? String(pathPart),
+            query: query,
+            headers: head.headers.map { ($0.name, $0.value) },
+            body: body
+        )
+    }
+
+    /// Query components use `+` for spaces in some clients; SigV4 clients
+    /// always percent-encode, so `+` is only ever a literal plus there.
+    private static func decode(_ component: Substring) -> String {
+        String(component).removingPercentEncoding ?? String(component)
+    }
+
+    private func write(
+        _ response: ObjectGatewayResponse, for request: HTTPRequestHead,
+        to outbound: NIOAsyncChannelOutboundWriter<HTTPServerResponsePart>
+    ) async throws {
+        var headers = HTTPHeaders(response.headers.map { ($0.name, $0.value) })
+        headers.replaceOrAdd(name: "Server", value: "strato-object-gateway")
+        headers.replaceOrAdd(name: "Date", value: ObjectGatewayXML.httpDate(Date()))
+        if !headers.contains(name: "content-length") {
+            switch response.body {
+            case .empty: headers.add(name: "Content-Length", value: "0")
+            case .data(let data): headers.add(name: "Content-Length", value: String(data.count))
+            case .file(_, let range): headers.add(name: "Content-Length", value: String(range.count))
+            }
+        }
+        if !request.isKeepAlive {
+            headers.replaceOrAdd(name: "Connection", value: "close")
+        }
+        let head = HTTPResponseHead(
+            version: request.version, status: HTTPResponseStatus(statusCode: response.status), headers: headers)
+        try await outbound.write(.head(head))
+
+        switch response.body {
+        case .empty:
+            break
+        case .data(let data):
+            try await outbound.write(.body(.byteBuffer(ByteBuffer(bytes: data))))
+        case .file(let path, let range):
+            // The data file may have been replaced since the gateway answered;
+            // its successor has a new name, so a failed open means the
+            // connection is closed rather than a wrong object sent.
+            try await FileSystem.shared.withFileHandle(forReadingAt: FilePath(path)) { handle in
+                for try await chunk in handle.readChunks(in: range, chunkLength: .mebibytes(1)) {
+                    try await outbound.write(.body(.byteBuffer(chunk)))
+                }
+            }
+        }
+        try await outbound.write(.end(nil))
+    }
+}
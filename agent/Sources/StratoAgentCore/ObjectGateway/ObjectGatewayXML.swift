@@ -0,0 +1,120 @@
+import Foundation
+
+/// The S3 XML the gateway speaks: rendering for its responses and a small
+/// scanner for the two request bodies it reads (CompleteMultipartUpload and
+/// DeleteObjects). Both request documents are flat lists of leaf elements,
+/// so a scanner is enough and keeps FoundationXML out of the agent.
+enum ObjectGatewayXML {
+    static let namespace = "http://s3.amazonaws.com/doc/2006-03-01/"
+    static let declaration = #"<?xml version="1.0" encoding="UTF-8"?>"#
+
+    // MARK: - Rendering
+
+    static func escape(_ text: String) -> String {
+        var escaped = ""
+        escaped.reserveCapacity(text.count)
+        for character in text {
+            switch character {
+            case "&": escaped += "&amp;"
+            case "<": escaped += "&lt;"
+            case ">": escaped += "&gt;"
+            case "\"": escaped += "&quot;"
+            case "'": escaped += "&apos;"
+            default: escaped.append(character)
+            }
+        }
+        return escaped
+    }
+
+    static func element(_ name: String, _ value: String) -> String {
+        "<\(name)>\(escape(value))</\(name)>"
+    }
+
+    /// A complete document with `root` as its namespaced root element.
+    static func document(_ root: String, _ children: [String]) -> Data {
+        Data((declaration + "\n<\(root) xmlns=\"\(namespace)\">" + children.joined() + "</\(root)>").utf8)
+    }
+
+    static func error(code: String, message: String, resource: String, requestId: String) -> Data {
+        Data(
+            (declaration + "\n<Error>"
+                + element("Code", code) + element("Message", message) + element("Resource", resource)
+                + element("RequestId", requestId) + "</Error>").utf8)
+    }
+
+    /// S3's XML timestamp form, e.g. `2026-10-16T09:30:00.000Z`.
+    static func timestamp(_ date: Date) -> String {
+        let formatter = ISO8601DateFormatter()
+        formatter.formatOptions = [.withInternetDateTime, .withFractionalSeconds]
+        return formatter.string(from: date)
+    }
+
+    /// The RFC 7231 form HTTP headers such as `Last-Modified` use.
+    static func httpDate(_ date: Date) -> String {
+        var calendar = Calendar(identifier: .gregorian)
+        calendar.timeZone = TimeZone(identifier: "GMT")!
+        let c = calendar.dateComponents([.weekday, .year, .month, .day, .hour, .minute, .second], from: date)
+        let weekdays = ["Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"]
+        let months = ["Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"]
+        func two(_ value: Int?) -> String {
+            let value = value ?? 0
+            return value < 10 ? "0\(value)" : "\(value)"
+        }
+        return "\(weekdays[(c.weekday ?? 1) - 1]), \(two(c.day)) \(months[(c.month ?? 1) - 1]) \(c.year ?? 1970) "
+            + "\(two(c.hour)):\(two(c.minute)):\(two(c.second)) GMT"
+    }
+
+    // MARK: - Scanning
+
+    /// The text of every `<name>…</name>` element in `xml`, in document
+    /// order and unescaped. Elements must not nest inside one of the same
+    /// name, which holds for every document the gateway reads.
+    static func values(of name: String, in xml: Substring) -> [Substring] {
+        var results: [Substring] = []
+        var remaining = xml[...]
+        while let open = remaining.range(of: "<\(name)>") {
+            guard let close = remaining[open.upperBound...].range(of: "</\(name)>") else { break }
+            results.append(remaining[open.upperBound..<close.lowerBound])
+            remaining = remaining[close.upperBound...]
+        }
+        return results
+    }
+
+    static func unescape(_ text: Substring) -> String {
+        guard text.contains("&") else { return String(text) }
+        return String(text)
+            .replacingOccurrences(of: "&lt;", with: "<")
+            .replacingOccurrences(of: "&gt;", with: ">")
+            .replacingOccurrences(of: "&quot;", with: "\"")
+            .replacingOccurrences(of: "&apos;", with: "'")
+            .replacingOccurrences(of: "&amp;", with: "&")
+    }
+
+    /// The `(PartNumber, ETag)` list of a CompleteMultipartUpload body, or
+    /// nil when it is not one. ETags are returned without their quotes.
+    static func completedParts(in xml: String) -> [(number: Int, etag: String)]? {
+        guard xml.contains("<CompleteMultipartUpload") else { return nil }
+        var parts: [(number: Int, etag: String)] = []
+        for part in values(of: "Part", in: xml[...]) {
+            guard let number = values(of: "PartNumber", in: part).first.flatMap({ Int($0) }),
+                let etag = values(of: "ETag", in: part).first
+            else {
+                return nil
+            }
+            let unquoted = unescape(etag).trimmingCharacters(in: CharacterSet(charactersIn: "\" "))
+            parts.append((number, unquoted))
+        }
+        return parts
+    }
+
+    /// The keys and quiet flag of a DeleteObjects body, or nil when it is
+    /// not one.
+    static func deleteRequest(in xml: String) -> (keys: [String], quiet: Bool)? {
+        guard xml.contains("<Delete") else { return nil }
+        let keys = values(of: "Object", in: xml[...]).compactMap { object in
+            values(of: "Key", in: object).first.map(unescape)
+        }
+        let quiet = values(of: "Quiet", in: xml[...]).first?.lowercased() == "true"
+        return (keys, quiet)
+    }
+}
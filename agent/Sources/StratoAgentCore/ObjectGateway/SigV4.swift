@@ -0,0 +1,380 @@
+import Crypto
+import Foundation
+
+/// AWS Signature Version 4 as S3 uses it: verification for the object
+/// gateway, and signing for its tests and any caller that needs a presigned
+/// URL. Both directions build the same canonical request, so a signature
+/// this type produces is one it accepts.
+///
+/// S3's dialect differs from the generic SigV4 spec in two places that
+/// matter here: the canonical URI is each path segment encoded once (never
+/// twice), and the payload hash is whatever the client put in
+/// `x-amz-content-sha256` — the gateway checks that claim against the body
+/// separately, after the signature.
+public enum SigV4 {
+    public static let algorithm = "AWS4-HMAC-SHA256"
+    public static let service = "s3"
+    public static let terminator = "aws4_request"
+    public static let unsignedPayload = "UNSIGNED-PAYLOAD"
+    /// SHA-256 of the empty string: the payload hash of a bodiless request.
+    public static let emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+    /// The longest validity a presigned URL may claim (seven days, as in S3).
+    public static let maximumPresignedExpiry = 604_800
+    /// How far a header-signed request's timestamp may sit from the
+    /// gateway's clock, either way.
+    public static let allowedClockSkew: TimeInterval = 900
+
+    /// The parts of a request the signature covers, in decoded form.
+    public struct CanonicalInput: Sendable {
+        public var method: String
+        /// The percent-decoded path, e.g. `/bucket/photos/a b.jpg`.
+        public var path: String
+        /// Percent-decoded query parameters, in any order.
+        public var query: [(name: String, value: String)]
+        /// Request headers; names are matched case-insensitively.
+        public var headers: [(name: String, value: String)]
+
+        public init(
+            method: String, path: String, query: [(name: String, value: String)],
+            headers: [(name: String, value: String)]
+        ) {
+            self.method = method
+            self.path = path
+            self.query = query
+            self.headers = headers
+        }
+    }
+
+    /// `<key>/<yyyymmdd>/<region>/s3/aws4_request`.
+    public struct CredentialScope: Equatable, Sendable {
+        public let accessKeyId: String
+        public let date: String
+        public let region: String
+
+        var scope: String { "\(date)/\(region)/\(SigV4.service)/\(SigV4.terminator)" }
+    }
+
+    /// A request's claimed authentication, from either the `Authorization`
+    /// header or presigned-URL query parameters.
+    public struct Claim: Equatable, Sendable {
+        public let credential: CredentialScope
+        public let signedHeaders: [String]
+        public let signature: String
+        /// The `x-amz-date` / `X-Amz-Date` timestamp, `yyyyMMdd'T'HHmmss'Z'`.
+        public let timestamp: String
+        /// The payload hash the signature was computed over.
+        public let payloadHash: String
+        /// Validity in seconds for a presigned URL; nil for header auth.
+        public let expires: Int?
+
+        public var isPresigned: Bool { expires != nil }
+    }
+
+    public enum AuthError: Error, Equatable, Sendable {
+        /// No SigV4 credentials at all: an anonymous request.
+        case missing
+        case malformed(String)
+        case unsupportedAlgorithm(String)
+        case timeSkewed
+        case expired
+        case signatureMismatch
+    }
+
+    // MARK: - Parsing
+
+    /// The claim a request makes, or `.missing` when it makes none.
+    public static func claim(of request: CanonicalInput) throws -> Claim {
+        if let header = header("authorization", in: request.headers) {
+            return try headerClaim(header, request: request)
+        }
+        if queryValue("X-Amz-Algorithm", in: request.query) != nil {
+            return try presignedClaim(request)
+        }
+        throw AuthError.missing
+    }
+
+    private static func headerClaim(_ header: String, request: CanonicalInput) throws -> Claim {
+        let trimmed = header.trimmingCharacters(in: .whitespaces)
+        guard trimmed.hasPrefix(algorithm + " ") else {
+            throw AuthError.unsupportedAlgorithm(String(trimmed.prefix { $0 != " " }))
+        }
+        var fields: [String: String] = [:]
+        for component in trimmed.dropFirst(algorithm.count + 1).split(separator: ",") {
+            let pair = component.trimmingCharacters(in: .whitespaces)
+            guard let equals = pair.firstIndex(of: "=") else { continue }
+            fields[String(pair[..<equals])] = String(pair[pair.index(after: equals)...])
+        }
+        guard let credential = fields["Credential"], let signedHeaders = fields["SignedHeaders"],
+            let signature = fields["Signature"]
+        else {
+            throw AuthError.malformed("Authorization header must carry Credential, SignedHeaders and Signature")
+        }
+        guard let timestamp = Self.header("x-amz-date", in: request.headers) else {
+            throw AuthError.malformed("header-signed requests must carry x-amz-date")
+        }
+        guard let payloadHash = Self.header("x-amz-content-sha256", in: request.headers) else {
+            throw AuthError.malformed("header-signed requests must carry x-amz-content-sha256")
+        }
+        return Claim(
+            credential: try parseCredential(credential, timestamp: timestamp),
+            signedHeaders: try parseSignedHeaders(signedHeaders),
+            signature: signature.lowercased(),
+            timestamp: timestamp,
+            payloadHash: payloadHash,
+            expires: nil
+        )
+    }
+
+    private static func presignedClaim(_ request: CanonicalInput) throws -> Claim {
+        let algorithmValue = queryValue("X-Amz-Algorithm", in: request.query) ?? ""
+        guard algorithmValue == algorithm else {
+            throw AuthError.unsupportedAlgorithm(algorithmValue)
+        }
+        guard let credential = queryValue("X-Amz-Credential", in: request.query),
+            let timestamp = queryValue("X-Amz-Date", in: request.query),
+            let expiresValue = queryValue("X-Amz-Expires", in: request.query),
+            let signedHeaders = queryValue("X-Amz-SignedHeaders", in: request.query),
+            let signature = queryValue("X-Amz-Signature", in: request.query)
+        else {
+            throw AuthError.malformed("presigned URLs must carry every X-Amz-* authentication parameter")
+        }
+        guard let expires = Int(expiresValue), (1...maximumPresignedExpiry).contains(expires) else {
+            throw AuthError.malformed("X-Amz-Expires must be between 1 and \(maximumPresignedExpiry) seconds")
+        }
+        return Claim(
+            credential: try parseCredential(credential, timestamp: timestamp),
+            signedHeaders: try parseSignedHeaders(signedHeaders),
+            signature: signature.lowercased(),
+            timestamp: timestamp,
+            payloadHash: queryValue("X-Amz-Content-Sha256", in: request.query) ?? unsignedPayload,
+            expires: expires
+        )
+    }
+
+    private static func parseCredential(_ value: String, timestamp: String) throws -> CredentialScope {
+        let parts = value.split(separator: "/", omittingEmptySubsequences: false).map(String.init)
+        guard parts.count == 5, !parts[0].isEmpty, parts[3] == service, parts[4] == terminator else {
+            throw AuthError.malformed("credential must be <key>/<date>/<region>/s3/aws4_request")
+        }
+        guard timestamp.hasPrefix(parts[1]), parts[1].count == 8 else {
+            throw AuthError.malformed("credential date does not match the request timestamp")
+        }
+        return CredentialScope(accessKeyId: parts[0], date: parts[1], region: parts[2])
+    }
+
+    private static func parseSignedHeaders(_ value: String) throws -> [String] {
+        let names = value.split(separator: ";").map { $0.lowercased() }
+        guard names.contains("host") else {
+            throw AuthError.malformed("the host header must be signed")
+        }
+        return names
+    }
+
+    // MARK: - Verification
+
+    /// Verifies `claim` against the request and the key's secret. Checks the
+    /// time window first, so an expired URL reports as expired rather than
+    /// as a signature problem.
+    public static func verify(
+        _ claim: Claim, request: CanonicalInput, secretAccessKey: String, now: Date = Date()
+    ) throws {
+        guard let signedAt = parseTimestamp(claim.timestamp) else {
+            throw AuthError.malformed("timestamps must be formatted yyyyMMdd'T'HHmmss'Z'")
+        }
+        if let expires = claim.expires {
+            if now < signedAt.addingTimeInterval(-allowedClockSkew) {
+                throw AuthError.timeSkewed
+            }
+            if now > signedAt.addingTimeInterval(TimeInterval(expires)) {
+                throw AuthError.expired
+            }
+        } else if abs(now.timeIntervalSince(signedAt)) > allowedClockSkew {
+            throw AuthError.timeSkewed
+        }
+
+        let expected = signature(
+            for: request, signedHeaders: claim.signedHeaders, payloadHash: claim.payloadHash,
+            timestamp: claim.timestamp, credential: claim.credential, secretAccessKey: secretAccessKey,
+            excludingQuery: claim.isPresigned ? "X-Amz-Signature" : nil)
+        guard constantTimeEquals(expected, claim.signature) else {
+            throw AuthError.signatureMismatch
+        }
+    }
+
+    // MARK: - Signing
+
+    /// The `Authorization` header value for a header-signed request. The
+    /// request must already carry every header named in `signedHeaders`,
+    /// including `host`, `x-amz-date` and `x-amz-content-sha256`.
+    public static func authorizationHeader(
+        for request: CanonicalInput, signedHeaders: [String], accessKeyId: String, secretAccessKey: String,
+        region: String
+    ) -> String {
+        let timestamp = header("x-amz-date", in: request.headers) ?? ""
+        let payloadHash = header("x-amz-content-sha256", in: request.headers) ?? unsignedPayload
+        let names = signedHeaders.map { $0.lowercased() }.sorted()
+        let credential = CredentialScope(
+            accessKeyId: accessKeyId, date: String(timestamp.prefix(8)), region: region)
+        let signature = signature(
+            for: request, signedHeaders: names, payloadHash: payloadHash, timestamp: timestamp,
+            credential: credential, secretAccessKey: secretAccessKey, excludingQuery: nil)
+        return
+            "\(algorithm) Credential=\(accessKeyId)/\(credential.scope), SignedHeaders=\(names.joined(separator: ";")), Signature=\(signature)"
+    }
+
+    /// The query parameters that presign `request` (which must carry a
+    /// `host` header) for `expires` seconds from `date`, signature last.
+    public static func presignedQuery(
+        for request: CanonicalInput, accessKeyId: String, secretAccessKey: String, region: String, date: Date,
+        expires: Int
+    ) -> [(name: String, value: String)] {
+        let timestamp = formatTimestamp(date)
+        let credential = CredentialScope(
+            accessKeyId: accessKeyId, date: String(timestamp.prefix(8)), region: region)
+        let authQuery: [(name: String, value: String)] = [
+            ("X-Amz-Algorithm", algorithm),
+            ("X-Amz-Credential", "\(accessKeyId)/\(credential.scope)"),
+            ("X-Amz-Date", timestamp),
+            ("X-Amz-Expires", String(expires)),
+            ("X-Amz-SignedHeaders", "host"),
+        ]
+        var signing = request
+        signing.query += authQuery
+        let signature = signature(
+            for: signing, signedHeaders: ["host"], payloadHash: unsignedPayload, timestamp: timestamp,
+            credential: credential, secretAccessKey: secretAccessKey, excludingQuery: nil)
+        return authQuery + [("X-Amz-Signature", signature)]
+    }
+
+    // MARK: - Canonical form
+
+    static func signature(
+        for request: CanonicalInput, signedHeaders: [String], payloadHash: String, timestamp: String,
+        credential: CredentialScope, secretAccessKey: String, excludingQuery excluded: String?
+    ) -> String {
+        let canonical = canonicalRequest(
+            request, signedHeaders: signedHeaders, payloadHash: payloadHash, excludingQuery: excluded)
+        let stringToSign = [
+            algorithm,
+            timestamp,
+            credential.scope,
+            hex(SHA256.hash(data: Data(canonical.utf8))),
+        ].joined(separator: "\n")
+        let key = signingKey(
+            secretAccessKey: secretAccessKey, date: credential.date, region: credential.region)
+        return hex(HMAC<SHA256>.authenticationCode(for: Data(stringToSign.utf8), using: key))
+    }
+
+    static func canonicalRequest(
+        _ request: CanonicalInput, signedHeaders: [String], payloadHash: String, excludingQuery excluded: String?
+    ) -> String {
+        let query = request.query
+            .filter { $0.name != excluded }
+            .map { (uriEncode($0.name, encodeSlash: true), uriEncode($0.value, encodeSlash: true)) }
+            .sorted { $0.0 == $1.0 ? $0.1 < $1.1 : $0.0 < $1.0 }
+            .map { "\($0.0)=\($0.1)" }
+            .joined(separator: "&")
+        let names = signedHeaders.sorted()
+        let headers = names.map { name in
+            let values = request.headers
+                .filter { $0.name.lowercased() == name }
+                .map { collapseWhitespace($0.value) }
+            return "\(name):\(values.joined(separator: ","))\n"
+        }.joined()
+        return [
+            request.method,
+            uriEncode(request.path, encodeSlash: false),
+            query,
+            headers,
+            names.joined(separator: ";"),
+            payloadHash,
+        ].joined(separator: "\n")
+    }
+
+    static func signingKey(secretAccessKey: String, date: String, region: String) -> SymmetricKey {
+        var key = SymmetricKey(data: Data("AWS4\(secretAccessKey)".utf8))
+        for component in [date, region, service, terminator] {
+            key = SymmetricKey(data: Data(HMAC<SHA256>.authenticationCode(for: Data(component.utf8), using: key)))
+        }
+        return key
+    }
+
+    /// RFC 3986 encoding with AWS's unreserved set; `/` is kept in paths.
+    public static func uriEncode(_ value: String, encodeSlash: Bool) -> String {
+        let digits = Array("0123456789ABCDEF")
+        var encoded = ""
+        for byte in value.utf8 {
+            switch byte {
+            case UInt8(ascii: "A")...UInt8(ascii: "Z"), UInt8(ascii: "a")...UInt8(ascii: "z"),
+                UInt8(ascii: "0")...UInt8(ascii: "9"), UInt8(ascii: "-"), UInt8(ascii: "."), UInt8(ascii: "_"),
+                UInt8(ascii: "~"):
+                encoded.append(Character(UnicodeScalar(byte)))
+            case UInt8(ascii: "/") where !encodeSlash:
+                encoded.append("/")
+            default:
+                encoded.append("%")
+                encoded.append(digits[Int(byte >> 4)])
+                encoded.append(digits[Int(byte & 0x0F)])
+            }
+        }
+        return encoded
+    }
+
+    // MARK: - Helpers
+
+    static func header(_ name: String, in headers: [(name: String, value: String)]) -> String? {
+        let values = headers.filter { $0.name.lowercased() == name }.map(\.value)
+        return values.isEmpty ? nil : values.joined(separator: ",")
+    }
+
+    static func queryValue(_ name: String, in query: [(name: String, value: String)]) -> String? {
+        query.first { $0.name == name }?.value
+    }
+
+    private static func collapseWhitespace(_ value: String) -> String {
+        value.split(whereSeparator: { $0 == " " || $0 == "\t" }).joined(separator: " ")
+    }
+
+    static func hex<D: Sequence>(_ bytes: D) -> String where D.Element == UInt8 {
+        bytes.map { String($0, radix: 16).leftPadded(to: 2) }.joined()
+    }
+
+    private static func constantTimeEquals(_ lhs: String, _ rhs: String) -> Bool {
+        let a = Array(lhs.utf8)
+        let b = Array(rhs.utf8)
+        guard a.count == b.count else { return false }
+        var difference: UInt8 = 0
+        for index in a.indices {
+            difference |= a[index] ^ b[index]
+        }
+        return difference == 0
+    }
+
+    /// Parses `yyyyMMdd'T'HHmmss'Z'` (the only form SigV4 signs).
+    static func parseTimestamp(_ value: String) -> Date? {
+        let characters = Array(value)
+        guard characters.count == 16, characters[8] == "T", characters[15] == "Z" else { return nil }
+        func number(_ range: Range<Int>) -> Int? { Int(String(characters[range])) }
+        guard let year = number(0..<4), let month = number(4..<6), let day = number(6..<8),
+            let hour = number(9..<11), let minute = number(11..<13), let second = number(13..<15)
+        else { return nil }
+        var calendar = Calendar(identifier: .gregorian)
+        calendar.timeZone = TimeZone(identifier: "UTC")!
+        return calendar.date(
+            from: DateComponents(year: year, month: month, day: day, hour: hour, minute: minute, second: second))
+    }
+
+    static func formatTimestamp(_ date: Date) -> String {
+        var calendar = Calendar(identifier: .gregorian)
+        calendar.timeZone = TimeZone(identifier: "UTC")!
+        let c = calendar.dateComponents([.year, .month, .day, .hour, .minute, .second], from: date)
+        func pad(_ value: Int?, _ width: Int) -> String { String(value ?? 0).leftPadded(to: width) }
+        return "\(pad(c.year, 4))\(pad(c.month, 2))\(pad(c.day, 2))T\(pad(c.hour, 2))\(pad(c.minute, 2))\(pad(c.second, 2))Z"
+    }
+}
+
+extension String {
+    fileprivate func leftPadded(to width: Int) -> String {
+        count >= width ? self : String(repeating: "0", count: width - count) + self
+    }
+}
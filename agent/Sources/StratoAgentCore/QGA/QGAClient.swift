@@ -149,6 +149,32 @@ public actor QGAClient {
         }
     }
 
+    /// Runs `path` with `arguments` inside the guest (`guest-exec`, no shell)
+    /// and waits for it to exit, polling `guest-exec-status`. The wait is
+    /// unbounded here: callers bound it with a `StageBudget`, like every qga
+    /// call. A process left running when the budget abandons the wait keeps
+    /// running in the guest.
+    public func exec(path: String, arguments: [String]) async throws -> GuestExecResult {
+        try await withChannel { channel, framer in
+            try await self.performSync(channel, framer)
+            try await self.writeRequest(
+                channel, execute: "guest-exec",
+                arguments: QGA.ExecArguments(path: path, arg: arguments, captureOutput: true))
+            let started = try await self.readReturn(channel, framer, as: QGA.ExecStarted.self)
+            while true {
+                try await self.writeRequest(
+                    channel, execute: "guest-exec-status", arguments: QGA.ExecStatusArguments(pid: started.pid))
+                let status = try await self.readReturn(channel, framer, as: QGA.ExecStatus.self)
+                if status.exited {
+                    return GuestExecResult(
+                        exitCode: status.exitCode, signal: status.signal,
+                        output: QGA.ExecStatus.text(status.outData ?? status.errData))
+                }
+                try await Task.sleep(for: .milliseconds(250))
+            }
+        }
+    }
+
     // MARK: - Channel lifecycle
 
     /// Opens a channel, runs `body`, and closes the channel whether or not
@@ -246,6 +272,26 @@ public actor QGAClient {
     }
 }
 
+/// How a `guest-exec` process ended.
+public struct GuestExecResult: Sendable, Equatable {
+    /// The exit status, when the process exited normally.
+    public let exitCode: Int?
+    /// The signal that ended the process, when one did.
+    public let signal: Int?
+    /// The start of its standard output, or of its standard error when it
+    /// wrote nothing to standard output.
+    public let output: String
+
+    public init(exitCode: Int?, signal: Int?, output: String) {
+        self.exitCode = exitCode
+        self.signal = signal
+        self.output = output
+    }
+
+    /// Whether the process exited 0.
+    public var succeeded: Bool { exitCode == 0 }
+}
+
 extension QGA {
     /// Decodable placeholder for commands whose `return` is an empty object.
     struct Empty: Decodable {}
@@ -63,6 +63,54 @@ enum QGA {
         init(mode: String = "powerdown") { self.mode = mode }
     }
 
+    /// `guest-exec`: the program runs directly, not through a shell.
+    struct ExecArguments: Encodable {
+        let path: String
+        let arg: [String]
+        let captureOutput: Bool
+
+        enum CodingKeys: String, CodingKey {
+            case path
+            case arg
+            case captureOutput = "capture-output"
+        }
+    }
+
+    /// `guest-exec` → `{"pid": N}`.
+    struct ExecStarted: Decodable {
+        let pid: Int
+    }
+
+    struct ExecStatusArguments: Encodable {
+        let pid: Int
+    }
+
+    /// `guest-exec-status`. The exit fields and captured output (base64)
+    /// appear only once `exited` is true.
+    struct ExecStatus: Decodable {
+        let exited: Bool
+        let exitCode: Int?
+        let signal: Int?
+        let outData: String?
+        let errData: String?
+
+        enum CodingKeys: String, CodingKey {
+            case exited
+            case exitCode = "exitcode"
+            case signal
+            case outData = "out-data"
+            case errData = "err-data"
+        }
+
+        /// Captured output decoded and cut to a line's worth, for a status
+        /// message rather than a log.
+        static func text(_ base64: String?) -> String {
+            guard let base64, let data = Data(base64Encoded: base64) else { return "" }
+            let text = String(decoding: data.prefix(512), as: UTF8.self)
+            return text.trimmingCharacters(in: .whitespacesAndNewlines)
+        }
+    }
+
     /// `guest-get-host-name` → `{"host-name": "..."}`.
     struct HostName: Decodable {
         let hostName: String
@@ -179,6 +179,48 @@ public actor QMPProbeClient {
         }
     }
 
+    // MARK: - CPU usage
+
+    /// The host thread IDs backing the VM's vCPUs (`query-cpus-fast`), which
+    /// is where per-vCPU CPU time lives in `/proc`. `query-cpus-fast` never
+    /// interrupts the guest, unlike the deprecated `query-cpus`.
+    public func vcpuThreadIDs() async throws -> [Int] {
+        try await withChannel { channel, framer in
+            try await self.negotiate(channel, framer)
+            return try await self.command(
+                channel, framer, execute: "query-cpus-fast",
+                arguments: QMPProbe.NoArguments?.none, as: [QMPProbe.CPUInfoFast].self
+            ).map(\.threadID)
+        }
+    }
+
+    // MARK: - CPU models (wire v28)
+
+    /// The CPU models this QEMU can give a guest with nothing missing, from
+    /// `query-cpu-definitions`. A model counts only when QEMU reported its
+    /// `unavailable-features` and the list is empty: without an accelerator
+    /// that can check, QEMU omits the field and nothing is claimed. Sorted,
+    /// aliases included (QEMU lists `EPYC` and `EPYC-v1` separately).
+    public func usableCPUModels() async throws -> [String] {
+        try await withChannel { channel, framer in
+            try await self.negotiate(channel, framer)
+            let definitions = try await self.command(
+                channel, framer, execute: "query-cpu-definitions",
+                arguments: QMPProbe.NoArguments?.none, as: [QMPProbe.CPUDefinition].self)
+            return definitions.filter { $0.unavailableFeatures?.isEmpty == true }.map(\.name).sorted()
+        }
+    }
+
+    /// Asks QEMU to exit (`quit`). For the throwaway process the CPU model
+    /// probe starts; never sent to a VM's monitor.
+    public func quit() async throws {
+        try await withChannel { channel, framer in
+            try await self.negotiate(channel, framer)
+            _ = try await self.command(
+                channel, framer, execute: "quit", arguments: QMPProbe.NoArguments?.none, as: QMPProbe.Empty.self)
+        }
+    }
+
     // MARK: - Memory hot-add (issue #568)
 
     /// Asks the VM's virtio-mem device to expose `bytes` of hot-plugged
@@ -202,6 +244,178 @@ public actor QMPProbeClient {
         }
     }
 
+    // MARK: - Block I/O throttling (volume types)
+
+    /// Applies a volume type's I/O limits to a hot-plugged disk with
+    /// `block_set_io_throttle`. `qdevID` is the id the guest device was added
+    /// under (the volume's device name). QMP requires all six limits on every
+    /// call; the split read/write limits are left at zero (unlimited) because
+    /// `VolumeQoS` only carries combined ceilings, and a nil limit is zero.
+    public func setBlockIOThrottle(qdevID: String, qos: VolumeQoS) async throws {
+        try await withChannel { channel, framer in
+            try await self.negotiate(channel, framer)
+            _ = try await self.command(
+                channel, framer, execute: "block_set_io_throttle",
+                arguments: QMPProbe.BlockIOThrottleArguments(qdevID: qdevID, qos: qos),
+                as: QMPProbe.Empty.self)
+        }
+    }
+
+    // MARK: - Shared disks (multi-attach volumes)
+
+    /// Hot-plugs a disk other VMs may hold open at the same time. SwiftQEMU's
+    /// `attachDisk` can't set `share-rw`, so this issues the same
+    /// `blockdev-add` + `device_add` pair itself, with the virtio-blk device
+    /// sharing write permission instead of taking QEMU's exclusive image
+    /// lock. The node is named `drive-<deviceID>`, as SwiftQEMU names its
+    /// own, so the ordinary hot-unplug path removes it. A failed
+    /// `device_add` deletes the node again rather than leaving it behind.
+    public func plugSharedDisk(deviceID: String, path: String, format: String, readOnly: Bool) async throws {
+        try await withChannel { channel, framer in
+            try await self.negotiate(channel, framer)
+            let nodeName = "drive-\(deviceID)"
+            _ = try await self.command(
+                channel, framer, execute: "blockdev-add",
+                arguments: QMPProbe.BlockdevAddArguments(
+                    nodeName: nodeName, format: format, path: path, readOnly: readOnly),
+                as: QMPProbe.Empty.self)
+            do {
+                _ = try await self.command(
+                    channel, framer, execute: "device_add",
+                    arguments: QMPProbe.SharedDiskDeviceArguments(id: deviceID, drive: nodeName),
+                    as: QMPProbe.Empty.self)
+            } catch {
+                _ = try? await self.command(
+                    channel, framer, execute: "blockdev-del",
+                    arguments: QMPProbe.BlockdevDelArguments(nodeName: nodeName),
+                    as: QMPProbe.Empty.self)
+                throw error
+            }
+        }
+    }
+
+    // MARK: - Block mirror (volume migration)
+
+    /// Moves the disk the guest currently reads from `sourcePath` onto an NBD
+    /// export with `blockdev-mirror`, then pivots the guest onto it.
+    ///
+    /// The target is added as a raw node over the NBD server, the mirror runs
+    /// a full copy while the guest keeps writing (QEMU replays the dirty
+    /// blocks), and once QEMU reports the job ready `block-job-complete`
+    /// swaps the guest's disk for the target. The call returns after the
+    /// job is gone and `query-block` shows the guest's disk is no longer
+    /// `sourcePath`; the source file is left behind, untouched from then on.
+    ///
+    /// Setup and each status poll open their own channel, because a mirror
+    /// of a large volume outlives many balloon-stats probes and the monitor
+    /// admits one client at a time. Any failure cancels the job and deletes
+    /// the target node, so the guest stays on its original disk.
+    public func mirrorDisk(
+        sourcePath: String,
+        target: NBDExportEndpoint,
+        jobID: String,
+        pollInterval: Duration = .seconds(1),
+        // Inside the caller's stage budget, so a mirror that will not
+        // converge is cancelled cleanly here rather than cut off there.
+        timeout: Duration = .seconds(StageBudget.volumeMirrorSeconds - 60)
+    ) async throws {
+        let targetNode = "mirror-\(jobID)"
+        try await withChannel { channel, framer in
+            try await self.negotiate(channel, framer)
+            let disks = try await self.command(
+                channel, framer, execute: "query-block",
+                arguments: QMPProbe.NoArguments?.none, as: [QMPProbe.BlockInfo].self)
+            guard let node = disks.first(where: { $0.inserted?.file == sourcePath })?.inserted?.nodeName else {
+                throw QMPProbeError.commandError("no block node is backed by \(sourcePath)")
+            }
+            _ = try await self.command(
+                channel, framer, execute: "blockdev-add",
+                arguments: QMPProbe.NBDBlockdevAddArguments(nodeName: targetNode, endpoint: target),
+                as: QMPProbe.Empty.self)
+            do {
+                _ = try await self.command(
+                    channel, framer, execute: "blockdev-mirror",
+                    arguments: QMPProbe.BlockdevMirrorArguments(jobID: jobID, device: node, target: targetNode),
+                    as: QMPProbe.Empty.self)
+            } catch {
+                _ = try? await self.command(
+                    channel, framer, execute: "blockdev-del",
+                    arguments: QMPProbe.BlockdevDelArguments(nodeName: targetNode),
+                    as: QMPProbe.Empty.self)
+                throw error
+            }
+        }
+
+        let deadline = ContinuousClock.now + timeout
+        do {
+            // Phase 1: wait for the bulk copy to converge.
+            while true {
+                guard let job = try await blockJob(jobID) else {
+                    throw QMPProbeError.commandError("mirror job \(jobID) ended before it was ready")
+                }
+                if job.ready { break }
+                guard ContinuousClock.now < deadline else {
+                    throw QMPProbeError.commandError("mirror job \(jobID) did not converge in time")
+                }
+                try await Task.sleep(for: pollInterval)
+            }
+
+            // Phase 2: pivot, and wait for QEMU to retire the job.
+            try await withChannel { channel, framer in
+                try await self.negotiate(channel, framer)
+                _ = try await self.command(
+                    channel, framer, execute: "block-job-complete",
+                    arguments: QMPProbe.BlockJobArguments(device: jobID),
+                    as: QMPProbe.Empty.self)
+            }
+            while try await blockJob(jobID) != nil {
+                guard ContinuousClock.now < deadline else {
+                    throw QMPProbeError.commandError("mirror job \(jobID) did not complete in time")
+                }
+                try await Task.sleep(for: pollInterval)
+            }
+
+            // A job that failed during the pivot also disappears; only the
+            // guest's disk tells the two apart.
+            let disks = try await withChannel { channel, framer in
+                try await self.negotiate(channel, framer)
+                return try await self.command(
+                    channel, framer, execute: "query-block",
+                    arguments: QMPProbe.NoArguments?.none, as: [QMPProbe.BlockInfo].self)
+            }
+            if disks.contains(where: { $0.inserted?.file == sourcePath }) {
+                throw QMPProbeError.commandError("mirror job \(jobID) ended without pivoting")
+            }
+        } catch {
+            logger.warning(
+                "Block mirror failed; cancelling",
+                metadata: ["jobId": .string(jobID), "error": .string("\(error)")])
+            _ = try? await withChannel { channel, framer in
+                try await self.negotiate(channel, framer)
+                _ = try? await self.command(
+                    channel, framer, execute: "block-job-cancel",
+                    arguments: QMPProbe.BlockJobArguments(device: jobID, force: true),
+                    as: QMPProbe.Empty.self)
+                _ = try? await self.command(
+                    channel, framer, execute: "blockdev-del",
+                    arguments: QMPProbe.BlockdevDelArguments(nodeName: targetNode),
+                    as: QMPProbe.Empty.self)
+            }
+            throw error
+        }
+    }
+
+    /// The block job named `jobID`, or nil once QEMU has retired it.
+    private func blockJob(_ jobID: String) async throws -> QMPProbe.BlockJobInfo? {
+        try await withChannel { channel, framer in
+            try await self.negotiate(channel, framer)
+            return try await self.command(
+                channel, framer, execute: "query-block-jobs",
+                arguments: QMPProbe.NoArguments?.none, as: [QMPProbe.BlockJobInfo].self
+            ).first { $0.device == jobID }
+        }
+    }
+
     // MARK: - Channel lifecycle
 
     /// Opens a channel, runs `body`, and closes the channel whether or not
@@ -417,11 +631,180 @@ enum QMPProbe {
         let property: String
     }
 
+    /// `block_set_io_throttle` arguments. Every limit is mandatory on the
+    /// wire; zero means unlimited.
+    struct BlockIOThrottleArguments: Encodable {
+        let id: String
+        let bps: Int64
+        let bpsRd: Int64 = 0
+        let bpsWr: Int64 = 0
+        let iops: Int64
+        let iopsRd: Int64 = 0
+        let iopsWr: Int64 = 0
+
+        init(qdevID: String, qos: VolumeQoS) {
+            self.id = qdevID
+            self.bps = qos.maxBytesPerSecond ?? 0
+            self.iops = Int64(qos.maxIOPS ?? 0)
+        }
+
+        enum CodingKeys: String, CodingKey {
+            case id, bps, iops
+            case bpsRd = "bps_rd"
+            case bpsWr = "bps_wr"
+            case iopsRd = "iops_rd"
+            case iopsWr = "iops_wr"
+        }
+    }
+
+    /// `blockdev-add` arguments for a format node over a plain file.
+    struct BlockdevAddArguments: Encodable {
+        let driver: String
+        let nodeName: String
+        let readOnly: Bool
+        let file: File
+
+        struct File: Encodable {
+            let driver = "file"
+            let filename: String
+        }
+
+        init(nodeName: String, format: String, path: String, readOnly: Bool) {
+            self.driver = format
+            self.nodeName = nodeName
+            self.readOnly = readOnly
+            self.file = File(filename: path)
+        }
+
+        enum CodingKeys: String, CodingKey {
+            case driver, file
+            case nodeName = "node-name"
+            case readOnly = "read-only"
+        }
+    }
+
+    struct BlockdevDelArguments: Encodable {
+        let nodeName: String
+
+        enum CodingKeys: String, CodingKey {
+            case nodeName = "node-name"
+        }
+    }
+
+    /// `device_add` arguments for a virtio-blk device that shares write
+    /// permission on its node with other users of the image.
+    struct SharedDiskDeviceArguments: Encodable {
+        let driver = "virtio-blk-pci"
+        let id: String
+        let drive: String
+        let shareRW = true
+
+        enum CodingKeys: String, CodingKey {
+            case driver, id, drive
+            case shareRW = "share-rw"
+        }
+    }
+
+    /// One entry of `query-block`: a guest drive and the node inserted in it.
+    struct BlockInfo: Decodable {
+        let device: String
+        let inserted: Inserted?
+
+        struct Inserted: Decodable {
+            /// The image the node reads, as QEMU renders it: a path for a
+            /// file, an `nbd://` URI for an NBD export.
+            let file: String
+            let nodeName: String?
+
+            enum CodingKeys: String, CodingKey {
+                case file
+                case nodeName = "node-name"
+            }
+        }
+    }
+
+    /// `blockdev-add` arguments for a raw node over an NBD export.
+    struct NBDBlockdevAddArguments: Encodable {
+        let driver = "raw"
+        let nodeName: String
+        let file: File
+
+        struct File: Encodable {
+            let driver = "nbd"
+            let server: Server
+            let export: String
+        }
+
+        struct Server: Encodable {
+            let type = "inet"
+            let host: String
+            let port: String
+        }
+
+        init(nodeName: String, endpoint: NBDExportEndpoint) {
+            self.nodeName = nodeName
+            self.file = File(
+                server: Server(host: endpoint.host, port: String(endpoint.port)), export: endpoint.exportName)
+        }
+
+        enum CodingKeys: String, CodingKey {
+            case driver, file
+            case nodeName = "node-name"
+        }
+    }
+
+    /// `blockdev-mirror` arguments: a full copy of `device` into `target`.
+    struct BlockdevMirrorArguments: Encodable {
+        let jobID: String
+        let device: String
+        let target: String
+        let sync = "full"
+
+        enum CodingKeys: String, CodingKey {
+            case device, target, sync
+            case jobID = "job-id"
+        }
+    }
+
+    /// Arguments naming a block job: `block-job-complete`, `block-job-cancel`.
+    struct BlockJobArguments: Encodable {
+        let device: String
+        var force: Bool?
+    }
+
+    /// One entry of `query-block-jobs`. `device` is the job id.
+    struct BlockJobInfo: Decodable {
+        let device: String
+        let ready: Bool
+    }
+
     /// `balloon` arguments: the memory, in bytes, the guest is left with.
     struct BalloonArguments: Encodable {
         let value: Int64
     }
 
+    /// One entry of `query-cpus-fast`; only the host thread is of interest.
+    struct CPUInfoFast: Decodable {
+        let threadID: Int
+
+        enum CodingKeys: String, CodingKey {
+            case threadID = "thread-id"
+        }
+    }
+
+    /// One entry of `query-cpu-definitions`. `unavailable-features` is what
+    /// the host lacks for the model under the running accelerator; absent
+    /// when QEMU couldn't tell.
+    struct CPUDefinition: Decodable {
+        let name: String
+        let unavailableFeatures: [String]?
+
+        enum CodingKeys: String, CodingKey {
+            case name
+            case unavailableFeatures = "unavailable-features"
+        }
+    }
+
     /// `query-balloon` → `{"actual": N}`, the balloon's current view of how
     /// much memory the guest holds.
     struct BalloonInfo: Decodable {
@@ -34,25 +34,31 @@ public typealias SandboxPresence = WorkloadPresence<SandboxStatus>
 
 /// The sizing a VM on this host is actually running with, as opposed to the
 /// sizing its desired spec asks for. Only the dimensions that can move on a
-/// live guest: the two hot-addable ones (issue #568) plus its balloon target
-/// (issue #567 phase 2) — everything else in a spec still needs a recreate.
+/// live guest: the two hot-addable ones (issue #568), its balloon target
+/// (issue #567 phase 2), and the floor pressure reclaim keeps it above —
+/// everything else in a spec still needs a recreate.
 public struct VMSizing: Equatable, Sendable {
     public let cpus: Int
     public let memoryBytes: Int64
     /// The balloon target last applied to this VM, or nil when none has been
     /// (the balloon is deflated and the guest holds its whole grant).
     public let balloonTargetBytes: Int64?
+    /// The reclaim floor last recorded for this VM. Moving it touches nothing
+    /// on the guest, but it still has to reach the manifest the reclaim
+    /// controller reads.
+    public let memoryFloorBytes: Int64?
 
-    public init(cpus: Int, memoryBytes: Int64, balloonTargetBytes: Int64? = nil) {
+    public init(cpus: Int, memoryBytes: Int64, balloonTargetBytes: Int64? = nil, memoryFloorBytes: Int64? = nil) {
         self.cpus = cpus
         self.memoryBytes = memoryBytes
         self.balloonTargetBytes = balloonTargetBytes
+        self.memoryFloorBytes = memoryFloorBytes
     }
 
     /// Whether `spec` asks for a different size than this.
     public func differs(from spec: VMSpec) -> Bool {
         cpus != spec.cpus || memoryBytes != spec.memoryBytes
-            || balloonTargetBytes != spec.balloonTargetBytes
+            || balloonTargetBytes != spec.balloonTargetBytes || memoryFloorBytes != spec.memoryFloorBytes
     }
 }
 
@@ -81,6 +87,9 @@ public enum ReconcileStep: Equatable, Sendable {
     case shutdown
     /// Gracefully stop (best effort) and remove the workload from this host.
     case delete
+    /// Discard the VM and its boot disk and create it again from its image
+    /// (wire v31); ends "exists, not running", like `.create`. VM-only.
+    case replace
 }
 
 /// The desired entry driving a work item, tagged by workload kind.
@@ -156,6 +165,9 @@ public protocol ReconcileActuator: Sendable {
     /// can spot a spec whose vCPU/memory changed under a running VM
     /// (issue #568).
     func observedSizing() async -> [String: VMSizing]
+    /// The replacement count each present VM was created at, so the planner
+    /// can spot a desired entry asking for a replacement (wire v31).
+    func observedReplacements() async -> [String: Int64]
     /// Re-adopt an orphaned VM and return its observed status, so the
     /// reconciler can plan the remaining convergence steps toward the desired
     /// status.
@@ -192,6 +204,10 @@ extension ReconcileActuator {
     /// planned for them; the change still lands at the VM's next boot.
     public func observedSizing() async -> [String: VMSizing] { [:] }
 
+    /// Actuators that don't record replacement counts never have a
+    /// replacement planned for them.
+    public func observedReplacements() async -> [String: Int64] { [:] }
+
     public func adoptSandbox(_ item: ReconcileWorkItem) async throws -> SandboxStatus {
         throw SandboxActuationUnsupportedError()
     }
@@ -356,7 +372,8 @@ public actor Reconciler {
         let presentVMs = await actuator.observedPresence()
         var items = Self.plan(
             desired: message.vms, present: presentVMs, lastApplied: appliedGenerations(kind: .vm),
-            presentSizing: await actuator.observedSizing())
+            presentSizing: await actuator.observedSizing(),
+            presentReplacements: await actuator.observedReplacements())
 
         var presentSandboxCount = 0
         if includeSandboxes {
@@ -617,6 +634,7 @@ public actor Reconciler {
         case .resize: return "resizing"
         case .shutdown: return "shutting down"
         case .delete: return "deleting"
+        case .replace: return "replacing"
         }
     }
 
@@ -628,13 +646,49 @@ public actor Reconciler {
         desired: [DesiredVMState],
         present: [String: VMPresence],
         lastApplied: [String: Int64],
-        presentSizing: [String: VMSizing] = [:]
+        presentSizing: [String: VMSizing] = [:],
+        presentReplacements: [String: Int64] = [:]
     ) -> [ReconcileWorkItem] {
         var items = planCore(desired: desired, present: present, lastApplied: lastApplied)
+        addReplacements(
+            to: &items, desired: desired, present: present, lastApplied: lastApplied,
+            replacements: presentReplacements)
         addResizes(to: &items, desired: desired, present: present, lastApplied: lastApplied, sizing: presentSizing)
         return items
     }
 
+    /// Plans `.replace` for VMs whose desired `replacementCount` is ahead of
+    /// the count they were created at (wire v31) — a health-check action.
+    /// The replacement supersedes whatever else was planned, since the VM is
+    /// recreated from its spec anyway, and is followed by the steps from
+    /// `.created` to the desired status. A VM absent here gets a plain
+    /// create, which records the current count.
+    private static func addReplacements(
+        to items: inout [ReconcileWorkItem],
+        desired: [DesiredVMState],
+        present: [String: VMPresence],
+        lastApplied: [String: Int64],
+        replacements: [String: Int64]
+    ) {
+        for entry in desired where !entry.wantsAbsent {
+            let id = entry.vmId.uuidString
+            guard present[id] != nil,
+                let wanted = entry.replacementCount,
+                wanted > replacements[id] ?? 0
+            else { continue }
+            if let applied = lastApplied[id], entry.generation < applied { continue }
+
+            let steps = [ReconcileStep.replace] + entry.convergenceSteps(from: DesiredVMState.statusAfterCreate)
+            let item = ReconcileWorkItem(
+                kind: .vm, id: id, generation: entry.generation, steps: steps, target: entry.asTarget)
+            if let index = items.firstIndex(where: { $0.kind == .vm && $0.id == id }) {
+                items[index] = item
+            } else {
+                items.append(item)
+            }
+        }
+    }
+
     /// Plans `.resize` for VMs that are already running the status the
     /// control plane wants but at a different size than its spec asks for
     /// (issue #568) — the declarative alternative to an imperative resize
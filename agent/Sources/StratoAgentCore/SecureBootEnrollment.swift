@@ -0,0 +1,153 @@
+import Crypto
+import Foundation
+import StratoShared
+
+/// What the agent needs to honor `MachineProfile.secureBootKeys` (wire v29):
+/// the files and `virt-fw-vars` command line that turn the Secure Boot VARS
+/// template into a variable store enrolled with the VM's own keys, and the
+/// fingerprint that tells an up-to-date store from a stale one. Pure, so the
+/// choices are testable without the tool.
+public enum SecureBootEnrollment {
+    /// Budget for `virt-fw-vars` to rewrite one variable store.
+    public static let enrollTimeout: Duration = .seconds(30)
+
+    /// Name of the file beside `nvram.fd` holding the fingerprint of the keys
+    /// it was enrolled with. Absent for a store copied straight from the
+    /// template.
+    public static let markerFileName = "nvram.keys"
+
+    /// `EFI_CERT_SHA256_GUID` and `EFI_CERT_X509_GUID` from the UEFI spec.
+    static let sha256SignatureType = "c1c41626-504c-4092-aca9-41f936934328"
+    static let x509SignatureType = "a5c059a1-94e4-4aa7-87b5-ab155c2bf072"
+
+    /// A stable digest of `keys`: equal keys give equal fingerprints whatever
+    /// order their JSON keys were sent in.
+    public static func fingerprint(_ keys: SecureBootKeys) -> String {
+        let encoder = JSONEncoder()
+        encoder.outputFormatting = [.sortedKeys]
+        let data = (try? encoder.encode(keys)) ?? Data()
+        return SHA256.hash(data: data).map { String(format: "%02x", $0) }.joined()
+    }
+
+    /// The files to write into a scratch directory and the `virt-fw-vars`
+    /// arguments that read them.
+    public struct Plan: Equatable, Sendable {
+        public let files: [String: Data]
+        public let arguments: [String]
+    }
+
+    public enum PlanError: Error, Equatable, CustomStringConvertible {
+        case invalidCertificate(variable: String, index: Int)
+        case invalidForbiddenEntry(index: Int)
+
+        public var description: String {
+            switch self {
+            case .invalidCertificate(let variable, let index):
+                return "\(variable) entry \(index) is not a PEM certificate"
+            case .invalidForbiddenEntry(let index):
+                return "dbx entry \(index) is neither a PEM certificate nor a SHA-256 hex digest"
+            }
+        }
+    }
+
+    /// Plans the enrollment of `keys` into a copy of `template` written to
+    /// `output`, with scratch files under `scratchDirectory`.
+    ///
+    /// Without `includeMicrosoftKeys` the template's KEK and db are deleted
+    /// first, so only the owner's keys are trusted. The template's dbx
+    /// revocations are kept unless the keys bring a dbx of their own.
+    public static func plan(
+        keys: SecureBootKeys, template: String, output: String, scratchDirectory: String
+    ) throws -> Plan {
+        var files: [String: Data] = [:]
+        func path(_ name: String) -> String { (scratchDirectory as NSString).appendingPathComponent(name) }
+        func certificate(_ pem: String, variable: String, index: Int) throws -> Data {
+            guard SecureBootKeys.certificateDER(fromPEM: pem) != nil else {
+                throw PlanError.invalidCertificate(variable: variable, index: index)
+            }
+            return Data(pem.utf8)
+        }
+
+        var arguments = ["--input", template, "--output", output]
+        if !keys.includeMicrosoftKeys {
+            arguments += ["--delete", "KEK", "--delete", "db"]
+        }
+
+        files[path("pk.pem")] = try certificate(keys.platformKey, variable: "PK", index: 0)
+        arguments += ["--set-pk", keys.ownerGUID, path("pk.pem")]
+        for (index, pem) in keys.keyExchangeKeys.enumerated() {
+            files[path("kek-\(index).pem")] = try certificate(pem, variable: "KEK", index: index)
+            arguments += ["--add-kek", keys.ownerGUID, path("kek-\(index).pem")]
+        }
+        for (index, pem) in keys.signatureDatabase.enumerated() {
+            files[path("db-\(index).pem")] = try certificate(pem, variable: "db", index: index)
+            arguments += ["--add-db", keys.ownerGUID, path("db-\(index).pem")]
+        }
+        if !keys.forbiddenSignatures.isEmpty {
+            files[path("dbx.esl")] = try signatureList(forbidden: keys.forbiddenSignatures, owner: keys.ownerGUID)
+            arguments += ["--set-dbx", path("dbx.esl")]
+        }
+
+        arguments.append("--secure-boot")
+        return Plan(files: files, arguments: arguments)
+    }
+
+    /// The dbx entries as EFI signature lists: one list for every SHA-256
+    /// digest, then one per certificate (X.509 entries differ in size, and a
+    /// list holds entries of one size).
+    public static func signatureList(forbidden: [String], owner: String) throws -> Data {
+        var digests: [Data] = []
+        var certificates: [Data] = []
+        for (index, entry) in forbidden.enumerated() {
+            if let digest = SecureBootKeys.sha256Digest(fromHex: entry) {
+                digests.append(digest)
+            } else if let der = SecureBootKeys.certificateDER(fromPEM: entry) {
+                certificates.append(der)
+            } else {
+                throw PlanError.invalidForbiddenEntry(index: index)
+            }
+        }
+
+        var data = Data()
+        if !digests.isEmpty {
+            data.append(list(type: sha256SignatureType, owner: owner, entries: digests))
+        }
+        for der in certificates {
+            data.append(list(type: x509SignatureType, owner: owner, entries: [der]))
+        }
+        return data
+    }
+
+    /// One `EFI_SIGNATURE_LIST`: type GUID, list size, header size (always
+    /// zero here), entry size, then each entry as owner GUID plus data.
+    static func list(type: String, owner: String, entries: [Data]) -> Data {
+        let entrySize = 16 + (entries.first?.count ?? 0)
+        let listSize = 16 + 4 + 4 + 4 + entrySize * entries.count
+        var data = guidBytes(type)
+        data.append(littleEndian: UInt32(listSize))
+        data.append(littleEndian: UInt32(0))
+        data.append(littleEndian: UInt32(entrySize))
+        for entry in entries {
+            data.append(guidBytes(owner))
+            data.append(entry)
+        }
+        return data
+    }
+
+    /// A GUID in EFI byte order: the first three fields little-endian, the
+    /// last eight bytes as written. An unparseable GUID encodes as zeros.
+    static func guidBytes(_ guid: String) -> Data {
+        guard let uuid = UUID(uuidString: guid) else { return Data(count: 16) }
+        let b = uuid.uuid
+        return Data([
+            b.3, b.2, b.1, b.0, b.5, b.4, b.7, b.6,
+            b.8, b.9, b.10, b.11, b.12, b.13, b.14, b.15,
+        ])
+    }
+}
+
+extension Data {
+    fileprivate mutating func append(littleEndian value: UInt32) {
+        Swift.withUnsafeBytes(of: value.littleEndian) { append(contentsOf: $0) }
+    }
+}
@@ -54,6 +54,12 @@ public enum StageBudget {
     // the caller thaws unconditionally once a freeze was attempted, even if
     // that freeze's reply arrived after the budget.
     public static let guestFreezeSeconds = 30
+    // A block mirror of an attached volume onto another agent's NBD export
+    // (volume migration). The guest keeps writing throughout, so the copy
+    // runs at whatever rate the storage network allows for the whole disk;
+    // this only stops a mirror that can never converge from holding the VM's
+    // monitor forever.
+    public static let volumeMirrorSeconds = 6 * 3600
 
     /// What a budget does with an operation that is still running when the
     /// deadline passes. The right answer depends on whether the operation has
@@ -137,6 +137,29 @@ public protocol StorageBackend: Actor {
 
     /// Queries a volume's on-disk state.
     func volumeInfo(volumePath: String) async throws -> VolumeInfoResult
+
+    /// Hands the file holding a volume's bytes to `send` (the source side of
+    /// a volume migration). The backend may stage a copy for the duration of
+    /// the call; the volume itself is left untouched.
+    func exportVolume(
+        volumeId: String, volumePath: String, send: @Sendable (String) async throws -> Void
+    ) async throws
+
+    /// Adopts a migrated copy of a volume (the destination side): `receive`
+    /// fills a staging path the backend chooses, the backend checks the
+    /// bytes are a self-contained disk of `format`, and publishes them at
+    /// the volume's canonical path, replacing any earlier partial import.
+    func importVolume(
+        volumeId: String, format: DiskFormat, receive: @Sendable (String) async throws -> Void
+    ) async throws -> DiskAttachment
+
+    /// Hands a standalone copy of a stopped VM's boot disk to `send` (an
+    /// image build's capture): the overlay flattened onto the image beneath
+    /// it, as one qcow2 naming no backing file. The copy is staged for the
+    /// duration of the call; the VM's own disk is left untouched.
+    func exportBootDisk(
+        vmId: String, diskPath: String, send: @Sendable (String) async throws -> Void
+    ) async throws
 }
 
 // MARK: - Errors
@@ -147,6 +170,8 @@ public enum StorageBackendError: Error, LocalizedError, Sendable {
     case resizeFailed(String)
     case snapshotFailed(String)
     case cloneFailed(String)
+    case importFailed(String)
+    case exportFailed(String)
     case infoFailed(String)
     case volumeNotFound(String)
     case imageSourceUnavailable
@@ -168,6 +193,10 @@ public enum StorageBackendError: Error, LocalizedError, Sendable {
             return "Snapshot creation failed: \(reason)"
         case .cloneFailed(let reason):
             return "Volume clone failed: \(reason)"
+        case .importFailed(let reason):
+            return "Volume import failed: \(reason)"
+        case .exportFailed(let reason):
+            return "Disk export failed: \(reason)"
         case .infoFailed(let reason):
             return "Volume info query failed: \(reason)"
         case .volumeNotFound(let volumeId):
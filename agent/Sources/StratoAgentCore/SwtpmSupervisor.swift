@@ -18,6 +18,7 @@ import Darwin
 /// <vmStoragePath>/<vmId>/swtpm.sock  control channel QEMU's tpmdev connects to
 /// <vmStoragePath>/<vmId>/swtpm.pid   pid file, so teardown and re-adoption
 ///                                    can find a process this agent did not spawn
+/// <vmStoragePath>/<vmId>/tpm-encrypted  marker: the state is encrypted
 /// ```
 ///
 /// The state directory is durable on purpose: a TPM whose seeds change across a
@@ -35,12 +36,32 @@ import Darwin
 /// recovered mid-flight, because the guest's TPM sessions live in the process
 /// that died. Such a VM needs a stop/start; its state directory is intact, so
 /// nothing sealed to the TPM is lost.
+///
+/// ## Encryption at rest (wire v32)
+///
+/// The control plane mints each vTPM VM a state key, keeps it wrapped by its
+/// secrets encryption, and sends it in the VM's desired state. The agent
+/// writes it to `<keyDirectory>/<vmId>.key` — a runtime directory, not the VM
+/// directory, so the key never sits on the same disk as the state — and swtpm
+/// encrypts the state with it. Because the key is the VM's rather than the
+/// host's, the state directory opens on any agent the VM's desired state
+/// reaches. State written before the VM had a key is read as plaintext and
+/// encrypted on swtpm's next write.
+///
+/// Once swtpm has run with a key, the `tpm-encrypted` marker records that the
+/// state needs it. Starting such a VM without its key installed fails: swtpm
+/// would not read the state, and a TPM that comes up empty is what sealed
+/// guests must never see.
 public struct SwtpmSupervisor: Sendable {
     private let binaryPath: String
+    /// Where state keys are installed, or nil to run every swtpm without one
+    /// (an agent whose control plane predates wire v32).
+    private let keyDirectory: String?
     private let logger: Logger
 
-    public init(binaryPath: String, logger: Logger) {
+    public init(binaryPath: String, keyDirectory: String? = nil, logger: Logger) {
         self.binaryPath = binaryPath
+        self.keyDirectory = keyDirectory
         self.logger = logger
     }
 
@@ -66,11 +87,76 @@ public struct SwtpmSupervisor: Sendable {
         (vmDirectory as NSString).appendingPathComponent("swtpm.log")
     }
 
+    /// The key directory under the agent's runtime socket directory, which
+    /// is a tmpfs on Linux hosts: keys are gone after a host reboot and come
+    /// back with the first desired-state sync, before any VM starts.
+    public static func keyDirectory(runtimeDirectory: String) -> String {
+        (runtimeDirectory as NSString).appendingPathComponent("tpm-keys")
+    }
+
+    public static func keyFilePath(keyDirectory: String, vmId: String) -> String {
+        (keyDirectory as NSString).appendingPathComponent("\(vmId).key")
+    }
+
+    /// Present once the VM's state has been encrypted with its key.
+    public static func encryptedMarkerPath(vmDirectory: String) -> String {
+        (vmDirectory as NSString).appendingPathComponent("tpm-encrypted")
+    }
+
+    // MARK: - State keys
+
+    /// Installs `vmId`'s state key as sent by the control plane, readable by
+    /// the agent alone. Returns whether the file changed; an unchanged key is
+    /// not rewritten, so the per-sync install is cheap.
+    ///
+    /// A VM's key never changes once minted, so a differing key on disk only
+    /// means the directory was tampered with or the VM id was reused — the
+    /// control plane's copy wins either way.
+    @discardableResult
+    public static func installKey(_ hexKey: String, vmId: String, keyDirectory: String) throws -> Bool {
+        guard hexKey.count == 64, hexKey.allSatisfy(\.isHexDigit) else {
+            throw SwtpmError.invalidKey(vmId)
+        }
+        let path = keyFilePath(keyDirectory: keyDirectory, vmId: vmId)
+        if let existing = try? String(contentsOfFile: path, encoding: .utf8), existing == hexKey {
+            return false
+        }
+        try FileManager.default.createDirectory(
+            atPath: keyDirectory, withIntermediateDirectories: true,
+            attributes: [.posixPermissions: 0o700])
+        // Created 0600 before the key is written into it, so the key is never
+        // readable by anyone else, even briefly.
+        let staging = path + ".partial"
+        guard
+            FileManager.default.createFile(
+                atPath: staging, contents: Data(hexKey.utf8), attributes: [.posixPermissions: 0o600])
+        else {
+            throw SwtpmError.keyWriteFailed(path)
+        }
+        if FileManager.default.fileExists(atPath: path) {
+            _ = try FileManager.default.replaceItemAt(
+                URL(fileURLWithPath: path), withItemAt: URL(fileURLWithPath: staging))
+        } else {
+            try FileManager.default.moveItem(atPath: staging, toPath: path)
+        }
+        return true
+    }
+
+    /// Removes `vmId`'s state key. Only deleting the VM does this: a key
+    /// missing from one sync (the control plane could not unwrap it) must not
+    /// lock the VM out of state already encrypted with it.
+    public static func removeKey(vmId: String, keyDirectory: String) {
+        try? FileManager.default.removeItem(atPath: keyFilePath(keyDirectory: keyDirectory, vmId: vmId))
+    }
+
     // MARK: - Lifecycle
 
     public enum SwtpmError: Error, CustomStringConvertible, Sendable {
         case launchFailed(String)
         case socketNeverAppeared(String)
+        case invalidKey(String)
+        case keyWriteFailed(String)
+        case keyMissing(String)
 
         public var description: String {
             switch self {
@@ -78,6 +164,12 @@ public struct SwtpmSupervisor: Sendable {
                 return "failed to start swtpm: \(detail)"
             case .socketNeverAppeared(let path):
                 return "swtpm started but never created its control socket at \(path)"
+            case .invalidKey(let vmId):
+                return "TPM state key for VM \(vmId) is not 32 hex-encoded bytes"
+            case .keyWriteFailed(let path):
+                return "failed to write TPM state key to \(path)"
+            case .keyMissing(let vmId):
+                return "TPM state of VM \(vmId) is encrypted but its key is not installed on this host"
             }
         }
     }
@@ -106,13 +198,32 @@ public struct SwtpmSupervisor: Sendable {
         // A socket left by a dead process would let QEMU connect to nothing.
         try? FileManager.default.removeItem(atPath: socketPath)
 
-        let arguments = Self.arguments(vmDirectory: vmDirectory)
+        // Without an installed key the state stays in plaintext, as it did
+        // before wire v32 — unless it was encrypted already, when starting
+        // without the key would hand the guest a TPM that can't read its own
+        // state.
+        let keyFile = keyDirectory
+            .map { Self.keyFilePath(keyDirectory: $0, vmId: vmId) }
+            .flatMap { FileManager.default.fileExists(atPath: $0) ? $0 : nil }
+        let markerPath = Self.encryptedMarkerPath(vmDirectory: vmDirectory)
+        if keyFile == nil, FileManager.default.fileExists(atPath: markerPath) {
+            throw SwtpmError.keyMissing(vmId)
+        }
+        // Recorded before swtpm starts: it encrypts on its first write, and a
+        // marker ahead of the state only ever asks for a key that exists.
+        if keyFile != nil, !FileManager.default.fileExists(atPath: markerPath),
+            !FileManager.default.createFile(atPath: markerPath, contents: nil)
+        {
+            throw SwtpmError.launchFailed("could not record that the TPM state of VM \(vmId) is encrypted")
+        }
+        let arguments = Self.arguments(vmDirectory: vmDirectory, keyFile: keyFile)
         logger.info(
             "Starting swtpm",
             metadata: [
                 "vmId": .string(vmId),
                 "socket": .string(socketPath),
                 "stateDir": .string(stateDirectory),
+                "stateEncrypted": .stringConvertible(keyFile != nil),
             ])
 
         let result: ProcessResult
@@ -138,18 +249,25 @@ public struct SwtpmSupervisor: Sendable {
         return socketPath
     }
 
-    /// The swtpm invocation for a VM. Split out so tests can assert the
+    /// The swtpm invocation for a VM, encrypting its state with the key in
+    /// `keyFile` when there is one. Split out so tests can assert the
     /// argument shape without a swtpm binary on the host.
-    public static func arguments(vmDirectory: String) -> [String] {
-        [
+    public static func arguments(vmDirectory: String, keyFile: String? = nil) -> [String] {
+        var arguments = [
             "socket",
             "--tpm2",
             "--tpmstate", "dir=\(stateDirectory(vmDirectory: vmDirectory))",
             "--ctrl", "type=unixio,path=\(socketPath(vmDirectory: vmDirectory))",
             "--pid", "file=\(pidFilePath(vmDirectory: vmDirectory))",
             "--log", "file=\(logFilePath(vmDirectory: vmDirectory)),level=1",
-            "--daemon",
         ]
+        if let keyFile {
+            // `remove=false` keeps the file for the next start: a respawn
+            // after the guest powers off runs a fresh swtpm that needs it.
+            arguments += ["--key", "file=\(keyFile),format=hex,mode=aes-256-cbc,remove=false"]
+        }
+        arguments.append("--daemon")
+        return arguments
     }
 
     /// Stops the VM's swtpm and removes its socket and pid file. The state
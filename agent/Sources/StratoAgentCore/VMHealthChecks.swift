@@ -0,0 +1,135 @@
+import AsyncHTTPClient
+import Foundation
+import NIOCore
+import NIOPosix
+import StratoShared
+
+/// Per-VM application health state (wire v31): when each VM's check is next
+/// due, and what its results so far add up to. Pure bookkeeping — the agent
+/// runs the probes and feeds the outcomes in — so the thresholds and grace
+/// period are testable without a VM.
+public struct VMHealthTracker: Sendable {
+    private struct Entry: Sendable {
+        let check: VMHealthCheck
+        let graceEnds: Date
+        var nextDue: Date
+        var consecutiveFailures = 0
+        var status: VMHealthStatus?
+        var passedOnce = false
+        var observation: VMHealthObservation?
+    }
+
+    private var entries: [String: Entry] = [:]
+
+    public init() {}
+
+    /// Sets the VMs to check: the running VMs that have a health check.
+    /// A VM dropping out (stopped, deleted, check removed) forgets its
+    /// history, so it starts over — grace period included — the next time
+    /// it runs. A changed check starts over too.
+    public mutating func configure(_ checks: [String: VMHealthCheck], now: Date) {
+        entries = checks.reduce(into: [:]) { result, item in
+            if let existing = entries[item.key], existing.check == item.value {
+                result[item.key] = existing
+            } else {
+                result[item.key] = Entry(
+                    check: item.value,
+                    graceEnds: now.addingTimeInterval(TimeInterval(item.value.gracePeriodSeconds)),
+                    nextDue: now)
+            }
+        }
+    }
+
+    /// The VMs whose next probe is due, with their checks.
+    public func due(at now: Date) -> [(vmId: String, check: VMHealthCheck)] {
+        entries.filter { $0.value.nextDue <= now }.map { ($0.key, $0.value.check) }
+    }
+
+    /// Records one probe's outcome — `failure` is nil on a pass — and
+    /// schedules the next. Returns whether the VM's status changed, which is
+    /// when the agent reports promptly instead of waiting for a heartbeat.
+    @discardableResult
+    public mutating func record(vmId: String, failure: String?, at now: Date) -> Bool {
+        guard var entry = entries[vmId] else { return false }
+        let previous = entry.status
+        entry.nextDue = now.addingTimeInterval(TimeInterval(entry.check.intervalSeconds))
+        if let failure {
+            // Before the application has ever answered, failures inside the
+            // grace period are the guest still booting.
+            if entry.passedOnce || now >= entry.graceEnds {
+                entry.consecutiveFailures += 1
+                if entry.consecutiveFailures >= entry.check.failureThreshold {
+                    entry.status = .unhealthy
+                }
+            }
+            if let status = entry.status {
+                entry.observation = VMHealthObservation(
+                    status: status, consecutiveFailures: entry.consecutiveFailures, checkedAt: now,
+                    message: failure)
+            }
+        } else {
+            entry.passedOnce = true
+            entry.consecutiveFailures = 0
+            entry.status = .healthy
+            entry.observation = VMHealthObservation(status: .healthy, consecutiveFailures: 0, checkedAt: now)
+        }
+        entries[vmId] = entry
+        return entry.status != previous
+    }
+
+    /// What to report for the VM: nil until its check has decided.
+    public func observation(for vmId: String) -> VMHealthObservation? {
+        entries[vmId]?.observation
+    }
+}
+
+/// Runs the network kinds of health check from the host. `exec` checks go
+/// through the hypervisor's guest agent instead, so they are the agent's.
+public enum VMHealthProber {
+    /// The address a VM's TCP and HTTP checks dial: its first NIC's
+    /// allocated IPv4 address, else its IPv6 one. Nil for a VM whose
+    /// addresses come from DHCP outside IPAM (or that has none), which can
+    /// only use `exec` checks.
+    public static func targetAddress(of spec: VMSpec) -> String? {
+        guard let nic = spec.networks.first else { return nil }
+        return nic.ipAddress ?? nic.ipv6Address
+    }
+
+    /// Probes `check` against `address`. Returns nil on a pass, otherwise
+    /// why it failed.
+    public static func probe(_ check: VMHealthCheck, address: String) async -> String? {
+        guard check.kind != .exec else { return "exec checks run through the guest agent" }
+        guard let port = check.port else { return "\(check.kind.rawValue) check has no port" }
+        if check.kind == .tcp {
+            return await tcp(host: address, port: port, timeoutSeconds: check.timeoutSeconds)
+        }
+        return await http(host: address, port: port, path: check.path ?? "/", timeoutSeconds: check.timeoutSeconds)
+    }
+
+    static func tcp(host: String, port: Int, timeoutSeconds: Int) async -> String? {
+        let bootstrap = ClientBootstrap(group: MultiThreadedEventLoopGroup.singleton)
+            .connectTimeout(.seconds(Int64(timeoutSeconds)))
+        do {
+            let channel = try await bootstrap.connect(host: host, port: port).get()
+            try? await channel.close().get()
+            return nil
+        } catch {
+            return "TCP connect to \(host):\(port) failed: \(error)"
+        }
+    }
+
+    static func http(host: String, port: Int, path: String, timeoutSeconds: Int) async -> String? {
+        let authority = host.contains(":") ? "[\(host)]:\(port)" : "\(host):\(port)"
+        let url = "http://\(authority)\(path.hasPrefix("/") ? path : "/" + path)"
+        do {
+            let response = try await HTTPClient.shared.execute(
+                HTTPClientRequest(url: url), timeout: .seconds(Int64(timeoutSeconds)))
+            guard (200..<400).contains(response.status.code) else {
+                return "GET \(url) answered \(response.status.code)"
+            }
+            return nil
+        } catch {
+            return "GET \(url) failed: \(error)"
+        }
+    }
+}
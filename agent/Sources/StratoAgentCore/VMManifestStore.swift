@@ -20,12 +20,16 @@ public struct VMManifestEntry: Codable, Sendable {
     /// The sandbox's own spec (present iff `kind == .sandbox`), kept so the
     /// sandbox runtime can re-adopt the orphan after a restart.
     public let sandboxSpec: SandboxSpec?
+    /// The `DesiredVMState.replacementCount` the VM was last created at, so
+    /// a higher one in a sync plans a replacement (wire v31) exactly once.
+    public let replacementCount: Int64
 
-    public init(hypervisorType: HypervisorType, spec: VMSpec) {
+    public init(hypervisorType: HypervisorType, spec: VMSpec, replacementCount: Int64 = 0) {
         self.kind = .vm
         self.hypervisorType = hypervisorType
         self.spec = spec
         self.sandboxSpec = nil
+        self.replacementCount = replacementCount
     }
 
     /// A sandbox entry. Sandboxes boot through Firecracker only, so the
@@ -36,10 +40,12 @@ public struct VMManifestEntry: Codable, Sendable {
         self.spec = VMSpec(
             cpus: sandboxSpec.cpus, memoryBytes: sandboxSpec.memoryBytes, boot: .disk(firmware: nil))
         self.sandboxSpec = sandboxSpec
+        self.replacementCount = 0
     }
 
     // Custom decode so `kind` tolerates absence: entries persisted by a
-    // pre-sandbox agent decode as VMs rather than throwing. `encode(to:)`
+    // pre-sandbox agent decode as VMs rather than throwing (and likewise a
+    // missing `replacementCount` as 0). `encode(to:)`
     // stays synthesized.
     public init(from decoder: any Decoder) throws {
         let c = try decoder.container(keyedBy: CodingKeys.self)
@@ -47,6 +53,7 @@ public struct VMManifestEntry: Codable, Sendable {
         hypervisorType = try c.decode(HypervisorType.self, forKey: .hypervisorType)
         spec = try c.decode(VMSpec.self, forKey: .spec)
         sandboxSpec = try c.decodeIfPresent(SandboxSpec.self, forKey: .sandboxSpec)
+        replacementCount = try c.decodeIfPresent(Int64.self, forKey: .replacementCount) ?? 0
     }
 }
 
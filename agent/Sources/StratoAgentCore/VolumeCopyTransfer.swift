@@ -0,0 +1,104 @@
+import Foundation
+import StratoShared
+
+/// Streams a volume's disk file between agents through the control plane's
+/// volume-migration data route, for the copy phase of a detached-volume
+/// migration.
+///
+/// The same model as `SnapshotArtifactTransfer`: paths are
+/// control-plane-relative and resolve against the base URL the agent already
+/// dials, the bytes move through the injected mTLS transport, and the control
+/// plane — not the source agent — records the size and SHA-256 the
+/// destination verifies against. The difference is who publishes: a verified
+/// download is handed to `StorageBackend.importVolume`, which owns the
+/// volume layout, so this type only fills the staging path it is given and
+/// removes it again when verification fails.
+public struct VolumeCopyTransfer: Sendable {
+    public enum TransferError: Error, LocalizedError {
+        case invalidURL(String)
+        case fileNotFound(String)
+        case uploadFailed(volumeId: String, reason: String)
+        case downloadFailed(volumeId: String, reason: String)
+        case sizeMismatch(volumeId: String, expected: Int64, actual: Int64)
+        case checksumMismatch(volumeId: String, expected: String, actual: String)
+
+        public var errorDescription: String? {
+            switch self {
+            case .invalidURL(let url):
+                return "invalid transfer URL: \(url)"
+            case .fileNotFound(let path):
+                return "volume file not found: \(path)"
+            case .uploadFailed(let volumeId, let reason):
+                return "uploading volume \(volumeId) failed: \(reason)"
+            case .downloadFailed(let volumeId, let reason):
+                return "downloading volume \(volumeId) failed: \(reason)"
+            case .sizeMismatch(let volumeId, let expected, let actual):
+                return "volume \(volumeId) size mismatch: expected \(expected) bytes, got \(actual)"
+            case .checksumMismatch(let volumeId, let expected, let actual):
+                return "volume \(volumeId) checksum mismatch: expected \(expected), got \(actual)"
+            }
+        }
+    }
+
+    let controlPlaneBaseURL: String
+    let downloadFile: SnapshotArtifactTransfer.FileDownloader
+    let uploadFile: SnapshotArtifactTransfer.FileUploader
+
+    public init(
+        controlPlaneBaseURL: String,
+        downloadFile: @escaping SnapshotArtifactTransfer.FileDownloader,
+        uploadFile: @escaping SnapshotArtifactTransfer.FileUploader
+    ) {
+        self.controlPlaneBaseURL = controlPlaneBaseURL
+        self.downloadFile = downloadFile
+        self.uploadFile = uploadFile
+    }
+
+    /// Uploads the volume's disk file with one streaming PUT.
+    public func upload(volumeId: String, filePath: String, to uploadURL: String) async throws {
+        guard FileManager.default.fileExists(atPath: filePath) else {
+            throw TransferError.fileNotFound(filePath)
+        }
+        let url = try resolve(uploadURL)
+        do {
+            try await uploadFile(url, filePath)
+        } catch {
+            throw TransferError.uploadFailed(volumeId: volumeId, reason: "\(error)")
+        }
+    }
+
+    /// Downloads the exported disk described by `message` to `stagingPath`
+    /// and verifies it. On any failure the staging file is removed, so the
+    /// caller never sees unverified bytes.
+    public func download(_ message: VolumeImportMessage, to stagingPath: String) async throws {
+        let url = try resolve(message.downloadURL)
+        do {
+            do {
+                try await downloadFile(url, stagingPath)
+            } catch {
+                throw TransferError.downloadFailed(volumeId: message.volumeId, reason: "\(error)")
+            }
+            let actualSize =
+                (try? FileManager.default.attributesOfItem(atPath: stagingPath)[.size] as? Int64 ?? 0) ?? 0
+            guard actualSize == message.sizeBytes else {
+                throw TransferError.sizeMismatch(
+                    volumeId: message.volumeId, expected: message.sizeBytes, actual: actualSize)
+            }
+            let actualChecksum = try SnapshotArtifactTransfer.sha256Hex(of: stagingPath)
+            guard actualChecksum.lowercased() == message.sha256.lowercased() else {
+                throw TransferError.checksumMismatch(
+                    volumeId: message.volumeId, expected: message.sha256, actual: actualChecksum)
+            }
+        } catch {
+            try? FileManager.default.removeItem(atPath: stagingPath)
+            throw error
+        }
+    }
+
+    func resolve(_ relativePath: String) throws -> URL {
+        guard let url = URL(string: controlPlaneBaseURL + relativePath) else {
+            throw TransferError.invalidURL(controlPlaneBaseURL + relativePath)
+        }
+        return url
+    }
+}
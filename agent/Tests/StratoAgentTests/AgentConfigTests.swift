@@ -87,6 +87,100 @@ struct AgentConfigTests {
         }
     }
 
+    @Test("volume_storage_encrypted loads as the operator's attestation")
+    func loadVolumeStorageEncrypted() throws {
+        try withTempDirectory { tempDirectory in
+            let tomlContent = """
+                control_plane_url = "ws://localhost:8080/agent/ws"
+                volume_storage_encrypted = true
+                """
+            let configPath = tempDirectory.appendingPathComponent("config.toml").path
+            try tomlContent.write(toFile: configPath, atomically: true, encoding: .utf8)
+
+            let config = try AgentConfig.load(from: configPath)
+
+            #expect(config.volumeStorageEncrypted == true)
+        }
+    }
+
+    @Test("NBD export settings load, and a half-set port range is rejected")
+    func loadVolumeNBDSettings() throws {
+        try withTempDirectory { tempDirectory in
+            let configPath = tempDirectory.appendingPathComponent("config.toml").path
+            try """
+                control_plane_url = "ws://localhost:8080/agent/ws"
+                volume_nbd_address = "10.0.10.5"
+                volume_nbd_port_min = 20000
+                volume_nbd_port_max = 20010
+                """.write(toFile: configPath, atomically: true, encoding: .utf8)
+
+            let config = try AgentConfig.load(from: configPath)
+            #expect(config.volumeNBDAddress == "10.0.10.5")
+            #expect(config.volumeNBDPortMin == 20000)
+            #expect(config.volumeNBDPortMax == 20010)
+
+            try """
+                control_plane_url = "ws://localhost:8080/agent/ws"
+                volume_nbd_address = "10.0.10.5"
+                volume_nbd_port_min = 20000
+                """.write(toFile: configPath, atomically: true, encoding: .utf8)
+            #expect(throws: AgentConfigError.self) {
+                _ = try AgentConfig.load(from: configPath)
+            }
+        }
+    }
+
+    @Test("The file-share directory loads, and is nil when unset")
+    func loadFileShareDirectory() throws {
+        try withTempDirectory { tempDirectory in
+            let configPath = tempDirectory.appendingPathComponent("config.toml").path
+            try """
+                control_plane_url = "ws://localhost:8080/agent/ws"
+                file_share_dir = "/srv/strato/shares"
+                """.write(toFile: configPath, atomically: true, encoding: .utf8)
+            #expect(try AgentConfig.load(from: configPath).fileShareDir == "/srv/strato/shares")
+
+            try """
+                control_plane_url = "ws://localhost:8080/agent/ws"
+                """.write(toFile: configPath, atomically: true, encoding: .utf8)
+            #expect(try AgentConfig.load(from: configPath).fileShareDir == nil)
+        }
+    }
+
+    @Test("The object gateway's directory and listener load together")
+    func loadObjectGateway() throws {
+        try withTempDirectory { tempDirectory in
+            let configPath = tempDirectory.appendingPathComponent("config.toml").path
+            try """
+                control_plane_url = "ws://localhost:8080/agent/ws"
+                object_gateway_dir = "/srv/strato/s3"
+                object_gateway_listen = "0.0.0.0:9000"
+                object_gateway_endpoint = "https://s3.hv1.example.com"
+                """.write(toFile: configPath, atomically: true, encoding: .utf8)
+            let config = try AgentConfig.load(from: configPath)
+            #expect(config.objectGatewayDir == "/srv/strato/s3")
+            #expect(config.objectGatewayListen == "0.0.0.0:9000")
+            #expect(config.objectGatewayEndpoint == "https://s3.hv1.example.com")
+
+            try """
+                control_plane_url = "ws://localhost:8080/agent/ws"
+                object_gateway_dir = "/srv/strato/s3"
+                """.write(toFile: configPath, atomically: true, encoding: .utf8)
+            #expect(throws: AgentConfigError.self) {
+                _ = try AgentConfig.load(from: configPath)
+            }
+
+            try """
+                control_plane_url = "ws://localhost:8080/agent/ws"
+                object_gateway_dir = "/srv/strato/s3"
+                object_gateway_listen = "9000"
+                """.write(toFile: configPath, atomically: true, encoding: .utf8)
+            #expect(throws: AgentConfigError.self) {
+                _ = try AgentConfig.load(from: configPath)
+            }
+        }
+    }
+
     // MARK: - Warm start (issue #426)
 
     @Test("Load warm-start settings")
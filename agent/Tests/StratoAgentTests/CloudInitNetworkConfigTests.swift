@@ -219,6 +219,31 @@ struct CloudInitNetworkConfigTests {
         #expect(yaml?.contains("ipv6-address-generation") == false)
     }
 
+    @Test("IPv6-only NICs render no v4 config, static or DHCP")
+    func ipv6OnlyNIC() {
+        let nic = { (dhcp: Bool) in
+            ResolvedNetworkAttachment(
+                network: "v6only",
+                attachment: .tap(interface: "tap0"),
+                macAddress: "52:54:00:aa:bb:cc",
+                ip6Address: "fd12:3456:789b::100",
+                prefixLength6: 64,
+                gateway6: "fd12:3456:789b::1",
+                dhcpEnabled: dhcp,
+                dnsServers: ["2001:4860:4860::6464"]
+            )
+        }
+        let staticYAML = CloudInitProvisioner.networkConfigYAML(for: [nic(false)])
+        #expect(staticYAML?.contains("addresses:\n      - fd12:3456:789b::100/64") == true)
+        #expect(staticYAML?.contains("gateway6: fd12:3456:789b::1") == true)
+        #expect(staticYAML?.contains("gateway4") == false)
+        #expect(staticYAML?.contains("addresses: [2001:4860:4860::6464]") == true)
+
+        let dhcpYAML = CloudInitProvisioner.networkConfigYAML(for: [nic(true)])
+        #expect(dhcpYAML?.contains("dhcp4: false") == true)
+        #expect(dhcpYAML?.contains("dhcp6: true") == true)
+    }
+
     @Test("multiple NICs render as separate entries with stable names")
     func multipleNICs() {
         let attachments = [
@@ -0,0 +1,243 @@
+import Foundation
+import Logging
+import StratoShared
+import Testing
+
+@testable import StratoAgentCore
+
+/// Managed NFS file shares. Serving needs mkfs, loop mounts and ganesha, so
+/// what is covered here is what must hold without them: the command
+/// sequence, the export configuration, and the generation/error bookkeeping
+/// the observed report carries. The fake runner never writes a pid file, so
+/// no test hands the manager a live process to signal.
+@Suite("FileShareManager")
+struct FileShareManagerTests {
+
+    /// Records every command and keeps a table of mount points so
+    /// `mountpoint -q` answers consistently with earlier `mount`s.
+    final class CommandRecorder: @unchecked Sendable {
+        private let lock = NSLock()
+        private var calls: [[String]] = []
+        private var mounted: Set<String> = []
+
+        var commands: [[String]] {
+            lock.withLock { calls }
+        }
+
+        func runner() -> FileShareManager.Runner {
+            { executable, arguments in
+                let status: Int32 = self.lock.withLock {
+                    self.calls.append([executable] + arguments)
+                    switch executable {
+                    case "mountpoint":
+                        return self.mounted.contains(arguments.last ?? "") ? 0 : 1
+                    case "mount":
+                        self.mounted.insert(arguments.last ?? "")
+                    case "umount":
+                        self.mounted.remove(arguments.last ?? "")
+                    default:
+                        break
+                    }
+                    return 0
+                }
+                let output = executable == "findmnt" ? "/dev/loop7\n" : ""
+                return ProcessResult(terminationStatus: status, standardOutput: Data(output.utf8), standardError: Data())
+            }
+        }
+    }
+
+    /// Hands out namespaces; refuses with a pending dependency when asked.
+    final class FakeNetworking: FileShareNetworking, @unchecked Sendable {
+        private let lock = NSLock()
+        private var removedIDs: [UUID] = []
+        var switchMissing = false
+
+        var removed: [UUID] {
+            lock.withLock { removedIDs }
+        }
+
+        func ensureServerPort(shareId: UUID, endpoint: NetworkSpec) async throws -> String {
+            if lock.withLock({ switchMissing }) {
+                throw DependencyPendingError("logical switch does not exist yet")
+            }
+            return OVNNaming.fileShareNamespace(shareId: shareId)
+        }
+
+        func removeServerPort(shareId: UUID) async {
+            lock.withLock { removedIDs.append(shareId) }
+        }
+    }
+
+    private func makeTempDirectory() throws -> String {
+        let path = NSTemporaryDirectory() + "file-share-tests-" + UUID().uuidString
+        try FileManager.default.createDirectory(atPath: path, withIntermediateDirectories: true)
+        return path
+    }
+
+    private func makeShare(
+        _ shareId: UUID, generation: Int64 = 1, size: Int64 = 1 << 20,
+        status: DesiredFileShareStatus = .present, clients: [String] = ["10.20.0.10"], snapshots: [UUID] = []
+    ) -> DesiredFileShareState {
+        DesiredFileShareState(
+            shareId: shareId,
+            desiredStatus: status,
+            generation: generation,
+            sizeBytes: size,
+            endpoint: NetworkSpec(
+                network: "team-net", networkId: UUID(), macAddress: "52:54:00:12:34:56",
+                ipAddress: "10.20.0.9", netmask: "255.255.255.0", gateway: "10.20.0.1"),
+            allowedClients: clients,
+            snapshots: snapshots
+        )
+    }
+
+    @Test("The config binds the share's address and admits only the listed clients")
+    func configShape() {
+        let shareId = UUID()
+        let snapshotId = UUID()
+        let config = FileShareManager.ganeshaConfig(
+            shareId: shareId,
+            serverAddress: "10.20.0.9",
+            dataPath: "/srv/shares/s/data",
+            snapshots: [(snapshotId, "/srv/shares/s/snapshots/x")],
+            allowedClients: ["10.20.0.10", "10.20.0.11"],
+            stateDirectory: "/srv/shares/s"
+        )
+        #expect(config.contains("Bind_addr = 10.20.0.9;"))
+        #expect(config.contains("Pseudo = \"\(FileShareExport.path(shareId: shareId))\";"))
+        #expect(
+            config.contains(
+                "Pseudo = \"\(FileShareExport.snapshotPath(shareId: shareId, snapshotId: snapshotId))\";"))
+        #expect(config.contains("Clients = 10.20.0.10, 10.20.0.11;"))
+        #expect(config.contains("Access_Type = RW;"))
+        #expect(config.contains("Access_Type = RO;"))
+
+        // No VM on the network yet: the export exists but admits nobody.
+        let closed = FileShareManager.ganeshaConfig(
+            shareId: shareId, serverAddress: "10.20.0.9", dataPath: "/d", snapshots: [], allowedClients: [],
+            stateDirectory: "/s")
+        #expect(!closed.contains("CLIENT"))
+    }
+
+    @Test("A new share is allocated, formatted, mounted and served from its namespace")
+    func createShare() async throws {
+        let directory = try makeTempDirectory()
+        defer { try? FileManager.default.removeItem(atPath: directory) }
+        let recorder = CommandRecorder()
+        let manager = FileShareManager(
+            root: directory, network: FakeNetworking(), logger: Logger(label: "test"), run: recorder.runner())
+        let shareId = UUID()
+
+        await manager.submit([makeShare(shareId, generation: 3)])
+
+        let image = await manager.imagePath(for: shareId)
+        #expect(FileShareManager.fileSize(at: image) == 1 << 20)
+        let executables = recorder.commands.map { $0[0] }
+        #expect(executables.contains("mkfs.ext4"))
+        #expect(recorder.commands.contains { $0 == ["mount", "-o", "loop", image, "\(directory)/\(shareId.uuidString.lowercased())/data"] })
+        let launch = try #require(recorder.commands.first { $0.contains("ganesha.nfsd") })
+        #expect(Array(launch.prefix(4)) == ["ip", "netns", "exec", OVNNaming.fileShareNamespace(shareId: shareId)])
+
+        let observed = try #require(await manager.observedStates().first)
+        #expect(observed.shareId == shareId)
+        #expect(observed.observedGeneration == 3)
+        #expect(observed.sizeBytes == 1 << 20)
+        #expect(observed.lastError == nil)
+        #expect(await manager.hostedShareIDs == [shareId])
+    }
+
+    @Test("Growing resizes the mounted filesystem; shrinking fails the generation")
+    func resize() async throws {
+        let directory = try makeTempDirectory()
+        defer { try? FileManager.default.removeItem(atPath: directory) }
+        let recorder = CommandRecorder()
+        let manager = FileShareManager(
+            root: directory, network: FakeNetworking(), logger: Logger(label: "test"), run: recorder.runner())
+        let shareId = UUID()
+
+        await manager.submit([makeShare(shareId, generation: 1, size: 1 << 20)])
+        await manager.submit([makeShare(shareId, generation: 2, size: 2 << 20)])
+        #expect(FileShareManager.fileSize(at: await manager.imagePath(for: shareId)) == 2 << 20)
+        #expect(recorder.commands.contains(["losetup", "-c", "/dev/loop7"]))
+        #expect(recorder.commands.contains(["resize2fs", "/dev/loop7"]))
+
+        await manager.submit([makeShare(shareId, generation: 3, size: 1 << 20)])
+        let observed = try #require(await manager.observedStates().first)
+        #expect(observed.status == .error)
+        #expect(observed.failedGeneration == 3)
+        #expect(observed.observedGeneration == 2)
+        #expect(observed.lastError?.contains("shrink") == true)
+    }
+
+    @Test("A network not realized yet is progress, not a failure")
+    func waitingOnNetwork() async throws {
+        let directory = try makeTempDirectory()
+        defer { try? FileManager.default.removeItem(atPath: directory) }
+        let network = FakeNetworking()
+        network.switchMissing = true
+        let manager = FileShareManager(
+            root: directory, network: network, logger: Logger(label: "test"), run: CommandRecorder().runner())
+        let shareId = UUID()
+
+        await manager.submit([makeShare(shareId)])
+        let observed = try #require(await manager.observedStates().first)
+        #expect(observed.status == .provisioning)
+        #expect(observed.lastError == nil)
+        #expect(observed.convergencePhase != nil)
+        #expect(observed.observedGeneration == 0)
+    }
+
+    @Test("A share dropped from the list, or desired absent, is torn down and forgotten")
+    func teardown() async throws {
+        let directory = try makeTempDirectory()
+        defer { try? FileManager.default.removeItem(atPath: directory) }
+        let network = FakeNetworking()
+        let recorder = CommandRecorder()
+        let manager = FileShareManager(
+            root: directory, network: network, logger: Logger(label: "test"), run: recorder.runner())
+        let kept = UUID()
+        let removed = UUID()
+
+        await manager.submit([makeShare(kept), makeShare(removed)])
+        await manager.submit([makeShare(kept), makeShare(removed, generation: 2, status: .absent)])
+
+        #expect(await manager.hostedShareIDs == [kept])
+        #expect(network.removed == [removed])
+        #expect(!FileManager.default.fileExists(atPath: await manager.directory(for: removed)))
+        #expect(await manager.observedStates().map(\.shareId) == [kept])
+
+        // The table survives a restart without the removed share.
+        let reloaded = FileShareManager(
+            root: directory, network: network, logger: Logger(label: "test"), run: recorder.runner())
+        #expect(await reloaded.hostedShareIDs == [kept])
+    }
+
+    @Test("Snapshots are copied under a filesystem freeze and mounted read-only")
+    func snapshots() async throws {
+        let directory = try makeTempDirectory()
+        defer { try? FileManager.default.removeItem(atPath: directory) }
+        let recorder = CommandRecorder()
+        let manager = FileShareManager(
+            root: directory, network: FakeNetworking(), logger: Logger(label: "test"), run: recorder.runner())
+        let shareId = UUID()
+        let snapshotId = UUID()
+
+        await manager.submit([makeShare(shareId)])
+        // The fake `cp` writes nothing; stand in for the copy it would make.
+        let snapshotImage = await manager.snapshotImagePath(shareId: shareId, snapshotId: snapshotId)
+        try FileManager.default.createDirectory(
+            atPath: (snapshotImage as NSString).deletingLastPathComponent, withIntermediateDirectories: true)
+        FileManager.default.createFile(atPath: snapshotImage + ".partial", contents: Data())
+
+        await manager.submit([makeShare(shareId, generation: 2, snapshots: [snapshotId])])
+
+        let freeze = try #require(recorder.commands.firstIndex { $0.first == "fsfreeze" && $0[1] == "-f" })
+        let copy = try #require(recorder.commands.firstIndex { $0.first == "cp" })
+        let thaw = try #require(recorder.commands.firstIndex { $0.first == "fsfreeze" && $0[1] == "-u" })
+        #expect(freeze < copy && copy < thaw)
+        #expect(recorder.commands.contains { $0.first == "mount" && $0[2] == "loop,ro,noload" })
+
+        let observed = try #require(await manager.observedStates().first)
+        #expect(observed.snapshots.map(\.snapshotId) == [snapshotId])
+    }
+}
@@ -400,6 +400,60 @@ struct FileSystemStorageBackendTests {
         #expect(info.virtualSize == 555)
         #expect(!info.dirty)
     }
+
+    @Test func importVolumePublishesReceivedBytesAtCanonicalPath() async throws {
+        let root = try makeTempDir()
+        defer { try? FileManager.default.removeItem(atPath: root) }
+        let recorder = SubprocessRecorder()
+        await recorder.stub(subcommand: "info", result: imageInfoJSON(format: "qcow2"))
+        let backend = makeBackend(root: root, recorder: recorder)
+
+        let attachment = try await backend.importVolume(volumeId: "vol-1", format: .qcow2) { staging in
+            FileManager.default.createFile(atPath: staging, contents: Data("migrated".utf8))
+        }
+
+        #expect(attachment == DiskAttachment(path: "\(root)/vol-1/volume.qcow2", format: .qcow2))
+        #expect(FileManager.default.contents(atPath: attachment.path) == Data("migrated".utf8))
+        #expect(!FileManager.default.fileExists(atPath: attachment.path + ".import"))
+    }
+
+    @Test func importVolumeRefusesImageWithBackingFile() async throws {
+        let root = try makeTempDir()
+        defer { try? FileManager.default.removeItem(atPath: root) }
+        let recorder = SubprocessRecorder()
+        let json = """
+            {"filename": "img", "format": "qcow2", "virtual-size": 1024, "actual-size": 512,
+             "backing-filename": "/var/lib/strato/volumes/other/volume.qcow2"}
+            """
+        await recorder.stub(
+            subcommand: "info",
+            result: ProcessResult(terminationStatus: 0, standardOutput: Data(json.utf8), standardError: Data()))
+        let backend = makeBackend(root: root, recorder: recorder)
+
+        await #expect(throws: StorageBackendError.self) {
+            _ = try await backend.importVolume(volumeId: "vol-1", format: .qcow2) { staging in
+                FileManager.default.createFile(atPath: staging, contents: Data("migrated".utf8))
+            }
+        }
+        // Nothing published, nothing staged left behind.
+        #expect(!FileManager.default.fileExists(atPath: "\(root)/vol-1/volume.qcow2"))
+        #expect(!FileManager.default.fileExists(atPath: "\(root)/vol-1/volume.qcow2.import"))
+    }
+
+    @Test func importVolumeRefusesFormatMismatch() async throws {
+        let root = try makeTempDir()
+        defer { try? FileManager.default.removeItem(atPath: root) }
+        let recorder = SubprocessRecorder()
+        await recorder.stub(subcommand: "info", result: imageInfoJSON(format: "raw"))
+        let backend = makeBackend(root: root, recorder: recorder)
+
+        await #expect(throws: StorageBackendError.self) {
+            _ = try await backend.importVolume(volumeId: "vol-1", format: .qcow2) { staging in
+                FileManager.default.createFile(atPath: staging, contents: Data("migrated".utf8))
+            }
+        }
+        #expect(!FileManager.default.fileExists(atPath: "\(root)/vol-1/volume.qcow2"))
+    }
 }
 
 @Suite("DiskFormat")
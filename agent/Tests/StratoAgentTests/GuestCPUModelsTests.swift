@@ -0,0 +1,63 @@
+import Foundation
+import StratoShared
+import Testing
+
+@testable import StratoAgentCore
+
+/// Guest CPU models (wire v28): the host flags parse, the `host-model`
+/// baseline choice, and the `-cpu` value for each kind of model with and
+/// without an accelerator.
+@Suite("Guest CPU Models")
+struct GuestCPUModelsTests {
+
+    @Test("Flags come from the first processor block, on x86 and on ARM")
+    func parsesFlags() {
+        let x86 = """
+            processor\t: 0
+            vendor_id\t: GenuineIntel
+            flags\t\t: sse2 avx2 fpu avx2
+
+            processor\t: 1
+            flags\t\t: something else
+            """
+        #expect(GuestCPUModels.flags(cpuinfo: x86) == ["avx2", "fpu", "sse2"])
+
+        let arm = "processor\t: 0\nFeatures\t: fp asimd aes\nCPU implementer\t: 0x41\n"
+        #expect(GuestCPUModels.flags(cpuinfo: arm) == ["aes", "asimd", "fp"])
+        #expect(GuestCPUModels.flags(cpuinfo: "") == [])
+    }
+
+    @Test("host-model picks the newest usable baseline, the host vendor's line first")
+    func hostModelBaseline() {
+        let usable: Set<String> = ["Haswell", "Skylake-Server", "EPYC", "qemu64"]
+        #expect(GuestCPUModels.hostModel(usable: usable, vendor: "GenuineIntel") == "Skylake-Server")
+        #expect(GuestCPUModels.hostModel(usable: usable, vendor: "AuthenticAMD") == "EPYC")
+        #expect(GuestCPUModels.hostModel(usable: ["qemu64"], vendor: "GenuineIntel") == nil)
+    }
+
+    @Test("The -cpu value follows the model, and TCG never gets host")
+    func qemuArgument() {
+        let usable: Set<String> = ["Cascadelake-Server"]
+        func argument(_ model: GuestCPUModel?, accelerated: Bool = true, usable: Set<String> = usable) -> String {
+            GuestCPUModels.qemuCPUArgument(model: model, accelerated: accelerated, usable: usable, vendor: nil)
+        }
+
+        #expect(argument(nil) == "host")
+        #expect(argument(.hostPassthrough) == "host")
+        #expect(argument(.hostModel) == "Cascadelake-Server")
+        #expect(argument(.hostModel, usable: []) == "host")
+        #expect(argument(.named("Haswell")) == "Haswell")
+
+        #expect(argument(nil, accelerated: false) == "max")
+        #expect(argument(.hostPassthrough, accelerated: false) == "max")
+        #expect(argument(.hostModel, accelerated: false) == "max")
+        #expect(argument(.named("Haswell"), accelerated: false) == "Haswell")
+    }
+
+    @Test("The probe QEMU builds no machine and listens for QMP without waiting")
+    func probeArguments() {
+        let arguments = GuestCPUModels.probeArguments(qmpSocketPath: "/tmp/probe.sock")
+        #expect(arguments.starts(with: ["-machine", "none"]))
+        #expect(arguments.last == "unix:/tmp/probe.sock,server=on,wait=off")
+    }
+}
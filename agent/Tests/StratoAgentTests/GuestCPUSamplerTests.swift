@@ -0,0 +1,55 @@
+import Foundation
+import Testing
+
+@testable import StratoAgentCore
+
+/// vCPU utilization from `/proc/<tid>/stat`: the stat-line parse (including
+/// QEMU's `CPU 0/KVM` thread names), reading a set of threads, and the
+/// difference between two readings.
+@Suite("Guest CPU Sampler")
+struct GuestCPUSamplerTests {
+
+    private static func statLine(comm: String = "CPU 0/KVM", utime: UInt64, stime: UInt64) -> String {
+        "4101 (\(comm)) S 1 4100 4100 0 -1 138412096 1200 0 0 0 \(utime) \(stime) 0 0 20 0 4 0 1000 0 0"
+    }
+
+    @Test("utime and stime are counted from the last paren, whatever the thread name")
+    func parsesStatLine() {
+        #expect(GuestCPUSampler.ticks(statLine: Self.statLine(utime: 700, stime: 50)) == 750)
+        #expect(GuestCPUSampler.ticks(statLine: Self.statLine(comm: "odd) name", utime: 1, stime: 2)) == 3)
+        #expect(GuestCPUSampler.ticks(statLine: "4101 (CPU 0/KVM) S 1") == nil)
+    }
+
+    @Test("A reading sums every vCPU thread, and a missing thread voids it")
+    func readsThreads() throws {
+        let root = NSTemporaryDirectory() + "cpu-sampler-" + UUID().uuidString
+        defer { try? FileManager.default.removeItem(atPath: root) }
+        for (tid, ticks) in [(11, UInt64(100)), (12, UInt64(300))] {
+            try FileManager.default.createDirectory(atPath: "\(root)/\(tid)", withIntermediateDirectories: true)
+            try Self.statLine(utime: ticks, stime: 0).write(
+                toFile: "\(root)/\(tid)/stat", atomically: true, encoding: .utf8)
+        }
+
+        let reading = GuestCPUSampler.read(threadIDs: [11, 12], at: 5, procRoot: root)
+        #expect(reading == GuestCPUSampler.Reading(ticks: 400, vcpus: 2, at: 5))
+        #expect(GuestCPUSampler.read(threadIDs: [11, 13], at: 5, procRoot: root) == nil)
+        #expect(GuestCPUSampler.read(threadIDs: [], at: 5, procRoot: root) == nil)
+    }
+
+    @Test("Utilization is busy time over elapsed time across all vCPUs")
+    func computesUtilization() {
+        let before = GuestCPUSampler.Reading(ticks: 1000, vcpus: 4, at: 100)
+        // 4 vCPUs over 10s is 40 CPU-seconds; 10s busy is a quarter of that.
+        let after = GuestCPUSampler.Reading(ticks: 2000, vcpus: 4, at: 110)
+        #expect(GuestCPUSampler.utilization(from: before, to: after) == 0.25)
+    }
+
+    @Test("Readings that can't be compared give no utilization")
+    func incomparableReadings() {
+        let before = GuestCPUSampler.Reading(ticks: 1000, vcpus: 2, at: 100)
+        #expect(GuestCPUSampler.utilization(from: before, to: .init(ticks: 1500, vcpus: 2, at: 100)) == nil)
+        #expect(GuestCPUSampler.utilization(from: before, to: .init(ticks: 1500, vcpus: 4, at: 110)) == nil)
+        #expect(GuestCPUSampler.utilization(from: before, to: .init(ticks: 10, vcpus: 2, at: 110)) == nil)
+        #expect(GuestCPUSampler.utilization(from: before, to: .init(ticks: 99_000, vcpus: 2, at: 110)) == 1)
+    }
+}
@@ -23,6 +23,7 @@ struct HostPreflightTests {
             qemuImgPath: "/bin/ls",
             firmwarePath: "/bin/ls",
             swtpmBinaryPath: "/bin/ls",
+            virtFwVarsBinaryPath: "/bin/ls",
             minimumFreeDiskBytes: 0
         )
     }
@@ -262,6 +263,23 @@ struct HostPreflightTests {
         #expect(report.swtpmAvailable)
     }
 
+    @Test("Missing virt-fw-vars only withholds custom Secure Boot key enrollment")
+    func missingVirtFwVarsIsAdvisory() throws {
+        let root = try makeTempDir()
+        defer { try? FileManager.default.removeItem(atPath: root) }
+
+        var inputs = passingInputs(root: root)
+        inputs.virtFwVarsBinaryPath = nil
+        let report = HostPreflight.run(inputs)
+
+        let check = try #require(report.check(.virtFwVarsBinary))
+        #expect(!check.passed)
+        #expect(check.severity == .advisory)
+        #expect(!report.secureBootKeyEnrollmentAvailable)
+        #expect(report.storageReady)
+        #expect(HostPreflight.run(passingInputs(root: root)).secureBootKeyEnrollmentAvailable)
+    }
+
     @Test("Missing firmware is advisory: logged, not gating")
     func missingFirmwareIsAdvisory() throws {
         let root = try makeTempDir()
@@ -0,0 +1,139 @@
+import Foundation
+import StratoShared
+import Testing
+
+@testable import StratoAgentCore
+
+/// Pressure-aware balloon reclaim: PSI parsing, and the controller squeezing
+/// idle guests a step at a time within their floors and operator targets,
+/// holding in the band between the thresholds, and handing memory back to
+/// busy guests and once pressure subsides. Plus the KSM sysfs writes.
+@Suite("Memory Pressure Controller")
+struct MemoryPressureControllerTests {
+
+    private static let gib: Int64 = 1 << 30
+    private static let step: Int64 = 256 << 20
+    private static let policy = PressureReclaimPolicy(
+        pressureThresholdPercent: 10, releaseThresholdPercent: 1, idleAvailableFraction: 0.5,
+        defaultFloorFraction: 0.5, stepBytes: step)
+
+    private static func idleStats(_ total: Int64 = 4 * gib) -> VMMemoryStats {
+        VMMemoryStats(totalBytes: total, availableBytes: total * 3 / 4)
+    }
+
+    private static func busyStats(_ total: Int64 = 4 * gib) -> VMMemoryStats {
+        VMMemoryStats(totalBytes: total, availableBytes: total / 10)
+    }
+
+    // MARK: - PSI
+
+    @Test("PSI lines parse into some/full avg10")
+    func parsesPressure() {
+        let text = """
+            some avg10=12.50 avg60=3.00 avg300=0.75 total=123456
+            full avg10=0.40 avg60=0.10 avg300=0.00 total=789
+            """
+        #expect(MemoryPressure.parse(text) == MemoryPressure(someAvg10: 12.5, fullAvg10: 0.4))
+        #expect(MemoryPressure.parse("some avg10=0.00 avg60=0.00 avg300=0.00 total=0")?.fullAvg10 == nil)
+        #expect(MemoryPressure.parse("") == nil)
+    }
+
+    // MARK: - Planning
+
+    @Test("Under pressure an idle guest is squeezed one step from its ceiling")
+    func squeezesIdleGuest() {
+        let changes = MemoryPressureController.plan(
+            pressure: MemoryPressure(someAvg10: 20), policy: Self.policy,
+            vms: [.init(vmId: "a", memoryBytes: 4 * Self.gib, stats: Self.idleStats())])
+        #expect(changes == ["a": 4 * Self.gib - Self.step])
+    }
+
+    @Test("The operator's target is the ceiling, and the floor stops the squeeze")
+    func respectsCeilingAndFloor() {
+        let changes = MemoryPressureController.plan(
+            pressure: MemoryPressure(someAvg10: 20), policy: Self.policy,
+            vms: [
+                .init(
+                    vmId: "target", memoryBytes: 4 * Self.gib, operatorTargetBytes: 3 * Self.gib,
+                    stats: Self.idleStats()),
+                .init(
+                    vmId: "floored", memoryBytes: 4 * Self.gib, floorBytes: 3 * Self.gib, stats: Self.idleStats(),
+                    reclaimTargetBytes: 3 * Self.gib + 100),
+                .init(
+                    vmId: "at-floor", memoryBytes: 4 * Self.gib, stats: Self.idleStats(),
+                    reclaimTargetBytes: 2 * Self.gib),
+            ])
+        #expect(changes["target"] == .some(3 * Self.gib - Self.step))
+        #expect(changes["floored"] == .some(3 * Self.gib))
+        #expect(changes["at-floor"] == nil)
+    }
+
+    @Test("Busy guests and guests without stats are never squeezed")
+    func leavesBusyGuestsAlone() {
+        let changes = MemoryPressureController.plan(
+            pressure: MemoryPressure(someAvg10: 50), policy: Self.policy,
+            vms: [
+                .init(vmId: "busy", memoryBytes: 4 * Self.gib, stats: Self.busyStats()),
+                .init(vmId: "silent", memoryBytes: 4 * Self.gib, stats: nil),
+            ])
+        #expect(changes.isEmpty)
+    }
+
+    @Test("A reclaimed guest that turns busy gets a step back even under pressure")
+    func releasesBusyGuestUnderPressure() {
+        let changes = MemoryPressureController.plan(
+            pressure: MemoryPressure(someAvg10: 50), policy: Self.policy,
+            vms: [
+                .init(
+                    vmId: "woke", memoryBytes: 4 * Self.gib, stats: Self.busyStats(),
+                    reclaimTargetBytes: 2 * Self.gib)
+            ])
+        #expect(changes == ["woke": 2 * Self.gib + Self.step])
+    }
+
+    @Test("Between the thresholds balloons hold; below release they deflate until released")
+    func holdsThenReleases() {
+        let reclaimed = MemoryPressureController.VMInput(
+            vmId: "a", memoryBytes: 4 * Self.gib, stats: Self.idleStats(),
+            reclaimTargetBytes: 4 * Self.gib - Self.step)
+
+        #expect(
+            MemoryPressureController.plan(
+                pressure: MemoryPressure(someAvg10: 5), policy: Self.policy, vms: [reclaimed]
+            ).isEmpty)
+
+        let changes = MemoryPressureController.plan(
+            pressure: MemoryPressure(someAvg10: 0), policy: Self.policy, vms: [reclaimed])
+        #expect(changes.count == 1)
+        #expect(changes["a"] == .some(nil))
+    }
+
+    @Test("A floor without a per-VM value is the policy fraction, but never below the minimum")
+    func defaultFloor() {
+        let small = MemoryPressureController.VMInput(vmId: "s", memoryBytes: 128 << 20, stats: nil)
+        let large = MemoryPressureController.VMInput(vmId: "l", memoryBytes: 8 * Self.gib, stats: nil)
+        #expect(
+            MemoryPressureController.floorBytes(for: small, policy: Self.policy)
+                == MemoryPressureController.minimumFloorBytes)
+        #expect(MemoryPressureController.floorBytes(for: large, policy: Self.policy) == 4 * Self.gib)
+    }
+
+    // MARK: - KSM
+
+    @Test("KSM settings write the scan rate before starting, and stop with run=0")
+    func ksmSettings() throws {
+        let root = NSTemporaryDirectory() + "ksm-tests-" + UUID().uuidString
+        try FileManager.default.createDirectory(atPath: root, withIntermediateDirectories: true)
+        defer { try? FileManager.default.removeItem(atPath: root) }
+
+        #expect(KSMTuner.settings(for: nil).map(\.file) == ["run"])
+        #expect(KSMTuner.settings(for: KSMTuning()).map(\.file) == ["pages_to_scan", "sleep_millisecs", "run"])
+
+        let tuner = KSMTuner(root: root)
+        try tuner.apply(KSMTuning(pagesToScan: 500, sleepMilliseconds: 10))
+        #expect(try String(contentsOfFile: root + "/pages_to_scan", encoding: .utf8) == "500")
+        #expect(try String(contentsOfFile: root + "/run", encoding: .utf8) == "1")
+        try tuner.apply(nil)
+        #expect(try String(contentsOfFile: root + "/run", encoding: .utf8) == "0")
+    }
+}
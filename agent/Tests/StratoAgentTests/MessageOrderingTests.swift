@@ -196,6 +196,46 @@ struct MessageOrderingTests {
         #expect(!Set(attachKeys).isDisjoint(with: vmActionKeys))
     }
 
+    @Test("A volume mirror holds the volume lane but not the VM's")
+    func volumeMirrorStaysOffVMLane() {
+        let vmId = UUID().uuidString
+        let volumeId = UUID().uuidString
+        let mirrorKeys = MessageEnvelope.serializationKeys(
+            type: .volumeMirror,
+            payload: payload(["vmId": vmId, "volumeId": volumeId])
+        )
+        // A mirror runs for as long as the copy takes; a reboot of the same VM
+        // must not queue behind it.
+        let vmActionKeys = MessageEnvelope.serializationKeys(
+            type: .vmReboot, payload: payload(["vmId": vmId])
+        )
+        let detachKeys = MessageEnvelope.serializationKeys(
+            type: .volumeDetach,
+            payload: payload(["vmId": vmId, "volumeId": volumeId])
+        )
+        #expect(mirrorKeys == [volumeId])
+        #expect(Set(mirrorKeys).isDisjoint(with: vmActionKeys))
+        #expect(!Set(mirrorKeys).isDisjoint(with: detachKeys))
+    }
+
+    @Test("Guest exec has a per-VM guest lane; a disk export stays on the VM's lane")
+    func guestExecStaysOffVMLane() {
+        let vmId = UUID().uuidString
+        let execKeys = MessageEnvelope.serializationKeys(
+            type: .vmGuestExec, payload: payload(["vmId": vmId, "command": ["true"], "timeoutSeconds": 60])
+        )
+        let vmActionKeys = MessageEnvelope.serializationKeys(
+            type: .vmReboot, payload: payload(["vmId": vmId])
+        )
+        let exportKeys = MessageEnvelope.serializationKeys(
+            type: .vmDiskExport, payload: payload(["vmId": vmId, "uploadURL": "/api/image-builds/b/disk"])
+        )
+        #expect(execKeys == ["guest-exec:\(vmId)"])
+        #expect(Set(execKeys).isDisjoint(with: vmActionKeys))
+        // The export reads the stopped VM's disk, so a delete must wait for it.
+        #expect(exportKeys == vmActionKeys)
+    }
+
     @Test("Network attach serializes against both the VM and the named network")
     func networkAttachSpansVMAndNetworkLanes() {
         let vmId = UUID().uuidString
@@ -226,4 +226,23 @@ struct MockStorageBackendTests {
         #expect(attachment.format == .raw)
         #expect(!FileManager.default.fileExists(atPath: path))
     }
+
+    @Test("Migration moves an empty file and records the volume at its canonical path")
+    func exportImport() async throws {
+        let sut = backend(root: "/var/lib/strato/volumes")
+        let attachment = try await sut.createVolume(volumeId: "vol-1", sizeBytes: 1024, format: .qcow2)
+
+        try await sut.exportVolume(volumeId: "vol-1", volumePath: attachment.path) { file in
+            #expect(FileManager.default.contents(atPath: file) == Data())
+        }
+        await #expect(throws: StorageBackendError.self) {
+            try await sut.exportVolume(volumeId: "missing", volumePath: "/nowhere") { _ in }
+        }
+
+        let imported = try await sut.importVolume(volumeId: "vol-2", format: .raw) { staging in
+            FileManager.default.createFile(atPath: staging, contents: Data())
+        }
+        #expect(imported.path == "/var/lib/strato/volumes/vol-2/volume.raw")
+        #expect(try await sut.volumeInfo(volumePath: imported.path).format == "raw")
+    }
 }
@@ -0,0 +1,163 @@
+import Foundation
+import Logging
+import StratoShared
+import Testing
+
+@testable import StratoAgentCore
+
+/// NBD exports for attached-volume migration. Serving needs a real qemu-nbd,
+/// so what is covered here is what must hold without one: the invocation,
+/// port assignment, and the persisted table that keeps a remote VM's
+/// endpoint stable across an agent restart. The fake launcher never writes a
+/// pid file, so no test ever hands the manager a live process to signal.
+@Suite("NBDExportManager")
+struct NBDExportManagerTests {
+
+    /// Records every launch; fails them when `failing` is set.
+    final class LaunchRecorder: @unchecked Sendable {
+        private let lock = NSLock()
+        private var calls: [[String]] = []
+        var failing = false
+
+        var launches: [[String]] {
+            lock.withLock { calls }
+        }
+
+        func launcher() -> NBDExportManager.Launcher {
+            { _, arguments in
+                let failing = self.lock.withLock {
+                    self.calls.append(arguments)
+                    return self.failing
+                }
+                return ProcessResult(
+                    terminationStatus: failing ? 1 : 0,
+                    standardOutput: Data(),
+                    standardError: Data((failing ? "bind: address in use" : "").utf8))
+            }
+        }
+    }
+
+    private func makeTempDirectory() throws -> String {
+        let path = NSTemporaryDirectory() + "nbd-tests-" + UUID().uuidString
+        try FileManager.default.createDirectory(atPath: path, withIntermediateDirectories: true)
+        return path
+    }
+
+    private func makeManager(
+        _ directory: String, ports: ClosedRange<Int> = 10809...10899, recorder: LaunchRecorder
+    ) -> NBDExportManager {
+        NBDExportManager(
+            stateDirectory: directory,
+            advertiseHost: "10.0.10.5",
+            bindAddress: "10.0.10.5",
+            portRange: ports,
+            logger: Logger(label: "test"),
+            launch: recorder.launcher()
+        )
+    }
+
+    @Test("The invocation forks a raw, uncached, multi-client export on the storage address")
+    func argumentShape() {
+        let arguments = NBDExportManager.arguments(
+            volumeId: "vol-1",
+            record: .init(path: "/var/lib/strato/volumes/vol-1/volume.raw", port: 10810),
+            bindAddress: "10.0.10.5",
+            pidFilePath: "/var/lib/strato/volumes/nbd/vol-1.pid"
+        )
+
+        // Without --fork the launch would never return; without --persistent
+        // the export would exit when the mirroring QEMU disconnects to pivot.
+        #expect(arguments.contains("--fork"))
+        #expect(arguments.contains("--persistent"))
+        #expect(arguments.contains("--format=raw"))
+        #expect(arguments.contains("--export-name=vol-1"))
+        #expect(arguments.contains("--bind=10.0.10.5"))
+        #expect(arguments.contains("--port=10810"))
+        #expect(arguments.contains("--pid-file=/var/lib/strato/volumes/nbd/vol-1.pid"))
+        #expect(arguments.last == "/var/lib/strato/volumes/vol-1/volume.raw")
+    }
+
+    @Test("Each export gets its own port, and a re-export keeps the one its clients were given")
+    func portAssignment() async throws {
+        let directory = try makeTempDirectory()
+        defer { try? FileManager.default.removeItem(atPath: directory) }
+        let recorder = LaunchRecorder()
+        let manager = makeManager(directory, recorder: recorder)
+
+        let first = try await manager.export(volumeId: "vol-1", path: "\(directory)/vol-1.raw")
+        let second = try await manager.export(volumeId: "vol-2", path: "\(directory)/vol-2.raw")
+        #expect(first.port == 10809)
+        #expect(second.port == 10810)
+        #expect(first.uri == "nbd://10.0.10.5:10809/vol-1")
+
+        let again = try await manager.export(volumeId: "vol-1", path: "\(directory)/vol-1.raw")
+        #expect(again == first)
+        #expect(recorder.launches.count == 3)
+    }
+
+    @Test("A full port range refuses the export rather than sharing a port")
+    func exhaustedRange() async throws {
+        let directory = try makeTempDirectory()
+        defer { try? FileManager.default.removeItem(atPath: directory) }
+        let manager = makeManager(directory, ports: 10809...10809, recorder: LaunchRecorder())
+
+        _ = try await manager.export(volumeId: "vol-1", path: "\(directory)/vol-1.raw")
+        await #expect(throws: NBDExportManager.ExportError.self) {
+            _ = try await manager.export(volumeId: "vol-2", path: "\(directory)/vol-2.raw")
+        }
+        #expect(await manager.endpoint(for: "vol-2") == nil)
+    }
+
+    @Test("A failed launch records nothing")
+    func failedLaunch() async throws {
+        let directory = try makeTempDirectory()
+        defer { try? FileManager.default.removeItem(atPath: directory) }
+        let recorder = LaunchRecorder()
+        recorder.failing = true
+        let manager = makeManager(directory, recorder: recorder)
+
+        await #expect(throws: NBDExportManager.ExportError.self) {
+            _ = try await manager.export(volumeId: "vol-1", path: "\(directory)/vol-1.raw")
+        }
+        #expect(await manager.endpoint(for: "vol-1") == nil)
+    }
+
+    @Test("After a restart, exports come back on their recorded ports; ones whose disk is gone are dropped")
+    func restoreAfterRestart() async throws {
+        let directory = try makeTempDirectory()
+        defer { try? FileManager.default.removeItem(atPath: directory) }
+        let kept = "\(directory)/kept.raw"
+        FileManager.default.createFile(atPath: kept, contents: Data())
+
+        let before = makeManager(directory, recorder: LaunchRecorder())
+        _ = try await before.export(volumeId: "gone", path: "\(directory)/gone.raw")
+        let keptEndpoint = try await before.export(volumeId: "kept", path: kept)
+
+        let recorder = LaunchRecorder()
+        let after = makeManager(directory, recorder: recorder)
+        await after.restore()
+
+        #expect(await after.endpoint(for: "kept") == keptEndpoint)
+        #expect(await after.endpoint(for: "gone") == nil)
+        #expect(recorder.launches.count == 1)
+        #expect(recorder.launches.first?.contains("--port=\(keptEndpoint.port)") == true)
+
+        // Dropping `gone` frees its port for the next export.
+        let next = try await after.export(volumeId: "next", path: "\(directory)/next.raw")
+        #expect(next.port == 10809)
+    }
+
+    @Test("Unexporting forgets the volume")
+    func unexport() async throws {
+        let directory = try makeTempDirectory()
+        defer { try? FileManager.default.removeItem(atPath: directory) }
+        let manager = makeManager(directory, recorder: LaunchRecorder())
+
+        _ = try await manager.export(volumeId: "vol-1", path: "\(directory)/vol-1.raw")
+        await manager.unexport(volumeId: "vol-1")
+        #expect(await manager.endpoint(for: "vol-1") == nil)
+
+        let reloaded = makeManager(directory, recorder: LaunchRecorder())
+        #expect(await reloaded.endpoint(for: "vol-1") == nil)
+    }
+}
@@ -10,7 +10,7 @@ struct NetworkReconcilerTests {
 
     private func network(
         name: String,
-        subnet: String,
+        subnet: String?,
         gateway: String?,
         subnet6: String? = nil,
         gateway6: String? = nil,
@@ -18,7 +18,8 @@ struct NetworkReconcilerTests {
         externalAccess: Bool = true,
         generation: Int64 = 1,
         id: UUID = UUID(),
-        floatingIPs: [DesiredFloatingIP]? = nil
+        floatingIPs: [DesiredFloatingIP]? = nil,
+        dnsServers: [String]? = nil
     ) -> DesiredNetworkState {
         DesiredNetworkState(
             networkId: id,
@@ -29,6 +30,7 @@ struct NetworkReconcilerTests {
             gateway6: gateway6,
             routerKey: routerKey,
             externalAccess: externalAccess,
+            dnsServers: dnsServers,
             generation: generation,
             floatingIPs: floatingIPs)
     }
@@ -136,6 +138,36 @@ struct NetworkReconcilerTests {
         #expect(plan.routers[0].snatSubnets == ["10.2.0.0/24", "fd12:3456:789a::/64"])
     }
 
+    @Test("An IPv6-only network routes and egresses v6 alone, with RDNSS")
+    func ipv6OnlyRouterPort() {
+        let id = UUID()
+        let plan = NetworkReconciler.plan(networks: [
+            network(
+                name: "v6only", subnet: nil, gateway: nil,
+                subnet6: "fd12:3456:789b::/64", gateway6: "fd12:3456:789b::1",
+                routerKey: "project-6", id: id,
+                dnsServers: ["2001:db8::53", "2001:db8:1::53"])
+        ])
+        #expect(plan.switches[0].subnet == "fd12:3456:789b::/64")
+        let router = plan.routers[0]
+        let port = router.ports[0]
+        #expect(port.cidrs == ["fd12:3456:789b::1/64"])
+        #expect(port.mac == OVNNaming.routerPortMAC(networkId: id))
+        #expect(port.ipv6RAConfigs?["rdnss"] == "2001:db8::53,2001:db8:1::53")
+        #expect(router.snatSubnets == ["fd12:3456:789b::/64"])
+        #expect(router.needsUplink)
+    }
+
+    @Test("An IPv6-only network with a bad v6 config plans nothing L3")
+    func ipv6OnlyUnparsable() {
+        let plan = NetworkReconciler.plan(networks: [
+            network(
+                name: "v6only", subnet: nil, gateway: nil, subnet6: "not-a-prefix", gateway6: "fd00::1",
+                routerKey: "project-6")
+        ])
+        #expect(plan.routers.isEmpty)
+    }
+
     @Test("The planned v6 SNAT subnet is the canonical masked prefix, not the raw string")
     func v6SNATSubnetIsCanonical() {
         // A non-canonical, non-masked spelling of fd12:3456:789a::/64. Planning
@@ -456,6 +488,34 @@ struct NetworkReconcilerTests {
         #expect(plan.routers[0].dnatRules[0].logicalPort == "vm-\(vmId.uuidString)-1")
     }
 
+    @Test("BYOIP floating IPs announce their prefix once per router; operator pools announce nothing")
+    func byoipPrefixesAdvertised() {
+        let plan = NetworkReconciler.plan(networks: [
+            network(
+                name: "web", subnet: "192.168.1.0/24", gateway: "192.168.1.1", routerKey: "p",
+                floatingIPs: [
+                    DesiredFloatingIP(
+                        externalIP: "198.51.100.7", logicalIP: "192.168.1.5", vmId: UUID(), nicIndex: 0,
+                        advertisedPrefix: "198.51.100.0/24"),
+                    DesiredFloatingIP(
+                        externalIP: "203.0.113.10", logicalIP: "192.168.1.6", vmId: UUID(), nicIndex: 0),
+                ]),
+            network(
+                name: "api", subnet: "192.168.2.0/24", gateway: "192.168.2.1", routerKey: "p",
+                floatingIPs: [
+                    DesiredFloatingIP(
+                        externalIP: "198.51.100.8", logicalIP: "192.168.2.5", vmId: UUID(), nicIndex: 0,
+                        advertisedPrefix: "198.51.100.9/24"),
+                    DesiredFloatingIP(
+                        externalIP: "192.0.2.9", logicalIP: "192.168.2.6", vmId: UUID(), nicIndex: 0,
+                        advertisedPrefix: "not-a-prefix"),
+                ]),
+        ])
+        #expect(plan.routers.count == 1)
+        #expect(plan.routers[0].advertisedPrefixes == ["198.51.100.0/24"])
+        #expect(plan.routers[0].dnatRules.count == 4)
+    }
+
     @Test("Floating IPs on a no-egress network are not planned (no uplink to NAT through)")
     func floatingIPIgnoredWithoutExternalAccess() {
         let plan = NetworkReconciler.plan(networks: [
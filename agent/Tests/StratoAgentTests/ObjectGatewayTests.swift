@@ -0,0 +1,275 @@
+import Crypto
+import Foundation
+import Logging
+import StratoShared
+import Testing
+
+@testable import StratoAgentCore
+
+/// The object gateway driven directly, without a socket: every request is
+/// signed the way an SDK would sign it, so these cover authentication,
+/// authorization from the synced grants, and the S3 operations together.
+@Suite("ObjectGateway")
+struct ObjectGatewayTests {
+    static let accessKeyId = "SKTESTKEY000000000001"
+    static let secret = "test-secret"
+    static let clock = Date(timeIntervalSince1970: 1_790_000_000)
+
+    private func makeTempDirectory() throws -> String {
+        let path = NSTemporaryDirectory() + "object-gateway-tests-" + UUID().uuidString
+        try FileManager.default.createDirectory(atPath: path, withIntermediateDirectories: true)
+        return path
+    }
+
+    private func makeGateway(_ root: String) -> ObjectGateway {
+        ObjectGateway(root: root, endpoint: "https://s3.test", logger: Logger(label: "test"), now: { Self.clock })
+    }
+
+    private func bucket(
+        _ bucketId: UUID, name: String = "team-data", generation: Int64 = 1, quota: Int64? = nil,
+        status: DesiredBucketStatus = .present, permissions: [ObjectPermission] = ObjectPermission.allCases
+    ) -> DesiredBucketState {
+        DesiredBucketState(
+            bucketId: bucketId, name: name, desiredStatus: status, generation: generation, quotaBytes: quota,
+            grants: [ObjectAccessGrant(accessKeyId: Self.accessKeyId, permissions: permissions)])
+    }
+
+    private func storage(_ buckets: [DesiredBucketState]) -> DesiredObjectStorageState {
+        DesiredObjectStorageState(
+            buckets: buckets,
+            credentials: [ObjectGatewayCredential(accessKeyId: Self.accessKeyId, secretAccessKey: Self.secret)])
+    }
+
+    /// A header-signed request, with its body spooled the way the server
+    /// would spool it.
+    private func signed(
+        _ method: String, _ path: String, query: [(name: String, value: String)] = [], body: Data? = nil,
+        headers extra: [(name: String, value: String)] = [], secret: String = Self.secret, in root: String
+    ) throws -> ObjectGatewayRequest {
+        var spooled: ObjectGatewayRequest.Body?
+        if let body {
+            let spool = (root as NSString).appendingPathComponent(".spool")
+            try FileManager.default.createDirectory(atPath: spool, withIntermediateDirectories: true)
+            let file = (spool as NSString).appendingPathComponent(UUID().uuidString)
+            try body.write(to: URL(fileURLWithPath: file))
+            spooled = ObjectGatewayRequest.Body(
+                path: file, size: Int64(body.count), sha256: SigV4.hex(SHA256.hash(data: body)),
+                md5: Data(Insecure.MD5.hash(data: body)))
+        }
+        var headers: [(name: String, value: String)] = [
+            ("Host", "s3.test"),
+            ("x-amz-date", SigV4.formatTimestamp(Self.clock)),
+            ("x-amz-content-sha256", spooled?.sha256 ?? SigV4.emptyPayloadHash),
+        ]
+        headers += extra
+        let input = SigV4.CanonicalInput(method: method, path: path, query: query, headers: headers)
+        headers.append(
+            ("Authorization",
+             SigV4.authorizationHeader(
+                for: input, signedHeaders: ["host", "x-amz-date", "x-amz-content-sha256"],
+                accessKeyId: Self.accessKeyId, secretAccessKey: secret, region: "us-east-1")))
+        return ObjectGatewayRequest(method: method, path: path, query: query, headers: headers, body: spooled)
+    }
+
+    private func bodyData(_ response: ObjectGatewayResponse) throws -> Data {
+        switch response.body {
+        case .empty:
+            return Data()
+        case .data(let data):
+            return data
+        case .file(let path, let range):
+            let data = try Data(contentsOf: URL(fileURLWithPath: path))
+            return data.subdata(in: Int(range.lowerBound)..<Int(range.upperBound))
+        }
+    }
+
+    private func bodyText(_ response: ObjectGatewayResponse) throws -> String {
+        String(decoding: try bodyData(response), as: UTF8.self)
+    }
+
+    @Test("Objects round-trip, with their ETag, metadata and byte ranges")
+    func putAndGet() async throws {
+        let root = try makeTempDirectory()
+        defer { try? FileManager.default.removeItem(atPath: root) }
+        let gateway = makeGateway(root)
+        await gateway.submit(storage([bucket(UUID())]))
+
+        let payload = Data("hello, object storage".utf8)
+        let put = await gateway.handle(
+            try signed(
+                "PUT", "/team-data/docs/hello.txt", body: payload,
+                headers: [("Content-Type", "text/plain"), ("x-amz-meta-owner", "ci")], in: root))
+        #expect(put.status == 200)
+        let etag = SigV4.hex(Insecure.MD5.hash(data: payload))
+        #expect(put.header("ETag") == "\"\(etag)\"")
+
+        let get = await gateway.handle(try signed("GET", "/team-data/docs/hello.txt", in: root))
+        #expect(get.status == 200)
+        #expect(try bodyData(get) == payload)
+        #expect(get.header("Content-Type") == "text/plain")
+        #expect(get.header("x-amz-meta-owner") == "ci")
+
+        let ranged = await gateway.handle(
+            try signed("GET", "/team-data/docs/hello.txt", headers: [("Range", "bytes=0-4")], in: root))
+        #expect(ranged.status == 206)
+        #expect(try bodyText(ranged) == "hello")
+        #expect(ranged.header("Content-Range") == "bytes 0-4/\(payload.count)")
+
+        let head = await gateway.handle(try signed("HEAD", "/team-data/docs/hello.txt", in: root))
+        #expect(head.header("Content-Length") == String(payload.count))
+
+        let deleted = await gateway.handle(try signed("DELETE", "/team-data/docs/hello.txt", in: root))
+        #expect(deleted.status == 204)
+        let missing = await gateway.handle(try signed("GET", "/team-data/docs/hello.txt", in: root))
+        #expect(missing.status == 404)
+        #expect(try bodyText(missing).contains("<Code>NoSuchKey</Code>"))
+    }
+
+    @Test("Listing rolls keys up at the delimiter and pages past a common prefix")
+    func listing() async throws {
+        let root = try makeTempDirectory()
+        defer { try? FileManager.default.removeItem(atPath: root) }
+        let gateway = makeGateway(root)
+        await gateway.submit(storage([bucket(UUID())]))
+        for key in ["a.txt", "photos/1.jpg", "photos/2.jpg", "z.txt"] {
+            _ = await gateway.handle(try signed("PUT", "/team-data/\(key)", body: Data(key.utf8), in: root))
+        }
+
+        let page = await gateway.handle(
+            try signed(
+                "GET", "/team-data",
+                query: [("list-type", "2"), ("delimiter", "/"), ("max-keys", "2")], in: root))
+        let first = try bodyText(page)
+        #expect(first.contains("<Key>a.txt</Key>"))
+        #expect(first.contains("<CommonPrefixes><Prefix>photos/</Prefix></CommonPrefixes>"))
+        #expect(first.contains("<IsTruncated>true</IsTruncated>"))
+        let token = try #require(
+            ObjectGatewayXML.values(of: "NextContinuationToken", in: first[...]).first.map(String.init))
+
+        let next = await gateway.handle(
+            try signed(
+                "GET", "/team-data",
+                query: [("list-type", "2"), ("delimiter", "/"), ("continuation-token", token)], in: root))
+        let second = try bodyText(next)
+        #expect(second.contains("<Key>z.txt</Key>"))
+        #expect(!second.contains("photos/"))
+        #expect(second.contains("<IsTruncated>false</IsTruncated>"))
+    }
+
+    @Test("A multipart upload assembles its parts and carries the multipart ETag")
+    func multipart() async throws {
+        let root = try makeTempDirectory()
+        defer { try? FileManager.default.removeItem(atPath: root) }
+        let gateway = makeGateway(root)
+        await gateway.submit(storage([bucket(UUID())]))
+
+        let created = await gateway.handle(
+            try signed("POST", "/team-data/big.bin", query: [("uploads", "")], in: root))
+        let uploadId = try #require(
+            ObjectGatewayXML.values(of: "UploadId", in: try bodyText(created)[...]).first.map(String.init))
+
+        let first = Data(repeating: 0x61, count: Int(ObjectGateway.minimumPartSize))
+        let second = Data("tail".utf8)
+        var listed = ""
+        for (number, part) in [first, second].enumerated() {
+            let response = await gateway.handle(
+                try signed(
+                    "PUT", "/team-data/big.bin",
+                    query: [("partNumber", String(number + 1)), ("uploadId", uploadId)], body: part, in: root))
+            #expect(response.status == 200)
+            listed += "<Part><PartNumber>\(number + 1)</PartNumber><ETag>\(response.header("ETag") ?? "")</ETag></Part>"
+        }
+
+        let completed = await gateway.handle(
+            try signed(
+                "POST", "/team-data/big.bin", query: [("uploadId", uploadId)],
+                body: Data("<CompleteMultipartUpload>\(listed)</CompleteMultipartUpload>".utf8), in: root))
+        #expect(completed.status == 200)
+        let digests = Data(Insecure.MD5.hash(data: first)) + Data(Insecure.MD5.hash(data: second))
+        #expect(try bodyText(completed).contains("\(SigV4.hex(Insecure.MD5.hash(data: digests)))-2"))
+
+        let get = await gateway.handle(try signed("GET", "/team-data/big.bin", in: root))
+        #expect(try bodyData(get) == first + second)
+    }
+
+    @Test("Grants, signatures and quotas are enforced")
+    func enforcement() async throws {
+        let root = try makeTempDirectory()
+        defer { try? FileManager.default.removeItem(atPath: root) }
+        let gateway = makeGateway(root)
+        await gateway.submit(
+            storage([
+                bucket(UUID(), name: "read-only", permissions: [.list, .read]),
+                bucket(UUID(), name: "small", quota: 8),
+            ]))
+
+        let denied = await gateway.handle(
+            try signed("PUT", "/read-only/file", body: Data("x".utf8), in: root))
+        #expect(denied.status == 403)
+        #expect(try bodyText(denied).contains("<Code>AccessDenied</Code>"))
+
+        let forged = await gateway.handle(try signed("GET", "/read-only", secret: "wrong", in: root))
+        #expect(try bodyText(forged).contains("<Code>SignatureDoesNotMatch</Code>"))
+
+        let anonymous = await gateway.handle(ObjectGatewayRequest(method: "GET", path: "/read-only"))
+        #expect(anonymous.status == 403)
+
+        let over = await gateway.handle(
+            try signed("PUT", "/small/file", body: Data("more than eight bytes".utf8), in: root))
+        #expect(try bodyText(over).contains("<Code>QuotaExceeded</Code>"))
+
+        // A body that does not match the signed payload hash is refused.
+        var mismatched = try signed("PUT", "/small/file", body: Data("1234".utf8), in: root)
+        let other = (root as NSString).appendingPathComponent(".spool/other")
+        try Data("5678".utf8).write(to: URL(fileURLWithPath: other))
+        mismatched.body = ObjectGatewayRequest.Body(
+            path: other, size: 4, sha256: SigV4.hex(SHA256.hash(data: Data("5678".utf8))),
+            md5: Data(Insecure.MD5.hash(data: Data("5678".utf8))))
+        let response = await gateway.handle(mismatched)
+        #expect(try bodyText(response).contains("<Code>XAmzContentSHA256Mismatch</Code>"))
+
+        let listing = await gateway.handle(try signed("GET", "/", in: root))
+        #expect(try bodyText(listing).contains("<Name>read-only</Name>"))
+    }
+
+    @Test("A bucket desired absent is deleted with its objects, and the table survives a restart")
+    func convergence() async throws {
+        let root = try makeTempDirectory()
+        defer { try? FileManager.default.removeItem(atPath: root) }
+        let gateway = makeGateway(root)
+        let kept = UUID()
+        let removed = UUID()
+        await gateway.submit(storage([bucket(kept, generation: 2), bucket(removed, name: "scratch")]))
+        _ = await gateway.handle(try signed("PUT", "/team-data/keep", body: Data("abc".utf8), in: root))
+
+        await gateway.submit(
+            storage([bucket(kept, generation: 2), bucket(removed, name: "scratch", generation: 2, status: .absent)]))
+        #expect(await gateway.hostedBucketIDs == [kept])
+        #expect(!FileManager.default.fileExists(atPath: await gateway.directory(for: removed)))
+
+        let observed = try #require(await gateway.observedStates().first)
+        #expect(observed.bucketId == kept)
+        #expect(observed.status == .available)
+        #expect(observed.observedGeneration == 2)
+        #expect(observed.usedBytes == 3)
+        #expect(observed.objectCount == 1)
+        #expect(observed.endpoint == "https://s3.test")
+
+        // Objects and buckets reload from disk; credentials do not.
+        let reloaded = makeGateway(root)
+        #expect(await reloaded.hostedBucketIDs == [kept])
+        #expect(await reloaded.observedStates().first?.objectCount == 1)
+        let beforeSync = await reloaded.handle(try signed("GET", "/team-data/keep", in: root))
+        #expect(try bodyText(beforeSync).contains("<Code>InvalidAccessKeyId</Code>"))
+    }
+
+    @Test("Range headers select S3's byte ranges")
+    func ranges() {
+        #expect(ObjectGateway.byteRange("bytes=0-9", size: 100) == 0..<10)
+        #expect(ObjectGateway.byteRange("bytes=90-", size: 100) == 90..<100)
+        #expect(ObjectGateway.byteRange("bytes=-5", size: 100) == 95..<100)
+        #expect(ObjectGateway.byteRange("bytes=50-500", size: 100) == 50..<100)
+        #expect(ObjectGateway.byteRange("bytes=100-", size: 100) == nil)
+        #expect(ObjectGateway.byteRange("bytes=0-1,5-6", size: 100) == nil)
+    }
+}
@@ -174,6 +174,27 @@ struct QGAClientTests {
         #expect(try await client.thawFilesystems() == 2)
     }
 
+    @Test("exec starts the program and returns its exit status and output")
+    func execReportsExit() async throws {
+        let transport = FakeQGATransport { execute, syncId in
+            switch execute {
+            case "guest-sync-delimited":
+                return .object(Array(#"{"return": \#(syncId ?? -1)}"#.utf8))
+            case "guest-exec":
+                return .object(Self.returnObject(#"{"pid": 42}"#))
+            case "guest-exec-status":
+                // "down\n", base64.
+                return .object(Self.returnObject(#"{"exited": true, "exitcode": 3, "out-data": "ZG93bgo="}"#))
+            default:
+                return .object(Array(#"{"error": {"class": "CommandNotFound", "desc": "\#(execute)"}}"#.utf8))
+            }
+        }
+        let result = try await makeClient(transport).exec(path: "/usr/local/bin/check", arguments: ["--quick"])
+        #expect(result == GuestExecResult(exitCode: 3, signal: nil, output: "down"))
+        #expect(!result.succeeded)
+        #expect(transport.executes == ["guest-sync-delimited", "guest-exec", "guest-exec-status"])
+    }
+
     @Test("shutdown treats a mid-command connection drop as success")
     func shutdownConnectionDrop() async throws {
         let transport = FakeQGATransport(
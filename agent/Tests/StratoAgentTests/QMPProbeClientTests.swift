@@ -342,6 +342,41 @@ struct QMPProbeClientTests {
         #expect(transport.executes.filter { $0 == "device_add" }.count == 2)
     }
 
+    @Test("vCPU thread IDs come from query-cpus-fast")
+    func vcpuThreadIDs() async throws {
+        let transport = FakeQMPTransport { execute in
+            switch execute {
+            case "query-cpus-fast":
+                let reply =
+                    #"{"return": [{"cpu-index": 0, "thread-id": 4101, "qom-path": "/machine/unattached/device[0]"},"#
+                    + #"{"cpu-index": 1, "thread-id": 4102}]}"#
+                return .object(Array(reply.utf8))
+            default:
+                return .object(Self.emptyReturn)
+            }
+        }
+        #expect(try await client(transport).vcpuThreadIDs() == [4101, 4102])
+        #expect(transport.executes == ["qmp_capabilities", "query-cpus-fast"])
+    }
+
+    @Test("only CPU models QEMU confirmed have nothing missing are usable")
+    func usableCPUModels() async throws {
+        let transport = FakeQMPTransport { execute in
+            switch execute {
+            case "query-cpu-definitions":
+                let reply =
+                    #"{"return": [{"name": "Skylake-Server", "unavailable-features": []},"#
+                    + #"{"name": "EPYC-Rome", "unavailable-features": ["sha-ni"]},"#
+                    + #"{"name": "Haswell", "unavailable-features": []}, {"name": "base"}]}"#
+                return .object(Array(reply.utf8))
+            default:
+                return .object(Self.emptyReturn)
+            }
+        }
+        #expect(try await client(transport).usableCPUModels() == ["Haswell", "Skylake-Server"])
+        #expect(transport.executes == ["qmp_capabilities", "query-cpu-definitions"])
+    }
+
     @Test("memory resize sets the virtio-mem device's requested size")
     func setRequestedSize() async throws {
         let transport = FakeQMPTransport(handler: Self.hotplugHandler())
@@ -397,6 +432,64 @@ struct QMPProbeClientTests {
         }
     }
 
+    // MARK: - Block I/O throttling (volume types)
+
+    @Test("volume QoS issues block_set_io_throttle with every limit present")
+    func setBlockIOThrottle() async throws {
+        let transport = FakeQMPTransport { execute in
+            execute == "qmp_capabilities" || execute == "block_set_io_throttle"
+                ? .object(Self.emptyReturn)
+                : .object(Array(#"{"error": {"class": "CommandNotFound", "desc": "\#(execute)"}}"#.utf8))
+        }
+        try await client(transport).setBlockIOThrottle(
+            qdevID: "disk1", qos: VolumeQoS(maxIOPS: 500, maxBytesPerSecond: nil))
+
+        #expect(transport.executes == ["qmp_capabilities", "block_set_io_throttle"])
+        let arguments = try #require(transport.requests.last?["arguments"] as? [String: Any])
+        #expect(arguments["id"] as? String == "disk1")
+        #expect((arguments["iops"] as? NSNumber)?.int64Value == 500)
+        // An unset limit is sent as zero (unlimited), never omitted.
+        #expect((arguments["bps"] as? NSNumber)?.int64Value == 0)
+        for key in ["bps_rd", "bps_wr", "iops_rd", "iops_wr"] {
+            #expect((arguments[key] as? NSNumber)?.int64Value == 0)
+        }
+    }
+
+    @Test("a shared disk is added with share-rw on its virtio-blk device")
+    func plugSharedDisk() async throws {
+        let transport = FakeQMPTransport { execute in
+            ["qmp_capabilities", "blockdev-add", "device_add"].contains(execute)
+                ? .object(Self.emptyReturn)
+                : .object(Array(#"{"error": {"class": "CommandNotFound", "desc": "\#(execute)"}}"#.utf8))
+        }
+        try await client(transport).plugSharedDisk(
+            deviceID: "disk1", path: "/var/lib/strato/volumes/v.raw", format: "raw", readOnly: false)
+
+        #expect(transport.executes == ["qmp_capabilities", "blockdev-add", "device_add"])
+        let blockdev = try #require(transport.requests[1]["arguments"] as? [String: Any])
+        #expect(blockdev["node-name"] as? String == "drive-disk1")
+        #expect(blockdev["driver"] as? String == "raw")
+        #expect((blockdev["file"] as? [String: Any])?["filename"] as? String == "/var/lib/strato/volumes/v.raw")
+        let device = try #require(transport.requests[2]["arguments"] as? [String: Any])
+        #expect(device["drive"] as? String == "drive-disk1")
+        #expect(device["id"] as? String == "disk1")
+        #expect(device["share-rw"] as? Bool == true)
+    }
+
+    @Test("a rejected shared device_add deletes the node it added")
+    func plugSharedDiskRollsBack() async throws {
+        let transport = FakeQMPTransport { execute in
+            execute == "device_add"
+                ? .object(Array(#"{"error": {"class": "GenericError", "desc": "Duplicate ID"}}"#.utf8))
+                : .object(Self.emptyReturn)
+        }
+        await #expect(throws: (any Error).self) {
+            try await client(transport).plugSharedDisk(
+                deviceID: "disk1", path: "/v.raw", format: "raw", readOnly: true)
+        }
+        #expect(transport.executes == ["qmp_capabilities", "blockdev-add", "device_add", "blockdev-del"])
+    }
+
     /// The balloon size is the host's own view, so losing it must not cost us
     /// the guest statistics that were already read on the same channel.
     @Test("a failed query-balloon still returns the guest stats")
@@ -410,4 +503,83 @@ struct QMPProbeClientTests {
         #expect(stats.totalBytes == 8_254_390_272)
         #expect(stats.balloonActualBytes == nil)
     }
+
+    /// Counts calls per command so a stateless fake can answer a polled
+    /// command differently over time.
+    final class CallCounter: @unchecked Sendable {
+        private let lock = NSLock()
+        private var counts: [String: Int] = [:]
+        func next(_ execute: String) -> Int {
+            lock.withLock {
+                counts[execute, default: 0] += 1
+                return counts[execute]!
+            }
+        }
+    }
+
+    @Test("a mirror copies onto the NBD target, waits for ready, pivots, and checks the pivot")
+    func mirrorDiskPivots() async throws {
+        let counter = CallCounter()
+        let source = #"[{"device": "drive-vdb", "inserted": {"file": "/v/disk.raw", "node-name": "node-vdb"}}]"#
+        let pivoted = #"[{"device": "drive-vdb", "inserted": {"file": "nbd://10.0.0.7:10809/vol", "node-name": "mirror-m1"}}]"#
+        let transport = FakeQMPTransport { execute in
+            let call = counter.next(execute)
+            switch execute {
+            case "query-block":
+                return .object(Array(#"{"return": \#(call == 1 ? source : pivoted)}"#.utf8))
+            case "query-block-jobs":
+                // Not ready, ready, then retired after the complete.
+                let jobs = [#"[{"device": "m1", "ready": false}]"#, #"[{"device": "m1", "ready": true}]"#]
+                return .object(Array(#"{"return": \#(call <= jobs.count ? jobs[call - 1] : "[]")}"#.utf8))
+            default:
+                return .object(Self.emptyReturn)
+            }
+        }
+
+        try await client(transport).mirrorDisk(
+            sourcePath: "/v/disk.raw",
+            target: NBDExportEndpoint(host: "10.0.0.7", port: 10809, exportName: "vol"),
+            jobID: "m1", pollInterval: .zero)
+
+        let commands = transport.executes.filter { $0 != "qmp_capabilities" }
+        #expect(
+            commands == [
+                "query-block", "blockdev-add", "blockdev-mirror",
+                "query-block-jobs", "query-block-jobs", "block-job-complete", "query-block-jobs",
+                "query-block",
+            ])
+        let add = try #require(transport.requests.first { $0["execute"] as? String == "blockdev-add" })
+        let file = try #require((add["arguments"] as? [String: Any])?["file"] as? [String: Any])
+        #expect(file["driver"] as? String == "nbd")
+        #expect(file["export"] as? String == "vol")
+        #expect((file["server"] as? [String: Any])?["port"] as? String == "10809")
+        let mirror = try #require(transport.requests.first { $0["execute"] as? String == "blockdev-mirror" })
+        let arguments = try #require(mirror["arguments"] as? [String: Any])
+        #expect(arguments["device"] as? String == "node-vdb")
+        #expect(arguments["target"] as? String == "mirror-m1")
+        #expect(arguments["sync"] as? String == "full")
+    }
+
+    @Test("a mirror job that vanishes before it is ready is cancelled and its target removed")
+    func mirrorDiskRollsBack() async throws {
+        let transport = FakeQMPTransport { execute in
+            switch execute {
+            case "query-block":
+                return .object(
+                    Array(#"{"return": [{"device": "d", "inserted": {"file": "/v/disk.raw", "node-name": "n"}}]}"#.utf8))
+            case "query-block-jobs":
+                return .object(Array(#"{"return": []}"#.utf8))
+            default:
+                return .object(Self.emptyReturn)
+            }
+        }
+        await #expect(throws: (any Error).self) {
+            try await client(transport).mirrorDisk(
+                sourcePath: "/v/disk.raw",
+                target: NBDExportEndpoint(host: "10.0.0.7", port: 10809, exportName: "vol"),
+                jobID: "m1", pollInterval: .zero)
+        }
+        let commands = transport.executes.filter { $0 != "qmp_capabilities" }
+        #expect(commands.suffix(2) == ["block-job-cancel", "blockdev-del"])
+    }
 }
@@ -34,14 +34,15 @@ struct ReconciliationTests {
         generation: Int64 = 1,
         cpus: Int,
         memoryBytes: Int64 = 1 << 30,
-        balloonTargetBytes: Int64? = nil
+        balloonTargetBytes: Int64? = nil,
+        memoryFloorBytes: Int64? = nil
     ) -> DesiredVMState {
         DesiredVMState(
             vmId: vmId,
             hypervisorType: .qemu,
             spec: VMSpec(
                 cpus: cpus, maxCpus: 8, memoryBytes: memoryBytes, maxMemoryBytes: 8 << 30,
-                balloonTargetBytes: balloonTargetBytes,
+                balloonTargetBytes: balloonTargetBytes, memoryFloorBytes: memoryFloorBytes,
                 boot: .disk(firmware: nil)),
             desiredStatus: status,
             generation: generation
@@ -59,6 +60,8 @@ struct ReconciliationTests {
         /// What each managed VM is running with, diffed against the desired
         /// spec to plan resizes (issue #568).
         var sizing: [String: VMSizing] = [:]
+        /// The replacement count each VM was created at (wire v31).
+        var replacements: [String: Int64] = [:]
         private(set) var performed: [(step: ReconcileStep, vmId: String)] = []
         private(set) var reportCount = 0
         /// Status an adopted orphan turns out to have.
@@ -90,6 +93,10 @@ struct ReconciliationTests {
             self.sizing = sizing
         }
 
+        func observedReplacements() -> [String: Int64] {
+            replacements
+        }
+
         func adoptVM(_ item: ReconcileWorkItem) throws -> VMStatus {
             if let failWith { throw failWith }
             performed.append((.adopt, item.vmId))
@@ -101,7 +108,9 @@ struct ReconciliationTests {
             if let failWith { throw failWith }
             performed.append((step, item.vmId))
             switch step {
-            case .create: presence[item.vmId] = .managed(.created)
+            case .create, .replace:
+                presence[item.vmId] = .managed(.created)
+                replacements[item.vmId] = item.desired?.replacementCount ?? 0
             case .boot, .resume: presence[item.vmId] = .managed(.running)
             case .pause: presence[item.vmId] = .managed(.paused)
             case .shutdown: presence[item.vmId] = .managed(.shutdown)
@@ -527,6 +536,20 @@ struct ReconciliationTests {
         #expect(items.isEmpty)
     }
 
+    /// A floor changes nothing on the guest, but it only reaches the manifest
+    /// the reclaim controller reads through the resize step.
+    @Test("A new reclaim floor on a running VM plans a resize")
+    func planResizesWhenMemoryFloorChanges() {
+        let vmId = UUID()
+        let items = Reconciler.plan(
+            desired: [Self.desiredSized(vmId, generation: 2, cpus: 2, memoryFloorBytes: 768 << 20)],
+            present: [vmId.uuidString: .managed(.running)],
+            lastApplied: [vmId.uuidString: 1],
+            presentSizing: [vmId.uuidString: VMSizing(cpus: 2, memoryBytes: 1 << 30)]
+        )
+        #expect(items.map(\.steps) == [[.resize]])
+    }
+
     @Test("A stopped VM boots into the new size instead of resizing")
     func planBootsRatherThanResizesStoppedVM() {
         let vmId = UUID()
@@ -573,4 +596,67 @@ struct ReconciliationTests {
         let stillOnce = await actuator.performed
         #expect(stillOnce.count == 1)
     }
+
+    // MARK: - Replacement (wire v31)
+
+    private static func desiredReplaced(
+        _ vmId: UUID, status: DesiredVMStatus = .running, generation: Int64, replacementCount: Int64
+    ) -> DesiredVMState {
+        DesiredVMState(
+            vmId: vmId, hypervisorType: .qemu, spec: spec(), desiredStatus: status, generation: generation,
+            replacementCount: replacementCount)
+    }
+
+    @Test("A replacement count ahead of the VM's plans a replace, then the steps to the desired status")
+    func planReplacesVM() {
+        let vmId = UUID()
+        let running = Reconciler.plan(
+            desired: [Self.desiredReplaced(vmId, generation: 3, replacementCount: 1)],
+            present: [vmId.uuidString: .managed(.running)],
+            lastApplied: [vmId.uuidString: 2]
+        )
+        #expect(running.map(\.steps) == [[.replace, .boot]])
+
+        let stopped = Reconciler.plan(
+            desired: [Self.desiredReplaced(vmId, status: .shutdown, generation: 3, replacementCount: 2)],
+            present: [vmId.uuidString: .managed(.running)],
+            lastApplied: [vmId.uuidString: 2],
+            presentReplacements: [vmId.uuidString: 1]
+        )
+        #expect(stopped.map(\.steps) == [[.replace]])
+    }
+
+    @Test("A replacement already made, or a VM not on the host yet, plans no replace")
+    func planSkipsReplacement() {
+        let vmId = UUID()
+        let done = Reconciler.plan(
+            desired: [Self.desiredReplaced(vmId, generation: 3, replacementCount: 1)],
+            present: [vmId.uuidString: .managed(.running)],
+            lastApplied: [vmId.uuidString: 3],
+            presentReplacements: [vmId.uuidString: 1]
+        )
+        #expect(done.isEmpty)
+
+        let absent = Reconciler.plan(
+            desired: [Self.desiredReplaced(vmId, generation: 3, replacementCount: 1)],
+            present: [:],
+            lastApplied: [:]
+        )
+        #expect(absent.map(\.steps) == [[.create, .boot]])
+    }
+
+    @Test("Applying a replacement sync replaces the VM once")
+    func replacementConverges() async {
+        let vmId = UUID()
+        let key = vmId.uuidString
+        let actuator = MockActuator(presence: [key: .managed(.running)])
+        let reconciler = makeReconciler(actuator)
+
+        await reconciler.apply(Self.sync([Self.desiredReplaced(vmId, generation: 2, replacementCount: 1)]))
+        _ = await actuator.waitForReports(1)
+        #expect(await actuator.performed.map(\.step) == [.replace, .boot])
+
+        await reconciler.apply(Self.sync([Self.desiredReplaced(vmId, generation: 2, replacementCount: 1)]))
+        #expect(await actuator.performed.count == 2)
+    }
 }
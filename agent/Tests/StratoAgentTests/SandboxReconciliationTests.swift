@@ -105,7 +105,7 @@ struct SandboxReconciliationTests {
             switch item.kind {
             case .vm:
                 switch step {
-                case .create: vmPresence[item.id] = .managed(.created)
+                case .create, .replace: vmPresence[item.id] = .managed(.created)
                 case .boot, .resume: vmPresence[item.id] = .managed(.running)
                 case .pause: vmPresence[item.id] = .managed(.paused)
                 case .shutdown: vmPresence[item.id] = .managed(.shutdown)
@@ -118,7 +118,7 @@ struct SandboxReconciliationTests {
                 case .boot: sandboxPresence[item.id] = .managed(.running)
                 case .shutdown: sandboxPresence[item.id] = .managed(.stopped)
                 case .delete: sandboxPresence.removeValue(forKey: item.id)
-                case .adopt, .pause, .resume, .resize: break
+                case .adopt, .pause, .resume, .resize, .replace: break
                 }
             }
         }
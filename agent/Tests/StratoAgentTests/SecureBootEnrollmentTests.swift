@@ -0,0 +1,81 @@
+import Foundation
+import StratoShared
+import Testing
+
+@testable import StratoAgentCore
+
+/// Custom Secure Boot keys (wire v29): the `virt-fw-vars` plan, the dbx
+/// signature-list encoding, and the fingerprint that decides re-enrollment.
+@Suite("Secure Boot Enrollment")
+struct SecureBootEnrollmentTests {
+
+    private static let pem = "-----BEGIN CERTIFICATE-----\nAQIDBA==\n-----END CERTIFICATE-----\n"
+    private static let owner = "11111111-2222-3333-4444-555555555555"
+
+    private static func keys(
+        dbx: [String] = [], includeMicrosoftKeys: Bool = false
+    ) -> SecureBootKeys {
+        SecureBootKeys(
+            ownerGUID: owner, platformKey: pem, keyExchangeKeys: [pem], signatureDatabase: [pem, pem],
+            forbiddenSignatures: dbx, includeMicrosoftKeys: includeMicrosoftKeys)
+    }
+
+    @Test("The plan replaces the template's keys and turns Secure Boot on")
+    func planWithoutMicrosoftKeys() throws {
+        let plan = try SecureBootEnrollment.plan(
+            keys: Self.keys(), template: "/fw/VARS.fd", output: "/vm/nvram.new", scratchDirectory: "/tmp/sb")
+
+        #expect(plan.arguments.starts(with: ["--input", "/fw/VARS.fd", "--output", "/vm/nvram.new"]))
+        #expect(plan.arguments.contains("--delete"))
+        #expect(plan.arguments.last == "--secure-boot")
+        #expect(plan.arguments.count(where: { $0 == "--add-db" }) == 2)
+        #expect(!plan.arguments.contains("--set-dbx"))
+        #expect(Set(plan.files.keys) == ["/tmp/sb/pk.pem", "/tmp/sb/kek-0.pem", "/tmp/sb/db-0.pem", "/tmp/sb/db-1.pem"])
+    }
+
+    @Test("Keeping Microsoft's keys leaves the template's KEK and db, and a dbx is written as a list")
+    func planWithMicrosoftKeysAndDbx() throws {
+        let hash = String(repeating: "ab", count: 32)
+        let plan = try SecureBootEnrollment.plan(
+            keys: Self.keys(dbx: [hash], includeMicrosoftKeys: true), template: "t", output: "o",
+            scratchDirectory: "/s")
+
+        #expect(!plan.arguments.contains("--delete"))
+        #expect(plan.arguments.contains("--set-dbx"))
+        #expect(plan.files["/s/dbx.esl"]?.count == 28 + 16 + 32)
+    }
+
+    @Test("Malformed certificates and dbx entries are refused")
+    func rejectsBadEntries() {
+        let badKEK = SecureBootKeys(ownerGUID: Self.owner, platformKey: Self.pem, keyExchangeKeys: ["nope"])
+        #expect(throws: SecureBootEnrollment.PlanError.invalidCertificate(variable: "KEK", index: 0)) {
+            try SecureBootEnrollment.plan(keys: badKEK, template: "t", output: "o", scratchDirectory: "/s")
+        }
+        #expect(throws: SecureBootEnrollment.PlanError.invalidForbiddenEntry(index: 1)) {
+            try SecureBootEnrollment.signatureList(forbidden: [Self.pem, "abcd"], owner: Self.owner)
+        }
+    }
+
+    @Test("Signature lists carry the spec's header and EFI-ordered GUIDs")
+    func signatureListLayout() throws {
+        let data = try SecureBootEnrollment.signatureList(
+            forbidden: [Self.pem, String(repeating: "00", count: 32)], owner: Self.owner)
+        // The SHA-256 list (28 + 48) then the certificate's (28 + 16 + 4).
+        #expect(data.count == 76 + 48)
+        #expect(Array(data.prefix(4)) == [0x26, 0x16, 0xc4, 0xc1])
+        #expect(Array(data[16..<20]) == [76, 0, 0, 0])
+        #expect(Array(data[24..<28]) == [48, 0, 0, 0])
+        #expect(Array(data[28..<32]) == [0x11, 0x11, 0x11, 0x11])
+        #expect(Array(data.suffix(4)) == [1, 2, 3, 4])
+    }
+
+    @Test("The fingerprint follows the keys")
+    func fingerprint() {
+        let keys = Self.keys()
+        #expect(SecureBootEnrollment.fingerprint(keys) == SecureBootEnrollment.fingerprint(Self.keys()))
+        #expect(
+            SecureBootEnrollment.fingerprint(keys)
+                != SecureBootEnrollment.fingerprint(keys.replacingDatabases(db: [], dbx: [])))
+        #expect(SecureBootEnrollment.fingerprint(keys).count == 64)
+    }
+}
@@ -41,6 +41,76 @@ struct SwtpmSupervisorTests {
         #expect(arguments.contains("--daemon"))
     }
 
+    @Test("A state key encrypts the state with AES-256; without one the state stays plaintext")
+    func keyArguments() throws {
+        let vmDir = "/var/lib/strato/vms/abc"
+        let keyFile = "/var/run/qemu/tpm-keys/abc.key"
+        let arguments = SwtpmSupervisor.arguments(vmDirectory: vmDir, keyFile: keyFile)
+
+        let key = try #require(arguments.firstIndex(of: "--key"))
+        #expect(arguments[key + 1] == "file=\(keyFile),format=hex,mode=aes-256-cbc,remove=false")
+        #expect(arguments.last == "--daemon")
+        #expect(!SwtpmSupervisor.arguments(vmDirectory: vmDir).contains("--key"))
+    }
+
+    @Test("State keys are installed owner-only, rewritten only when they change, and removed on request")
+    func keyInstallation() throws {
+        let keyDirectory = try makeTempDirectory() + "/tpm-keys"
+        defer { try? FileManager.default.removeItem(atPath: (keyDirectory as NSString).deletingLastPathComponent) }
+        let key = String(repeating: "0f", count: 32)
+        let path = SwtpmSupervisor.keyFilePath(keyDirectory: keyDirectory, vmId: "vm-1")
+
+        #expect(try SwtpmSupervisor.installKey(key, vmId: "vm-1", keyDirectory: keyDirectory))
+        #expect(try String(contentsOfFile: path, encoding: .utf8) == key)
+        let permissions = try FileManager.default.attributesOfItem(atPath: path)[.posixPermissions] as? Int
+        #expect(permissions == 0o600)
+        // Every sync re-sends the key; an unchanged one is left alone.
+        #expect(try !SwtpmSupervisor.installKey(key, vmId: "vm-1", keyDirectory: keyDirectory))
+
+        let replacement = String(repeating: "a0", count: 32)
+        #expect(try SwtpmSupervisor.installKey(replacement, vmId: "vm-1", keyDirectory: keyDirectory))
+        #expect(try String(contentsOfFile: path, encoding: .utf8) == replacement)
+
+        #expect(throws: SwtpmSupervisor.SwtpmError.self) {
+            try SwtpmSupervisor.installKey("not-a-key", vmId: "vm-2", keyDirectory: keyDirectory)
+        }
+
+        SwtpmSupervisor.removeKey(vmId: "vm-1", keyDirectory: keyDirectory)
+        #expect(!FileManager.default.fileExists(atPath: path))
+    }
+
+    @Test("Once a VM's state is encrypted, starting it without the key fails instead of wiping the TPM")
+    func encryptedStateNeedsItsKey() async throws {
+        let root = try makeTempDirectory()
+        defer { try? FileManager.default.removeItem(atPath: root) }
+        let vmDir = root + "/vm-1"
+        let keyDirectory = root + "/tpm-keys"
+        let marker = SwtpmSupervisor.encryptedMarkerPath(vmDirectory: vmDir)
+        let supervisor = SwtpmSupervisor(
+            binaryPath: "/nonexistent/swtpm", keyDirectory: keyDirectory, logger: Logger(label: "test"))
+
+        // A keyed start records the encryption before swtpm can write state,
+        // so even this launch, which fails, leaves the marker behind.
+        try SwtpmSupervisor.installKey(String(repeating: "0f", count: 32), vmId: "vm-1", keyDirectory: keyDirectory)
+        await #expect(throws: SwtpmSupervisor.SwtpmError.self) {
+            try await supervisor.ensureRunning(vmDirectory: vmDir, vmId: "vm-1")
+        }
+        #expect(FileManager.default.fileExists(atPath: marker))
+
+        SwtpmSupervisor.removeKey(vmId: "vm-1", keyDirectory: keyDirectory)
+        var thrown: (any Error)?
+        do {
+            try await supervisor.ensureRunning(vmDirectory: vmDir, vmId: "vm-1")
+        } catch {
+            thrown = error
+        }
+        guard case .keyMissing(let vmId) = thrown as? SwtpmSupervisor.SwtpmError else {
+            Issue.record("expected keyMissing, got \(String(describing: thrown))")
+            return
+        }
+        #expect(vmId == "vm-1")
+    }
+
     @Test("No pid file means nothing is running")
     func noPIDFileMeansStopped() throws {
         let vmDir = try makeTempDirectory()
@@ -0,0 +1,91 @@
+import Foundation
+import Testing
+
+@testable import StratoAgentCore
+import StratoShared
+
+/// VM health-check bookkeeping (wire v31): when probes are due, the failure
+/// threshold, the boot grace period, and starting over when a VM stops or its
+/// check changes.
+@Suite("VM Health Tracker")
+struct VMHealthTrackerTests {
+
+    private static func check(threshold: Int = 3, grace: Int = 0, port: Int = 8080) -> VMHealthCheck {
+        VMHealthCheck(
+            kind: .http, port: port, path: "/healthz", intervalSeconds: 10, timeoutSeconds: 2,
+            failureThreshold: threshold, gracePeriodSeconds: grace)
+    }
+
+    private static let start = Date(timeIntervalSince1970: 1_800_000_000)
+
+    @Test("Failures turn a VM unhealthy only at the threshold, and one pass turns it healthy")
+    func thresholdAndRecovery() {
+        var tracker = VMHealthTracker()
+        tracker.configure(["vm": Self.check()], now: Self.start)
+        #expect(tracker.due(at: Self.start).map(\.vmId) == ["vm"])
+
+        #expect(!tracker.record(vmId: "vm", failure: "refused", at: Self.start))
+        #expect(tracker.due(at: Self.start.addingTimeInterval(5)).isEmpty)
+        #expect(!tracker.record(vmId: "vm", failure: "refused", at: Self.start.addingTimeInterval(10)))
+        #expect(tracker.observation(for: "vm") == nil)
+
+        #expect(tracker.record(vmId: "vm", failure: "refused", at: Self.start.addingTimeInterval(20)))
+        let unhealthy = tracker.observation(for: "vm")
+        #expect(unhealthy?.status == .unhealthy)
+        #expect(unhealthy?.consecutiveFailures == 3)
+        #expect(unhealthy?.message == "refused")
+
+        #expect(!tracker.record(vmId: "vm", failure: "refused", at: Self.start.addingTimeInterval(30)))
+        #expect(tracker.record(vmId: "vm", failure: nil, at: Self.start.addingTimeInterval(40)))
+        #expect(tracker.observation(for: "vm")?.status == .healthy)
+        #expect(tracker.observation(for: "vm")?.consecutiveFailures == 0)
+    }
+
+    @Test("Failures during the grace period don't count until the application first answers")
+    func gracePeriod() {
+        var tracker = VMHealthTracker()
+        tracker.configure(["vm": Self.check(threshold: 1, grace: 60)], now: Self.start)
+        #expect(!tracker.record(vmId: "vm", failure: "refused", at: Self.start.addingTimeInterval(30)))
+        #expect(tracker.observation(for: "vm") == nil)
+        #expect(tracker.record(vmId: "vm", failure: "refused", at: Self.start.addingTimeInterval(61)))
+        #expect(tracker.observation(for: "vm")?.status == .unhealthy)
+
+        // A pass inside the grace period ends it: the next failure counts.
+        tracker.configure([:], now: Self.start)
+        tracker.configure(["vm": Self.check(threshold: 1, grace: 60)], now: Self.start)
+        tracker.record(vmId: "vm", failure: nil, at: Self.start.addingTimeInterval(5))
+        #expect(tracker.record(vmId: "vm", failure: "refused", at: Self.start.addingTimeInterval(15)))
+    }
+
+    @Test("A VM dropping out or changing its check starts over")
+    func reconfigureStartsOver() {
+        var tracker = VMHealthTracker()
+        tracker.configure(["a": Self.check(threshold: 1), "b": Self.check(threshold: 1)], now: Self.start)
+        tracker.record(vmId: "a", failure: "refused", at: Self.start)
+        tracker.record(vmId: "b", failure: "refused", at: Self.start)
+
+        let later = Self.start.addingTimeInterval(1)
+        tracker.configure(["a": Self.check(threshold: 1), "b": Self.check(threshold: 1, port: 9090)], now: later)
+        #expect(tracker.observation(for: "a")?.status == .unhealthy)
+        #expect(tracker.observation(for: "b") == nil)
+        #expect(tracker.due(at: later).map(\.vmId) == ["b"])
+
+        tracker.configure([:], now: later)
+        #expect(tracker.observation(for: "a") == nil)
+        #expect(!tracker.record(vmId: "a", failure: nil, at: later))
+    }
+
+    @Test("TCP and HTTP checks dial the first NIC's allocated address")
+    func targetAddress() {
+        let v4 = VMSpec(
+            cpus: 1, memoryBytes: 1 << 30, boot: .disk(firmware: nil),
+            networks: [NetworkSpec(network: "default", ipAddress: "10.0.0.5", ipv6Address: "fd00::5")])
+        #expect(VMHealthProber.targetAddress(of: v4) == "10.0.0.5")
+        let v6 = VMSpec(
+            cpus: 1, memoryBytes: 1 << 30, boot: .disk(firmware: nil),
+            networks: [NetworkSpec(network: "default", ipv6Address: "fd00::5")])
+        #expect(VMHealthProber.targetAddress(of: v6) == "fd00::5")
+        let unaddressed = VMSpec(cpus: 1, memoryBytes: 1 << 30, boot: .disk(firmware: nil))
+        #expect(VMHealthProber.targetAddress(of: unaddressed) == nil)
+    }
+}
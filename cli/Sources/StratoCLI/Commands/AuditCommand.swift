@@ -0,0 +1,121 @@
+import ArgumentParser
+import Foundation
+import StratoCLICore
+
+struct AuditCommand: AsyncParsableCommand {
+    static let configuration = CommandConfiguration(
+        commandName: "audit",
+        abstract: "Query the audit trail.",
+        subcommands: [Query.self, Searches.self]
+    )
+
+    struct Query: AsyncParsableCommand {
+        static let configuration = CommandConfiguration(
+            abstract: "Run an audit query over an organization's events, or with --all the whole trail.")
+
+        @OptionGroup var global: GlobalOptions
+
+        @Argument(help: "The query, e.g. 'status >= 400 | count by actor'. Omit it to run --saved.")
+        var query: String?
+
+        @Option(name: .long, help: "Organization id (defaults to the context's organization).")
+        var org: String?
+
+        @Option(name: .long, help: "Run the organization's saved search with this name.")
+        var saved: String?
+
+        @Flag(name: .long, help: "Query the whole trail (system administrators only).")
+        var all = false
+
+        @Option(name: .long, help: "Maximum events to return (1-500).")
+        var limit = 50
+
+        @Option(name: .long, help: "Events to skip.")
+        var offset = 0
+
+        func run() async throws {
+            try await runHandlingCLIErrors {
+                guard (query == nil) != (saved == nil) else {
+                    throw CLIError.config("Pass either a query or --saved <name>.")
+                }
+                if all && (org != nil || saved != nil) {
+                    throw CLIError.config("--all can't be combined with --org or --saved.")
+                }
+                let environment = try CLIEnvironment.resolve(global)
+                let client = environment.makeClient()
+                let organizationId = all ? nil : org ?? environment.context.organization
+
+                var source = query ?? ""
+                if let saved {
+                    guard let organizationId else {
+                        throw CLIError.config(
+                            "Saved searches belong to an organization. Pass --org <id> or set one on the context.")
+                    }
+                    let searches: [AuditSavedSearch] = try await client
+                        .get("/api/organizations/\(organizationId)/audit-searches")
+                    guard let search = searches.first(where: { $0.name == saved }) else {
+                        throw CLIError.config("No saved search named '\(saved)' in organization \(organizationId).")
+                    }
+                    source = search.query
+                }
+
+                let path = organizationId.map { "/api/organizations/\($0)/audit-events/query" }
+                    ?? "/api/audit-events/query"
+                let result: AuditQueryResult = try await client.get(
+                    path, query: [("q", source), ("limit", String(limit)), ("offset", String(offset))])
+                try printResult(result, format: global.output) { Self.table(for: result) }
+            }
+        }
+
+        static func table(for result: AuditQueryResult) -> TextTable {
+            if let groups = result.groups {
+                let fields = result.groupBy ?? []
+                var table = TextTable(headers: fields + ["count"])
+                for group in groups {
+                    table.addRow(fields.map { group.key[$0] ?? "-" } + [String(group.count)])
+                }
+                return table
+            }
+            var table = TextTable(headers: ["time", "type", "actor", "resource", "action", "status"])
+            for event in result.events ?? [] {
+                let actor = event.username ?? event.actorID.map { "\(event.actorType):\(formatUUID($0))" }
+                    ?? event.actorType
+                let resource = [event.resourceType, event.resourceID].compactMap { $0 }.joined(separator: "/")
+                table.addRow([
+                    formatDate(event.createdAt), event.eventType, actor, resource, event.action ?? "",
+                    event.status.map(String.init) ?? "",
+                ])
+            }
+            return table
+        }
+    }
+
+    struct Searches: AsyncParsableCommand {
+        static let configuration = CommandConfiguration(
+            abstract: "List an organization's saved audit searches.")
+
+        @OptionGroup var global: GlobalOptions
+
+        @Option(name: .long, help: "Organization id (defaults to the context's organization).")
+        var org: String?
+
+        func run() async throws {
+            try await runHandlingCLIErrors {
+                let environment = try CLIEnvironment.resolve(global)
+                guard let organizationId = org ?? environment.context.organization else {
+                    throw CLIError.config(
+                        "No organization specified. Pass --org <id> or set one on the context.")
+                }
+                let searches: [AuditSavedSearch] = try await environment.makeClient()
+                    .get("/api/organizations/\(organizationId)/audit-searches")
+                try printResult(searches, format: global.output) {
+                    var table = TextTable(headers: ["name", "query", "description"])
+                    for search in searches {
+                        table.addRow([search.name, search.query, search.description ?? ""])
+                    }
+                    return table
+                }
+            }
+        }
+    }
+}
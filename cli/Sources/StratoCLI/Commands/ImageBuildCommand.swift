@@ -0,0 +1,255 @@
+import ArgumentParser
+import Foundation
+import StratoCLICore
+
+struct ImageBuildCommand: AsyncParsableCommand {
+    static let configuration = CommandConfiguration(
+        commandName: "build",
+        abstract: "Build images server-side: provision a VM from a base image and capture its disk.",
+        subcommands: [List.self, Get.self, Create.self, Cancel.self, Delete.self],
+        defaultSubcommand: List.self
+    )
+
+    static let finishedStatuses: Set<String> = ["succeeded", "failed", "cancelled"]
+
+    static func table(for builds: [ImageBuild]) -> TextTable {
+        var table = TextTable(headers: ["id", "name", "target", "status", "steps", "image", "created"])
+        for build in builds {
+            table.addRow([
+                formatUUID(build.id), build.name, build.targetImageName, build.status,
+                "\(build.completedSteps)/\(build.totalSteps)", formatUUID(build.imageId),
+                formatDate(build.createdAt),
+            ])
+        }
+        return table
+    }
+
+    struct List: AsyncParsableCommand {
+        static let configuration = CommandConfiguration(abstract: "List a project's image builds.")
+
+        @OptionGroup var global: GlobalOptions
+
+        @Option(name: .long, help: "Project id (defaults to the context's project).")
+        var project: String?
+
+        func run() async throws {
+            try await runHandlingCLIErrors {
+                let environment = try CLIEnvironment.resolve(global)
+                let projectID = try resolveProject(project, environment: environment)
+                let page: Page<ImageBuild> = try await environment.makeClient()
+                    .get("/api/projects/\(projectID)/image-builds", query: [("limit", String(listPageLimit))])
+                try printResult(page.items, format: global.output) { ImageBuildCommand.table(for: page.items) }
+            }
+        }
+    }
+
+    struct Get: AsyncParsableCommand {
+        static let configuration = CommandConfiguration(abstract: "Show one image build and its log.")
+
+        @OptionGroup var global: GlobalOptions
+
+        @Argument(help: "Image build id.")
+        var id: String
+
+        @Option(name: .long, help: "Project id (defaults to the context's project).")
+        var project: String?
+
+        func run() async throws {
+            try await runHandlingCLIErrors {
+                let environment = try CLIEnvironment.resolve(global)
+                let projectID = try resolveProject(project, environment: environment)
+                let build: ImageBuild = try await environment.makeClient()
+                    .get("/api/projects/\(projectID)/image-builds/\(id)")
+                try printResult(build, format: global.output) {
+                    var table = TextTable(headers: ["field", "value"])
+                    table.addRow(["id", formatUUID(build.id)])
+                    table.addRow(["name", build.name])
+                    table.addRow(["status", build.status])
+                    table.addRow(["base image", formatUUID(build.baseImageId)])
+                    table.addRow(["target", build.targetImageName])
+                    table.addRow(["steps", "\(build.completedSteps)/\(build.totalSteps)"])
+                    table.addRow(["vm", formatUUID(build.vmId)])
+                    table.addRow(["image", formatUUID(build.imageId)])
+                    table.addRow(["error", build.errorMessage ?? ""])
+                    table.addRow(["started", formatDate(build.startedAt)])
+                    table.addRow(["finished", formatDate(build.finishedAt)])
+                    return table
+                }
+                if global.output == .table, let log = build.log, !log.isEmpty {
+                    print("")
+                    print(log, terminator: log.hasSuffix("\n") ? "" : "\n")
+                }
+            }
+        }
+    }
+
+    struct Create: AsyncParsableCommand {
+        static let configuration = CommandConfiguration(
+            abstract: "Start an image build.",
+            discussion: """
+                Each --script is a local shell script run in the build VM with /bin/sh -c, in the order \
+                given. For exec steps or per-step timeouts, pass --provisioners with a JSON array of \
+                provisioners instead.
+                """)
+
+        @OptionGroup var global: GlobalOptions
+
+        @Argument(help: "Build name.")
+        var name: String
+
+        @Option(name: .long, help: "Base image id to boot the build VM from.")
+        var baseImage: String
+
+        @Option(name: .long, help: "Name of the image to add a new version to.")
+        var target: String
+
+        @Option(name: .long, help: "Description of the captured image.")
+        var description: String?
+
+        @Option(name: .long, help: "Project id (defaults to the context's project).")
+        var project: String?
+
+        @Option(name: .long, help: "Environment name.")
+        var environment: String?
+
+        @Option(name: .long, help: "Path to a shell script to run in the build VM. Repeatable.")
+        var script: [String] = []
+
+        @Option(name: .long, help: "Path to a JSON array of provisioners.")
+        var provisioners: String?
+
+        @Option(name: .long, help: "Path to cloud-init user data for the build VM.")
+        var userDataFile: String?
+
+        @Option(name: .long, help: "Build network id (defaults to the project's default network).")
+        var network: String?
+
+        @Option(name: .long, help: "vCPU count.")
+        var cpu: Int?
+
+        @Option(name: .long, help: "Memory in bytes.")
+        var memory: Int64?
+
+        @Option(name: .long, help: "Disk in bytes; also the captured image's default disk size.")
+        var disk: Int64?
+
+        @Flag(name: .long, help: "Wait for the build to finish.")
+        var wait = false
+
+        @Option(name: .long, help: "With --wait, give up after this many seconds.")
+        var timeout: Double = 3600
+
+        func run() async throws {
+            try await runHandlingCLIErrors {
+                if !script.isEmpty && provisioners != nil {
+                    throw CLIError.config("Pass either --script or --provisioners, not both.")
+                }
+                let env = try CLIEnvironment.resolve(global)
+                let projectID = try resolveProject(project, environment: env)
+                let client = env.makeClient()
+
+                var steps: [ImageBuildProvisioner]?
+                if let provisioners {
+                    let data = try Data(contentsOf: URL(fileURLWithPath: provisioners))
+                    do {
+                        steps = try JSONDecoder().decode([ImageBuildProvisioner].self, from: data)
+                    } catch {
+                        throw CLIError.config("\(provisioners) is not a JSON array of provisioners: \(error)")
+                    }
+                } else if !script.isEmpty {
+                    steps = try script.map { path in
+                        ImageBuildProvisioner(
+                            kind: "shell", script: try String(contentsOfFile: path, encoding: .utf8),
+                            command: nil, timeoutSeconds: nil)
+                    }
+                }
+                let userData = try userDataFile.map { try String(contentsOfFile: $0, encoding: .utf8) }
+
+                let request = CreateImageBuildRequest(
+                    name: name, baseImageId: baseImage, targetImageName: target,
+                    targetImageDescription: description, environment: environment, userData: userData,
+                    provisioners: steps, networkId: network, cpu: cpu, memory: memory, disk: disk
+                )
+                var build: ImageBuild = try await client.post(
+                    "/api/projects/\(projectID)/image-builds", body: request)
+                if wait, let buildID = build.id {
+                    build = try await waitForBuild(buildID, projectID: projectID, client: client)
+                }
+                try printResult(build, format: global.output) { ImageBuildCommand.table(for: [build]) }
+            }
+        }
+
+        /// Polls the build until it finishes, printing each status change,
+        /// and fails unless it succeeded.
+        private func waitForBuild(_ buildID: UUID, projectID: String, client: APIClient) async throws -> ImageBuild {
+            let deadline = Date().addingTimeInterval(timeout)
+            var lastStatus = ""
+            while true {
+                let build: ImageBuild = try await client.get("/api/projects/\(projectID)/image-builds/\(buildID)")
+                if build.status != lastStatus {
+                    FileHandle.standardError.write(Data("Build \(formatUUID(buildID)): \(build.status)\n".utf8))
+                    lastStatus = build.status
+                }
+                if ImageBuildCommand.finishedStatuses.contains(build.status) {
+                    if build.status != "succeeded" {
+                        throw CLIError.operationFailed(
+                            kind: "image build", message: build.errorMessage ?? build.status)
+                    }
+                    return build
+                }
+                guard Date() < deadline else {
+                    throw CLIError.timedOut(
+                        "Timed out after \(Int(timeout))s waiting for image build \(buildID); "
+                            + "check it later with 'strato image build get \(buildID)'.")
+                }
+                try await Task.sleep(nanoseconds: 5_000_000_000)
+            }
+        }
+    }
+
+    struct Cancel: AsyncParsableCommand {
+        static let configuration = CommandConfiguration(
+            abstract: "Cancel an image build and delete its VM.")
+
+        @OptionGroup var global: GlobalOptions
+
+        @Argument(help: "Image build id.")
+        var id: String
+
+        @Option(name: .long, help: "Project id (defaults to the context's project).")
+        var project: String?
+
+        func run() async throws {
+            try await runHandlingCLIErrors {
+                let environment = try CLIEnvironment.resolve(global)
+                let projectID = try resolveProject(project, environment: environment)
+                let build: ImageBuild = try await environment.makeClient()
+                    .post("/api/projects/\(projectID)/image-builds/\(id)/cancel")
+                try printResult(build, format: global.output) { ImageBuildCommand.table(for: [build]) }
+            }
+        }
+    }
+
+    struct Delete: AsyncParsableCommand {
+        static let configuration = CommandConfiguration(
+            abstract: "Delete a finished image build. The image it produced is kept.")
+
+        @OptionGroup var global: GlobalOptions
+
+        @Argument(help: "Image build id.")
+        var id: String
+
+        @Option(name: .long, help: "Project id (defaults to the context's project).")
+        var project: String?
+
+        func run() async throws {
+            try await runHandlingCLIErrors {
+                let environment = try CLIEnvironment.resolve(global)
+                let projectID = try resolveProject(project, environment: environment)
+                try await environment.makeClient()
+                    .deleteExpectingNoContent("/api/projects/\(projectID)/image-builds/\(id)")
+                print("Image build \(id) deleted.")
+            }
+        }
+    }
+}
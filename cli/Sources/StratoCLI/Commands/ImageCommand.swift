@@ -6,7 +6,7 @@ struct ImageCommand: AsyncParsableCommand {
     static let configuration = CommandConfiguration(
         commandName: "image",
         abstract: "Manage VM images (project-scoped).",
-        subcommands: [List.self, Get.self, Delete.self],
+        subcommands: [List.self, Get.self, Delete.self, ImageBuildCommand.self],
         defaultSubcommand: List.self
     )
 
@@ -27,10 +27,10 @@ struct ImageCommand: AsyncParsableCommand {
                 let images = page.items
                 try printResult(images, format: global.output) {
                     var table = TextTable(
-                        headers: ["id", "name", "format", "arch", "size", "status", "created"])
+                        headers: ["id", "name", "version", "format", "arch", "size", "status", "created"])
                     for image in images {
                         table.addRow([
-                            formatUUID(image.id), image.name, image.format ?? "",
+                            formatUUID(image.id), image.name, image.version.map(String.init) ?? "", image.format ?? "",
                             image.architecture ?? "", image.sizeFormatted ?? "",
                             image.status ?? "", formatDate(image.createdAt),
                         ])
@@ -63,10 +63,12 @@ struct ImageCommand: AsyncParsableCommand {
                     table.addRow(["id", formatUUID(image.id)])
                     table.addRow(["name", image.name])
                     table.addRow(["description", image.description ?? ""])
+                    table.addRow(["version", image.version.map(String.init) ?? ""])
                     table.addRow(["format", image.format ?? ""])
                     table.addRow(["architecture", image.architecture ?? ""])
                     table.addRow(["size", image.sizeFormatted ?? ""])
                     table.addRow(["status", image.status ?? ""])
+                    table.addRow(["image build", formatUUID(image.imageBuildId)])
                     table.addRow(["created", formatDate(image.createdAt)])
                     return table
                 }
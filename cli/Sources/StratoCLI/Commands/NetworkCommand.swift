@@ -26,7 +26,7 @@ struct NetworkCommand: AsyncParsableCommand {
                         headers: ["id", "name", "subnet", "gateway", "dhcp", "attached", "default"])
                     for network in networks {
                         table.addRow([
-                            formatUUID(network.id), network.name, network.subnet,
+                            formatUUID(network.id), network.name, network.subnet ?? network.subnet6 ?? "",
                             network.gateway ?? "",
                             (network.dhcpEnabled ?? false) ? "yes" : "no",
                             network.attachedInterfaceCount.map(String.init) ?? "",
@@ -55,7 +55,7 @@ struct NetworkCommand: AsyncParsableCommand {
                     var table = TextTable(headers: ["field", "value"])
                     table.addRow(["id", formatUUID(network.id)])
                     table.addRow(["name", network.name])
-                    table.addRow(["subnet", network.subnet])
+                    table.addRow(["subnet", network.subnet ?? ""])
                     table.addRow(["gateway", network.gateway ?? ""])
                     table.addRow(["ipv6 subnet", network.subnet6 ?? ""])
                     table.addRow(["dhcp", (network.dhcpEnabled ?? false) ? "enabled" : "disabled"])
@@ -76,8 +76,10 @@ struct NetworkCommand: AsyncParsableCommand {
         @Argument(help: "Network name.")
         var name: String
 
-        @Option(name: .long, help: "IPv4 subnet in CIDR form, e.g. 10.1.0.0/24.")
-        var subnet: String
+        @Option(
+            name: .long,
+            help: "IPv4 subnet in CIDR form, e.g. 10.1.0.0/24. Omit for an IPv6-only network (no IPv4 egress).")
+        var subnet: String?
 
         @Option(name: .long, help: "Gateway address (defaults to the subnet's first host).")
         var gateway: String?
@@ -21,6 +21,7 @@ struct Strato: AsyncParsableCommand {
             OrgCommand.self,
             QuotaCommand.self,
             OperationCommand.self,
+            AuditCommand.self,
         ]
     )
 }
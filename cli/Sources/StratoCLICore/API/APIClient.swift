@@ -23,6 +23,11 @@ public actor APIClient {
         self.transport = transport
     }
 
+    /// The API version the CLI's models are written against, sent as
+    /// `Strato-API-Version` on every request so a later server default
+    /// doesn't change the shapes under it.
+    public static let apiVersion = "1"
+
     // MARK: - JSON coding (matches Vapor's defaults: ISO8601 dates)
 
     public static func jsonDecoder() -> JSONDecoder {
@@ -123,6 +128,7 @@ public actor APIClient {
         var headers = [
             "Authorization": "Bearer \(accessToken)",
             "Accept": "application/json",
+            "Strato-API-Version": Self.apiVersion,
         ]
         if jsonBody != nil {
             headers["Content-Type"] = "application/json"
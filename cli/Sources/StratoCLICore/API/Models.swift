@@ -73,13 +73,54 @@ public struct Image: Codable, Sendable {
     public let format: String?
     public let architecture: String?
     public let status: String?
+    /// Position among the project's images of the same name, from 1.
+    public let version: Int?
+    public let imageBuildId: UUID?
     public let createdAt: Date?
 }
 
+/// One step of an image build, run in the build VM through the guest agent:
+/// `script` under `/bin/sh -c` for `shell`, `command` as-is for `exec`.
+public struct ImageBuildProvisioner: Codable, Sendable {
+    public let kind: String
+    public let script: String?
+    public let command: [String]?
+    public let timeoutSeconds: Int?
+
+    public init(kind: String, script: String?, command: [String]?, timeoutSeconds: Int?) {
+        self.kind = kind
+        self.script = script
+        self.command = command
+        self.timeoutSeconds = timeoutSeconds
+    }
+}
+
+public struct ImageBuild: Codable, Sendable {
+    public let id: UUID?
+    public let projectId: UUID
+    public let name: String
+    public let status: String
+    public let baseImageId: UUID?
+    public let targetImageName: String
+    public let provisioners: [ImageBuildProvisioner]
+    public let completedSteps: Int
+    public let totalSteps: Int
+    public let vmId: UUID?
+    public let imageId: UUID?
+    public let errorMessage: String?
+    public let cancelRequested: Bool
+    public let startedAt: Date?
+    public let finishedAt: Date?
+    public let createdAt: Date?
+    /// Only on single-build reads.
+    public let log: String?
+}
+
 public struct Network: Codable, Sendable {
     public let id: UUID?
     public let name: String
-    public let subnet: String
+    /// Nil on an IPv6-only network.
+    public let subnet: String?
     public let gateway: String?
     public let subnet6: String?
     public let projectId: UUID?
@@ -131,6 +172,52 @@ public struct Organization: Codable, Sendable {
     public let userRole: String?
 }
 
+public struct AuditEvent: Codable, Sendable {
+    public let id: UUID?
+    public let eventType: String
+    public let actorType: String
+    public let actorID: UUID?
+    public let username: String?
+    public let organizationID: UUID?
+    public let method: String?
+    public let path: String?
+    public let status: Int?
+    public let resourceType: String?
+    public let resourceID: String?
+    public let action: String?
+    public let sourceIP: String?
+    public let adminBypass: Bool
+    public let metadata: [String: String]?
+    public let createdAt: Date?
+}
+
+/// One page of events matching an audit query, or — for a `| count` query —
+/// the match counts per group, largest first.
+public struct AuditQueryResult: Codable, Sendable {
+    public let query: String
+    public let events: [AuditEvent]?
+    public let groupBy: [String]?
+    public let groups: [AuditQueryGroup]?
+    public let total: Int
+    public let limit: Int
+    public let offset: Int
+}
+
+public struct AuditQueryGroup: Codable, Sendable {
+    /// Grouped field → value; a field whose value is missing is absent.
+    public let key: [String: String]
+    public let count: Int
+}
+
+public struct AuditSavedSearch: Codable, Sendable {
+    public let id: UUID
+    public let organizationId: UUID
+    public let name: String
+    public let description: String?
+    public let query: String
+    public let createdAt: Date?
+}
+
 public struct QuotaLimits: Codable, Sendable {
     public let maxVCPUs: Int?
     public let maxMemoryGB: Double?
@@ -183,6 +270,38 @@ public struct CreateVMRequest: Codable, Sendable {
     }
 }
 
+public struct CreateImageBuildRequest: Codable, Sendable {
+    public let name: String
+    public let baseImageId: String
+    public let targetImageName: String
+    public let targetImageDescription: String?
+    public let environment: String?
+    public let userData: String?
+    public let provisioners: [ImageBuildProvisioner]?
+    public let networkId: String?
+    public let cpu: Int?
+    public let memory: Int64?
+    public let disk: Int64?
+
+    public init(
+        name: String, baseImageId: String, targetImageName: String, targetImageDescription: String?,
+        environment: String?, userData: String?, provisioners: [ImageBuildProvisioner]?,
+        networkId: String?, cpu: Int?, memory: Int64?, disk: Int64?
+    ) {
+        self.name = name
+        self.baseImageId = baseImageId
+        self.targetImageName = targetImageName
+        self.targetImageDescription = targetImageDescription
+        self.environment = environment
+        self.userData = userData
+        self.provisioners = provisioners
+        self.networkId = networkId
+        self.cpu = cpu
+        self.memory = memory
+        self.disk = disk
+    }
+}
+
 public struct CreateSandboxRequest: Codable, Sendable {
     public let name: String
     public let image: String?
@@ -229,12 +348,12 @@ public struct CreateVolumeRequest: Codable, Sendable {
 
 public struct CreateNetworkRequest: Codable, Sendable {
     public let name: String
-    public let subnet: String
+    public let subnet: String?
     public let gateway: String?
     public let projectId: String?
     public let dhcpEnabled: Bool?
 
-    public init(name: String, subnet: String, gateway: String?, projectId: String?, dhcpEnabled: Bool?) {
+    public init(name: String, subnet: String?, gateway: String?, projectId: String?, dhcpEnabled: Bool?) {
         self.name = name
         self.subnet = subnet
         self.gateway = gateway
@@ -33,6 +33,7 @@ struct APIClientTests {
 
             let request = try #require(transport.recordedRequests.first)
             #expect(request.headers["Authorization"] == "Bearer st_old")
+            #expect(request.headers["Strato-API-Version"] == APIClient.apiVersion)
         }
     }
 
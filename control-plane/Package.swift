@@ -59,6 +59,8 @@ let package = Package(
         // TLS primitives for the SPIRE server mTLS verification callback
         // (already in the graph transitively via grpc-swift-nio-transport)
         .package(url: "https://github.com/apple/swift-nio-ssl.git", from: "2.29.0"),
+        // SSH server for the console gateway (`ssh <vm-id>@console…`)
+        .package(url: "https://github.com/apple/swift-nio-ssh.git", from: "0.9.0"),
         // ☁️ S3-compatible object storage for images (IMAGE_STORAGE_BACKEND=s3).
         // Any S3 API implementation works — AWS, MinIO, Garage, R2, Ceph RGW —
         // via IMAGE_S3_ENDPOINT; we don't bundle a service.
@@ -105,6 +107,7 @@ let package = Package(
                 .product(name: "NIOCore", package: "swift-nio"),
                 .product(name: "NIOPosix", package: "swift-nio"),
                 .product(name: "NIOWebSocket", package: "swift-nio"),
+                .product(name: "NIOSSH", package: "swift-nio-ssh"),
                 .product(name: "WebAuthn", package: "webauthn-swift"),
                 .product(name: "SwiftSCIM", package: "swift-scim"),
                 .product(name: "JWT", package: "jwt"),
@@ -141,10 +144,13 @@ let package = Package(
                 .product(name: "VaporTesting", package: "vapor"),
                 .product(name: "FluentPostgresDriver", package: "fluent-postgres-driver"),
                 .product(name: "X509", package: "swift-certificates"),
+                .product(name: "NIOSSH", package: "swift-nio-ssh"),
                 .product(name: "GRPCCore", package: "grpc-swift-2"),
                 .product(name: "GRPCNIOTransportHTTP2Posix", package: "grpc-swift-nio-transport"),
                 .product(name: "GRPCProtobuf", package: "grpc-swift-protobuf"),
             ],
+            // Read from the source tree by `APIContractTests`, not bundled.
+            exclude: ["APIContracts"],
             swiftSettings: testSwiftSettings
         ),
     ],
@@ -0,0 +1,74 @@
+import Fluent
+import Vapor
+
+/// The published API versions, and who still calls the deprecated ones.
+///
+/// - `GET /api/api-versions` — any authenticated caller: each version, its
+///   deprecation and sunset dates, and what it changed.
+/// - `GET /api/api-versions/usage` — system administrators: per-credential
+///   request counts in deprecated versions, most recently seen first
+///   (`APIVersionUsageTracker`).
+struct APIVersionController: RouteCollection {
+    func boot(routes: RoutesBuilder) throws {
+        let versions = routes.grouped("api", "api-versions")
+        versions.get(use: list)
+        versions.get("usage", use: usage)
+    }
+
+    func list(req: Request) async throws -> APIVersionListResponse {
+        let published = req.application.apiVersions
+        let latest = published.last ?? .latest
+        return APIVersionListResponse(
+            versions: published.map { APIVersionResponse($0, latest: latest) },
+            latest: latest.number,
+            unversioned: APIVersion.unversioned.number,
+            requested: req.apiVersion.number)
+    }
+
+    struct UsageQuery: Content {
+        var version: Int?
+    }
+
+    func usage(req: Request) async throws -> [APIVersionUsageResponse] {
+        _ = try req.requireSystemAdmin()
+        let query = try req.query.decode(UsageQuery.self)
+        var usage = APIVersionUsage.query(on: req.db)
+        if let version = query.version {
+            usage = usage.filter(\.$apiVersion == version)
+        }
+        return try await usage
+            .sort(\.$lastSeenAt, .descending)
+            .all()
+            .map(APIVersionUsageResponse.init)
+    }
+}
+
+// MARK: - DTOs
+
+struct APIVersionResponse: Content {
+    let version: Int
+    /// `current`, `supported` or `deprecated`.
+    let status: String
+    let deprecatedAt: Date?
+    let sunsetAt: Date?
+    let changes: [String]
+
+    init(_ version: APIVersion, latest: APIVersion) {
+        self.version = version.number
+        self.status =
+            version.isDeprecated ? "deprecated" : version == latest ? "current" : "supported"
+        self.deprecatedAt = version.deprecatedAt
+        self.sunsetAt = version.sunsetAt
+        self.changes = version.changes
+    }
+}
+
+struct APIVersionListResponse: Content {
+    /// Oldest first.
+    let versions: [APIVersionResponse]
+    let latest: Int
+    /// The version a request naming none is served.
+    let unversioned: Int
+    /// The version this request was served in.
+    let requested: Int
+}
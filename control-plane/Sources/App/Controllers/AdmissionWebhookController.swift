@@ -0,0 +1,227 @@
+import Fluent
+import Foundation
+import Vapor
+
+/// An organization's external admission webhooks (see `AdmissionService`).
+///
+/// Org admins only, reads included — the list is the organization's policy
+/// enforcement, and its URLs point into the platform team's infrastructure:
+/// - `GET/POST  /api/organizations/:organizationID/admission-webhooks`
+/// - `GET/PUT/DELETE .../admission-webhooks/:webhookID`
+/// - `POST .../:webhookID/rotate-secret` — new signing secret, shown once.
+struct AdmissionWebhookController: RouteCollection {
+    func boot(routes: RoutesBuilder) throws {
+        let webhooks = routes.grouped("api", "organizations", ":organizationID", "admission-webhooks")
+        webhooks.get(use: list)
+        webhooks.post(use: create)
+        webhooks.group(":webhookID") { webhook in
+            webhook.get(use: get)
+            webhook.put(use: update)
+            webhook.delete(use: delete)
+            webhook.post("rotate-secret", use: rotateSecret)
+        }
+    }
+
+    // MARK: - CRUD
+
+    /// In call order.
+    func list(req: Request) async throws -> [AdmissionWebhookResponse] {
+        let organizationID = try requireOrganizationID(req)
+        try await OrganizationAccessService.requireAdmin(organizationID: organizationID, on: req)
+
+        let webhooks = try await AdmissionWebhook.query(on: req.db)
+            .filter(\.$organization.$id == organizationID)
+            .sort(\.$position)
+            .sort(\.$name)
+            .all()
+        return webhooks.map(AdmissionWebhookResponse.init(from:))
+    }
+
+    /// Without a `position`, the webhook is called after every existing one.
+    func create(req: Request) async throws -> Response {
+        let organizationID = try requireOrganizationID(req)
+        try await OrganizationAccessService.requireAdmin(organizationID: organizationID, on: req)
+        guard let user = req.auth.get(User.self) else {
+            throw Abort(.unauthorized)
+        }
+
+        let request = try req.content.decode(CreateAdmissionWebhookRequest.self)
+        let name = try validateName(request.name)
+        try await validateTargetURL(request.url, on: req)
+        let position: Int
+        if let requested = request.position {
+            position = requested
+        } else {
+            let last = try await AdmissionWebhook.query(on: req.db)
+                .filter(\.$organization.$id == organizationID)
+                .max(\.$position)
+            position = last.map { $0 + 1 } ?? 0
+        }
+
+        let secret = WebhookSubscription.generateSigningSecret()
+        let webhook = AdmissionWebhook(
+            organizationID: organizationID,
+            name: name,
+            url: request.url,
+            position: position,
+            resourceKinds: try validateResourceKinds(request.resourceKinds ?? []),
+            operations: try validateOperations(request.operations ?? []),
+            failurePolicy: request.failurePolicy ?? .fail,
+            timeoutSeconds: try validateTimeout(request.timeoutSeconds ?? AdmissionWebhook.defaultTimeoutSeconds),
+            signingSecret: try req.secretsEncryption.encrypt(secret),
+            createdByID: try user.requireID()
+        )
+        try await save(webhook, on: req.db)
+
+        let body = AdmissionWebhookWithSecretResponse(
+            webhook: AdmissionWebhookResponse(from: webhook),
+            signingSecret: secret)
+        let response = Response(status: .created)
+        try response.content.encode(body)
+        return response
+    }
+
+    func get(req: Request) async throws -> AdmissionWebhookResponse {
+        let webhook = try await requireWebhook(req)
+        try await OrganizationAccessService.requireAdmin(organizationID: webhook.$organization.id, on: req)
+        return AdmissionWebhookResponse(from: webhook)
+    }
+
+    func update(req: Request) async throws -> AdmissionWebhookResponse {
+        let webhook = try await requireWebhook(req)
+        try await OrganizationAccessService.requireAdmin(organizationID: webhook.$organization.id, on: req)
+
+        let request = try req.content.decode(UpdateAdmissionWebhookRequest.self)
+        if let name = request.name {
+            webhook.name = try validateName(name)
+        }
+        if let url = request.url {
+            try await validateTargetURL(url, on: req)
+            webhook.url = url
+        }
+        if let position = request.position {
+            webhook.position = position
+        }
+        if let resourceKinds = request.resourceKinds {
+            webhook.resourceKinds = try validateResourceKinds(resourceKinds)
+        }
+        if let operations = request.operations {
+            webhook.operations = try validateOperations(operations)
+        }
+        if let failurePolicy = request.failurePolicy {
+            webhook.failurePolicy = failurePolicy.rawValue
+        }
+        if let timeoutSeconds = request.timeoutSeconds {
+            webhook.timeoutSeconds = try validateTimeout(timeoutSeconds)
+        }
+        if let isActive = request.isActive {
+            webhook.isActive = isActive
+        }
+        try await save(webhook, on: req.db)
+        return AdmissionWebhookResponse(from: webhook)
+    }
+
+    func delete(req: Request) async throws -> HTTPStatus {
+        let webhook = try await requireWebhook(req)
+        try await OrganizationAccessService.requireAdmin(organizationID: webhook.$organization.id, on: req)
+
+        try await webhook.delete(on: req.db)
+        return .noContent
+    }
+
+    // MARK: - Secret rotation
+
+    func rotateSecret(req: Request) async throws -> AdmissionWebhookWithSecretResponse {
+        let webhook = try await requireWebhook(req)
+        try await OrganizationAccessService.requireAdmin(organizationID: webhook.$organization.id, on: req)
+
+        let secret = WebhookSubscription.generateSigningSecret()
+        webhook.signingSecret = try req.secretsEncryption.encrypt(secret)
+        try await webhook.save(on: req.db)
+
+        return AdmissionWebhookWithSecretResponse(
+            webhook: AdmissionWebhookResponse(from: webhook),
+            signingSecret: secret)
+    }
+
+    // MARK: - Helpers
+
+    private func requireOrganizationID(_ req: Request) throws -> UUID {
+        guard let raw = req.parameters.get("organizationID"), let id = UUID(uuidString: raw) else {
+            throw Abort(.badRequest, reason: "Invalid organization ID")
+        }
+        return id
+    }
+
+    private func requireWebhook(_ req: Request) async throws -> AdmissionWebhook {
+        let organizationID = try requireOrganizationID(req)
+        guard let raw = req.parameters.get("webhookID"), let id = UUID(uuidString: raw) else {
+            throw Abort(.badRequest, reason: "Invalid admission webhook ID")
+        }
+        guard
+            let webhook = try await AdmissionWebhook.query(on: req.db)
+                .filter(\.$id == id)
+                .filter(\.$organization.$id == organizationID)
+                .first()
+        else {
+            throw Abort(.notFound, reason: "Admission webhook not found")
+        }
+        return webhook
+    }
+
+    private func save(_ webhook: AdmissionWebhook, on db: Database) async throws {
+        do {
+            try await webhook.save(on: db)
+        } catch let error as any DatabaseError where error.isConstraintFailure {
+            throw Abort(.conflict, reason: "An admission webhook named '\(webhook.name)' already exists")
+        }
+    }
+
+    private func validateName(_ raw: String) throws -> String {
+        let name = raw.trimmingCharacters(in: .whitespacesAndNewlines)
+        guard !name.isEmpty, name.count <= 100 else {
+            throw Abort(.badRequest, reason: "Admission webhook name must be 1-100 characters")
+        }
+        return name
+    }
+
+    /// Same checks as webhook subscriptions; `AdmissionService` re-validates
+    /// on every review, covering later DNS changes.
+    private func validateTargetURL(_ urlString: String, on req: Request) async throws {
+        guard let url = URL(string: urlString), let scheme = url.scheme?.lowercased(),
+            scheme == "http" || scheme == "https", url.host != nil
+        else {
+            throw Abort(.badRequest, reason: "Admission webhook URL must be a valid http or https URL")
+        }
+        do {
+            try await SSRFGuard.validate(
+                url: url, environment: req.application.environment,
+                on: req.application.threadPool)
+        } catch let error as SSRFGuard.BlockedHostError {
+            throw Abort(.badRequest, reason: error.reason)
+        }
+    }
+
+    private func validateResourceKinds(_ raw: [String]) throws -> [String] {
+        for value in raw where AdmissionResourceKind(rawValue: value) == nil {
+            throw Abort(.badRequest, reason: "Unknown resource kind '\(value)'")
+        }
+        return Array(Set(raw)).sorted()
+    }
+
+    /// `create` is itself a `VMOperationKind`.
+    private func validateOperations(_ raw: [String]) throws -> [String] {
+        for value in raw where VMOperationKind(rawValue: value) == nil {
+            throw Abort(.badRequest, reason: "Unknown operation '\(value)'")
+        }
+        return Array(Set(raw)).sorted()
+    }
+
+    private func validateTimeout(_ seconds: Int) throws -> Int {
+        guard (1...AdmissionWebhook.maxTimeoutSeconds).contains(seconds) else {
+            throw Abort(
+                .badRequest, reason: "Timeout must be between 1 and \(AdmissionWebhook.maxTimeoutSeconds) seconds")
+        }
+        return seconds
+    }
+}
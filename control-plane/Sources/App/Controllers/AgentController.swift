@@ -813,6 +813,24 @@ struct AgentController: RouteCollection {
         }
         let artifactURL = artifact.url
 
+        // Projects keeping maintenance windows get the same gate as the
+        // rollout: the first refusal announces the update for their next
+        // window, and a retry inside it goes through. Force skips the wait.
+        if !force {
+            let clearance = try await MaintenanceWindows.clearance(
+                for: .agentUpdate,
+                subject: "\(agent.name)@\(targetVersion)",
+                summary: "Agent \(agent.name) is updated from \(agent.version) to \(targetVersion)",
+                on: agent, db: req.db)
+            guard clearance.isCleared else {
+                throw Abort(
+                    .conflict,
+                    reason:
+                        "Agent hosts VMs of \(clearance.waitingOn.count) project(s) whose maintenance windows are closed; the update was announced for their next window. Retry then, or pass force to proceed anyway."
+                )
+            }
+        }
+
         req.logger.info(
             "Dispatching agent update",
             metadata: [
@@ -877,14 +895,32 @@ struct AgentController: RouteCollection {
 
     // MARK: - Agent Properties
 
-    struct AgentPatchRequest: Content {
+    // Decodable rather than Content, for the same reason as the VM update
+    // request: `memoryOvercommit` tells an absent key from an explicit null.
+    struct AgentPatchRequest: Decodable {
         /// Enroll in (or withdraw from) declarative auto-update (issue #434).
         var autoUpdate: Bool?
+        /// The memory overcommit policy. `.none` (key absent) leaves it alone;
+        /// `.some(nil)` (explicit null) removes it.
+        var memoryOvercommit: MemoryOvercommitPolicy??
+
+        enum CodingKeys: String, CodingKey {
+            case autoUpdate, memoryOvercommit
+        }
+
+        init(from decoder: any Decoder) throws {
+            let c = try decoder.container(keyedBy: CodingKeys.self)
+            autoUpdate = try c.decodeIfPresent(Bool.self, forKey: .autoUpdate)
+            memoryOvercommit =
+                c.contains(.memoryOvercommit)
+                ? .some(try c.decodeIfPresent(MemoryOvercommitPolicy.self, forKey: .memoryOvercommit)) : .none
+        }
     }
 
-    /// Updates mutable agent properties. Currently only `autoUpdate`; scoped
-    /// to `agent#manage` like the imperative update action, since enrollment
-    /// authorizes future restarts of this capacity.
+    /// Updates mutable agent properties: `autoUpdate` and the memory
+    /// overcommit policy. Scoped to `agent#manage` like the imperative update
+    /// action, since enrollment authorizes future restarts of this capacity
+    /// and a ratio decides how much of it the scheduler hands out.
     func patchAgent(req: Request) async throws -> AgentResponse {
         guard let agentId = req.parameters.get("agentId", as: UUID.self) else {
             throw Abort(.badRequest, reason: "Invalid agent ID")
@@ -925,9 +961,63 @@ struct AgentController: RouteCollection {
             await req.agentService.syncDesiredState(agentId: agentId.uuidString)
         }
 
+        if let policy = patch.memoryOvercommit, policy != agent.memoryOvercommit {
+            if let policy {
+                try Self.validateMemoryOvercommit(policy)
+            }
+            agent.memoryOvercommit = policy
+            try await agent.save(on: req.db)
+            req.logger.info(
+                "Agent memory overcommit policy changed",
+                metadata: [
+                    "agentId": .string(agentId.uuidString),
+                    "agentName": .string(agent.name),
+                    "ratio": .stringConvertible(policy?.ratio ?? 1),
+                ])
+            // Lowering the ratio never evicts anything: VMs already placed
+            // stay, and admission simply stops until commitments fit again.
+            await req.agentService.syncDesiredState(agentId: agentId.uuidString)
+        }
+
         return try AgentResponse(from: agent)
     }
 
+    /// Rejects a policy the agent could not apply sensibly, naming the field.
+    static func validateMemoryOvercommit(_ policy: MemoryOvercommitPolicy) throws {
+        guard policy.ratio >= 1, policy.ratio <= MemoryOvercommitPolicy.maximumRatio else {
+            throw Abort(
+                .badRequest,
+                reason: "'ratio' must be between 1 and \(MemoryOvercommitPolicy.maximumRatio)")
+        }
+        if let ksm = policy.ksm {
+            guard ksm.pagesToScan > 0, ksm.sleepMilliseconds >= 0 else {
+                throw Abort(
+                    .badRequest, reason: "'ksm.pagesToScan' must be positive and 'ksm.sleepMilliseconds' non-negative")
+            }
+        }
+        if let reclaim = policy.pressureReclaim {
+            guard reclaim.releaseThresholdPercent >= 0,
+                reclaim.releaseThresholdPercent < reclaim.pressureThresholdPercent,
+                reclaim.pressureThresholdPercent <= 100
+            else {
+                throw Abort(
+                    .badRequest,
+                    reason: "'pressureReclaim' thresholds must satisfy 0 <= releaseThresholdPercent "
+                        + "< pressureThresholdPercent <= 100")
+            }
+            guard reclaim.idleAvailableFraction > 0, reclaim.idleAvailableFraction <= 1,
+                reclaim.defaultFloorFraction > 0, reclaim.defaultFloorFraction <= 1
+            else {
+                throw Abort(
+                    .badRequest,
+                    reason: "'pressureReclaim.idleAvailableFraction' and 'defaultFloorFraction' must be in (0, 1]")
+            }
+            guard reclaim.stepBytes > 0 else {
+                throw Abort(.badRequest, reason: "'pressureReclaim.stepBytes' must be positive")
+            }
+        }
+    }
+
     // MARK: - Organization Reassignment
 
     struct ReassignAgentOrganizationRequest: Content {
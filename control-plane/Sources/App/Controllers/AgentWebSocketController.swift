@@ -413,7 +413,8 @@ struct AgentWebSocketController: RouteCollection {
                 let message = try envelope.decode(as: SandboxExecOutputMessage.self)
                 if let data = message.rawData {
                     req.sandboxExecSessionManager.handleOutput(
-                        sessionId: message.sessionId, fromAgentKey: agentKey, data: data)
+                        sessionId: message.sessionId, fromAgentKey: agentKey, data: data,
+                        stream: message.stream)
                 }
 
             case .sandboxExecExit:
@@ -1,4 +1,5 @@
 import Fluent
+import SQLKit
 import Vapor
 
 /// Read API for the audit trail (issue #39).
@@ -7,11 +8,17 @@ import Vapor
 ///   cross-organization trail.
 /// - `GET /api/organizations/:organizationID/audit-events` — organization
 ///   admins (`manage_members`); events scoped to that organization.
+///
+/// Each has a `query` sibling taking an `AuditQuery` in `q` — a filter, and
+/// optionally a `count by` aggregation — under the same authorization.
 struct AuditEventController: RouteCollection {
     func boot(routes: RoutesBuilder) throws {
-        routes.grouped("api", "audit-events").get(use: listAll)
-        routes.grouped("api", "organizations", ":organizationID", "audit-events")
-            .get(use: listForOrganization)
+        let global = routes.grouped("api", "audit-events")
+        global.get(use: listAll)
+        global.get("query", use: queryAll)
+        let organization = routes.grouped("api", "organizations", ":organizationID", "audit-events")
+        organization.get(use: listForOrganization)
+        organization.get("query", use: queryForOrganization)
     }
 
     struct ListQuery: Content {
@@ -42,6 +49,129 @@ struct AuditEventController: RouteCollection {
         return try await list(query: query, organizationID: organizationID, on: req)
     }
 
+    struct QueryParameters: Content {
+        var q: String?
+        var limit: Int?
+        var offset: Int?
+    }
+
+    func queryAll(req: Request) async throws -> AuditQueryResponse {
+        _ = try req.requireSystemAdmin()
+        let parameters = try req.query.decode(QueryParameters.self)
+        return try await Self.run(
+            try Self.parse(parameters.q ?? ""), organizationID: nil, limit: parameters.limit,
+            offset: parameters.offset, on: req.db)
+    }
+
+    /// The query runs within the organization whatever it says: a filter on
+    /// another `org` matches nothing.
+    func queryForOrganization(req: Request) async throws -> AuditQueryResponse {
+        guard let organizationID = req.parameters.get("organizationID", as: UUID.self) else {
+            throw Abort(.badRequest, reason: "Invalid organization ID")
+        }
+        try await OrganizationAccessService.requireAdmin(organizationID: organizationID, on: req)
+        let parameters = try req.query.decode(QueryParameters.self)
+        return try await Self.run(
+            try Self.parse(parameters.q ?? ""), organizationID: organizationID, limit: parameters.limit,
+            offset: parameters.offset, on: req.db)
+    }
+
+    /// Parses a query, reporting a syntax error as a bad request.
+    static func parse(_ source: String) throws -> AuditQuery {
+        do {
+            return try AuditQuery(source)
+        } catch let error as AuditQuery.ParseError {
+            throw Abort(.badRequest, reason: "Invalid audit query: \(error.description)")
+        }
+    }
+
+    /// Runs a query: the matching events newest first, or for a `count` the
+    /// groups largest first. `limit` and `offset` page whichever it is.
+    static func run(
+        _ query: AuditQuery, organizationID: UUID?, limit: Int?, offset: Int?, on db: Database
+    ) async throws -> AuditQueryResponse {
+        let limit = min(max(limit ?? 50, 1), 500)
+        let offset = max(offset ?? 0, 0)
+        let predicate = query.predicate()
+
+        let dbQuery = AuditEvent.query(on: db)
+        if let organizationID {
+            dbQuery.filter(\.$organizationID == organizationID)
+        }
+        if let predicate {
+            dbQuery.filter(.custom(predicate))
+        }
+        let total = try await dbQuery.copy().count()
+
+        guard let groupBy = query.groupBy else {
+            let events =
+                try await dbQuery
+                .sort(\.$createdAt, .descending)
+                .sort(\.$id, .descending)
+                .range(offset..<(offset + limit))
+                .all()
+            return AuditQueryResponse(
+                query: query.source, events: events.map(AuditEventResponse.init), groupBy: nil, groups: nil,
+                total: total, limit: limit, offset: offset)
+        }
+
+        let groups: [AuditQueryGroup]
+        if groupBy.isEmpty {
+            groups = offset == 0 ? [AuditQueryGroup(key: [:], count: total)] : []
+        } else {
+            groups = try await Self.groups(
+                groupBy, predicate: predicate, organizationID: organizationID, limit: limit, offset: offset, on: db)
+        }
+        return AuditQueryResponse(
+            query: query.source, events: nil, groupBy: groupBy.map(\.name), groups: groups, total: total,
+            limit: limit, offset: offset)
+    }
+
+    private static func groups(
+        _ fields: [AuditQuery.Field], predicate: SQLQueryString?, organizationID: UUID?, limit: Int, offset: Int,
+        on db: Database
+    ) async throws -> [AuditQueryGroup] {
+        guard let sql = db as? SQLDatabase else {
+            throw Abort(.internalServerError, reason: "Audit aggregation requires an SQL database")
+        }
+        let select = sql.select()
+        // Grouped by the output alias: a metadata field's key is a bind
+        // parameter, and a second copy of it would be a different expression.
+        for (index, field) in fields.enumerated() {
+            select.column(field.expression, as: "g\(index)").groupBy(SQLColumn("g\(index)"))
+        }
+        select.column(SQLFunction("COUNT", args: SQLLiteral.all), as: "row_count")
+            .from(AuditEvent.schema)
+        if let organizationID {
+            select.where(SQLColumn("organization_id"), .equal, SQLBind(organizationID))
+        }
+        if let predicate {
+            select.where(predicate)
+        }
+        let rows =
+            try await select
+            .orderBy("row_count", .descending)
+            .limit(limit)
+            .offset(offset)
+            .all()
+
+        return try rows.map { row in
+            var key: [String: String] = [:]
+            for (index, field) in fields.enumerated() {
+                let column = "g\(index)"
+                let value: String?
+                switch field.kind {
+                case .uuid: value = try row.decode(column: column, as: UUID?.self)?.uuidString
+                case .integer: value = try row.decode(column: column, as: Int?.self).map(String.init)
+                case .boolean: value = try row.decode(column: column, as: Bool?.self).map(String.init)
+                case .string, .time: value = try row.decode(column: column, as: String?.self)
+                }
+                key[field.name] = value
+            }
+            return AuditQueryGroup(key: key, count: try row.decode(column: "row_count", as: Int.self))
+        }
+    }
+
     private func list(
         query: ListQuery, organizationID: UUID?, on req: Request
     ) async throws -> AuditEventListResponse {
@@ -121,6 +251,8 @@ struct AuditEventResponse: Content {
     let sourceIP: String?
     let adminBypass: Bool
     let metadata: [String: String]?
+    let actorType: String
+    let actorID: UUID?
     let createdAt: Date?
 
     init(from event: AuditEvent) {
@@ -139,6 +271,8 @@ struct AuditEventResponse: Content {
         self.sourceIP = event.sourceIP
         self.adminBypass = event.adminBypass
         self.metadata = event.metadata
+        self.actorType = event.actorType
+        self.actorID = event.actorID
         self.createdAt = event.createdAt
     }
 }
@@ -149,3 +283,23 @@ struct AuditEventListResponse: Content {
     let limit: Int
     let offset: Int
 }
+
+struct AuditQueryResponse: Content {
+    let query: String
+    /// The matching events, newest first; nil for a `count` query.
+    let events: [AuditEventResponse]?
+    /// The fields a `count by` grouped on; empty for a bare `count`.
+    let groupBy: [String]?
+    /// Event counts per distinct value of `groupBy`, largest first.
+    let groups: [AuditQueryGroup]?
+    /// How many events match.
+    let total: Int
+    let limit: Int
+    let offset: Int
+}
+
+struct AuditQueryGroup: Content {
+    /// Each grouped field's value; a field with none is left out.
+    let key: [String: String]
+    let count: Int
+}
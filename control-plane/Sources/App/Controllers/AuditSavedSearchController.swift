@@ -0,0 +1,122 @@
+import Fluent
+import Vapor
+
+/// Saved audit queries under `/api/organizations/:organizationID/audit-searches`.
+/// A saved search is only its query: clients run it through the
+/// organization's `audit-events/query`.
+///
+/// Authorization follows the organization's audit trail, which only its
+/// admins (`manage_members`) may read.
+struct AuditSavedSearchController: RouteCollection {
+    func boot(routes: RoutesBuilder) throws {
+        let searches = routes.grouped("api", "organizations", ":organizationID", "audit-searches")
+        searches.get(use: list)
+        searches.post(use: create)
+        searches.get(":searchID", use: get)
+        searches.patch(":searchID", use: update)
+        searches.delete(":searchID", use: delete)
+    }
+
+    private func organizationID(_ req: Request) async throws -> UUID {
+        guard let organizationID = req.parameters.get("organizationID", as: UUID.self) else {
+            throw Abort(.badRequest, reason: "Invalid organization ID")
+        }
+        try await OrganizationAccessService.requireAdmin(organizationID: organizationID, on: req)
+        return organizationID
+    }
+
+    private func findSearch(_ req: Request, organizationID: UUID) async throws -> AuditSavedSearch {
+        guard let searchID = req.parameters.get("searchID", as: UUID.self) else {
+            throw Abort(.badRequest, reason: "Invalid saved search ID")
+        }
+        guard
+            let search = try await AuditSavedSearch.query(on: req.db)
+                .filter(\.$id == searchID)
+                .filter(\.$organization.$id == organizationID)
+                .first()
+        else {
+            throw Abort(.notFound, reason: "Saved search not found")
+        }
+        return search
+    }
+
+    /// GET /api/organizations/:organizationID/audit-searches
+    @Sendable
+    func list(req: Request) async throws -> [AuditSavedSearchResponse] {
+        let organizationID = try await organizationID(req)
+        return try await AuditSavedSearch.query(on: req.db)
+            .filter(\.$organization.$id == organizationID)
+            .sort(\.$name)
+            .all()
+            .map { try AuditSavedSearchResponse(from: $0) }
+    }
+
+    /// POST /api/organizations/:organizationID/audit-searches — the query must
+    /// parse.
+    @Sendable
+    func create(req: Request) async throws -> AuditSavedSearchResponse {
+        let user = try req.auth.require(User.self)
+        let organizationID = try await organizationID(req)
+        let create = try req.content.decode(CreateAuditSavedSearchRequest.self)
+        let name = try Self.validName(create.name)
+        _ = try AuditEventController.parse(create.query)
+
+        let search = AuditSavedSearch(
+            organizationID: organizationID, name: name, description: create.description ?? "",
+            query: create.query, createdByID: user.id)
+        try await save(search, on: req)
+        return try AuditSavedSearchResponse(from: search)
+    }
+
+    /// GET /api/organizations/:organizationID/audit-searches/:searchID
+    @Sendable
+    func get(req: Request) async throws -> AuditSavedSearchResponse {
+        let organizationID = try await organizationID(req)
+        return try AuditSavedSearchResponse(from: try await findSearch(req, organizationID: organizationID))
+    }
+
+    /// PATCH /api/organizations/:organizationID/audit-searches/:searchID —
+    /// omitted fields stay as they are.
+    @Sendable
+    func update(req: Request) async throws -> AuditSavedSearchResponse {
+        let organizationID = try await organizationID(req)
+        let search = try await findSearch(req, organizationID: organizationID)
+        let update = try req.content.decode(UpdateAuditSavedSearchRequest.self)
+
+        if let name = update.name { search.name = try Self.validName(name) }
+        if let description = update.description { search.searchDescription = description }
+        if let query = update.query {
+            _ = try AuditEventController.parse(query)
+            search.query = query
+        }
+        try await save(search, on: req)
+        return try AuditSavedSearchResponse(from: search)
+    }
+
+    /// DELETE /api/organizations/:organizationID/audit-searches/:searchID
+    @Sendable
+    func delete(req: Request) async throws -> HTTPStatus {
+        let organizationID = try await organizationID(req)
+        try await findSearch(req, organizationID: organizationID).delete(on: req.db)
+        return .noContent
+    }
+
+    // MARK: - Helpers
+
+    private func save(_ search: AuditSavedSearch, on req: Request) async throws {
+        do {
+            try await search.save(on: req.db)
+        } catch let error as any DatabaseError where error.isConstraintFailure {
+            throw Abort(.conflict, reason: "A saved search named '\(search.name)' already exists")
+        }
+    }
+
+    static func validName(_ raw: String) throws -> String {
+        let name = raw.trimmingCharacters(in: .whitespacesAndNewlines)
+        guard !name.isEmpty, name.count <= AuditSavedSearch.maxNameLength else {
+            throw Abort(
+                .badRequest, reason: "A saved search's name must be 1 to \(AuditSavedSearch.maxNameLength) characters")
+        }
+        return name
+    }
+}
@@ -0,0 +1,316 @@
+import Fluent
+import Foundation
+import Vapor
+
+/// A project's event-driven automation rules (see `AutomationService`).
+///
+/// - `GET/POST  /api/projects/:projectID/automation-rules`
+/// - `GET/PUT/DELETE .../automation-rules/:ruleID`
+/// - `GET .../:ruleID/runs` — run history, newest first.
+/// - `POST .../:ruleID/rotate-secret` — new `call_webhook` signing secret,
+///   shown once.
+///
+/// Reads need `project:read`, writes `project:update`. Writing a rule also
+/// needs `serviceaccount:impersonate` on its service account, checked again
+/// on every update: a rule acts as the account, so only someone who could
+/// act as it may decide what the rule does.
+struct AutomationRuleController: RouteCollection {
+    static let maxNameLength = 100
+    static let maxMessageLength = 1000
+
+    func boot(routes: RoutesBuilder) throws {
+        let rules = routes.grouped("api", "projects", ":projectID", "automation-rules")
+        rules.get(use: list)
+        rules.post(use: create)
+        rules.group(":ruleID") { rule in
+            rule.get(use: get)
+            rule.put(use: update)
+            rule.delete(use: delete)
+            rule.get("runs", use: listRuns)
+            rule.post("rotate-secret", use: rotateSecret)
+        }
+    }
+
+    // MARK: - CRUD
+
+    func list(req: Request) async throws -> [AutomationRuleResponse] {
+        let projectID = try requireProjectID(req)
+        try await req.authorize("project:read", on: IAMNode(type: .project, id: projectID))
+
+        let rules = try await AutomationRule.query(on: req.db)
+            .filter(\.$project.$id == projectID)
+            .sort(\.$name)
+            .all()
+        return rules.map(AutomationRuleResponse.init(from:))
+    }
+
+    func create(req: Request) async throws -> Response {
+        let projectID = try requireProjectID(req)
+        guard try await Project.find(projectID, on: req.db) != nil else {
+            throw Abort(.notFound, reason: "Project not found")
+        }
+        try await req.authorize("project:update", on: IAMNode(type: .project, id: projectID))
+        let user = try req.auth.require(User.self)
+
+        let request = try req.content.decode(CreateAutomationRuleRequest.self)
+        try await authorizeServiceAccount(request.serviceAccountId, projectID: projectID, on: req)
+        let filter = try validateFilter(request.filter ?? "")
+        let conditions = try validateConditions(request.conditions ?? [])
+        let actions = try await validateActions(request.actions, on: req)
+
+        let secret = WebhookSubscription.generateSigningSecret()
+        let rule = AutomationRule(
+            projectID: projectID,
+            name: try validateName(request.name),
+            description: request.description ?? "",
+            triggerEventType: try validateTrigger(request.triggerEventType),
+            filter: filter,
+            conditions: conditions,
+            actions: actions,
+            serviceAccountID: request.serviceAccountId,
+            maxRunsPerHour: try validateMaxRunsPerHour(request.maxRunsPerHour ?? AutomationRule.defaultMaxRunsPerHour),
+            signingSecret: try req.secretsEncryption.encrypt(secret),
+            createdByID: try user.requireID()
+        )
+        try await save(rule, on: req.db)
+
+        let body = AutomationRuleWithSecretResponse(rule: AutomationRuleResponse(from: rule), signingSecret: secret)
+        let response = Response(status: .created)
+        try response.content.encode(body)
+        return response
+    }
+
+    func get(req: Request) async throws -> AutomationRuleResponse {
+        let rule = try await requireRule(req)
+        try await req.authorize("project:read", on: IAMNode(type: .project, id: rule.$project.id))
+        return AutomationRuleResponse(from: rule)
+    }
+
+    func update(req: Request) async throws -> AutomationRuleResponse {
+        let rule = try await requireRule(req)
+        let projectID = rule.$project.id
+        try await req.authorize("project:update", on: IAMNode(type: .project, id: projectID))
+
+        let request = try req.content.decode(UpdateAutomationRuleRequest.self)
+        try await authorizeServiceAccount(
+            request.serviceAccountId ?? rule.$serviceAccount.id, projectID: projectID, on: req)
+        if let serviceAccountID = request.serviceAccountId {
+            rule.$serviceAccount.id = serviceAccountID
+        }
+        if let name = request.name {
+            rule.name = try validateName(name)
+        }
+        if let description = request.description {
+            rule.ruleDescription = description
+        }
+        if let trigger = request.triggerEventType {
+            rule.triggerEventType = try validateTrigger(trigger).rawValue
+        }
+        if let filter = request.filter {
+            rule.filter = try validateFilter(filter)
+        }
+        if let conditions = request.conditions {
+            rule.conditions = try validateConditions(conditions)
+        }
+        if let actions = request.actions {
+            rule.actions = try await validateActions(actions, on: req)
+        }
+        if let maxRunsPerHour = request.maxRunsPerHour {
+            rule.maxRunsPerHour = try validateMaxRunsPerHour(maxRunsPerHour)
+        }
+        if let isActive = request.isActive {
+            rule.isActive = isActive
+        }
+        try await save(rule, on: req.db)
+        return AutomationRuleResponse(from: rule)
+    }
+
+    /// Runs go with the rule.
+    func delete(req: Request) async throws -> HTTPStatus {
+        let rule = try await requireRule(req)
+        try await req.authorize("project:update", on: IAMNode(type: .project, id: rule.$project.id))
+
+        try await rule.delete(on: req.db)
+        return .noContent
+    }
+
+    // MARK: - Runs
+
+    /// `?limit=` (default 50, at most 200) newest runs.
+    func listRuns(req: Request) async throws -> [AutomationRunResponse] {
+        let rule = try await requireRule(req)
+        try await req.authorize("project:read", on: IAMNode(type: .project, id: rule.$project.id))
+
+        let limit = min(max(req.query[Int.self, at: "limit"] ?? 50, 1), 200)
+        let runs = try await AutomationRun.query(on: req.db)
+            .filter(\.$rule.$id == rule.requireID())
+            .sort(\.$createdAt, .descending)
+            .limit(limit)
+            .all()
+        return runs.map(AutomationRunResponse.init(from:))
+    }
+
+    // MARK: - Secret rotation
+
+    func rotateSecret(req: Request) async throws -> AutomationRuleWithSecretResponse {
+        let rule = try await requireRule(req)
+        try await req.authorize("project:update", on: IAMNode(type: .project, id: rule.$project.id))
+
+        let secret = WebhookSubscription.generateSigningSecret()
+        rule.signingSecret = try req.secretsEncryption.encrypt(secret)
+        try await rule.save(on: req.db)
+
+        return AutomationRuleWithSecretResponse(rule: AutomationRuleResponse(from: rule), signingSecret: secret)
+    }
+
+    // MARK: - Helpers
+
+    private func requireProjectID(_ req: Request) throws -> UUID {
+        guard let projectID = req.parameters.get("projectID", as: UUID.self) else {
+            throw Abort(.badRequest, reason: "Invalid project ID")
+        }
+        return projectID
+    }
+
+    private func requireRule(_ req: Request) async throws -> AutomationRule {
+        let projectID = try requireProjectID(req)
+        guard let ruleID = req.parameters.get("ruleID", as: UUID.self) else {
+            throw Abort(.badRequest, reason: "Invalid automation rule ID")
+        }
+        guard
+            let rule = try await AutomationRule.query(on: req.db)
+                .filter(\.$id == ruleID)
+                .filter(\.$project.$id == projectID)
+                .first()
+        else {
+            throw Abort(.notFound, reason: "Automation rule not found")
+        }
+        return rule
+    }
+
+    /// The account must belong to the rule's project, and the caller must be
+    /// allowed to act as it.
+    private func authorizeServiceAccount(_ accountID: UUID, projectID: UUID, on req: Request) async throws {
+        guard let account = try await ServiceAccount.find(accountID, on: req.db),
+            account.$project.id == projectID
+        else {
+            throw Abort(.badRequest, reason: "Service account not found in this project")
+        }
+        try await req.authorize("serviceaccount:impersonate", on: IAMNode(type: .serviceAccount, id: accountID))
+    }
+
+    private func save(_ rule: AutomationRule, on db: Database) async throws {
+        do {
+            try await rule.save(on: db)
+        } catch let error as any DatabaseError where error.isConstraintFailure {
+            throw Abort(.conflict, reason: "An automation rule named '\(rule.name)' already exists in this project")
+        }
+    }
+
+    private func validateName(_ raw: String) throws -> String {
+        let name = raw.trimmingCharacters(in: .whitespacesAndNewlines)
+        guard !name.isEmpty, name.count <= Self.maxNameLength else {
+            throw Abort(.badRequest, reason: "Automation rule name must be 1-\(Self.maxNameLength) characters")
+        }
+        return name
+    }
+
+    /// Any subscribable event type; the test event is never emitted for real.
+    private func validateTrigger(_ raw: String) throws -> WebhookEventType {
+        guard let type = WebhookEventType(rawValue: raw), WebhookEventType.subscribable.contains(type) else {
+            throw Abort(.badRequest, reason: "Unknown trigger event type '\(raw)'")
+        }
+        return type
+    }
+
+    private func validateFilter(_ raw: String) throws -> String {
+        let filter = raw.trimmingCharacters(in: .whitespacesAndNewlines)
+        guard !filter.isEmpty else { return "" }
+        do {
+            _ = try AutomationExpression(filter, roots: AutomationRule.filterRoots)
+        } catch let error as AutomationExpression.ParseError {
+            throw Abort(.badRequest, reason: "Invalid filter: \(error.description)")
+        }
+        return filter
+    }
+
+    private func validateConditions(_ raw: [String]) throws -> [String] {
+        guard raw.count <= AutomationRule.maxConditions else {
+            throw Abort(.badRequest, reason: "A rule may have at most \(AutomationRule.maxConditions) conditions")
+        }
+        return try raw.map { source in
+            let condition = source.trimmingCharacters(in: .whitespacesAndNewlines)
+            do {
+                _ = try AutomationExpression(condition, roots: AutomationRule.conditionRoots)
+            } catch let error as AutomationExpression.ParseError {
+                throw Abort(.badRequest, reason: "Invalid condition '\(condition)': \(error.description)")
+            }
+            return condition
+        }
+    }
+
+    /// Each action carries exactly the fields its type uses.
+    private func validateActions(_ actions: [AutomationAction], on req: Request) async throws -> [AutomationAction] {
+        guard (1...AutomationRule.maxActions).contains(actions.count) else {
+            throw Abort(.badRequest, reason: "A rule needs 1-\(AutomationRule.maxActions) actions")
+        }
+        var validated: [AutomationAction] = []
+        for action in actions {
+            switch action.type {
+            case .start, .stop, .snapshot:
+                validated.append(AutomationAction(type: action.type))
+            case .tag:
+                guard let tags = action.tags, !tags.isEmpty else {
+                    throw Abort(.badRequest, reason: "A 'tag' action needs 'tags'")
+                }
+                // Empty values remove keys, so only the keys are checked here.
+                try VM.validateTags(tags.mapValues { _ in "" })
+                for (key, value) in tags where value.count > VM.maxTagValueLength {
+                    throw Abort(
+                        .badRequest, reason: "Tag '\(key)' has a value longer than \(VM.maxTagValueLength) characters")
+                }
+                validated.append(AutomationAction(type: .tag, tags: tags))
+            case .notify:
+                let message = action.message ?? ""
+                guard !message.isEmpty, message.count <= Self.maxMessageLength else {
+                    throw Abort(
+                        .badRequest,
+                        reason: "A 'notify' action needs a message of 1-\(Self.maxMessageLength) characters")
+                }
+                validated.append(AutomationAction(type: .notify, message: message))
+            case .callWebhook:
+                guard let url = action.url else {
+                    throw Abort(.badRequest, reason: "A 'call_webhook' action needs a 'url'")
+                }
+                try await validateTargetURL(url, on: req)
+                validated.append(AutomationAction(type: .callWebhook, url: url))
+            }
+        }
+        return validated
+    }
+
+    /// Same checks as webhook subscriptions; the action re-validates on every
+    /// call, covering later DNS changes.
+    private func validateTargetURL(_ urlString: String, on req: Request) async throws {
+        guard let url = URL(string: urlString), let scheme = url.scheme?.lowercased(),
+            scheme == "http" || scheme == "https", url.host != nil
+        else {
+            throw Abort(.badRequest, reason: "Webhook URL must be a valid http or https URL")
+        }
+        do {
+            try await SSRFGuard.validate(
+                url: url, environment: req.application.environment,
+                on: req.application.threadPool)
+        } catch let error as SSRFGuard.BlockedHostError {
+            throw Abort(.badRequest, reason: error.reason)
+        }
+    }
+
+    private func validateMaxRunsPerHour(_ value: Int) throws -> Int {
+        guard (1...AutomationRule.maxRunsPerHourLimit).contains(value) else {
+            throw Abort(
+                .badRequest, reason: "maxRunsPerHour must be between 1 and \(AutomationRule.maxRunsPerHourLimit)")
+        }
+        return value
+    }
+}
@@ -0,0 +1,248 @@
+import Fluent
+import Vapor
+
+/// Bring-your-own IP prefixes under `/api/byoip-prefixes`. An organization
+/// registers an IPv4 prefix, proves it controls it (`POST :id/verify`), and
+/// the prefix becomes a `FloatingIPPool` scoped to the organization. The
+/// site's gateway chassis then announce it over BGP while any of its
+/// floating IPs is attached (see `DesiredFloatingIP.advertisedPrefix`).
+///
+/// Authorization follows pools: `manage_agents` on the organization to
+/// register, verify and delete; `org:read` to see.
+struct BYOIPPrefixController: RouteCollection {
+    func boot(routes: RoutesBuilder) throws {
+        let prefixes = routes.grouped("api", "byoip-prefixes").grouped(User.guardMiddleware())
+        prefixes.get(use: list)
+        prefixes.post(use: create)
+        prefixes.get(":prefixId", use: get)
+        prefixes.delete(":prefixId", use: delete)
+        prefixes.post(":prefixId", "verify", use: verify)
+    }
+
+    private func requireManage(_ req: Request, organizationID: UUID) async throws {
+        let allowed = try await req.can("manage_agents", on: "organization", id: organizationID.uuidString)
+        guard allowed else {
+            throw Abort(.forbidden, reason: "You don't have permission to manage IP prefixes for this organization")
+        }
+    }
+
+    private func findPrefix(_ req: Request) async throws -> BYOIPPrefix {
+        guard let prefixId = req.parameters.get("prefixId", as: UUID.self) else {
+            throw Abort(.badRequest, reason: "Invalid prefix ID")
+        }
+        guard let prefix = try await BYOIPPrefix.find(prefixId, on: req.db) else {
+            throw Abort(.notFound, reason: "IP prefix not found")
+        }
+        return prefix
+    }
+
+    /// GET /api/byoip-prefixes
+    /// Query params: limit/offset (optional) — select the page.
+    @Sendable
+    func list(req: Request) async throws -> PagedResponse<BYOIPPrefixResponse> {
+        _ = try req.auth.require(User.self)
+        let paging = try ListPaging.decode(from: req)
+        let prefixes = try await BYOIPPrefix.query(on: req.db).sort(\.$cidr).sort(\.$id).all()
+        let readable = try await req.canFilter(
+            "org:read", on: prefixes.map { IAMNode(type: .organization, id: $0.$organization.id) })
+        let visible = prefixes.filter { readable.contains(IAMNode(type: .organization, id: $0.$organization.id)) }
+        let poolIDs = try await Self.poolIDs(for: visible.compactMap(\.id), on: req.db)
+        return paging.page(try visible.map { try BYOIPPrefixResponse(from: $0, poolId: poolIDs[$0.requireID()]) })
+    }
+
+    /// POST /api/byoip-prefixes — registers a prefix, pending until verified.
+    /// The response carries the challenge a `signed_challenge` proof signs.
+    @Sendable
+    func create(req: Request) async throws -> BYOIPPrefixResponse {
+        let user = try req.auth.require(User.self)
+        let create = try req.content.decode(CreateBYOIPPrefixRequest.self)
+        let scope = OrganizationScope.organization(create.organizationId)
+        try await scope.validateExists(on: req.db)
+        try await requireManage(req, organizationID: create.organizationId)
+
+        guard let parsed = IPv4CIDR(create.cidr),
+            (BYOIPPrefix.shortestPrefix...BYOIPPrefix.longestPrefix).contains(parsed.prefix)
+        else {
+            throw Abort(
+                .badRequest,
+                reason:
+                    "Prefix must be IPv4 with a /\(BYOIPPrefix.shortestPrefix)–/\(BYOIPPrefix.longestPrefix) length")
+        }
+        let cidr = "\(parsed.networkAddress)/\(parsed.prefix)"
+
+        if let siteId = create.siteId {
+            guard let site = try await Site.find(siteId, on: req.db) else {
+                throw Abort(.badRequest, reason: "Site \(siteId) does not exist")
+            }
+            guard try await site.rootOrganizationID(on: req.db) == create.organizationId else {
+                throw Abort(.badRequest, reason: "Site '\(site.name)' does not belong to this organization")
+            }
+        }
+
+        let config = req.application.byoipConfig
+        if create.verificationMethod == .roa, config.originASN == nil || config.rpkiValidatorURL == nil {
+            throw Abort(.badRequest, reason: "ROA verification is not configured on this control plane")
+        }
+
+        let poolName = (create.poolName ?? "byoip-\(parsed.networkAddress)-\(parsed.prefix)")
+            .trimmingCharacters(in: .whitespacesAndNewlines)
+        guard !poolName.isEmpty, poolName.count <= 100 else {
+            throw Abort(.badRequest, reason: "Pool name must be 1-100 characters")
+        }
+        try await Self.assertClaimable(cidr: cidr, poolName: poolName, excluding: nil, on: req.db)
+
+        let prefix = BYOIPPrefix(
+            organizationID: create.organizationId, siteID: create.siteId, cidr: cidr, poolName: poolName,
+            verificationMethod: create.verificationMethod,
+            challenge: BYOIPPrefix.makeChallenge(organizationID: create.organizationId, cidr: cidr),
+            createdByID: user.id)
+        if create.verificationMethod == .roa { prefix.originASN = config.originASN }
+        try await prefix.save(on: req.db)
+
+        req.logger.info(
+            "BYOIP prefix registered",
+            metadata: [
+                "prefixId": .string(prefix.id!.uuidString),
+                "cidr": .string(cidr),
+                "method": .string(prefix.verificationMethod),
+            ])
+        return try BYOIPPrefixResponse(from: prefix, poolId: nil)
+    }
+
+    /// GET /api/byoip-prefixes/:prefixId
+    @Sendable
+    func get(req: Request) async throws -> BYOIPPrefixResponse {
+        let prefix = try await findPrefix(req)
+        guard try await req.can("org:read", on: IAMNode(type: .organization, id: prefix.$organization.id)) else {
+            throw Abort(.forbidden, reason: "You don't have access to this IP prefix")
+        }
+        let poolIDs = try await Self.poolIDs(for: [prefix.requireID()], on: req.db)
+        return try BYOIPPrefixResponse(from: prefix, poolId: poolIDs[prefix.requireID()])
+    }
+
+    /// POST /api/byoip-prefixes/:prefixId/verify — checks the proof now. A
+    /// failed check is recorded on the prefix (`failed`, with the reason) and
+    /// may be retried; a passed one creates the pool. Verifying a verified
+    /// prefix changes nothing.
+    @Sendable
+    func verify(req: Request) async throws -> BYOIPPrefixResponse {
+        let prefix = try await findPrefix(req)
+        try await requireManage(req, organizationID: prefix.$organization.id)
+        let prefixID = try prefix.requireID()
+        if prefix.prefixStatus == .verified {
+            let poolIDs = try await Self.poolIDs(for: [prefixID], on: req.db)
+            return try BYOIPPrefixResponse(from: prefix, poolId: poolIDs[prefixID])
+        }
+
+        let body = try? req.content.decode(VerifyBYOIPPrefixRequest.self)
+        if let failure = await BYOIPVerifier.failure(
+            of: prefix, signature: body?.signature, config: req.application.byoipConfig,
+            evidence: req.application.byoipEvidence)
+        {
+            prefix.status = BYOIPPrefixStatus.failed.rawValue
+            prefix.statusMessage = failure
+            try await prefix.save(on: req.db)
+            req.logger.info(
+                "BYOIP prefix verification failed",
+                metadata: ["prefixId": .string(prefixID.uuidString), "reason": .string(failure)])
+            return try BYOIPPrefixResponse(from: prefix, poolId: nil)
+        }
+
+        // Another organization may have proven an overlapping prefix (or an
+        // operator made a pool over it) since this one was registered.
+        try await Self.assertClaimable(
+            cidr: prefix.cidr, poolName: prefix.poolName, excluding: prefixID, on: req.db)
+        let pool = FloatingIPPool(
+            name: prefix.poolName, cidr: prefix.cidr, siteID: prefix.$site.id,
+            organizationScope: .organization(prefix.$organization.id), byoipPrefixID: prefixID)
+        prefix.status = BYOIPPrefixStatus.verified.rawValue
+        prefix.statusMessage = nil
+        prefix.verifiedAt = Date()
+        do {
+            try await req.db.transaction { db in
+                try await pool.save(on: db)
+                try await prefix.save(on: db)
+            }
+        } catch let error as any DatabaseError where error.isConstraintFailure {
+            // Either the pool name's unique index, or the verified-overlap
+            // exclusion when an overlapping prefix was verified meanwhile.
+            throw Abort(
+                .conflict,
+                reason:
+                    "\(prefix.cidr) overlaps a prefix verified by another registration, or a floating IP pool named '\(prefix.poolName)' exists"
+            )
+        }
+
+        req.logger.info(
+            "BYOIP prefix verified",
+            metadata: [
+                "prefixId": .string(prefixID.uuidString),
+                "cidr": .string(prefix.cidr),
+                "poolId": .string(pool.id!.uuidString),
+            ])
+        return try BYOIPPrefixResponse(from: prefix, poolId: pool.id)
+    }
+
+    /// DELETE /api/byoip-prefixes/:prefixId — withdraws the prefix and its
+    /// pool. Refused while the pool has allocated addresses.
+    @Sendable
+    func delete(req: Request) async throws -> HTTPStatus {
+        let prefix = try await findPrefix(req)
+        try await requireManage(req, organizationID: prefix.$organization.id)
+        let pool = try await FloatingIPPool.query(on: req.db)
+            .filter(\.$byoipPrefix.$id == prefix.requireID())
+            .first()
+        if let pool {
+            let allocated = try await FloatingIP.query(on: req.db)
+                .filter(\.$pool.$id == pool.requireID())
+                .count()
+            guard allocated == 0 else {
+                throw Abort(
+                    .conflict, reason: "The prefix's pool has \(allocated) allocated address(es); release them first")
+            }
+        }
+        try await req.db.transaction { db in
+            try await pool?.delete(on: db)
+            try await prefix.delete(on: db)
+        }
+        return .noContent
+    }
+
+    // MARK: - Helpers
+
+    /// The pool made from each verified prefix, by prefix id.
+    static func poolIDs(for prefixIDs: [UUID], on db: Database) async throws -> [UUID: UUID] {
+        guard !prefixIDs.isEmpty else { return [:] }
+        let pools = try await FloatingIPPool.query(on: db)
+            .filter(\.$byoipPrefix.$id ~~ prefixIDs)
+            .all()
+        var byPrefix: [UUID: UUID] = [:]
+        for pool in pools {
+            if let prefixID = pool.$byoipPrefix.id, let poolID = pool.id { byPrefix[prefixID] = poolID }
+        }
+        return byPrefix
+    }
+
+    /// Rejects a prefix overlapping a verified one or any floating-IP pool
+    /// (BGP announcements are global, so sites don't separate them), and a
+    /// pool name already taken. Pending registrations don't block: only
+    /// proof does.
+    static func assertClaimable(
+        cidr: String, poolName: String, excluding prefixID: UUID?, on db: Database
+    ) async throws {
+        let verified = try await BYOIPPrefix.query(on: db)
+            .filter(\.$status == BYOIPPrefixStatus.verified.rawValue)
+            .all()
+        for other in verified where other.id != prefixID && NetworkController.subnetsOverlap(cidr, other.cidr) {
+            throw Abort(.conflict, reason: "\(cidr) overlaps the verified prefix \(other.cidr)")
+        }
+        for pool in try await FloatingIPPool.query(on: db).all() {
+            if NetworkController.subnetsOverlap(cidr, pool.cidr) {
+                throw Abort(.conflict, reason: "\(cidr) overlaps floating IP pool '\(pool.name)' (\(pool.cidr))")
+            }
+            if pool.name == poolName {
+                throw Abort(.conflict, reason: "A floating IP pool named '\(poolName)' already exists")
+            }
+        }
+    }
+}
@@ -0,0 +1,312 @@
+import Fluent
+import Foundation
+import StratoShared
+import Vapor
+
+/// `/api/buckets`: S3 buckets — object storage for a project, served by the
+/// S3-compatible gateway on one pool-member agent. The API manages the
+/// bucket itself; its contents are reached through the gateway with an
+/// access key (`ObjectStorageAccessKeyController`), which is why there is no
+/// object route here.
+///
+/// Buckets are cheap to converge — a directory on the agent, not a VM or a
+/// filesystem — so mutations answer synchronously with the bucket rather
+/// than an operation: `status` moves from `creating`/`deleting` once the
+/// agent's observed report confirms the generation.
+struct BucketController: RouteCollection {
+    func boot(routes: any RoutesBuilder) throws {
+        let buckets = routes.grouped("api", "buckets").grouped(User.guardMiddleware())
+        buckets.get(use: index)
+        buckets.post(use: create)
+        buckets.group(":bucketID") { bucket in
+            bucket.get(use: show)
+            bucket.patch(use: update)
+            bucket.delete(use: delete)
+        }
+    }
+
+    // MARK: - Reads
+
+    /// GET /api/buckets
+    /// Query params: project_id (optional),
+    /// limit/offset (optional) — select the page.
+    @Sendable
+    func index(req: Request) async throws -> PagedResponse<BucketResponse> {
+        let paging = try ListPaging.decode(from: req)
+        let buckets = try await visibleBuckets(req: req)
+        return paging.page(buckets)
+    }
+
+    /// Every bucket the caller may read, newest first, ready for slicing.
+    func visibleBuckets(req: Request) async throws -> [BucketResponse] {
+        _ = try req.auth.require(User.self)
+        let requestedProjectId = req.query[String.self, at: "project_id"].flatMap(UUID.init(uuidString:))
+
+        var query = Bucket.query(on: req.db)
+            .sort(\.$createdAt, .descending)
+            .sort(\.$id, .descending)
+
+        // Project scoping as in FileShareController.visibleShares.
+        if let requestedProjectId {
+            let hasAccess = try await req.can("view_project", on: "project", id: requestedProjectId.uuidString)
+            guard hasAccess else {
+                throw Abort(.forbidden, reason: "You don't have access to this project")
+            }
+            query = query.filter(\.$project.$id == requestedProjectId)
+        } else {
+            let resolved = try await ProjectVisibility.resolve(on: req)
+            guard !resolved.reachesNoProject else { return [] }
+            if let candidates = resolved.candidateProjectIDs {
+                query = query.filter(\.$project.$id ~~ candidates)
+            }
+        }
+
+        let buckets = try await query.all()
+        let nodes = buckets.compactMap { $0.id.map { IAMNode(type: .bucket, id: $0) } }
+        let readable = try await req.canFilter("bucket:read", on: nodes)
+
+        return buckets.compactMap { bucket in
+            guard let id = bucket.id, readable.contains(IAMNode(type: .bucket, id: id)) else { return nil }
+            return BucketResponse(from: bucket)
+        }
+    }
+
+    /// GET /api/buckets/:bucketID
+    @Sendable
+    func show(req: Request) async throws -> BucketResponse {
+        let bucket = try await fetchBucketWithPermission(req: req, permission: "read")
+        return BucketResponse(from: bucket)
+    }
+
+    // MARK: - Create
+
+    /// POST /api/buckets
+    @Sendable
+    func create(req: Request) async throws -> Response {
+        let user = try req.auth.require(User.self)
+        let decoded = try req.content.decode(CreateBucketRequest.self)
+        let target = try await req.authorizeCreateProject(
+            requestedProjectId: decoded.projectId, user: user, resourceKind: "buckets")
+        let createRequest = try await req.admitCreate(
+            decoded, resourceKind: .bucket, resourceName: decoded.name, projectID: try target.requireID(), user: user)
+
+        guard BucketName.isValid(createRequest.name) else {
+            throw Abort(
+                .badRequest,
+                reason:
+                    "'name' must be 3-63 lowercase letters, digits, '.' or '-', start and end with a letter or digit, and not look like an IP address"
+            )
+        }
+        if let quotaBytes = createRequest.quotaBytes, quotaBytes <= 0 {
+            throw Abort(.badRequest, reason: "'quotaBytes' must be positive")
+        }
+
+        let (project, environment) = try await req.resolveProjectForCreate(
+            requestedProjectId: createRequest.projectId,
+            requestedEnvironment: createRequest.environment,
+            user: user,
+            resourceKind: "buckets"
+        )
+        let projectId = try project.requireID()
+
+        let hasPermission = try await req.can("create_bucket", on: "project", id: projectId.uuidString)
+        guard hasPermission else {
+            throw Abort(.forbidden, reason: "You don't have permission to create buckets in this project")
+        }
+
+        // Checked up front for a readable error; the unique index is what
+        // settles a race.
+        if try await Bucket.query(on: req.db).filter(\.$name == createRequest.name).first() != nil {
+            throw Abort(.conflict, reason: "A bucket named '\(createRequest.name)' already exists")
+        }
+
+        let pool: StoragePool
+        if let poolId = createRequest.poolId {
+            guard let requested = try await StoragePool.find(poolId, on: req.db) else {
+                throw Abort(.badRequest, reason: "Storage pool \(poolId) does not exist")
+            }
+            pool = requested
+        } else {
+            pool = try await StoragePool.defaultPool(on: req.db)
+        }
+        let hypervisorId = try await Self.placementAgent(in: pool, on: req)
+
+        let bucket = Bucket(
+            name: createRequest.name,
+            description: createRequest.description,
+            projectID: projectId,
+            environment: environment,
+            poolID: try pool.requireID(),
+            quotaBytes: createRequest.quotaBytes
+        )
+        bucket.hypervisorId = hypervisorId
+
+        let userID = try user.requireID()
+        do {
+            try await req.db.transaction { db in
+                try await bucket.save(on: db)
+                try await RoleBindingService.grant(
+                    principalType: .user,
+                    principalID: userID,
+                    role: .admin,
+                    nodeType: .bucket,
+                    nodeID: try bucket.requireID(),
+                    createdBy: userID,
+                    on: db
+                )
+            }
+        } catch let error as any DatabaseError where error.isConstraintFailure {
+            throw Abort(.conflict, reason: "A bucket named '\(createRequest.name)' already exists")
+        }
+
+        await req.application.agentService.syncDesiredState(agentId: hypervisorId)
+
+        req.logger.info(
+            "Bucket created",
+            metadata: [
+                "bucketId": .string(bucket.id?.uuidString ?? ""),
+                "agentId": .string(hypervisorId),
+            ])
+
+        let response = Response(status: .created)
+        try response.content.encode(BucketResponse(from: bucket))
+        return response
+    }
+
+    /// The agent to host a new bucket: an online, v25+ member of `pool` that
+    /// runs an object gateway, preferring the one holding the fewest buckets.
+    /// As with file shares, a replicated pool still places the bucket on a
+    /// single member.
+    private static func placementAgent(in pool: StoragePool, on req: Request) async throws -> String {
+        let agents = await req.application.agentService.getAgentList()
+        let candidates = agents.filter {
+            $0.status == .online
+                && WireProtocol.supportsObjectStorage($0.wireProtocolVersion ?? 0)
+                && $0.capabilities.contains(StorageCapability.objectGateway)
+                && VolumeTypeDefinition.agentQualifies(
+                    agentId: $0.id?.uuidString ?? "", capabilities: $0.capabilities, pool: pool,
+                    requiresEncryption: false)
+        }
+        .compactMap { $0.id?.uuidString }
+        guard !candidates.isEmpty else {
+            throw Abort(
+                .conflict,
+                reason:
+                    "No online agent in pool '\(pool.name)' can serve buckets (needs wire protocol >= \(WireProtocol.objectStorageMinimumVersion) and the '\(StorageCapability.objectGateway)' capability)"
+            )
+        }
+
+        var load: [String: Int] = [:]
+        for bucket in try await Bucket.query(on: req.db).filter(\.$hypervisorId ~~ candidates).all() {
+            if let agentId = bucket.hypervisorId {
+                load[agentId, default: 0] += 1
+            }
+        }
+        return candidates.sorted { (load[$0] ?? 0, $0) < (load[$1] ?? 0, $1) }[0]
+    }
+
+    // MARK: - Update
+
+    /// PATCH /api/buckets/:bucketID — description and quota. Lowering the
+    /// quota below current usage is allowed: existing objects stay, and
+    /// writes are refused until usage drops under it.
+    @Sendable
+    func update(req: Request) async throws -> BucketResponse {
+        let bucket = try await fetchBucketWithPermission(req: req, permission: "update")
+        let request = try req.content.decode(UpdateBucketRequest.self)
+
+        guard bucket.desiredStatus == .present else {
+            throw Abort(.conflict, reason: "Bucket cannot be updated in status '\(bucket.status.rawValue)'")
+        }
+        if let quotaBytes = request.quotaBytes, quotaBytes <= 0 {
+            throw Abort(.badRequest, reason: "'quotaBytes' must be positive")
+        }
+        if request.quotaBytes != nil, request.removeQuota == true {
+            throw Abort(.badRequest, reason: "'quotaBytes' and 'removeQuota' are mutually exclusive")
+        }
+
+        if let description = request.description {
+            bucket.description = description
+        }
+        let quotaBytes = request.removeQuota == true ? nil : (request.quotaBytes ?? bucket.quotaBytes)
+        let quotaChanged = quotaBytes != bucket.quotaBytes
+        if quotaChanged {
+            bucket.quotaBytes = quotaBytes
+            bucket.bumpGeneration()
+        }
+        try await bucket.save(on: req.db)
+
+        if quotaChanged, let hypervisorId = bucket.hypervisorId {
+            await req.application.agentService.syncDesiredState(agentId: hypervisorId)
+        }
+        return BucketResponse(from: bucket)
+    }
+
+    // MARK: - Delete
+
+    /// DELETE /api/buckets/:bucketID — only an empty bucket, as in S3. The
+    /// check reads the last report, so an object written since is removed
+    /// with the bucket.
+    @Sendable
+    func delete(req: Request) async throws -> Response {
+        let bucket = try await fetchBucketWithPermission(req: req, permission: "delete")
+
+        guard bucket.objectCount == 0 else {
+            throw Abort(.conflict, reason: "Bucket '\(bucket.name)' is not empty")
+        }
+        guard bucket.desiredStatus == .present else {
+            return Response(status: .accepted)
+        }
+
+        // Same shape as file-share deletion: desired becomes `.absent` and the
+        // row goes once a report confirms it; a bucket whose agent is gone is
+        // removed directly.
+        let app = req.application
+        guard let hypervisorId = bucket.hypervisorId,
+            await app.agentService.agentIsOnline(agentId: hypervisorId)
+        else {
+            try await Self.performDirectDeletion(bucket: bucket, on: req.db, app: app)
+            return Response(status: .noContent)
+        }
+
+        bucket.setDesiredStatus(.absent)
+        bucket.setStatus(.deleting)
+        try await bucket.save(on: req.db)
+        await app.agentService.syncDesiredState(agentId: hypervisorId)
+        return Response(status: .accepted)
+    }
+
+    /// Removes a bucket whose agent is offline: the record and its role
+    /// bindings. If the agent comes back still holding it, the bucket is
+    /// dropped there by the next sync, which no longer lists it.
+    static func performDirectDeletion(bucket: Bucket, on db: any Database, app: Application) async throws {
+        let bucketID = try bucket.requireID()
+        app.logger.warning(
+            "Deleting bucket record without agent teardown; agent is offline",
+            metadata: ["bucketId": .string(bucketID.uuidString)])
+        try await db.transaction { db in
+            try await bucket.delete(on: db)
+            try await RoleBindingService.revokeAll(nodeType: .bucket, nodeID: bucketID, on: db)
+        }
+    }
+
+    // MARK: - Helpers
+
+    /// Pushes desired state to every agent holding a bucket, so a credential
+    /// change reaches the gateways now rather than at the next forced sync.
+    static func syncGateways(app: Application) async throws {
+        let agentIds = Set(try await Bucket.query(on: app.db).all().compactMap(\.hypervisorId))
+        for agentId in agentIds.sorted() {
+            await app.agentService.syncDesiredState(agentId: agentId)
+        }
+    }
+
+    /// Fetch a bucket by its :bucketID route parameter and enforce a
+    /// permission on it.
+    private func fetchBucketWithPermission(req: Request, permission: String) async throws -> Bucket {
+        guard let bucketID = req.parameters.get("bucketID", as: UUID.self) else {
+            throw Abort(.badRequest, reason: "Invalid bucket ID")
+        }
+        return try await req.authorizedBucket(bucketID, permission: permission)
+    }
+}
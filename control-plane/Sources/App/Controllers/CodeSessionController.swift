@@ -0,0 +1,229 @@
+import Fluent
+import Foundation
+import StratoShared
+import Vapor
+
+/// `/api/code-sessions`: code-interpreter sessions for running
+/// model-generated code. Each session is a sandbox of its own running a
+/// persistent language kernel, so the sandbox's IAM, quota, placement and
+/// deletion apply unchanged: reading a session is `sandbox:read` on its
+/// sandbox, executing is `sandbox:exec`, deleting is `sandbox:delete`.
+/// `CodeSessionService` runs executions and the idle lifecycle.
+struct CodeSessionController: RouteCollection {
+    func boot(routes: any RoutesBuilder) throws {
+        let sessions = routes.grouped("api", "code-sessions")
+        sessions.get(use: index)
+        sessions.post(use: create)
+        sessions.group(":sessionID") { session in
+            session.get(use: show)
+            session.delete(use: delete)
+            session.post("execute", use: execute)
+        }
+    }
+
+    // MARK: - Reads
+
+    /// GET /api/code-sessions — sessions whose sandbox the caller may read,
+    /// newest first. Query params: limit/offset (optional).
+    func index(req: Request) async throws -> PagedResponse<CodeSessionResponse> {
+        _ = try req.auth.require(User.self)
+        let paging = try ListPaging.decode(from: req)
+
+        let sessions = try await CodeSession.query(on: req.db)
+            .with(\.$sandbox)
+            .sort(\.$createdAt, .descending)
+            .sort(\.$id, .descending)
+            .all()
+        let nodes = sessions.map { IAMNode(type: .sandbox, id: $0.$sandbox.id) }
+        let readable = try await req.canFilter("sandbox:read", on: nodes)
+
+        let now = Date()
+        return paging.page(
+            sessions.compactMap { session in
+                guard readable.contains(IAMNode(type: .sandbox, id: session.$sandbox.id)) else { return nil }
+                return CodeSessionResponse(from: session, sandbox: session.sandbox, now: now)
+            })
+    }
+
+    func show(req: Request) async throws -> CodeSessionResponse {
+        _ = try req.auth.require(User.self)
+        let (session, sandbox) = try await fetchSession(req: req, permission: "read")
+        return CodeSessionResponse(from: session, sandbox: sandbox)
+    }
+
+    /// The session named by `:sessionID` and its sandbox, with `permission`
+    /// enforced on the sandbox. A session the caller cannot see is a 404
+    /// only after the permission check, as for sandboxes themselves.
+    private func fetchSession(req: Request, permission: String) async throws -> (CodeSession, Sandbox) {
+        guard let sessionID = req.parameters.get("sessionID", as: UUID.self) else {
+            throw Abort(.badRequest, reason: "Invalid code session ID")
+        }
+        guard let session = try await CodeSession.find(sessionID, on: req.db) else {
+            throw Abort(.notFound)
+        }
+        let sandbox = try await req.authorizedSandbox(session.$sandbox.id, permission: permission)
+        return (session, sandbox)
+    }
+
+    // MARK: - Create
+
+    /// POST /api/code-sessions — provisions the session's sandbox from the
+    /// deployment's image for the language and returns `201 Created`. The
+    /// session is `starting` until the sandbox runs; poll it for `ready`.
+    func create(req: Request) async throws -> Response {
+        let user = try req.auth.require(User.self)
+        let decoded = try req.content.decode(CreateCodeSessionRequest.self)
+        let target = try await req.authorizeCreateProject(
+            requestedProjectId: decoded.projectId, user: user, resourceKind: "sandboxes")
+        let createRequest = try await req.admitCreate(
+            decoded, resourceKind: .sandbox, resourceName: nil, projectID: try target.requireID(), user: user)
+
+        guard let image = req.application.codeSessions.configuration.images[createRequest.language] else {
+            throw Abort(
+                .badRequest,
+                reason: "Code sessions for '\(createRequest.language.rawValue)' are not enabled on this deployment")
+        }
+        let idleTimeout = createRequest.idleTimeoutSeconds ?? CodeSession.defaultIdleTimeoutSeconds
+        guard CodeSession.idleTimeoutRange.contains(idleTimeout) else {
+            throw Abort(
+                .badRequest,
+                reason:
+                    "'idleTimeoutSeconds' must be between \(CodeSession.idleTimeoutRange.lowerBound) and \(CodeSession.idleTimeoutRange.upperBound)"
+            )
+        }
+        let cpus = createRequest.cpus ?? 1
+        let memory = createRequest.memory ?? Int64(1024 * 1024 * 1024)
+        guard cpus > 0 else {
+            throw Abort(.badRequest, reason: "'cpus' must be positive")
+        }
+        guard memory > 0 else {
+            throw Abort(.badRequest, reason: "'memory' must be positive")
+        }
+        if let ttl = createRequest.ttlSeconds, ttl <= 0 {
+            throw Abort(.badRequest, reason: "'ttlSeconds' must be positive")
+        }
+
+        let (project, environment) = try await req.resolveProjectForCreate(
+            requestedProjectId: createRequest.projectId,
+            requestedEnvironment: createRequest.environment,
+            user: user,
+            resourceKind: "sandboxes"
+        )
+        let projectID = try project.requireID()
+        let userID = try user.requireID()
+
+        let sessionID = UUID()
+        let language = createRequest.language
+        let sandbox = Sandbox(
+            name: "code-\(language.rawValue)-\(sessionID.uuidString.prefix(8).lowercased())",
+            projectID: projectID,
+            environment: environment,
+            image: image,
+            cpus: cpus,
+            memory: memory,
+            entrypoint: nil,
+            cmd: ["strato-kernel", "serve", "--language", language.rawValue],
+            env: createRequest.env ?? [:],
+            workingDir: nil,
+            ttlSeconds: createRequest.ttlSeconds
+        )
+        let session = CodeSession(
+            id: sessionID, sandboxID: UUID(), projectID: projectID, language: language,
+            idleTimeoutSeconds: idleTimeout, createdByID: userID)
+
+        // The session row commits with the sandbox, so a session never exists
+        // without one; it cascades away when the sandbox is deleted.
+        let operation = try await SandboxController.provision(
+            sandbox, in: project, environment: environment, userID: userID, desiredStatus: .running, on: req
+        ) { db in
+            session.$sandbox.id = try sandbox.requireID()
+            try await session.create(on: db)
+        }
+
+        req.logger.info(
+            "Code session created",
+            metadata: [
+                "codeSessionId": .string(sessionID.uuidString),
+                "sandbox_id": .string(sandbox.id?.uuidString ?? ""),
+                "operation_id": .string(operation.id?.uuidString ?? ""),
+                "language": .string(language.rawValue),
+            ])
+
+        let response = Response(status: .created)
+        try response.content.encode(CodeSessionResponse(from: session, sandbox: sandbox))
+        return response
+    }
+
+    // MARK: - Delete
+
+    /// DELETE /api/code-sessions/:sessionID — deletes the session's sandbox
+    /// (and with it the session and any checkpoint); `202 Accepted` with the
+    /// sandbox's delete operation.
+    func delete(req: Request) async throws -> Response {
+        let user = try req.auth.require(User.self)
+        let (_, sandbox) = try await fetchSession(req: req, permission: "delete")
+        let operation = try await SandboxController.beginDeletion(
+            of: sandbox, userID: try user.requireID(), on: req.db, app: req.application)
+        return try operation.acceptedResponse()
+    }
+
+    // MARK: - Execute
+
+    /// POST /api/code-sessions/:sessionID/execute — runs code in the
+    /// session's kernel and returns its output. A checkpointed session is
+    /// resumed first: the call answers `409` with `Retry-After` while the
+    /// restore runs, and the retry executes against the restored kernel.
+    func execute(req: Request) async throws -> CodeExecutionResponse {
+        let user = try req.auth.require(User.self)
+        let executeRequest = try req.content.decode(ExecuteCodeRequest.self)
+        guard !executeRequest.code.isEmpty else {
+            throw Abort(.badRequest, reason: "'code' must be non-empty")
+        }
+        guard executeRequest.code.utf8.count <= CodeSession.maxCodeBytes else {
+            throw Abort(.payloadTooLarge, reason: "'code' exceeds \(CodeSession.maxCodeBytes) bytes")
+        }
+        let timeout = executeRequest.timeoutSeconds ?? CodeSession.defaultExecutionTimeoutSeconds
+        guard CodeSession.executionTimeoutRange.contains(timeout) else {
+            throw Abort(
+                .badRequest,
+                reason:
+                    "'timeoutSeconds' must be between \(CodeSession.executionTimeoutRange.lowerBound) and \(CodeSession.executionTimeoutRange.upperBound)"
+            )
+        }
+
+        let (session, sandbox) = try await fetchSession(req: req, permission: "exec")
+        let service = req.application.codeSessions
+        guard sandbox.desiredStatus != .absent else {
+            throw Abort(.conflict, reason: "Code session is being deleted")
+        }
+        // Settle any lifecycle step that is due (a finished checkpoint or
+        // restore) so the status below is current.
+        await service.advance(session, sandbox: sandbox, on: req.db)
+
+        switch CodeSessionStatus(session: session, sandbox: sandbox) {
+        case .ready:
+            return try await service.execute(
+                session, sandbox: sandbox, code: executeRequest.code, timeoutSeconds: timeout,
+                userID: try user.requireID(), on: req)
+        case .checkpointed:
+            try await service.resume(session, sandbox: sandbox, userID: try user.requireID(), on: req.db)
+            throw Self.retryLater("Code session is resuming from its idle checkpoint")
+        case .resuming:
+            throw Self.retryLater("Code session is resuming from its idle checkpoint")
+        case .checkpointing:
+            throw Self.retryLater("Code session is being checkpointed after going idle")
+        case .starting:
+            throw Self.retryLater("Code session's sandbox is still starting")
+        case .busy:
+            throw Abort(.conflict, reason: "An execution is already running in this session")
+        case .failed:
+            throw Abort(
+                .conflict,
+                reason: "Code session's sandbox is \(sandbox.status.rawValue); delete the session and start a new one")
+        }
+    }
+
+    private static func retryLater(_ reason: String) -> Abort {
+        Abort(.conflict, headers: ["Retry-After": "5"], reason: reason)
+    }
+}
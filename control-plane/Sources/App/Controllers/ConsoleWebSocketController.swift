@@ -8,6 +8,9 @@ struct ConsoleWebSocketController: RouteCollection {
         // WebSocket endpoint for VM console: /api/vms/:vmID/console
         let vmRoutes = routes.grouped("api", "vms")
         vmRoutes.webSocket(":vmID", "console", onUpgrade: websocketHandler)
+        // A participant joining a shared session (see SharedSessionController):
+        // /api/vms/:vmID/console/sessions/:sessionID/join
+        vmRoutes.webSocket(":vmID", "console", "sessions", ":sessionID", "join", onUpgrade: joinHandler)
     }
 
     // Non-async handler - runs on WebSocket's event loop
@@ -44,9 +47,13 @@ struct ConsoleWebSocketController: RouteCollection {
                 vmId: vmIdString,
                 agentKey: agentKey,
                 userId: userId,
-                websocket: ws
+                username: req.auth.get(User.self)?.username,
+                terminal: WebSocketConsoleTerminal(websocket: ws)
             )
 
+            // The owner needs the session's ID to share it.
+            try? await ws.send("session: \(sessionId)")
+
             // WebSocketKit's frame-callback setters are loop-bound
             // (`NIOLoopBoundBox`): calling them from this task — which runs on
             // the concurrent executor, not the socket's event loop — trips
@@ -124,6 +131,92 @@ struct ConsoleWebSocketController: RouteCollection {
         }
     }
 
+    // Non-async handler - runs on WebSocket's event loop
+    private func joinHandler(req: Request, ws: WebSocket) {
+        guard let vmIdString = req.parameters.get("vmID"),
+            let vmId = UUID(uuidString: vmIdString),
+            let sessionId = req.parameters.get("sessionID")
+        else {
+            ws.send("error: Invalid VM or session ID")
+            _ = ws.close(code: .unacceptableData)
+            return
+        }
+
+        Task {
+            // The invitee must be able to open the console themselves: the
+            // same checks as a new session, made again at every join.
+            guard await validateConsoleAccess(req: req, ws: ws, vmId: vmId) != nil,
+                let user = req.auth.get(User.self), let userId = user.id
+            else {
+                return
+            }
+
+            let manager = req.consoleSessionManager
+            guard manager.getSession(sessionId: sessionId)?.vmId == vmIdString else {
+                try? await ws.send("error: Console session not found")
+                try? await ws.close(code: .policyViolation)
+                return
+            }
+            let participantId: UUID
+            let access: SessionAccess
+            do {
+                (participantId, access) = try manager.join(
+                    sessionId: sessionId, userId: userId, username: user.username,
+                    terminal: WebSocketConsoleTerminal(websocket: ws))
+            } catch {
+                try? await ws.send("error: You are not invited to this console session")
+                try? await ws.close(code: .policyViolation)
+                return
+            }
+
+            req.logger.info(
+                "Participant joined console session",
+                metadata: [
+                    "vmId": .string(vmIdString),
+                    "sessionId": .string(sessionId),
+                    "access": .string(access.rawValue),
+                ])
+            if let record = manager.joinRecord(
+                sessionId: sessionId, userId: userId, username: user.username, access: access)
+            {
+                await req.application.audit.record(record)
+            }
+
+            // The console is already attached; the participant's access
+            // decides whether their input goes anywhere.
+            WebSocketConsoleTerminal(websocket: ws).consoleReady()
+            WebSocketConsoleTerminal(websocket: ws).notice("joined session \(sessionId) \(access.label)")
+
+            // One consumer, so keystrokes reach the agent in the order typed.
+            let (input, continuation) = AsyncStream.makeStream(of: Data.self)
+            Task {
+                for await data in input {
+                    do {
+                        try await manager.routeParticipantInput(
+                            sessionId: sessionId, participantId: participantId, data: data)
+                    } catch {
+                        req.logger.error("Failed to route console input to agent: \(error)")
+                    }
+                }
+            }
+
+            // Frame callbacks are loop-bound; see `websocketHandler`.
+            ws.eventLoop.execute {
+                ws.onBinary { _, buffer in
+                    continuation.yield(Data(buffer.readableBytesView))
+                }
+                ws.onText { _, text in
+                    continuation.yield(Data(text.utf8))
+                }
+            }
+
+            ws.onClose.whenComplete { _ in
+                continuation.finish()
+                manager.removeParticipant(sessionId: sessionId, participantId: participantId)
+            }
+        }
+    }
+
     /// Authenticates and authorizes the console request, then resolves the
     /// VM's agent. Returns the agent's identity key and user ID on success; on any
     /// failure it reports the error over the socket, closes it, and returns
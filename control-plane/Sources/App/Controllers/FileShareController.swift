@@ -0,0 +1,462 @@
+import Fluent
+import Foundation
+import StratoShared
+import Vapor
+
+/// `/api/file-shares`: managed NFS file shares — shared POSIX storage for a
+/// project's VMs. A share is placed on one pool-member agent at create time
+/// and served from its own address on one of the owner project's logical
+/// networks; everything after that is level-triggered desired state driven
+/// through `ResourceOperationCoordinator`, exactly like sandboxes: mutations
+/// return `202 Accepted` with an operation, and the agent's observed-state
+/// report decides its verdict.
+struct FileShareController: RouteCollection {
+    func boot(routes: any RoutesBuilder) throws {
+        let shares = routes.grouped("api", "file-shares").grouped(User.guardMiddleware())
+        shares.get(use: index)
+        shares.post(use: create)
+        shares.group(":shareID") { share in
+            share.get(use: show)
+            share.delete(use: delete)
+            share.post("resize", use: resize)
+            share.get("operations", use: listOperations)
+            share.post("snapshots", use: createSnapshot)
+            share.get("snapshots", use: listSnapshots)
+            share.delete("snapshots", ":snapshotID", use: deleteSnapshot)
+        }
+    }
+
+    // MARK: - Reads
+
+    /// GET /api/file-shares
+    /// Query params: project_id (optional),
+    /// limit/offset (optional) — select the page.
+    @Sendable
+    func index(req: Request) async throws -> PagedResponse<FileShareResponse> {
+        let paging = try ListPaging.decode(from: req)
+        let shares = try await visibleShares(req: req)
+        return paging.page(shares)
+    }
+
+    /// Every file share the caller may read, newest first, ready for slicing.
+    func visibleShares(req: Request) async throws -> [FileShareResponse] {
+        _ = try req.auth.require(User.self)
+        let requestedProjectId = req.query[String.self, at: "project_id"].flatMap(UUID.init(uuidString:))
+
+        var query = FileShare.query(on: req.db)
+            .sort(\.$createdAt, .descending)
+            .sort(\.$id, .descending)
+
+        // Project scoping as in SecurityGroupController.visibleGroups.
+        if let requestedProjectId {
+            let hasAccess = try await req.can("view_project", on: "project", id: requestedProjectId.uuidString)
+            guard hasAccess else {
+                throw Abort(.forbidden, reason: "You don't have access to this project")
+            }
+            query = query.filter(\.$project.$id == requestedProjectId)
+        } else {
+            let resolved = try await ProjectVisibility.resolve(on: req)
+            guard !resolved.reachesNoProject else { return [] }
+            if let candidates = resolved.candidateProjectIDs {
+                query = query.filter(\.$project.$id ~~ candidates)
+            }
+        }
+
+        // One batched decision for the whole page, as in SandboxController.
+        let shares = try await query.all()
+        let nodes = shares.compactMap { $0.id.map { IAMNode(type: .fileShare, id: $0) } }
+        let readable = try await req.canFilter("fileshare:read", on: nodes)
+
+        return shares.compactMap { share in
+            guard let id = share.id, readable.contains(IAMNode(type: .fileShare, id: id)) else { return nil }
+            return FileShareResponse(from: share)
+        }
+    }
+
+    /// GET /api/file-shares/:shareID
+    @Sendable
+    func show(req: Request) async throws -> FileShareResponse {
+        let share = try await fetchShareWithPermission(req: req, permission: "read")
+        return FileShareResponse(from: share)
+    }
+
+    /// GET /api/file-shares/:shareID/operations
+    @Sendable
+    func listOperations(req: Request) async throws -> [OperationResponse] {
+        let share = try await fetchShareWithPermission(req: req, permission: "read")
+        let shareID = try share.requireID()
+
+        let requestedLimit: Int = req.query["limit"] ?? 20
+        let limit = min(max(requestedLimit, 1), 100)
+
+        let operations = try await ResourceOperation.query(on: req.db)
+            .filter(\.$resourceKind == .fileShare)
+            .filter(\.$resourceID == shareID)
+            .sort(\.$createdAt, .descending)
+            .limit(limit)
+            .all()
+
+        return operations.map { OperationResponse(from: $0) }
+    }
+
+    // MARK: - Create
+
+    /// POST /api/file-shares
+    @Sendable
+    func create(req: Request) async throws -> Response {
+        let user = try req.auth.require(User.self)
+        let decoded = try req.content.decode(CreateFileShareRequest.self)
+        let target = try await req.authorizeCreateProject(
+            requestedProjectId: decoded.projectId, user: user, resourceKind: "file shares")
+        let createRequest = try await req.admitCreate(
+            decoded, resourceKind: .fileShare, resourceName: decoded.name, projectID: try target.requireID(),
+            user: user)
+
+        let name = createRequest.name.trimmingCharacters(in: .whitespacesAndNewlines)
+        guard !name.isEmpty else {
+            throw Abort(.badRequest, reason: "'name' must be non-empty")
+        }
+        guard createRequest.sizeBytes > 0 else {
+            throw Abort(.badRequest, reason: "'sizeBytes' must be positive")
+        }
+
+        let (project, environment) = try await req.resolveProjectForCreate(
+            requestedProjectId: createRequest.projectId,
+            requestedEnvironment: createRequest.environment,
+            user: user,
+            resourceKind: "file shares"
+        )
+        let projectId = try project.requireID()
+
+        let hasPermission = try await req.can("create_file_share", on: "project", id: projectId.uuidString)
+        guard hasPermission else {
+            throw Abort(.forbidden, reason: "You don't have permission to create file shares in this project")
+        }
+
+        // Exported only onto the owner project's own networks: shared or
+        // other projects' networks would put the NFS server in front of
+        // workloads the access rules know nothing about.
+        guard let network = try await LogicalNetwork.find(createRequest.networkId, on: req.db) else {
+            throw Abort(.badRequest, reason: "Network \(createRequest.networkId) does not exist")
+        }
+        guard network.$project.id == projectId else {
+            throw Abort(.badRequest, reason: "File shares can only be exported on a network owned by their project")
+        }
+        // The NFS server is addressed over IPv4 only.
+        guard !network.isIPv6Only else {
+            throw Abort(.badRequest, reason: "File shares can't be exported on an IPv6-only network")
+        }
+
+        let pool: StoragePool
+        if let poolId = createRequest.poolId {
+            guard let requested = try await StoragePool.find(poolId, on: req.db) else {
+                throw Abort(.badRequest, reason: "Storage pool \(poolId) does not exist")
+            }
+            pool = requested
+        } else {
+            pool = try await StoragePool.defaultPool(on: req.db)
+        }
+        let hypervisorId = try await Self.placementAgent(in: pool, on: req)
+
+        let share = FileShare(
+            name: name,
+            description: createRequest.description,
+            projectID: projectId,
+            environment: environment,
+            networkID: try network.requireID(),
+            poolID: try pool.requireID(),
+            sizeBytes: createRequest.sizeBytes,
+            ipAddress: "",
+            netmask: "",
+            macAddress: VMNetworkInterface.generateMACAddress()
+        )
+        share.hypervisorId = hypervisorId
+
+        // Quota admission, the server's address, the insert, and the pending
+        // create operation commit as one transaction, retried on an address
+        // collision exactly like sandbox creation.
+        let userID = try user.requireID()
+        let operation: ResourceOperation
+        do {
+            operation = try await VMController.retryingOnConstraintFailure {
+                share.id = nil
+                share.$id.exists = false
+                return try await req.db.transaction { db -> ResourceOperation in
+                    try await QuotaEnforcementService.reserveFileShare(
+                        for: project,
+                        environment: environment,
+                        size: share.sizeBytes,
+                        on: db
+                    )
+
+                    guard let allocation = try await IPAMService.allocateIP(for: network, on: db) else {
+                        throw Abort(.badRequest, reason: "File shares can't be exported on an IPv6-only network")
+                    }
+                    share.ipAddress = allocation.ipAddress
+                    share.netmask = allocation.netmask
+                    try await share.save(on: db)
+                    let shareID = try share.requireID()
+
+                    let operation = ResourceOperation(fileShareID: shareID, userID: userID, kind: .create)
+                    try await operation.save(on: db)
+
+                    try await RoleBindingService.grant(
+                        principalType: .user,
+                        principalID: userID,
+                        role: .admin,
+                        nodeType: .fileShare,
+                        nodeID: shareID,
+                        createdBy: userID,
+                        on: db
+                    )
+
+                    return operation
+                }
+            }
+        } catch let error as IPAMService.IPAMError {
+            throw Abort(.conflict, reason: error.errorDescription ?? "No free IP addresses in the network")
+        }
+
+        let shareID = try share.requireID()
+        req.resourceOperationCoordinator.dispatch(
+            operation, resourceKind: .fileShare, resourceID: shareID, hypervisorId: hypervisorId,
+            dispatch: .stateSync, app: req.application)
+
+        req.logger.info(
+            "File share creation accepted",
+            metadata: [
+                "fileShareId": .string(shareID.uuidString),
+                "operation_id": .string(operation.id?.uuidString ?? ""),
+                "agentId": .string(hypervisorId),
+            ])
+
+        return try operation.acceptedResponse()
+    }
+
+    /// The agent to host a new share: an online, v24+ member of `pool` that
+    /// advertises NFS file-share support, preferring the one serving the
+    /// fewest shares. A replicated pool still places the share on a single
+    /// member — its data is not replicated yet.
+    private static func placementAgent(in pool: StoragePool, on req: Request) async throws -> String {
+        let agents = await req.application.agentService.getAgentList()
+        let candidates = agents.filter {
+            $0.status == .online
+                && WireProtocol.supportsFileShares($0.wireProtocolVersion ?? 0)
+                && $0.capabilities.contains(StorageCapability.nfsFileShare)
+                && VolumeTypeDefinition.agentQualifies(
+                    agentId: $0.id?.uuidString ?? "", capabilities: $0.capabilities, pool: pool,
+                    requiresEncryption: false)
+        }
+        .compactMap { $0.id?.uuidString }
+        guard !candidates.isEmpty else {
+            throw Abort(
+                .conflict,
+                reason:
+                    "No online agent in pool '\(pool.name)' can serve file shares (needs wire protocol >= \(WireProtocol.fileShareMinimumVersion) and the '\(StorageCapability.nfsFileShare)' capability)"
+            )
+        }
+
+        var load: [String: Int] = [:]
+        for share in try await FileShare.query(on: req.db).filter(\.$hypervisorId ~~ candidates).all() {
+            if let agentId = share.hypervisorId {
+                load[agentId, default: 0] += 1
+            }
+        }
+        return candidates.sorted { (load[$0] ?? 0, $0) < (load[$1] ?? 0, $1) }[0]
+    }
+
+    // MARK: - Resize
+
+    /// POST /api/file-shares/:shareID/resize — grow only; a filesystem under
+    /// live NFS clients cannot be shrunk safely.
+    @Sendable
+    func resize(req: Request) async throws -> Response {
+        let user = try req.auth.require(User.self)
+        let share = try await fetchShareWithPermission(req: req, permission: "resize")
+        let request = try req.content.decode(ResizeFileShareRequest.self)
+
+        guard request.sizeBytes > share.sizeBytes else {
+            throw Abort(
+                .badRequest,
+                reason: "'sizeBytes' must be larger than the current size (\(share.sizeBytes)); shares cannot shrink")
+        }
+        guard share.status == .available else {
+            throw Abort(.conflict, reason: "File share cannot be resized in status '\(share.status.rawValue)'")
+        }
+
+        let growth = request.sizeBytes - share.sizeBytes
+        let project = try await share.$project.get(on: req.db)
+        let operation = try await req.resourceOperationCoordinator.perform(
+            .resize, resourceKind: .fileShare, resourceID: share.requireID(), userID: user.requireID(),
+            hypervisorId: share.hypervisorId, dispatch: .stateSync, on: req.db, app: req.application
+        ) { @Sendable db in
+            try await QuotaEnforcementService.reserveFileShare(
+                for: project, environment: share.environment, size: growth, on: db)
+            share.sizeBytes = request.sizeBytes
+            share.setStatus(.resizing)
+            share.bumpGeneration()
+            try await share.save(on: db)
+        }
+        return try operation.acceptedResponse()
+    }
+
+    // MARK: - Snapshots
+
+    /// POST /api/file-shares/:shareID/snapshots
+    @Sendable
+    func createSnapshot(req: Request) async throws -> Response {
+        let user = try req.auth.require(User.self)
+        let share = try await fetchShareWithPermission(req: req, permission: "snapshot")
+        let request = try req.content.decode(CreateFileShareSnapshotRequest.self)
+
+        guard share.status == .available else {
+            throw Abort(.conflict, reason: "File share cannot be snapshotted in status '\(share.status.rawValue)'")
+        }
+        let name =
+            request.name?.trimmingCharacters(in: .whitespacesAndNewlines).nilIfEmpty
+            ?? "\(share.name)-\(ISO8601DateFormatter().string(from: Date()))"
+
+        // Admission charges the share's used bytes as the estimate; the
+        // agent's report replaces it with the real size.
+        let estimate = share.usedBytes ?? 0
+        let project = try await share.$project.get(on: req.db)
+        let shareID = try share.requireID()
+        let operation = try await req.resourceOperationCoordinator.perform(
+            .snapshot, resourceKind: .fileShare, resourceID: shareID, userID: user.requireID(),
+            hypervisorId: share.hypervisorId, dispatch: .stateSync, on: req.db, app: req.application
+        ) { @Sendable db in
+            try await QuotaEnforcementService.reserveFileShare(
+                for: project, environment: share.environment, size: estimate, on: db)
+            let snapshot = FileShareSnapshot(
+                shareID: shareID,
+                projectID: share.$project.id,
+                environment: share.environment,
+                name: name,
+                sizeBytes: estimate
+            )
+            try await snapshot.save(on: db)
+            share.bumpGeneration()
+            try await share.save(on: db)
+        }
+        return try operation.acceptedResponse()
+    }
+
+    /// GET /api/file-shares/:shareID/snapshots
+    @Sendable
+    func listSnapshots(req: Request) async throws -> [FileShareSnapshotResponse] {
+        let share = try await fetchShareWithPermission(req: req, permission: "read")
+        let snapshots = try await FileShareSnapshot.query(on: req.db)
+            .filter(\.$share.$id == share.requireID())
+            .sort(\.$createdAt, .descending)
+            .all()
+        return snapshots.map { FileShareSnapshotResponse(from: $0, share: share) }
+    }
+
+    /// DELETE /api/file-shares/:shareID/snapshots/:snapshotID
+    @Sendable
+    func deleteSnapshot(req: Request) async throws -> Response {
+        let user = try req.auth.require(User.self)
+        let share = try await fetchShareWithPermission(req: req, permission: "snapshot")
+        let shareID = try share.requireID()
+        guard let snapshotID = req.parameters.get("snapshotID", as: UUID.self),
+            let snapshot = try await FileShareSnapshot.find(snapshotID, on: req.db),
+            snapshot.$share.id == shareID
+        else {
+            throw Abort(.notFound, reason: "Snapshot not found")
+        }
+
+        // A snapshot that never made it onto the agent has nothing to tear
+        // down: drop the row and its quota charge directly.
+        if snapshot.status == .error {
+            try await req.db.transaction { db in
+                try await snapshot.delete(on: db)
+                try await QuotaEnforcementService.release(for: share, on: db)
+            }
+            return Response(status: .noContent)
+        }
+        guard snapshot.status == .available else {
+            throw Abort(.conflict, reason: "Snapshot cannot be deleted in status '\(snapshot.status.rawValue)'")
+        }
+
+        let operation = try await req.resourceOperationCoordinator.perform(
+            .snapshotDelete, resourceKind: .fileShare, resourceID: shareID, userID: user.requireID(),
+            hypervisorId: share.hypervisorId, dispatch: .stateSync, on: req.db, app: req.application
+        ) { @Sendable db in
+            snapshot.status = .deleting
+            try await snapshot.save(on: db)
+            share.bumpGeneration()
+            try await share.save(on: db)
+        }
+        return try operation.acceptedResponse()
+    }
+
+    // MARK: - Delete
+
+    /// DELETE /api/file-shares/:shareID
+    @Sendable
+    func delete(req: Request) async throws -> Response {
+        let user = try req.auth.require(User.self)
+        let share = try await fetchShareWithPermission(req: req, permission: "delete")
+
+        // Same shape as sandbox deletion: desired becomes `.absent` and the
+        // row goes once a report confirms it; a share whose agent is gone is
+        // removed directly.
+        let shareID = try share.requireID()
+        let app = req.application
+        let agentOnline: Bool
+        if let hypervisorId = share.hypervisorId {
+            agentOnline = await app.agentService.agentIsOnline(agentId: hypervisorId)
+        } else {
+            agentOnline = false
+        }
+
+        let strategy: ResourceOperationCoordinator.Strategy =
+            agentOnline
+            ? .stateSync
+            : .directResolution { @Sendable db in
+                try await Self.performDirectDeletion(share: share, on: db, app: app)
+            }
+
+        let operation = try await req.resourceOperationCoordinator.perform(
+            .delete, resourceKind: .fileShare, resourceID: shareID, userID: user.requireID(),
+            hypervisorId: share.hypervisorId, dispatch: strategy, on: req.db, app: app
+        ) { @Sendable db in
+            share.setDesiredStatus(.absent)
+            share.setStatus(.deleting)
+            try await share.save(on: db)
+        }
+        return try operation.acceptedResponse()
+    }
+
+    /// Removes a share whose agent is offline: the record, its snapshots (by
+    /// cascade), its quota charge and its role bindings. If the agent comes
+    /// back still serving it, the share is orphaned there for operator
+    /// cleanup.
+    static func performDirectDeletion(share: FileShare, on db: any Database, app: Application) async throws {
+        let shareID = try share.requireID()
+        app.logger.warning(
+            "Deleting file share record without agent teardown; agent is offline",
+            metadata: ["fileShareId": .string(shareID.uuidString)])
+        do {
+            try await db.transaction { db in
+                try await share.delete(on: db)
+                try await QuotaEnforcementService.release(for: share, on: db)
+                try await RoleBindingService.revokeAll(nodeType: .fileShare, nodeID: shareID, on: db)
+            }
+        } catch {
+            throw ResourceOperationCoordinator.WorkError(
+                "Failed to delete file share record: \(error.localizedDescription)")
+        }
+    }
+
+    // MARK: - Helpers
+
+    /// Fetch a share by its :shareID route parameter and enforce a
+    /// permission on it.
+    private func fetchShareWithPermission(req: Request, permission: String) async throws -> FileShare {
+        guard let shareID = req.parameters.get("shareID", as: UUID.self) else {
+            throw Abort(.badRequest, reason: "Invalid file share ID")
+        }
+        return try await req.authorizedFileShare(shareID, permission: permission)
+    }
+}
@@ -234,6 +234,10 @@ struct FloatingIPController: RouteCollection {
         // attach time, so a move would leave the old site advertising
         // addresses from a pool that now claims to answer elsewhere.
         if update.siteId != pool.$site.id {
+            // A BYOIP pool announces from its prefix's site.
+            guard pool.$byoipPrefix.id == nil else {
+                throw Abort(.conflict, reason: "A BYOIP pool's site is its prefix's; re-register the prefix instead")
+            }
             let attached = try await FloatingIP.query(on: req.db)
                 .filter(\.$pool.$id == pool.requireID())
                 .all()
@@ -266,6 +270,9 @@ struct FloatingIPController: RouteCollection {
         let pool = try await findPool(req)
         try await requirePoolPermission(req, pool: pool, manage: true)
         let poolId = try pool.requireID()
+        guard pool.$byoipPrefix.id == nil else {
+            throw Abort(.conflict, reason: "Pool belongs to a BYOIP prefix; delete the prefix instead")
+        }
 
         let allocated = try await FloatingIP.query(on: req.db)
             .filter(\.$pool.$id == poolId)
@@ -0,0 +1,271 @@
+import Foundation
+import NIOConcurrencyHelpers
+import StratoShared
+import Vapor
+
+/// A GraphQL request body, over HTTP or in a socket `subscribe` message.
+struct GraphQLRequest: Content {
+    let query: String
+    let operationName: String?
+    let variables: [String: CodableValue]?
+}
+
+/// The read-only GraphQL API over the resource graph (see
+/// docs/architecture/graphql.md).
+///
+/// - `POST /api/graphql` runs a query. A document that fails to parse,
+///   validate, or fit the cost limit is a 400 with only `errors`; once it
+///   runs the answer is a 200, with `errors` alongside `data` for fields that
+///   failed.
+/// - `GET /api/graphql/schema` prints the schema as SDL.
+/// - `GET /api/graphql/ws` speaks the graphql-transport-ws protocol:
+///   `connection_init` → `connection_ack`, then `subscribe` / `next` /
+///   `error` / `complete` per operation id, plus `ping` / `pong`.
+///
+/// Login is checked by the middleware (`/api/graphql` is login-only); what
+/// a caller can see is decided per object through the evaluator, as each
+/// schema type declares.
+struct GraphQLController: RouteCollection {
+    /// Largest document accepted, in bytes.
+    static let maxDocumentBytes = 64 * 1024
+
+    /// Concurrent operations one socket may run.
+    static let maxOperationsPerSocket = 32
+
+    static let socketProtocol = "graphql-transport-ws"
+
+    func boot(routes: RoutesBuilder) throws {
+        let graphQL = routes.grouped("api", "graphql")
+        graphQL.post(use: query)
+        graphQL.get("schema", use: schema)
+        graphQL.webSocket(
+            "ws",
+            shouldUpgrade: { req in
+                req.eventLoop.makeSucceededFuture(["Sec-WebSocket-Protocol": Self.socketProtocol])
+            },
+            onUpgrade: websocketHandler)
+    }
+
+    @Sendable
+    func query(req: Request) async throws -> Response {
+        _ = try req.auth.require(User.self)
+        let body = try req.content.decode(GraphQLRequest.self)
+        let executor = req.application.graphQL
+
+        let plan: GraphQLPlan
+        do {
+            plan = try Self.plan(body, executor: executor)
+            guard plan.kind == .query else {
+                throw GraphQLError("Subscriptions run over the WebSocket at /api/graphql/ws")
+            }
+        } catch let error as GraphQLError {
+            return try Self.respond(.badRequest, GraphQLExecutor.response(data: nil, errors: [error]))
+        }
+        let result = await executor.execute(plan, context: .query(req))
+        return try Self.respond(.ok, result)
+    }
+
+    @Sendable
+    func schema(req: Request) async throws -> Response {
+        _ = try req.auth.require(User.self)
+        var headers = HTTPHeaders()
+        headers.contentType = .plainText
+        return Response(status: .ok, headers: headers, body: .init(string: req.application.graphQL.schema.sdl()))
+    }
+
+    private static func plan(_ body: GraphQLRequest, executor: GraphQLExecutor) throws -> GraphQLPlan {
+        guard body.query.utf8.count <= maxDocumentBytes else {
+            throw GraphQLError("Document exceeds \(maxDocumentBytes) bytes")
+        }
+        return try executor.plan(body.query, operationName: body.operationName, variables: body.variables)
+    }
+
+    private static func respond(_ status: HTTPStatus, _ result: CodableValue) throws -> Response {
+        let response = Response(status: status)
+        try response.content.encode(result, as: .json)
+        return response
+    }
+
+    // MARK: - Subscriptions
+
+    /// Message envelope of the graphql-transport-ws protocol.
+    private struct SocketMessage: Codable {
+        let type: String
+        let id: String?
+        let payload: CodableValue?
+    }
+
+    private struct SubscribeMessage: Decodable {
+        let id: String
+        let payload: GraphQLRequest
+    }
+
+    /// Per-socket state: whether `connection_init` arrived, and the running
+    /// operations by id.
+    private final class SocketSession: Sendable {
+        private struct State {
+            var initialized = false
+            var operations: [String: Task<Void, Never>] = [:]
+        }
+
+        private let state = NIOLockedValueBox(State())
+
+        /// Marks the socket initialized; false if it already was.
+        func initialize() -> Bool {
+            state.withLockedValue { state in
+                defer { state.initialized = true }
+                return !state.initialized
+            }
+        }
+
+        var isInitialized: Bool { state.withLockedValue { $0.initialized } }
+
+        var operationCount: Int { state.withLockedValue { $0.operations.count } }
+
+        /// Registers a running operation; false if the id is taken.
+        func start(_ id: String, _ task: @escaping @Sendable () -> Task<Void, Never>) -> Bool {
+            state.withLockedValue { state in
+                guard state.operations[id] == nil else { return false }
+                state.operations[id] = task()
+                return true
+            }
+        }
+
+        func finished(_ id: String) {
+            _ = state.withLockedValue { $0.operations.removeValue(forKey: id) }
+        }
+
+        func stop(_ id: String) {
+            state.withLockedValue { $0.operations.removeValue(forKey: id) }?.cancel()
+        }
+
+        func stopAll() {
+            let tasks = state.withLockedValue { state in
+                defer { state.operations = [:] }
+                return Array(state.operations.values)
+            }
+            tasks.forEach { $0.cancel() }
+        }
+    }
+
+    // Non-async handler - runs on WebSocket's event loop
+    private func websocketHandler(req: Request, ws: WebSocket) {
+        guard let user = req.auth.get(User.self), let userID = user.id else {
+            _ = ws.close(code: .init(codeNumber: 4401))
+            return
+        }
+        let session = SocketSession()
+
+        ws.onText { ws, text in
+            Self.handle(text, ws: ws, session: session, req: req, userID: userID)
+        }
+        ws.onClose.whenComplete { _ in
+            session.stopAll()
+        }
+    }
+
+    private static func handle(_ text: String, ws: WebSocket, session: SocketSession, req: Request, userID: UUID) {
+        guard let message = try? JSONDecoder().decode(SocketMessage.self, from: Data(text.utf8)) else {
+            _ = ws.close(code: .init(codeNumber: 4400))
+            return
+        }
+        switch message.type {
+        case "connection_init":
+            guard session.initialize() else {
+                _ = ws.close(code: .init(codeNumber: 4429))  // too many initialisation requests
+                return
+            }
+            send(SocketMessage(type: "connection_ack", id: nil, payload: nil), on: ws)
+        case "ping":
+            send(SocketMessage(type: "pong", id: nil, payload: nil), on: ws)
+        case "pong":
+            break
+        case "subscribe":
+            guard session.isInitialized else {
+                _ = ws.close(code: .init(codeNumber: 4401))
+                return
+            }
+            guard let subscribe = try? JSONDecoder().decode(SubscribeMessage.self, from: Data(text.utf8)) else {
+                _ = ws.close(code: .init(codeNumber: 4400))
+                return
+            }
+            subscribeOperation(subscribe, ws: ws, session: session, req: req, userID: userID)
+        case "complete":
+            if let id = message.id { session.stop(id) }
+        default:
+            _ = ws.close(code: .init(codeNumber: 4400))
+        }
+    }
+
+    private static func subscribeOperation(
+        _ message: SubscribeMessage, ws: WebSocket, session: SocketSession, req: Request, userID: UUID
+    ) {
+        let id = message.id
+        let executor = req.application.graphQL
+        let plan: GraphQLPlan
+        do {
+            guard session.operationCount < maxOperationsPerSocket else {
+                throw GraphQLError("A socket may run at most \(maxOperationsPerSocket) operations at once")
+            }
+            plan = try Self.plan(message.payload, executor: executor)
+        } catch {
+            let graphQLError = error as? GraphQLError ?? GraphQLError("\(error)")
+            send(SocketMessage(type: "error", id: id, payload: .array([graphQLError.response])), on: ws)
+            return
+        }
+
+        let started = session.start(id) {
+            Task {
+                defer { session.finished(id) }
+                if plan.kind == .subscription {
+                    await stream(plan, id: id, executor: executor, ws: ws, req: req, userID: userID)
+                } else {
+                    // Not `.query(req)`: the upgrade request outlives any grant
+                    // its decision memo saw.
+                    let context = GraphQLContext.subscription(req, userID: userID)
+                    let result = await executor.execute(plan, context: context)
+                    send(SocketMessage(type: "next", id: id, payload: result), on: ws)
+                }
+                if !Task.isCancelled {
+                    send(SocketMessage(type: "complete", id: id, payload: nil), on: ws)
+                }
+            }
+        }
+        guard started else {
+            _ = ws.close(code: .init(codeNumber: 4409))  // subscriber for this id already exists
+            return
+        }
+    }
+
+    /// Runs a subscription plan once per committed event until the client
+    /// completes it or the socket closes. Events the arguments filter out, or
+    /// the caller may not read, come back null and are not sent.
+    private static func stream(
+        _ plan: GraphQLPlan, id: String, executor: GraphQLExecutor, ws: WebSocket, req: Request, userID: UUID
+    ) async {
+        let events = req.application.resourceEvents
+        let subscription = events.subscribe()
+        defer { events.unsubscribe(subscription.id) }
+        let context = GraphQLContext.subscription(req, userID: userID)
+        let rootKey = plan.fields.first?.responseKey ?? ""
+
+        await withTaskCancellationHandler {
+            for await event in subscription.events {
+                let result = await executor.execute(plan, root: event, context: context)
+                if case .object(let response) = result, response["errors"] == nil,
+                    case .object(let data)? = response["data"], case .null? = data[rootKey]
+                {
+                    continue
+                }
+                send(SocketMessage(type: "next", id: id, payload: result), on: ws)
+            }
+        } onCancel: {
+            events.unsubscribe(subscription.id)
+        }
+    }
+
+    private static func send(_ message: SocketMessage, on ws: WebSocket) {
+        guard let data = try? JSONEncoder().encode(message) else { return }
+        ws.send(String(decoding: data, as: UTF8.self))
+    }
+}
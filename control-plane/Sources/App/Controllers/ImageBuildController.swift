@@ -0,0 +1,362 @@
+import Crypto
+import Fluent
+import Foundation
+import StratoShared
+import Vapor
+
+/// A project's image builds (see `ImageBuildService`).
+///
+/// - `GET/POST  /api/projects/:projectID/image-builds`
+/// - `GET/DELETE .../image-builds/:buildID` — a finished build only; the
+///   image it produced is kept.
+/// - `POST .../:buildID/cancel` — ends the build and deletes its VM.
+/// - `PUT /api/image-builds/:buildID/disk` — the agent route the build VM's
+///   disk is uploaded through.
+///
+/// Reads need `project:read`. Starting a build needs `vm:create` and
+/// `image:create` on the project, since it makes both, and `image:read` on
+/// the base image; cancelling or deleting one needs `project:update`.
+///
+/// The disk route is an agent route with the same trust model as volume
+/// migration data (`VolumeMigrationController`): it authenticates the SPIFFE
+/// SVID forwarded by the Envoy mTLS sidecar, with no session fallback, and
+/// accepts bytes only from the agent holding the VM of a build that is
+/// capturing.
+struct ImageBuildController: RouteCollection {
+    static let maxNameLength = 100
+    static let maxTargetNameLength = 255
+
+    func boot(routes: RoutesBuilder) throws {
+        let builds = routes.grouped("api", "projects", ":projectID", "image-builds")
+        builds.get(use: list)
+        builds.post(use: create)
+        builds.group(":buildID") { build in
+            build.get(use: get)
+            build.delete(use: delete)
+            build.post("cancel", use: cancel)
+        }
+
+        routes.on(.PUT, "api", "image-builds", ":buildID", "disk", body: .stream, use: uploadDisk)
+    }
+
+    // MARK: - CRUD
+
+    /// Query params: limit/offset (optional) — select the page. Newest first.
+    func list(req: Request) async throws -> PagedResponse<ImageBuildResponse> {
+        let paging = try ListPaging.decode(from: req)
+        let projectID = try requireProjectID(req)
+        try await req.authorize("project:read", on: IAMNode(type: .project, id: projectID))
+
+        let builds = try await ImageBuild.query(on: req.db)
+            .filter(\.$project.$id == projectID)
+            .sort(\.$createdAt, .descending)
+            .sort(\.$id, .descending)
+            .all()
+        return paging.page(builds.map { ImageBuildResponse(from: $0) })
+    }
+
+    func create(req: Request) async throws -> Response {
+        let projectID = try requireProjectID(req)
+        guard let project = try await Project.find(projectID, on: req.db) else {
+            throw Abort(.notFound, reason: "Project not found")
+        }
+        try await req.authorize("vm:create", on: IAMNode(type: .project, id: projectID))
+        try await req.authorize("image:create", on: IAMNode(type: .project, id: projectID))
+        let user = try req.auth.require(User.self)
+
+        let request = try req.content.decode(CreateImageBuildRequest.self)
+        let name = try validateName(request.name, limit: Self.maxNameLength, field: "name")
+        let targetImageName = try validateName(
+            request.targetImageName, limit: Self.maxTargetNameLength, field: "targetImageName")
+        let environment = request.environment ?? project.defaultEnvironment
+        guard project.hasEnvironment(environment) else {
+            throw Abort(
+                .badRequest,
+                reason: "Environment '\(environment)' not available in project. Available: "
+                    + project.environments.joined(separator: ", "))
+        }
+        let userData = try VMController.validatedUserData(request.userData)
+        let provisioners = try validateProvisioners(request.provisioners ?? [])
+        guard userData != nil || !provisioners.isEmpty else {
+            throw Abort(.badRequest, reason: "An image build needs 'provisioners', 'userData', or both")
+        }
+
+        guard let baseImage = try await Image.find(request.baseImageId, on: req.db) else {
+            throw Abort(.badRequest, reason: "Base image not found")
+        }
+        try await req.authorize("image:read", on: IAMNode(type: .image, id: request.baseImageId))
+        guard baseImage.status == .ready else {
+            throw Abort(.badRequest, reason: "Base image is not ready. Status: \(baseImage.status.rawValue)")
+        }
+        try await baseImage.$artifacts.load(on: req.db)
+        if !baseImage.artifacts.isEmpty, !baseImage.isUsable(by: .qemu) {
+            throw Abort(.badRequest, reason: "Base image '\(baseImage.name)' has no QEMU disk image")
+        }
+
+        let cpu = request.cpu ?? baseImage.defaultCpu ?? 1
+        let memory = request.memory ?? baseImage.defaultMemory ?? Int64(1024 * 1024 * 1024)
+        let disk = request.disk ?? baseImage.defaultDisk ?? Int64(10 * 1024 * 1024 * 1024)
+        guard cpu > 0, memory > 0, disk > 0 else {
+            throw Abort(.badRequest, reason: "'cpu', 'memory' and 'disk' must be positive")
+        }
+
+        // Resolved now for an early 400; the sweep resolves it again when it
+        // creates the VM.
+        _ = try await VMController.resolveNIC(
+            CreateVMNICRequest(networkId: request.networkId), index: 0, projectId: projectID, planned: [],
+            on: req.db)
+
+        let build = ImageBuild(
+            projectID: projectID,
+            environment: environment,
+            name: name,
+            baseImageID: request.baseImageId,
+            targetImageName: targetImageName,
+            targetImageDescription: request.targetImageDescription ?? "",
+            userData: userData,
+            provisioners: provisioners,
+            networkId: request.networkId,
+            cpu: cpu,
+            memory: memory,
+            disk: disk,
+            createdByID: try user.requireID()
+        )
+        try await build.save(on: req.db)
+
+        req.logger.info(
+            "Image build accepted",
+            metadata: [
+                "imageBuildId": .string(build.id?.uuidString ?? ""),
+                "targetImageName": .string(targetImageName),
+            ])
+
+        let response = Response(status: .created)
+        try response.content.encode(ImageBuildResponse(from: build))
+        return response
+    }
+
+    /// Includes the build log.
+    func get(req: Request) async throws -> ImageBuildResponse {
+        let build = try await requireBuild(req)
+        try await req.authorize("project:read", on: IAMNode(type: .project, id: build.$project.id))
+        return ImageBuildResponse(from: build, includeLog: true)
+    }
+
+    /// Ends the build now and starts deleting its VM; a step still running
+    /// in the guest is abandoned. A finished build is returned as it is.
+    func cancel(req: Request) async throws -> ImageBuildResponse {
+        let build = try await requireBuild(req)
+        try await req.authorize("project:update", on: IAMNode(type: .project, id: build.$project.id))
+        guard !build.isFinished else {
+            return ImageBuildResponse(from: build)
+        }
+        build.cancelRequested = true
+        try await build.save(on: req.db)
+        await req.application.imageBuilds.advance(build, on: req.db)
+        return ImageBuildResponse(from: build)
+    }
+
+    func delete(req: Request) async throws -> HTTPStatus {
+        let build = try await requireBuild(req)
+        try await req.authorize("project:update", on: IAMNode(type: .project, id: build.$project.id))
+        guard build.isFinished else {
+            throw Abort(.conflict, reason: "Image build is still running; cancel it first")
+        }
+        guard build.vmId == nil else {
+            throw Abort(.conflict, reason: "Image build is still deleting its VM; try again shortly")
+        }
+        try await build.delete(on: req.db)
+        return .noContent
+    }
+
+    // MARK: - Disk upload (agent)
+
+    /// PUT /api/image-builds/:buildID/disk
+    ///
+    /// The flattened boot disk of a stopped build VM, streamed by its agent
+    /// (`VMDiskExportMessage`). Hashed into object storage as the build's
+    /// image, which becomes ready with its disk-image artifact and the
+    /// build creator's binding.
+    func uploadDisk(req: Request) async throws -> HTTPStatus {
+        guard AgentMTLSAuthenticator.hasClientCertificate(req) else {
+            throw Abort(.unauthorized, reason: "Image build capture requires agent mTLS authentication")
+        }
+        let agent = try await AgentMTLSAuthenticator.authenticateAgent(req: req)
+
+        guard let buildID = req.parameters.get("buildID", as: UUID.self) else {
+            throw Abort(.badRequest, reason: "Invalid image build ID")
+        }
+        guard let build = try await ImageBuild.find(buildID, on: req.db), let vmID = build.vmId,
+            let imageID = build.$image.id
+        else {
+            throw Abort(.notFound, reason: "Image build not found")
+        }
+        guard build.status == .capturing else {
+            throw Abort(.conflict, reason: "Image build is not capturing")
+        }
+        // Only the agent holding the build VM has its disk.
+        let agentRow = try await Agent.query(on: req.db)
+            .filter(\.$trustDomain == agent.identity.trustDomain)
+            .filter(\.$name == agent.identity.name)
+            .first()
+        guard let vm = try await VM.find(vmID, on: req.db), let holder = vm.hypervisorId,
+            agentRow?.id?.uuidString == holder
+        else {
+            throw Abort(.forbidden, reason: "Only the agent holding the build VM may upload its disk")
+        }
+        guard let image = try await Image.find(imageID, on: req.db), image.status == .uploading else {
+            throw Abort(.conflict, reason: "The build's image is not awaiting its disk")
+        }
+
+        let key = ImageObjectKey.image(projectId: image.$project.id, imageId: imageID, filename: image.filename)
+        // A flattened qcow2 is at most its virtual size plus metadata.
+        let maxBytes = max(build.disk * 2, Int64(1) << 30)
+
+        let store = req.application.imageObjectStore
+        let writer = try await store.openWriter(key: key)
+        var hasher = SHA256()
+        var size: Int64 = 0
+        do {
+            for try await chunk in req.body {
+                try Task.checkCancellation()
+                size += Int64(chunk.readableBytes)
+                guard size <= maxBytes else {
+                    throw Abort(
+                        .payloadTooLarge,
+                        reason: "Disk upload exceeds the maximum allowed size of \(maxBytes) bytes")
+                }
+                let readable = chunk
+                if let bytes = readable.getBytes(at: readable.readerIndex, length: readable.readableBytes) {
+                    hasher.update(data: bytes)
+                }
+                try await writer.write(chunk)
+            }
+            guard size > 0 else {
+                throw Abort(.badRequest, reason: "Disk upload carried no bytes")
+            }
+            try await writer.finish()
+        } catch {
+            await writer.abort()
+            throw error
+        }
+
+        // The build may have been cancelled, and its image deleted, while
+        // the disk streamed.
+        guard let current = try await ImageBuild.find(buildID, on: req.db), current.status == .capturing,
+            current.$image.id == imageID, let stored = try await Image.find(imageID, on: req.db)
+        else {
+            try? await store.delete(key: key)
+            throw Abort(.conflict, reason: "The image build ended while its disk was uploading")
+        }
+
+        let checksum = hasher.finalize().map { String(format: "%02x", $0) }.joined()
+        try await req.db.transaction { db in
+            stored.size = size
+            stored.checksum = checksum
+            stored.storagePath = key
+            stored.status = .ready
+            try await stored.save(on: db)
+            try await ImageArtifact(
+                imageID: imageID,
+                kind: .diskImage,
+                format: .qcow2,
+                architecture: stored.architecture,
+                filename: stored.filename,
+                size: size,
+                checksum: checksum,
+                storagePath: key
+            ).save(on: db)
+            try await RoleBindingService.grant(
+                principalType: .user,
+                principalID: current.$createdBy.id,
+                role: .admin,
+                nodeType: .image,
+                nodeID: imageID,
+                createdBy: current.$createdBy.id,
+                on: db
+            )
+        }
+
+        req.logger.info(
+            "Image build disk stored",
+            metadata: [
+                "agent": .string(agent.identity.key),
+                "imageBuildId": .string(buildID.uuidString),
+                "imageId": .string(imageID.uuidString),
+                "size": .stringConvertible(size),
+            ])
+        return .ok
+    }
+
+    // MARK: - Validation
+
+    private func validateName(_ raw: String, limit: Int, field: String) throws -> String {
+        let name = raw.trimmingCharacters(in: .whitespacesAndNewlines)
+        guard !name.isEmpty, name.count <= limit else {
+            throw Abort(.badRequest, reason: "'\(field)' must be 1-\(limit) characters")
+        }
+        return name
+    }
+
+    func validateProvisioners(_ provisioners: [ImageBuildProvisioner]) throws -> [ImageBuildProvisioner] {
+        guard provisioners.count <= ImageBuild.maxProvisioners else {
+            throw Abort(.badRequest, reason: "At most \(ImageBuild.maxProvisioners) provisioners are allowed")
+        }
+        for (index, provisioner) in provisioners.enumerated() {
+            let position = "Provisioner \(index + 1)"
+            switch provisioner.kind {
+            case .shell:
+                guard let script = provisioner.script,
+                    !script.trimmingCharacters(in: .whitespacesAndNewlines).isEmpty,
+                    provisioner.command == nil
+                else {
+                    throw Abort(.badRequest, reason: "\(position): a 'shell' provisioner takes a 'script' only")
+                }
+            case .exec:
+                guard let command = provisioner.command, let program = command.first, !program.isEmpty,
+                    provisioner.script == nil
+                else {
+                    throw Abort(.badRequest, reason: "\(position): an 'exec' provisioner takes a 'command' only")
+                }
+            }
+            let bytes = provisioner.guestCommand.reduce(0) { $0 + $1.utf8.count }
+            guard bytes <= ImageBuild.maxProvisionerBytes else {
+                throw Abort(
+                    .badRequest, reason: "\(position) exceeds \(ImageBuild.maxProvisionerBytes / 1024) KiB")
+            }
+            if let timeout = provisioner.timeoutSeconds, !ImageBuild.provisionerTimeoutRange.contains(timeout) {
+                throw Abort(
+                    .badRequest,
+                    reason: "\(position): 'timeoutSeconds' must be between "
+                        + "\(ImageBuild.provisionerTimeoutRange.lowerBound) and "
+                        + "\(ImageBuild.provisionerTimeoutRange.upperBound)")
+            }
+        }
+        return provisioners
+    }
+
+    // MARK: - Helpers
+
+    private func requireProjectID(_ req: Request) throws -> UUID {
+        guard let projectID = req.parameters.get("projectID", as: UUID.self) else {
+            throw Abort(.badRequest, reason: "Invalid project ID")
+        }
+        return projectID
+    }
+
+    private func requireBuild(_ req: Request) async throws -> ImageBuild {
+        let projectID = try requireProjectID(req)
+        guard let buildID = req.parameters.get("buildID", as: UUID.self) else {
+            throw Abort(.badRequest, reason: "Invalid image build ID")
+        }
+        guard
+            let build = try await ImageBuild.query(on: req.db)
+                .filter(\.$id == buildID)
+                .filter(\.$project.$id == projectID)
+                .first()
+        else {
+            throw Abort(.notFound, reason: "Image build not found")
+        }
+        return build
+    }
+}
@@ -0,0 +1,92 @@
+import Fluent
+import Foundation
+import Vapor
+
+/// A project's maintenance windows, deny periods and notice lead, under
+/// `/api/projects/:projectID/maintenance-policy`. Members read; project
+/// admins set (`PUT`, whole policy) and clear (`DELETE`) it.
+///
+/// The answer also carries what the gate would say now — open or not, the
+/// next opening — and the announced work that hasn't started yet, so a
+/// project can see what is coming without subscribing to webhooks.
+struct MaintenancePolicyController: RouteCollection {
+    func boot(routes: any RoutesBuilder) throws {
+        let policy = routes.grouped("api", "projects", ":projectID", "maintenance-policy")
+        policy.get(use: show)
+        policy.put(use: update)
+        policy.delete(use: delete)
+    }
+
+    /// GET /api/projects/:projectID/maintenance-policy
+    func show(req: Request) async throws -> ProjectMaintenancePolicyResponse {
+        let project = try await requireProject(req)
+        try await OrganizationAccessService.requireProjectMember(project: project, on: req)
+        return try await Self.response(for: project, on: req.db)
+    }
+
+    /// PUT /api/projects/:projectID/maintenance-policy — replaces the
+    /// policy. Work already announced keeps the time it was scheduled for,
+    /// but still waits for the new policy to be open.
+    func update(req: Request) async throws -> ProjectMaintenancePolicyResponse {
+        let project = try await requireProject(req)
+        try await OrganizationAccessService.requireProjectAdmin(project: project, on: req)
+
+        let policy = try req.content.decode(MaintenancePolicy.self)
+        if let error = policy.validationError {
+            throw Abort(.badRequest, reason: error)
+        }
+        project.maintenancePolicy = policy
+        try await project.save(on: req.db)
+
+        req.logger.info(
+            "Updated project maintenance policy",
+            metadata: [
+                "project_id": .string(project.id?.uuidString ?? ""),
+                "windows": .stringConvertible(policy.windows.count),
+                "deny_periods": .stringConvertible(policy.denyPeriods.count),
+            ])
+        return try await Self.response(for: project, on: req.db)
+    }
+
+    /// DELETE /api/projects/:projectID/maintenance-policy — the project
+    /// takes work at any time again.
+    func delete(req: Request) async throws -> HTTPStatus {
+        let project = try await requireProject(req)
+        try await OrganizationAccessService.requireProjectAdmin(project: project, on: req)
+
+        project.maintenancePolicy = nil
+        try await project.save(on: req.db)
+        return .noContent
+    }
+
+    static func response(
+        for project: Project, now: Date = Date(), on db: Database
+    ) async throws -> ProjectMaintenancePolicyResponse {
+        let projectID = try project.requireID()
+        let pending = try await MaintenanceNotice.query(on: db)
+            .filter(\.$project.$id == projectID)
+            .filter(\.$startedAt == nil)
+            .sort(\.$scheduledFor)
+            .all()
+        // Without a policy the gate is always open.
+        let policy = project.maintenancePolicy
+        var nextOpening: Date? = now
+        if let policy { nextOpening = policy.nextOpening(atOrAfter: now) }
+        return ProjectMaintenancePolicyResponse(
+            projectId: projectID,
+            policy: policy,
+            openNow: policy?.isOpen(at: now) ?? true,
+            nextOpening: nextOpening,
+            scheduled: pending.map(MaintenanceNoticeResponse.init(from:)))
+    }
+
+    private func requireProject(_ req: Request) async throws -> Project {
+        guard let projectID = req.parameters.get("projectID", as: UUID.self) else {
+            throw Abort(.badRequest, reason: "Invalid project ID")
+        }
+        guard let project = try await Project.find(projectID, on: req.db) else {
+            throw Abort(.notFound, reason: "Project not found")
+        }
+        return project
+    }
+}
@@ -0,0 +1,351 @@
+import Fluent
+import StratoShared
+import Vapor
+
+/// Who holds which address on a logical network: reservations
+/// (`/api/networks/:networkId/reservations`) that keep an address for a
+/// project before a VM exists, and the allocation listing
+/// (`/api/networks/:networkId/allocations`) covering every address in use.
+///
+/// A project network's reservations belong to its project and follow the
+/// network's own permissions (`read` to list, `update` to reserve or
+/// release). On a global network each reservation names its project, and
+/// reserving takes `create_resources` there — the same bar as putting a VM
+/// on the network.
+struct NetworkAllocationController: RouteCollection {
+    func boot(routes: RoutesBuilder) throws {
+        let network = routes.grouped("api", "networks", ":networkId").grouped(User.guardMiddleware())
+        network.get("allocations", use: listAllocations)
+        network.get("reservations", use: listReservations)
+        network.post("reservations", use: createReservation)
+        network.delete("reservations", ":reservationId", use: deleteReservation)
+    }
+
+    // MARK: - Reservations
+
+    /// GET /api/networks/:networkId/reservations
+    @Sendable
+    func listReservations(req: Request) async throws -> [IPReservationResponse] {
+        let network = try await fetchNetwork(req: req)
+        var reservations = try await IPReservation.query(on: req.db)
+            .filter(\.$network.$id == network.requireID())
+            .sort(\.$createdAt)
+            .all()
+        if network.$project.id == nil {
+            let readable = try await readableProjects(among: reservations.map(\.$project.id), req: req)
+            reservations = reservations.filter { readable.contains($0.$project.id) }
+        }
+        let holders = try await holdingInterfaces(on: network, db: req.db)
+        return reservations.map { IPReservationResponse(from: $0, interfaceId: holders[$0.address]) }
+    }
+
+    /// POST /api/networks/:networkId/reservations — holds the named address,
+    /// or the next free one of the requested family.
+    @Sendable
+    func createReservation(req: Request) async throws -> IPReservationResponse {
+        let user = try req.auth.require(User.self)
+        let network = try await fetchNetwork(req: req)
+        let request = try req.content.decode(CreateIPReservationRequest.self)
+
+        let projectID: UUID
+        if let networkProjectID = network.$project.id {
+            if let requested = request.projectId, requested != networkProjectID {
+                throw Abort(.badRequest, reason: "A project network's reservations belong to its project")
+            }
+            try await requireNetworkPermission("update", on: network, req: req)
+            projectID = networkProjectID
+        } else {
+            guard let requested = request.projectId else {
+                throw Abort(.badRequest, reason: "'projectId' is required to reserve on a global network")
+            }
+            guard try await req.can("create_resources", on: "project", id: requested.uuidString) else {
+                throw Abort(.forbidden, reason: "You don't have permission to reserve addresses for this project")
+            }
+            projectID = requested
+        }
+
+        let description = request.description?.trimmingCharacters(in: .whitespacesAndNewlines) ?? ""
+        guard description.count <= 255 else {
+            throw Abort(.badRequest, reason: "'description' must be at most 255 characters")
+        }
+        let requestedAddress = request.address?.trimmingCharacters(in: .whitespacesAndNewlines)
+        if let requestedAddress, let family = request.family,
+            family != (IPv4Address(requestedAddress) != nil ? .ipv4 : .ipv6)
+        {
+            throw Abort(.badRequest, reason: "'family' doesn't match '\(requestedAddress)'")
+        }
+
+        let networkID = try network.requireID()
+        let reservation: IPReservation
+        do {
+            reservation = try await req.db.transaction { db in
+                let held = try await IPReservation.query(on: db)
+                    .filter(\.$network.$id == networkID)
+                    .filter(\.$project.$id == projectID)
+                    .count()
+                guard held < IPReservation.maxPerProjectPerNetwork else {
+                    throw Abort(
+                        .conflict,
+                        reason: "A project may hold at most \(IPReservation.maxPerProjectPerNetwork) "
+                            + "reservations per network")
+                }
+
+                let family: IPFamily
+                let address: String
+                if let requestedAddress {
+                    let claimed = try await IPAMService.claimIP(
+                        requestedAddress, on: network, projectID: projectID, db: db)
+                    // Claiming lets a project's own reservation through; a
+                    // second reservation of the same address is still a clash.
+                    let taken = try await IPReservation.query(on: db)
+                        .filter(\.$network.$id == networkID)
+                        .filter(\.$address == claimed.ipAddress)
+                        .count()
+                    guard taken == 0 else {
+                        throw Abort(.conflict, reason: "\(claimed.ipAddress) is already reserved")
+                    }
+                    switch claimed {
+                    case .ipv4: family = .ipv4
+                    case .ipv6: family = .ipv6
+                    }
+                    address = claimed.ipAddress
+                } else if request.family == .ipv6 || (request.family == nil && network.isIPv6Only) {
+                    guard let allocation = try await IPAMService.allocateIPv6(for: network, on: db) else {
+                        throw Abort(.badRequest, reason: "Network '\(network.name)' has no IPv6 subnet")
+                    }
+                    family = .ipv6
+                    address = allocation.ipAddress
+                } else {
+                    guard let allocation = try await IPAMService.allocateIP(for: network, on: db) else {
+                        throw Abort(.badRequest, reason: "Network '\(network.name)' is IPv6-only")
+                    }
+                    family = .ipv4
+                    address = allocation.ipAddress
+                }
+
+                let reservation = IPReservation(
+                    networkID: networkID, projectID: projectID, family: family, address: address,
+                    description: description, createdByID: user.id)
+                try await reservation.save(on: db)
+                return reservation
+            }
+        } catch let error as IPAMService.IPAMError {
+            if case .invalidAddress = error {
+                throw Abort(.badRequest, reason: error.errorDescription ?? "Invalid address")
+            }
+            throw Abort(.conflict, reason: error.errorDescription ?? "Address unavailable")
+        } catch let error as any DatabaseError where error.isConstraintFailure {
+            throw Abort(.conflict, reason: "The address was reserved concurrently; try again")
+        }
+
+        req.logger.info(
+            "IP reservation created",
+            metadata: [
+                "network_id": .string(networkID.uuidString),
+                "project_id": .string(projectID.uuidString),
+                "address": .string(reservation.address),
+            ])
+        let holders = try await holdingInterfaces(on: network, db: req.db)
+        return IPReservationResponse(from: reservation, interfaceId: holders[reservation.address])
+    }
+
+    /// DELETE /api/networks/:networkId/reservations/:reservationId — releases
+    /// the hold. A VM already using the address keeps it; the address just
+    /// returns to the free pool once that VM lets go.
+    @Sendable
+    func deleteReservation(req: Request) async throws -> HTTPStatus {
+        let network = try await fetchNetwork(req: req)
+        guard let reservationID = req.parameters.get("reservationId", as: UUID.self) else {
+            throw Abort(.badRequest, reason: "Invalid reservation ID")
+        }
+        guard let reservation = try await IPReservation.find(reservationID, on: req.db),
+            reservation.$network.id == network.id
+        else {
+            throw Abort(.notFound, reason: "Reservation not found")
+        }
+
+        if network.$project.id != nil {
+            try await requireNetworkPermission("update", on: network, req: req)
+        } else {
+            let projectID = reservation.$project.id.uuidString
+            guard try await req.can("create_resources", on: "project", id: projectID) else {
+                // Other projects' reservations on a shared network read as
+                // absent, as they do in the list.
+                throw Abort(.notFound, reason: "Reservation not found")
+            }
+        }
+
+        try await reservation.delete(on: req.db)
+        req.logger.info(
+            "IP reservation released",
+            metadata: [
+                "network_id": .string(network.id?.uuidString ?? ""),
+                "address": .string(reservation.address),
+            ])
+        return .noContent
+    }
+
+    // MARK: - Allocations
+
+    /// GET /api/networks/:networkId/allocations — every address in use on
+    /// the network and what holds it.
+    @Sendable
+    func listAllocations(req: Request) async throws -> NetworkAllocationsResponse {
+        let network = try await fetchNetwork(req: req)
+        let networkID = try network.requireID()
+        var entries: [NetworkAllocationResponse] = []
+
+        // The router port answers on the gateway of each family.
+        for (family, gateway) in [(IPFamily.ipv4, network.gateway), (.ipv6, network.gateway6)] {
+            guard let gateway else { continue }
+            entries.append(
+                NetworkAllocationResponse(
+                    address: gateway, family: family.rawValue, kind: .router, projectId: network.$project.id,
+                    resourceId: nil, resourceName: nil, interfaceId: nil, reservationId: nil, natTarget: nil))
+        }
+
+        let reservations = try await IPReservation.query(on: req.db)
+            .filter(\.$network.$id == networkID)
+            .all()
+        let reservationsByAddress = Dictionary(
+            reservations.map { ($0.address, $0) }, uniquingKeysWith: { first, _ in first })
+        var taken: Set<String> = []
+
+        let vmAddresses = try await VMInterfaceAddress.query(on: req.db)
+            .filter(\.$network == network.name)
+            .with(\.$interface) { $0.with(\.$vm) }
+            .all()
+        for row in vmAddresses {
+            let vm = row.interface.vm
+            taken.insert(row.address)
+            entries.append(
+                NetworkAllocationResponse(
+                    address: row.address, family: row.family, kind: .vm, projectId: vm.$project.id,
+                    resourceId: vm.id, resourceName: vm.name, interfaceId: row.$interface.id,
+                    reservationId: reservationsByAddress[row.address]?.id, natTarget: nil))
+        }
+
+        let sandboxAddresses = try await SandboxInterfaceAddress.query(on: req.db)
+            .filter(\.$network == network.name)
+            .with(\.$interface) { $0.with(\.$sandbox) }
+            .all()
+        for row in sandboxAddresses {
+            let sandbox = row.interface.sandbox
+            taken.insert(row.address)
+            entries.append(
+                NetworkAllocationResponse(
+                    address: row.address, family: row.family, kind: .sandbox, projectId: sandbox.$project.id,
+                    resourceId: sandbox.id, resourceName: sandbox.name, interfaceId: row.$interface.id,
+                    reservationId: reservationsByAddress[row.address]?.id, natTarget: nil))
+        }
+
+        let fileShares = try await FileShare.query(on: req.db)
+            .filter(\.$network.$id == networkID)
+            .all()
+        for share in fileShares {
+            taken.insert(share.ipAddress)
+            entries.append(
+                NetworkAllocationResponse(
+                    address: share.ipAddress, family: IPFamily.ipv4.rawValue, kind: .fileShare,
+                    projectId: share.$project.id, resourceId: share.id, resourceName: share.name,
+                    interfaceId: nil, reservationId: nil, natTarget: nil))
+        }
+
+        for reservation in reservations where !taken.contains(reservation.address) {
+            entries.append(
+                NetworkAllocationResponse(
+                    address: reservation.address, family: reservation.family, kind: .reservation,
+                    projectId: reservation.$project.id, resourceId: reservation.id,
+                    resourceName: reservation.description.isEmpty ? nil : reservation.description,
+                    interfaceId: nil, reservationId: reservation.id, natTarget: nil))
+        }
+
+        entries.sort { lhs, rhs in
+            if lhs.family != rhs.family { return lhs.family == IPFamily.ipv4.rawValue }
+            return Self.addressOrder(lhs.address) < Self.addressOrder(rhs.address)
+        }
+
+        // Floating IPs are external addresses, listed after the network's
+        // own with the fixed address each forwards to.
+        let fixedByInterface = Dictionary(
+            vmAddresses.filter { $0.family == IPFamily.ipv4.rawValue }.map { ($0.$interface.id, $0) },
+            uniquingKeysWith: { first, _ in first })
+        let floatingIPs = try await FloatingIP.query(on: req.db)
+            .join(parent: \.$interface)
+            .filter(VMNetworkInterface.self, \.$network == network.name)
+            .sort(\.$address)
+            .all()
+        for floating in floatingIPs {
+            guard let interfaceID = floating.$interface.id else { continue }
+            entries.append(
+                NetworkAllocationResponse(
+                    address: floating.address, family: IPFamily.ipv4.rawValue, kind: .floatingIP,
+                    projectId: floating.$project.id, resourceId: floating.id,
+                    resourceName: fixedByInterface[interfaceID]?.interface.vm.name, interfaceId: interfaceID,
+                    reservationId: nil, natTarget: fixedByInterface[interfaceID]?.address))
+        }
+
+        // A shared network lists every address so callers see what is
+        // taken, but only names the holders in projects they can read.
+        if network.$project.id == nil {
+            let readable = try await readableProjects(among: entries.compactMap(\.projectId), req: req)
+            entries = entries.map { entry in
+                guard let projectID = entry.projectId, !readable.contains(projectID) else { return entry }
+                return NetworkAllocationResponse(
+                    address: entry.address, family: entry.family, kind: entry.kind, projectId: nil,
+                    resourceId: nil, resourceName: nil, interfaceId: nil, reservationId: nil,
+                    natTarget: entry.natTarget)
+            }
+        }
+
+        return NetworkAllocationsResponse(
+            networkId: networkID, subnet: network.subnet, subnet6: network.subnet6, allocations: entries)
+    }
+
+    // MARK: - Helpers
+
+    /// Sorts addresses numerically within a family.
+    private static func addressOrder(_ address: String) -> (UInt64, UInt64) {
+        if let v4 = IPv4Address(address) { return (0, UInt64(v4.raw)) }
+        if let v6 = IPv6Address(address) { return (v6.hi, v6.lo) }
+        return (.max, .max)
+    }
+
+    /// Reserved addresses currently held by a VM NIC, address to interface.
+    private func holdingInterfaces(on network: LogicalNetwork, db: Database) async throws -> [String: UUID] {
+        let rows = try await VMInterfaceAddress.query(on: db)
+            .filter(\.$network == network.name)
+            .all()
+        return Dictionary(rows.map { ($0.address, $0.$interface.id) }, uniquingKeysWith: { first, _ in first })
+    }
+
+    private func readableProjects(among projectIDs: [UUID], req: Request) async throws -> Set<UUID> {
+        var readable: Set<UUID> = []
+        for projectID in Set(projectIDs) {
+            if try await req.can("view_project", on: "project", id: projectID.uuidString) {
+                readable.insert(projectID)
+            }
+        }
+        return readable
+    }
+
+    /// The path's network, checked for `read`. Reservation writes add their
+    /// own check once they know the network's scope.
+    private func fetchNetwork(req: Request) async throws -> LogicalNetwork {
+        guard let networkID = req.parameters.get("networkId", as: UUID.self) else {
+            throw Abort(.badRequest, reason: "Invalid network ID")
+        }
+        guard let network = try await LogicalNetwork.find(networkID, on: req.db) else {
+            throw Abort(.notFound, reason: "Network not found")
+        }
+        try await requireNetworkPermission("read", on: network, req: req)
+        return network
+    }
+
+    private func requireNetworkPermission(_ permission: String, on network: LogicalNetwork, req: Request) async throws {
+        let allowed = try await req.can(permission, on: "network", id: try network.requireID().uuidString)
+        guard allowed else {
+            throw Abort(.forbidden, reason: "You don't have '\(permission)' permission on this network")
+        }
+    }
+}
@@ -115,44 +115,47 @@ struct NetworkController: RouteCollection {
     @Sendable
     func createNetwork(req: Request) async throws -> NetworkResponse {
         let user = try req.auth.require(User.self)
-        let request = try req.content.decode(CreateNetworkRequest.self)
-
-        // Determine project (same resolution as volumes)
-        let projectId: UUID
-        if let requestProjectId = request.projectId {
-            projectId = requestProjectId
-        } else if let currentOrgId = user.currentOrganizationId {
-            guard
-                let defaultProject = try await Project.query(on: req.db)
-                    .filter(\.$organization.$id == currentOrgId)
-                    .first()
-            else {
-                throw Abort(.badRequest, reason: "No project specified and no default project found")
-            }
-            projectId = defaultProject.id!
-        } else {
-            throw Abort(.badRequest, reason: "No project specified and user has no current organization")
-        }
-
-        let hasPermission = try await req.can("create_network", on: "project", id: projectId.uuidString)
-
-        guard hasPermission else {
-            throw Abort(.forbidden, reason: "You don't have permission to create networks in this project")
-        }
+        let decoded = try req.content.decode(CreateNetworkRequest.self)
+
+        // Admission webhooks see (and may patch) the body once the caller may
+        // create networks in the project it names. A webhook that moves the
+        // network to another project has that one checked too.
+        let target = try await Self.createProjectID(requested: decoded.projectId, user: user, req: req)
+        let request = try await req.admitCreate(
+            decoded, resourceKind: .network, resourceName: decoded.name, projectID: target, user: user)
+        let projectId =
+            request.projectId == decoded.projectId
+            ? target : try await Self.createProjectID(requested: request.projectId, user: user, req: req)
 
         let name = request.name.trimmingCharacters(in: .whitespacesAndNewlines)
         guard !name.isEmpty else {
             throw Abort(.badRequest, reason: "Network name must not be empty")
         }
 
-        let (subnet, gateway) = try Self.validateAddressing(subnet: request.subnet, gateway: request.gateway)
+        // No `subnet` asks for an IPv6-only network: nothing IPv4 at all.
+        // Its egress is IPv6 alone — nothing on the router translates to
+        // IPv4, so IPv4-only destinations stay out of reach.
+        var subnet: String?
+        var gateway: String?
+        if let requestedSubnet = request.subnet {
+            let addressing = try Self.validateAddressing(subnet: requestedSubnet, gateway: request.gateway)
+            subnet = addressing.subnet
+            gateway = addressing.gateway
+        } else {
+            guard request.gateway == nil else {
+                throw Abort(.badRequest, reason: "gateway requires subnet; omit both for an IPv6-only network")
+            }
+            guard request.ipv6Enabled != false else {
+                throw Abort(.badRequest, reason: "A network needs an IPv4 subnet, IPv6, or both")
+            }
+        }
         // Dual-stack by default: absent an explicit /64 (or an explicit
         // opt-out), every new network gets a generated unique-local /64.
         let addressing6 = try Self.resolveIPv6Addressing(
             subnet6: request.subnet6, gateway6: request.gateway6, ipv6Enabled: request.ipv6Enabled)
         try await Self.assertNoSubnetOverlap(
             subnet: subnet, subnet6: addressing6?.subnet6, projectId: projectId, excluding: nil, on: req.db)
-        let dnsServers = try Self.validatedDNS(request.dnsServers ?? [])
+        let dnsServers = try Self.validatedDNS(request.dnsServers ?? [], ipv6Only: subnet == nil)
         try Self.validateLeaseTime(request.leaseTime)
 
         // Pinning to a site constrains all the network's VMs to that site's
@@ -218,7 +221,8 @@ struct NetworkController: RouteCollection {
             metadata: [
                 "networkId": .string(network.id!.uuidString),
                 "name": .string(network.name),
-                "subnet": .string(network.subnet),
+                "subnet": .string(network.subnet ?? ""),
+                "subnet6": .string(network.subnet6 ?? ""),
                 "projectId": .string(projectId.uuidString),
             ])
 
@@ -305,9 +309,13 @@ struct NetworkController: RouteCollection {
         }
 
         // Re-validate the resulting subnet/gateway combination as a whole.
-        let (subnet, gateway) = try Self.validateAddressing(subnet: network.subnet, gateway: network.gateway)
-        network.subnet = subnet
-        network.gateway = gateway
+        if let currentSubnet = network.subnet {
+            let (subnet, gateway) = try Self.validateAddressing(subnet: currentSubnet, gateway: network.gateway)
+            network.subnet = subnet
+            network.gateway = gateway
+        } else if network.gateway != nil {
+            throw Abort(.badRequest, reason: "gateway requires an IPv4 subnet")
+        }
 
         // IPv6: enable (explicit /64 or generated ULA), change, or remove.
         // The in-use guard counts allocated v6 addresses, not interfaces — a
@@ -322,6 +330,9 @@ struct NetworkController: RouteCollection {
             guard request.subnet6 == nil, request.gateway6 == nil else {
                 throw Abort(.badRequest, reason: "subnet6/gateway6 cannot be combined with ipv6Enabled=false")
             }
+            guard network.subnet != nil else {
+                throw Abort(.badRequest, reason: "An IPv6-only network can't disable IPv6")
+            }
             if network.subnet6 != nil {
                 guard v6AddressCount == 0 else {
                     throw Abort(
@@ -418,7 +429,7 @@ struct NetworkController: RouteCollection {
             network.dhcpEnabled = dhcpEnabled
         }
         if let dnsServers = request.dnsServers {
-            network.dnsServers = try Self.validatedDNS(dnsServers)
+            network.dnsServers = try Self.validatedDNS(dnsServers, ipv6Only: network.isIPv6Only)
         }
         if let domainName = request.domainName {
             network.domainName = domainName.trimmingCharacters(in: .whitespacesAndNewlines).nilIfEmpty
@@ -454,7 +465,7 @@ struct NetworkController: RouteCollection {
     // MARK: - Delete Network
 
     /// Delete a network. The default network is never deletable; networks with
-    /// attached VM interfaces are rejected with 409.
+    /// attached VM interfaces or file shares are rejected with 409.
     /// DELETE /api/networks/:networkId
     @Sendable
     func deleteNetwork(req: Request) async throws -> HTTPStatus {
@@ -472,6 +483,17 @@ struct NetworkController: RouteCollection {
                 reason: "Network is in use by \(interfaceCount) interface(s); detach them first"
             )
         }
+        // File shares are exported on the network by id; the FK would refuse
+        // the delete anyway, this just says why.
+        let fileShareCount = try await FileShare.query(on: req.db)
+            .filter(\.$network.$id == network.requireID())
+            .count()
+        guard fileShareCount == 0 else {
+            throw Abort(
+                .conflict,
+                reason: "Network is in use by \(fileShareCount) file share(s); delete them first"
+            )
+        }
 
         try await req.db.transaction { db in
             try await network.delete(on: db)
@@ -493,6 +515,33 @@ struct NetworkController: RouteCollection {
 
     // MARK: - Helper Methods
 
+    /// The project a network create targets (same resolution as volumes),
+    /// once the caller may create networks in it.
+    static func createProjectID(requested: UUID?, user: User, req: Request) async throws -> UUID {
+        let projectId: UUID
+        if let requested {
+            projectId = requested
+        } else if let currentOrgId = user.currentOrganizationId {
+            guard
+                let defaultProject = try await Project.query(on: req.db)
+                    .filter(\.$organization.$id == currentOrgId)
+                    .first()
+            else {
+                throw Abort(.badRequest, reason: "No project specified and no default project found")
+            }
+            projectId = defaultProject.id!
+        } else {
+            throw Abort(.badRequest, reason: "No project specified and user has no current organization")
+        }
+
+        let hasPermission = try await req.can("create_network", on: "project", id: projectId.uuidString)
+
+        guard hasPermission else {
+            throw Abort(.forbidden, reason: "You don't have permission to create networks in this project")
+        }
+        return projectId
+    }
+
     /// How many floating IPs are attached to NICs on the named network.
     ///
     /// Joined rather than intersected in Swift: the set this counts is a
@@ -530,7 +579,7 @@ struct NetworkController: RouteCollection {
     /// (project-less) networks each get their own router, so they're exempt.
     /// Each family is checked against its own sibling column.
     static func assertNoSubnetOverlap(
-        subnet: String, subnet6: String? = nil, projectId: UUID?, excluding networkId: UUID?,
+        subnet: String?, subnet6: String? = nil, projectId: UUID?, excluding networkId: UUID?,
         on db: any Database
     ) async throws {
         guard let projectId else { return }
@@ -539,11 +588,15 @@ struct NetworkController: RouteCollection {
             query = query.filter(\.$id != networkId)
         }
         let siblings = try await query.all()
-        if let clash = siblings.first(where: { subnetsOverlap($0.subnet, subnet) }) {
+        if let subnet,
+            let clash = siblings.first(where: { sibling in
+                sibling.subnet.map { subnetsOverlap($0, subnet) } ?? false
+            })
+        {
             throw Abort(
                 .conflict,
                 reason:
-                    "Subnet \(subnet) overlaps network '\(clash.name)' (\(clash.subnet)) in the same project; networks sharing a project share one router and must use disjoint subnets"
+                    "Subnet \(subnet) overlaps network '\(clash.name)' (\(clash.subnet ?? "")) in the same project; networks sharing a project share one router and must use disjoint subnets"
             )
         }
         if let subnet6,
@@ -667,12 +720,18 @@ struct NetworkController: RouteCollection {
     /// Validates a list of DNS resolver addresses, dropping blanks. Either
     /// family is accepted (the list stays mixed on the wire; the agent splits
     /// it when programming DHCPv4 vs DHCPv6). IPv6 entries are canonicalized.
-    static func validatedDNS(_ servers: [String]) throws -> [String] {
+    /// An IPv6-only network's guests have no IPv4 route to reach a resolver
+    /// on, so there IPv4 servers are refused.
+    static func validatedDNS(_ servers: [String], ipv6Only: Bool = false) throws -> [String] {
         var cleaned: [String] = []
         for server in servers {
             let trimmed = server.trimmingCharacters(in: .whitespaces)
             if trimmed.isEmpty { continue }
             if IPAMService.parseIPv4(trimmed) != nil {
+                guard !ipv6Only else {
+                    throw Abort(
+                        .badRequest, reason: "DNS server '\(trimmed)' is IPv4; this network is IPv6-only")
+                }
                 cleaned.append(trimmed)
             } else if let canonical = IPv6Address.canonicalize(trimmed) {
                 cleaned.append(canonical)
@@ -3,6 +3,7 @@ import SQLKit
 import Vapor
 import JWT
 import Crypto
+import WebAuthn
 import Foundation
 
 struct OIDCController: RouteCollection {
@@ -30,8 +31,17 @@ struct OIDCController: RouteCollection {
         publicRoutes.get("oidc-providers", use: listPublicProviders)
 
         // Public SSO discovery for the login page: resolve an organization
-        // name to its enabled providers without knowing the org UUID.
+        // name (or an email at a verified domain) to its enabled providers
+        // without knowing the org UUID.
         routes.grouped("api", "public", "sso").get("lookup", use: lookupSSOProviders)
+
+        // Consent to a verified domain taking an existing account over, for a
+        // sign-in parked by `DomainAccountClaimRequired`
+        let domainClaim = routes.grouped("auth", "domain-claim")
+        domainClaim.get(use: getDomainClaim)
+        domainClaim.post("confirm", use: beginDomainClaimConfirmation)
+        domainClaim.post("accept", use: acceptDomainClaim)
+        domainClaim.post("decline", use: declineDomainClaim)
     }
 
     // MARK: - Provider Management
@@ -363,12 +373,29 @@ struct OIDCController: RouteCollection {
     }
 
     func lookupSSOProviders(req: Request) async throws -> SSOLookupResponse {
+        // An email routes to the organization that verified its domain.
+        // Verified domains are public knowledge (the TXT record is in DNS),
+        // so this reveals no more than the name lookup does.
+        if let email = req.query[String.self, at: "email"]?.trimmingCharacters(in: .whitespacesAndNewlines),
+            !email.isEmpty
+        {
+            guard let domain = OrganizationDomain.domain(ofEmail: email),
+                let verified = try await OrganizationDomain.query(on: req.db)
+                    .filter(\.$domain == domain)
+                    .filter(\.$status == OrganizationDomainStatus.verified.rawValue)
+                    .first()
+            else {
+                return SSOLookupResponse(organizationID: nil, providers: [])
+            }
+            return try await ssoLookupResponse(organizationID: verified.$organization.id, on: req.db)
+        }
+
         guard
             let rawName = req.query[String.self, at: "organization"]?
                 .trimmingCharacters(in: .whitespacesAndNewlines),
             !rawName.isEmpty
         else {
-            throw Abort(.badRequest, reason: "Missing 'organization' query parameter")
+            throw Abort(.badRequest, reason: "Missing 'organization' or 'email' query parameter")
         }
 
         // Case-insensitive name match. Exact match first; the fallback scan
@@ -399,8 +426,11 @@ struct OIDCController: RouteCollection {
         guard let organization, let organizationID = organization.id else {
             return SSOLookupResponse(organizationID: nil, providers: [])
         }
+        return try await ssoLookupResponse(organizationID: organizationID, on: req.db)
+    }
 
-        let providers = try await OIDCProvider.query(on: req.db)
+    private func ssoLookupResponse(organizationID: UUID, on db: Database) async throws -> SSOLookupResponse {
+        let providers = try await OIDCProvider.query(on: db)
             .filter(\.$organization.$id == organizationID)
             .filter(\.$enabled == true)
             .all()
@@ -544,19 +574,32 @@ struct OIDCController: RouteCollection {
             // token's claims (issue #363).
             let identity = OIDCIdentityService(db: req.db, logger: req.logger)
 
-            let user = try await identity.resolveUser(
-                userInfo: userInfo,
-                provider: provider,
-                organization: provider.organization,
-                groupValues: userInfo.groupValues
-            )
+            let user: User
+            do {
+                user = try await identity.resolveUser(
+                    userInfo: userInfo,
+                    provider: provider,
+                    organization: provider.organization,
+                    groupValues: userInfo.groupValues
+                )
+            } catch let claim as DomainAccountClaimRequired {
+                // The organization's verified domain may take the existing
+                // account over; park the sign-in until its holder says so.
+                clearOIDCFlowState(req)
+                try PendingDomainClaim(
+                    userID: claim.userID,
+                    domainID: claim.domainID,
+                    providerID: providerID,
+                    subject: userInfo.subject,
+                    groupValues: userInfo.groupValues,
+                    idToken: tokenResponse.idToken,
+                    expiresAt: Date().addingTimeInterval(PendingDomainClaim.lifetime)
+                ).store(in: req.session)
+                return Response(
+                    status: .seeOther, headers: HTTPHeaders([("Location", "/login?domain_claim=pending")]))
+            }
 
-            // Clean up session data
-            req.session.data["oidc_state"] = nil
-            req.session.data["oidc_nonce"] = nil
-            req.session.data["oidc_code_verifier"] = nil
-            req.session.data["oidc_provider_id"] = nil
-            req.session.data["oidc_organization_id"] = nil
+            clearOIDCFlowState(req)
 
             // Accounts disabled by an SSF signal must not get a session; the
             // middleware only sees authenticated requests, so check here too.
@@ -565,6 +608,18 @@ struct OIDCController: RouteCollection {
             try rejectDisabledAccount(user)
             try identity.enforceSCIMActive(user)
 
+            // A verified auto-join domain brings a non-member back into the
+            // organization before the sync below, which skips non-members.
+            let autoJoinDomain = try await identity.autoJoinDomain(for: userInfo, organizationID: organizationID)
+            if try await identity.autoJoin(
+                user: user, userInfo: userInfo, provider: provider, organizationID: organizationID,
+                groupValues: userInfo.groupValues)
+            {
+                await req.recordAuthEvent(
+                    .domainAutoJoin, user: user, organizationID: organizationID,
+                    metadata: ["domain": autoJoinDomain?.domain ?? ""])
+            }
+
             // Sync IdP-managed group memberships and the org role from the
             // token's claims (after the deactivation checks: a denied user
             // must not have authz state written).
@@ -578,7 +633,8 @@ struct OIDCController: RouteCollection {
                 user: user,
                 provider: provider,
                 organizationID: organizationID,
-                groupValues: userInfo.groupValues
+                groupValues: userInfo.groupValues,
+                defaultRole: autoJoinDomain?.defaultRole
             )
 
             // Authenticate user
@@ -603,17 +659,141 @@ struct OIDCController: RouteCollection {
                 .oidcLoginFailed, organizationID: organizationID, metadata: ["error": "\(error)"])
 
             // Clean up session data on error
-            req.session.data["oidc_state"] = nil
-            req.session.data["oidc_nonce"] = nil
-            req.session.data["oidc_code_verifier"] = nil
-            req.session.data["oidc_provider_id"] = nil
-            req.session.data["oidc_organization_id"] = nil
+            clearOIDCFlowState(req)
 
             // Redirect to login with error
             return Response(status: .seeOther, headers: HTTPHeaders([("Location", "/login?error=oidc_failed")]))
         }
     }
 
+    /// Drops the flow-scoped values `initiateOIDCAuth` stored for the callback.
+    private func clearOIDCFlowState(_ req: Request) {
+        req.session.data["oidc_state"] = nil
+        req.session.data["oidc_nonce"] = nil
+        req.session.data["oidc_code_verifier"] = nil
+        req.session.data["oidc_provider_id"] = nil
+        req.session.data["oidc_organization_id"] = nil
+    }
+
+    // MARK: - Domain Account Claims
+
+    /// GET /auth/domain-claim — what the parked sign-in would do, for the
+    /// consent prompt.
+    func getDomainClaim(req: Request) async throws -> DomainClaimResponse {
+        guard let claim = PendingDomainClaim.load(from: req.session) else {
+            throw Abort(.notFound, reason: "No account claim is pending")
+        }
+        guard let user = try await User.find(claim.userID, on: req.db),
+            let domain = try await OrganizationDomain.query(on: req.db)
+                .filter(\.$id == claim.domainID)
+                .with(\.$organization)
+                .first()
+        else {
+            PendingDomainClaim.clear(from: req.session)
+            throw Abort(.notFound, reason: "No account claim is pending")
+        }
+        return DomainClaimResponse(
+            username: user.username, email: user.email, organizationName: domain.organization.name,
+            domain: domain.domain)
+    }
+
+    /// POST /auth/domain-claim/confirm — the passkey challenge the account
+    /// holder answers to accept the claim. Only the account's own passkeys
+    /// are offered; an account without one can't be claimed, as nothing but
+    /// the IdP would vouch for the person accepting.
+    func beginDomainClaimConfirmation(req: Request) async throws -> AuthenticationBeginResponse {
+        guard let claim = PendingDomainClaim.load(from: req.session) else {
+            throw Abort(.notFound, reason: "No account claim is pending")
+        }
+        guard let holder = try await User.find(claim.userID, on: req.db) else {
+            throw Abort(.notFound, reason: "The account to claim no longer exists")
+        }
+        let passkeys = try await UserCredential.query(on: req.db)
+            .filter(\.$user.$id == claim.userID)
+            .count()
+        guard passkeys > 0 else {
+            throw Abort(
+                .conflict,
+                reason: "This account has no passkey to confirm the claim with. Ask an administrator to move it.")
+        }
+
+        let options = try await req.webAuthn.beginAuthentication(
+            for: holder.username,
+            decoyKey: try await DecoyKeyService.getKey(from: req.application),
+            on: req.db
+        )
+        try await req.webAuthn.storeChallenge(
+            options.challenge.base64URLEncodedString().asString(),
+            operation: "authentication",
+            on: req.db
+        )
+        return AuthenticationBeginResponse(options: options)
+    }
+
+    /// POST /auth/domain-claim/accept — the account holder agrees, signing
+    /// the challenge from `confirm` with one of the account's passkeys: the
+    /// account is linked to the IdP and joins the organization, and the
+    /// parked sign-in completes as the callback would have. A failed
+    /// assertion leaves the claim pending, to be retried until it expires.
+    func acceptDomainClaim(req: Request) async throws -> HTTPStatus {
+        guard let claim = PendingDomainClaim.load(from: req.session) else {
+            throw Abort(.notFound, reason: "No account claim is pending")
+        }
+        let confirmation = try req.content.decode(AuthenticationFinishRequest.self)
+        let confirmedBy: User
+        do {
+            confirmedBy = try await req.webAuthn.finishAuthentication(
+                challenge: confirmation.challenge,
+                authenticationCredential: confirmation.response,
+                on: req.db
+            )
+        } catch {
+            await req.recordAuthEvent(
+                .loginFailed, metadata: ["error": "\(error)", "domain_id": claim.domainID.uuidString])
+            throw Abort(.unauthorized, reason: "The passkey could not be verified")
+        }
+        PendingDomainClaim.clear(from: req.session)
+        guard let provider = try await OIDCProvider.query(on: req.db)
+            .filter(\.$id == claim.providerID)
+            .filter(\.$enabled == true)
+            .first()
+        else {
+            throw Abort(.notFound, reason: "OIDC provider not found or disabled")
+        }
+        let organizationID = provider.$organization.id
+
+        // The deactivation checks come first here: a denied account must not
+        // be taken over either.
+        let identity = OIDCIdentityService(db: req.db, logger: req.logger)
+        guard let holder = try await User.find(claim.userID, on: req.db) else {
+            throw Abort(.notFound, reason: "The account to claim no longer exists")
+        }
+        try rejectDisabledAccount(holder)
+        try identity.enforceSCIMActive(holder)
+        let user = try await identity.claimAccount(
+            userID: claim.userID, domainID: claim.domainID, provider: provider, subject: claim.subject,
+            groupValues: claim.groupValues, confirmedUserID: try confirmedBy.requireID())
+        try await identity.syncGroupMemberships(
+            user: user, provider: provider, organizationID: organizationID, groupValues: claim.groupValues)
+
+        req.auth.login(user)
+        req.stampSessionEpoch(for: user)
+        req.session.data["oidc_login_provider_id"] = claim.providerID.uuidString
+        req.session.data["oidc_login_id_token"] = claim.idToken
+        await req.recordAuthEvent(
+            .domainAccountClaimed, user: user, organizationID: organizationID,
+            metadata: ["domain_id": claim.domainID.uuidString])
+        await req.recordAuthEvent(.oidcLogin, user: user, organizationID: organizationID)
+        return .noContent
+    }
+
+    /// POST /auth/domain-claim/decline — the account stays as it is and
+    /// nobody is signed in.
+    func declineDomainClaim(req: Request) async throws -> HTTPStatus {
+        PendingDomainClaim.clear(from: req.session)
+        return .noContent
+    }
+
     // MARK: - Helper Methods
 
     // Provider management goes through the Cedar evaluator like every other
@@ -0,0 +1,107 @@
+import Fluent
+import Foundation
+import Vapor
+
+/// `/api/object-storage/access-keys`: the SigV4 key pairs S3 clients sign
+/// gateway requests with. A key belongs to the caller or to a service
+/// account; managing the caller's own keys is `user:update` on their own
+/// record (the `platform-user-self` policy), and a service account's is
+/// `serviceaccount:update` on it. The secret is shown once, at creation.
+///
+/// Keys confer nothing themselves — the gateways get a key only together
+/// with the bucket grants its owner holds — so every change is pushed to the
+/// agents holding buckets straight away rather than left to the next sync.
+struct ObjectStorageAccessKeyController: RouteCollection {
+    func boot(routes: any RoutesBuilder) throws {
+        let keys = routes.grouped("api", "object-storage", "access-keys").grouped(User.guardMiddleware())
+        keys.get(use: index)
+        keys.post(use: create)
+        keys.delete(":keyID", use: delete)
+    }
+
+    /// GET /api/object-storage/access-keys
+    /// Query params: service_account_id (optional) — list that account's keys
+    /// instead of the caller's.
+    @Sendable
+    func index(req: Request) async throws -> [ObjectStorageAccessKeyResponse] {
+        let user = try req.auth.require(User.self)
+        var query = ObjectStorageAccessKey.query(on: req.db).sort(\.$createdAt, .descending)
+        if let accountID = req.query[String.self, at: "service_account_id"].flatMap(UUID.init(uuidString:)) {
+            try await req.authorize("serviceaccount:read", on: IAMNode(type: .serviceAccount, id: accountID))
+            query = query.filter(\.$serviceAccount.$id == accountID)
+        } else {
+            query = query.filter(\.$user.$id == user.requireID())
+        }
+        return try await query.all().map { ObjectStorageAccessKeyResponse(from: $0) }
+    }
+
+    /// POST /api/object-storage/access-keys
+    @Sendable
+    func create(req: Request) async throws -> Response {
+        let user = try req.auth.require(User.self)
+        let userID = try user.requireID()
+        let createRequest = try req.content.decode(CreateObjectStorageAccessKeyRequest.self)
+
+        let name = createRequest.name.trimmingCharacters(in: .whitespacesAndNewlines)
+        guard !name.isEmpty else {
+            throw Abort(.badRequest, reason: "'name' must be non-empty")
+        }
+
+        if let accountID = createRequest.serviceAccountId {
+            guard try await ServiceAccount.find(accountID, on: req.db) != nil else {
+                throw Abort(.badRequest, reason: "Service account \(accountID) does not exist")
+            }
+            try await req.authorize("serviceaccount:update", on: IAMNode(type: .serviceAccount, id: accountID))
+        } else {
+            try await req.authorize("user:update", on: IAMNode(type: .user, id: userID))
+        }
+
+        let secret = ObjectStorageAccessKey.generateSecret()
+        let key = ObjectStorageAccessKey(
+            accessKeyId: ObjectStorageAccessKey.generateAccessKeyId(),
+            secret: try req.secretsEncryption.encrypt(secret),
+            name: name,
+            userID: createRequest.serviceAccountId == nil ? userID : nil,
+            serviceAccountID: createRequest.serviceAccountId,
+            createdBy: userID
+        )
+        try await key.save(on: req.db)
+        try await BucketController.syncGateways(app: req.application)
+
+        req.logger.info(
+            "Object storage access key created",
+            metadata: [
+                "accessKeyId": .string(key.accessKeyId),
+                "serviceAccountId": .string(createRequest.serviceAccountId?.uuidString ?? ""),
+            ])
+
+        let response = Response(status: .created)
+        try response.content.encode(
+            CreatedObjectStorageAccessKeyResponse(
+                key: ObjectStorageAccessKeyResponse(from: key), secretAccessKey: secret))
+        return response
+    }
+
+    /// DELETE /api/object-storage/access-keys/:keyID
+    @Sendable
+    func delete(req: Request) async throws -> HTTPStatus {
+        _ = try req.auth.require(User.self)
+        guard let keyID = req.parameters.get("keyID", as: UUID.self),
+            let key = try await ObjectStorageAccessKey.find(keyID, on: req.db)
+        else {
+            throw Abort(.notFound)
+        }
+        switch key.principal {
+        case (.serviceAccount, let accountID)?:
+            try await req.authorize("serviceaccount:update", on: IAMNode(type: .serviceAccount, id: accountID))
+        case (_, let ownerID)?:
+            try await req.authorize("user:update", on: IAMNode(type: .user, id: ownerID))
+        case nil:
+            throw Abort(.notFound)
+        }
+
+        try await key.delete(on: req.db)
+        try await BucketController.syncGateways(app: req.application)
+        return .noContent
+    }
+}
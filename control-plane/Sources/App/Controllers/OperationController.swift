@@ -39,6 +39,11 @@ struct OperationController: RouteCollection {
                 _ = try await req.authorizedSandbox(operation.resourceID, permission: "read")
                 return OperationResponse(from: operation)
             }
+        case .fileShare:
+            if try await FileShare.find(operation.resourceID, on: req.db) != nil {
+                _ = try await req.authorizedFileShare(operation.resourceID, permission: "read")
+                return OperationResponse(from: operation)
+            }
         }
 
         // The resource is gone, so there is no node left to evaluate against.
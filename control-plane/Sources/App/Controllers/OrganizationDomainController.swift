@@ -0,0 +1,221 @@
+import Fluent
+import Vapor
+
+/// Verified email domains under `/api/organizations/:organizationID/domains`.
+/// An organization registers a domain, publishes the returned TXT record at
+/// `_strato-challenge.<domain>`, and proves it (`POST :domainID/verify`).
+/// A verified domain lets the organization's identity providers auto-join
+/// users and take over existing accounts at the domain (see
+/// `OIDCIdentityService`).
+///
+/// Authorization follows OIDC providers, which a domain configures sign-in
+/// for: `view_organization` to see, `manage_members` to change.
+struct OrganizationDomainController: RouteCollection {
+    func boot(routes: RoutesBuilder) throws {
+        let domains = routes.grouped("api", "organizations", ":organizationID", "domains")
+        domains.get(use: list)
+        domains.post(use: create)
+        domains.get(":domainID", use: get)
+        domains.patch(":domainID", use: update)
+        domains.delete(":domainID", use: delete)
+        domains.post(":domainID", "verify", use: verify)
+    }
+
+    private func organizationID(_ req: Request) throws -> UUID {
+        guard let organizationID = req.parameters.get("organizationID", as: UUID.self) else {
+            throw Abort(.badRequest, reason: "Invalid organization ID")
+        }
+        return organizationID
+    }
+
+    private func requireView(_ req: Request, organizationID: UUID) async throws {
+        guard try await req.can("view_organization", on: "organization", id: organizationID.uuidString) else {
+            throw Abort(.forbidden, reason: "Access denied to organization")
+        }
+    }
+
+    private func requireManage(_ req: Request, organizationID: UUID) async throws {
+        guard try await req.can("manage_members", on: "organization", id: organizationID.uuidString) else {
+            throw Abort(.forbidden, reason: "You don't have permission to manage this organization's domains")
+        }
+    }
+
+    private func findDomain(_ req: Request, organizationID: UUID) async throws -> OrganizationDomain {
+        guard let domainID = req.parameters.get("domainID", as: UUID.self) else {
+            throw Abort(.badRequest, reason: "Invalid domain ID")
+        }
+        guard
+            let domain = try await OrganizationDomain.query(on: req.db)
+                .filter(\.$id == domainID)
+                .filter(\.$organization.$id == organizationID)
+                .first()
+        else {
+            throw Abort(.notFound, reason: "Domain not found")
+        }
+        return domain
+    }
+
+    /// GET /api/organizations/:organizationID/domains
+    @Sendable
+    func list(req: Request) async throws -> [OrganizationDomainResponse] {
+        _ = try req.auth.require(User.self)
+        let organizationID = try organizationID(req)
+        try await requireView(req, organizationID: organizationID)
+        return try await OrganizationDomain.query(on: req.db)
+            .filter(\.$organization.$id == organizationID)
+            .sort(\.$domain)
+            .all()
+            .map { try OrganizationDomainResponse(from: $0) }
+    }
+
+    /// POST /api/organizations/:organizationID/domains — registers a domain,
+    /// pending until verified. The response carries the TXT record to publish.
+    @Sendable
+    func create(req: Request) async throws -> OrganizationDomainResponse {
+        let user = try req.auth.require(User.self)
+        let organizationID = try organizationID(req)
+        try await OrganizationScope.organization(organizationID).validateExists(on: req.db)
+        try await requireManage(req, organizationID: organizationID)
+        let create = try req.content.decode(CreateOrganizationDomainRequest.self)
+
+        guard let name = OrganizationDomain.canonical(create.domain) else {
+            throw Abort(.badRequest, reason: "'\(create.domain)' is not a domain name")
+        }
+        try await Self.validateDefaultRole(create.defaultRole, organizationID: organizationID, on: req.db)
+        try await Self.assertClaimable(name, by: organizationID, on: req.db)
+
+        let domain = OrganizationDomain(
+            organizationID: organizationID, domain: name, autoJoin: create.autoJoin ?? false,
+            defaultRole: create.defaultRole ?? "member", claimAccounts: create.claimAccounts ?? false,
+            createdByID: user.id)
+        do {
+            try await domain.save(on: req.db)
+        } catch let error as any DatabaseError where error.isConstraintFailure {
+            throw Abort(.conflict, reason: "The organization has already registered \(name)")
+        }
+
+        req.logger.info(
+            "Organization domain registered",
+            metadata: [
+                "domainId": .string(domain.id!.uuidString),
+                "organizationId": .string(organizationID.uuidString),
+                "domain": .string(name),
+            ])
+        return try OrganizationDomainResponse(from: domain)
+    }
+
+    /// GET /api/organizations/:organizationID/domains/:domainID
+    @Sendable
+    func get(req: Request) async throws -> OrganizationDomainResponse {
+        _ = try req.auth.require(User.self)
+        let organizationID = try organizationID(req)
+        try await requireView(req, organizationID: organizationID)
+        return try OrganizationDomainResponse(from: try await findDomain(req, organizationID: organizationID))
+    }
+
+    /// PATCH /api/organizations/:organizationID/domains/:domainID — changes
+    /// what a verified domain does at sign-in. Omitted fields stay as they
+    /// are.
+    @Sendable
+    func update(req: Request) async throws -> OrganizationDomainResponse {
+        _ = try req.auth.require(User.self)
+        let organizationID = try organizationID(req)
+        try await requireManage(req, organizationID: organizationID)
+        let domain = try await findDomain(req, organizationID: organizationID)
+        let update = try req.content.decode(UpdateOrganizationDomainRequest.self)
+
+        try await Self.validateDefaultRole(update.defaultRole, organizationID: organizationID, on: req.db)
+        if let autoJoin = update.autoJoin { domain.autoJoin = autoJoin }
+        if let defaultRole = update.defaultRole { domain.defaultRole = defaultRole }
+        if let claimAccounts = update.claimAccounts { domain.claimAccounts = claimAccounts }
+        try await domain.save(on: req.db)
+        return try OrganizationDomainResponse(from: domain)
+    }
+
+    /// DELETE /api/organizations/:organizationID/domains/:domainID — stops
+    /// trusting the organization's identity providers for the domain. Members
+    /// who joined through it stay members.
+    @Sendable
+    func delete(req: Request) async throws -> HTTPStatus {
+        _ = try req.auth.require(User.self)
+        let organizationID = try organizationID(req)
+        try await requireManage(req, organizationID: organizationID)
+        try await findDomain(req, organizationID: organizationID).delete(on: req.db)
+        return .noContent
+    }
+
+    /// POST /api/organizations/:organizationID/domains/:domainID/verify —
+    /// looks the TXT record up now. A failed check is recorded on the domain
+    /// (`failed`, with the reason) and may be retried. Verifying a verified
+    /// domain changes nothing; removing the record later doesn't unverify it.
+    @Sendable
+    func verify(req: Request) async throws -> OrganizationDomainResponse {
+        _ = try req.auth.require(User.self)
+        let organizationID = try organizationID(req)
+        try await requireManage(req, organizationID: organizationID)
+        let domain = try await findDomain(req, organizationID: organizationID)
+        let domainID = try domain.requireID()
+        if domain.domainStatus == .verified {
+            return try OrganizationDomainResponse(from: domain)
+        }
+
+        if let failure = await DomainVerifier.failure(of: domain, resolver: req.application.domainTXTResolver) {
+            domain.status = OrganizationDomainStatus.failed.rawValue
+            domain.statusMessage = failure
+            try await domain.save(on: req.db)
+            req.logger.info(
+                "Organization domain verification failed",
+                metadata: ["domainId": .string(domainID.uuidString), "reason": .string(failure)])
+            return try OrganizationDomainResponse(from: domain)
+        }
+
+        // Another organization may have proven the domain since this one
+        // registered it, or prove it while this check runs: the partial
+        // unique index on verified `domain` refuses the second save.
+        try await Self.assertClaimable(domain.domain, by: organizationID, on: req.db)
+        domain.status = OrganizationDomainStatus.verified.rawValue
+        domain.statusMessage = nil
+        domain.verifiedAt = Date()
+        do {
+            try await domain.save(on: req.db)
+        } catch let error as any DatabaseError where error.isConstraintFailure {
+            throw Abort(.conflict, reason: "\(domain.domain) is already verified by another organization")
+        }
+
+        req.logger.info(
+            "Organization domain verified",
+            metadata: [
+                "domainId": .string(domainID.uuidString),
+                "organizationId": .string(organizationID.uuidString),
+                "domain": .string(domain.domain),
+            ])
+        return try OrganizationDomainResponse(from: domain)
+    }
+
+    // MARK: - Helpers
+
+    /// Rejects a domain another organization already verified. Pending
+    /// registrations don't block: only proof does.
+    static func assertClaimable(_ name: String, by organizationID: UUID, on db: Database) async throws {
+        let verifiedElsewhere = try await OrganizationDomain.query(on: db)
+            .filter(\.$domain == name)
+            .filter(\.$status == OrganizationDomainStatus.verified.rawValue)
+            .filter(\.$organization.$id != organizationID)
+            .count()
+        if verifiedElsewhere > 0 {
+            throw Abort(.conflict, reason: "\(name) is already verified by another organization")
+        }
+    }
+
+    /// The default role spans the vocabulary of an OIDC provider's: `member`,
+    /// `admin`, an IAM role name, or a role id bindable in the organization.
+    static func validateDefaultRole(_ role: String?, organizationID: UUID, on db: Database) async throws {
+        guard let role else { return }
+        do {
+            _ = try await MemberRoleResolver.resolveOrganizationRole(role, organizationID: organizationID, on: db)
+        } catch {
+            let reason = (error as? any AbortError)?.reason ?? String(describing: error)
+            throw Abort(.badRequest, reason: "Default role '\(role)' is not bindable in this organization: \(reason)")
+        }
+    }
+}
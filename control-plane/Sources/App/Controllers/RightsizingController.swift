@@ -0,0 +1,89 @@
+import Fluent
+import Foundation
+import Vapor
+
+/// Rightsizing recommendations from observed guest usage: per VM under
+/// `/api/vms/:vmID/rightsizing` (guarded by the VM routes' own read/update
+/// mapping), and per project under `/api/projects/:projectID/rightsizing`
+/// (readable by project members, listing only the VMs the caller may read).
+///
+/// Applying a recommendation is an ordinary resize: it goes through
+/// `VMController.applyUpdate`, so a running VM is resized online where the
+/// hot-add ceilings allow and the same quota and agent-version checks apply.
+struct RightsizingController: RouteCollection {
+    func boot(routes: any RoutesBuilder) throws {
+        let vm = routes.grouped("api", "vms", ":vmID", "rightsizing")
+        vm.get(use: showVM)
+        vm.post("apply", use: apply)
+
+        routes.grouped("api", "projects", ":projectID", "rightsizing").get(use: showProject)
+    }
+
+    /// GET /api/vms/:vmID/rightsizing
+    func showVM(req: Request) async throws -> RightsizingRecommendation {
+        let vm = try await req.authorizedVM(try vmID(req), permission: "read")
+        return try await RightsizingService.recommendation(for: vm, on: req.db)
+    }
+
+    /// POST /api/vms/:vmID/rightsizing/apply — resizes the VM to the current
+    /// recommendation. Answers like `PUT /api/vms/:vmID`: `200` with the VM
+    /// when it rests, `202` with the resize operation when it runs. A VM with
+    /// nothing to apply is a `409`, so a stale UI can't resize on a verdict
+    /// that has since changed.
+    func apply(req: Request) async throws -> Response {
+        let user = try req.auth.require(User.self)
+        let vm = try await req.authorizedVM(try vmID(req), permission: "update")
+        let recommendation = try await RightsizingService.recommendation(for: vm, on: req.db)
+        guard recommendation.isActionable else {
+            throw Abort(
+                .conflict,
+                reason: "There is no rightsizing recommendation to apply (\(recommendation.verdict.rawValue))")
+        }
+
+        req.logger.info(
+            "Applying rightsizing recommendation",
+            metadata: [
+                "vm_id": .string(recommendation.vmId.uuidString),
+                "verdict": .string(recommendation.verdict.rawValue),
+                "cpu": .string("\(recommendation.currentCpu) -> \(recommendation.proposedCpu)"),
+                "memory": .string("\(recommendation.currentMemory) -> \(recommendation.proposedMemory)"),
+            ])
+        return try await VMController().applyUpdate(
+            .init(cpu: recommendation.proposedCpu, memory: recommendation.proposedMemory),
+            to: vm, user: user, req: req)
+    }
+
+    /// GET /api/projects/:projectID/rightsizing
+    func showProject(req: Request) async throws -> ProjectRightsizingReport {
+        guard let projectID = req.parameters.get("projectID", as: UUID.self) else {
+            throw Abort(.badRequest, reason: "Invalid project ID")
+        }
+        guard let project = try await Project.find(projectID, on: req.db) else {
+            throw Abort(.notFound, reason: "Project not found")
+        }
+        try await OrganizationAccessService.requireProjectMember(project: project, on: req)
+
+        let vms = try await VM.query(on: req.db)
+            .filter(\.$project.$id == projectID)
+            .sort(\.$name)
+            .all()
+        // One batched decision for the whole project, as in the VM list.
+        let nodes = vms.compactMap { $0.id.map { IAMNode(type: .virtualMachine, id: $0) } }
+        let allowed = try await req.canFilter("vm:read", on: nodes)
+        let readable = vms.filter { vm in
+            guard let id = vm.id else { return false }
+            return allowed.contains(IAMNode(type: .virtualMachine, id: id))
+        }
+        return ProjectRightsizingReport(
+            projectId: projectID,
+            lookbackDays: RightsizingService.defaultPolicy.lookbackDays,
+            recommendations: try await RightsizingService.recommendations(for: readable, on: req.db))
+    }
+
+    private func vmID(_ req: Request) throws -> UUID {
+        guard let vmID = req.parameters.get("vmID", as: UUID.self) else {
+            throw Abort(.badRequest, reason: "Invalid VM ID")
+        }
+        return vmID
+    }
+}
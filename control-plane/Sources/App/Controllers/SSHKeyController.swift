@@ -0,0 +1,90 @@
+import Fluent
+import Foundation
+import Vapor
+
+/// Self-service SSH keys for the console gateway (`/api/users/me/ssh-keys`).
+///
+/// The acting user is always `req.auth`'s user, as for passkeys. Unlike
+/// passkeys, API keys may manage SSH keys: a key reaches only the serial
+/// consoles a write-scoped API key can already drive over the WebSocket.
+struct SSHKeyController: RouteCollection {
+    func boot(routes: RoutesBuilder) throws {
+        let keys = routes.grouped("api", "users", "me", "ssh-keys")
+        keys.get(use: index)
+        keys.post(use: create)
+        keys.delete(":keyID", use: delete)
+    }
+
+    func index(req: Request) async throws -> [SSHKeyResponse] {
+        let user = try currentUser(req)
+        let keys = try await UserSSHKey.query(on: req.db)
+            .filter(\.$user.$id == user.requireID())
+            .sort(\.$createdAt, .ascending)
+            .all()
+        return keys.map(SSHKeyResponse.init(from:))
+    }
+
+    func create(req: Request) async throws -> Response {
+        let user = try currentUser(req)
+        try rejectDisabledAccount(user)
+        let userID = try user.requireID()
+
+        let body = try req.content.decode(CreateSSHKeyRequest.self)
+        let name = body.name.trimmingCharacters(in: .whitespacesAndNewlines)
+        guard !name.isEmpty, name.count <= UserSSHKey.maxNameLength else {
+            throw Abort(.badRequest, reason: "Key name must be 1-\(UserSSHKey.maxNameLength) characters")
+        }
+        let parsed = try UserSSHKey.parse(body.publicKey)
+
+        let existing = try await UserSSHKey.query(on: req.db)
+            .filter(\.$user.$id == userID)
+            .count()
+        guard existing < UserSSHKey.maxKeysPerUser else {
+            throw Abort(.conflict, reason: "You already have the maximum of \(UserSSHKey.maxKeysPerUser) SSH keys")
+        }
+
+        let key = UserSSHKey(
+            userID: userID, name: name, publicKey: parsed.normalized, fingerprint: parsed.fingerprint)
+        do {
+            try await key.save(on: req.db)
+        } catch let error as any DatabaseError where error.isConstraintFailure {
+            throw Abort(.conflict, reason: "This key is already registered")
+        }
+
+        await req.recordAuthEvent(
+            .sshKeyAdded, user: user,
+            metadata: ["sshKeyId": try key.requireID().uuidString, "fingerprint": key.fingerprint])
+
+        let response = Response(status: .created)
+        try response.content.encode(SSHKeyResponse(from: key))
+        return response
+    }
+
+    func delete(req: Request) async throws -> HTTPStatus {
+        let user = try currentUser(req)
+        guard let keyID = req.parameters.get("keyID", as: UUID.self) else {
+            throw Abort(.badRequest, reason: "Invalid SSH key ID")
+        }
+        guard
+            let key = try await UserSSHKey.query(on: req.db)
+                .filter(\.$id == keyID)
+                .filter(\.$user.$id == user.requireID())
+                .first()
+        else {
+            throw Abort(.notFound, reason: "SSH key not found")
+        }
+
+        try await key.delete(on: req.db)
+        await req.recordAuthEvent(
+            .sshKeyRemoved, user: user,
+            metadata: ["sshKeyId": keyID.uuidString, "fingerprint": key.fingerprint])
+        return .noContent
+    }
+
+    private func currentUser(_ req: Request) throws -> User {
+        guard let user = req.auth.get(User.self) else {
+            throw Abort(.unauthorized)
+        }
+        return user
+    }
+}
@@ -46,14 +46,15 @@ struct SandboxController: RouteCollection {
     /// Sandbox-flavored front of `ResourceOperation.begin`: creates the pending
     /// operation record and applies the sandbox's desired-state change in one
     /// transaction, rejecting with `409 Conflict` when any operation is already
-    /// pending for the sandbox. Internal (not private) because the snapshot
-    /// handlers in SandboxSnapshotController.swift share it.
+    /// pending for the sandbox, after the organization's admission webhooks
+    /// have reviewed it. Internal (not private) because the snapshot
+    /// transfer handlers in SandboxSnapshotTransferController.swift share it.
     func beginOperation(
         _ kind: VMOperationKind,
         sandbox: Sandbox,
         user: User,
         settingDesiredStatus desiredStatus: DesiredSandboxStatus? = nil,
-        on db: Database,
+        on req: Request,
         preparing mutation: @escaping @Sendable (any Database) async throws -> Void = { _ in }
     ) async throws -> ResourceOperation {
         try await ResourceOperation.begin(
@@ -61,7 +62,8 @@ struct SandboxController: RouteCollection {
             resourceKind: .sandbox,
             resourceID: sandbox.requireID(),
             userID: user.requireID(),
-            on: db
+            on: req.db,
+            admittedBy: req.application.admission
         ) { db in
             try await mutation(db)
             if let desiredStatus {
@@ -208,7 +210,12 @@ struct SandboxController: RouteCollection {
             let cpuTemplate: String?
         }
 
-        let createRequest = try req.content.decode(CreateSandboxRequest.self)
+        let decoded = try req.content.decode(CreateSandboxRequest.self)
+        let target = try await req.authorizeCreateProject(
+            requestedProjectId: decoded.projectId, user: user, resourceKind: "sandboxes")
+        let createRequest = try await req.admitCreate(
+            decoded, resourceKind: .sandbox, resourceName: decoded.name, projectID: try target.requireID(),
+            user: user)
 
         let requestedName = createRequest.name.trimmingCharacters(in: .whitespacesAndNewlines)
         guard !requestedName.isEmpty else {
@@ -359,11 +366,41 @@ struct SandboxController: RouteCollection {
         )
         sandbox.imageDigest = restoreSource?.imageDigest
 
-        let userID = try user.requireID()
-        let restoreSnapshotID = restoreSnapshot?.id
-        let initialDesiredStatus: DesiredSandboxStatus =
-            restoreSnapshot == nil ? .stopped : .running
+        let operation = try await Self.provision(
+            sandbox, in: project, environment: environment, userID: try user.requireID(),
+            desiredStatus: restoreSnapshot == nil ? .stopped : .running,
+            forkingFrom: restoreSnapshot?.id, on: req)
+        let sandboxID = try sandbox.requireID()
+
+        req.logger.info(
+            "Sandbox creation accepted",
+            metadata: [
+                "sandbox_id": .string(sandboxID.uuidString),
+                "operation_id": .string(operation.id?.uuidString ?? ""),
+                "image": .string(imageRef),
+            ])
+
+        return try operation.acceptedResponse()
+    }
 
+    /// Inserts a validated, not-yet-saved sandbox and sets it on its way: the
+    /// quota admission check, the row, its NIC + addresses, the initial
+    /// desired state, the creator's binding and the pending create operation
+    /// in one transaction, then placement in the background. Shared by
+    /// `create` and code sessions, which provision a sandbox per session.
+    /// `forkingFrom` is the ready snapshot a fork restores; `mutation` writes
+    /// rows that must commit with the sandbox (it may run more than once, on
+    /// a retried transaction).
+    static func provision(
+        _ sandbox: Sandbox,
+        in project: Project,
+        environment: String,
+        userID: UUID,
+        desiredStatus initialDesiredStatus: DesiredSandboxStatus,
+        forkingFrom restoreSnapshotID: UUID? = nil,
+        on req: Request,
+        applying mutation: @escaping @Sendable (any Database) async throws -> Void = { _ in }
+    ) async throws -> ResourceOperation {
         // Quota admission check, the sandbox insert, its NIC + address rows, the
         // initial desired-state bump, and the pending create operation commit
         // (or roll back) as one transaction, mirroring VM creation. Sandboxes
@@ -405,7 +442,8 @@ struct SandboxController: RouteCollection {
 
                     // A cold create starts stopped. A fork resumes the captured
                     // guest during create and must be desired-running so the
-                    // reconciler does not immediately pause it again.
+                    // reconciler does not immediately pause it again; so must a
+                    // code session, whose kernel is the point.
                     // The bump to generation 1 distinguishes "never confirmed by
                     // any agent" (observed_generation 0) from "confirmed".
                     sandbox.setDesiredStatus(initialDesiredStatus)
@@ -433,6 +471,7 @@ struct SandboxController: RouteCollection {
                         on: db
                     )
 
+                    try await mutation(db)
                     return operation
                 }
             }
@@ -442,27 +481,17 @@ struct SandboxController: RouteCollection {
             throw Abort(.conflict, reason: error.errorDescription ?? "No free IP addresses in the network")
         }
 
-        let sandboxID = try sandbox.requireID()
-
         // Place the sandbox in the background: the scheduler selects a
         // Firecracker-capable agent and persists hypervisorId, and the
         // desired-state sync carries the sandbox to its agent. Observed-state
         // reports — not this request — decide the operation's verdict.
         req.resourceOperationCoordinator.dispatch(
-            operation, resourceKind: .sandbox, resourceID: sandboxID, hypervisorId: nil,
+            operation, resourceKind: .sandbox, resourceID: try sandbox.requireID(), hypervisorId: nil,
             dispatch: .placement { @Sendable [app = req.application] db in
                 try await app.agentService.createSandbox(sandbox: sandbox, db: db)
             }, app: req.application)
 
-        req.logger.info(
-            "Sandbox creation accepted",
-            metadata: [
-                "sandbox_id": .string(sandboxID.uuidString),
-                "operation_id": .string(operation.id?.uuidString ?? ""),
-                "image": .string(imageRef),
-            ])
-
-        return try operation.acceptedResponse()
+        return operation
     }
 
     /// Allocates and persists the sandbox's single NIC on the default logical
@@ -659,7 +688,40 @@ struct SandboxController: RouteCollection {
 
         let sandbox = try await fetchSandboxWithPermission(req: req, permission: "exec")
         let sandboxID = try sandbox.requireID()
+        let agent = try await Self.execAgent(for: sandbox, on: req)
+
+        let session = req.sandboxExecSessionManager.createPendingSession(
+            sandboxId: sandboxID.uuidString,
+            agentKey: agent.identity.key,
+            userId: try user.requireID().uuidString,
+            command: execRequest.command,
+            env: execRequest.env,
+            workingDir: execRequest.workingDir,
+            tty: execRequest.tty ?? false,
+            rows: execRequest.rows,
+            cols: execRequest.cols
+        )
+
+        struct ExecSessionResponse: Content {
+            let sessionId: String
+            let websocketPath: String
+            let expiresAt: Date
+        }
 
+        let response = Response(status: .created)
+        try response.content.encode(
+            ExecSessionResponse(
+                sessionId: session.sessionId,
+                websocketPath: "/api/sandboxes/\(sandboxID.uuidString)/exec/\(session.sessionId)/attach",
+                expiresAt: session.expiresAt
+            ))
+        return response
+    }
+
+    /// The agent to relay an exec into `sandbox` through, once the sandbox is
+    /// running, its agent speaks exec, and this replica holds the agent's
+    /// socket. Shared by `exec` and code-session executions.
+    static func execAgent(for sandbox: Sandbox, on req: Request) async throws -> Agent {
         guard sandbox.isRunning else {
             throw Abort(
                 .badRequest,
@@ -696,32 +758,7 @@ struct SandboxController: RouteCollection {
             )
         }
 
-        let session = req.sandboxExecSessionManager.createPendingSession(
-            sandboxId: sandboxID.uuidString,
-            agentKey: agent.identity.key,
-            userId: try user.requireID().uuidString,
-            command: execRequest.command,
-            env: execRequest.env,
-            workingDir: execRequest.workingDir,
-            tty: execRequest.tty ?? false,
-            rows: execRequest.rows,
-            cols: execRequest.cols
-        )
-
-        struct ExecSessionResponse: Content {
-            let sessionId: String
-            let websocketPath: String
-            let expiresAt: Date
-        }
-
-        let response = Response(status: .created)
-        try response.content.encode(
-            ExecSessionResponse(
-                sessionId: session.sessionId,
-                websocketPath: "/api/sandboxes/\(sandboxID.uuidString)/exec/\(session.sessionId)/attach",
-                expiresAt: session.expiresAt
-            ))
-        return response
+        return agent
     }
 
     // MARK: - Delete
@@ -729,14 +766,20 @@ struct SandboxController: RouteCollection {
     func delete(req: Request) async throws -> Response {
         let user = try req.auth.require(User.self)
         let sandbox = try await fetchSandboxWithPermission(req: req, permission: "delete")
+        let operation = try await Self.beginDeletion(
+            of: sandbox, userID: try user.requireID(), on: req.db, app: req.application)
+        return try operation.acceptedResponse()
+    }
 
-        // Deletion via state sync, exactly like VMs: desired becomes
-        // `.absent`, the agent tears the sandbox down on its next sync, and
-        // the row is removed only once a report confirms absence. Unplaced
-        // sandboxes and offline agents keep a direct database path.
+    /// Deletion via state sync, exactly like VMs: desired becomes `.absent`,
+    /// the agent tears the sandbox down on its next sync, and the row is
+    /// removed only once a report confirms absence. Unplaced sandboxes and
+    /// offline agents keep a direct database path. Shared by `delete` and
+    /// code-session deletion.
+    static func beginDeletion(
+        of sandbox: Sandbox, userID: UUID, on db: any Database, app: Application
+    ) async throws -> ResourceOperation {
         let sandboxID = try sandbox.requireID()
-        let userID = try user.requireID()
-        let app = req.application
         let agentOnline: Bool
         if let hypervisorId = sandbox.hypervisorId {
             agentOnline = await app.agentService.agentIsOnline(agentId: hypervisorId)
@@ -751,15 +794,14 @@ struct SandboxController: RouteCollection {
                 try await Self.performDirectDeletion(sandbox: sandbox, on: db, app: app)
             }
 
-        let operation = try await req.resourceOperationCoordinator.perform(
+        return try await app.resourceOperationCoordinator.perform(
             .delete, resourceKind: .sandbox, resourceID: sandboxID, userID: userID,
-            hypervisorId: sandbox.hypervisorId, dispatch: strategy, on: req.db, app: app
+            hypervisorId: sandbox.hypervisorId, dispatch: strategy, on: db, app: app
         ) { @Sendable db in
             try await Self.requireSnapshotLineageDeletable(for: sandboxID, on: db)
             sandbox.setDesiredStatus(.absent)
             try await sandbox.save(on: db)
         }
-        return try operation.acceptedResponse()
     }
 
     /// The direct-removal work for a sandbox whose agent is gone (never placed,
@@ -19,11 +19,19 @@ import Vapor
 /// - CP → browser: `{"type":"ready"}` once the process spawned; binary frames
 ///   are output bytes (stdout/stderr interleaved);
 ///   `{"type":"exit","exitCode":N}` then a normal close when it exits;
-///   `{"type":"error","message":"..."}` then a close on abnormal end.
+///   `{"type":"error","message":"..."}` then a close on abnormal end;
+///   `{"type":"notice","message":"..."}` when a participant of a shared
+///   session joins, leaves, or has their access changed.
+///
+/// A participant the owner invited (see `SharedSessionController`) joins an
+/// attached session over `GET /api/sandboxes/:id/exec/:sessionId/join`: the
+/// same frames, except that resizes are ignored — the owner's terminal sets
+/// the size — and a read-only participant's input is dropped.
 struct SandboxExecWebSocketController: RouteCollection {
     func boot(routes: RoutesBuilder) throws {
         let sandboxRoutes = routes.grouped("api", "sandboxes")
         sandboxRoutes.webSocket(":sandboxID", "exec", ":sessionID", "attach", onUpgrade: websocketHandler)
+        sandboxRoutes.webSocket(":sandboxID", "exec", ":sessionID", "join", onUpgrade: joinHandler)
     }
 
     // Non-async handler - runs on WebSocket's event loop
@@ -55,7 +63,8 @@ struct SandboxExecWebSocketController: RouteCollection {
                     sessionId: sessionId,
                     sandboxId: sandboxId.uuidString,
                     userId: userId,
-                    websocket: ws
+                    username: req.auth.get(User.self)?.username,
+                    frontend: WebSocketExecFrontend(websocket: ws)
                 )
             } catch {
                 req.logger.warning(
@@ -181,6 +190,82 @@ struct SandboxExecWebSocketController: RouteCollection {
         }
     }
 
+    // Non-async handler - runs on WebSocket's event loop
+    private func joinHandler(req: Request, ws: WebSocket) {
+        guard let sandboxIdString = req.parameters.get("sandboxID"),
+            let sandboxId = UUID(uuidString: sandboxIdString),
+            let sessionId = req.parameters.get("sessionID"),
+            !sessionId.isEmpty
+        else {
+            ws.send(#"{"type":"error","message":"Invalid sandbox or session ID"}"#)
+            _ = ws.close(code: .unacceptableData)
+            return
+        }
+
+        Task {
+            // The invitee must be able to exec into the sandbox themselves,
+            // checked again at every join.
+            guard await validateExecAccess(req: req, ws: ws, sandboxId: sandboxId) != nil,
+                let user = req.auth.get(User.self), let userId = user.id
+            else {
+                return
+            }
+
+            let manager = req.sandboxExecSessionManager
+            let participantId: UUID
+            let access: SessionAccess
+            do {
+                (participantId, access) = try manager.join(
+                    sessionId: sessionId, sandboxId: sandboxId.uuidString, userId: userId,
+                    username: user.username, frontend: WebSocketExecFrontend(websocket: ws))
+            } catch {
+                try? await ws.send(#"{"type":"error","message":"No such exec session, or you are not invited to it"}"#)
+                try? await ws.close(code: .policyViolation)
+                return
+            }
+
+            req.logger.info(
+                "Participant joined sandbox exec session",
+                metadata: [
+                    "sandboxId": .string(sandboxId.uuidString),
+                    "sessionId": .string(sessionId),
+                    "access": .string(access.rawValue),
+                ])
+            if let record = manager.joinRecord(
+                sessionId: sessionId, userId: userId, username: user.username, access: access)
+            {
+                await req.application.audit.record(record)
+            }
+            WebSocketExecFrontend(websocket: ws).execNotice("joined session \(sessionId) \(access.label)")
+
+            // One consumer, so input reaches the agent in the order typed.
+            let (input, continuation) = AsyncStream.makeStream(of: Data.self)
+            Task {
+                for await data in input {
+                    do {
+                        try await manager.routeParticipantInput(
+                            sessionId: sessionId, participantId: participantId, data: data)
+                    } catch {
+                        req.logger.error("Failed to route exec input to agent: \(error)")
+                    }
+                }
+            }
+
+            // Frame callbacks are loop-bound; see `websocketHandler`. Text
+            // frames (resizes) are ignored for participants.
+            ws.eventLoop.execute {
+                ws.onBinary { _, buffer in
+                    continuation.yield(Data(buffer.readableBytesView))
+                }
+            }
+
+            ws.onClose.whenComplete { _ in
+                continuation.finish()
+                manager.removeParticipant(sessionId: sessionId, participantId: participantId)
+            }
+        }
+    }
+
     /// One event on the per-connection serial pump: the initial exec start,
     /// browser frames, and the browser-disconnect teardown, in strict order.
     private enum SessionEvent: Sendable {
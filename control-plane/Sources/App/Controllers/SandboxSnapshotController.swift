@@ -71,7 +71,39 @@ extension SandboxController {
             ? request.name!.trimmingCharacters(in: .whitespacesAndNewlines)
             : "snapshot-\(Int(Date().timeIntervalSince1970))"
 
-        let userID = try user.requireID()
+        let (operation, snapshot) = try await Self.beginCheckpoint(
+            of: sandbox, in: project, agentId: agentId, name: name, stop: stopAfterSnapshot,
+            userID: try user.requireID(), on: req.db, app: req.application,
+            admittedBy: req.application.admission)
+        let snapshotID = try snapshot.requireID()
+
+        req.logger.info(
+            "Sandbox snapshot accepted",
+            metadata: [
+                "sandbox_id": .string(sandboxID.uuidString),
+                "snapshot_id": .string(snapshotID.uuidString),
+                "stop": .stringConvertible(stopAfterSnapshot),
+            ])
+
+        return try operation.acceptedResponse()
+    }
+
+    /// Starts a checkpoint of a placed, agent-confirmed sandbox whose agent
+    /// can snapshot: the snapshot row and its storage reservation commit with
+    /// the pending operation, and the agent RPC runs in the background. Shared
+    /// by `createSnapshot` and the code-session idle sweep.
+    static func beginCheckpoint(
+        of sandbox: Sandbox,
+        in project: Project,
+        agentId: String,
+        name: String,
+        stop stopAfterSnapshot: Bool,
+        userID: UUID,
+        on db: any Database,
+        app: Application,
+        admittedBy admission: AdmissionService? = nil
+    ) async throws -> (ResourceOperation, SandboxSnapshot) {
+        let sandboxID = try sandbox.requireID()
         let snapshot = SandboxSnapshot(
             name: name,
             sandboxID: sandboxID,
@@ -90,7 +122,8 @@ extension SandboxController {
             resourceKind: .sandbox,
             resourceID: sandboxID,
             userID: userID,
-            on: req.db
+            on: db,
+            admittedBy: admission
         ) { db in
             // Snapshot storage draws from the shared storage quota pool
             // (issue #415 enforcement points).
@@ -117,22 +150,11 @@ extension SandboxController {
             }
         }
 
-        let snapshotID = try snapshot.requireID()
-
         Self.runSnapshotCreation(
             operation, snapshot: snapshot, sandbox: sandbox,
             mode: stopAfterSnapshot ? .stop : .resume,
-            agentId: agentId, app: req.application)
-
-        req.logger.info(
-            "Sandbox snapshot accepted",
-            metadata: [
-                "sandbox_id": .string(sandboxID.uuidString),
-                "snapshot_id": .string(snapshotID.uuidString),
-                "stop": .stringConvertible(stopAfterSnapshot),
-            ])
-
-        return try operation.acceptedResponse()
+            agentId: agentId, app: app)
+        return (operation, snapshot)
     }
 
     /// Background half of `createSnapshot`: the agent RPC and the verdict.
@@ -273,12 +295,32 @@ extension SandboxController {
                 .conflict,
                 reason: "Snapshot cannot be deleted in status '\(snapshot.status.rawValue)'")
         }
+        let operation = try await Self.beginSnapshotDeletion(
+            of: snapshot, sandbox: sandbox, userID: try user.requireID(), on: req.db,
+            app: req.application, admittedBy: req.application.admission)
+        return try operation.acceptedResponse()
+    }
+
+    /// Starts deleting a snapshot: `deleting` commits with the pending
+    /// operation once no fork depends on it, and the agent RPC runs in the
+    /// background. Shared by `deleteSnapshot` and code sessions, which drop
+    /// their previous checkpoint once resumed.
+    static func beginSnapshotDeletion(
+        of snapshot: SandboxSnapshot,
+        sandbox: Sandbox,
+        userID: UUID,
+        on db: any Database,
+        app: Application,
+        admittedBy admission: AdmissionService? = nil
+    ) async throws -> ResourceOperation {
+        let snapshotID = try snapshot.requireID()
         let operation = try await ResourceOperation.begin(
             .snapshotDelete,
             resourceKind: .sandbox,
             resourceID: try sandbox.requireID(),
-            userID: try user.requireID(),
-            on: req.db
+            userID: userID,
+            on: db,
+            admittedBy: admission
         ) { db in
             try await Self.lockSnapshotLineage([snapshotID], on: db)
             guard let current = try await SandboxSnapshot.find(snapshotID, on: db), current.canDelete else {
@@ -293,8 +335,8 @@ extension SandboxController {
             try await current.save(on: db)
         }
 
-        Self.runSnapshotDeletion(operation, snapshot: snapshot, sandbox: sandbox, app: req.application)
-        return try operation.acceptedResponse()
+        Self.runSnapshotDeletion(operation, snapshot: snapshot, sandbox: sandbox, app: app)
+        return operation
     }
 
     /// Background half of `deleteSnapshot`. A snapshot whose agent is gone
@@ -418,12 +460,44 @@ extension SandboxController {
             }
         }
 
+        let operation = try await Self.beginRestore(
+            of: sandbox, from: snapshotID, agentId: agentId, artifacts: transferArtifacts,
+            userID: try user.requireID(), on: req.db, app: req.application,
+            admittedBy: req.application.admission)
+
+        req.logger.info(
+            "Sandbox restore accepted",
+            metadata: [
+                "sandbox_id": .string(sandboxID.uuidString),
+                "snapshot_id": .string(snapshotID.uuidString),
+            ])
+        return try operation.acceptedResponse()
+    }
+
+    /// Starts an in-place restore of `sandbox` from one of its snapshots,
+    /// re-checking restorability under the lineage lock in the operation's
+    /// transaction; the agent RPC runs in the background. Shared by
+    /// `restoreSnapshot` and code sessions resuming from their idle
+    /// checkpoint.
+    static func beginRestore(
+        of sandbox: Sandbox,
+        from snapshotID: UUID,
+        agentId: String,
+        artifacts: [SandboxSnapshotArtifactDescriptor]? = nil,
+        userID: UUID,
+        on db: any Database,
+        app: Application,
+        admittedBy admission: AdmissionService? = nil
+    ) async throws -> ResourceOperation {
         // The restored guest resumes running; desired state must agree or
         // the next sync would pause it right back.
-        let operation = try await beginOperation(
-            .restore, sandbox: sandbox, user: user,
-            settingDesiredStatus: .running,
-            on: req.db
+        let operation = try await ResourceOperation.begin(
+            .restore,
+            resourceKind: .sandbox,
+            resourceID: try sandbox.requireID(),
+            userID: userID,
+            on: db,
+            admittedBy: admission
         ) { db in
             try await Self.lockSnapshotLineage([snapshotID], on: db)
             guard let current = try await SandboxSnapshot.find(snapshotID, on: db), current.canRestore
@@ -438,19 +512,14 @@ extension SandboxController {
                     .conflict,
                     reason: "Snapshot cannot be restored in place while live forks of it exist")
             }
+            sandbox.setDesiredStatus(.running)
+            try await sandbox.save(on: db)
         }
 
         Self.runSnapshotRestore(
             operation, snapshotID: snapshotID, agentId: agentId,
-            artifacts: transferArtifacts, app: req.application)
-
-        req.logger.info(
-            "Sandbox restore accepted",
-            metadata: [
-                "sandbox_id": .string(sandboxID.uuidString),
-                "snapshot_id": .string(snapshotID.uuidString),
-            ])
-        return try operation.acceptedResponse()
+            artifacts: artifacts, app: app)
+        return operation
     }
 
     /// Background half of `restoreSnapshot`. `artifacts` is non-nil for a
@@ -85,7 +85,7 @@ extension SandboxController {
         }
 
         let operation = try await beginOperation(
-            .snapshotExport, sandbox: sandbox, user: user, on: req.db
+            .snapshotExport, sandbox: sandbox, user: user, on: req
         ) { db in
             try await Self.lockSnapshotLineage([snapshotID], on: db)
             guard let current = try await SandboxSnapshot.find(snapshotID, on: db), current.isReady
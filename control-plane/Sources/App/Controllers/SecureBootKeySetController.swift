@@ -0,0 +1,259 @@
+import Fluent
+import Foundation
+import StratoShared
+import Vapor
+
+/// Custom UEFI Secure Boot keys (wire v29).
+///
+/// Key sets, org-scoped and optionally narrowed to one project (org members
+/// read; org admins — or, for a project's own sets, its admins — mutate):
+/// - `GET/POST  /api/organizations/:organizationID/secure-boot-key-sets`
+/// - `GET/PUT/DELETE /api/organizations/:organizationID/secure-boot-key-sets/:keySetID`
+///
+/// A VM's own copy, guarded like the VM itself:
+/// - `GET/PUT /api/vms/:vmID/secure-boot/keys` — its db and dbx. Changes only
+///   while the VM is stopped; the agent enrolls them before its next boot.
+struct SecureBootKeySetController: RouteCollection {
+    func boot(routes: any RoutesBuilder) throws {
+        let keySets = routes.grouped("api", "organizations", ":organizationID", "secure-boot-key-sets")
+        keySets.get(use: list)
+        keySets.post(use: create)
+        keySets.group(":keySetID") { keySet in
+            keySet.get(use: get)
+            keySet.put(use: update)
+            keySet.delete(use: delete)
+        }
+
+        let vmKeys = routes.grouped("api", "vms", ":vmID", "secure-boot", "keys")
+        vmKeys.get(use: showVMKeys)
+        vmKeys.put(use: updateVMKeys)
+    }
+
+    // MARK: - Key sets
+
+    /// Every set in the organization, or with `?projectId=` only those a VM
+    /// in that project may use (the org-wide ones and its own).
+    func list(req: Request) async throws -> [SecureBootKeySetResponse] {
+        let organizationID = try requireOrganizationID(req)
+        try await OrganizationAccessService.requireMember(organizationID: organizationID, on: req)
+
+        let query = SecureBootKeySet.query(on: req.db)
+            .filter(\.$organization.$id == organizationID)
+        if let projectID = req.query[UUID.self, at: "projectId"] {
+            query.group(.or) { scope in
+                scope.filter(\.$project.$id == nil).filter(\.$project.$id == projectID)
+            }
+        }
+        return try await query.sort(\.$name).all().map(SecureBootKeySetResponse.init(from:))
+    }
+
+    func create(req: Request) async throws -> Response {
+        let organizationID = try requireOrganizationID(req)
+        let request = try req.content.decode(CreateSecureBootKeySetRequest.self)
+        try await requireManage(organizationID: organizationID, projectID: request.projectId, on: req)
+
+        let name = request.name.trimmingCharacters(in: .whitespacesAndNewlines)
+        guard !name.isEmpty else {
+            throw Abort(.badRequest, reason: "Key set name must not be empty")
+        }
+        try await requireUniqueName(name, organizationID: organizationID, excluding: nil, on: req.db)
+
+        let keySet = SecureBootKeySet(
+            organizationID: organizationID,
+            projectID: request.projectId,
+            name: name,
+            description: request.description ?? "",
+            platformKey: request.platformKey,
+            keyExchangeKeys: request.keyExchangeKeys ?? [],
+            signatureDatabase: request.signatureDatabase ?? [],
+            forbiddenSignatures: request.forbiddenSignatures ?? [],
+            includeMicrosoftKeys: request.includeMicrosoftKeys ?? false)
+        if let ownerGuid = request.ownerGuid {
+            keySet.ownerGUID = ownerGuid.lowercased()
+        }
+        try validate(keySet.keys)
+        try await keySet.save(on: req.db)
+
+        req.logger.info(
+            "Created Secure Boot key set",
+            metadata: [
+                "key_set_id": .string(keySet.id?.uuidString ?? ""),
+                "organization_id": .string(organizationID.uuidString),
+            ])
+        let response = Response(status: .created)
+        try response.content.encode(SecureBootKeySetResponse(from: keySet))
+        return response
+    }
+
+    func get(req: Request) async throws -> SecureBootKeySetResponse {
+        let keySet = try await requireKeySet(req)
+        try await OrganizationAccessService.requireMember(organizationID: keySet.$organization.id, on: req)
+        return SecureBootKeySetResponse(from: keySet)
+    }
+
+    /// Edits the set for VMs created from now on; VMs already created from
+    /// it keep the keys they copied.
+    func update(req: Request) async throws -> SecureBootKeySetResponse {
+        let keySet = try await requireKeySet(req)
+        try await requireManage(
+            organizationID: keySet.$organization.id, projectID: keySet.$project.id, on: req)
+
+        let request = try req.content.decode(UpdateSecureBootKeySetRequest.self)
+        if let name = request.name {
+            let trimmed = name.trimmingCharacters(in: .whitespacesAndNewlines)
+            guard !trimmed.isEmpty else {
+                throw Abort(.badRequest, reason: "Key set name must not be empty")
+            }
+            try await requireUniqueName(
+                trimmed, organizationID: keySet.$organization.id, excluding: keySet.id, on: req.db)
+            keySet.name = trimmed
+        }
+        if let description = request.description { keySet.description = description }
+        if let platformKey = request.platformKey { keySet.platformKey = platformKey }
+        if let keyExchangeKeys = request.keyExchangeKeys { keySet.keyExchangeKeys = keyExchangeKeys }
+        if let signatureDatabase = request.signatureDatabase { keySet.signatureDatabase = signatureDatabase }
+        if let forbidden = request.forbiddenSignatures { keySet.forbiddenSignatures = forbidden }
+        if let includeMicrosoftKeys = request.includeMicrosoftKeys {
+            keySet.includeMicrosoftKeys = includeMicrosoftKeys
+        }
+        try validate(keySet.keys)
+        try await keySet.save(on: req.db)
+        return SecureBootKeySetResponse(from: keySet)
+    }
+
+    /// VMs created from the set keep their copy; only the link is cleared.
+    func delete(req: Request) async throws -> HTTPStatus {
+        let keySet = try await requireKeySet(req)
+        try await requireManage(
+            organizationID: keySet.$organization.id, projectID: keySet.$project.id, on: req)
+
+        try await keySet.delete(on: req.db)
+        return .noContent
+    }
+
+    // MARK: - A VM's keys
+
+    /// GET /api/vms/:vmID/secure-boot/keys
+    func showVMKeys(req: Request) async throws -> VMSecureBootKeysResponse {
+        let vm = try await req.authorizedVM(try vmID(req), permission: "read")
+        return try Self.keysResponse(for: vm)
+    }
+
+    /// PUT /api/vms/:vmID/secure-boot/keys — replaces the VM's db and/or
+    /// dbx. A `409` unless the VM is stopped: the running guest's variable
+    /// store is QEMU's, and the agent re-enrolls it only before a boot.
+    func updateVMKeys(req: Request) async throws -> VMSecureBootKeysResponse {
+        let vm = try await req.authorizedVM(try vmID(req), permission: "update")
+        guard let keys = vm.secureBootKeys else {
+            throw Abort(.conflict, reason: "This VM boots with the firmware's own Secure Boot keys")
+        }
+        guard vm.status == .created || vm.status == .shutdown || vm.status == .error else {
+            throw Abort(
+                .conflict,
+                reason: "A VM's Secure Boot keys can only change while it is stopped (this one is "
+                    + "\(vm.status.rawValue))")
+        }
+
+        let request = try req.content.decode(UpdateVMSecureBootKeysRequest.self)
+        let updated = keys.replacingDatabases(
+            db: request.signatureDatabase ?? keys.signatureDatabase,
+            dbx: request.forbiddenSignatures ?? keys.forbiddenSignatures)
+        try validate(updated)
+        guard updated != keys else { return try Self.keysResponse(for: vm) }
+
+        vm.secureBootKeys = updated
+        // The stopped VM still has a desired-state entry the agent syncs on;
+        // bump so the new keys aren't dropped as stale.
+        vm.bumpGeneration()
+        try await vm.save(on: req.db)
+
+        req.logger.info(
+            "Updated VM Secure Boot keys",
+            metadata: [
+                "vm_id": .string(vm.id?.uuidString ?? ""),
+                "db": .stringConvertible(updated.signatureDatabase.count),
+                "dbx": .stringConvertible(updated.forbiddenSignatures.count),
+            ])
+        return try Self.keysResponse(for: vm)
+    }
+
+    static func keysResponse(for vm: VM) throws -> VMSecureBootKeysResponse {
+        guard let keys = vm.secureBootKeys else {
+            throw Abort(.notFound, reason: "This VM boots with the firmware's own Secure Boot keys")
+        }
+        return VMSecureBootKeysResponse(
+            vmId: try vm.requireID(),
+            keySetId: vm.$secureBootKeySet.id,
+            ownerGuid: keys.ownerGUID,
+            includeMicrosoftKeys: keys.includeMicrosoftKeys,
+            signatureDatabase: keys.signatureDatabase,
+            forbiddenSignatures: keys.forbiddenSignatures,
+            signatureDatabaseSummary: keys.signatureDatabase.map(SecureBootKeySet.summary(of:)),
+            forbiddenSignaturesSummary: keys.forbiddenSignatures.map(SecureBootKeySet.summary(of:)))
+    }
+
+    // MARK: - Helpers
+
+    private func requireOrganizationID(_ req: Request) throws -> UUID {
+        guard let raw = req.parameters.get("organizationID"), let id = UUID(uuidString: raw) else {
+            throw Abort(.badRequest, reason: "Invalid organization ID")
+        }
+        return id
+    }
+
+    private func vmID(_ req: Request) throws -> UUID {
+        guard let id = req.parameters.get("vmID", as: UUID.self) else {
+            throw Abort(.badRequest, reason: "Invalid VM ID")
+        }
+        return id
+    }
+
+    private func requireKeySet(_ req: Request) async throws -> SecureBootKeySet {
+        let organizationID = try requireOrganizationID(req)
+        guard let raw = req.parameters.get("keySetID"), let id = UUID(uuidString: raw) else {
+            throw Abort(.badRequest, reason: "Invalid key set ID")
+        }
+        guard
+            let keySet = try await SecureBootKeySet.query(on: req.db)
+                .filter(\.$id == id)
+                .filter(\.$organization.$id == organizationID)
+                .first()
+        else {
+            throw Abort(.notFound, reason: "Secure Boot key set not found")
+        }
+        return keySet
+    }
+
+    /// Org admins manage every set; a project's admins manage the sets
+    /// narrowed to it.
+    private func requireManage(organizationID: UUID, projectID: UUID?, on req: Request) async throws {
+        guard let projectID else {
+            try await OrganizationAccessService.requireAdmin(organizationID: organizationID, on: req)
+            return
+        }
+        guard let project = try await Project.find(projectID, on: req.db),
+            try await project.getRootOrganizationId(on: req.db) == organizationID
+        else {
+            throw Abort(.badRequest, reason: "Project does not belong to this organization")
+        }
+        try await OrganizationAccessService.requireProjectAdmin(project: project, on: req)
+    }
+
+    private func requireUniqueName(
+        _ name: String, organizationID: UUID, excluding id: UUID?, on db: Database
+    ) async throws {
+        let existing = try await SecureBootKeySet.query(on: db)
+            .filter(\.$organization.$id == organizationID)
+            .filter(\.$name == name)
+            .first()
+        if let existing, existing.id != id {
+            throw Abort(.conflict, reason: "A key set named '\(name)' already exists in this organization")
+        }
+    }
+
+    private func validate(_ keys: SecureBootKeys) throws {
+        if let error = SecureBootKeySet.validationError(for: keys) {
+            throw Abort(.badRequest, reason: error)
+        }
+    }
+}
@@ -0,0 +1,203 @@
+import Fluent
+import Vapor
+
+/// Sharing of live console and exec sessions: the owner — the user who
+/// opened the session — invites other users as read-only or read-write
+/// participants, who then attach through the join WebSockets
+/// (`ConsoleWebSocketController`, `SandboxExecWebSocketController`).
+///
+/// - `GET    /api/vms/:vmID/console/sessions`
+/// - `GET    /api/vms/:vmID/console/sessions/:sessionID/participants`
+/// - `POST   /api/vms/:vmID/console/sessions/:sessionID/participants`
+/// - `DELETE /api/vms/:vmID/console/sessions/:sessionID/participants/:userID`
+/// - `GET    /api/sandboxes/:sandboxID/exec/sessions`
+/// - `GET    /api/sandboxes/:sandboxID/exec/:sessionID/participants`
+/// - `POST   /api/sandboxes/:sandboxID/exec/:sessionID/participants`
+/// - `DELETE /api/sandboxes/:sandboxID/exec/:sessionID/participants/:userID`
+///
+/// Listing needs `read` on the VM or sandbox and shows only sessions the
+/// caller owns or was invited to. Managing participants needs the permission
+/// that opens the session (`view_console` / `exec`) and is the owner's alone.
+/// An invitee must hold that same permission — checked at the invitation and
+/// again when they join — so sharing never grants access a user lacks.
+///
+/// Sessions live in the replica that holds the agent's socket, like the
+/// sessions themselves; on another replica they read as not found.
+struct SharedSessionController: RouteCollection {
+    func boot(routes: any RoutesBuilder) throws {
+        let console = routes.grouped("api", "vms", ":vmID", "console", "sessions")
+        console.get(use: listConsoleSessions)
+        let consoleParticipants = console.grouped(":sessionID", "participants")
+        consoleParticipants.get(use: listConsoleParticipants)
+        consoleParticipants.post(use: inviteConsoleParticipant)
+        consoleParticipants.delete(":userID", use: revokeConsoleParticipant)
+
+        let exec = routes.grouped("api", "sandboxes", ":sandboxID", "exec")
+        exec.get("sessions", use: listExecSessions)
+        let execParticipants = exec.grouped(":sessionID", "participants")
+        execParticipants.get(use: listExecParticipants)
+        execParticipants.post(use: inviteExecParticipant)
+        execParticipants.delete(":userID", use: revokeExecParticipant)
+    }
+
+    // MARK: - Console
+
+    /// GET /api/vms/:vmID/console/sessions
+    func listConsoleSessions(req: Request) async throws -> [SharedSessionResponse] {
+        let vm = try await req.authorizedVM(try uuid(req, "vmID"), permission: "read")
+        return req.consoleSessionManager.sharedSessions(vmId: try vm.requireID().uuidString, for: try userID(req))
+    }
+
+    /// GET /api/vms/:vmID/console/sessions/:sessionID/participants
+    func listConsoleParticipants(req: Request) async throws -> [SessionParticipantResponse] {
+        let vm = try await req.authorizedVM(try uuid(req, "vmID"), permission: "view_console")
+        let sessionId = try consoleSession(req, on: vm)
+        return try Self.mapping {
+            try req.consoleSessionManager.participants(sessionId: sessionId, ownerId: try userID(req))
+        }
+    }
+
+    /// POST /api/vms/:vmID/console/sessions/:sessionID/participants — invites
+    /// a user, or changes an invited user's access (live, if attached).
+    func inviteConsoleParticipant(req: Request) async throws -> SessionParticipantResponse {
+        let vm = try await req.authorizedVM(try uuid(req, "vmID"), permission: "view_console")
+        let sessionId = try consoleSession(req, on: vm)
+        let (invitee, organizationID) = try await validatedInvitee(
+            req, action: "vm:viewConsole", node: IAMNode(type: .virtualMachine, id: try vm.requireID()),
+            project: try await vm.$project.get(on: req.db))
+        return try Self.mapping {
+            try req.consoleSessionManager.invite(
+                sessionId: sessionId, ownerId: try userID(req), userId: try invitee.user.requireID(),
+                username: invitee.user.username, access: invitee.access, organizationID: organizationID)
+        }
+    }
+
+    /// DELETE /api/vms/:vmID/console/sessions/:sessionID/participants/:userID
+    /// — withdraws the invitation and disconnects the user at once.
+    func revokeConsoleParticipant(req: Request) async throws -> HTTPStatus {
+        let vm = try await req.authorizedVM(try uuid(req, "vmID"), permission: "view_console")
+        let sessionId = try consoleSession(req, on: vm)
+        try Self.mapping {
+            try req.consoleSessionManager.revoke(
+                sessionId: sessionId, ownerId: try userID(req), userId: try uuid(req, "userID"))
+        }
+        return .noContent
+    }
+
+    /// The session named in the path, which must be one of this VM's.
+    private func consoleSession(_ req: Request, on vm: VM) throws -> String {
+        guard let sessionId = req.parameters.get("sessionID"),
+            let session = req.consoleSessionManager.getSession(sessionId: sessionId),
+            try session.vmId == vm.requireID().uuidString
+        else {
+            throw Abort(.notFound, reason: "Console session not found")
+        }
+        return sessionId
+    }
+
+    // MARK: - Exec
+
+    /// GET /api/sandboxes/:sandboxID/exec/sessions
+    func listExecSessions(req: Request) async throws -> [SharedSessionResponse] {
+        let sandbox = try await req.authorizedSandbox(try uuid(req, "sandboxID"), permission: "read")
+        return req.sandboxExecSessionManager.sharedSessions(
+            sandboxId: try sandbox.requireID().uuidString, for: try userID(req))
+    }
+
+    /// GET /api/sandboxes/:sandboxID/exec/:sessionID/participants
+    func listExecParticipants(req: Request) async throws -> [SessionParticipantResponse] {
+        let sandbox = try await req.authorizedSandbox(try uuid(req, "sandboxID"), permission: "exec")
+        let sessionId = try execSession(req, on: sandbox)
+        return try Self.mapping {
+            try req.sandboxExecSessionManager.participants(sessionId: sessionId, ownerId: try userID(req))
+        }
+    }
+
+    /// POST /api/sandboxes/:sandboxID/exec/:sessionID/participants
+    func inviteExecParticipant(req: Request) async throws -> SessionParticipantResponse {
+        let sandbox = try await req.authorizedSandbox(try uuid(req, "sandboxID"), permission: "exec")
+        let sessionId = try execSession(req, on: sandbox)
+        let (invitee, organizationID) = try await validatedInvitee(
+            req, action: "sandbox:exec", node: IAMNode(type: .sandbox, id: try sandbox.requireID()),
+            project: try await sandbox.$project.get(on: req.db))
+        return try Self.mapping {
+            try req.sandboxExecSessionManager.invite(
+                sessionId: sessionId, ownerId: try userID(req), userId: try invitee.user.requireID(),
+                username: invitee.user.username, access: invitee.access, organizationID: organizationID)
+        }
+    }
+
+    /// DELETE /api/sandboxes/:sandboxID/exec/:sessionID/participants/:userID
+    func revokeExecParticipant(req: Request) async throws -> HTTPStatus {
+        let sandbox = try await req.authorizedSandbox(try uuid(req, "sandboxID"), permission: "exec")
+        let sessionId = try execSession(req, on: sandbox)
+        try Self.mapping {
+            try req.sandboxExecSessionManager.revoke(
+                sessionId: sessionId, ownerId: try userID(req), userId: try uuid(req, "userID"))
+        }
+        return .noContent
+    }
+
+    /// The attached session named in the path, which must be one of this
+    /// sandbox's.
+    private func execSession(_ req: Request, on sandbox: Sandbox) throws -> String {
+        guard let sessionId = req.parameters.get("sessionID"),
+            let session = req.sandboxExecSessionManager.getSession(sessionId: sessionId),
+            try session.sandboxId == sandbox.requireID().uuidString
+        else {
+            throw Abort(.notFound, reason: "Exec session not found")
+        }
+        return sessionId
+    }
+
+    // MARK: - Helpers
+
+    /// Decode an invitation and check the invitee could open the session
+    /// themselves. Returns the invitee and the organization the session's
+    /// audit records belong to.
+    private func validatedInvitee(
+        _ req: Request, action: String, node: IAMNode, project: Project
+    ) async throws -> (invitee: (user: User, access: SessionAccess), organizationID: UUID?) {
+        let body = try req.content.decode(InviteSessionParticipantRequest.self)
+        guard try body.userId != userID(req) else {
+            throw Abort(.badRequest, reason: "The session's owner is already in it")
+        }
+        guard let user = try await User.find(body.userId, on: req.db) else {
+            throw Abort(.notFound, reason: "User not found")
+        }
+        let permitted = try await WhoCanService.can(
+            principalType: .user, principalID: body.userId, action: action, node: node,
+            app: req.application, on: req.db)
+        guard permitted else {
+            throw Abort(.forbidden, reason: "\(user.username) is not allowed to open this session themselves")
+        }
+        return ((user, body.access), try await project.getRootOrganizationId(on: req.db))
+    }
+
+    private func userID(_ req: Request) throws -> UUID {
+        guard let id = req.auth.get(User.self)?.id else {
+            throw Abort(.unauthorized)
+        }
+        return id
+    }
+
+    private func uuid(_ req: Request, _ name: String) throws -> UUID {
+        guard let value = req.parameters.get(name).flatMap(UUID.init(uuidString:)) else {
+            throw Abort(.badRequest, reason: "Invalid \(name)")
+        }
+        return value
+    }
+
+    /// Session-manager errors as HTTP statuses.
+    private static func mapping<T>(_ body: () throws -> T) throws -> T {
+        do {
+            return try body()
+        } catch ConsoleSessionError.notSessionOwner, SandboxExecSessionError.notSessionOwner {
+            throw Abort(.forbidden, reason: "Only the session's owner can manage its participants")
+        } catch ConsoleSessionError.sessionNotFound, SandboxExecSessionError.sessionNotFound {
+            throw Abort(.notFound, reason: "Session not found")
+        } catch ConsoleSessionError.notInvited, SandboxExecSessionError.notInvited {
+            throw Abort(.notFound, reason: "That user is not invited to the session")
+        }
+    }
+}
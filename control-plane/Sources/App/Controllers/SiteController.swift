@@ -144,6 +144,20 @@ struct SiteController: RouteCollection {
         }
     }
 
+    /// The canonical form of a site's default CPU model (so `host` is stored
+    /// as `host-passthrough`); nil for an omitted or blank one. Whether any
+    /// agent can run a named model is the scheduler's question, asked per
+    /// VM, so a site may default to a baseline before its hosts arrive.
+    static func normalizedCPUModel(_ value: String?) throws -> String? {
+        guard let value = normalized(value) else { return nil }
+        guard let model = GuestCPUModel(rawValue: value) else {
+            throw Abort(
+                .badRequest,
+                reason: "defaultCpuModel must be host-passthrough, host-model or a QEMU CPU model name")
+        }
+        return model.rawValue
+    }
+
     private func findSite(_ req: Request) async throws -> Site {
         guard let siteId = req.parameters.get("siteId", as: UUID.self) else {
             throw Abort(.badRequest, reason: "Invalid site ID")
@@ -222,6 +236,7 @@ struct SiteController: RouteCollection {
         try Self.validateMetadata(
             latitude: create.latitude, longitude: create.longitude,
             locationLabel: create.locationLabel, regionCode: create.regionCode, labels: labels)
+        let defaultCPUModel = try Self.normalizedCPUModel(create.defaultCpuModel)
 
         let site = Site(
             name: name,
@@ -232,6 +247,7 @@ struct SiteController: RouteCollection {
             locationLabel: Self.normalized(create.locationLabel),
             regionCode: Self.normalized(create.regionCode),
             labels: labels ?? [:],
+            defaultCPUModel: defaultCPUModel,
             organizationScope: scope)
         do {
             try await site.save(on: req.db)
@@ -300,6 +316,7 @@ struct SiteController: RouteCollection {
         try Self.validateMetadata(
             latitude: update.latitude, longitude: update.longitude,
             locationLabel: update.locationLabel, regionCode: update.regionCode, labels: labels)
+        let defaultCPUModel = try Self.normalizedCPUModel(update.defaultCpuModel)
 
         site.description = update.description
         site.$networkControllerAgent.id = update.networkControllerAgentId
@@ -312,6 +329,7 @@ struct SiteController: RouteCollection {
         site.locationLabel = Self.normalized(update.locationLabel)
         site.regionCode = Self.normalized(update.regionCode)
         site.labels = labels ?? [:]
+        site.defaultCPUModel = defaultCPUModel
         try await site.save(on: req.db)
 
         // Topology authority may have moved: the old controller must stop
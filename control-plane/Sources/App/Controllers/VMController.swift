@@ -16,7 +16,7 @@ struct VMController: RouteCollection {
         #endif
     }
 
-    private static func socketPath(for vmID: UUID, filename: String) -> String {
+    static func socketPath(for vmID: UUID, filename: String) -> String {
         let base = defaultVMStoragePath()
         let vmDir = (base as NSString).appendingPathComponent(vmID.uuidString)
         return (vmDir as NSString).appendingPathComponent(filename)
@@ -211,13 +211,34 @@ struct VMController: RouteCollection {
             // behavior — and both are what Windows 11 / Server 2025 require.
             let secureBoot: Bool?
             let tpm: Bool?
+            // Guest CPU model: host-passthrough, host-model or a named QEMU
+            // baseline. Omitted takes the site's default at placement.
+            let cpuModel: String?
+            // Custom Secure Boot keys: a key set of the project's
+            // organization, copied into the VM. Requires secureBoot.
+            let secureBootKeySetId: UUID?
             // Security groups for the VM's NIC. Omitted (or empty) means the
             // project's default group — every NIC must belong to at least one
             // group.
             let securityGroupIds: [UUID]?
+            // Every NIC spelled out, in guest order. Replaces networkId,
+            // networkName and securityGroupIds, which describe a single NIC.
+            let nics: [CreateVMNICRequest]?
+            // Existing detached volumes to attach as data disks at first
+            // boot, in order. Placement co-locates the VM with their data
+            // (the volume's pool and, for local pools, its replica's agent).
+            let volumeIds: [UUID]?
         }
 
-        let createRequest = try req.content.decode(CreateVMRequest.self)
+        // Admission webhooks see (and may patch) the body before anything
+        // below validates it, but only once the caller may create VMs in the
+        // project it names.
+        let decoded = try req.content.decode(CreateVMRequest.self)
+        let target = try await req.authorizeCreateProject(
+            requestedProjectId: decoded.projectId, user: user, resourceKind: "VMs")
+        let createRequest = try await req.admitCreate(
+            decoded, resourceKind: .virtualMachine, resourceName: decoded.name, projectID: try target.requireID(),
+            user: user)
 
         // An image is required to create a VM.
         guard let imageId = createRequest.imageId else {
@@ -256,66 +277,73 @@ struct VMController: RouteCollection {
         )
         let projectId = try project.requireID()
 
-        // Resolve which logical network the VM's NIC attaches to. Omitting both
-        // fields keeps the historical default-network behavior (including the
-        // degrade-to-addressless-NIC fallback when the row is missing); an
-        // explicit selection is a hard requirement that never degrades.
-        if createRequest.networkId != nil && createRequest.networkName != nil {
-            throw Abort(.badRequest, reason: "Specify either 'networkId' or 'networkName', not both")
-        }
-
-        let resolvedNetworkName: String
-        let networkExplicitlyRequested: Bool
-        if createRequest.networkId != nil || createRequest.networkName != nil {
-            let network: LogicalNetwork?
-            if let networkId = createRequest.networkId {
-                network = try await LogicalNetwork.find(networkId, on: req.db)
-            } else {
-                network = try await LogicalNetwork.query(on: req.db)
-                    .filter(\.$name == createRequest.networkName!)
-                    .first()
+        // Resolve the VM's NICs. The single-NIC fields describe net0; `nics`
+        // describes every NIC and can't be mixed with them.
+        let nicRequests: [CreateVMNICRequest]
+        if let nics = createRequest.nics {
+            guard createRequest.networkId == nil, createRequest.networkName == nil,
+                createRequest.securityGroupIds == nil
+            else {
+                throw Abort(
+                    .badRequest,
+                    reason: "'nics' replaces 'networkId', 'networkName' and 'securityGroupIds'; use one or the other")
             }
-            guard let network else {
-                throw Abort(.badRequest, reason: "Network not found")
+            guard !nics.isEmpty else {
+                throw Abort(.badRequest, reason: "'nics' must list at least one interface")
             }
-
-            // The caller already proved membership in this VM's project above, so
-            // no extra permission check is needed: a global network (nil project) is
-            // usable by anyone, and a project-scoped network is usable only by the
-            // project it belongs to.
-            if let networkProjectId = network.$project.id, networkProjectId != projectId {
-                throw Abort(.forbidden, reason: "Network belongs to a different project")
+            guard nics.count <= VMNetworkInterface.maxPerVM else {
+                throw Abort(.badRequest, reason: "At most \(VMNetworkInterface.maxPerVM) network interfaces per VM")
             }
-
-            resolvedNetworkName = network.name
-            networkExplicitlyRequested = true
+            nicRequests = nics
         } else {
-            resolvedNetworkName = LogicalNetwork.defaultNetworkName
-            networkExplicitlyRequested = false
+            nicRequests = [
+                CreateVMNICRequest(
+                    networkId: createRequest.networkId, networkName: createRequest.networkName,
+                    securityGroupIds: createRequest.securityGroupIds)
+            ]
+        }
+        var nicPlans: [NICPlan] = []
+        for (index, nic) in nicRequests.enumerated() {
+            nicPlans.append(
+                try await Self.resolveNIC(
+                    nic, index: index, projectId: projectId, planned: nicPlans, on: req.db))
+        }
+        if Set(nicPlans.compactMap { $0.network?.$site.id }).count > 1 {
+            throw Abort(.badRequest, reason: "The VM's networks are pinned to different sites; no host is in both")
         }
 
-        // Resolve the NIC's security groups. Explicit ids must exist, belong
-        // to this project, and fit the per-NIC cap; omitted (or empty) means
-        // the project's default group, ensured inside the create transaction.
-        // No agent-version gate here: VM create must work on a pre-security-
-        // group fleet, where assembly simply omits the fields (documented
-        // mixed-fleet rollout semantics).
-        let requestedSecurityGroupIds: [UUID] = (createRequest.securityGroupIds ?? [])
-            .reduce(into: []) { unique, groupId in
-                if !unique.contains(groupId) { unique.append(groupId) }
+        // Resolve the volumes to attach at boot. Each must be a detached (or
+        // multi-attach) volume in this project the caller may attach; the attachment itself
+        // is written in the create transaction, and placement then picks an
+        // agent that can reach every one of them.
+        var bootVolumes: [Volume] = []
+        for volumeId in createRequest.volumeIds ?? [] where !bootVolumes.contains(where: { $0.id == volumeId }) {
+            guard let volume = try await Volume.find(volumeId, on: req.db) else {
+                throw Abort(.badRequest, reason: "Volume \(volumeId) does not exist")
             }
-        if requestedSecurityGroupIds.count > SecurityGroup.maxGroupsPerNIC {
-            throw Abort(
-                .badRequest,
-                reason: "At most \(SecurityGroup.maxGroupsPerNIC) security groups per interface")
-        }
-        for groupId in requestedSecurityGroupIds {
-            guard let group = try await SecurityGroup.find(groupId, on: req.db) else {
-                throw Abort(.badRequest, reason: "Security group \(groupId) does not exist")
+            guard volume.$project.id == projectId else {
+                throw Abort(.badRequest, reason: "Volume \(volumeId) belongs to a different project")
             }
-            guard group.$project.id == projectId else {
-                throw Abort(.badRequest, reason: "Security group \(groupId) belongs to a different project")
+            guard try await req.can("attach", on: "volume", id: volumeId.uuidString) else {
+                throw Abort(.forbidden, reason: "You don't have 'attach' permission on volume \(volumeId)")
             }
+            guard volume.canAttach else {
+                throw Abort(
+                    .conflict,
+                    reason:
+                        "Volume \(volumeId) cannot be attached in status '\(volume.status.rawValue)'. Must be 'available'"
+                )
+            }
+            // Boot-time attachments are writable, and only raw images take
+            // several writers.
+            if volume.multiAttach, volume.format != .raw {
+                throw Abort(
+                    .badRequest,
+                    reason:
+                        "Volume \(volumeId) is a multi-attach qcow2 volume; only raw volumes can be shared writable. Attach it read-only after create."
+                )
+            }
+            bootVolumes.append(volume)
         }
 
         // Create the VM instance from the image.
@@ -438,6 +466,48 @@ struct VMController: RouteCollection {
                 reason: "'secureBoot' and 'tpm' are not supported for firecracker VMs "
                     + "(no UEFI firmware or TPM device); use the qemu hypervisor")
         }
+        // Minted with the VM and never changed: TPM state the agent encrypts
+        // with it is unreadable without it. Only ever stored wrapped, so
+        // without a secrets key the VM gets none and its state stays
+        // unencrypted (`SecretsEncryptionService.mintTPMStateKeys`).
+        if vm.tpmEnabled, req.secretsEncryption.isEnabled {
+            vm.tpmStateKey = try req.secretsEncryption.encrypt(VM.generateTPMStateKey())
+        }
+
+        // Stored canonical, so `host` reads back as `host-passthrough`.
+        // Firecracker exposes the host CPU (minus a fixed template) and has
+        // no model to choose.
+        if let requested = createRequest.cpuModel?.trimmingCharacters(in: .whitespacesAndNewlines),
+            !requested.isEmpty
+        {
+            guard let model = GuestCPUModel(rawValue: requested) else {
+                throw Abort(
+                    .badRequest,
+                    reason: "'cpuModel' must be host-passthrough, host-model or a QEMU CPU model name")
+            }
+            guard vm.hypervisorType == .qemu else {
+                throw Abort(.badRequest, reason: "'cpuModel' is only supported for qemu VMs")
+            }
+            vm.cpuModel = model.rawValue
+        }
+
+        // The VM copies the set's keys, so editing or deleting the set later
+        // never changes what this guest trusts. A set narrowed to another
+        // project reads as absent, like any resource the caller can't see.
+        if let keySetId = createRequest.secureBootKeySetId {
+            guard vm.secureBoot else {
+                throw Abort(.badRequest, reason: "'secureBootKeySetId' requires 'secureBoot'")
+            }
+            let organizationId = try await project.getRootOrganizationId(on: req.db)
+            guard let keySet = try await SecureBootKeySet.find(keySetId, on: req.db),
+                keySet.$organization.id == organizationId,
+                keySet.$project.id == nil || keySet.$project.id == projectId
+            else {
+                throw Abort(.notFound, reason: "Secure Boot key set not found")
+            }
+            vm.$secureBootKeySet.id = keySet.id
+            vm.secureBootKeys = keySet.keys
+        }
 
         if vm.userData != nil, vm.hypervisorType == .firecracker {
             throw Abort(
@@ -445,6 +515,14 @@ struct VMController: RouteCollection {
                 reason: "'userData' is not supported for firecracker VMs (cloud-init runs only on QEMU disk boot)")
         }
 
+        if !bootVolumes.isEmpty, vm.hypervisorType == .firecracker {
+            throw Abort(
+                .badRequest,
+                reason:
+                    "Volume operations are not supported for Firecracker VMs. Firecracker only supports a single root disk."
+            )
+        }
+
         let userID = try user.requireID()
 
         // Reserve quota and persist the VM and its pending create operation in one
@@ -502,77 +580,32 @@ struct VMController: RouteCollection {
                     // Update VM with generated paths
                     try await vm.update(on: db)
 
-                    // Every VM starts with one NIC on the resolved network (the default
-                    // network unless the caller picked one). The control plane owns IPAM
-                    // (issue #212): allocate the NIC's address from the logical network
-                    // here so agents receive it in the spec instead of inventing one.
-                    // For the implicit default, a missing network row (pre-migration
-                    // data) degrades to an address-less NIC, matching the old behavior;
-                    // an explicitly requested network must exist, so its absence fails.
-                    let networkName = resolvedNetworkName
-                    var allocation: IPAMService.Allocation?
-                    var allocation6: IPAMService.Allocation6?
-                    var networkGateway: String?
-                    var networkGateway6: String?
-                    if let logicalNetwork = try await LogicalNetwork.query(on: db)
-                        .filter(\.$name == networkName)
-                        .first()
-                    {
-                        allocation = try await IPAMService.allocateIP(for: logicalNetwork, on: db)
-                        networkGateway = logicalNetwork.gateway
-                        // Dual-stack network: the NIC gets one address per family.
-                        allocation6 = try await IPAMService.allocateIPv6(for: logicalNetwork, on: db)
-                        networkGateway6 = logicalNetwork.gateway6
-                    } else if networkExplicitlyRequested {
-                        throw Abort(.badRequest, reason: "Network '\(networkName)' no longer exists")
+                    for (index, plan) in nicPlans.enumerated() {
+                        try await Self.createInterface(
+                            plan, vmID: vmID, index: index, projectId: projectId, on: db)
                     }
 
-                    let networkInterface = VMNetworkInterface(
-                        vmID: vmID,
-                        network: networkName,
-                        macAddress: VMNetworkInterface.generateMACAddress()
-                    )
-                    try await networkInterface.save(on: db)
-
-                    // The ≥1-group invariant: the NIC joins the requested
-                    // security groups, or the project's default group when the
-                    // caller picked none.
-                    let groupIds: [UUID]
-                    if requestedSecurityGroupIds.isEmpty {
-                        let defaultGroup = try await SecurityGroupService.ensureDefaultGroup(
-                            projectID: projectId, on: db)
-                        groupIds = [try defaultGroup.requireID()]
-                    } else {
-                        groupIds = requestedSecurityGroupIds
-                    }
-                    for groupId in groupIds {
-                        try await VMInterfaceSecurityGroup(
-                            interfaceID: try networkInterface.requireID(),
-                            securityGroupID: groupId
+                    // Boot volumes join the VM's spec as attached disks. The
+                    // status re-check under the transaction catches a volume
+                    // attached elsewhere since validation; the agent is
+                    // filled in once placement picks it. A multi-attach volume
+                    // other VMs already hold keeps its primary holder.
+                    var deviceNames: [String?] = []
+                    for volume in bootVolumes {
+                        guard let current = try await Volume.find(volume.requireID(), on: db), current.canAttach
+                        else {
+                            throw Abort(.conflict, reason: "Volume \(volume.id!) is no longer available")
+                        }
+                        let deviceName = VolumeNaming.nextDeviceName(existingDeviceNames: deviceNames)
+                        deviceNames.append(deviceName)
+                        try await VolumeAttachment(
+                            volumeID: try current.requireID(),
+                            vmID: vmID,
+                            agentId: nil,
+                            deviceName: deviceName,
+                            status: .attached
                         ).save(on: db)
-                    }
-
-                    if let allocation {
-                        let address = VMInterfaceAddress(
-                            interfaceID: try networkInterface.requireID(),
-                            network: networkName,
-                            family: .ipv4,
-                            address: allocation.ipAddress,
-                            prefixLength: allocation.prefixLength,
-                            gateway: networkGateway
-                        )
-                        try await address.save(on: db)
-                    }
-                    if let allocation6 {
-                        let address6 = VMInterfaceAddress(
-                            interfaceID: try networkInterface.requireID(),
-                            network: networkName,
-                            family: .ipv6,
-                            address: allocation6.ipAddress,
-                            prefixLength: allocation6.prefixLength,
-                            gateway: networkGateway6
-                        )
-                        try await address6.save(on: db)
+                        try await VolumeAttachment.syncVolume(current, on: db)
                     }
 
                     // The pending create operation is the client's handle on the
@@ -597,8 +630,11 @@ struct VMController: RouteCollection {
                 }
             }
         } catch let error as IPAMService.IPAMError {
-            // The chosen network's subnet is full; the whole transaction rolled
-            // back, so no VM was created.
+            // The chosen network's subnet is full, or a fixed address is
+            // taken; the whole transaction rolled back, so no VM was created.
+            if case .invalidAddress = error {
+                throw Abort(.badRequest, reason: error.errorDescription ?? "Invalid fixed address")
+            }
             throw Abort(.conflict, reason: error.errorDescription ?? "No free IP addresses in the selected network")
         }
 
@@ -625,6 +661,61 @@ struct VMController: RouteCollection {
         return try operation.acceptedResponse()
     }
 
+    // Decodable rather than Content: `balloonTarget` needs to tell an
+    // absent key from an explicit null, which needs a hand-written decode,
+    // and Content's Encodable half has nothing to encode here.
+    struct UpdateVMRequest: Decodable {
+        let name: String?
+        let description: String?
+        /// Target boot vCPU count (issue #568).
+        let cpu: Int?
+        /// Target memory in bytes (issue #568).
+        let memory: Int64?
+        /// Operator balloon target in bytes (issue #567 phase 2), doubly
+        /// optional so the two ways of "not a number" stay distinct:
+        /// `.none` (key absent) leaves the current target alone, while
+        /// `.some(nil)` (explicit null) clears it and hands the guest its
+        /// whole grant back.
+        let balloonTarget: Int64??
+        /// Pressure-reclaim floor in bytes, doubly optional like
+        /// `balloonTarget`: explicit null returns the VM to the agent
+        /// policy's default floor.
+        let memoryFloor: Int64??
+        /// Replaces the VM's tags wholesale; an empty object clears them.
+        let tags: [String: String]?
+
+        enum CodingKeys: String, CodingKey {
+            case name, description, cpu, memory, balloonTarget, memoryFloor, tags
+        }
+
+        /// A sizing-only request, for callers that resize on the user's
+        /// behalf (rightsizing's apply) rather than decoding a body.
+        init(cpu: Int?, memory: Int64?) {
+            self.name = nil
+            self.description = nil
+            self.cpu = cpu
+            self.memory = memory
+            self.balloonTarget = .none
+            self.memoryFloor = .none
+            self.tags = nil
+        }
+
+        init(from decoder: any Decoder) throws {
+            let c = try decoder.container(keyedBy: CodingKeys.self)
+            name = try c.decodeIfPresent(String.self, forKey: .name)
+            description = try c.decodeIfPresent(String.self, forKey: .description)
+            cpu = try c.decodeIfPresent(Int.self, forKey: .cpu)
+            memory = try c.decodeIfPresent(Int64.self, forKey: .memory)
+            balloonTarget =
+                c.contains(.balloonTarget)
+                ? .some(try c.decodeIfPresent(Int64.self, forKey: .balloonTarget)) : .none
+            memoryFloor =
+                c.contains(.memoryFloor)
+                ? .some(try c.decodeIfPresent(Int64.self, forKey: .memoryFloor)) : .none
+            tags = try c.decodeIfPresent([String: String].self, forKey: .tags)
+        }
+    }
+
     /// Updates a VM's metadata and, since issue #568, its vCPU/memory sizing.
     ///
     /// Sizing changes take one of two routes:
@@ -644,41 +735,17 @@ struct VMController: RouteCollection {
         let user = try req.auth.require(User.self)
         let existingVM = try await fetchVMWithPermission(req: req, user: user, permission: "update")
 
-        // Decodable rather than Content: `balloonTarget` needs to tell an
-        // absent key from an explicit null, which needs a hand-written decode,
-        // and Content's Encodable half has nothing to encode here.
-        struct UpdateVMRequest: Decodable {
-            let name: String?
-            let description: String?
-            /// Target boot vCPU count (issue #568).
-            let cpu: Int?
-            /// Target memory in bytes (issue #568).
-            let memory: Int64?
-            /// Operator balloon target in bytes (issue #567 phase 2), doubly
-            /// optional so the two ways of "not a number" stay distinct:
-            /// `.none` (key absent) leaves the current target alone, while
-            /// `.some(nil)` (explicit null) clears it and hands the guest its
-            /// whole grant back.
-            let balloonTarget: Int64??
-
-            enum CodingKeys: String, CodingKey {
-                case name, description, cpu, memory, balloonTarget
-            }
-
-            init(from decoder: any Decoder) throws {
-                let c = try decoder.container(keyedBy: CodingKeys.self)
-                name = try c.decodeIfPresent(String.self, forKey: .name)
-                description = try c.decodeIfPresent(String.self, forKey: .description)
-                cpu = try c.decodeIfPresent(Int.self, forKey: .cpu)
-                memory = try c.decodeIfPresent(Int64.self, forKey: .memory)
-                balloonTarget =
-                    c.contains(.balloonTarget)
-                    ? .some(try c.decodeIfPresent(Int64.self, forKey: .balloonTarget)) : .none
-            }
-        }
-
         let updateRequest = try req.content.decode(UpdateVMRequest.self)
+        return try await applyUpdate(updateRequest, to: existingVM, user: user, req: req)
+    }
 
+    /// The body of `update` once the request is decoded and `update`
+    /// permission checked. Shared with rightsizing's apply, so a recommended
+    /// size goes through exactly the validation, quota reservation and
+    /// operation path an operator's own resize does.
+    func applyUpdate(
+        _ updateRequest: UpdateVMRequest, to existingVM: VM, user: User, req: Request
+    ) async throws -> Response {
         if let name = updateRequest.name {
             existingVM.name = name
         }
@@ -687,12 +754,40 @@ struct VMController: RouteCollection {
             existingVM.description = description
         }
 
+        if let tags = updateRequest.tags {
+            try VM.validateTags(tags)
+            existingVM.tags = tags.isEmpty ? nil : tags
+        }
+
         let newCPU = updateRequest.cpu ?? existingVM.cpu
         let newMemory = updateRequest.memory ?? existingVM.memory
         let newBalloonTarget = updateRequest.balloonTarget ?? existingVM.balloonTarget
         let balloonChanged = newBalloonTarget != existingVM.balloonTarget
+
+        // A floor only bounds the agent's own reclaim, so it moves without a
+        // resize: validated, recorded with a generation bump, and pushed. An
+        // agent too old to reclaim ignores it, which loses nothing.
+        let newMemoryFloor = updateRequest.memoryFloor ?? existingVM.memoryFloor
+        let floorChanged = newMemoryFloor != existingVM.memoryFloor
+        if let floor = newMemoryFloor, floorChanged {
+            guard floor <= newMemory else {
+                throw Abort(.badRequest, reason: "'memoryFloor' must not exceed the VM's memory (\(newMemory) bytes)")
+            }
+            guard floor >= Self.minimumBalloonTargetBytes else {
+                throw Abort(
+                    .badRequest, reason: "'memoryFloor' must be at least \(Self.minimumBalloonTargetBytes) bytes")
+            }
+        }
+        if floorChanged {
+            existingVM.memoryFloor = newMemoryFloor
+            existingVM.bumpGeneration()
+        }
+
         guard newCPU != existingVM.cpu || newMemory != existingVM.memory || balloonChanged else {
             try await existingVM.save(on: req.db)
+            if floorChanged, let hypervisorId = existingVM.hypervisorId {
+                await req.application.agentService.syncDesiredState(agentId: hypervisorId)
+            }
             return try await Self.detailResponse(for: existingVM, on: req)
         }
 
@@ -1041,3 +1136,230 @@ struct VMController: RouteCollection {
         return try operation.acceptedResponse()
     }
 }
+
+// MARK: - Network interfaces
+
+extension VMController {
+    /// One NIC of a VM create, resolved and checked before the create
+    /// transaction opens. Addresses are claimed or allocated inside it.
+    struct NICPlan {
+        let networkName: String
+        /// Nil only for the implicit default network when its row is
+        /// missing (pre-migration data); that NIC degrades to address-less.
+        let network: LogicalNetwork?
+        /// An explicit selection is a hard requirement that never degrades.
+        let explicitlyRequested: Bool
+        let ipAddress: String?
+        let ipv6Address: String?
+        let macAddress: String
+        let securityGroupIds: [UUID]
+    }
+
+    /// Resolves a requested NIC's network, fixed addresses, MAC and security
+    /// groups. `planned` holds the VM's earlier NICs, so two NICs can't ask
+    /// for the same address or MAC.
+    static func resolveNIC(
+        _ nic: CreateVMNICRequest, index: Int, projectId: UUID, planned: [NICPlan], on db: Database
+    ) async throws -> NICPlan {
+        if nic.networkId != nil && nic.networkName != nil {
+            throw Abort(.badRequest, reason: "Specify either 'networkId' or 'networkName', not both")
+        }
+
+        let network: LogicalNetwork?
+        let explicitlyRequested = nic.networkId != nil || nic.networkName != nil
+        if explicitlyRequested {
+            if let networkId = nic.networkId {
+                network = try await LogicalNetwork.find(networkId, on: db)
+            } else {
+                network = try await LogicalNetwork.query(on: db)
+                    .filter(\.$name == nic.networkName!)
+                    .first()
+            }
+            guard let network else {
+                throw Abort(.badRequest, reason: "Network not found")
+            }
+            // The caller already proved membership in this VM's project, so
+            // no extra permission check is needed: a global network (nil
+            // project) is usable by anyone, and a project-scoped network is
+            // usable only by the project it belongs to.
+            if let networkProjectId = network.$project.id, networkProjectId != projectId {
+                throw Abort(.forbidden, reason: "Network belongs to a different project")
+            }
+        } else {
+            network = try await LogicalNetwork.query(on: db)
+                .filter(\.$name == LogicalNetwork.defaultNetworkName)
+                .first()
+        }
+        let networkName = network?.name ?? LogicalNetwork.defaultNetworkName
+        let onSameNetwork = planned.filter { $0.networkName == networkName }
+
+        // Fixed addresses: shape and subnet are checked here (400); whether
+        // the address is free is IPAM's call inside the transaction (409).
+        var ipAddress: String?
+        if let requested = nic.ipAddress?.trimmingCharacters(in: .whitespaces) {
+            guard let network else {
+                throw Abort(.badRequest, reason: "NIC \(index) has no network to take 'ipAddress' from")
+            }
+            guard let subnet = network.subnet, let cidr = IPv4CIDR(subnet) else {
+                throw Abort(.badRequest, reason: "NIC \(index) is on an IPv6-only network")
+            }
+            guard let address = IPv4Address(requested), cidr.contains(address) else {
+                throw Abort(
+                    .badRequest,
+                    reason: "NIC \(index) 'ipAddress' must be an IPv4 address in \(subnet)")
+            }
+            guard !onSameNetwork.contains(where: { $0.ipAddress == address.description }) else {
+                throw Abort(.badRequest, reason: "NIC \(index) repeats another NIC's 'ipAddress'")
+            }
+            ipAddress = address.description
+        }
+        var ipv6Address: String?
+        if let requested = nic.ipv6Address?.trimmingCharacters(in: .whitespaces) {
+            guard let network, let subnet6 = network.subnet6, let cidr = IPv6CIDR(subnet6) else {
+                throw Abort(.badRequest, reason: "NIC \(index) is on a network without IPv6")
+            }
+            guard let address = IPv6Address(requested), cidr.contains(address) else {
+                throw Abort(
+                    .badRequest, reason: "NIC \(index) 'ipv6Address' must be an IPv6 address in \(subnet6)")
+            }
+            guard !onSameNetwork.contains(where: { $0.ipv6Address == address.description }) else {
+                throw Abort(.badRequest, reason: "NIC \(index) repeats another NIC's 'ipv6Address'")
+            }
+            ipv6Address = address.description
+        }
+
+        // A duplicate MAC on one switch makes both NICs flap; across
+        // networks it is harmless, as on physical LANs.
+        let macAddress: String
+        if let requested = nic.macAddress {
+            guard let normalized = VMNetworkInterface.normalizedMACAddress(requested) else {
+                throw Abort(
+                    .badRequest, reason: "NIC \(index) 'macAddress' must be a unicast MAC such as 52:54:00:12:34:56")
+            }
+            let inUse =
+                try await VMNetworkInterface.query(on: db)
+                .filter(\.$network == networkName)
+                .filter(\.$macAddress == normalized)
+                .count() > 0
+            guard !inUse, !onSameNetwork.contains(where: { $0.macAddress == normalized }) else {
+                throw Abort(.conflict, reason: "MAC address \(normalized) is already in use on network \(networkName)")
+            }
+            macAddress = normalized
+        } else {
+            macAddress = VMNetworkInterface.generateMACAddress()
+        }
+
+        // Explicit groups must exist, belong to this project, and fit the
+        // per-NIC cap; omitted (or empty) means the project's default group,
+        // ensured inside the create transaction. No agent-version gate here:
+        // VM create must work on a pre-security-group fleet, where assembly
+        // simply omits the fields (documented mixed-fleet rollout semantics).
+        let securityGroupIds: [UUID] = (nic.securityGroupIds ?? [])
+            .reduce(into: []) { unique, groupId in
+                if !unique.contains(groupId) { unique.append(groupId) }
+            }
+        if securityGroupIds.count > SecurityGroup.maxGroupsPerNIC {
+            throw Abort(
+                .badRequest,
+                reason: "At most \(SecurityGroup.maxGroupsPerNIC) security groups per interface")
+        }
+        for groupId in securityGroupIds {
+            guard let group = try await SecurityGroup.find(groupId, on: db) else {
+                throw Abort(.badRequest, reason: "Security group \(groupId) does not exist")
+            }
+            guard group.$project.id == projectId else {
+                throw Abort(.badRequest, reason: "Security group \(groupId) belongs to a different project")
+            }
+        }
+
+        return NICPlan(
+            networkName: networkName, network: network, explicitlyRequested: explicitlyRequested,
+            ipAddress: ipAddress, ipv6Address: ipv6Address, macAddress: macAddress,
+            securityGroupIds: securityGroupIds)
+    }
+
+    /// Creates one planned NIC inside the VM create transaction. The control
+    /// plane owns IPAM (issue #212): the NIC's addresses are claimed (fixed)
+    /// or allocated here so agents receive them in the spec instead of
+    /// inventing them.
+    static func createInterface(
+        _ plan: NICPlan, vmID: UUID, index: Int, projectId: UUID, on db: Database
+    ) async throws {
+        var allocation: IPAMService.Allocation?
+        var allocation6: IPAMService.Allocation6?
+        var networkGateway: String?
+        var networkGateway6: String?
+        if let logicalNetwork = try await LogicalNetwork.query(on: db)
+            .filter(\.$name == plan.networkName)
+            .first()
+        {
+            if let fixed = plan.ipAddress {
+                if case .ipv4(let claimed) = try await IPAMService.claimIP(
+                    fixed, on: logicalNetwork, projectID: projectId, db: db)
+                {
+                    allocation = claimed
+                }
+            } else {
+                allocation = try await IPAMService.allocateIP(for: logicalNetwork, on: db)
+            }
+            networkGateway = logicalNetwork.gateway
+            // Dual-stack network: the NIC gets one address per family.
+            if let fixed = plan.ipv6Address {
+                if case .ipv6(let claimed) = try await IPAMService.claimIP(
+                    fixed, on: logicalNetwork, projectID: projectId, db: db)
+                {
+                    allocation6 = claimed
+                }
+            } else {
+                allocation6 = try await IPAMService.allocateIPv6(for: logicalNetwork, on: db)
+            }
+            networkGateway6 = logicalNetwork.gateway6
+        } else if plan.explicitlyRequested || plan.ipAddress != nil || plan.ipv6Address != nil {
+            throw Abort(.badRequest, reason: "Network '\(plan.networkName)' no longer exists")
+        }
+
+        let networkInterface = VMNetworkInterface(
+            vmID: vmID,
+            network: plan.networkName,
+            macAddress: plan.macAddress,
+            deviceName: "net\(index)",
+            orderIndex: index
+        )
+        try await networkInterface.save(on: db)
+        let interfaceID = try networkInterface.requireID()
+
+        // The ≥1-group invariant: the NIC joins the requested security
+        // groups, or the project's default group when the caller picked none.
+        let groupIds: [UUID]
+        if plan.securityGroupIds.isEmpty {
+            let defaultGroup = try await SecurityGroupService.ensureDefaultGroup(projectID: projectId, on: db)
+            groupIds = [try defaultGroup.requireID()]
+        } else {
+            groupIds = plan.securityGroupIds
+        }
+        for groupId in groupIds {
+            try await VMInterfaceSecurityGroup(interfaceID: interfaceID, securityGroupID: groupId).save(on: db)
+        }
+
+        if let allocation {
+            try await VMInterfaceAddress(
+                interfaceID: interfaceID,
+                network: plan.networkName,
+                family: .ipv4,
+                address: allocation.ipAddress,
+                prefixLength: allocation.prefixLength,
+                gateway: networkGateway
+            ).save(on: db)
+        }
+        if let allocation6 {
+            try await VMInterfaceAddress(
+                interfaceID: interfaceID,
+                network: plan.networkName,
+                family: .ipv6,
+                address: allocation6.ipAddress,
+                prefixLength: allocation6.prefixLength,
+                gateway: networkGateway6
+            ).save(on: db)
+        }
+    }
+}
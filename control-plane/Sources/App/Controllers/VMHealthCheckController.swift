@@ -0,0 +1,178 @@
+import Fluent
+import StratoShared
+import Vapor
+
+/// A VM's application health check under `/api/vms/:vmID/health-check`
+/// (wire v31). The hosting agent probes the VM while it runs — a TCP
+/// connect or HTTP GET against its first NIC's address, or a command run
+/// through the guest agent — and reports `healthy`/`unhealthy`; the
+/// observed-state applier runs the configured action when it turns
+/// unhealthy (see `VMHealthAction`).
+///
+/// Reading needs `read` on the VM and changing needs `update`; a `replace`
+/// action also needs `delete`, since it throws away the boot disk.
+struct VMHealthCheckController: RouteCollection {
+    func boot(routes: any RoutesBuilder) throws {
+        let check = routes.grouped("api", "vms", ":vmID", "health-check")
+        check.get(use: show)
+        check.put(use: set)
+        check.delete(use: remove)
+    }
+
+    /// GET /api/vms/:vmID/health-check — `404` when the VM has none.
+    func show(req: Request) async throws -> VMHealthCheckResponse {
+        let vm = try await req.authorizedVM(try vmID(req), permission: "read")
+        return try Self.response(for: vm)
+    }
+
+    /// PUT /api/vms/:vmID/health-check — sets or replaces the check. A
+    /// changed check starts over on the agent, grace period included.
+    func set(req: Request) async throws -> VMHealthCheckResponse {
+        let vm = try await req.authorizedVM(try vmID(req), permission: "update")
+        let request = try req.content.decode(SetVMHealthCheckRequest.self)
+        let check = try Self.validated(request)
+        let action = request.action ?? .event
+        if action == .replace {
+            try await req.authorize("delete", on: "virtual_machine", id: try vm.requireID())
+            guard vm.$sourceImage.id != nil else {
+                throw Abort(.badRequest, reason: "Only a VM created from an image can be replaced from it")
+            }
+        }
+        guard await Self.agentSupportsHealthChecks(vm: vm, app: req.application) else {
+            throw Abort(.conflict, reason: "This VM's agent is too old to run health checks; upgrade the agent")
+        }
+
+        guard check != vm.healthCheck || action.rawValue != vm.healthAction else {
+            return try Self.response(for: vm)
+        }
+        if check != vm.healthCheck {
+            // The agent starts the new check from scratch; so does the verdict.
+            vm.healthStatus = nil
+            vm.healthConsecutiveFailures = nil
+            vm.healthCheckedAt = nil
+            vm.healthMessage = nil
+        }
+        vm.healthCheck = check
+        vm.healthAction = action.rawValue
+        vm.bumpGeneration()
+        try await vm.save(on: req.db)
+
+        req.logger.info(
+            "Set VM health check",
+            metadata: [
+                "vm_id": .string(vm.id?.uuidString ?? ""),
+                "kind": .string(check.kind.rawValue),
+                "action": .string(action.rawValue),
+            ])
+        return try Self.response(for: vm)
+    }
+
+    /// DELETE /api/vms/:vmID/health-check — stops checking the VM. Deleting
+    /// a missing check is a no-op.
+    func remove(req: Request) async throws -> HTTPStatus {
+        let vm = try await req.authorizedVM(try vmID(req), permission: "update")
+        guard vm.healthCheck != nil || vm.healthStatus != nil else { return .noContent }
+        vm.healthCheck = nil
+        vm.healthAction = nil
+        vm.healthStatus = nil
+        vm.healthConsecutiveFailures = nil
+        vm.healthCheckedAt = nil
+        vm.healthMessage = nil
+        vm.bumpGeneration()
+        try await vm.save(on: req.db)
+        return .noContent
+    }
+
+    // MARK: - Helpers
+
+    static func response(for vm: VM) throws -> VMHealthCheckResponse {
+        guard let check = vm.healthCheck else {
+            throw Abort(.notFound, reason: "This VM has no health check")
+        }
+        return VMHealthCheckResponse(
+            vmId: try vm.requireID(),
+            kind: check.kind,
+            port: check.port,
+            path: check.path,
+            command: check.command,
+            intervalSeconds: check.intervalSeconds,
+            timeoutSeconds: check.timeoutSeconds,
+            failureThreshold: check.failureThreshold,
+            gracePeriodSeconds: check.gracePeriodSeconds,
+            action: vm.healthAction.flatMap(VMHealthAction.init(rawValue:)) ?? .event,
+            status: vm.healthStatus,
+            consecutiveFailures: vm.healthConsecutiveFailures,
+            checkedAt: vm.healthCheckedAt,
+            message: vm.healthMessage,
+            replacementCount: vm.replacementCount)
+    }
+
+    /// The check a request describes, with defaults filled in. Fields that
+    /// don't apply to the kind are dropped rather than rejected.
+    static func validated(_ request: SetVMHealthCheckRequest) throws -> VMHealthCheck {
+        let interval = request.intervalSeconds ?? SetVMHealthCheckRequest.defaultIntervalSeconds
+        let timeout = request.timeoutSeconds ?? SetVMHealthCheckRequest.defaultTimeoutSeconds
+        let threshold = request.failureThreshold ?? SetVMHealthCheckRequest.defaultFailureThreshold
+        let grace = request.gracePeriodSeconds ?? SetVMHealthCheckRequest.defaultGracePeriodSeconds
+        guard (5...3600).contains(interval) else {
+            throw Abort(.badRequest, reason: "intervalSeconds must be between 5 and 3600")
+        }
+        guard (1...60).contains(timeout), timeout < interval else {
+            throw Abort(.badRequest, reason: "timeoutSeconds must be between 1 and 60 and less than intervalSeconds")
+        }
+        guard (1...10).contains(threshold) else {
+            throw Abort(.badRequest, reason: "failureThreshold must be between 1 and 10")
+        }
+        guard (0...3600).contains(grace) else {
+            throw Abort(.badRequest, reason: "gracePeriodSeconds must be between 0 and 3600")
+        }
+
+        switch request.kind {
+        case .tcp, .http:
+            guard let port = request.port, (1...65535).contains(port) else {
+                throw Abort(.badRequest, reason: "A \(request.kind.rawValue) check needs a port between 1 and 65535")
+            }
+            var path: String?
+            if request.kind == .http {
+                let requested = request.path ?? "/"
+                guard requested.hasPrefix("/"), requested.count <= 1024,
+                    !requested.contains(where: { $0.isWhitespace || $0.isNewline })
+                else {
+                    throw Abort(.badRequest, reason: "path must start with / and contain no whitespace")
+                }
+                path = requested
+            }
+            return VMHealthCheck(
+                kind: request.kind, port: port, path: path, intervalSeconds: interval, timeoutSeconds: timeout,
+                failureThreshold: threshold, gracePeriodSeconds: grace)
+        case .exec:
+            guard let command = request.command, let program = command.first, program.hasPrefix("/"),
+                command.count <= 32, command.allSatisfy({ $0.utf8.count <= 1024 })
+            else {
+                throw Abort(
+                    .badRequest,
+                    reason: "An exec check needs a command whose first element is an absolute guest path")
+            }
+            return VMHealthCheck(
+                kind: .exec, command: command, intervalSeconds: interval, timeoutSeconds: timeout,
+                failureThreshold: threshold, gracePeriodSeconds: grace)
+        }
+    }
+
+    /// Whether the VM's agent runs health checks. A pre-v31 agent ignores the
+    /// check, so it would never report a verdict. An unplaced VM passes: it
+    /// is placed later, by which time its agent is checked again on every
+    /// change to the check.
+    private static func agentSupportsHealthChecks(vm: VM, app: Application) async -> Bool {
+        guard let agentId = vm.hypervisorId else { return true }
+        guard let agent = await app.agentService.getAgentInfo(agentId) else { return false }
+        return WireProtocol.supportsVMHealthChecks(agent.wireProtocolVersion ?? 0)
+    }
+
+    private func vmID(_ req: Request) throws -> UUID {
+        guard let id = req.parameters.get("vmID", as: UUID.self) else {
+            throw Abort(.badRequest, reason: "Invalid VM ID")
+        }
+        return id
+    }
+}
@@ -22,6 +22,17 @@ struct VolumeController: RouteCollection {
         protected.post(":volumeId", "resize", use: resizeVolume)
         protected.post(":volumeId", "snapshot", use: createSnapshot)
         protected.post(":volumeId", "clone", use: cloneVolume)
+        protected.post(":volumeId", "retype", use: retypeVolume)
+        protected.get(":volumeId", "attachments", use: listAttachments)
+
+        // Migration between agents and pools; handlers live in
+        // VolumeMigrationController.swift. The data routes are agent routes
+        // (streamed bodies, no session — see the AuthorizationMiddleware
+        // carve-out), so they sit outside the user guard.
+        protected.post(":volumeId", "migrate", use: migrateVolume)
+        protected.get(":volumeId", "migrations", use: listMigrations)
+        volumes.on(.PUT, ":volumeId", "migrations", ":migrationId", "data", body: .stream, use: uploadMigrationData)
+        volumes.get(":volumeId", "migrations", ":migrationId", "data", use: downloadMigrationData)
 
         // Snapshot operations
         protected.get(":volumeId", "snapshots", use: listSnapshots)
@@ -106,37 +117,42 @@ struct VolumeController: RouteCollection {
     @Sendable
     func createVolume(req: Request) async throws -> VolumeResponse {
         let user = try req.auth.require(User.self)
-        let request = try req.content.decode(CreateVolumeRequest.self)
-
-        // Determine project
-        let projectId: UUID
-        if let requestProjectId = request.projectId {
-            projectId = requestProjectId
-        } else if let currentOrgId = user.currentOrganizationId {
-            // Get default project for user's current organization
-            guard
-                let defaultProject = try await Project.query(on: req.db)
-                    .filter(\.$organization.$id == currentOrgId)
-                    .first()
-            else {
-                throw Abort(.badRequest, reason: "No project specified and no default project found")
+        let decoded = try req.content.decode(CreateVolumeRequest.self)
+
+        // Admission webhooks see (and may patch) the body once the caller may
+        // create volumes in the project it names. A webhook that moves the
+        // volume to another project has that one checked too.
+        let target = try await createProjectID(requested: decoded.projectId, user: user, req: req)
+        let request = try await req.admitCreate(
+            decoded, resourceKind: .volume, resourceName: decoded.name, projectID: target, user: user)
+        let projectId =
+            request.projectId == decoded.projectId
+            ? target : try await createProjectID(requested: request.projectId, user: user, req: req)
+
+        // A volume type, when named, decides the pool and the default format.
+        var typeDefinition: VolumeTypeDefinition?
+        if let volumeTypeId = request.volumeTypeId {
+            guard let found = try await VolumeTypeDefinition.find(volumeTypeId, on: req.db) else {
+                throw Abort(.badRequest, reason: "Volume type \(volumeTypeId) does not exist")
             }
-            projectId = defaultProject.id!
-        } else {
-            throw Abort(.badRequest, reason: "No project specified and user has no current organization")
-        }
-
-        // Check permission to create volumes in this project
-        let hasPermission = try await req.can("create_volume", on: "project", id: projectId.uuidString)
-
-        guard hasPermission else {
-            throw Abort(.forbidden, reason: "You don't have permission to create volumes in this project")
+            typeDefinition = found
         }
 
         // Validate format and volume type
-        let format = try VolumeNaming.parseFormat(request.format)
+        let format: VolumeFormat
+        if let typeDefinition, request.format == nil {
+            format = typeDefinition.defaultFormat
+        } else {
+            format = try VolumeNaming.parseFormat(request.format)
+        }
         let volumeType = try VolumeNaming.parseVolumeType(request.volumeType)
 
+        // A boot disk belongs to one VM; only data volumes can be shared.
+        let multiAttach = request.multiAttach ?? false
+        if multiAttach, volumeType == .boot {
+            throw Abort(.badRequest, reason: "Boot volumes cannot be multi-attach")
+        }
+
         // Resolve the source image (if any) up front, so a bad image ID fails
         // the request instead of surfacing later as a failed volume.
         var sourceImage: Image?
@@ -177,9 +193,14 @@ struct VolumeController: RouteCollection {
             throw Abort(.badRequest, reason: "'sizeGB' is too large")
         }
 
-        // Every volume lives in a pool; without a pool-selection API yet,
-        // that's the default local pool seeded by migration.
-        let pool = try await StoragePool.defaultPool(on: req.db)
+        // Every volume lives in a pool: its type's, or for an untyped volume
+        // the default local pool seeded by migration.
+        let poolID: UUID?
+        if let typeDefinition {
+            poolID = typeDefinition.$pool.id
+        } else {
+            poolID = try await StoragePool.defaultPool(on: req.db).id
+        }
 
         // Create volume record
         let volume = Volume(
@@ -191,13 +212,21 @@ struct VolumeController: RouteCollection {
             volumeType: volumeType,
             status: .creating,
             createdByID: user.id!,
-            poolID: pool.id,
+            poolID: poolID,
+            volumeTypeID: typeDefinition?.id,
+            multiAttach: multiAttach,
             sourceImageID: request.sourceImageId
         )
 
         // The creator's explicit, revocable binding on the volume, in the same
-        // transaction as the row (issue #477).
+        // transaction as the row (issue #477). The type quota is checked in
+        // that transaction too, so the lock covers the check and the insert.
         try await req.db.transaction { db in
+            if let typeID = typeDefinition?.id {
+                try await VolumeTypeQuotaService.check(
+                    volumeTypeID: typeID, projectID: projectId,
+                    addingVolume: true, addingBytes: sizeBytes, on: db)
+            }
             try await volume.save(on: db)
             try await RoleBindingService.grant(
                 principalType: .user,
@@ -361,7 +390,9 @@ struct VolumeController: RouteCollection {
         guard volume.canAttach else {
             throw Abort(
                 .conflict,
-                reason: "Volume cannot be attached in status '\(volume.status.rawValue)'. Must be 'available'")
+                reason: volume.multiAttach
+                    ? "Volume cannot be attached in status '\(volume.status.rawValue)'. Must be 'available' or 'attached'"
+                    : "Volume cannot be attached in status '\(volume.status.rawValue)'. Must be 'available'")
         }
 
         // Fetch the VM
@@ -385,6 +416,25 @@ struct VolumeController: RouteCollection {
             )
         }
 
+        // Several writers of one image are only safe on raw volumes: qcow2
+        // keeps allocation metadata that two VMs would update independently.
+        // Read-only holders never write it, so they may share either format.
+        let readonly = request.readonly ?? false
+        if volume.multiAttach, !readonly, volume.format != .raw {
+            throw Abort(
+                .badRequest,
+                reason:
+                    "A writable multi-attach needs a raw volume; qcow2 metadata cannot be shared by several writers. Attach it read-only."
+            )
+        }
+
+        let existingAttachments = try await VolumeAttachment.query(on: req.db)
+            .filter(\.$volume.$id == volume.id!)
+            .all()
+        if existingAttachments.contains(where: { $0.$vm.id == vm.id }) {
+            throw Abort(.conflict, reason: "Volume is already attached to this VM")
+        }
+
         // Pool-aware reachability guard: the VM's agent must be able to reach
         // the volume's data. For a `local` pool that means the agent holding
         // the volume's single replica — identical to the old same-hypervisor
@@ -416,22 +466,63 @@ struct VolumeController: RouteCollection {
         }
 
         // Generate device name if not provided
+        let takenDeviceNames = try await VolumeAttachment.deviceNames(onVM: vm.requireID(), on: req.db)
         let deviceName: String
         if let providedName = request.deviceName {
+            guard !takenDeviceNames.contains(providedName) else {
+                throw Abort(.conflict, reason: "The VM already has a disk named '\(providedName)'")
+            }
             deviceName = providedName
         } else {
-            deviceName = try await generateDeviceName(for: vm, on: req.db)
+            deviceName = VolumeNaming.nextDeviceName(existingDeviceNames: takenDeviceNames)
         }
 
-        // Mark as attaching. The volume's replica placement is set at
+        // Record the VM's attachment. A first attachment also marks the
+        // volume attaching and fills its single-attachment columns; a further
+        // VM joining a multi-attach volume leaves the volume `.attached` for
+        // the VMs already holding it. The volume's replica placement is set at
         // provisioning and must not be overwritten here — the reachability
         // check above already guarantees the VM's agent can reach it.
-        volume.status = .attaching
-        volume.$vm.id = vm.id
-        volume.deviceName = deviceName
-        volume.bootOrder = request.bootOrder
-        volume.attachedAgentId = vm.hypervisorId
-        try await volume.save(on: req.db)
+        let attachment = VolumeAttachment(
+            volumeID: try volume.requireID(),
+            vmID: try vm.requireID(),
+            agentId: vm.hypervisorId,
+            deviceName: deviceName,
+            bootOrder: request.bootOrder,
+            readonly: readonly
+        )
+        let volumeID = try volume.requireID()
+        let holders: Int
+        do {
+            holders = try await req.db.transaction { db in
+                // Lock the volume row so concurrent attaches of it queue here:
+                // otherwise two first attaches of a multi-attach volume both
+                // read no holders and both take the first-holder path. The
+                // holder count is re-read under the lock.
+                try await VolumeAttachment.lockVolume(volumeID, on: db)
+                let holders = try await VolumeAttachment.query(on: db)
+                    .filter(\.$volume.$id == volumeID)
+                    .count()
+                if holders > 0, !volume.multiAttach {
+                    throw Abort(.conflict, reason: "Volume is already attached to another VM")
+                }
+                try await attachment.save(on: db)
+                if holders == 0 {
+                    volume.status = .attaching
+                    volume.$vm.id = vm.id
+                    volume.deviceName = deviceName
+                    volume.bootOrder = request.bootOrder
+                    volume.attachedAgentId = vm.hypervisorId
+                    try await volume.save(on: db)
+                }
+                return holders + 1
+            }
+        } catch let error as any DatabaseError where error.isConstraintFailure {
+            throw Abort(.conflict, reason: "Volume is already attached to this VM")
+        }
+
+        // The type's I/O limits ride along with the hot-plug.
+        let qos = try await volume.$typeDefinition.get(on: req.db)?.qos
 
         // Send hot-plug message to agent
         do {
@@ -439,20 +530,20 @@ struct VolumeController: RouteCollection {
                 volume: volume,
                 vm: vm,
                 deviceName: deviceName,
-                readonly: request.readonly ?? false
+                readonly: readonly,
+                qos: qos
             )
         } catch {
-            // If hot-plug fails, revert status
-            volume.status = .available
-            volume.$vm.id = nil
-            volume.deviceName = nil
-            volume.bootOrder = nil
-            volume.attachedAgentId = nil
-            try await volume.save(on: req.db)
+            // If hot-plug fails, drop the attachment and let the volume's
+            // status follow whoever still holds it
+            try await attachment.delete(on: req.db)
+            try await VolumeAttachment.syncVolume(volume, on: req.db)
             throw error
         }
 
         // Agent confirmed the hot-plug
+        attachment.status = .attached
+        try await attachment.save(on: req.db)
         volume.status = .attached
         try await volume.save(on: req.db)
 
@@ -462,6 +553,7 @@ struct VolumeController: RouteCollection {
                 "volumeId": .string(volume.id!.uuidString),
                 "vmId": .string(vm.id!.uuidString),
                 "deviceName": .string(deviceName),
+                "holders": .stringConvertible(holders),
             ])
 
         return VolumeResponse(from: volume)
@@ -471,6 +563,8 @@ struct VolumeController: RouteCollection {
 
     /// Detach a volume from a VM
     /// POST /api/volumes/:volumeId/detach
+    /// Query params: vmId — which VM to detach from; required only when a
+    /// multi-attach volume is held by more than one.
     @Sendable
     func detachVolume(req: Request) async throws -> VolumeResponse {
         let user = try req.auth.require(User.self)
@@ -483,10 +577,32 @@ struct VolumeController: RouteCollection {
             )
         }
 
-        guard let vmId = volume.$vm.id else {
+        let attachments = try await VolumeAttachment.query(on: req.db)
+            .filter(\.$volume.$id == volume.id!)
+            .all()
+        let attachment: VolumeAttachment
+        if let requestedVMId = req.query[UUID.self, at: "vmId"] {
+            guard let found = attachments.first(where: { $0.$vm.id == requestedVMId }) else {
+                throw Abort(.conflict, reason: "Volume is not attached to VM \(requestedVMId)")
+            }
+            attachment = found
+        } else if attachments.count == 1, let only = attachments.first {
+            attachment = only
+        } else if attachments.isEmpty {
             throw Abort(.conflict, reason: "Volume is not attached to any VM")
+        } else {
+            throw Abort(
+                .badRequest,
+                reason: "Volume is attached to \(attachments.count) VMs; pass 'vmId' to choose which to detach")
         }
 
+        guard attachment.status == .attached else {
+            throw Abort(
+                .conflict,
+                reason: "The attachment is '\(attachment.status.rawValue)'; wait for it to finish")
+        }
+        let vmId = attachment.$vm.id
+
         // Fetch the VM
         guard let vm = try await VM.find(vmId, on: req.db) else {
             throw Abort(.notFound, reason: "VM not found")
@@ -501,30 +617,60 @@ struct VolumeController: RouteCollection {
             )
         }
 
-        // Mark as detaching
-        volume.status = .detaching
-        try await volume.save(on: req.db)
+        // Mark as detaching. Only the last holder's detach moves the volume
+        // itself; the others keep it `.attached`. Under the volume's row lock,
+        // like attach: two detaches of a multi-attach volume must not both
+        // count the other as still holding it, nor both as gone. A holder
+        // already detaching doesn't count.
+        let volumeID = try volume.requireID()
+        let attachmentID = try attachment.requireID()
+        try await req.db.transaction { db in
+            try await VolumeAttachment.lockVolume(volumeID, on: db)
+            guard let current = try await VolumeAttachment.find(attachmentID, on: db),
+                current.status == .attached
+            else {
+                throw Abort(.conflict, reason: "The attachment is already being detached")
+            }
+            let otherHolders = try await VolumeAttachment.query(on: db)
+                .filter(\.$volume.$id == volumeID)
+                .filter(\.$id != attachmentID)
+                .filter(\.$status != .detaching)
+                .count()
+            attachment.status = .detaching
+            try await attachment.save(on: db)
+            if otherHolders == 0 {
+                volume.status = .detaching
+                try await volume.save(on: db)
+            }
+        }
 
         // Send hot-unplug message to agent
         do {
             try await req.application.volumeService.requestVolumeDetachment(
                 volume: volume,
-                vm: vm
+                vm: vm,
+                deviceName: attachment.deviceName
             )
         } catch {
-            // If hot-unplug fails, revert status
-            volume.status = .attached
-            try await volume.save(on: req.db)
+            // If hot-unplug fails, the VM still holds the volume; let the
+            // volume's status follow its holders rather than this request's
+            // view of them
+            try await req.db.transaction { db in
+                try await VolumeAttachment.lockVolume(volumeID, on: db)
+                attachment.status = .attached
+                try await attachment.save(on: db)
+                try await VolumeAttachment.syncVolume(volume, on: db)
+            }
             throw error
         }
 
-        // Agent confirmed the hot-unplug; clear attachment info
-        volume.$vm.id = nil
-        volume.deviceName = nil
-        volume.bootOrder = nil
-        volume.attachedAgentId = nil
-        volume.status = .available
-        try await volume.save(on: req.db)
+        // Agent confirmed the hot-unplug; drop the attachment and re-derive
+        // the volume's attachment info from whoever still holds it
+        try await req.db.transaction { db in
+            try await VolumeAttachment.lockVolume(volumeID, on: db)
+            try await attachment.delete(on: db)
+            try await VolumeAttachment.syncVolume(volume, on: db)
+        }
 
         req.logger.info(
             "Volume detached from VM",
@@ -536,6 +682,24 @@ struct VolumeController: RouteCollection {
         return VolumeResponse(from: volume)
     }
 
+    // MARK: - List Attachments
+
+    /// The VMs holding a volume, oldest first: one entry for an ordinary
+    /// volume, one per VM for a multi-attach volume.
+    /// GET /api/volumes/:volumeId/attachments
+    @Sendable
+    func listAttachments(req: Request) async throws -> [VolumeAttachmentResponse] {
+        let user = try req.auth.require(User.self)
+        let volume = try await fetchVolumeWithPermission(req: req, user: user, permission: "read")
+
+        return try await VolumeAttachment.query(on: req.db)
+            .filter(\.$volume.$id == volume.requireID())
+            .sort(\.$createdAt)
+            .sort(\.$id)
+            .all()
+            .map { try VolumeAttachmentResponse(from: $0) }
+    }
+
     // MARK: - Resize Volume
 
     /// Resize a volume (increase size only)
@@ -582,10 +746,18 @@ struct VolumeController: RouteCollection {
             throw Abort(.conflict, reason: "Volume is not provisioned on any hypervisor")
         }
 
-        // Mark as resizing
+        // Mark as resizing, charging the growth to the type's quota under
+        // the same lock.
         let previousSize = volume.size
         volume.status = .resizing
-        try await volume.save(on: req.db)
+        try await req.db.transaction { db in
+            if let typeID = volume.$typeDefinition.id {
+                try await VolumeTypeQuotaService.check(
+                    volumeTypeID: typeID, projectID: volume.$project.id,
+                    addingVolume: false, addingBytes: newSizeBytes - previousSize, on: db)
+            }
+            try await volume.save(on: db)
+        }
 
         // Grow the disk on the hypervisor; the database size is only updated
         // once the agent confirms.
@@ -626,73 +798,15 @@ struct VolumeController: RouteCollection {
         let volume = try await fetchVolumeWithPermission(req: req, user: user, permission: "snapshot")
         let request = try req.content.decode(CreateSnapshotRequest.self)
 
-        // Validate volume can be snapshotted
-        guard volume.canSnapshot else {
-            throw Abort(
-                .conflict,
-                reason:
-                    "Volume cannot be snapshotted in status '\(volume.status.rawValue)'. Must be 'available' or 'attached'"
-            )
-        }
-
-        guard volume.hypervisorId != nil, volume.storagePath != nil else {
-            throw Abort(.conflict, reason: "Volume is not provisioned on any hypervisor")
-        }
-
-        // Mark volume as snapshotting
-        let previousStatus = volume.status
-        volume.status = .snapshotting
-        try await volume.save(on: req.db)
-
-        // Create snapshot record
-        let snapshot = VolumeSnapshot(
+        let snapshot = try await req.application.volumeService.takeSnapshot(
+            of: volume,
             name: request.name,
             description: request.description ?? "",
-            volumeID: volume.id!,
-            projectID: volume.$project.id,
-            size: volume.size,
-            status: .creating,
-            createdByID: user.id!
+            createdByID: user.id!,
+            owner: (.user, user.id!),
+            on: req.db
         )
 
-        // Creator binding on the snapshot, in the same transaction as the row
-        // (issue #477).
-        try await req.db.transaction { db in
-            try await snapshot.save(on: db)
-            try await RoleBindingService.grant(
-                principalType: .user,
-                principalID: user.id!,
-                role: .admin,
-                nodeType: .volumeSnapshot,
-                nodeID: snapshot.id!,
-                createdBy: user.id,
-                on: db
-            )
-        }
-
-        // Create the snapshot on the hypervisor; the agent reports the actual
-        // snapshot storage path.
-        do {
-            let snapshotPath = try await req.application.volumeService.requestVolumeSnapshot(
-                volume: volume,
-                snapshot: snapshot
-            )
-            snapshot.storagePath = snapshotPath
-            snapshot.status = .available
-            try await snapshot.save(on: req.db)
-        } catch {
-            snapshot.status = .error
-            snapshot.errorMessage = error.localizedDescription
-            try await snapshot.save(on: req.db)
-            volume.status = previousStatus
-            try await volume.save(on: req.db)
-            throw Abort(.badGateway, reason: "Failed to create snapshot on hypervisor: \(error.localizedDescription)")
-        }
-
-        // Restore volume status
-        volume.status = previousStatus
-        try await volume.save(on: req.db)
-
         req.logger.info(
             "Snapshot created",
             metadata: [
@@ -734,7 +848,7 @@ struct VolumeController: RouteCollection {
         try await sourceVolume.save(on: req.db)
 
         // Create new volume record. The clone is materialized on the source's
-        // agent, so it lives in the source's pool.
+        // agent, so it lives in the source's pool and keeps its type.
         let newVolume = Volume(
             name: request.name,
             description: request.description ?? "Clone of \(sourceVolume.name)",
@@ -745,22 +859,35 @@ struct VolumeController: RouteCollection {
             status: .creating,
             createdByID: user.id!,
             poolID: sourceVolume.$pool.id,
+            volumeTypeID: sourceVolume.$typeDefinition.id,
+            multiAttach: sourceVolume.multiAttach,
             sourceVolumeID: sourceVolume.id
         )
 
         // Creator binding on the cloned volume, in the same transaction as
-        // the row (issue #477).
-        try await req.db.transaction { db in
-            try await newVolume.save(on: db)
-            try await RoleBindingService.grant(
-                principalType: .user,
-                principalID: user.id!,
-                role: .admin,
-                nodeType: .volume,
-                nodeID: newVolume.id!,
-                createdBy: user.id,
-                on: db
-            )
+        // the row (issue #477), along with the type quota check.
+        do {
+            try await req.db.transaction { db in
+                if let typeID = newVolume.$typeDefinition.id {
+                    try await VolumeTypeQuotaService.check(
+                        volumeTypeID: typeID, projectID: newVolume.$project.id,
+                        addingVolume: true, addingBytes: newVolume.size, on: db)
+                }
+                try await newVolume.save(on: db)
+                try await RoleBindingService.grant(
+                    principalType: .user,
+                    principalID: user.id!,
+                    role: .admin,
+                    nodeType: .volume,
+                    nodeID: newVolume.id!,
+                    createdBy: user.id,
+                    on: db
+                )
+            }
+        } catch {
+            sourceVolume.status = previousStatus
+            try await sourceVolume.save(on: req.db)
+            throw error
         }
 
         // Clone on the agent in the background (copying a disk image can take
@@ -791,6 +918,91 @@ struct VolumeController: RouteCollection {
         return VolumeResponse(from: newVolume)
     }
 
+    // MARK: - Retype Volume
+
+    /// Move a detached volume to another volume type
+    /// POST /api/volumes/:volumeId/retype
+    /// Body: { "volumeTypeId": UUID }
+    ///
+    /// A retype whose target pool already admits every agent holding the
+    /// volume's data (and satisfies the type's encryption requirement) is a
+    /// metadata change. Anything else means the data has to move, which this
+    /// endpoint refuses with 409. The on-disk format is left alone: a type's
+    /// default format only applies to volumes it creates.
+    @Sendable
+    func retypeVolume(req: Request) async throws -> VolumeResponse {
+        let user = try req.auth.require(User.self)
+        let volume = try await fetchVolumeWithPermission(req: req, user: user, permission: "update")
+        let request = try req.content.decode(RetypeVolumeRequest.self)
+
+        guard volume.status == .available else {
+            throw Abort(
+                .conflict,
+                reason: "Volume cannot be retyped in status '\(volume.status.rawValue)'. Must be 'available' (detached)"
+            )
+        }
+
+        guard let target = try await VolumeTypeDefinition.find(request.volumeTypeId, on: req.db) else {
+            throw Abort(.badRequest, reason: "Volume type \(request.volumeTypeId) does not exist")
+        }
+        let targetID = try target.requireID()
+        guard volume.$typeDefinition.id != targetID else {
+            return VolumeResponse(from: volume)
+        }
+
+        var replicaAgentIds = try await VolumeReplica.query(on: req.db)
+            .filter(\.$volume.$id == volume.id!)
+            .all()
+            .map(\.agentId)
+        if replicaAgentIds.isEmpty, let legacyAgentId = volume.hypervisorId {
+            replicaAgentIds = [legacyAgentId]
+        }
+        guard !replicaAgentIds.isEmpty else {
+            throw Abort(.conflict, reason: "Volume is not provisioned on any hypervisor")
+        }
+
+        let targetPool = try await target.$pool.get(on: req.db)
+        for agentId in replicaAgentIds {
+            var capabilities: [String] = []
+            if let agentUUID = UUID(uuidString: agentId), let agent = try await Agent.find(agentUUID, on: req.db) {
+                capabilities = agent.capabilities
+            }
+            guard
+                VolumeTypeDefinition.agentQualifies(
+                    agentId: agentId, capabilities: capabilities,
+                    pool: targetPool, requiresEncryption: target.requiresEncryption)
+            else {
+                throw Abort(
+                    .conflict,
+                    reason:
+                        "Volume data on agent '\(agentId)' is outside volume type '\(target.name)' "
+                        + "(pool '\(targetPool.name)'\(target.requiresEncryption ? ", encrypted storage" : "")); "
+                        + "the volume must be migrated first"
+                )
+            }
+        }
+
+        let previousTypeID = volume.$typeDefinition.id
+        try await req.db.transaction { db in
+            try await VolumeTypeQuotaService.check(
+                volumeTypeID: targetID, projectID: volume.$project.id,
+                addingVolume: true, addingBytes: volume.size, on: db)
+            volume.$typeDefinition.id = targetID
+            volume.$pool.id = target.$pool.id
+            try await volume.save(on: db)
+        }
+
+        req.logger.info(
+            "Volume retyped",
+            metadata: [
+                "volumeId": .string(volume.id!.uuidString),
+                "previousVolumeTypeId": .string(previousTypeID?.uuidString ?? "none"),
+                "volumeTypeId": .string(targetID.uuidString),
+            ])
+
+        return VolumeResponse(from: volume)
+    }
+
     // MARK: - List Snapshots
 
     /// List all snapshots for a volume
@@ -890,8 +1102,38 @@ struct VolumeController: RouteCollection {
 
     // MARK: - Helper Methods
 
+    /// The project a volume create targets (the named one, else the first of
+    /// the caller's current organization), once the caller may create volumes
+    /// in it.
+    func createProjectID(requested: UUID?, user: User, req: Request) async throws -> UUID {
+        let projectId: UUID
+        if let requested {
+            projectId = requested
+        } else if let currentOrgId = user.currentOrganizationId {
+            // Get default project for user's current organization
+            guard
+                let defaultProject = try await Project.query(on: req.db)
+                    .filter(\.$organization.$id == currentOrgId)
+                    .first()
+            else {
+                throw Abort(.badRequest, reason: "No project specified and no default project found")
+            }
+            projectId = defaultProject.id!
+        } else {
+            throw Abort(.badRequest, reason: "No project specified and user has no current organization")
+        }
+
+        // Check permission to create volumes in this project
+        let hasPermission = try await req.can("create_volume", on: "project", id: projectId.uuidString)
+
+        guard hasPermission else {
+            throw Abort(.forbidden, reason: "You don't have permission to create volumes in this project")
+        }
+        return projectId
+    }
+
     /// Fetch a volume and check permission
-    private func fetchVolumeWithPermission(req: Request, user: User, permission: String) async throws -> Volume {
+    func fetchVolumeWithPermission(req: Request, user: User, permission: String) async throws -> Volume {
         guard let volumeIdString = req.parameters.get("volumeId"),
             let volumeId = UUID(uuidString: volumeIdString)
         else {
@@ -910,14 +1152,4 @@ struct VolumeController: RouteCollection {
 
         return volume
     }
-
-    /// Generate a device name for a new volume attachment
-    private func generateDeviceName(for vm: VM, on db: Database) async throws -> String {
-        // Get existing volumes attached to this VM
-        let attachedVolumes = try await Volume.query(on: db)
-            .filter(\.$vm.$id == vm.id!)
-            .all()
-
-        return VolumeNaming.nextDeviceName(existingDeviceNames: attachedVolumes.map { $0.deviceName })
-    }
 }
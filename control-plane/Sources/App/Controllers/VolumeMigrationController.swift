@@ -0,0 +1,386 @@
+import Crypto
+import Fluent
+import Foundation
+import StratoShared
+import Vapor
+
+/// Volume migration handlers, registered by `VolumeController.boot`: the
+/// user-facing migrate and history endpoints, and the data route agents
+/// stream a detached volume's disk through.
+///
+/// A detached volume is copied: its agent uploads the disk file to the data
+/// route, the control plane hashes it into object storage, and the target
+/// agent downloads and verifies it. An attached volume is mirrored live: the
+/// target agent serves a blank volume over NBD and the VM's QEMU runs
+/// `blockdev-mirror` onto it, pivoting when the copy converges; the VM stays
+/// on its host and keeps using the export. Either way the `VolumeReplica`
+/// records switch in one transaction only once the copy is complete
+/// (`VolumeService.performMigration`).
+///
+/// The data route is an agent route with the same trust model as snapshot
+/// artifact transfer (`SandboxSnapshotTransferController`): it authenticates
+/// the SPIFFE SVID forwarded by the Envoy mTLS sidecar, with no session
+/// fallback, and accepts bytes only for a migration that is running.
+extension VolumeController {
+
+    // MARK: - Migrate
+
+    /// POST /api/volumes/:volumeId/migrate
+    /// Body: { "targetAgentId"?: string, "targetPoolId"?: UUID, "volumeTypeId"?: UUID }
+    ///
+    /// Moves the volume's data to another agent, pool, or both. With no
+    /// target agent, one is picked from the target pool — staying put when
+    /// the current agent is already a member, which makes a pool change a
+    /// metadata switch; with no target at all, another agent of the current
+    /// pool. Naming the agent is a system-administrator decision.
+    /// 202 with the migration; the volume is `migrating` until it completes.
+    ///
+    /// Refused with 409 while the volume has snapshots (they live beside it
+    /// on its agent and would be left behind), while a multi-attach volume
+    /// is attached, and for an attached volume whose VM isn't running QEMU.
+    @Sendable
+    func migrateVolume(req: Request) async throws -> Response {
+        let user = try req.auth.require(User.self)
+        let volume = try await fetchVolumeWithPermission(req: req, user: user, permission: "update")
+        let request = try req.content.decode(MigrateVolumeRequest.self)
+        let volumeId = try volume.requireID()
+
+        // Agents are below the tenant abstraction; tenants pick a pool or type.
+        if request.targetAgentId != nil {
+            _ = try req.requireSystemAdmin("Only system administrators can choose a migration's target agent")
+        }
+
+        guard volume.status == .available || volume.status == .attached else {
+            throw Abort(
+                .conflict,
+                reason:
+                    "Volume cannot be migrated in status '\(volume.status.rawValue)'. Must be 'available' or 'attached'"
+            )
+        }
+
+        let snapshotCount = try await VolumeSnapshot.query(on: req.db)
+            .filter(\.$volume.$id == volumeId)
+            .count()
+        guard snapshotCount == 0 else {
+            throw Abort(
+                .conflict,
+                reason: "Volume has \(snapshotCount) snapshot(s) stored beside it on its agent; delete them before migrating"
+            )
+        }
+
+        // Attached: mirror under the one running VM. Detached: copy.
+        let attachments = try await VolumeAttachment.query(on: req.db)
+            .filter(\.$volume.$id == volumeId)
+            .all()
+        var vm: VM?
+        if let attachment = attachments.first {
+            guard !volume.multiAttach else {
+                throw Abort(
+                    .conflict,
+                    reason: "A multi-attach volume cannot migrate while attached; detach it from every VM first")
+            }
+            guard attachment.status == .attached, let attachedVM = try await VM.find(attachment.$vm.id, on: req.db)
+            else {
+                throw Abort(.conflict, reason: "Volume attachment is still settling; retry once it is attached")
+            }
+            guard attachedVM.hypervisorType == .qemu else {
+                throw Abort(.badRequest, reason: "Volume operations are not supported for Firecracker VMs")
+            }
+            guard attachedVM.status == .running, attachedVM.hypervisorId != nil else {
+                throw Abort(
+                    .conflict,
+                    reason:
+                        "An attached volume migrates live and its VM is '\(attachedVM.status.rawValue)'; start the VM or detach the volume first"
+                )
+            }
+            vm = attachedVM
+        }
+        let mode: VolumeMigrationMode = vm == nil ? .copy : .mirror
+
+        // Source: the volume's single replica (local pools), or the
+        // dual-written legacy column for rows without one.
+        let replicas = try await VolumeReplica.query(on: req.db)
+            .filter(\.$volume.$id == volumeId)
+            .all()
+        guard replicas.count <= 1 else {
+            throw Abort(.conflict, reason: "Volumes with several replicas cannot be migrated")
+        }
+        guard let sourceAgentId = replicas.first?.agentId ?? volume.hypervisorId else {
+            throw Abort(.conflict, reason: "Volume is not provisioned on any hypervisor")
+        }
+
+        // Target pool and type. A typed volume keeps a type whose pool is the
+        // one it lives in, so moving it to another pool takes a new type.
+        let currentType = try await volume.$typeDefinition.get(on: req.db)
+        var targetType: VolumeTypeDefinition?
+        if let volumeTypeId = request.volumeTypeId {
+            guard let found = try await VolumeTypeDefinition.find(volumeTypeId, on: req.db) else {
+                throw Abort(.badRequest, reason: "Volume type \(volumeTypeId) does not exist")
+            }
+            targetType = found
+        }
+        if let targetType, let targetPoolId = request.targetPoolId, targetType.$pool.id != targetPoolId {
+            throw Abort(
+                .badRequest,
+                reason: "Volume type '\(targetType.name)' is backed by another pool than \(targetPoolId)")
+        }
+        guard let targetPoolId = request.targetPoolId ?? targetType?.$pool.id ?? volume.$pool.id else {
+            throw Abort(.conflict, reason: "Volume has no storage pool")
+        }
+        if targetType == nil, let currentType, currentType.$pool.id != targetPoolId {
+            throw Abort(
+                .badRequest,
+                reason:
+                    "Volume type '\(currentType.name)' is backed by another pool; pass a volumeTypeId backed by the target pool"
+            )
+        }
+        guard let targetPool = try await StoragePool.find(targetPoolId, on: req.db) else {
+            throw Abort(.badRequest, reason: "Storage pool \(targetPoolId) does not exist")
+        }
+        guard targetPool.mode == .local else {
+            throw Abort(.badRequest, reason: "Volumes can only be migrated into local pools")
+        }
+        let requiresEncryption = (targetType ?? currentType)?.requiresEncryption ?? false
+
+        let targetVolumeTypeId = try targetType?.requireID()
+        let changesPool =
+            targetPoolId != volume.$pool.id
+            || (targetVolumeTypeId != nil && targetVolumeTypeId != volume.$typeDefinition.id)
+
+        // Target agent. A pool change stays on the current agent when it is
+        // a member; a request that changes nothing else means "move off it".
+        let agents = await req.application.agentService.getAgentList()
+        let candidates = agents.filter {
+            $0.status == .online && $0.supportedHypervisors.contains(.qemu)
+                && VolumeTypeDefinition.agentQualifies(
+                    agentId: $0.id?.uuidString ?? "", capabilities: $0.capabilities, pool: targetPool,
+                    requiresEncryption: requiresEncryption)
+        }
+        let targetAgent: Agent
+        if let requested = request.targetAgentId {
+            guard let agent = candidates.first(where: { $0.id?.uuidString == requested }) else {
+                throw Abort(
+                    .conflict,
+                    reason:
+                        "Agent '\(requested)' is not an online QEMU agent in pool '\(targetPool.name)'"
+                        + (requiresEncryption ? " with encrypted storage" : ""))
+            }
+            targetAgent = agent
+        } else if changesPool, let current = candidates.first(where: { $0.id?.uuidString == sourceAgentId }) {
+            targetAgent = current
+        } else if let other = candidates.first(where: {
+            $0.id?.uuidString != sourceAgentId && Self.canReceiveMigration($0, mode: mode)
+        }) {
+            targetAgent = other
+        } else {
+            throw Abort(
+                .conflict,
+                reason: "No online agent in pool '\(targetPool.name)' can receive the volume")
+        }
+        let targetAgentId = targetAgent.id!.uuidString
+        guard targetAgentId != sourceAgentId || changesPool else {
+            throw Abort(.conflict, reason: "Volume is already on that agent and pool")
+        }
+
+        // Moving bytes needs the v23 messages on every agent that takes part.
+        if targetAgentId != sourceAgentId {
+            guard Self.canReceiveMigration(targetAgent, mode: mode) else {
+                throw Abort(
+                    .conflict,
+                    reason: mode == .mirror
+                        ? "Agent '\(targetAgentId)' cannot serve volumes over NBD (needs wire protocol >= \(WireProtocol.volumeMigrationMinimumVersion) and the '\(StorageCapability.nbdExport)' capability)"
+                        : "Agent '\(targetAgentId)' is too old for volume migration (need wire protocol >= \(WireProtocol.volumeMigrationMinimumVersion))"
+                )
+            }
+            let sender = vm?.hypervisorId ?? sourceAgentId
+            guard let agent = await req.application.agentService.getAgentInfo(sender),
+                WireProtocol.supportsVolumeMigration(agent.wireProtocolVersion ?? 0)
+            else {
+                throw Abort(
+                    .conflict,
+                    reason:
+                        "Agent '\(sender)' is too old for volume migration (need wire protocol >= \(WireProtocol.volumeMigrationMinimumVersion)). Upgrade the agent."
+                )
+            }
+        }
+
+        let migration = VolumeMigration(
+            volumeID: volumeId,
+            mode: mode,
+            sourceAgentId: sourceAgentId,
+            targetAgentId: targetAgentId,
+            sourcePoolId: volume.$pool.id,
+            targetPoolId: targetPoolId,
+            targetVolumeTypeId: targetVolumeTypeId,
+            createdByID: try user.requireID()
+        )
+        try await req.db.transaction { db in
+            if let targetVolumeTypeId, targetVolumeTypeId != volume.$typeDefinition.id {
+                try await VolumeTypeQuotaService.check(
+                    volumeTypeID: targetVolumeTypeId, projectID: volume.$project.id,
+                    addingVolume: true, addingBytes: volume.size, on: db)
+            }
+            volume.status = .migrating
+            try await volume.save(on: db)
+            try await migration.create(on: db)
+        }
+
+        let migrationId = try migration.requireID()
+        let volumeService = req.application.volumeService
+        // Register with the drain registry (like the create and clone paths)
+        // so shutdown waits for and cancels this rather than racing Fluent
+        // teardown; the stuck-volume sweep recovers a cancelled migration.
+        req.application.backgroundTasks.spawn {
+            await volumeService.performMigration(migrationId: migrationId)
+        }
+
+        req.logger.info(
+            "Volume migration accepted",
+            metadata: [
+                "volumeId": .string(volumeId.uuidString),
+                "migrationId": .string(migrationId.uuidString),
+                "mode": .string(mode.rawValue),
+                "sourceAgentId": .string(sourceAgentId),
+                "targetAgentId": .string(targetAgentId),
+            ])
+
+        return try migration.acceptedResponse()
+    }
+
+    /// Whether `agent` can be the destination of a migration in `mode`: the
+    /// v23 import message for a copy, plus an NBD export for a mirror.
+    static func canReceiveMigration(_ agent: Agent, mode: VolumeMigrationMode) -> Bool {
+        guard WireProtocol.supportsVolumeMigration(agent.wireProtocolVersion ?? 0) else { return false }
+        return mode == .copy || agent.capabilities.contains(StorageCapability.nbdExport)
+    }
+
+    // MARK: - Migration History
+
+    /// List a volume's migrations, newest first
+    /// GET /api/volumes/:volumeId/migrations
+    /// Query params: limit/offset (optional) — select the page.
+    @Sendable
+    func listMigrations(req: Request) async throws -> PagedResponse<VolumeMigrationResponse> {
+        let paging = try ListPaging.decode(from: req)
+        let user = try req.auth.require(User.self)
+        let volume = try await fetchVolumeWithPermission(req: req, user: user, permission: "read")
+
+        let migrations = try await VolumeMigration.query(on: req.db)
+            .filter(\.$volume.$id == volume.requireID())
+            .sort(\.$createdAt, .descending)
+            .sort(\.$id, .descending)
+            .all()
+
+        return paging.page(migrations.map { VolumeMigrationResponse(from: $0) })
+    }
+
+    // MARK: - Data transfer (agent mTLS routes)
+
+    /// PUT /api/volumes/:volumeId/migrations/:migrationId/data
+    ///
+    /// The source agent's disk file, streamed as the raw request body into
+    /// object storage. Size and SHA-256 are computed here from the bytes
+    /// actually stored and recorded on the migration, for the target agent
+    /// to verify its download against.
+    func uploadMigrationData(req: Request) async throws -> HTTPStatus {
+        let (volume, migration) = try await authenticatedMigrationDataRequest(req: req)
+        let volumeId = try volume.requireID()
+        let migrationId = try migration.requireID()
+        let key = VolumeMigration.objectKey(volumeId: volumeId, migrationId: migrationId)
+
+        // A raw disk is exactly its virtual size; qcow2 adds metadata on top.
+        // Double it, with a floor for small volumes.
+        let maxBytes = max(volume.size * 2, Int64(1) << 30)
+
+        let store = req.application.imageObjectStore
+        let writer = try await store.openWriter(key: key)
+        var hasher = SHA256()
+        var size: Int64 = 0
+        do {
+            for try await chunk in req.body {
+                try Task.checkCancellation()
+                size += Int64(chunk.readableBytes)
+                guard size <= maxBytes else {
+                    throw Abort(
+                        .payloadTooLarge,
+                        reason: "Volume upload exceeds the maximum allowed size of \(maxBytes) bytes")
+                }
+                let readable = chunk
+                if let bytes = readable.getBytes(at: readable.readerIndex, length: readable.readableBytes) {
+                    hasher.update(data: bytes)
+                }
+                try await writer.write(chunk)
+            }
+            guard size > 0 else {
+                throw Abort(.badRequest, reason: "Volume upload carried no bytes")
+            }
+            try await writer.finish()
+        } catch {
+            await writer.abort()
+            throw error
+        }
+
+        migration.sizeBytes = size
+        migration.sha256 = hasher.finalize().map { String(format: "%02x", $0) }.joined()
+        try await migration.save(on: req.db)
+
+        req.logger.info(
+            "Volume migration data stored",
+            metadata: [
+                "volumeId": .string(volumeId.uuidString),
+                "migrationId": .string(migrationId.uuidString),
+                "size": .stringConvertible(size),
+            ])
+        return .ok
+    }
+
+    /// GET /api/volumes/:volumeId/migrations/:migrationId/data
+    ///
+    /// Streams the uploaded disk to the target agent, range-aware via the
+    /// object store.
+    func downloadMigrationData(req: Request) async throws -> Response {
+        let (volume, migration) = try await authenticatedMigrationDataRequest(req: req)
+        guard migration.sha256 != nil else {
+            throw Abort(.notFound, reason: "The volume has not been uploaded yet")
+        }
+        let key = VolumeMigration.objectKey(volumeId: try volume.requireID(), migrationId: try migration.requireID())
+        return try await req.application.imageObjectStore.stream(
+            key: key, filename: "volume.\(volume.format.rawValue)", on: req)
+    }
+
+    /// Shared preflight for both directions: authenticate the caller's SVID
+    /// first — an unauthenticated caller learns nothing about which IDs
+    /// exist — then load a running copy migration of the volume.
+    private func authenticatedMigrationDataRequest(req: Request) async throws -> (Volume, VolumeMigration) {
+        guard AgentMTLSAuthenticator.hasClientCertificate(req) else {
+            throw Abort(
+                .unauthorized,
+                reason: "Volume migration transfer requires agent mTLS authentication")
+        }
+        let agent = try await AgentMTLSAuthenticator.authenticateAgent(req: req)
+
+        guard let volumeId = req.parameters.get("volumeId", as: UUID.self),
+            let migrationId = req.parameters.get("migrationId", as: UUID.self)
+        else {
+            throw Abort(.badRequest, reason: "Invalid volume migration path")
+        }
+        guard let migration = try await VolumeMigration.find(migrationId, on: req.db),
+            migration.$volume.id == volumeId,
+            let volume = try await Volume.find(volumeId, on: req.db)
+        else {
+            throw Abort(.notFound, reason: "Volume migration not found")
+        }
+        guard migration.status == .running, migration.mode == .copy else {
+            throw Abort(.conflict, reason: "Volume migration is not transferring data")
+        }
+        req.logger.info(
+            "Agent volume migration transfer authenticated",
+            metadata: [
+                "agent": .string(agent.identity.key),
+                "volumeId": .string(volumeId.uuidString),
+                "migrationId": .string(migrationId.uuidString),
+                "method": .string(req.method.rawValue),
+            ])
+        return (volume, migration)
+    }
+}
@@ -0,0 +1,250 @@
+import Fluent
+import StratoShared
+import Vapor
+
+/// Volume types: admin-defined classes of storage backed by a storage pool,
+/// plus per-project quotas on each type. Types are platform catalog — any
+/// signed-in user may list them to pick one at volume create; only system
+/// admins define them. Quotas are a project's business: members read them,
+/// project admins set them.
+struct VolumeTypeController: RouteCollection {
+    func boot(routes: RoutesBuilder) throws {
+        let types = routes.grouped("api", "volume-types").grouped(User.guardMiddleware())
+        types.get(use: listTypes)
+        types.post(use: createType)
+        types.get(":volumeTypeId", use: getType)
+        types.put(":volumeTypeId", use: updateType)
+        types.delete(":volumeTypeId", use: deleteType)
+
+        // Per-project quotas on a type
+        types.get(":volumeTypeId", "quotas", ":projectID", use: getQuota)
+        types.put(":volumeTypeId", "quotas", ":projectID", use: setQuota)
+        types.delete(":volumeTypeId", "quotas", ":projectID", use: deleteQuota)
+    }
+
+    // MARK: - Types
+
+    /// GET /api/volume-types
+    /// Query params: limit/offset (optional) — select the page.
+    @Sendable
+    func listTypes(req: Request) async throws -> PagedResponse<VolumeTypeResponse> {
+        let paging = try ListPaging.decode(from: req)
+        let types = try await VolumeTypeDefinition.query(on: req.db).sort(\.$name).sort(\.$id).all()
+        return paging.page(try types.map { try VolumeTypeResponse(from: $0) })
+    }
+
+    /// GET /api/volume-types/:volumeTypeId
+    @Sendable
+    func getType(req: Request) async throws -> VolumeTypeResponse {
+        try VolumeTypeResponse(from: try await findType(req))
+    }
+
+    /// POST /api/volume-types
+    @Sendable
+    func createType(req: Request) async throws -> VolumeTypeResponse {
+        _ = try req.requireSystemAdmin("Only system administrators can define volume types")
+        let create = try req.content.decode(CreateVolumeTypeRequest.self)
+
+        let name = create.name.trimmingCharacters(in: .whitespacesAndNewlines)
+        guard !name.isEmpty, name.count <= 100 else {
+            throw Abort(.badRequest, reason: "Volume type name must be 1-100 characters")
+        }
+
+        let pool: StoragePool
+        if let poolId = create.poolId {
+            guard let found = try await StoragePool.find(poolId, on: req.db) else {
+                throw Abort(.badRequest, reason: "Storage pool \(poolId) does not exist")
+            }
+            pool = found
+        } else {
+            pool = try await StoragePool.defaultPool(on: req.db)
+        }
+
+        let format = try VolumeNaming.parseFormat(create.defaultFormat)
+        let replicationFactor = create.replicationFactor ?? 1
+        if let failure = VolumeTypeDefinition.validationFailure(
+            pool: pool,
+            replicationFactor: replicationFactor,
+            maxIOPS: create.maxIOPS,
+            maxBytesPerSecond: create.maxBytesPerSecond
+        ) {
+            throw Abort(.badRequest, reason: failure)
+        }
+
+        let volumeType = VolumeTypeDefinition(
+            name: name,
+            description: create.description ?? "",
+            poolID: try pool.requireID(),
+            defaultFormat: format,
+            replicationFactor: replicationFactor,
+            maxIOPS: create.maxIOPS,
+            maxBytesPerSecond: create.maxBytesPerSecond,
+            requiresEncryption: create.requiresEncryption ?? false
+        )
+        do {
+            try await volumeType.save(on: req.db)
+        } catch let error as any DatabaseError where error.isConstraintFailure {
+            throw Abort(.conflict, reason: "A volume type named '\(name)' already exists")
+        }
+
+        return try VolumeTypeResponse(from: volumeType)
+    }
+
+    /// PUT /api/volume-types/:volumeTypeId — full-replace of the mutable
+    /// fields. New I/O limits apply to volumes as they are next attached (or
+    /// their VM next boots); running attachments keep the limits they got.
+    @Sendable
+    func updateType(req: Request) async throws -> VolumeTypeResponse {
+        _ = try req.requireSystemAdmin("Only system administrators can modify volume types")
+        let volumeType = try await findType(req)
+        let update = try req.content.decode(UpdateVolumeTypeRequest.self)
+
+        let pool = try await volumeType.$pool.get(on: req.db)
+        if let failure = VolumeTypeDefinition.validationFailure(
+            pool: pool,
+            replicationFactor: volumeType.replicationFactor,
+            maxIOPS: update.maxIOPS,
+            maxBytesPerSecond: update.maxBytesPerSecond
+        ) {
+            throw Abort(.badRequest, reason: failure)
+        }
+
+        volumeType.description = update.description ?? ""
+        volumeType.defaultFormat = try VolumeNaming.parseFormat(update.defaultFormat)
+        volumeType.maxIOPS = update.maxIOPS
+        volumeType.maxBytesPerSecond = update.maxBytesPerSecond
+        try await volumeType.save(on: req.db)
+
+        return try VolumeTypeResponse(from: volumeType)
+    }
+
+    /// DELETE /api/volume-types/:volumeTypeId — refused while any volume
+    /// still has the type; its quotas go with it.
+    @Sendable
+    func deleteType(req: Request) async throws -> HTTPStatus {
+        _ = try req.requireSystemAdmin("Only system administrators can delete volume types")
+        let volumeType = try await findType(req)
+        let typeId = try volumeType.requireID()
+
+        let inUse = try await Volume.query(on: req.db)
+            .filter(\.$typeDefinition.$id == typeId)
+            .count()
+        guard inUse == 0 else {
+            throw Abort(
+                .conflict,
+                reason: "Volume type '\(volumeType.name)' is used by \(inUse) volume(s); retype or delete them first")
+        }
+
+        try await volumeType.delete(on: req.db)
+        return .noContent
+    }
+
+    // MARK: - Quotas
+
+    /// GET /api/volume-types/:volumeTypeId/quotas/:projectID — the project's
+    /// allowance and current usage. A project without a quota row reports
+    /// no limits.
+    @Sendable
+    func getQuota(req: Request) async throws -> VolumeTypeQuotaResponse {
+        let volumeType = try await findType(req)
+        let project = try await findProject(req)
+        try await OrganizationAccessService.requireProjectMember(project: project, on: req)
+
+        let typeId = try volumeType.requireID()
+        let projectId = try project.requireID()
+        let quota =
+            try await findQuota(volumeTypeID: typeId, projectID: projectId, on: req.db)
+            ?? VolumeTypeQuota(volumeTypeID: typeId, projectID: projectId)
+        let usage = try await VolumeTypeQuotaService.usage(volumeTypeID: typeId, projectID: projectId, on: req.db)
+        return VolumeTypeQuotaResponse(from: quota, usedVolumes: usage.volumes, usedStorageBytes: usage.bytes)
+    }
+
+    /// PUT /api/volume-types/:volumeTypeId/quotas/:projectID
+    /// Body: { "maxVolumes"?: int, "maxStorageGB"?: int } — nil clears a limit.
+    /// A limit below current usage is accepted: it blocks growth, it does not
+    /// evict existing volumes.
+    @Sendable
+    func setQuota(req: Request) async throws -> VolumeTypeQuotaResponse {
+        let volumeType = try await findType(req)
+        let project = try await findProject(req)
+        try await OrganizationAccessService.requireProjectAdmin(project: project, on: req)
+        let request = try req.content.decode(SetVolumeTypeQuotaRequest.self)
+
+        if let maxVolumes = request.maxVolumes, maxVolumes < 0 {
+            throw Abort(.badRequest, reason: "'maxVolumes' must not be negative")
+        }
+        var maxStorageBytes: Int64?
+        if let maxStorageGB = request.maxStorageGB {
+            guard maxStorageGB >= 0 else {
+                throw Abort(.badRequest, reason: "'maxStorageGB' must not be negative")
+            }
+            guard let bytes = maxStorageGB.gbToBytes else {
+                throw Abort(.badRequest, reason: "'maxStorageGB' is too large")
+            }
+            maxStorageBytes = bytes
+        }
+
+        let typeId = try volumeType.requireID()
+        let projectId = try project.requireID()
+        let quota =
+            try await findQuota(volumeTypeID: typeId, projectID: projectId, on: req.db)
+            ?? VolumeTypeQuota(volumeTypeID: typeId, projectID: projectId)
+        quota.maxVolumes = request.maxVolumes
+        quota.maxStorageBytes = maxStorageBytes
+        do {
+            try await quota.save(on: req.db)
+        } catch let error as any DatabaseError where error.isConstraintFailure {
+            throw Abort(.conflict, reason: "The quota was set concurrently; retry")
+        }
+
+        let usage = try await VolumeTypeQuotaService.usage(volumeTypeID: typeId, projectID: projectId, on: req.db)
+        return VolumeTypeQuotaResponse(from: quota, usedVolumes: usage.volumes, usedStorageBytes: usage.bytes)
+    }
+
+    /// DELETE /api/volume-types/:volumeTypeId/quotas/:projectID — the
+    /// project becomes unlimited for the type.
+    @Sendable
+    func deleteQuota(req: Request) async throws -> HTTPStatus {
+        let volumeType = try await findType(req)
+        let project = try await findProject(req)
+        try await OrganizationAccessService.requireProjectAdmin(project: project, on: req)
+
+        guard
+            let quota = try await findQuota(
+                volumeTypeID: try volumeType.requireID(), projectID: try project.requireID(), on: req.db)
+        else {
+            throw Abort(.notFound, reason: "No quota is set for this volume type in this project")
+        }
+        try await quota.delete(on: req.db)
+        return .noContent
+    }
+
+    // MARK: - Helpers
+
+    private func findType(_ req: Request) async throws -> VolumeTypeDefinition {
+        guard let typeId = req.parameters.get("volumeTypeId", as: UUID.self) else {
+            throw Abort(.badRequest, reason: "Invalid volume type ID")
+        }
+        guard let volumeType = try await VolumeTypeDefinition.find(typeId, on: req.db) else {
+            throw Abort(.notFound, reason: "Volume type not found")
+        }
+        return volumeType
+    }
+
+    private func findProject(_ req: Request) async throws -> Project {
+        guard let projectId = req.parameters.get("projectID", as: UUID.self) else {
+            throw Abort(.badRequest, reason: "Invalid project ID")
+        }
+        guard let project = try await Project.find(projectId, on: req.db) else {
+            throw Abort(.notFound, reason: "Project not found")
+        }
+        return project
+    }
+
+    private func findQuota(volumeTypeID: UUID, projectID: UUID, on db: Database) async throws -> VolumeTypeQuota? {
+        try await VolumeTypeQuota.query(on: db)
+            .filter(\.$volumeType.$id == volumeTypeID)
+            .filter(\.$project.$id == projectID)
+            .first()
+    }
+}
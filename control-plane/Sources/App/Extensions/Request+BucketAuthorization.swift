@@ -0,0 +1,19 @@
+import Fluent
+import Vapor
+
+extension Request {
+    /// Fetch a bucket and enforce a permission on it in one call, through the
+    /// evaluator — `authorizedFileShare(_:permission:)` for buckets.
+    ///
+    /// - Throws: `.unauthorized` if unauthenticated, `.notFound` if the bucket
+    ///   does not exist, `.forbidden` if the user lacks `permission` on it.
+    func authorizedBucket(_ bucketID: UUID, permission: String) async throws -> Bucket {
+        guard let bucket = try await Bucket.find(bucketID, on: db) else {
+            throw Abort(.notFound)
+        }
+
+        try await authorize(permission, on: "bucket", id: bucket.id?.uuidString ?? "")
+
+        return bucket
+    }
+}
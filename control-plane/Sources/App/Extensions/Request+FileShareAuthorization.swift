@@ -0,0 +1,19 @@
+import Fluent
+import Vapor
+
+extension Request {
+    /// Fetch a file share and enforce a permission on it in one call, through
+    /// the evaluator — `authorizedSandbox(_:permission:)` for shares.
+    ///
+    /// - Throws: `.unauthorized` if unauthenticated, `.notFound` if the share
+    ///   does not exist, `.forbidden` if the user lacks `permission` on it.
+    func authorizedFileShare(_ shareID: UUID, permission: String) async throws -> FileShare {
+        guard let share = try await FileShare.find(shareID, on: db) else {
+            throw Abort(.notFound)
+        }
+
+        try await authorize(permission, on: "file_share", id: share.id?.uuidString ?? "")
+
+        return share
+    }
+}
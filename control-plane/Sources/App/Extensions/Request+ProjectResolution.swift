@@ -27,6 +27,31 @@ extension Request {
         user: User,
         resourceKind: String
     ) async throws -> (project: Project, environment: String) {
+        let project = try await authorizeCreateProject(
+            requestedProjectId: requestedProjectId, user: user, resourceKind: resourceKind)
+
+        // Determine and validate the environment.
+        let environment = requestedEnvironment ?? project.defaultEnvironment
+        if !project.hasEnvironment(environment) {
+            throw Abort(
+                .badRequest,
+                reason:
+                    "Environment '\(environment)' not available in project. Available: \(project.environments.joined(separator: ", "))"
+            )
+        }
+
+        return (project, environment)
+    }
+
+    /// Steps 1 and 2 of `resolveProjectForCreate`: the target project, once
+    /// the caller may create in it. Create handlers call this on the body as
+    /// decoded, before `admitCreate`, so admission webhooks never see a
+    /// request from a caller who couldn't make it.
+    func authorizeCreateProject(
+        requestedProjectId: UUID?,
+        user: User,
+        resourceKind: String
+    ) async throws -> Project {
         // Determine project context.
         let projectId: UUID
         if let requestedProjectId {
@@ -59,7 +84,7 @@ extension Request {
             projectId = project.id!
         }
 
-        // Re-fetch the resolved project to validate the environment.
+        // Re-fetch the resolved project; the environment is validated against it.
         guard let project = try await Project.find(projectId, on: db) else {
             throw Abort(.internalServerError, reason: "Project not found")
         }
@@ -74,16 +99,6 @@ extension Request {
             throw Abort(.forbidden, reason: "You don't have permission to create \(resourceKind) in this project")
         }
 
-        // Determine and validate the environment.
-        let environment = requestedEnvironment ?? project.defaultEnvironment
-        if !project.hasEnvironment(environment) {
-            throw Abort(
-                .badRequest,
-                reason:
-                    "Environment '\(environment)' not available in project. Available: \(project.environments.joined(separator: ", "))"
-            )
-        }
-
-        return (project, environment)
+        return project
     }
 }
@@ -0,0 +1,541 @@
+import Foundation
+import StratoShared
+
+/// One entry of a response's `errors` array. `path` names the field that
+/// failed by response key; batched resolution fails a field for every parent
+/// at once, so list indices are not included.
+struct GraphQLError: Error, Sendable {
+    let message: String
+    var path: [String]
+
+    init(_ message: String, path: [String] = []) {
+        self.message = message
+        self.path = path
+    }
+
+    var response: CodableValue {
+        var entry: [String: CodableValue] = ["message": .string(message)]
+        if !path.isEmpty {
+            entry["path"] = .array(path.map { .string($0) })
+        }
+        return .object(entry)
+    }
+}
+
+/// A literal or variable reference as written in a document.
+indirect enum GraphQLValue: Sendable, Equatable {
+    case variable(String)
+    case int(Int)
+    case float(Double)
+    case string(String)
+    case boolean(Bool)
+    case null
+    case enumValue(String)
+    case list([GraphQLValue])
+    case object([String: GraphQLValue])
+
+    /// A JSON variable value as a document value.
+    init(_ value: CodableValue) {
+        switch value {
+        case .string(let string): self = .string(string)
+        case .int(let int): self = .int(int)
+        case .double(let double): self = .float(double)
+        case .bool(let bool): self = .boolean(bool)
+        case .array(let items): self = .list(items.map(GraphQLValue.init))
+        case .object(let fields): self = .object(fields.mapValues(GraphQLValue.init))
+        case .null: self = .null
+        }
+    }
+}
+
+struct GraphQLDirective: Sendable, Equatable {
+    let name: String
+    let arguments: [String: GraphQLValue]
+}
+
+struct GraphQLFieldNode: Sendable {
+    let alias: String?
+    let name: String
+    let arguments: [String: GraphQLValue]
+    let directives: [GraphQLDirective]
+    let selections: [GraphQLSelection]
+
+    var responseKey: String { alias ?? name }
+}
+
+enum GraphQLSelection: Sendable {
+    case field(GraphQLFieldNode)
+    case fragmentSpread(name: String, directives: [GraphQLDirective])
+    case inlineFragment(typeCondition: String?, directives: [GraphQLDirective], selections: [GraphQLSelection])
+}
+
+struct GraphQLVariableDefinition: Sendable {
+    let name: String
+    let type: GraphQLTypeRef
+    let defaultValue: GraphQLValue?
+}
+
+struct GraphQLOperation: Sendable {
+    enum Kind: String, Sendable {
+        case query
+        case mutation
+        case subscription
+    }
+
+    let kind: Kind
+    let name: String?
+    let variables: [GraphQLVariableDefinition]
+    let selections: [GraphQLSelection]
+}
+
+struct GraphQLFragment: Sendable {
+    let name: String
+    let typeCondition: String
+    let selections: [GraphQLSelection]
+}
+
+/// A parsed executable document: operations and the fragments they spread.
+/// Type-system definitions (SDL) are not accepted — the schema is fixed in
+/// code, and `GET /api/graphql/schema` prints it.
+struct GraphQLDocument: Sendable {
+    let operations: [GraphQLOperation]
+    let fragments: [String: GraphQLFragment]
+
+    /// Nesting allowed while parsing, well past any depth the executor
+    /// accepts, so a hostile document fails here rather than on the stack.
+    static let maxParseDepth = 64
+
+    static func parse(_ source: String) throws -> GraphQLDocument {
+        var parser = GraphQLParser(tokens: try GraphQLLexer.tokenize(source))
+        return try parser.document()
+    }
+
+    /// The operation to run: the named one, or the only one when no name is
+    /// given.
+    func operation(named name: String?) throws -> GraphQLOperation {
+        if let name, !name.isEmpty {
+            guard let operation = operations.first(where: { $0.name == name }) else {
+                throw GraphQLError("Unknown operation named \"\(name)\"")
+            }
+            return operation
+        }
+        guard operations.count == 1, let operation = operations.first else {
+            throw GraphQLError("Must provide operation name if query contains multiple operations")
+        }
+        return operation
+    }
+}
+
+// MARK: - Lexer
+
+private enum GraphQLToken: Equatable {
+    case punctuator(String)
+    case name(String)
+    case int(Int)
+    case float(Double)
+    case string(String)
+    case end
+
+    var display: String {
+        switch self {
+        case .punctuator(let value): "\"\(value)\""
+        case .name(let value): "name \"\(value)\""
+        case .int(let value): "\(value)"
+        case .float(let value): "\(value)"
+        case .string: "string"
+        case .end: "end of document"
+        }
+    }
+}
+
+private enum GraphQLLexer {
+    static func tokenize(_ source: String) throws -> [GraphQLToken] {
+        let scalars = Array(source.unicodeScalars)
+        var tokens: [GraphQLToken] = []
+        var index = 0
+        while index < scalars.count {
+            let scalar = scalars[index]
+            switch scalar {
+            case " ", "\t", "\n", "\r", ",", "\u{FEFF}":
+                index += 1
+            case "#":
+                while index < scalars.count, scalars[index] != "\n", scalars[index] != "\r" {
+                    index += 1
+                }
+            case "!", "$", "&", "(", ")", ":", "=", "@", "[", "]", "{", "|", "}":
+                tokens.append(.punctuator(String(scalar)))
+                index += 1
+            case ".":
+                guard index + 2 < scalars.count, scalars[index + 1] == ".", scalars[index + 2] == "." else {
+                    throw GraphQLError("Syntax error: unexpected \".\"")
+                }
+                tokens.append(.punctuator("..."))
+                index += 3
+            case "\"":
+                if index + 2 < scalars.count, scalars[index + 1] == "\"", scalars[index + 2] == "\"" {
+                    tokens.append(.string(try blockString(scalars, &index)))
+                } else {
+                    tokens.append(.string(try string(scalars, &index)))
+                }
+            case "-", "0"..."9":
+                tokens.append(try number(scalars, &index))
+            case "_", "a"..."z", "A"..."Z":
+                let start = index
+                while index < scalars.count, isNameContinue(scalars[index]) {
+                    index += 1
+                }
+                tokens.append(.name(String(String.UnicodeScalarView(scalars[start..<index]))))
+            default:
+                throw GraphQLError("Syntax error: unexpected character \"\(scalar.escaped(asASCII: true))\"")
+            }
+        }
+        tokens.append(.end)
+        return tokens
+    }
+
+    private static func isNameContinue(_ scalar: Unicode.Scalar) -> Bool {
+        switch scalar {
+        case "_", "a"..."z", "A"..."Z", "0"..."9": true
+        default: false
+        }
+    }
+
+    private static func isDigit(_ scalar: Unicode.Scalar) -> Bool {
+        scalar.value >= 0x30 && scalar.value <= 0x39
+    }
+
+    private static func number(_ scalars: [Unicode.Scalar], _ index: inout Int) throws -> GraphQLToken {
+        let start = index
+        var isFloat = false
+        if scalars[index] == "-" { index += 1 }
+        func digits() throws {
+            let digitsStart = index
+            while index < scalars.count, isDigit(scalars[index]) {
+                index += 1
+            }
+            guard index > digitsStart else { throw GraphQLError("Syntax error: invalid number") }
+        }
+        try digits()
+        if index < scalars.count, scalars[index] == "." {
+            isFloat = true
+            index += 1
+            try digits()
+        }
+        if index < scalars.count, scalars[index] == "e" || scalars[index] == "E" {
+            isFloat = true
+            index += 1
+            if index < scalars.count, scalars[index] == "+" || scalars[index] == "-" { index += 1 }
+            try digits()
+        }
+        if index < scalars.count, isNameContinue(scalars[index]) || scalars[index] == "." {
+            throw GraphQLError("Syntax error: invalid number")
+        }
+        let text = String(String.UnicodeScalarView(scalars[start..<index]))
+        if isFloat {
+            guard let value = Double(text) else { throw GraphQLError("Syntax error: invalid number \(text)") }
+            return .float(value)
+        }
+        guard let value = Int(text) else { throw GraphQLError("Syntax error: integer \(text) is out of range") }
+        return .int(value)
+    }
+
+    private static func string(_ scalars: [Unicode.Scalar], _ index: inout Int) throws -> String {
+        index += 1
+        var result = String.UnicodeScalarView()
+        while index < scalars.count {
+            let scalar = scalars[index]
+            switch scalar {
+            case "\"":
+                index += 1
+                return String(result)
+            case "\n", "\r":
+                throw GraphQLError("Syntax error: unterminated string")
+            case "\\":
+                guard index + 1 < scalars.count else { throw GraphQLError("Syntax error: unterminated string") }
+                let escaped = scalars[index + 1]
+                index += 2
+                switch escaped {
+                case "\"", "\\", "/": result.append(escaped)
+                case "b": result.append("\u{08}")
+                case "f": result.append("\u{0C}")
+                case "n": result.append("\n")
+                case "r": result.append("\r")
+                case "t": result.append("\t")
+                case "u":
+                    guard index + 4 <= scalars.count,
+                        let code = UInt32(String(String.UnicodeScalarView(scalars[index..<index + 4])), radix: 16),
+                        let decoded = Unicode.Scalar(code)
+                    else { throw GraphQLError("Syntax error: invalid unicode escape") }
+                    result.append(decoded)
+                    index += 4
+                default:
+                    throw GraphQLError("Syntax error: invalid escape \"\\\(escaped)\"")
+                }
+            default:
+                result.append(scalar)
+                index += 1
+            }
+        }
+        throw GraphQLError("Syntax error: unterminated string")
+    }
+
+    /// A `"""` block string: raw text with `\"""` as the only escape, common
+    /// indentation removed and blank first and last lines dropped.
+    private static func blockString(_ scalars: [Unicode.Scalar], _ index: inout Int) throws -> String {
+        index += 3
+        var raw = String.UnicodeScalarView()
+        while index < scalars.count {
+            if scalars[index] == "\"", index + 2 < scalars.count, scalars[index + 1] == "\"",
+                scalars[index + 2] == "\""
+            {
+                index += 3
+                return dedent(String(raw))
+            }
+            if scalars[index] == "\\", index + 3 < scalars.count, scalars[index + 1] == "\"",
+                scalars[index + 2] == "\"", scalars[index + 3] == "\""
+            {
+                raw.append(contentsOf: "\"\"\"".unicodeScalars)
+                index += 4
+                continue
+            }
+            raw.append(scalars[index])
+            index += 1
+        }
+        throw GraphQLError("Syntax error: unterminated block string")
+    }
+
+    private static func dedent(_ raw: String) -> String {
+        var lines = raw.replacingOccurrences(of: "\r\n", with: "\n")
+            .split(separator: "\n", omittingEmptySubsequences: false)
+            .map(String.init)
+        let indents = lines.dropFirst().compactMap { line -> Int? in
+            let indent = line.prefix { $0 == " " || $0 == "\t" }.count
+            return indent < line.count ? indent : nil
+        }
+        if let common = indents.min(), common > 0 {
+            lines = [lines[0]] + lines.dropFirst().map { String($0.dropFirst(min(common, $0.count))) }
+        }
+        while let first = lines.first, first.allSatisfy({ $0 == " " || $0 == "\t" }) { lines.removeFirst() }
+        while let last = lines.last, last.allSatisfy({ $0 == " " || $0 == "\t" }) { lines.removeLast() }
+        return lines.joined(separator: "\n")
+    }
+}
+
+// MARK: - Parser
+
+private struct GraphQLParser {
+    let tokens: [GraphQLToken]
+    var position = 0
+    var depth = 0
+
+    init(tokens: [GraphQLToken]) {
+        self.tokens = tokens
+    }
+
+    private var peek: GraphQLToken { tokens[position] }
+
+    private mutating func advance() -> GraphQLToken {
+        let token = tokens[position]
+        if token != .end { position += 1 }
+        return token
+    }
+
+    private mutating func skip(_ punctuator: String) -> Bool {
+        guard peek == .punctuator(punctuator) else { return false }
+        position += 1
+        return true
+    }
+
+    private mutating func expect(_ punctuator: String) throws {
+        guard skip(punctuator) else { throw unexpected() }
+    }
+
+    private mutating func name() throws -> String {
+        guard case .name(let name) = peek else { throw unexpected() }
+        position += 1
+        return name
+    }
+
+    private func unexpected() -> GraphQLError {
+        GraphQLError("Syntax error: unexpected \(peek.display)")
+    }
+
+    private mutating func nested<T>(_ body: (inout GraphQLParser) throws -> T) throws -> T {
+        depth += 1
+        defer { depth -= 1 }
+        guard depth <= GraphQLDocument.maxParseDepth else {
+            throw GraphQLError("Document nests more than \(GraphQLDocument.maxParseDepth) levels")
+        }
+        return try body(&self)
+    }
+
+    mutating func document() throws -> GraphQLDocument {
+        var operations: [GraphQLOperation] = []
+        var fragments: [String: GraphQLFragment] = [:]
+        repeat {
+            switch peek {
+            case .punctuator("{"):
+                operations.append(
+                    GraphQLOperation(kind: .query, name: nil, variables: [], selections: try selectionSet()))
+            case .name("query"), .name("mutation"), .name("subscription"):
+                operations.append(try operation())
+            case .name("fragment"):
+                let fragment = try fragment()
+                guard fragments[fragment.name] == nil else {
+                    throw GraphQLError("There can be only one fragment named \"\(fragment.name)\"")
+                }
+                fragments[fragment.name] = fragment
+            default:
+                throw unexpected()
+            }
+        } while peek != .end
+        guard !operations.isEmpty else { throw GraphQLError("Document contains no operation") }
+        return GraphQLDocument(operations: operations, fragments: fragments)
+    }
+
+    private mutating func operation() throws -> GraphQLOperation {
+        guard let kind = GraphQLOperation.Kind(rawValue: try name()) else { throw unexpected() }
+        var operationName: String?
+        if case .name(let value) = peek {
+            operationName = value
+            position += 1
+        }
+        var variables: [GraphQLVariableDefinition] = []
+        if skip("(") {
+            repeat {
+                try expect("$")
+                let variable = try name()
+                try expect(":")
+                let type = try typeRef()
+                let defaultValue = skip("=") ? try value(const: true) : nil
+                variables.append(GraphQLVariableDefinition(name: variable, type: type, defaultValue: defaultValue))
+            } while !skip(")")
+        }
+        _ = try directives()
+        return GraphQLOperation(kind: kind, name: operationName, variables: variables, selections: try selectionSet())
+    }
+
+    private mutating func fragment() throws -> GraphQLFragment {
+        _ = try name()
+        let fragmentName = try name()
+        guard fragmentName != "on", try name() == "on" else { throw unexpected() }
+        let typeCondition = try name()
+        _ = try directives()
+        return GraphQLFragment(name: fragmentName, typeCondition: typeCondition, selections: try selectionSet())
+    }
+
+    private mutating func typeRef() throws -> GraphQLTypeRef {
+        let base: GraphQLTypeRef
+        if skip("[") {
+            let inner = try nested { try $0.typeRef() }
+            try expect("]")
+            base = .list(inner)
+        } else {
+            base = .named(try name())
+        }
+        return skip("!") ? .nonNull(base) : base
+    }
+
+    private mutating func selectionSet() throws -> [GraphQLSelection] {
+        try expect("{")
+        return try nested { parser in
+            var selections: [GraphQLSelection] = []
+            repeat {
+                selections.append(try parser.selection())
+            } while !parser.skip("}")
+            return selections
+        }
+    }
+
+    private mutating func selection() throws -> GraphQLSelection {
+        if skip("...") {
+            if case .name(let value) = peek, value != "on" {
+                position += 1
+                return .fragmentSpread(name: value, directives: try directives())
+            }
+            var typeCondition: String?
+            if peek == .name("on") {
+                position += 1
+                typeCondition = try name()
+            }
+            return .inlineFragment(
+                typeCondition: typeCondition, directives: try directives(), selections: try selectionSet())
+        }
+        var alias: String?
+        var fieldName = try name()
+        if skip(":") {
+            alias = fieldName
+            fieldName = try name()
+        }
+        let arguments = try self.arguments(const: false)
+        let directives = try self.directives()
+        let selections = peek == .punctuator("{") ? try selectionSet() : []
+        return .field(
+            GraphQLFieldNode(
+                alias: alias, name: fieldName, arguments: arguments, directives: directives, selections: selections))
+    }
+
+    private mutating func arguments(const: Bool) throws -> [String: GraphQLValue] {
+        guard skip("(") else { return [:] }
+        var arguments: [String: GraphQLValue] = [:]
+        repeat {
+            let argument = try name()
+            try expect(":")
+            guard arguments[argument] == nil else {
+                throw GraphQLError("There can be only one argument named \"\(argument)\"")
+            }
+            arguments[argument] = try value(const: const)
+        } while !skip(")")
+        return arguments
+    }
+
+    private mutating func directives() throws -> [GraphQLDirective] {
+        var directives: [GraphQLDirective] = []
+        while skip("@") {
+            directives.append(GraphQLDirective(name: try name(), arguments: try arguments(const: false)))
+        }
+        return directives
+    }
+
+    private mutating func value(const: Bool) throws -> GraphQLValue {
+        let token = advance()
+        switch token {
+        case .punctuator("$") where !const:
+            return .variable(try name())
+        case .int(let value):
+            return .int(value)
+        case .float(let value):
+            return .float(value)
+        case .string(let value):
+            return .string(value)
+        case .name("true"):
+            return .boolean(true)
+        case .name("false"):
+            return .boolean(false)
+        case .name("null"):
+            return .null
+        case .name(let value):
+            return .enumValue(value)
+        case .punctuator("["):
+            return try nested { parser in
+                var items: [GraphQLValue] = []
+                while !parser.skip("]") {
+                    items.append(try parser.value(const: const))
+                }
+                return .list(items)
+            }
+        case .punctuator("{"):
+            return try nested { parser in
+                var fields: [String: GraphQLValue] = [:]
+                while !parser.skip("}") {
+                    let field = try parser.name()
+                    try parser.expect(":")
+                    fields[field] = try parser.value(const: const)
+                }
+                return .object(fields)
+            }
+        default:
+            throw GraphQLError("Syntax error: unexpected \(token.display)")
+        }
+    }
+}
@@ -0,0 +1,434 @@
+import Foundation
+import StratoShared
+import Vapor
+
+/// The parent of a query's root fields.
+struct GraphQLRoot: Sendable {}
+
+/// One field of a validated document, with its arguments coerced and its
+/// selection resolved against the schema.
+struct GraphQLPlannedField: Sendable {
+    let responseKey: String
+    /// Nil for `__typename`.
+    let definition: GraphQLFieldDefinition?
+    let arguments: GraphQLArguments
+    /// The field's object type; nil for leaves.
+    let objectType: GraphQLObjectType?
+    let children: [GraphQLPlannedField]
+    let cost: Int
+}
+
+/// A document validated against the schema and within the limits, ready to
+/// run as many times as needed (once for a query, once per event for a
+/// subscription).
+struct GraphQLPlan: Sendable {
+    let kind: GraphQLOperation.Kind
+    let rootType: GraphQLObjectType
+    let fields: [GraphQLPlannedField]
+    let cost: Int
+}
+
+/// Validates and runs documents against a `GraphQLSchema`.
+///
+/// Execution is breadth-first: each field is resolved once per level for
+/// every parent reached so far, so `projects { vms { volumes } }` is three
+/// batched resolver calls — typically three queries — however many projects
+/// and VMs there are. The objects a level produces pass the Cedar read gate
+/// of their type in one `canFilter` batch per action; a denied object is
+/// dropped from a list, or null in place of a single object, exactly as the
+/// REST list endpoints omit rows and the item endpoints answer 404.
+struct GraphQLExecutor: Sendable {
+    let schema: GraphQLSchema
+    let limits: GraphQLLimits
+
+    // MARK: - Planning
+
+    func plan(
+        _ source: String, operationName: String?, variables: [String: CodableValue]?
+    ) throws -> GraphQLPlan {
+        let document = try GraphQLDocument.parse(source)
+        let operation = try document.operation(named: operationName)
+        let rootName: String
+        switch operation.kind {
+        case .query:
+            rootName = schema.query
+        case .mutation:
+            throw GraphQLError("Mutations are not supported; changes go through the REST API")
+        case .subscription:
+            guard let subscription = schema.subscription else {
+                throw GraphQLError("Subscriptions are not supported")
+            }
+            rootName = subscription
+        }
+        guard let rootType = schema.types[rootName] else {
+            throw GraphQLError("Schema has no \(rootName) type")
+        }
+
+        let planner = Planner(
+            schema: schema, limits: limits, fragments: document.fragments,
+            variables: try coerceVariables(operation.variables, values: variables ?? [:]))
+        let fields = try planner.selections(operation.selections, on: rootType, depth: 1)
+        if operation.kind == .subscription, fields.count != 1 {
+            throw GraphQLError("A subscription must select exactly one root field")
+        }
+        let cost = fields.reduce(0) { $0 + $1.cost }
+        guard cost <= limits.maxCost else {
+            throw GraphQLError("Query cost \(cost) exceeds the limit of \(limits.maxCost)")
+        }
+        return GraphQLPlan(kind: operation.kind, rootType: rootType, fields: fields, cost: cost)
+    }
+
+    private func coerceVariables(
+        _ definitions: [GraphQLVariableDefinition], values: [String: CodableValue]
+    ) throws -> [String: GraphQLValue] {
+        var coerced: [String: GraphQLValue] = [:]
+        for definition in definitions {
+            guard schema.isScalar(definition.type.namedType) else {
+                throw GraphQLError(
+                    "Variable \"$\(definition.name)\" has type \"\(definition.type)\", which is not an input type")
+            }
+            let value = values[definition.name].map(GraphQLValue.init) ?? definition.defaultValue ?? .null
+            coerced[definition.name] = try Planner.coerce(
+                value, to: definition.type, describing: "Variable \"$\(definition.name)\"")
+        }
+        return coerced
+    }
+
+    private struct Planner {
+        let schema: GraphQLSchema
+        let limits: GraphQLLimits
+        let fragments: [String: GraphQLFragment]
+        let variables: [String: GraphQLValue]
+
+        func selections(
+            _ selections: [GraphQLSelection], on type: GraphQLObjectType, depth: Int
+        ) throws -> [GraphQLPlannedField] {
+            guard depth <= limits.maxDepth else {
+                throw GraphQLError("Query exceeds the maximum depth of \(limits.maxDepth)")
+            }
+            var grouped: [(key: String, nodes: [GraphQLFieldNode])] = []
+            try collect(selections, on: type, into: &grouped, spreading: [])
+            return try grouped.map { try field($0.key, nodes: $0.nodes, on: type, depth: depth) }
+        }
+
+        /// Flattens fragments and applies `@skip`/`@include`, grouping the
+        /// fields by response key in first-seen order.
+        private func collect(
+            _ selections: [GraphQLSelection], on type: GraphQLObjectType,
+            into grouped: inout [(key: String, nodes: [GraphQLFieldNode])], spreading: Set<String>
+        ) throws {
+            for selection in selections {
+                switch selection {
+                case .field(let node):
+                    guard try included(node.directives) else { continue }
+                    if let index = grouped.firstIndex(where: { $0.key == node.responseKey }) {
+                        grouped[index].nodes.append(node)
+                    } else {
+                        grouped.append((node.responseKey, [node]))
+                    }
+                case .fragmentSpread(let name, let directives):
+                    guard try included(directives) else { continue }
+                    guard let fragment = fragments[name] else {
+                        throw GraphQLError("Unknown fragment \"\(name)\"")
+                    }
+                    guard !spreading.contains(name) else {
+                        throw GraphQLError("Cannot spread fragment \"\(name)\" within itself")
+                    }
+                    try requireCondition(fragment.typeCondition, on: type)
+                    try collect(fragment.selections, on: type, into: &grouped, spreading: spreading.union([name]))
+                case .inlineFragment(let typeCondition, let directives, let selections):
+                    guard try included(directives) else { continue }
+                    if let typeCondition { try requireCondition(typeCondition, on: type) }
+                    try collect(selections, on: type, into: &grouped, spreading: spreading)
+                }
+            }
+        }
+
+        /// Every type is a concrete object type — there are no interfaces or
+        /// unions — so a fragment applies only to its own type.
+        private func requireCondition(_ condition: String, on type: GraphQLObjectType) throws {
+            guard schema.types[condition] != nil else {
+                throw GraphQLError("Unknown type \"\(condition)\"")
+            }
+            guard condition == type.name else {
+                throw GraphQLError("Fragment on \"\(condition)\" cannot be spread within type \"\(type.name)\"")
+            }
+        }
+
+        private func included(_ directives: [GraphQLDirective]) throws -> Bool {
+            for directive in directives {
+                guard directive.name == "skip" || directive.name == "include" else {
+                    throw GraphQLError("Unknown directive \"@\(directive.name)\"")
+                }
+                let condition = try Self.coerce(
+                    substitute(directive.arguments["if"] ?? .null), to: .nonNull(.named("Boolean")),
+                    describing: "Argument \"if\" of \"@\(directive.name)\"")
+                guard case .boolean(let value) = condition else { continue }
+                if (directive.name == "skip") == value { return false }
+            }
+            return true
+        }
+
+        private func field(
+            _ key: String, nodes: [GraphQLFieldNode], on type: GraphQLObjectType, depth: Int
+        ) throws -> GraphQLPlannedField {
+            let node = nodes[0]
+            for other in nodes.dropFirst() where other.name != node.name || other.arguments != node.arguments {
+                throw GraphQLError(
+                    "Fields \"\(key)\" conflict because they select different fields or arguments; "
+                        + "use different aliases to fetch both")
+            }
+            let selections = nodes.flatMap(\.selections)
+
+            if node.name == "__typename" {
+                guard selections.isEmpty, node.arguments.isEmpty else {
+                    throw GraphQLError("Field \"__typename\" takes no arguments or selection")
+                }
+                return GraphQLPlannedField(
+                    responseKey: key, definition: nil, arguments: GraphQLArguments(values: [:]), objectType: nil,
+                    children: [], cost: 0)
+            }
+            guard let definition = type.field(named: node.name) else {
+                throw GraphQLError("Cannot query field \"\(node.name)\" on type \"\(type.name)\"")
+            }
+            let arguments = try self.arguments(node.arguments, for: definition, on: type)
+
+            let namedType = definition.type.namedType
+            if schema.isScalar(namedType) {
+                guard selections.isEmpty else {
+                    throw GraphQLError(
+                        "Field \"\(node.name)\" must not have a selection since type \"\(namedType)\" has no subfields")
+                }
+                return GraphQLPlannedField(
+                    responseKey: key, definition: definition, arguments: arguments, objectType: nil, children: [],
+                    cost: 1)
+            }
+            guard let objectType = schema.types[namedType] else {
+                throw GraphQLError("Schema has no type \"\(namedType)\"")
+            }
+            guard !selections.isEmpty else {
+                throw GraphQLError(
+                    "Field \"\(node.name)\" of type \"\(definition.type)\" must have a selection of subfields")
+            }
+            let children = try self.selections(selections, on: objectType, depth: depth + 1)
+            let multiplier = definition.type.isList ? arguments.first : 1
+            return GraphQLPlannedField(
+                responseKey: key, definition: definition, arguments: arguments, objectType: objectType,
+                children: children, cost: 1 + multiplier * children.reduce(0) { $0 + $1.cost })
+        }
+
+        private func arguments(
+            _ provided: [String: GraphQLValue], for definition: GraphQLFieldDefinition, on type: GraphQLObjectType
+        ) throws -> GraphQLArguments {
+            for name in provided.keys where !definition.arguments.contains(where: { $0.name == name }) {
+                throw GraphQLError("Unknown argument \"\(name)\" on field \"\(type.name).\(definition.name)\"")
+            }
+            var values: [String: GraphQLValue] = [:]
+            for argument in definition.arguments {
+                var value = try provided[argument.name].map(substitute) ?? .null
+                if value == .null, let defaultValue = argument.defaultValue { value = defaultValue }
+                values[argument.name] = try Self.coerce(
+                    value, to: argument.type, describing: "Argument \"\(argument.name)\"")
+            }
+            if case .int(let first) = values["first"], !(0...GraphQLLimits.maxPageSize).contains(first) {
+                throw GraphQLError("Argument \"first\" must be between 0 and \(GraphQLLimits.maxPageSize)")
+            }
+            return GraphQLArguments(values: values)
+        }
+
+        private func substitute(_ value: GraphQLValue) throws -> GraphQLValue {
+            switch value {
+            case .variable(let name):
+                guard let bound = variables[name] else {
+                    throw GraphQLError("Variable \"$\(name)\" is not defined")
+                }
+                return bound
+            case .list(let items):
+                return .list(try items.map(substitute))
+            case .object(let fields):
+                return .object(try fields.mapValues(substitute))
+            default:
+                return value
+            }
+        }
+
+        /// Input coercion for the built-in scalars, which are the only input
+        /// types the schema has. `ID` values are UUIDs throughout.
+        static func coerce(_ value: GraphQLValue, to type: GraphQLTypeRef, describing subject: String) throws
+            -> GraphQLValue
+        {
+            switch type {
+            case .nonNull(let inner):
+                guard value != .null else { throw GraphQLError("\(subject) of type \"\(type)\" is required") }
+                return try coerce(value, to: inner, describing: subject)
+            case .list(let inner):
+                if value == .null { return .null }
+                if case .list(let items) = value {
+                    return .list(try items.map { try coerce($0, to: inner, describing: subject) })
+                }
+                return .list([try coerce(value, to: inner, describing: subject)])
+            case .named(let name):
+                switch (name, value) {
+                case (_, .null):
+                    return .null
+                case ("Int", .int), ("Float", .float), ("String", .string), ("Boolean", .boolean):
+                    return value
+                case ("Float", .int(let int)):
+                    return .float(Double(int))
+                case ("ID", .string(let string)) where UUID(uuidString: string) != nil:
+                    return value
+                default:
+                    throw GraphQLError("\(subject) expected a value of type \"\(type)\"")
+                }
+            }
+        }
+    }
+
+    // MARK: - Execution
+
+    /// Runs a plan, returning the response document: `data`, plus `errors`
+    /// when any field failed (the field itself is null).
+    func execute(_ plan: GraphQLPlan, root: any Sendable = GraphQLRoot(), context: GraphQLContext) async
+        -> CodableValue
+    {
+        var errors: [GraphQLError] = []
+        let data = await resolve(
+            plan.fields, on: plan.rootType, parents: [root], path: [], context: context, errors: &errors)
+        return Self.response(data: .object(data[0]), errors: errors)
+    }
+
+    static func response(data: CodableValue?, errors: [GraphQLError]) -> CodableValue {
+        var response: [String: CodableValue] = [:]
+        if let data { response["data"] = data }
+        if !errors.isEmpty { response["errors"] = .array(errors.map(\.response)) }
+        return .object(response)
+    }
+
+    private func resolve(
+        _ fields: [GraphQLPlannedField], on type: GraphQLObjectType, parents: [any Sendable], path: [String],
+        context: GraphQLContext, errors: inout [GraphQLError]
+    ) async -> [[String: CodableValue]] {
+        var results = Array(repeating: [String: CodableValue](), count: parents.count)
+        guard !parents.isEmpty else { return results }
+
+        for field in fields {
+            let fieldPath = path + [field.responseKey]
+            guard let definition = field.definition else {
+                for index in results.indices { results[index][field.responseKey] = .string(type.name) }
+                continue
+            }
+            for index in results.indices { results[index][field.responseKey] = .null }
+
+            var eligible = Array(parents.indices)
+            if let action = definition.requires {
+                do {
+                    let permitted = try await authorized(action, on: parents, of: type, context: context)
+                    eligible = eligible.filter { permitted[$0] }
+                    if eligible.count < parents.count {
+                        errors.append(
+                            GraphQLError("Not authorized to read \(type.name).\(definition.name)", path: fieldPath))
+                    }
+                } catch {
+                    errors.append(Self.fieldError(error, path: fieldPath, logger: context.request.logger))
+                    continue
+                }
+            }
+            guard !eligible.isEmpty else { continue }
+
+            let resolved: [GraphQLResolved]
+            do {
+                resolved = try await definition.resolve(eligible.map { parents[$0] }, field.arguments, context)
+                guard resolved.count == eligible.count else {
+                    throw GraphQLError("Field \"\(definition.name)\" resolved the wrong number of results")
+                }
+            } catch {
+                errors.append(Self.fieldError(error, path: fieldPath, logger: context.request.logger))
+                continue
+            }
+
+            var rendered: [Int: CodableValue] = [:]
+            if let objectType = field.objectType {
+                var objects: [any Sendable] = []
+                for value in resolved { Self.collectObjects(value, into: &objects) }
+                let visible: [Bool]
+                do {
+                    visible = try await objectType.visible(objects, context: context)
+                } catch {
+                    errors.append(Self.fieldError(error, path: fieldPath, logger: context.request.logger))
+                    continue
+                }
+                let shown = objects.indices.filter { visible[$0] }
+                let children = await resolve(
+                    field.children, on: objectType, parents: shown.map { objects[$0] }, path: fieldPath,
+                    context: context, errors: &errors)
+                for (offset, index) in shown.enumerated() {
+                    rendered[index] = .object(children[offset])
+                }
+            }
+            var cursor = 0
+            for (offset, index) in eligible.enumerated() {
+                results[index][field.responseKey] = Self.render(resolved[offset], objects: rendered, cursor: &cursor)
+                    ?? .null
+            }
+        }
+        return results
+    }
+
+    /// Which `parents` the caller holds a field-level `action` on.
+    private func authorized(
+        _ action: String, on parents: [any Sendable], of type: GraphQLObjectType, context: GraphQLContext
+    ) async throws -> [Bool] {
+        let nodes = parents.map { type.authorization?.check($0)?.node }
+        let allowed = try await context.filter(action, Array(Set(nodes.compactMap { $0 })))
+        return nodes.map { node in node.map { allowed.contains($0) } ?? false }
+    }
+
+    private static func collectObjects(_ value: GraphQLResolved, into objects: inout [any Sendable]) {
+        switch value {
+        case .object(let object):
+            objects.append(object)
+        case .list(let items):
+            for item in items { collectObjects(item, into: &objects) }
+        case .null, .leaf:
+            break
+        }
+    }
+
+    /// The response value for one resolved result. Objects are numbered in
+    /// the order `collectObjects` saw them; one missing from `objects` was
+    /// denied, and renders as nil — dropped from a list, null on its own.
+    private static func render(_ value: GraphQLResolved, objects: [Int: CodableValue], cursor: inout Int)
+        -> CodableValue?
+    {
+        switch value {
+        case .null:
+            return .null
+        case .leaf(let leaf):
+            return leaf
+        case .object:
+            let index = cursor
+            cursor += 1
+            return objects[index]
+        case .list(let items):
+            var rendered: [CodableValue] = []
+            for item in items {
+                if let value = render(item, objects: objects, cursor: &cursor) { rendered.append(value) }
+            }
+            return .array(rendered)
+        }
+    }
+
+    private static func fieldError(_ error: any Error, path: [String], logger: Logger) -> GraphQLError {
+        switch error {
+        case let error as GraphQLError:
+            return GraphQLError(error.message, path: path)
+        case let error as any AbortError:
+            return GraphQLError(error.reason, path: path)
+        default:
+            logger.error(
+                "GraphQL field failed",
+                metadata: ["path": .string(path.joined(separator: ".")), "error": .string("\(error)")])
+            return GraphQLError("Internal error resolving \(path.joined(separator: "."))", path: path)
+        }
+    }
+}
@@ -0,0 +1,326 @@
+import Fluent
+import Foundation
+import StratoShared
+import Vapor
+
+/// A type reference in the schema or a variable definition: `VM`, `[VM!]`,
+/// `ID!`.
+indirect enum GraphQLTypeRef: Sendable, Equatable, CustomStringConvertible {
+    case named(String)
+    case list(GraphQLTypeRef)
+    case nonNull(GraphQLTypeRef)
+
+    /// The innermost type name, with list and non-null wrappers removed.
+    var namedType: String {
+        switch self {
+        case .named(let name): name
+        case .list(let inner), .nonNull(let inner): inner.namedType
+        }
+    }
+
+    var isList: Bool {
+        switch self {
+        case .named: false
+        case .list: true
+        case .nonNull(let inner): inner.isList
+        }
+    }
+
+    var description: String {
+        switch self {
+        case .named(let name): name
+        case .list(let inner): "[\(inner)]"
+        case .nonNull(let inner): "\(inner)!"
+        }
+    }
+}
+
+/// What a field resolved to for one parent.
+indirect enum GraphQLResolved: Sendable {
+    case null
+    case leaf(CodableValue)
+    /// A value of the field's object type — the parent its own fields
+    /// resolve against.
+    case object(any Sendable)
+    case list([GraphQLResolved])
+}
+
+/// Per-request state every resolver receives.
+struct GraphQLContext: Sendable {
+    let request: Request
+    /// The Cedar batch filter: the nodes, out of those given, on which the
+    /// caller may perform the action.
+    let filter: @Sendable (_ action: String, _ nodes: [IAMNode]) async throws -> Set<IAMNode>
+
+    var db: any Database { request.db }
+
+    /// Whether an object with no node (a pre-scoping agent) may appear: only
+    /// for system admins, as on the REST list endpoints.
+    func allowsScopelessRow() -> Bool {
+        request.allowsScopelessPlatformRow()
+    }
+
+    /// Queries decide through the request's memoized `canFilter`: within
+    /// one document the same VM reached along two paths is decided once.
+    static func query(_ req: Request) -> GraphQLContext {
+        GraphQLContext(request: req) { action, nodes in
+            try await req.canFilter(action, on: nodes)
+        }
+    }
+
+    /// A subscription lives as long as its socket, so every event is decided
+    /// afresh, without the request memo — a revoked grant stops the next
+    /// event rather than the next connection.
+    static func subscription(_ req: Request, userID: UUID) -> GraphQLContext {
+        GraphQLContext(request: req) { action, nodes in
+            let decisions = try await IAMAuthorizer.authorize(
+                principal: .user(userID),
+                action: action,
+                nodes: nodes,
+                context: IAMCheckContext(path: req.url.path, method: req.method.rawValue, requestID: req.id),
+                state: nil,
+                app: req.application,
+                db: req.db
+            )
+            return Set(decisions.filter { $0.value.allowed }.keys)
+        }
+    }
+}
+
+/// A field's arguments after variable substitution, defaults, and coercion
+/// to their declared types.
+struct GraphQLArguments: Sendable {
+    let values: [String: GraphQLValue]
+
+    func int(_ name: String) -> Int? {
+        if case .int(let value) = values[name] { return value }
+        return nil
+    }
+
+    func string(_ name: String) -> String? {
+        if case .string(let value) = values[name] { return value }
+        return nil
+    }
+
+    func strings(_ name: String) -> [String]? {
+        guard case .list(let items) = values[name] else { return nil }
+        return items.compactMap { item in
+            if case .string(let value) = item { return value }
+            return nil
+        }
+    }
+
+    /// An `ID` argument as a UUID. Coercion already checked the shape.
+    func id(_ name: String) -> UUID? {
+        string(name).flatMap(UUID.init(uuidString:))
+    }
+
+    /// The page size of a list field: `first`, clamped by planning to
+    /// `GraphQLLimits.maxPageSize`.
+    var first: Int {
+        int("first") ?? GraphQLLimits.defaultPageSize
+    }
+}
+
+struct GraphQLArgumentDefinition: Sendable {
+    let name: String
+    let type: GraphQLTypeRef
+    let description: String
+    let defaultValue: GraphQLValue?
+
+    init(_ name: String, _ type: GraphQLTypeRef, _ description: String, defaultValue: GraphQLValue? = nil) {
+        self.name = name
+        self.type = type
+        self.description = description
+        self.defaultValue = defaultValue
+    }
+
+    /// The page-size argument every list field takes, so the cost of a
+    /// document is bounded before it runs.
+    static let first = GraphQLArgumentDefinition(
+        "first", .named("Int"), "Maximum items to return (default 50, at most 100).",
+        defaultValue: .int(GraphQLLimits.defaultPageSize))
+}
+
+struct GraphQLFieldDefinition: Sendable {
+    /// Resolves the field for every parent at one level of the document in
+    /// a single call — the dataloader batching — returning one result per
+    /// parent, in order.
+    typealias Resolver =
+        @Sendable (_ parents: [any Sendable], _ arguments: GraphQLArguments, _ context: GraphQLContext)
+        async throws -> [GraphQLResolved]
+
+    let name: String
+    let type: GraphQLTypeRef
+    let description: String
+    let arguments: [GraphQLArgumentDefinition]
+    /// Field-level Cedar gate: an action the caller must hold on the parent
+    /// object's node, beyond the read that made the parent visible. Parents
+    /// lacking it get null for this field and an error naming it.
+    let requires: String?
+    let resolve: Resolver
+
+    /// A leaf read straight off the parent object.
+    static func leaf<Parent: Sendable>(
+        _ name: String, _ type: GraphQLTypeRef, _ description: String,
+        _ value: @escaping @Sendable (Parent) -> CodableValue?
+    ) -> GraphQLFieldDefinition {
+        GraphQLFieldDefinition(
+            name: name, type: type, description: description, arguments: [], requires: nil
+        ) { parents, _, _ in
+            parents.map { parent in
+                guard let parent = parent as? Parent, let resolved = value(parent) else { return .null }
+                return .leaf(resolved)
+            }
+        }
+    }
+
+    /// A field resolved for all parents at once, typically with one query.
+    static func batch<Parent: Sendable>(
+        _ name: String, _ type: GraphQLTypeRef, _ description: String,
+        arguments: [GraphQLArgumentDefinition] = [], requires: String? = nil,
+        _ resolve: @escaping @Sendable ([Parent], GraphQLArguments, GraphQLContext) async throws -> [GraphQLResolved]
+    ) -> GraphQLFieldDefinition {
+        GraphQLFieldDefinition(
+            name: name, type: type, description: description, arguments: arguments, requires: requires
+        ) { parents, arguments, context in
+            let typed = parents.compactMap { $0 as? Parent }
+            guard typed.count == parents.count else {
+                throw GraphQLError("Field \"\(name)\" resolved against the wrong parent type")
+            }
+            return try await resolve(typed, arguments, context)
+        }
+    }
+}
+
+struct GraphQLObjectType: Sendable {
+    /// The Cedar read gate each object of the type passes before it appears
+    /// in a response: the action and node to check for one object, or nil
+    /// for an object with no node (a pre-scoping agent), which only the
+    /// platform's scopeless-row rule admits.
+    struct Authorization: Sendable {
+        let check: @Sendable (any Sendable) -> (action: String, node: IAMNode)?
+    }
+
+    let name: String
+    let description: String
+    /// Nil for types whose objects are only reachable through an already
+    /// authorized parent and carry no node of their own (a VM's NICs).
+    let authorization: Authorization?
+    let fields: [GraphQLFieldDefinition]
+
+    func field(named name: String) -> GraphQLFieldDefinition? {
+        fields.first { $0.name == name }
+    }
+
+    /// Which `objects` pass the type's read gate, batched per action. List
+    /// resolvers filter with this before paging, so `first` counts visible
+    /// rows; the executor's own pass then answers from the request memo.
+    func visible(_ objects: [any Sendable], context: GraphQLContext) async throws -> [Bool] {
+        guard let authorization else { return objects.map { _ in true } }
+        let checks = objects.map { authorization.check($0) }
+        var allowed: [String: Set<IAMNode>] = [:]
+        let byAction = Dictionary(grouping: checks.compactMap { $0 }, by: { $0.action })
+        for (action, group) in byAction {
+            allowed[action] = try await context.filter(action, Array(Set(group.map { $0.node })))
+        }
+        return checks.map { check in
+            guard let check else { return context.allowsScopelessRow() }
+            return allowed[check.action]?.contains(check.node) ?? false
+        }
+    }
+}
+
+/// Cost and shape limits applied to every document before it runs.
+struct GraphQLLimits: Sendable {
+    static let defaultPageSize = 50
+    static let maxPageSize = 100
+
+    /// Upper bound on a document's estimated cost: each field costs one,
+    /// and a list field multiplies its selection by its page size.
+    let maxCost: Int
+    /// Deepest field nesting accepted.
+    let maxDepth: Int
+
+    static func fromEnvironment() -> GraphQLLimits {
+        GraphQLLimits(
+            maxCost: Environment.get("GRAPHQL_MAX_COST").flatMap(Int.init) ?? 10_000,
+            maxDepth: Environment.get("GRAPHQL_MAX_DEPTH").flatMap(Int.init) ?? 10)
+    }
+}
+
+/// A fixed, code-defined schema: object types, custom scalars, and the root
+/// types operations start from. There are no mutations; writes stay on the
+/// REST API.
+struct GraphQLSchema: Sendable {
+    static let builtinScalars = ["ID", "String", "Int", "Float", "Boolean"]
+
+    let types: [String: GraphQLObjectType]
+    /// Custom scalar name → description.
+    let scalars: [String: String]
+    let query: String
+    let subscription: String?
+
+    init(types: [GraphQLObjectType], scalars: [String: String], query: String, subscription: String?) {
+        self.types = Dictionary(uniqueKeysWithValues: types.map { ($0.name, $0) })
+        self.scalars = scalars
+        self.query = query
+        self.subscription = subscription
+    }
+
+    func isScalar(_ name: String) -> Bool {
+        Self.builtinScalars.contains(name) || scalars[name] != nil
+    }
+
+    /// The schema in GraphQL SDL, types in alphabetical order after the
+    /// roots.
+    func sdl() -> String {
+        var blocks: [String] = []
+        var schemaBlock = "schema {\n  query: \(query)\n"
+        if let subscription { schemaBlock += "  subscription: \(subscription)\n" }
+        blocks.append(schemaBlock + "}")
+        for (name, description) in scalars.sorted(by: { $0.key < $1.key }) {
+            blocks.append("\(Self.docString(description, indent: ""))scalar \(name)")
+        }
+        let roots = [query] + (subscription.map { [$0] } ?? [])
+        let ordered = roots.compactMap { types[$0] }
+            + types.values.filter { !roots.contains($0.name) }.sorted { $0.name < $1.name }
+        for type in ordered {
+            var lines = ["\(Self.docString(type.description, indent: ""))type \(type.name) {"]
+            for field in type.fields {
+                var signature = "  \(field.name)"
+                if !field.arguments.isEmpty {
+                    let arguments = field.arguments.map { argument in
+                        var text = "\(argument.name): \(argument.type)"
+                        if let defaultValue = argument.defaultValue { text += " = \(Self.literal(defaultValue))" }
+                        return text
+                    }
+                    signature += "(\(arguments.joined(separator: ", ")))"
+                }
+                lines.append(Self.docString(field.description, indent: "  ") + signature + ": \(field.type)")
+            }
+            blocks.append(lines.joined(separator: "\n") + "\n}")
+        }
+        return blocks.joined(separator: "\n\n") + "\n"
+    }
+
+    private static func docString(_ description: String, indent: String) -> String {
+        guard !description.isEmpty else { return "" }
+        return "\(indent)\"\"\"\n\(indent)\(description)\n\(indent)\"\"\"\n"
+    }
+
+    private static func literal(_ value: GraphQLValue) -> String {
+        switch value {
+        case .variable(let name): "$\(name)"
+        case .int(let value): "\(value)"
+        case .float(let value): "\(value)"
+        case .string(let value): "\"\(value)\""
+        case .boolean(let value): "\(value)"
+        case .null: "null"
+        case .enumValue(let value): value
+        case .list(let items): "[\(items.map(literal).joined(separator: ", "))]"
+        case .object(let fields):
+            "{\(fields.sorted { $0.key < $1.key }.map { "\($0.key): \(literal($0.value))" }.joined(separator: ", "))}"
+        }
+    }
+}
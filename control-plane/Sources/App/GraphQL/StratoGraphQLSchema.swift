@@ -0,0 +1,527 @@
+import Fluent
+import Foundation
+import StratoShared
+import Vapor
+
+/// The GraphQL view of the resource graph: projects and what they hold,
+/// agents and the workloads they host, IAM bindings, and the resource event
+/// stream. Read-only by design — every write stays on the REST API, where
+/// admission, quotas and operations live.
+///
+/// Each object type carries the same Cedar read the REST item endpoint
+/// checks, so the graph never shows more than the REST API would. List
+/// fields filter before they page, so `first` counts rows the caller can
+/// see; parent ids are batched into one query per field per level.
+enum StratoGraphQLSchema {
+    static let schema = GraphQLSchema(
+        types: [
+            query, subscription, project, vm, sandbox, volume, networkInterface, operation, agent, iamBinding,
+            resourceEvent,
+        ],
+        scalars: [
+            "DateTime": "An ISO 8601 timestamp in UTC.",
+            "JSON": "An arbitrary JSON value.",
+        ],
+        query: "Query",
+        subscription: "Subscription")
+
+    // MARK: - Roots
+
+    static let query = GraphQLObjectType(
+        name: "Query", description: "Read entry points into the resource graph.", authorization: nil,
+        fields: [
+            .batch(
+                "project", .named("Project"), "A project by id; null when it does not exist or is not readable.",
+                arguments: [GraphQLArgumentDefinition("id", .nonNull(.named("ID")), "Project id.")]
+            ) { (roots: [GraphQLRoot], arguments, context) in
+                let found = try await arguments.id("id").asyncMap { try await Project.find($0, on: context.db) }
+                return roots.map { _ in found.flatMap { $0 }.map { .object($0) } ?? .null }
+            },
+            .batch(
+                "projects", .nonNull(.list(.nonNull(.named("Project")))),
+                "Projects in the caller's organizations, by name.", arguments: [.first]
+            ) { (roots: [GraphQLRoot], arguments, context) in
+                let projects = try await memberProjects(context)
+                let visible = try await page(projects, type: project, first: arguments.first, context: context)
+                return roots.map { _ in visible }
+            },
+            .batch(
+                "vm", .named("VM"), "A VM by id; null when it does not exist or is not readable.",
+                arguments: [GraphQLArgumentDefinition("id", .nonNull(.named("ID")), "VM id.")]
+            ) { (roots: [GraphQLRoot], arguments, context) in
+                let found = try await arguments.id("id").asyncMap { try await VM.find($0, on: context.db) }
+                return roots.map { _ in found.flatMap { $0 }.map { .object($0) } ?? .null }
+            },
+            .batch(
+                "sandbox", .named("Sandbox"), "A sandbox by id; null when it does not exist or is not readable.",
+                arguments: [GraphQLArgumentDefinition("id", .nonNull(.named("ID")), "Sandbox id.")]
+            ) { (roots: [GraphQLRoot], arguments, context) in
+                let found = try await arguments.id("id").asyncMap { try await Sandbox.find($0, on: context.db) }
+                return roots.map { _ in found.flatMap { $0 }.map { .object($0) } ?? .null }
+            },
+            .batch(
+                "agent", .named("Agent"), "An agent by id; null when it does not exist or is not readable.",
+                arguments: [GraphQLArgumentDefinition("id", .nonNull(.named("ID")), "Agent id.")]
+            ) { (roots: [GraphQLRoot], arguments, context) in
+                let found = try await arguments.id("id").asyncMap { try await Agent.find($0, on: context.db) }
+                return roots.map { _ in found.flatMap { $0 }.map { .object($0) } ?? .null }
+            },
+            .batch(
+                "agents", .nonNull(.list(.nonNull(.named("Agent")))), "Agents the caller may read, by name.",
+                arguments: [.first]
+            ) { (roots: [GraphQLRoot], arguments, context) in
+                let agents = try await Agent.query(on: context.db).sort(\.$name).all()
+                let visible = try await page(agents, type: agent, first: arguments.first, context: context)
+                return roots.map { _ in visible }
+            },
+        ])
+
+    static let subscription = GraphQLObjectType(
+        name: "Subscription", description: "Live resource events.", authorization: nil,
+        fields: [
+            .batch(
+                "resourceEvents", .named("ResourceEvent"),
+                "Every event the caller may read as it commits: the same catalog webhooks deliver.",
+                arguments: [
+                    GraphQLArgumentDefinition(
+                        "types", .list(.nonNull(.named("String"))),
+                        "Event types to receive, such as vm.state_changed; all when omitted."),
+                    GraphQLArgumentDefinition("projectId", .named("ID"), "Only events in this project."),
+                ]
+            ) { (events: [ResourceEvent], arguments, _) in
+                let types = arguments.strings("types")
+                let projectID = arguments.id("projectId")
+                return events.map { event in
+                    if let types, !types.contains(event.type) { return .null }
+                    if let projectID, event.projectID != projectID { return .null }
+                    return .object(event)
+                }
+            }
+        ])
+
+    // MARK: - Projects
+
+    static let project = GraphQLObjectType(
+        name: "Project", description: "A project: the unit resources are created in.",
+        authorization: .init { object in
+            guard let project = object as? Project, let id = project.id else { return nil }
+            return ("project:read", IAMNode(type: .project, id: id))
+        },
+        fields: [
+            .leaf("id", .nonNull(.named("ID")), "") { (project: Project) in id(project.id) },
+            .leaf("name", .nonNull(.named("String")), "") { (project: Project) in .string(project.name) },
+            .leaf("description", .nonNull(.named("String")), "") { (project: Project) in
+                .string(project.description)
+            },
+            .leaf("organizationId", .named("ID"), "Owning organization, for a project directly under one.") {
+                (project: Project) in id(project.$organization.id)
+            },
+            .leaf("organizationalUnitId", .named("ID"), "Owning folder, for a project inside one.") {
+                (project: Project) in id(project.$organizationalUnit.id)
+            },
+            .leaf("environments", .nonNull(.list(.nonNull(.named("String")))), "") { (project: Project) in
+                .array(project.environments.map { .string($0) })
+            },
+            .leaf("createdAt", .named("DateTime"), "") { (project: Project) in timestamp(project.createdAt) },
+            .batch(
+                "vms", .nonNull(.list(.nonNull(.named("VM")))), "VMs in the project, by name.", arguments: [.first]
+            ) { (projects: [Project], arguments, context) in
+                let ids = projects.map(\.id)
+                let vms = try await VM.query(on: context.db).filter(\.$project.$id ~~ ids.compactMap { $0 })
+                    .sort(\.$name).all()
+                return try await pages(
+                    vms.map { ($0.$project.id, $0) }, parents: ids, type: vm, first: arguments.first, context: context)
+            },
+            .batch(
+                "sandboxes", .nonNull(.list(.nonNull(.named("Sandbox")))), "Sandboxes in the project, by name.",
+                arguments: [.first]
+            ) { (projects: [Project], arguments, context) in
+                let ids = projects.map(\.id)
+                let sandboxes = try await Sandbox.query(on: context.db)
+                    .filter(\.$project.$id ~~ ids.compactMap { $0 }).sort(\.$name).all()
+                return try await pages(
+                    sandboxes.map { ($0.$project.id, $0) }, parents: ids, type: sandbox, first: arguments.first,
+                    context: context)
+            },
+            .batch(
+                "iamBindings", .list(.nonNull(.named("IAMBinding"))),
+                "Unexpired role bindings on the project itself. Requires iam:readPolicy on the project.",
+                arguments: [.first], requires: "iam:readPolicy"
+            ) { (projects: [Project], arguments, context) in
+                let ids = projects.map(\.id)
+                let bindings = try await RoleBinding.query(on: context.db)
+                    .filter(\.$nodeType == IAMNodeType.project.rawValue)
+                    .filter(\.$nodeID ~~ ids.compactMap { $0 })
+                    .active()
+                    .sort(\.$createdAt)
+                    .all()
+                return try await pages(
+                    bindings.map { ($0.nodeID, $0) }, parents: ids, type: iamBinding, first: arguments.first,
+                    context: context)
+            },
+        ])
+
+    static let iamBinding = GraphQLObjectType(
+        name: "IAMBinding", description: "A role grant: a principal holds a role on a node.",
+        // Reachable only through the field-level iam:readPolicy gate.
+        authorization: nil,
+        fields: [
+            .leaf("id", .nonNull(.named("ID")), "") { (binding: RoleBinding) in id(binding.id) },
+            .leaf("principalType", .nonNull(.named("String")), "user, group or service_account.") {
+                (binding: RoleBinding) in .string(binding.principalType)
+            },
+            .leaf("principalId", .nonNull(.named("ID")), "") { (binding: RoleBinding) in id(binding.principalID) },
+            .leaf("role", .nonNull(.named("String")), "The granted role's id.") { (binding: RoleBinding) in
+                .string(binding.role)
+            },
+            .leaf("nodeType", .nonNull(.named("String")), "") { (binding: RoleBinding) in .string(binding.nodeType) },
+            .leaf("nodeId", .nonNull(.named("ID")), "") { (binding: RoleBinding) in id(binding.nodeID) },
+            .leaf("expiresAt", .named("DateTime"), "Null for a grant that never expires.") {
+                (binding: RoleBinding) in timestamp(binding.expiresAt)
+            },
+            .leaf("createdAt", .named("DateTime"), "") { (binding: RoleBinding) in timestamp(binding.createdAt) },
+        ])
+
+    // MARK: - Workloads
+
+    static let vm = GraphQLObjectType(
+        name: "VM", description: "A virtual machine.",
+        authorization: .init { object in
+            guard let vm = object as? VM, let id = vm.id else { return nil }
+            return ("vm:read", IAMNode(type: .virtualMachine, id: id))
+        },
+        fields: [
+            .leaf("id", .nonNull(.named("ID")), "") { (vm: VM) in id(vm.id) },
+            .leaf("name", .nonNull(.named("String")), "") { (vm: VM) in .string(vm.name) },
+            .leaf("description", .nonNull(.named("String")), "") { (vm: VM) in .string(vm.description) },
+            .leaf("status", .nonNull(.named("String")), "Observed status.") { (vm: VM) in .string(vm.status.rawValue) },
+            .leaf("desiredStatus", .nonNull(.named("String")), "") { (vm: VM) in
+                .string(vm.desiredStatus.rawValue)
+            },
+            .leaf("environment", .nonNull(.named("String")), "") { (vm: VM) in .string(vm.environment) },
+            .leaf("cpu", .nonNull(.named("Int")), "Boot vCPUs.") { (vm: VM) in .int(vm.cpu) },
+            .leaf("memory", .nonNull(.named("Int")), "Boot memory in bytes.") { (vm: VM) in .int(Int(vm.memory)) },
+            .leaf("disk", .nonNull(.named("Int")), "Boot disk size in bytes.") { (vm: VM) in .int(Int(vm.disk)) },
+            .leaf("healthStatus", .named("String"), "healthy or unhealthy, for a VM with a health check.") {
+                (vm: VM) in vm.healthStatus.map { .string($0) }
+            },
+            .leaf("createdAt", .named("DateTime"), "") { (vm: VM) in timestamp(vm.createdAt) },
+            .leaf("updatedAt", .named("DateTime"), "") { (vm: VM) in timestamp(vm.updatedAt) },
+            .batch("project", .named("Project"), "") { (vms: [VM], _, context) in
+                let ids = vms.map { $0.$project.id }
+                let projects = try await Project.query(on: context.db).filter(\.$id ~~ ids).all()
+                return lookup(ids, in: projects)
+            },
+            .batch("agent", .named("Agent"), "The agent hosting the VM; null while unscheduled.") {
+                (vms: [VM], _, context) in
+                let ids = vms.map { $0.hypervisorId.flatMap(UUID.init(uuidString:)) }
+                let agents = try await Agent.query(on: context.db).filter(\.$id ~~ ids.compactMap { $0 }).all()
+                return lookup(ids, in: agents)
+            },
+            .batch(
+                "volumes", .nonNull(.list(.nonNull(.named("Volume")))), "Volumes attached to the VM, oldest first.",
+                arguments: [.first]
+            ) { (vms: [VM], arguments, context) in
+                let ids = vms.map(\.id)
+                let attachments = try await VolumeAttachment.query(on: context.db)
+                    .filter(\.$vm.$id ~~ ids.compactMap { $0 })
+                    .with(\.$volume)
+                    .sort(\.$createdAt)
+                    .all()
+                return try await pages(
+                    attachments.map { ($0.$vm.id, $0.volume) }, parents: ids, type: volume, first: arguments.first,
+                    context: context)
+            },
+            .batch(
+                "nics", .nonNull(.list(.nonNull(.named("NetworkInterface")))), "The VM's NICs in device order.",
+                arguments: [.first]
+            ) { (vms: [VM], arguments, context) in
+                let ids = vms.map(\.id)
+                let nics = try await VMNetworkInterface.query(on: context.db)
+                    .filter(\.$vm.$id ~~ ids.compactMap { $0 })
+                    .with(\.$addresses)
+                    .sort(\.$orderIndex)
+                    .sort(\.$deviceName)
+                    .all()
+                return try await pages(
+                    nics.map { ($0.$vm.id, $0) }, parents: ids, type: networkInterface, first: arguments.first,
+                    context: context)
+            },
+            operations(of: .virtualMachine) { (vm: VM) in vm.id },
+        ])
+
+    static let sandbox = GraphQLObjectType(
+        name: "Sandbox", description: "An OCI-image microVM sandbox.",
+        authorization: .init { object in
+            guard let sandbox = object as? Sandbox, let id = sandbox.id else { return nil }
+            return ("sandbox:read", IAMNode(type: .sandbox, id: id))
+        },
+        fields: [
+            .leaf("id", .nonNull(.named("ID")), "") { (sandbox: Sandbox) in id(sandbox.id) },
+            .leaf("name", .nonNull(.named("String")), "") { (sandbox: Sandbox) in .string(sandbox.name) },
+            .leaf("image", .nonNull(.named("String")), "") { (sandbox: Sandbox) in .string(sandbox.image) },
+            .leaf("status", .nonNull(.named("String")), "Observed status.") { (sandbox: Sandbox) in
+                .string(sandbox.status.rawValue)
+            },
+            .leaf("cpus", .nonNull(.named("Int")), "") { (sandbox: Sandbox) in .int(sandbox.cpus) },
+            .leaf("memory", .nonNull(.named("Int")), "Memory in bytes.") { (sandbox: Sandbox) in
+                .int(Int(sandbox.memory))
+            },
+            .leaf("createdAt", .named("DateTime"), "") { (sandbox: Sandbox) in timestamp(sandbox.createdAt) },
+            .batch("project", .named("Project"), "") { (sandboxes: [Sandbox], _, context) in
+                let ids = sandboxes.map { $0.$project.id }
+                let projects = try await Project.query(on: context.db).filter(\.$id ~~ ids).all()
+                return lookup(ids, in: projects)
+            },
+            .batch("agent", .named("Agent"), "The agent hosting the sandbox; null while unscheduled.") {
+                (sandboxes: [Sandbox], _, context) in
+                let ids = sandboxes.map { $0.hypervisorId.flatMap(UUID.init(uuidString:)) }
+                let agents = try await Agent.query(on: context.db).filter(\.$id ~~ ids.compactMap { $0 }).all()
+                return lookup(ids, in: agents)
+            },
+            operations(of: .sandbox) { (sandbox: Sandbox) in sandbox.id },
+        ])
+
+    static let volume = GraphQLObjectType(
+        name: "Volume", description: "A block volume.",
+        authorization: .init { object in
+            guard let volume = object as? Volume, let id = volume.id else { return nil }
+            return ("volume:read", IAMNode(type: .volume, id: id))
+        },
+        fields: [
+            .leaf("id", .nonNull(.named("ID")), "") { (volume: Volume) in id(volume.id) },
+            .leaf("name", .nonNull(.named("String")), "") { (volume: Volume) in .string(volume.name) },
+            .leaf("size", .nonNull(.named("Int")), "Size in bytes.") { (volume: Volume) in .int(Int(volume.size)) },
+            .leaf("status", .nonNull(.named("String")), "") { (volume: Volume) in .string(volume.status.rawValue) },
+            .leaf("type", .nonNull(.named("String")), "") { (volume: Volume) in .string(volume.volumeType.rawValue) },
+            .leaf("format", .nonNull(.named("String")), "") { (volume: Volume) in .string(volume.format.rawValue) },
+            .leaf("multiAttach", .nonNull(.named("Boolean")), "") { (volume: Volume) in .bool(volume.multiAttach) },
+            .leaf("createdAt", .named("DateTime"), "") { (volume: Volume) in timestamp(volume.createdAt) },
+        ])
+
+    static let networkInterface = GraphQLObjectType(
+        name: "NetworkInterface", description: "A VM's NIC.",
+        // Part of its VM: visible whenever the VM is.
+        authorization: nil,
+        fields: [
+            .leaf("id", .nonNull(.named("ID")), "") { (nic: VMNetworkInterface) in id(nic.id) },
+            .leaf("deviceName", .nonNull(.named("String")), "") { (nic: VMNetworkInterface) in
+                .string(nic.deviceName)
+            },
+            .leaf("network", .nonNull(.named("String")), "") { (nic: VMNetworkInterface) in .string(nic.network) },
+            .leaf("macAddress", .nonNull(.named("String")), "") { (nic: VMNetworkInterface) in
+                .string(nic.macAddress)
+            },
+            .leaf("mtu", .named("Int"), "") { (nic: VMNetworkInterface) in nic.mtu.map { .int($0) } },
+            .leaf("addresses", .nonNull(.list(.nonNull(.named("String")))), "Allocated addresses in CIDR form.") {
+                (nic: VMNetworkInterface) in
+                .array(nic.addresses.map { .string("\($0.address)/\($0.prefixLength)") })
+            },
+        ])
+
+    static let operation = GraphQLObjectType(
+        name: "Operation", description: "An async operation on a VM or sandbox.",
+        // Reached only through its resource, whose read covers it — the same
+        // rule as GET /api/operations/:id.
+        authorization: nil,
+        fields: [
+            .leaf("id", .nonNull(.named("ID")), "") { (operation: ResourceOperation) in id(operation.id) },
+            .leaf("kind", .nonNull(.named("String")), "") { (operation: ResourceOperation) in
+                .string(operation.kind.rawValue)
+            },
+            .leaf("status", .nonNull(.named("String")), "") { (operation: ResourceOperation) in
+                .string(operation.status.rawValue)
+            },
+            .leaf("error", .named("String"), "") { (operation: ResourceOperation) in
+                operation.error.map { .string($0) }
+            },
+            .leaf("createdAt", .named("DateTime"), "") { (operation: ResourceOperation) in
+                timestamp(operation.createdAt)
+            },
+            .leaf("completedAt", .named("DateTime"), "") { (operation: ResourceOperation) in
+                timestamp(operation.completedAt)
+            },
+        ])
+
+    // MARK: - Agents
+
+    static let agent = GraphQLObjectType(
+        name: "Agent", description: "A hypervisor host running the Strato agent.",
+        authorization: .init { object in
+            guard let agent = object as? Agent, agent.organizationScope != nil, let id = agent.id else { return nil }
+            return ("agent:read", IAMNode(type: .agent, id: id))
+        },
+        fields: [
+            .leaf("id", .nonNull(.named("ID")), "") { (agent: Agent) in id(agent.id) },
+            .leaf("name", .nonNull(.named("String")), "") { (agent: Agent) in .string(agent.name) },
+            .leaf("hostname", .nonNull(.named("String")), "") { (agent: Agent) in .string(agent.hostname) },
+            .leaf("status", .nonNull(.named("String")), "") { (agent: Agent) in .string(agent.status.rawValue) },
+            .leaf("version", .nonNull(.named("String")), "") { (agent: Agent) in .string(agent.version) },
+            .leaf("architecture", .named("String"), "") { (agent: Agent) in agent.architecture.map { .string($0) } },
+            .leaf("totalCpu", .nonNull(.named("Int")), "") { (agent: Agent) in .int(agent.totalCPU) },
+            .leaf("availableCpu", .nonNull(.named("Int")), "") { (agent: Agent) in .int(agent.availableCPU) },
+            .leaf("totalMemory", .nonNull(.named("Int")), "Bytes.") { (agent: Agent) in .int(Int(agent.totalMemory)) },
+            .leaf("availableMemory", .nonNull(.named("Int")), "Bytes.") { (agent: Agent) in
+                .int(Int(agent.availableMemory))
+            },
+            .leaf("lastHeartbeat", .named("DateTime"), "") { (agent: Agent) in timestamp(agent.lastHeartbeat) },
+            .batch(
+                "vms", .nonNull(.list(.nonNull(.named("VM")))), "VMs the agent hosts that the caller may read.",
+                arguments: [.first]
+            ) { (agents: [Agent], arguments, context) in
+                let ids = agents.map(\.id)
+                let vms = try await VM.query(on: context.db)
+                    .filter(\.$hypervisorId ~~ ids.compactMap { $0?.uuidString }).sort(\.$name).all()
+                return try await pages(
+                    vms.map { ($0.hypervisorId.flatMap(UUID.init(uuidString:)), $0) }, parents: ids, type: vm,
+                    first: arguments.first, context: context)
+            },
+            .batch(
+                "sandboxes", .nonNull(.list(.nonNull(.named("Sandbox")))),
+                "Sandboxes the agent hosts that the caller may read.", arguments: [.first]
+            ) { (agents: [Agent], arguments, context) in
+                let ids = agents.map(\.id)
+                let sandboxes = try await Sandbox.query(on: context.db)
+                    .filter(\.$hypervisorId ~~ ids.compactMap { $0?.uuidString }).sort(\.$name).all()
+                return try await pages(
+                    sandboxes.map { ($0.hypervisorId.flatMap(UUID.init(uuidString:)), $0) }, parents: ids,
+                    type: sandbox, first: arguments.first, context: context)
+            },
+        ])
+
+    // MARK: - Events
+
+    static let resourceEvent = GraphQLObjectType(
+        name: "ResourceEvent",
+        description: "A platform event, in the shape webhooks deliver it.",
+        authorization: .init { object in (object as? ResourceEvent)?.readCheck },
+        fields: [
+            .leaf("id", .nonNull(.named("ID")), "Shared with the event's webhook deliveries.") {
+                (event: ResourceEvent) in id(event.id)
+            },
+            .leaf("type", .nonNull(.named("String")), "") { (event: ResourceEvent) in .string(event.type) },
+            .leaf("timestamp", .nonNull(.named("DateTime")), "") { (event: ResourceEvent) in
+                timestamp(event.occurredAt)
+            },
+            .leaf("organizationId", .nonNull(.named("ID")), "") { (event: ResourceEvent) in
+                id(event.organizationID)
+            },
+            .leaf("projectId", .named("ID"), "") { (event: ResourceEvent) in id(event.projectID) },
+            .leaf("resourceKind", .named("String"), "") { (event: ResourceEvent) in
+                event.resourceKind.map { .string($0) }
+            },
+            .leaf("resourceId", .named("ID"), "") { (event: ResourceEvent) in id(event.resourceID) },
+            .leaf("resourceName", .named("String"), "") { (event: ResourceEvent) in
+                event.resourceName.map { .string($0) }
+            },
+            .leaf("data", .nonNull(.named("JSON")), "Type-specific detail.") { (event: ResourceEvent) in
+                event.decodedData
+            },
+        ])
+
+    // MARK: - Helpers
+
+    /// `operations(first:)` on a resource: its operations, newest first.
+    private static func operations<Resource: Sendable>(
+        of kind: OperationResourceKind, id resourceID: @escaping @Sendable (Resource) -> UUID?
+    ) -> GraphQLFieldDefinition {
+        .batch(
+            "operations", .nonNull(.list(.nonNull(.named("Operation")))), "Operations on the resource, newest first.",
+            arguments: [.first]
+        ) { (resources: [Resource], arguments, context) in
+            let ids = resources.map(resourceID)
+            let operations = try await ResourceOperation.query(on: context.db)
+                .filter(\.$resourceKind == kind)
+                .filter(\.$resourceID ~~ ids.compactMap { $0 })
+                .sort(\.$createdAt, .descending)
+                .all()
+            return try await pages(
+                operations.map { ($0.resourceID, $0) }, parents: ids, type: operation, first: arguments.first,
+                context: context)
+        }
+    }
+
+    /// Projects in every organization the caller belongs to, directly or in
+    /// a folder — the same candidates as `GET /api/projects`.
+    private static func memberProjects(_ context: GraphQLContext) async throws -> [Project] {
+        let user = try context.request.auth.require(User.self)
+        try await user.$organizations.load(on: context.db)
+        let organizationIDs = user.organizations.compactMap(\.id)
+        guard !organizationIDs.isEmpty else { return [] }
+        let folderIDs = try await OrganizationalUnit.query(on: context.db)
+            .filter(\.$organization.$id ~~ organizationIDs)
+            .all()
+            .compactMap(\.id)
+        return try await Project.query(on: context.db)
+            .group(.or) { group in
+                group.filter(\.$organization.$id ~~ organizationIDs)
+                if !folderIDs.isEmpty { group.filter(\.$organizationalUnit.$id ~~ folderIDs) }
+            }
+            .sort(\.$name)
+            .all()
+    }
+
+    /// A root list: the readable `items`, cut to `first`.
+    private static func page<Item: Sendable>(
+        _ items: [Item], type: GraphQLObjectType, first: Int, context: GraphQLContext
+    ) async throws -> GraphQLResolved {
+        let visible = try await type.visible(items, context: context)
+        return .list(zip(items, visible).filter { $0.1 }.prefix(first).map { .object($0.0) })
+    }
+
+    /// A child list for every parent: the readable children grouped under
+    /// their parent's id, each group cut to `first`.
+    private static func pages<Child: Sendable>(
+        _ children: [(parent: UUID?, child: Child)], parents: [UUID?], type: GraphQLObjectType, first: Int,
+        context: GraphQLContext
+    ) async throws -> [GraphQLResolved] {
+        let visible = try await type.visible(children.map { $0.child }, context: context)
+        var grouped: [UUID: [GraphQLResolved]] = [:]
+        for (entry, isVisible) in zip(children, visible) where isVisible {
+            guard let parent = entry.parent, grouped[parent, default: []].count < first else { continue }
+            grouped[parent, default: []].append(.object(entry.child))
+        }
+        return parents.map { parent in .list(parent.flatMap { grouped[$0] } ?? []) }
+    }
+
+    /// A single related object for every parent, matched by id.
+    private static func lookup<Item: Model>(_ ids: [UUID?], in items: [Item]) -> [GraphQLResolved]
+    where Item.IDValue == UUID {
+        let byID = Dictionary(
+            items.compactMap { item in item.id.map { ($0, item) } }, uniquingKeysWith: { first, _ in first })
+        return ids.map { id in id.flatMap { byID[$0] }.map { .object($0) } ?? .null }
+    }
+
+    private static func id(_ value: UUID?) -> CodableValue? {
+        value.map { .string($0.uuidString) }
+    }
+
+    private static func timestamp(_ date: Date?) -> CodableValue? {
+        date.map { .string(ISO8601DateFormatter().string(from: $0)) }
+    }
+}
+
+extension Optional {
+    fileprivate func asyncMap<T>(_ transform: (Wrapped) async throws -> T) async rethrows -> T? {
+        guard let self else { return nil }
+        return try await transform(self)
+    }
+}
+
+// MARK: - Application accessor
+
+extension Application {
+    private struct GraphQLExecutorKey: StorageKey {
+        typealias Value = GraphQLExecutor
+    }
+
+    /// The executor for `/api/graphql`, with limits from the environment.
+    /// Tests replace it to tighten the limits.
+    var graphQL: GraphQLExecutor {
+        get {
+            storage[GraphQLExecutorKey.self]
+                ?? GraphQLExecutor(schema: StratoGraphQLSchema.schema, limits: .fromEnvironment())
+        }
+        set { setStorageValue(GraphQLExecutorKey.self, to: newValue) }
+    }
+}
@@ -30,6 +30,8 @@ enum CedarEntityType: String, CaseIterable, Sendable {
     case network = "Network"
     case floatingIP = "FloatingIP"
     case securityGroup = "SecurityGroup"
+    case fileShare = "FileShare"
+    case bucket = "Bucket"
     case volume = "Volume"
     case volumeSnapshot = "VolumeSnapshot"
     case sandboxSnapshot = "SandboxSnapshot"
@@ -67,6 +69,8 @@ extension IAMNodeType {
         case .network: return .network
         case .floatingIP: return .floatingIP
         case .securityGroup: return .securityGroup
+        case .fileShare: return .fileShare
+        case .bucket: return .bucket
         case .volume: return .volume
         case .volumeSnapshot: return .volumeSnapshot
         case .sandboxSnapshot: return .sandboxSnapshot
@@ -76,8 +76,10 @@ enum CedarSchemaBuilder {
         case "network": return [.network] + projectContainers
         case "floatingip": return [.floatingIP] + projectContainers
         case "securitygroup": return [.securityGroup] + projectContainers
+        case "fileshare": return [.fileShare] + projectContainers
+        case "bucket": return [.bucket] + projectContainers
         case "serviceaccount": return [.serviceAccount] + projectContainers
-        case "operation": return [.vm, .sandbox] + projectContainers
+        case "operation": return [.vm, .sandbox, .fileShare] + projectContainers
         case "project": return projectContainers
         case "folder": return [.folder, .organization]
         case "org": return [.organization]
@@ -244,7 +246,7 @@ enum CedarSchemaBuilder {
         case .folder: return [.organization, .folder]
         case .project: return [.organization, .folder]
         case .vm, .sandbox, .image, .volume, .volumeSnapshot, .sandboxSnapshot, .floatingIP, .securityGroup,
-            .serviceAccount:
+            .fileShare, .bucket, .serviceAccount:
             return [.project]
         case .network:
             // Project-scoped normally; a site-scoped network climbs to the
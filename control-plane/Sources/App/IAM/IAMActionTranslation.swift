@@ -58,6 +58,8 @@ enum IAMActionTranslator {
         case .network: return "network"
         case .floatingIP: return "floatingip"
         case .securityGroup: return "securitygroup"
+        case .fileShare: return "fileshare"
+        case .bucket: return "bucket"
         case .volume, .volumeSnapshot: return "volume"
         case .site: return "site"
         case .agent: return "agent"
@@ -104,6 +106,7 @@ enum IAMActionTranslator {
             switch service {
             case "sandbox": return "sandbox:snapshot"
             case "volume": return "volume:snapshot"
+            case "fileshare": return "fileshare:snapshot"
             default: return nil
             }
         case "restore":
@@ -132,9 +135,13 @@ enum IAMActionTranslator {
         case "clone":
             return service == "volume" ? "volume:clone" : nil
         case "resize":
-            // The registry has no distinct resize action; growing a volume is
-            // an update of it.
-            return service == "volume" ? "volume:update" : nil
+            // The registry has no distinct resize action; growing a volume or
+            // a file share is an update of it.
+            switch service {
+            case "volume": return "volume:update"
+            case "fileshare": return "fileshare:update"
+            default: return nil
+            }
         case "view_console":
             return "vm:viewConsole"
         case "download":
@@ -173,6 +180,10 @@ enum IAMActionTranslator {
             return "floatingip:create"
         case "create_security_group":
             return "securitygroup:create"
+        case "create_file_share":
+            return "fileshare:create"
+        case "create_bucket":
+            return "bucket:create"
 
         default:
             return nil
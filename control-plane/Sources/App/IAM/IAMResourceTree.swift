@@ -368,6 +368,16 @@ enum IAMResourceTree {
                 try await SecurityGroup.query(on: db).filter(\.$id ~~ idList).all(),
                 id: \.id, projectID: { $0.$project.id })
 
+        case .fileShare:
+            return projectParents(
+                try await FileShare.query(on: db).filter(\.$id ~~ idList).all(),
+                id: \.id, projectID: { $0.$project.id }, environment: { $0.environment })
+
+        case .bucket:
+            return projectParents(
+                try await Bucket.query(on: db).filter(\.$id ~~ idList).all(),
+                id: \.id, projectID: { $0.$project.id }, environment: { $0.environment })
+
         case .serviceAccount:
             return projectParents(
                 try await ServiceAccount.query(on: db).filter(\.$id ~~ idList).all(),
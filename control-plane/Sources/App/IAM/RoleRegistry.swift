@@ -62,6 +62,8 @@ enum IAMNodeType: String, Codable, Sendable, CaseIterable {
     case network
     case floatingIP = "floating_ip"
     case securityGroup = "security_group"
+    case fileShare = "file_share"
+    case bucket
     case volume
     case volumeSnapshot = "volume_snapshot"
     case sandboxSnapshot = "sandbox_snapshot"
@@ -122,6 +124,8 @@ enum IAMRoleRegistry {
             "network:read", "network:list",
             "floatingip:read", "floatingip:list",
             "securitygroup:read", "securitygroup:list",
+            "fileshare:read", "fileshare:list",
+            "bucket:read", "bucket:list", "bucket:getObject", "bucket:listObjects",
             "serviceaccount:read", "serviceaccount:list",
             "project:read",
             "folder:read",
@@ -149,6 +153,8 @@ enum IAMRoleRegistry {
             "floatingip:attach", "floatingip:detach",
             "securitygroup:create", "securitygroup:update", "securitygroup:delete",
             "securitygroup:attach", "securitygroup:detach",
+            "fileshare:create", "fileshare:update", "fileshare:delete", "fileshare:snapshot",
+            "bucket:create", "bucket:update", "bucket:delete", "bucket:putObject", "bucket:deleteObject",
             "serviceaccount:create", "serviceaccount:update", "serviceaccount:delete",
             "project:update",
         ],
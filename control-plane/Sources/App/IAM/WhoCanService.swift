@@ -245,6 +245,36 @@ enum WhoCanService {
         )
     }
 
+    /// The request principals that could be granted any of `actions` on any of
+    /// `nodes` — a superset, for callers that must then ask `can` of each and
+    /// would otherwise have to ask it of every principal on the platform. The
+    /// enumeration is `whoCan`'s (bindings with their group members,
+    /// membership, system admins) without its markings, which only `can`
+    /// needs to settle.
+    ///
+    /// `nil` when the set cannot be bounded: an authored permit bears on one
+    /// of the questions, and its principals are exactly what a reverse lookup
+    /// cannot enumerate. The caller then has to fall back to asking everyone.
+    static func candidatePrincipals(
+        actions: [String], nodes: [IAMNode], on db: any Database
+    ) async throws -> Set<WhoCanPrincipalRef>? {
+        var candidates: Set<WhoCanPrincipalRef> = []
+        for node in Set(nodes) {
+            let chain = try await IAMResourceTree.ancestors(of: node, on: db)
+            for action in actions {
+                let authoredPermits = try await authoredPolicyMatches(
+                    action: action, chain: chain, effect: .permit, on: db)
+                guard authoredPermits.isEmpty else { return nil }
+                let entries =
+                    try await bindingEntries(action: action, chain: chain, on: db)
+                    + membershipEntries(action: action, chain: chain, on: db)
+                candidates.formUnion(entries.map(\.principal))
+            }
+        }
+        candidates.formUnion(try await systemAdminEntries(on: db).map(\.principal))
+        return candidates.filter { $0.type != .group }
+    }
+
     /// Flag entries a ceiling denies, so the list agrees with the enforcer:
     /// a granted principal a guardrail or authored forbid neutralises is marked
     /// rather than dropped (#610). Decided by `IAMDecisionEngine` — exact for
@@ -0,0 +1,104 @@
+import Foundation
+import Vapor
+
+/// Resolves which `APIVersion` an API request speaks, and reports it back.
+///
+/// The version comes from the path (`/api/v1/…`, stripped before routing by
+/// `APIVersionPathResponder`) or the `Strato-API-Version` header; a request
+/// naming both must name the same one, and a version that isn't published is
+/// a 400 rather than a silent fallback to another contract. Every API response
+/// echoes the version it was served in. A deprecated version's responses also
+/// carry `Deprecation` (RFC 9745) and `Sunset` (RFC 8594), and each of its
+/// authenticated requests is counted: in
+/// `strato_api_deprecated_requests_total`, by User-Agent product, and per
+/// credential in the usage report
+/// (`APIVersionUsageTracker`) that says who still has to move before the
+/// sunset.
+///
+/// Registered ahead of the authenticators, so by the time the inner chain
+/// returns the request knows its caller. Like `MetricsMiddleware`, usage is
+/// counted on the error path too; the headers only reach responses that come
+/// back as responses.
+struct APIVersionMiddleware: AsyncMiddleware {
+    func respond(to request: Request, chainingTo next: any AsyncResponder) async throws -> Response {
+        guard request.url.path == "/api" || request.url.path.hasPrefix("/api/") else {
+            return try await next.respond(to: request)
+        }
+
+        let version = try Self.resolve(
+            pathVersion: request.storage[APIVersionPathResponder.PathVersionKey.self],
+            headerVersion: request.headers.first(name: APIVersion.headerName),
+            published: request.application.apiVersions)
+        request.apiVersion = version
+
+        let response: Response
+        do {
+            response = try await next.respond(to: request)
+        } catch {
+            Self.recordUsage(of: version, by: request)
+            throw error
+        }
+        Self.recordUsage(of: version, by: request)
+
+        response.headers.replaceOrAdd(name: APIVersion.headerName, value: String(version.number))
+        if let deprecatedAt = version.deprecatedAt {
+            response.headers.replaceOrAdd(
+                name: "Deprecation", value: "@\(Int(deprecatedAt.timeIntervalSince1970))")
+        }
+        if let sunsetAt = version.sunsetAt {
+            response.headers.replaceOrAdd(name: "Sunset", value: Self.httpDate(sunsetAt))
+        }
+        return response
+    }
+
+    static func resolve(
+        pathVersion: String?, headerVersion: String?, published: [APIVersion] = APIVersion.published
+    ) throws -> APIVersion {
+        let header = headerVersion?.trimmingCharacters(in: .whitespaces)
+        if let pathVersion, let header, pathVersion != header {
+            throw Abort(
+                .badRequest,
+                reason: "The path names API version \(pathVersion) but \(APIVersion.headerName) says \(header)")
+        }
+        // The served entry, not the constant: it carries the deprecation dates.
+        guard let requested = pathVersion ?? header else {
+            return published.first { $0 == .unversioned } ?? .unversioned
+        }
+        guard let number = Int(requested), let version = published.first(where: { $0.number == number }) else {
+            let supported = published.map { String($0.number) }.joined(separator: ", ")
+            throw Abort(
+                .badRequest, reason: "Unsupported API version '\(requested)'; supported versions are \(supported)")
+        }
+        return version
+    }
+
+    private static func recordUsage(of version: APIVersion, by request: Request) {
+        guard version.isDeprecated else { return }
+        // Unauthenticated calls (health probes, login) have no one to chase.
+        guard let client = APIVersionUsageTracker.Client(request: request) else { return }
+        let userAgent = request.headers.first(name: .userAgent)
+        Telemetry.recordDeprecatedAPIRequest(version: version.number, client: Self.clientLabel(userAgent: userAgent))
+        request.application.apiVersionUsage.record(
+            version: version, client: client, userAgent: userAgent, on: request.application)
+    }
+
+    /// The metric's `client` label: the User-Agent's first product name
+    /// (`strato-cli`, `terraform-provider-strato`), lowercased and trimmed to
+    /// a bounded alphabet, or `unknown`.
+    static func clientLabel(userAgent: String?) -> String {
+        guard let product = userAgent?.split(whereSeparator: { $0 == "/" || $0 == " " }).first else {
+            return "unknown"
+        }
+        let allowed = Set("abcdefghijklmnopqrstuvwxyz0123456789._-")
+        let label = String(product.lowercased().filter { allowed.contains($0) }.prefix(40))
+        return label.isEmpty ? "unknown" : label
+    }
+
+    private static func httpDate(_ date: Date) -> String {
+        let formatter = DateFormatter()
+        formatter.locale = Locale(identifier: "en_US_POSIX")
+        formatter.timeZone = TimeZone(identifier: "GMT")
+        formatter.dateFormat = "EEE, dd MMM yyyy HH:mm:ss 'GMT'"
+        return formatter.string(from: date)
+    }
+}
@@ -15,8 +15,8 @@ import Vapor
 //  - **loginOnly**: authenticated, but outside the IAM resource tree —
 //    identity-plane surfaces whose authorization is row scoping by
 //    construction (my API keys, my user record, my OAuth sessions, the
-//    operation-initiator fallback, the can-i/who-can query endpoints which
-//    gate per resource internally).
+//    operation-initiator fallback, the can-i/who-can query endpoints and
+//    GraphQL, which gate per resource internally).
 //  - **resource-mapped**: the middleware itself evaluates a Cedar check
 //    derived from the method and path (VMs and sandboxes, as before —
 //    handlers keep their finer checks as defense in depth).
@@ -76,6 +76,7 @@ struct AuthorizationMiddleware: AsyncMiddleware {
         "/api/operations",  // initiator-may-read fallback; non-initiators 404
         "/api/oauth",  // the caller's own device approvals and CLI sessions
         "/api/authorization",  // can-i / who-can gate per queried resource internally
+        "/api/graphql",  // every object resolved is gated through the evaluator
     ]
 
     /// Route prefixes whose handlers authorize through the evaluator
@@ -92,11 +93,15 @@ struct AuthorizationMiddleware: AsyncMiddleware {
         "/api/organizations",
         "/api/projects",
         "/api/volumes",
+        "/api/volume-types",
         "/api/networks",
         "/api/images",
         "/api/floating-ips",
         "/api/floating-ip-pools",
         "/api/security-groups",
+        "/api/file-shares",
+        "/api/buckets",
+        "/api/object-storage",
         "/api/agents",
         "/api/agent-enrollments",
         "/api/sites",
@@ -104,11 +109,17 @@ struct AuthorizationMiddleware: AsyncMiddleware {
         "/api/iam",
         "/api/hierarchy",
         "/api/audit-events",
+        // The published versions are any caller's to read; who still calls
+        // deprecated ones is system-admin.
+        "/api/api-versions",
         "/api/workload-identity",
         // Workload principals (issue #491): service-account CRUD authorizes
         // per-node via the evaluator; the registry surface is system-admin.
         "/api/service-accounts",
         "/api/workload-registrations",
+        // Code-interpreter sessions: each handler authorizes the session's
+        // sandbox (read / exec / delete) via `req.authorizedSandbox`.
+        "/api/code-sessions",
         // SCIM token management (the data plane under /scim/v2 is public,
         // matched earlier).
         "/organizations",
@@ -146,6 +157,16 @@ struct AuthorizationMiddleware: AsyncMiddleware {
         let isAgentSnapshotArtifact =
             path.hasPrefix("/api/sandboxes/") && path.contains("/snapshots/")
             && path.contains("/artifacts/")
+        // Volume migration data (copy of a detached volume): the source agent
+        // uploads and the target agent downloads the disk with their SPIFFE
+        // SVIDs over mTLS; the handler authenticates the forwarded client
+        // certificate before touching any bytes.
+        let isAgentVolumeMigrationData =
+            path.hasPrefix("/api/volumes/") && path.contains("/migrations/") && path.hasSuffix("/data")
+        // Image build capture: the build VM's agent uploads the stopped VM's
+        // disk with its SPIFFE SVID over mTLS; the handler authenticates the
+        // forwarded client certificate before touching any bytes.
+        let isAgentImageBuildDisk = path.hasPrefix("/api/image-builds/") && path.hasSuffix("/disk")
         // Routes whose path has a dynamic segment before the public part, so a
         // flat prefix can't express them: exempt when the path starts with
         // `prefix` AND contains `infix`. The SCIM data plane
@@ -160,7 +181,8 @@ struct AuthorizationMiddleware: AsyncMiddleware {
             path.hasPrefix(pair.prefix) && path.contains(pair.infix)
         }
         if exactPublic.contains(path) || publicPrefixes.contains(where: { path.hasPrefix($0) })
-            || isAgentDownload || isAgentSnapshotArtifact || isPublicPrefixInfix
+            || isAgentDownload || isAgentSnapshotArtifact || isAgentVolumeMigrationData || isAgentImageBuildDisk
+            || isPublicPrefixInfix
         {
             return .isPublic
         }
@@ -270,6 +292,16 @@ struct AuthorizationMiddleware: AsyncMiddleware {
         // mapping below would demand `delete` on the *sandbox* to delete one
         // of its snapshots.
         let isSnapshotSubresource = pathComponents.count >= 4 && pathComponents[3] == "snapshots"
+        // Likewise, removing a VM's health check edits the VM's settings:
+        // plain `update`, not `delete` on the VM.
+        let isSettingSubresource = pathComponents.count == 4 && pathComponents[3] == "health-check"
+        // Sharing a console or exec session — inviting or removing its
+        // participants — takes the permission that opens the session, not
+        // `update` or `delete` on the VM or sandbox.
+        var sessionPermission: String?
+        if pathComponents.count >= 5 {
+            sessionPermission = ["console": "view_console", "exec": "exec"][String(pathComponents[3])]
+        }
 
         // Determine required permission based on HTTP method and path
         let permission: String
@@ -280,6 +312,8 @@ struct AuthorizationMiddleware: AsyncMiddleware {
             // Special handling for lifecycle actions
             if isSnapshotSubresource {
                 permission = "snapshot"
+            } else if let sessionPermission {
+                permission = sessionPermission
             } else if pathComponents.count >= 4 {
                 let action = String(pathComponents[3])
                 permission = resource.actionVerbs.contains(action) ? action : "update"
@@ -289,7 +323,11 @@ struct AuthorizationMiddleware: AsyncMiddleware {
         case .PUT, .PATCH:
             permission = "update"
         case .DELETE:
-            permission = isSnapshotSubresource ? "snapshot" : "delete"
+            if let sessionPermission {
+                permission = sessionPermission
+            } else {
+                permission = isSnapshotSubresource ? "snapshot" : isSettingSubresource ? "update" : "delete"
+            }
         default:
             throw Abort(.methodNotAllowed)
         }
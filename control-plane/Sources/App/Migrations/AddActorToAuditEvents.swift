@@ -0,0 +1,72 @@
+import Fluent
+import SQLKit
+
+/// `audit_events.actor_type` / `actor_id`, and the indexes the audit query
+/// language leans on.
+///
+/// The actor was implicit before: a user in `user_id`, an automation rule's
+/// service account only in its metadata, and nothing to tell a failed login
+/// from a background job. Existing rows are backfilled from those same
+/// signals — `user_id` → `user`, an automation action → its
+/// `serviceAccountId`, any other request (it has a `method`) → `anonymous`,
+/// everything else stays the `system` default.
+struct AddActorToAuditEvents: AsyncMigration {
+    static let indexes: [(name: String, definition: String)] = [
+        // `actor.type == …` and `count by actor`, newest first.
+        ("idx_audit_events_actor", "audit_events (actor_type, actor_id, created_at)"),
+        // `type == …` over a time window.
+        ("idx_audit_events_type_created", "audit_events (event_type, created_at)"),
+        // `type startsWith "iam."`: a prefix `LIKE` needs byte-ordered
+        // pattern ops under a non-C collation (see `AddFolderPathIndex`).
+        ("idx_audit_events_type_prefix", "audit_events (event_type varchar_pattern_ops)"),
+    ]
+
+    func prepare(on database: Database) async throws {
+        try await database.schema("audit_events")
+            .field("actor_type", .string, .required, .custom("DEFAULT 'system'"))
+            .field("actor_id", .uuid)
+            .update()
+
+        guard let sql = database as? SQLDatabase else { return }
+
+        try await sql.raw(
+            """
+            UPDATE audit_events SET actor_type = 'user', actor_id = user_id WHERE user_id IS NOT NULL
+            """
+        ).run()
+
+        try await sql.raw(
+            """
+            UPDATE audit_events
+            SET actor_type = 'service_account', actor_id = (metadata::jsonb ->> 'serviceAccountId')::uuid
+            WHERE event_type = \(bind: AuditEventType.automationAction.rawValue) AND user_id IS NULL
+            """
+        ).run()
+
+        try await sql.raw(
+            """
+            UPDATE audit_events SET actor_type = 'anonymous'
+            WHERE user_id IS NULL AND method IS NOT NULL
+              AND event_type <> \(bind: AuditEventType.automationAction.rawValue)
+            """
+        ).run()
+
+        for index in Self.indexes {
+            try await sql.raw(
+                "CREATE INDEX IF NOT EXISTS \(unsafeRaw: index.name) ON \(unsafeRaw: index.definition)"
+            ).run()
+        }
+    }
+
+    func revert(on database: Database) async throws {
+        if let sql = database as? SQLDatabase {
+            for index in Self.indexes {
+                try await sql.raw("DROP INDEX IF EXISTS \(unsafeRaw: index.name)").run()
+            }
+        }
+        try await database.schema("audit_events")
+            .deleteField("actor_type")
+            .deleteField("actor_id")
+            .update()
+    }
+}
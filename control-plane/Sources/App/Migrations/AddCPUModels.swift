@@ -0,0 +1,28 @@
+import Fluent
+import Foundation
+
+/// Explicit guest CPU models (wire v28).
+///
+/// * `vms.cpu_model` — the VM's requested model. Nil is host passthrough,
+///   exactly the behavior before this column, so existing VMs are unaffected.
+/// * `sites.default_cpu_model` — the model QEMU VMs placed in the site get
+///   when they don't name one. Nil keeps passthrough.
+struct AddCPUModels: AsyncMigration {
+    func prepare(on database: Database) async throws {
+        try await database.schema("vms")
+            .field("cpu_model", .string)
+            .update()
+        try await database.schema("sites")
+            .field("default_cpu_model", .string)
+            .update()
+    }
+
+    func revert(on database: Database) async throws {
+        try await database.schema("vms")
+            .deleteField("cpu_model")
+            .update()
+        try await database.schema("sites")
+            .deleteField("default_cpu_model")
+            .update()
+    }
+}
@@ -0,0 +1,39 @@
+import Fluent
+
+/// Tenant maintenance windows.
+///
+/// * `projects.maintenance_policy` — the project's windows, deny periods and
+///   notice lead as JSON. Nil takes disruptive work at any time, exactly the
+///   behavior before this migration.
+/// * `maintenance_notices` — one row per piece of announced work per
+///   project, holding the time it was scheduled for; unique per action and
+///   subject so a sweep never announces the same work twice.
+struct AddMaintenanceWindows: AsyncMigration {
+    func prepare(on database: Database) async throws {
+        try await database.schema("projects")
+            .field("maintenance_policy", .json)
+            .update()
+
+        try await database.schema("maintenance_notices")
+            .id()
+            .field(
+                "project_id", .uuid, .required,
+                .references("projects", "id", onDelete: .cascade)
+            )
+            .field("action", .string, .required)
+            .field("subject", .string, .required)
+            .field("scheduled_for", .datetime, .required)
+            .field("summary", .string, .required)
+            .field("started_at", .datetime)
+            .field("created_at", .datetime)
+            .unique(on: "project_id", "action", "subject")
+            .create()
+    }
+
+    func revert(on database: Database) async throws {
+        try await database.schema("maintenance_notices").delete()
+        try await database.schema("projects")
+            .deleteField("maintenance_policy")
+            .update()
+    }
+}
@@ -0,0 +1,19 @@
+import Fluent
+import Foundation
+
+/// Adds `memory_floor` to `vms`: the least memory an agent's pressure reclaim
+/// may leave the guest. Nullable; a null floor takes the agent policy's
+/// default fraction of the grant.
+struct AddMemoryFloorToVM: AsyncMigration {
+    func prepare(on database: Database) async throws {
+        try await database.schema("vms")
+            .field("memory_floor", .int64)
+            .update()
+    }
+
+    func revert(on database: Database) async throws {
+        try await database.schema("vms")
+            .deleteField("memory_floor")
+            .update()
+    }
+}
@@ -0,0 +1,25 @@
+import Fluent
+
+/// Adds an agent's memory overcommit policy (`MemoryOvercommitPolicy`, one
+/// JSON object) and the unclamped committed memory it reports from wire v26
+/// on. Both nullable: a row without a policy admits memory one to one, and
+/// one without a committed figure falls back to `available_memory`.
+struct AddMemoryOvercommitToAgent: AsyncMigration {
+    func prepare(on database: Database) async throws {
+        try await database.schema("agents")
+            .field("memory_overcommit", .json)
+            .update()
+        try await database.schema("agents")
+            .field("committed_memory", .int64)
+            .update()
+    }
+
+    func revert(on database: Database) async throws {
+        try await database.schema("agents")
+            .deleteField("memory_overcommit")
+            .update()
+        try await database.schema("agents")
+            .deleteField("committed_memory")
+            .update()
+    }
+}
@@ -0,0 +1,48 @@
+import Fluent
+import SQLKit
+
+/// Adds `migrating` to `volumes.status`: the enforced value set, and the
+/// partial index the stuck-volume sweep reads (`AddHotPathIndexes`), whose
+/// predicate lists the transitional statuses literally. A sweep query that
+/// names a status outside the predicate can't use the index at all, so the
+/// index is rebuilt with `migrating` included rather than left narrower than
+/// `AgentService.transitionalVolumeStatuses`.
+///
+/// Re-installing the constraint is idempotent (drop-if-exists first), as in
+/// `AddSnapshotExportOperationKind`.
+struct AddMigratingVolumeStatus: AsyncMigration {
+    private static var constraint: PersistedEnumConstraint {
+        // The canonical definition, which already includes `migrating`.
+        EnforcePersistedEnumValues.constraints.first {
+            $0.table == "volumes" && $0.column == "status"
+        }!
+    }
+
+    static let indexName = "idx_volumes_transitional"
+    static let indexDefinition = """
+        volumes (status)
+        WHERE status IN ('creating', 'attaching', 'detaching', 'resizing', 'snapshotting', 'cloning', 'migrating')
+        """
+    private static let previousIndexDefinition = """
+        volumes (status)
+        WHERE status IN ('creating', 'attaching', 'detaching', 'resizing', 'snapshotting', 'cloning')
+        """
+
+    func prepare(on database: any Database) async throws {
+        try await EnforcePersistedEnumValues.prepare(Self.constraint, on: database)
+        try await rebuildIndex(Self.indexDefinition, on: database)
+    }
+
+    func revert(on database: any Database) async throws {
+        // The constraint is re-installed rather than narrowed, for the reason
+        // `AddSnapshotExportOperationKind` gives: rows may carry the value.
+        try await EnforcePersistedEnumValues.prepare(Self.constraint, on: database)
+        try await rebuildIndex(Self.previousIndexDefinition, on: database)
+    }
+
+    private func rebuildIndex(_ definition: String, on database: any Database) async throws {
+        guard let sql = database as? SQLDatabase else { return }
+        try await sql.raw("DROP INDEX IF EXISTS \(unsafeRaw: Self.indexName)").run()
+        try await sql.raw("CREATE INDEX \(unsafeRaw: Self.indexName) ON \(unsafeRaw: definition)").run()
+    }
+}
@@ -0,0 +1,18 @@
+import Fluent
+import SQLKit
+
+/// `volumes.multi_attach`: whether several VMs may hold the volume at once.
+/// Defaults to false, which is every volume's behavior before the column.
+struct AddMultiAttachToVolume: AsyncMigration {
+    func prepare(on database: Database) async throws {
+        try await database.schema(Volume.schema)
+            .field("multi_attach", .bool, .required, .sql(.default(false)))
+            .update()
+    }
+
+    func revert(on database: Database) async throws {
+        try await database.schema(Volume.schema)
+            .deleteField("multi_attach")
+            .update()
+    }
+}
@@ -0,0 +1,21 @@
+import Fluent
+
+/// Where a replica is served over NBD, for an attached volume migrated away
+/// from its VM's host. Null for every replica that predates the columns.
+struct AddNBDExportToVolumeReplica: AsyncMigration {
+    func prepare(on database: Database) async throws {
+        try await database.schema(VolumeReplica.schema)
+            .field("nbd_host", .string)
+            .field("nbd_port", .int)
+            .field("nbd_export_name", .string)
+            .update()
+    }
+
+    func revert(on database: Database) async throws {
+        try await database.schema(VolumeReplica.schema)
+            .deleteField("nbd_host")
+            .deleteField("nbd_port")
+            .deleteField("nbd_export_name")
+            .update()
+    }
+}
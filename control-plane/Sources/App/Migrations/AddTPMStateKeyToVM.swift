@@ -0,0 +1,21 @@
+import Fluent
+
+/// Encrypted vTPM state (wire v32): `vms.tpm_state_key`, the key the agent
+/// encrypts the VM's TPM state with, stored through `secretsEncryption`.
+/// A TPM VM gets its key when it is created; the ones that already exist get
+/// theirs from `SecretsEncryptionService.mintTPMStateKeys` at startup, not
+/// here: migrations have no secrets key, and a state key is never stored
+/// unwrapped. VMs without a TPM never get one.
+struct AddTPMStateKeyToVM: AsyncMigration {
+    func prepare(on database: Database) async throws {
+        try await database.schema("vms")
+            .field("tpm_state_key", .string)
+            .update()
+    }
+
+    func revert(on database: Database) async throws {
+        try await database.schema("vms")
+            .deleteField("tpm_state_key")
+            .update()
+    }
+}
@@ -0,0 +1,19 @@
+import Fluent
+import Foundation
+
+/// Adds `usage_sampled_at` to `vms`: when `VMUsageRecorder` last folded a
+/// report into the VM's usage history, so it samples on its own cadence
+/// rather than on every report.
+struct AddUsageSampledAtToVM: AsyncMigration {
+    func prepare(on database: Database) async throws {
+        try await database.schema("vms")
+            .field("usage_sampled_at", .datetime)
+            .update()
+    }
+
+    func revert(on database: Database) async throws {
+        try await database.schema("vms")
+            .deleteField("usage_sampled_at")
+            .update()
+    }
+}
@@ -0,0 +1,45 @@
+import Fluent
+
+/// VM application health checks (wire v31).
+///
+/// * `vms.health_check` / `vms.health_action` — the check the agent runs and
+///   what the control plane does when it fails. Nil checks nothing, exactly
+///   the behavior before this migration.
+/// * `vms.health_status`, `health_consecutive_failures`, `health_checked_at`,
+///   `health_message` — the agent's last reported verdict.
+/// * `vms.replacement_count` — replacements from the VM's image, carried on
+///   its desired state.
+struct AddVMHealthChecks: AsyncMigration {
+    private static let columns: [(FieldKey, DatabaseSchema.DataType)] = [
+        ("health_check", .json),
+        ("health_action", .string),
+        ("health_status", .string),
+        ("health_consecutive_failures", .int),
+        ("health_checked_at", .datetime),
+        ("health_message", .string),
+    ]
+
+    func prepare(on database: Database) async throws {
+        // Single action per update() call, matching the rest of the `vms`
+        // column migrations.
+        for (key, type) in Self.columns {
+            try await database.schema("vms")
+                .field(key, type)
+                .update()
+        }
+        try await database.schema("vms")
+            .field("replacement_count", .int64, .required, .custom("DEFAULT 0"))
+            .update()
+    }
+
+    func revert(on database: Database) async throws {
+        try await database.schema("vms")
+            .deleteField("replacement_count")
+            .update()
+        for (key, _) in Self.columns.reversed() {
+            try await database.schema("vms")
+                .deleteField(key)
+                .update()
+        }
+    }
+}
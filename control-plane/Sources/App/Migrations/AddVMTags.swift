@@ -0,0 +1,17 @@
+import Fluent
+
+/// `vms.tags`: free-form key/value labels. Nil on existing rows, which read
+/// as no tags.
+struct AddVMTags: AsyncMigration {
+    func prepare(on database: Database) async throws {
+        try await database.schema("vms")
+            .field("tags", .json)
+            .update()
+    }
+
+    func revert(on database: Database) async throws {
+        try await database.schema("vms")
+            .deleteField("tags")
+            .update()
+    }
+}
@@ -0,0 +1,19 @@
+import Fluent
+
+/// A volume optionally belongs to a volume type (`volume_type_id`). Nullable:
+/// volumes created before types existed — and creates that name no type —
+/// keep today's behavior in the default pool. No `ON DELETE` action, so the
+/// database refuses to drop a type that volumes still reference.
+struct AddVolumeTypeToVolume: AsyncMigration {
+    func prepare(on database: Database) async throws {
+        try await database.schema(Volume.schema)
+            .field("volume_type_id", .uuid, .references(VolumeTypeDefinition.schema, "id"))
+            .update()
+    }
+
+    func revert(on database: Database) async throws {
+        try await database.schema(Volume.schema)
+            .deleteField("volume_type_id")
+            .update()
+    }
+}
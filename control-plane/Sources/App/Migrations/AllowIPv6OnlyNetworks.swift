@@ -0,0 +1,21 @@
+import Fluent
+import SQLKit
+
+/// Makes `logical_networks.subnet` nullable: an IPv6-only network has no IPv4
+/// subnet at all. Existing rows keep theirs.
+///
+/// Reverting fails while any IPv6-only network exists — there is no IPv4
+/// subnet to put back — so delete those first.
+struct AllowIPv6OnlyNetworks: AsyncMigration {
+    struct UnsupportedDatabase: Error {}
+
+    func prepare(on database: Database) async throws {
+        guard let sql = database as? SQLDatabase else { throw UnsupportedDatabase() }
+        try await sql.raw("ALTER TABLE logical_networks ALTER COLUMN subnet DROP NOT NULL").run()
+    }
+
+    func revert(on database: Database) async throws {
+        guard let sql = database as? SQLDatabase else { throw UnsupportedDatabase() }
+        try await sql.raw("ALTER TABLE logical_networks ALTER COLUMN subnet SET NOT NULL").run()
+    }
+}
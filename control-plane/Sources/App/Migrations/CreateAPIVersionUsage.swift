@@ -0,0 +1,24 @@
+import Fluent
+
+/// Per-credential request counts in deprecated API versions. The unique key
+/// is what `APIVersionUsageTracker`'s upsert conflicts on.
+struct CreateAPIVersionUsage: AsyncMigration {
+    func prepare(on database: Database) async throws {
+        try await database.schema("api_version_usage")
+            .id()
+            .field("api_version", .int, .required)
+            .field("client_type", .string, .required)
+            .field("client_id", .uuid, .required)
+            .field("client_name", .string, .required)
+            .field("user_agent", .string)
+            .field("request_count", .int64, .required)
+            .field("first_seen_at", .datetime, .required)
+            .field("last_seen_at", .datetime, .required)
+            .unique(on: "api_version", "client_type", "client_id")
+            .create()
+    }
+
+    func revert(on database: Database) async throws {
+        try await database.schema("api_version_usage").delete()
+    }
+}
@@ -0,0 +1,49 @@
+import Fluent
+import SQLKit
+
+/// External admission webhooks: per organization, called in `position` order
+/// before creates and operations.
+struct CreateAdmissionWebhooks: AsyncMigration {
+    func prepare(on database: Database) async throws {
+        try await database.schema("admission_webhooks")
+            .id()
+            .field(
+                "organization_id", .uuid, .required,
+                .references("organizations", "id", onDelete: .cascade)
+            )
+            .field("name", .string, .required)
+            .field("url", .string, .required)
+            .field("position", .int, .required, .custom("DEFAULT 0"))
+            .field("resource_kinds", .array(of: .string), .required)
+            .field("operations", .array(of: .string), .required)
+            .field("failure_policy", .string, .required, .custom("DEFAULT 'fail'"))
+            .field("timeout_seconds", .int, .required, .custom("DEFAULT 5"))
+            .field("signing_secret", .string, .required)
+            .field("is_active", .bool, .required, .custom("DEFAULT TRUE"))
+            .field(
+                "created_by_id", .uuid, .required,
+                .references("users", "id")
+            )
+            .field("created_at", .datetime)
+            .field("updated_at", .datetime)
+            .unique(on: "organization_id", "name")
+            .create()
+
+        // Every reviewed request reads its organization's active webhooks.
+        if let sql = database as? SQLDatabase {
+            try await sql.raw(
+                """
+                CREATE INDEX IF NOT EXISTS idx_admission_webhooks_org_active
+                ON admission_webhooks (organization_id, is_active)
+                """
+            ).run()
+        }
+    }
+
+    func revert(on database: Database) async throws {
+        if let sql = database as? SQLDatabase {
+            try await sql.raw("DROP INDEX IF EXISTS idx_admission_webhooks_org_active").run()
+        }
+        try await database.schema("admission_webhooks").delete()
+    }
+}
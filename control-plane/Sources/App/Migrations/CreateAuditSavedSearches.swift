@@ -0,0 +1,22 @@
+import Fluent
+
+/// Named audit queries, per organization.
+struct CreateAuditSavedSearches: AsyncMigration {
+    func prepare(on database: Database) async throws {
+        try await database.schema("audit_saved_searches")
+            .id()
+            .field("organization_id", .uuid, .required, .references("organizations", "id", onDelete: .cascade))
+            .field("name", .string, .required)
+            .field("description", .string, .required)
+            .field("query", .string, .required)
+            .field("created_by_id", .uuid, .references("users", "id", onDelete: .setNull))
+            .field("created_at", .datetime)
+            .field("updated_at", .datetime)
+            .unique(on: "organization_id", "name")
+            .create()
+    }
+
+    func revert(on database: Database) async throws {
+        try await database.schema("audit_saved_searches").delete()
+    }
+}
@@ -0,0 +1,90 @@
+import Fluent
+import SQLKit
+
+/// Event-driven automation: per-project rules and the history of their runs.
+struct CreateAutomationRules: AsyncMigration {
+    func prepare(on database: Database) async throws {
+        // `actions` and `steps` are Swift arrays of structs, so `jsonb[]`
+        // rather than a scalar JSONB column (the `agents.hypervisors`
+        // precedent).
+        try await database.schema("automation_rules")
+            .id()
+            .field(
+                "project_id", .uuid, .required,
+                .references("projects", "id", onDelete: .cascade)
+            )
+            .field("name", .string, .required)
+            .field("description", .string, .required, .custom("DEFAULT ''"))
+            .field("trigger_event_type", .string, .required)
+            .field("filter", .string, .required, .custom("DEFAULT ''"))
+            .field("conditions", .array(of: .string), .required)
+            .field("actions", .array(of: .json), .required)
+            .field(
+                "service_account_id", .uuid, .required,
+                .references("service_accounts", "id", onDelete: .cascade)
+            )
+            .field("max_runs_per_hour", .int, .required, .custom("DEFAULT 10"))
+            .field("signing_secret", .string, .required)
+            .field("is_active", .bool, .required, .custom("DEFAULT TRUE"))
+            .field(
+                "created_by_id", .uuid, .required,
+                .references("users", "id")
+            )
+            .field("created_at", .datetime)
+            .field("updated_at", .datetime)
+            .unique(on: "project_id", "name")
+            .create()
+
+        try await database.schema("automation_runs")
+            .id()
+            .field(
+                "rule_id", .uuid, .required,
+                .references("automation_rules", "id", onDelete: .cascade)
+            )
+            .field("event_id", .uuid, .required)
+            .field("event_type", .string, .required)
+            .field("event_payload", .string, .required)
+            .field("status", .string, .required)
+            .field("steps", .array(of: .json), .required)
+            .field("error", .string)
+            .field("started_at", .datetime)
+            .field("completed_at", .datetime)
+            .field("created_at", .datetime)
+            .create()
+
+        if let sql = database as? SQLDatabase {
+            // Every enqueued event reads the active rules of its project and
+            // type.
+            try await sql.raw(
+                """
+                CREATE INDEX IF NOT EXISTS idx_automation_rules_project_trigger
+                ON automation_rules (project_id, trigger_event_type)
+                """
+            ).run()
+            // The sweep claims pending runs oldest first; the rate limit and
+            // run history read one rule's recent runs.
+            try await sql.raw(
+                """
+                CREATE INDEX IF NOT EXISTS idx_automation_runs_status_created
+                ON automation_runs (status, created_at)
+                """
+            ).run()
+            try await sql.raw(
+                """
+                CREATE INDEX IF NOT EXISTS idx_automation_runs_rule_created
+                ON automation_runs (rule_id, created_at)
+                """
+            ).run()
+        }
+    }
+
+    func revert(on database: Database) async throws {
+        if let sql = database as? SQLDatabase {
+            try await sql.raw("DROP INDEX IF EXISTS idx_automation_runs_rule_created").run()
+            try await sql.raw("DROP INDEX IF EXISTS idx_automation_runs_status_created").run()
+            try await sql.raw("DROP INDEX IF EXISTS idx_automation_rules_project_trigger").run()
+        }
+        try await database.schema("automation_runs").delete()
+        try await database.schema("automation_rules").delete()
+    }
+}
@@ -0,0 +1,60 @@
+import Fluent
+import SQLKit
+
+/// Organization-owned prefixes brought to the platform, and the link from a
+/// floating-IP pool back to the prefix it was made from.
+///
+/// Verified rows may not overlap: several organizations may register the
+/// same (or an overlapping) prefix, and only the first to prove control gets
+/// it — a plain unique index would let whoever registers first squat on
+/// space they can't prove, and would not catch a /25 inside a verified /24.
+///
+/// The organization cascades: its prefixes mean nothing without it. The
+/// pool's link has no cascade — the API deletes the pool with its prefix,
+/// and refuses while addresses are allocated.
+struct CreateBYOIPPrefixes: AsyncMigration {
+    func prepare(on database: Database) async throws {
+        try await database.schema("byoip_prefixes")
+            .id()
+            .field("organization_id", .uuid, .required, .references("organizations", "id", onDelete: .cascade))
+            .field("site_id", .uuid, .references("sites", "id", onDelete: .setNull))
+            .field("cidr", .string, .required)
+            .field("pool_name", .string, .required)
+            .field("verification_method", .string, .required)
+            .field("challenge", .string, .required)
+            .field("status", .string, .required)
+            .field("status_message", .string)
+            .field("origin_asn", .int)
+            .field("verified_at", .datetime)
+            .field("created_by_id", .uuid, .references("users", "id", onDelete: .setNull))
+            .field("created_at", .datetime)
+            .field("updated_at", .datetime)
+            .create()
+
+        // The verify path checks for a verified overlap, then writes; two
+        // overlapping registrations verified at once would both pass the
+        // check. An exclusion constraint over the address range closes that
+        // race for overlaps, not just identical strings. Raw SQL: Fluent's
+        // schema builder has no exclusion constraints.
+        if let sql = database as? SQLDatabase {
+            try await sql.raw(
+                """
+                ALTER TABLE byoip_prefixes
+                ADD CONSTRAINT ex_byoip_prefixes_verified_overlap
+                EXCLUDE USING gist ((cidr::inet) inet_ops WITH &&) WHERE (status = 'verified')
+                """
+            ).run()
+        }
+
+        try await database.schema("floating_ip_pools")
+            .field("byoip_prefix_id", .uuid, .references("byoip_prefixes", "id"))
+            .update()
+    }
+
+    func revert(on database: Database) async throws {
+        try await database.schema("floating_ip_pools")
+            .deleteField("byoip_prefix_id")
+            .update()
+        try await database.schema("byoip_prefixes").delete()
+    }
+}
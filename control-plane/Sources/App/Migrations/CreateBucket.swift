@@ -0,0 +1,47 @@
+import Fluent
+import SQLKit
+
+/// `buckets`: S3 buckets, with the same desired/observed split and generation
+/// pair as `file_shares`. Names are unique across the deployment — S3 clients
+/// address a bucket by name alone.
+struct CreateBucket: AsyncMigration {
+    func prepare(on database: Database) async throws {
+        try await database.schema(Bucket.schema)
+            .id()
+            .field("name", .string, .required)
+            .field("description", .string)
+            .field("project_id", .uuid, .required, .references("projects", "id"))
+            .field("environment", .string, .required)
+            .field("pool_id", .uuid, .references(StoragePool.schema, "id"))
+            .field("quota_bytes", .int64)
+            .field("used_bytes", .int64, .required)
+            .field("object_count", .int64, .required)
+            .field("endpoint", .string)
+            .field("hypervisor_id", .string)
+            .field("status", .string, .required)
+            .field("status_changed_at", .datetime)
+            .field("error_message", .string)
+            .field("desired_status", .string, .required)
+            .field("generation", .int64, .required)
+            .field("observed_generation", .int64, .required)
+            .field("created_at", .datetime)
+            .field("updated_at", .datetime)
+            .unique(on: "name")
+            .create()
+
+        // Sync assembly and observed-report application read an agent's
+        // buckets by placement.
+        if let sql = database as? SQLDatabase {
+            try await sql.raw(
+                "CREATE INDEX IF NOT EXISTS idx_buckets_hypervisor_id ON buckets (hypervisor_id)"
+            ).run()
+        }
+    }
+
+    func revert(on database: Database) async throws {
+        if let sql = database as? SQLDatabase {
+            try await sql.raw("DROP INDEX IF EXISTS idx_buckets_hypervisor_id").run()
+        }
+        try await database.schema(Bucket.schema).delete()
+    }
+}
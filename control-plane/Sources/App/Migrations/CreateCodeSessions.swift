@@ -0,0 +1,48 @@
+import Fluent
+import SQLKit
+
+/// Code-interpreter sessions. One per sandbox, and gone with it.
+struct CreateCodeSessions: AsyncMigration {
+    func prepare(on database: Database) async throws {
+        try await database.schema("code_sessions")
+            .id()
+            .field(
+                "sandbox_id", .uuid, .required,
+                .references("sandboxes", "id", onDelete: .cascade)
+            )
+            .field(
+                "project_id", .uuid, .required,
+                .references("projects", "id", onDelete: .cascade)
+            )
+            .field("language", .string, .required)
+            .field("state", .string, .required)
+            .field("idle_timeout_seconds", .int, .required)
+            .field("last_activity_at", .datetime, .required)
+            .field("executing_until", .datetime)
+            .field("execution_count", .int, .required, .custom("DEFAULT 0"))
+            .field("checkpoint_snapshot_id", .uuid)
+            .field("checkpointed_at", .datetime)
+            .field(
+                "created_by_id", .uuid, .required,
+                .references("users", "id")
+            )
+            .field("created_at", .datetime)
+            .field("updated_at", .datetime)
+            .unique(on: "sandbox_id")
+            .create()
+
+        if let sql = database as? SQLDatabase {
+            // The idle sweep reads sessions by state every pass.
+            try await sql.raw(
+                """
+                CREATE INDEX IF NOT EXISTS idx_code_sessions_state
+                ON code_sessions (state)
+                """
+            ).run()
+        }
+    }
+
+    func revert(on database: Database) async throws {
+        try await database.schema("code_sessions").delete()
+    }
+}
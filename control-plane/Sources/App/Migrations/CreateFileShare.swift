@@ -0,0 +1,53 @@
+import Fluent
+import SQLKit
+
+/// `file_shares`: managed NFS shares, with the same desired/observed split
+/// and generation pair as `sandboxes`. The network reference has no cascade —
+/// `NetworkController.deleteNetwork` refuses a network that still has shares.
+/// Share operations reuse `resource_operations` (`resource_kind = file_share`).
+struct CreateFileShare: AsyncMigration {
+    func prepare(on database: Database) async throws {
+        try await database.schema(FileShare.schema)
+            .id()
+            .field("name", .string, .required)
+            .field("description", .string)
+            .field("project_id", .uuid, .required, .references("projects", "id"))
+            .field("environment", .string, .required)
+            .field("network_id", .uuid, .required, .references("logical_networks", "id"))
+            .field("pool_id", .uuid, .references(StoragePool.schema, "id"))
+            .field("size_bytes", .int64, .required)
+            .field("observed_size_bytes", .int64)
+            .field("used_bytes", .int64)
+            .field("hypervisor_id", .string)
+            .field("ip_address", .string, .required)
+            .field("netmask", .string, .required)
+            .field("mac_address", .string, .required)
+            .field("status", .string, .required)
+            .field("status_changed_at", .datetime)
+            .field("error_message", .string)
+            .field("desired_status", .string, .required)
+            .field("generation", .int64, .required)
+            .field("observed_generation", .int64, .required)
+            .field("created_at", .datetime)
+            .field("updated_at", .datetime)
+            // One address per network, like the NIC address tables; the
+            // IPAM advisory lock serializes allocations across the tables.
+            .unique(on: "network_id", "ip_address")
+            .create()
+
+        // Sync assembly and observed-report application read an agent's
+        // shares by placement.
+        if let sql = database as? SQLDatabase {
+            try await sql.raw(
+                "CREATE INDEX IF NOT EXISTS idx_file_shares_hypervisor_id ON file_shares (hypervisor_id)"
+            ).run()
+        }
+    }
+
+    func revert(on database: Database) async throws {
+        if let sql = database as? SQLDatabase {
+            try await sql.raw("DROP INDEX IF EXISTS idx_file_shares_hypervisor_id").run()
+        }
+        try await database.schema(FileShare.schema).delete()
+    }
+}
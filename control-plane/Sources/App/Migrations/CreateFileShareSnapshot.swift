@@ -0,0 +1,31 @@
+import Fluent
+import SQLKit
+
+/// `file_share_snapshots`: point-in-time copies of a share, cascading with
+/// it. Project and environment are denormalized for quota scoping.
+struct CreateFileShareSnapshot: AsyncMigration {
+    func prepare(on database: Database) async throws {
+        try await database.schema(FileShareSnapshot.schema)
+            .id()
+            .field(
+                "file_share_id", .uuid, .required, .references(FileShare.schema, "id", onDelete: .cascade))
+            .field("project_id", .uuid, .required, .references("projects", "id"))
+            .field("environment", .string, .required)
+            .field("name", .string, .required)
+            .field("status", .string, .required)
+            .field("size_bytes", .int64)
+            .field("created_at", .datetime)
+            .field("updated_at", .datetime)
+            .create()
+
+        if let sql = database as? SQLDatabase {
+            try await sql.raw(
+                "CREATE INDEX IF NOT EXISTS idx_file_share_snapshots_file_share_id ON file_share_snapshots (file_share_id)"
+            ).run()
+        }
+    }
+
+    func revert(on database: Database) async throws {
+        try await database.schema(FileShareSnapshot.schema).delete()
+    }
+}
@@ -0,0 +1,27 @@
+import Fluent
+
+/// Addresses held on a logical network for a project ahead of any VM.
+///
+/// `(network_id, address)` is unique, so two projects racing for one address
+/// can't both commit. Both parents cascade: a reservation means nothing
+/// without its network, and a deleted project holds nothing.
+struct CreateIPReservations: AsyncMigration {
+    func prepare(on database: Database) async throws {
+        try await database.schema("ip_reservations")
+            .id()
+            .field("network_id", .uuid, .required, .references("logical_networks", "id", onDelete: .cascade))
+            .field("project_id", .uuid, .required, .references("projects", "id", onDelete: .cascade))
+            .field("family", .string, .required)
+            .field("address", .string, .required)
+            .field("description", .string, .required)
+            .field("created_by_id", .uuid, .references("users", "id", onDelete: .setNull))
+            .field("created_at", .datetime)
+            .field("updated_at", .datetime)
+            .unique(on: "network_id", "address")
+            .create()
+    }
+
+    func revert(on database: Database) async throws {
+        try await database.schema("ip_reservations").delete()
+    }
+}
@@ -0,0 +1,88 @@
+import Fluent
+import SQLKit
+
+/// Server-side image builds: the `image_builds` table, the build a VM was
+/// created to run (`vms.image_build_id`), and the version and producing
+/// build of each image (`images.version`, `images.image_build_id`). Images
+/// that predate builds are version 1.
+struct CreateImageBuilds: AsyncMigration {
+    func prepare(on database: Database) async throws {
+        try await database.schema("image_builds")
+            .id()
+            .field(
+                "project_id", .uuid, .required,
+                .references("projects", "id", onDelete: .cascade)
+            )
+            .field("environment", .string, .required)
+            .field("name", .string, .required)
+            .field(
+                "base_image_id", .uuid,
+                .references("images", "id", onDelete: .setNull)
+            )
+            .field("target_image_name", .string, .required)
+            .field("target_image_description", .string, .required)
+            .field("user_data", .string)
+            .field("provisioners", .json, .required)
+            .field("network_id", .uuid)
+            .field("cpu", .int, .required)
+            .field("memory", .int64, .required)
+            .field("disk", .int64, .required)
+            .field("status", .string, .required)
+            .field("step_index", .int, .required, .custom("DEFAULT 0"))
+            .field("step_deadline", .datetime)
+            .field("phase_started_at", .datetime, .required)
+            .field("log", .string, .required)
+            .field("error_message", .string)
+            .field("cancel_requested", .bool, .required, .custom("DEFAULT FALSE"))
+            .field("vm_id", .uuid)
+            .field(
+                "image_id", .uuid,
+                .references("images", "id", onDelete: .setNull)
+            )
+            .field(
+                "created_by_id", .uuid, .required,
+                .references("users", "id")
+            )
+            .field("started_at", .datetime)
+            .field("finished_at", .datetime)
+            .field("created_at", .datetime)
+            .field("updated_at", .datetime)
+            .create()
+
+        try await database.schema("vms")
+            .field(
+                "image_build_id", .uuid,
+                .references("image_builds", "id", onDelete: .setNull)
+            )
+            .update()
+
+        try await database.schema("images")
+            .field("version", .int, .required, .custom("DEFAULT 1"))
+            .field(
+                "image_build_id", .uuid,
+                .references("image_builds", "id", onDelete: .setNull)
+            )
+            .update()
+
+        if let sql = database as? SQLDatabase {
+            // The build sweep reads builds by status every pass.
+            try await sql.raw(
+                """
+                CREATE INDEX IF NOT EXISTS idx_image_builds_status
+                ON image_builds (status)
+                """
+            ).run()
+        }
+    }
+
+    func revert(on database: Database) async throws {
+        try await database.schema("images")
+            .deleteField("image_build_id")
+            .deleteField("version")
+            .update()
+        try await database.schema("vms")
+            .deleteField("image_build_id")
+            .update()
+        try await database.schema("image_builds").delete()
+    }
+}
@@ -0,0 +1,24 @@
+import Fluent
+
+/// `object_storage_access_keys`: SigV4 key pairs for the object gateways, each
+/// owned by a user or a service account and removed with it. The secret is
+/// encrypted at rest like `registry_pull_secrets.secret`.
+struct CreateObjectStorageAccessKey: AsyncMigration {
+    func prepare(on database: Database) async throws {
+        try await database.schema(ObjectStorageAccessKey.schema)
+            .id()
+            .field("access_key_id", .string, .required)
+            .field("secret", .string, .required)
+            .field("name", .string, .required)
+            .field("user_id", .uuid, .references("users", "id", onDelete: .cascade))
+            .field("service_account_id", .uuid, .references("service_accounts", "id", onDelete: .cascade))
+            .field("created_by", .uuid, .required)
+            .field("created_at", .datetime)
+            .unique(on: "access_key_id")
+            .create()
+    }
+
+    func revert(on database: Database) async throws {
+        try await database.schema(ObjectStorageAccessKey.schema).delete()
+    }
+}
@@ -0,0 +1,46 @@
+import Fluent
+import SQLKit
+
+/// Email domains organizations prove they control through DNS.
+///
+/// `domain` is unique per organization, and globally only among verified
+/// rows: several organizations may register the same domain and only the
+/// first to publish its challenge record gets it, so a plain unique index
+/// would let whoever registers first squat on a domain they can't prove (the
+/// reasoning of `byoip_prefixes`).
+struct CreateOrganizationDomains: AsyncMigration {
+    func prepare(on database: Database) async throws {
+        try await database.schema("organization_domains")
+            .id()
+            .field("organization_id", .uuid, .required, .references("organizations", "id", onDelete: .cascade))
+            .field("domain", .string, .required)
+            .field("verification_token", .string, .required)
+            .field("status", .string, .required)
+            .field("status_message", .string)
+            .field("verified_at", .datetime)
+            .field("auto_join", .bool, .required)
+            .field("default_role", .string, .required)
+            .field("claim_accounts", .bool, .required)
+            .field("created_by_id", .uuid, .references("users", "id", onDelete: .setNull))
+            .field("created_at", .datetime)
+            .field("updated_at", .datetime)
+            .unique(on: "organization_id", "domain")
+            .create()
+
+        // `verify` checks no other organization verified the domain, then
+        // writes; two organizations verifying at once would both pass the
+        // check. Raw SQL: Fluent's schema builder has no partial indexes.
+        if let sql = database as? SQLDatabase {
+            try await sql.raw(
+                """
+                CREATE UNIQUE INDEX uq_organization_domains_verified_domain
+                ON organization_domains (domain) WHERE status = 'verified'
+                """
+            ).run()
+        }
+    }
+
+    func revert(on database: Database) async throws {
+        try await database.schema("organization_domains").delete()
+    }
+}
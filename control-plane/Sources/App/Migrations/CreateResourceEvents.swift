@@ -0,0 +1,34 @@
+import Fluent
+import SQLKit
+
+/// The short-lived event log GraphQL subscriptions tail.
+struct CreateResourceEvents: AsyncMigration {
+    func prepare(on database: Database) async throws {
+        try await database.schema("resource_events")
+            .id()
+            .field("type", .string, .required)
+            .field("organization_id", .uuid, .required)
+            .field("project_id", .uuid)
+            .field("resource_kind", .string)
+            .field("resource_id", .uuid)
+            .field("resource_name", .string)
+            .field("data", .string, .required)
+            .field("occurred_at", .datetime, .required)
+            .field("created_at", .datetime)
+            .create()
+
+        // Every replica's stream polls by write time, and pruning deletes by it.
+        if let sql = database as? SQLDatabase {
+            try await sql.raw(
+                "CREATE INDEX IF NOT EXISTS idx_resource_events_created_at ON resource_events (created_at)"
+            ).run()
+        }
+    }
+
+    func revert(on database: Database) async throws {
+        if let sql = database as? SQLDatabase {
+            try await sql.raw("DROP INDEX IF EXISTS idx_resource_events_created_at").run()
+        }
+        try await database.schema("resource_events").delete()
+    }
+}
@@ -0,0 +1,56 @@
+import Fluent
+
+/// Custom Secure Boot keys (wire v29).
+///
+/// * `secure_boot_key_sets` — uploaded key sets, per organization and
+///   optionally narrowed to one project.
+/// * `vms.secure_boot_key_set_id` — the set a VM was created from, kept for
+///   display; nulled if the set is deleted.
+/// * `vms.secure_boot_keys` — the keys the VM actually enrolls, copied from
+///   the set at creation. Nil boots with the firmware template's keys,
+///   exactly the behavior before this migration.
+struct CreateSecureBootKeySets: AsyncMigration {
+    func prepare(on database: Database) async throws {
+        try await database.schema("secure_boot_key_sets")
+            .id()
+            .field(
+                "organization_id", .uuid, .required,
+                .references("organizations", "id", onDelete: .cascade)
+            )
+            .field(
+                "project_id", .uuid,
+                .references("projects", "id", onDelete: .cascade)
+            )
+            .field("name", .string, .required)
+            .field("description", .string, .required, .custom("DEFAULT ''"))
+            .field("owner_guid", .string, .required)
+            .field("platform_key", .string, .required)
+            .field("key_exchange_keys", .array(of: .string), .required)
+            .field("signature_database", .array(of: .string), .required)
+            .field("forbidden_signatures", .array(of: .string), .required)
+            .field("include_microsoft_keys", .bool, .required, .custom("DEFAULT FALSE"))
+            .field("created_at", .datetime)
+            .field("updated_at", .datetime)
+            .unique(on: "organization_id", "name")
+            .create()
+
+        try await database.schema("vms")
+            .field(
+                "secure_boot_key_set_id", .uuid,
+                .references("secure_boot_key_sets", "id", onDelete: .setNull))
+            .update()
+        try await database.schema("vms")
+            .field("secure_boot_keys", .json)
+            .update()
+    }
+
+    func revert(on database: Database) async throws {
+        try await database.schema("vms")
+            .deleteField("secure_boot_keys")
+            .update()
+        try await database.schema("vms")
+            .deleteField("secure_boot_key_set_id")
+            .update()
+        try await database.schema("secure_boot_key_sets").delete()
+    }
+}
@@ -0,0 +1,27 @@
+import Fluent
+
+/// SSH public keys users register for the console gateway. The fingerprint
+/// is unique across users: the key alone names the account at login.
+struct CreateUserSSHKeys: AsyncMigration {
+    func prepare(on database: Database) async throws {
+        try await database.schema("user_ssh_keys")
+            .id()
+            .field(
+                "user_id", .uuid, .required,
+                .references("users", "id", onDelete: .cascade)
+            )
+            .field("name", .string, .required)
+            .field("public_key", .string, .required)
+            .field("fingerprint", .string, .required)
+            .field("last_used_at", .datetime)
+            .field("last_used_ip", .string)
+            .field("created_at", .datetime)
+            .field("updated_at", .datetime)
+            .unique(on: "fingerprint")
+            .create()
+    }
+
+    func revert(on database: Database) async throws {
+        try await database.schema("user_ssh_keys").delete()
+    }
+}
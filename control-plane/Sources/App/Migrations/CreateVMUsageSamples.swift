@@ -0,0 +1,37 @@
+import Fluent
+import Foundation
+import SQLKit
+
+/// Creates `vm_usage_samples`, the hourly CPU and memory rollups rightsizing
+/// reads. No backfill: history starts with the first report after upgrade.
+struct CreateVMUsageSamples: AsyncMigration {
+    func prepare(on database: Database) async throws {
+        try await database.schema("vm_usage_samples")
+            .id()
+            .field("vm_id", .uuid, .required, .references("vms", "id", onDelete: .cascade))
+            .field("hour", .datetime, .required)
+            .field("cpu_samples", .int, .required)
+            .field("cpu_utilization_sum", .double, .required)
+            .field("cpu_utilization_peak", .double, .required)
+            .field("memory_samples", .int, .required)
+            .field("memory_used_sum", .int64, .required)
+            .field("memory_used_peak", .int64, .required)
+            .create()
+
+        if let sql = database as? SQLDatabase {
+            // One row per (VM, hour): the recorder finds-or-creates the
+            // current hour's row, and the index serves both that lookup and
+            // the lookback range scan.
+            try await sql.raw(
+                "CREATE UNIQUE INDEX IF NOT EXISTS idx_vm_usage_samples_vm_hour ON vm_usage_samples (vm_id, hour)"
+            ).run()
+        }
+    }
+
+    func revert(on database: Database) async throws {
+        if let sql = database as? SQLDatabase {
+            try await sql.raw("DROP INDEX IF EXISTS idx_vm_usage_samples_vm_hour").run()
+        }
+        try await database.schema("vm_usage_samples").delete()
+    }
+}
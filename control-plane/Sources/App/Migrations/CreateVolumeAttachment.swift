@@ -0,0 +1,125 @@
+import Fluent
+import Foundation
+
+/// Snapshot of the `volumes` columns the backfill reads, frozen here for the
+/// same reason as `BackfillVolume`: the live model will keep growing.
+private final class AttachmentBackfillVolume: Model, @unchecked Sendable {
+    static let schema = "volumes"
+
+    @ID(key: .id)
+    var id: UUID?
+
+    @Field(key: "status")
+    var status: String
+
+    @OptionalField(key: "vm_id")
+    var vmId: UUID?
+
+    @OptionalField(key: "attached_agent_id")
+    var attachedAgentId: String?
+
+    @OptionalField(key: "device_name")
+    var deviceName: String?
+
+    @OptionalField(key: "boot_order")
+    var bootOrder: Int?
+
+    init() {}
+}
+
+/// Snapshot of the `volume_attachments` columns as created here.
+private final class AttachmentBackfillRow: Model, @unchecked Sendable {
+    static let schema = "volume_attachments"
+
+    @ID(key: .id)
+    var id: UUID?
+
+    @Field(key: "volume_id")
+    var volumeId: UUID
+
+    @Field(key: "vm_id")
+    var vmId: UUID
+
+    @OptionalField(key: "agent_id")
+    var agentId: String?
+
+    @Field(key: "device_name")
+    var deviceName: String
+
+    @OptionalField(key: "boot_order")
+    var bootOrder: Int?
+
+    @Field(key: "readonly")
+    var readonly: Bool
+
+    @Field(key: "status")
+    var status: String
+
+    @Timestamp(key: "created_at", on: .create)
+    var createdAt: Date?
+
+    @Timestamp(key: "updated_at", on: .update)
+    var updatedAt: Date?
+
+    init() {}
+}
+
+/// Per-VM volume attachments (multi-attach volumes). Rows cascade with both
+/// the volume and the VM. One row per (volume, VM): a VM holds a volume
+/// once. Device names are not constrained per VM here — pre-existing rows
+/// may already collide, since attach never checked — the attach path
+/// refuses new collisions instead.
+///
+/// Every volume attached before this migration gets its row, derived from
+/// the single-attachment columns on `volumes`, so the table is complete from
+/// the start. Guarded per volume so a re-run is a no-op.
+struct CreateVolumeAttachment: AsyncMigration {
+    func prepare(on database: Database) async throws {
+        try await database.schema(VolumeAttachment.schema)
+            .id()
+            .field("volume_id", .uuid, .required, .references(Volume.schema, "id", onDelete: .cascade))
+            .field("vm_id", .uuid, .required, .references("vms", "id", onDelete: .cascade))
+            .field("agent_id", .string)
+            .field("device_name", .string, .required)
+            .field("boot_order", .int)
+            .field("readonly", .bool, .required)
+            .field("status", .string, .required)
+            .field("created_at", .datetime)
+            .field("updated_at", .datetime)
+            .unique(on: "volume_id", "vm_id")
+            .create()
+
+        let attached = try await AttachmentBackfillVolume.query(on: database)
+            .filter(\.$vmId != nil)
+            .all()
+        for volume in attached {
+            guard let volumeId = volume.id, let vmId = volume.vmId else { continue }
+            let existing = try await AttachmentBackfillRow.query(on: database)
+                .filter(\.$volumeId == volumeId)
+                .count()
+            guard existing == 0 else { continue }
+
+            // A volume caught mid-hot-plug keeps that state on its row, so the
+            // stuck-operation sweep still sees it.
+            let status: VolumeAttachmentStatus
+            switch volume.status {
+            case VolumeStatus.attaching.rawValue: status = .attaching
+            case VolumeStatus.detaching.rawValue: status = .detaching
+            default: status = .attached
+            }
+            let row = AttachmentBackfillRow()
+            row.volumeId = volumeId
+            row.vmId = vmId
+            row.agentId = volume.attachedAgentId
+            row.deviceName = volume.deviceName ?? "disk0"
+            row.bootOrder = volume.bootOrder
+            row.readonly = false
+            row.status = status.rawValue
+            try await row.create(on: database)
+        }
+    }
+
+    func revert(on database: Database) async throws {
+        try await database.schema(VolumeAttachment.schema).delete()
+    }
+}
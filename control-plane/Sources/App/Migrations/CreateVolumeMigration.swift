@@ -0,0 +1,39 @@
+import Fluent
+import SQLKit
+
+/// `volume_migrations`: one row per move of a volume's data to another agent
+/// or pool, running or finished. Rows cascade with the volume. Pool, type,
+/// and agent references are plain columns — the history outlives them.
+struct CreateVolumeMigration: AsyncMigration {
+    func prepare(on database: Database) async throws {
+        try await database.schema(VolumeMigration.schema)
+            .id()
+            .field("volume_id", .uuid, .required, .references(Volume.schema, "id", onDelete: .cascade))
+            .field("mode", .string, .required)
+            .field("status", .string, .required)
+            .field("source_agent_id", .string, .required)
+            .field("target_agent_id", .string, .required)
+            .field("source_pool_id", .uuid)
+            .field("target_pool_id", .uuid)
+            .field("target_volume_type_id", .uuid)
+            .field("size_bytes", .int64)
+            .field("sha256", .string)
+            .field("error_message", .string)
+            .field("created_by_id", .uuid, .required, .references("users", "id", onDelete: .cascade))
+            .field("created_at", .datetime)
+            .field("updated_at", .datetime)
+            .field("completed_at", .datetime)
+            .create()
+
+        // Per-volume history listing and the one-running-migration guard.
+        if let sql = database as? SQLDatabase {
+            try await sql.raw(
+                "CREATE INDEX IF NOT EXISTS idx_volume_migrations_volume_id ON volume_migrations (volume_id)"
+            ).run()
+        }
+    }
+
+    func revert(on database: Database) async throws {
+        try await database.schema(VolumeMigration.schema).delete()
+    }
+}
@@ -0,0 +1,44 @@
+import Fluent
+
+/// Volume types: admin-defined classes of storage backed by a pool, plus the
+/// per-project allowance of each. Quota rows are owned by both their type and
+/// their project (cascade delete); a type itself cannot be deleted while
+/// volumes reference it (`AddVolumeTypeToVolume`'s FK), which the controller
+/// also reports as 409.
+struct CreateVolumeType: AsyncMigration {
+    func prepare(on database: Database) async throws {
+        try await database.schema(VolumeTypeDefinition.schema)
+            .id()
+            .field("name", .string, .required)
+            .field("description", .string, .required)
+            .field("pool_id", .uuid, .required, .references(StoragePool.schema, "id"))
+            .field("default_format", .string, .required)
+            .field("replication_factor", .int, .required)
+            .field("max_iops", .int)
+            .field("max_bytes_per_second", .int64)
+            .field("requires_encryption", .bool, .required)
+            .field("created_at", .datetime)
+            .field("updated_at", .datetime)
+            .unique(on: "name")
+            .create()
+
+        try await database.schema(VolumeTypeQuota.schema)
+            .id()
+            .field(
+                "volume_type_id", .uuid, .required,
+                .references(VolumeTypeDefinition.schema, "id", onDelete: .cascade))
+            .field("project_id", .uuid, .required, .references("projects", "id", onDelete: .cascade))
+            .field("max_volumes", .int)
+            .field("max_storage_bytes", .int64)
+            .field("created_at", .datetime)
+            .field("updated_at", .datetime)
+            // One allowance per (type, project); PUT replaces it in place.
+            .unique(on: "volume_type_id", "project_id")
+            .create()
+    }
+
+    func revert(on database: Database) async throws {
+        try await database.schema(VolumeTypeQuota.schema).delete()
+        try await database.schema(VolumeTypeDefinition.schema).delete()
+    }
+}
@@ -0,0 +1,33 @@
+import Fluent
+import StratoShared
+
+/// CHECK-constraint hardening for the bucket status columns, through the same
+/// per-constraint entry point as `EnforceFileShareEnums`.
+struct EnforceBucketEnums: AsyncMigration {
+    static let constraints = [
+        PersistedEnumConstraint(
+            table: "buckets",
+            column: "status",
+            allowedValues: BucketStatus.allCases.map(\.rawValue),
+            defaultValue: BucketStatus.creating.rawValue
+        ),
+        PersistedEnumConstraint(
+            table: "buckets",
+            column: "desired_status",
+            allowedValues: DesiredBucketStatus.allCases.map(\.rawValue),
+            defaultValue: DesiredBucketStatus.present.rawValue
+        ),
+    ]
+
+    func prepare(on database: Database) async throws {
+        for constraint in Self.constraints {
+            try await EnforcePersistedEnumValues.prepare(constraint, on: database)
+        }
+    }
+
+    func revert(on database: Database) async throws {
+        for constraint in Self.constraints.reversed() {
+            try await EnforcePersistedEnumValues.revert(constraint, on: database)
+        }
+    }
+}
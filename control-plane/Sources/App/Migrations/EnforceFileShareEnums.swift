@@ -0,0 +1,54 @@
+import Fluent
+import StratoShared
+
+/// CHECK-constraint hardening for the file-share status columns, through the
+/// same per-constraint entry point as `EnforceVolumeMigrationEnums`, plus
+/// `file_share` in `resource_operations.resource_kind`.
+///
+/// The resource-kind constraint is re-installed from its canonical definition
+/// (which already lists `file_share`), the documented follow-up for adding an
+/// enum case — see `AddSnapshotExportOperationKind`. Install is idempotent, so
+/// fresh databases are unaffected; revert re-installs rather than narrows,
+/// since share operation rows may exist.
+struct EnforceFileShareEnums: AsyncMigration {
+    static let constraints = [
+        PersistedEnumConstraint(
+            table: "file_shares",
+            column: "status",
+            allowedValues: FileShareStatus.allCases.map(\.rawValue),
+            defaultValue: FileShareStatus.creating.rawValue
+        ),
+        PersistedEnumConstraint(
+            table: "file_shares",
+            column: "desired_status",
+            allowedValues: DesiredFileShareStatus.allCases.map(\.rawValue),
+            defaultValue: DesiredFileShareStatus.present.rawValue
+        ),
+        PersistedEnumConstraint(
+            table: "file_share_snapshots",
+            column: "status",
+            allowedValues: FileShareSnapshotStatus.allCases.map(\.rawValue),
+            defaultValue: FileShareSnapshotStatus.creating.rawValue
+        ),
+    ]
+
+    private static var resourceKindConstraint: PersistedEnumConstraint {
+        EnforcePersistedEnumValues.constraints.first {
+            $0.table == "resource_operations" && $0.column == "resource_kind"
+        }!
+    }
+
+    func prepare(on database: Database) async throws {
+        for constraint in Self.constraints {
+            try await EnforcePersistedEnumValues.prepare(constraint, on: database)
+        }
+        try await EnforcePersistedEnumValues.prepare(Self.resourceKindConstraint, on: database)
+    }
+
+    func revert(on database: Database) async throws {
+        try await EnforcePersistedEnumValues.prepare(Self.resourceKindConstraint, on: database)
+        for constraint in Self.constraints.reversed() {
+            try await EnforcePersistedEnumValues.revert(constraint, on: database)
+        }
+    }
+}
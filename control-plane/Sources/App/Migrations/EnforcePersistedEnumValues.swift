@@ -96,7 +96,7 @@ struct EnforcePersistedEnumValues: AsyncMigration {
         ),
         .init(
             table: "resource_operations", column: "resource_kind",
-            allowedValues: ["virtual_machine", "sandbox"], defaultValue: "virtual_machine"
+            allowedValues: ["virtual_machine", "sandbox", "file_share"], defaultValue: "virtual_machine"
         ),
         .init(
             table: "resource_operations", column: "kind",
@@ -152,7 +152,7 @@ struct EnforcePersistedEnumValues: AsyncMigration {
             table: "volumes", column: "status",
             allowedValues: [
                 "creating", "available", "attaching", "attached", "detaching", "resizing", "snapshotting",
-                "cloning", "deleting", "error",
+                "cloning", "deleting", "error", "migrating",
             ],
             defaultValue: "creating"
         ),
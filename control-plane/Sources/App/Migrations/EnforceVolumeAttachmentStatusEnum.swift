@@ -0,0 +1,20 @@
+import Fluent
+
+/// CHECK-constraint hardening for `volume_attachments.status`, through the
+/// same reusable per-constraint entry point as `EnforceVolumeTypeFormatEnum`.
+struct EnforceVolumeAttachmentStatusEnum: AsyncMigration {
+    static let constraint = PersistedEnumConstraint(
+        table: "volume_attachments",
+        column: "status",
+        allowedValues: VolumeAttachmentStatus.allCases.map(\.rawValue),
+        defaultValue: VolumeAttachmentStatus.attached.rawValue
+    )
+
+    func prepare(on database: Database) async throws {
+        try await EnforcePersistedEnumValues.prepare(Self.constraint, on: database)
+    }
+
+    func revert(on database: Database) async throws {
+        try await EnforcePersistedEnumValues.revert(Self.constraint, on: database)
+    }
+}
@@ -0,0 +1,32 @@
+import Fluent
+
+/// CHECK-constraint hardening for `volume_migrations.mode` and `.status`,
+/// through the same per-constraint entry point as
+/// `EnforceVolumeAttachmentStatusEnum`.
+struct EnforceVolumeMigrationEnums: AsyncMigration {
+    static let constraints = [
+        PersistedEnumConstraint(
+            table: "volume_migrations",
+            column: "mode",
+            allowedValues: VolumeMigrationMode.allCases.map(\.rawValue)
+        ),
+        PersistedEnumConstraint(
+            table: "volume_migrations",
+            column: "status",
+            allowedValues: VolumeMigrationStatus.allCases.map(\.rawValue),
+            defaultValue: VolumeMigrationStatus.running.rawValue
+        ),
+    ]
+
+    func prepare(on database: Database) async throws {
+        for constraint in Self.constraints {
+            try await EnforcePersistedEnumValues.prepare(constraint, on: database)
+        }
+    }
+
+    func revert(on database: Database) async throws {
+        for constraint in Self.constraints.reversed() {
+            try await EnforcePersistedEnumValues.revert(constraint, on: database)
+        }
+    }
+}
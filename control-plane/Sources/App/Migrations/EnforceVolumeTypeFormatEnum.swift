@@ -0,0 +1,24 @@
+import Fluent
+
+/// CHECK-constraint hardening for `volume_types.default_format`.
+///
+/// The table postdates `EnforcePersistedEnumValues`, so — like
+/// `EnforceSiteStatusEnum` — the new string-backed `@Enum` column gets the
+/// same normalize → validate → CHECK guard through the reusable
+/// per-constraint entry point.
+struct EnforceVolumeTypeFormatEnum: AsyncMigration {
+    static let constraint = PersistedEnumConstraint(
+        table: "volume_types",
+        column: "default_format",
+        allowedValues: VolumeFormat.allCases.map(\.rawValue),
+        defaultValue: VolumeFormat.qcow2.rawValue
+    )
+
+    func prepare(on database: Database) async throws {
+        try await EnforcePersistedEnumValues.prepare(Self.constraint, on: database)
+    }
+
+    func revert(on database: Database) async throws {
+        try await EnforcePersistedEnumValues.revert(Self.constraint, on: database)
+    }
+}
@@ -0,0 +1,61 @@
+import Fluent
+import Vapor
+
+/// One credential's requests in one deprecated API version, kept by
+/// `APIVersionUsageTracker`.
+final class APIVersionUsage: Model, @unchecked Sendable {
+    static let schema = "api_version_usage"
+
+    @ID(key: .id)
+    var id: UUID?
+
+    @Field(key: "api_version")
+    var apiVersion: Int
+
+    /// `api_key` or `user` (`APIVersionUsageTracker.Client.Kind`).
+    @Field(key: "client_type")
+    var clientType: String
+
+    @Field(key: "client_id")
+    var clientID: UUID
+
+    /// The API key's name or the username, as of the latest write.
+    @Field(key: "client_name")
+    var clientName: String
+
+    @OptionalField(key: "user_agent")
+    var userAgent: String?
+
+    @Field(key: "request_count")
+    var requestCount: Int
+
+    @Field(key: "first_seen_at")
+    var firstSeenAt: Date
+
+    @Field(key: "last_seen_at")
+    var lastSeenAt: Date
+
+    init() {}
+}
+
+struct APIVersionUsageResponse: Content {
+    let version: Int
+    let clientType: String
+    let clientId: UUID
+    let clientName: String
+    let userAgent: String?
+    let requestCount: Int
+    let firstSeenAt: Date
+    let lastSeenAt: Date
+
+    init(from usage: APIVersionUsage) {
+        self.version = usage.apiVersion
+        self.clientType = usage.clientType
+        self.clientId = usage.clientID
+        self.clientName = usage.clientName
+        self.userAgent = usage.userAgent
+        self.requestCount = usage.requestCount
+        self.firstSeenAt = usage.firstSeenAt
+        self.lastSeenAt = usage.lastSeenAt
+    }
+}
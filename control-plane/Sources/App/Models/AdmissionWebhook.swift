@@ -0,0 +1,242 @@
+import Fluent
+import Foundation
+import StratoShared
+import Vapor
+
+/// An organization's external admission webhook: code the platform team runs
+/// to validate and mutate *what* is created or changed, after Cedar has
+/// decided who may act. `AdmissionService` POSTs a signed `AdmissionReview`
+/// to each matching webhook in `position` order before a create handler
+/// proceeds or an operation begins; a webhook allows, denies, or (for
+/// creates) patches the proposed resource.
+final class AdmissionWebhook: Model, @unchecked Sendable {
+    static let schema = "admission_webhooks"
+
+    @ID(key: .id)
+    var id: UUID?
+
+    @Parent(key: "organization_id")
+    var organization: Organization
+
+    @Field(key: "name")
+    var name: String
+
+    /// Target endpoint. Validated against `SSRFGuard` when set and again
+    /// before every review.
+    @Field(key: "url")
+    var url: String
+
+    /// Ascending call order; ties break by name. Each webhook sees the
+    /// resource as patched by the ones before it.
+    @Field(key: "position")
+    var position: Int
+
+    /// `AdmissionResourceKind` raw values reviewed; empty means every kind.
+    @Field(key: "resource_kinds")
+    var resourceKinds: [String]
+
+    /// Operations reviewed: `create` or a `VMOperationKind` raw value. Empty
+    /// means every operation.
+    @Field(key: "operations")
+    var operations: [String]
+
+    /// An `AdmissionFailurePolicy` raw value.
+    @Field(key: "failure_policy")
+    var failurePolicy: String
+
+    @Field(key: "timeout_seconds")
+    var timeoutSeconds: Int
+
+    /// HMAC key for `X-Strato-Signature`, encrypted at rest like a webhook
+    /// subscription's; the plaintext is returned only from create and
+    /// rotate-secret.
+    @Field(key: "signing_secret")
+    var signingSecret: String
+
+    @Field(key: "is_active")
+    var isActive: Bool
+
+    @Parent(key: "created_by_id")
+    var createdBy: User
+
+    @Timestamp(key: "created_at", on: .create)
+    var createdAt: Date?
+
+    @Timestamp(key: "updated_at", on: .update)
+    var updatedAt: Date?
+
+    init() {}
+
+    init(
+        id: UUID? = nil,
+        organizationID: UUID,
+        name: String,
+        url: String,
+        position: Int,
+        resourceKinds: [String] = [],
+        operations: [String] = [],
+        failurePolicy: AdmissionFailurePolicy = .fail,
+        timeoutSeconds: Int = AdmissionWebhook.defaultTimeoutSeconds,
+        signingSecret: String,
+        isActive: Bool = true,
+        createdByID: UUID
+    ) {
+        self.id = id
+        self.$organization.id = organizationID
+        self.name = name
+        self.url = url
+        self.position = position
+        self.resourceKinds = resourceKinds
+        self.operations = operations
+        self.failurePolicy = failurePolicy.rawValue
+        self.timeoutSeconds = timeoutSeconds
+        self.signingSecret = signingSecret
+        self.isActive = isActive
+        self.$createdBy.id = createdByID
+    }
+}
+
+/// What an admission webhook can review: every `OperationResourceKind`, and
+/// the resources that are only ever reviewed as creates because they have no
+/// asynchronous operations.
+enum AdmissionResourceKind: String, Codable, CaseIterable, Sendable {
+    case virtualMachine = "virtual_machine"
+    case sandbox = "sandbox"
+    case fileShare = "file_share"
+    case volume = "volume"
+    case network = "network"
+    case bucket = "bucket"
+
+    init(_ kind: OperationResourceKind) {
+        switch kind {
+        case .virtualMachine: self = .virtualMachine
+        case .sandbox: self = .sandbox
+        case .fileShare: self = .fileShare
+        }
+    }
+}
+
+/// What happens when a webhook can't give an answer (unreachable, timed out,
+/// a non-2xx status, or a body that isn't a review response).
+enum AdmissionFailurePolicy: String, Codable, CaseIterable, Sendable {
+    /// Refuse the request: nothing is admitted that the webhook didn't see.
+    case fail
+    /// Carry on as if the webhook allowed it unchanged.
+    case ignore
+}
+
+extension AdmissionWebhook {
+    static let defaultTimeoutSeconds = 5
+    static let maxTimeoutSeconds = 10
+
+    /// The operation name creates are reviewed under; every other review
+    /// names its `VMOperationKind`.
+    static let createOperation = VMOperationKind.create.rawValue
+
+    var failurePolicyValue: AdmissionFailurePolicy {
+        AdmissionFailurePolicy(rawValue: failurePolicy) ?? .fail
+    }
+
+    /// Whether this webhook reviews `operation` on `resourceKind`.
+    func matches(resourceKind: AdmissionResourceKind, operation: String) -> Bool {
+        (resourceKinds.isEmpty || resourceKinds.contains(resourceKind.rawValue))
+            && (operations.isEmpty || operations.contains(operation))
+    }
+}
+
+// MARK: - DTOs
+
+struct CreateAdmissionWebhookRequest: Content {
+    let name: String
+    let url: String
+    let position: Int?
+    let resourceKinds: [String]?
+    let operations: [String]?
+    let failurePolicy: AdmissionFailurePolicy?
+    let timeoutSeconds: Int?
+}
+
+struct UpdateAdmissionWebhookRequest: Content {
+    let name: String?
+    let url: String?
+    let position: Int?
+    let resourceKinds: [String]?
+    let operations: [String]?
+    let failurePolicy: AdmissionFailurePolicy?
+    let timeoutSeconds: Int?
+    let isActive: Bool?
+}
+
+struct AdmissionWebhookResponse: Content {
+    let id: UUID?
+    let organizationId: UUID
+    let name: String
+    let url: String
+    let position: Int
+    let resourceKinds: [String]
+    let operations: [String]
+    let failurePolicy: AdmissionFailurePolicy
+    let timeoutSeconds: Int
+    let isActive: Bool
+    let createdAt: Date?
+    let updatedAt: Date?
+
+    init(from webhook: AdmissionWebhook) {
+        self.id = webhook.id
+        self.organizationId = webhook.$organization.id
+        self.name = webhook.name
+        self.url = webhook.url
+        self.position = webhook.position
+        self.resourceKinds = webhook.resourceKinds
+        self.operations = webhook.operations
+        self.failurePolicy = webhook.failurePolicyValue
+        self.timeoutSeconds = webhook.timeoutSeconds
+        self.isActive = webhook.isActive
+        self.createdAt = webhook.createdAt
+        self.updatedAt = webhook.updatedAt
+    }
+}
+
+/// Create and rotate-secret responses: the only places the plaintext signing
+/// secret appears.
+struct AdmissionWebhookWithSecretResponse: Content {
+    let webhook: AdmissionWebhookResponse
+    let signingSecret: String
+}
+
+// MARK: - Wire format
+
+/// The body POSTed to an admission webhook. `object` is the proposed
+/// resource — a create's request body, as patched by earlier webhooks — and
+/// is absent for operations on an existing resource, which are reviewed by
+/// name and kind alone.
+struct AdmissionReview: Content {
+    struct Resource: Content {
+        let kind: String
+        let id: UUID?
+        let name: String?
+    }
+
+    struct Principal: Content {
+        let id: UUID
+        let username: String?
+    }
+
+    var apiVersion = "strato.admission/v1"
+    let uid: UUID
+    let organizationId: UUID
+    let projectId: UUID?
+    let operation: String
+    let resource: Resource
+    let user: Principal
+    let object: CodableValue?
+}
+
+/// A webhook's verdict. `uid` must echo the review's. `patch` is a JSON
+/// merge patch (RFC 7386) over `object`, honored on creates only.
+struct AdmissionReviewResponse: Content {
+    let uid: UUID
+    let allowed: Bool
+    let reason: String?
+    let patch: CodableValue?
+}
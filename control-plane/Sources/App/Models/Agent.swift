@@ -158,6 +158,20 @@ final class Agent: Model, Content, @unchecked Sendable {
     @OptionalField(key: "update_failure_reason")
     var updateFailureReason: String?
 
+    /// The operator's memory overcommit policy for this host (wire v26):
+    /// the ratio the scheduler admits memory against, and the KSM,
+    /// free-page-reporting and pressure-reclaim settings the agent applies
+    /// to make that safe. Nil is no overcommit.
+    @OptionalField(key: "memory_overcommit")
+    var memoryOvercommit: MemoryOvercommitPolicy?
+
+    /// Memory committed to workloads on the host as the agent last reported
+    /// it, unclamped (`AgentResources.committedMemory`). Nil for agents that
+    /// predate the field; `availableMemory` is exact for those, since they
+    /// never commit beyond the host.
+    @OptionalField(key: "committed_memory")
+    var committedMemory: Int64?
+
     init() {}
 
     init(
@@ -189,6 +203,7 @@ final class Agent: Model, Content, @unchecked Sendable {
         self.availableCPU = resources.availableCPU
         self.availableMemory = resources.availableMemory
         self.availableDisk = resources.availableDisk
+        self.committedMemory = resources.committedMemory
         self.architecture = architecture?.rawValue
         self.hypervisors = hypervisors
         self.networkCapability = networkCapability?.rawValue
@@ -213,10 +228,12 @@ final class Agent: Model, Content, @unchecked Sendable {
             availableCPU != resources.availableCPU
                 || availableMemory != resources.availableMemory
                 || availableDisk != resources.availableDisk
+                || committedMemory != resources.committedMemory
         else { return false }
         availableCPU = resources.availableCPU
         availableMemory = resources.availableMemory
         availableDisk = resources.availableDisk
+        committedMemory = resources.committedMemory
         return true
     }
 
@@ -227,9 +244,20 @@ final class Agent: Model, Content, @unchecked Sendable {
             totalMemory: totalMemory,
             availableMemory: availableMemory,
             totalDisk: totalDisk,
-            availableDisk: availableDisk
+            availableDisk: availableDisk,
+            committedMemory: committedMemory
         )
     }
+
+    /// The overcommit ratio the scheduler admits memory against: the policy's
+    /// when the agent can reclaim on its own (v26+), otherwise 1 — an older
+    /// agent would leave the host to the kernel's OOM killer.
+    var effectiveMemoryOvercommitRatio: Double {
+        guard WireProtocol.supportsMemoryOvercommit(wireProtocolVersion ?? 0),
+            let ratio = memoryOvercommit?.ratio
+        else { return 1 }
+        return max(ratio, 1)
+    }
 }
 
 enum AgentStatus: String, Codable, CaseIterable, Sendable {
@@ -425,6 +453,8 @@ struct AgentResponse: Content {
     let updateBlockedReason: String?
     /// Terminal failure that halted the rollout at this agent, if any.
     let updateFailureReason: String?
+    /// The operator's memory overcommit policy; nil is no overcommit.
+    let memoryOvercommit: MemoryOvercommitPolicy?
 
     init(from agent: Agent) throws {
         guard let id = agent.id else {
@@ -461,5 +491,6 @@ struct AgentResponse: Content {
         self.updateAttemptedAt = agent.updateAttemptedAt
         self.updateBlockedReason = agent.updateBlockedReason
         self.updateFailureReason = agent.updateFailureReason
+        self.memoryOvercommit = agent.memoryOvercommit
     }
 }
@@ -59,12 +59,23 @@ final class AuditEvent: Model, @unchecked Sendable {
     @OptionalField(key: "metadata")
     var metadataJSON: String?
 
+    /// `AuditActorType.rawValue`: who acted — a user, a service account, an
+    /// anonymous caller or the system.
+    @Field(key: "actor_type")
+    var actorType: String
+
+    /// The user or service account that acted; nil for anonymous and system
+    /// actors.
+    @OptionalField(key: "actor_id")
+    var actorID: UUID?
+
     @Timestamp(key: "created_at", on: .create)
     var createdAt: Date?
 
     init() {}
 
     init(from record: AuditRecord) {
+        let record = record.resolvingActor()
         self.eventType = record.eventType
         self.userID = record.userID
         self.username = record.username
@@ -78,6 +89,8 @@ final class AuditEvent: Model, @unchecked Sendable {
         self.action = record.action
         self.sourceIP = record.sourceIP
         self.adminBypass = record.adminBypass
+        self.actorType = record.actorType ?? AuditActorType.system.rawValue
+        self.actorID = record.actorID
         if let metadata = record.metadata,
             let data = try? JSONEncoder().encode(metadata)
         {
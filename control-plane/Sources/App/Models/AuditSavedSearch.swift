@@ -0,0 +1,92 @@
+import Fluent
+import Vapor
+
+/// A named audit query an organization keeps for reuse — "service-account
+/// IAM changes today", "failed calls by actor". The query is stored as
+/// written and parsed again each time it runs, so relative times stay
+/// relative.
+final class AuditSavedSearch: Model, @unchecked Sendable {
+    static let schema = "audit_saved_searches"
+
+    static let maxNameLength = 100
+
+    @ID(key: .id)
+    var id: UUID?
+
+    @Parent(key: "organization_id")
+    var organization: Organization
+
+    /// Unique within the organization.
+    @Field(key: "name")
+    var name: String
+
+    @Field(key: "description")
+    var searchDescription: String
+
+    /// `AuditQuery` source.
+    @Field(key: "query")
+    var query: String
+
+    @OptionalParent(key: "created_by_id")
+    var createdBy: User?
+
+    @Timestamp(key: "created_at", on: .create)
+    var createdAt: Date?
+
+    @Timestamp(key: "updated_at", on: .update)
+    var updatedAt: Date?
+
+    init() {}
+
+    init(
+        id: UUID? = nil,
+        organizationID: UUID,
+        name: String,
+        description: String = "",
+        query: String,
+        createdByID: UUID? = nil
+    ) {
+        self.id = id
+        self.$organization.id = organizationID
+        self.name = name
+        self.searchDescription = description
+        self.query = query
+        self.$createdBy.id = createdByID
+    }
+}
+
+// MARK: - DTOs
+
+struct CreateAuditSavedSearchRequest: Content {
+    let name: String
+    let description: String?
+    let query: String
+}
+
+struct UpdateAuditSavedSearchRequest: Content {
+    let name: String?
+    let description: String?
+    let query: String?
+}
+
+struct AuditSavedSearchResponse: Content {
+    let id: UUID
+    let organizationId: UUID
+    let name: String
+    let description: String
+    let query: String
+    let createdById: UUID?
+    let createdAt: Date?
+    let updatedAt: Date?
+
+    init(from search: AuditSavedSearch) throws {
+        self.id = try search.requireID()
+        self.organizationId = search.$organization.id
+        self.name = search.name
+        self.description = search.searchDescription
+        self.query = search.query
+        self.createdById = search.$createdBy.id
+        self.createdAt = search.createdAt
+        self.updatedAt = search.updatedAt
+    }
+}
@@ -0,0 +1,338 @@
+import Fluent
+import Foundation
+import StratoShared
+import Vapor
+
+/// A project's event-driven automation: when a platform event of
+/// `triggerEventType` whose envelope satisfies `filter` happens in the
+/// project, run `actions` in order as `serviceAccount` — provided the
+/// `conditions` still hold against the resource when the run executes.
+///
+/// Matching happens in `WebhookEvents.enqueue`, in the transaction of the
+/// change that produced the event, so a run exists exactly when its event
+/// committed; `AutomationService` executes the runs. Every action is an
+/// ordinary Cedar check against the service account's bindings — a rule can
+/// do nothing its account could not do through the API.
+final class AutomationRule: Model, @unchecked Sendable {
+    static let schema = "automation_rules"
+
+    @ID(key: .id)
+    var id: UUID?
+
+    @Parent(key: "project_id")
+    var project: Project
+
+    @Field(key: "name")
+    var name: String
+
+    @Field(key: "description")
+    var ruleDescription: String
+
+    /// A `WebhookEventType` raw value.
+    @Field(key: "trigger_event_type")
+    var triggerEventType: String
+
+    /// An `AutomationExpression` over `event`; empty matches every event of
+    /// the trigger type.
+    @Field(key: "filter")
+    var filter: String
+
+    /// `AutomationExpression`s over `event` and `resource`, all of which must
+    /// hold when the run executes.
+    @Field(key: "conditions")
+    var conditions: [String]
+
+    @Field(key: "actions")
+    var actions: [AutomationAction]
+
+    /// The principal every action is authorized as. Rules go with their
+    /// account when it is deleted.
+    @Parent(key: "service_account_id")
+    var serviceAccount: ServiceAccount
+
+    /// Runs started per rolling hour before further matches are recorded as
+    /// `rate_limited` instead of run.
+    @Field(key: "max_runs_per_hour")
+    var maxRunsPerHour: Int
+
+    /// HMAC key `call_webhook` actions sign with, encrypted at rest like a
+    /// webhook subscription's; the plaintext is returned only from create and
+    /// rotate-secret.
+    @Field(key: "signing_secret")
+    var signingSecret: String
+
+    @Field(key: "is_active")
+    var isActive: Bool
+
+    @Parent(key: "created_by_id")
+    var createdBy: User
+
+    @Timestamp(key: "created_at", on: .create)
+    var createdAt: Date?
+
+    @Timestamp(key: "updated_at", on: .update)
+    var updatedAt: Date?
+
+    init() {}
+
+    init(
+        id: UUID? = nil,
+        projectID: UUID,
+        name: String,
+        description: String = "",
+        triggerEventType: WebhookEventType,
+        filter: String = "",
+        conditions: [String] = [],
+        actions: [AutomationAction],
+        serviceAccountID: UUID,
+        maxRunsPerHour: Int = AutomationRule.defaultMaxRunsPerHour,
+        signingSecret: String,
+        isActive: Bool = true,
+        createdByID: UUID
+    ) {
+        self.id = id
+        self.$project.id = projectID
+        self.name = name
+        self.ruleDescription = description
+        self.triggerEventType = triggerEventType.rawValue
+        self.filter = filter
+        self.conditions = conditions
+        self.actions = actions
+        self.$serviceAccount.id = serviceAccountID
+        self.maxRunsPerHour = maxRunsPerHour
+        self.signingSecret = signingSecret
+        self.isActive = isActive
+        self.$createdBy.id = createdByID
+    }
+}
+
+extension AutomationRule {
+    static let defaultMaxRunsPerHour = 10
+    static let maxRunsPerHourLimit = 1000
+    static let maxActions = 10
+    static let maxConditions = 10
+
+    /// Paths a trigger filter may read.
+    static let filterRoots: Set<String> = ["event"]
+    /// Paths a condition may read.
+    static let conditionRoots: Set<String> = ["event", "resource"]
+}
+
+/// One step of a rule. Which fields apply depends on `type`.
+struct AutomationAction: Content, Equatable, Sendable {
+    var type: AutomationActionType
+    /// `tag`: merged into the VM's tags; an empty value removes the key.
+    var tags: [String: String]?
+    /// `notify`: the text of the `automation.notification` event.
+    var message: String?
+    /// `call_webhook`: where the signed run payload is POSTed.
+    var url: String?
+}
+
+enum AutomationActionType: String, Codable, CaseIterable, Sendable {
+    /// Start the event's VM (`vm:start`).
+    case start
+    /// Stop the event's VM (`vm:stop`).
+    case stop
+    /// Snapshot every volume attached to the event's VM (`volume:snapshot`).
+    case snapshot
+    /// Merge `tags` into the event's VM (`vm:update`).
+    case tag
+    /// Emit an `automation.notification` event to the project's webhook
+    /// subscriptions and GraphQL subscribers.
+    case notify
+    /// POST the run to `url`, signed with the rule's secret.
+    case callWebhook = "call_webhook"
+}
+
+// MARK: - Runs
+
+/// One match of a rule: the event that triggered it and what each action
+/// did. Kept as history for `AutomationService.historyRetentionDays`.
+final class AutomationRun: Model, @unchecked Sendable {
+    static let schema = "automation_runs"
+
+    @ID(key: .id)
+    var id: UUID?
+
+    @Parent(key: "rule_id")
+    var rule: AutomationRule
+
+    @Field(key: "event_id")
+    var eventID: UUID
+
+    @Field(key: "event_type")
+    var eventType: String
+
+    /// The triggering event's envelope, frozen at match time exactly as a
+    /// webhook delivery would carry it.
+    @Field(key: "event_payload")
+    var eventPayload: String
+
+    /// An `AutomationRunStatus` raw value.
+    @Field(key: "status")
+    var status: String
+
+    @Field(key: "steps")
+    var steps: [AutomationStepResult]
+
+    @OptionalField(key: "error")
+    var error: String?
+
+    @OptionalField(key: "started_at")
+    var startedAt: Date?
+
+    @OptionalField(key: "completed_at")
+    var completedAt: Date?
+
+    @Timestamp(key: "created_at", on: .create)
+    var createdAt: Date?
+
+    init() {}
+
+    init(
+        id: UUID? = nil, ruleID: UUID, event: WebhookEvent, payload: String,
+        status: AutomationRunStatus = .pending
+    ) {
+        self.id = id
+        self.$rule.id = ruleID
+        self.eventID = event.id
+        self.eventType = event.type.rawValue
+        self.eventPayload = payload
+        self.status = status.rawValue
+        self.steps = []
+        if status == .rateLimited {
+            self.error = "Rule exceeded its limit of runs per hour"
+            self.completedAt = Date()
+        }
+    }
+
+    var statusValue: AutomationRunStatus {
+        AutomationRunStatus(rawValue: status) ?? .failed
+    }
+}
+
+enum AutomationRunStatus: String, Codable, CaseIterable, Sendable {
+    case pending
+    case running
+    case succeeded
+    /// An action failed; the ones after it did not run.
+    case failed
+    /// A condition did not hold, or the rule was disabled, when the run
+    /// executed. No action ran.
+    case skipped
+    /// The rule had already run `maxRunsPerHour` times in the past hour.
+    case rateLimited = "rate_limited"
+}
+
+struct AutomationStepResult: Content, Equatable, Sendable {
+    enum Status: String, Codable, Sendable {
+        case succeeded, failed
+        /// Nothing to do: the VM was already in the asked-for state, or had
+        /// no volumes to snapshot.
+        case skipped
+    }
+
+    let action: AutomationActionType
+    let status: Status
+    let detail: String?
+    /// The operation a `start` or `stop` began.
+    let operationId: UUID?
+
+    init(action: AutomationActionType, status: Status, detail: String? = nil, operationId: UUID? = nil) {
+        self.action = action
+        self.status = status
+        self.detail = detail
+        self.operationId = operationId
+    }
+}
+
+// MARK: - DTOs
+
+struct CreateAutomationRuleRequest: Content {
+    let name: String
+    let description: String?
+    let triggerEventType: String
+    let filter: String?
+    let conditions: [String]?
+    let actions: [AutomationAction]
+    let serviceAccountId: UUID
+    let maxRunsPerHour: Int?
+}
+
+struct UpdateAutomationRuleRequest: Content {
+    let name: String?
+    let description: String?
+    let triggerEventType: String?
+    let filter: String?
+    let conditions: [String]?
+    let actions: [AutomationAction]?
+    let serviceAccountId: UUID?
+    let maxRunsPerHour: Int?
+    let isActive: Bool?
+}
+
+struct AutomationRuleResponse: Content {
+    let id: UUID?
+    let projectId: UUID
+    let name: String
+    let description: String
+    let triggerEventType: String
+    let filter: String
+    let conditions: [String]
+    let actions: [AutomationAction]
+    let serviceAccountId: UUID
+    let maxRunsPerHour: Int
+    let isActive: Bool
+    let createdAt: Date?
+    let updatedAt: Date?
+
+    init(from rule: AutomationRule) {
+        self.id = rule.id
+        self.projectId = rule.$project.id
+        self.name = rule.name
+        self.description = rule.ruleDescription
+        self.triggerEventType = rule.triggerEventType
+        self.filter = rule.filter
+        self.conditions = rule.conditions
+        self.actions = rule.actions
+        self.serviceAccountId = rule.$serviceAccount.id
+        self.maxRunsPerHour = rule.maxRunsPerHour
+        self.isActive = rule.isActive
+        self.createdAt = rule.createdAt
+        self.updatedAt = rule.updatedAt
+    }
+}
+
+/// Create and rotate-secret responses: the only places the plaintext signing
+/// secret appears.
+struct AutomationRuleWithSecretResponse: Content {
+    let rule: AutomationRuleResponse
+    let signingSecret: String
+}
+
+struct AutomationRunResponse: Content {
+    let id: UUID?
+    let ruleId: UUID
+    let eventId: UUID
+    let eventType: String
+    let status: AutomationRunStatus
+    let steps: [AutomationStepResult]
+    let error: String?
+    let createdAt: Date?
+    let startedAt: Date?
+    let completedAt: Date?
+
+    init(from run: AutomationRun) {
+        self.id = run.id
+        self.ruleId = run.$rule.id
+        self.eventId = run.eventID
+        self.eventType = run.eventType
+        self.status = run.statusValue
+        self.steps = run.steps
+        self.error = run.error
+        self.createdAt = run.createdAt
+        self.startedAt = run.startedAt
+        self.completedAt = run.completedAt
+    }
+}
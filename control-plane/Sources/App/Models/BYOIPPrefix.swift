@@ -0,0 +1,187 @@
+import Fluent
+import Vapor
+
+/// How an organization proves it controls a prefix it brings.
+enum BYOIPVerificationMethod: String, Codable, Sendable {
+    /// An RPKI ROA authorizes the platform's origin ASN
+    /// (`BYOIP_ORIGIN_ASN`) to announce the prefix, as the configured
+    /// validator (`BYOIP_RPKI_VALIDATOR_URL`) reports it, and the prefix's
+    /// RDAP record carries the registration's challenge in a remark. Only
+    /// the holder can create either; the challenge says which organization
+    /// the holder meant, since the ROA's ASN is the same for all of them.
+    case roa
+    /// The prefix's RDAP record carries an X.509 certificate in its remarks,
+    /// and the organization signs the registration's challenge with that
+    /// certificate's key.
+    case signedChallenge = "signed_challenge"
+}
+
+/// Where a registration is in its proof of control. Stored as a string.
+enum BYOIPPrefixStatus: String, Codable, Sendable {
+    /// Registered, not yet proven.
+    case pending
+    /// Proven; the prefix is a floating-IP pool.
+    case verified
+    /// The last attempt failed (`statusMessage` says why). Verification may
+    /// be retried.
+    case failed
+}
+
+/// An IPv4 prefix an organization owns and brings to the platform (BYOIP).
+/// Once verified it becomes a `FloatingIPPool` scoped to the organization,
+/// and the site's gateway chassis announce the whole prefix over BGP while
+/// at least one of its floating IPs is attached.
+///
+/// Prefixes are unique across the platform: two organizations can't both
+/// claim overlapping space, whichever proved it first. A partial unique
+/// index on verified `cidr` backs the overlap check against two
+/// verifications of the same prefix racing.
+final class BYOIPPrefix: Model, @unchecked Sendable {
+    static let schema = "byoip_prefixes"
+
+    /// Longest prefix accepted: longer ones are filtered by most of the
+    /// Internet, so announcing them would attract no traffic.
+    static let longestPrefix = 24
+    /// Shortest prefix accepted, matching floating-IP pools.
+    static let shortestPrefix = IPAMService.allocatablePrefixRange.lowerBound
+
+    @ID(key: .id)
+    var id: UUID?
+
+    @Parent(key: "organization_id")
+    var organization: Organization
+
+    /// Site whose gateway chassis announce the prefix; nil for single-node
+    /// deployments, like an unpinned pool.
+    @OptionalParent(key: "site_id")
+    var site: Site?
+
+    /// Canonical CIDR (network address / prefix).
+    @Field(key: "cidr")
+    var cidr: String
+
+    /// Name the verified prefix's floating-IP pool takes.
+    @Field(key: "pool_name")
+    var poolName: String
+
+    /// `BYOIPVerificationMethod.rawValue`.
+    @Field(key: "verification_method")
+    var verificationMethod: String
+
+    /// The text published in RDAP remarks for `roa`, or signed for
+    /// `signed_challenge`. Minted at registration and bound to the
+    /// organization and prefix, so a proof can't be replayed for another
+    /// claim.
+    @Field(key: "challenge")
+    var challenge: String
+
+    /// `BYOIPPrefixStatus.rawValue`.
+    @Field(key: "status")
+    var status: String
+
+    /// Why the last verification failed; nil otherwise.
+    @OptionalField(key: "status_message")
+    var statusMessage: String?
+
+    /// The origin ASN a ROA was checked against.
+    @OptionalField(key: "origin_asn")
+    var originASN: Int?
+
+    @OptionalField(key: "verified_at")
+    var verifiedAt: Date?
+
+    @OptionalParent(key: "created_by_id")
+    var createdBy: User?
+
+    @Timestamp(key: "created_at", on: .create)
+    var createdAt: Date?
+
+    @Timestamp(key: "updated_at", on: .update)
+    var updatedAt: Date?
+
+    init() {}
+
+    init(
+        id: UUID? = nil,
+        organizationID: UUID,
+        siteID: UUID?,
+        cidr: String,
+        poolName: String,
+        verificationMethod: BYOIPVerificationMethod,
+        challenge: String,
+        createdByID: UUID? = nil
+    ) {
+        self.id = id
+        self.$organization.id = organizationID
+        self.$site.id = siteID
+        self.cidr = cidr
+        self.poolName = poolName
+        self.verificationMethod = verificationMethod.rawValue
+        self.challenge = challenge
+        self.status = BYOIPPrefixStatus.pending.rawValue
+        self.$createdBy.id = createdByID
+    }
+
+    var method: BYOIPVerificationMethod? { BYOIPVerificationMethod(rawValue: verificationMethod) }
+    var prefixStatus: BYOIPPrefixStatus? { BYOIPPrefixStatus(rawValue: status) }
+
+    /// The challenge for a new registration: the organization, the prefix,
+    /// and a random nonce.
+    static func makeChallenge(organizationID: UUID, cidr: String) -> String {
+        let nonce = [UInt8].random(count: 16).map { String(format: "%02x", $0) }.joined()
+        return "strato-byoip:\(organizationID.uuidString.lowercased()):\(cidr):\(nonce)"
+    }
+}
+
+// MARK: - DTOs
+
+struct CreateBYOIPPrefixRequest: Content {
+    let organizationId: UUID
+    /// IPv4 prefix in CIDR form, /8–/24.
+    let cidr: String
+    let verificationMethod: BYOIPVerificationMethod
+    /// Site whose gateways announce the prefix.
+    let siteId: UUID?
+    /// Name for the floating-IP pool; defaults to `byoip-<network>-<prefix>`.
+    let poolName: String?
+}
+
+struct VerifyBYOIPPrefixRequest: Content {
+    /// Base64 signature over the challenge's UTF-8 bytes, by the key of the
+    /// certificate in the prefix's RDAP remarks: ECDSA (DER) with P-256 or
+    /// P-384, or Ed25519. Required for `signed_challenge`, ignored for `roa`.
+    let signature: String?
+}
+
+struct BYOIPPrefixResponse: Content {
+    let id: UUID
+    let organizationId: UUID
+    let siteId: UUID?
+    let cidr: String
+    let poolName: String
+    let verificationMethod: String
+    let challenge: String
+    let status: String
+    let statusMessage: String?
+    let originAsn: Int?
+    let verifiedAt: Date?
+    /// The floating-IP pool, once verified.
+    let poolId: UUID?
+    let createdAt: Date?
+
+    init(from prefix: BYOIPPrefix, poolId: UUID?) throws {
+        self.id = try prefix.requireID()
+        self.organizationId = prefix.$organization.id
+        self.siteId = prefix.$site.id
+        self.cidr = prefix.cidr
+        self.poolName = prefix.poolName
+        self.verificationMethod = prefix.verificationMethod
+        self.challenge = prefix.challenge
+        self.status = prefix.status
+        self.statusMessage = prefix.statusMessage
+        self.originAsn = prefix.originASN
+        self.verifiedAt = prefix.verifiedAt
+        self.poolId = poolId
+        self.createdAt = prefix.createdAt
+    }
+}
@@ -0,0 +1,210 @@
+import Fluent
+import Foundation
+import StratoShared
+import Vapor
+
+/// Lifecycle of a bucket as the API reports it. `creating` and `deleting`
+/// are set by the API and cleared by the gateway agent's report once it
+/// converges; `error` carries the agent's last convergence failure.
+enum BucketStatus: String, Codable, CaseIterable, Sendable {
+    case creating
+    case available
+    case deleting
+    case error
+}
+
+/// An S3 bucket: object storage for a project, served by the S3-compatible
+/// gateway on one agent.
+///
+/// Placed like a file share — on an online member of a `StoragePool` that
+/// advertises `StorageCapability.objectGateway` — and level-triggered the same
+/// way: the API writes the desired state (`desiredStatus`, `quotaBytes`) and
+/// bumps `generation`, and the agent's observed report advances
+/// `observedGeneration` and the usage counters. Who may do what to the
+/// bucket's contents is not stored here: every sync compiles it from Cedar
+/// policy into per-access-key grants (`bucket:getObject` and friends).
+final class Bucket: Model, @unchecked Sendable {
+    static let schema = "buckets"
+
+    @ID(key: .id)
+    var id: UUID?
+
+    /// The S3 bucket name. Globally unique — clients address buckets by name
+    /// alone — and valid under `BucketName.isValid`.
+    @Field(key: "name")
+    var name: String
+
+    @OptionalField(key: "description")
+    var description: String?
+
+    @Parent(key: "project_id")
+    var project: Project
+
+    @Field(key: "environment")
+    var environment: String
+
+    /// The pool whose member agents may host the bucket; nil for the default
+    /// pool.
+    @OptionalParent(key: "pool_id")
+    var pool: StoragePool?
+
+    /// Upper bound on stored bytes; nil is unlimited.
+    @OptionalField(key: "quota_bytes")
+    var quotaBytes: Int64?
+
+    /// Bytes and objects held, as last reported by the gateway.
+    @Field(key: "used_bytes")
+    var usedBytes: Int64
+
+    @Field(key: "object_count")
+    var objectCount: Int64
+
+    /// The gateway URL clients use, as the hosting agent's operator
+    /// configured it; nil until reported or when none is configured.
+    @OptionalField(key: "endpoint")
+    var endpoint: String?
+
+    /// The agent whose gateway holds the bucket, chosen at create time.
+    @OptionalField(key: "hypervisor_id")
+    var hypervisorId: String?
+
+    @Enum(key: "status")
+    var status: BucketStatus
+
+    @OptionalField(key: "status_changed_at")
+    var statusChangedAt: Date?
+
+    /// The agent's last convergence error, cleared once it converges.
+    @OptionalField(key: "error_message")
+    var errorMessage: String?
+
+    @Enum(key: "desired_status")
+    var desiredStatus: DesiredBucketStatus
+
+    @Field(key: "generation")
+    var generation: Int64
+
+    @Field(key: "observed_generation")
+    var observedGeneration: Int64
+
+    @Timestamp(key: "created_at", on: .create)
+    var createdAt: Date?
+
+    @Timestamp(key: "updated_at", on: .update)
+    var updatedAt: Date?
+
+    init() {}
+
+    init(
+        id: UUID? = nil,
+        name: String,
+        description: String? = nil,
+        projectID: UUID,
+        environment: String,
+        poolID: UUID? = nil,
+        quotaBytes: Int64? = nil
+    ) {
+        self.id = id
+        self.name = name
+        self.description = description
+        self.$project.id = projectID
+        self.environment = environment
+        self.$pool.id = poolID
+        self.quotaBytes = quotaBytes
+        self.usedBytes = 0
+        self.objectCount = 0
+        self.status = .creating
+        self.statusChangedAt = Date()
+        self.desiredStatus = .present
+        self.generation = 1
+        self.observedGeneration = 0
+    }
+}
+
+extension Bucket: Content {}
+
+// MARK: - State helpers (mirroring FileShare)
+
+extension Bucket {
+    /// Updates the status and stamps the change time. Does not persist.
+    func setStatus(_ newStatus: BucketStatus, at date: Date = Date()) {
+        status = newStatus
+        statusChangedAt = date
+    }
+
+    /// Marks the desired state changed so the agent treats the next sync as
+    /// newer than anything it has applied. Does not persist.
+    func bumpGeneration() {
+        generation += 1
+    }
+
+    /// Records a new desired status and bumps the generation. Does not persist.
+    func setDesiredStatus(_ newDesired: DesiredBucketStatus) {
+        desiredStatus = newDesired
+        bumpGeneration()
+    }
+
+    /// True once the hosting agent has confirmed the current generation.
+    var isConverged: Bool {
+        observedGeneration >= generation
+    }
+}
+
+// MARK: - Request/Response DTOs
+
+struct CreateBucketRequest: Content {
+    let name: String
+    let description: String?
+    /// Owner project; defaults to the default project of the caller's
+    /// current organization.
+    let projectId: UUID?
+    let environment: String?
+    /// Pool to place the bucket in; defaults to the seeded default pool.
+    let poolId: UUID?
+    let quotaBytes: Int64?
+}
+
+struct UpdateBucketRequest: Content {
+    let description: String?
+    /// The new quota. Must be present to change it; send `removeQuota` to
+    /// make the bucket unlimited.
+    let quotaBytes: Int64?
+    let removeQuota: Bool?
+}
+
+struct BucketResponse: Content {
+    let id: UUID?
+    let name: String
+    let description: String?
+    let projectId: UUID
+    let environment: String
+    let poolId: UUID?
+    let quotaBytes: Int64?
+    let usedBytes: Int64
+    let objectCount: Int64
+    let status: BucketStatus
+    let errorMessage: String?
+    let hypervisorId: String?
+    /// The gateway's base URL; S3 clients use it with path-style addressing.
+    let endpoint: String?
+    let createdAt: Date?
+    let updatedAt: Date?
+
+    init(from bucket: Bucket) {
+        self.id = bucket.id
+        self.name = bucket.name
+        self.description = bucket.description
+        self.projectId = bucket.$project.id
+        self.environment = bucket.environment
+        self.poolId = bucket.$pool.id
+        self.quotaBytes = bucket.quotaBytes
+        self.usedBytes = bucket.usedBytes
+        self.objectCount = bucket.objectCount
+        self.status = bucket.status
+        self.errorMessage = bucket.errorMessage
+        self.hypervisorId = bucket.hypervisorId
+        self.endpoint = bucket.endpoint
+        self.createdAt = bucket.createdAt
+        self.updatedAt = bucket.updatedAt
+    }
+}
@@ -0,0 +1,260 @@
+import Fluent
+import Foundation
+import StratoShared
+import Vapor
+
+/// A code-interpreter session: a sandbox running a persistent language kernel
+/// (`strato-kernel serve`, see `sandbox-guest/code-interpreter/`) that
+/// executes snippets with state kept between them.
+///
+/// The session lives exactly as long as its sandbox — the row cascades with
+/// it — and draws its vCPUs, memory, count and checkpoint storage from the
+/// sandbox quota like any other sandbox. `CodeSessionService` checkpoints an
+/// idle session (checkpoint-and-stop), resumes it on the next execution, and
+/// tears it down once it has sat checkpointed past the retention window.
+final class CodeSession: Model, @unchecked Sendable {
+    static let schema = "code_sessions"
+
+    @ID(key: .id)
+    var id: UUID?
+
+    @Parent(key: "sandbox_id")
+    var sandbox: Sandbox
+
+    @Parent(key: "project_id")
+    var project: Project
+
+    @Field(key: "language")
+    var language: CodeSessionLanguage
+
+    @Field(key: "state")
+    var state: CodeSessionState
+
+    /// Seconds without an execution before the session is checkpointed.
+    @Field(key: "idle_timeout_seconds")
+    var idleTimeoutSeconds: Int
+
+    @Field(key: "last_activity_at")
+    var lastActivityAt: Date
+
+    /// Set while an execution may be running (its deadline), so the idle
+    /// sweep on any replica leaves the session alone; nil otherwise.
+    @OptionalField(key: "executing_until")
+    var executingUntil: Date?
+
+    @Field(key: "execution_count")
+    var executionCount: Int
+
+    /// The idle checkpoint, while one is being taken, held, or resumed from.
+    /// An opaque id like `Sandbox.restoredFromSnapshotId`: the snapshot row
+    /// cascades with the sandbox, as does this one.
+    @OptionalField(key: "checkpoint_snapshot_id")
+    var checkpointSnapshotId: UUID?
+
+    @OptionalField(key: "checkpointed_at")
+    var checkpointedAt: Date?
+
+    @Parent(key: "created_by_id")
+    var createdBy: User
+
+    @Timestamp(key: "created_at", on: .create)
+    var createdAt: Date?
+
+    @Timestamp(key: "updated_at", on: .update)
+    var updatedAt: Date?
+
+    init() {}
+
+    init(
+        id: UUID? = nil,
+        sandboxID: UUID,
+        projectID: UUID,
+        language: CodeSessionLanguage,
+        idleTimeoutSeconds: Int,
+        createdByID: UUID,
+        now: Date = Date()
+    ) {
+        self.id = id
+        self.$sandbox.id = sandboxID
+        self.$project.id = projectID
+        self.language = language
+        self.state = .active
+        self.idleTimeoutSeconds = idleTimeoutSeconds
+        self.lastActivityAt = now
+        self.executingUntil = nil
+        self.executionCount = 0
+        self.$createdBy.id = createdByID
+    }
+}
+
+extension CodeSession {
+    static let defaultIdleTimeoutSeconds = 900
+    static let idleTimeoutRange = 60...86_400
+
+    static let defaultExecutionTimeoutSeconds = 60
+    static let executionTimeoutRange = 1...600
+
+    /// Largest snippet accepted, in UTF-8 bytes.
+    static let maxCodeBytes = 1024 * 1024
+
+    /// Whether an execution may be running right now.
+    func isExecuting(at now: Date = Date()) -> Bool {
+        guard let executingUntil else { return false }
+        return executingUntil > now
+    }
+
+    /// Whether the session has gone `idleTimeoutSeconds` without an
+    /// execution.
+    func isIdle(at now: Date = Date()) -> Bool {
+        !isExecuting(at: now) && now.timeIntervalSince(lastActivityAt) >= TimeInterval(idleTimeoutSeconds)
+    }
+}
+
+enum CodeSessionLanguage: String, Codable, CaseIterable, Sendable {
+    case python
+    case node
+    case bash
+}
+
+/// Where the session is in its idle lifecycle. Whether an `active` session
+/// can run code right now depends on its sandbox; see `CodeSessionStatus`.
+enum CodeSessionState: String, Codable, CaseIterable, Sendable {
+    case active
+    /// Idle: a checkpoint-and-stop is in flight.
+    case checkpointing
+    /// Idle: stopped, its kernel state held in `checkpointSnapshotId`.
+    case checkpointed
+    /// An execution arrived while checkpointed; the restore is in flight.
+    case resuming
+}
+
+/// The status clients see, folding the sandbox into the session state.
+enum CodeSessionStatus: String, Codable, Sendable {
+    /// The sandbox is being placed or booted.
+    case starting
+    case ready
+    /// An execution is running.
+    case busy
+    case checkpointing
+    case checkpointed
+    case resuming
+    /// The sandbox exited or errored; the session cannot run code and should
+    /// be deleted.
+    case failed
+
+    init(session: CodeSession, sandbox: Sandbox, now: Date = Date()) {
+        switch session.state {
+        case .checkpointing: self = .checkpointing
+        case .checkpointed: self = .checkpointed
+        case .resuming: self = .resuming
+        case .active:
+            switch sandbox.status {
+            case .running: self = session.isExecuting(at: now) ? .busy : .ready
+            case .exited, .error: self = .failed
+            default: self = .starting
+            }
+        }
+    }
+}
+
+// MARK: - DTOs
+
+struct CreateCodeSessionRequest: Content {
+    let language: CodeSessionLanguage
+    let projectId: UUID?
+    let environment: String?
+    let cpus: Int?
+    /// Guest memory in bytes.
+    let memory: Int64?
+    let idleTimeoutSeconds: Int?
+    /// Hard lifetime, enforced as the sandbox's TTL.
+    let ttlSeconds: Int?
+    /// Extra environment for the kernel process.
+    let env: [String: String]?
+}
+
+struct CodeSessionResponse: Content {
+    let id: UUID?
+    let sandboxId: UUID
+    let projectId: UUID
+    let language: CodeSessionLanguage
+    let status: CodeSessionStatus
+    let idleTimeoutSeconds: Int
+    let executionCount: Int
+    let lastActivityAt: Date
+    /// When the session will be checkpointed if nothing runs.
+    let idleCheckpointAt: Date?
+    let createdAt: Date?
+
+    init(from session: CodeSession, sandbox: Sandbox, now: Date = Date()) {
+        self.id = session.id
+        self.sandboxId = sandbox.id ?? session.$sandbox.id
+        self.projectId = session.$project.id
+        self.language = session.language
+        self.status = CodeSessionStatus(session: session, sandbox: sandbox, now: now)
+        self.idleTimeoutSeconds = session.idleTimeoutSeconds
+        self.executionCount = session.executionCount
+        self.lastActivityAt = session.lastActivityAt
+        self.idleCheckpointAt =
+            session.state == .active
+            ? session.lastActivityAt.addingTimeInterval(TimeInterval(session.idleTimeoutSeconds)) : nil
+        self.createdAt = session.createdAt
+    }
+}
+
+struct ExecuteCodeRequest: Content {
+    let code: String
+    let timeoutSeconds: Int?
+}
+
+/// What `strato-kernel execute` prints: one JSON document describing the
+/// execution. Passed through to the client as the bulk of
+/// `CodeExecutionResponse`.
+struct CodeExecutionResult: Codable, Sendable {
+    /// `ok`, `error` (the code raised), or `timeout` (the kernel was
+    /// interrupted at the deadline).
+    let status: String
+    let stdout: String
+    let stderr: String
+    /// Rich display outputs, in the order the code produced them.
+    let outputs: [CodeOutput]
+    /// Files created or modified under the working directory.
+    let files: [CodeFile]
+    let error: CodeError?
+}
+
+struct CodeOutput: Codable, Sendable {
+    let mimeType: String
+    /// Text for textual types, base64 for binary ones (`image/png`, …).
+    let data: String?
+    /// `application/json` (and `+json`) outputs, as JSON.
+    let json: CodableValue?
+}
+
+struct CodeFile: Codable, Sendable {
+    let path: String
+    let size: Int
+    let mimeType: String?
+    /// Base64 contents; absent when the file exceeds the kernel's inline
+    /// limit.
+    let content: String?
+}
+
+struct CodeError: Codable, Sendable {
+    let name: String
+    let message: String
+    let traceback: [String]
+}
+
+struct CodeExecutionResponse: Content {
+    let sessionId: UUID
+    /// The session's execution number, starting at 1.
+    let executionCount: Int
+    let status: String
+    let stdout: String
+    let stderr: String
+    let outputs: [CodeOutput]
+    let files: [CodeFile]
+    let error: CodeError?
+    let durationMs: Int
+}
@@ -0,0 +1,324 @@
+import Fluent
+import Foundation
+import StratoShared
+import Vapor
+
+/// Lifecycle of a file share as the API reports it. `creating`, `resizing`
+/// and `deleting` are set by the mutation that starts them and cleared by the
+/// agent's report once it converges; `error` means the share could not be
+/// confirmed (see `FileShare.resolveForStuckOperation`).
+enum FileShareStatus: String, Codable, CaseIterable, Sendable {
+    case creating
+    case available
+    case resizing
+    case deleting
+    case error
+
+    var isTransitional: Bool {
+        self == .creating || self == .resizing || self == .deleting
+    }
+}
+
+/// A managed NFS file share: shared POSIX storage for a project's VMs.
+///
+/// The share lives on one agent's storage — placed in a `StoragePool` like a
+/// volume, on a member agent that advertises `StorageCapability.nfsFileShare`
+/// — and is served by that agent's NFS server from its own address on one of
+/// the owner project's logical networks. The export admits only the IPv4
+/// addresses of the project's VM NICs on that network, re-derived at every
+/// sync, so attaching or removing a VM changes who may mount without any call
+/// against the share.
+///
+/// Level-triggered like `Sandbox`: API mutations write the desired state
+/// (`desiredStatus`, `sizeBytes`, the snapshot rows) and bump `generation`;
+/// the agent's observed report advances `observedGeneration` and completes
+/// the pending `ResourceOperation`.
+final class FileShare: Model, @unchecked Sendable {
+    static let schema = "file_shares"
+
+    @ID(key: .id)
+    var id: UUID?
+
+    @Field(key: "name")
+    var name: String
+
+    @OptionalField(key: "description")
+    var description: String?
+
+    @Parent(key: "project_id")
+    var project: Project
+
+    @Field(key: "environment")
+    var environment: String
+
+    /// The project network the share is exported on. A network with shares
+    /// cannot be deleted.
+    @Parent(key: "network_id")
+    var network: LogicalNetwork
+
+    /// The pool whose member agents may host the share; nil for the default
+    /// pool.
+    @OptionalParent(key: "pool_id")
+    var pool: StoragePool?
+
+    /// Provisioned capacity in bytes — the desired size, and what quotas
+    /// charge.
+    @Field(key: "size_bytes")
+    var sizeBytes: Int64
+
+    /// Capacity the agent last reported. Lags `sizeBytes` during a resize and
+    /// is what a failed resize reverts to; nil until the first report.
+    @OptionalField(key: "observed_size_bytes")
+    var observedSizeBytes: Int64?
+
+    /// Bytes in use inside the filesystem, as last reported.
+    @OptionalField(key: "used_bytes")
+    var usedBytes: Int64?
+
+    /// The agent hosting the share, chosen at create time.
+    @OptionalField(key: "hypervisor_id")
+    var hypervisorId: String?
+
+    // The NFS server's port on `network`, allocated by the same IPAM as VM
+    // NICs.
+    @Field(key: "ip_address")
+    var ipAddress: String
+
+    @Field(key: "netmask")
+    var netmask: String
+
+    @Field(key: "mac_address")
+    var macAddress: String
+
+    @Enum(key: "status")
+    var status: FileShareStatus
+
+    /// When `status` last changed, for the stuck-operation sweep.
+    @OptionalField(key: "status_changed_at")
+    var statusChangedAt: Date?
+
+    /// The agent's last convergence error, cleared once it converges.
+    @OptionalField(key: "error_message")
+    var errorMessage: String?
+
+    @Enum(key: "desired_status")
+    var desiredStatus: DesiredFileShareStatus
+
+    @Field(key: "generation")
+    var generation: Int64
+
+    @Field(key: "observed_generation")
+    var observedGeneration: Int64
+
+    @Timestamp(key: "created_at", on: .create)
+    var createdAt: Date?
+
+    @Timestamp(key: "updated_at", on: .update)
+    var updatedAt: Date?
+
+    init() {}
+
+    init(
+        id: UUID? = nil,
+        name: String,
+        description: String? = nil,
+        projectID: UUID,
+        environment: String,
+        networkID: UUID,
+        poolID: UUID? = nil,
+        sizeBytes: Int64,
+        ipAddress: String,
+        netmask: String,
+        macAddress: String
+    ) {
+        self.id = id
+        self.name = name
+        self.description = description
+        self.$project.id = projectID
+        self.environment = environment
+        self.$network.id = networkID
+        self.$pool.id = poolID
+        self.sizeBytes = sizeBytes
+        self.ipAddress = ipAddress
+        self.netmask = netmask
+        self.macAddress = macAddress
+        self.status = .creating
+        self.statusChangedAt = Date()
+        // Generation 1 from the start: the create operation's desired state is
+        // "present", and `observedGeneration == 0` means no agent has
+        // confirmed it yet.
+        self.desiredStatus = .present
+        self.generation = 1
+        self.observedGeneration = 0
+    }
+}
+
+extension FileShare: Content {}
+
+// MARK: - State helpers (mirroring Sandbox)
+
+extension FileShare {
+    /// Updates the status and stamps the change time. Does not persist.
+    func setStatus(_ newStatus: FileShareStatus, at date: Date = Date()) {
+        status = newStatus
+        statusChangedAt = date
+    }
+
+    /// Marks the desired state changed so the agent treats the next sync as
+    /// newer than anything it has applied. Does not persist.
+    func bumpGeneration() {
+        generation += 1
+    }
+
+    /// Records a new desired status and bumps the generation. Does not persist.
+    func setDesiredStatus(_ newDesired: DesiredFileShareStatus) {
+        desiredStatus = newDesired
+        bumpGeneration()
+    }
+
+    /// True once the hosting agent has confirmed the current generation.
+    var isConverged: Bool {
+        observedGeneration >= generation
+    }
+
+    /// Realigns desired state with what the agent last confirmed after a
+    /// failed operation — a failed delete's `.absent` or a failed resize's
+    /// size must not replay on a later sync. Returns whether anything
+    /// changed; does not persist.
+    @discardableResult
+    func revertDesiredToObserved() -> Bool {
+        var changed = false
+        if desiredStatus == .absent, observedGeneration > 0 {
+            desiredStatus = .present
+            changed = true
+        }
+        if let observedSizeBytes, observedSizeBytes != sizeBytes {
+            sizeBytes = observedSizeBytes
+            changed = true
+        }
+        if changed {
+            bumpGeneration()
+        }
+        return changed
+    }
+
+    /// `Sandbox.resolveForStuckOperation` for shares: a share still in a
+    /// transitional status — or whose create no agent ever confirmed — goes
+    /// to `.error`; a resize or delete the agent never finished goes back to
+    /// `.available` with the desired state realigned. Shared by
+    /// `ResourceOperationCoordinator.recordVerdict` and the stuck-operation
+    /// sweep. Returns whether anything changed; does not persist.
+    @discardableResult
+    func resolveForStuckOperation(_ operation: ResourceOperation) -> Bool {
+        var changed = false
+        if operation.kind == .create && observedGeneration == 0 {
+            if status != .error {
+                setStatus(.error)
+                changed = true
+            }
+        } else if status.isTransitional {
+            setStatus(observedGeneration > 0 ? .available : .error)
+            changed = true
+        }
+        if revertDesiredToObserved() {
+            changed = true
+        }
+        return changed
+    }
+
+    /// `resolveForStuckOperation` plus the rows around the share: snapshots
+    /// the failed operation left `creating` go to `.error` (dropping out of
+    /// desired state), ones it left `deleting` go back to `.available`, and
+    /// quota is re-synced when the revert gave back a resize's bytes.
+    func resolveAndSaveForStuckOperation(_ operation: ResourceOperation, on db: Database) async throws {
+        let sizeBefore = sizeBytes
+        if resolveForStuckOperation(operation) {
+            try await save(on: db)
+        }
+        let shareID = try requireID()
+        switch operation.kind {
+        case .snapshot:
+            try await FileShareSnapshot.query(on: db)
+                .filter(\.$share.$id == shareID)
+                .filter(\.$status == .creating)
+                .set(\.$status, to: .error)
+                .update()
+        case .snapshotDelete:
+            try await FileShareSnapshot.query(on: db)
+                .filter(\.$share.$id == shareID)
+                .filter(\.$status == .deleting)
+                .set(\.$status, to: .available)
+                .update()
+        default:
+            break
+        }
+        if sizeBytes != sizeBefore || operation.kind == .snapshot {
+            try await QuotaEnforcementService.release(for: self, on: db)
+        }
+    }
+}
+
+// MARK: - Request/Response DTOs
+
+struct CreateFileShareRequest: Content {
+    let name: String
+    let description: String?
+    /// Owner project; defaults to the default project of the caller's
+    /// current organization.
+    let projectId: UUID?
+    let environment: String?
+    /// Logical network of the owner project to export the share on.
+    let networkId: UUID
+    /// Pool to place the share in; defaults to the seeded default pool.
+    let poolId: UUID?
+    let sizeBytes: Int64
+}
+
+struct ResizeFileShareRequest: Content {
+    /// The new capacity; must be larger than the current one.
+    let sizeBytes: Int64
+}
+
+struct CreateFileShareSnapshotRequest: Content {
+    let name: String?
+}
+
+struct FileShareResponse: Content {
+    let id: UUID?
+    let name: String
+    let description: String?
+    let projectId: UUID
+    let environment: String
+    let networkId: UUID
+    let poolId: UUID?
+    let sizeBytes: Int64
+    let usedBytes: Int64?
+    let status: FileShareStatus
+    let errorMessage: String?
+    let hypervisorId: String?
+    /// The NFS server address clients mount from.
+    let ipAddress: String
+    /// `<ipAddress>:<exportPath>`, ready for `mount -t nfs4`.
+    let mountTarget: String
+    let createdAt: Date?
+    let updatedAt: Date?
+
+    init(from share: FileShare) {
+        self.id = share.id
+        self.name = share.name
+        self.description = share.description
+        self.projectId = share.$project.id
+        self.environment = share.environment
+        self.networkId = share.$network.id
+        self.poolId = share.$pool.id
+        self.sizeBytes = share.sizeBytes
+        self.usedBytes = share.usedBytes
+        self.status = share.status
+        self.errorMessage = share.errorMessage
+        self.hypervisorId = share.hypervisorId
+        self.ipAddress = share.ipAddress
+        self.mountTarget = share.id.map { "\(share.ipAddress):\(FileShareExport.path(shareId: $0))" } ?? ""
+        self.createdAt = share.createdAt
+        self.updatedAt = share.updatedAt
+    }
+}
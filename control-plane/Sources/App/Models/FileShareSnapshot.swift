@@ -0,0 +1,99 @@
+import Fluent
+import Foundation
+import StratoShared
+import Vapor
+
+/// Lifecycle of a file-share snapshot. `creating` and `deleting` are the
+/// desired-state writes; the share's observed report moves them on.
+enum FileShareSnapshotStatus: String, Codable, CaseIterable, Sendable {
+    case creating
+    case available
+    case deleting
+    case error
+}
+
+/// A point-in-time copy of a file share, kept beside it on its agent and
+/// exported read-only at `FileShareExport.snapshotPath` so clients can
+/// recover files without a restore. Part of the share's desired state: the
+/// sync lists every snapshot not being deleted, and a row goes away once the
+/// agent stops reporting it.
+final class FileShareSnapshot: Model, @unchecked Sendable {
+    static let schema = "file_share_snapshots"
+
+    @ID(key: .id)
+    var id: UUID?
+
+    @Parent(key: "file_share_id")
+    var share: FileShare
+
+    /// Project ownership and environment, denormalized from the share for
+    /// quota scoping (the sandbox-snapshot pattern).
+    @Parent(key: "project_id")
+    var project: Project
+
+    @Field(key: "environment")
+    var environment: String
+
+    @Field(key: "name")
+    var name: String
+
+    @Enum(key: "status")
+    var status: FileShareSnapshotStatus
+
+    /// Bytes the snapshot holds. The share's used bytes as the admission
+    /// estimate, then the agent's reported figure.
+    @OptionalField(key: "size_bytes")
+    var sizeBytes: Int64?
+
+    @Timestamp(key: "created_at", on: .create)
+    var createdAt: Date?
+
+    @Timestamp(key: "updated_at", on: .update)
+    var updatedAt: Date?
+
+    init() {}
+
+    init(
+        id: UUID? = nil,
+        shareID: UUID,
+        projectID: UUID,
+        environment: String,
+        name: String,
+        sizeBytes: Int64?,
+        status: FileShareSnapshotStatus = .creating
+    ) {
+        self.id = id
+        self.$share.id = shareID
+        self.$project.id = projectID
+        self.environment = environment
+        self.name = name
+        self.sizeBytes = sizeBytes
+        self.status = status
+    }
+}
+
+extension FileShareSnapshot: Content {}
+
+struct FileShareSnapshotResponse: Content {
+    let id: UUID?
+    let fileShareId: UUID
+    let name: String
+    let status: FileShareSnapshotStatus
+    let sizeBytes: Int64?
+    /// Read-only mount target of the snapshot on the share's server.
+    let mountTarget: String
+    let createdAt: Date?
+
+    init(from snapshot: FileShareSnapshot, share: FileShare) {
+        self.id = snapshot.id
+        self.fileShareId = snapshot.$share.id
+        self.name = snapshot.name
+        self.status = snapshot.status
+        self.sizeBytes = snapshot.sizeBytes
+        self.mountTarget =
+            snapshot.id.map {
+                "\(share.ipAddress):\(FileShareExport.snapshotPath(shareId: snapshot.$share.id, snapshotId: $0))"
+            } ?? ""
+        self.createdAt = snapshot.createdAt
+    }
+}
@@ -45,6 +45,11 @@ final class FloatingIPPool: Model, @unchecked Sendable {
     @OptionalParent(key: "organizational_unit_id")
     var organizationalUnit: OrganizationalUnit?
 
+    /// The verified BYOIP prefix this pool was made from. Such a pool's whole
+    /// CIDR is announced over BGP while any of its addresses is attached.
+    @OptionalParent(key: "byoip_prefix_id")
+    var byoipPrefix: BYOIPPrefix?
+
     @Children(for: \.$pool)
     var floatingIPs: [FloatingIP]
 
@@ -62,7 +67,8 @@ final class FloatingIPPool: Model, @unchecked Sendable {
         cidr: String,
         gateway: String? = nil,
         siteID: UUID? = nil,
-        organizationScope: OrganizationScope? = nil
+        organizationScope: OrganizationScope? = nil,
+        byoipPrefixID: UUID? = nil
     ) {
         self.id = id
         self.name = name
@@ -71,6 +77,7 @@ final class FloatingIPPool: Model, @unchecked Sendable {
         self.$site.id = siteID
         self.$organization.id = organizationScope?.organizationID
         self.$organizationalUnit.id = organizationScope?.organizationalUnitID
+        self.$byoipPrefix.id = byoipPrefixID
     }
 
     /// The pool's org-or-OU owner; nil only for rows that predate scoping.
@@ -119,6 +126,8 @@ struct FloatingIPPoolResponse: Content {
     let siteId: UUID?
     let organizationId: UUID?
     let organizationalUnitId: UUID?
+    /// Set when the pool is a verified BYOIP prefix.
+    let byoipPrefixId: UUID?
     let allocatedCount: Int
     let createdAt: Date?
 
@@ -130,6 +139,7 @@ struct FloatingIPPoolResponse: Content {
         self.siteId = pool.$site.id
         self.organizationId = pool.$organization.id
         self.organizationalUnitId = pool.$organizationalUnit.id
+        self.byoipPrefixId = pool.$byoipPrefix.id
         self.allocatedCount = allocatedCount
         self.createdAt = pool.createdAt
     }
@@ -0,0 +1,145 @@
+import Fluent
+import StratoShared
+import Vapor
+
+/// An address on a logical network held for one project before (or beyond)
+/// any workload using it. IPAM never hands a reserved address out on its
+/// own; the owning project takes it by naming it as a NIC's fixed IP at VM
+/// create. The reservation outlives that VM, so a recreated VM can come
+/// back on the same address — deleting the reservation is what releases it.
+///
+/// `address` is canonical text, like `VMInterfaceAddress.address`, so the
+/// `(network_id, address)` unique index compares one spelling.
+final class IPReservation: Model, @unchecked Sendable {
+    static let schema = "ip_reservations"
+
+    /// Per project and network; generous for fixed-address fleets, small
+    /// enough that a loop can't reserve a whole /16 away from its neighbors.
+    static let maxPerProjectPerNetwork = 256
+
+    @ID(key: .id)
+    var id: UUID?
+
+    @Parent(key: "network_id")
+    var network: LogicalNetwork
+
+    @Parent(key: "project_id")
+    var project: Project
+
+    /// Address family, stored as `IPFamily.rawValue`.
+    @Field(key: "family")
+    var family: String
+
+    @Field(key: "address")
+    var address: String
+
+    @Field(key: "description")
+    var description: String
+
+    @OptionalParent(key: "created_by_id")
+    var createdBy: User?
+
+    @Timestamp(key: "created_at", on: .create)
+    var createdAt: Date?
+
+    @Timestamp(key: "updated_at", on: .update)
+    var updatedAt: Date?
+
+    init() {}
+
+    init(
+        id: UUID? = nil,
+        networkID: UUID,
+        projectID: UUID,
+        family: IPFamily,
+        address: String,
+        description: String = "",
+        createdByID: UUID? = nil
+    ) {
+        self.id = id
+        self.$network.id = networkID
+        self.$project.id = projectID
+        self.family = family.rawValue
+        self.address = address
+        self.description = description
+        self.$createdBy.id = createdByID
+    }
+
+    var ipFamily: IPFamily? { IPFamily(rawValue: family) }
+}
+
+// MARK: - DTOs
+
+struct CreateIPReservationRequest: Content {
+    /// A specific address to hold; omitted takes the next free one.
+    let address: String?
+    /// The family to allocate from when `address` is omitted (default IPv4,
+    /// or IPv6 on an IPv6-only network).
+    let family: IPFamily?
+    /// Required on global networks; a project network's reservations belong
+    /// to its project.
+    let projectId: UUID?
+    let description: String?
+}
+
+struct IPReservationResponse: Content {
+    let id: UUID?
+    let networkId: UUID
+    let projectId: UUID
+    let family: String
+    let address: String
+    let description: String
+    /// The VM NIC currently holding the address, if any.
+    let interfaceId: UUID?
+    let createdAt: Date?
+
+    init(from reservation: IPReservation, interfaceId: UUID? = nil) {
+        self.id = reservation.id
+        self.networkId = reservation.$network.id
+        self.projectId = reservation.$project.id
+        self.family = reservation.family
+        self.address = reservation.address
+        self.description = reservation.description
+        self.interfaceId = interfaceId
+        self.createdAt = reservation.createdAt
+    }
+}
+
+/// One address in use on a network and what holds it.
+struct NetworkAllocationResponse: Content, Equatable {
+    enum Kind: String, Codable, Sendable {
+        /// The network's router port (its gateway).
+        case router
+        case vm
+        case sandbox
+        case fileShare = "file_share"
+        /// A floating IP NAT'd to a VM NIC on the network. `address` is the
+        /// external address; `natTarget` the fixed one it forwards to.
+        case floatingIP = "floating_ip"
+        /// Reserved and not taken by any NIC yet.
+        case reservation
+    }
+
+    let address: String
+    let family: String
+    let kind: Kind
+    /// Owner details are withheld (nil) on a shared network for projects
+    /// the caller can't read.
+    let projectId: UUID?
+    /// The VM, sandbox, file share, floating IP or reservation.
+    let resourceId: UUID?
+    let resourceName: String?
+    let interfaceId: UUID?
+    /// Set when the address belongs to a reservation, taken or not.
+    let reservationId: UUID?
+    let natTarget: String?
+}
+
+struct NetworkAllocationsResponse: Content {
+    let networkId: UUID
+    /// Nil on an IPv6-only network.
+    let subnet: String?
+    let subnet6: String?
+    /// IPv4 before IPv6, each in address order; floating IPs last.
+    let allocations: [NetworkAllocationResponse]
+}
@@ -107,6 +107,15 @@ final class Image: Model, @unchecked Sendable {
     @OptionalField(key: "default_cmdline")
     var defaultCmdline: String?
 
+    /// Position among the images of the same name in the project, counting
+    /// from 1. Image builds number their output here; other images are 1.
+    @Field(key: "version")
+    var version: Int
+
+    /// The build that produced this image, while the build is kept.
+    @OptionalParent(key: "image_build_id")
+    var imageBuild: ImageBuild?
+
     // Upload tracking
     @Parent(key: "uploaded_by_id")
     var uploadedBy: User
@@ -135,7 +144,8 @@ final class Image: Model, @unchecked Sendable {
         defaultCpu: Int? = nil,
         defaultMemory: Int64? = nil,
         defaultDisk: Int64? = nil,
-        defaultCmdline: String? = nil
+        defaultCmdline: String? = nil,
+        version: Int = 1
     ) {
         self.id = id
         self.name = name
@@ -152,6 +162,7 @@ final class Image: Model, @unchecked Sendable {
         self.defaultMemory = defaultMemory
         self.defaultDisk = defaultDisk
         self.defaultCmdline = defaultCmdline
+        self.version = version
     }
 }
 
@@ -178,6 +189,8 @@ extension Image {
         let defaultMemory: Int64?
         let defaultDisk: Int64?
         let defaultCmdline: String?
+        let version: Int
+        let imageBuildId: UUID?
         let uploadedById: UUID?
         let createdAt: Date?
         let updatedAt: Date?
@@ -202,6 +215,8 @@ extension Image {
             defaultMemory: self.defaultMemory,
             defaultDisk: self.defaultDisk,
             defaultCmdline: self.defaultCmdline,
+            version: self.version,
+            imageBuildId: self.$imageBuild.id,
             uploadedById: self.$uploadedBy.id,
             createdAt: self.createdAt,
             updatedAt: self.updatedAt
@@ -339,6 +354,9 @@ struct ImageResponse: Content {
     let artifacts: [ImageArtifact.Public]
     /// Hypervisor types this image can run on, when artifacts are eager-loaded.
     let compatibleHypervisors: [HypervisorType]
+    let version: Int
+    /// The image build that produced this image, if any.
+    let imageBuildId: UUID?
     let uploadedById: UUID?
     let createdAt: Date?
     let updatedAt: Date?
@@ -364,6 +382,8 @@ struct ImageResponse: Content {
         self.defaultCmdline = image.defaultCmdline
         self.artifacts = (image.$artifacts.value ?? []).map { $0.asPublic() }
         self.compatibleHypervisors = image.compatibleHypervisors().sorted { $0.rawValue < $1.rawValue }
+        self.version = image.version
+        self.imageBuildId = image.$imageBuild.id
         self.uploadedById = image.$uploadedBy.id
         self.createdAt = image.createdAt
         self.updatedAt = image.updatedAt
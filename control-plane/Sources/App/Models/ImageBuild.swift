@@ -0,0 +1,336 @@
+import Fluent
+import Foundation
+import Vapor
+
+/// A server-side golden-image build: boot a temporary VM from `baseImage`,
+/// run the provisioners in it through the QEMU guest agent, stop it, and
+/// capture its boot disk as a new version of the image `targetImageName`.
+///
+/// `ImageBuildService` walks a build through `ImageBuildStatus` one sweep at
+/// a time and, once the build ends — however it ends — deletes the VM. The
+/// VM is an ordinary project VM (it counts against quota and shows in the
+/// VM list, tagged with the build), so an operator can look at a stuck build
+/// the usual ways.
+final class ImageBuild: Model, @unchecked Sendable {
+    static let schema = "image_builds"
+
+    @ID(key: .id)
+    var id: UUID?
+
+    @Parent(key: "project_id")
+    var project: Project
+
+    /// The project environment the build VM is created in.
+    @Field(key: "environment")
+    var environment: String
+
+    @Field(key: "name")
+    var name: String
+
+    /// Nulled if the base image is deleted; a build that has not booted yet
+    /// then fails.
+    @OptionalParent(key: "base_image_id")
+    var baseImage: Image?
+
+    @Field(key: "target_image_name")
+    var targetImageName: String
+
+    @Field(key: "target_image_description")
+    var targetImageDescription: String
+
+    /// Cloud-init user data for the build VM. When set, the build waits for
+    /// cloud-init to finish before the first provisioner.
+    @OptionalField(key: "user_data")
+    var userData: String?
+
+    @Field(key: "provisioners")
+    var provisioners: [ImageBuildProvisioner]
+
+    /// The build network; nil is the default network.
+    @OptionalField(key: "network_id")
+    var networkId: UUID?
+
+    @Field(key: "cpu")
+    var cpu: Int
+
+    @Field(key: "memory")
+    var memory: Int64
+
+    @Field(key: "disk")
+    var disk: Int64
+
+    @Field(key: "status")
+    var status: ImageBuildStatus
+
+    /// The next step to run while provisioning: an index into `steps`.
+    @Field(key: "step_index")
+    var stepIndex: Int
+
+    /// Set while a provisioner or the disk export is running (its deadline),
+    /// so a sweep on any replica leaves the step alone. One that expires
+    /// without a result means the replica running it died: the step may or
+    /// may not have happened, so the build fails rather than repeating it.
+    @OptionalField(key: "step_deadline")
+    var stepDeadline: Date?
+
+    /// When the build entered its current status, for the phase timeouts.
+    @Field(key: "phase_started_at")
+    var phaseStartedAt: Date
+
+    /// What the steps printed, newest last, trimmed from the front to
+    /// `maxLogBytes`.
+    @Field(key: "log")
+    var log: String
+
+    @OptionalField(key: "error_message")
+    var errorMessage: String?
+
+    @Field(key: "cancel_requested")
+    var cancelRequested: Bool
+
+    /// The build VM, until it is deleted. A plain column: the VM row points
+    /// back at the build, and is gone before the build forgets it.
+    @OptionalField(key: "vm_id")
+    var vmId: UUID?
+
+    /// The captured image, once capture has begun.
+    @OptionalParent(key: "image_id")
+    var image: Image?
+
+    @Parent(key: "created_by_id")
+    var createdBy: User
+
+    @OptionalField(key: "started_at")
+    var startedAt: Date?
+
+    @OptionalField(key: "finished_at")
+    var finishedAt: Date?
+
+    @Timestamp(key: "created_at", on: .create)
+    var createdAt: Date?
+
+    @Timestamp(key: "updated_at", on: .update)
+    var updatedAt: Date?
+
+    init() {}
+
+    init(
+        id: UUID? = nil,
+        projectID: UUID,
+        environment: String,
+        name: String,
+        baseImageID: UUID,
+        targetImageName: String,
+        targetImageDescription: String = "",
+        userData: String? = nil,
+        provisioners: [ImageBuildProvisioner],
+        networkId: UUID? = nil,
+        cpu: Int,
+        memory: Int64,
+        disk: Int64,
+        createdByID: UUID,
+        now: Date = Date()
+    ) {
+        self.id = id
+        self.$project.id = projectID
+        self.environment = environment
+        self.name = name
+        self.$baseImage.id = baseImageID
+        self.targetImageName = targetImageName
+        self.targetImageDescription = targetImageDescription
+        self.userData = userData
+        self.provisioners = provisioners
+        self.networkId = networkId
+        self.cpu = cpu
+        self.memory = memory
+        self.disk = disk
+        self.status = .pending
+        self.stepIndex = 0
+        self.phaseStartedAt = now
+        self.log = ""
+        self.cancelRequested = false
+        self.$createdBy.id = createdByID
+    }
+}
+
+extension ImageBuild {
+    static let maxProvisioners = 50
+    /// Largest inline script or command, in UTF-8 bytes.
+    static let maxProvisionerBytes = 64 * 1024
+    static let defaultProvisionerTimeoutSeconds = 1800
+    static let provisionerTimeoutRange = 1...21_600
+    static let maxLogBytes = 256 * 1024
+
+    /// Waits for the build VM's cloud-init run to end. Exit 2 is cloud-init's
+    /// "finished with recoverable errors" (a deprecated key, say), which is
+    /// not worth failing an image over; it is in the log.
+    static let cloudInitWait = ImageBuildProvisioner(
+        kind: .exec, script: nil, command: ["cloud-init", "status", "--wait"], timeoutSeconds: 1800)
+
+    /// What the provisioning phase runs, in order: the cloud-init wait when
+    /// there is user data, then the provisioners.
+    var steps: [ImageBuildProvisioner] {
+        (userData == nil ? [] : [Self.cloudInitWait]) + provisioners
+    }
+
+    var isFinished: Bool {
+        status == .succeeded || status == .failed || status == .cancelled
+    }
+
+    /// Appends a step's output, keeping the newest `maxLogBytes`.
+    func appendLog(_ text: String) {
+        var combined = log + text
+        if !combined.hasSuffix("\n") { combined += "\n" }
+        if combined.utf8.count > Self.maxLogBytes {
+            combined = String(decoding: combined.utf8.suffix(Self.maxLogBytes), as: UTF8.self)
+        }
+        log = combined
+    }
+
+    func enter(_ status: ImageBuildStatus, now: Date = Date()) {
+        self.status = status
+        phaseStartedAt = now
+        stepDeadline = nil
+        if isFinished {
+            finishedAt = now
+        }
+    }
+}
+
+enum ImageBuildStatus: String, Codable, CaseIterable, Sendable {
+    /// Accepted; the build VM is not created yet.
+    case pending
+    /// The build VM is being placed and booted, until its guest agent answers.
+    case booting
+    /// Running `steps` one at a time.
+    case provisioning
+    /// The build VM is shutting down.
+    case stopping
+    /// The stopped VM's disk is being flattened and uploaded.
+    case capturing
+    case succeeded
+    case failed
+    case cancelled
+}
+
+/// One provisioning step, run in the build VM through qga.
+struct ImageBuildProvisioner: Content, Equatable, Sendable {
+    enum Kind: String, Codable, Sendable {
+        /// `script` run by `/bin/sh -c`.
+        case shell
+        /// `command` run directly: the program, then its arguments.
+        case exec
+    }
+
+    let kind: Kind
+    let script: String?
+    let command: [String]?
+    /// Defaults to `ImageBuild.defaultProvisionerTimeoutSeconds`.
+    let timeoutSeconds: Int?
+
+    /// The argv handed to `guest-exec`.
+    var guestCommand: [String] {
+        switch kind {
+        case .shell: return ["/bin/sh", "-c", script ?? ""]
+        case .exec: return command ?? []
+        }
+    }
+
+    var effectiveTimeoutSeconds: Int {
+        timeoutSeconds ?? ImageBuild.defaultProvisionerTimeoutSeconds
+    }
+
+    /// A one-line description for the log.
+    var summary: String {
+        switch kind {
+        case .shell:
+            let firstLine = (script ?? "").split(separator: "\n").first.map(String.init) ?? ""
+            return "shell: \(firstLine.prefix(80))"
+        case .exec:
+            return "exec: \((command ?? []).joined(separator: " ").prefix(80))"
+        }
+    }
+}
+
+// MARK: - DTOs
+
+struct CreateImageBuildRequest: Content {
+    let name: String
+    let baseImageId: UUID
+    let targetImageName: String
+    let targetImageDescription: String?
+    let environment: String?
+    let userData: String?
+    let provisioners: [ImageBuildProvisioner]?
+    /// The network the build VM joins; omitted is the default network.
+    let networkId: UUID?
+    /// Build VM sizing; omitted takes the base image's defaults. The disk
+    /// size is also the captured image's default disk size.
+    let cpu: Int?
+    let memory: Int64?
+    let disk: Int64?
+}
+
+struct ImageBuildResponse: Content {
+    let id: UUID?
+    let projectId: UUID
+    let name: String
+    let status: ImageBuildStatus
+    let baseImageId: UUID?
+    let targetImageName: String
+    let provisioners: [ImageBuildProvisioner]
+    let hasUserData: Bool
+    let networkId: UUID?
+    let cpu: Int
+    let memory: Int64
+    let disk: Int64
+    /// Steps finished so far, of `totalSteps` (the cloud-init wait counts).
+    let completedSteps: Int
+    let totalSteps: Int
+    let vmId: UUID?
+    /// The captured image, once capture has begun; usable once the build
+    /// has succeeded.
+    let imageId: UUID?
+    let errorMessage: String?
+    let cancelRequested: Bool
+    let createdById: UUID
+    let startedAt: Date?
+    let finishedAt: Date?
+    let createdAt: Date?
+    let updatedAt: Date?
+    /// Only on single-build reads.
+    let log: String?
+
+    init(from build: ImageBuild, includeLog: Bool = false) {
+        self.id = build.id
+        self.projectId = build.$project.id
+        self.name = build.name
+        self.status = build.status
+        self.baseImageId = build.$baseImage.id
+        self.targetImageName = build.targetImageName
+        self.provisioners = build.provisioners
+        self.hasUserData = build.userData != nil
+        self.networkId = build.networkId
+        self.cpu = build.cpu
+        self.memory = build.memory
+        self.disk = build.disk
+        self.totalSteps = build.steps.count
+        self.completedSteps =
+            switch build.status {
+            case .pending, .booting: 0
+            case .provisioning: min(build.stepIndex, build.steps.count)
+            case .stopping, .capturing, .succeeded: build.steps.count
+            case .failed, .cancelled: min(build.stepIndex, build.steps.count)
+            }
+        self.vmId = build.vmId
+        self.imageId = build.$image.id
+        self.errorMessage = build.errorMessage
+        self.cancelRequested = build.cancelRequested
+        self.createdById = build.$createdBy.id
+        self.startedAt = build.startedAt
+        self.finishedAt = build.finishedAt
+        self.createdAt = build.createdAt
+        self.updatedAt = build.updatedAt
+        self.log = includeLog ? build.log : nil
+    }
+}
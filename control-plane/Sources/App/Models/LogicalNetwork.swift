@@ -27,9 +27,10 @@ final class LogicalNetwork: Model, @unchecked Sendable {
     var name: String
 
     /// Subnet in CIDR notation (e.g. "192.168.1.0/24"). IPs are allocated from
-    /// its host range.
-    @Field(key: "subnet")
-    var subnet: String
+    /// its host range. Nil on an IPv6-only network, whose guests have no
+    /// IPv4 at all.
+    @OptionalField(key: "subnet")
+    var subnet: String?
 
     /// Gateway address inside the subnet; excluded from allocation and pushed
     /// to guests via the VM spec. Changing it only affects future allocations:
@@ -111,7 +112,7 @@ final class LogicalNetwork: Model, @unchecked Sendable {
     init(
         id: UUID? = nil,
         name: String,
-        subnet: String,
+        subnet: String?,
         gateway: String? = nil,
         subnet6: String? = nil,
         gateway6: String? = nil,
@@ -162,6 +163,9 @@ final class LogicalNetwork: Model, @unchecked Sendable {
         return "network-\(id?.uuidString ?? name)"
     }
 
+    /// No IPv4 subnet: addresses, DHCP and routing are IPv6 alone.
+    var isIPv6Only: Bool { subnet == nil }
+
     /// Parsed DNS resolver list, backed by the comma-separated `dns_servers` column.
     var dnsServers: [String] {
         get { LogicalNetwork.splitDNS(dnsServersRaw) }
@@ -190,8 +194,9 @@ extension LogicalNetwork: Content {}
 
 struct CreateNetworkRequest: Content {
     let name: String
-    /// Subnet in CIDR notation; prefix must be within /8–/30.
-    let subnet: String
+    /// Subnet in CIDR notation; prefix must be within /8–/30. Omit for an
+    /// IPv6-only network, which then needs IPv6 enabled and no `gateway`.
+    let subnet: String?
     /// Defaults to the subnet's first host address when omitted.
     let gateway: String?
     /// IPv6 subnet (must be a /64). When omitted and IPv6 isn't disabled, a
@@ -220,7 +225,7 @@ struct CreateNetworkRequest: Content {
     // Explicit init so the DHCP fields default when omitted (e.g. in tests) while
     // JSON decoding still populates them via the synthesized Codable conformance.
     init(
-        name: String, subnet: String, gateway: String? = nil, subnet6: String? = nil,
+        name: String, subnet: String?, gateway: String? = nil, subnet6: String? = nil,
         gateway6: String? = nil, ipv6Enabled: Bool? = nil, projectId: UUID? = nil,
         dhcpEnabled: Bool? = nil, dnsServers: [String]? = nil, domainName: String? = nil,
         leaseTime: Int? = nil, externalAccess: Bool? = nil, siteId: UUID? = nil
@@ -288,7 +293,8 @@ struct UpdateNetworkRequest: Content {
 struct NetworkResponse: Content {
     let id: UUID?
     let name: String
-    let subnet: String
+    /// Nil on an IPv6-only network.
+    let subnet: String?
     let gateway: String?
     let subnet6: String?
     let gateway6: String?
@@ -0,0 +1,281 @@
+import Fluent
+import Foundation
+import Vapor
+
+/// When disruptive platform work — agent updates today, hypervisor reboots
+/// and migrations as they arrive — may touch a project's VMs.
+///
+/// Stored as JSON on `projects.maintenance_policy`. A project without one
+/// takes work at any time and without notice, which is how every project
+/// behaved before windows existed. With one, work waits for a recurring
+/// window, never runs inside a deny period, and is announced `noticeHours`
+/// ahead through the `maintenance.scheduled` webhook.
+struct MaintenancePolicy: Content, Equatable, Sendable {
+    /// IANA zone the windows' days and start times are read in, so a window
+    /// keeps its local time across daylight-saving changes.
+    var timeZone: String
+    /// Recurring windows. Empty means any time outside a deny period.
+    var windows: [Window]
+    /// Absolute periods when nothing disruptive may start, windows or not.
+    var denyPeriods: [DenyPeriod]
+    /// How far ahead of scheduled work its notice goes out. Zero schedules
+    /// work straight into the next open window.
+    var noticeHours: Int
+
+    static let defaultNoticeHours = 24
+    static let maxWindows = 14
+    static let maxDenyPeriods = 20
+    static let maxNoticeHours = 14 * 24
+    static let minWindowMinutes = 30
+    /// A window ends within a day of its start, so whether one is open at an
+    /// instant depends only on the occurrences of the day before it.
+    static let maxWindowMinutes = 24 * 60
+    static let maxDenyPeriod: TimeInterval = 90 * 86_400
+
+    struct Window: Content, Equatable, Sendable {
+        var days: [Weekday]
+        /// Local start time, `HH:mm` (24-hour).
+        var startTime: String
+        var durationMinutes: Int
+
+        /// `startTime` as hour and minute; nil when malformed.
+        var start: (hour: Int, minute: Int)? {
+            let parts = startTime.split(separator: ":", omittingEmptySubsequences: false)
+            guard parts.count == 2, parts[0].count == 2, parts[1].count == 2,
+                let hour = Int(parts[0]), let minute = Int(parts[1]),
+                (0..<24).contains(hour), (0..<60).contains(minute)
+            else { return nil }
+            return (hour, minute)
+        }
+    }
+
+    struct DenyPeriod: Content, Equatable, Sendable {
+        var start: Date
+        var end: Date
+        var reason: String?
+
+        func contains(_ date: Date) -> Bool { start <= date && date < end }
+    }
+
+    /// Raw values are API surface; the order matches `Calendar`'s weekday
+    /// numbering (Sunday is 1).
+    enum Weekday: String, Codable, CaseIterable, Sendable {
+        case sunday, monday, tuesday, wednesday, thursday, friday, saturday
+
+        init?(calendarWeekday: Int) {
+            guard (1...7).contains(calendarWeekday) else { return nil }
+            self = Self.allCases[calendarWeekday - 1]
+        }
+    }
+
+    init(
+        timeZone: String = "UTC", windows: [Window] = [], denyPeriods: [DenyPeriod] = [],
+        noticeHours: Int = Self.defaultNoticeHours
+    ) {
+        self.timeZone = timeZone
+        self.windows = windows
+        self.denyPeriods = denyPeriods
+        self.noticeHours = noticeHours
+    }
+
+    private enum CodingKeys: String, CodingKey {
+        case timeZone, windows, denyPeriods, noticeHours
+    }
+
+    /// Everything but the zone is optional on the wire.
+    init(from decoder: any Decoder) throws {
+        let container = try decoder.container(keyedBy: CodingKeys.self)
+        self.timeZone = try container.decode(String.self, forKey: .timeZone)
+        self.windows = try container.decodeIfPresent([Window].self, forKey: .windows) ?? []
+        self.denyPeriods = try container.decodeIfPresent([DenyPeriod].self, forKey: .denyPeriods) ?? []
+        self.noticeHours = try container.decodeIfPresent(Int.self, forKey: .noticeHours) ?? Self.defaultNoticeHours
+    }
+
+    /// Why the policy can't be stored, or nil when it can.
+    var validationError: String? {
+        guard TimeZone(identifier: timeZone) != nil else {
+            return "Unknown time zone '\(timeZone)'; use an IANA name such as Europe/Berlin"
+        }
+        guard windows.count <= Self.maxWindows else {
+            return "At most \(Self.maxWindows) maintenance windows"
+        }
+        for (index, window) in windows.enumerated() {
+            if window.days.isEmpty {
+                return "Window \(index) names no days"
+            }
+            if window.start == nil {
+                return "Window \(index) startTime must be HH:mm"
+            }
+            if !(Self.minWindowMinutes...Self.maxWindowMinutes).contains(window.durationMinutes) {
+                return "Window \(index) must last \(Self.minWindowMinutes) to \(Self.maxWindowMinutes) minutes"
+            }
+        }
+        guard denyPeriods.count <= Self.maxDenyPeriods else {
+            return "At most \(Self.maxDenyPeriods) deny periods"
+        }
+        for (index, period) in denyPeriods.enumerated() {
+            if period.end <= period.start {
+                return "Deny period \(index) must end after it starts"
+            }
+            if period.end.timeIntervalSince(period.start) > Self.maxDenyPeriod {
+                return "Deny period \(index) is longer than 90 days"
+            }
+        }
+        guard (0...Self.maxNoticeHours).contains(noticeHours) else {
+            return "noticeHours must be between 0 and \(Self.maxNoticeHours)"
+        }
+        return nil
+    }
+
+    // MARK: - Evaluation
+
+    private var calendar: Calendar {
+        var calendar = Calendar(identifier: .gregorian)
+        calendar.timeZone = TimeZone(identifier: timeZone) ?? .gmt
+        return calendar
+    }
+
+    /// Whether disruptive work may start at `date`.
+    func isOpen(at date: Date) -> Bool {
+        if denyPeriods.contains(where: { $0.contains(date) }) { return false }
+        guard !windows.isEmpty else { return true }
+        let lookback = date.addingTimeInterval(-TimeInterval(Self.maxWindowMinutes * 60))
+        return occurrences(from: lookback, through: date).contains { $0.start <= date && date < $0.end }
+    }
+
+    /// The first instant at or after `date` when work may start, or nil when
+    /// none falls within the search horizon (two weeks past the last deny
+    /// period) — every window denied, in effect.
+    func nextOpening(atOrAfter date: Date) -> Date? {
+        if isOpen(at: date) { return date }
+        let lastDenial = denyPeriods.map(\.end).max() ?? date
+        let horizon = max(date, lastDenial).addingTimeInterval(14 * 86_400)
+
+        // An opening is a window starting or a deny period ending; nothing
+        // else flips the answer from closed to open.
+        var candidates = denyPeriods.map(\.end).filter { $0 > date && $0 <= horizon }
+        if !windows.isEmpty {
+            candidates += occurrences(from: date, through: horizon).map(\.start).filter { $0 > date }
+        }
+        return candidates.sorted().first { isOpen(at: $0) }
+    }
+
+    /// Every window occurrence starting in `from...through`, in no order.
+    ///
+    /// Days are walked by their local noon, which every zone has exactly
+    /// once, and each start is built from the day's date components in the
+    /// policy's zone. A start falling into a daylight-saving gap resolves to
+    /// the instant `Calendar` gives that wall-clock time rather than
+    /// dropping the day, and one in a repeated hour starts at its first pass.
+    func occurrences(from: Date, through: Date) -> [DateInterval] {
+        let calendar = self.calendar
+        var noonComponents = calendar.dateComponents([.year, .month, .day], from: from)
+        noonComponents.hour = 12
+        guard var noon = calendar.date(from: noonComponents) else { return [] }
+        var result: [DateInterval] = []
+        // The day whose noon lies past `through` can still start a window
+        // before it, at any time from its midnight.
+        while noon.addingTimeInterval(-13 * 3600) <= through {
+            let day = calendar.dateComponents([.year, .month, .day, .weekday], from: noon)
+            if let weekday = day.weekday.flatMap(Weekday.init(calendarWeekday:)) {
+                for window in windows where window.days.contains(weekday) {
+                    guard let start = window.start,
+                        let begins = calendar.date(
+                            from: DateComponents(
+                                year: day.year, month: day.month, day: day.day,
+                                hour: start.hour, minute: start.minute)),
+                        begins >= from, begins <= through
+                    else { continue }
+                    result.append(DateInterval(start: begins, duration: TimeInterval(window.durationMinutes * 60)))
+                }
+            }
+            guard let next = calendar.date(byAdding: .day, value: 1, to: noon) else { break }
+            noon = next
+        }
+        return result
+    }
+}
+
+/// Kinds of disruptive work a maintenance policy gates. Raw values are the
+/// `action` of notices and of the `maintenance.scheduled` webhook.
+enum MaintenanceAction: String, Codable, CaseIterable, Sendable {
+    /// The agent on the VM's host is replaced by a newer build.
+    case agentUpdate = "agent_update"
+}
+
+/// One announcement of disruptive work to a project, and the time the work
+/// was scheduled for. Doubles as the gate's memory: the work may start once
+/// its notice's `scheduledFor` has passed and the project's policy is open,
+/// at which point `startedAt` is stamped.
+final class MaintenanceNotice: Model, @unchecked Sendable {
+    static let schema = "maintenance_notices"
+
+    @ID(key: .id)
+    var id: UUID?
+
+    @Parent(key: "project_id")
+    var project: Project
+
+    /// A `MaintenanceAction` raw value.
+    @Field(key: "action")
+    var action: String
+
+    /// What the work is about, unique per action — for an agent update
+    /// `<agent name>@<target version>`.
+    @Field(key: "subject")
+    var subject: String
+
+    @Field(key: "scheduled_for")
+    var scheduledFor: Date
+
+    @Field(key: "summary")
+    var summary: String
+
+    @OptionalField(key: "started_at")
+    var startedAt: Date?
+
+    @Timestamp(key: "created_at", on: .create)
+    var createdAt: Date?
+
+    init() {}
+
+    init(projectID: UUID, action: MaintenanceAction, subject: String, scheduledFor: Date, summary: String) {
+        self.$project.id = projectID
+        self.action = action.rawValue
+        self.subject = subject
+        self.scheduledFor = scheduledFor
+        self.summary = summary
+    }
+}
+
+// MARK: - DTOs
+
+struct ProjectMaintenancePolicyResponse: Content {
+    let projectId: UUID
+    /// Nil when the project takes work at any time.
+    let policy: MaintenancePolicy?
+    let openNow: Bool
+    /// The next instant work may start; nil when no window opens within the
+    /// search horizon.
+    let nextOpening: Date?
+    /// Announced work that hasn't started yet, soonest first.
+    let scheduled: [MaintenanceNoticeResponse]
+}
+
+struct MaintenanceNoticeResponse: Content {
+    let id: UUID?
+    let action: String
+    let subject: String
+    let summary: String
+    let scheduledFor: Date
+    let createdAt: Date?
+
+    init(from notice: MaintenanceNotice) {
+        self.id = notice.id
+        self.action = notice.action
+        self.subject = notice.subject
+        self.summary = notice.summary
+        self.scheduledFor = notice.scheduledFor
+        self.createdAt = notice.createdAt
+    }
+}
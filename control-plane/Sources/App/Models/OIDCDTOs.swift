@@ -145,6 +145,51 @@ struct OIDCUserInfo {
     var groupValues: [String] = []
 }
 
+// MARK: - Domain Account Claims
+
+/// A sign-in parked until the account holder consents to a verified domain's
+/// organization taking their account over (`DomainAccountClaimRequired`).
+/// Kept in the session as JSON. It expires, so a consent prompt left open
+/// doesn't carry the IdP's word indefinitely.
+struct PendingDomainClaim: Codable {
+    static let sessionKey = "domain_claim"
+    static let lifetime: TimeInterval = 600
+
+    let userID: UUID
+    let domainID: UUID
+    let providerID: UUID
+    let subject: String
+    let groupValues: [String]
+    /// Retained for RP-initiated logout, as the callback retains it.
+    let idToken: String
+    let expiresAt: Date
+
+    /// The pending claim, or nil when there is none or it has expired.
+    static func load(from session: Session) -> PendingDomainClaim? {
+        guard let json = session.data[sessionKey],
+            let claim = try? JSONDecoder().decode(PendingDomainClaim.self, from: Data(json.utf8)),
+            claim.expiresAt > Date()
+        else { return nil }
+        return claim
+    }
+
+    func store(in session: Session) throws {
+        session.data[Self.sessionKey] = String(decoding: try JSONEncoder().encode(self), as: UTF8.self)
+    }
+
+    static func clear(from session: Session) {
+        session.data[sessionKey] = nil
+    }
+}
+
+/// What accepting a pending claim does, for the consent prompt.
+struct DomainClaimResponse: Content {
+    let username: String
+    let email: String
+    let organizationName: String
+    let domain: String
+}
+
 // MARK: - ID Token Header
 
 /// The decoded JOSE header of an ID token, parsed to pin the signature
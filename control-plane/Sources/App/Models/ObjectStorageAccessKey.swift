@@ -0,0 +1,113 @@
+import Fluent
+import Foundation
+import Vapor
+
+/// An S3 access key pair for the object gateways: an access key ID and a
+/// SigV4 secret, owned by exactly one principal — a user or a service
+/// account. The key carries no permissions of its own; a request signed with
+/// it may do whatever Cedar lets its owner do to the bucket (compiled into
+/// grants at every sync), so revoking a role binding narrows every key the
+/// principal holds.
+final class ObjectStorageAccessKey: Model, @unchecked Sendable {
+    static let schema = "object_storage_access_keys"
+
+    @ID(key: .id)
+    var id: UUID?
+
+    /// The public half, `SK` plus 18 uppercase letters and digits — the same
+    /// shape as an AWS access key ID, so SDKs and tools accept it. Unique.
+    @Field(key: "access_key_id")
+    var accessKeyId: String
+
+    /// The SigV4 secret, encrypted at rest with `SecretsEncryptionService`.
+    /// Unlike an API key it cannot be stored hashed: the gateway needs the
+    /// secret itself to recompute signatures. Returned to the caller once,
+    /// at creation.
+    @Field(key: "secret")
+    var secret: String
+
+    @Field(key: "name")
+    var name: String
+
+    @OptionalParent(key: "user_id")
+    var user: User?
+
+    @OptionalParent(key: "service_account_id")
+    var serviceAccount: ServiceAccount?
+
+    @Field(key: "created_by")
+    var createdBy: UUID
+
+    @Timestamp(key: "created_at", on: .create)
+    var createdAt: Date?
+
+    init() {}
+
+    init(
+        id: UUID? = nil,
+        accessKeyId: String,
+        secret: String,
+        name: String,
+        userID: UUID? = nil,
+        serviceAccountID: UUID? = nil,
+        createdBy: UUID
+    ) {
+        self.id = id
+        self.accessKeyId = accessKeyId
+        self.secret = secret
+        self.name = name
+        self.$user.id = userID
+        self.$serviceAccount.id = serviceAccountID
+        self.createdBy = createdBy
+    }
+
+    /// The principal requests signed with this key act as.
+    var principal: (type: IAMPrincipalType, id: UUID)? {
+        if let userID = $user.id { return (.user, userID) }
+        if let serviceAccountID = $serviceAccount.id { return (.serviceAccount, serviceAccountID) }
+        return nil
+    }
+
+    static func generateAccessKeyId() -> String {
+        let characters = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+        return "SK" + String((0..<18).map { _ in characters.randomElement()! })
+    }
+
+    /// 40 characters, like an AWS secret access key.
+    static func generateSecret() -> String {
+        String.randomAlphanumeric(length: 40)
+    }
+}
+
+// MARK: - DTOs
+
+struct CreateObjectStorageAccessKeyRequest: Content {
+    let name: String
+    /// Issue the key to this service account instead of the caller. Requires
+    /// `serviceaccount:update` on it.
+    let serviceAccountId: UUID?
+}
+
+struct ObjectStorageAccessKeyResponse: Content {
+    let id: UUID?
+    let accessKeyId: String
+    let name: String
+    let userId: UUID?
+    let serviceAccountId: UUID?
+    let createdAt: Date?
+
+    init(from key: ObjectStorageAccessKey) {
+        self.id = key.id
+        self.accessKeyId = key.accessKeyId
+        self.name = key.name
+        self.userId = key.$user.id
+        self.serviceAccountId = key.$serviceAccount.id
+        self.createdAt = key.createdAt
+    }
+}
+
+/// The creation response: the only time the secret is shown.
+struct CreatedObjectStorageAccessKeyResponse: Content {
+    let key: ObjectStorageAccessKeyResponse
+    let secretAccessKey: String
+}
@@ -0,0 +1,199 @@
+import Fluent
+import Vapor
+
+/// Where a domain is in its proof of control. Stored as a string.
+enum OrganizationDomainStatus: String, Codable, Sendable {
+    /// Registered, not yet proven.
+    case pending
+    /// The TXT record was found; the organization owns the domain's addresses.
+    case verified
+    /// The last check failed (`statusMessage` says why). It may be retried.
+    case failed
+}
+
+/// An email domain an organization proves it controls by publishing a DNS TXT
+/// record. Once verified, the organization's identity providers are trusted
+/// for the domain's addresses: users signing in through them with a matching
+/// email can join the organization automatically (`autoJoin`), and existing
+/// accounts with such an address can be taken over into it, with the
+/// account holder's consent (`claimAccounts`).
+///
+/// A domain may be registered by several organizations, but only one can
+/// hold it verified — whichever proved it first, like a BYOIP prefix.
+final class OrganizationDomain: Model, @unchecked Sendable {
+    static let schema = "organization_domains"
+
+    /// The label the challenge record is published under, below the domain.
+    static let recordLabel = "_strato-challenge"
+    /// What the challenge record's value starts with.
+    static let recordValuePrefix = "strato-domain-verification="
+
+    @ID(key: .id)
+    var id: UUID?
+
+    @Parent(key: "organization_id")
+    var organization: Organization
+
+    /// Lowercased, without a trailing dot.
+    @Field(key: "domain")
+    var domain: String
+
+    /// The random token the TXT record must carry. Minted at registration.
+    @Field(key: "verification_token")
+    var verificationToken: String
+
+    /// `OrganizationDomainStatus.rawValue`.
+    @Field(key: "status")
+    var status: String
+
+    /// Why the last check failed; nil otherwise.
+    @OptionalField(key: "status_message")
+    var statusMessage: String?
+
+    @OptionalField(key: "verified_at")
+    var verifiedAt: Date?
+
+    /// Users signing in through the organization's identity providers with
+    /// an email at this domain join the organization if they aren't members.
+    @Field(key: "auto_join")
+    var autoJoin: Bool
+
+    /// The org role auto-joined users get: `member`, `admin`, an IAM role
+    /// name or a role id, as for an OIDC provider's default role.
+    @Field(key: "default_role")
+    var defaultRole: String
+
+    /// Existing accounts with an email at this domain that aren't members may
+    /// be taken over into the organization when their holder signs in through
+    /// its identity provider and consents.
+    @Field(key: "claim_accounts")
+    var claimAccounts: Bool
+
+    @OptionalParent(key: "created_by_id")
+    var createdBy: User?
+
+    @Timestamp(key: "created_at", on: .create)
+    var createdAt: Date?
+
+    @Timestamp(key: "updated_at", on: .update)
+    var updatedAt: Date?
+
+    init() {}
+
+    init(
+        id: UUID? = nil,
+        organizationID: UUID,
+        domain: String,
+        verificationToken: String = OrganizationDomain.makeToken(),
+        autoJoin: Bool = false,
+        defaultRole: String = "member",
+        claimAccounts: Bool = false,
+        createdByID: UUID? = nil
+    ) {
+        self.id = id
+        self.$organization.id = organizationID
+        self.domain = domain
+        self.verificationToken = verificationToken
+        self.status = OrganizationDomainStatus.pending.rawValue
+        self.autoJoin = autoJoin
+        self.defaultRole = defaultRole
+        self.claimAccounts = claimAccounts
+        self.$createdBy.id = createdByID
+    }
+
+    var domainStatus: OrganizationDomainStatus? { OrganizationDomainStatus(rawValue: status) }
+
+    /// The name the TXT record is published under.
+    var recordName: String { "\(Self.recordLabel).\(domain)" }
+
+    /// The TXT record's value.
+    var recordValue: String { Self.recordValuePrefix + verificationToken }
+
+    static func makeToken() -> String {
+        [UInt8].random(count: 20).map { String(format: "%02x", $0) }.joined()
+    }
+
+    /// The canonical form of a domain name, or nil when it isn't one: at least
+    /// two labels of letters, digits and inner hyphens, and not an address.
+    static func canonical(_ raw: String) -> String? {
+        var name = raw.trimmingCharacters(in: .whitespacesAndNewlines).lowercased()
+        if name.hasSuffix(".") { name.removeLast() }
+        guard !name.isEmpty, name.count <= 253 else { return nil }
+        let labels = name.split(separator: ".", omittingEmptySubsequences: false)
+        guard labels.count >= 2 else { return nil }
+        for label in labels {
+            guard (1...63).contains(label.count),
+                label.allSatisfy({ $0.isASCII && ($0.isLetter || $0.isNumber || $0 == "-") }),
+                label.first != "-", label.last != "-"
+            else { return nil }
+        }
+        // A numeric top-level label makes it an IPv4 address, not a domain.
+        guard let tld = labels.last, !tld.allSatisfy(\.isNumber) else { return nil }
+        return name
+    }
+
+    /// The domain part of an email address, canonical; nil without one.
+    static func domain(ofEmail email: String) -> String? {
+        guard let at = email.lastIndex(of: "@") else { return nil }
+        return canonical(String(email[email.index(after: at)...]))
+    }
+
+    /// The organization's verified domain an email address belongs to. Only
+    /// the exact domain matches — a subdomain must be verified on its own.
+    static func verified(
+        forEmail email: String, organizationID: UUID, on db: Database
+    ) async throws -> OrganizationDomain? {
+        guard let domain = domain(ofEmail: email) else { return nil }
+        return try await OrganizationDomain.query(on: db)
+            .filter(\.$organization.$id == organizationID)
+            .filter(\.$domain == domain)
+            .filter(\.$status == OrganizationDomainStatus.verified.rawValue)
+            .first()
+    }
+}
+
+// MARK: - DTOs
+
+struct CreateOrganizationDomainRequest: Content {
+    let domain: String
+    let autoJoin: Bool?
+    let defaultRole: String?
+    let claimAccounts: Bool?
+}
+
+struct UpdateOrganizationDomainRequest: Content {
+    let autoJoin: Bool?
+    let defaultRole: String?
+    let claimAccounts: Bool?
+}
+
+struct OrganizationDomainResponse: Content {
+    let id: UUID
+    let organizationId: UUID
+    let domain: String
+    let status: String
+    let statusMessage: String?
+    /// The TXT record to publish: its name and value.
+    let recordName: String
+    let recordValue: String
+    let autoJoin: Bool
+    let defaultRole: String
+    let claimAccounts: Bool
+    let verifiedAt: Date?
+    let createdAt: Date?
+
+    init(from domain: OrganizationDomain) throws {
+        self.id = try domain.requireID()
+        self.organizationId = domain.$organization.id
+        self.domain = domain.domain
+        self.status = domain.status
+        self.statusMessage = domain.statusMessage
+        self.recordName = domain.recordName
+        self.recordValue = domain.recordValue
+        self.autoJoin = domain.autoJoin
+        self.defaultRole = domain.defaultRole
+        self.claimAccounts = domain.claimAccounts
+        self.verifiedAt = domain.verifiedAt
+        self.createdAt = domain.createdAt
+    }
+}
@@ -33,6 +33,10 @@ final class Project: Model, @unchecked Sendable {
     @Field(key: "environments")
     var environments: [String]
 
+    // When disruptive platform work may touch the project's VMs; nil is any time
+    @OptionalField(key: "maintenance_policy")
+    var maintenancePolicy: MaintenancePolicy?
+
     @Timestamp(key: "created_at", on: .create)
     var createdAt: Date?
 
@@ -0,0 +1,88 @@
+import Fluent
+import Foundation
+import StratoShared
+import Vapor
+
+/// One platform event as the GraphQL subscription stream sees it: a copy of
+/// every `WebhookEvent`, written by `WebhookEvents.enqueue` in the same
+/// transaction as the change that produced it, so subscribers only ever see
+/// committed events. Rows are short-lived — `ResourceEventStream` tails them
+/// and prunes them after `ResourceEventStream.retention`.
+final class ResourceEvent: Model, @unchecked Sendable {
+    static let schema = "resource_events"
+
+    /// The event's own id, shared with its webhook deliveries.
+    @ID(key: .id)
+    var id: UUID?
+
+    @Field(key: "type")
+    var type: String
+
+    @Field(key: "organization_id")
+    var organizationID: UUID
+
+    @OptionalField(key: "project_id")
+    var projectID: UUID?
+
+    @OptionalField(key: "resource_kind")
+    var resourceKind: String?
+
+    @OptionalField(key: "resource_id")
+    var resourceID: UUID?
+
+    @OptionalField(key: "resource_name")
+    var resourceName: String?
+
+    /// The event's `data` object as JSON.
+    @Field(key: "data")
+    var data: String
+
+    /// When the event happened.
+    @Field(key: "occurred_at")
+    var occurredAt: Date
+
+    /// When the row was written — what the stream's cursor follows.
+    @Timestamp(key: "created_at", on: .create)
+    var createdAt: Date?
+
+    init() {}
+
+    init(_ event: WebhookEvent) throws {
+        self.id = event.id
+        self.type = event.type.rawValue
+        self.organizationID = event.organizationID
+        self.projectID = event.projectID
+        self.resourceKind = event.resource?.kind
+        self.resourceID = event.resource?.id
+        self.resourceName = event.resource?.name
+        let encoded = try JSONEncoder().encode(event.data)
+        self.data = String(decoding: encoded, as: UTF8.self)
+        self.occurredAt = event.timestamp
+    }
+
+    var decodedData: CodableValue {
+        (try? JSONDecoder().decode(CodableValue.self, from: Data(data.utf8))) ?? .object([:])
+    }
+
+    /// The Cedar read that makes the event visible: read on the resource it
+    /// names when that resource is a node in the IAM tree, else read on its
+    /// project, else on its organization.
+    var readCheck: (action: String, node: IAMNode) {
+        if let resourceID, let kind = resourceKind, let type = IAMNodeType(rawValue: kind),
+            let action = Self.readActions[type]
+        {
+            return (action, IAMNode(type: type, id: resourceID))
+        }
+        if let projectID {
+            return ("project:read", IAMNode(type: .project, id: projectID))
+        }
+        return ("org:read", IAMNode(type: .organization, id: organizationID))
+    }
+
+    private static let readActions: [IAMNodeType: String] = [
+        .virtualMachine: "vm:read",
+        .sandbox: "sandbox:read",
+        .fileShare: "fileshare:read",
+        .agent: "agent:read",
+    ]
+}
@@ -10,6 +10,7 @@ import StratoShared
 enum OperationResourceKind: String, Codable, CaseIterable, Sendable, Hashable {
     case virtualMachine = "virtual_machine"
     case sandbox = "sandbox"
+    case fileShare = "file_share"
 
     /// Short noun for client-facing messages ("An operation is already
     /// pending for this VM").
@@ -19,6 +20,8 @@ enum OperationResourceKind: String, Codable, CaseIterable, Sendable, Hashable {
             return "VM"
         case .sandbox:
             return "sandbox"
+        case .fileShare:
+            return "file share"
         }
     }
 
@@ -31,8 +34,9 @@ enum OperationResourceKind: String, Codable, CaseIterable, Sendable, Hashable {
         switch self {
         case .virtualMachine:
             switch kind {
-            case .create:
-                // Image-based creates can download multi-gigabyte base images.
+            case .create, .replace:
+                // Image-based creates can download multi-gigabyte base images;
+                // a replacement recreates the disk from the same image.
                 return 600
             case .boot:
                 return 180
@@ -64,9 +68,9 @@ enum OperationResourceKind: String, Codable, CaseIterable, Sendable, Hashable {
                 return 600
             case .delete:
                 return 300
-            case .shutdown, .reboot, .pause, .resume, .resize:
-                // Pause/resume/resize are unreachable for sandboxes (no
-                // endpoint issues them) but the budget function stays total.
+            case .shutdown, .reboot, .pause, .resume, .resize, .replace:
+                // Pause/resume/resize/replace are unreachable for sandboxes
+                // (nothing issues them) but the budget function stays total.
                 return 120
             case .snapshot:
                 // Checkpoint copies the guest memory file plus a full rootfs
@@ -86,6 +90,23 @@ enum OperationResourceKind: String, Codable, CaseIterable, Sendable, Hashable {
             case .snapshotDelete:
                 return 120
             }
+        case .fileShare:
+            switch kind {
+            case .create:
+                // Allocating the backing file, formatting it and starting the
+                // NFS server; no image download involved.
+                return 300
+            case .delete, .resize, .snapshotDelete:
+                return 180
+            case .snapshot:
+                // A reflink copy is instant; on filesystems without reflink
+                // support the snapshot is a full copy of the share.
+                return 1800
+            case .boot, .shutdown, .reboot, .pause, .resume, .restore, .snapshotExport, .replace:
+                // Unreachable for file shares (no endpoint issues them) but
+                // the budget function stays total.
+                return 120
+            }
         }
     }
 }
@@ -167,6 +188,10 @@ final class ResourceOperation: Model, @unchecked Sendable {
     convenience init(sandboxID: UUID, userID: UUID, kind: VMOperationKind) {
         self.init(resourceKind: .sandbox, resourceID: sandboxID, userID: userID, kind: kind)
     }
+
+    convenience init(fileShareID: UUID, userID: UUID, kind: VMOperationKind) {
+        self.init(resourceKind: .fileShare, resourceID: fileShareID, userID: userID, kind: kind)
+    }
 }
 
 extension ResourceOperation {
@@ -216,15 +241,35 @@ extension ResourceOperation {
     /// double-submit guard from issue #259. `mutation` runs inside the same
     /// transaction, after the insert, so the resource change commits (or rolls
     /// back) atomically with the operation record (issue #260).
+    ///
+    /// With `admission`, the organization's admission webhooks review the
+    /// operation first, outside the transaction — a webhook may take seconds
+    /// to answer. System-initiated operations (health remediation, sandbox
+    /// expiry) aren't reviewed: nobody asked for them to refuse.
     static func begin(
         _ kind: VMOperationKind,
         resourceKind: OperationResourceKind,
         resourceID: UUID,
         userID: UUID,
         on db: Database,
+        admittedBy admission: AdmissionService? = nil,
         applying mutation: @escaping @Sendable (any Database) async throws -> Void = { _ in }
     ) async throws -> ResourceOperation {
-        try await db.transaction { db in
+        if let admission, userID != systemUserID,
+            let context = try await WebhookEvents.resourceContext(kind: resourceKind, id: resourceID, on: db)
+        {
+            let subject = AdmissionService.Subject(
+                organizationID: context.organizationID,
+                projectID: context.projectID,
+                resourceKind: AdmissionResourceKind(resourceKind),
+                resourceID: resourceID,
+                resourceName: context.resourceName,
+                operation: kind.rawValue,
+                userID: userID,
+                username: try await User.find(userID, on: db)?.username)
+            _ = try await admission.review(subject, object: nil)
+        }
+        return try await db.transaction { db in
             // Read first for a friendly reason naming the conflicting kind; the
             // partial unique index on pending operations (GeneralizeVMOperations)
             // is what actually closes the race when two mutations arrive at once.
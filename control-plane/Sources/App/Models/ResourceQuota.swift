@@ -366,6 +366,32 @@ extension ResourceQuota {
         }
         reservedStorage += bytes
     }
+
+    /// Check whether `bytes` of file-share capacity fits. Shares are charged
+    /// their provisioned size, from the same storage pool as VM disks.
+    func canAccommodateFileShareStorage(_ bytes: Int64) -> (allowed: Bool, reason: String?) {
+        if !isEnabled {
+            return (true, nil)
+        }
+        if reservedStorage + bytes > maxStorage {
+            let availableGB = Double(availableStorage) / 1024 / 1024 / 1024
+            let requestedGB = Double(bytes) / 1024 / 1024 / 1024
+            return (
+                false,
+                "Insufficient storage quota for the file share: \(String(format: "%.2f", availableGB))GB available, \(String(format: "%.2f", requestedGB))GB requested"
+            )
+        }
+        return (true, nil)
+    }
+
+    /// Reserve file-share capacity.
+    func reserveFileShareStorage(_ bytes: Int64) throws {
+        let check = canAccommodateFileShareStorage(bytes)
+        if !check.allowed {
+            throw Abort(.forbidden, reason: check.reason ?? "Quota exceeded")
+        }
+        reservedStorage += bytes
+    }
 }
 
 // MARK: - Validations
@@ -0,0 +1,214 @@
+import Crypto
+import Fluent
+import Foundation
+import StratoShared
+import Vapor
+
+/// A named set of UEFI Secure Boot keys an organization — or one of its
+/// projects — uploads for its VMs to boot with in place of the firmware
+/// template's (wire v29). A VM created with a key set copies it (see
+/// `VM.secureBootKeys`), so later edits to the set never change what an
+/// existing guest trusts; that VM's own db/dbx are edited on the VM.
+final class SecureBootKeySet: Model, @unchecked Sendable {
+    static let schema = "secure_boot_key_sets"
+
+    @ID(key: .id)
+    var id: UUID?
+
+    @Parent(key: "organization_id")
+    var organization: Organization
+
+    /// Optional narrowing to one project: when set, only that project's VMs
+    /// may use the set. Nil makes it available to every project in the
+    /// organization.
+    @OptionalParent(key: "project_id")
+    var project: Project?
+
+    @Field(key: "name")
+    var name: String
+
+    @Field(key: "description")
+    var description: String
+
+    /// Recorded as the owner of every entry the agent enrolls.
+    @Field(key: "owner_guid")
+    var ownerGUID: String
+
+    /// PEM certificates; `forbidden_signatures` also takes SHA-256 hex
+    /// digests. See `SecureBootKeys` for what each variable holds.
+    @Field(key: "platform_key")
+    var platformKey: String
+
+    @Field(key: "key_exchange_keys")
+    var keyExchangeKeys: [String]
+
+    @Field(key: "signature_database")
+    var signatureDatabase: [String]
+
+    @Field(key: "forbidden_signatures")
+    var forbiddenSignatures: [String]
+
+    @Field(key: "include_microsoft_keys")
+    var includeMicrosoftKeys: Bool
+
+    @Timestamp(key: "created_at", on: .create)
+    var createdAt: Date?
+
+    @Timestamp(key: "updated_at", on: .update)
+    var updatedAt: Date?
+
+    init() {}
+
+    init(
+        id: UUID? = nil,
+        organizationID: UUID,
+        projectID: UUID? = nil,
+        name: String,
+        description: String = "",
+        ownerGUID: String = UUID().uuidString.lowercased(),
+        platformKey: String,
+        keyExchangeKeys: [String] = [],
+        signatureDatabase: [String] = [],
+        forbiddenSignatures: [String] = [],
+        includeMicrosoftKeys: Bool = false
+    ) {
+        self.id = id
+        self.$organization.id = organizationID
+        self.$project.id = projectID
+        self.name = name
+        self.description = description
+        self.ownerGUID = ownerGUID
+        self.platformKey = platformKey
+        self.keyExchangeKeys = keyExchangeKeys
+        self.signatureDatabase = signatureDatabase
+        self.forbiddenSignatures = forbiddenSignatures
+        self.includeMicrosoftKeys = includeMicrosoftKeys
+    }
+}
+
+extension SecureBootKeySet {
+    /// The keys as they travel to the agent.
+    var keys: SecureBootKeys {
+        SecureBootKeys(
+            ownerGUID: ownerGUID, platformKey: platformKey, keyExchangeKeys: keyExchangeKeys,
+            signatureDatabase: signatureDatabase, forbiddenSignatures: forbiddenSignatures,
+            includeMicrosoftKeys: includeMicrosoftKeys)
+    }
+
+    /// Why `keys` cannot be enrolled, or nil when every entry parses. The
+    /// agent would refuse the same entries at boot; catching them here puts
+    /// the error in front of whoever uploaded them.
+    static func validationError(for keys: SecureBootKeys) -> String? {
+        guard UUID(uuidString: keys.ownerGUID) != nil else {
+            return "ownerGuid must be a GUID"
+        }
+        guard SecureBootKeys.certificateDER(fromPEM: keys.platformKey) != nil else {
+            return "platformKey must be a PEM certificate"
+        }
+        let lists = [("keyExchangeKeys", keys.keyExchangeKeys), ("signatureDatabase", keys.signatureDatabase)]
+        for (field, entries) in lists {
+            if let index = entries.firstIndex(where: { SecureBootKeys.certificateDER(fromPEM: $0) == nil }) {
+                return "\(field)[\(index)] must be a PEM certificate"
+            }
+        }
+        if let index = keys.forbiddenSignatures.firstIndex(where: {
+            SecureBootKeys.sha256Digest(fromHex: $0) == nil && SecureBootKeys.certificateDER(fromPEM: $0) == nil
+        }) {
+            return "forbiddenSignatures[\(index)] must be a PEM certificate or a SHA-256 hex digest"
+        }
+        return nil
+    }
+
+    /// A short description of each certificate or digest, for responses
+    /// that should not echo whole PEM blocks.
+    static func summary(of entry: String) -> SecureBootKeyEntrySummary {
+        if let digest = SecureBootKeys.sha256Digest(fromHex: entry) {
+            return SecureBootKeyEntrySummary(
+                kind: "sha256", sha256: digest.map { String(format: "%02x", $0) }.joined())
+        }
+        let der = SecureBootKeys.certificateDER(fromPEM: entry) ?? Data()
+        return SecureBootKeyEntrySummary(
+            kind: "x509", sha256: SHA256.hash(data: der).map { String(format: "%02x", $0) }.joined())
+    }
+}
+
+// MARK: - DTOs
+
+struct CreateSecureBootKeySetRequest: Content {
+    let name: String
+    let description: String?
+    let projectId: UUID?
+    let ownerGuid: String?
+    let platformKey: String
+    let keyExchangeKeys: [String]?
+    let signatureDatabase: [String]?
+    let forbiddenSignatures: [String]?
+    let includeMicrosoftKeys: Bool?
+}
+
+struct UpdateSecureBootKeySetRequest: Content {
+    let name: String?
+    let description: String?
+    let platformKey: String?
+    let keyExchangeKeys: [String]?
+    let signatureDatabase: [String]?
+    let forbiddenSignatures: [String]?
+    let includeMicrosoftKeys: Bool?
+}
+
+/// One enrolled entry: a certificate, identified by the SHA-256 of its DER
+/// bytes, or a forbidden binary's SHA-256.
+struct SecureBootKeyEntrySummary: Content, Equatable {
+    let kind: String
+    let sha256: String
+}
+
+struct SecureBootKeySetResponse: Content {
+    let id: UUID?
+    let organizationId: UUID
+    let projectId: UUID?
+    let name: String
+    let description: String
+    let ownerGuid: String
+    let platformKey: String
+    let keyExchangeKeys: [String]
+    let signatureDatabase: [String]
+    let forbiddenSignatures: [String]
+    let includeMicrosoftKeys: Bool
+    let createdAt: Date?
+    let updatedAt: Date?
+
+    init(from keySet: SecureBootKeySet) {
+        self.id = keySet.id
+        self.organizationId = keySet.$organization.id
+        self.projectId = keySet.$project.id
+        self.name = keySet.name
+        self.description = keySet.description
+        self.ownerGuid = keySet.ownerGUID
+        self.platformKey = keySet.platformKey
+        self.keyExchangeKeys = keySet.keyExchangeKeys
+        self.signatureDatabase = keySet.signatureDatabase
+        self.forbiddenSignatures = keySet.forbiddenSignatures
+        self.includeMicrosoftKeys = keySet.includeMicrosoftKeys
+        self.createdAt = keySet.createdAt
+        self.updatedAt = keySet.updatedAt
+    }
+}
+
+/// A VM's enrolled db and dbx, returned by and accepted on
+/// `/api/vms/:vmID/secure-boot/keys`. PK and KEK are fixed at creation.
+struct VMSecureBootKeysResponse: Content {
+    let vmId: UUID
+    let keySetId: UUID?
+    let ownerGuid: String
+    let includeMicrosoftKeys: Bool
+    let signatureDatabase: [String]
+    let forbiddenSignatures: [String]
+    let signatureDatabaseSummary: [SecureBootKeyEntrySummary]
+    let forbiddenSignaturesSummary: [SecureBootKeyEntrySummary]
+}
+
+struct UpdateVMSecureBootKeysRequest: Content {
+    let signatureDatabase: [String]?
+    let forbiddenSignatures: [String]?
+}
@@ -83,6 +83,13 @@ final class Site: Model, Content, @unchecked Sendable {
     @Field(key: "labels")
     var labels: [String: String]
 
+    /// CPU model QEMU VMs placed here get when they don't name one (wire
+    /// v28), as a `GuestCPUModel` raw value — typically the baseline every
+    /// host in the site can run, so guests can move between them. Nil keeps
+    /// host passthrough.
+    @OptionalField(key: "default_cpu_model")
+    var defaultCPUModel: String?
+
     /// The agent that authors the site's shared OVN NB topology. Assigned
     /// explicitly by the operator (it is the node running ovn-central, a
     /// deployment-time fact the control plane cannot infer). While unset, no
@@ -119,6 +126,7 @@ final class Site: Model, Content, @unchecked Sendable {
         locationLabel: String? = nil,
         regionCode: String? = nil,
         labels: [String: String] = [:],
+        defaultCPUModel: String? = nil,
         networkControllerAgentID: UUID? = nil,
         organizationScope: OrganizationScope? = nil
     ) {
@@ -131,6 +139,7 @@ final class Site: Model, Content, @unchecked Sendable {
         self.locationLabel = locationLabel
         self.regionCode = regionCode
         self.labels = labels
+        self.defaultCPUModel = defaultCPUModel
         self.$networkControllerAgent.id = networkControllerAgentID
         self.$organization.id = organizationScope?.organizationID
         self.$organizationalUnit.id = organizationScope?.organizationalUnitID
@@ -196,6 +205,7 @@ struct SiteResponse: Content {
     let locationLabel: String?
     let regionCode: String?
     let labels: [String: String]
+    let defaultCpuModel: String?
     let networkControllerAgentId: UUID?
     let organizationId: UUID?
     let organizationalUnitId: UUID?
@@ -212,6 +222,7 @@ struct SiteResponse: Content {
         self.locationLabel = site.locationLabel
         self.regionCode = site.regionCode
         self.labels = site.labels
+        self.defaultCpuModel = site.defaultCPUModel
         self.networkControllerAgentId = site.$networkControllerAgent.id
         self.organizationId = site.$organization.id
         self.organizationalUnitId = site.$organizationalUnit.id
@@ -233,6 +244,8 @@ struct CreateSiteRequest: Content {
     let locationLabel: String?
     let regionCode: String?
     let labels: [String: String]?
+    /// `GuestCPUModel` raw value for QEMU VMs that don't name one.
+    let defaultCpuModel: String?
 
     init(
         name: String,
@@ -244,7 +257,8 @@ struct CreateSiteRequest: Content {
         longitude: Double? = nil,
         locationLabel: String? = nil,
         regionCode: String? = nil,
-        labels: [String: String]? = nil
+        labels: [String: String]? = nil,
+        defaultCpuModel: String? = nil
     ) {
         self.name = name
         self.description = description
@@ -256,12 +270,13 @@ struct CreateSiteRequest: Content {
         self.locationLabel = locationLabel
         self.regionCode = regionCode
         self.labels = labels
+        self.defaultCpuModel = defaultCpuModel
     }
 }
 
 /// Full-replace (PUT) semantics for descriptive fields: `description`,
-/// `networkControllerAgentId`, the location fields, and `labels` are all
-/// applied as given, so omitting one clears it (labels omitted → empty map).
+/// `networkControllerAgentId`, the location fields, `labels` and
+/// `defaultCpuModel` are all applied as given, so omitting one clears it (labels omitted → empty map).
 /// Avoids the absent-vs-null decoding ambiguity a PATCH would need.
 ///
 /// `status` is the deliberate exception: it has no natural "cleared" value and
@@ -277,6 +292,7 @@ struct UpdateSiteRequest: Content {
     let locationLabel: String?
     let regionCode: String?
     let labels: [String: String]?
+    let defaultCpuModel: String?
 
     init(
         description: String? = nil,
@@ -286,7 +302,8 @@ struct UpdateSiteRequest: Content {
         longitude: Double? = nil,
         locationLabel: String? = nil,
         regionCode: String? = nil,
-        labels: [String: String]? = nil
+        labels: [String: String]? = nil,
+        defaultCpuModel: String? = nil
     ) {
         self.description = description
         self.networkControllerAgentId = networkControllerAgentId
@@ -296,5 +313,6 @@ struct UpdateSiteRequest: Content {
         self.locationLabel = locationLabel
         self.regionCode = regionCode
         self.labels = labels
+        self.defaultCpuModel = defaultCpuModel
     }
 }
@@ -0,0 +1,124 @@
+import Crypto
+import Fluent
+import Foundation
+import NIOSSH
+import Vapor
+
+/// An SSH public key a user registered for the console gateway
+/// (`SSHConsoleGateway`). Presenting the key — signing the SSH
+/// authentication with its private half — authenticates as `user`.
+///
+/// A key identifies exactly one user, since the SSH username is the VM
+/// being connected to, not the account: `fingerprint` is unique across all
+/// users.
+final class UserSSHKey: Model, @unchecked Sendable {
+    static let schema = "user_ssh_keys"
+
+    @ID(key: .id)
+    var id: UUID?
+
+    @Parent(key: "user_id")
+    var user: User
+
+    @Field(key: "name")
+    var name: String
+
+    /// The key in OpenSSH `authorized_keys` form (`<type> <base64>`), comment
+    /// stripped.
+    @Field(key: "public_key")
+    var publicKey: String
+
+    /// `SHA256:<base64>` of the key blob, as `ssh-keygen -l` prints it.
+    @Field(key: "fingerprint")
+    var fingerprint: String
+
+    @OptionalField(key: "last_used_at")
+    var lastUsedAt: Date?
+
+    @OptionalField(key: "last_used_ip")
+    var lastUsedIP: String?
+
+    @Timestamp(key: "created_at", on: .create)
+    var createdAt: Date?
+
+    @Timestamp(key: "updated_at", on: .update)
+    var updatedAt: Date?
+
+    init() {}
+
+    init(id: UUID? = nil, userID: UUID, name: String, publicKey: String, fingerprint: String) {
+        self.id = id
+        self.$user.id = userID
+        self.name = name
+        self.publicKey = publicKey
+        self.fingerprint = fingerprint
+    }
+}
+
+extension UserSSHKey {
+    static let maxKeysPerUser = 20
+    static let maxNameLength = 100
+
+    /// Parses one `authorized_keys`-style line (`<type> <base64> [comment]`)
+    /// into the key, its normalized text and its fingerprint. Certificates are
+    /// rejected: they are presented at login, not registered.
+    static func parse(_ line: String) throws -> (key: NIOSSHPublicKey, normalized: String, fingerprint: String) {
+        let parts = line.split(whereSeparator: \.isWhitespace)
+        guard parts.count >= 2 else {
+            throw Abort(.badRequest, reason: "Public key must be in OpenSSH format: '<type> <base64> [comment]'")
+        }
+        let key: NIOSSHPublicKey
+        do {
+            key = try NIOSSHPublicKey(openSSHPublicKey: "\(parts[0]) \(parts[1])")
+        } catch {
+            throw Abort(
+                .badRequest,
+                reason: "Unsupported or malformed public key; use ssh-ed25519 or ecdsa-sha2-nistp256/384/521")
+        }
+        guard NIOSSHCertifiedPublicKey(key) == nil else {
+            throw Abort(.badRequest, reason: "Register the key itself, not a certificate for it")
+        }
+        let normalized = String(openSSHPublicKey: key)
+        return (key, normalized, try fingerprint(ofOpenSSHKey: normalized))
+    }
+
+    /// `SHA256:<unpadded base64>` of the key blob, matching `ssh-keygen -l`.
+    static func fingerprint(of key: NIOSSHPublicKey) -> String {
+        // A key NIOSSH produced always round-trips through its own encoding.
+        (try? fingerprint(ofOpenSSHKey: String(openSSHPublicKey: key))) ?? ""
+    }
+
+    private static func fingerprint(ofOpenSSHKey text: String) throws -> String {
+        let parts = text.split(separator: " ")
+        guard parts.count >= 2, let blob = Data(base64Encoded: String(parts[1])) else {
+            throw Abort(.badRequest, reason: "Malformed public key")
+        }
+        let digest = Data(SHA256.hash(data: blob)).base64EncodedString()
+        return "SHA256:" + digest.trimmingCharacters(in: CharacterSet(charactersIn: "="))
+    }
+}
+
+// MARK: - DTOs
+
+struct CreateSSHKeyRequest: Content {
+    let name: String
+    let publicKey: String
+}
+
+struct SSHKeyResponse: Content {
+    let id: UUID?
+    let name: String
+    let publicKey: String
+    let fingerprint: String
+    let createdAt: Date?
+    let lastUsedAt: Date?
+
+    init(from key: UserSSHKey) {
+        self.id = key.id
+        self.name = key.name
+        self.publicKey = key.publicKey
+        self.fingerprint = key.fingerprint
+        self.createdAt = key.createdAt
+        self.lastUsedAt = key.lastUsedAt
+    }
+}
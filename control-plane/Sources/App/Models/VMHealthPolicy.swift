@@ -0,0 +1,56 @@
+import Foundation
+import StratoShared
+import Vapor
+
+/// What the control plane does when a VM's health check turns it unhealthy.
+/// Every action also records the verdict and emits `vm.health_changed`.
+enum VMHealthAction: String, Codable, CaseIterable, Sendable {
+    /// Notify only.
+    case event
+    /// Reboot the guest, as `POST /api/vms/:vmID/restart` would.
+    case reboot
+    /// Recreate the VM from its image on the same agent: same id, spec and
+    /// addresses, a fresh boot disk. Volumes stay attached.
+    case replace
+}
+
+/// `PUT /api/vms/:vmID/health-check`. Omitted timings take the defaults
+/// below; `action` defaults to `event`.
+struct SetVMHealthCheckRequest: Content {
+    let kind: VMHealthCheckKind
+    let port: Int?
+    let path: String?
+    let command: [String]?
+    let intervalSeconds: Int?
+    let timeoutSeconds: Int?
+    let failureThreshold: Int?
+    let gracePeriodSeconds: Int?
+    let action: VMHealthAction?
+
+    static let defaultIntervalSeconds = 10
+    static let defaultTimeoutSeconds = 5
+    static let defaultFailureThreshold = 3
+    static let defaultGracePeriodSeconds = 300
+}
+
+struct VMHealthCheckResponse: Content {
+    let vmId: UUID
+    let kind: VMHealthCheckKind
+    let port: Int?
+    let path: String?
+    let command: [String]?
+    let intervalSeconds: Int
+    let timeoutSeconds: Int
+    let failureThreshold: Int
+    let gracePeriodSeconds: Int
+    let action: VMHealthAction
+    /// `healthy` or `unhealthy`; nil until the check first decides and while
+    /// the VM isn't running.
+    let status: String?
+    let consecutiveFailures: Int?
+    /// When the reported verdict last changed.
+    let checkedAt: Date?
+    let message: String?
+    /// How many times a `replace` action has recreated the VM.
+    let replacementCount: Int64
+}
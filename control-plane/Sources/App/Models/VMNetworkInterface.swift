@@ -7,6 +7,10 @@ import Vapor
 final class VMNetworkInterface: Model, @unchecked Sendable {
     static let schema = "vm_network_interfaces"
 
+    /// NICs a VM may be created with: plenty for multi-homed appliances, and
+    /// well inside the PCI slots QEMU's default machine leaves free.
+    static let maxPerVM = 8
+
     @ID(key: .id)
     var id: UUID?
 
@@ -75,6 +79,47 @@ final class VMNetworkInterface: Model, @unchecked Sendable {
         let randomBytes = (0..<3).map { _ in String(format: "%02x", Int.random(in: 0...255)) }
         return "00:0c:29:\(randomBytes.joined(separator: ":"))"
     }
+
+    /// A caller-chosen MAC in the stored form (lowercase, colon-separated),
+    /// or nil when it isn't a unicast address: a multicast bit would make
+    /// the switch flood the NIC's traffic, and all-zero is no address.
+    static func normalizedMACAddress(_ mac: String) -> String? {
+        let octets = mac.trimmingCharacters(in: .whitespaces).lowercased()
+            .split(separator: ":", omittingEmptySubsequences: false)
+        guard octets.count == 6,
+            octets.allSatisfy({ $0.count == 2 && UInt8($0, radix: 16) != nil }),
+            let first = UInt8(octets[0], radix: 16), first & 0x01 == 0,
+            !octets.allSatisfy({ $0 == "00" })
+        else { return nil }
+        return octets.joined(separator: ":")
+    }
 }
 
 extension VMNetworkInterface: Content {}
+
+/// One NIC of a VM create request's `nics` list.
+struct CreateVMNICRequest: Content {
+    /// The network, by id or by name; both omitted means the default network.
+    let networkId: UUID?
+    let networkName: String?
+    /// Fixed addresses. Omitted ones are allocated as usual; a fixed address
+    /// must be free, or reserved by the VM's project.
+    let ipAddress: String?
+    let ipv6Address: String?
+    /// Omitted generates one.
+    let macAddress: String?
+    /// Omitted (or empty) means the project's default group.
+    let securityGroupIds: [UUID]?
+
+    init(
+        networkId: UUID? = nil, networkName: String? = nil, ipAddress: String? = nil,
+        ipv6Address: String? = nil, macAddress: String? = nil, securityGroupIds: [UUID]? = nil
+    ) {
+        self.networkId = networkId
+        self.networkName = networkName
+        self.ipAddress = ipAddress
+        self.ipv6Address = ipv6Address
+        self.macAddress = macAddress
+        self.securityGroupIds = securityGroupIds
+    }
+}
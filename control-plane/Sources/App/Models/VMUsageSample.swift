@@ -0,0 +1,69 @@
+import Fluent
+import Foundation
+import Vapor
+
+/// One hour of a VM's observed resource usage: the running aggregates of the
+/// samples `VMUsageRecorder` took from observed-state reports during that
+/// hour. Hourly rollups rather than raw samples keep four weeks of history at
+/// a few hundred rows per VM, which is what rightsizing reads.
+///
+/// CPU and memory keep separate sample counts: a guest without the balloon
+/// driver still reports CPU, and one polled only once so far has memory but
+/// no CPU difference yet.
+final class VMUsageSample: Model, @unchecked Sendable {
+    static let schema = "vm_usage_samples"
+
+    @ID(key: .id)
+    var id: UUID?
+
+    @Parent(key: "vm_id")
+    var vm: VM
+
+    /// The start of the hour this row aggregates.
+    @Field(key: "hour")
+    var hour: Date
+
+    @Field(key: "cpu_samples")
+    var cpuSamples: Int
+
+    /// Sum of the sampled vCPU utilizations (each 0...1), for the mean.
+    @Field(key: "cpu_utilization_sum")
+    var cpuUtilizationSum: Double
+
+    @Field(key: "cpu_utilization_peak")
+    var cpuUtilizationPeak: Double
+
+    @Field(key: "memory_samples")
+    var memorySamples: Int
+
+    /// Sum of the sampled guest memory in use (total minus available), for
+    /// the mean.
+    @Field(key: "memory_used_sum")
+    var memoryUsedSum: Int64
+
+    @Field(key: "memory_used_peak")
+    var memoryUsedPeak: Int64
+
+    init() {}
+
+    init(vmID: UUID, hour: Date) {
+        self.$vm.id = vmID
+        self.hour = hour
+        self.cpuSamples = 0
+        self.cpuUtilizationSum = 0
+        self.cpuUtilizationPeak = 0
+        self.memorySamples = 0
+        self.memoryUsedSum = 0
+        self.memoryUsedPeak = 0
+    }
+
+    /// Mean vCPU utilization over the hour; nil when no CPU sample landed.
+    var cpuUtilizationMean: Double? {
+        cpuSamples > 0 ? cpuUtilizationSum / Double(cpuSamples) : nil
+    }
+
+    /// Peak guest memory in use over the hour; nil when no memory sample landed.
+    var memoryUsedMax: Int64? {
+        memorySamples > 0 ? memoryUsedPeak : nil
+    }
+}
@@ -25,6 +25,7 @@ public enum VolumeStatus: String, Codable, CaseIterable, Sendable {
     case snapshotting = "snapshotting"  // Snapshot is being created
     case cloning = "cloning"  // Volume is being cloned
     case deleting = "deleting"  // Volume is being deleted
+    case migrating = "migrating"  // Volume data is moving to another agent or pool
     case error = "error"  // An error occurred
 }
 
@@ -74,6 +75,26 @@ final class Volume: Model, @unchecked Sendable {
     @OptionalParent(key: "pool_id")
     var pool: StoragePool?
 
+    // The admin-defined volume type the volume was created with (or retyped
+    // to); nil for untyped volumes in the default pool. Named apart from
+    // `volumeType`, the boot/data role.
+    @OptionalParent(key: "volume_type_id")
+    var typeDefinition: VolumeTypeDefinition?
+
+    // Whether several VMs may hold the volume at once. Each holder has a
+    // `VolumeAttachment` row; the single-attachment columns below mirror the
+    // oldest of them.
+    @Field(key: "multi_attach")
+    var multiAttach: Bool
+
+    @Children(for: \.$volume)
+    var attachments: [VolumeAttachment]
+
+    // Where the volume's bytes live. Eager-loaded when building VM specs, so
+    // a volume served over NBD from another agent is attached from there.
+    @Children(for: \.$volume)
+    var replicas: [VolumeReplica]
+
     // Where the attachment currently runs (set while attached to a VM).
     // Replaces hypervisor_id's "single owner" role.
     @OptionalField(key: "attached_agent_id")
@@ -87,7 +108,9 @@ final class Volume: Model, @unchecked Sendable {
     @OptionalField(key: "hypervisor_id")
     var hypervisorId: String?
 
-    // VM attachment (null when detached)
+    // VM attachment (null when detached). Mirrors the oldest
+    // `VolumeAttachment` row (`VolumeAttachment.syncVolume`); the rows are
+    // authoritative once a multi-attach volume has several holders.
     @OptionalParent(key: "vm_id")
     var vm: VM?
 
@@ -128,6 +151,8 @@ final class Volume: Model, @unchecked Sendable {
         status: VolumeStatus = .creating,
         createdByID: UUID,
         poolID: UUID? = nil,
+        volumeTypeID: UUID? = nil,
+        multiAttach: Bool = false,
         sourceImageID: UUID? = nil,
         sourceVolumeID: UUID? = nil
     ) {
@@ -141,6 +166,8 @@ final class Volume: Model, @unchecked Sendable {
         self.status = status
         self.$createdBy.id = createdByID
         self.$pool.id = poolID
+        self.$typeDefinition.id = volumeTypeID
+        self.multiAttach = multiAttach
         if let sourceImageID = sourceImageID {
             self.$sourceImage.id = sourceImageID
         }
@@ -167,6 +194,8 @@ extension Volume {
         let status: VolumeStatus
         let errorMessage: String?
         let poolId: UUID?
+        let volumeTypeId: UUID?
+        let multiAttach: Bool
         let attachedAgentId: String?
         let storagePath: String?
         let hypervisorId: String?
@@ -193,6 +222,8 @@ extension Volume {
             status: self.status,
             errorMessage: self.errorMessage,
             poolId: self.$pool.id,
+            volumeTypeId: self.$typeDefinition.id,
+            multiAttach: self.multiAttach,
             attachedAgentId: self.attachedAgentId,
             storagePath: self.storagePath,
             hypervisorId: self.hypervisorId,
@@ -215,8 +246,10 @@ extension Volume {
         return Double(size) / 1024.0 / 1024.0 / 1024.0
     }
 
+    /// Whether another VM may attach: a detached volume always, and a
+    /// multi-attach volume while it is attached to others too.
     var canAttach: Bool {
-        return status == .available
+        return status == .available || (multiAttach && status == .attached)
     }
 
     var canDetach: Bool {
@@ -241,9 +274,14 @@ extension Volume {
     /// otherwise strand a volume in one of those with no recovery but manual
     /// database surgery. `sweepStuckOperations()` also recovers these back to a
     /// resting state, but delete stays available as the immediate escape hatch.
+    ///
+    /// `.migrating` is the exception among the transitional states: the
+    /// migration holds copies on two agents (and, mid-mirror, a running
+    /// guest's block job), and deleting underneath it would orphan one of
+    /// them. The sweep recovers a migration abandoned by a crash.
     var canDelete: Bool {
         switch status {
-        case .attached:
+        case .attached, .migrating:
             return false
         case .available, .error, .deleting,
             .creating, .attaching, .detaching, .resizing, .snapshotting, .cloning:
@@ -262,6 +300,8 @@ struct CreateVolumeRequest: Content {
     let format: String?  // "qcow2" or "raw", defaults to qcow2
     let volumeType: String?  // "boot" or "data", defaults to data
     let sourceImageId: UUID?  // Create volume from image
+    var volumeTypeId: UUID? = nil  // Admin-defined volume type; defaults to the untyped default pool
+    var multiAttach: Bool? = nil  // Allow several VMs to attach at once; defaults to false
 }
 
 struct UpdateVolumeRequest: Content {
@@ -280,6 +320,10 @@ struct ResizeVolumeRequest: Content {
     let sizeGB: Int  // New size in GB (must be larger than current)
 }
 
+struct RetypeVolumeRequest: Content {
+    let volumeTypeId: UUID  // Target volume type
+}
+
 struct CloneVolumeRequest: Content {
     let name: String
     let description: String?
@@ -297,6 +341,8 @@ struct VolumeResponse: Content {
     let status: VolumeStatus
     let errorMessage: String?
     let poolId: UUID?
+    let volumeTypeId: UUID?
+    let multiAttach: Bool
     let attachedAgentId: String?
     let hypervisorId: String?
     let vmId: UUID?
@@ -320,6 +366,8 @@ struct VolumeResponse: Content {
         self.status = volume.status
         self.errorMessage = volume.errorMessage
         self.poolId = volume.$pool.id
+        self.volumeTypeId = volume.$typeDefinition.id
+        self.multiAttach = volume.multiAttach
         self.attachedAgentId = volume.attachedAgentId
         self.hypervisorId = volume.hypervisorId
         self.vmId = volume.$vm.id
@@ -0,0 +1,151 @@
+import Fluent
+import SQLKit
+import Foundation
+import Vapor
+
+/// Lifecycle of one VM's hold on a volume.
+public enum VolumeAttachmentStatus: String, Codable, CaseIterable, Sendable {
+    case attaching = "attaching"  // hot-plug sent, agent hasn't confirmed
+    case attached = "attached"  // plugged into the VM
+    case detaching = "detaching"  // hot-unplug sent, agent hasn't confirmed
+}
+
+/// One VM's attachment of a volume. An ordinary volume has at most one; a
+/// multi-attach volume (`Volume.multiAttach`) has one per VM holding it, each
+/// with its own device name, boot order, and read-only flag.
+///
+/// These rows are authoritative. `Volume`'s single-attachment columns
+/// (`vm_id`, `device_name`, `boot_order`, `attached_agent_id`) mirror the
+/// oldest row for readers that predate multi-attach — see `syncVolume`.
+/// Per-row status lets one VM attach or detach a shared volume while the
+/// volume itself stays `.attached` for everyone else.
+final class VolumeAttachment: Model, @unchecked Sendable {
+    static let schema = "volume_attachments"
+
+    @ID(key: .id)
+    var id: UUID?
+
+    @Parent(key: "volume_id")
+    var volume: Volume
+
+    @Parent(key: "vm_id")
+    var vm: VM
+
+    /// The agent the attaching VM runs on; nil until the VM is placed.
+    @OptionalField(key: "agent_id")
+    var agentId: String?
+
+    @Field(key: "device_name")
+    var deviceName: String
+
+    @OptionalField(key: "boot_order")
+    var bootOrder: Int?
+
+    @Field(key: "readonly")
+    var readonly: Bool
+
+    @Enum(key: "status")
+    var status: VolumeAttachmentStatus
+
+    @Timestamp(key: "created_at", on: .create)
+    var createdAt: Date?
+
+    @Timestamp(key: "updated_at", on: .update)
+    var updatedAt: Date?
+
+    init() {}
+
+    init(
+        id: UUID? = nil,
+        volumeID: UUID,
+        vmID: UUID,
+        agentId: String?,
+        deviceName: String,
+        bootOrder: Int? = nil,
+        readonly: Bool = false,
+        status: VolumeAttachmentStatus = .attaching
+    ) {
+        self.id = id
+        self.$volume.id = volumeID
+        self.$vm.id = vmID
+        self.agentId = agentId
+        self.deviceName = deviceName
+        self.bootOrder = bootOrder
+        self.readonly = readonly
+        self.status = status
+    }
+}
+
+extension VolumeAttachment {
+    /// Locks `volumeID`'s row until `db`'s transaction ends, so attaches and
+    /// detaches of one volume queue behind each other and each counts the
+    /// holders the one before it left.
+    static func lockVolume(_ volumeID: UUID, on db: Database) async throws {
+        if let sql = db as? SQLDatabase {
+            try await sql.raw("SELECT id FROM volumes WHERE id = \(bind: volumeID) FOR UPDATE").run()
+        }
+    }
+
+    /// Re-derives `volume`'s single-attachment columns and resting status
+    /// from its remaining attachment rows: the oldest row is mirrored and the
+    /// volume is `.attached`; with no rows the columns are cleared and the
+    /// volume is `.available`. Called after a row is removed, so a failed
+    /// attach and a completed detach both land on the same answer however
+    /// many VMs still hold the volume.
+    static func syncVolume(_ volume: Volume, on db: Database) async throws {
+        let remaining = try await VolumeAttachment.query(on: db)
+            .filter(\.$volume.$id == volume.requireID())
+            .sort(\.$createdAt)
+            .sort(\.$id)
+            .all()
+
+        if let primary = remaining.first {
+            volume.$vm.id = primary.$vm.id
+            volume.deviceName = primary.deviceName
+            volume.bootOrder = primary.bootOrder
+            volume.attachedAgentId = primary.agentId
+            volume.status = .attached
+        } else {
+            volume.$vm.id = nil
+            volume.deviceName = nil
+            volume.bootOrder = nil
+            volume.attachedAgentId = nil
+            volume.status = .available
+        }
+        try await volume.save(on: db)
+    }
+
+    /// The device names already taken on `vmID`, across every volume it holds.
+    static func deviceNames(onVM vmID: UUID, on db: Database) async throws -> [String] {
+        try await VolumeAttachment.query(on: db)
+            .filter(\.$vm.$id == vmID)
+            .all()
+            .map(\.deviceName)
+    }
+}
+
+// MARK: - Response DTO
+
+struct VolumeAttachmentResponse: Content {
+    let id: UUID
+    let volumeId: UUID
+    let vmId: UUID
+    let agentId: String?
+    let deviceName: String
+    let bootOrder: Int?
+    let readonly: Bool
+    let status: VolumeAttachmentStatus
+    let createdAt: Date?
+
+    init(from attachment: VolumeAttachment) throws {
+        self.id = try attachment.requireID()
+        self.volumeId = attachment.$volume.id
+        self.vmId = attachment.$vm.id
+        self.agentId = attachment.agentId
+        self.deviceName = attachment.deviceName
+        self.bootOrder = attachment.bootOrder
+        self.readonly = attachment.readonly
+        self.status = attachment.status
+        self.createdAt = attachment.createdAt
+    }
+}
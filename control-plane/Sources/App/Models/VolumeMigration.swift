@@ -0,0 +1,183 @@
+import Fluent
+import Foundation
+import Vapor
+
+/// How a volume migration moves the bytes.
+public enum VolumeMigrationMode: String, Codable, CaseIterable, Sendable {
+    case copy = "copy"  // detached: streamed through the control plane
+    case mirror = "mirror"  // attached: QEMU block mirror onto an NBD export
+}
+
+/// Lifecycle of one volume migration.
+public enum VolumeMigrationStatus: String, Codable, CaseIterable, Sendable {
+    case running = "running"  // copy or mirror in progress
+    case succeeded = "succeeded"  // replica records switched to the target
+    case failed = "failed"  // the volume stayed where it was (or went to `.error`)
+}
+
+/// One move of a volume's data to another agent or pool
+/// (`POST /api/volumes/:volumeId/migrate`). The volume itself sits in
+/// `.migrating` while a row here is `.running`; at most one is running per
+/// volume. Rows are kept after completion as the volume's migration history.
+final class VolumeMigration: Model, @unchecked Sendable {
+    static let schema = "volume_migrations"
+
+    @ID(key: .id)
+    var id: UUID?
+
+    @Parent(key: "volume_id")
+    var volume: Volume
+
+    @Enum(key: "mode")
+    var mode: VolumeMigrationMode
+
+    @Enum(key: "status")
+    var status: VolumeMigrationStatus
+
+    @Field(key: "source_agent_id")
+    var sourceAgentId: String
+
+    @Field(key: "target_agent_id")
+    var targetAgentId: String
+
+    // Pool and type the volume moves from/to. Plain columns rather than
+    // foreign keys: history outlives the pools and types it names.
+    @OptionalField(key: "source_pool_id")
+    var sourcePoolId: UUID?
+
+    @OptionalField(key: "target_pool_id")
+    var targetPoolId: UUID?
+
+    @OptionalField(key: "target_volume_type_id")
+    var targetVolumeTypeId: UUID?
+
+    // Integrity of the streamed copy, recorded by the data route as the
+    // source agent's upload lands (copy mode only).
+    @OptionalField(key: "size_bytes")
+    var sizeBytes: Int64?
+
+    @OptionalField(key: "sha256")
+    var sha256: String?
+
+    @OptionalField(key: "error_message")
+    var errorMessage: String?
+
+    @Parent(key: "created_by_id")
+    var createdBy: User
+
+    @Timestamp(key: "created_at", on: .create)
+    var createdAt: Date?
+
+    @Timestamp(key: "updated_at", on: .update)
+    var updatedAt: Date?
+
+    @OptionalField(key: "completed_at")
+    var completedAt: Date?
+
+    init() {}
+
+    init(
+        id: UUID? = nil,
+        volumeID: UUID,
+        mode: VolumeMigrationMode,
+        sourceAgentId: String,
+        targetAgentId: String,
+        sourcePoolId: UUID?,
+        targetPoolId: UUID?,
+        targetVolumeTypeId: UUID?,
+        createdByID: UUID,
+        status: VolumeMigrationStatus = .running
+    ) {
+        self.id = id
+        self.$volume.id = volumeID
+        self.mode = mode
+        self.status = status
+        self.sourceAgentId = sourceAgentId
+        self.targetAgentId = targetAgentId
+        self.sourcePoolId = sourcePoolId
+        self.targetPoolId = targetPoolId
+        self.targetVolumeTypeId = targetVolumeTypeId
+        self.$createdBy.id = createdByID
+    }
+}
+
+extension VolumeMigration: Content {}
+
+extension VolumeMigration {
+    /// Control-plane-relative path the source agent uploads the disk to and
+    /// the target agent downloads it from (agent mTLS; see
+    /// `AuthorizationMiddleware`).
+    static func dataTransferPath(volumeId: UUID, migrationId: UUID) -> String {
+        "/api/volumes/\(volumeId)/migrations/\(migrationId)/data"
+    }
+
+    /// Object-store key holding a copy migration's bytes in transit.
+    static func objectKey(volumeId: UUID, migrationId: UUID) -> String {
+        "volume-migrations/\(volumeId)/\(migrationId)"
+    }
+
+    /// Marks every running migration of a volume failed. Used when the
+    /// volume leaves `.migrating` by any path other than the migration's own
+    /// completion.
+    static func failRunning(volumeID: UUID, reason: String, on db: Database) async throws {
+        let running = try await VolumeMigration.query(on: db)
+            .filter(\.$volume.$id == volumeID)
+            .filter(\.$status == .running)
+            .all()
+        for migration in running {
+            migration.status = .failed
+            migration.errorMessage = reason
+            migration.completedAt = Date()
+            try await migration.save(on: db)
+        }
+    }
+
+    /// 202 with the migration, for the endpoint that accepts it.
+    func acceptedResponse() throws -> Response {
+        let response = Response(status: .accepted)
+        try response.content.encode(VolumeMigrationResponse(from: self))
+        return response
+    }
+}
+
+// MARK: - Request/Response DTOs
+
+struct MigrateVolumeRequest: Content {
+    let targetAgentId: String?  // Agent to move to; picked from the target pool if omitted
+    let targetPoolId: UUID?  // Pool to move to; defaults to the volume type's, then the current pool
+    let volumeTypeId: UUID?  // Volume type to take on arrival; its pool must match `targetPoolId`
+}
+
+struct VolumeMigrationResponse: Content {
+    let id: UUID?
+    let volumeId: UUID
+    let mode: VolumeMigrationMode
+    let status: VolumeMigrationStatus
+    let sourceAgentId: String
+    let targetAgentId: String
+    let sourcePoolId: UUID?
+    let targetPoolId: UUID?
+    let targetVolumeTypeId: UUID?
+    let sizeBytes: Int64?
+    let errorMessage: String?
+    let createdById: UUID
+    let createdAt: Date?
+    let completedAt: Date?
+
+    init(from migration: VolumeMigration) {
+        self.id = migration.id
+        self.volumeId = migration.$volume.id
+        self.mode = migration.mode
+        self.status = migration.status
+        self.sourceAgentId = migration.sourceAgentId
+        self.targetAgentId = migration.targetAgentId
+        self.sourcePoolId = migration.sourcePoolId
+        self.targetPoolId = migration.targetPoolId
+        self.targetVolumeTypeId = migration.targetVolumeTypeId
+        self.sizeBytes = migration.sizeBytes
+        self.errorMessage = migration.errorMessage
+        self.createdById = migration.$createdBy.id
+        self.createdAt = migration.createdAt
+        self.completedAt = migration.completedAt
+    }
+}
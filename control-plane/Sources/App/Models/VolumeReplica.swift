@@ -1,5 +1,6 @@
 import Fluent
 import Foundation
+import StratoShared
 import Vapor
 
 /// Lifecycle of one physical copy of a volume.
@@ -37,6 +38,18 @@ final class VolumeReplica: Model, @unchecked Sendable {
     @Enum(key: "state")
     var state: VolumeReplicaState
 
+    /// Where the agent serves this copy over NBD, when it does: set by an
+    /// attached-volume migration whose VM stayed on its original host. All
+    /// three are set together or not at all.
+    @OptionalField(key: "nbd_host")
+    var nbdHost: String?
+
+    @OptionalField(key: "nbd_port")
+    var nbdPort: Int?
+
+    @OptionalField(key: "nbd_export_name")
+    var nbdExportName: String?
+
     /// Monotonic counter for reconciliation ordering, mirroring
     /// `DesiredVMState.generation` (see ReconciliationProtocol.swift).
     @Field(key: "generation")
@@ -68,3 +81,18 @@ final class VolumeReplica: Model, @unchecked Sendable {
 }
 
 extension VolumeReplica: Content {}
+
+extension VolumeReplica {
+    /// The NBD endpoint serving this copy, if it is exported.
+    var nbdEndpoint: NBDExportEndpoint? {
+        get {
+            guard let nbdHost, let nbdPort, let nbdExportName else { return nil }
+            return NBDExportEndpoint(host: nbdHost, port: nbdPort, exportName: nbdExportName)
+        }
+        set {
+            nbdHost = newValue?.host
+            nbdPort = newValue?.port
+            nbdExportName = newValue?.exportName
+        }
+    }
+}
@@ -0,0 +1,195 @@
+import Fluent
+import Foundation
+import StratoShared
+import Vapor
+
+/// An admin-defined class of storage users pick when creating a volume — the
+/// user-facing handle on a `StoragePool`. A type bundles where the data lives
+/// (its pool), how it is laid out (default format, replica count), how fast
+/// it may go (QoS defaults), and whether it must sit on encrypted media.
+///
+/// Named `…Definition` because `VolumeType` is already the boot/data role
+/// enum on `Volume`; the API calls these "volume types" (`/api/volume-types`).
+/// Types are platform catalog, like pools: every authenticated user may list
+/// them, only system admins define them. See `docs/architecture/storage.md`.
+final class VolumeTypeDefinition: Model, @unchecked Sendable {
+    static let schema = "volume_types"
+
+    @ID(key: .id)
+    var id: UUID?
+
+    /// Unique operator-facing name (e.g. `standard`, `fast-replicated`).
+    @Field(key: "name")
+    var name: String
+
+    @Field(key: "description")
+    var description: String
+
+    /// The pool every volume of this type is placed in.
+    @Parent(key: "pool_id")
+    var pool: StoragePool
+
+    /// Format used when a create request names none.
+    @Enum(key: "default_format")
+    var defaultFormat: VolumeFormat
+
+    /// Replicas per volume. Must be 1 for a `local` pool and between 2 and
+    /// the pool's own factor for a `replicated` one.
+    @Field(key: "replication_factor")
+    var replicationFactor: Int
+
+    /// Combined read+write IOPS ceiling applied when a volume is attached;
+    /// nil is unlimited.
+    @OptionalField(key: "max_iops")
+    var maxIOPS: Int?
+
+    /// Combined read+write throughput ceiling in bytes per second; nil is
+    /// unlimited.
+    @OptionalField(key: "max_bytes_per_second")
+    var maxBytesPerSecond: Int64?
+
+    /// Whether volumes of this type may only live on agents that advertise
+    /// encrypted volume storage (`StorageCapability.encryptedVolumeStorage`).
+    @Field(key: "requires_encryption")
+    var requiresEncryption: Bool
+
+    @Timestamp(key: "created_at", on: .create)
+    var createdAt: Date?
+
+    @Timestamp(key: "updated_at", on: .update)
+    var updatedAt: Date?
+
+    init() {}
+
+    init(
+        id: UUID? = nil,
+        name: String,
+        description: String = "",
+        poolID: UUID,
+        defaultFormat: VolumeFormat = .qcow2,
+        replicationFactor: Int = 1,
+        maxIOPS: Int? = nil,
+        maxBytesPerSecond: Int64? = nil,
+        requiresEncryption: Bool = false
+    ) {
+        self.id = id
+        self.name = name
+        self.description = description
+        self.$pool.id = poolID
+        self.defaultFormat = defaultFormat
+        self.replicationFactor = replicationFactor
+        self.maxIOPS = maxIOPS
+        self.maxBytesPerSecond = maxBytesPerSecond
+        self.requiresEncryption = requiresEncryption
+    }
+
+    /// The I/O limits the agent applies, or nil when the type sets none.
+    var qos: VolumeQoS? {
+        let qos = VolumeQoS(maxIOPS: maxIOPS, maxBytesPerSecond: maxBytesPerSecond)
+        return qos.isLimited ? qos : nil
+    }
+}
+
+extension VolumeTypeDefinition {
+    /// Validates a type's replication and QoS settings against its pool,
+    /// returning the reason it is invalid, or nil. Pure so the rules are
+    /// testable without a database.
+    static func validationFailure(
+        pool: StoragePool,
+        replicationFactor: Int,
+        maxIOPS: Int?,
+        maxBytesPerSecond: Int64?
+    ) -> String? {
+        switch pool.mode {
+        case .local:
+            guard replicationFactor == 1 else {
+                return "Pool '\(pool.name)' is local; 'replicationFactor' must be 1"
+            }
+        case .replicated:
+            guard replicationFactor >= 2, replicationFactor <= pool.replicationFactor else {
+                return
+                    "Pool '\(pool.name)' replicates up to \(pool.replicationFactor) copies; "
+                    + "'replicationFactor' must be between 2 and \(pool.replicationFactor)"
+            }
+        }
+        if let maxIOPS, maxIOPS <= 0 {
+            return "'maxIOPS' must be positive"
+        }
+        if let maxBytesPerSecond, maxBytesPerSecond <= 0 {
+            return "'maxBytesPerSecond' must be positive"
+        }
+        return nil
+    }
+
+    /// Whether an agent may hold data for a volume of this type: a member of
+    /// the type's pool (an empty member list admits every agent) that also
+    /// advertises encrypted storage when the type requires it.
+    static func agentQualifies(
+        agentId: String,
+        capabilities: [String],
+        pool: StoragePool?,
+        requiresEncryption: Bool
+    ) -> Bool {
+        if let pool, !pool.memberAgentIds.isEmpty, !pool.memberAgentIds.contains(agentId) {
+            return false
+        }
+        return !requiresEncryption || capabilities.contains(StorageCapability.encryptedVolumeStorage)
+    }
+}
+
+extension VolumeTypeDefinition: Content {}
+
+// MARK: - Request/Response DTOs
+
+struct CreateVolumeTypeRequest: Content {
+    let name: String
+    let description: String?
+    /// Backing pool; defaults to the seeded default pool.
+    let poolId: UUID?
+    /// "qcow2" or "raw"; defaults to qcow2.
+    let defaultFormat: String?
+    /// Defaults to 1 (local pools) — required explicitly for replicated pools.
+    let replicationFactor: Int?
+    let maxIOPS: Int?
+    let maxBytesPerSecond: Int64?
+    let requiresEncryption: Bool?
+}
+
+/// Full-replace (PUT) semantics for the mutable fields, matching
+/// `UpdateFloatingIPPoolRequest`. The pool, replica count, and encryption
+/// requirement are immutable: existing volumes of the type were placed by
+/// them, and moving a volume to different placement is what retype is for.
+struct UpdateVolumeTypeRequest: Content {
+    let description: String?
+    let defaultFormat: String?
+    let maxIOPS: Int?
+    let maxBytesPerSecond: Int64?
+}
+
+struct VolumeTypeResponse: Content {
+    let id: UUID
+    let name: String
+    let description: String
+    let poolId: UUID
+    let defaultFormat: VolumeFormat
+    let replicationFactor: Int
+    let maxIOPS: Int?
+    let maxBytesPerSecond: Int64?
+    let requiresEncryption: Bool
+    let createdAt: Date?
+    let updatedAt: Date?
+
+    init(from volumeType: VolumeTypeDefinition) throws {
+        self.id = try volumeType.requireID()
+        self.name = volumeType.name
+        self.description = volumeType.description
+        self.poolId = volumeType.$pool.id
+        self.defaultFormat = volumeType.defaultFormat
+        self.replicationFactor = volumeType.replicationFactor
+        self.maxIOPS = volumeType.maxIOPS
+        self.maxBytesPerSecond = volumeType.maxBytesPerSecond
+        self.requiresEncryption = volumeType.requiresEncryption
+        self.createdAt = volumeType.createdAt
+        self.updatedAt = volumeType.updatedAt
+    }
+}
@@ -0,0 +1,106 @@
+import Fluent
+import Foundation
+import Vapor
+
+/// A project's allowance of one volume type — how many volumes of the type it
+/// may hold and how many bytes they may total. Separate from `ResourceQuota`,
+/// which governs compute (and VM boot disks) across the org hierarchy: a
+/// volume type is typically scarce or premium storage an operator wants to
+/// ration per project, independently of everything else. A project with no
+/// row for a type is unlimited for that type.
+final class VolumeTypeQuota: Model, @unchecked Sendable {
+    static let schema = "volume_type_quotas"
+
+    @ID(key: .id)
+    var id: UUID?
+
+    @Parent(key: "volume_type_id")
+    var volumeType: VolumeTypeDefinition
+
+    @Parent(key: "project_id")
+    var project: Project
+
+    /// Maximum number of volumes of this type; nil is unlimited.
+    @OptionalField(key: "max_volumes")
+    var maxVolumes: Int?
+
+    /// Maximum total provisioned size of this type's volumes, in bytes; nil
+    /// is unlimited.
+    @OptionalField(key: "max_storage_bytes")
+    var maxStorageBytes: Int64?
+
+    @Timestamp(key: "created_at", on: .create)
+    var createdAt: Date?
+
+    @Timestamp(key: "updated_at", on: .update)
+    var updatedAt: Date?
+
+    init() {}
+
+    init(
+        id: UUID? = nil,
+        volumeTypeID: UUID,
+        projectID: UUID,
+        maxVolumes: Int? = nil,
+        maxStorageBytes: Int64? = nil
+    ) {
+        self.id = id
+        self.$volumeType.id = volumeTypeID
+        self.$project.id = projectID
+        self.maxVolumes = maxVolumes
+        self.maxStorageBytes = maxStorageBytes
+    }
+}
+
+extension VolumeTypeQuota {
+    /// Admission check for adding `addingBytes` (and, when `addingVolume`, one
+    /// more volume) to a project's current usage of the type. Returns the
+    /// reason the quota would be exceeded, or nil. Pure so the arithmetic is
+    /// testable without a database.
+    func exceededReason(
+        currentVolumes: Int,
+        currentBytes: Int64,
+        addingVolume: Bool,
+        addingBytes: Int64
+    ) -> String? {
+        if addingVolume, let maxVolumes, currentVolumes + 1 > maxVolumes {
+            return "\(currentVolumes) of \(maxVolumes) volumes already in use"
+        }
+        if let maxStorageBytes {
+            let (total, overflow) = currentBytes.addingReportingOverflow(addingBytes)
+            if overflow || total > maxStorageBytes {
+                return
+                    "\(VolumeResponse.formatSize(currentBytes)) of "
+                    + "\(VolumeResponse.formatSize(maxStorageBytes)) in use; "
+                    + "\(VolumeResponse.formatSize(addingBytes)) more would exceed it"
+            }
+        }
+        return nil
+    }
+}
+
+// MARK: - Request/Response DTOs
+
+/// Full-replace (PUT) of a project's allowance for a type; nil clears a limit.
+struct SetVolumeTypeQuotaRequest: Content {
+    let maxVolumes: Int?
+    let maxStorageGB: Int?
+}
+
+struct VolumeTypeQuotaResponse: Content {
+    let volumeTypeId: UUID
+    let projectId: UUID
+    let maxVolumes: Int?
+    let maxStorageBytes: Int64?
+    let usedVolumes: Int
+    let usedStorageBytes: Int64
+
+    init(from quota: VolumeTypeQuota, usedVolumes: Int, usedStorageBytes: Int64) {
+        self.volumeTypeId = quota.$volumeType.id
+        self.projectId = quota.$project.id
+        self.maxVolumes = quota.maxVolumes
+        self.maxStorageBytes = quota.maxStorageBytes
+        self.usedVolumes = usedVolumes
+        self.usedStorageBytes = usedStorageBytes
+    }
+}
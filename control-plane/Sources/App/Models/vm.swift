@@ -1,3 +1,4 @@
+import Crypto
 import Fluent
 import Vapor
 import StratoShared
@@ -78,6 +79,11 @@ final class VM: Model, @unchecked Sendable {
     @OptionalField(key: "guest_memory_balloon_actual_bytes")
     var guestMemoryBalloonActualBytes: Int64?
 
+    // When `VMUsageRecorder` last folded a report into this VM's usage
+    // history (`vm_usage_samples`); throttles sampling to its own cadence.
+    @OptionalField(key: "usage_sampled_at")
+    var usageSampledAt: Date?
+
     /// Operator-requested memory ceiling for the running guest, in bytes
     /// (issue #567 phase 2). Nil — the default — means no ballooning: the
     /// guest keeps its whole `memory` grant. Setting it inflates the VM's
@@ -87,6 +93,13 @@ final class VM: Model, @unchecked Sendable {
     @OptionalField(key: "balloon_target")
     var balloonTarget: Int64?
 
+    /// The least memory the hosting agent's pressure reclaim may leave the
+    /// guest, in bytes. Nil takes the agent policy's default fraction of
+    /// `memory`. Unlike `balloonTarget` this reclaims nothing by itself: it
+    /// only bounds what the agent takes back when its host runs short.
+    @OptionalField(key: "memory_floor")
+    var memoryFloor: Int64?
+
     @Enum(key: "hypervisor_type")
     var hypervisorType: HypervisorType
 
@@ -97,14 +110,31 @@ final class VM: Model, @unchecked Sendable {
     @Field(key: "environment")
     var environment: String
 
+    /// Free-form labels, set through the API or by automation rules' `tag`
+    /// actions. Nil on VMs that were never tagged.
+    @OptionalField(key: "tags")
+    var tags: [String: String]?
+
     // Optional reference to the Image used to create this VM (new image system)
     @OptionalParent(key: "image_id")
     var sourceImage: Image?
 
-    // Volumes attached to this VM (QEMU only - requires eager loading with .with(\.$volumes))
+    /// The image build this VM was created to run, if any. The build owns
+    /// it and deletes it when the build ends.
+    @OptionalParent(key: "image_build_id")
+    var imageBuild: ImageBuild?
+
+    // Volumes attached to this VM (QEMU only - requires eager loading with .with(\.$volumes)).
+    // Mirrors only the primary holder of each volume; a multi-attach volume
+    // held by several VMs shows up under one. Use volumeAttachments for the
+    // VM's full set.
     @Children(for: \.$vm)
     var volumes: [Volume]
 
+    // This VM's volume attachments (requires eager loading with .with(\.$volumeAttachments))
+    @Children(for: \.$vm)
+    var volumeAttachments: [VolumeAttachment]
+
     // Network interfaces attached to this VM (requires eager loading with .with(\.$networkInterfaces))
     @Children(for: \.$vm)
     var networkInterfaces: [VMNetworkInterface]
@@ -176,6 +206,59 @@ final class VM: Model, @unchecked Sendable {
     @Field(key: "tpm_enabled")
     var tpmEnabled: Bool
 
+    /// The key the agent encrypts this VM's TPM state with (wire v32): 32
+    /// bytes hex-encoded, always stored through `secretsEncryption`. Minted
+    /// when the VM is created and never changed after — state encrypted with
+    /// it is unreadable without it. Never part of an API response.
+    @OptionalField(key: "tpm_state_key")
+    var tpmStateKey: String?
+
+    /// Guest CPU model (wire v28), a `GuestCPUModel` raw value:
+    /// `host-passthrough`, `host-model` or a named QEMU baseline. Nil on a
+    /// QEMU VM means its site's default, pinned here at placement; a VM that
+    /// is still nil after placement gets passthrough, the pre-v28 behavior.
+    @OptionalField(key: "cpu_model")
+    var cpuModel: String?
+
+    /// Custom Secure Boot keys (wire v29), copied from `secureBootKeySet` at
+    /// creation so edits to the set never change what this guest trusts. Its
+    /// db/dbx are edited here while the VM is stopped. Nil boots with the
+    /// firmware template's keys.
+    @OptionalField(key: "secure_boot_keys")
+    var secureBootKeys: SecureBootKeys?
+
+    @OptionalParent(key: "secure_boot_key_set_id")
+    var secureBootKeySet: SecureBootKeySet?
+
+    /// Application health check (wire v31) the hosting agent runs while the
+    /// VM is running, and what the control plane does when it fails
+    /// (`healthAction`, a `VMHealthAction` raw value). Nil checks nothing.
+    @OptionalField(key: "health_check")
+    var healthCheck: VMHealthCheck?
+
+    @OptionalField(key: "health_action")
+    var healthAction: String?
+
+    // Observed health from the agent's reports: nil until the check first
+    // decides, and cleared whenever the VM stops running.
+    @OptionalField(key: "health_status")
+    var healthStatus: String?
+
+    @OptionalField(key: "health_consecutive_failures")
+    var healthConsecutiveFailures: Int?
+
+    @OptionalField(key: "health_checked_at")
+    var healthCheckedAt: Date?
+
+    @OptionalField(key: "health_message")
+    var healthMessage: String?
+
+    /// How many times the VM has been recreated from its image by a `replace`
+    /// health action. Carried on the desired state; the agent recreates the
+    /// VM when it sees a count above the one it last realized.
+    @Field(key: "replacement_count")
+    var replacementCount: Int64
+
     // Console configuration
     @Enum(key: "console_mode")
     var consoleMode: ConsoleMode
@@ -235,6 +318,7 @@ final class VM: Model, @unchecked Sendable {
         self.desiredStatus = .shutdown
         self.generation = 0
         self.observedGeneration = 0
+        self.replacementCount = 0
         self.hypervisorType = hypervisorType
         self.hugepages = hugepages
         self.sharedMemory = sharedMemory
@@ -248,6 +332,16 @@ final class VM: Model, @unchecked Sendable {
 
 extension VM: Content {}
 
+extension VM {
+    /// A fresh TPM state key: 32 random bytes, hex-encoded for swtpm's
+    /// `--key format=hex`.
+    static func generateTPMStateKey() -> String {
+        SymmetricKey(size: .bits256).withUnsafeBytes { bytes in
+            bytes.map { String(format: "%02x", $0) }.joined()
+        }
+    }
+}
+
 // MARK: - Computed Properties
 
 extension VM {
@@ -265,6 +359,29 @@ extension VM {
         return status == .running || status == .paused
     }
 
+    static let maxTags = 50
+    static let maxTagValueLength = 255
+
+    /// Keys are 1-63 characters of letters, digits, `.`, `_`, `-` and `/`;
+    /// values are free text up to `maxTagValueLength`.
+    static func validateTags(_ tags: [String: String]) throws {
+        guard tags.count <= maxTags else {
+            throw Abort(.badRequest, reason: "A VM may have at most \(maxTags) tags")
+        }
+        let allowed = CharacterSet(charactersIn: "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789._-/")
+        for (key, value) in tags {
+            guard (1...63).contains(key.count), key.unicodeScalars.allSatisfy(allowed.contains) else {
+                throw Abort(
+                    .badRequest,
+                    reason: "Tag key '\(key)' must be 1-63 characters of letters, digits, '.', '_', '-' and '/'")
+            }
+            guard value.count <= maxTagValueLength else {
+                throw Abort(
+                    .badRequest, reason: "Tag '\(key)' has a value longer than \(maxTagValueLength) characters")
+            }
+        }
+    }
+
     /// Updates the VM status and stamps the change time for the reconciliation sweep.
     /// Does not persist — call `save(on:)` afterwards.
     func setStatus(_ newStatus: VMStatus, at date: Date = Date()) {
@@ -431,11 +548,24 @@ struct VMDetailResponse: Content {
     /// Boot and whether it has an emulated TPM 2.0.
     let secureBoot: Bool
     let tpmEnabled: Bool
+    /// Guest CPU model; nil is host passthrough.
+    let cpuModel: String?
+    /// The Secure Boot key set the VM was created from, and whether it
+    /// enrolls custom keys at all (see `/api/vms/:vmID/secure-boot/keys`).
+    let secureBootKeySetId: UUID?
+    let customSecureBootKeys: Bool
     /// Observed guest-agent view (issue #563). `qgaAvailable` is nil until the
     /// agent's slow poll first sees a responsive qga; `observedHostname` is the
     /// guest OS's own hostname when it reported one.
     let qgaAvailable: Bool?
     let observedHostname: String?
+    /// `healthy` or `unhealthy` from the VM's application health check; nil
+    /// without a check, before it first decides, and while the VM isn't
+    /// running (see `/api/vms/:vmID/health-check`).
+    let healthStatus: String?
+    let tags: [String: String]
+    /// The image build running in this VM, for build VMs.
+    let imageBuildId: UUID?
     /// Observed guest memory usage from the virtio-balloon device (issue
     /// #567), nil until a guest with the virtio_balloon driver reports.
     /// `guestMemoryUsedBytes` is derived (`total - available`) — the number
@@ -452,6 +582,9 @@ struct VMDetailResponse: Content {
     let balloonTarget: Int64?
     let balloonTargetFormatted: String?
     let guestMemoryBalloonActualBytes: Int64?
+    /// The floor pressure reclaim keeps the guest above; nil is the agent
+    /// policy's default.
+    let memoryFloor: Int64?
     let createdAt: Date?
     let updatedAt: Date?
 
@@ -478,8 +611,14 @@ struct VMDetailResponse: Content {
             .map(NetworkInterfaceResponse.init)
         self.secureBoot = vm.secureBoot
         self.tpmEnabled = vm.tpmEnabled
+        self.cpuModel = vm.cpuModel
+        self.secureBootKeySetId = vm.$secureBootKeySet.id
+        self.customSecureBootKeys = vm.secureBootKeys != nil
         self.qgaAvailable = vm.qgaAvailable
         self.observedHostname = vm.observedHostname
+        self.healthStatus = vm.healthStatus
+        self.tags = vm.tags ?? [:]
+        self.imageBuildId = vm.$imageBuild.id
         self.guestMemoryTotalBytes = vm.guestMemoryTotalBytes
         self.guestMemoryAvailableBytes = vm.guestMemoryAvailableBytes
         if let total = vm.guestMemoryTotalBytes, let available = vm.guestMemoryAvailableBytes {
@@ -494,6 +633,7 @@ struct VMDetailResponse: Content {
         self.balloonTarget = vm.balloonTarget
         self.balloonTargetFormatted = vm.balloonTarget.map(VMDetailResponse.formatSize)
         self.guestMemoryBalloonActualBytes = vm.guestMemoryBalloonActualBytes
+        self.memoryFloor = vm.memoryFloor
         self.createdAt = vm.createdAt
         self.updatedAt = vm.updatedAt
     }
@@ -0,0 +1,148 @@
+import Foundation
+import Vapor
+
+/// A published version of the JSON API.
+///
+/// A caller names one in the path (`/api/v1/vms`) or, on an unversioned path,
+/// with the `Strato-API-Version` header; naming none gets
+/// ``APIVersion/unversioned``. Routes are registered once, unversioned, and
+/// handlers always work in the latest shapes: once a DTO's wire format
+/// changes, the change ships as a new version, the DTO conforms to
+/// ``VersionedContent`` and converts itself to the shape an older version
+/// published, and a changed request DTO decodes the older shape and upgrades
+/// it. A published shape never changes again — `APIContractTests` pins each
+/// version's.
+struct APIVersion: Comparable, Hashable, Sendable, CustomStringConvertible {
+    let number: Int
+    /// Since when the version is deprecated. Its responses carry
+    /// `Deprecation` (and `Sunset`), and its use is counted per client.
+    let deprecatedAt: Date?
+    /// The earliest the version may be removed.
+    let sunsetAt: Date?
+    /// What changed from the previous version.
+    let changes: [String]
+
+    init(number: Int, deprecatedAt: Date? = nil, sunsetAt: Date? = nil, changes: [String] = []) {
+        self.number = number
+        self.deprecatedAt = deprecatedAt
+        self.sunsetAt = sunsetAt
+        self.changes = changes
+    }
+
+    var isDeprecated: Bool { deprecatedAt != nil }
+
+    var description: String { "v\(number)" }
+
+    static func < (lhs: APIVersion, rhs: APIVersion) -> Bool { lhs.number < rhs.number }
+    static func == (lhs: APIVersion, rhs: APIVersion) -> Bool { lhs.number == rhs.number }
+    func hash(into hasher: inout Hasher) { hasher.combine(number) }
+}
+
+extension APIVersion {
+    static let headerName = "Strato-API-Version"
+
+    /// The API as it shipped when versioning was introduced.
+    static let v1 = APIVersion(number: 1)
+
+    /// Oldest first. A version is deprecated by giving it `deprecatedAt` and
+    /// `sunsetAt` once its successor ships, never on the day it does.
+    static let published: [APIVersion] = [.v1]
+
+    static var latest: APIVersion { published[published.count - 1] }
+
+    /// What a request that names no version gets: version 1, the contract
+    /// every integration written before versioning was built against.
+    static let unversioned = APIVersion.v1
+
+    static func published(_ number: Int) -> APIVersion? {
+        published.first { $0.number == number }
+    }
+}
+
+/// A response DTO whose wire shape changed between API versions. The
+/// conforming type is the latest shape; ``content(for:)`` converts it to the
+/// shape `version` published. Handlers return it wrapped in ``Versioned``.
+protocol VersionedContent: Content {
+    func content(for version: APIVersion) -> any AsyncResponseEncodable
+}
+
+/// Encodes a handler's result in the shape of the request's API version.
+struct Versioned<Body: VersionedContent>: AsyncResponseEncodable {
+    let body: Body
+
+    init(_ body: Body) {
+        self.body = body
+    }
+
+    func encodeResponse(for request: Request) async throws -> Response {
+        try await body.content(for: request.apiVersion).encodeResponse(for: request)
+    }
+}
+
+// MARK: - Application
+
+extension Application {
+    private struct APIVersionsKey: StorageKey {
+        typealias Value = [APIVersion]
+    }
+
+    /// The versions this application serves, oldest first:
+    /// ``APIVersion/published``, unless a test stands in its own — a second
+    /// version, or a deprecated first — to exercise conversion and the
+    /// deprecation headers before a real successor ships.
+    var apiVersions: [APIVersion] {
+        get { storage[APIVersionsKey.self] ?? APIVersion.published }
+        set { setStorageValue(APIVersionsKey.self, to: newValue) }
+    }
+}
+
+// MARK: - Request
+
+extension Request {
+    private struct APIVersionKey: StorageKey {
+        typealias Value = APIVersion
+    }
+
+    /// The API version the request resolved to (see `APIVersionMiddleware`).
+    var apiVersion: APIVersion {
+        get { storage[APIVersionKey.self] ?? .unversioned }
+        set { storage[APIVersionKey.self] = newValue }
+    }
+}
+
+// MARK: - Path versions
+
+/// Serves `/api/v<N>/…` as `/api/…`, remembering `N` for
+/// `APIVersionMiddleware` to resolve.
+///
+/// Routes are registered unversioned, so the version segment has to go before
+/// the router sees the path. That rules out middleware: Vapor matches the
+/// route first and only then runs the middleware chain, so this wraps the
+/// application's responder instead.
+struct APIVersionPathResponder: Responder {
+    let base: any Responder
+
+    struct PathVersionKey: StorageKey {
+        typealias Value = String
+    }
+
+    func respond(to request: Request) -> EventLoopFuture<Response> {
+        if let split = Self.splitVersion(from: request.url.path) {
+            request.storage[PathVersionKey.self] = split.version
+            request.url.path = split.path
+        }
+        return base.respond(to: request)
+    }
+
+    /// `/api/v1/vms` → (`1`, `/api/vms`); nil for a path without a version
+    /// segment.
+    static func splitVersion(from path: String) -> (version: String, path: String)? {
+        let prefix = "/api/v"
+        guard path.hasPrefix(prefix) else { return nil }
+        let rest = path.dropFirst(prefix.count)
+        let digits = rest.prefix { $0.isASCII && $0.isNumber }
+        let remainder = rest.dropFirst(digits.count)
+        guard !digits.isEmpty, remainder.isEmpty || remainder.hasPrefix("/") else { return nil }
+        return (String(digits), "/api" + remainder)
+    }
+}
@@ -0,0 +1,122 @@
+import Fluent
+import Foundation
+import NIOConcurrencyHelpers
+import SQLKit
+import Vapor
+
+/// Counts, per credential, the requests made in deprecated API versions, so
+/// operators can see who still has to move before a version's sunset
+/// (`GET /api/api-versions/usage`).
+///
+/// Requests are tallied in memory and written to `api_version_usage` at most
+/// once per ``writeInterval`` per credential and version — the first request
+/// immediately, the rest in arrears — so a client hammering an old version
+/// costs one upsert a minute, not one per call. Counts still in memory when
+/// the process stops are lost; the report is a guide to who to chase, not a
+/// bill.
+final class APIVersionUsageTracker: Sendable {
+    /// Who made a request: the API key when one was presented (a user's
+    /// scripts and integrations each have their own), otherwise the user.
+    struct Client: Hashable, Sendable {
+        enum Kind: String, Sendable {
+            case apiKey = "api_key"
+            case user
+        }
+
+        let kind: Kind
+        let id: UUID
+        let name: String
+
+        init(kind: Kind, id: UUID, name: String) {
+            self.kind = kind
+            self.id = id
+            self.name = name
+        }
+
+        /// Nil for an unauthenticated request.
+        init?(request: Request) {
+            if let apiKey = request.apiKey, let id = apiKey.id {
+                self.init(kind: .apiKey, id: id, name: apiKey.name)
+            } else if let user = request.auth.get(User.self), let id = user.id {
+                self.init(kind: .user, id: id, name: user.username)
+            } else {
+                return nil
+            }
+        }
+    }
+
+    static let writeInterval: TimeInterval = 60
+
+    private struct Key: Hashable {
+        let version: Int
+        let kind: Client.Kind
+        let id: UUID
+    }
+
+    private struct Tally {
+        var count = 0
+        var firstSeen: Date
+        var lastSeen: Date
+        var userAgent: String?
+        var lastWrite: Date?
+    }
+
+    private let tallies = NIOLockedValueBox<[Key: Tally]>([:])
+
+    func record(
+        version: APIVersion, client: Client, userAgent: String?, on app: Application, now: Date = Date()
+    ) {
+        let key = Key(version: version.number, kind: client.kind, id: client.id)
+        let due: Tally? = tallies.withLockedValue { tallies in
+            var tally = tallies[key] ?? Tally(firstSeen: now, lastSeen: now)
+            tally.count += 1
+            tally.lastSeen = now
+            tally.userAgent = userAgent ?? tally.userAgent
+            if let lastWrite = tally.lastWrite, now.timeIntervalSince(lastWrite) < Self.writeInterval {
+                tallies[key] = tally
+                return nil
+            }
+            tallies[key] = Tally(firstSeen: now, lastSeen: now, userAgent: tally.userAgent, lastWrite: now)
+            return tally
+        }
+        guard let due else { return }
+
+        app.backgroundTasks.spawn {
+            // `liveDB`: shutdown's drain may have cancelled us (see
+            // `Application.liveDB`).
+            guard let sql = app.liveDB as? SQLDatabase else { return }
+            do {
+                try await sql.raw(
+                    """
+                    INSERT INTO api_version_usage
+                        (id, api_version, client_type, client_id, client_name, user_agent,
+                         request_count, first_seen_at, last_seen_at)
+                    VALUES
+                        (\(bind: UUID()), \(bind: key.version), \(bind: key.kind.rawValue), \(bind: key.id),
+                         \(bind: client.name), \(bind: due.userAgent), \(bind: due.count), \(bind: due.firstSeen),
+                         \(bind: due.lastSeen))
+                    ON CONFLICT (api_version, client_type, client_id) DO UPDATE SET
+                        client_name = EXCLUDED.client_name,
+                        user_agent = COALESCE(EXCLUDED.user_agent, api_version_usage.user_agent),
+                        request_count = api_version_usage.request_count + EXCLUDED.request_count,
+                        last_seen_at = GREATEST(api_version_usage.last_seen_at, EXCLUDED.last_seen_at)
+                    """
+                ).run()
+            } catch {
+                app.logger.warning(
+                    "Failed to record API version usage",
+                    metadata: ["version": .stringConvertible(key.version), "error": .string("\(error)")])
+            }
+        }
+    }
+}
+
+extension Application {
+    private struct APIVersionUsageTrackerKey: StorageKey, LockKey {
+        typealias Value = APIVersionUsageTracker
+    }
+
+    var apiVersionUsage: APIVersionUsageTracker {
+        lazyService(APIVersionUsageTrackerKey.self) { APIVersionUsageTracker() }
+    }
+}
@@ -0,0 +1,289 @@
+import AsyncHTTPClient
+import Fluent
+import Foundation
+import NIOCore
+import StratoShared
+import Vapor
+
+/// How an admission review reaches a webhook. A protocol so tests can answer
+/// without a listening endpoint.
+protocol AdmissionTransport: Sendable {
+    /// POSTs `body` to `url` and returns the status and (bounded) response
+    /// body. Throws when nothing usable came back in time.
+    func post(_ body: Data, to url: String, headers: HTTPHeaders, timeoutSeconds: Int) async throws
+        -> (status: Int, body: Data)
+}
+
+/// Sends reviews through `SSRFGuard.execute`: the URL is re-validated and the
+/// connection pinned on every call, since DNS may have changed since the
+/// webhook was registered.
+struct HTTPAdmissionTransport: AdmissionTransport {
+    /// Verdicts are a few hundred bytes; a patch rewriting a whole create
+    /// body is still far below this.
+    static let maxResponseBytes = 256 * 1024
+
+    let app: Application
+
+    func post(_ body: Data, to url: String, headers: HTTPHeaders, timeoutSeconds: Int) async throws
+        -> (status: Int, body: Data)
+    {
+        guard let parsed = URL(string: url) else {
+            throw SSRFGuard.BlockedHostError(reason: "Admission webhook URL is not a valid URL")
+        }
+        var request = HTTPClientRequest(url: url)
+        request.method = .POST
+        request.headers = headers
+        request.body = .bytes(ByteBuffer(data: body))
+        let response = try await SSRFGuard.execute(
+            request, url: parsed, timeout: .seconds(Int64(timeoutSeconds)),
+            maxResponseBytes: Self.maxResponseBytes, app: app)
+        return (Int(response.status.code), Data(buffer: response.body))
+    }
+}
+
+/// Runs an organization's external admission webhooks (`AdmissionWebhook`)
+/// over a proposed create or operation.
+///
+/// Webhooks run in `position` order, and each sees the object as patched by
+/// the ones before it. The first deny ends the review with a 403. A webhook
+/// that gives no usable answer fails the review with a 503 under the `fail`
+/// policy and is skipped under `ignore`. Every call — whatever came of it —
+/// is an `admission.review` audit event.
+///
+/// Admission runs after authorization and before anything is written, so a
+/// denied request leaves no trace but its audit events; a patched create
+/// still passes every validation and permission check the handler makes
+/// afterwards, so a webhook can't patch a request into something its caller
+/// couldn't ask for.
+struct AdmissionService {
+    /// What is being admitted, for the review body and the audit trail.
+    struct Subject: Sendable {
+        let organizationID: UUID
+        let projectID: UUID?
+        let resourceKind: AdmissionResourceKind
+        /// Nil for a create.
+        let resourceID: UUID?
+        let resourceName: String?
+        /// `create`, or the `VMOperationKind` raw value.
+        let operation: String
+        let userID: UUID
+        let username: String?
+        var apiKeyID: UUID? = nil
+        var sourceIP: String? = nil
+    }
+
+    /// Why a webhook's answer couldn't be used.
+    struct WebhookError: Error, CustomStringConvertible {
+        let description: String
+    }
+
+    let app: Application
+
+    /// Reviews `object` (nil for operations on an existing resource) with
+    /// every matching webhook. Returns the object as patched, or nil when no
+    /// webhook patched it; throws when a webhook denies or fails closed.
+    func review(_ subject: Subject, object: CodableValue?) async throws -> CodableValue? {
+        let webhooks = try await AdmissionWebhook.query(on: app.db)
+            .filter(\.$organization.$id == subject.organizationID)
+            .filter(\.$isActive == true)
+            .sort(\.$position)
+            .sort(\.$name)
+            .all()
+            .filter { $0.matches(resourceKind: subject.resourceKind, operation: subject.operation) }
+        guard !webhooks.isEmpty else { return nil }
+
+        var current = object
+        var patched = false
+        for webhook in webhooks {
+            let started = Date()
+            var metadata = [
+                "webhookId": webhook.id?.uuidString ?? "",
+                "webhookName": webhook.name,
+                "failurePolicy": webhook.failurePolicy,
+            ]
+            do {
+                let verdict = try await call(webhook, subject: subject, object: current)
+                metadata["durationMs"] = Self.milliseconds(since: started)
+                if let reason = verdict.reason { metadata["reason"] = reason }
+                guard verdict.allowed else {
+                    metadata["decision"] = "denied"
+                    await audit(subject, metadata: metadata)
+                    let suffix = verdict.reason.map { ": \($0)" } ?? ""
+                    throw Abort(.forbidden, reason: "Denied by admission webhook '\(webhook.name)'\(suffix)")
+                }
+                if let patch = verdict.patch {
+                    if let target = current {
+                        current = Self.mergePatch(target, patch)
+                        patched = true
+                        metadata["decision"] = "patched"
+                    } else {
+                        // Operations carry no object to patch.
+                        metadata["decision"] = "allowed"
+                        metadata["patchIgnored"] = "true"
+                    }
+                } else {
+                    metadata["decision"] = "allowed"
+                }
+                await audit(subject, metadata: metadata)
+            } catch let error as WebhookError {
+                metadata["durationMs"] = Self.milliseconds(since: started)
+                metadata["decision"] = "error"
+                metadata["reason"] = error.description
+                await audit(subject, metadata: metadata)
+                app.logger.warning(
+                    "Admission webhook failed",
+                    metadata: [
+                        "webhookId": .string(webhook.id?.uuidString ?? ""),
+                        "error": .string(error.description),
+                    ])
+                if webhook.failurePolicyValue == .fail {
+                    throw Abort(
+                        .serviceUnavailable,
+                        reason: "Admission webhook '\(webhook.name)' could not be reached: \(error.description)")
+                }
+            }
+        }
+        return patched ? current : nil
+    }
+
+    /// One webhook's verdict. Every failure to get one is a `WebhookError`.
+    private func call(
+        _ webhook: AdmissionWebhook, subject: Subject, object: CodableValue?
+    ) async throws -> AdmissionReviewResponse {
+        let review = AdmissionReview(
+            uid: UUID(),
+            organizationId: subject.organizationID,
+            projectId: subject.projectID,
+            operation: subject.operation,
+            resource: .init(kind: subject.resourceKind.rawValue, id: subject.resourceID, name: subject.resourceName),
+            user: .init(id: subject.userID, username: subject.username),
+            object: object)
+        let body: Data
+        let secret: String
+        do {
+            body = try JSONEncoder().encode(review)
+            secret = try app.secretsEncryption.decrypt(webhook.signingSecret)
+        } catch {
+            throw WebhookError(description: "Could not prepare the review: \(error)")
+        }
+
+        let timestamp = Int(Date().timeIntervalSince1970)
+        let signature = WebhookDeliveryService.signature(
+            payload: String(decoding: body, as: UTF8.self), timestamp: timestamp, secret: secret)
+        var headers = HTTPHeaders()
+        headers.add(name: "Content-Type", value: "application/json")
+        headers.add(name: "User-Agent", value: "Strato-Admission/1.0")
+        headers.add(name: "X-Strato-Signature", value: "t=\(timestamp),v1=\(signature)")
+        headers.add(name: "X-Strato-Admission-Uid", value: review.uid.uuidString)
+
+        let timeout = min(max(webhook.timeoutSeconds, 1), AdmissionWebhook.maxTimeoutSeconds)
+        let response: (status: Int, body: Data)
+        do {
+            response = try await app.admissionTransport.post(
+                body, to: webhook.url, headers: headers, timeoutSeconds: timeout)
+        } catch {
+            throw WebhookError(description: "\(error)")
+        }
+        guard (200..<300).contains(response.status) else {
+            throw WebhookError(description: "Webhook answered \(response.status)")
+        }
+        guard let verdict = try? JSONDecoder().decode(AdmissionReviewResponse.self, from: response.body) else {
+            throw WebhookError(description: "Webhook response is not an admission review response")
+        }
+        guard verdict.uid == review.uid else {
+            throw WebhookError(description: "Webhook response answers a different review")
+        }
+        return verdict
+    }
+
+    private func audit(_ subject: Subject, metadata: [String: String]) async {
+        await app.audit.record(
+            AuditRecord(
+                eventType: AuditEventType.admissionReview.rawValue,
+                userID: subject.userID == ResourceOperation.systemUserID ? nil : subject.userID,
+                username: subject.username,
+                apiKeyID: subject.apiKeyID,
+                organizationID: subject.organizationID,
+                resourceType: subject.resourceKind.rawValue,
+                resourceID: subject.resourceID?.uuidString,
+                action: subject.operation,
+                sourceIP: subject.sourceIP,
+                metadata: metadata
+            ))
+    }
+
+    private static func milliseconds(since start: Date) -> String {
+        String(Int(Date().timeIntervalSince(start) * 1000))
+    }
+
+    /// Applies a JSON merge patch (RFC 7386): object members merge
+    /// recursively, `null` removes a member, anything else replaces.
+    static func mergePatch(_ target: CodableValue, _ patch: CodableValue) -> CodableValue {
+        guard case .object(let members) = patch else { return patch }
+        var result: [String: CodableValue] = [:]
+        if case .object(let existing) = target { result = existing }
+        for (key, value) in members {
+            if case .null = value {
+                result[key] = nil
+            } else {
+                result[key] = mergePatch(result[key] ?? .null, value)
+            }
+        }
+        return .object(result)
+    }
+}
+
+extension Application {
+    private struct AdmissionTransportKey: StorageKey {
+        typealias Value = any AdmissionTransport
+    }
+
+    /// Tests replace this; everything else posts over HTTP.
+    var admissionTransport: any AdmissionTransport {
+        get { storage[AdmissionTransportKey.self] ?? HTTPAdmissionTransport(app: self) }
+        set { setStorageValue(AdmissionTransportKey.self, to: newValue) }
+    }
+
+    var admission: AdmissionService {
+        AdmissionService(app: self)
+    }
+}
+
+extension Request {
+    /// Runs a create's decoded body past the organization's admission
+    /// webhooks, returning it as they patched it. Called once the caller is
+    /// known to be allowed to create in `projectID`, the target project
+    /// resolved from the body as decoded (`authorizeCreateProject`), and
+    /// before any other check, so every check the handler makes applies to
+    /// the patched body — including the project one, should a webhook move
+    /// the create elsewhere.
+    ///
+    /// The organization is the caller's current one: a create may only
+    /// target a project in it. A caller without one can't create anything,
+    /// so there is nothing to review.
+    func admitCreate<T: Codable>(
+        _ proposed: T, resourceKind: AdmissionResourceKind, resourceName: String?, projectID: UUID, user: User
+    ) async throws -> T {
+        guard let organizationID = user.currentOrganizationId else { return proposed }
+        let object = try JSONDecoder().decode(CodableValue.self, from: JSONEncoder().encode(proposed))
+        let subject = AdmissionService.Subject(
+            organizationID: organizationID,
+            projectID: projectID,
+            resourceKind: resourceKind,
+            resourceID: nil,
+            resourceName: resourceName,
+            operation: AdmissionWebhook.createOperation,
+            userID: try user.requireID(),
+            username: user.username,
+            apiKeyID: apiKey?.id,
+            sourceIP: auditClientIP)
+        guard let patched = try await application.admission.review(subject, object: object) else {
+            return proposed
+        }
+        do {
+            return try JSONDecoder().decode(T.self, from: JSONEncoder().encode(patched))
+        } catch {
+            throw Abort(.unprocessableEntity, reason: "Admission webhooks patched the request into an invalid one")
+        }
+    }
+}
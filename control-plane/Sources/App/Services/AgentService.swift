@@ -1115,6 +1115,26 @@ actor AgentService {
                     // rather than error it. The orphaned snapshot/clone-target
                     // row is a `.creating` volume/snapshot resolved on its own.
                     resolved = volume.$vm.id != nil ? .attached : .available
+                case .migrating where volume.$vm.id == nil:
+                    // A detached volume's copy never touches the source, and
+                    // the replica records switch in the same transaction that
+                    // leaves `.migrating` — so a volume still here is whole
+                    // where it was. Any partial copy on the target is left
+                    // for the target's agent to overwrite on the next attempt.
+                    resolved = .available
+                    try await VolumeMigration.failRunning(
+                        volumeID: volumeID,
+                        reason: "Migration abandoned; recovered by the stuck-operation sweep", on: db)
+                case .migrating:
+                    // Mid-mirror the guest may already have pivoted onto the
+                    // destination's export; which copy it writes is unknown.
+                    resolved = .error
+                    volume.errorMessage =
+                        "Volume migration did not complete and the guest may be on either copy; "
+                        + "recovered by the stuck-operation sweep after \(Int(budget))s"
+                    try await VolumeMigration.failRunning(
+                        volumeID: volumeID,
+                        reason: "Migration abandoned; recovered by the stuck-operation sweep", on: db)
                 default:
                     // creating/attaching/detaching/resizing: the agent-side
                     // outcome is unknown, so `.error` is the honest, recoverable
@@ -1139,6 +1159,35 @@ actor AgentService {
                         "budgetSeconds": .string("\(Int(budget))"),
                     ])
             }
+
+            // A VM attaching or detaching a multi-attach volume others still
+            // hold moves only its attachment row; the volume stays `.attached`
+            // and the backstop above never sees it. Rows stuck mid-transition
+            // settle as `.attached` for the same reason volumes aren't
+            // returned to `.available`: the agent may have connected the disk,
+            // and a held row is what lets the caller detach it again.
+            let attachmentBudget = stuckVolumeBudgetSeconds(for: .attaching)
+            let stuckAttachments = try await VolumeAttachment.query(on: db)
+                .filter(\.$status ~~ [.attaching, .detaching])
+                .filterAged(
+                    before: now.addingTimeInterval(-attachmentBudget), by: \.$updatedAt,
+                    fallingBackTo: \.$createdAt)
+                .with(\.$volume)
+                .all()
+            for attachment in stuckAttachments where attachment.volume.status == .attached {
+                let previous = attachment.status
+                attachment.status = .attached
+                try await attachment.save(on: db)
+
+                app.logger.warning(
+                    "Volume attachment stuck in transitional state past budget; recovered",
+                    metadata: [
+                        "volumeId": .string(attachment.$volume.id.uuidString),
+                        "vmId": .string(attachment.$vm.id.uuidString),
+                        "stuckStatus": .string(previous.rawValue),
+                        "budgetSeconds": .string("\(Int(attachmentBudget))"),
+                    ])
+            }
         } catch {
             app.logger.error("Stuck-operation sweep failed: \(error)")
         }
@@ -1146,10 +1195,11 @@ actor AgentService {
 
     /// The volume statuses the stuck-volume backstop watches. Kept in one
     /// place because `AddHotPathIndexes` indexes exactly this set (a partial
-    /// index on `volumes.status`) — widening the list means widening that
+    /// index on `volumes.status`, widened for `.migrating` by
+    /// `AddMigratingVolumeStatus`) — widening the list means widening that
     /// index too, or the sweep falls back to a sequential scan.
     static let transitionalVolumeStatuses: [VolumeStatus] = [
-        .creating, .attaching, .detaching, .resizing, .snapshotting, .cloning,
+        .creating, .attaching, .detaching, .resizing, .snapshotting, .cloning, .migrating,
     ]
 
     /// How long a volume may sit in a given transitional status before the
@@ -1173,6 +1223,10 @@ actor AgentService {
         case .attaching, .detaching, .resizing:
             // VolumeService.defaultTimeout is 30s.
             return 180
+        case .migrating:
+            // VolumeService.migrationTimeout is 22200s, and a copy migration
+            // makes two such RPCs back to back (export, then import).
+            return 45_300
         case .available, .attached, .deleting, .error:
             // Not transitional (or, for `.deleting`, deliberately left to the
             // retryable-delete path); never queried by the sweep above.
@@ -1198,11 +1252,13 @@ actor AgentService {
 
     /// Why the expiry sweep is deleting a sandbox. Both reasons end in the
     /// same deletion; they differ only in what started the clock.
-    private enum SandboxExpiryReason {
+    enum SandboxExpiryReason {
         /// The lifetime budget ran out (`ttl_seconds` from `createdAt`).
         case ttl(seconds: Int)
         /// A terminal sandbox outlived the retention window for its record.
         case retention(hours: Int)
+        /// A code session's sandbox, torn down by the code-session sweep.
+        case codeSession(String)
 
         var description: String {
             switch self {
@@ -1210,6 +1266,8 @@ actor AgentService {
                 return "TTL of \(seconds)s elapsed"
             case .retention(let hours):
                 return "terminal record retained for \(hours)h"
+            case .codeSession(let why):
+                return "code session \(why)"
             }
         }
     }
@@ -1290,8 +1348,9 @@ actor AgentService {
     /// once a report confirms absence) or — with no agent to converge on — a
     /// direct record delete. Sharing the path is the point: quota release,
     /// reservation release, and operation accounting all come for free, and
-    /// the operation row makes the unattended deletion auditable.
-    private func expireSandbox(_ sandbox: Sandbox, reason: SandboxExpiryReason, on db: Database) async {
+    /// the operation row makes the unattended deletion auditable. Internal
+    /// because the code-session sweep tears sessions down the same way.
+    func expireSandbox(_ sandbox: Sandbox, reason: SandboxExpiryReason, on db: Database) async {
         guard let sandboxID = sandbox.id else { return }
 
         var onlineAgentID: String?
@@ -1473,7 +1532,7 @@ actor AgentService {
             // Eligibility mirrors the imperative endpoint's checks, minus the
             // Firecracker guard — that precondition is evaluated live on the
             // agent, which is the only side that actually knows.
-            let next = enrolled.first { agent in
+            let candidates = enrolled.filter { agent in
                 agent.updateDesiredVersion == nil
                     && AgentVersionTarget.updateAvailable(agentVersion: agent.version, target: target)
                     && agent.isOnline
@@ -1481,6 +1540,31 @@ actor AgentService {
                     && agent.hostOperatingSystem != nil
                     && agent.cpuArchitecture != nil
             }
+
+            // An agent hosting VMs of projects with maintenance windows
+            // waits for all of them (announcing the update to each on first
+            // sight); the rollout moves on to the next agent meanwhile
+            // rather than stalling the fleet behind one project's calendar.
+            try await MaintenanceWindows.pruneNotices(now: now, on: db)
+            var next: Agent?
+            for candidate in candidates {
+                let clearance = try await MaintenanceWindows.clearance(
+                    for: .agentUpdate,
+                    subject: "\(candidate.name)@\(canonicalTarget)",
+                    summary: "Agent \(candidate.name) is updated from \(candidate.version) to \(target)",
+                    on: candidate, now: now, db: db)
+                if clearance.isCleared {
+                    next = candidate
+                    break
+                }
+                app.logger.debug(
+                    "Agent auto-update waiting for maintenance windows",
+                    metadata: [
+                        "agentName": .string(candidate.name),
+                        "targetVersion": .string(target),
+                        "projects": .stringConvertible(clearance.waitingOn.count),
+                    ])
+            }
             guard let next, let nextId = next.id else { return }
 
             // Prove the release serves this agent's platform before assigning
@@ -1942,8 +2026,19 @@ actor AgentService {
         let vmId = vm.id?.uuidString ?? ""
 
         // A network pinned to a site exists only in that site's OVN
-        // deployment, so it pins the VM's placement (issue #343).
-        let requiredSiteID = try await pinnedSiteID(for: vm, on: db)
+        // deployment, so it pins the VM's placement (issue #343); an
+        // IPv6-only network needs an agent that can realize it.
+        let (requiredSiteID, ipv6OnlyNetworks) = try await networkPlacement(for: vm, on: db)
+
+        // Volumes attached at create confine the VM to agents that can reach
+        // their data.
+        let bootVolumes = try await attachedVolumes(of: vm, on: db)
+        let storageAgentIDs = try await storagePlacement(
+            for: bootVolumes, among: schedulableAgents, on: db)
+
+        // A project keeping maintenance windows would rather not start on a
+        // host that is mid-update.
+        let maintenanceWindows = try await Project.find(vm.$project.id, on: db)?.maintenancePolicy != nil
 
         // Use scheduler to select the best agent and atomically reserve the
         // VM's resources on it, so a concurrent create can't place against
@@ -1952,7 +2047,9 @@ actor AgentService {
         do {
             agentId = try await app.scheduler.selectAndReserveAgent(
                 requirements: SchedulerService.placementRequirements(
-                    for: vm, architecture: image?.architecture, siteID: requiredSiteID),
+                    for: vm, architecture: image?.architecture, siteID: requiredSiteID,
+                    ipv6OnlyNetworks: ipv6OnlyNetworks, storageAgentIDs: storageAgentIDs,
+                    maintenanceWindows: maintenanceWindows),
                 vmId: vmId,
                 from: schedulableAgents,
                 coordination: app.coordination,
@@ -1972,7 +2069,25 @@ actor AgentService {
             // the agent's desired state and every path (nudge now, periodic
             // timer later, reconnect sync) will carry it.
             vm.hypervisorId = agentId
+            // A QEMU VM without a CPU model takes its site's default now, so
+            // the guest keeps the same CPU if the site's default later moves.
+            if vm.cpuModel == nil, vm.hypervisorType == .qemu,
+                let siteDefault = schedulableAgents.first(where: { $0.id == agentId })?.siteDefaultCPUModel
+            {
+                vm.cpuModel = siteDefault.rawValue
+            }
             try await vm.save(on: db)
+            let vmAttachments = try await VolumeAttachment.query(on: db)
+                .filter(\.$vm.$id == vm.requireID())
+                .all()
+            for attachment in vmAttachments {
+                attachment.agentId = agentId
+                try await attachment.save(on: db)
+            }
+            for volume in bootVolumes where volume.$vm.id == vm.id {
+                volume.attachedAgentId = agentId
+                try await volume.save(on: db)
+            }
 
             app.logger.info(
                 "VM creation dispatched via desired-state sync",
@@ -2137,14 +2252,15 @@ actor AgentService {
     /// networks: attaching a site-pinned network confines the VM to that
     /// site's agents. NICs are persisted before placement runs, so the rows
     /// are authoritative here. Networks pinned to different sites cannot
-    /// coexist on one VM — no host is in both sites.
-    private func pinnedSiteID(for vm: VM, on db: Database) async throws -> UUID? {
-        guard let vmID = vm.id else { return nil }
+    /// coexist on one VM — no host is in both sites. Also whether any of
+    /// those networks is IPv6-only.
+    private func networkPlacement(for vm: VM, on db: Database) async throws -> (siteID: UUID?, ipv6Only: Bool) {
+        guard let vmID = vm.id else { return (nil, false) }
         let nics = try await VMNetworkInterface.query(on: db)
             .filter(\.$vm.$id == vmID)
             .all()
         let names = Set(nics.map(\.network))
-        guard !names.isEmpty else { return nil }
+        guard !names.isEmpty else { return (nil, false) }
 
         let networks = try await LogicalNetwork.query(on: db)
             .filter(\.$name ~~ names)
@@ -2154,7 +2270,71 @@ actor AgentService {
             throw AgentServiceError.schedulingFailed(
                 "VM attaches networks pinned to different sites; no host can satisfy both")
         }
-        return siteIDs.first
+        return (siteIDs.first, networks.contains(where: \.isIPv6Only))
+    }
+
+    /// Volumes attached to a VM — including multi-attach volumes whose
+    /// primary holder is another VM — with their types and pools loaded.
+    private func attachedVolumes(of vm: VM, on db: Database) async throws -> [Volume] {
+        guard let vmID = vm.id else { return [] }
+        let volumeIDs = try await VolumeAttachment.query(on: db)
+            .filter(\.$vm.$id == vmID)
+            .all()
+            .map { $0.$volume.id }
+        guard !volumeIDs.isEmpty else { return [] }
+        return try await Volume.query(on: db)
+            .filter(\.$id ~~ volumeIDs)
+            .with(\.$pool)
+            .with(\.$typeDefinition)
+            .all()
+    }
+
+    /// The agents able to serve every one of `volumes`, or nil when none of
+    /// them constrains placement. A local-pool volume is reachable only from
+    /// the agents holding its replicas; a replicated-pool volume from any of
+    /// the pool's members (`StoragePool.agentCanReach`). A volume whose type
+    /// sets I/O limits additionally needs a v21+ agent to enforce them, and a
+    /// multi-attach volume a v22+ agent to open it shared.
+    private func storagePlacement(
+        for volumes: [Volume],
+        among agents: [SchedulableAgent],
+        on db: Database
+    ) async throws -> Set<String>? {
+        guard !volumes.isEmpty else { return nil }
+        let volumeIDs = volumes.compactMap(\.id)
+        let replicas = try await VolumeReplica.query(on: db)
+            .filter(\.$volume.$id ~~ volumeIDs)
+            .all()
+
+        var allowed = Set(agents.map(\.id))
+        var constrained = false
+        for volume in volumes {
+            var replicaAgentIds = replicas.filter { $0.$volume.id == volume.id }.map(\.agentId)
+            if replicaAgentIds.isEmpty, let legacyAgentId = volume.hypervisorId {
+                replicaAgentIds = [legacyAgentId]
+            }
+            let pool = volume.$pool.value ?? nil
+            let reachable = allowed.filter {
+                StoragePool.agentCanReach(agentId: $0, pool: pool, replicaAgentIds: replicaAgentIds)
+            }
+            if reachable.count != allowed.count { constrained = true }
+            allowed = reachable
+
+            if (volume.$typeDefinition.value ?? nil)?.qos != nil {
+                let qosCapable = Set(
+                    agents.filter { WireProtocol.supportsVolumeQoS($0.wireProtocolVersion ?? 0) }.map(\.id))
+                if !allowed.isSubset(of: qosCapable) { constrained = true }
+                allowed.formIntersection(qosCapable)
+            }
+
+            if volume.multiAttach {
+                let shareCapable = Set(
+                    agents.filter { WireProtocol.supportsSharedVolumes($0.wireProtocolVersion ?? 0) }.map(\.id))
+                if !allowed.isSubset(of: shareCapable) { constrained = true }
+                allowed.formIntersection(shareCapable)
+            }
+        }
+        return constrained ? allowed : nil
     }
 
     /// Dispatch a correlated VM command (reboot — an action, not a state, so
@@ -2213,7 +2393,24 @@ actor AgentService {
                     }
                 } ?? agents
 
-            return Self.schedulableAgents(from: present, runningVMCounts: runningVMCounts)
+            // Site CPU-model defaults, for the sites that have one.
+            let siteIDs = Set(present.compactMap { $0.$site.id })
+            let sites =
+                siteIDs.isEmpty
+                ? []
+                : try await Site.query(on: app.db)
+                    .filter(\.$id ~~ siteIDs)
+                    .filter(\.$defaultCPUModel != nil)
+                    .all()
+            let siteDefaultCPUModels = Dictionary(
+                uniqueKeysWithValues: sites.compactMap { site -> (UUID, GuestCPUModel)? in
+                    guard let id = site.id, let model = site.defaultCPUModel.flatMap(GuestCPUModel.init(rawValue:))
+                    else { return nil }
+                    return (id, model)
+                })
+
+            return Self.schedulableAgents(
+                from: present, runningVMCounts: runningVMCounts, siteDefaultCPUModels: siteDefaultCPUModels)
         } catch {
             app.logger.error("Failed to load schedulable agents from database: \(error)")
             return []
@@ -2247,17 +2444,19 @@ actor AgentService {
     /// `nonisolated static` so it can be unit-tested without the actor.
     nonisolated static func schedulableAgents(
         from agents: [Agent],
-        runningVMCounts: [String: Int]
+        runningVMCounts: [String: Int],
+        siteDefaultCPUModels: [UUID: GuestCPUModel] = [:]
     ) -> [SchedulableAgent] {
         return agents.compactMap { agent in
             guard let agentId = agent.id?.uuidString else { return nil }
+            let memory = overcommittedMemory(of: agent)
             return SchedulableAgent(
                 id: agentId,  // Database UUID (as String)
                 name: agent.name,  // Human-readable name
                 totalCPU: agent.totalCPU,
                 availableCPU: agent.availableCPU,
-                totalMemory: agent.totalMemory,
-                availableMemory: agent.availableMemory,
+                totalMemory: memory.total,
+                availableMemory: memory.available,
                 totalDisk: agent.totalDisk,
                 availableDisk: agent.availableDisk,
                 status: agent.status,
@@ -2277,11 +2476,39 @@ actor AgentService {
                 // machine profile reaches the agent at all.
                 supportsVTPM: agent.tpmCapable
                     && WireProtocol.supportsMachineProfile(agent.wireProtocolVersion ?? 0),
-                supportsMachineProfile: WireProtocol.supportsMachineProfile(agent.wireProtocolVersion ?? 0)
+                supportsMachineProfile: WireProtocol.supportsMachineProfile(agent.wireProtocolVersion ?? 0),
+                // Custom Secure Boot keys: the same two signals, with the
+                // enrollment tool advertised as a capability string.
+                supportsSecureBootKeys: agent.capabilities.contains(MachineCapability.secureBootKeyEnrollment)
+                    && WireProtocol.supportsSecureBootKeys(agent.wireProtocolVersion ?? 0),
+                // Image builds need nothing on the host beyond qga and
+                // qemu-img, which every QEMU agent already uses.
+                supportsImageBuilds: WireProtocol.supportsImageBuilds(agent.wireProtocolVersion ?? 0),
+                // A v28 agent honors the spec's CPU model; the models it can
+                // run ride its host info.
+                supportsCPUModels: WireProtocol.supportsCPUModels(agent.wireProtocolVersion ?? 0),
+                cpuModels: Set(agent.hostInfo?.supportedCPUModels ?? []),
+                siteDefaultCPUModel: agent.$site.id.flatMap { siteDefaultCPUModels[$0] },
+                // An assigned, unconverged update is the disruption in flight.
+                hasPendingMaintenance: agent.updateDesiredVersion != nil
             )
         }
     }
 
+    /// The memory an agent admits against: its physical memory scaled by its
+    /// effective overcommit ratio, less what is already committed there. At
+    /// ratio 1 this is exactly the agent's own report. Above it, the
+    /// committed figure must be the unclamped one — the report's
+    /// `availableMemory` bottoms out at zero once commitments pass the host's
+    /// size, which would hand the headroom out twice.
+    nonisolated static func overcommittedMemory(of agent: Agent) -> (total: Int64, available: Int64) {
+        let ratio = agent.effectiveMemoryOvercommitRatio
+        guard ratio > 1 else { return (agent.totalMemory, agent.availableMemory) }
+        let total = Int64(Double(agent.totalMemory) * ratio)
+        let committed = agent.committedMemory ?? (agent.totalMemory - agent.availableMemory)
+        return (total, max(0, total - committed))
+    }
+
     // MARK: - Message Sending
 
     /// Encode and push an envelope over a locally held socket.
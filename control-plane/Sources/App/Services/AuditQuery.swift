@@ -0,0 +1,541 @@
+import Fluent
+import Foundation
+import SQLKit
+
+/// The query language of the audit trail's `query` endpoints: a filter over
+/// `audit_events`, optionally followed by an aggregation, compiled to SQL so
+/// the database does the work and its indexes serve it.
+///
+///     actor.type == "service_account" and type startsWith "iam." and time > -24h
+///     status >= 400 or adminBypass == true | count by actor
+///
+/// A comparison names a field on the left and a literal on the right:
+/// strings (single or double quoted), integers, `true`, `false`, `null` and
+/// `[…]` lists for `in`. `time` takes a duration relative to now (`-30m`,
+/// `-24h`, `-7d`), `now`, or an ISO 8601 timestamp or date (UTC). Operators,
+/// loosest first: `or` (`||`), `and` (`&&`), `not` (`!`), then `==` `!=` `<`
+/// `<=` `>` `>=` `in` `startsWith` `contains`. String matches are
+/// case-sensitive. A missing value is `null`: it equals only `null`, differs
+/// from everything else, and fails every other comparison.
+///
+/// `| count` counts the matching events; `| count by <field>, …` counts them
+/// per distinct value (`actor` is short for `actor.type, actor.id,
+/// actor.name`). Everything — fields, literal types, which operators a field
+/// takes — is checked when the query is parsed, so a parsed query always
+/// compiles.
+struct AuditQuery: Sendable {
+    let source: String
+    private let filter: Node?
+    /// The fields a `count by` groups on, `actor` expanded; empty for a bare
+    /// `| count` and nil when the query lists events.
+    let groupBy: [Field]?
+
+    static let maxLength = 1000
+    static let maxDepth = 32
+
+    struct ParseError: Error, CustomStringConvertible {
+        let description: String
+    }
+
+    enum FieldKind: Sendable {
+        case string
+        case uuid
+        case integer
+        case boolean
+        case time
+    }
+
+    /// A field of the language and the SQL it reads.
+    struct Field: Sendable, Equatable {
+        /// As written in a query: `actor.type`, `metadata.ruleId`.
+        let name: String
+        let kind: FieldKind
+        /// The `audit_events` column; nil for a `metadata.<key>` value.
+        let column: String?
+
+        /// One value out of the event's metadata, a JSON object of strings
+        /// stored as text.
+        var metadataKey: String? {
+            column == nil ? String(name.dropFirst(Self.metadataPrefix.count)) : nil
+        }
+
+        static let metadataPrefix = "metadata."
+
+        /// The SQL reading the field.
+        var expression: SQLQueryString {
+            if let column { return "\(ident: column)" }
+            return "(metadata::jsonb ->> \(bind: metadataKey ?? ""))"
+        }
+    }
+
+    /// Every field but `metadata.<key>`, by name.
+    static let fields: [String: Field] = Dictionary(
+        uniqueKeysWithValues: [
+            Field(name: "time", kind: .time, column: "created_at"),
+            Field(name: "type", kind: .string, column: "event_type"),
+            Field(name: "actor.type", kind: .string, column: "actor_type"),
+            Field(name: "actor.id", kind: .uuid, column: "actor_id"),
+            Field(name: "actor.name", kind: .string, column: "username"),
+            Field(name: "apiKey", kind: .uuid, column: "api_key_id"),
+            Field(name: "org", kind: .uuid, column: "organization_id"),
+            Field(name: "method", kind: .string, column: "method"),
+            Field(name: "path", kind: .string, column: "path"),
+            Field(name: "status", kind: .integer, column: "status"),
+            Field(name: "resource.type", kind: .string, column: "resource_type"),
+            Field(name: "resource.id", kind: .string, column: "resource_id"),
+            Field(name: "action", kind: .string, column: "action"),
+            Field(name: "sourceIp", kind: .string, column: "source_ip"),
+            Field(name: "adminBypass", kind: .boolean, column: "admin_bypass"),
+        ].map { ($0.name, $0) })
+
+    /// What `count by actor` groups on.
+    static let actorFields = ["actor.type", "actor.id", "actor.name"]
+
+    fileprivate indirect enum Node: Sendable {
+        case not(Node)
+        case and(Node, Node)
+        case or(Node, Node)
+        case compare(Field, Comparison, Operand)
+    }
+
+    fileprivate enum Comparison: String, Sendable {
+        case equal = "=="
+        case notEqual = "!="
+        case less = "<"
+        case lessOrEqual = "<="
+        case greater = ">"
+        case greaterOrEqual = ">="
+        case isIn = "in"
+        case startsWith
+        case contains
+    }
+
+    fileprivate enum Operand: Sendable {
+        case null
+        case value(Value)
+        case list([Value])
+    }
+
+    fileprivate enum Value: Sendable {
+        case string(String)
+        case uuid(UUID)
+        case integer(Int)
+        case boolean(Bool)
+        case instant(Date)
+        /// Seconds from the moment the query runs.
+        case relative(TimeInterval)
+
+        func bindable(now: Date) -> any Encodable & Sendable {
+            switch self {
+            case .string(let value): return value
+            case .uuid(let value): return value
+            case .integer(let value): return value
+            case .boolean(let value): return value
+            case .instant(let value): return value
+            case .relative(let seconds): return now.addingTimeInterval(seconds)
+            }
+        }
+    }
+
+    init(_ source: String) throws {
+        guard source.count <= Self.maxLength else {
+            throw ParseError(description: "Query exceeds \(Self.maxLength) characters")
+        }
+        var parser = Parser(tokens: try Self.tokenize(source))
+        var filter: Node?
+        if !parser.atEnd && !parser.atPipe {
+            filter = try parser.parseExpression()
+        }
+        let groupBy = try parser.parseAggregation()
+        guard parser.atEnd else {
+            throw ParseError(description: "Unexpected \(parser.currentDescription)")
+        }
+        self.source = source
+        self.filter = filter
+        self.groupBy = groupBy
+    }
+
+    /// The filter as a predicate over `audit_events`, or nil when the query
+    /// has none. Relative times resolve against `now`, so a saved search for
+    /// `time > -24h` keeps meaning the last day.
+    func predicate(now: Date = Date()) -> SQLQueryString? {
+        filter.map { Self.sql($0, now: now) }
+    }
+
+    // MARK: - Compilation
+
+    /// Comparisons compile to bare column predicates, so they stay sargable.
+    /// SQL's `NULL` only matters under `NOT` — elsewhere a `WHERE` reads it as
+    /// false, as this language does — so that is where it is folded away.
+    private static func sql(_ node: Node, now: Date) -> SQLQueryString {
+        switch node {
+        case .not(let operand):
+            return "NOT COALESCE(\(sql(operand, now: now)), FALSE)"
+        case .and(let left, let right):
+            return "(\(sql(left, now: now)) AND \(sql(right, now: now)))"
+        case .or(let left, let right):
+            return "(\(sql(left, now: now)) OR \(sql(right, now: now)))"
+        case .compare(let field, let comparison, let operand):
+            return sql(field.expression, comparison, operand, now: now)
+        }
+    }
+
+    private static func sql(
+        _ column: SQLQueryString, _ comparison: Comparison, _ operand: Operand, now: Date
+    ) -> SQLQueryString {
+        switch operand {
+        case .null:
+            return comparison == .equal ? "\(column) IS NULL" : "\(column) IS NOT NULL"
+        case .list(let values):
+            guard !values.isEmpty else { return "FALSE" }
+            return "\(column) IN (\(binds: values.map { $0.bindable(now: now) }))"
+        case .value(let value):
+            let bound = value.bindable(now: now)
+            switch comparison {
+            case .equal: return "\(column) = \(bind: bound)"
+            // A missing value differs from every value.
+            case .notEqual: return "(\(column) <> \(bind: bound) OR \(column) IS NULL)"
+            case .less: return "\(column) < \(bind: bound)"
+            case .lessOrEqual: return "\(column) <= \(bind: bound)"
+            case .greater: return "\(column) > \(bind: bound)"
+            case .greaterOrEqual: return "\(column) >= \(bind: bound)"
+            case .startsWith, .contains:
+                guard case .string(let text) = value else { return "FALSE" }
+                let escaped = DatabaseQuery.Filter.escapeLikePattern(text)
+                let pattern = comparison == .startsWith ? "\(escaped)%" : "%\(escaped)%"
+                return "\(column) LIKE \(bind: pattern) ESCAPE '\\'"
+            case .isIn:
+                return "FALSE"
+            }
+        }
+    }
+
+    // MARK: - Lexing
+
+    fileprivate enum Token: Equatable {
+        case punctuator(String)
+        case name(String)
+        case string(String)
+        case integer(Int)
+        /// A number with a unit: `-24h`, `30m`. In seconds.
+        case duration(TimeInterval)
+
+        var description: String {
+            switch self {
+            case .punctuator(let text), .name(let text): return "'\(text)'"
+            case .string(let text): return "string \"\(text)\""
+            case .integer(let value): return "number \(value)"
+            case .duration(let seconds): return "duration \(Int(seconds))s"
+            }
+        }
+    }
+
+    private static let punctuators = [
+        "==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "(", ")", "[", "]", ",", ".", "|",
+    ]
+
+    private static let units: [Unicode.Scalar: TimeInterval] = [
+        "s": 1, "m": 60, "h": 3600, "d": 86_400, "w": 604_800,
+    ]
+
+    private static func tokenize(_ source: String) throws -> [Token] {
+        let scalars = Array(source.unicodeScalars)
+        var tokens: [Token] = []
+        var index = 0
+        func isNameStart(_ scalar: Unicode.Scalar) -> Bool {
+            scalar == "_" || ("a"..."z").contains(scalar) || ("A"..."Z").contains(scalar)
+        }
+        func isDigit(_ scalar: Unicode.Scalar) -> Bool { ("0"..."9").contains(scalar) }
+
+        while index < scalars.count {
+            let scalar = scalars[index]
+            if scalar == " " || scalar == "\t" || scalar == "\n" || scalar == "\r" {
+                index += 1
+            } else if scalar == "\"" || scalar == "'" {
+                var text = String.UnicodeScalarView()
+                index += 1
+                while true {
+                    guard index < scalars.count else {
+                        throw ParseError(description: "Unterminated string")
+                    }
+                    let next = scalars[index]
+                    index += 1
+                    if next == scalar { break }
+                    if next == "\\", index < scalars.count {
+                        text.append(scalars[index])
+                        index += 1
+                    } else {
+                        text.append(next)
+                    }
+                }
+                tokens.append(.string(String(text)))
+            } else if isDigit(scalar) || (scalar == "-" && index + 1 < scalars.count && isDigit(scalars[index + 1])) {
+                let start = index
+                index += 1
+                while index < scalars.count, isDigit(scalars[index]) { index += 1 }
+                let text = String(String.UnicodeScalarView(scalars[start..<index]))
+                guard let value = Int(text) else {
+                    throw ParseError(description: "Invalid number '\(text)'")
+                }
+                if index < scalars.count, let unit = units[scalars[index]],
+                    index + 1 == scalars.count || !(isNameStart(scalars[index + 1]) || isDigit(scalars[index + 1]))
+                {
+                    index += 1
+                    tokens.append(.duration(TimeInterval(value) * unit))
+                } else if index < scalars.count, isNameStart(scalars[index]) || scalars[index] == "." {
+                    throw ParseError(
+                        description: "Invalid number '\(text)\(scalars[index])'; durations end in s, m, h, d or w")
+                } else {
+                    tokens.append(.integer(value))
+                }
+            } else if isNameStart(scalar) {
+                let start = index
+                while index < scalars.count, isNameStart(scalars[index]) || isDigit(scalars[index]) { index += 1 }
+                tokens.append(.name(String(String.UnicodeScalarView(scalars[start..<index]))))
+            } else if let punctuator = punctuators.first(where: { candidate in
+                let candidateScalars = Array(candidate.unicodeScalars)
+                return index + candidateScalars.count <= scalars.count
+                    && Array(scalars[index..<index + candidateScalars.count]) == candidateScalars
+            }) {
+                tokens.append(.punctuator(punctuator))
+                index += punctuator.unicodeScalars.count
+            } else {
+                throw ParseError(description: "Unexpected character '\(scalar)'")
+            }
+        }
+        return tokens
+    }
+
+    // MARK: - Parsing
+
+    fileprivate struct Parser {
+        let tokens: [Token]
+        var position = 0
+        var depth = 0
+
+        init(tokens: [Token]) {
+            self.tokens = tokens
+        }
+
+        var atEnd: Bool { position >= tokens.count }
+
+        var atPipe: Bool { peek("|") }
+
+        var currentDescription: String {
+            atEnd ? "end of query" : tokens[position].description
+        }
+
+        private func peek(_ punctuator: String) -> Bool {
+            !atEnd && tokens[position] == .punctuator(punctuator)
+        }
+
+        private mutating func take(_ punctuator: String) -> Bool {
+            guard peek(punctuator) else { return false }
+            position += 1
+            return true
+        }
+
+        /// A keyword, or the punctuator spelling it: `and` or `&&`.
+        private mutating func take(keyword: String, or punctuator: String? = nil) -> Bool {
+            if !atEnd, tokens[position] == .name(keyword) {
+                position += 1
+                return true
+            }
+            return punctuator.map { take($0) } ?? false
+        }
+
+        private mutating func expect(_ punctuator: String) throws {
+            guard take(punctuator) else {
+                throw ParseError(description: "Expected '\(punctuator)' but found \(currentDescription)")
+            }
+        }
+
+        private mutating func descend() throws {
+            depth += 1
+            guard depth <= AuditQuery.maxDepth else {
+                throw ParseError(description: "Query is nested too deeply")
+            }
+        }
+
+        mutating func parseExpression() throws -> Node {
+            try descend()
+            defer { depth -= 1 }
+            var node = try parseAnd()
+            while take(keyword: "or", or: "||") { node = .or(node, try parseAnd()) }
+            return node
+        }
+
+        private mutating func parseAnd() throws -> Node {
+            var node = try parseNot()
+            while take(keyword: "and", or: "&&") { node = .and(node, try parseNot()) }
+            return node
+        }
+
+        private mutating func parseNot() throws -> Node {
+            if take(keyword: "not", or: "!") {
+                try descend()
+                defer { depth -= 1 }
+                return .not(try parseNot())
+            }
+            if take("(") {
+                let node = try parseExpression()
+                try expect(")")
+                return node
+            }
+            return try parseComparison()
+        }
+
+        private mutating func parseComparison() throws -> Node {
+            let field = try parseField()
+            let comparison: Comparison?
+            switch atEnd ? nil : tokens[position] {
+            case .punctuator(let text): comparison = Comparison(rawValue: text)
+            case .name(let text):
+                comparison = [Comparison.isIn, .startsWith, .contains].first { $0.rawValue == text }
+            default: comparison = nil
+            }
+            guard let comparison else {
+                throw ParseError(
+                    description: "Expected an operator after \(field.name) but found \(currentDescription)")
+            }
+            position += 1
+            try check(comparison, on: field)
+
+            if comparison == .isIn {
+                try expect("[")
+                var values: [Value] = []
+                if !take("]") {
+                    repeat { values.append(try parseValue(for: field)) } while take(",")
+                    try expect("]")
+                }
+                return .compare(field, comparison, .list(values))
+            }
+            if !atEnd, tokens[position] == .name("null") {
+                guard comparison == .equal || comparison == .notEqual else {
+                    throw ParseError(description: "null only compares with == and !=")
+                }
+                position += 1
+                return .compare(field, comparison, .null)
+            }
+            return .compare(field, comparison, .value(try parseValue(for: field)))
+        }
+
+        /// A field name: `status`, `actor.type`, `metadata.ruleId`.
+        private mutating func parseField() throws -> Field {
+            guard !atEnd, case .name(let first) = tokens[position] else {
+                throw ParseError(description: "Expected a field but found \(currentDescription)")
+            }
+            position += 1
+            var name = first
+            while take(".") {
+                guard !atEnd, case .name(let segment) = tokens[position] else {
+                    throw ParseError(description: "Expected a field name after '.'")
+                }
+                position += 1
+                name += ".\(segment)"
+            }
+            if let field = AuditQuery.fields[name] { return field }
+            if name.hasPrefix(Field.metadataPrefix), name.split(separator: ".").count == 2 {
+                return Field(name: name, kind: .string, column: nil)
+            }
+            let known = (AuditQuery.fields.keys.sorted() + ["metadata.<key>"]).joined(separator: ", ")
+            throw ParseError(description: "Unknown field '\(name)'; fields are \(known)")
+        }
+
+        private func check(_ comparison: Comparison, on field: Field) throws {
+            let allowed: [Comparison]
+            switch field.kind {
+            case .string: return
+            case .uuid: allowed = [.equal, .notEqual, .isIn]
+            case .integer: allowed = [.equal, .notEqual, .less, .lessOrEqual, .greater, .greaterOrEqual, .isIn]
+            case .boolean: allowed = [.equal, .notEqual]
+            case .time: allowed = [.less, .lessOrEqual, .greater, .greaterOrEqual]
+            }
+            guard allowed.contains(comparison) else {
+                let operators = allowed.map(\.rawValue).joined(separator: " ")
+                throw ParseError(description: "\(field.name) takes \(operators), not \(comparison.rawValue)")
+            }
+        }
+
+        private mutating func parseValue(for field: Field) throws -> Value {
+            guard !atEnd else {
+                throw ParseError(description: "Unexpected end of query")
+            }
+            let token = tokens[position]
+            position += 1
+            switch (field.kind, token) {
+            case (.string, .string(let text)):
+                return .string(text)
+            case (.uuid, .string(let text)):
+                guard let id = UUID(uuidString: text) else {
+                    throw ParseError(description: "\(field.name) compares with ids; '\(text)' is not one")
+                }
+                return .uuid(id)
+            case (.integer, .integer(let value)):
+                return .integer(value)
+            case (.boolean, .name("true")):
+                return .boolean(true)
+            case (.boolean, .name("false")):
+                return .boolean(false)
+            case (.time, .duration(let seconds)):
+                return .relative(seconds)
+            case (.time, .name("now")):
+                return .relative(0)
+            case (.time, .string(let text)):
+                guard let date = AuditQuery.parseInstant(text) else {
+                    throw ParseError(description: "'\(text)' is not an ISO 8601 timestamp or date")
+                }
+                return .instant(date)
+            default:
+                let expected: String
+                switch field.kind {
+                case .string: expected = "a string"
+                case .uuid: expected = "an id string"
+                case .integer: expected = "an integer"
+                case .boolean: expected = "true or false"
+                case .time: expected = "a duration like -24h, now, or a timestamp string"
+                }
+                throw ParseError(description: "\(field.name) expects \(expected) but found \(token.description)")
+            }
+        }
+
+        /// `| count` or `| count by <field>, …`; nil without a pipe.
+        mutating func parseAggregation() throws -> [Field]? {
+            guard take("|") else { return nil }
+            guard take(keyword: "count") else {
+                throw ParseError(description: "Expected 'count' after '|' but found \(currentDescription)")
+            }
+            guard take(keyword: "by") else { return [] }
+            var fields: [Field] = []
+            repeat {
+                if !atEnd, tokens[position] == .name("actor"), !(position + 1 < tokens.count
+                    && tokens[position + 1] == .punctuator("."))
+                {
+                    position += 1
+                    fields += AuditQuery.actorFields.compactMap { AuditQuery.fields[$0] }
+                    continue
+                }
+                let field = try parseField()
+                guard field.kind != .time else {
+                    throw ParseError(description: "Events can't be counted by time")
+                }
+                fields.append(field)
+            } while take(",")
+            var seen = Set<String>()
+            return fields.filter { seen.insert($0.name).inserted }
+        }
+    }
+
+    /// An ISO 8601 timestamp, with or without fractional seconds, or a bare
+    /// date read as midnight UTC.
+    static func parseInstant(_ text: String) -> Date? {
+        let fractional = ISO8601DateFormatter()
+        fractional.formatOptions = [.withInternetDateTime, .withFractionalSeconds]
+        if let date = fractional.date(from: text) ?? ISO8601DateFormatter().date(from: text) {
+            return date
+        }
+        let day = ISO8601DateFormatter()
+        day.formatOptions = [.withFullDate]
+        return day.date(from: text)
+    }
+}
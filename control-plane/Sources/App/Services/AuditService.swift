@@ -19,12 +19,23 @@ enum AuditEventType: String, Sendable {
     case register = "auth.register"
     case oidcLogin = "auth.oidc_login"
     case oidcLoginFailed = "auth.oidc_login_failed"
+    /// A user signing in through an organization's IdP joined it because
+    /// their email is at one of its verified auto-join domains.
+    case domainAutoJoin = "auth.domain_auto_join"
+    /// An existing account taken over by the organization of its verified
+    /// email domain, with the holder's consent: it now signs in through that
+    /// organization's IdP.
+    case domainAccountClaimed = "auth.domain_account_claimed"
     /// Self-service passkey enrollment/removal (`/api/users/me/passkeys`).
     /// Credential changes alter who can sign in, so they are audited
     /// alongside the login events rather than left to the generic API-request
     /// record.
     case passkeyAdded = "auth.passkey_added"
     case passkeyRemoved = "auth.passkey_removed"
+    /// Self-service SSH key registration/removal (`/api/users/me/ssh-keys`):
+    /// a registered key signs in to the console gateway.
+    case sshKeyAdded = "auth.ssh_key_added"
+    case sshKeyRemoved = "auth.ssh_key_removed"
     /// A role granted to a principal outside the resource's organization
     /// (issue #485). Cross-org access is allowed only via explicit bindings,
     /// and those bindings are deliberately loud: a distinct event type, so the
@@ -33,6 +44,37 @@ enum AuditEventType: String, Sendable {
     /// A cross-org principal's role revoked — the other half of the trail, so
     /// external access has a visible end as well as a visible start.
     case crossOrgRevoke = "iam.cross_org_revoke"
+    /// One admission webhook's verdict on a create or operation (allowed,
+    /// denied, patched, or error). The API-request record shows only the
+    /// outcome; these say which webhook decided and why.
+    case admissionReview = "admission.review"
+    /// One action of an automation rule's run, taken as the rule's service
+    /// account. No request carries it, so no `api.request` record exists.
+    case automationAction = "automation.action"
+    /// A console session opened — or joined read-only — through the SSH
+    /// gateway. No HTTP request carries an SSH session, so it has no
+    /// `api.request` record.
+    case sshConsoleSession = "console.ssh_session"
+    /// A participant the owner invited attached to a shared console or exec
+    /// session (the WebSocket join, or the SSH gateway's `join`).
+    case sharedSessionJoin = "session.join"
+    /// Input typed into a shared console or exec session, attributed to the
+    /// user who typed it: one record per line. Once a session is shared every
+    /// participant's input is recorded, the owner's included.
+    case sharedSessionInput = "session.input"
+}
+
+/// Who an audit event's action was taken by — the `actor.type` of the
+/// query language.
+enum AuditActorType: String, Sendable {
+    /// A signed-in user, by session or API key.
+    case user
+    /// A service account acting on its own, like an automation rule's.
+    case serviceAccount = "service_account"
+    /// A request no one was signed in for: failed logins, denied calls.
+    case anonymous
+    /// The control plane itself, outside any request.
+    case system
 }
 
 // MARK: - Record
@@ -55,6 +97,24 @@ struct AuditRecord: Content, Sendable {
     var sourceIP: String?
     var adminBypass: Bool = false
     var metadata: [String: String]?
+    /// `AuditActorType.rawValue`. Callers acting as someone other than the
+    /// request's user set it; otherwise `resolvingActor()` infers it.
+    var actorType: String?
+    var actorID: UUID?
+
+    /// The record with its actor filled in: the user when there is one, an
+    /// anonymous caller for a request without one, else the system.
+    func resolvingActor() -> AuditRecord {
+        guard actorType == nil else { return self }
+        var record = self
+        if let userID {
+            record.actorType = AuditActorType.user.rawValue
+            record.actorID = userID
+        } else {
+            record.actorType = (method == nil ? AuditActorType.system : .anonymous).rawValue
+        }
+        return record
+    }
 }
 
 // MARK: - Configuration
@@ -204,6 +264,8 @@ struct LogAuditBackend: AuditBackend {
             "eventType": .string(record.eventType),
             "adminBypass": .stringConvertible(record.adminBypass),
         ]
+        if let actorType = record.actorType { metadata["actorType"] = .string(actorType) }
+        if let actorID = record.actorID { metadata["actorID"] = .string(actorID.uuidString) }
         if let userID = record.userID { metadata["userID"] = .string(userID.uuidString) }
         if let username = record.username { metadata["username"] = .string(username) }
         if let organizationID = record.organizationID {
@@ -496,6 +558,7 @@ final class AuditService: @unchecked Sendable {
     /// `AUDIT_SYNCHRONOUS` is set, in which case every backend is awaited.
     func record(_ record: AuditRecord) async {
         guard isEnabled else { return }
+        let record = record.resolvingActor()
         guard !config.synchronousWrites else {
             await deliver([record])
             return
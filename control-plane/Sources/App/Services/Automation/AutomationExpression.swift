@@ -0,0 +1,362 @@
+import Foundation
+import StratoShared
+
+/// The small boolean language automation rules filter and gate on.
+///
+/// An expression reads values by dotted path from the objects it is given —
+/// `event` (the webhook envelope) for a trigger filter, plus `resource` (the
+/// event's resource as it is now) for conditions — and compares them:
+///
+///     event.data.newStatus == "Shutdown" && resource.tags.env in ["prod", "staging"]
+///
+/// Literals are strings (single or double quoted), numbers, `true`, `false`,
+/// `null` and `[…]` lists. Operators, loosest first: `||`, `&&`, `!`, then
+/// `==` `!=` `<` `<=` `>` `>=` `in` `contains`. A path that leads nowhere is
+/// `null`, so a filter on a field an event lacks is simply false — nothing
+/// here throws once parsed. Ordering compares numbers with numbers and
+/// strings with strings; anything else is false.
+struct AutomationExpression: Sendable {
+    let source: String
+    private let root: Node
+
+    static let maxLength = 1000
+    static let maxDepth = 32
+
+    struct ParseError: Error, CustomStringConvertible {
+        let description: String
+    }
+
+    fileprivate indirect enum Node: Sendable {
+        case literal(CodableValue)
+        case path([String])
+        case list([Node])
+        case not(Node)
+        case and(Node, Node)
+        case or(Node, Node)
+        case compare(Node, Comparison, Node)
+    }
+
+    fileprivate enum Comparison: String, Sendable {
+        case equal = "=="
+        case notEqual = "!="
+        case less = "<"
+        case lessOrEqual = "<="
+        case greater = ">"
+        case greaterOrEqual = ">="
+        case isIn = "in"
+        case contains
+    }
+
+    /// Parses `source`, rejecting paths whose first segment is not one of
+    /// `roots`.
+    init(_ source: String, roots: Set<String>) throws {
+        guard source.count <= Self.maxLength else {
+            throw ParseError(description: "Expression exceeds \(Self.maxLength) characters")
+        }
+        var parser = Parser(tokens: try Self.tokenize(source), roots: roots)
+        self.root = try parser.parseExpression()
+        guard parser.atEnd else {
+            throw ParseError(description: "Unexpected \(parser.currentDescription)")
+        }
+        self.source = source
+    }
+
+    /// Whether the expression holds over `scope`, an object keyed by the
+    /// roots it was parsed with. Only a literal `true` result holds.
+    func evaluate(_ scope: [String: CodableValue]) -> Bool {
+        if case .bool(true) = Self.value(root, scope) { return true }
+        return false
+    }
+
+    // MARK: - Evaluation
+
+    private static func value(_ node: Node, _ scope: [String: CodableValue]) -> CodableValue {
+        switch node {
+        case .literal(let value):
+            return value
+        case .path(let segments):
+            var current: CodableValue = scope[segments[0]] ?? .null
+            for segment in segments.dropFirst() {
+                guard case .object(let object) = current, let next = object[segment] else { return .null }
+                current = next
+            }
+            return current
+        case .list(let items):
+            return .array(items.map { value($0, scope) })
+        case .not(let operand):
+            if case .bool(true) = value(operand, scope) { return .bool(false) }
+            return .bool(true)
+        case .and(let left, let right):
+            guard case .bool(true) = value(left, scope) else { return .bool(false) }
+            if case .bool(true) = value(right, scope) { return .bool(true) }
+            return .bool(false)
+        case .or(let left, let right):
+            if case .bool(true) = value(left, scope) { return .bool(true) }
+            if case .bool(true) = value(right, scope) { return .bool(true) }
+            return .bool(false)
+        case .compare(let left, let comparison, let right):
+            return .bool(compare(value(left, scope), comparison, value(right, scope)))
+        }
+    }
+
+    private static func compare(_ left: CodableValue, _ comparison: Comparison, _ right: CodableValue) -> Bool {
+        switch comparison {
+        case .equal: return equal(left, right)
+        case .notEqual: return !equal(left, right)
+        case .isIn:
+            guard case .array(let items) = right else { return false }
+            return items.contains { equal(left, $0) }
+        case .contains:
+            switch (left, right) {
+            case (.string(let haystack), .string(let needle)): return haystack.contains(needle)
+            case (.array(let items), _): return items.contains { equal($0, right) }
+            default: return false
+            }
+        case .less, .lessOrEqual, .greater, .greaterOrEqual:
+            let order: ComparisonResult
+            if let l = number(left), let r = number(right) {
+                order = l < r ? .orderedAscending : (l > r ? .orderedDescending : .orderedSame)
+            } else if case .string(let l) = left, case .string(let r) = right {
+                order = l < r ? .orderedAscending : (l > r ? .orderedDescending : .orderedSame)
+            } else {
+                return false
+            }
+            switch comparison {
+            case .less: return order == .orderedAscending
+            case .lessOrEqual: return order != .orderedDescending
+            case .greater: return order == .orderedDescending
+            default: return order != .orderedAscending
+            }
+        }
+    }
+
+    private static func number(_ value: CodableValue) -> Double? {
+        switch value {
+        case .int(let int): return Double(int)
+        case .double(let double): return double
+        default: return nil
+        }
+    }
+
+    static func equal(_ left: CodableValue, _ right: CodableValue) -> Bool {
+        if let l = number(left), let r = number(right) { return l == r }
+        switch (left, right) {
+        case (.string(let l), .string(let r)): return l == r
+        case (.bool(let l), .bool(let r)): return l == r
+        case (.null, .null): return true
+        case (.array(let l), .array(let r)):
+            return l.count == r.count && zip(l, r).allSatisfy { equal($0, $1) }
+        case (.object(let l), .object(let r)):
+            return l.count == r.count && l.allSatisfy { key, value in r[key].map { equal(value, $0) } ?? false }
+        default: return false
+        }
+    }
+
+    // MARK: - Lexing
+
+    fileprivate enum Token: Equatable {
+        case punctuator(String)
+        case name(String)
+        case string(String)
+        case number(Double, isInteger: Bool)
+
+        var description: String {
+            switch self {
+            case .punctuator(let text), .name(let text): return "'\(text)'"
+            case .string(let text): return "string \"\(text)\""
+            case .number(let value, _): return "number \(value)"
+            }
+        }
+    }
+
+    private static let punctuators = ["==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "(", ")", "[", "]", ",", "."]
+
+    private static func tokenize(_ source: String) throws -> [Token] {
+        let scalars = Array(source.unicodeScalars)
+        var tokens: [Token] = []
+        var index = 0
+        func isNameStart(_ scalar: Unicode.Scalar) -> Bool {
+            scalar == "_" || ("a"..."z").contains(scalar) || ("A"..."Z").contains(scalar)
+        }
+        func isDigit(_ scalar: Unicode.Scalar) -> Bool { ("0"..."9").contains(scalar) }
+
+        while index < scalars.count {
+            let scalar = scalars[index]
+            if scalar == " " || scalar == "\t" || scalar == "\n" || scalar == "\r" {
+                index += 1
+            } else if scalar == "\"" || scalar == "'" {
+                var text = String.UnicodeScalarView()
+                index += 1
+                while true {
+                    guard index < scalars.count else {
+                        throw ParseError(description: "Unterminated string")
+                    }
+                    let next = scalars[index]
+                    index += 1
+                    if next == scalar { break }
+                    if next == "\\", index < scalars.count {
+                        text.append(scalars[index])
+                        index += 1
+                    } else {
+                        text.append(next)
+                    }
+                }
+                tokens.append(.string(String(text)))
+            } else if isDigit(scalar) || (scalar == "-" && index + 1 < scalars.count && isDigit(scalars[index + 1])) {
+                let start = index
+                index += 1
+                while index < scalars.count, isDigit(scalars[index]) || scalars[index] == "." { index += 1 }
+                let text = String(String.UnicodeScalarView(scalars[start..<index]))
+                guard let value = Double(text) else {
+                    throw ParseError(description: "Invalid number '\(text)'")
+                }
+                tokens.append(.number(value, isInteger: !text.contains(".")))
+            } else if isNameStart(scalar) {
+                let start = index
+                while index < scalars.count, isNameStart(scalars[index]) || isDigit(scalars[index]) { index += 1 }
+                tokens.append(.name(String(String.UnicodeScalarView(scalars[start..<index]))))
+            } else if let punctuator = punctuators.first(where: { candidate in
+                let candidateScalars = Array(candidate.unicodeScalars)
+                return index + candidateScalars.count <= scalars.count
+                    && Array(scalars[index..<index + candidateScalars.count]) == candidateScalars
+            }) {
+                tokens.append(.punctuator(punctuator))
+                index += punctuator.unicodeScalars.count
+            } else {
+                throw ParseError(description: "Unexpected character '\(scalar)'")
+            }
+        }
+        return tokens
+    }
+
+    // MARK: - Parsing
+
+    fileprivate struct Parser {
+        let tokens: [Token]
+        let roots: Set<String>
+        var position = 0
+        var depth = 0
+
+        init(tokens: [Token], roots: Set<String>) {
+            self.tokens = tokens
+            self.roots = roots
+        }
+
+        var atEnd: Bool { position >= tokens.count }
+
+        var currentDescription: String {
+            atEnd ? "end of expression" : tokens[position].description
+        }
+
+        private func peek(_ punctuator: String) -> Bool {
+            !atEnd && tokens[position] == .punctuator(punctuator)
+        }
+
+        private mutating func take(_ punctuator: String) -> Bool {
+            guard peek(punctuator) else { return false }
+            position += 1
+            return true
+        }
+
+        private mutating func expect(_ punctuator: String) throws {
+            guard take(punctuator) else {
+                throw ParseError(description: "Expected '\(punctuator)' but found \(currentDescription)")
+            }
+        }
+
+        private mutating func descend() throws {
+            depth += 1
+            guard depth <= AutomationExpression.maxDepth else {
+                throw ParseError(description: "Expression is nested too deeply")
+            }
+        }
+
+        mutating func parseExpression() throws -> Node {
+            try descend()
+            defer { depth -= 1 }
+            var node = try parseAnd()
+            while take("||") { node = .or(node, try parseAnd()) }
+            return node
+        }
+
+        private mutating func parseAnd() throws -> Node {
+            var node = try parseNot()
+            while take("&&") { node = .and(node, try parseNot()) }
+            return node
+        }
+
+        private mutating func parseNot() throws -> Node {
+            if take("!") {
+                try descend()
+                defer { depth -= 1 }
+                return .not(try parseNot())
+            }
+            return try parseComparison()
+        }
+
+        private mutating func parseComparison() throws -> Node {
+            let left = try parsePrimary()
+            guard !atEnd else { return left }
+            let comparison: Comparison?
+            switch tokens[position] {
+            case .punctuator(let text): comparison = Comparison(rawValue: text)
+            case .name("in"): comparison = .isIn
+            case .name("contains"): comparison = .contains
+            default: comparison = nil
+            }
+            guard let comparison else { return left }
+            position += 1
+            return .compare(left, comparison, try parsePrimary())
+        }
+
+        private mutating func parsePrimary() throws -> Node {
+            guard !atEnd else {
+                throw ParseError(description: "Unexpected end of expression")
+            }
+            let token = tokens[position]
+            position += 1
+            switch token {
+            case .punctuator("("):
+                let node = try parseExpression()
+                try expect(")")
+                return node
+            case .punctuator("["):
+                try descend()
+                defer { depth -= 1 }
+                var items: [Node] = []
+                if !take("]") {
+                    repeat { items.append(try parsePrimary()) } while take(",")
+                    try expect("]")
+                }
+                return .list(items)
+            case .string(let text):
+                return .literal(.string(text))
+            case .number(let value, let isInteger):
+                if isInteger, let int = Int(exactly: value) { return .literal(.int(int)) }
+                return .literal(.double(value))
+            case .name("true"):
+                return .literal(.bool(true))
+            case .name("false"):
+                return .literal(.bool(false))
+            case .name("null"):
+                return .literal(.null)
+            case .name(let name):
+                guard roots.contains(name) else {
+                    let allowed = roots.sorted().joined(separator: ", ")
+                    throw ParseError(description: "Unknown name '\(name)'; paths start with \(allowed)")
+                }
+                var segments = [name]
+                while take(".") {
+                    guard !atEnd, case .name(let segment) = tokens[position] else {
+                        throw ParseError(description: "Expected a field name after '.'")
+                    }
+                    position += 1
+                    segments.append(segment)
+                }
+                return .path(segments)
+            default:
+                throw ParseError(description: "Unexpected \(token.description)")
+            }
+        }
+    }
+}
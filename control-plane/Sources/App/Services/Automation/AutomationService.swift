@@ -0,0 +1,549 @@
+import AsyncHTTPClient
+import Fluent
+import Foundation
+import NIOConcurrencyHelpers
+import NIOCore
+import SQLKit
+import StratoShared
+import Vapor
+
+/// Matches events to automation rules. Runs inside `WebhookEvents.enqueue`,
+/// on the handle of the change that produced the event, so a rule's run
+/// commits (or rolls back) with it exactly like a webhook delivery.
+enum AutomationRules {
+    /// Queue a run for every active rule of the event's project and type
+    /// whose filter holds. A rule already at its hourly limit gets a
+    /// `rate_limited` run instead, so the history shows what was dropped.
+    static func enqueueRuns(for event: WebhookEvent, on db: Database) async throws {
+        guard let projectID = event.projectID else { return }
+        let rules = try await AutomationRule.query(on: db)
+            .filter(\.$project.$id == projectID)
+            .filter(\.$triggerEventType == event.type.rawValue)
+            .filter(\.$isActive == true)
+            .all()
+        guard !rules.isEmpty else { return }
+
+        let payload = try event.encodedPayload()
+        let envelope = (try? JSONDecoder().decode(CodableValue.self, from: Data(payload.utf8))) ?? .null
+        let hourAgo = Date().addingTimeInterval(-3600)
+        for rule in rules {
+            let ruleID = try rule.requireID()
+            // A rule's own notification never triggers it again; anything
+            // longer-winded is bounded by the rate limit.
+            if event.type == .automationNotification, event.data["ruleId"] == .string(ruleID.uuidString) {
+                continue
+            }
+            if !rule.filter.isEmpty {
+                guard let filter = try? AutomationExpression(rule.filter, roots: AutomationRule.filterRoots),
+                    filter.evaluate(["event": envelope])
+                else { continue }
+            }
+
+            let recent = try await AutomationRun.query(on: db)
+                .filter(\.$rule.$id == ruleID)
+                .filter(\.$status != AutomationRunStatus.rateLimited.rawValue)
+                .filter(\.$createdAt >= hourAgo)
+                .count()
+            let status: AutomationRunStatus = recent >= rule.maxRunsPerHour ? .rateLimited : .pending
+            try await AutomationRun(ruleID: ruleID, event: event, payload: payload, status: status).save(on: db)
+        }
+    }
+}
+
+/// Executes queued automation runs.
+///
+/// A periodic loop — cluster-singleton per pass via the
+/// `lock:sweep:automation` Valkey lock, like the webhook delivery sweep —
+/// claims pending runs oldest first, re-checks each rule's conditions
+/// against the resource as it is now, and performs the actions in order as
+/// the rule's service account, stopping at the first failure. Every action is
+/// an ordinary Cedar check for that account plus the same code path the API
+/// uses (`ResourceOperationCoordinator` for start and stop), and is audited
+/// as `automation.action`.
+///
+/// Runs execute at most once: a run a crashed replica left `running` is
+/// failed as interrupted after `runningLeaseSeconds`, never repeated, since
+/// half its actions may already have happened.
+final class AutomationService: @unchecked Sendable {
+    let app: Application
+    let logger: Logger
+    private let sweepTask: NIOLockedValueBox<Task<Void, Never>?> = .init(nil)
+
+    /// How often each replica looks for pending runs — the worst-case delay
+    /// between an event and its rule acting on it.
+    let sweepIntervalSeconds: Int
+
+    var sweepLockTTLSeconds: Int { max(sweepIntervalSeconds - 2, 2) }
+
+    /// Runs claimed per pass; anything beyond rolls to the next pass.
+    static let batchSize = 20
+
+    /// How long a run may stay `running` before it is presumed abandoned.
+    /// Covers ten actions of the slowest kind (a snapshot of every attached
+    /// volume) with room to spare.
+    static let runningLeaseSeconds = 3600
+
+    /// Timeout of a `call_webhook` POST, as for webhook deliveries.
+    static let requestTimeoutSeconds: Int64 = 10
+
+    /// Finished runs are kept this long as history.
+    static let historyRetentionDays = 7
+
+    init(app: Application) {
+        self.app = app
+        self.logger = app.logger
+        self.sweepIntervalSeconds =
+            Environment.get("AUTOMATION_INTERVAL_SECONDS").flatMap(Int.init) ?? 5
+    }
+
+    private var sweepEnabled: Bool {
+        Environment.get("AUTOMATION_ENABLED").flatMap(Bool.init)
+            ?? (app.environment != .testing)
+    }
+
+    // MARK: - Sweep lifecycle
+
+    /// Arm the periodic sweep. Called once from the boot lifecycle; disabled
+    /// in the testing environment (tests drive `sweepOnce` directly).
+    func startSweep() {
+        sweepTask.withLockedValue { task in
+            guard task == nil else { return }
+            task = Task { [weak self] in
+                guard let self, self.sweepEnabled else { return }
+                let interval = self.sweepIntervalSeconds
+                while !Task.isCancelled {
+                    await self.sweepOnce()
+                    do {
+                        try await Task.sleep(for: .seconds(interval))
+                    } catch {
+                        break  // cancelled
+                    }
+                }
+            }
+        }
+    }
+
+    func shutdown() {
+        sweepTask.withLockedValue { task in
+            task?.cancel()
+            task = nil
+        }
+    }
+
+    // MARK: - One pass
+
+    /// One pass. `acquiringLock: false` skips the cluster-singleton lock, for
+    /// tests running passes back-to-back. As with webhook deliveries, the
+    /// row claim — not the lock — is what keeps two passes from running the
+    /// same run.
+    func sweepOnce(acquiringLock: Bool = true) async {
+        if acquiringLock {
+            guard await app.coordination.acquireSweepLock("automation", ttlSeconds: sweepLockTTLSeconds) else {
+                logger.debug("Skipping automation sweep; lock held by another control-plane instance")
+                return
+            }
+        }
+
+        guard let db = app.liveDB else { return }
+        do {
+            try await failInterruptedRuns(on: db)
+            // One at a time, in event order: two rules acting on the same VM
+            // see each other's effects in the order their events happened.
+            for run in try await claimPendingRuns(on: db) {
+                await execute(run, on: db)
+            }
+            try await pruneHistory(on: db)
+        } catch {
+            logger.error("Automation sweep failed: \(error)")
+        }
+    }
+
+    private func claimPendingRuns(on db: Database) async throws -> [AutomationRun] {
+        guard let sql = db as? SQLDatabase else { return [] }
+        struct ClaimedRow: Decodable {
+            let id: UUID
+        }
+        let claimed = try await sql.raw(
+            """
+            UPDATE automation_runs
+            SET status = \(bind: AutomationRunStatus.running.rawValue), started_at = now()
+            WHERE id IN (
+                SELECT id FROM automation_runs
+                WHERE status = \(bind: AutomationRunStatus.pending.rawValue)
+                ORDER BY created_at
+                LIMIT \(bind: Self.batchSize)
+                FOR UPDATE SKIP LOCKED
+            )
+            RETURNING id
+            """
+        ).all(decoding: ClaimedRow.self)
+        guard !claimed.isEmpty else { return [] }
+
+        return try await AutomationRun.query(on: db)
+            .filter(\.$id ~~ claimed.map(\.id))
+            .sort(\.$createdAt)
+            .with(\.$rule)
+            .all()
+    }
+
+    private func failInterruptedRuns(on db: Database) async throws {
+        let cutoff = Date().addingTimeInterval(-Double(Self.runningLeaseSeconds))
+        try await AutomationRun.query(on: db)
+            .filter(\.$status == AutomationRunStatus.running.rawValue)
+            .filter(\.$startedAt < cutoff)
+            .set(\.$status, to: AutomationRunStatus.failed.rawValue)
+            .set(\.$error, to: "Run was interrupted before it finished; it is not retried")
+            .set(\.$completedAt, to: Date())
+            .update()
+    }
+
+    private func pruneHistory(on db: Database) async throws {
+        let cutoff = Date().addingTimeInterval(-Double(Self.historyRetentionDays) * 86_400)
+        try await AutomationRun.query(on: db)
+            .filter(\.$status !~ [AutomationRunStatus.pending.rawValue, AutomationRunStatus.running.rawValue])
+            .filter(\.$createdAt < cutoff)
+            .delete()
+    }
+
+    // MARK: - Running a rule
+
+    /// The parts of the triggering event's envelope the actions use.
+    private struct Envelope: Decodable {
+        let id: UUID
+        let type: String
+        let organizationId: UUID
+        let resource: WebhookEvent.Resource?
+    }
+
+    /// What every action of one run shares.
+    private struct RunContext {
+        let rule: AutomationRule
+        let ruleID: UUID
+        let runID: UUID
+        let envelope: Envelope
+        let event: CodableValue
+        let vm: VM?
+    }
+
+    private func execute(_ run: AutomationRun, on db: Database) async {
+        let rule = run.rule
+        do {
+            guard rule.isActive else {
+                return try await finish(run, .skipped, error: "Rule was disabled before the run started", on: db)
+            }
+            let payload = Data(run.eventPayload.utf8)
+            let envelope = try JSONDecoder().decode(Envelope.self, from: payload)
+            let context = RunContext(
+                rule: rule,
+                ruleID: try rule.requireID(),
+                runID: try run.requireID(),
+                envelope: envelope,
+                event: try JSONDecoder().decode(CodableValue.self, from: payload),
+                vm: try await targetVM(of: envelope, rule: rule, on: db))
+
+            let scope: [String: CodableValue] = ["event": context.event, "resource": Self.resource(context.vm)]
+            for source in rule.conditions {
+                let condition = try AutomationExpression(source, roots: AutomationRule.conditionRoots)
+                guard condition.evaluate(scope) else {
+                    return try await finish(run, .skipped, error: "Condition did not hold: \(source)", on: db)
+                }
+            }
+
+            for action in rule.actions {
+                let step = await perform(action, context, on: db)
+                run.steps.append(step)
+                await audit(step, context)
+                if step.status == .failed {
+                    return try await finish(run, .failed, error: step.detail, on: db)
+                }
+                // Persist progress so the history shows what already
+                // happened if the run is interrupted.
+                try await run.save(on: db)
+            }
+            try await finish(run, .succeeded, error: nil, on: db)
+        } catch {
+            try? await finish(run, .failed, error: String("\(error)".prefix(500)), on: db)
+        }
+    }
+
+    private func finish(
+        _ run: AutomationRun, _ status: AutomationRunStatus, error: String?, on db: Database
+    ) async throws {
+        run.status = status.rawValue
+        run.error = error
+        run.completedAt = Date()
+        try await run.save(on: db)
+    }
+
+    /// The VM the event is about, if it is about one in the rule's project.
+    private func targetVM(of envelope: Envelope, rule: AutomationRule, on db: Database) async throws -> VM? {
+        guard let resource = envelope.resource,
+            resource.kind == OperationResourceKind.virtualMachine.rawValue,
+            let vm = try await VM.find(resource.id, on: db),
+            vm.$project.id == rule.$project.id
+        else { return nil }
+        return vm
+    }
+
+    /// `resource` in conditions: the VM as it is when the run executes, or
+    /// null when the event is not about a VM.
+    static func resource(_ vm: VM?) -> CodableValue {
+        guard let vm, let id = vm.id else { return .null }
+        var object: [String: CodableValue] = [
+            "kind": .string(OperationResourceKind.virtualMachine.rawValue),
+            "id": .string(id.uuidString),
+            "name": .string(vm.name),
+            "status": .string(vm.status.rawValue),
+            "desiredStatus": .string(vm.desiredStatus.rawValue),
+            "environment": .string(vm.environment),
+            "projectId": .string(vm.$project.id.uuidString),
+            "tags": .object((vm.tags ?? [:]).mapValues { .string($0) }),
+        ]
+        object["healthStatus"] = vm.healthStatus.map { .string($0) } ?? .null
+        return .object(object)
+    }
+
+    // MARK: - Actions
+
+    private struct ActionError: Error, CustomStringConvertible {
+        let description: String
+    }
+
+    private func perform(
+        _ action: AutomationAction, _ context: RunContext, on db: Database
+    ) async -> AutomationStepResult {
+        do {
+            switch action.type {
+            case .start, .stop:
+                return try await changePower(action.type, context, on: db)
+            case .snapshot:
+                return try await snapshot(context, on: db)
+            case .tag:
+                return try await tag(action.tags ?? [:], context, on: db)
+            case .notify:
+                return try await notify(action.message ?? "", context, on: db)
+            case .callWebhook:
+                return try await callWebhook(action.url ?? "", context)
+            }
+        } catch let error as AbortError {
+            return AutomationStepResult(action: action.type, status: .failed, detail: error.reason)
+        } catch {
+            return AutomationStepResult(action: action.type, status: .failed, detail: String("\(error)".prefix(500)))
+        }
+    }
+
+    private func requireVM(_ context: RunContext) throws -> VM {
+        guard let vm = context.vm else {
+            throw ActionError(description: "The triggering event is not about a VM in this project")
+        }
+        return vm
+    }
+
+    /// Throws unless the rule's service account may take `action` on `node`.
+    private func authorize(_ action: String, on node: IAMNode, _ context: RunContext, on db: Database) async throws {
+        let decision = try await IAMAuthorizer.authorize(
+            principal: .serviceAccount(context.rule.$serviceAccount.id),
+            action: action,
+            node: node,
+            legacyEquivalent: nil,
+            context: IAMCheckContext(
+                path: "/api/projects/\(context.rule.$project.id)/automation-rules/\(context.ruleID)",
+                method: "POST",
+                requestID: context.runID.uuidString),
+            state: nil,
+            app: app,
+            db: db)
+        guard decision.allowed else {
+            throw ActionError(description: "Service account is not allowed to \(action)")
+        }
+    }
+
+    private func changePower(
+        _ type: AutomationActionType, _ context: RunContext, on db: Database
+    ) async throws -> AutomationStepResult {
+        let vm = try requireVM(context)
+        let vmID = try vm.requireID()
+        let starting = type == .start
+        try await authorize(
+            starting ? "vm:start" : "vm:stop", on: IAMNode(type: .virtualMachine, id: vmID), context, on: db)
+
+        let target: DesiredVMStatus = starting ? .running : .shutdown
+        if vm.desiredStatus == target, vm.status == (starting ? .running : .shutdown) {
+            return AutomationStepResult(action: type, status: .skipped, detail: "VM is already \(vm.status.rawValue)")
+        }
+        guard starting ? vm.canStart : vm.canStop else {
+            throw ActionError(
+                description: "VM cannot be \(starting ? "started" : "stopped") in current state: \(vm.status.rawValue)")
+        }
+
+        let operation = try await app.resourceOperationCoordinator.perform(
+            starting ? .boot : .shutdown, resourceKind: .virtualMachine, resourceID: vmID,
+            userID: context.rule.$serviceAccount.id, hypervisorId: vm.hypervisorId, dispatch: .stateSync,
+            on: db, app: app
+        ) { @Sendable db in
+            vm.setDesiredStatus(target)
+            try await vm.save(on: db)
+        }
+        return AutomationStepResult(action: type, status: .succeeded, operationId: operation.id)
+    }
+
+    /// Snapshots every volume attached to the VM, each owned by the service
+    /// account and named after the rule and run.
+    private func snapshot(_ context: RunContext, on db: Database) async throws -> AutomationStepResult {
+        let vm = try requireVM(context)
+        let attachments = try await VolumeAttachment.query(on: db)
+            .filter(\.$vm.$id == vm.requireID())
+            .with(\.$volume)
+            .all()
+        guard !attachments.isEmpty else {
+            return AutomationStepResult(action: .snapshot, status: .skipped, detail: "VM has no attached volumes")
+        }
+
+        var names: [String] = []
+        for attachment in attachments {
+            let volume = attachment.volume
+            try await authorize("volume:snapshot", on: IAMNode(type: .volume, id: volume.requireID()), context, on: db)
+            let name = "\(context.rule.name)-\(context.runID.uuidString.prefix(8).lowercased())-\(volume.name)"
+            let snapshot = try await app.volumeService.takeSnapshot(
+                of: volume,
+                name: String(name.prefix(255)),
+                description: "Taken by automation rule '\(context.rule.name)' (run \(context.runID))",
+                createdByID: context.rule.$createdBy.id,
+                owner: (.serviceAccount, context.rule.$serviceAccount.id),
+                on: db)
+            names.append(snapshot.name)
+        }
+        return AutomationStepResult(
+            action: .snapshot, status: .succeeded, detail: "Created snapshots: \(names.joined(separator: ", "))")
+    }
+
+    private func tag(
+        _ tags: [String: String], _ context: RunContext, on db: Database
+    ) async throws -> AutomationStepResult {
+        let vm = try requireVM(context)
+        try await authorize("vm:update", on: IAMNode(type: .virtualMachine, id: vm.requireID()), context, on: db)
+
+        var merged = vm.tags ?? [:]
+        for (key, value) in tags {
+            merged[key] = value.isEmpty ? nil : value
+        }
+        try VM.validateTags(merged)
+        vm.tags = merged.isEmpty ? nil : merged
+        try await vm.save(on: db)
+        return AutomationStepResult(action: .tag, status: .succeeded)
+    }
+
+    /// Emits `automation.notification` to the project's webhook subscribers
+    /// and GraphQL subscribers. Needs no permission: it reaches only
+    /// consumers the project already set up.
+    private func notify(
+        _ message: String, _ context: RunContext, on db: Database
+    ) async throws -> AutomationStepResult {
+        let event = WebhookEvent(
+            type: .automationNotification,
+            organizationID: context.envelope.organizationId,
+            projectID: context.rule.$project.id,
+            resource: WebhookEvent.Resource(kind: "automation_rule", id: context.ruleID, name: context.rule.name),
+            data: [
+                "ruleId": .string(context.ruleID.uuidString),
+                "ruleName": .string(context.rule.name),
+                "runId": .string(context.runID.uuidString),
+                "message": .string(message),
+                "triggerEventId": .string(context.envelope.id.uuidString),
+                "triggerEventType": .string(context.envelope.type),
+            ])
+        try await WebhookEvents.enqueue(event, on: db)
+        return AutomationStepResult(action: .notify, status: .succeeded, detail: "Event \(event.id)")
+    }
+
+    /// The body a `call_webhook` action POSTs.
+    private struct WebhookCall: Encodable {
+        let ruleId: UUID
+        let runId: UUID
+        let event: CodableValue
+    }
+
+    /// POSTs the run, signed like a webhook delivery but with the rule's
+    /// secret, through `SSRFGuard`. Anything but a 2xx fails the step.
+    private func callWebhook(_ urlString: String, _ context: RunContext) async throws -> AutomationStepResult {
+        guard let url = URL(string: urlString) else {
+            throw ActionError(description: "Webhook URL is not a valid URL")
+        }
+        let encoder = JSONEncoder()
+        encoder.outputFormatting = [.sortedKeys, .withoutEscapingSlashes]
+        let call = WebhookCall(ruleId: context.ruleID, runId: context.runID, event: context.event)
+        let body = String(decoding: try encoder.encode(call), as: UTF8.self)
+        let secret = try app.secretsEncryption.decrypt(context.rule.signingSecret)
+        let timestamp = Int(Date().timeIntervalSince1970)
+        let signature = WebhookDeliveryService.signature(payload: body, timestamp: timestamp, secret: secret)
+
+        var request = HTTPClientRequest(url: urlString)
+        request.method = .POST
+        request.headers.add(name: "Content-Type", value: "application/json")
+        request.headers.add(name: "User-Agent", value: "Strato-Automation/1.0")
+        request.headers.add(name: "X-Strato-Signature", value: "t=\(timestamp),v1=\(signature)")
+        request.headers.add(name: "X-Strato-Event-Id", value: context.envelope.id.uuidString)
+        request.headers.add(name: "X-Strato-Automation-Run-Id", value: context.runID.uuidString)
+        request.body = .bytes(ByteBuffer(string: body))
+
+        let response = try await SSRFGuard.execute(
+            request, url: url, timeout: .seconds(Self.requestTimeoutSeconds), app: app)
+        let status = Int(response.status.code)
+        guard (200..<300).contains(status) else {
+            throw ActionError(description: "Endpoint answered HTTP \(status)")
+        }
+        return AutomationStepResult(action: .callWebhook, status: .succeeded, detail: "HTTP \(status)")
+    }
+
+    private func audit(_ step: AutomationStepResult, _ context: RunContext) async {
+        var metadata = [
+            "ruleId": context.ruleID.uuidString,
+            "ruleName": context.rule.name,
+            "runId": context.runID.uuidString,
+            "serviceAccountId": context.rule.$serviceAccount.id.uuidString,
+            "outcome": step.status.rawValue,
+        ]
+        if let detail = step.detail { metadata["detail"] = detail }
+        if let operationID = step.operationId { metadata["operationId"] = operationID.uuidString }
+        await app.audit.record(
+            AuditRecord(
+                eventType: AuditEventType.automationAction.rawValue,
+                organizationID: context.envelope.organizationId,
+                resourceType: context.vm == nil ? "automation_rule" : OperationResourceKind.virtualMachine.rawValue,
+                resourceID: context.vm?.id?.uuidString ?? context.ruleID.uuidString,
+                action: step.action.rawValue,
+                metadata: metadata,
+                actorType: AuditActorType.serviceAccount.rawValue,
+                actorID: context.rule.$serviceAccount.id
+            ))
+    }
+}
+
+// MARK: - Application accessor / lifecycle
+
+extension Application {
+    private struct AutomationServiceKey: StorageKey, LockKey {
+        typealias Value = AutomationService
+    }
+
+    var automation: AutomationService {
+        lazyService(AutomationServiceKey.self) { AutomationService(app: self) }
+    }
+
+    /// The automation service if something already created it, so shutdown
+    /// does not instantiate it just to shut it down.
+    var automationServiceIfCreated: AutomationService? {
+        storage[AutomationServiceKey.self]
+    }
+}
+
+/// Arms the automation sweep at boot and cancels it at shutdown.
+struct AutomationLifecycleHandler: LifecycleHandler {
+    func didBootAsync(_ application: Application) async throws {
+        application.automation.startSweep()
+    }
+
+    func shutdownAsync(_ application: Application) async {
+        application.automationServiceIfCreated?.shutdown()
+    }
+}
@@ -0,0 +1,222 @@
+import AsyncHTTPClient
+import Crypto
+import Foundation
+import NIOCore
+import Vapor
+import X509
+
+/// RPKI route origin validation state, as RFC 6811 names it.
+enum RouteOriginValidity: String, Sendable {
+    case valid
+    case invalid
+    case notFound = "not-found"
+}
+
+/// Where BYOIP proof of control comes from: an RPKI validator and the RIRs'
+/// RDAP service. A protocol so tests can answer without the Internet.
+protocol BYOIPEvidenceSource: Sendable {
+    /// Origin validation of `prefix` announced by `asn`.
+    func routeOriginValidity(prefix: String, asn: Int) async throws -> RouteOriginValidity
+    /// Every remark line of the prefix's RDAP record, in order.
+    func rdapRemarks(prefix: String) async throws -> [String]
+}
+
+/// Operator settings for BYOIP verification, read from the environment.
+struct BYOIPConfig: Sendable {
+    /// Base URL of a Routinator-compatible validator
+    /// (`GET /api/v1/validity/AS<asn>/<prefix>`). Nil disables `roa`.
+    var rpkiValidatorURL: String?
+    /// The ASN the sites' FRR originates BYOIP prefixes from. A ROA must
+    /// authorize it; nil disables `roa`.
+    var originASN: Int?
+    /// RDAP base (`GET /ip/<prefix>`); rdap.org redirects to the right RIR.
+    var rdapBaseURL: String
+
+    static func fromEnvironment() -> BYOIPConfig {
+        BYOIPConfig(
+            rpkiValidatorURL: Environment.get("BYOIP_RPKI_VALIDATOR_URL"),
+            originASN: Environment.get("BYOIP_ORIGIN_ASN").flatMap(Int.init),
+            rdapBaseURL: Environment.get("BYOIP_RDAP_URL") ?? "https://rdap.org")
+    }
+}
+
+/// Reads a Routinator-style validator and RDAP over HTTP.
+struct HTTPBYOIPEvidenceSource: BYOIPEvidenceSource {
+    let config: BYOIPConfig
+    let client: HTTPClient
+
+    struct EvidenceError: Error, CustomStringConvertible {
+        let description: String
+    }
+
+    func routeOriginValidity(prefix: String, asn: Int) async throws -> RouteOriginValidity {
+        guard let base = config.rpkiValidatorURL else {
+            throw EvidenceError(description: "No RPKI validator is configured")
+        }
+        struct Body: Decodable {
+            struct Route: Decodable {
+                struct Validity: Decodable { let state: String }
+                let validity: Validity
+            }
+            let validatedRoute: Route
+
+            enum CodingKeys: String, CodingKey {
+                case validatedRoute = "validated_route"
+            }
+        }
+        let body: Body = try await getJSON("\(base)/api/v1/validity/AS\(asn)/\(prefix)")
+        guard let state = RouteOriginValidity(rawValue: body.validatedRoute.validity.state) else {
+            throw EvidenceError(
+                description: "Validator returned unknown state '\(body.validatedRoute.validity.state)'")
+        }
+        return state
+    }
+
+    func rdapRemarks(prefix: String) async throws -> [String] {
+        struct Body: Decodable {
+            struct Remark: Decodable { let description: [String]? }
+            let remarks: [Remark]?
+        }
+        let body: Body = try await getJSON("\(config.rdapBaseURL)/ip/\(prefix)")
+        return (body.remarks ?? []).flatMap { $0.description ?? [] }
+    }
+
+    private func getJSON<T: Decodable>(_ url: String) async throws -> T {
+        var request = HTTPClientRequest(url: url)
+        request.headers.add(name: "Accept", value: "application/json, application/rdap+json")
+        let response = try await client.execute(request, timeout: .seconds(15))
+        guard response.status == .ok else {
+            throw EvidenceError(description: "\(url) answered \(response.status.code)")
+        }
+        let body = try await response.body.collect(upTo: 1 << 20)
+        return try JSONDecoder().decode(T.self, from: body)
+    }
+}
+
+/// Decides whether an organization has proven control of a prefix.
+enum BYOIPVerifier {
+    /// The outcome: nil when proven, otherwise why not (stored on the
+    /// registration as its status message).
+    static func failure(
+        of prefix: BYOIPPrefix, signature: String?, config: BYOIPConfig, evidence: any BYOIPEvidenceSource
+    ) async -> String? {
+        switch prefix.method {
+        case .roa:
+            guard let asn = config.originASN, config.rpkiValidatorURL != nil else {
+                return "ROA verification is not configured on this control plane"
+            }
+            do {
+                let validity = try await evidence.routeOriginValidity(prefix: prefix.cidr, asn: asn)
+                guard validity == .valid else {
+                    return "No ROA authorizes AS\(asn) to originate \(prefix.cidr) (\(validity.rawValue))"
+                }
+            } catch {
+                return "RPKI validator lookup failed: \(error)"
+            }
+            // The ROA names the operator's AS, which every customer shares,
+            // so it says the prefix may be announced here — not for whom.
+            // The registration's own challenge in the holder's RDAP record
+            // is what ties it to this organization.
+            let remarks: [String]
+            do {
+                remarks = try await evidence.rdapRemarks(prefix: prefix.cidr)
+            } catch {
+                return "RDAP lookup failed: \(error)"
+            }
+            guard remarks.contains(where: { $0.contains(prefix.challenge) }) else {
+                return "The RDAP record for \(prefix.cidr) has no remark carrying this registration's challenge"
+            }
+            return nil
+        case .signedChallenge:
+            guard let signature, let signatureBytes = Data(base64Encoded: signature) else {
+                return "A base64 signature over the challenge is required"
+            }
+            let remarks: [String]
+            do {
+                remarks = try await evidence.rdapRemarks(prefix: prefix.cidr)
+            } catch {
+                return "RDAP lookup failed: \(error)"
+            }
+            guard let pem = certificatePEM(in: remarks) else {
+                return "The RDAP record for \(prefix.cidr) has no certificate in its remarks"
+            }
+            let certificate: Certificate
+            do {
+                certificate = try Certificate(pemEncoded: pem)
+            } catch {
+                return "The certificate in the RDAP record could not be parsed"
+            }
+            guard isValid(signatureBytes, over: Data(prefix.challenge.utf8), by: certificate.publicKey) else {
+                return "The signature does not verify against the certificate in the RDAP record"
+            }
+            return nil
+        case nil:
+            return "Unknown verification method '\(prefix.verificationMethod)'"
+        }
+    }
+
+    /// The first certificate in RDAP remark lines, re-wrapped as PEM. RIR
+    /// databases reflow remarks, so the body is rebuilt from its base64
+    /// characters rather than trusted line by line.
+    static func certificatePEM(in remarks: [String]) -> String? {
+        let text = remarks.joined(separator: "\n")
+        let begin = "-----BEGIN CERTIFICATE-----"
+        let end = "-----END CERTIFICATE-----"
+        guard let start = text.range(of: begin),
+            let stop = text.range(of: end, range: start.upperBound..<text.endIndex)
+        else { return nil }
+        let base64 = text[start.upperBound..<stop.lowerBound].filter {
+            $0.isASCII && ($0.isLetter || $0.isNumber || $0 == "+" || $0 == "/" || $0 == "=")
+        }
+        guard !base64.isEmpty else { return nil }
+        var lines: [String] = [begin]
+        var rest = Substring(base64)
+        while !rest.isEmpty {
+            lines.append(String(rest.prefix(64)))
+            rest = rest.dropFirst(64)
+        }
+        lines.append(end)
+        return lines.joined(separator: "\n")
+    }
+
+    /// ECDSA signatures are DER; Ed25519 raw. RSA keys are not accepted.
+    static func isValid(_ signature: Data, over message: Data, by key: Certificate.PublicKey) -> Bool {
+        if let p256 = P256.Signing.PublicKey(key) {
+            guard let parsed = try? P256.Signing.ECDSASignature(derRepresentation: signature) else { return false }
+            return p256.isValidSignature(parsed, for: message)
+        }
+        if let p384 = P384.Signing.PublicKey(key) {
+            guard let parsed = try? P384.Signing.ECDSASignature(derRepresentation: signature) else { return false }
+            return p384.isValidSignature(parsed, for: message)
+        }
+        if let ed25519 = Curve25519.Signing.PublicKey(key) {
+            return ed25519.isValidSignature(signature, for: message)
+        }
+        return false
+    }
+}
+
+extension Application {
+    private struct BYOIPConfigKey: StorageKey {
+        typealias Value = BYOIPConfig
+    }
+
+    private struct BYOIPEvidenceSourceKey: StorageKey {
+        typealias Value = any BYOIPEvidenceSource
+    }
+
+    /// Falls back to the environment, like `proxyTrust`.
+    var byoipConfig: BYOIPConfig {
+        get { storage[BYOIPConfigKey.self] ?? .fromEnvironment() }
+        set { setStorageValue(BYOIPConfigKey.self, to: newValue) }
+    }
+
+    /// Tests replace this; everything else reads the configured services.
+    var byoipEvidence: any BYOIPEvidenceSource {
+        get {
+            storage[BYOIPEvidenceSourceKey.self]
+                ?? HTTPBYOIPEvidenceSource(config: byoipConfig, client: http.client.shared)
+        }
+        set { setStorageValue(BYOIPEvidenceSourceKey.self, to: newValue) }
+    }
+}
@@ -0,0 +1,550 @@
+import Fluent
+import Foundation
+import NIOConcurrencyHelpers
+import StratoShared
+import Vapor
+
+/// Runs code-interpreter sessions (`/api/code-sessions`) on sandboxes.
+///
+/// An execution is a sandbox exec of `strato-kernel execute` with the snippet
+/// on stdin: the bridge hands it to the kernel the sandbox's workload keeps
+/// running (`strato-kernel serve`), and prints one `CodeExecutionResult`.
+/// Like every exec it needs this replica to hold the agent's socket.
+///
+/// A periodic sweep — cluster-singleton per pass via the
+/// `lock:sweep:code_sessions` Valkey lock — walks each session through its
+/// idle lifecycle with `advance`: an idle session is checkpointed and
+/// stopped, the next execution restores it in place, and one left
+/// checkpointed past `checkpointRetentionHours` is deleted with its sandbox
+/// down the expiry path. The sweep is level-triggered: a pass that finds a
+/// checkpoint or restore still in flight simply looks again next time.
+final class CodeSessionService: @unchecked Sendable {
+    struct Configuration: Sendable {
+        /// The OCI image per language; a language without one is disabled.
+        var images: [CodeSessionLanguage: String]
+        /// How long a checkpointed session is kept before it is deleted.
+        var checkpointRetentionHours: Int
+        var sweepIntervalSeconds: Int
+
+        static func fromEnvironment() -> Configuration {
+            var images: [CodeSessionLanguage: String] = [:]
+            for language in CodeSessionLanguage.allCases {
+                let variable = "CODE_SESSION_IMAGE_\(language.rawValue.uppercased())"
+                if let image = Environment.get(variable)?.trimmingCharacters(in: .whitespaces), !image.isEmpty {
+                    images[language] = image
+                }
+            }
+            return Configuration(
+                images: images,
+                checkpointRetentionHours:
+                    Environment.get("CODE_SESSION_CHECKPOINT_RETENTION_HOURS").flatMap(Int.init) ?? 24,
+                sweepIntervalSeconds: Environment.get("CODE_SESSION_SWEEP_INTERVAL_SECONDS").flatMap(Int.init) ?? 30
+            )
+        }
+    }
+
+    /// The bridge inside every code-interpreter image.
+    static let kernelCommand = ["strato-kernel", "execute"]
+
+    /// Largest result document accepted from the bridge. Files produced ride
+    /// inline, so this is well above any sensible stdout.
+    static let maxResultBytes = 16 * 1024 * 1024
+
+    /// Bridge stderr kept for error messages.
+    static let maxDiagnosticBytes = 64 * 1024
+
+    /// Time the bridge gets past the execution timeout to interrupt the
+    /// kernel and report, before the control plane gives up on it.
+    static let executionGraceSeconds = 10
+
+    let app: Application
+    var configuration: Configuration
+    private let sweepTask: NIOLockedValueBox<Task<Void, Never>?> = .init(nil)
+    /// Sessions with an execution in flight on this replica.
+    private let executing: NIOLockedValueBox<Set<UUID>> = .init([])
+
+    var sweepLockTTLSeconds: Int { max(configuration.sweepIntervalSeconds - 2, 2) }
+
+    init(app: Application, configuration: Configuration = .fromEnvironment()) {
+        self.app = app
+        self.configuration = configuration
+    }
+
+    private var sweepEnabled: Bool {
+        Environment.get("CODE_SESSION_SWEEP_ENABLED").flatMap(Bool.init)
+            ?? (app.environment != .testing)
+    }
+
+    // MARK: - Sweep lifecycle
+
+    /// Arm the periodic sweep. Called once from the boot lifecycle; disabled
+    /// in the testing environment (tests drive `sweepOnce` directly).
+    func startSweep() {
+        sweepTask.withLockedValue { task in
+            guard task == nil else { return }
+            task = Task { [weak self] in
+                guard let self, self.sweepEnabled else { return }
+                let interval = self.configuration.sweepIntervalSeconds
+                while !Task.isCancelled {
+                    await self.sweepOnce()
+                    do {
+                        try await Task.sleep(for: .seconds(interval))
+                    } catch {
+                        break  // cancelled
+                    }
+                }
+            }
+        }
+    }
+
+    func shutdown() {
+        sweepTask.withLockedValue { task in
+            task?.cancel()
+            task = nil
+        }
+    }
+
+    /// One pass over every session. `acquiringLock: false` skips the
+    /// cluster-singleton lock, for tests.
+    func sweepOnce(acquiringLock: Bool = true, now: Date = Date()) async {
+        if acquiringLock {
+            guard await app.coordination.acquireSweepLock("code_sessions", ttlSeconds: sweepLockTTLSeconds) else {
+                app.logger.debug("Skipping code session sweep; lock held by another control-plane instance")
+                return
+            }
+        }
+
+        guard let db = app.liveDB else { return }
+        do {
+            let sessions = try await CodeSession.query(on: db).with(\.$sandbox).all()
+            for session in sessions {
+                await advance(session, sandbox: session.sandbox, now: now, on: db)
+            }
+        } catch {
+            app.logger.error("Code session sweep failed: \(error)")
+        }
+    }
+
+    // MARK: - Idle lifecycle
+
+    /// Moves one session along its idle lifecycle as far as its sandbox
+    /// allows right now. Safe to call from a request as well as the sweep:
+    /// every step re-derives from stored state, and the operations it starts
+    /// reject a second concurrent start with 409.
+    func advance(_ session: CodeSession, sandbox: Sandbox, now: Date = Date(), on db: any Database) async {
+        guard sandbox.desiredStatus != .absent else { return }  // already going
+        do {
+            switch session.state {
+            case .active:
+                guard session.isIdle(at: now) else { return }
+                switch sandbox.status {
+                case .running:
+                    try await checkpoint(session, sandbox: sandbox, on: db)
+                case .exited, .error:
+                    await tearDown(session, sandbox: sandbox, because: "sandbox is not running", on: db)
+                default:
+                    return  // still booting; idle time starts once it runs code
+                }
+
+            case .checkpointing:
+                var snapshot: SandboxSnapshot?
+                if let snapshotID = session.checkpointSnapshotId {
+                    snapshot = try await SandboxSnapshot.find(snapshotID, on: db)
+                }
+                switch snapshot?.status {
+                case .ready:
+                    session.state = .checkpointed
+                    session.checkpointedAt = now
+                    try await session.save(on: db)
+                case .creating:
+                    return
+                default:
+                    await tearDown(session, sandbox: sandbox, because: "idle checkpoint failed", on: db)
+                }
+
+            case .checkpointed:
+                let since = session.checkpointedAt ?? session.updatedAt ?? now
+                let retention = TimeInterval(configuration.checkpointRetentionHours) * 3600
+                if now.timeIntervalSince(since) >= retention {
+                    await tearDown(session, sandbox: sandbox, because: "checkpoint retention elapsed", on: db)
+                }
+
+            case .resuming:
+                let sandboxID = try sandbox.requireID()
+                let pendingRestore = try await ResourceOperation.query(on: db)
+                    .filter(\.$resourceKind == .sandbox)
+                    .filter(\.$resourceID == sandboxID)
+                    .filter(\.$status == .pending)
+                    .filter(\.$kind == .restore)
+                    .first()
+                guard pendingRestore == nil else { return }
+                guard let current = try await Sandbox.find(sandboxID, on: db), current.isRunning else {
+                    await tearDown(session, sandbox: sandbox, because: "resume failed", on: db)
+                    return
+                }
+                let previousCheckpoint = session.checkpointSnapshotId
+                session.state = .active
+                session.lastActivityAt = now
+                session.checkpointSnapshotId = nil
+                session.checkpointedAt = nil
+                try await session.save(on: db)
+                await dropCheckpoint(previousCheckpoint, of: current, for: session, on: db)
+            }
+        } catch {
+            app.logger.warning(
+                "Code session lifecycle step failed: \(error)",
+                metadata: ["codeSessionId": .string(session.id?.uuidString ?? "")])
+        }
+    }
+
+    /// Checkpoint-and-stop an idle session. An agent that cannot snapshot
+    /// leaves nothing to resume from, so the session is torn down instead.
+    private func checkpoint(_ session: CodeSession, sandbox: Sandbox, on db: any Database) async throws {
+        guard let agentId = sandbox.hypervisorId, sandbox.observedGeneration > 0 else { return }
+        do {
+            try await SandboxSnapshotService.requireCapableAgent(agentId, app: app)
+        } catch {
+            await tearDown(session, sandbox: sandbox, because: "idle and its agent cannot checkpoint", on: db)
+            return
+        }
+        guard let project = try await Project.find(sandbox.$project.id, on: db) else { return }
+
+        // Attributed to the session's creator: the snapshot is theirs to see,
+        // and its storage is charged to their project like any checkpoint.
+        let (_, snapshot) = try await SandboxSnapshotController.beginCheckpoint(
+            of: sandbox, in: project, agentId: agentId,
+            name: "code-session-idle-\(Int(Date().timeIntervalSince1970))",
+            stop: true, userID: session.$createdBy.id, on: db, app: app)
+        session.state = .checkpointing
+        session.checkpointSnapshotId = try snapshot.requireID()
+        try await session.save(on: db)
+
+        app.logger.info(
+            "Checkpointing idle code session",
+            metadata: [
+                "codeSessionId": .string(session.id?.uuidString ?? ""),
+                "sandboxId": .string(sandbox.id?.uuidString ?? ""),
+            ])
+    }
+
+    /// Restore a checkpointed session in place, for an execution that found
+    /// it idle. The caller reports `resuming` and the client retries.
+    func resume(_ session: CodeSession, sandbox: Sandbox, userID: UUID, on db: any Database) async throws {
+        guard session.state == .checkpointed, let snapshotID = session.checkpointSnapshotId else { return }
+        guard let agentId = sandbox.hypervisorId else {
+            throw Abort(.conflict, reason: "Session's sandbox is not placed on any agent")
+        }
+        do {
+            try await SandboxSnapshotService.requireCapableAgent(agentId, app: app)
+        } catch let error as SandboxSnapshotServiceError {
+            throw Abort(.conflict, reason: error.localizedDescription)
+        }
+        _ = try await SandboxSnapshotController.beginRestore(
+            of: sandbox, from: snapshotID, agentId: agentId, userID: userID, on: db, app: app,
+            admittedBy: app.admission)
+        session.state = .resuming
+        try await session.save(on: db)
+    }
+
+    /// Best-effort removal of a checkpoint the session has resumed from, so
+    /// checkpoints do not pile up against the storage quota.
+    private func dropCheckpoint(
+        _ snapshotID: UUID?, of sandbox: Sandbox, for session: CodeSession, on db: any Database
+    ) async {
+        guard let snapshotID, let snapshot = try? await SandboxSnapshot.find(snapshotID, on: db),
+            snapshot.canDelete
+        else { return }
+        do {
+            _ = try await SandboxSnapshotController.beginSnapshotDeletion(
+                of: snapshot, sandbox: sandbox, userID: session.$createdBy.id, on: db, app: app)
+        } catch {
+            app.logger.debug(
+                "Leaving a resumed code session's checkpoint in place: \(error)",
+                metadata: ["snapshotId": .string(snapshotID.uuidString)])
+        }
+    }
+
+    private func tearDown(_ session: CodeSession, sandbox: Sandbox, because reason: String, on db: any Database) async {
+        await app.agentService.expireSandbox(sandbox, reason: .codeSession(reason), on: db)
+    }
+
+    // MARK: - Execution
+
+    /// Run `code` in the session's kernel and return what it produced. The
+    /// session must be active on a running sandbox whose agent socket is on
+    /// this replica; one execution runs at a time.
+    func execute(
+        _ session: CodeSession,
+        sandbox: Sandbox,
+        code: String,
+        timeoutSeconds: Int,
+        userID: UUID,
+        on req: Request
+    ) async throws -> CodeExecutionResponse {
+        let sessionID = try session.requireID()
+        let sandboxID = try sandbox.requireID()
+        let agent = try await SandboxController.execAgent(for: sandbox, on: req)
+
+        let claimed = executing.withLockedValue { $0.insert(sessionID).inserted }
+        guard claimed, !session.isExecuting() else {
+            if claimed { executing.withLockedValue { _ = $0.remove(sessionID) } }
+            throw Abort(.conflict, reason: "An execution is already running in this session")
+        }
+        defer { executing.withLockedValue { _ = $0.remove(sessionID) } }
+
+        let deadline = timeoutSeconds + Self.executionGraceSeconds
+        let started = Date()
+        session.executingUntil = started.addingTimeInterval(TimeInterval(deadline))
+        session.lastActivityAt = started
+        try await session.save(on: req.db)
+
+        let outcome: CodeExecutionCollector.Outcome
+        do {
+            outcome = try await run(
+                code: code, timeoutSeconds: timeoutSeconds, deadlineSeconds: deadline,
+                sandboxID: sandboxID, agentKey: agent.identity.key, userID: userID)
+        } catch {
+            try? await finishExecution(session, ran: false, on: req.db)
+            throw error
+        }
+
+        let result: CodeExecutionResult
+        switch outcome {
+        case .exited(0, let stdout, _):
+            guard let decoded = try? JSONDecoder().decode(CodeExecutionResult.self, from: stdout) else {
+                try? await finishExecution(session, ran: true, on: req.db)
+                throw Abort(.badGateway, reason: "The kernel returned an unreadable result")
+            }
+            result = decoded
+        case .exited(let status, _, let stderr):
+            try? await finishExecution(session, ran: false, on: req.db)
+            let detail = String(decoding: stderr.prefix(1000), as: UTF8.self)
+            throw Abort(.badGateway, reason: "The kernel bridge failed (exit \(status)): \(detail)")
+        case .closed(let reason):
+            try? await finishExecution(session, ran: false, on: req.db)
+            throw Abort(.badGateway, reason: "Execution failed: \(reason)")
+        case .timedOut:
+            try? await finishExecution(session, ran: false, on: req.db)
+            throw Abort(.gatewayTimeout, reason: "The kernel did not answer within \(deadline)s")
+        }
+
+        try await finishExecution(session, ran: true, on: req.db)
+        return CodeExecutionResponse(
+            sessionId: sessionID,
+            executionCount: session.executionCount,
+            status: result.status,
+            stdout: result.stdout,
+            stderr: result.stderr,
+            outputs: result.outputs,
+            files: result.files,
+            error: result.error,
+            durationMs: Int(Date().timeIntervalSince(started) * 1000))
+    }
+
+    private func finishExecution(_ session: CodeSession, ran: Bool, on db: any Database) async throws {
+        session.executingUntil = nil
+        session.lastActivityAt = Date()
+        if ran {
+            session.executionCount += 1
+        }
+        try await session.save(on: db)
+    }
+
+    /// One exec of the kernel bridge: start it, wait for the spawn, send the
+    /// request on stdin, and collect until it ends or the deadline passes.
+    private func run(
+        code: String,
+        timeoutSeconds: Int,
+        deadlineSeconds: Int,
+        sandboxID: UUID,
+        agentKey: String,
+        userID: UUID
+    ) async throws -> CodeExecutionCollector.Outcome {
+        struct KernelRequest: Encodable {
+            let code: String
+            let timeoutSeconds: Int
+        }
+        let input = try JSONEncoder().encode(KernelRequest(code: code, timeoutSeconds: timeoutSeconds))
+
+        let manager = app.sandboxExecSessionManager
+        let pending = manager.createPendingSession(
+            sandboxId: sandboxID.uuidString,
+            agentKey: agentKey,
+            userId: userID.uuidString,
+            command: Self.kernelCommand,
+            env: nil,
+            workingDir: nil,
+            tty: false,
+            rows: nil,
+            cols: nil)
+        let collector = CodeExecutionCollector(
+            maxOutputBytes: Self.maxResultBytes, maxDiagnosticBytes: Self.maxDiagnosticBytes)
+        _ = try manager.attachSession(
+            sessionId: pending.sessionId, sandboxId: sandboxID.uuidString, userId: userID.uuidString,
+            frontend: collector)
+
+        let timer = Task {
+            try await Task.sleep(for: .seconds(deadlineSeconds))
+            collector.finish(.timedOut)
+        }
+        defer { timer.cancel() }
+
+        do {
+            try await manager.sendExecStart(for: pending)
+            if await collector.waitUntilStarted() {
+                try await manager.routeInput(sessionId: pending.sessionId, data: input, eof: true)
+            }
+        } catch {
+            manager.removeSession(sessionId: pending.sessionId)
+            throw Abort(.badGateway, reason: "Failed to start the kernel bridge: \(error.localizedDescription)")
+        }
+
+        let outcome = await collector.outcome()
+        switch outcome {
+        case .exited:
+            break
+        case .closed, .timedOut:
+            // Ended on our side (deadline, oversized result) or the agent's;
+            // a close for a session the agent already dropped is a no-op.
+            try? await manager.sendExecClose(sessionId: pending.sessionId, reason: "code execution ended")
+            manager.removeSession(sessionId: pending.sessionId)
+        }
+        return outcome
+    }
+}
+
+/// The server-side end of a kernel-bridge exec: buffers stdout (the result
+/// document) and stderr (diagnostics) and hands back how the exec ended.
+final class CodeExecutionCollector: SandboxExecFrontend, @unchecked Sendable {
+    enum Outcome: Sendable {
+        case exited(Int, stdout: Data, stderr: Data)
+        case closed(String)
+        case timedOut
+    }
+
+    private struct State {
+        var stdout = Data()
+        var stderr = Data()
+        var started = false
+        var outcome: Outcome?
+        var startWaiters: [CheckedContinuation<Bool, Never>] = []
+        var outcomeWaiters: [CheckedContinuation<Outcome, Never>] = []
+    }
+
+    private let maxOutputBytes: Int
+    private let maxDiagnosticBytes: Int
+    private let state = NIOLockedValueBox(State())
+
+    init(maxOutputBytes: Int, maxDiagnosticBytes: Int) {
+        self.maxOutputBytes = maxOutputBytes
+        self.maxDiagnosticBytes = maxDiagnosticBytes
+    }
+
+    /// True once the process spawned; false if the exec ended first.
+    func waitUntilStarted() async -> Bool {
+        await withCheckedContinuation { continuation in
+            let ready: Bool? = state.withLockedValue { state in
+                if state.started { return true }
+                if state.outcome != nil { return false }
+                state.startWaiters.append(continuation)
+                return nil
+            }
+            if let ready { continuation.resume(returning: ready) }
+        }
+    }
+
+    func outcome() async -> Outcome {
+        await withCheckedContinuation { continuation in
+            let outcome: Outcome? = state.withLockedValue { state in
+                if let outcome = state.outcome { return outcome }
+                state.outcomeWaiters.append(continuation)
+                return nil
+            }
+            if let outcome { continuation.resume(returning: outcome) }
+        }
+    }
+
+    /// Settle the exec; the first outcome wins.
+    func finish(_ outcome: Outcome) {
+        let (startWaiters, outcomeWaiters) = state.withLockedValue { state in
+            guard state.outcome == nil else {
+                return ([CheckedContinuation<Bool, Never>](), [CheckedContinuation<Outcome, Never>]())
+            }
+            state.outcome = outcome
+            defer {
+                state.startWaiters = []
+                state.outcomeWaiters = []
+            }
+            return (state.startWaiters, state.outcomeWaiters)
+        }
+        for waiter in startWaiters { waiter.resume(returning: false) }
+        for waiter in outcomeWaiters { waiter.resume(returning: outcome) }
+    }
+
+    // MARK: SandboxExecFrontend
+
+    func execStarted() {
+        let waiters = state.withLockedValue { state in
+            state.started = true
+            defer { state.startWaiters = [] }
+            return state.startWaiters
+        }
+        for waiter in waiters { waiter.resume(returning: true) }
+    }
+
+    func execOutput(_ data: Data, stream: String) {
+        let overflowed = state.withLockedValue { state -> Bool in
+            guard state.outcome == nil else { return false }
+            if stream == "stderr" {
+                state.stderr.append(data.prefix(max(maxDiagnosticBytes - state.stderr.count, 0)))
+                return false
+            }
+            state.stdout.append(data)
+            return state.stdout.count > maxOutputBytes
+        }
+        if overflowed {
+            finish(.closed("the result exceeded \(maxOutputBytes) bytes"))
+        }
+    }
+
+    func execExited(exitCode: Int) {
+        let (stdout, stderr) = state.withLockedValue { ($0.stdout, $0.stderr) }
+        finish(.exited(exitCode, stdout: stdout, stderr: stderr))
+    }
+
+    func execClosed(reason: String) {
+        finish(.closed(reason))
+    }
+
+    /// Code-session execs are never shared.
+    func execNotice(_ text: String) {}
+}
+
+// MARK: - Application accessor / lifecycle
+
+extension Application {
+    private struct CodeSessionServiceKey: StorageKey, LockKey {
+        typealias Value = CodeSessionService
+    }
+
+    var codeSessions: CodeSessionService {
+        lazyService(CodeSessionServiceKey.self) { CodeSessionService(app: self) }
+    }
+
+    /// The code session service if something already created it, so
+    /// shutdown does not instantiate it just to shut it down.
+    var codeSessionServiceIfCreated: CodeSessionService? {
+        storage[CodeSessionServiceKey.self]
+    }
+}
+
+/// Arms the code session sweep at boot and cancels it at shutdown.
+struct CodeSessionLifecycleHandler: LifecycleHandler {
+    func didBootAsync(_ application: Application) async throws {
+        application.codeSessions.startSweep()
+    }
+
+    func shutdownAsync(_ application: Application) async {
+        application.codeSessionServiceIfCreated?.shutdown()
+    }
+}
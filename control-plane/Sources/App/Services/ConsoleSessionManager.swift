@@ -3,14 +3,56 @@ import Vapor
 import StratoShared
 import NIOConcurrencyHelpers
 
-/// Manages console sessions between frontend WebSockets and agents
+/// The client end of a console session: the browser's WebSocket, or an SSH
+/// channel of the console gateway (`SSHConsoleGateway`).
+protocol ConsoleTerminal: Sendable {
+    /// Console output from the VM.
+    func write(_ bytes: [UInt8])
+    /// The agent attached the console; input now reaches the VM.
+    func consoleReady()
+    /// The session ended underneath the client (agent gone, session torn
+    /// down); report `reason` and close.
+    func terminate(reason: String)
+    /// A line about the session itself — someone joined, left, or had their
+    /// access changed — kept apart from the console's own output.
+    func notice(_ text: String)
+}
+
+/// A browser console: bytes as binary frames, `ready`, `notice: …` and
+/// `error: …` as text.
+struct WebSocketConsoleTerminal: ConsoleTerminal {
+    let websocket: WebSocket
+
+    func write(_ bytes: [UInt8]) {
+        websocket.send(bytes)
+    }
+
+    func consoleReady() {
+        websocket.send("ready")
+    }
+
+    func terminate(reason: String) {
+        websocket.send("error: \(reason)")
+        _ = websocket.close(code: .normalClosure)
+    }
+
+    func notice(_ text: String) {
+        websocket.send("notice: \(text)")
+    }
+}
+
+/// Manages console sessions between frontend terminals and agents
 /// This is NOT an actor to avoid event loop conflicts with NIO WebSockets
 final class ConsoleSessionManager: @unchecked Sendable {
     private let lock = NIOLock()
     private let app: Application
 
-    /// Maps sessionId -> frontend WebSocket
-    private var frontendConnections: [String: WebSocket] = [:]
+    /// Maps sessionId -> frontend terminal
+    private var frontendConnections: [String: any ConsoleTerminal] = [:]
+
+    /// Maps sessionId -> who the session is shared with: the owner's
+    /// invitations and the participants attached besides the owner's terminal.
+    private var shares: [String: SessionShare<any ConsoleTerminal>] = [:]
 
     /// Maps sessionId -> ConsoleSessionInfo
     private var sessions: [String: ConsoleSessionInfo] = [:]
@@ -23,6 +65,8 @@ final class ConsoleSessionManager: @unchecked Sendable {
         let vmId: String
         let agentKey: String
         let userId: String?
+        /// The owner's username, for the notices participants see.
+        let username: String?
         let createdAt: Date
     }
 
@@ -38,7 +82,8 @@ final class ConsoleSessionManager: @unchecked Sendable {
         vmId: String,
         agentKey: String,
         userId: String?,
-        websocket: WebSocket?
+        username: String? = nil,
+        terminal: (any ConsoleTerminal)?
     ) {
         lock.withLock {
             let sessionInfo = ConsoleSessionInfo(
@@ -46,12 +91,13 @@ final class ConsoleSessionManager: @unchecked Sendable {
                 vmId: vmId,
                 agentKey: agentKey,
                 userId: userId,
+                username: username,
                 createdAt: Date()
             )
 
             sessions[sessionId] = sessionInfo
-            if let websocket {
-                frontendConnections[sessionId] = websocket
+            if let terminal {
+                frontendConnections[sessionId] = terminal
             }
 
             if vmSessions[vmId] == nil {
@@ -69,24 +115,215 @@ final class ConsoleSessionManager: @unchecked Sendable {
             ])
     }
 
-    /// Remove a console session
+    /// Remove a console session. Its participants are told the session ended,
+    /// and input still buffered for the audit log is flushed.
     func removeSession(sessionId: String) {
-        lock.withLock {
-            if let sessionInfo = sessions.removeValue(forKey: sessionId) {
-                frontendConnections.removeValue(forKey: sessionId)
-                vmSessions[sessionInfo.vmId]?.remove(sessionId)
+        let (orphaned, records): ([any ConsoleTerminal], [AuditRecord]) = lock.withLock {
+            guard let sessionInfo = sessions.removeValue(forKey: sessionId) else { return ([], []) }
+            frontendConnections.removeValue(forKey: sessionId)
+            vmSessions[sessionInfo.vmId]?.remove(sessionId)
+
+            if vmSessions[sessionInfo.vmId]?.isEmpty == true {
+                vmSessions.removeValue(forKey: sessionInfo.vmId)
+            }
+
+            app.logger.info(
+                "Console session removed",
+                metadata: [
+                    "sessionId": .string(sessionId),
+                    "vmId": .string(sessionInfo.vmId),
+                ])
+            guard var share = shares.removeValue(forKey: sessionId) else { return ([], []) }
+            return (share.terminals, inputRecords(share.drainInput(), share: share, session: sessionInfo))
+        }
 
-                if vmSessions[sessionInfo.vmId]?.isEmpty == true {
-                    vmSessions.removeValue(forKey: sessionInfo.vmId)
+        for participant in orphaned {
+            participant.terminate(reason: "console session ended")
+        }
+        if !records.isEmpty {
+            Task { await app.recordSharedSessionAudit(records) }
+        }
+    }
+
+    // MARK: - Sharing
+
+    /// The VM's sessions `userId` owns or was invited to, newest first. The
+    /// owner sees each session's invitations; an invitee sees only its own
+    /// access.
+    func sharedSessions(vmId: String, for userId: UUID) -> [SharedSessionResponse] {
+        lock.withLock {
+            let sessionIds = vmSessions[vmId] ?? []
+            return sessionIds.compactMap { sessionId -> SharedSessionResponse? in
+                guard let session = sessions[sessionId] else { return nil }
+                let share = shares[sessionId]
+                if Self.isOwner(userId, of: session) {
+                    return SharedSessionResponse(
+                        id: sessionId, ownerId: session.userId.flatMap(UUID.init(uuidString:)),
+                        createdAt: session.createdAt, access: nil,
+                        participants: share?.invitationResponses ?? [])
                 }
+                guard let invitation = share?.invitations[userId] else { return nil }
+                return SharedSessionResponse(
+                    id: sessionId, ownerId: session.userId.flatMap(UUID.init(uuidString:)),
+                    createdAt: session.createdAt, access: invitation.access, participants: [])
+            }
+            .sorted { $0.createdAt > $1.createdAt }
+        }
+    }
+
+    /// The session's invitations, for its owner.
+    func participants(sessionId: String, ownerId: UUID) throws -> [SessionParticipantResponse] {
+        try lock.withLock {
+            _ = try ownedSessionLocked(sessionId: sessionId, ownerId: ownerId)
+            return shares[sessionId]?.invitationResponses ?? []
+        }
+    }
+
+    /// Invite `userId` into the owner's session, or change the access of an
+    /// existing invitation — live, for terminals the user already has attached.
+    /// Checking that the invitee may open the console at all is the caller's
+    /// job; `join` is where the invitation is used.
+    func invite(
+        sessionId: String, ownerId: UUID, userId: UUID, username: String, access: SessionAccess,
+        organizationID: UUID?
+    ) throws -> SessionParticipantResponse {
+        let (invitation, connected, changed, audience) = try lock.withLock {
+            _ = try ownedSessionLocked(sessionId: sessionId, ownerId: ownerId)
+            var share = shares[sessionId] ?? SessionShare()
+            let previous = share.invitations[userId]?.access
+            let invitation = share.invite(
+                userId: userId, username: username, access: access, organizationID: organizationID)
+            shares[sessionId] = share
+            let changed = previous != nil && previous != access && share.isConnected(userId)
+            return (invitation, share.isConnected(userId), changed, audienceLocked(sessionId: sessionId))
+        }
+        if changed {
+            for terminal in audience {
+                terminal.notice("\(username) is now \(access.label)")
+            }
+        }
+        return SessionParticipantResponse(invitation, connected: connected)
+    }
+
+    /// Withdraw an invitation. Every terminal the user has attached —
+    /// joined or observing — is closed at once; everyone else is told.
+    func revoke(sessionId: String, ownerId: UUID, userId: UUID) throws {
+        let (revoked, username, records, audience) = try lock.withLock {
+            let session = try ownedSessionLocked(sessionId: sessionId, ownerId: ownerId)
+            guard var share = shares[sessionId], let (username, revoked) = share.revoke(userId: userId) else {
+                throw ConsoleSessionError.notInvited(sessionId)
+            }
+            let records = inputRecords(share.drainInput(from: userId), share: share, session: session)
+            shares[sessionId] = share
+            return (revoked, username, records, audienceLocked(sessionId: sessionId))
+        }
+        for terminal in revoked {
+            terminal.terminate(reason: "access revoked by the session owner")
+        }
+        if !revoked.isEmpty {
+            for terminal in audience {
+                terminal.notice("\(username) was removed from the session")
+            }
+        }
+        if !records.isEmpty {
+            Task { await app.recordSharedSessionAudit(records) }
+        }
+    }
+
+    /// Attach an invited user's terminal. The owner may also join their own
+    /// session, from another device, with full access. Returns the
+    /// participant ID and the access the terminal has.
+    func join(
+        sessionId: String, userId: UUID, username: String, terminal: any ConsoleTerminal
+    ) throws -> (participantId: UUID, access: SessionAccess) {
+        let (participantId, access, audience) = try lock.withLock {
+            guard let session = sessions[sessionId] else {
+                throw ConsoleSessionError.sessionNotFound(sessionId)
+            }
+            var share = shares[sessionId] ?? SessionShare()
+            let access: SessionAccess
+            if Self.isOwner(userId, of: session) {
+                access = .readWrite
+            } else if let invitation = share.invitations[userId] {
+                access = invitation.access
+            } else {
+                throw ConsoleSessionError.notInvited(sessionId)
+            }
+            let audience = audienceLocked(sessionId: sessionId)
+            let participantId = share.attach(userId: userId, username: username, access: access, terminal: terminal)
+            shares[sessionId] = share
+            return (participantId, access, audience)
+        }
+        for other in audience {
+            other.notice("\(username) joined (\(access.label))")
+        }
+        return (participantId, access)
+    }
 
-                app.logger.info(
-                    "Console session removed",
-                    metadata: [
-                        "sessionId": .string(sessionId),
-                        "vmId": .string(sessionInfo.vmId),
-                    ])
+    /// Attach a read-only observer (the SSH gateway's `observe`). Watching a
+    /// session takes what joining it does: owning it, or an invitation from
+    /// its owner, whatever the invitation's access. Returns the participant
+    /// ID.
+    func addObserver(
+        sessionId: String, userId: UUID, username: String, terminal: any ConsoleTerminal
+    ) throws -> UUID {
+        let (participantId, audience) = try lock.withLock {
+            guard let session = sessions[sessionId] else {
+                throw ConsoleSessionError.sessionNotFound(sessionId)
             }
+            var share = shares[sessionId] ?? SessionShare()
+            guard Self.isOwner(userId, of: session) || share.invitations[userId] != nil else {
+                throw ConsoleSessionError.notInvited(sessionId)
+            }
+            let audience = audienceLocked(sessionId: sessionId)
+            let participantId = share.attach(userId: userId, username: username, access: .readOnly, terminal: terminal)
+            shares[sessionId] = share
+            return (participantId, audience)
+        }
+        for other in audience {
+            other.notice("\(username) is observing (read-only)")
+        }
+        return participantId
+    }
+
+    /// Detach a participant that left; the others are told.
+    func removeParticipant(sessionId: String, participantId: UUID) {
+        let left: (username: String, audience: [any ConsoleTerminal], records: [AuditRecord])? = lock.withLock {
+            guard let session = sessions[sessionId], var share = shares[sessionId],
+                let participant = share.detach(participantId)
+            else { return nil }
+            var records: [AuditRecord] = []
+            if !share.isConnected(participant.userId) {
+                records = inputRecords(share.drainInput(from: participant.userId), share: share, session: session)
+            }
+            shares[sessionId] = share
+            return (participant.username, audienceLocked(sessionId: sessionId), records)
+        }
+        guard let left else { return }
+        for other in left.audience {
+            other.notice("\(left.username) left")
+        }
+        if !left.records.isEmpty {
+            Task { await app.recordSharedSessionAudit(left.records) }
+        }
+    }
+
+    /// The audit record of a participant joining.
+    func joinRecord(sessionId: String, userId: UUID, username: String, access: SessionAccess) -> AuditRecord? {
+        lock.withLock {
+            guard let session = sessions[sessionId] else { return nil }
+            return SharedSessionAuditTarget(
+                resourceType: OperationResourceKind.virtualMachine.rawValue, resourceID: session.vmId,
+                sessionId: sessionId, kind: "console"
+            ).joinRecord(
+                userId: userId, username: username, access: access,
+                organizationID: shares[sessionId]?.organizationID)
+        }
+    }
+
+    func participantCount(sessionId: String) -> Int {
+        lock.withLock {
+            shares[sessionId]?.participants.count ?? 0
         }
     }
 
@@ -136,48 +373,52 @@ final class ConsoleSessionManager: @unchecked Sendable {
 
     /// Tear down every console session targeting `agentKey` because its
     /// socket is gone (crash, network drop, or graceful unregister). Each
-    /// attached browser gets a terminal error frame and a close — instead of
-    /// a silently frozen terminal whose keystrokes go nowhere.
+    /// attached terminal and participant gets an error and a close — instead
+    /// of a silently frozen terminal whose keystrokes go nowhere.
     func closeAllSessions(forAgent agentKey: String, reason: String) {
-        let closed: [(sessionId: String, websocket: WebSocket?)] = lock.withLock {
-            var closed: [(String, WebSocket?)] = []
+        let closed: [(sessionId: String, terminals: [any ConsoleTerminal])] = lock.withLock {
+            var closed: [(String, [any ConsoleTerminal])] = []
             for (sessionId, session) in sessions where session.agentKey == agentKey {
                 sessions.removeValue(forKey: sessionId)
-                let websocket = frontendConnections.removeValue(forKey: sessionId)
+                var terminals = shares.removeValue(forKey: sessionId)?.terminals ?? []
+                if let terminal = frontendConnections.removeValue(forKey: sessionId) {
+                    terminals.insert(terminal, at: 0)
+                }
                 vmSessions[session.vmId]?.remove(sessionId)
                 if vmSessions[session.vmId]?.isEmpty == true {
                     vmSessions.removeValue(forKey: session.vmId)
                 }
-                closed.append((sessionId, websocket))
+                closed.append((sessionId, terminals))
             }
             return closed
         }
 
-        for (sessionId, websocket) in closed {
+        for (sessionId, terminals) in closed {
             app.logger.info(
                 "Closed console session: agent disconnected",
                 metadata: [
                     "sessionId": .string(sessionId),
                     "agentKey": .string(agentKey),
                 ])
-            guard let websocket else { continue }
-            websocket.send("error: \(reason)")
-            _ = websocket.close(code: .normalClosure)
+            for terminal in terminals {
+                terminal.terminate(reason: reason)
+            }
         }
     }
 
     // MARK: - Data Routing
 
-    /// Resolve the browser socket for an agent-reported console event, but only
-    /// when the reporting agent owns the session. Without this an agent that
-    /// learned another session's (random) id could inject console bytes into,
-    /// or signal readiness on, a session it does not host. Mirrors the
-    /// ownership gate `SandboxExecSessionManager.frontendConnection` enforces.
+    /// Resolve the frontend terminal — and the session's participants — for an
+    /// agent-reported console event, but only when the reporting agent owns
+    /// the session. Without this an agent that learned another session's
+    /// (random) id could inject console bytes into, or signal readiness on, a
+    /// session it does not host. Mirrors the ownership gate
+    /// `SandboxExecSessionManager.frontendConnection` enforces.
     private func frontendConnection(
         sessionId: String, fromAgentKey agentKey: String, event: String
-    ) -> WebSocket? {
-        let (session, websocket) = lock.withLock {
-            (sessions[sessionId], frontendConnections[sessionId])
+    ) -> (terminal: (any ConsoleTerminal)?, participants: [any ConsoleTerminal])? {
+        let (session, terminal, participants) = lock.withLock {
+            (sessions[sessionId], frontendConnections[sessionId], shares[sessionId]?.terminals ?? [])
         }
         guard let session else {
             app.logger.debug(
@@ -195,23 +436,26 @@ final class ConsoleSessionManager: @unchecked Sendable {
                 ])
             return nil
         }
-        return websocket
+        return (terminal, participants)
     }
 
-    /// Route console data from agent to frontend(s)
+    /// Route console data from agent to the frontend and any participants
     func routeToFrontend(vmId: String, sessionId: String, data: Data, fromAgentKey agentKey: String) {
-        guard let ws = frontendConnection(sessionId: sessionId, fromAgentKey: agentKey, event: "data")
+        guard let targets = frontendConnection(sessionId: sessionId, fromAgentKey: agentKey, event: "data")
         else {
             return
         }
 
-        // Send binary data to frontend
-        ws.send([UInt8](data))
+        let bytes = [UInt8](data)
+        targets.terminal?.write(bytes)
+        for participant in targets.participants {
+            participant.write(bytes)
+        }
     }
 
     /// Notify the frontend that the console is ready for input
     func notifyFrontendReady(sessionId: String, fromAgentKey agentKey: String) {
-        guard let ws = frontendConnection(sessionId: sessionId, fromAgentKey: agentKey, event: "ready")
+        guard let terminal = frontendConnection(sessionId: sessionId, fromAgentKey: agentKey, event: "ready")?.terminal
         else {
             return
         }
@@ -222,19 +466,51 @@ final class ConsoleSessionManager: @unchecked Sendable {
                 "sessionId": .string(sessionId)
             ])
 
-        // Send a "ready" text message to the frontend
-        ws.send("ready")
+        terminal.consoleReady()
     }
 
-    /// Route user input from frontend to agent
+    /// Route the owner's input from frontend to agent
     func routeToAgent(sessionId: String, data: Data) async throws {
-        let sessionInfo: ConsoleSessionInfo? = lock.withLock {
-            sessions[sessionId]
+        let (sessionInfo, records): (ConsoleSessionInfo?, [AuditRecord]) = lock.withLock {
+            guard let session = sessions[sessionId] else { return (nil, []) }
+            guard let ownerId = session.userId.flatMap(UUID.init(uuidString:)) else { return (session, []) }
+            return (
+                session,
+                bufferInputLocked(data, sessionId: sessionId, userId: ownerId, username: session.username ?? "owner")
+            )
         }
 
         guard let session = sessionInfo else {
             throw ConsoleSessionError.sessionNotFound(sessionId)
         }
+        await app.recordSharedSessionAudit(records)
+
+        try await sendConsoleData(data, session: session)
+    }
+
+    /// Route a participant's input to the agent. Input from a read-only
+    /// participant — including one downgraded mid-session — is dropped.
+    func routeParticipantInput(sessionId: String, participantId: UUID, data: Data) async throws {
+        let (sessionInfo, records): (ConsoleSessionInfo?, [AuditRecord]) = lock.withLock {
+            guard let session = sessions[sessionId],
+                let participant = shares[sessionId]?.participants[participantId],
+                participant.access == .readWrite
+            else { return (nil, []) }
+            return (
+                session,
+                bufferInputLocked(
+                    data, sessionId: sessionId, userId: participant.userId, username: participant.username)
+            )
+        }
+
+        guard let session = sessionInfo else { return }
+        await app.recordSharedSessionAudit(records)
+
+        try await sendConsoleData(data, session: session)
+    }
+
+    private func sendConsoleData(_ data: Data, session: ConsoleSessionInfo) async throws {
+        let sessionId = session.sessionId
 
         // Send console data to agent via AgentService
         let message = ConsoleDataMessage(
@@ -292,6 +568,48 @@ final class ConsoleSessionManager: @unchecked Sendable {
 
     // MARK: - Private Helpers
 
+    private static func isOwner(_ userId: UUID, of session: ConsoleSessionInfo) -> Bool {
+        session.userId.flatMap(UUID.init(uuidString:)) == userId
+    }
+
+    /// Must be called while holding `lock`.
+    private func ownedSessionLocked(sessionId: String, ownerId: UUID) throws -> ConsoleSessionInfo {
+        guard let session = sessions[sessionId] else {
+            throw ConsoleSessionError.sessionNotFound(sessionId)
+        }
+        guard Self.isOwner(ownerId, of: session) else {
+            throw ConsoleSessionError.notSessionOwner(sessionId)
+        }
+        return session
+    }
+
+    /// Everyone attached to the session: the owner's terminal and every
+    /// participant. Must be called while holding `lock`.
+    private func audienceLocked(sessionId: String) -> [any ConsoleTerminal] {
+        (frontendConnections[sessionId].map { [$0] } ?? []) + (shares[sessionId]?.terminals ?? [])
+    }
+
+    /// Must be called while holding `lock`.
+    private func bufferInputLocked(_ data: Data, sessionId: String, userId: UUID, username: String) -> [AuditRecord] {
+        guard let session = sessions[sessionId], var share = shares[sessionId] else { return [] }
+        let text = share.bufferInput(data, from: userId, username: username)
+        shares[sessionId] = share
+        return inputRecords(text.map { [(userId, username, $0)] } ?? [], share: share, session: session)
+    }
+
+    private func inputRecords(
+        _ input: [(userId: UUID, username: String, text: String)], share: SessionShare<any ConsoleTerminal>,
+        session: ConsoleSessionInfo
+    ) -> [AuditRecord] {
+        let target = SharedSessionAuditTarget(
+            resourceType: OperationResourceKind.virtualMachine.rawValue, resourceID: session.vmId,
+            sessionId: session.sessionId, kind: "console")
+        return input.map {
+            target.inputRecord(
+                userId: $0.userId, username: $0.username, text: $0.text, organizationID: share.organizationID)
+        }
+    }
+
     private func sendMessageToAgent<T: WebSocketMessage>(_ message: T, agentKey: String) async throws {
         app.logger.debug("Looking up WebSocket for agent", metadata: ["agentKey": .string(agentKey)])
 
@@ -321,6 +639,8 @@ enum ConsoleSessionError: Error, LocalizedError {
     case sessionNotFound(String)
     case agentNotConnected(String)
     case vmNotRunning(String)
+    case notSessionOwner(String)
+    case notInvited(String)
 
     var errorDescription: String? {
         switch self {
@@ -330,6 +650,10 @@ enum ConsoleSessionError: Error, LocalizedError {
             return "Agent not connected: \(agentKey)"
         case .vmNotRunning(let vmId):
             return "VM is not running: \(vmId)"
+        case .notSessionOwner(let sessionId):
+            return "Only the user who opened console session \(sessionId) may share it"
+        case .notInvited(let sessionId):
+            return "Not invited to console session \(sessionId)"
         }
     }
 }
@@ -46,7 +46,13 @@ struct DesiredStateAssembler {
         }
         let vms = try await VM.query(on: db)
             .filter(\.$hypervisorId == agentId)
-            .with(\.$volumes)
+            // Attachments carry each VM's own view of its volumes (a
+            // multi-attach volume is held by several); volume types carry the
+            // I/O limits the agent applies, and replicas any NBD export a
+            // migrated volume is attached from.
+            .with(\.$volumeAttachments) {
+                $0.with(\.$volume) { $0.with(\.$typeDefinition).with(\.$replicas) }
+            }
             .with(\.$networkInterfaces) { $0.with(\.$addresses) }
             // Artifacts loaded too so buildImageInfo emits the typed artifact
             // set (kernel/rootfs distribution, issue #214) rather than the
@@ -63,8 +69,25 @@ struct DesiredStateAssembler {
             .with(\.$networkInterfaces) { $0.with(\.$addresses) }
             .all()
 
+        // The file shares this agent serves (wire v24). Omitted entirely —
+        // nil, "no opinion" — for older agents, which are never chosen to
+        // host one. Loaded before network scope so a network only a share
+        // uses is still realized here.
+        let sendFileShares =
+            agent.map { WireProtocol.supportsFileShares($0.wireProtocolVersion ?? 0) } ?? true
+        let fileShares: [FileShare]
+        if sendFileShares {
+            fileShares = try await FileShare.query(on: db)
+                .filter(\.$hypervisorId == agentId)
+                .with(\.$network)
+                .all()
+        } else {
+            fileShares = []
+        }
+
         let scope = try await networkAssemblyScope(
-            agentId: agentId, agent: agent, ownVMs: vms, ownSandboxes: sandboxes, on: db)
+            agentId: agentId, agent: agent, ownVMs: vms, ownSandboxes: sandboxes,
+            ownFileShares: fileShares, on: db)
 
         // DHCP/DNS config lives on the logical-network row. Query exactly the
         // union used by local workload specs and authoritative topology.
@@ -91,6 +114,15 @@ struct DesiredStateAssembler {
             securityGroupsByInterface = [:]
         }
 
+        // Volume-type I/O limits, likewise omitted for pre-v21 agents; VM
+        // placement refuses to put a VM with limited volumes on one.
+        let sendVolumeQoS = agent.map { WireProtocol.supportsVolumeQoS($0.wireProtocolVersion ?? 0) } ?? true
+
+        // TPM state keys, likewise only toward v32+ agents: an older one
+        // would keep the state in plaintext anyway, so it never learns them.
+        let sendTPMStateKeys =
+            agent.map { WireProtocol.supportsTPMStateEncryption($0.wireProtocolVersion ?? 0) } ?? true
+
         var entries: [DesiredVMState] = []
         for vm in vms {
             guard let vmId = vm.id else { continue }
@@ -98,10 +130,11 @@ struct DesiredStateAssembler {
             let spec = VMSpecBuilder.buildVMSpecWithVolumes(
                 from: vm,
                 image: image,
-                volumes: vm.volumes,
+                attachments: vm.volumeAttachments,
                 networkInterfaces: vm.networkInterfaces,
                 networks: networksByName,
-                securityGroupsByInterface: securityGroupsByInterface
+                securityGroupsByInterface: securityGroupsByInterface,
+                includeVolumeQoS: sendVolumeQoS
             )
 
             // Image download info lets the agent materialize a VM it doesn't
@@ -135,6 +168,11 @@ struct DesiredStateAssembler {
                     metadata: ["vmId": .string(vmId.uuidString)])
             }
 
+            var tpmStateKey: String?
+            if vm.tpmEnabled, sendTPMStateKeys, vm.desiredStatus != .absent {
+                tpmStateKey = self.tpmStateKey(for: vm)
+            }
+
             entries.append(
                 DesiredVMState(
                     vmId: vmId,
@@ -142,7 +180,10 @@ struct DesiredStateAssembler {
                     spec: spec,
                     desiredStatus: vm.desiredStatus,
                     generation: vm.generation,
-                    imageInfo: imageInfo
+                    imageInfo: imageInfo,
+                    healthCheck: vm.healthCheck,
+                    replacementCount: vm.replacementCount,
+                    tpmStateKey: tpmStateKey
                 ))
         }
 
@@ -165,11 +206,16 @@ struct DesiredStateAssembler {
         } else {
             floatingIPsByNetwork = [:]
         }
+        // IPv6-only networks (no subnet) are omitted for pre-v30 agents, which
+        // can't decode them; placement keeps their NICs off such agents.
+        let ipv6OnlySupported =
+            agent.map { WireProtocol.supportsIPv6OnlyNetworks($0.wireProtocolVersion ?? 0) } ?? true
         let networkStates =
             scope.networkNames
             .sorted()
             .compactMap { name -> DesiredNetworkState? in
                 guard let network = networksByName[name], let networkId = network.id else { return nil }
+                if network.isIPv6Only && !ipv6OnlySupported { return nil }
                 return DesiredNetworkState(
                     networkId: networkId,
                     name: network.name,
@@ -293,11 +339,195 @@ struct DesiredStateAssembler {
             securityGroups = nil
         }
 
+        let fileShareEntries: [DesiredFileShareState]? =
+            sendFileShares ? try await desiredFileShares(fileShares, on: db) : nil
+
+        // The buckets this agent's gateway serves (wire v25), with the same
+        // nil-for-older-agents rule as file shares.
+        let objectStorage: DesiredObjectStorageState?
+        if agent.map({ WireProtocol.supportsObjectStorage($0.wireProtocolVersion ?? 0) }) ?? true {
+            objectStorage = try await desiredObjectStorage(
+                try await Bucket.query(on: db).filter(\.$hypervisorId == agentId).all(), on: db)
+        } else {
+            objectStorage = nil
+        }
+
+        // The agent's overcommit policy (wire v26). Always explicit for a
+        // v26 agent: a removed policy goes out as ratio 1 with everything off,
+        // so KSM and reclaim stop rather than running on the last policy sent.
+        let memoryOvercommit: MemoryOvercommitPolicy? = agent.flatMap { agent in
+            guard WireProtocol.supportsMemoryOvercommit(agent.wireProtocolVersion ?? 0) else { return nil }
+            return agent.memoryOvercommit ?? MemoryOvercommitPolicy(ratio: 1)
+        }
+
         return DesiredStateMessage(
             vms: entries, sandboxes: sandboxEntries, networks: networkStates,
             networksAuthoritative: scope.authoritative,
             desiredAgentUpdate: await desiredAgentUpdateForSync(agent: agent),
-            securityGroups: securityGroups)
+            securityGroups: securityGroups,
+            fileShares: fileShareEntries,
+            objectStorage: objectStorage,
+            memoryOvercommit: memoryOvercommit)
+    }
+
+    /// The object-gateway actions a bucket grant is compiled from, one per
+    /// permission the gateway enforces.
+    static let objectPermissionActions: [(ObjectPermission, String)] = [
+        (.list, "bucket:listObjects"),
+        (.read, "bucket:getObject"),
+        (.write, "bucket:putObject"),
+        (.delete, "bucket:deleteObject"),
+    ]
+
+    /// The desired gateway state for an agent's buckets. Bucket access is
+    /// Cedar policy, but the gateway authorizes every request locally, so the
+    /// policy is compiled here — on every sync — into per-access-key grants:
+    /// each key acts as its owner, and is granted what its owner may do to
+    /// the bucket right now. A role binding revoked or a guardrail added thus
+    /// narrows every key its principal holds at the next sync, without
+    /// touching the bucket's generation. Only keys holding some grant are
+    /// sent, so a gateway never learns secrets it cannot use.
+    ///
+    /// Only the keys of principals the reverse index names as candidates for
+    /// these buckets are loaded and checked, so a sync costs what the agent's
+    /// buckets are bound to rather than every key on the platform.
+    private func desiredObjectStorage(
+        _ buckets: [Bucket], on db: any Database
+    ) async throws -> DesiredObjectStorageState {
+        guard !buckets.isEmpty else { return DesiredObjectStorageState(buckets: [], credentials: []) }
+        let nodes = buckets.compactMap { $0.id.map { IAMNode(type: .bucket, id: $0) } }
+
+        var grants: [UUID: [ObjectAccessGrant]] = [:]
+        var credentials: [ObjectGatewayCredential] = []
+        let keys = try await candidateAccessKeys(for: nodes, on: db)
+        let cache = IAMRequestCache()
+        for key in keys {
+            guard let principal = key.principal else { continue }
+            var permissions: [UUID: [ObjectPermission]] = [:]
+            for (permission, action) in Self.objectPermissionActions {
+                let decisions = try await WhoCanService.can(
+                    principalType: principal.type, principalID: principal.id, action: action, nodes: nodes,
+                    app: app, cache: cache, on: db)
+                for (node, allowed) in decisions where allowed {
+                    permissions[node.id, default: []].append(permission)
+                }
+            }
+            guard !permissions.isEmpty else { continue }
+            for (bucketID, granted) in permissions {
+                grants[bucketID, default: []].append(
+                    ObjectAccessGrant(accessKeyId: key.accessKeyId, permissions: granted))
+            }
+            do {
+                let secret = try app.secretsEncryption.decrypt(key.secret)
+                credentials.append(ObjectGatewayCredential(accessKeyId: key.accessKeyId, secretAccessKey: secret))
+            } catch {
+                // One undecryptable key must not take every bucket on the
+                // agent down with it; its grants name a key the gateway does
+                // not know, which refuses its requests.
+                app.logger.error(
+                    "Cannot decrypt object storage secret key; omitting it from the sync",
+                    metadata: ["accessKeyId": .string(key.accessKeyId), "error": .string("\(error)")])
+            }
+        }
+
+        return DesiredObjectStorageState(
+            buckets: buckets.compactMap { bucket in
+                guard let bucketID = bucket.id else { return nil }
+                return DesiredBucketState(
+                    bucketId: bucketID,
+                    name: bucket.name,
+                    desiredStatus: bucket.desiredStatus,
+                    generation: bucket.generation,
+                    quotaBytes: bucket.quotaBytes,
+                    grants: grants[bucketID] ?? []
+                )
+            },
+            credentials: credentials
+        )
+    }
+
+    /// The access keys whose owners could hold a grant on `nodes`. An
+    /// authored permit in force on a bucket can name anyone, so it widens
+    /// this back to every key — `WhoCanService.can` still decides each one.
+    private func candidateAccessKeys(
+        for nodes: [IAMNode], on db: any Database
+    ) async throws -> [ObjectStorageAccessKey] {
+        let query = ObjectStorageAccessKey.query(on: db).sort(\.$accessKeyId)
+        guard
+            let candidates = try await WhoCanService.candidatePrincipals(
+                actions: Self.objectPermissionActions.map(\.1), nodes: nodes, on: db)
+        else { return try await query.all() }
+
+        let userIDs = candidates.filter { $0.type == .user }.map { Optional($0.id) }
+        let serviceAccountIDs = candidates.filter { $0.type == .serviceAccount }.map { Optional($0.id) }
+        guard !userIDs.isEmpty || !serviceAccountIDs.isEmpty else { return [] }
+        return try await query.group(.or) { owner in
+            if !userIDs.isEmpty { owner.filter(\.$user.$id ~~ userIDs) }
+            if !serviceAccountIDs.isEmpty { owner.filter(\.$serviceAccount.$id ~~ serviceAccountIDs) }
+        }.all()
+    }
+
+    /// The desired entries for the shares an agent serves. The export's
+    /// client list is derived here, on every sync, from the IPv4 addresses
+    /// of the owner project's VM NICs on the share's network — so a VM
+    /// joining or leaving the network changes who may mount without touching
+    /// the share's generation.
+    private func desiredFileShares(
+        _ shares: [FileShare], on db: any Database
+    ) async throws -> [DesiredFileShareState] {
+        guard !shares.isEmpty else { return [] }
+        let shareIDs = shares.compactMap(\.id)
+
+        struct ClientScope: Hashable {
+            let network: String
+            let projectID: UUID
+        }
+        let networkNames = Set(shares.map(\.network.name))
+        let projectIDs = Set(shares.map { $0.$project.id })
+        let addresses = try await VMInterfaceAddress.query(on: db)
+            .join(VMNetworkInterface.self, on: \VMInterfaceAddress.$interface.$id == \VMNetworkInterface.$id)
+            .join(VM.self, on: \VMNetworkInterface.$vm.$id == \VM.$id)
+            .filter(\VMInterfaceAddress.$network ~~ Array(networkNames))
+            .filter(\VMInterfaceAddress.$family == IPFamily.ipv4.rawValue)
+            .filter(VM.self, \.$project.$id ~~ Array(projectIDs))
+            .all()
+        var clients: [ClientScope: Set<String>] = [:]
+        for address in addresses {
+            let projectID = try address.joined(VM.self).$project.id
+            clients[ClientScope(network: address.network, projectID: projectID), default: []]
+                .insert(address.address)
+        }
+
+        // Snapshots being deleted or that failed are not wanted on the agent.
+        let snapshots = try await FileShareSnapshot.query(on: db)
+            .filter(\.$share.$id ~~ shareIDs)
+            .filter(\.$status ~~ [.creating, .available])
+            .sort(\.$createdAt)
+            .all()
+        let snapshotsByShare = Dictionary(grouping: snapshots, by: \.$share.id)
+
+        return shares.compactMap { share in
+            guard let shareID = share.id else { return nil }
+            let network = share.network
+            let endpoint = NetworkSpec(
+                network: network.name,
+                networkId: network.id,
+                macAddress: share.macAddress,
+                ipAddress: share.ipAddress,
+                netmask: share.netmask,
+                gateway: network.gateway
+            )
+            let scope = ClientScope(network: network.name, projectID: share.$project.id)
+            return DesiredFileShareState(
+                shareId: shareID,
+                desiredStatus: share.desiredStatus,
+                generation: share.generation,
+                sizeBytes: share.sizeBytes,
+                endpoint: endpoint,
+                allowedClients: (clients[scope] ?? []).sorted(),
+                snapshots: (snapshotsByShare[shareID] ?? []).compactMap(\.id)
+            )
+        }
     }
 
     /// The agent self-update this sync should carry (issue #434): the rollout
@@ -341,6 +571,30 @@ struct DesiredStateAssembler {
         }
     }
 
+    /// The VM's TPM state key, unwrapped for the sync. Keys are minted at VM
+    /// create (or by `SecretsEncryptionService.mintTPMStateKeys` for older
+    /// VMs), never here: a key minted during a sync could race another
+    /// replica's and leave the state encrypted with a key nobody kept. Nil, logged, when the VM has no key
+    /// or it cannot be unwrapped: the agent then keeps any key it already
+    /// installed, and refuses to start encrypted state without one.
+    private func tpmStateKey(for vm: VM) -> String? {
+        guard let vmId = vm.id else { return nil }
+        guard let stored = vm.tpmStateKey else {
+            app.logger.error(
+                "VM has a TPM but no TPM state key; syncing without it",
+                metadata: ["vmId": .string(vmId.uuidString)])
+            return nil
+        }
+        do {
+            return try app.secretsEncryption.decrypt(stored)
+        } catch {
+            app.logger.error(
+                "Cannot unwrap the VM's TPM state key; syncing without it",
+                metadata: ["vmId": .string(vmId.uuidString), "error": .string("\(error)")])
+            return nil
+        }
+    }
+
     /// Load a name-indexed logical-network slice without ever issuing an
     /// unbounded table scan. Empty scopes intentionally produce no query.
     private func logicalNetworksByName(
@@ -507,12 +761,15 @@ struct DesiredStateAssembler {
         agent: Agent?,
         ownVMs: [VM],
         ownSandboxes: [Sandbox],
+        ownFileShares: [FileShare],
         on db: any Database
     ) async throws -> NetworkAssemblyScope {
         // A network referenced by either a VM or a sandbox on this host must be
-        // realized here (issue #416).
+        // realized here (issue #416), and so must one a hosted file share is
+        // exported on.
         var ownReferences = Set(ownVMs.flatMap { $0.networkInterfaces.map(\.network) })
         ownReferences.formUnion(ownSandboxes.flatMap { $0.networkInterfaces.map(\.network) })
+        ownReferences.formUnion(ownFileShares.map(\.network.name))
 
         guard let agent,
             let agentUUID = agent.id,
@@ -583,6 +840,11 @@ struct DesiredStateAssembler {
             .with(\.$networkInterfaces)
             .all()
         names.formUnion(siteSandboxes.flatMap { $0.networkInterfaces.map(\.network) })
+        let siteFileShares = try await FileShare.query(on: db)
+            .filter(\.$hypervisorId ~~ siteAgentIDs)
+            .with(\.$network)
+            .all()
+        names.formUnion(siteFileShares.map(\.network.name))
         let pinned = try await LogicalNetwork.query(on: db)
             .filter(\.$site.$id == siteID)
             .all()
@@ -674,7 +936,10 @@ struct DesiredStateAssembler {
     /// the attached NIC's network name: each becomes a `dnat_and_snat` rule on
     /// that network's router. Only attachments to VMs placed on `agentIDs` —
     /// the hosts whose topology the receiving agent authors — so a site-less
-    /// agent never NATs for a VM on some other node's private NB.
+    /// agent never NATs for a VM on some other node's private NB. An address
+    /// from a BYOIP pool carries its prefix, which the router then announces
+    /// — so a prefix is announced exactly while one of its addresses is
+    /// attached.
     private func desiredFloatingIPs(
         forAgentIDs agentIDs: Set<String>, on db: any Database
     ) async throws -> [String: [DesiredFloatingIP]] {
@@ -682,6 +947,7 @@ struct DesiredStateAssembler {
         let attached = try await FloatingIP.query(on: db)
             .filter(\.$interface.$id != nil)
             .with(\.$interface)
+            .with(\.$pool)
             .all()
         guard !attached.isEmpty else { return [:] }
 
@@ -722,7 +988,8 @@ struct DesiredStateAssembler {
                     externalIP: floatingIP.address,
                     logicalIP: logicalIP,
                     vmId: vmId,
-                    nicIndex: nicIndex))
+                    nicIndex: nicIndex,
+                    advertisedPrefix: floatingIP.pool.$byoipPrefix.id != nil ? floatingIP.pool.cidr : nil))
         }
         return byNetwork.mapValues { $0.sorted { $0.externalIP < $1.externalIP } }
     }
@@ -0,0 +1,148 @@
+import AsyncHTTPClient
+import Foundation
+import NIOCore
+import Vapor
+
+/// Where domain-verification TXT records are read from. A protocol so tests
+/// can answer without the Internet.
+protocol DomainTXTResolver: Sendable {
+    /// Every TXT record at `name`, each one's strings joined; empty when the
+    /// name does not exist or has none.
+    func txtRecords(for name: String) async throws -> [String]
+}
+
+/// Operator settings for domain verification, read from the environment.
+struct DomainVerificationConfig: Sendable {
+    /// A DNS-over-HTTPS resolver speaking the JSON API
+    /// (`GET ?name=<name>&type=TXT`, `application/dns-json`). A public
+    /// resolver rather than the host's: the record must be visible from the
+    /// Internet, not only from inside the deployment's network.
+    var dohURL: String
+
+    static func fromEnvironment() -> DomainVerificationConfig {
+        DomainVerificationConfig(
+            dohURL: Environment.get("DOMAIN_VERIFICATION_DOH_URL") ?? "https://cloudflare-dns.com/dns-query")
+    }
+}
+
+/// Reads TXT records through a DNS-over-HTTPS JSON endpoint.
+struct DNSOverHTTPSResolver: DomainTXTResolver {
+    let config: DomainVerificationConfig
+    let client: HTTPClient
+
+    struct ResolverError: Error, CustomStringConvertible {
+        let description: String
+    }
+
+    /// DNS response codes the JSON API reports in `Status`.
+    private static let noError = 0
+    private static let nameError = 3
+    private static let txtType = 16
+
+    func txtRecords(for name: String) async throws -> [String] {
+        struct Body: Decodable {
+            struct Answer: Decodable {
+                let type: Int
+                let data: String
+            }
+            let status: Int
+            let answer: [Answer]?
+
+            enum CodingKeys: String, CodingKey {
+                case status = "Status"
+                case answer = "Answer"
+            }
+        }
+        var components = URLComponents(string: config.dohURL)
+        components?.queryItems = [URLQueryItem(name: "name", value: name), URLQueryItem(name: "type", value: "TXT")]
+        guard let url = components?.string else {
+            throw ResolverError(description: "Invalid DNS-over-HTTPS URL '\(config.dohURL)'")
+        }
+        var request = HTTPClientRequest(url: url)
+        request.headers.add(name: "Accept", value: "application/dns-json")
+        let response = try await client.execute(request, timeout: .seconds(10))
+        guard response.status == .ok else {
+            throw ResolverError(description: "The DNS resolver answered \(response.status.code)")
+        }
+        let body = try JSONDecoder().decode(Body.self, from: try await response.body.collect(upTo: 1 << 20))
+        switch body.status {
+        case Self.noError:
+            return (body.answer ?? []).filter { $0.type == Self.txtType }.map { Self.joinedStrings($0.data) }
+        case Self.nameError:
+            return []
+        default:
+            throw ResolverError(description: "The DNS lookup of \(name) failed (rcode \(body.status))")
+        }
+    }
+
+    /// A TXT record's presentation form — one or more quoted character
+    /// strings (`"v=a" "bc"`) — as the single string they make up. Long
+    /// values are split into 255-byte strings, so they must be rejoined
+    /// before comparing.
+    static func joinedStrings(_ data: String) -> String {
+        guard data.first == "\"" else { return data }
+        var result = ""
+        var inString = false
+        var escaped = false
+        for character in data {
+            if escaped {
+                result.append(character)
+                escaped = false
+            } else if character == "\\" && inString {
+                escaped = true
+            } else if character == "\"" {
+                inString.toggle()
+            } else if inString {
+                result.append(character)
+            }
+        }
+        return result
+    }
+}
+
+/// Decides whether an organization has proven control of a domain.
+enum DomainVerifier {
+    /// The outcome: nil when proven, otherwise why not (stored on the domain
+    /// as its status message).
+    static func failure(of domain: OrganizationDomain, resolver: any DomainTXTResolver) async -> String? {
+        let records: [String]
+        do {
+            records = try await resolver.txtRecords(for: domain.recordName)
+        } catch {
+            return "DNS lookup failed: \(error)"
+        }
+        let expected = domain.recordValue
+        guard records.contains(where: { $0.trimmingCharacters(in: .whitespaces) == expected }) else {
+            return records.isEmpty
+                ? "No TXT record found at \(domain.recordName)"
+                : "The TXT records at \(domain.recordName) don't include \(expected)"
+        }
+        return nil
+    }
+}
+
+extension Application {
+    private struct DomainVerificationConfigKey: StorageKey {
+        typealias Value = DomainVerificationConfig
+    }
+
+    private struct DomainTXTResolverKey: StorageKey {
+        typealias Value = any DomainTXTResolver
+    }
+
+    /// Falls back to the environment, like `byoipConfig`.
+    var domainVerificationConfig: DomainVerificationConfig {
+        get { storage[DomainVerificationConfigKey.self] ?? .fromEnvironment() }
+        set { setStorageValue(DomainVerificationConfigKey.self, to: newValue) }
+    }
+
+    /// Tests replace this with a local stub; everything else asks the
+    /// configured DNS-over-HTTPS resolver.
+    var domainTXTResolver: any DomainTXTResolver {
+        get {
+            storage[DomainTXTResolverKey.self]
+                ?? DNSOverHTTPSResolver(config: domainVerificationConfig, client: http.client.shared)
+        }
+        set { setStorageValue(DomainTXTResolverKey.self, to: newValue) }
+    }
+}
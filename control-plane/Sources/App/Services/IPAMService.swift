@@ -9,7 +9,10 @@ import StratoShared
 ///
 /// Allocation strategy: lowest free host address, skipping the network address,
 /// broadcast address, and gateway, with existing `VMNetworkInterface` rows on
-/// the same network as the used set. Callers should run inside the same
+/// the same network (and `IPReservation`s held on it) as the used set. A
+/// caller may instead claim one specific address (`claimIP`), which must be
+/// free and either unreserved or reserved by its project. Callers should run
+/// inside the same
 /// transaction that saves the interface row; a per-network advisory lock
 /// serializes concurrent allocations (VM and sandbox rows live in different
 /// tables, so no unique index can span them), and each table's unique
@@ -31,6 +34,11 @@ enum IPAMService {
         case invalidSubnet(String)
         case invalidGateway(String)
         case poolExhausted(network: String, subnet: String)
+        /// A requested fixed address that isn't a host address of the subnet.
+        case invalidAddress(address: String, subnet: String)
+        /// A requested fixed address that is the gateway, in use, or held by
+        /// another project's reservation.
+        case addressUnavailable(address: String, network: String, reason: String)
 
         var errorDescription: String? {
             switch self {
@@ -40,6 +48,10 @@ enum IPAMService {
                 return "Logical network has an invalid gateway: \(gateway)"
             case .poolExhausted(let network, let subnet):
                 return "No free IP addresses left in network \(network) (\(subnet))"
+            case .invalidAddress(let address, let subnet):
+                return "\(address) is not a host address in \(subnet)"
+            case .addressUnavailable(let address, let network, let reason):
+                return "\(address) on network \(network) is \(reason)"
             }
         }
 
@@ -49,6 +61,8 @@ enum IPAMService {
             case .invalidSubnet: return "invalid_subnet"
             case .invalidGateway: return "invalid_gateway"
             case .poolExhausted: return "pool_exhausted"
+            case .invalidAddress: return "invalid_address"
+            case .addressUnavailable: return "address_unavailable"
             }
         }
     }
@@ -76,8 +90,10 @@ enum IPAMService {
         try await sql.raw("SELECT pg_advisory_xact_lock(hashtext(\(bind: "ipam:\(network)")))").run()
     }
 
-    /// Allocates the lowest free host address in `network`'s subnet.
-    static func allocateIP(for network: LogicalNetwork, on db: Database) async throws -> Allocation {
+    /// Allocates the lowest free host address in `network`'s subnet, or nil
+    /// when the network is IPv6-only.
+    static func allocateIP(for network: LogicalNetwork, on db: Database) async throws -> Allocation? {
+        guard let subnet = network.subnet else { return nil }
         // The used set is the union of VM and sandbox addresses on the network
         // (issue #416): both draw from the same subnet, so an allocation must
         // see the other's addresses or two workloads could get the same IP.
@@ -85,22 +101,15 @@ enum IPAMService {
         // concurrent same-table creates; cross-table (VM vs sandbox) races
         // are serialized by the advisory lock, which no unique index covers.
         try await lockAllocations(network: network.name, on: db)
-        let usedVM = try await VMInterfaceAddress.query(on: db)
-            .filter(\.$network == network.name)
-            .filter(\.$family == IPFamily.ipv4.rawValue)
-            .all()
-            .compactMap { parseIPv4($0.address) }
-        let usedSandbox = try await SandboxInterfaceAddress.query(on: db)
-            .filter(\.$network == network.name)
-            .filter(\.$family == IPFamily.ipv4.rawValue)
-            .all()
+        // Reserved addresses are only ever taken by name (`claimIP`).
+        let reserved = try await reservations(on: network, family: .ipv4, db: db)
             .compactMap { parseIPv4($0.address) }
-        let used = Set(usedVM).union(usedSandbox)
+        let used = try await usedIPv4(on: network, db: db).union(reserved)
 
         do {
             let allocation = try allocateIP(
                 networkName: network.name,
-                subnet: network.subnet,
+                subnet: subnet,
                 gateway: network.gateway,
                 used: used
             )
@@ -153,23 +162,16 @@ enum IPAMService {
         // Union of VM and sandbox interface IDs on the network (issue #416),
         // for the same reason as the v4 path, under the same advisory lock.
         try await lockAllocations(network: network.name, on: db)
-        let usedVM = try await VMInterfaceAddress.query(on: db)
-            .filter(\.$network == network.name)
-            .filter(\.$family == IPFamily.ipv6.rawValue)
-            .all()
-            .compactMap { IPv6Address($0.address)?.lo }
-        let usedSandbox = try await SandboxInterfaceAddress.query(on: db)
-            .filter(\.$network == network.name)
-            .filter(\.$family == IPFamily.ipv6.rawValue)
-            .all()
+        let reserved = try await reservations(on: network, family: .ipv6, db: db)
             .compactMap { IPv6Address($0.address)?.lo }
+        let used = try await usedIPv6InterfaceIDs(on: network, db: db).union(reserved)
 
         do {
             let allocation = try allocateIPv6(
                 networkName: network.name,
                 subnet6: subnet6,
                 gateway6: network.gateway6,
-                usedInterfaceIDs: Set(usedVM).union(usedSandbox)
+                usedInterfaceIDs: used
             )
             Telemetry.ipamAllocated(family: "ipv6")
             return allocation
@@ -220,6 +222,155 @@ enum IPAMService {
             ipAddress: base.replacingInterfaceID(candidate).description, prefixLength: cidr.prefix)
     }
 
+    // MARK: - Fixed addresses
+
+    /// Claims `address` on `network` for a NIC or reservation of `projectID`.
+    /// The address must be a host address of the matching subnet, not the
+    /// gateway, not in use, and not reserved by a different project — the
+    /// owning project's own reservation is exactly what lets it through.
+    /// Returns the canonical allocation, family inferred from the text.
+    static func claimIP(
+        _ address: String, on network: LogicalNetwork, projectID: UUID, db: Database
+    ) async throws -> ClaimedAddress {
+        try await lockAllocations(network: network.name, on: db)
+        let family: IPFamily = IPv4Address(address) != nil ? .ipv4 : .ipv6
+        let claimed: ClaimedAddress
+        switch family {
+        case .ipv4:
+            guard let subnet = network.subnet else {
+                throw IPAMError.invalidAddress(address: address, subnet: network.subnet6 ?? "none")
+            }
+            claimed = .ipv4(
+                try claimIP(
+                    address, networkName: network.name, subnet: subnet, gateway: network.gateway,
+                    used: try await usedIPv4(on: network, db: db)))
+        case .ipv6:
+            guard let subnet6 = network.subnet6 else {
+                throw IPAMError.invalidAddress(address: address, subnet: network.subnet ?? "none")
+            }
+            claimed = .ipv6(
+                try claimIPv6(
+                    address, networkName: network.name, subnet6: subnet6, gateway6: network.gateway6,
+                    usedInterfaceIDs: try await usedIPv6InterfaceIDs(on: network, db: db)))
+        }
+        let heldElsewhere = try await reservations(on: network, family: family, db: db)
+            .contains { $0.address == claimed.ipAddress && $0.$project.id != projectID }
+        if heldElsewhere {
+            throw IPAMError.addressUnavailable(
+                address: claimed.ipAddress, network: network.name, reason: "reserved by another project")
+        }
+        return claimed
+    }
+
+    enum ClaimedAddress: Equatable {
+        case ipv4(Allocation)
+        case ipv6(Allocation6)
+
+        var ipAddress: String {
+            switch self {
+            case .ipv4(let allocation): return allocation.ipAddress
+            case .ipv6(let allocation): return allocation.ipAddress
+            }
+        }
+    }
+
+    /// Pure IPv4 claim core, separated for testability.
+    static func claimIP(
+        _ address: String, networkName: String, subnet: String, gateway: String?, used: Set<UInt32>
+    ) throws -> Allocation {
+        guard let cidr = IPv4CIDR(subnet), allocatablePrefixRange.contains(cidr.prefix) else {
+            throw IPAMError.invalidSubnet(subnet)
+        }
+        let networkAddress = cidr.networkAddress.raw
+        let broadcastAddress = networkAddress | ~cidr.mask
+        guard let value = parseIPv4(address), cidr.contains(IPv4Address(raw: value)),
+            value != networkAddress, value != broadcastAddress
+        else {
+            throw IPAMError.invalidAddress(address: address, subnet: subnet)
+        }
+        let canonical = formatIPv4(value)
+        if let gateway, parseIPv4(gateway) == value {
+            throw IPAMError.addressUnavailable(address: canonical, network: networkName, reason: "the gateway")
+        }
+        if used.contains(value) {
+            throw IPAMError.addressUnavailable(address: canonical, network: networkName, reason: "in use")
+        }
+        return Allocation(ipAddress: canonical, netmask: formatIPv4(cidr.mask), prefixLength: cidr.prefix)
+    }
+
+    /// Pure IPv6 claim core. Interface IDs identify addresses within the
+    /// network's single /64, as in `allocateIPv6`.
+    static func claimIPv6(
+        _ address: String, networkName: String, subnet6: String, gateway6: String?,
+        usedInterfaceIDs: Set<UInt64>
+    ) throws -> Allocation6 {
+        guard let cidr = IPv6CIDR(subnet6), cidr.prefix == 64 else {
+            throw IPAMError.invalidSubnet(subnet6)
+        }
+        guard let parsed = IPv6Address(address), cidr.contains(parsed), parsed != cidr.networkAddress else {
+            throw IPAMError.invalidAddress(address: address, subnet: subnet6)
+        }
+        let canonical = parsed.description
+        if let gateway6, IPv6Address(gateway6) == parsed {
+            throw IPAMError.addressUnavailable(address: canonical, network: networkName, reason: "the gateway")
+        }
+        if usedInterfaceIDs.contains(parsed.lo) {
+            throw IPAMError.addressUnavailable(address: canonical, network: networkName, reason: "in use")
+        }
+        return Allocation6(ipAddress: canonical, prefixLength: cidr.prefix)
+    }
+
+    // MARK: - Used sets
+
+    /// IPv4 addresses held on `network` by workloads: VM and sandbox NICs
+    /// (issue #416) and file-share servers. Reservations are separate —
+    /// whether they count depends on who is asking.
+    private static func usedIPv4(on network: LogicalNetwork, db: Database) async throws -> Set<UInt32> {
+        let usedVM = try await VMInterfaceAddress.query(on: db)
+            .filter(\.$network == network.name)
+            .filter(\.$family == IPFamily.ipv4.rawValue)
+            .all()
+            .compactMap { parseIPv4($0.address) }
+        let usedSandbox = try await SandboxInterfaceAddress.query(on: db)
+            .filter(\.$network == network.name)
+            .filter(\.$family == IPFamily.ipv4.rawValue)
+            .all()
+            .compactMap { parseIPv4($0.address) }
+        // File-share servers (wire v24) hold one IPv4 address each on their
+        // export network; `file_shares` has its own `(network_id, ip_address)`
+        // unique index and shares the advisory lock.
+        let usedFileShare = try await FileShare.query(on: db)
+            .filter(\.$network.$id == network.requireID())
+            .all()
+            .compactMap { parseIPv4($0.ipAddress) }
+        return Set(usedVM).union(usedSandbox).union(usedFileShare)
+    }
+
+    /// Interface IDs of the IPv6 addresses VM and sandbox NICs hold on
+    /// `network`.
+    private static func usedIPv6InterfaceIDs(on network: LogicalNetwork, db: Database) async throws -> Set<UInt64> {
+        let usedVM = try await VMInterfaceAddress.query(on: db)
+            .filter(\.$network == network.name)
+            .filter(\.$family == IPFamily.ipv6.rawValue)
+            .all()
+            .compactMap { IPv6Address($0.address)?.lo }
+        let usedSandbox = try await SandboxInterfaceAddress.query(on: db)
+            .filter(\.$network == network.name)
+            .filter(\.$family == IPFamily.ipv6.rawValue)
+            .all()
+            .compactMap { IPv6Address($0.address)?.lo }
+        return Set(usedVM).union(usedSandbox)
+    }
+
+    private static func reservations(
+        on network: LogicalNetwork, family: IPFamily, db: Database
+    ) async throws -> [IPReservation] {
+        try await IPReservation.query(on: db)
+            .filter(\.$network.$id == network.requireID())
+            .filter(\.$family == family.rawValue)
+            .all()
+    }
+
     /// Allocates the lowest free floating address in `pool`'s CIDR (issue
     /// #344). Same shape as NIC allocation: the used set is the pool's
     /// existing `FloatingIP` rows, a per-pool advisory lock serializes
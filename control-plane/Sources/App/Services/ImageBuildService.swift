@@ -0,0 +1,734 @@
+import Fluent
+import Foundation
+import NIOConcurrencyHelpers
+import SQLKit
+import StratoShared
+import Vapor
+
+/// How the image build service reaches a build VM's agent. A protocol so
+/// tests can play the guest.
+protocol ImageBuildAgent: Sendable {
+    /// Runs a command in the guest through qga. Returns whatever the command
+    /// exited with; throws when it could not be started or did not finish.
+    func guestExec(
+        _ message: VMGuestExecMessage, agentId: String, timeout: Duration
+    ) async throws -> VMGuestExecResponse
+
+    /// Returns once the agent has uploaded the stopped VM's disk.
+    func exportDisk(_ message: VMDiskExportMessage, agentId: String, timeout: Duration) async throws
+}
+
+extension AgentService: ImageBuildAgent {
+    func guestExec(
+        _ message: VMGuestExecMessage, agentId: String, timeout: Duration
+    ) async throws -> VMGuestExecResponse {
+        switch try await sendMessageToAgentWithResponse(message, agentId: agentId, timeout: timeout) {
+        case .success(let data):
+            guard let result = try data?.decode(as: VMGuestExecResponse.self) else {
+                throw ImageBuildError.malformedAgentResponse
+            }
+            return result
+        case .error(let error, let details):
+            throw ImageBuildError.agentOperationFailed(error, details)
+        }
+    }
+
+    func exportDisk(_ message: VMDiskExportMessage, agentId: String, timeout: Duration) async throws {
+        if case .error(let error, let details) = try await sendMessageToAgentWithResponse(
+            message, agentId: agentId, timeout: timeout)
+        {
+            throw ImageBuildError.agentOperationFailed(error, details)
+        }
+    }
+}
+
+enum ImageBuildError: Error, LocalizedError {
+    case agentOperationFailed(String, String?)
+    case malformedAgentResponse
+
+    var errorDescription: String? {
+        switch self {
+        case .agentOperationFailed(let error, let details):
+            if let details, !details.isEmpty {
+                return "\(error): \(details)"
+            }
+            return error
+        case .malformedAgentResponse:
+            return "The agent's response carried no command result"
+        }
+    }
+}
+
+/// Runs image builds (`/api/projects/:projectID/image-builds`).
+///
+/// A build is an ordinary QEMU VM booted from the base image on the build
+/// network, with the build's user data. Once its guest agent answers, each
+/// step — the cloud-init wait, then the provisioners — runs through qga
+/// `guest-exec`, one at a time, as a background task on whichever replica
+/// started it. Then the VM is shut down, its agent flattens the boot disk and
+/// uploads it to `/api/image-builds/:buildID/disk`, which stores it as a new
+/// version of the target image. However the build ends, the VM is deleted.
+///
+/// A periodic sweep — cluster-singleton per pass via the
+/// `lock:sweep:image_builds` Valkey lock — moves each build along with
+/// `advance`. It is level-triggered: every phase re-derives from stored state,
+/// and a pass that finds a VM still booting or a step still running looks
+/// again next time. Steps are never repeated: a step whose lease expires
+/// without a result fails the build, since it may already have run.
+final class ImageBuildService: @unchecked Sendable {
+    struct Configuration: Sendable {
+        /// How long the build VM gets, from creation, until its guest agent
+        /// answers.
+        var bootTimeoutSeconds: Int
+        /// How long the build VM gets to shut down after the last step.
+        var stopTimeoutSeconds: Int
+        /// How long the agent gets to flatten and upload the disk.
+        var captureTimeoutSeconds: Int
+        var sweepIntervalSeconds: Int
+
+        static func fromEnvironment() -> Configuration {
+            Configuration(
+                bootTimeoutSeconds: Environment.get("IMAGE_BUILD_BOOT_TIMEOUT_SECONDS").flatMap(Int.init) ?? 900,
+                stopTimeoutSeconds: Environment.get("IMAGE_BUILD_STOP_TIMEOUT_SECONDS").flatMap(Int.init) ?? 300,
+                captureTimeoutSeconds:
+                    Environment.get("IMAGE_BUILD_CAPTURE_TIMEOUT_SECONDS").flatMap(Int.init) ?? 3600,
+                sweepIntervalSeconds: Environment.get("IMAGE_BUILD_SWEEP_INTERVAL_SECONDS").flatMap(Int.init) ?? 10
+            )
+        }
+    }
+
+    /// Time a step gets past its own timeout for the agent to report, before
+    /// the control plane gives up on it.
+    static let stepGraceSeconds = 60
+
+    let app: Application
+    var configuration: Configuration
+    /// Tests replace this to play the build VM's guest.
+    var agent: any ImageBuildAgent
+    private let sweepTask: NIOLockedValueBox<Task<Void, Never>?> = .init(nil)
+
+    var sweepLockTTLSeconds: Int { max(configuration.sweepIntervalSeconds - 2, 2) }
+
+    init(app: Application, configuration: Configuration = .fromEnvironment()) {
+        self.app = app
+        self.configuration = configuration
+        self.agent = app.agentService
+    }
+
+    private var sweepEnabled: Bool {
+        Environment.get("IMAGE_BUILD_SWEEP_ENABLED").flatMap(Bool.init)
+            ?? (app.environment != .testing)
+    }
+
+    // MARK: - Sweep lifecycle
+
+    /// Arm the periodic sweep. Called once from the boot lifecycle; disabled
+    /// in the testing environment (tests drive `sweepOnce` directly).
+    func startSweep() {
+        sweepTask.withLockedValue { task in
+            guard task == nil else { return }
+            task = Task { [weak self] in
+                guard let self, self.sweepEnabled else { return }
+                let interval = self.configuration.sweepIntervalSeconds
+                while !Task.isCancelled {
+                    await self.sweepOnce()
+                    do {
+                        try await Task.sleep(for: .seconds(interval))
+                    } catch {
+                        break  // cancelled
+                    }
+                }
+            }
+        }
+    }
+
+    func shutdown() {
+        sweepTask.withLockedValue { task in
+            task?.cancel()
+            task = nil
+        }
+    }
+
+    /// One pass over every build still running or still holding its VM.
+    /// `acquiringLock: false` skips the cluster-singleton lock, for tests.
+    func sweepOnce(acquiringLock: Bool = true, now: Date = Date()) async {
+        if acquiringLock {
+            guard await app.coordination.acquireSweepLock("image_builds", ttlSeconds: sweepLockTTLSeconds) else {
+                app.logger.debug("Skipping image build sweep; lock held by another control-plane instance")
+                return
+            }
+        }
+
+        guard let db = app.liveDB else { return }
+        do {
+            let builds = try await ImageBuild.query(on: db)
+                .group(.or) { group in
+                    group.filter(\.$status !~ [.succeeded, .failed, .cancelled])
+                    group.filter(\.$vmId != nil)
+                }
+                .sort(\.$createdAt)
+                .all()
+            for build in builds {
+                await advance(build, now: now, on: db)
+            }
+        } catch {
+            app.logger.error("Image build sweep failed: \(error)")
+        }
+    }
+
+    // MARK: - Build lifecycle
+
+    /// Moves one build along as far as it can go right now. Safe to call from
+    /// a request as well as the sweep: every phase re-derives from stored
+    /// state, and step leases and VM operations reject a second start.
+    func advance(_ build: ImageBuild, now: Date = Date(), on db: any Database) async {
+        do {
+            if !build.isFinished, build.cancelRequested {
+                try await finish(build, as: .cancelled, reason: nil, now: now, on: db)
+            }
+            switch build.status {
+            case .pending:
+                try await createVM(for: build, now: now, on: db)
+            case .booting:
+                try await awaitBoot(of: build, now: now, on: db)
+            case .provisioning:
+                try await provision(build, now: now, on: db)
+            case .stopping:
+                try await awaitStop(of: build, now: now, on: db)
+            case .capturing:
+                try await capture(build, now: now, on: db)
+            case .succeeded, .failed, .cancelled:
+                try await removeVM(of: build, on: db)
+            }
+        } catch {
+            app.logger.warning(
+                "Image build step failed: \(error)",
+                metadata: ["imageBuildId": .string(build.id?.uuidString ?? "")])
+        }
+    }
+
+    /// Creates the build VM the way `VMController.create` does — quota,
+    /// network interface, create operation and the creator's binding in one
+    /// transaction — with the build moving to `booting` in the same
+    /// transaction, so a VM is never created twice for one build.
+    private func createVM(for build: ImageBuild, now: Date, on db: any Database) async throws {
+        guard let baseImageID = build.$baseImage.id,
+            let image = try await Image.query(on: db).filter(\.$id == baseImageID).with(\.$artifacts).first(),
+            image.status == .ready
+        else {
+            try await finish(build, as: .failed, reason: "The base image is gone or not ready", now: now, on: db)
+            return
+        }
+        if !(image.$artifacts.value ?? []).isEmpty, !image.isUsable(by: .qemu) {
+            try await finish(
+                build, as: .failed, reason: "The base image has no QEMU disk image", now: now, on: db)
+            return
+        }
+        guard let project = try await Project.find(build.$project.id, on: db) else { return }
+
+        let buildID = try build.requireID()
+        let projectID = build.$project.id
+        let userID = build.$createdBy.id
+
+        let plan: VMController.NICPlan
+        do {
+            plan = try await VMController.resolveNIC(
+                CreateVMNICRequest(networkId: build.networkId), index: 0, projectId: projectID, planned: [], on: db)
+        } catch let error as any AbortError {
+            try await finish(build, as: .failed, reason: "Build network: \(error.reason)", now: now, on: db)
+            return
+        }
+
+        let vm = VM(
+            name: "image-build-\(build.name)",
+            description: "Image build \(buildID) of '\(build.targetImageName)'",
+            image: image.name,
+            projectID: projectID,
+            environment: build.environment,
+            cpu: build.cpu,
+            memory: build.memory,
+            disk: build.disk,
+            hypervisorType: .qemu
+        )
+        vm.$sourceImage.id = image.id
+        vm.$imageBuild.id = buildID
+        vm.userData = build.userData
+
+        let operation: ResourceOperation
+        do {
+            let initialGeneration = vm.generation
+            operation = try await VMController.retryingOnConstraintFailure {
+                vm.id = nil
+                vm.$id.exists = false
+                vm.generation = initialGeneration
+                return try await db.transaction { db in
+                    try await QuotaEnforcementService.reserve(
+                        for: project, environment: build.environment, vcpus: vm.cpu, memory: vm.memory,
+                        storage: vm.disk, on: db)
+                    try await vm.save(on: db)
+                    let vmID = try vm.requireID()
+                    vm.diskPath = "/var/lib/strato/vms/\(vmID)/disk.qcow2"
+                    vm.consoleSocket = VMController.socketPath(for: vmID, filename: "console.sock")
+                    vm.serialSocket = VMController.socketPath(for: vmID, filename: "serial.sock")
+                    // Unlike a user's VM, a build VM is created to run.
+                    vm.setDesiredStatus(.running)
+                    try await vm.update(on: db)
+                    try await VMController.createInterface(plan, vmID: vmID, index: 0, projectId: projectID, on: db)
+
+                    let operation = ResourceOperation(vmID: vmID, userID: userID, kind: .create)
+                    try await operation.save(on: db)
+                    try await RoleBindingService.grant(
+                        principalType: .user, principalID: userID, role: .admin, nodeType: .virtualMachine,
+                        nodeID: vmID, createdBy: userID, on: db)
+
+                    // A query update, so a rolled-back attempt leaves the
+                    // build model as it was.
+                    try await ImageBuild.query(on: db)
+                        .filter(\.$id == buildID)
+                        .set(\.$vmId, to: vmID)
+                        .set(\.$status, to: .booting)
+                        .set(\.$phaseStartedAt, to: now)
+                        .set(\.$startedAt, to: now)
+                        .update()
+                    return operation
+                }
+            }
+        } catch let error as IPAMService.IPAMError {
+            try await finish(
+                build, as: .failed,
+                reason: error.errorDescription ?? "No free IP addresses on the build network", now: now, on: db)
+            return
+        } catch let error as any AbortError where error.status == .forbidden {
+            // A quota the build VM would exceed.
+            try await finish(build, as: .failed, reason: error.reason, now: now, on: db)
+            return
+        }
+
+        let vmID = try vm.requireID()
+        build.vmId = vmID
+        build.status = .booting
+        build.phaseStartedAt = now
+        build.startedAt = now
+
+        let app = self.app
+        app.resourceOperationCoordinator.dispatch(
+            operation, resourceKind: .virtualMachine, resourceID: vmID, hypervisorId: nil,
+            dispatch: .placement { @Sendable db in
+                try await app.agentService.createVM(vm: vm, db: db, image: image)
+            }, app: app)
+
+        app.logger.info(
+            "Image build VM created",
+            metadata: ["imageBuildId": .string(buildID.uuidString), "vmId": .string(vmID.uuidString)])
+    }
+
+    /// Waits for the build VM to run with a responsive guest agent.
+    private func awaitBoot(of build: ImageBuild, now: Date, on db: any Database) async throws {
+        guard let vmID = build.vmId, let vm = try await VM.find(vmID, on: db) else {
+            try await finish(build, as: .failed, reason: "The build VM was deleted", now: now, on: db)
+            return
+        }
+        if vm.status == .running, vm.qgaAvailable == true {
+            build.enter(.provisioning, now: now)
+            try await build.save(on: db)
+            return
+        }
+        if let failed = try await ResourceOperation.query(on: db)
+            .filter(\.$resourceKind == .virtualMachine)
+            .filter(\.$resourceID == vmID)
+            .filter(\.$kind == .create)
+            .filter(\.$status == .failed)
+            .first()
+        {
+            try await finish(
+                build, as: .failed,
+                reason: "The build VM could not be created: \(failed.error ?? "unknown error")", now: now, on: db)
+            return
+        }
+        if vm.status == .error {
+            try await finish(build, as: .failed, reason: "The build VM failed to start", now: now, on: db)
+            return
+        }
+        if now.timeIntervalSince(build.phaseStartedAt) > TimeInterval(configuration.bootTimeoutSeconds) {
+            try await finish(
+                build, as: .failed,
+                reason: "The build VM's guest agent did not answer within \(configuration.bootTimeoutSeconds) "
+                    + "seconds; the base image needs qemu-guest-agent running",
+                now: now, on: db)
+        }
+    }
+
+    /// Starts the next step, or shuts the VM down once every step is done.
+    private func provision(_ build: ImageBuild, now: Date, on db: any Database) async throws {
+        guard let vmID = build.vmId, let vm = try await VM.find(vmID, on: db), let agentId = vm.hypervisorId else {
+            try await finish(build, as: .failed, reason: "The build VM was deleted", now: now, on: db)
+            return
+        }
+        let steps = build.steps
+        if let deadline = build.stepDeadline {
+            if now > deadline {
+                try await finish(
+                    build, as: .failed,
+                    reason: "Step \(build.stepIndex + 1) of \(steps.count) was interrupted before it reported; "
+                        + "steps are not repeated",
+                    now: now, on: db)
+            }
+            return
+        }
+
+        guard build.stepIndex < steps.count else {
+            let started = try await startVMOperation(.shutdown, on: vm, dispatch: .stateSync, db: db) { db in
+                vm.setDesiredStatus(.shutdown)
+                try await vm.save(on: db)
+            }
+            if started {
+                build.enter(.stopping, now: now)
+                try await build.save(on: db)
+            }
+            return
+        }
+        guard vm.status == .running else {
+            try await finish(
+                build, as: .failed, reason: "The build VM stopped during provisioning (\(vm.status.rawValue))",
+                now: now, on: db)
+            return
+        }
+
+        let index = build.stepIndex
+        let step = steps[index]
+        let timeoutSeconds = step.effectiveTimeoutSeconds + Self.stepGraceSeconds
+        guard
+            try await claimStep(
+                of: build, until: now.addingTimeInterval(TimeInterval(timeoutSeconds)), on: db)
+        else { return }
+
+        let buildID = try build.requireID()
+        let message = VMGuestExecMessage(
+            vmId: vmID.uuidString, command: step.guestCommand, timeoutSeconds: step.effectiveTimeoutSeconds)
+        let agent = self.agent
+        let app = self.app
+        // Exit 2 from the cloud-init wait is "done, with recoverable errors".
+        let acceptsExitTwo = build.userData != nil && index == 0
+        app.backgroundTasks.spawn { [self] in
+            let result: Result<VMGuestExecResponse, any Error>
+            do {
+                result = .success(
+                    try await agent.guestExec(message, agentId: agentId, timeout: .seconds(timeoutSeconds)))
+            } catch {
+                result = .failure(error)
+            }
+            guard let db = app.liveDB else { return }
+            await recordStep(
+                index, of: buildID, step: step, total: steps.count, acceptsExitTwo: acceptsExitTwo,
+                result: result, on: db)
+        }
+    }
+
+    /// Records a step's outcome, unless the build has moved on without it
+    /// (cancelled, or failed by the sweep).
+    private func recordStep(
+        _ index: Int, of buildID: UUID, step: ImageBuildProvisioner, total: Int, acceptsExitTwo: Bool,
+        result: Result<VMGuestExecResponse, any Error>, on db: any Database
+    ) async {
+        do {
+            guard let build = try await ImageBuild.find(buildID, on: db),
+                build.status == .provisioning, build.stepIndex == index, build.stepDeadline != nil
+            else { return }
+            let header = "==> Step \(index + 1)/\(total): \(step.summary)\n"
+            switch result {
+            case .success(let response):
+                build.appendLog(header + response.output)
+                if response.succeeded || (acceptsExitTwo && response.exitCode == 2 && response.signal == nil) {
+                    build.stepIndex += 1
+                    build.stepDeadline = nil
+                    try await build.save(on: db)
+                    return
+                }
+                let outcome =
+                    response.signal.map { "was killed by signal \($0)" }
+                    ?? "exited with status \(response.exitCode.map(String.init) ?? "unknown")"
+                try await finish(
+                    build, as: .failed, reason: "Step \(index + 1) (\(step.summary)) \(outcome)", now: Date(), on: db)
+            case .failure(let error):
+                build.appendLog(header + "error: \(error.localizedDescription)")
+                try await finish(
+                    build, as: .failed,
+                    reason: "Step \(index + 1) (\(step.summary)) failed: \(error.localizedDescription)",
+                    now: Date(), on: db)
+            }
+        } catch {
+            app.logger.warning(
+                "Failed to record image build step: \(error)", metadata: ["imageBuildId": .string(buildID.uuidString)])
+        }
+    }
+
+    /// Waits for the build VM to stop.
+    private func awaitStop(of build: ImageBuild, now: Date, on db: any Database) async throws {
+        guard let vmID = build.vmId, let vm = try await VM.find(vmID, on: db) else {
+            try await finish(build, as: .failed, reason: "The build VM was deleted", now: now, on: db)
+            return
+        }
+        if vm.status == .shutdown {
+            build.enter(.capturing, now: now)
+            try await build.save(on: db)
+            return
+        }
+        if vm.status == .error
+            || now.timeIntervalSince(build.phaseStartedAt) > TimeInterval(configuration.stopTimeoutSeconds)
+        {
+            try await finish(
+                build, as: .failed,
+                reason: "The build VM did not shut down within \(configuration.stopTimeoutSeconds) seconds",
+                now: now, on: db)
+        }
+    }
+
+    /// Creates the target image version, then has the agent upload the disk
+    /// into it. The upload route marks the image ready.
+    private func capture(_ build: ImageBuild, now: Date, on db: any Database) async throws {
+        guard let vmID = build.vmId, let vm = try await VM.find(vmID, on: db), let agentId = vm.hypervisorId else {
+            try await finish(build, as: .failed, reason: "The build VM was deleted", now: now, on: db)
+            return
+        }
+        let image: Image
+        if let imageID = build.$image.id {
+            guard let existing = try await Image.find(imageID, on: db) else {
+                try await finish(build, as: .failed, reason: "The captured image was deleted", now: now, on: db)
+                return
+            }
+            image = existing
+        } else {
+            image = try await createTargetImage(for: build, on: db)
+        }
+        if image.status == .ready {
+            try await finish(build, as: .succeeded, reason: nil, now: now, on: db)
+            return
+        }
+        if let deadline = build.stepDeadline {
+            if now > deadline {
+                try await finish(
+                    build, as: .failed, reason: "The disk capture was interrupted or timed out", now: now, on: db)
+            }
+            return
+        }
+
+        let timeoutSeconds = configuration.captureTimeoutSeconds
+        guard
+            try await claimStep(
+                of: build, until: now.addingTimeInterval(TimeInterval(timeoutSeconds)), on: db)
+        else { return }
+
+        let buildID = try build.requireID()
+        let message = VMDiskExportMessage(vmId: vmID.uuidString, uploadURL: "/api/image-builds/\(buildID)/disk")
+        let agent = self.agent
+        let app = self.app
+        app.backgroundTasks.spawn { [self] in
+            var failure: String?
+            do {
+                try await agent.exportDisk(message, agentId: agentId, timeout: .seconds(timeoutSeconds))
+            } catch {
+                failure = error.localizedDescription
+            }
+            guard let db = app.liveDB else { return }
+            await recordCapture(of: buildID, failure: failure, on: db)
+        }
+    }
+
+    private func recordCapture(of buildID: UUID, failure: String?, on db: any Database) async {
+        do {
+            guard let build = try await ImageBuild.find(buildID, on: db),
+                build.status == .capturing, build.stepDeadline != nil
+            else { return }
+            if failure == nil, let imageID = build.$image.id,
+                let image = try await Image.find(imageID, on: db), image.status == .ready
+            {
+                try await finish(build, as: .succeeded, reason: nil, now: Date(), on: db)
+                return
+            }
+            try await finish(
+                build, as: .failed,
+                reason: "Disk capture failed: \(failure ?? "the agent finished without uploading the disk")",
+                now: Date(), on: db)
+        } catch {
+            app.logger.warning(
+                "Failed to record image build capture: \(error)",
+                metadata: ["imageBuildId": .string(buildID.uuidString)])
+        }
+    }
+
+    /// The next version of the target image, `uploading` until the agent's
+    /// upload lands.
+    private func createTargetImage(for build: ImageBuild, on db: any Database) async throws -> Image {
+        let projectID = build.$project.id
+        let base = try await build.$baseImage.get(on: db)
+        let latest = try await Image.query(on: db)
+            .filter(\.$project.$id == projectID)
+            .filter(\.$name == build.targetImageName)
+            .max(\.$version)
+        let version = (latest ?? 0) + 1
+        let image = Image(
+            name: build.targetImageName,
+            description: build.targetImageDescription,
+            projectID: projectID,
+            filename: "\(Self.filenameStem(build.targetImageName))-v\(version).qcow2",
+            format: .qcow2,
+            architecture: base?.architecture ?? .x86_64,
+            status: .uploading,
+            uploadedByID: build.$createdBy.id,
+            defaultCpu: build.cpu,
+            defaultMemory: build.memory,
+            defaultDisk: build.disk,
+            defaultCmdline: base?.defaultCmdline,
+            version: version
+        )
+        image.$imageBuild.id = build.id
+        try await db.transaction { db in
+            try await image.save(on: db)
+            build.$image.id = image.id
+            try await build.save(on: db)
+        }
+        return image
+    }
+
+    /// `name` with anything but letters, digits, `.`, `_` and `-` replaced, for
+    /// the stored file's name.
+    static func filenameStem(_ name: String) -> String {
+        let allowed = Set("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789._-")
+        let stem = String(name.map { allowed.contains($0) ? $0 : "-" })
+        return stem.isEmpty ? "image" : stem
+    }
+
+    // MARK: - Helpers
+
+    /// Ends the build. An image whose capture never completed is deleted; the
+    /// VM goes on the next pass.
+    private func finish(
+        _ build: ImageBuild, as status: ImageBuildStatus, reason: String?, now: Date, on db: any Database
+    ) async throws {
+        build.enter(status, now: now)
+        build.errorMessage = reason
+        var abandoned: Image?
+        if status != .succeeded, let imageID = build.$image.id,
+            let image = try await Image.find(imageID, on: db), image.status != .ready
+        {
+            abandoned = image
+            build.$image.id = nil
+        }
+        try await db.transaction { db in
+            try await build.save(on: db)
+            try await abandoned?.delete(on: db)
+        }
+        app.logger.info(
+            "Image build finished",
+            metadata: [
+                "imageBuildId": .string(build.id?.uuidString ?? ""),
+                "status": .string(status.rawValue),
+                "reason": .string(reason ?? ""),
+            ])
+    }
+
+    /// Takes the build's step lease, until `deadline`. False when another
+    /// replica holds it, or the build moved on since it was read.
+    private func claimStep(of build: ImageBuild, until deadline: Date, on db: any Database) async throws -> Bool {
+        guard let sql = db as? SQLDatabase else { return false }
+        struct ClaimedRow: Decodable {
+            let id: UUID
+        }
+        let claimed = try await sql.raw(
+            """
+            UPDATE image_builds
+            SET step_deadline = \(bind: deadline), updated_at = now()
+            WHERE id = \(bind: try build.requireID())
+              AND status = \(bind: build.status.rawValue)
+              AND step_deadline IS NULL
+            RETURNING id
+            """
+        ).all(decoding: ClaimedRow.self)
+        guard !claimed.isEmpty else { return false }
+        build.stepDeadline = deadline
+        return true
+    }
+
+    /// Deletes a finished build's VM, then forgets it once the row is gone.
+    /// While a delete (or anything else) is pending on the VM, it waits.
+    private func removeVM(of build: ImageBuild, on db: any Database) async throws {
+        guard let vmID = build.vmId else { return }
+        guard let vm = try await VM.find(vmID, on: db) else {
+            build.vmId = nil
+            try await build.save(on: db)
+            return
+        }
+
+        // As `VMController.delete`: an offline or unplaced VM is removed
+        // directly, since no agent will confirm anything.
+        let app = self.app
+        let agentOnline: Bool
+        if let hypervisorId = vm.hypervisorId {
+            agentOnline = await app.agentService.agentIsOnline(agentId: hypervisorId)
+        } else {
+            agentOnline = false
+        }
+        let strategy: ResourceOperationCoordinator.Strategy =
+            agentOnline
+            ? .stateSync
+            : .directResolution { @Sendable db in
+                do {
+                    try await db.transaction { db in
+                        try await vm.delete(on: db)
+                        try await QuotaEnforcementService.release(for: vm, on: db)
+                    }
+                } catch {
+                    throw ResourceOperationCoordinator.WorkError(
+                        "Failed to delete VM record: \(error.localizedDescription)")
+                }
+            }
+        _ = try await startVMOperation(.delete, on: vm, dispatch: strategy, db: db) { db in
+            vm.setDesiredStatus(.absent)
+            try await vm.save(on: db)
+        }
+    }
+
+    /// Starts an operation on the build VM on the platform's behalf. False
+    /// when another is already pending on it; the next pass tries again.
+    private func startVMOperation(
+        _ kind: VMOperationKind, on vm: VM, dispatch strategy: ResourceOperationCoordinator.Strategy,
+        db: any Database, applying mutation: @escaping @Sendable (any Database) async throws -> Void
+    ) async throws -> Bool {
+        do {
+            try await app.resourceOperationCoordinator.perform(
+                kind, resourceKind: .virtualMachine, resourceID: try vm.requireID(),
+                userID: ResourceOperation.systemUserID, hypervisorId: vm.hypervisorId, dispatch: strategy,
+                on: db, app: app, applying: mutation)
+            return true
+        } catch let error as any AbortError where error.status == .conflict {
+            return false
+        }
+    }
+}
+
+extension Application {
+    private struct ImageBuildServiceKey: StorageKey, LockKey {
+        typealias Value = ImageBuildService
+    }
+
+    var imageBuilds: ImageBuildService {
+        lazyService(ImageBuildServiceKey.self) { ImageBuildService(app: self) }
+    }
+
+    /// The image build service if something already created it, so shutdown
+    /// does not instantiate it just to shut it down.
+    var imageBuildServiceIfCreated: ImageBuildService? {
+        storage[ImageBuildServiceKey.self]
+    }
+}
+
+/// Arms the image build sweep at boot and cancels it at shutdown.
+struct ImageBuildLifecycleHandler: LifecycleHandler {
+    func didBootAsync(_ application: Application) async throws {
+        application.imageBuilds.startSweep()
+    }
+
+    func shutdownAsync(_ application: Application) async {
+        application.imageBuildServiceIfCreated?.shutdown()
+    }
+}
@@ -105,3 +105,8 @@ extension SCIMToken: LastUsedTracked {
     static let lastUsedAtKey: FieldKey = "last_used_at"
     static let lastUsedIPKey: FieldKey = "last_used_ip"
 }
+
+extension UserSSHKey: LastUsedTracked {
+    static let lastUsedAtKey: FieldKey = "last_used_at"
+    static let lastUsedIPKey: FieldKey = "last_used_ip"
+}
@@ -0,0 +1,107 @@
+import Fluent
+import Foundation
+import Vapor
+
+/// The gate disruptive work passes before it touches tenant VMs, and the
+/// notices it sends on the way (project maintenance policies).
+///
+/// Work is gated per agent: every project with a VM placed there must be
+/// ready for it. A project without a policy always is. A project with one
+/// hears about the work once — a `MaintenanceNotice` plus the
+/// `maintenance.scheduled` webhook — scheduled for its first opening at
+/// least `noticeHours` away, and is ready once that time has passed and its
+/// policy is open. Callers re-ask on every sweep; the notices remember what
+/// was promised, so a busy rollout that misses a window simply starts in a
+/// later one.
+enum MaintenanceWindows {
+    /// How long notices are kept, started or not, for the project's history.
+    static let noticeRetention: TimeInterval = 30 * 86_400
+
+    struct Clearance: Sendable {
+        /// Projects with VMs on the agent that aren't ready for the work.
+        let waitingOn: [UUID]
+
+        var isCleared: Bool { waitingOn.isEmpty }
+    }
+
+    /// Whether `action` on `subject` may start on `agent` now. Projects
+    /// meeting the work for the first time are notified here; once every
+    /// project is ready, their notices are stamped started.
+    static func clearance(
+        for action: MaintenanceAction,
+        subject: String,
+        summary: String,
+        on agent: Agent,
+        now: Date = Date(),
+        db: Database
+    ) async throws -> Clearance {
+        guard let agentID = agent.id?.uuidString else { return Clearance(waitingOn: []) }
+        let projectIDs = Set(
+            try await VM.query(on: db)
+                .filter(\.$hypervisorId == agentID)
+                .all(\.$project.$id))
+        guard !projectIDs.isEmpty else { return Clearance(waitingOn: []) }
+
+        let projects = try await Project.query(on: db)
+            .filter(\.$id ~~ projectIDs)
+            .filter(\.$maintenancePolicy != nil)
+            .sort(\.$name)
+            .all()
+        guard !projects.isEmpty else { return Clearance(waitingOn: []) }
+
+        let existing = try await MaintenanceNotice.query(on: db)
+            .filter(\.$project.$id ~~ projectIDs)
+            .filter(\.$action == action.rawValue)
+            .filter(\.$subject == subject)
+            .all()
+        let notices = Dictionary(existing.map { ($0.$project.id, $0) }, uniquingKeysWith: { first, _ in first })
+
+        var waitingOn: [UUID] = []
+        var ready: [MaintenanceNotice] = []
+        for project in projects {
+            guard let projectID = project.id, let policy = project.maintenancePolicy else { continue }
+
+            let notice: MaintenanceNotice
+            if let announced = notices[projectID] {
+                notice = announced
+            } else {
+                let earliest = now.addingTimeInterval(TimeInterval(policy.noticeHours) * 3600)
+                guard let scheduledFor = policy.nextOpening(atOrAfter: earliest) else {
+                    // Denied as far as the horizon reaches: nothing to
+                    // promise yet, so nothing announced either.
+                    waitingOn.append(projectID)
+                    continue
+                }
+                notice = MaintenanceNotice(
+                    projectID: projectID, action: action, subject: subject,
+                    scheduledFor: scheduledFor, summary: summary)
+                try await db.transaction { tx in
+                    try await notice.save(on: tx)
+                    try await WebhookEvents.enqueueMaintenanceScheduled(
+                        notice: notice, project: project, agent: agent, on: tx)
+                }
+            }
+
+            if now >= notice.scheduledFor && policy.isOpen(at: now) {
+                ready.append(notice)
+            } else {
+                waitingOn.append(projectID)
+            }
+        }
+
+        if waitingOn.isEmpty {
+            for notice in ready where notice.startedAt == nil {
+                notice.startedAt = now
+                try await notice.save(on: db)
+            }
+        }
+        return Clearance(waitingOn: waitingOn)
+    }
+
+    /// Drops notices past retention. Called from the sweeps that gate work.
+    static func pruneNotices(now: Date = Date(), on db: Database) async throws {
+        try await MaintenanceNotice.query(on: db)
+            .filter(\.$createdAt < now.addingTimeInterval(-Self.noticeRetention))
+            .delete()
+    }
+}
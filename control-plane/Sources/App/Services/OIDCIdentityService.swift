@@ -8,8 +8,9 @@ import Vapor
 /// resolving (or JIT-provisioning) the user record, converging the OIDC and
 /// SCIM identity paths onto one user, enforcing SCIM deactivation, and syncing
 /// IdP-managed group memberships and the org role from token claims
-/// (issue #363). Lives outside `OIDCController` so tests can drive it without
-/// a fake IdP.
+/// (issue #363), and applying the organization's verified domains (auto-join
+/// and account claiming). Lives outside `OIDCController` so tests can drive it
+/// without a fake IdP.
 struct OIDCIdentityService {
     let db: Database
     let logger: Logger
@@ -51,7 +52,13 @@ struct OIDCIdentityService {
     /// sole provider — subjects aren't unique across issuers), (3) org member
     /// with the same email; both (2) and (3) link the user to the provider. Otherwise a new
     /// user is created and added to the org with the role derived from the
-    /// provider's admin claim values and configured default role.
+    /// provider's admin claim values and configured default role — or the
+    /// default role of the auto-join domain the user's email is at.
+    ///
+    /// An account holding the email that isn't an org member is never linked
+    /// here. When the email is at a verified domain that claims accounts,
+    /// `DomainAccountClaimRequired` asks the caller to get the account
+    /// holder's consent first (`claimAccount`); otherwise the login is refused.
     func resolveUser(
         userInfo: OIDCUserInfo,
         provider: OIDCProvider,
@@ -130,8 +137,10 @@ struct OIDCIdentityService {
         let email = userInfo.email ?? ""
         // The claim-driven role, resolved across the unified vocabulary — a
         // legacy literal, or a scoped custom role id (issue #611).
+        let autoJoinDomain = try await autoJoinDomain(for: userInfo, organizationID: organizationID)
         let resolvedRole = await resolveDesiredOrgRole(
-            provider: provider, organizationID: organizationID, groupValues: groupValues)
+            provider: provider, organizationID: organizationID, groupValues: groupValues,
+            defaultRole: autoJoinDomain?.defaultRole)
 
         // Reaching here with an email that already belongs to a user means we were
         // not allowed to link to that account — either the IdP didn't verify the
@@ -139,8 +148,17 @@ struct OIDCIdentityService {
         // unique, so JIT-provisioning would fail the constraint; deny with a clear
         // reason instead of surfacing a 500, and never auto-adopt the address.
         if !email.isEmpty {
-            let emailTaken = try await User.query(on: db).filter(\.$email == email).first() != nil
-            if emailTaken {
+            if let holder = try await User.query(on: db).filter(\.$email == email).first() {
+                // The organization proved it owns the address's domain, so its
+                // IdP speaks for the address: the account may be taken over,
+                // but only once its holder agrees to it. An account another
+                // IdP already signs in keeps that link.
+                if holder.$oidcProvider.id == nil,
+                    let domain = try await verifiedDomain(for: userInfo, organizationID: organizationID),
+                    domain.claimAccounts
+                {
+                    throw DomainAccountClaimRequired(userID: try holder.requireID(), domainID: try domain.requireID())
+                }
                 logger.warning(
                     "Refusing to JIT-provision an OIDC user whose email is already in use",
                     metadata: [
@@ -175,39 +193,170 @@ struct OIDCIdentityService {
                 throw Abort(.internalServerError, reason: "User ID is required")
             }
 
-            let membership = UserOrganization(
-                userID: userID,
-                organizationID: organizationID,
-                role: resolvedRole.storedRole
+            try await Self.addMembership(
+                userID: userID, organizationID: organizationID, role: resolvedRole, on: transaction)
+            return user
+        }
+    }
+
+    /// The org membership row and, in the same transaction, its role binding
+    /// on the org node — without the binding the user authenticates but fails
+    /// every permission check. Bare membership ("member") maps to no binding.
+    ///
+    /// Deliberately not gated by the write-time ceiling check (#484), unlike
+    /// the administrative grant APIs: this runs during sign-in, and failing
+    /// closed here would make an SMT solver a hard dependency of
+    /// authentication. Guardrails still apply to every request this user
+    /// makes, so a ceiling is enforced either way — what is given up is only
+    /// the explanation at write time, for a grant no human is watching anyway.
+    private static func addMembership(
+        userID: UUID, organizationID: UUID, role: MemberRoleResolver.ResolvedOrgRole, on db: Database
+    ) async throws {
+        let membership = UserOrganization(
+            userID: userID,
+            organizationID: organizationID,
+            role: role.storedRole
+        )
+        try await membership.save(on: db)
+
+        if let bindingRoleID = role.bindingRoleID {
+            try await RoleBindingService.grant(
+                principalType: .user,
+                principalID: userID,
+                roleID: bindingRoleID,
+                nodeType: .organization,
+                nodeID: organizationID,
+                createdBy: nil,
+                on: db
             )
-            try await membership.save(on: transaction)
+        }
+    }
 
-            // The claim-driven role gets its binding on the org node, in the
-            // same transaction as the mirror row — without it the new user
-            // authenticates but fails every permission check. Bare membership
-            // (default "member") maps to no binding.
-            //
-            // Deliberately not gated by the write-time ceiling check (#484),
-            // unlike the administrative grant APIs: this runs during sign-in,
-            // and failing closed here would make an SMT solver a hard
-            // dependency of authentication. Guardrails still apply to every
-            // request this user makes, so a ceiling is enforced either way —
-            // what is given up is only the explanation at write time, for a
-            // grant no human is watching anyway.
-            if let bindingRoleID = resolvedRole.bindingRoleID {
-                try await RoleBindingService.grant(
-                    principalType: .user,
-                    principalID: userID,
-                    roleID: bindingRoleID,
-                    nodeType: .organization,
-                    nodeID: organizationID,
-                    createdBy: nil,
-                    on: transaction
-                )
+    // MARK: - Verified domains
+
+    /// The organization's verified domain the identity's email is at. Only
+    /// an email the IdP asserts verified counts: the domain makes the
+    /// organization's IdPs authoritative for its addresses, not for whatever
+    /// a user typed into a profile.
+    func verifiedDomain(for userInfo: OIDCUserInfo, organizationID: UUID) async throws -> OrganizationDomain? {
+        guard userInfo.emailVerified, let email = userInfo.email else { return nil }
+        return try await OrganizationDomain.verified(forEmail: email, organizationID: organizationID, on: db)
+    }
+
+    /// `verifiedDomain`, when it auto-joins users.
+    func autoJoinDomain(for userInfo: OIDCUserInfo, organizationID: UUID) async throws -> OrganizationDomain? {
+        guard let domain = try await verifiedDomain(for: userInfo, organizationID: organizationID),
+            domain.autoJoin
+        else { return nil }
+        return domain
+    }
+
+    /// Join a user signing in through the organization's IdP to it when their
+    /// email is at an auto-join domain and they aren't a member — an account
+    /// linked to the IdP but removed from the organization, say. While
+    /// auto-join is on, membership follows the IdP: removing such a user
+    /// sticks only once the IdP stops vouching for them. Returns whether the
+    /// user was joined.
+    @discardableResult
+    func autoJoin(
+        user: User, userInfo: OIDCUserInfo, provider: OIDCProvider, organizationID: UUID, groupValues: [String]
+    ) async throws -> Bool {
+        guard let domain = try await autoJoinDomain(for: userInfo, organizationID: organizationID),
+            let userID = user.id
+        else { return false }
+        let isMember = try await UserOrganization.query(on: db)
+            .filter(\.$user.$id == userID)
+            .filter(\.$organization.$id == organizationID)
+            .first() != nil
+        guard !isMember else { return false }
+
+        let role = await resolveDesiredOrgRole(
+            provider: provider, organizationID: organizationID, groupValues: groupValues,
+            defaultRole: domain.defaultRole)
+        try await db.transaction { transaction in
+            try await Self.addMembership(userID: userID, organizationID: organizationID, role: role, on: transaction)
+            if user.currentOrganizationId == nil {
+                user.currentOrganizationId = organizationID
+                try await user.save(on: transaction)
             }
+        }
+        logger.info(
+            "Auto-joined a user to the organization of their verified email domain",
+            metadata: [
+                "user_id": .string(userID.uuidString),
+                "organization_id": .string(organizationID.uuidString),
+                "domain": .string(domain.domain),
+            ])
+        return true
+    }
 
-            return user
+    /// Take an existing account over into the organization once its holder
+    /// has consented (see `resolveUser`): the account is linked to the
+    /// provider, so the IdP signs it in from now on, and joins the
+    /// organization with the domain's default role.
+    ///
+    /// The IdP vouching for the email is not consent: whoever controls the
+    /// IdP could otherwise take any account at the domain. `confirmedUserID`
+    /// is the account the caller re-authenticated as (a passkey assertion in
+    /// `acceptDomainClaim`), and must be the one claimed. An account already
+    /// linked to another identity is refused rather than relinked. Everything
+    /// `resolveUser` checked is checked again, as the consent may come
+    /// minutes later.
+    func claimAccount(
+        userID: UUID, domainID: UUID, provider: OIDCProvider, subject: String, groupValues: [String],
+        confirmedUserID: UUID
+    ) async throws -> User {
+        guard let providerID = provider.id else {
+            throw Abort(.internalServerError, reason: "Provider ID is required")
+        }
+        let organizationID = provider.$organization.id
+        guard let domain = try await OrganizationDomain.find(domainID, on: db),
+            domain.$organization.id == organizationID,
+            domain.domainStatus == .verified, domain.claimAccounts
+        else {
+            throw Abort(.forbidden, reason: "The organization no longer claims accounts at this domain")
+        }
+        guard let user = try await User.find(userID, on: db),
+            OrganizationDomain.domain(ofEmail: user.email) == domain.domain
+        else {
+            throw Abort(.notFound, reason: "The account to claim no longer exists")
+        }
+        guard confirmedUserID == userID else {
+            throw Abort(.forbidden, reason: "Sign in to the account being claimed to confirm the claim")
+        }
+        if let linkedProvider = user.$oidcProvider.id, linkedProvider != providerID || user.oidcSubject != subject {
+            throw Abort(.conflict, reason: "This account already signs in through another identity provider")
         }
+        if let linked = try await User.findOIDCUser(subject: subject, providerID: providerID, on: db),
+            linked.id != userID
+        {
+            throw Abort(.conflict, reason: "This identity already signs in to another account")
+        }
+        let isMember = try await UserOrganization.query(on: db)
+            .filter(\.$user.$id == userID)
+            .filter(\.$organization.$id == organizationID)
+            .first() != nil
+
+        let role = await resolveDesiredOrgRole(
+            provider: provider, organizationID: organizationID, groupValues: groupValues,
+            defaultRole: domain.defaultRole)
+        try await db.transaction { transaction in
+            user.linkToOIDCProvider(providerID, subject: subject)
+            user.currentOrganizationId = organizationID
+            try await user.save(on: transaction)
+            if !isMember {
+                try await Self.addMembership(
+                    userID: userID, organizationID: organizationID, role: role, on: transaction)
+            }
+        }
+        logger.info(
+            "Existing account claimed by the organization of its verified email domain",
+            metadata: [
+                "user_id": .string(userID.uuidString),
+                "organization_id": .string(organizationID.uuidString),
+                "domain": .string(domain.domain),
+            ])
+        return user
     }
 
     // MARK: - SCIM deactivation
@@ -302,7 +451,8 @@ struct OIDCIdentityService {
         user: User,
         provider: OIDCProvider,
         organizationID: UUID,
-        groupValues: [String]
+        groupValues: [String],
+        defaultRole: String? = nil
     ) async throws {
         // As with group sync, an unset groups claim disables role mapping —
         // empty claim values must not demote anyone.
@@ -319,7 +469,8 @@ struct OIDCIdentityService {
         }
 
         let resolved = await resolveDesiredOrgRole(
-            provider: provider, organizationID: organizationID, groupValues: groupValues)
+            provider: provider, organizationID: organizationID, groupValues: groupValues,
+            defaultRole: defaultRole)
         guard membership.role != resolved.storedRole else { return }
 
         if membership.role == "admin" {
@@ -384,13 +535,16 @@ struct OIDCIdentityService {
     /// precedence order (issue #611):
     ///  1. any configured admin claim value present → the literal `"admin"`;
     ///  2. the first role mapping whose claim value is present → its role id;
-    ///  3. the provider's configured default role.
+    ///  3. `defaultRole` — an auto-join domain's — or else the provider's
+    ///     configured default role.
     ///
     /// Admin claim values keep the top of the order for backward compatibility:
     /// an org that grants "admin" by claim keeps doing so even if a role mapping
     /// also matches. The returned value is a *token* — a legacy literal, an IAM
     /// name, or a role id — that `resolveDesiredOrgRole` turns into a binding.
-    func desiredOrganizationRole(provider: OIDCProvider, groupValues: [String]) -> String {
+    func desiredOrganizationRole(
+        provider: OIDCProvider, groupValues: [String], defaultRole: String? = nil
+    ) -> String {
         let adminValues = Set(provider.adminClaimValuesArray)
         if !adminValues.isEmpty && groupValues.contains(where: adminValues.contains) {
             return "admin"
@@ -399,7 +553,7 @@ struct OIDCIdentityService {
         for mapping in provider.roleMappingsArray where claimValues.contains(mapping.claimValue) {
             return mapping.roleID.uuidString
         }
-        return provider.defaultRole
+        return defaultRole ?? provider.defaultRole
     }
 
     /// True when the provider drives the org role from claims at all — either
@@ -420,9 +574,9 @@ struct OIDCIdentityService {
     /// failing. Provider config is validated at write time, so this is the rare
     /// after-the-fact path.
     func resolveDesiredOrgRole(
-        provider: OIDCProvider, organizationID: UUID, groupValues: [String]
+        provider: OIDCProvider, organizationID: UUID, groupValues: [String], defaultRole: String? = nil
     ) async -> MemberRoleResolver.ResolvedOrgRole {
-        let raw = desiredOrganizationRole(provider: provider, groupValues: groupValues)
+        let raw = desiredOrganizationRole(provider: provider, groupValues: groupValues, defaultRole: defaultRole)
         do {
             return try await MemberRoleResolver.resolveOrganizationRole(
                 raw, organizationID: organizationID, on: db)
@@ -445,3 +599,12 @@ struct OIDCIdentityService {
         }
     }
 }
+
+/// Thrown by `OIDCIdentityService.resolveUser` when the identity's email
+/// belongs to an existing account outside the organization, at a verified
+/// domain that claims accounts: the account may be taken over, but only once
+/// the person signing in consents (`claimAccount`).
+struct DomainAccountClaimRequired: Error {
+    let userID: UUID
+    let domainID: UUID
+}
@@ -45,12 +45,35 @@ struct ObservedStateApplier {
             .filter(\.$hypervisorId == report.agentId)
             .all()
 
+        // File shares (wire v24) follow the sandbox shape too; an agent that
+        // predates them reports none, and hosts none to report.
+        let reportedFileShares = Dictionary(
+            report.fileShares.map { ($0.shareId, $0) },
+            uniquingKeysWith: { first, _ in first }
+        )
+
+        let dbFileShares = try await FileShare.query(on: db)
+            .filter(\.$hypervisorId == report.agentId)
+            .all()
+
+        // Buckets (wire v25) have no operations: the report alone moves
+        // their status.
+        let reportedBuckets = Dictionary(
+            report.buckets.map { ($0.bucketId, $0) },
+            uniquingKeysWith: { first, _ in first }
+        )
+
+        let dbBuckets = try await Bucket.query(on: db)
+            .filter(\.$hypervisorId == report.agentId)
+            .all()
+
         // Pending operations are sparse but used by both the present and
         // absent paths. Fetch every candidate in one report-level query
         // instead of issuing a point query for every VM and sandbox.
         let resourceIDs =
             dbVMs.compactMap(\.id)
             + dbSandboxes.compactMap(\.id)
+            + dbFileShares.compactMap(\.id)
         let pendingOperations: [ResourceKey: ResourceOperation]
         if resourceIDs.isEmpty {
             pendingOperations = [:]
@@ -79,6 +102,10 @@ struct ObservedStateApplier {
                 return reported[key.id] == nil ? nil : key.id.uuidString
             case .sandbox:
                 return reportedSandboxes[key.id] == nil ? nil : key.id.uuidString
+            case .fileShare:
+                // Shares are placed at create time, without a scheduler
+                // reservation.
+                return nil
             }
         }
         if !accountedReservationIDs.isEmpty {
@@ -158,6 +185,36 @@ struct ObservedStateApplier {
                 )
             }
         }
+
+        for share in dbFileShares {
+            guard let shareID = share.id else { continue }
+            let operation = pendingOperations[
+                ResourceKey(kind: .fileShare, id: shareID)
+            ]
+            if let observed = reportedFileShares[shareID] {
+                try await applyObservedFileShareState(
+                    share: share,
+                    observed: observed,
+                    pendingOperation: operation,
+                    on: db
+                )
+            } else {
+                try await handleReportedFileShareAbsence(
+                    share: share,
+                    agentId: report.agentId,
+                    pendingOperation: operation,
+                    on: db
+                )
+            }
+        }
+
+        for bucket in dbBuckets {
+            if let observed = bucket.id.flatMap({ reportedBuckets[$0] }) {
+                try await applyObservedBucketState(bucket: bucket, observed: observed, on: db)
+            } else {
+                try await handleReportedBucketAbsence(bucket: bucket, agentId: report.agentId, on: db)
+            }
+        }
     }
 
     /// Apply one settled (or failing) observation to its VM row and resolve
@@ -194,6 +251,19 @@ struct ObservedStateApplier {
             try await clearMemoryStats(vm: vm, on: db)
         }
 
+        // Application health (wire v31) follows the same contract again: a
+        // VM's verdict is reported only while it runs, so a nil on a running
+        // VM keeps the last one (and with it, one remediation per unhealthy
+        // spell — a rebooting or replaced VM doesn't retrigger its action).
+        if let health = observed.health {
+            try await persistHealth(vm: vm, observation: health, on: db)
+        } else if Self.guestInfoClearedByStatus.contains(observed.status) {
+            try await clearHealth(vm: vm, on: db)
+        }
+
+        // Usage history for rightsizing, sampled on its own slower cadence.
+        try await VMUsageRecorder.record(vm: vm, observed: observed, on: db)
+
         // Still converging: progress only. The status is not settled, so it
         // must not overwrite the row or complete operations.
         if observed.convergencePhase != nil {
@@ -392,6 +462,104 @@ struct ObservedStateApplier {
         try await vm.save(on: db)
     }
 
+    /// Persists a VM's health-check verdict (wire v31). Writes only when the
+    /// verdict, failure count or message changed, so `healthCheckedAt` is
+    /// when it last changed rather than the last probe. A turn to unhealthy
+    /// runs the VM's `healthAction`; any turn after the first verdict, and a
+    /// first verdict of unhealthy, emits `vm.health_changed`.
+    private func persistHealth(vm: VM, observation: VMHealthObservation, on db: Database) async throws {
+        let previous = vm.healthStatus
+        guard
+            previous != observation.status.rawValue
+                || vm.healthConsecutiveFailures != observation.consecutiveFailures
+                || vm.healthMessage != observation.message
+        else { return }
+        vm.healthStatus = observation.status.rawValue
+        vm.healthConsecutiveFailures = observation.consecutiveFailures
+        vm.healthCheckedAt = observation.checkedAt
+        vm.healthMessage = observation.message
+        try await vm.save(on: db)
+
+        guard previous != observation.status.rawValue else { return }
+        var action: VMHealthAction?
+        if observation.status == .unhealthy, vm.healthCheck != nil,
+            let policy = vm.healthAction.flatMap(VMHealthAction.init(rawValue:)), policy != .event
+        {
+            action = policy
+        }
+        app.logger.info(
+            "VM health changed",
+            metadata: [
+                "vmId": .string(vm.id?.uuidString ?? ""),
+                "health": .string(observation.status.rawValue),
+                "consecutiveFailures": .stringConvertible(observation.consecutiveFailures),
+                "action": .string(action?.rawValue ?? "none"),
+            ])
+        if previous != nil || observation.status == .unhealthy {
+            await WebhookEvents.emitVMHealthChanged(
+                vm: vm, previous: previous, current: observation, action: action?.rawValue, on: db,
+                logger: app.logger)
+        }
+        if let action {
+            await remediateUnhealthyVM(vm, action: action, on: db)
+        }
+    }
+
+    /// Clears a VM's health verdict once it is definitively not running, so
+    /// its next run starts from "not yet decided".
+    private func clearHealth(vm: VM, on db: Database) async throws {
+        guard vm.healthStatus != nil else { return }
+        vm.healthStatus = nil
+        vm.healthConsecutiveFailures = nil
+        vm.healthCheckedAt = nil
+        vm.healthMessage = nil
+        try await vm.save(on: db)
+    }
+
+    /// Runs a VM's health policy as an ordinary operation on behalf of the
+    /// platform: a reboot, or a replacement that recreates the VM from its
+    /// image on the same agent. An operation already in flight wins — the
+    /// user's own action, or the VM being stopped — and the remediation is
+    /// skipped rather than queued.
+    private func remediateUnhealthyVM(_ vm: VM, action: VMHealthAction, on db: Database) async {
+        guard let vmID = vm.id else { return }
+        let coordinator = app.resourceOperationCoordinator
+        do {
+            switch action {
+            case .event:
+                return
+            case .reboot:
+                try await coordinator.perform(
+                    .reboot, resourceKind: .virtualMachine, resourceID: vmID,
+                    userID: ResourceOperation.systemUserID, hypervisorId: vm.hypervisorId,
+                    dispatch: .awaitingResponse(.vmReboot), on: db, app: app)
+            case .replace:
+                try await coordinator.perform(
+                    .replace, resourceKind: .virtualMachine, resourceID: vmID,
+                    userID: ResourceOperation.systemUserID, hypervisorId: vm.hypervisorId,
+                    dispatch: .stateSync, on: db, app: app
+                ) { @Sendable db in
+                    vm.replacementCount += 1
+                    vm.bumpGeneration()
+                    try await vm.save(on: db)
+                }
+            }
+            Telemetry.vmHealthRemediated(action: action.rawValue)
+        } catch let error as any AbortError where error.status == .conflict {
+            app.logger.info(
+                "Skipping VM health action: another operation is in flight",
+                metadata: ["vmId": .string(vmID.uuidString), "action": .string(action.rawValue)])
+        } catch {
+            app.logger.warning(
+                "VM health action failed to start",
+                metadata: [
+                    "vmId": .string(vmID.uuidString),
+                    "action": .string(action.rawValue),
+                    "error": .string(String(describing: error)),
+                ])
+        }
+    }
+
     /// VM statuses for which a nil `guestInfo` should *clear* the stored qga
     /// view rather than preserve it: the guest is definitively not running, so
     /// its last-known hostname/addresses are stale. Running, paused,
@@ -612,6 +780,213 @@ struct ObservedStateApplier {
     }
 }
 
+// MARK: - File shares
+
+extension ObservedStateApplier {
+    /// Apply one file-share observation: sizes and generation, the snapshot
+    /// rows it confirms, then the pending operation it satisfies or fails.
+    fileprivate func applyObservedFileShareState(
+        share: FileShare,
+        observed: ObservedFileShareState,
+        pendingOperation: ResourceOperation?,
+        on db: Database
+    ) async throws {
+        let shareID = try share.requireID()
+
+        if observed.convergencePhase != nil {
+            app.logger.debug(
+                "File share converging on agent",
+                metadata: [
+                    "fileShareId": .string(shareID.uuidString),
+                    "phase": .string(observed.convergencePhase ?? ""),
+                    "targetGeneration": .stringConvertible(share.generation),
+                ])
+            return
+        }
+
+        if observed.observedGeneration > share.observedGeneration {
+            share.observedGeneration = observed.observedGeneration
+        }
+        share.observedSizeBytes = observed.sizeBytes
+        share.usedBytes = observed.usedBytes
+
+        // Snapshot rows move on what the agent actually holds. A `creating`
+        // row the agent still lacks after converging this generation failed
+        // to be taken; it leaves desired state as `.error`.
+        let converged = observed.observedGeneration >= share.generation
+        let present = Dictionary(
+            observed.snapshots.map { ($0.snapshotId, $0.sizeBytes) },
+            uniquingKeysWith: { first, _ in first })
+        let snapshots = try await FileShareSnapshot.query(on: db)
+            .filter(\.$share.$id == shareID)
+            .all()
+        var snapshotsChanged = false
+        for snapshot in snapshots {
+            let snapshotID = try snapshot.requireID()
+            switch (snapshot.status, present[snapshotID]) {
+            case (.creating, .some(let size)), (.available, .some(let size)):
+                if snapshot.status != .available || snapshot.sizeBytes != size {
+                    snapshot.status = .available
+                    snapshot.sizeBytes = size
+                    try await snapshot.save(on: db)
+                    snapshotsChanged = true
+                }
+            case (.deleting, .none):
+                try await snapshot.delete(on: db)
+                snapshotsChanged = true
+            case (.creating, .none) where converged:
+                snapshot.status = .error
+                try await snapshot.save(on: db)
+                snapshotsChanged = true
+            default:
+                break
+            }
+        }
+        if snapshotsChanged {
+            // Admission reserved an estimate; recount against real sizes.
+            try await QuotaEnforcementService.release(for: share, on: db)
+        }
+
+        if converged, observed.status == .available {
+            if share.status != .available || share.errorMessage != nil {
+                share.setStatus(.available)
+                share.errorMessage = nil
+            }
+            try await share.save(on: db)
+            // Deletions complete by absence from the report, never by a status.
+            if let operation = pendingOperation, share.desiredStatus == .present {
+                _ = try await operation.completeIfPending(as: .succeeded, error: nil, on: db)
+            }
+            return
+        }
+
+        if let lastError = observed.lastError, observed.failedGeneration == share.generation {
+            share.errorMessage = lastError
+            var sizeReverted = false
+            if let operation = pendingOperation,
+                try await operation.completeIfPending(as: .failed, error: lastError, on: db)
+            {
+                let sizeBefore = share.sizeBytes
+                share.revertDesiredToObserved()
+                sizeReverted = share.sizeBytes != sizeBefore
+                share.setStatus(share.observedGeneration > 0 ? .available : .error)
+            }
+            try await share.save(on: db)
+            if sizeReverted {
+                try await QuotaEnforcementService.release(for: share, on: db)
+            }
+            return
+        }
+
+        try await share.save(on: db)
+    }
+
+    /// A file share the database maps to this agent is absent from its full
+    /// report: a confirmed deletion, or a share the agent lost.
+    fileprivate func handleReportedFileShareAbsence(
+        share: FileShare,
+        agentId: String,
+        pendingOperation: ResourceOperation?,
+        on db: Database
+    ) async throws {
+        let shareID = try share.requireID()
+
+        if share.desiredStatus == .absent {
+            if let operation = pendingOperation {
+                _ = try await operation.completeIfPending(as: .succeeded, error: nil, on: db)
+            }
+            // Snapshot rows cascade with the share.
+            try await db.transaction { db in
+                try await share.delete(on: db)
+                try await QuotaEnforcementService.release(for: share, on: db)
+                try await RoleBindingService.revokeAll(nodeType: .fileShare, nodeID: shareID, on: db)
+            }
+            app.logger.info(
+                "File share deletion confirmed by agent report; record removed",
+                metadata: ["fileShareId": .string(shareID.uuidString), "agentId": .string(agentId)])
+            return
+        }
+
+        // A never-confirmed share may be mid-create on an agent that has not
+        // received the sync yet.
+        guard share.observedGeneration > 0, share.status != .error else { return }
+
+        share.setStatus(.error)
+        share.errorMessage = "File share is missing from its agent"
+        try await share.save(on: db)
+        app.logger.warning(
+            "File share missing from agent observed-state report; marking as error",
+            metadata: ["fileShareId": .string(shareID.uuidString), "agentId": .string(agentId)])
+    }
+}
+
+// MARK: - Buckets
+
+extension ObservedStateApplier {
+    /// Apply one bucket observation: usage, endpoint and generation, then the
+    /// status the converged (or failed) generation implies.
+    fileprivate func applyObservedBucketState(
+        bucket: Bucket,
+        observed: ObservedBucketState,
+        on db: Database
+    ) async throws {
+        if observed.observedGeneration > bucket.observedGeneration {
+            bucket.observedGeneration = observed.observedGeneration
+        }
+        bucket.usedBytes = observed.usedBytes
+        bucket.objectCount = observed.objectCount
+        bucket.endpoint = observed.endpoint
+
+        // A deletion completes by absence from the report, never by a status.
+        if bucket.desiredStatus == .present {
+            if bucket.isConverged, observed.status == .available {
+                if bucket.status != .available || bucket.errorMessage != nil {
+                    bucket.setStatus(.available)
+                    bucket.errorMessage = nil
+                }
+            } else if let lastError = observed.lastError, observed.failedGeneration == bucket.generation {
+                bucket.errorMessage = lastError
+                if bucket.status != .error {
+                    bucket.setStatus(.error)
+                }
+            }
+        }
+        try await bucket.save(on: db)
+    }
+
+    /// A bucket the database maps to this agent is absent from its full
+    /// report: a confirmed deletion, or a bucket the agent lost.
+    fileprivate func handleReportedBucketAbsence(
+        bucket: Bucket,
+        agentId: String,
+        on db: Database
+    ) async throws {
+        let bucketID = try bucket.requireID()
+
+        if bucket.desiredStatus == .absent {
+            try await db.transaction { db in
+                try await bucket.delete(on: db)
+                try await RoleBindingService.revokeAll(nodeType: .bucket, nodeID: bucketID, on: db)
+            }
+            app.logger.info(
+                "Bucket deletion confirmed by agent report; record removed",
+                metadata: ["bucketId": .string(bucketID.uuidString), "agentId": .string(agentId)])
+            return
+        }
+
+        // A never-confirmed bucket may be mid-create on an agent that has not
+        // received the sync yet.
+        guard bucket.observedGeneration > 0, bucket.status != .error else { return }
+
+        bucket.setStatus(.error)
+        bucket.errorMessage = "Bucket is missing from its agent"
+        try await bucket.save(on: db)
+        app.logger.warning(
+            "Bucket missing from agent observed-state report; marking as error",
+            metadata: ["bucketId": .string(bucketID.uuidString), "agentId": .string(agentId)])
+    }
+}
+
 extension Application {
     /// The observed-state report applier. Stateless and cheap to construct
     /// (it holds a reference), so it is materialized per access rather than
@@ -174,6 +174,25 @@ struct QuotaEnforcementService {
         }
     }
 
+    /// Admission for file-share capacity: a new share's size, a resize's
+    /// growth, or a snapshot's estimate (the share's used bytes). Shares draw
+    /// from the same storage pool as VM disks. Call inside the same
+    /// transaction as the write that adds the bytes, and before it, so the
+    /// resync baseline does not already include them.
+    static func reserveFileShare(
+        for project: Project,
+        environment: String,
+        size: Int64,
+        on db: Database
+    ) async throws {
+        try await reserveWorkload(for: project, environment: environment, on: db) { quota in
+            let check = quota.canAccommodateFileShareStorage(size)
+            guard check.allowed else { return check }
+            try quota.reserveFileShareStorage(size)
+            return check
+        }
+    }
+
     /// Post-completion validation for sandbox snapshots (issue #426):
     /// admission reserved an *estimate*, so once the agent reports actual
     /// sizes the caller re-checks the pool. Resyncs every applicable quota to
@@ -276,6 +295,15 @@ struct QuotaEnforcementService {
         try await releaseWorkload(projectID: sandbox.$project.id, environment: sandbox.environment, on: db)
     }
 
+    /// File-share counterpart of `release(for vm:)`: call *after* the share
+    /// row is deleted, or after its size was reverted.
+    static func release(
+        for share: FileShare,
+        on db: Database
+    ) async throws {
+        try await releaseWorkload(projectID: share.$project.id, environment: share.environment, on: db)
+    }
+
     private static func releaseWorkload(projectID: UUID, environment: String, on db: Database) async throws {
         guard let project = try await Project.find(projectID, on: db) else { return }
         let quotas = try await applicableQuotas(for: project, environment: environment, on: db)
@@ -317,7 +345,8 @@ struct QuotaEnforcementService {
         let usage = try await QuotaUsageAggregator.measure(scope, on: db)
         quota.reservedVCPUs = usage.vcpus
         quota.reservedMemory = usage.memoryBytes
-        // Storage: VM disks plus sandbox snapshot artifacts (issue #426).
+        // Storage: VM disks, sandbox snapshot artifacts (issue #426) and file
+        // shares with their snapshots.
         quota.reservedStorage = usage.storageBytes
         quota.vmCount = usage.vmCount
         quota.sandboxCount = usage.sandboxCount
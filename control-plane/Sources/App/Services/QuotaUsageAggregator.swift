@@ -39,9 +39,9 @@ struct QuotaScope: Sendable {
 struct QuotaMeasuredUsage: Sendable {
     var vcpus: Int
     var memoryBytes: Int64
-    /// VM disks plus sandbox-snapshot artifacts. Sandboxes themselves reserve
-    /// no storage, but their checkpoints persist real bytes in the same pool
-    /// (issue #426).
+    /// VM disks plus sandbox-snapshot artifacts and file shares. Sandboxes
+    /// themselves reserve no storage, but their checkpoints persist real bytes
+    /// in the same pool (issue #426).
     var storageBytes: Int64
     var vmCount: Int
     var sandboxCount: Int
@@ -109,7 +109,8 @@ struct QuotaUsageAggregator {
     }
 
     /// Measures `scope` with one aggregate per workload table: VMs, sandboxes,
-    /// and the snapshot artifacts that also occupy the storage pool.
+    /// and the snapshot artifacts and file shares that also occupy the
+    /// storage pool.
     static func measure(_ scope: QuotaScope, on db: Database) async throws -> QuotaMeasuredUsage {
         if case .none = scope.projects { return .none }
         let sql = try requireSQL(db)
@@ -148,11 +149,12 @@ struct QuotaUsageAggregator {
         ).first(decoding: SandboxTotals.self)
 
         let snapshotStorage = try await snapshotStorageBytes(in: scope, on: db)
+        let fileShareStorage = try await fileShareStorageBytes(in: scope, on: db)
 
         return QuotaMeasuredUsage(
             vcpus: Int(vms?.vcpus ?? 0) + Int(sandboxes?.vcpus ?? 0),
             memoryBytes: (vms?.memory_bytes ?? 0) + (sandboxes?.memory_bytes ?? 0),
-            storageBytes: (vms?.disk_bytes ?? 0) + snapshotStorage,
+            storageBytes: (vms?.disk_bytes ?? 0) + snapshotStorage + fileShareStorage,
             vmCount: Int(vms?.vm_count ?? 0),
             sandboxCount: Int(sandboxes?.sandbox_count ?? 0)
         )
@@ -193,6 +195,36 @@ struct QuotaUsageAggregator {
         return total?.storage_bytes ?? 0
     }
 
+    /// Total file-share storage in scope: each share's provisioned size plus
+    /// its snapshots. A share is charged its capacity rather than its used
+    /// bytes — the capacity is what the agent sets aside. Snapshots are
+    /// charged their reported size, or the share's used bytes as an estimate
+    /// until the agent reports one; `error` snapshots hold nothing.
+    static func fileShareStorageBytes(in scope: QuotaScope, on db: Database) async throws -> Int64 {
+        if case .none = scope.projects { return 0 }
+        let sql = try requireSQL(db)
+
+        struct StorageTotal: Decodable {
+            let storage_bytes: Int64
+        }
+        let shares = try await sql.raw(
+            """
+            SELECT COALESCE(SUM(size_bytes), 0)::bigint AS storage_bytes
+            FROM file_shares
+            WHERE \(scope.predicate)
+            """
+        ).first(decoding: StorageTotal.self)
+        let snapshots = try await sql.raw(
+            """
+            SELECT COALESCE(SUM(size_bytes), 0)::bigint AS storage_bytes
+            FROM file_share_snapshots
+            WHERE \(scope.predicate)
+              AND status::text <> \(bind: FileShareSnapshotStatus.error.rawValue)
+            """
+        ).first(decoding: StorageTotal.self)
+        return (shares?.storage_bytes ?? 0) + (snapshots?.storage_bytes ?? 0)
+    }
+
     /// Counts the scope's VMs by environment and by status in one grouped
     /// aggregate, for the per-quota usage endpoint.
     static func vmBreakdown(in scope: QuotaScope, on db: Database) async throws -> QuotaVMBreakdown {
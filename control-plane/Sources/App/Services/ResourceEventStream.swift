@@ -0,0 +1,199 @@
+import Fluent
+import Foundation
+import NIOConcurrencyHelpers
+import Vapor
+
+/// Feeds GraphQL subscriptions from the `resource_events` log.
+///
+/// Every replica tails the table itself — events are written by whichever
+/// replica handled the change, inside its transaction, so polling the table
+/// sees exactly the committed ones wherever the subscriber is connected. A
+/// poll re-reads `overlap` behind the newest row it has seen, because a row's
+/// `created_at` is stamped before its transaction commits; ids already
+/// delivered inside that window are skipped. The loop only queries while this
+/// replica has subscribers, and every replica prunes rows past `retention`.
+final class ResourceEventStream: @unchecked Sendable {
+    let app: Application
+    private let pollTask: NIOLockedValueBox<Task<Void, Never>?> = .init(nil)
+
+    private struct State {
+        var subscribers: [UUID: AsyncStream<ResourceEvent>.Continuation] = [:]
+        /// Newest `created_at` delivered, starting from when the first
+        /// current subscriber arrived.
+        var cursor = Date()
+        /// When the first current subscriber arrived: nothing older is
+        /// replayed to them, overlap or not.
+        var floor = Date()
+        /// Ids delivered within the overlap window, with their `created_at`.
+        var delivered: [UUID: Date] = [:]
+        var lastPrune = Date.distantPast
+    }
+
+    private let state = NIOLockedValueBox(State())
+
+    /// How often each replica polls. Worst-case added latency for an event.
+    static let pollInterval: Duration = .seconds(1)
+
+    /// How far behind the newest delivered row each poll re-reads: the
+    /// longest a transaction that writes an event may stay open and still
+    /// have it delivered.
+    static let overlap: TimeInterval = 30
+
+    /// Rows older than this are deleted. Subscribers only ever see live
+    /// events; the log is not a history API.
+    static let retention: TimeInterval = 3600
+
+    static let pruneInterval: TimeInterval = 60
+
+    init(app: Application) {
+        self.app = app
+    }
+
+    private var pollEnabled: Bool {
+        Environment.get("RESOURCE_EVENT_STREAM_ENABLED").flatMap(Bool.init)
+            ?? (app.environment != .testing)
+    }
+
+    // MARK: - Subscribers
+
+    /// A stream of every event committed from now on. Callers filter by what
+    /// they asked for and what the subscriber may read, and must
+    /// `unsubscribe` when done.
+    func subscribe() -> (id: UUID, events: AsyncStream<ResourceEvent>) {
+        let id = UUID()
+        let (stream, continuation) = AsyncStream.makeStream(
+            of: ResourceEvent.self, bufferingPolicy: .bufferingNewest(256))
+        state.withLockedValue { state in
+            if state.subscribers.isEmpty {
+                let now = Date()
+                state.cursor = now
+                state.floor = now
+                state.delivered = [:]
+            }
+            state.subscribers[id] = continuation
+        }
+        return (id, stream)
+    }
+
+    func unsubscribe(_ id: UUID) {
+        let continuation = state.withLockedValue { $0.subscribers.removeValue(forKey: id) }
+        continuation?.finish()
+    }
+
+    var subscriberCount: Int {
+        state.withLockedValue { $0.subscribers.count }
+    }
+
+    // MARK: - Polling
+
+    func startPolling() {
+        pollTask.withLockedValue { task in
+            guard task == nil else { return }
+            task = Task { [weak self] in
+                guard let self, self.pollEnabled else { return }
+                while !Task.isCancelled {
+                    do {
+                        try await self.pollOnce()
+                    } catch {
+                        self.app.logger.warning(
+                            "Resource event poll failed", metadata: ["error": .string("\(error)")])
+                    }
+                    do {
+                        try await Task.sleep(for: Self.pollInterval)
+                    } catch {
+                        break  // cancelled
+                    }
+                }
+            }
+        }
+    }
+
+    /// Finish every subscriber's stream, closing their sockets, and stop
+    /// polling.
+    func shutdown() {
+        pollTask.withLockedValue { task in
+            task?.cancel()
+            task = nil
+        }
+        let continuations = state.withLockedValue { state in
+            defer { state.subscribers = [:] }
+            return Array(state.subscribers.values)
+        }
+        continuations.forEach { $0.finish() }
+    }
+
+    /// One poll. Internal rather than private so tests can drive it directly
+    /// without the timer.
+    func pollOnce(now: Date = Date()) async throws {
+        try await pruneIfDue(now: now)
+
+        let since = state.withLockedValue { state -> Date? in
+            guard !state.subscribers.isEmpty else { return nil }
+            return max(state.floor, state.cursor.addingTimeInterval(-Self.overlap))
+        }
+        guard let since else { return }
+        let rows = try await ResourceEvent.query(on: app.db)
+            .filter(\.$createdAt >= since)
+            .sort(\.$createdAt)
+            .sort(\.$id)
+            .all()
+
+        let (fresh, continuations) = state.withLockedValue { state in
+            var fresh: [ResourceEvent] = []
+            for row in rows {
+                guard let id = row.id, let createdAt = row.createdAt, state.delivered[id] == nil else { continue }
+                state.delivered[id] = createdAt
+                fresh.append(row)
+                state.cursor = max(state.cursor, createdAt)
+            }
+            let horizon = state.cursor.addingTimeInterval(-Self.overlap)
+            state.delivered = state.delivered.filter { $0.value >= horizon }
+            return (fresh, Array(state.subscribers.values))
+        }
+        for event in fresh {
+            for continuation in continuations { continuation.yield(event) }
+        }
+    }
+
+    private func pruneIfDue(now: Date) async throws {
+        let due = state.withLockedValue { state in
+            guard now.timeIntervalSince(state.lastPrune) >= Self.pruneInterval else { return false }
+            state.lastPrune = now
+            return true
+        }
+        guard due else { return }
+        try await ResourceEvent.query(on: app.db)
+            .filter(\.$createdAt < now.addingTimeInterval(-Self.retention))
+            .delete()
+    }
+}
+
+// MARK: - Application accessor / lifecycle
+
+extension Application {
+    private struct ResourceEventStreamKey: StorageKey, LockKey {
+        typealias Value = ResourceEventStream
+    }
+
+    var resourceEvents: ResourceEventStream {
+        lazyService(ResourceEventStreamKey.self) { ResourceEventStream(app: self) }
+    }
+
+    /// The stream if something already created it. Shutdown must not
+    /// instantiate the service just to shut it down.
+    var resourceEventStreamIfCreated: ResourceEventStream? {
+        storage[ResourceEventStreamKey.self]
+    }
+}
+
+/// Arms the resource event poll at boot and ends it, with every open
+/// subscription, at shutdown.
+struct ResourceEventStreamLifecycleHandler: LifecycleHandler {
+    func didBootAsync(_ application: Application) async throws {
+        application.resourceEvents.startPolling()
+    }
+
+    func shutdownAsync(_ application: Application) async {
+        application.resourceEventStreamIfCreated?.shutdown()
+    }
+}
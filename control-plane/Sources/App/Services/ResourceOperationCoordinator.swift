@@ -86,9 +86,10 @@ struct ResourceOperationCoordinator {
         var errorDescription: String? { message }
     }
 
-    /// Begins the operation (atomic insert + 409 double-submit guard + the
-    /// caller's desired-state/spec mutation) and hands it off to the background
-    /// dispatch, returning the pending row for the `202` response.
+    /// Begins the operation (admission review, then atomic insert + 409
+    /// double-submit guard + the caller's desired-state/spec mutation) and
+    /// hands it off to the background dispatch, returning the pending row for
+    /// the `202` response.
     @discardableResult
     func perform(
         _ kind: VMOperationKind,
@@ -103,7 +104,7 @@ struct ResourceOperationCoordinator {
     ) async throws -> ResourceOperation {
         let operation = try await ResourceOperation.begin(
             kind, resourceKind: resourceKind, resourceID: resourceID, userID: userID,
-            on: db, applying: mutation)
+            on: db, admittedBy: app.admission, applying: mutation)
         dispatchInBackground(
             operation, resourceKind: resourceKind, resourceID: resourceID,
             hypervisorId: hypervisorId, strategy: strategy, app: app)
@@ -277,6 +278,10 @@ struct ResourceOperationCoordinator {
                 {
                     try await sandbox.save(on: db)
                 }
+            case .fileShare:
+                if let share = try await FileShare.find(operation.resourceID, on: db) {
+                    try await share.resolveAndSaveForStuckOperation(operation, on: db)
+                }
             }
             return true
         } catch {
@@ -0,0 +1,223 @@
+import Fluent
+import Foundation
+import Vapor
+
+/// How a VM's size compares with what it has actually used.
+enum RightsizingVerdict: String, Codable, Sendable {
+    /// Observed usage would fit a smaller size; the proposal shrinks it.
+    case overProvisioned = "over_provisioned"
+    /// The guest runs hot or short of memory; the proposal grows it.
+    case underProvisioned = "under_provisioned"
+    case rightSized = "right_sized"
+    /// Too little history to judge; the proposal is the current size.
+    case insufficientData = "insufficient_data"
+}
+
+/// A proposed size for one VM, with the evidence behind it.
+struct RightsizingRecommendation: Content, Equatable {
+    let vmId: UUID
+    let vmName: String
+    let verdict: RightsizingVerdict
+    let currentCpu: Int
+    let currentMemory: Int64
+    let proposedCpu: Int
+    let proposedMemory: Int64
+    /// Hours of history the verdict rests on.
+    let observedHours: Int
+    /// 95th percentile of the hourly mean vCPU utilization (0...1).
+    let cpuUtilizationP95: Double?
+    /// Highest guest memory in use seen in the window, in bytes.
+    let memoryUsedPeak: Int64?
+    /// Human-readable reasons, one per resource that moved.
+    let reasons: [String]
+
+    /// vCPUs the proposal gives back (positive) or asks for (negative).
+    let reclaimableCpu: Int
+    /// Bytes the proposal gives back (positive) or asks for (negative).
+    let reclaimableMemory: Int64
+
+    /// Whether applying would change anything.
+    var isActionable: Bool {
+        proposedCpu != currentCpu || proposedMemory != currentMemory
+    }
+
+    init(
+        vmId: UUID, vmName: String, verdict: RightsizingVerdict, currentCpu: Int, currentMemory: Int64,
+        proposedCpu: Int, proposedMemory: Int64, observedHours: Int, cpuUtilizationP95: Double?,
+        memoryUsedPeak: Int64?, reasons: [String]
+    ) {
+        self.vmId = vmId
+        self.vmName = vmName
+        self.verdict = verdict
+        self.currentCpu = currentCpu
+        self.currentMemory = currentMemory
+        self.proposedCpu = proposedCpu
+        self.proposedMemory = proposedMemory
+        self.observedHours = observedHours
+        self.cpuUtilizationP95 = cpuUtilizationP95
+        self.memoryUsedPeak = memoryUsedPeak
+        self.reasons = reasons
+        self.reclaimableCpu = currentCpu - proposedCpu
+        self.reclaimableMemory = currentMemory - proposedMemory
+    }
+}
+
+/// A project's recommendations and what acting on all of them would free up
+/// (or cost).
+struct ProjectRightsizingReport: Content {
+    let projectId: UUID
+    let lookbackDays: Int
+    let recommendations: [RightsizingRecommendation]
+    /// vCPUs and bytes the over-provisioned VMs would give back.
+    let reclaimableCpu: Int
+    let reclaimableMemory: Int64
+    /// vCPUs and bytes the under-provisioned VMs would need.
+    let additionalCpu: Int
+    let additionalMemory: Int64
+
+    init(projectId: UUID, lookbackDays: Int, recommendations: [RightsizingRecommendation]) {
+        self.projectId = projectId
+        self.lookbackDays = lookbackDays
+        self.recommendations = recommendations
+        reclaimableCpu = recommendations.reduce(0) { $0 + max($1.reclaimableCpu, 0) }
+        reclaimableMemory = recommendations.reduce(0) { $0 + max($1.reclaimableMemory, 0) }
+        additionalCpu = recommendations.reduce(0) { $0 + max(-$1.reclaimableCpu, 0) }
+        additionalMemory = recommendations.reduce(0) { $0 + max(-$1.reclaimableMemory, 0) }
+    }
+}
+
+/// Turns a VM's usage history into a proposed size.
+///
+/// CPU is sized on the 95th percentile of hourly mean utilization, so a
+/// nightly batch job counts but a single spike does not; the proposal puts
+/// that percentile at `cpuTargetUtilization`. Memory is sized on the peak in
+/// use plus `memoryHeadroom`, since running short of memory costs far more
+/// than running short of CPU. A resource only moves when the evidence is
+/// clear — below `cpuOverProvisionedBelow` or above `cpuUnderProvisionedAbove`
+/// for CPU, a saving of at least a quarter or a peak above
+/// `memoryUnderProvisionedAbove` of the grant for memory — so a VM near its
+/// right size isn't nudged back and forth.
+enum RightsizingService {
+    struct Policy: Sendable {
+        var lookbackDays = 28
+        /// A week, so a weekly cycle is seen at least once.
+        var minimumObservedHours = 7 * 24
+        var cpuTargetUtilization = 0.6
+        var cpuOverProvisionedBelow = 0.3
+        var cpuUnderProvisionedAbove = 0.85
+        var memoryHeadroom = 1.25
+        var memoryUnderProvisionedAbove = 0.9
+        /// Shrink memory only when the proposal saves at least this share.
+        var memoryMinimumSaving = 0.25
+        var memoryGranularity: Int64 = 256 * 1024 * 1024
+        var minimumMemory: Int64 = 512 * 1024 * 1024
+    }
+
+    static let defaultPolicy = Policy()
+
+    /// The recommendation for `vm`, reading its history from the database.
+    static func recommendation(
+        for vm: VM, policy: Policy = defaultPolicy, now: Date = Date(), on db: Database
+    ) async throws -> RightsizingRecommendation {
+        let samples = try await VMUsageSample.query(on: db)
+            .filter(\.$vm.$id == vm.requireID())
+            .filter(\.$hour >= now.addingTimeInterval(-Double(policy.lookbackDays) * 86_400))
+            .all()
+        return try analyze(vm: vm, samples: samples, policy: policy)
+    }
+
+    /// Recommendations for several VMs with one history query.
+    static func recommendations(
+        for vms: [VM], policy: Policy = defaultPolicy, now: Date = Date(), on db: Database
+    ) async throws -> [RightsizingRecommendation] {
+        let ids = try vms.map { try $0.requireID() }
+        guard !ids.isEmpty else { return [] }
+        let samples = try await VMUsageSample.query(on: db)
+            .filter(\.$vm.$id ~~ ids)
+            .filter(\.$hour >= now.addingTimeInterval(-Double(policy.lookbackDays) * 86_400))
+            .all()
+        let byVM = Dictionary(grouping: samples, by: { $0.$vm.id })
+        return try vms.map { try analyze(vm: $0, samples: byVM[$0.requireID()] ?? [], policy: policy) }
+    }
+
+    static func analyze(
+        vm: VM, samples: [VMUsageSample], policy: Policy = defaultPolicy
+    ) throws -> RightsizingRecommendation {
+        let hourlyCPU = samples.compactMap(\.cpuUtilizationMean)
+        let memoryPeaks = samples.compactMap(\.memoryUsedMax)
+        let observedHours = samples.filter { $0.cpuSamples > 0 || $0.memorySamples > 0 }.count
+        let cpuP95 = percentile(hourlyCPU, 0.95)
+        let memoryPeak = memoryPeaks.max()
+
+        func result(_ verdict: RightsizingVerdict, cpu: Int, memory: Int64, reasons: [String])
+            throws -> RightsizingRecommendation
+        {
+            RightsizingRecommendation(
+                vmId: try vm.requireID(), vmName: vm.name, verdict: verdict,
+                currentCpu: vm.cpu, currentMemory: vm.memory, proposedCpu: cpu, proposedMemory: memory,
+                observedHours: observedHours, cpuUtilizationP95: cpuP95, memoryUsedPeak: memoryPeak,
+                reasons: reasons)
+        }
+
+        guard observedHours >= policy.minimumObservedHours else {
+            return try result(
+                .insufficientData, cpu: vm.cpu, memory: vm.memory,
+                reasons: ["\(observedHours) of the \(policy.minimumObservedHours) hours of usage needed"])
+        }
+
+        var reasons: [String] = []
+        var grows = false
+        var shrinks = false
+
+        var proposedCpu = vm.cpu
+        if let cpuP95 {
+            let busy = cpuP95 * Double(vm.cpu)
+            let fitted = max(1, Int((busy / policy.cpuTargetUtilization).rounded(.up)))
+            let percent = Int((cpuP95 * 100).rounded())
+            if cpuP95 > policy.cpuUnderProvisionedAbove {
+                proposedCpu = min(max(fitted, vm.cpu + 1), VMController.maxHotpluggableCPUs)
+                grows = proposedCpu > vm.cpu
+                reasons.append("vCPUs were \(percent)% busy at the 95th percentile")
+            } else if cpuP95 < policy.cpuOverProvisionedBelow, fitted < vm.cpu {
+                proposedCpu = fitted
+                shrinks = true
+                reasons.append("vCPUs were only \(percent)% busy at the 95th percentile")
+            }
+        }
+
+        var proposedMemory = vm.memory
+        if let memoryPeak {
+            let fitted = roundUp(Int64(Double(memoryPeak) * policy.memoryHeadroom), to: policy.memoryGranularity)
+            let peakShare = Double(memoryPeak) / Double(vm.memory)
+            let percent = Int((peakShare * 100).rounded())
+            if peakShare > policy.memoryUnderProvisionedAbove {
+                let grown = roundUp(Int64(Double(vm.memory) * policy.memoryHeadroom), to: policy.memoryGranularity)
+                proposedMemory = max(fitted, grown)
+                grows = true
+                reasons.append("memory in use peaked at \(percent)% of the grant")
+            } else {
+                let candidate = max(fitted, policy.minimumMemory)
+                if Double(candidate) <= Double(vm.memory) * (1 - policy.memoryMinimumSaving) {
+                    proposedMemory = candidate
+                    shrinks = true
+                    reasons.append("memory in use peaked at only \(percent)% of the grant")
+                }
+            }
+        }
+
+        let verdict: RightsizingVerdict = grows ? .underProvisioned : shrinks ? .overProvisioned : .rightSized
+        return try result(verdict, cpu: proposedCpu, memory: proposedMemory, reasons: reasons)
+    }
+
+    /// Nearest-rank percentile; nil for no values.
+    static func percentile(_ values: [Double], _ p: Double) -> Double? {
+        guard !values.isEmpty else { return nil }
+        let sorted = values.sorted()
+        let rank = Int((p * Double(sorted.count)).rounded(.up))
+        return sorted[min(max(rank, 1), sorted.count) - 1]
+    }
+
+    private static func roundUp(_ bytes: Int64, to granularity: Int64) -> Int64 {
+        (bytes + granularity - 1) / granularity * granularity
+    }
+}
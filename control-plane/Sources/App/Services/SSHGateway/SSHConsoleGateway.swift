@@ -0,0 +1,351 @@
+import Crypto
+import Fluent
+import Foundation
+import NIOConcurrencyHelpers
+import NIOCore
+import NIOPosix
+import NIOSSH
+import Vapor
+
+/// An SSH server bridging `ssh <vm-id>@console.example` to the VM's serial
+/// console, for clients that are neither a browser nor a WebSocket client.
+///
+/// - **Authentication** is public-key only: a key the user registered
+///   (`UserSSHKey`), or a short-lived OpenSSH user certificate signed by a
+///   trusted CA (`SSH_GATEWAY_USER_CA_KEYS`) naming the user's username as a
+///   principal.
+/// - **Authorization** is the same `vm:viewConsole` check as the browser
+///   console, made per session channel so a refusal reaches the user's
+///   terminal instead of reading as a failed login.
+/// - **Sessions** go through `ConsoleSessionManager` like browser ones: a
+///   shell opens a new console session; `ssh <vm-id>@… observe [session-id]`
+///   joins, read-only, a session of the VM the user opened or was invited
+///   to.
+///
+/// Like the WebSocket console, a session works when the SSH connection and
+/// the VM's agent socket are on the same replica.
+final class SSHConsoleGateway: @unchecked Sendable {
+    struct Configuration: Sendable {
+        var enabled: Bool
+        var host: String
+        var port: Int
+        /// Base64 of a 32-byte Ed25519 private key. Every replica must share
+        /// it, or clients see the host key change between connections.
+        var hostKey: String?
+        /// OpenSSH public keys of CAs whose user certificates are accepted.
+        var trustedUserCAKeys: [String]
+        /// Longest validity window (`valid_before - valid_after`) a
+        /// certificate may carry: only short-lived certificates are accepted.
+        var maxCertificateLifetimeSeconds: Int
+
+        static func fromEnvironment() -> Configuration {
+            Configuration(
+                enabled: Environment.get("SSH_GATEWAY_ENABLED").flatMap(Bool.init) ?? false,
+                host: Environment.get("SSH_GATEWAY_HOST") ?? "0.0.0.0",
+                port: Environment.get("SSH_GATEWAY_PORT").flatMap(Int.init) ?? 2222,
+                hostKey: Environment.get("SSH_GATEWAY_HOST_KEY"),
+                trustedUserCAKeys: (Environment.get("SSH_GATEWAY_USER_CA_KEYS") ?? "")
+                    .split(whereSeparator: { $0 == "," || $0.isNewline })
+                    .map { $0.trimmingCharacters(in: .whitespaces) }
+                    .filter { !$0.isEmpty },
+                maxCertificateLifetimeSeconds:
+                    Environment.get("SSH_GATEWAY_MAX_CERT_LIFETIME_SECONDS").flatMap(Int.init) ?? 43_200
+            )
+        }
+    }
+
+    /// Failed authentication attempts one connection may make before every
+    /// further attempt fails without a database lookup.
+    static let maxAuthAttempts = 6
+
+    let app: Application
+    let configuration: Configuration
+    private let serverChannel: NIOLockedValueBox<Channel?> = .init(nil)
+
+    init(app: Application, configuration: Configuration = .fromEnvironment()) {
+        self.app = app
+        self.configuration = configuration
+    }
+
+    // MARK: - Lifecycle
+
+    /// Bind the listener when `SSH_GATEWAY_ENABLED`. A misconfigured gateway
+    /// fails boot rather than starting without its host key or CAs.
+    func start() async throws {
+        guard configuration.enabled else { return }
+        let hostKey = try loadHostKey()
+        let trustedCAs = try loadTrustedCAs()
+
+        let bootstrap = ServerBootstrap(group: app.eventLoopGroup)
+            .serverChannelOption(ChannelOptions.backlog, value: 256)
+            .serverChannelOption(ChannelOptions.socketOption(.so_reuseaddr), value: 1)
+            .childChannelOption(ChannelOptions.allowRemoteHalfClosure, value: true)
+            .childChannelInitializer { [self] channel in
+                channel.eventLoop.makeCompletedFuture {
+                    let authenticator = SSHGatewayAuthenticator(
+                        gateway: self, trustedCAs: trustedCAs, remoteAddress: channel.remoteAddress?.ipAddress)
+                    let handler = NIOSSHHandler(
+                        role: .server(.init(hostKeys: [hostKey], userAuthDelegate: authenticator)),
+                        allocator: channel.allocator,
+                        inboundChildChannelInitializer: { child, channelType in
+                            self.initializeChild(child, channelType, authenticator: authenticator)
+                        })
+                    try channel.pipeline.syncOperations.addHandler(handler)
+                    try channel.pipeline.syncOperations.addHandler(SSHGatewayErrorHandler(logger: self.app.logger))
+                }
+            }
+
+        let channel = try await bootstrap.bind(host: configuration.host, port: configuration.port).get()
+        serverChannel.withLockedValue { $0 = channel }
+        app.logger.info(
+            "SSH console gateway listening",
+            metadata: [
+                "address": .string("\(configuration.host):\(configuration.port)"),
+                "hostKeyFingerprint": .string(UserSSHKey.fingerprint(of: hostKey.publicKey)),
+            ])
+    }
+
+    func shutdown() async {
+        let channel = serverChannel.withLockedValue { channel in
+            defer { channel = nil }
+            return channel
+        }
+        try? await channel?.close()
+    }
+
+    /// Only session channels, and only once the connection authenticated —
+    /// NIOSSH opens none before, but the identity is checked regardless.
+    private func initializeChild(
+        _ child: Channel, _ channelType: SSHChannelType, authenticator: SSHGatewayAuthenticator
+    ) -> EventLoopFuture<Void> {
+        guard case .session = channelType, let login = authenticator.login else {
+            return child.eventLoop.makeFailedFuture(SSHGatewayError.channelRejected)
+        }
+        return child.eventLoop.makeCompletedFuture {
+            try child.pipeline.syncOperations.addHandler(SSHConsoleSessionHandler(gateway: self, login: login))
+        }
+    }
+
+    private func loadHostKey() throws -> NIOSSHPrivateKey {
+        if let encoded = configuration.hostKey {
+            guard let raw = Data(base64Encoded: encoded), raw.count == 32 else {
+                throw SSHGatewayError.invalidConfiguration(
+                    "SSH_GATEWAY_HOST_KEY must be a base64-encoded 32-byte Ed25519 private key")
+            }
+            return NIOSSHPrivateKey(ed25519Key: try Curve25519.Signing.PrivateKey(rawRepresentation: raw))
+        }
+        guard app.environment == .development || app.environment == .testing else {
+            throw SSHGatewayError.invalidConfiguration("SSH_GATEWAY_HOST_KEY is required outside development")
+        }
+        app.logger.warning("SSH_GATEWAY_HOST_KEY unset; using an ephemeral host key")
+        return NIOSSHPrivateKey(ed25519Key: Curve25519.Signing.PrivateKey())
+    }
+
+    private func loadTrustedCAs() throws -> [NIOSSHPublicKey] {
+        try configuration.trustedUserCAKeys.map { line in
+            let parts = line.split(whereSeparator: \.isWhitespace)
+            guard parts.count >= 2,
+                let key = try? NIOSSHPublicKey(openSSHPublicKey: "\(parts[0]) \(parts[1])")
+            else {
+                throw SSHGatewayError.invalidConfiguration("SSH_GATEWAY_USER_CA_KEYS has an unreadable key: \(line)")
+            }
+            return key
+        }
+    }
+
+    // MARK: - Authentication
+
+    /// The account a public key authenticates as, or nil. NIOSSH has already
+    /// verified the client holds the private key; this decides whose key it
+    /// is.
+    func authenticate(
+        publicKey: NIOSSHPublicKey, trustedCAs: [NIOSSHPublicKey], remoteAddress: String?
+    ) async throws -> SSHGatewayIdentity? {
+        if let certificate = NIOSSHCertifiedPublicKey(publicKey) {
+            return try await authenticate(
+                certificate: certificate, trustedCAs: trustedCAs, remoteAddress: remoteAddress)
+        }
+
+        guard
+            let key = try await UserSSHKey.query(on: app.db)
+                .filter(\.$fingerprint == UserSSHKey.fingerprint(of: publicKey))
+                .with(\.$user)
+                .first(),
+            key.user.disabledAt == nil
+        else {
+            return nil
+        }
+        key.recordUsage(ip: remoteAddress, on: app)
+        return SSHGatewayIdentity(
+            userID: try key.user.requireID(), username: key.user.username,
+            method: "key", credential: key.fingerprint, remoteAddress: remoteAddress)
+    }
+
+    /// A certificate authenticates as the first of its principals that is a
+    /// username, provided a trusted CA signed it, it is valid now, carries no
+    /// critical options, and its validity window is short.
+    private func authenticate(
+        certificate: NIOSSHCertifiedPublicKey, trustedCAs: [NIOSSHPublicKey], remoteAddress: String?
+    ) async throws -> SSHGatewayIdentity? {
+        guard !trustedCAs.isEmpty,
+            certificate.validBefore > certificate.validAfter,
+            certificate.validBefore - certificate.validAfter <= UInt64(configuration.maxCertificateLifetimeSeconds)
+        else {
+            return nil
+        }
+        for principal in certificate.validPrincipals {
+            guard
+                let user = try await User.query(on: app.db).filter(\.$username == principal).first(),
+                user.disabledAt == nil
+            else {
+                continue
+            }
+            do {
+                _ = try certificate.validate(
+                    principal: principal, type: .user, allowedAuthoritySigningKeys: trustedCAs)
+            } catch {
+                return nil
+            }
+            return SSHGatewayIdentity(
+                userID: try user.requireID(), username: user.username,
+                method: "certificate", credential: certificate.keyID, remoteAddress: remoteAddress)
+        }
+        return nil
+    }
+
+    // MARK: - Console targets
+
+    /// The VM's console, if `identity` may open it: the same checks, in the
+    /// same order, as the WebSocket console — authorize before loading the VM
+    /// so unauthorized users cannot probe VM IDs.
+    func consoleTarget(vmID: UUID, for identity: SSHGatewayIdentity) async throws -> SSHConsoleTarget {
+        let decision = try await IAMAuthorizer.authorize(
+            principal: .user(identity.userID),
+            action: "vm:viewConsole",
+            node: IAMNode(type: .virtualMachine, id: vmID),
+            legacyEquivalent: nil,
+            context: IAMCheckContext(path: "ssh://\(vmID)", method: "SSH", requestID: nil),
+            state: nil,
+            app: app,
+            db: app.db)
+        guard decision.allowed else {
+            throw SSHGatewayError.refused("You do not have permission to access this VM console")
+        }
+        guard let vm = try await VM.find(vmID, on: app.db) else {
+            throw SSHGatewayError.refused("VM not found")
+        }
+        guard vm.status == .running else {
+            throw SSHGatewayError.refused("VM is not running")
+        }
+        guard let agentIdString = vm.hypervisorId, let agentID = UUID(uuidString: agentIdString),
+            let agent = try await Agent.find(agentID, on: app.db)
+        else {
+            throw SSHGatewayError.refused("VM has no assigned hypervisor")
+        }
+        let project = try await vm.$project.get(on: app.db)
+        return SSHConsoleTarget(
+            vmID: vmID, vmName: vm.name, agentKey: agent.identity.key,
+            organizationID: try await project.getRootOrganizationId(on: app.db))
+    }
+
+    /// Audit a session opened or joined. `sessionID` is the console session
+    /// (the one observed, for an observer).
+    func auditSession(
+        _ identity: SSHGatewayIdentity, target: SSHConsoleTarget, sessionID: String, readOnly: Bool
+    ) async {
+        await app.audit.record(
+            AuditRecord(
+                eventType: AuditEventType.sshConsoleSession.rawValue,
+                userID: identity.userID,
+                username: identity.username,
+                organizationID: target.organizationID,
+                method: "SSH",
+                resourceType: OperationResourceKind.virtualMachine.rawValue,
+                resourceID: target.vmID.uuidString,
+                action: readOnly ? "observe" : "console",
+                sourceIP: identity.remoteAddress,
+                metadata: [
+                    "sessionId": sessionID,
+                    "authMethod": identity.method,
+                    "credential": identity.credential,
+                ]))
+    }
+}
+
+/// Who an SSH connection authenticated as, and with what.
+struct SSHGatewayIdentity: Sendable {
+    let userID: UUID
+    let username: String
+    /// `key` or `certificate`.
+    let method: String
+    /// The key's fingerprint, or the certificate's key ID.
+    let credential: String
+    let remoteAddress: String?
+}
+
+struct SSHConsoleTarget: Sendable {
+    let vmID: UUID
+    let vmName: String
+    let agentKey: String
+    let organizationID: UUID?
+}
+
+enum SSHGatewayError: Error, CustomStringConvertible {
+    case invalidConfiguration(String)
+    case channelRejected
+    /// A session the user may not open; the message is shown to them.
+    case refused(String)
+
+    var description: String {
+        switch self {
+        case .invalidConfiguration(let message): return message
+        case .channelRejected: return "Only session channels are supported"
+        case .refused(let message): return message
+        }
+    }
+}
+
+/// Closes a connection whose SSH handler errored (a protocol violation, a
+/// failed key exchange) instead of leaving it half-open.
+private final class SSHGatewayErrorHandler: ChannelInboundHandler, Sendable {
+    typealias InboundIn = Any
+
+    let logger: Logger
+
+    init(logger: Logger) {
+        self.logger = logger
+    }
+
+    func errorCaught(context: ChannelHandlerContext, error: any Error) {
+        logger.debug("SSH gateway connection error: \(error)")
+        context.close(promise: nil)
+    }
+}
+
+// MARK: - Application accessor / lifecycle
+
+extension Application {
+    private struct SSHConsoleGatewayKey: StorageKey, LockKey {
+        typealias Value = SSHConsoleGateway
+    }
+
+    var sshConsoleGateway: SSHConsoleGateway {
+        lazyService(SSHConsoleGatewayKey.self) { SSHConsoleGateway(app: self) }
+    }
+
+    var sshConsoleGatewayIfCreated: SSHConsoleGateway? {
+        storage[SSHConsoleGatewayKey.self]
+    }
+}
+
+/// Binds the SSH console gateway at boot (when enabled) and closes the
+/// listener at shutdown.
+struct SSHConsoleGatewayLifecycleHandler: LifecycleHandler {
+    func didBootAsync(_ application: Application) async throws {
+        try await application.sshConsoleGateway.start()
+    }
+
+    func shutdownAsync(_ application: Application) async {
+        await application.sshConsoleGatewayIfCreated?.shutdown()
+    }
+}
@@ -0,0 +1,299 @@
+import Foundation
+import NIOConcurrencyHelpers
+import NIOCore
+import NIOSSH
+
+/// One SSH session channel of the console gateway.
+///
+/// - A **shell** request opens a new console session on the VM named by the
+///   SSH username — the SSH analogue of the browser's console WebSocket.
+/// - An **exec** of `observe [session-id]` joins a session of the VM
+///   read-only: the given one, or else the most recent the user opened or
+///   was invited to. Observers see the session's output; their input is
+///   dropped.
+/// - An **exec** of `join <session-id>` joins a session its owner shared
+///   with the user, with the access the invitation grants.
+///
+/// Either way the session ends when the client closes the channel or the
+/// console goes away underneath it.
+final class SSHConsoleSessionHandler: ChannelInboundHandler, @unchecked Sendable {
+    typealias InboundIn = SSHChannelData
+    typealias OutboundOut = SSHChannelData
+
+    private enum Mode {
+        case idle
+        /// Between the request and the session being registered.
+        case starting
+        case interactive(sessionId: String, input: AsyncStream<Data>.Continuation)
+        /// Attached to another session: `input` is nil for an observer.
+        case participating(sessionId: String, participantId: UUID, input: AsyncStream<Data>.Continuation?)
+        case closed
+    }
+
+    private let gateway: SSHConsoleGateway
+    private let login: SSHGatewayLogin
+    private let mode: NIOLockedValueBox<Mode> = .init(.idle)
+
+    init(gateway: SSHConsoleGateway, login: SSHGatewayLogin) {
+        self.gateway = gateway
+        self.login = login
+    }
+
+    private var consoleSessions: ConsoleSessionManager { gateway.app.consoleSessionManager }
+
+    func handlerAdded(context: ChannelHandlerContext) {
+        let channel = context.channel
+        channel.setOption(ChannelOptions.allowRemoteHalfClosure, value: true).whenFailure { _ in
+            channel.close(promise: nil)
+        }
+        channel.closeFuture.whenComplete { [self] _ in
+            tearDown()
+        }
+    }
+
+    func channelRead(context: ChannelHandlerContext, data: NIOAny) {
+        let message = unwrapInboundIn(data)
+        guard case .channel = message.type, case .byteBuffer(var buffer) = message.data,
+            let bytes = buffer.readBytes(length: buffer.readableBytes)
+        else {
+            return
+        }
+        switch mode.withLockedValue({ $0 }) {
+        case .interactive(_, let input), .participating(_, _, let input?):
+            input.yield(Data(bytes))
+        default:
+            break
+        }
+    }
+
+    func userInboundEventTriggered(context: ChannelHandlerContext, event: Any) {
+        switch event {
+        case let request as SSHChannelRequestEvent.PseudoTerminalRequest:
+            // The serial console is a byte stream with no size or modes to
+            // set; accepting the pty just lets the client go raw.
+            reply(context, success: true, wantReply: request.wantReply)
+        case let request as SSHChannelRequestEvent.ShellRequest:
+            let began = begin()
+            reply(context, success: began, wantReply: request.wantReply)
+            if began {
+                startInteractive(channel: context.channel)
+            }
+        case let request as SSHChannelRequestEvent.ExecRequest:
+            let began = begin()
+            reply(context, success: began, wantReply: request.wantReply)
+            guard began else { return }
+            let words = request.command.split(separator: " ").map(String.init)
+            switch (words.first, words.count) {
+            case ("observe", 1), ("observe", 2):
+                startObserving(sessionId: words.count == 2 ? words[1] : nil, channel: context.channel)
+            case ("join", 2):
+                startJoining(sessionId: words[1], channel: context.channel)
+            default:
+                SSHConsoleTerminal(channel: context.channel).terminate(
+                    reason: "Unknown command '\(request.command)'; the commands are 'observe [session-id]' "
+                        + "and 'join <session-id>'")
+            }
+        case ChannelEvent.inputClosed:
+            context.close(promise: nil)
+        default:
+            context.fireUserInboundEventTriggered(event)
+        }
+    }
+
+    private func reply(_ context: ChannelHandlerContext, success: Bool, wantReply: Bool) {
+        guard wantReply else { return }
+        if success {
+            context.triggerUserOutboundEvent(ChannelSuccessEvent(), promise: nil)
+        } else {
+            context.triggerUserOutboundEvent(ChannelFailureEvent(), promise: nil)
+        }
+    }
+
+    /// Claims the channel for one shell or exec; a second request fails.
+    private func begin() -> Bool {
+        mode.withLockedValue { mode in
+            guard case .idle = mode else { return false }
+            mode = .starting
+            return true
+        }
+    }
+
+    // MARK: - Sessions
+
+    private func startInteractive(channel: Channel) {
+        let terminal = SSHConsoleTerminal(channel: channel)
+        Task {
+            do {
+                let target = try await resolveTarget()
+                let sessionId = UUID().uuidString
+                consoleSessions.createSession(
+                    sessionId: sessionId,
+                    vmId: target.vmID.uuidString,
+                    agentKey: target.agentKey,
+                    userId: login.identity.userID.uuidString,
+                    terminal: terminal)
+
+                let (input, continuation) = AsyncStream.makeStream(of: Data.self)
+                guard settle(.interactive(sessionId: sessionId, input: continuation)) else { return }
+                await gateway.auditSession(login.identity, target: target, sessionID: sessionId, readOnly: false)
+
+                terminal.notice(
+                    "Connected to the serial console of \(target.vmName) (session \(sessionId)). "
+                        + "Press Enter if no prompt appears.")
+                try await consoleSessions.sendConsoleConnect(
+                    sessionId: sessionId, vmId: target.vmID.uuidString, agentKey: target.agentKey)
+
+                // One consumer, so keystrokes reach the agent in the order typed.
+                for await data in input {
+                    try await consoleSessions.routeToAgent(sessionId: sessionId, data: data)
+                }
+            } catch {
+                terminal.terminate(reason: Self.message(for: error))
+            }
+        }
+    }
+
+    private func startObserving(sessionId requested: String?, channel: Channel) {
+        let terminal = SSHConsoleTerminal(channel: channel)
+        Task {
+            do {
+                let target = try await resolveTarget()
+                let identity = login.identity
+                // Newest first, and only the sessions the user owns or was
+                // invited to: `vm:viewConsole` alone doesn't let anyone watch
+                // someone else's session.
+                let visible = consoleSessions.sharedSessions(vmId: target.vmID.uuidString, for: identity.userID)
+                guard let sessionId = requested ?? visible.first?.id,
+                    visible.contains(where: { $0.id == sessionId })
+                else {
+                    throw SSHGatewayError.refused("No console session on this VM that you own or were invited to")
+                }
+                let observerId = try consoleSessions.addObserver(
+                    sessionId: sessionId, userId: identity.userID, username: identity.username, terminal: terminal)
+                guard settle(.participating(sessionId: sessionId, participantId: observerId, input: nil))
+                else { return }
+                await gateway.auditSession(identity, target: target, sessionID: sessionId, readOnly: true)
+                terminal.notice("Observing console session \(sessionId) of \(target.vmName), read-only.")
+            } catch {
+                terminal.terminate(reason: Self.message(for: error))
+            }
+        }
+    }
+
+    private func startJoining(sessionId: String, channel: Channel) {
+        let terminal = SSHConsoleTerminal(channel: channel)
+        Task {
+            do {
+                let target = try await resolveTarget()
+                guard consoleSessions.getSession(sessionId: sessionId)?.vmId == target.vmID.uuidString else {
+                    throw SSHGatewayError.refused("No such console session on this VM to join")
+                }
+                let identity = login.identity
+                let (participantId, access) = try consoleSessions.join(
+                    sessionId: sessionId, userId: identity.userID, username: identity.username, terminal: terminal)
+
+                let (input, continuation) = AsyncStream.makeStream(of: Data.self)
+                guard settle(.participating(sessionId: sessionId, participantId: participantId, input: continuation))
+                else { return }
+                await gateway.auditSession(
+                    identity, target: target, sessionID: sessionId, readOnly: access == .readOnly)
+                if let record = consoleSessions.joinRecord(
+                    sessionId: sessionId, userId: identity.userID, username: identity.username, access: access)
+                {
+                    await gateway.app.audit.record(record)
+                }
+                terminal.notice("Joined console session \(sessionId) of \(target.vmName), \(access.label).")
+
+                for await data in input {
+                    try await consoleSessions.routeParticipantInput(
+                        sessionId: sessionId, participantId: participantId, data: data)
+                }
+            } catch {
+                terminal.terminate(reason: Self.message(for: error))
+            }
+        }
+    }
+
+    private func resolveTarget() async throws -> SSHConsoleTarget {
+        guard let vmID = UUID(uuidString: login.target) else {
+            throw SSHGatewayError.refused("Connect as <vm-id>@ — '\(login.target)' is not a VM ID")
+        }
+        return try await gateway.consoleTarget(vmID: vmID, for: login.identity)
+    }
+
+    /// Records the session the channel now holds. False if the channel closed
+    /// while it was being set up, in which case the session is released here
+    /// since `tearDown` has already run.
+    private func settle(_ settled: Mode) -> Bool {
+        let closed = mode.withLockedValue { mode in
+            if case .closed = mode { return true }
+            mode = settled
+            return false
+        }
+        if closed {
+            release(settled)
+        }
+        return !closed
+    }
+
+    private func tearDown() {
+        let previous = mode.withLockedValue { mode in
+            defer { mode = .closed }
+            return mode
+        }
+        release(previous)
+    }
+
+    private func release(_ mode: Mode) {
+        switch mode {
+        case .interactive(let sessionId, let input):
+            input.finish()
+            let consoleSessions = self.consoleSessions
+            Task {
+                defer { consoleSessions.removeSession(sessionId: sessionId) }
+                try? await consoleSessions.sendConsoleDisconnect(sessionId: sessionId)
+            }
+        case .participating(let sessionId, let participantId, let input):
+            input?.finish()
+            consoleSessions.removeParticipant(sessionId: sessionId, participantId: participantId)
+        case .idle, .starting, .closed:
+            break
+        }
+    }
+
+    private static func message(for error: any Error) -> String {
+        switch error {
+        case let error as SSHGatewayError: return error.description
+        case let error as ConsoleSessionError: return error.errorDescription ?? "\(error)"
+        default: return "Failed to connect to VM console"
+        }
+    }
+}
+
+/// The SSH side of a console session: output on the channel's data stream,
+/// gateway notices and errors on its stderr stream.
+struct SSHConsoleTerminal: ConsoleTerminal {
+    let channel: Channel
+
+    func write(_ bytes: [UInt8]) {
+        send(bytes, as: .channel)
+    }
+
+    /// The banner already told the user to press Enter; nothing more to say.
+    func consoleReady() {}
+
+    func terminate(reason: String) {
+        notice("error: \(reason)")
+        channel.triggerUserOutboundEvent(SSHChannelRequestEvent.ExitStatus(exitStatus: 1), promise: nil)
+        channel.close(promise: nil)
+    }
+
+    func notice(_ text: String) {
+        send(Array("\r\n\(text)\r\n".utf8), as: .stdErr)
+    }
+
+    private func send(_ bytes: [UInt8], as type: SSHChannelData.DataType) {
+        let data = SSHChannelData(type: type, data: .byteBuffer(channel.allocator.buffer(bytes: bytes)))
+        channel.writeAndFlush(data, promise: nil)
+    }
+}
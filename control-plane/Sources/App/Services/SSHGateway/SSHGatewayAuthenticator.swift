@@ -0,0 +1,80 @@
+import Foundation
+import NIOConcurrencyHelpers
+import NIOCore
+import NIOSSH
+
+/// One SSH connection's public-key authentication. A new instance per
+/// connection, so the identity it settles on is the connection's: session
+/// channels read it from here.
+///
+/// NIOSSH answers signature-less key queries itself and verifies the
+/// signature before asking us, so `requestReceived` only has to decide whose
+/// key it is. The SSH username is the VM to connect to, not the account; it
+/// is checked per session, where a refusal can be shown to the user.
+final class SSHGatewayAuthenticator: NIOSSHServerUserAuthenticationDelegate, @unchecked Sendable {
+    let supportedAuthenticationMethods: NIOSSHAvailableUserAuthenticationMethods = .publicKey
+
+    private let gateway: SSHConsoleGateway
+    private let trustedCAs: [NIOSSHPublicKey]
+    private let remoteAddress: String?
+    private let state: NIOLockedValueBox<(attempts: Int, login: SSHGatewayLogin?)> = .init((0, nil))
+
+    init(gateway: SSHConsoleGateway, trustedCAs: [NIOSSHPublicKey], remoteAddress: String?) {
+        self.gateway = gateway
+        self.trustedCAs = trustedCAs
+        self.remoteAddress = remoteAddress
+    }
+
+    /// Who the connection authenticated as, and the SSH username it asked
+    /// for; nil until it has authenticated.
+    var login: SSHGatewayLogin? {
+        state.withLockedValue { $0.login }
+    }
+
+    func requestReceived(
+        request: NIOSSHUserAuthenticationRequest,
+        responsePromise: EventLoopPromise<NIOSSHUserAuthenticationOutcome>
+    ) {
+        let allowed = state.withLockedValue { state in
+            state.attempts += 1
+            return state.attempts <= SSHConsoleGateway.maxAuthAttempts
+        }
+        guard allowed, case .publicKey(let publicKeyRequest) = request.request else {
+            responsePromise.succeed(.failure)
+            return
+        }
+
+        let publicKey = publicKeyRequest.publicKey
+        let target = request.username
+        let gateway = self.gateway
+        let trustedCAs = self.trustedCAs
+        let remoteAddress = self.remoteAddress
+        let state = self.state
+        responsePromise.completeWithTask {
+            let identity: SSHGatewayIdentity?
+            do {
+                identity = try await gateway.authenticate(
+                    publicKey: publicKey, trustedCAs: trustedCAs, remoteAddress: remoteAddress)
+            } catch {
+                gateway.app.logger.error("SSH gateway authentication failed: \(error)")
+                identity = nil
+            }
+            guard let identity else { return .failure }
+            state.withLockedValue { $0.login = SSHGatewayLogin(identity: identity, target: target) }
+            gateway.app.logger.info(
+                "SSH gateway login",
+                metadata: [
+                    "username": .string(identity.username),
+                    "authMethod": .string(identity.method),
+                    "target": .string(target),
+                ])
+            return .success
+        }
+    }
+}
+
+struct SSHGatewayLogin: Sendable {
+    let identity: SSHGatewayIdentity
+    /// The SSH username: the VM to connect to.
+    let target: String
+}
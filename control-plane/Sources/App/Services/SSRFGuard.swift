@@ -1,4 +1,6 @@
+import AsyncHTTPClient
 import Foundation
+import NIOCore
 import NIOPosix
 import Vapor
 
@@ -23,9 +25,10 @@ import Darwin
 ///
 /// KNOWN GAP: the fetch re-resolves the host when it connects, so a low-TTL
 /// record can rebind the name to an internal address between this check and
-/// the connect. `validate` returns the addresses it approved so a future
-/// change can pin the connection to them (AsyncHTTPClient's `dnsOverride`);
-/// no caller does that yet.
+/// the connect. `validate` returns the addresses it approved so a caller can
+/// pin the connection to them (AsyncHTTPClient's `dnsOverride`); `execute`
+/// does, and webhook deliveries and admission reviews go through it. Image
+/// fetches don't yet.
 enum SSRFGuard {
     /// Blocked because the resolved address is not a public, routable host.
     struct BlockedHostError: Error, CustomStringConvertible {
@@ -87,6 +90,53 @@ enum SSRFGuard {
         }
     }
 
+    /// Validates `url` and sends `request` (built for the same URL) with the
+    /// connection pinned to an address the validation approved, collecting
+    /// up to `maxResponseBytes` of the response body (none by default).
+    ///
+    /// The shared client would re-resolve the name at connect time, so a
+    /// transient client with a `dnsOverride` makes the connect; when private
+    /// hosts are allowed (testing/dev) nothing was approved and the shared
+    /// client is fine. TLS certificate validation still runs against the
+    /// hostname — only resolution is overridden.
+    static func execute(
+        _ request: HTTPClientRequest,
+        url: URL,
+        timeout: TimeAmount,
+        maxResponseBytes: Int = 0,
+        app: Application
+    ) async throws -> (status: HTTPResponseStatus, body: ByteBuffer) {
+        let approvedAddresses = try await validate(url: url, environment: app.environment, on: app.threadPool)
+        guard let host = url.host, let pinnedAddress = approvedAddresses.first else {
+            let response = try await app.http.client.shared.execute(request, timeout: timeout)
+            return (response.status, try await collect(response, upTo: maxResponseBytes))
+        }
+
+        var configuration = HTTPClient.Configuration()
+        // The shared client disallows redirects globally (configure.swift); a
+        // transient client must not silently reintroduce redirect-following,
+        // which would defeat the SSRF validation of the final destination.
+        configuration.redirectConfiguration = .disallow
+        configuration.dnsOverride = [host: pinnedAddress]
+        let client = HTTPClient(
+            eventLoopGroupProvider: .shared(app.eventLoopGroup),
+            configuration: configuration)
+        do {
+            let response = try await client.execute(request, timeout: timeout)
+            let body = try await collect(response, upTo: maxResponseBytes)
+            try await client.shutdown()
+            return (response.status, body)
+        } catch {
+            try? await client.shutdown()
+            throw error
+        }
+    }
+
+    private static func collect(_ response: HTTPClientResponse, upTo maxBytes: Int) async throws -> ByteBuffer {
+        guard maxBytes > 0 else { return ByteBuffer() }
+        return try await response.body.collect(upTo: maxBytes)
+    }
+
     /// Resolves `host` to its IP addresses. A bare IP literal resolves to
     /// itself; a name is resolved via the system resolver so that the addresses
     /// classified are the ones the HTTP client will actually connect to.
@@ -16,6 +16,14 @@ import Vapor
 ///    `SandboxExecStartMessage` went to the agent. Frames are relayed both
 ///    ways until exit/close.
 ///
+/// The attached end is a `SandboxExecFrontend`: the browser's WebSocket, or a
+/// server-side consumer such as a code-session execution, which mints and
+/// attaches in one step.
+///
+/// An attached session can be shared: its owner invites other users, who
+/// join through `/api/sandboxes/:id/exec/:sessionId/join` and see the same
+/// output (`SessionShare`). Resizes stay with the owner's terminal.
+///
 /// Like the console path, messages go to the agent only over a *local*
 /// WebSocket (`app.websocketManager`): exec requires the control-plane
 /// replica that holds the agent's socket (single-replica limitation, accepted
@@ -35,12 +43,20 @@ final class SandboxExecSessionManager: @unchecked Sendable {
     /// Maps sessionId -> attached session info.
     private var sessions: [String: AttachedExecSession] = [:]
 
-    /// Maps sessionId -> browser WebSocket.
-    private var frontendConnections: [String: WebSocket] = [:]
+    /// Maps sessionId -> the attached frontend (browser WebSocket or
+    /// server-side consumer).
+    private var frontendConnections: [String: any SandboxExecFrontend] = [:]
 
     /// Maps sandboxId -> attached sessionIds (multiple execs may run at once).
     private var sandboxSessions: [String: Set<String>] = [:]
 
+    /// Maps sessionId -> who the session is shared with.
+    private var shares: [String: SessionShare<any SandboxExecFrontend>] = [:]
+
+    /// Attached sessions whose process has spawned, so a participant joining
+    /// late is told input may flow.
+    private var startedSessions: Set<String> = []
+
     /// A minted-but-not-yet-attached exec session: everything needed to build
     /// the `SandboxExecStartMessage` once the browser attaches.
     struct PendingExecSession: Sendable {
@@ -63,6 +79,8 @@ final class SandboxExecSessionManager: @unchecked Sendable {
         let sandboxId: String
         let agentKey: String
         let userId: String
+        /// The owner's username, for the notices participants see.
+        let username: String?
         let attachedAt: Date
     }
 
@@ -134,13 +152,14 @@ final class SandboxExecSessionManager: @unchecked Sendable {
     /// to attached and the returned value carries the exec request for
     /// `sendExecStart(for:)`.
     ///
-    /// `websocket` is optional only so unit tests can exercise the lifecycle
-    /// without a live socket; the controller always passes one.
+    /// `frontend` is optional only so unit tests can exercise the lifecycle
+    /// without a live socket; the callers always pass one.
     func attachSession(
         sessionId: String,
         sandboxId: String,
         userId: String,
-        websocket: WebSocket?,
+        username: String? = nil,
+        frontend: (any SandboxExecFrontend)?,
         now: Date = Date()
     ) throws -> PendingExecSession {
         let session = try lock.withLock { () -> PendingExecSession in
@@ -169,10 +188,11 @@ final class SandboxExecSessionManager: @unchecked Sendable {
                 sandboxId: pending.sandboxId,
                 agentKey: pending.agentKey,
                 userId: pending.userId,
+                username: username,
                 attachedAt: now
             )
-            if let websocket {
-                frontendConnections[sessionId] = websocket
+            if let frontend {
+                frontendConnections[sessionId] = frontend
             }
             sandboxSessions[pending.sandboxId, default: []].insert(sessionId)
             return pending
@@ -192,10 +212,21 @@ final class SandboxExecSessionManager: @unchecked Sendable {
     // MARK: - Session lifecycle
 
     /// Remove an attached session (browser gone, exec ended, or start failed).
+    /// Participants still attached are told the session ended.
     func removeSession(sessionId: String) {
-        lock.withLock {
-            guard let session = sessions.removeValue(forKey: sessionId) else { return }
+        let participants = takeSession(sessionId: sessionId)
+        for participant in participants {
+            participant.execClosed(reason: "exec session ended")
+        }
+    }
+
+    /// Unregister a session and return its participants; input still buffered
+    /// for the audit log is flushed.
+    private func takeSession(sessionId: String) -> [any SandboxExecFrontend] {
+        let (participants, records): ([any SandboxExecFrontend], [AuditRecord]) = lock.withLock {
+            guard let session = sessions.removeValue(forKey: sessionId) else { return ([], []) }
             frontendConnections.removeValue(forKey: sessionId)
+            startedSessions.remove(sessionId)
             sandboxSessions[session.sandboxId]?.remove(sessionId)
             if sandboxSessions[session.sandboxId]?.isEmpty == true {
                 sandboxSessions.removeValue(forKey: session.sandboxId)
@@ -206,7 +237,13 @@ final class SandboxExecSessionManager: @unchecked Sendable {
                     "sessionId": .string(sessionId),
                     "sandboxId": .string(session.sandboxId),
                 ])
+            guard var share = shares.removeValue(forKey: sessionId) else { return ([], []) }
+            return (share.terminals, inputRecords(share.drainInput(), share: share, session: session))
+        }
+        if !records.isEmpty {
+            Task { await app.recordSharedSessionAudit(records) }
         }
+        return participants
     }
 
     /// Get attached session info.
@@ -226,37 +263,198 @@ final class SandboxExecSessionManager: @unchecked Sendable {
 
     /// Tear down every session targeting `agentKey` because its socket is
     /// gone (crash, network drop, or graceful unregister). Each attached
-    /// browser gets a terminal error frame and a close — instead of a
-    /// silently frozen terminal — and pending sessions that could never
-    /// start are dropped.
+    /// frontend is told the session closed — instead of a silently frozen
+    /// terminal — and pending sessions that could never start are dropped.
     func closeAllSessions(forAgent agentKey: String, reason: String) {
-        let closed: [(sessionId: String, websocket: WebSocket?)] = lock.withLock {
+        let closed: [(sessionId: String, frontends: [any SandboxExecFrontend])] = lock.withLock {
             for (sessionId, pending) in pendingSessions where pending.agentKey == agentKey {
                 pendingSessions.removeValue(forKey: sessionId)
             }
-            var closed: [(String, WebSocket?)] = []
+            var closed: [(String, [any SandboxExecFrontend])] = []
             for (sessionId, session) in sessions where session.agentKey == agentKey {
                 sessions.removeValue(forKey: sessionId)
-                let websocket = frontendConnections.removeValue(forKey: sessionId)
+                startedSessions.remove(sessionId)
+                var frontends = shares.removeValue(forKey: sessionId)?.terminals ?? []
+                if let frontend = frontendConnections.removeValue(forKey: sessionId) {
+                    frontends.insert(frontend, at: 0)
+                }
                 sandboxSessions[session.sandboxId]?.remove(sessionId)
                 if sandboxSessions[session.sandboxId]?.isEmpty == true {
                     sandboxSessions.removeValue(forKey: session.sandboxId)
                 }
-                closed.append((sessionId, websocket))
+                closed.append((sessionId, frontends))
             }
             return closed
         }
 
-        for (sessionId, websocket) in closed {
+        for (sessionId, frontends) in closed {
             app.logger.info(
                 "Closed sandbox exec session: agent disconnected",
                 metadata: [
                     "sessionId": .string(sessionId),
                     "agentKey": .string(agentKey),
                 ])
-            guard let websocket else { continue }
-            websocket.send(Self.controlFrame(BrowserControlFrame(type: "error", message: reason)))
-            _ = websocket.close(code: .normalClosure)
+            for frontend in frontends {
+                frontend.execClosed(reason: reason)
+            }
+        }
+    }
+
+    // MARK: - Sharing
+
+    /// The sandbox's attached sessions `userId` owns or was invited to,
+    /// newest first. The owner sees each session's invitations; an invitee
+    /// sees only its own access.
+    func sharedSessions(sandboxId: String, for userId: UUID) -> [SharedSessionResponse] {
+        lock.withLock {
+            let sessionIds = sandboxSessions[sandboxId] ?? []
+            return sessionIds.compactMap { sessionId -> SharedSessionResponse? in
+                guard let session = sessions[sessionId] else { return nil }
+                let share = shares[sessionId]
+                if Self.isOwner(userId, of: session) {
+                    return SharedSessionResponse(
+                        id: sessionId, ownerId: UUID(uuidString: session.userId), createdAt: session.attachedAt,
+                        access: nil, participants: share?.invitationResponses ?? [])
+                }
+                guard let invitation = share?.invitations[userId] else { return nil }
+                return SharedSessionResponse(
+                    id: sessionId, ownerId: UUID(uuidString: session.userId), createdAt: session.attachedAt,
+                    access: invitation.access, participants: [])
+            }
+            .sorted { $0.createdAt > $1.createdAt }
+        }
+    }
+
+    /// The session's invitations, for its owner.
+    func participants(sessionId: String, ownerId: UUID) throws -> [SessionParticipantResponse] {
+        try lock.withLock {
+            _ = try ownedSessionLocked(sessionId: sessionId, ownerId: ownerId)
+            return shares[sessionId]?.invitationResponses ?? []
+        }
+    }
+
+    /// Invite `userId` into the owner's session, or change the access of an
+    /// existing invitation — live, for frontends the user already has
+    /// attached. Checking that the invitee may exec into the sandbox is the
+    /// caller's job.
+    func invite(
+        sessionId: String, ownerId: UUID, userId: UUID, username: String, access: SessionAccess,
+        organizationID: UUID?
+    ) throws -> SessionParticipantResponse {
+        let (invitation, connected, changed, audience) = try lock.withLock {
+            _ = try ownedSessionLocked(sessionId: sessionId, ownerId: ownerId)
+            var share = shares[sessionId] ?? SessionShare()
+            let previous = share.invitations[userId]?.access
+            let invitation = share.invite(
+                userId: userId, username: username, access: access, organizationID: organizationID)
+            shares[sessionId] = share
+            let changed = previous != nil && previous != access && share.isConnected(userId)
+            return (invitation, share.isConnected(userId), changed, audienceLocked(sessionId: sessionId))
+        }
+        if changed {
+            for frontend in audience {
+                frontend.execNotice("\(username) is now \(access.label)")
+            }
+        }
+        return SessionParticipantResponse(invitation, connected: connected)
+    }
+
+    /// Withdraw an invitation. The user's attached frontends are closed at
+    /// once; everyone else is told.
+    func revoke(sessionId: String, ownerId: UUID, userId: UUID) throws {
+        let (revoked, username, records, audience) = try lock.withLock {
+            let session = try ownedSessionLocked(sessionId: sessionId, ownerId: ownerId)
+            guard var share = shares[sessionId], let (username, revoked) = share.revoke(userId: userId) else {
+                throw SandboxExecSessionError.notInvited(sessionId)
+            }
+            let records = inputRecords(share.drainInput(from: userId), share: share, session: session)
+            shares[sessionId] = share
+            return (revoked, username, records, audienceLocked(sessionId: sessionId))
+        }
+        for frontend in revoked {
+            frontend.execClosed(reason: "access revoked by the session owner")
+        }
+        if !revoked.isEmpty {
+            for frontend in audience {
+                frontend.execNotice("\(username) was removed from the session")
+            }
+        }
+        if !records.isEmpty {
+            Task { await app.recordSharedSessionAudit(records) }
+        }
+    }
+
+    /// Attach an invited user's frontend to a running session; the owner may
+    /// also join their own session with full access. A frontend joining after
+    /// the process spawned is told at once that input may flow.
+    func join(
+        sessionId: String, sandboxId: String, userId: UUID, username: String, frontend: any SandboxExecFrontend
+    ) throws -> (participantId: UUID, access: SessionAccess) {
+        let (participantId, access, started, audience) = try lock.withLock {
+            guard let session = sessions[sessionId],
+                UUID(uuidString: session.sandboxId) == UUID(uuidString: sandboxId)
+            else {
+                throw SandboxExecSessionError.sessionNotFound(sessionId)
+            }
+            var share = shares[sessionId] ?? SessionShare()
+            let access: SessionAccess
+            if Self.isOwner(userId, of: session) {
+                access = .readWrite
+            } else if let invitation = share.invitations[userId] {
+                access = invitation.access
+            } else {
+                throw SandboxExecSessionError.notInvited(sessionId)
+            }
+            let audience = audienceLocked(sessionId: sessionId)
+            let participantId = share.attach(
+                userId: userId, username: username, access: access, terminal: frontend)
+            shares[sessionId] = share
+            return (participantId, access, startedSessions.contains(sessionId), audience)
+        }
+        if started {
+            frontend.execStarted()
+        }
+        for other in audience {
+            other.execNotice("\(username) joined (\(access.label))")
+        }
+        return (participantId, access)
+    }
+
+    /// Detach a participant that left; the others are told.
+    func removeParticipant(sessionId: String, participantId: UUID) {
+        let left: (username: String, audience: [any SandboxExecFrontend], records: [AuditRecord])? = lock.withLock {
+            guard let session = sessions[sessionId], var share = shares[sessionId],
+                let participant = share.detach(participantId)
+            else { return nil }
+            var records: [AuditRecord] = []
+            if !share.isConnected(participant.userId) {
+                records = inputRecords(share.drainInput(from: participant.userId), share: share, session: session)
+            }
+            shares[sessionId] = share
+            return (participant.username, audienceLocked(sessionId: sessionId), records)
+        }
+        guard let left else { return }
+        for other in left.audience {
+            other.execNotice("\(left.username) left")
+        }
+        if !left.records.isEmpty {
+            Task { await app.recordSharedSessionAudit(left.records) }
+        }
+    }
+
+    /// The audit record of a participant joining.
+    func joinRecord(sessionId: String, userId: UUID, username: String, access: SessionAccess) -> AuditRecord? {
+        lock.withLock {
+            guard let session = sessions[sessionId] else { return nil }
+            return Self.auditTarget(session).joinRecord(
+                userId: userId, username: username, access: access,
+                organizationID: shares[sessionId]?.organizationID)
+        }
+    }
+
+    func participantCount(sessionId: String) -> Int {
+        lock.withLock {
+            shares[sessionId]?.participants.count ?? 0
         }
     }
 
@@ -277,11 +475,45 @@ final class SandboxExecSessionManager: @unchecked Sendable {
         try await sendMessageToAgent(message, agentKey: session.agentKey)
     }
 
-    /// Relay browser stdin bytes (and/or EOF) to the agent.
+    /// Relay the owner's stdin bytes (and/or EOF) to the agent.
     func routeInput(sessionId: String, data: Data?, eof: Bool = false) async throws {
-        guard let session = getSession(sessionId: sessionId) else {
+        let (sessionInfo, records): (AttachedExecSession?, [AuditRecord]) = lock.withLock {
+            guard let session = sessions[sessionId] else { return (nil, []) }
+            guard let data, let ownerId = UUID(uuidString: session.userId) else { return (session, []) }
+            return (
+                session,
+                bufferInputLocked(data, sessionId: sessionId, userId: ownerId, username: session.username ?? "owner")
+            )
+        }
+        guard let session = sessionInfo else {
             throw SandboxExecSessionError.sessionNotFound(sessionId)
         }
+        await app.recordSharedSessionAudit(records)
+        try await sendInput(data, eof: eof, session: session)
+    }
+
+    /// Relay a participant's stdin bytes to the agent. Input from a
+    /// read-only participant — including one downgraded mid-session — is
+    /// dropped.
+    func routeParticipantInput(sessionId: String, participantId: UUID, data: Data) async throws {
+        let (sessionInfo, records): (AttachedExecSession?, [AuditRecord]) = lock.withLock {
+            guard let session = sessions[sessionId],
+                let participant = shares[sessionId]?.participants[participantId],
+                participant.access == .readWrite
+            else { return (nil, []) }
+            return (
+                session,
+                bufferInputLocked(
+                    data, sessionId: sessionId, userId: participant.userId, username: participant.username)
+            )
+        }
+        guard let session = sessionInfo else { return }
+        await app.recordSharedSessionAudit(records)
+        try await sendInput(data, eof: false, session: session)
+    }
+
+    private func sendInput(_ data: Data?, eof: Bool, session: AttachedExecSession) async throws {
+        let sessionId = session.sessionId
         let message: SandboxExecInputMessage
         if let data {
             message = SandboxExecInputMessage(sessionId: sessionId, rawData: data, eof: eof)
@@ -308,19 +540,24 @@ final class SandboxExecSessionManager: @unchecked Sendable {
         try await sendMessageToAgent(message, agentKey: session.agentKey)
     }
 
-    // MARK: - Agent → browser
+    // MARK: - Agent → frontend
 
-    /// The exec process spawned: tell the browser it may start sending input.
+    /// The exec process spawned: tell the frontend it may start sending input.
     func handleStarted(sessionId: String, fromAgentKey agentKey: String) {
-        guard let ws = frontendConnection(sessionId: sessionId, fromAgentKey: agentKey, event: "started")
+        guard let targets = frontendConnection(sessionId: sessionId, fromAgentKey: agentKey, event: "started")
         else { return }
-        ws.send(Self.controlFrame(BrowserControlFrame(type: "ready")))
+        lock.withLock {
+            _ = startedSessions.insert(sessionId)
+        }
+        for frontend in targets {
+            frontend.execStarted()
+        }
     }
 
-    /// Output bytes from the exec process, relayed to the browser as a binary
-    /// frame (stdout and stderr interleaved).
-    func handleOutput(sessionId: String, fromAgentKey agentKey: String, data: Data) {
-        guard let ws = frontendConnection(sessionId: sessionId, fromAgentKey: agentKey, event: "output")
+    /// Output bytes from the exec process, relayed to the frontend. `stream`
+    /// is "stdout" or "stderr" (always "stdout" for a tty session).
+    func handleOutput(sessionId: String, fromAgentKey agentKey: String, data: Data, stream: String = "stdout") {
+        guard let targets = frontendConnection(sessionId: sessionId, fromAgentKey: agentKey, event: "output")
         else {
             // An entirely unknown session (control-plane restart, or the
             // session was already cleaned up) means the agent is streaming
@@ -336,46 +573,55 @@ final class SandboxExecSessionManager: @unchecked Sendable {
             }
             return
         }
-        ws.send([UInt8](data))
+        for frontend in targets {
+            frontend.execOutput(data, stream: stream)
+        }
     }
 
-    /// The exec process ended: report the exit code and close normally.
+    /// The exec process ended: report the exit code.
     func handleExit(sessionId: String, fromAgentKey agentKey: String, exitCode: Int) {
-        guard let ws = frontendConnection(sessionId: sessionId, fromAgentKey: agentKey, event: "exit")
+        guard frontendConnection(sessionId: sessionId, fromAgentKey: agentKey, event: "exit") != nil
         else {
             removeSessionIfOwned(sessionId: sessionId, byAgentKey: agentKey)
             return
         }
-        ws.send(Self.controlFrame(BrowserControlFrame(type: "exit", exitCode: exitCode)))
-        _ = ws.close(code: .normalClosure)
-        removeSession(sessionId: sessionId)
+        let frontend = lock.withLock { frontendConnections[sessionId] }
+        let participants = takeSession(sessionId: sessionId)
+        frontend?.execExited(exitCode: exitCode)
+        for participant in participants {
+            participant.execExited(exitCode: exitCode)
+        }
     }
 
     /// The exec session ended without an exit code (spawn failure, vsock
     /// died, sandbox stopped): report the error and close.
     func handleClosed(sessionId: String, fromAgentKey agentKey: String, reason: String?) {
-        guard let ws = frontendConnection(sessionId: sessionId, fromAgentKey: agentKey, event: "closed")
+        guard frontendConnection(sessionId: sessionId, fromAgentKey: agentKey, event: "closed") != nil
         else {
             removeSessionIfOwned(sessionId: sessionId, byAgentKey: agentKey)
             return
         }
-        let message = reason ?? "exec session closed by agent"
-        ws.send(Self.controlFrame(BrowserControlFrame(type: "error", message: message)))
-        _ = ws.close(code: .normalClosure)
-        removeSession(sessionId: sessionId)
+        let frontend = lock.withLock { frontendConnections[sessionId] }
+        let participants = takeSession(sessionId: sessionId)
+        frontend?.execClosed(reason: reason ?? "exec session closed by agent")
+        for participant in participants {
+            participant.execClosed(reason: reason ?? "exec session closed by agent")
+        }
     }
 
     // MARK: - Private helpers
 
-    /// Resolve the browser socket for an agent-reported event, enforcing that
-    /// the reporting agent is the one the session was created against —
-    /// otherwise a compromised agent could inject frames into another
-    /// tenant's exec session by guessing session ids.
+    /// Resolve the frontend — and the session's participants — for an
+    /// agent-reported event, enforcing that the reporting agent is the one the
+    /// session was created against — otherwise a compromised agent could
+    /// inject frames into another tenant's exec session by guessing session
+    /// ids. The result is nil for such an event, and otherwise every attached
+    /// frontend, the owner's first (possibly none).
     private func frontendConnection(
         sessionId: String, fromAgentKey agentKey: String, event: String
-    ) -> WebSocket? {
-        let (session, websocket) = lock.withLock {
-            (sessions[sessionId], frontendConnections[sessionId])
+    ) -> [any SandboxExecFrontend]? {
+        let (session, frontends) = lock.withLock {
+            (sessions[sessionId], audienceLocked(sessionId: sessionId))
         }
         guard let session else {
             app.logger.debug(
@@ -393,7 +639,53 @@ final class SandboxExecSessionManager: @unchecked Sendable {
                 ])
             return nil
         }
-        return websocket
+        return frontends
+    }
+
+    private static func isOwner(_ userId: UUID, of session: AttachedExecSession) -> Bool {
+        UUID(uuidString: session.userId) == userId
+    }
+
+    private static func auditTarget(_ session: AttachedExecSession) -> SharedSessionAuditTarget {
+        SharedSessionAuditTarget(
+            resourceType: OperationResourceKind.sandbox.rawValue, resourceID: session.sandboxId,
+            sessionId: session.sessionId, kind: "exec")
+    }
+
+    /// Must be called while holding `lock`.
+    private func ownedSessionLocked(sessionId: String, ownerId: UUID) throws -> AttachedExecSession {
+        guard let session = sessions[sessionId] else {
+            throw SandboxExecSessionError.sessionNotFound(sessionId)
+        }
+        guard Self.isOwner(ownerId, of: session) else {
+            throw SandboxExecSessionError.notSessionOwner(sessionId)
+        }
+        return session
+    }
+
+    /// Everyone attached to the session: the owner's frontend and every
+    /// participant. Must be called while holding `lock`.
+    private func audienceLocked(sessionId: String) -> [any SandboxExecFrontend] {
+        (frontendConnections[sessionId].map { [$0] } ?? []) + (shares[sessionId]?.terminals ?? [])
+    }
+
+    /// Must be called while holding `lock`.
+    private func bufferInputLocked(_ data: Data, sessionId: String, userId: UUID, username: String) -> [AuditRecord] {
+        guard let session = sessions[sessionId], var share = shares[sessionId] else { return [] }
+        let text = share.bufferInput(data, from: userId, username: username)
+        shares[sessionId] = share
+        return inputRecords(text.map { [(userId, username, $0)] } ?? [], share: share, session: session)
+    }
+
+    private func inputRecords(
+        _ input: [(userId: UUID, username: String, text: String)], share: SessionShare<any SandboxExecFrontend>,
+        session: AttachedExecSession
+    ) -> [AuditRecord] {
+        let target = Self.auditTarget(session)
+        return input.map {
+            target.inputRecord(
+                userId: $0.userId, username: $0.username, text: $0.text, organizationID: share.organizationID)
+        }
     }
 
     /// Best-effort `SandboxExecCloseMessage` to an agent that reported output
@@ -414,8 +706,8 @@ final class SandboxExecSessionManager: @unchecked Sendable {
             metadata: ["sessionId": .string(sessionId), "agentKey": .string(agentKey)])
     }
 
-    /// Remove a session on a terminal agent event when no browser socket is
-    /// bound (unit tests, or the browser already went away), still requiring
+    /// Remove a session on a terminal agent event when no frontend is bound
+    /// (unit tests, or the browser already went away), still requiring
     /// the reporting agent to own the session.
     private func removeSessionIfOwned(sessionId: String, byAgentKey agentKey: String) {
         let owned = lock.withLock {
@@ -426,24 +718,6 @@ final class SandboxExecSessionManager: @unchecked Sendable {
         }
     }
 
-    /// JSON control frame sent to the browser as a text message.
-    private struct BrowserControlFrame: Encodable {
-        let type: String
-        var exitCode: Int?
-        var message: String?
-    }
-
-    private static func controlFrame(_ frame: BrowserControlFrame) -> String {
-        guard let data = try? JSONEncoder().encode(frame),
-            let text = String(data: data, encoding: .utf8)
-        else {
-            // Encodable String/Int fields cannot fail to encode in practice;
-            // fall back to a bare error frame just in case.
-            return #"{"type":"error","message":"internal encoding error"}"#
-        }
-        return text
-    }
-
     /// Must be called while holding `lock`.
     private func sweepExpiredPendingLocked(now: Date) {
         for (sessionId, pending) in pendingSessions where pending.expiresAt <= now {
@@ -471,6 +745,72 @@ final class SandboxExecSessionManager: @unchecked Sendable {
     }
 }
 
+// MARK: - Frontends
+
+/// The attached end of an exec session. Callbacks arrive in the order the
+/// agent reported them, from the agent's socket handler; exactly one of
+/// `execExited` / `execClosed` ends the session.
+protocol SandboxExecFrontend: Sendable {
+    /// The process spawned; input may flow.
+    func execStarted()
+    /// Output from the process; `stream` is "stdout" or "stderr".
+    func execOutput(_ data: Data, stream: String)
+    func execExited(exitCode: Int)
+    /// The session ended without an exit code (spawn failure, vsock died,
+    /// sandbox stopped, agent gone).
+    func execClosed(reason: String)
+    /// A line about a shared session itself: someone joined, left, or had
+    /// their access changed.
+    func execNotice(_ text: String)
+}
+
+/// A browser attached over `/api/sandboxes/:id/exec/:sessionId/attach`:
+/// output as binary frames (stdout and stderr interleaved), lifecycle as JSON
+/// text control frames, and a close once the session ends.
+struct WebSocketExecFrontend: SandboxExecFrontend {
+    let websocket: WebSocket
+
+    func execStarted() {
+        websocket.send(Self.controlFrame(BrowserControlFrame(type: "ready")))
+    }
+
+    func execOutput(_ data: Data, stream: String) {
+        websocket.send([UInt8](data))
+    }
+
+    func execExited(exitCode: Int) {
+        websocket.send(Self.controlFrame(BrowserControlFrame(type: "exit", exitCode: exitCode)))
+        _ = websocket.close(code: .normalClosure)
+    }
+
+    func execClosed(reason: String) {
+        websocket.send(Self.controlFrame(BrowserControlFrame(type: "error", message: reason)))
+        _ = websocket.close(code: .normalClosure)
+    }
+
+    func execNotice(_ text: String) {
+        websocket.send(Self.controlFrame(BrowserControlFrame(type: "notice", message: text)))
+    }
+
+    /// JSON control frame sent to the browser as a text message.
+    private struct BrowserControlFrame: Encodable {
+        let type: String
+        var exitCode: Int?
+        var message: String?
+    }
+
+    private static func controlFrame(_ frame: BrowserControlFrame) -> String {
+        guard let data = try? JSONEncoder().encode(frame),
+            let text = String(data: data, encoding: .utf8)
+        else {
+            // Encodable String/Int fields cannot fail to encode in practice;
+            // fall back to a bare error frame just in case.
+            return #"{"type":"error","message":"internal encoding error"}"#
+        }
+        return text
+    }
+}
+
 // MARK: - Errors
 
 enum SandboxExecSessionError: Error, LocalizedError, Equatable {
@@ -479,6 +819,8 @@ enum SandboxExecSessionError: Error, LocalizedError, Equatable {
     case sessionMismatch(String)
     case alreadyAttached(String)
     case agentNotConnected(String)
+    case notSessionOwner(String)
+    case notInvited(String)
 
     var errorDescription: String? {
         switch self {
@@ -492,6 +834,10 @@ enum SandboxExecSessionError: Error, LocalizedError, Equatable {
             return "Exec session is already attached: \(sessionId)"
         case .agentNotConnected(let agentKey):
             return "Agent not connected: \(agentKey)"
+        case .notSessionOwner(let sessionId):
+            return "Only the user who opened exec session \(sessionId) may share it"
+        case .notInvited(let sessionId):
+            return "Not invited to exec session \(sessionId)"
         }
     }
 }
@@ -61,6 +61,23 @@ struct SchedulableAgent: Sendable {
     /// only this — no host binary, just a firmware set the agent resolves — so
     /// it is tracked separately from `supportsVTPM`.
     let supportsMachineProfile: Bool
+    /// Whether this agent enrolls a VM's own Secure Boot keys (wire v29): it
+    /// advertised `MachineCapability.secureBootKeyEnrollment` AND speaks v29.
+    let supportsSecureBootKeys: Bool
+    /// Whether this agent runs guest commands and exports boot disks for an
+    /// image build's VM (wire v33).
+    let supportsImageBuilds: Bool
+    /// Whether this agent honors `VMSpec.cpuModel` (wire v28); `cpuModels`
+    /// is the set of named models it reported running in full.
+    let supportsCPUModels: Bool
+    let cpuModels: Set<String>
+    /// The CPU model of the agent's site, which a QEMU VM naming none gets
+    /// when placed here. Nil for site-less agents and sites without one.
+    let siteDefaultCPUModel: GuestCPUModel?
+    /// Whether disruptive work is under way here — today an agent update the
+    /// rollout has assigned but the agent hasn't converged on. VMs of
+    /// projects with maintenance windows are never placed on such agents.
+    let hasPendingMaintenance: Bool
 
     init(
         id: String,
@@ -80,7 +97,13 @@ struct SchedulableAgent: Sendable {
         wireProtocolVersion: Int? = nil,
         supportsSandboxWorkloads: Bool = false,
         supportsVTPM: Bool = false,
-        supportsMachineProfile: Bool = false
+        supportsMachineProfile: Bool = false,
+        supportsSecureBootKeys: Bool = false,
+        supportsImageBuilds: Bool = false,
+        supportsCPUModels: Bool = false,
+        cpuModels: Set<String> = [],
+        siteDefaultCPUModel: GuestCPUModel? = nil,
+        hasPendingMaintenance: Bool = false
     ) {
         self.id = id
         self.name = name
@@ -100,6 +123,26 @@ struct SchedulableAgent: Sendable {
         self.supportsSandboxWorkloads = supportsSandboxWorkloads
         self.supportsVTPM = supportsVTPM
         self.supportsMachineProfile = supportsMachineProfile
+        self.supportsSecureBootKeys = supportsSecureBootKeys
+        self.supportsImageBuilds = supportsImageBuilds
+        self.supportsCPUModels = supportsCPUModels
+        self.cpuModels = cpuModels
+        self.siteDefaultCPUModel = siteDefaultCPUModel
+        self.hasPendingMaintenance = hasPendingMaintenance
+    }
+
+    /// Whether a guest asking for `model` would get it here. Passthrough is
+    /// what every agent has always done; `host-model` needs an agent that
+    /// resolves it; a named model must also be one the agent reported.
+    func canProvide(_ model: GuestCPUModel) -> Bool {
+        switch model {
+        case .hostPassthrough:
+            return true
+        case .hostModel:
+            return supportsCPUModels
+        case .named(let name):
+            return supportsCPUModels && cpuModels.contains(name)
+        }
     }
 
     /// Calculate resource utilization percentage (0.0 to 1.0)
@@ -155,7 +198,13 @@ struct SchedulableAgent: Sendable {
             wireProtocolVersion: wireProtocolVersion,
             supportsSandboxWorkloads: supportsSandboxWorkloads,
             supportsVTPM: supportsVTPM,
-            supportsMachineProfile: supportsMachineProfile
+            supportsMachineProfile: supportsMachineProfile,
+            supportsSecureBootKeys: supportsSecureBootKeys,
+            supportsImageBuilds: supportsImageBuilds,
+            supportsCPUModels: supportsCPUModels,
+            cpuModels: cpuModels,
+            siteDefaultCPUModel: siteDefaultCPUModel,
+            hasPendingMaintenance: hasPendingMaintenance
         )
     }
 }
@@ -177,6 +226,10 @@ struct VMPlacementRequirements: Sendable {
     /// Whether the VM needs VM-to-VM networking, which user-mode (SLIRP)
     /// agents cannot provide.
     let requiresInterVMNetworking: Bool
+    /// Whether a NIC of the VM is on an IPv6-only network (wire v30). Hard
+    /// constraint: sync assembly omits such networks for older agents, so
+    /// the NIC would have no switch to attach to there.
+    let requiresIPv6OnlyNetworks: Bool
     /// Site the VM must place into, when one of its networks is pinned to a
     /// site (a pinned network only exists in that site's OVN deployment).
     /// Hard constraint; nil means unconstrained.
@@ -196,6 +249,28 @@ struct VMPlacementRequirements: Sendable {
     /// resolve a signed firmware set (or fail the create loudly if its host
     /// has none).
     let requiresSecureBoot: Bool
+    /// Whether the VM enrolls its own Secure Boot keys. Hard constraint: an
+    /// agent that can't would boot it trusting the firmware template's keys.
+    let requiresSecureBootKeys: Bool
+    /// Whether the VM is an image build's, which the control plane drives
+    /// through guest commands and captures with a disk export. Hard
+    /// constraint: an older agent cannot decode either message.
+    let requiresImageBuildSupport: Bool
+    /// Agents able to reach the data of every volume the VM boots with —
+    /// for a local pool the replica's agent, for a replicated one the pool's
+    /// members. Hard constraint: a VM placed elsewhere cannot open its
+    /// disks. Nil means unconstrained (no volumes, or only unrestricted
+    /// pools).
+    let storageAgentIDs: Set<String>?
+    /// The guest CPU model the VM asks for. Hard constraint: a named model
+    /// the host can't run fails to start, and one the agent would ignore
+    /// silently hands the guest passthrough. Nil defers to each candidate's
+    /// site default (QEMU only).
+    let cpuModel: GuestCPUModel?
+    /// Whether the VM's project keeps maintenance windows. Agents with
+    /// disruptive work pending are excluded, since landing there would have
+    /// the VM disrupted without the project's window or notice.
+    let requiresUndisturbedAgent: Bool
 
     init(
         cpu: Int,
@@ -204,10 +279,16 @@ struct VMPlacementRequirements: Sendable {
         hypervisorType: HypervisorType = .qemu,
         architecture: CPUArchitecture? = nil,
         requiresInterVMNetworking: Bool = false,
+        requiresIPv6OnlyNetworks: Bool = false,
         siteID: UUID? = nil,
         requiresSandboxRuntime: Bool = false,
         requiresVTPM: Bool = false,
-        requiresSecureBoot: Bool = false
+        requiresSecureBoot: Bool = false,
+        requiresSecureBootKeys: Bool = false,
+        requiresImageBuildSupport: Bool = false,
+        storageAgentIDs: Set<String>? = nil,
+        cpuModel: GuestCPUModel? = nil,
+        requiresUndisturbedAgent: Bool = false
     ) {
         self.cpu = cpu
         self.memory = memory
@@ -215,10 +296,16 @@ struct VMPlacementRequirements: Sendable {
         self.hypervisorType = hypervisorType
         self.architecture = architecture
         self.requiresInterVMNetworking = requiresInterVMNetworking
+        self.requiresIPv6OnlyNetworks = requiresIPv6OnlyNetworks
         self.siteID = siteID
         self.requiresSandboxRuntime = requiresSandboxRuntime
         self.requiresVTPM = requiresVTPM
         self.requiresSecureBoot = requiresSecureBoot
+        self.requiresSecureBootKeys = requiresSecureBootKeys
+        self.requiresImageBuildSupport = requiresImageBuildSupport
+        self.storageAgentIDs = storageAgentIDs
+        self.cpuModel = cpuModel
+        self.requiresUndisturbedAgent = requiresUndisturbedAgent
     }
 }
 
@@ -229,11 +316,17 @@ enum SchedulerError: Error, CustomStringConvertible, Sendable {
     case noUsableHypervisors(onlineAgents: Int)
     case architectureMismatch(required: CPUArchitecture)
     case networkCapabilityUnsatisfied
+    case ipv6OnlyNetworksUnsatisfied(eligibleAgents: Int)
     case sandboxRuntimeUnsatisfied(eligibleAgents: Int)
     case vtpmUnsatisfied(eligibleAgents: Int)
     case machineProfileUnsatisfied(eligibleAgents: Int)
+    case secureBootKeysUnsatisfied(eligibleAgents: Int)
+    case imageBuildUnsatisfied(eligibleAgents: Int)
+    case cpuModelUnsatisfied(model: String, eligibleAgents: Int)
     case siteUnsatisfied(requiredSiteID: UUID)
+    case storagePlacementUnsatisfied(candidateAgents: Int)
     case insufficientResources(required: VMPlacementRequirements, available: [SchedulableAgent])
+    case maintenanceWindowUnsatisfied(eligibleAgents: Int)
     case invalidStrategy(String)
     case agentServiceUnavailable
 
@@ -257,6 +350,10 @@ enum SchedulerError: Error, CustomStringConvertible, Sendable {
                 "No eligible agent has a \(required.displayName) host architecture (required for hardware-accelerated guests)"
         case .networkCapabilityUnsatisfied:
             return "No eligible agent supports VM-to-VM networking required by this VM"
+        case .ipv6OnlyNetworksUnsatisfied(let eligibleAgents):
+            return
+                "No eligible agent is new enough to attach IPv6-only networks (\(eligibleAgents) agent(s) checked) "
+                + "— upgrade the agents on your hypervisor nodes"
         case .sandboxRuntimeUnsatisfied(let eligibleAgents):
             return
                 "No eligible agent advertises the sandbox runtime (\(eligibleAgents) Firecracker-capable agent(s) checked) — each needs a working Firecracker/KVM setup and the sandbox guest base image installed"
@@ -268,12 +365,34 @@ enum SchedulerError: Error, CustomStringConvertible, Sendable {
             return
                 "No eligible agent is new enough to realize Secure Boot or a TPM (\(eligibleAgents) agent(s) "
                 + "checked) — upgrade the agents on your hypervisor nodes"
+        case .secureBootKeysUnsatisfied(let eligibleAgents):
+            return
+                "No eligible agent can enroll custom Secure Boot keys (\(eligibleAgents) agent(s) checked) — "
+                + "install virt-fw-vars on a hypervisor node (Debian/Ubuntu: `apt install python3-virt-firmware`) "
+                + "and upgrade its agent"
+        case .imageBuildUnsatisfied(let eligibleAgents):
+            return
+                "No eligible agent is new enough to host an image build (\(eligibleAgents) agent(s) checked) "
+                + "— upgrade the agents on your hypervisor nodes"
+        case .cpuModelUnsatisfied(let model, let eligibleAgents):
+            return
+                "No eligible agent can run the \(model) guest CPU model (\(eligibleAgents) agent(s) checked) "
+                + "— pick a model every host in the site reports, or upgrade the agents"
         case .siteUnsatisfied(let requiredSiteID):
             return
                 "No online agent belongs to site \(requiredSiteID) required by the VM's network pinning"
+        case .storagePlacementUnsatisfied(let candidateAgents):
+            return
+                "No online agent can reach the data of every volume the VM attaches (\(candidateAgents) "
+                + "candidate agent(s) from the volumes' pools) — attach volumes from a common pool, or migrate them"
         case .insufficientResources(let required, let available):
             return
                 "No agent has sufficient resources. Required: CPU=\(required.cpu), Memory=\(required.memory), Disk=\(required.disk). Available agents: \(available.count)"
+        case .maintenanceWindowUnsatisfied(let eligibleAgents):
+            return
+                "Every eligible agent (\(eligibleAgents) checked) has an agent update pending, and the project's "
+                + "maintenance windows keep its VMs off hosts with disruptive work in flight — retry once the "
+                + "rollout has converged"
         case .invalidStrategy(let strategy):
             return "Invalid scheduling strategy: \(strategy)"
         case .agentServiceUnavailable:
@@ -326,7 +445,8 @@ final class SchedulerService: @unchecked Sendable {
     /// agents. It becomes derivable once VMs can express attachment to a
     /// shared/tenant network at creation time.
     static func placementRequirements(
-        for vm: VM, architecture: CPUArchitecture? = nil, siteID: UUID? = nil
+        for vm: VM, architecture: CPUArchitecture? = nil, siteID: UUID? = nil,
+        ipv6OnlyNetworks: Bool = false, storageAgentIDs: Set<String>? = nil, maintenanceWindows: Bool = false
     ) -> VMPlacementRequirements {
         VMPlacementRequirements(
             cpu: vm.cpu,
@@ -334,9 +454,15 @@ final class SchedulerService: @unchecked Sendable {
             disk: vm.disk,
             hypervisorType: vm.hypervisorType,
             architecture: architecture,
+            requiresIPv6OnlyNetworks: ipv6OnlyNetworks,
             siteID: siteID,
             requiresVTPM: vm.tpmEnabled,
-            requiresSecureBoot: vm.secureBoot
+            requiresSecureBoot: vm.secureBoot,
+            requiresSecureBootKeys: vm.secureBoot && vm.secureBootKeys != nil,
+            requiresImageBuildSupport: vm.$imageBuild.id != nil,
+            storageAgentIDs: storageAgentIDs,
+            cpuModel: vm.cpuModel.flatMap(GuestCPUModel.init(rawValue:)),
+            requiresUndisturbedAgent: maintenanceWindows
         )
     }
 
@@ -521,19 +647,31 @@ final class SchedulerService: @unchecked Sendable {
             siteMatched = online
         }
 
-        let hypervisorCapable = siteMatched.filter { $0.supportedHypervisors.contains(requirements.hypervisorType) }
+        // Volume co-placement is as categorical as site pinning: an agent
+        // outside a volume's reach could never open the disk.
+        let storageMatched: [SchedulableAgent]
+        if let storageAgentIDs = requirements.storageAgentIDs {
+            storageMatched = siteMatched.filter { storageAgentIDs.contains($0.id) }
+            guard !storageMatched.isEmpty else {
+                throw SchedulerError.storagePlacementUnsatisfied(candidateAgents: storageAgentIDs.count)
+            }
+        } else {
+            storageMatched = siteMatched
+        }
+
+        let hypervisorCapable = storageMatched.filter { $0.supportedHypervisors.contains(requirements.hypervisorType) }
         guard !hypervisorCapable.isEmpty else {
             // Distinguish a genuine backend mismatch from agents that
             // advertise no hypervisor at all (failed binary probes at
             // registration) so the operator is pointed at the agent's
             // configuration rather than the VM's hypervisor type.
-            let agentsWithoutHypervisors = siteMatched.count(where: { $0.supportedHypervisors.isEmpty })
-            if agentsWithoutHypervisors == siteMatched.count {
-                throw SchedulerError.noUsableHypervisors(onlineAgents: siteMatched.count)
+            let agentsWithoutHypervisors = storageMatched.count(where: { $0.supportedHypervisors.isEmpty })
+            if agentsWithoutHypervisors == storageMatched.count {
+                throw SchedulerError.noUsableHypervisors(onlineAgents: storageMatched.count)
             }
             throw SchedulerError.unsupportedHypervisor(
                 required: requirements.hypervisorType,
-                onlineAgents: siteMatched.count,
+                onlineAgents: storageMatched.count,
                 agentsWithoutHypervisors: agentsWithoutHypervisors
             )
         }
@@ -572,6 +710,36 @@ final class SchedulerService: @unchecked Sendable {
             }
             machineCapable = tpmCapable
         }
+        if requirements.requiresSecureBootKeys {
+            let keyCapable = machineCapable.filter { $0.supportsSecureBootKeys }
+            guard !keyCapable.isEmpty else {
+                throw SchedulerError.secureBootKeysUnsatisfied(eligibleAgents: machineCapable.count)
+            }
+            machineCapable = keyCapable
+        }
+        if requirements.requiresImageBuildSupport {
+            let buildCapable = machineCapable.filter { $0.supportsImageBuilds }
+            guard !buildCapable.isEmpty else {
+                throw SchedulerError.imageBuildUnsatisfied(eligibleAgents: machineCapable.count)
+            }
+            machineCapable = buildCapable
+        }
+
+        // A guest CPU model — the VM's own, or for a QEMU VM without one the
+        // candidate's site default — must be one the agent can provide.
+        // Checked per agent because defaults differ between sites. Failing
+        // here beats the alternatives: QEMU refuses a model the host lacks,
+        // and a pre-v28 agent would drop the field and pass the host through.
+        let cpuModelCapable = machineCapable.filter { agent in
+            guard let model = effectiveCPUModel(requirements, on: agent) else { return true }
+            return agent.canProvide(model)
+        }
+        guard !cpuModelCapable.isEmpty else {
+            let model = requirements.cpuModel ?? machineCapable.lazy.compactMap(\.siteDefaultCPUModel).first
+            throw SchedulerError.cpuModelUnsatisfied(
+                model: model?.rawValue ?? "requested", eligibleAgents: machineCapable.count)
+        }
+        machineCapable = cpuModelCapable
 
         // An agent with unknown architecture cannot prove it satisfies an
         // explicit architecture requirement, so it is excluded.
@@ -592,18 +760,43 @@ final class SchedulerService: @unchecked Sendable {
         guard !networkCapable.isEmpty else {
             throw SchedulerError.networkCapabilityUnsatisfied
         }
+        let familyCapable =
+            requirements.requiresIPv6OnlyNetworks
+            ? networkCapable.filter { WireProtocol.supportsIPv6OnlyNetworks($0.wireProtocolVersion ?? 0) }
+            : networkCapable
+        guard !familyCapable.isEmpty else {
+            throw SchedulerError.ipv6OnlyNetworksUnsatisfied(eligibleAgents: networkCapable.count)
+        }
 
-        let eligible = networkCapable.filter { agent in
+        let eligible = familyCapable.filter { agent in
             agent.availableCPU >= requirements.cpu && agent.availableMemory >= requirements.memory
                 && agent.availableDisk >= requirements.disk
         }
         guard !eligible.isEmpty else {
-            throw SchedulerError.insufficientResources(required: requirements, available: networkCapable)
+            throw SchedulerError.insufficientResources(required: requirements, available: familyCapable)
         }
 
+        // Checked last so the error names the one thing that's missing: the
+        // VM would fit, but only where gated work is about to land.
+        if requirements.requiresUndisturbedAgent {
+            let undisturbed = eligible.filter { !$0.hasPendingMaintenance }
+            guard !undisturbed.isEmpty else {
+                throw SchedulerError.maintenanceWindowUnsatisfied(eligibleAgents: eligible.count)
+            }
+            return undisturbed
+        }
         return eligible
     }
 
+    /// The CPU model a VM would get on `agent`: its own, else (QEMU only)
+    /// the agent's site default.
+    private func effectiveCPUModel(_ requirements: VMPlacementRequirements, on agent: SchedulableAgent)
+        -> GuestCPUModel?
+    {
+        if let model = requirements.cpuModel { return model }
+        return requirements.hypervisorType == .qemu ? agent.siteDefaultCPUModel : nil
+    }
+
     /// Best-fit strategy: Pack VMs onto agents with least remaining capacity
     /// This minimizes fragmentation and maximizes resource utilization
     private func selectBestFit(from agents: [SchedulableAgent]) throws -> SchedulableAgent {
@@ -125,7 +125,8 @@ struct SecretsEncryptionService: @unchecked Sendable {
     }
 
     /// Re-encrypts any plaintext stored secrets (OIDC client secrets, SSF
-    /// stream auth tokens, registry pull secrets). Runs at every startup so rows written before a key
+    /// stream auth tokens, registry pull secrets, webhook signing secrets, object
+    /// storage secret keys). Runs at every startup so rows written before a key
     /// existed converge to encrypted form as soon as one is configured.
     /// Idempotent; concurrent replicas may both re-encrypt a row, but each
     /// writes a self-contained valid ciphertext.
@@ -179,6 +180,50 @@ struct SecretsEncryptionService: @unchecked Sendable {
         if migratedSigningSecrets > 0 {
             logger.info("Encrypted \(migratedSigningSecrets) stored webhook signing secret(s) at rest")
         }
+
+        let accessKeys = try await ObjectStorageAccessKey.query(on: db).all()
+        var migratedAccessKeys = 0
+        for accessKey in accessKeys where !accessKey.secret.hasPrefix(Self.encryptedPrefix) {
+            accessKey.secret = try encrypt(accessKey.secret)
+            try await accessKey.save(on: db)
+            migratedAccessKeys += 1
+        }
+        if migratedAccessKeys > 0 {
+            logger.info("Encrypted \(migratedAccessKeys) stored object storage secret key(s) at rest")
+        }
+    }
+
+    /// Gives every vTPM VM that lacks one its TPM state key, wrapped. Without a
+    /// secrets key there is nothing to wrap it with, and a state key stored in
+    /// plaintext would protect nothing, so TPM-state encryption stays off —
+    /// the agents keep those VMs' state unencrypted — and that is logged as an
+    /// error while any vTPM VM exists. Runs every startup, so a key set later
+    /// enables it for the VMs created before.
+    func mintTPMStateKeys(on db: Database, logger: Logger) async throws {
+        let unkeyed = try await VM.query(on: db)
+            .filter(\.$tpmEnabled == true)
+            .filter(\.$tpmStateKey == nil)
+            .all()
+        guard !unkeyed.isEmpty else { return }
+        guard isEnabled else {
+            logger.error(
+                "STRATO_SECRET_ENCRYPTION_KEY is not set — TPM state encryption is disabled, and \(unkeyed.count) vTPM VM(s) keep their TPM state unencrypted on the agents"
+            )
+            return
+        }
+
+        // A targeted update rather than `save()`: VM rows take observed-state
+        // writes concurrently, which a whole-row save would clobber. The nil
+        // filter keeps a concurrent replica's key rather than replacing it.
+        for vm in unkeyed {
+            guard let vmId = vm.id else { continue }
+            try await VM.query(on: db)
+                .filter(\.$id == vmId)
+                .filter(\.$tpmStateKey == nil)
+                .set(\.$tpmStateKey, to: try encrypt(VM.generateTPMStateKey()))
+                .update()
+        }
+        logger.info("Minted TPM state keys for \(unkeyed.count) vTPM VM(s)")
     }
 }
 
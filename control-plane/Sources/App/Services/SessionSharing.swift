@@ -0,0 +1,230 @@
+import Foundation
+import Vapor
+
+/// What an invited participant may do in a shared console or exec session.
+enum SessionAccess: String, Codable, CaseIterable, Sendable {
+    /// Sees the session's output; anything typed is dropped.
+    case readOnly = "read_only"
+    /// Types into the session alongside its owner.
+    case readWrite = "read_write"
+
+    /// How notices name the access: "read-only" or "read-write".
+    var label: String {
+        switch self {
+        case .readOnly: return "read-only"
+        case .readWrite: return "read-write"
+        }
+    }
+}
+
+/// The sharing state of one live console or exec session, kept by its
+/// session manager under the manager's lock: who the owner invited, which
+/// terminals are attached as participants, and the per-user input buffers
+/// of the audit trail.
+///
+/// Sharing lives and dies with the session — nothing is persisted, and an
+/// invitation does not outlive the session it was issued for.
+struct SessionShare<Terminal: Sendable>: Sendable {
+    /// Input is audited in chunks of at most this many bytes.
+    static var maxAuditedInputBytes: Int { 1024 }
+
+    struct Invitation: Sendable {
+        let userId: UUID
+        let username: String
+        var access: SessionAccess
+        let invitedAt: Date
+    }
+
+    /// A terminal attached to the session other than the owner's first one:
+    /// an invitee's, or the owner's own from another device.
+    struct Participant: Sendable {
+        let userId: UUID
+        let username: String
+        var access: SessionAccess
+        let terminal: Terminal
+        let joinedAt: Date
+    }
+
+    private(set) var invitations: [UUID: Invitation] = [:]
+    private(set) var participants: [UUID: Participant] = [:]
+
+    /// Set by the first invitation and never cleared: from then on every
+    /// user's input is audited, including the owner's, until the session ends.
+    private(set) var auditsInput = false
+    /// The organization the audit records are filed under.
+    private(set) var organizationID: UUID?
+
+    /// Buffered input per user, flushed to the audit log a line at a time.
+    private var pendingInput: [UUID: (username: String, bytes: Data)] = [:]
+
+    var terminals: [Terminal] { participants.values.map(\.terminal) }
+
+    // MARK: Invitations
+
+    /// Invite `userId`, or change the access of an existing invitation. Any
+    /// terminals the user already has attached take the new access at once.
+    mutating func invite(
+        userId: UUID, username: String, access: SessionAccess, organizationID: UUID?, now: Date = Date()
+    ) -> Invitation {
+        let invitation = Invitation(
+            userId: userId, username: username, access: access,
+            invitedAt: invitations[userId]?.invitedAt ?? now)
+        invitations[userId] = invitation
+        for (id, participant) in participants where participant.userId == userId {
+            participants[id]?.access = access
+        }
+        auditsInput = true
+        if let organizationID {
+            self.organizationID = organizationID
+        }
+        return invitation
+    }
+
+    /// Withdraw `userId`'s invitation, if any, and detach every terminal
+    /// they have attached; the terminals are returned for the caller to
+    /// close, with the name to announce. Nil when the user was neither
+    /// invited nor attached.
+    mutating func revoke(userId: UUID) -> (username: String, terminals: [Terminal])? {
+        let invitation = invitations.removeValue(forKey: userId)
+        let revoked = participants.filter { $0.value.userId == userId }
+        guard let username = invitation?.username ?? revoked.first?.value.username else { return nil }
+        for id in revoked.keys {
+            participants.removeValue(forKey: id)
+        }
+        return (username, revoked.values.map(\.terminal))
+    }
+
+    // MARK: Participants
+
+    /// Attach a terminal; returns its participant ID.
+    mutating func attach(
+        userId: UUID, username: String, access: SessionAccess, terminal: Terminal, now: Date = Date()
+    ) -> UUID {
+        let id = UUID()
+        participants[id] = Participant(
+            userId: userId, username: username, access: access, terminal: terminal, joinedAt: now)
+        return id
+    }
+
+    mutating func detach(_ participantId: UUID) -> Participant? {
+        participants.removeValue(forKey: participantId)
+    }
+
+    /// Whether `userId` has a terminal attached.
+    func isConnected(_ userId: UUID) -> Bool {
+        participants.values.contains { $0.userId == userId }
+    }
+
+    /// The invitations as the owner sees them, oldest first.
+    var invitationResponses: [SessionParticipantResponse] {
+        invitations.values
+            .map { SessionParticipantResponse($0, connected: isConnected($0.userId)) }
+            .sorted { $0.invitedAt < $1.invitedAt }
+    }
+
+    // MARK: Input audit
+
+    /// Buffer input typed by `userId`. Returns the text to audit once a line
+    /// completes or the buffer fills; nil while input is not audited or the
+    /// line is still open. The recorded text is what was typed — a password
+    /// typed at a prompt is in it, which is why auditing only starts once the
+    /// owner shares the session.
+    mutating func bufferInput(_ data: Data, from userId: UUID, username: String) -> String? {
+        guard auditsInput else { return nil }
+        var buffered = pendingInput[userId]?.bytes ?? Data()
+        buffered.append(data)
+        let lineEnded = data.contains(UInt8(ascii: "\r")) || data.contains(UInt8(ascii: "\n"))
+        guard lineEnded || buffered.count >= Self.maxAuditedInputBytes else {
+            pendingInput[userId] = (username, buffered)
+            return nil
+        }
+        pendingInput.removeValue(forKey: userId)
+        return String(decoding: buffered, as: UTF8.self)
+    }
+
+    /// Take every user's unfinished input, for when users leave or the
+    /// session ends.
+    mutating func drainInput(from userId: UUID? = nil) -> [(userId: UUID, username: String, text: String)] {
+        let drained = pendingInput.filter { userId == nil || $0.key == userId }
+        for key in drained.keys {
+            pendingInput.removeValue(forKey: key)
+        }
+        return drained.map { ($0.key, $0.value.username, String(decoding: $0.value.bytes, as: UTF8.self)) }
+    }
+}
+
+/// Which session an input audit record belongs to.
+struct SharedSessionAuditTarget: Sendable {
+    /// `virtual_machine` or `sandbox`.
+    let resourceType: String
+    let resourceID: String
+    let sessionId: String
+    /// `console` or `exec`.
+    let kind: String
+
+    func inputRecord(userId: UUID, username: String, text: String, organizationID: UUID?) -> AuditRecord {
+        AuditRecord(
+            eventType: AuditEventType.sharedSessionInput.rawValue,
+            userID: userId,
+            username: username,
+            organizationID: organizationID,
+            resourceType: resourceType,
+            resourceID: resourceID,
+            action: kind,
+            metadata: ["sessionId": sessionId, "input": text])
+    }
+
+    func joinRecord(userId: UUID, username: String, access: SessionAccess, organizationID: UUID?) -> AuditRecord {
+        AuditRecord(
+            eventType: AuditEventType.sharedSessionJoin.rawValue,
+            userID: userId,
+            username: username,
+            organizationID: organizationID,
+            resourceType: resourceType,
+            resourceID: resourceID,
+            action: kind,
+            metadata: ["sessionId": sessionId, "access": access.rawValue])
+    }
+}
+
+extension Application {
+    /// Record the audit events a session manager produced under its lock.
+    func recordSharedSessionAudit(_ records: [AuditRecord]) async {
+        for record in records {
+            await audit.record(record)
+        }
+    }
+}
+
+/// The wire form of a session shown to its owner or an invitee.
+struct SharedSessionResponse: Content {
+    let id: String
+    /// The user who opened the session.
+    let ownerId: UUID?
+    let createdAt: Date
+    /// Null for the caller's own session.
+    let access: SessionAccess?
+    let participants: [SessionParticipantResponse]
+}
+
+/// An invitation, and whether the invitee is attached right now.
+struct SessionParticipantResponse: Content {
+    let userId: UUID
+    let username: String
+    let access: SessionAccess
+    let invitedAt: Date
+    let connected: Bool
+
+    init<Terminal: Sendable>(_ invitation: SessionShare<Terminal>.Invitation, connected: Bool) {
+        self.userId = invitation.userId
+        self.username = invitation.username
+        self.access = invitation.access
+        self.invitedAt = invitation.invitedAt
+        self.connected = connected
+    }
+}
+
+struct InviteSessionParticipantRequest: Content {
+    let userId: UUID
+    let access: SessionAccess
+}
@@ -125,6 +125,7 @@ struct VMSpecBuilder {
             memoryBytes: memorySize,
             maxMemoryBytes: vm.maxMemory > memorySize ? vm.maxMemory : memorySize,
             balloonTargetBytes: vm.balloonTarget,
+            memoryFloorBytes: vm.memoryFloor,
             diskBytes: vm.disk,
             sharedMemory: vm.sharedMemory,
             hugepages: vm.hugepages,
@@ -134,7 +135,9 @@ struct VMSpecBuilder {
                 cmdline: vm.cmdline ?? image.defaultCmdline,
                 firmware: vm.firmwarePath
             ),
-            machine: MachineProfile(secureBoot: vm.secureBoot, tpm: vm.tpmEnabled),
+            machine: MachineProfile(
+                secureBoot: vm.secureBoot, tpm: vm.tpmEnabled, secureBootKeys: vm.secureBoot ? vm.secureBootKeys : nil),
+            cpuModel: vm.cpuModel.flatMap(GuestCPUModel.init(rawValue:)),
             volumes: legacyVolumeSpecs(from: vm),
             networks: networkSpecs(from: networkInterfaces, networks: networks),
             console: ConsoleSpec(console: vm.consoleMode, serial: vm.serialMode),
@@ -145,19 +148,24 @@ struct VMSpecBuilder {
 
     /// Builds a VM spec from VM and Image, with attached volumes
     /// - Parameters:
-    ///   - vm: The VM to build the spec for (must have volumes eager-loaded with .with(\.$volumes))
+    ///   - vm: The VM to build the spec for
     ///   - image: The image used for the boot volume (if no boot volume attached)
-    ///   - volumes: Attached volumes (sorted by boot order, then device name)
+    ///   - attachments: The VM's volume attachments, with each volume
+    ///     eager-loaded (`.with(\.$volume)`); sorted here by boot order, then
+    ///     device name
     ///   - networkInterfaces: The VM's network interfaces
+    ///   - includeVolumeQoS: Whether to carry volume-type I/O limits (false
+    ///     for pre-v21 agents, which would ignore them)
     static func buildVMSpecWithVolumes(
-        from vm: VM, image: Image?, volumes: [Volume], networkInterfaces: [VMNetworkInterface],
+        from vm: VM, image: Image?, attachments: [VolumeAttachment], networkInterfaces: [VMNetworkInterface],
         networks: [String: LogicalNetwork] = [:],
-        securityGroupsByInterface: [UUID: [UUID]] = [:]
+        securityGroupsByInterface: [UUID: [UUID]] = [:],
+        includeVolumeQoS: Bool = true
     ) -> VMSpec {
         let cpuCount = vm.cpu > 0 ? vm.cpu : (image?.defaultCpu ?? 1)
         let memorySize = vm.memory > 0 ? vm.memory : (image?.defaultMemory ?? 1024 * 1024 * 1024)  // 1GB default
 
-        var volumes = volumeSpecs(from: volumes)
+        var volumes = volumeSpecs(from: attachments, includeQoS: includeVolumeQoS)
         if volumes.isEmpty {
             volumes = legacyVolumeSpecs(from: vm)
         }
@@ -168,6 +176,7 @@ struct VMSpecBuilder {
             memoryBytes: memorySize,
             maxMemoryBytes: vm.maxMemory > memorySize ? vm.maxMemory : memorySize,
             balloonTargetBytes: vm.balloonTarget,
+            memoryFloorBytes: vm.memoryFloor,
             diskBytes: vm.disk,
             sharedMemory: vm.sharedMemory,
             hugepages: vm.hugepages,
@@ -177,7 +186,9 @@ struct VMSpecBuilder {
                 cmdline: vm.cmdline ?? image?.defaultCmdline,
                 firmware: vm.firmwarePath
             ),
-            machine: MachineProfile(secureBoot: vm.secureBoot, tpm: vm.tpmEnabled),
+            machine: MachineProfile(
+                secureBoot: vm.secureBoot, tpm: vm.tpmEnabled, secureBootKeys: vm.secureBoot ? vm.secureBootKeys : nil),
+            cpuModel: vm.cpuModel.flatMap(GuestCPUModel.init(rawValue:)),
             volumes: volumes,
             networks: networkSpecs(
                 from: networkInterfaces, networks: networks,
@@ -188,11 +199,19 @@ struct VMSpecBuilder {
         )
     }
 
-    /// Builds volume specs from attached volumes, sorted by boot order (explicit
-    /// orders first), then device name.
-    static func volumeSpecs(from volumes: [Volume]) -> [VolumeSpec] {
-        let sortedVolumes = volumes.sorted { v1, v2 in
-            switch (v1.bootOrder, v2.bootOrder) {
+    /// Builds volume specs from a VM's attachments, sorted by boot order
+    /// (explicit orders first), then device name. Device name, boot order, and
+    /// read-only are the VM's own — a multi-attach volume may differ in each
+    /// VM holding it. Only settled attachments of attached volumes are
+    /// included; one mid-hot-plug joins the spec once the agent confirms it.
+    /// I/O limits come from each volume's type when it was eager-loaded
+    /// (`.with(\.$typeDefinition)`). A volume whose replica was migrated to
+    /// another agent while attached is attached from that agent's NBD export,
+    /// found through its eager-loaded replicas (`.with(\.$replicas)`); one
+    /// mid-migration stays in the spec on its current disk.
+    static func volumeSpecs(from attachments: [VolumeAttachment], includeQoS: Bool = true) -> [VolumeSpec] {
+        let sortedAttachments = attachments.sorted { a1, a2 in
+            switch (a1.bootOrder, a2.bootOrder) {
             case (let o1?, let o2?):
                 return o1 < o2
             case (nil, _?):
@@ -200,20 +219,31 @@ struct VMSpecBuilder {
             case (_?, nil):
                 return true
             case (nil, nil):
-                return (v1.deviceName ?? "") < (v2.deviceName ?? "")
+                return a1.deviceName < a2.deviceName
             }
         }
 
         var specs: [VolumeSpec] = []
-        for volume in sortedVolumes where volume.status == .attached {
-            guard let storagePath = volume.storagePath else { continue }
+        for attachment in sortedAttachments where attachment.status == .attached {
+            guard let volume = attachment.$volume.value,
+                volume.status == .attached || volume.status == .migrating,
+                let storagePath = volume.storagePath
+            else { continue }
+            // Served over NBD only to a VM on another host: once the VM runs
+            // where the replica is, it opens the file directly.
+            let remote = (volume.$replicas.value ?? []).first {
+                $0.nbdEndpoint != nil && $0.agentId != attachment.agentId
+            }
             specs.append(
                 VolumeSpec(
                     volumeId: volume.id,
-                    deviceName: volume.deviceName ?? "disk\(specs.count)",
+                    deviceName: attachment.deviceName,
                     storagePath: storagePath,
-                    readonly: false,  // Could be enhanced to track readonly per-volume
-                    bootOrder: volume.bootOrder
+                    readonly: attachment.readonly,
+                    bootOrder: attachment.bootOrder,
+                    qos: includeQoS ? volume.$typeDefinition.value??.qos : nil,
+                    shared: volume.multiAttach,
+                    nbd: remote?.nbdEndpoint
                 ))
         }
         return specs
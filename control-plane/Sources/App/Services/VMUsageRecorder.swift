@@ -0,0 +1,61 @@
+import Fluent
+import Foundation
+import StratoShared
+
+/// Folds the CPU and memory usage on observed-state reports into each VM's
+/// hourly history (`vm_usage_samples`), the input rightsizing analyzes.
+///
+/// Reports arrive far more often than rightsizing needs, so a VM is sampled
+/// at most once per `sampleInterval` (tracked by `VM.usageSampledAt`), and
+/// only while running — a stopped VM's zero usage is not evidence that it is
+/// over-provisioned. History older than `retention` is pruned for the VM
+/// whenever a new hour's row is started, so there is no separate sweep.
+enum VMUsageRecorder {
+    static let sampleInterval: TimeInterval = 300
+    /// Comfortably longer than rightsizing's default lookback.
+    static let retention: TimeInterval = 35 * 86_400
+
+    static func record(vm: VM, observed: ObservedVMState, at now: Date = Date(), on db: Database) async throws {
+        guard observed.status == .running else { return }
+        let memoryUsed = observed.memoryStats.map { max($0.totalBytes - $0.availableBytes, 0) }
+        guard observed.cpuUtilization != nil || memoryUsed != nil else { return }
+        if let last = vm.usageSampledAt, now.timeIntervalSince(last) < sampleInterval { return }
+
+        let vmID = try vm.requireID()
+        let hour = hourStart(of: now)
+        let sample: VMUsageSample
+        if let existing = try await VMUsageSample.query(on: db)
+            .filter(\.$vm.$id == vmID)
+            .filter(\.$hour == hour)
+            .first()
+        {
+            sample = existing
+        } else {
+            sample = VMUsageSample(vmID: vmID, hour: hour)
+            try await VMUsageSample.query(on: db)
+                .filter(\.$vm.$id == vmID)
+                .filter(\.$hour < now.addingTimeInterval(-retention))
+                .delete()
+        }
+
+        if let utilization = observed.cpuUtilization {
+            sample.cpuSamples += 1
+            sample.cpuUtilizationSum += utilization
+            sample.cpuUtilizationPeak = max(sample.cpuUtilizationPeak, utilization)
+        }
+        if let memoryUsed {
+            sample.memorySamples += 1
+            sample.memoryUsedSum += memoryUsed
+            sample.memoryUsedPeak = max(sample.memoryUsedPeak, memoryUsed)
+        }
+        try await sample.save(on: db)
+
+        vm.usageSampledAt = now
+        try await vm.save(on: db)
+    }
+
+    /// The start of the UTC hour containing `date`.
+    static func hourStart(of date: Date) -> Date {
+        Date(timeIntervalSince1970: (date.timeIntervalSince1970 / 3600).rounded(.down) * 3600)
+    }
+}
@@ -17,6 +17,11 @@ actor VolumeService {
     /// image-backed create).
     private static let createTimeout: Duration = .seconds(60)
     private static let transferTimeout: Duration = .seconds(600)
+    /// Migration copies: a whole disk streamed through the control plane, or
+    /// a live block mirror. Just above the agent's own mirror budget (6h,
+    /// `StageBudget.volumeMirrorSeconds`), so the agent gives up first and
+    /// reports it rather than leaving the outcome unknown.
+    private static let migrationTimeout: Duration = .seconds(22_200)
 
     init(app: Application) {
         self.app = app
@@ -48,10 +53,12 @@ actor VolumeService {
             }
 
             let pool = try await volume.$pool.get(on: db)
+            let volumeType = try await volume.$typeDefinition.get(on: db)
             let result = try await requestVolumeCreation(
                 volume: volume,
                 sourceImage: sourceImage,
-                memberAgentIds: pool?.memberAgentIds ?? []
+                memberAgentIds: pool?.memberAgentIds ?? [],
+                requiresEncryption: volumeType?.requiresEncryption ?? false
             )
 
             // The agent RPC above can span the drain; bail cleanly before the
@@ -210,14 +217,17 @@ actor VolumeService {
     func requestVolumeCreation(
         volume: Volume,
         sourceImage: Image? = nil,
-        memberAgentIds: [String] = []
+        memberAgentIds: [String] = [],
+        requiresEncryption: Bool = false
     ) async throws -> (agentId: String, storagePath: String?) {
         // In the future, we might want to consider storage locality
         let agentService = app.agentService
 
         let agents = await agentService.getAgentList()
 
-        guard let selectedAgent = Self.selectVolumeAgent(from: agents, memberAgentIds: memberAgentIds),
+        guard
+            let selectedAgent = Self.selectVolumeAgent(
+                from: agents, memberAgentIds: memberAgentIds, requiresEncryption: requiresEncryption),
             let selectedAgentId = selectedAgent.id?.uuidString
         else {
             throw VolumeServiceError.noAgentsAvailable
@@ -269,11 +279,18 @@ actor VolumeService {
     /// QEMU are eligible — a volume placed on a Firecracker-only agent could
     /// never be attached. A pool with an explicit member list further
     /// restricts candidates to those members; an empty list (the default
-    /// local pool) leaves all agents eligible.
-    static func selectVolumeAgent(from agents: [Agent], memberAgentIds: [String] = []) -> Agent? {
+    /// local pool) leaves all agents eligible. A volume type that requires
+    /// encryption further restricts them to agents advertising encrypted
+    /// volume storage.
+    static func selectVolumeAgent(
+        from agents: [Agent],
+        memberAgentIds: [String] = [],
+        requiresEncryption: Bool = false
+    ) -> Agent? {
         agents.first {
             $0.status == .online && $0.supportedHypervisors.contains(.qemu)
                 && (memberAgentIds.isEmpty || memberAgentIds.contains($0.id?.uuidString ?? ""))
+                && (!requiresEncryption || $0.capabilities.contains(StorageCapability.encryptedVolumeStorage))
         }
     }
 
@@ -310,11 +327,14 @@ actor VolumeService {
     // MARK: - Volume Attachment
 
     /// Request an agent to attach a volume to a VM and await its confirmation.
+    /// A multi-attach volume is plugged shared (`share-rw`), whether or not
+    /// another VM holds it yet, so a later holder never trips this one's lock.
     func requestVolumeAttachment(
         volume: Volume,
         vm: VM,
         deviceName: String,
-        readonly: Bool = false
+        readonly: Bool = false,
+        qos: VolumeQoS? = nil
     ) async throws {
         guard let hypervisorId = vm.hypervisorId else {
             throw VolumeServiceError.vmNotScheduled
@@ -329,12 +349,30 @@ actor VolumeService {
             throw VolumeServiceError.volumeNotOnAgent
         }
 
+        // A pre-v21 agent decodes the attach, ignores `qos`, and plugs the
+        // disk unthrottled; refuse rather than report limits nothing enforces.
+        if qos != nil, let agentInfo = await app.agentService.getAgentInfo(hypervisorId),
+            !WireProtocol.supportsVolumeQoS(agentInfo.wireProtocolVersion ?? 0)
+        {
+            throw VolumeServiceError.operationUnsupportedByAgent("volume I/O limits", hypervisorId)
+        }
+
+        // Likewise a pre-v22 agent would plug a multi-attach volume with an
+        // exclusive lock, which the next VM to attach it trips over.
+        if volume.multiAttach, let agentInfo = await app.agentService.getAgentInfo(hypervisorId),
+            !WireProtocol.supportsSharedVolumes(agentInfo.wireProtocolVersion ?? 0)
+        {
+            throw VolumeServiceError.operationUnsupportedByAgent("multi-attach volumes", hypervisorId)
+        }
+
         let message = VolumeAttachMessage(
             vmId: vm.id!.uuidString,
             volumeId: volume.id!.uuidString,
             volumePath: volumePath,
             deviceName: deviceName,
-            readonly: readonly
+            readonly: readonly,
+            qos: qos,
+            shared: volume.multiAttach
         )
 
         _ = try await sendVolumeRequest(message, toAgent: hypervisorId)
@@ -349,16 +387,14 @@ actor VolumeService {
             ])
     }
 
-    /// Request an agent to detach a volume from a VM and await its confirmation.
-    func requestVolumeDetachment(volume: Volume, vm: VM) async throws {
+    /// Request an agent to detach a volume from a VM and await its
+    /// confirmation. `deviceName` is the VM's own attachment's: a
+    /// multi-attach volume may sit under a different name in each VM.
+    func requestVolumeDetachment(volume: Volume, vm: VM, deviceName: String) async throws {
         guard let hypervisorId = vm.hypervisorId else {
             throw VolumeServiceError.vmNotScheduled
         }
 
-        guard let deviceName = volume.deviceName else {
-            throw VolumeServiceError.volumeNotAttached
-        }
-
         let message = VolumeDetachMessage(
             vmId: vm.id!.uuidString,
             volumeId: volume.id!.uuidString,
@@ -416,11 +452,19 @@ actor VolumeService {
         // Name the attached VM so the agent can fs-freeze that guest around the
         // overlay for an application-consistent snapshot (issue #563). Nil when
         // the volume is detached — the agent then takes a crash-consistent one.
+        // Also nil when several VMs share it: freezing one guest while others
+        // keep writing buys no consistency.
+        var holders = 0
+        if let db = app.liveDB {
+            holders = try await VolumeAttachment.query(on: db)
+                .filter(\.$volume.$id == volume.requireID())
+                .count()
+        }
         let message = VolumeSnapshotMessage(
             volumeId: volume.id!.uuidString,
             snapshotId: snapshot.id!.uuidString,
             volumePath: volumePath,
-            attachedVMId: volume.$vm.id?.uuidString
+            attachedVMId: holders > 1 ? nil : volume.$vm.id?.uuidString
         )
 
         let status = try await sendVolumeRequest(message, toAgent: hypervisorId, timeout: Self.snapshotTimeout)
@@ -436,6 +480,83 @@ actor VolumeService {
         return status?.storagePath
     }
 
+    /// Snapshot `volume` end to end: record the snapshot, grant `owner` admin
+    /// on it in the same transaction (issue #477), take it on the hypervisor,
+    /// and return it `.available`. The volume is `.snapshotting` meanwhile and
+    /// gets its status back either way. Shared by the snapshot endpoint and
+    /// automation rules, whose owner is the rule's service account.
+    nonisolated func takeSnapshot(
+        of volume: Volume,
+        name: String,
+        description: String,
+        createdByID: UUID,
+        owner: (type: IAMPrincipalType, id: UUID),
+        on db: Database
+    ) async throws -> VolumeSnapshot {
+        guard volume.canSnapshot else {
+            throw Abort(
+                .conflict,
+                reason:
+                    "Volume cannot be snapshotted in status '\(volume.status.rawValue)'. Must be 'available' or 'attached'"
+            )
+        }
+
+        guard volume.hypervisorId != nil, volume.storagePath != nil else {
+            throw Abort(.conflict, reason: "Volume is not provisioned on any hypervisor")
+        }
+
+        let previousStatus = volume.status
+        volume.status = .snapshotting
+        try await volume.save(on: db)
+
+        let snapshot = VolumeSnapshot(
+            name: name,
+            description: description,
+            volumeID: try volume.requireID(),
+            projectID: volume.$project.id,
+            size: volume.size,
+            status: .creating,
+            createdByID: createdByID
+        )
+
+        do {
+            try await db.transaction { db in
+                try await snapshot.save(on: db)
+                try await RoleBindingService.grant(
+                    principalType: owner.type,
+                    principalID: owner.id,
+                    role: .admin,
+                    nodeType: .volumeSnapshot,
+                    nodeID: snapshot.requireID(),
+                    createdBy: createdByID,
+                    on: db
+                )
+            }
+        } catch {
+            volume.status = previousStatus
+            try await volume.save(on: db)
+            throw error
+        }
+
+        // The agent reports the actual snapshot storage path.
+        do {
+            snapshot.storagePath = try await requestVolumeSnapshot(volume: volume, snapshot: snapshot)
+            snapshot.status = .available
+            try await snapshot.save(on: db)
+        } catch {
+            snapshot.status = .error
+            snapshot.errorMessage = error.localizedDescription
+            try await snapshot.save(on: db)
+            volume.status = previousStatus
+            try await volume.save(on: db)
+            throw Abort(.badGateway, reason: "Failed to create snapshot on hypervisor: \(error.localizedDescription)")
+        }
+
+        volume.status = previousStatus
+        try await volume.save(on: db)
+        return snapshot
+    }
+
     /// Request an agent to delete a volume snapshot from storage and await
     /// its confirmation. The message carries only IDs — the agent derives the
     /// file's location the same way it did at creation — so this also cleans
@@ -518,6 +639,314 @@ actor VolumeService {
         return status?.storagePath
     }
 
+    // MARK: - Volume Migration
+
+    /// Run an accepted migration (`VolumeMigration`, `.running`; the volume in
+    /// `.migrating`) to completion. Intended to run detached from the
+    /// request, like `provisionVolume`. On success the volume's replica
+    /// records name the target agent and it returns to its resting status;
+    /// on failure it returns there unmoved, or — when a live mirror's outcome
+    /// is unknown — to `.error`.
+    func performMigration(migrationId: UUID) async {
+        // Registered with the drain registry: bail if shutdown already
+        // cancelled us, and reuse the captured handle (see `Application.liveDB`).
+        guard let db = app.liveDB else { return }
+        guard let migration = try? await VolumeMigration.find(migrationId, on: db),
+            let volume = try? await Volume.find(migration.$volume.id, on: db)
+        else {
+            logger.warning(
+                "Volume disappeared before migration started",
+                metadata: ["migrationId": .string(migrationId.uuidString)])
+            return
+        }
+
+        if migration.sourceAgentId == migration.targetAgentId {
+            await performPoolSwitch(migration, volume: volume, on: db)
+        } else {
+            switch migration.mode {
+            case .copy:
+                await performCopyMigration(migration, volume: volume, on: db)
+            case .mirror:
+                await performMirrorMigration(migration, volume: volume, on: db)
+            }
+        }
+    }
+
+    /// The target agent already holds the bytes and is a member of the
+    /// target pool: nothing moves, only the pool and type change.
+    private func performPoolSwitch(_ migration: VolumeMigration, volume: Volume, on db: Database) async {
+        do {
+            try await completeMigration(
+                migration, volume: volume, replica: nil, format: nil,
+                restingStatus: volume.$vm.id != nil ? .attached : .available, on: db)
+        } catch {
+            await failMigration(
+                migration, volumeId: volume.id!, volumeStatus: volume.$vm.id != nil ? .attached : .available,
+                error: error, on: db)
+        }
+    }
+
+    /// Detached volume: the source agent streams its disk file up to the
+    /// migration's data route, the target agent downloads and verifies it
+    /// against the size and SHA-256 the route recorded, and the replica
+    /// records switch. The source copy is untouched until then, so every
+    /// failure leaves the volume whole where it was.
+    private func performCopyMigration(_ migration: VolumeMigration, volume: Volume, on db: Database) async {
+        let volumeId = volume.id!
+        let migrationId = migration.id!
+        let transferPath = VolumeMigration.dataTransferPath(volumeId: volumeId, migrationId: migrationId)
+        var importSent = false
+        do {
+            guard let (sourceAgentId, path) = try await placement(of: volume), let sourcePath = path else {
+                throw VolumeServiceError.volumeNotOnAgent
+            }
+
+            _ = try await sendVolumeRequest(
+                VolumeExportMessage(volumeId: volumeId.uuidString, volumePath: sourcePath, uploadURL: transferPath),
+                toAgent: sourceAgentId, timeout: Self.migrationTimeout)
+            // The agent RPC above can span the drain; bail cleanly before the
+            // next step rather than issue doomed queries during shutdown.
+            guard !Task.isCancelled else { return }
+
+            // What the data route recorded as the bytes landed is the ground
+            // truth, not the agent's success.
+            guard let recorded = try await VolumeMigration.find(migrationId, on: db),
+                let sizeBytes = recorded.sizeBytes, let sha256 = recorded.sha256
+            else {
+                throw VolumeServiceError.agentOperationFailed(
+                    "Source agent reported the export complete but no upload was recorded", nil)
+            }
+
+            importSent = true
+            let status = try await sendVolumeRequest(
+                VolumeImportMessage(
+                    volumeId: volumeId.uuidString, format: volume.format.rawValue, downloadURL: transferPath,
+                    sizeBytes: sizeBytes, sha256: sha256),
+                toAgent: migration.targetAgentId, timeout: Self.migrationTimeout)
+            guard !Task.isCancelled else { return }
+
+            try await completeMigration(
+                migration, volume: volume, replica: (status?.storagePath, nil), format: nil,
+                restingStatus: .available, on: db)
+            await discardCopy(volumeId: volumeId, onAgent: sourceAgentId)
+        } catch {
+            // Nothing references the target's copy yet; a partial import
+            // would only be overwritten by the next attempt, but don't leave
+            // a volume's worth of bytes behind on an agent that doesn't own it.
+            if importSent {
+                await discardCopy(volumeId: volumeId, onAgent: migration.targetAgentId)
+            }
+            await failMigration(migration, volumeId: volumeId, volumeStatus: .available, error: error, on: db)
+        }
+
+        do {
+            try await app.imageObjectStore.delete(
+                key: VolumeMigration.objectKey(volumeId: volumeId, migrationId: migrationId))
+        } catch {
+            logger.warning(
+                "Failed to delete volume migration transfer object",
+                metadata: [
+                    "volumeId": .string(volumeId.uuidString),
+                    "migrationId": .string(migrationId.uuidString),
+                    "error": .string(error.localizedDescription),
+                ])
+        }
+    }
+
+    /// Attached volume: the target agent creates a blank raw volume and
+    /// serves it over NBD, the VM's agent mirrors the running guest's disk
+    /// onto it and pivots, and the replica records switch to the target with
+    /// the NBD endpoint the VM now runs on. The VM itself does not move.
+    private func performMirrorMigration(_ migration: VolumeMigration, volume: Volume, on db: Database) async {
+        let volumeId = volume.id!
+        // Where the guest's disk is. Until the mirror is sent it is
+        // certainly the original; once the VM's agent answers with an error
+        // the job was cancelled and it still is. Only a lost answer — or a
+        // failure after the pivot — leaves it unknown (or on the target).
+        var guestOnSource = true
+        var exported = false
+        do {
+            guard let vmId = volume.$vm.id, let vm = try await VM.find(vmId, on: db),
+                let vmAgentId = vm.hypervisorId
+            else {
+                throw VolumeServiceError.vmNotScheduled
+            }
+            guard let current = try await VolumeReplica.query(on: db)
+                .filter(\.$volume.$id == volumeId)
+                .sort(\.$createdAt)
+                .first()
+            else {
+                throw VolumeServiceError.volumeNotOnAgent
+            }
+            // The disk as QEMU opened it: a local file, or the NBD export of
+            // an earlier migration.
+            let guestPath: String
+            if let endpoint = current.nbdEndpoint, current.agentId != vmAgentId {
+                guestPath = endpoint.uri
+            } else if let path = current.datasetPath ?? volume.storagePath {
+                guestPath = path
+            } else {
+                throw VolumeServiceError.volumeNotOnAgent
+            }
+
+            exported = true
+            let data = try await sendVolumeMessage(
+                VolumeNBDExportMessage(volumeId: volumeId.uuidString, size: volume.size),
+                toAgent: migration.targetAgentId, timeout: Self.createTimeout)
+            guard let export = try? data?.decode(as: VolumeNBDExportResponse.self) else {
+                throw VolumeServiceError.agentOperationFailed("Target agent returned no NBD endpoint", nil)
+            }
+
+            do {
+                _ = try await sendVolumeRequest(
+                    VolumeMirrorMessage(
+                        vmId: vmId.uuidString, volumeId: volumeId.uuidString, volumePath: guestPath,
+                        target: export.endpoint),
+                    toAgent: vmAgentId, timeout: Self.migrationTimeout)
+            } catch let error as VolumeServiceError {
+                // Refused before sending, or answered with a failure: the
+                // agent cancels the job, so the guest never left its disk.
+                throw error
+            } catch {
+                // No answer: the pivot may have happened.
+                guestOnSource = false
+                throw error
+            }
+            guestOnSource = false
+            guard !Task.isCancelled else { return }
+
+            // The target serves a raw file whatever the source's format was:
+            // the mirror copies what the guest sees, not the qcow2 container.
+            try await completeMigration(
+                migration, volume: volume, replica: (export.storagePath, export.endpoint), format: .raw,
+                restingStatus: .attached, on: db)
+            await discardCopy(volumeId: volumeId, onAgent: current.agentId)
+        } catch {
+            if guestOnSource {
+                if exported {
+                    await discardCopy(volumeId: volumeId, onAgent: migration.targetAgentId)
+                }
+                await failMigration(migration, volumeId: volumeId, volumeStatus: .attached, error: error, on: db)
+            } else {
+                // Both copies are kept: the guest may be writing either.
+                await failMigration(migration, volumeId: volumeId, volumeStatus: .error, error: error, on: db)
+            }
+        }
+    }
+
+    /// Switch the volume onto the migration's target in one transaction:
+    /// replica records (when `replica` is given — a pool switch keeps the
+    /// existing one), the legacy placement columns, pool and type, status,
+    /// and the migration row.
+    private func completeMigration(
+        _ migration: VolumeMigration,
+        volume: Volume,
+        replica: (path: String?, nbd: NBDExportEndpoint?)?,
+        format: VolumeFormat?,
+        restingStatus: VolumeStatus,
+        on db: Database
+    ) async throws {
+        let volumeId = volume.id!
+        try await db.transaction { tx in
+            if let replica {
+                // A local-pool volume has one replica, and it is now the
+                // target's. Delete-then-create so the per-agent unique holds.
+                try await VolumeReplica.query(on: tx)
+                    .filter(\.$volume.$id == volumeId)
+                    .delete()
+                let record = VolumeReplica(
+                    volumeID: volumeId, agentId: migration.targetAgentId, datasetPath: replica.path,
+                    state: .healthy)
+                record.nbdEndpoint = replica.nbd
+                try await record.create(on: tx)
+                volume.hypervisorId = migration.targetAgentId
+                volume.storagePath = replica.path
+            }
+            if let format {
+                volume.format = format
+            }
+            if let poolId = migration.targetPoolId {
+                volume.$pool.id = poolId
+            }
+            if let volumeTypeId = migration.targetVolumeTypeId {
+                volume.$typeDefinition.id = volumeTypeId
+            }
+            volume.status = restingStatus
+            volume.errorMessage = nil
+            try await volume.save(on: tx)
+
+            migration.status = .succeeded
+            migration.completedAt = Date()
+            try await migration.save(on: tx)
+        }
+
+        logger.info(
+            "Volume migrated",
+            metadata: [
+                "volumeId": .string(volumeId.uuidString),
+                "migrationId": .string(migration.id!.uuidString),
+                "sourceAgentId": .string(migration.sourceAgentId),
+                "targetAgentId": .string(migration.targetAgentId),
+                "mode": .string(migration.mode.rawValue),
+            ])
+    }
+
+    private func failMigration(
+        _ migration: VolumeMigration, volumeId: UUID, volumeStatus: VolumeStatus, error: Error, on db: Database
+    ) async {
+        logger.error(
+            "Volume migration failed",
+            metadata: [
+                "volumeId": .string(volumeId.uuidString),
+                "migrationId": .string(migration.id?.uuidString ?? ""),
+                "error": .string(error.localizedDescription),
+            ])
+        // Skip the write-back if shutdown cancelled us; the sweep recovers
+        // the volume instead (see `Application.liveDB`).
+        guard !Task.isCancelled else { return }
+        do {
+            try await db.transaction { tx in
+                if let volume = try await Volume.find(volumeId, on: tx) {
+                    volume.status = volumeStatus
+                    if volumeStatus == .error {
+                        volume.errorMessage =
+                            "Volume migration failed and the guest may be on either copy: "
+                            + error.localizedDescription
+                    }
+                    try await volume.save(on: tx)
+                }
+                migration.status = .failed
+                migration.errorMessage = error.localizedDescription
+                migration.completedAt = Date()
+                try await migration.save(on: tx)
+            }
+        } catch {
+            logger.error(
+                "Failed to record volume migration failure",
+                metadata: [
+                    "volumeId": .string(volumeId.uuidString),
+                    "error": .string(error.localizedDescription),
+                ])
+        }
+    }
+
+    /// Best-effort removal of a copy no replica record points at any more
+    /// (the agent's delete also stops any NBD export of it). A failure leaves
+    /// an orphaned directory on that agent, which is logged, not fatal.
+    private func discardCopy(volumeId: UUID, onAgent agentId: String) async {
+        do {
+            _ = try await sendVolumeRequest(VolumeDeleteMessage(volumeId: volumeId.uuidString), toAgent: agentId)
+        } catch {
+            logger.warning(
+                "Failed to remove volume copy left behind by migration",
+                metadata: [
+                    "volumeId": .string(volumeId.uuidString),
+                    "agentId": .string(agentId),
+                    "error": .string(error.localizedDescription),
+                ])
+        }
+    }
+
     // MARK: - Private Helpers
 
     /// Send a volume message to an agent and await the correlated
@@ -528,6 +957,17 @@ actor VolumeService {
         toAgent agentId: String,
         timeout: Duration = VolumeService.defaultTimeout
     ) async throws -> VolumeStatusResponse? {
+        let data = try await sendVolumeMessage(message, toAgent: agentId, timeout: timeout)
+        return try? data?.decode(as: VolumeStatusResponse.self)
+    }
+
+    /// `sendVolumeRequest` for replies that are not a `VolumeStatusResponse`:
+    /// returns the success payload undecoded.
+    private func sendVolumeMessage<T: WebSocketMessage>(
+        _ message: T,
+        toAgent agentId: String,
+        timeout: Duration = VolumeService.defaultTimeout
+    ) async throws -> AnyCodableValue? {
         let agentService = app.agentService
 
         guard let agentInfo = await agentService.getAgentInfo(agentId) else {
@@ -553,7 +993,7 @@ actor VolumeService {
 
         switch response {
         case .success(let data):
-            return try? data?.decode(as: VolumeStatusResponse.self)
+            return data
         case .error(let error, let details):
             throw VolumeServiceError.agentOperationFailed(error, details)
         }
@@ -0,0 +1,72 @@
+import Fluent
+import Foundation
+import SQLKit
+import Vapor
+
+/// Enforces per-project volume-type quotas (`VolumeTypeQuota`). Unlike
+/// `QuotaEnforcementService` there are no reservation counters: volumes of a
+/// type are a small, indexed set per project, so admission counts them
+/// directly under a transaction-scoped advisory lock keyed on the
+/// (type, project) pair.
+struct VolumeTypeQuotaService {
+
+    /// Current usage of `volumeTypeID` by `projectID`: the number of volumes
+    /// and their total provisioned bytes. Volumes being deleted still hold
+    /// their storage until the agent confirms, so they count.
+    static func usage(
+        volumeTypeID: UUID,
+        projectID: UUID,
+        on db: Database
+    ) async throws -> (volumes: Int, bytes: Int64) {
+        let volumes = try await Volume.query(on: db)
+            .filter(\.$typeDefinition.$id == volumeTypeID)
+            .filter(\.$project.$id == projectID)
+            .all()
+        let bytes = volumes.reduce(Int64(0)) { total, volume in
+            let (sum, overflow) = total.addingReportingOverflow(volume.size)
+            return overflow ? .max : sum
+        }
+        return (volumes.count, bytes)
+    }
+
+    /// Rejects (403, like `QuotaEnforcementService`) adding `addingBytes` —
+    /// and, when `addingVolume`, one more volume — of `volumeTypeID` to
+    /// `projectID`. Call inside the transaction that writes the volume so
+    /// the lock covers the check and the write; a project with no quota row
+    /// for the type is unlimited.
+    static func check(
+        volumeTypeID: UUID,
+        projectID: UUID,
+        addingVolume: Bool,
+        addingBytes: Int64,
+        on db: Database
+    ) async throws {
+        try await lock(volumeTypeID: volumeTypeID, projectID: projectID, on: db)
+
+        guard
+            let quota = try await VolumeTypeQuota.query(on: db)
+                .filter(\.$volumeType.$id == volumeTypeID)
+                .filter(\.$project.$id == projectID)
+                .first()
+        else { return }
+
+        let current = try await usage(volumeTypeID: volumeTypeID, projectID: projectID, on: db)
+        if let reason = quota.exceededReason(
+            currentVolumes: current.volumes,
+            currentBytes: current.bytes,
+            addingVolume: addingVolume,
+            addingBytes: addingBytes
+        ) {
+            let typeName = try await VolumeTypeDefinition.find(volumeTypeID, on: db)?.name ?? volumeTypeID.uuidString
+            throw Abort(.forbidden, reason: "Quota for volume type '\(typeName)' exceeded: \(reason)")
+        }
+    }
+
+    /// Postgres-only transaction-scoped lock, as in
+    /// `QuotaEnforcementService.lockQuotas`; a no-op on SQLite.
+    private static func lock(volumeTypeID: UUID, projectID: UUID, on db: Database) async throws {
+        guard let sql = db as? SQLDatabase, sql.dialect.name == "postgresql" else { return }
+        let key = "volume-type-quota:\(volumeTypeID.uuidString):\(projectID.uuidString)"
+        try await sql.raw("SELECT pg_advisory_xact_lock(hashtext(\(bind: key)))").run()
+    }
+}
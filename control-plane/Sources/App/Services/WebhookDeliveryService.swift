@@ -248,9 +248,6 @@ final class WebhookDeliveryService: @unchecked Sendable {
         guard let url = URL(string: subscription.url) else {
             throw SSRFGuard.BlockedHostError(reason: "Webhook URL is not a valid URL")
         }
-        let approvedAddresses = try await SSRFGuard.validate(
-            url: url, environment: app.environment, on: app.threadPool)
-
         let secret = try app.secretsEncryption.decrypt(subscription.signingSecret)
         let timestamp = Int(Date().timeIntervalSince1970)
         let signature = Self.signature(
@@ -267,37 +264,11 @@ final class WebhookDeliveryService: @unchecked Sendable {
             name: "X-Strato-Delivery-Id", value: delivery.id?.uuidString ?? "")
         request.body = .bytes(ByteBuffer(string: delivery.payload))
 
-        // Pin the connection to an address the guard approved (its documented
-        // rebind gap): the shared client would re-resolve the name at connect
-        // time, and a low-TTL record could point it at an internal address
-        // between validation and connect. `approvedAddresses` is empty when
-        // private hosts are allowed (testing/dev) — then the shared client is
-        // fine. TLS certificate validation still runs against the hostname;
-        // only resolution is overridden.
-        guard let host = url.host, let pinnedAddress = approvedAddresses.first else {
-            let response = try await app.http.client.shared.execute(
-                request, timeout: .seconds(Self.requestTimeoutSeconds))
-            return Int(response.status.code)
-        }
-
-        var configuration = HTTPClient.Configuration()
-        // The shared client disallows redirects globally (configure.swift); a
-        // transient client must not silently reintroduce redirect-following,
-        // which would defeat the SSRF validation of the final destination.
-        configuration.redirectConfiguration = .disallow
-        configuration.dnsOverride = [host: pinnedAddress]
-        let client = HTTPClient(
-            eventLoopGroupProvider: .shared(app.eventLoopGroup),
-            configuration: configuration)
-        do {
-            let response = try await client.execute(
-                request, timeout: .seconds(Self.requestTimeoutSeconds))
-            try await client.shutdown()
-            return Int(response.status.code)
-        } catch {
-            try? await client.shutdown()
-            throw error
-        }
+        // `execute` pins the connection to an address the guard approved
+        // (its documented rebind gap).
+        let response = try await SSRFGuard.execute(
+            request, url: url, timeout: .seconds(Self.requestTimeoutSeconds), app: app)
+        return Int(response.status.code)
     }
 
     /// HMAC-SHA256 over `"<timestamp>.<payload>"`, hex-encoded — the `v1`
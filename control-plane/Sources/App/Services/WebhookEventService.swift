@@ -17,11 +17,18 @@ enum WebhookEventType: String, Codable, CaseIterable, Sendable {
     case operationFailed = "operation.failed"
     /// A VM's observed status changed (agent reports, drift, loss).
     case vmStateChanged = "vm.state_changed"
+    /// A VM's application health check turned it healthy or unhealthy.
+    case vmHealthChanged = "vm.health_changed"
     case agentConnected = "agent.connected"
     case agentDisconnected = "agent.disconnected"
     /// A quota pool crossed a warning (80%) or exhaustion (100%) threshold
     /// while admitting a workload.
     case quotaThresholdExceeded = "quota.threshold_exceeded"
+    /// Disruptive work affecting a project's VMs was scheduled into its
+    /// maintenance window; sent `noticeHours` ahead.
+    case maintenanceScheduled = "maintenance.scheduled"
+    /// An automation rule's `notify` action ran.
+    case automationNotification = "automation.notification"
     /// Manual "send test event" deliveries. Not subscribable: it is enqueued
     /// directly for the target subscription, bypassing its type selection.
     case webhookTest = "webhook.test"
@@ -118,9 +125,16 @@ struct QuotaUsageSnapshot: Sendable {
 /// variant for call sites outside any transaction, where a webhook bookkeeping
 /// failure must never break the main path.
 enum WebhookEvents {
-    /// Fan the event out to every matching active subscription. Throws on
-    /// database errors so transactional callers stay atomic.
+    /// Fan the event out to every matching active subscription, record it
+    /// for GraphQL subscribers (`ResourceEventStream`), and queue the runs of
+    /// the automation rules it triggers. Throws on database errors so
+    /// transactional callers stay atomic.
     static func enqueue(_ event: WebhookEvent, on db: Database) async throws {
+        if event.type != .webhookTest {
+            try await ResourceEvent(event).save(on: db)
+            try await AutomationRules.enqueueRuns(for: event, on: db)
+        }
+
         let subscriptions = try await WebhookSubscription.query(on: db)
             .filter(\.$organization.$id == event.organizationID)
             .filter(\.$isActive == true)
@@ -227,6 +241,10 @@ enum WebhookEvents {
             guard let sandbox = try await Sandbox.find(id, on: db) else { return nil }
             projectID = sandbox.$project.id
             name = sandbox.name
+        case .fileShare:
+            guard let share = try await FileShare.find(id, on: db) else { return nil }
+            projectID = share.$project.id
+            name = share.name
         }
         guard let projectID,
             let project = try await Project.find(projectID, on: db),
@@ -261,6 +279,35 @@ enum WebhookEvents {
         await emit(event, on: db, logger: logger)
     }
 
+    /// Enqueue `vm.health_changed` for a health-check verdict change.
+    /// `action` is the policy the transition triggered (`reboot`, `replace`),
+    /// nil when it triggered none. Fire-and-forget, like `emitVMStateChanged`.
+    static func emitVMHealthChanged(
+        vm: VM, previous: String?, current: VMHealthObservation, action: String?, on db: Database,
+        logger: Logger
+    ) async {
+        guard let vmID = vm.id else { return }
+        guard let project = try? await Project.find(vm.$project.id, on: db),
+            let organizationID = try? await project.getRootOrganizationId(on: db)
+        else { return }
+
+        var data: [String: CodableValue] = [
+            "newStatus": .string(current.status.rawValue),
+            "consecutiveFailures": .int(current.consecutiveFailures),
+        ]
+        if let previous { data["previousStatus"] = .string(previous) }
+        if let message = current.message { data["message"] = .string(message) }
+        if let action { data["action"] = .string(action) }
+        let event = WebhookEvent(
+            type: .vmHealthChanged,
+            organizationID: organizationID,
+            projectID: vm.$project.id,
+            resource: WebhookEvent.Resource(
+                kind: OperationResourceKind.virtualMachine.rawValue, id: vmID, name: vm.name),
+            data: data)
+        await emit(event, on: db, logger: logger)
+    }
+
     // MARK: - Quota thresholds
 
     /// Warning and exhaustion levels, in percent of a quota pool.
@@ -331,4 +378,32 @@ enum WebhookEvents {
             data: ["reason": .string(reason)])
         await emit(event, on: db, logger: logger)
     }
+
+    // MARK: - Maintenance windows
+
+    /// Enqueue `maintenance.scheduled` for a just-created notice, in the
+    /// notice's transaction so the announcement and the schedule it
+    /// promises commit together.
+    static func enqueueMaintenanceScheduled(
+        notice: MaintenanceNotice, project: Project, agent: Agent, on db: Database
+    ) async throws {
+        guard let agentID = agent.id,
+            let organizationID = try await project.getRootOrganizationId(on: db)
+        else { return }
+
+        let formatter = ISO8601DateFormatter()
+        let event = WebhookEvent(
+            type: .maintenanceScheduled,
+            organizationID: organizationID,
+            projectID: project.id,
+            resource: WebhookEvent.Resource(kind: "agent", id: agentID, name: agent.name),
+            data: [
+                "noticeId": .string(notice.id?.uuidString ?? ""),
+                "action": .string(notice.action),
+                "subject": .string(notice.subject),
+                "summary": .string(notice.summary),
+                "scheduledFor": .string(formatter.string(from: notice.scheduledFor)),
+            ])
+        try await enqueue(event, on: db)
+    }
 }
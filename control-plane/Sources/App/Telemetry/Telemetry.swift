@@ -99,6 +99,12 @@ enum Telemetry {
         Counter(label: "strato_vm_drift_total").increment()
     }
 
+    /// A VM's health check turned it unhealthy and its policy started an
+    /// operation (`action`: `reboot` or `replace`).
+    static func vmHealthRemediated(action: String) {
+        Counter(label: "strato_vm_health_remediations_total", dimensions: [("action", action)]).increment()
+    }
+
     // MARK: - HTTP request layer
 
     /// RED metrics for the whole API surface, emitted once per request by
@@ -119,6 +125,17 @@ enum Telemetry {
         ).recordSeconds(durationSeconds)
     }
 
+    /// An authenticated request made in a deprecated API version. `client`
+    /// is the caller's User-Agent product (`strato-cli`,
+    /// `terraform-provider-strato`, `unknown`); which credential made it is
+    /// in `GET /api/api-versions/usage`, kept out of the labels.
+    static func recordDeprecatedAPIRequest(version: Int, client: String) {
+        Counter(
+            label: "strato_api_deprecated_requests_total",
+            dimensions: [("version", String(version)), ("client", client)]
+        ).increment()
+    }
+
     // MARK: - Scheduler / placement
 
     /// A placement decision resolved. `outcome` is `success` (an agent was
@@ -76,6 +76,14 @@ public func configure(_ app: Application) async throws {
     app.middleware.use(TracingMiddleware())
     app.middleware.use(MetricsMiddleware())
 
+    // API versioning: `/api/v<N>/…` is served by the unversioned routes (the
+    // path responder strips the segment before routing), and the middleware
+    // resolves the version from the path or `Strato-API-Version`, stamps the
+    // response, and counts deprecated-version use. Ahead of the
+    // authenticators, so it sees the caller once the chain returns.
+    app.responder.use { app in APIVersionPathResponder(base: app.responder.default) }
+    app.middleware.use(APIVersionMiddleware())
+
     // Whether browsers reach us over HTTPS. This can't be inferred from the Vapor
     // environment: the published image, single-host compose, and Helm chart all
     // run `--env production` yet default to serving plaintext HTTP (TLS, when
@@ -642,6 +650,103 @@ public func configure(_ app: Application) async throws {
     // materialized path instead of scanning for a contained uuid (issue #692).
     app.migrations.add(AddFolderPathIndex())
 
+    // Volume types: admin-defined storage classes backed by a pool, with
+    // per-project allowances, and the volume's reference to its type.
+    app.migrations.add(CreateVolumeType())
+    app.migrations.add(AddVolumeTypeToVolume())
+    // CHECK-guard the new default_format column (EnforcePersistedEnumValues
+    // had already run when the table was added).
+    app.migrations.add(EnforceVolumeTypeFormatEnum())
+
+    // Multi-attach volumes: the per-volume flag and per-VM attachment rows,
+    // backfilled from the single-attachment columns.
+    app.migrations.add(AddMultiAttachToVolume())
+    app.migrations.add(CreateVolumeAttachment())
+    app.migrations.add(EnforceVolumeAttachmentStatusEnum())
+
+    // Volume migration between agents and pools: the `migrating` status (and
+    // the sweep's partial index over it), NBD-served replicas, and the
+    // per-volume migration history.
+    app.migrations.add(AddMigratingVolumeStatus())
+    app.migrations.add(AddNBDExportToVolumeReplica())
+    app.migrations.add(CreateVolumeMigration())
+    app.migrations.add(EnforceVolumeMigrationEnums())
+
+    // Managed NFS file shares and their snapshots; `file_share` joins the
+    // operation resource kinds.
+    app.migrations.add(CreateFileShare())
+    app.migrations.add(CreateFileShareSnapshot())
+    app.migrations.add(EnforceFileShareEnums())
+
+    // S3-compatible object storage: buckets and the access keys that sign
+    // requests to the gateways.
+    app.migrations.add(CreateBucket())
+    app.migrations.add(CreateObjectStorageAccessKey())
+    app.migrations.add(EnforceBucketEnums())
+
+    // Memory overcommit: the per-agent policy and committed-memory report,
+    // and per-VM reclaim floors.
+    app.migrations.add(AddMemoryOvercommitToAgent())
+    app.migrations.add(AddMemoryFloorToVM())
+
+    // Rightsizing: hourly CPU/memory usage history per VM.
+    app.migrations.add(CreateVMUsageSamples())
+    app.migrations.add(AddUsageSampledAtToVM())
+
+    // Guest CPU models: per-VM model and per-site default.
+    app.migrations.add(AddCPUModels())
+
+    // Custom Secure Boot keys: org/project key sets and each VM's copy.
+    app.migrations.add(CreateSecureBootKeySets())
+
+    // Project maintenance windows and the notices sent ahead of gated work.
+    app.migrations.add(AddMaintenanceWindows())
+
+    // Per-project address reservations on logical networks.
+    app.migrations.add(CreateIPReservations())
+
+    // IPv6-only logical networks (no IPv4 subnet).
+    app.migrations.add(AllowIPv6OnlyNetworks())
+
+    // Bring-your-own IP prefixes and the floating-IP pools made from them.
+    app.migrations.add(CreateBYOIPPrefixes())
+
+    // Application health checks on VMs and the actions they trigger.
+    app.migrations.add(AddVMHealthChecks())
+
+    // External admission webhooks reviewing creates and operations.
+    app.migrations.add(CreateAdmissionWebhooks())
+
+    // The event log GraphQL subscriptions tail.
+    app.migrations.add(CreateResourceEvents())
+
+    // Event-driven automation rules, and the VM tags their actions set.
+    app.migrations.add(AddVMTags())
+    app.migrations.add(CreateAutomationRules())
+
+    // SSH keys users register for the SSH console gateway.
+    app.migrations.add(CreateUserSSHKeys())
+
+    // Code-interpreter sessions, one per backing sandbox.
+    app.migrations.add(CreateCodeSessions())
+
+    // Email domains organizations verify through DNS, for sign-in auto-join.
+    app.migrations.add(CreateOrganizationDomains())
+
+    // Who acted on each audit event, the audit query language's indexes, and
+    // the searches organizations save.
+    app.migrations.add(AddActorToAuditEvents())
+    app.migrations.add(CreateAuditSavedSearches())
+
+    // Per-credential use of deprecated API versions.
+    app.migrations.add(CreateAPIVersionUsage())
+
+    // The key each vTPM VM's TPM state is encrypted with at rest.
+    app.migrations.add(AddTPMStateKeyToVM())
+
+    // Server-side image builds, and the version of each image.
+    app.migrations.add(CreateImageBuilds())
+
     try await app.autoMigrate()
 
     // Reconcile the iam_roles/iam_role_actions tables with the code-side
@@ -688,6 +793,9 @@ public func configure(_ app: Application) async throws {
     // so a key added after upgrade still picks up rows written before it
     // existed. No-op without a key.
     try await secretsEncryption.encryptStoredSecrets(on: app.db, logger: app.logger)
+    // vTPM VMs created before TPM-state encryption, or while no key was set,
+    // get their state keys — only ever wrapped, so only with a key.
+    try await secretsEncryption.mintTPMStateKeys(on: app.db, logger: app.logger)
 
     // IAM phase 1: populate role_bindings from the relational mirrors
     // (user_organizations, project_members, project_group_grants). Idempotent,
@@ -746,6 +854,24 @@ public func configure(_ app: Application) async throws {
     // cancels it at shutdown.
     app.lifecycle.use(WebhookDeliveryLifecycleHandler())
 
+    // GraphQL subscriptions: tail the resource_events log on every replica
+    // and fan events out to this replica's subscribers.
+    app.lifecycle.use(ResourceEventStreamLifecycleHandler())
+
+    // Automation rules: execute the runs matching events queued, as each
+    // rule's service account.
+    app.lifecycle.use(AutomationLifecycleHandler())
+
+    // SSH console gateway: when SSH_GATEWAY_ENABLED, serve `ssh <vm-id>@…`
+    // on SSH_GATEWAY_PORT alongside the HTTP listener.
+    app.lifecycle.use(SSHConsoleGatewayLifecycleHandler())
+    // Code-session idle sweep: checkpoint idle sessions, tear down ones left
+    // checkpointed past CODE_SESSION_CHECKPOINT_RETENTION_HOURS.
+    app.lifecycle.use(CodeSessionLifecycleHandler())
+    // Image build sweep: boot, provision, stop and capture each build, and
+    // delete the VMs of finished ones.
+    app.lifecycle.use(ImageBuildLifecycleHandler())
+
     // Blue/green drain: flip `/health/ready` to 503 on SIGTERM so a load
     // balancer pulls this replica before Vapor stops accepting connections.
     app.lifecycle.use(DrainSignalLifecycleHandler())
@@ -7,9 +7,15 @@ func routes(_ app: Application) throws {
     try app.register(collection: UserController())
     // Self-service passkey management for the signed-in user
     try app.register(collection: PasskeyController())
+    // SSH keys the signed-in user logs in to the SSH console gateway with
+    try app.register(collection: SSHKeyController())
     try app.register(collection: VMController())
+    // Rightsizing recommendations from observed guest usage
+    try app.register(collection: RightsizingController())
     // Sandboxes: OCI-image Firecracker microVMs (issue #413)
     try app.register(collection: SandboxController())
+    // Code-interpreter sessions, each backed by a sandbox running a kernel
+    try app.register(collection: CodeSessionController())
     try app.register(collection: OperationController())
     try app.register(collection: OrganizationController())
     try app.register(collection: AuthorizationController())
@@ -42,6 +48,8 @@ func routes(_ app: Application) throws {
 
     // OIDC controller
     try app.register(collection: OIDCController())
+    // Verified email domains of organizations, for sign-in auto-join
+    try app.register(collection: OrganizationDomainController())
     // Agent management controller
     try app.register(collection: AgentController())
     // Sites (availability zones) grouping agents into shared OVN deployments
@@ -57,17 +65,47 @@ func routes(_ app: Application) throws {
     // User-managed webhook notifications (issue #559)
     try app.register(collection: WebhookSubscriptionController())
 
+    // External admission webhooks reviewing creates and operations
+    try app.register(collection: AdmissionWebhookController())
+
+    // Event-driven automation rules acting as a project's service accounts
+    try app.register(collection: AutomationRuleController())
+
+    // Custom UEFI Secure Boot key sets and each VM's db/dbx
+    try app.register(collection: SecureBootKeySetController())
+
+    // Application health checks on VMs and their automatic actions
+    try app.register(collection: VMHealthCheckController())
+
+    // Project maintenance windows gating disruptive platform work
+    try app.register(collection: MaintenancePolicyController())
+
     // Image management controller
     try app.register(collection: ImageController())
 
+    // Image builds: provision a VM from a base image and capture it
+    try app.register(collection: ImageBuildController())
+
     // Volume management controller
     try app.register(collection: VolumeController())
 
+    // Volume types backed by storage pools, with per-project quotas
+    try app.register(collection: VolumeTypeController())
+
+    // Managed NFS file shares on project networks
+    try app.register(collection: FileShareController())
+
+    // S3-compatible object storage: buckets and their access keys
+    try app.register(collection: BucketController())
+    try app.register(collection: ObjectStorageAccessKeyController())
+
     // Network management controller
     try app.register(collection: NetworkController())
+    try app.register(collection: NetworkAllocationController())
 
     // Floating IPs: external address pools + VM NIC attachments (issue #344)
     try app.register(collection: FloatingIPController())
+    try app.register(collection: BYOIPPrefixController())
     try app.register(collection: SecurityGroupController())
 
     // Console WebSocket controller for VM console streaming
@@ -76,11 +114,18 @@ func routes(_ app: Application) throws {
     // Sandbox exec attach WebSocket (issue #423)
     try app.register(collection: SandboxExecWebSocketController())
 
+    // Sharing live console and exec sessions with invited participants
+    try app.register(collection: SharedSessionController())
+
     // VM Logs controller for querying logs from Loki
     try app.register(collection: LogsController())
 
-    // Audit trail query API (issue #39)
+    // Audit trail query API (issue #39), and the searches organizations save
     try app.register(collection: AuditEventController())
+    try app.register(collection: AuditSavedSearchController())
+
+    // Published API versions and who still calls the deprecated ones
+    try app.register(collection: APIVersionController())
 
     // Workload Identity (SPIFFE / SPIRE) read API
     try app.register(collection: WorkloadIdentityController())
@@ -90,6 +135,9 @@ func routes(_ app: Application) throws {
     try app.register(collection: ServiceAccountController())
     try app.register(collection: WorkloadRegistrationController())
 
+    // Read-only GraphQL over the resource graph, with event subscriptions
+    try app.register(collection: GraphQLController())
+
     // OpenAPI Vapor transport (spec-first, issue #583): surfaces whose handlers
     // are generated from Sources/App/openapi.yaml. Registered last so a
     // hand-written controller can never shadow a generated route unnoticed —
@@ -0,0 +1,322 @@
+import Foundation
+import Testing
+import Vapor
+
+@testable import App
+
+/// Pins the surface each published API version gives its callers.
+///
+/// `APIContracts/v<N>.txt` lists, one line each, every operation a version
+/// published, the query and header parameters and schemas it uses, and every
+/// schema's properties (with their types) and required list. The latest
+/// version is the one `openapi.yaml` describes, so its file must match the
+/// spec's surface exactly:
+///
+/// - A pinned line the spec no longer has is a breaking change — a removed
+///   operation, a renamed field or parameter, a changed type or required list.
+///   It belongs in a new `APIVersion` with a codec for the old shape, not in
+///   the published one.
+/// - A spec line the file lacks is an additive change. Additions are
+///   compatible; add the lines the failure lists to the file.
+///
+/// A version superseded by a newer one keeps its file as the record of what it
+/// published, and its codecs get encoding tests like the ones below.
+@Suite("API Contract Tests")
+struct APIContractTests {
+
+    private static let contractsDirectory = URL(fileURLWithPath: #filePath)
+        .deletingLastPathComponent()
+        .appendingPathComponent("APIContracts")
+
+    private static func pinnedSurface(of version: APIVersion) throws -> Set<String> {
+        let url = contractsDirectory.appendingPathComponent("v\(version.number).txt")
+        let text = try String(contentsOf: url, encoding: .utf8)
+        return Set(
+            text.split(separator: "\n")
+                .map { $0.trimmingCharacters(in: .whitespaces) }
+                .filter { !$0.isEmpty && !$0.hasPrefix("#") })
+    }
+
+    // MARK: - Surface extraction
+
+    /// Collapse every path parameter to `{}`: renaming one changes nothing on
+    /// the wire.
+    private static func normalizePath(_ path: String) -> String {
+        var result = ""
+        var depth = 0
+        for ch in path {
+            switch ch {
+            case "{": depth += 1
+            case "}": if depth > 0 { depth -= 1; result += "{}" }
+            default: if depth == 0 { result.append(ch) }
+            }
+        }
+        return result
+    }
+
+    private static func captured(_ pattern: String, in text: String) -> String? {
+        guard let regex = try? NSRegularExpression(pattern: pattern),
+            let match = regex.firstMatch(in: text, range: NSRange(text.startIndex..., in: text)),
+            let range = Range(match.range(at: 1), in: text)
+        else { return nil }
+        return String(text[range])
+    }
+
+    /// The surface `openapi.yaml` describes, in the lines of the contract
+    /// files. Dependency-free like `OpenAPISpecDriftTests`, and relying on the
+    /// same invariant: the document's 2-space indentation (paths and
+    /// component sections at 2, operations and schemas at 4, schema keys at
+    /// 6, properties at 8).
+    static func surface(of yaml: String) -> Set<String> {
+        let httpMethods: Set<String> = ["get", "put", "post", "delete", "patch", "options", "head", "trace"]
+        var lines: Set<String> = []
+        var section = ""
+        var subsection = ""
+        var path: String?
+        var operation: String?
+        var pendingParameter: String?
+        var parameterRefs: [(operation: String, name: String)] = []
+        var componentParameters: [String: (name: String?, location: String?)] = [:]
+        var currentParameter: String?
+        var schema: String?
+        var schemaKey: String?
+        var property: String?
+        var properties: [String: [String: String?]] = [:]
+        var required: [String: [String]] = [:]
+
+        for rawLine in yaml.split(separator: "\n", omittingEmptySubsequences: false) {
+            let line = String(rawLine)
+            let trimmed = line.trimmingCharacters(in: .whitespaces)
+            if trimmed.isEmpty { continue }
+            let indent = line.prefix { $0 == " " }.count
+            let key = String(trimmed.prefix { $0 != ":" })
+
+            if indent == 0 {
+                section = key
+                subsection = ""
+                path = nil
+                operation = nil
+                schema = nil
+                continue
+            }
+
+            if section == "paths" {
+                if indent == 2, trimmed.hasPrefix("/"), let colon = trimmed.lastIndex(of: ":") {
+                    path = normalizePath(String(trimmed[..<colon]))
+                    operation = nil
+                    pendingParameter = nil
+                    continue
+                }
+                if indent == 4 {
+                    let token = trimmed.hasSuffix(":") ? String(trimmed.dropLast()) : trimmed
+                    if httpMethods.contains(token), let path {
+                        operation = "\(token.uppercased()) \(path)"
+                        lines.insert(operation!)
+                    } else {
+                        operation = nil
+                    }
+                    pendingParameter = nil
+                    continue
+                }
+                guard let operation, indent > 4 else { continue }
+                if let name = captured(#"#/components/schemas/([A-Za-z0-9_]+)"#, in: trimmed) {
+                    lines.insert("\(operation) schema:\(name)")
+                }
+                if let name = captured(##"^- \$ref: "#/components/parameters/([A-Za-z0-9_]+)""##, in: trimmed) {
+                    parameterRefs.append((operation, name))
+                    continue
+                }
+                if trimmed.hasPrefix("- name: ") {
+                    pendingParameter = trimmed.dropFirst("- name: ".count).trimmingCharacters(in: .whitespaces)
+                    continue
+                }
+                if let name = pendingParameter, trimmed.hasPrefix("in: ") {
+                    let location = trimmed.dropFirst("in: ".count).trimmingCharacters(in: .whitespaces)
+                    if location == "query" || location == "header" {
+                        lines.insert("\(operation) \(location):\(name)")
+                    }
+                    pendingParameter = nil
+                }
+                continue
+            }
+
+            guard section == "components" else { continue }
+            if indent == 2 {
+                subsection = key
+                currentParameter = nil
+                schema = nil
+                continue
+            }
+
+            if subsection == "parameters" {
+                if indent == 4 {
+                    currentParameter = key
+                    componentParameters[key] = (nil, nil)
+                } else if indent == 6, let currentParameter {
+                    if trimmed.hasPrefix("name: ") {
+                        componentParameters[currentParameter]?.name =
+                            trimmed.dropFirst("name: ".count).trimmingCharacters(in: .whitespaces)
+                    } else if trimmed.hasPrefix("in: ") {
+                        componentParameters[currentParameter]?.location =
+                            trimmed.dropFirst("in: ".count).trimmingCharacters(in: .whitespaces)
+                    }
+                }
+                continue
+            }
+
+            guard subsection == "schemas" else { continue }
+            if indent == 4 {
+                schema = key
+                schemaKey = nil
+                property = nil
+                properties[key] = [:]
+                continue
+            }
+            guard let schema else { continue }
+            if indent == 6 {
+                schemaKey = key
+                property = nil
+                if key == "required" {
+                    let rest = trimmed.dropFirst("required:".count).trimmingCharacters(in: .whitespaces)
+                    required[schema] =
+                        rest.hasPrefix("[")
+                        ? rest.trimmingCharacters(in: CharacterSet(charactersIn: "[]"))
+                            .split(separator: ",")
+                            .map { $0.trimmingCharacters(in: .whitespaces) }
+                            .filter { !$0.isEmpty }
+                        : []
+                }
+                continue
+            }
+            if indent == 8, schemaKey == "required", trimmed.hasPrefix("- ") {
+                required[schema, default: []].append(trimmed.dropFirst(2).trimmingCharacters(in: .whitespaces))
+                continue
+            }
+            if indent == 8, schemaKey == "properties" {
+                property = key
+                properties[schema]?[key] = .some(nil)
+                continue
+            }
+            if indent == 10, schemaKey == "properties", let property, properties[schema]?[property] == .some(nil) {
+                if trimmed.hasPrefix("type: ") {
+                    properties[schema]?[property] = String(trimmed.dropFirst("type: ".count))
+                } else if trimmed.hasPrefix("$ref: ") {
+                    let reference = trimmed.hasSuffix("\"") ? String(trimmed.dropLast()) : trimmed
+                    properties[schema]?[property] = reference.split(separator: "/").last.map(String.init)
+                } else if ["allOf:", "oneOf:", "anyOf:"].contains(trimmed) {
+                    properties[schema]?[property] = String(trimmed.dropLast())
+                }
+            }
+        }
+
+        for reference in parameterRefs {
+            guard let parameter = componentParameters[reference.name], let name = parameter.name,
+                let location = parameter.location, location == "query" || location == "header"
+            else { continue }
+            lines.insert("\(reference.operation) \(location):\(name)")
+        }
+        for (schema, fields) in properties {
+            for (field, type) in fields {
+                lines.insert("schema \(schema).\(field) \(type ?? "any")")
+            }
+        }
+        for (schema, fields) in required where !fields.isEmpty {
+            lines.insert("schema \(schema) required:\(fields.sorted().joined(separator: ","))")
+        }
+        return lines
+    }
+
+    // MARK: - Published surfaces
+
+    @Test("Every published version has a pinned surface")
+    func everyVersionIsPinned() throws {
+        for version in APIVersion.published {
+            let surface = try Self.pinnedSurface(of: version)
+            #expect(!surface.isEmpty, "APIContracts/v\(version.number).txt is empty")
+        }
+    }
+
+    @Test("The spec keeps the latest version's pinned surface")
+    func latestMatchesSpec() throws {
+        let yaml = try #require(OpenAPISpec.yaml)
+        let described = Self.surface(of: yaml)
+        let pinned = try Self.pinnedSurface(of: .latest)
+        let file = "APIContracts/v\(APIVersion.latest.number).txt"
+
+        let broken = pinned.subtracting(described).sorted()
+        #expect(
+            broken.isEmpty,
+            """
+            openapi.yaml no longer has these lines of \(file). Changing a published version breaks \
+            its callers; ship the change as a new APIVersion instead:
+            \(broken.joined(separator: "\n"))
+            """)
+
+        let added = described.subtracting(pinned).sorted()
+        #expect(
+            added.isEmpty,
+            """
+            openapi.yaml adds to the published surface. Additions are compatible; add these lines \
+            to \(file):
+            \(added.joined(separator: "\n"))
+            """)
+    }
+
+    @Test("Published versions are contiguous, and only older ones are deprecated")
+    func publishedVersions() {
+        let numbers = APIVersion.published.map(\.number)
+        #expect(numbers == Array(1...numbers.count))
+        #expect(!APIVersion.latest.isDeprecated)
+        #expect(APIVersion.published.contains(APIVersion.unversioned))
+        for version in APIVersion.published {
+            if let deprecatedAt = version.deprecatedAt, let sunsetAt = version.sunsetAt {
+                #expect(sunsetAt > deprecatedAt, "\(version)")
+            }
+        }
+    }
+
+    // MARK: - Encoded shapes
+
+    /// The keys of `value`'s JSON encoding.
+    private func encodedKeys(of value: some Encodable) throws -> Set<String> {
+        let encoder = JSONEncoder()
+        encoder.dateEncodingStrategy = .iso8601
+        let object = try JSONSerialization.jsonObject(with: try encoder.encode(value))
+        return Set(try #require(object as? [String: Any]).keys)
+    }
+
+    /// The properties `schema` has in the latest version's pinned surface.
+    private func pinnedProperties(of schema: String) throws -> Set<String> {
+        let prefix = "schema \(schema)."
+        return Set(
+            try Self.pinnedSurface(of: .latest)
+                .filter { $0.hasPrefix(prefix) }
+                .compactMap { $0.dropFirst(prefix.count).split(separator: " ").first.map(String.init) })
+    }
+
+    /// An event with every field set, so every key is encoded.
+    private var sampleEvent: AuditEventResponse {
+        let event = AuditEvent(
+            from: AuditRecord(
+                eventType: "api.request", userID: UUID(), username: "alice", apiKeyID: UUID(),
+                organizationID: UUID(), method: "POST", path: "/api/vms", status: 201, resourceType: "vms",
+                resourceID: "vm-1", action: "create", sourceIP: "10.0.0.1", adminBypass: false,
+                metadata: ["error": "none"], actorType: AuditActorType.user.rawValue, actorID: UUID()))
+        event.id = UUID()
+        event.createdAt = Date()
+        return AuditEventResponse(from: event)
+    }
+
+    @Test("Audit events encode the fields their pinned schemas publish")
+    func auditEventShapes() throws {
+        #expect(try encodedKeys(of: sampleEvent) == pinnedProperties(of: "AuditEvent"))
+
+        let list = AuditEventListResponse(events: [sampleEvent], total: 1, limit: 50, offset: 0)
+        #expect(try encodedKeys(of: list) == pinnedProperties(of: "AuditEventListResponse"))
+
+        let query = AuditQueryResponse(
+            query: "| count by status", events: [sampleEvent], groupBy: ["status"],
+            groups: [AuditQueryGroup(key: ["status": "200"], count: 1)], total: 1, limit: 50, offset: 0)
+        #expect(try encodedKeys(of: query) == pinnedProperties(of: "AuditQueryResponse"))
+    }
+}
@@ -0,0 +1,245 @@
+import Fluent
+import Foundation
+import Testing
+import Vapor
+import VaporTesting
+
+@testable import App
+
+/// How a request picks its API version (path or `Strato-API-Version`), that
+/// the current version goes out without deprecation headers, a changed DTO
+/// served in each version's shape with a deprecated version's headers, and
+/// the per-client usage report for deprecated versions.
+@Suite("API Versioning Tests", .serialized)
+final class APIVersioningTests {
+
+    /// A stand-in for the first real successor: v1 deprecated, v2 current.
+    private static let deprecatedV1 = APIVersion(
+        number: 1, deprecatedAt: Date(timeIntervalSince1970: 1_790_000_000),
+        sunsetAt: Date(timeIntervalSince1970: 1_800_000_000))
+    private static let v2 = APIVersion(number: 2, changes: ["Widgets report sizeBytes instead of sizeMB."])
+
+    /// A response DTO whose shape changed in `v2`: it is the v2 shape, and
+    /// converts itself to the one v1 published.
+    private struct Widget: VersionedContent {
+        let name: String
+        let sizeBytes: Int
+
+        struct V1: Content {
+            let name: String
+            let sizeMB: Int
+        }
+
+        func content(for version: APIVersion) -> any AsyncResponseEncodable {
+            version < APIVersioningTests.v2 ? V1(name: name, sizeMB: sizeBytes >> 20) : self
+        }
+    }
+
+    private func withTestVersions(_ app: Application) {
+        app.apiVersions = [Self.deprecatedV1, Self.v2]
+        app.testOnlyLoginRoutePrefixes = ["/api/widgets"]
+        app.get("api", "widgets") { _ in Versioned(Widget(name: "sprocket", sizeBytes: 3 << 20)) }
+    }
+
+    private func withAdmin(_ test: (Application, String) async throws -> Void) async throws {
+        try await withTestApp { app in
+            let user = try await TestDataBuilder(db: app.db).createUser(
+                username: "versionadmin", email: "versionadmin@example.com", isSystemAdmin: true)
+            let token = try await user.generateAPIKey(on: app.db)
+            try await test(app, token)
+        }
+    }
+
+    // MARK: - Resolution
+
+    @Test("The version segment is split off API paths only")
+    func pathVersions() {
+        #expect(APIVersionPathResponder.splitVersion(from: "/api/v1/vms")! == ("1", "/api/vms"))
+        #expect(APIVersionPathResponder.splitVersion(from: "/api/v12/vms")! == ("12", "/api/vms"))
+        #expect(APIVersionPathResponder.splitVersion(from: "/api/v1")! == ("1", "/api"))
+        #expect(APIVersionPathResponder.splitVersion(from: "/api/vms") == nil)
+        #expect(APIVersionPathResponder.splitVersion(from: "/api/v1beta/vms") == nil)
+        #expect(APIVersionPathResponder.splitVersion(from: "/api/volumes") == nil)
+        #expect(APIVersionPathResponder.splitVersion(from: "/v1/api/vms") == nil)
+    }
+
+    @Test("Path and header agree or the request is rejected; unknown versions are too")
+    func resolution() throws {
+        #expect(try APIVersionMiddleware.resolve(pathVersion: nil, headerVersion: nil) == .unversioned)
+        #expect(try APIVersionMiddleware.resolve(pathVersion: "1", headerVersion: nil) == .v1)
+        #expect(try APIVersionMiddleware.resolve(pathVersion: nil, headerVersion: " 1 ") == .v1)
+        #expect(try APIVersionMiddleware.resolve(pathVersion: "1", headerVersion: "1") == .v1)
+        for (path, header) in [("1", "2"), ("9", nil), (nil, "one"), (nil, "0")] as [(String?, String?)] {
+            #expect(throws: Abort.self, "\(String(describing: path)) \(String(describing: header))") {
+                try APIVersionMiddleware.resolve(pathVersion: path, headerVersion: header)
+            }
+        }
+    }
+
+    @Test("The metric's client label is the User-Agent's product, bounded")
+    func clientLabels() {
+        #expect(APIVersionMiddleware.clientLabel(userAgent: "strato-cli/1.4.0 (linux)") == "strato-cli")
+        #expect(
+            APIVersionMiddleware.clientLabel(userAgent: "Terraform-Provider-Strato/0.3") == "terraform-provider-strato")
+        #expect(APIVersionMiddleware.clientLabel(userAgent: "{}") == "unknown")
+        #expect(APIVersionMiddleware.clientLabel(userAgent: nil) == "unknown")
+    }
+
+    // MARK: - Responses
+
+    @Test("Every way of naming version 1 is served it, current and without deprecation headers")
+    func currentVersion() async throws {
+        try await withAdmin { app, token in
+            let alice = UUID()
+            try await AuditEvent(from: AuditRecord(eventType: "test.versioned", userID: alice)).save(on: app.db)
+            try await AuditEvent(from: AuditRecord(eventType: "test.versioned", userID: UUID())).save(on: app.db)
+
+            let named: [(String, String?)] = [
+                ("/api/audit-events", nil), ("/api/v1/audit-events", nil), ("/api/audit-events", "1"),
+                ("/api/v1/audit-events", "1"),
+            ]
+            for (path, header) in named {
+                try await app.test(.GET, "\(path)?eventType=test.versioned&userID=\(alice)") { req in
+                    req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                    if let header { req.headers.replaceOrAdd(name: APIVersion.headerName, value: header) }
+                } afterResponse: { res in
+                    #expect(res.status == .ok, "\(path)")
+                    #expect(res.headers.first(name: APIVersion.headerName) == "1")
+                    #expect(!res.headers.contains(name: "Deprecation"))
+                    #expect(!res.headers.contains(name: "Sunset"))
+                    let body = try res.content.decode(AuditEventListResponse.self)
+                    #expect(body.events.map(\.userID) == [alice], "\(path)")
+                }
+            }
+
+            // An unpublished version, and a path and header that disagree.
+            let rejected: [(String, String?)] = [("/api/v7/audit-events", nil), ("/api/v1/audit-events", "2")]
+            for (path, header) in rejected {
+                try await app.test(.GET, path) { req in
+                    req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                    if let header { req.headers.replaceOrAdd(name: APIVersion.headerName, value: header) }
+                } afterResponse: { res in
+                    #expect(res.status == .badRequest, "\(path)")
+                }
+            }
+        }
+    }
+
+    @Test("A changed DTO is served in each version's shape, a deprecated one with Deprecation and Sunset")
+    func convertsAndDeprecates() async throws {
+        try await withAdmin { app, token in
+            withTestVersions(app)
+
+            for (path, header) in [("/api/v2/widgets", nil), ("/api/widgets", "2")] as [(String, String?)] {
+                try await app.test(.GET, path) { req in
+                    req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                    if let header { req.headers.replaceOrAdd(name: APIVersion.headerName, value: header) }
+                } afterResponse: { res in
+                    #expect(res.status == .ok, "\(path)")
+                    #expect(res.headers.first(name: APIVersion.headerName) == "2")
+                    #expect(!res.headers.contains(name: "Deprecation"))
+                    #expect(!res.headers.contains(name: "Sunset"))
+                    let widget = try res.content.decode(Widget.self)
+                    #expect(widget.sizeBytes == 3 << 20)
+                }
+            }
+
+            // Naming no version still gets v1 — now deprecated.
+            for path in ["/api/v1/widgets", "/api/widgets"] {
+                try await app.test(.GET, path) { req in
+                    req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                } afterResponse: { res in
+                    #expect(res.status == .ok, "\(path)")
+                    #expect(res.headers.first(name: APIVersion.headerName) == "1")
+                    #expect(res.headers.first(name: "Deprecation") == "@1790000000")
+                    #expect(res.headers.first(name: "Sunset") == "Fri, 15 Jan 2027 08:00:00 GMT")
+                    let widget = try res.content.decode(Widget.V1.self)
+                    #expect(widget.name == "sprocket")
+                    #expect(widget.sizeMB == 3)
+                }
+            }
+
+            try await app.test(.GET, "/api/api-versions") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+            } afterResponse: { res in
+                let body = try res.content.decode(APIVersionListResponse.self)
+                #expect(body.versions.map(\.status) == ["deprecated", "current"])
+                #expect(body.latest == 2)
+                #expect(body.unversioned == 1)
+            }
+        }
+    }
+
+    @Test("The published versions are listed with their status")
+    func listsVersions() async throws {
+        try await withAdmin { app, token in
+            try await app.test(.GET, "/api/v1/api-versions") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+            } afterResponse: { res in
+                #expect(res.status == .ok)
+                let body = try res.content.decode(APIVersionListResponse.self)
+                #expect(body.versions.map(\.version) == [1])
+                #expect(body.versions.map(\.status) == ["current"])
+                #expect(body.versions.first?.deprecatedAt == nil)
+                #expect(body.latest == 1)
+                #expect(body.unversioned == 1)
+                #expect(body.requested == 1)
+            }
+        }
+    }
+
+    // MARK: - Usage
+
+    @Test("Deprecated-version use is recorded per credential, for system administrators to read")
+    func usageReport() async throws {
+        try await withAdmin { app, token in
+            // The current version is nobody's to chase.
+            try await app.test(.GET, "/api/audit-events") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+            } afterResponse: { res in
+                #expect(res.status == .ok)
+            }
+            await app.backgroundTasks.drain(timeout: .seconds(10))
+            try await app.test(.GET, "/api/v1/api-versions/usage") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+            } afterResponse: { res in
+                #expect(res.status == .ok)
+                #expect(try res.content.decode([APIVersionUsageResponse].self).isEmpty)
+            }
+
+            // No version is deprecated yet, so stand one in.
+            let deprecated = APIVersion(
+                number: 1, deprecatedAt: Date(), sunsetAt: Date().addingTimeInterval(365 * 86_400))
+            let client = APIVersionUsageTracker.Client(kind: .apiKey, id: UUID(), name: "Old Integration")
+            for _ in 0..<3 {
+                app.apiVersionUsage.record(version: deprecated, client: client, userAgent: "strato-cli/1.0", on: app)
+            }
+            await app.backgroundTasks.drain(timeout: .seconds(10))
+
+            try await app.test(.GET, "/api/v1/api-versions/usage") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+            } afterResponse: { res in
+                #expect(res.status == .ok)
+                let usage = try res.content.decode([APIVersionUsageResponse].self)
+                #expect(usage.count == 1)
+                let entry = try #require(usage.first)
+                #expect(entry.version == 1)
+                #expect(entry.clientType == "api_key")
+                #expect(entry.clientName == "Old Integration")
+                #expect(entry.userAgent == "strato-cli/1.0")
+                // The first request is written at once; the rest wait for the
+                // next write window.
+                #expect(entry.requestCount == 1)
+            }
+
+            let member = try await TestDataBuilder(db: app.db).createUser(
+                username: "versionmember", email: "versionmember@example.com")
+            let memberToken = try await member.generateAPIKey(on: app.db)
+            try await app.test(.GET, "/api/v1/api-versions/usage") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: memberToken)
+            } afterResponse: { res in
+                #expect(res.status == .forbidden)
+            }
+        }
+    }
+}
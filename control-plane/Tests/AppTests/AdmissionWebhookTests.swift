@@ -0,0 +1,352 @@
+import Fluent
+import Foundation
+import NIOConcurrencyHelpers
+import StratoShared
+import Testing
+import Vapor
+import VaporTesting
+
+@testable import App
+
+/// External admission webhooks: managing them, the merge patch, and the
+/// reviews creates and operations pass through — denies, patches, failure
+/// policies, and the audit trail.
+@Suite("Admission Webhook Tests", .serialized)
+struct AdmissionWebhookTests {
+
+    private typealias Verdict = (allowed: Bool, reason: String?, patch: CodableValue?)
+
+    private struct Unreachable: Error {}
+
+    /// Answers every review with `answer`, or fails to when it is nil,
+    /// keeping what it was sent.
+    private final class StubTransport: AdmissionTransport, @unchecked Sendable {
+        let reviews = NIOLockedValueBox<[(url: String, review: AdmissionReview)]>([])
+        let answer: @Sendable (AdmissionReview) -> Verdict?
+
+        init(_ answer: @escaping @Sendable (AdmissionReview) -> Verdict?) {
+            self.answer = answer
+        }
+
+        func post(_ body: Data, to url: String, headers: HTTPHeaders, timeoutSeconds: Int) async throws
+            -> (status: Int, body: Data)
+        {
+            let review = try JSONDecoder().decode(AdmissionReview.self, from: body)
+            reviews.withLockedValue { $0.append((url, review)) }
+            guard let verdict = answer(review) else { throw Unreachable() }
+            let response = AdmissionReviewResponse(
+                uid: review.uid, allowed: verdict.allowed, reason: verdict.reason, patch: verdict.patch)
+            return (200, try JSONEncoder().encode(response))
+        }
+    }
+
+    private func withOrgAdmin(_ test: (Application, Organization, User, String) async throws -> Void) async throws {
+        try await withTestApp { app in
+            let builder = TestDataBuilder(db: app.db)
+            let user = try await builder.createUser(
+                username: "admissionadmin", email: "admissionadmin@example.com", isSystemAdmin: false)
+            let org = try await builder.createOrganization(name: "Admission Org")
+            _ = try await builder.createProject(name: "Default Project", description: "", organization: org)
+            try await builder.addUserToOrganization(user: user, organization: org, role: "admin")
+            user.currentOrganizationId = org.id
+            try await user.save(on: app.db)
+            let token = try await user.generateAPIKey(on: app.db)
+            try await test(app, org, user, token)
+        }
+    }
+
+    private func makeWebhook(
+        _ app: Application, org: Organization, user: User, name: String, position: Int,
+        operations: [String] = [], failurePolicy: AdmissionFailurePolicy = .fail
+    ) async throws {
+        let webhook = AdmissionWebhook(
+            organizationID: org.id!, name: name, url: "http://127.0.0.1:1/\(name)", position: position,
+            operations: operations, failurePolicy: failurePolicy,
+            signingSecret: try app.secretsEncryption.encrypt("whsec_test"), createdByID: user.id!)
+        try await webhook.save(on: app.db)
+    }
+
+    private func reviewEvents(_ app: Application) async throws -> [AuditEvent] {
+        try await AuditEvent.query(on: app.db)
+            .filter(\.$eventType == AuditEventType.admissionReview.rawValue)
+            .all()
+    }
+
+    @Test("A merge patch merges objects recursively, removes members set to null, and replaces the rest")
+    func mergePatch() {
+        let target: CodableValue = .object([
+            "name": .string("web"),
+            "tags": .object(["team": .string("a"), "cost": .string("x")]),
+            "cpu": .int(8),
+        ])
+        let patch: CodableValue = .object([
+            "tags": .object(["cost": .null, "env": .string("prod")]),
+            "cpu": .int(2),
+            "sshPublicKey": .null,
+        ])
+        guard case .object(let result) = AdmissionService.mergePatch(target, patch),
+            case .object(let tags) = result["tags"]
+        else {
+            Issue.record("Patch result is not an object")
+            return
+        }
+        #expect(Set(result.keys) == ["name", "tags", "cpu"])
+        guard case .int(2) = result["cpu"] else {
+            Issue.record("cpu was not replaced")
+            return
+        }
+        #expect(Set(tags.keys) == ["team", "env"])
+    }
+
+    @Test("Org admins manage admission webhooks; the secret is shown once and bad settings are refused")
+    func crud() async throws {
+        try await withOrgAdmin { app, org, _, token in
+            let base = "/api/organizations/\(org.id!)/admission-webhooks"
+            var first: AdmissionWebhookResponse?
+            try await app.test(.POST, base) { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                try req.content.encode(
+                    CreateAdmissionWebhookRequest(
+                        name: "naming", url: "http://127.0.0.1:9/naming", position: nil, resourceKinds: nil,
+                        operations: ["create"], failurePolicy: nil, timeoutSeconds: nil))
+            } afterResponse: { res in
+                #expect(res.status == .created)
+                let body = try res.content.decode(AdmissionWebhookWithSecretResponse.self)
+                #expect(body.signingSecret.hasPrefix("whsec_"))
+                #expect(body.webhook.failurePolicy == .fail)
+                #expect(body.webhook.timeoutSeconds == AdmissionWebhook.defaultTimeoutSeconds)
+                first = body.webhook
+            }
+            try await app.test(.POST, base) { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                try req.content.encode(
+                    CreateAdmissionWebhookRequest(
+                        name: "sizes", url: "http://127.0.0.1:9/sizes", position: nil, resourceKinds: ["sandbox"],
+                        operations: nil, failurePolicy: .ignore, timeoutSeconds: 2))
+            } afterResponse: { res in
+                #expect(res.status == .created)
+                let body = try res.content.decode(AdmissionWebhookWithSecretResponse.self)
+                #expect(body.webhook.position == first!.position + 1)
+            }
+            for bad in [
+                CreateAdmissionWebhookRequest(
+                    name: "ops", url: "http://127.0.0.1:9/", position: nil, resourceKinds: nil,
+                    operations: ["explode"], failurePolicy: nil, timeoutSeconds: nil),
+                CreateAdmissionWebhookRequest(
+                    name: "kinds", url: "http://127.0.0.1:9/", position: nil, resourceKinds: ["floating_ip"],
+                    operations: nil, failurePolicy: nil, timeoutSeconds: nil),
+                CreateAdmissionWebhookRequest(
+                    name: "slow", url: "http://127.0.0.1:9/", position: nil, resourceKinds: nil,
+                    operations: nil, failurePolicy: nil, timeoutSeconds: 30),
+                CreateAdmissionWebhookRequest(
+                    name: "ftp", url: "ftp://127.0.0.1/", position: nil, resourceKinds: nil,
+                    operations: nil, failurePolicy: nil, timeoutSeconds: nil),
+            ] {
+                try await app.test(.POST, base) { req in
+                    req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                    try req.content.encode(bad)
+                } afterResponse: { res in
+                    #expect(res.status == .badRequest)
+                }
+            }
+
+            // Moving "naming" last reorders the list.
+            try await app.test(.PUT, "\(base)/\(first!.id!)") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                try req.content.encode(
+                    UpdateAdmissionWebhookRequest(
+                        name: nil, url: nil, position: 50, resourceKinds: nil, operations: nil,
+                        failurePolicy: nil, timeoutSeconds: nil, isActive: nil))
+            } afterResponse: { res in
+                #expect(res.status == .ok)
+            }
+            try await app.test(.GET, base) { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+            } afterResponse: { res in
+                #expect(res.status == .ok)
+                #expect(try res.content.decode([AdmissionWebhookResponse].self).map(\.name) == ["sizes", "naming"])
+            }
+
+            // Plain members can't see them.
+            let builder = TestDataBuilder(db: app.db)
+            let member = try await builder.createUser(
+                username: "admissionmember", email: "admissionmember@example.com", isSystemAdmin: false)
+            try await builder.addUserToOrganization(user: member, organization: org, role: "member")
+            let memberToken = try await member.generateAPIKey(on: app.db)
+            try await app.test(.GET, base) { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: memberToken)
+            } afterResponse: { res in
+                #expect(res.status == .forbidden)
+            }
+        }
+    }
+
+    @Test("Webhooks review a create in order: a patch reaches the next webhook and the handler, a deny stops it")
+    func createReview() async throws {
+        try await withOrgAdmin { app, org, user, token in
+            try await makeWebhook(app, org: org, user: user, name: "first", position: 0)
+            try await makeWebhook(app, org: org, user: user, name: "second", position: 1)
+            // "first" drops the image; "second" denies anything still asking for 8 CPUs.
+            let stub = StubTransport { review in
+                guard case .object(let object) = review.object else { return (false, "no object", nil) }
+                if review.resource.name == "big", case .int(8) = object["cpu"] {
+                    return (false, "8 CPUs is over the limit here", nil)
+                }
+                if object["imageId"] != nil { return (true, nil, .object(["imageId": .null])) }
+                return (true, nil, nil)
+            }
+            app.admissionTransport = stub
+
+            try await app.test(.POST, "/api/vms") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                try req.content.encode(["name": "small", "imageId": UUID().uuidString])
+            } afterResponse: { res in
+                // The handler saw the patched body: no image.
+                #expect(res.status == .badRequest)
+                #expect(res.body.string.contains("'imageId' must be provided"))
+            }
+            let reviews = stub.reviews.withLockedValue { $0 }
+            #expect(reviews.map(\.url) == ["http://127.0.0.1:1/first", "http://127.0.0.1:1/second"])
+            #expect(reviews.allSatisfy { $0.review.operation == "create" })
+            #expect(reviews.allSatisfy { $0.review.resource.kind == "virtual_machine" })
+            if case .object(let seen) = reviews[1].review.object {
+                #expect(seen["imageId"] == nil)
+            } else {
+                Issue.record("The second webhook saw no object")
+            }
+
+            try await app.test(.POST, "/api/vms") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                try req.content.encode(CreateProbe(name: "big", cpu: 8))
+            } afterResponse: { res in
+                #expect(res.status == .forbidden)
+                #expect(res.body.string.contains("Denied by admission webhook 'first': 8 CPUs is over the limit here"))
+            }
+
+            let decisions = try await reviewEvents(app).compactMap { $0.metadata?["decision"] }
+            #expect(decisions.sorted() == ["allowed", "denied", "patched"])
+        }
+    }
+
+    @Test("A create is reviewed only once its caller may create in the target project")
+    func createReviewFollowsAuthorization() async throws {
+        try await withOrgAdmin { app, org, user, token in
+            try await makeWebhook(app, org: org, user: user, name: "watch", position: 0)
+            let stub = StubTransport { _ in (false, "not today", nil) }
+            app.admissionTransport = stub
+
+            // A member with no role in the project is refused before any
+            // webhook hears of the request.
+            let builder = TestDataBuilder(db: app.db)
+            let member = try await builder.createUser(
+                username: "admissionbystander", email: "admissionbystander@example.com", isSystemAdmin: false)
+            try await builder.addUserToOrganization(user: member, organization: org, role: "member")
+            member.currentOrganizationId = org.id
+            try await member.save(on: app.db)
+            let memberToken = try await member.generateAPIKey(on: app.db)
+            for path in ["/api/vms", "/api/volumes", "/api/networks", "/api/buckets"] {
+                try await app.test(.POST, path) { req in
+                    req.headers.bearerAuthorization = BearerAuthorization(token: memberToken)
+                    try req.content.encode(SizedProbe(name: "secret-plans", sizeGB: 1))
+                } afterResponse: { res in
+                    #expect(res.status == .forbidden, "\(path)")
+                }
+            }
+            #expect(stub.reviews.withLockedValue { $0.isEmpty })
+
+            // The admin's volume, network and bucket creates are reviewed
+            // under their own kinds, against the resolved project.
+            let project = try #require(
+                try await Project.query(on: app.db).filter(\.$name == "Default Project").first())
+            for (path, kind) in [("/api/volumes", "volume"), ("/api/networks", "network"), ("/api/buckets", "bucket")] {
+                try await app.test(.POST, path) { req in
+                    req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                    try req.content.encode(SizedProbe(name: "reviewed", sizeGB: 1))
+                } afterResponse: { res in
+                    #expect(res.status == .forbidden, "\(path)")
+                    #expect(res.body.string.contains("Denied by admission webhook 'watch'"), "\(path)")
+                }
+                let review = try #require(stub.reviews.withLockedValue { $0.last }?.review)
+                #expect(review.resource.kind == kind)
+                #expect(review.projectId == project.id)
+            }
+        }
+    }
+
+    private struct CreateProbe: Content {
+        let name: String
+        let cpu: Int
+    }
+
+    /// Decodes as any of the probed creates; `sizeGB` is the one field a
+    /// volume create can't do without.
+    private struct SizedProbe: Content {
+        let name: String
+        let sizeGB: Int
+    }
+
+    @Test("A webhook without an answer fails the request closed, or is skipped under the ignore policy")
+    func failurePolicy() async throws {
+        try await withOrgAdmin { app, org, user, token in
+            try await makeWebhook(app, org: org, user: user, name: "down", position: 0)
+            app.admissionTransport = StubTransport { _ in nil }
+
+            try await app.test(.POST, "/api/vms") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                try req.content.encode(["name": "vm"])
+            } afterResponse: { res in
+                #expect(res.status == .serviceUnavailable)
+            }
+
+            let webhook = try #require(try await AdmissionWebhook.query(on: app.db).first())
+            webhook.failurePolicy = AdmissionFailurePolicy.ignore.rawValue
+            try await webhook.save(on: app.db)
+            try await app.test(.POST, "/api/vms") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                try req.content.encode(["name": "vm"])
+            } afterResponse: { res in
+                // Past admission, into the handler's own validation.
+                #expect(res.status == .badRequest)
+            }
+
+            let events = try await reviewEvents(app)
+            #expect(events.count == 2)
+            #expect(events.allSatisfy { $0.metadata?["decision"] == "error" })
+        }
+    }
+
+    @Test("Operations are reviewed without an object, unless the system started them")
+    func operationReview() async throws {
+        try await withOrgAdmin { app, org, user, _ in
+            try await makeWebhook(app, org: org, user: user, name: "no-reboots", position: 0, operations: ["reboot"])
+            let stub = StubTransport { review in
+                review.operation == "reboot" ? (false, "frozen", .object(["x": .int(1)])) : (true, nil, nil)
+            }
+            app.admissionTransport = stub
+            let project = try await TestDataBuilder(db: app.db).createProject(
+                name: "Admission Project", description: "", organization: org)
+            let vm = try await TestDataBuilder(db: app.db).createVM(name: "ops-vm", project: project)
+
+            await #expect(throws: Abort.self) {
+                try await ResourceOperation.begin(
+                    .reboot, resourceKind: .virtualMachine, resourceID: vm.id!, userID: user.id!,
+                    on: app.db, admittedBy: app.admission)
+            }
+            let review = try #require(stub.reviews.withLockedValue { $0 }.first?.review)
+            #expect(review.object == nil)
+            #expect(review.resource.id == vm.id)
+            #expect(review.resource.name == "ops-vm")
+            #expect(review.projectId == project.id)
+
+            // Not a reviewed operation, and the system's own reboots skip review.
+            _ = try await ResourceOperation.begin(
+                .boot, resourceKind: .virtualMachine, resourceID: vm.id!, userID: user.id!,
+                on: app.db, admittedBy: app.admission)
+            try await ResourceOperation.query(on: app.db).delete()
+            _ = try await ResourceOperation.begin(
+                .reboot, resourceKind: .virtualMachine, resourceID: vm.id!, userID: ResourceOperation.systemUserID,
+                on: app.db, admittedBy: app.admission)
+            #expect(stub.reviews.withLockedValue { $0.count } == 1)
+        }
+    }
+}
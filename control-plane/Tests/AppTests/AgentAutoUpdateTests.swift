@@ -127,6 +127,55 @@ final class AgentAutoUpdateTests {
         }
     }
 
+    @Test("an agent hosting a maintenance-window project waits for its window, announced ahead")
+    func maintenanceWindowGatesAssignment() async throws {
+        try await withAutoUpdateApp { app, builder, org, _ in
+            let gated = try await self.makeAgent(app: app, org: org, name: "aa-agent")
+            let free = try await self.makeAgent(app: app, org: org, name: "bb-agent")
+
+            // Closed for the next two hours, then open: no notice lead, so
+            // the update is scheduled for the end of the deny period.
+            let project = try await builder.createProject(name: "Windowed", description: "", organization: org)
+            let reopens = Date().addingTimeInterval(7200)
+            project.maintenancePolicy = MaintenancePolicy(
+                denyPeriods: [.init(start: Date().addingTimeInterval(-60), end: reopens, reason: "launch")],
+                noticeHours: 0)
+            try await project.save(on: app.db)
+            let vm = try await builder.createVM(name: "windowed-vm", project: project)
+            vm.hypervisorId = try gated.requireID().uuidString
+            try await vm.save(on: app.db)
+
+            await self.sweep(app)
+
+            // The rollout skips ahead rather than stalling on the window.
+            #expect(try await self.reload(gated, on: app).updateDesiredVersion == nil)
+            #expect(try await self.reload(free, on: app).updateDesiredVersion == Self.target)
+            let notice = try #require(
+                try await MaintenanceNotice.query(on: app.db).filter(\.$project.$id == project.requireID()).first())
+            #expect(notice.action == MaintenanceAction.agentUpdate.rawValue)
+            #expect(notice.subject == "aa-agent@\(Self.target)")
+            #expect(abs(notice.scheduledFor.timeIntervalSince(reopens)) < 1)
+            #expect(notice.startedAt == nil)
+
+            // The deny period is over and the free agent converged: the
+            // gated agent goes next, announced once.
+            project.maintenancePolicy = MaintenancePolicy(noticeHours: 0)
+            try await project.save(on: app.db)
+            notice.scheduledFor = Date().addingTimeInterval(-60)
+            try await notice.save(on: app.db)
+            let converged = try await self.reload(free, on: app)
+            converged.version = Self.target
+            try await converged.save(on: app.db)
+
+            await self.sweep(app)
+
+            #expect(try await self.reload(gated, on: app).updateDesiredVersion == Self.target)
+            let notices = try await MaintenanceNotice.query(on: app.db).all()
+            #expect(notices.count == 1)
+            #expect(notices.first?.startedAt != nil)
+        }
+    }
+
     @Test("the rollout advances only after the assigned agent re-registers at the target")
     func advancesOnConvergence() async throws {
         try await withAutoUpdateApp { app, _, org, _ in
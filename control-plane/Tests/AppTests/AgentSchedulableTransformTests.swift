@@ -143,4 +143,75 @@ struct AgentSchedulableTransformTests {
         #expect(byName["version-only"]?.supportsMachineProfile == true)
         #expect(byName["capable-old"]?.supportsMachineProfile == false)
     }
+
+    @Test("CPU models come from host info, gated on a v28 protocol, with the site's default attached")
+    func testCPUModels() throws {
+        let siteID = UUID()
+        let current = makeAgent(id: UUID(), name: "current")
+        current.wireProtocolVersion = WireProtocol.cpuModelMinimumVersion
+        current.hostInfo = HostInfo(supportedCPUModels: ["Haswell", "Skylake-Server"])
+        current.$site.id = siteID
+
+        let old = makeAgent(id: UUID(), name: "old")
+        old.wireProtocolVersion = WireProtocol.cpuModelMinimumVersion - 1
+        old.hostInfo = HostInfo(supportedCPUModels: ["Haswell"])
+
+        let result = AgentService.schedulableAgents(
+            from: [current, old], runningVMCounts: [:], siteDefaultCPUModels: [siteID: .named("Haswell")])
+        let byName = Dictionary(uniqueKeysWithValues: result.map { ($0.name, $0) })
+
+        #expect(byName["current"]?.supportsCPUModels == true)
+        #expect(byName["current"]?.cpuModels == ["Haswell", "Skylake-Server"])
+        #expect(byName["current"]?.siteDefaultCPUModel == .named("Haswell"))
+        #expect(byName["old"]?.supportsCPUModels == false)
+        #expect(byName["old"]?.canProvide(.named("Haswell")) == false)
+        #expect(byName["old"]?.siteDefaultCPUModel == nil)
+    }
+
+    @Test("Secure Boot key enrollment requires both the advertised capability and a v29 protocol")
+    func testSecureBootKeySupport() throws {
+        let capable = makeAgent(id: UUID(), name: "capable")
+        capable.capabilities = [MachineCapability.secureBootKeyEnrollment]
+        capable.wireProtocolVersion = WireProtocol.secureBootKeysMinimumVersion
+
+        let capableOld = makeAgent(id: UUID(), name: "capable-old")
+        capableOld.capabilities = [MachineCapability.secureBootKeyEnrollment]
+        capableOld.wireProtocolVersion = WireProtocol.secureBootKeysMinimumVersion - 1
+
+        let versionOnly = makeAgent(id: UUID(), name: "version-only")
+        versionOnly.wireProtocolVersion = WireProtocol.currentVersion
+
+        let result = AgentService.schedulableAgents(from: [capable, capableOld, versionOnly], runningVMCounts: [:])
+        let byName = Dictionary(uniqueKeysWithValues: result.map { ($0.name, $0) })
+
+        #expect(byName["capable"]?.supportsSecureBootKeys == true)
+        #expect(byName["capable-old"]?.supportsSecureBootKeys == false)
+        #expect(byName["version-only"]?.supportsSecureBootKeys == false)
+    }
+
+    @Test("a v26 agent with an overcommit ratio admits memory against the scaled total")
+    func testMemoryOvercommitScalesCapacity() throws {
+        let agent = makeAgent(id: UUID(), name: "overcommitted")
+        agent.wireProtocolVersion = WireProtocol.memoryOvercommitMinimumVersion
+        agent.memoryOvercommit = MemoryOvercommitPolicy(ratio: 1.5)
+        // Committed beyond the host: the report's available memory is
+        // clamped at zero, and only the unclamped figure is exact.
+        agent.availableMemory = 0
+        agent.committedMemory = 20
+
+        let result = try #require(AgentService.schedulableAgents(from: [agent], runningVMCounts: [:]).first)
+        #expect(result.totalMemory == 24)
+        #expect(result.availableMemory == 4)
+    }
+
+    @Test("an overcommit ratio is ignored for an agent that cannot reclaim")
+    func testMemoryOvercommitNeedsV26() throws {
+        let agent = makeAgent(id: UUID(), name: "too-old")
+        agent.wireProtocolVersion = WireProtocol.memoryOvercommitMinimumVersion - 1
+        agent.memoryOvercommit = MemoryOvercommitPolicy(ratio: 2)
+
+        let result = try #require(AgentService.schedulableAgents(from: [agent], runningVMCounts: [:]).first)
+        #expect(result.totalMemory == 16)
+        #expect(result.availableMemory == 8)
+    }
 }
@@ -224,6 +224,49 @@ final class AgentUpdateEndpointTests {
         }
     }
 
+    @Test("a closed maintenance window refuses the update and announces it, unless forced")
+    func maintenanceWindowRequiresForce() async throws {
+        try await withUpdateTestApp { app, builder, org, token in
+            let agent = try await self.makeAgent(app: app, org: org)
+
+            let project = try await builder.createProject(
+                name: "Windowed Project", description: "project with a deny period", organization: org)
+            project.maintenancePolicy = MaintenancePolicy(
+                denyPeriods: [.init(start: Date().addingTimeInterval(-60), end: Date().addingTimeInterval(7200))],
+                noticeHours: 0)
+            try await project.save(on: app.db)
+            let vm = try await builder.createVM(name: "windowed-vm", project: project)
+            vm.hypervisorId = agent.id!.uuidString
+            try await vm.save(on: app.db)
+
+            struct Body: Content {
+                let artifactUrl: String
+                let sha256: String
+                let force: Bool?
+            }
+            let body = Body(
+                artifactUrl: "https://mirror.internal/strato-linux-x86_64.tar.gz", sha256: Self.validDigest,
+                force: nil)
+
+            try await app.test(.POST, "/api/agents/\(agent.id!)/actions/update") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                try req.content.encode(body)
+            } afterResponse: { res in
+                #expect(res.status == .conflict)
+                #expect(res.body.string.contains("maintenance windows"))
+            }
+            #expect(try await MaintenanceNotice.query(on: app.db).count() == 1)
+
+            // Forced, it clears the gate and fails only at the send.
+            try await app.test(.POST, "/api/agents/\(agent.id!)/actions/update") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                try req.content.encode(Body(artifactUrl: body.artifactUrl, sha256: body.sha256, force: true))
+            } afterResponse: { res in
+                #expect(res.status == .badGateway)
+            }
+        }
+    }
+
     @Test("explicit artifact overrides are system-admin only")
     func explicitArtifactRequiresSystemAdmin() async throws {
         try await withUpdateTestApp { app, builder, org, _ in
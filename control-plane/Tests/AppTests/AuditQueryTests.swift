@@ -0,0 +1,292 @@
+import Fluent
+import Foundation
+import Testing
+import Vapor
+import VaporTesting
+
+@testable import App
+
+/// The audit query language (`AuditQuery`): what it parses and rejects, what
+/// its compiled SQL matches through the `query` endpoints, its `count by`
+/// aggregation, and the searches organizations save.
+@Suite("Audit Query Tests", .serialized)
+final class AuditQueryTests {
+
+    private func withOrgAdmin(
+        systemAdmin: Bool = false,
+        _ test: (Application, Organization, String) async throws -> Void
+    ) async throws {
+        try await withTestApp { app in
+            let builder = TestDataBuilder(db: app.db)
+            let user = try await builder.createUser(
+                username: "queryadmin", email: "queryadmin@example.com", isSystemAdmin: systemAdmin)
+            let org = try await builder.createOrganization(name: "Query Org")
+            try await builder.addUserToOrganization(user: user, organization: org, role: "admin")
+            user.currentOrganizationId = org.id
+            try await user.save(on: app.db)
+            let token = try await user.generateAPIKey(on: app.db)
+            try await test(app, org, token)
+        }
+    }
+
+    /// Persists an event, backdated by `ageHours`.
+    @discardableResult
+    private func saveEvent(
+        _ record: AuditRecord, ageHours: Double = 0, on db: any Database
+    ) async throws -> AuditEvent {
+        let event = AuditEvent(from: record)
+        try await event.save(on: db)
+        if ageHours > 0 {
+            event.createdAt = Date().addingTimeInterval(-ageHours * 3600)
+            try await event.save(on: db)
+        }
+        return event
+    }
+
+    private func query(
+        _ q: String, path: String, token: String, app: Application
+    ) async throws -> AuditQueryResponse {
+        var response: AuditQueryResponse?
+        try await app.test(.GET, path) { req in
+            req.headers.bearerAuthorization = BearerAuthorization(token: token)
+            try req.query.encode(["q": q])
+        } afterResponse: { res in
+            #expect(res.status == .ok)
+            response = try res.content.decode(AuditQueryResponse.self)
+        }
+        return try #require(response)
+    }
+
+    // MARK: - Parsing
+
+    @Test("Well-formed queries parse, with their aggregation")
+    func parses() throws {
+        let filter = try AuditQuery(
+            #"actor.type == "service_account" and type startsWith "iam." and time > -24h"#)
+        #expect(filter.groupBy == nil)
+        #expect(filter.predicate() != nil)
+
+        let grouped = try AuditQuery("status >= 400 || adminBypass == true | count by actor, status")
+        #expect(grouped.groupBy?.map(\.name) == ["actor.type", "actor.id", "actor.name", "status"])
+
+        let bare = try AuditQuery("| count")
+        #expect(bare.groupBy == [])
+        #expect(bare.predicate() == nil)
+
+        let all = try AuditQuery("")
+        #expect(all.groupBy == nil)
+        #expect(all.predicate() == nil)
+    }
+
+    @Test("Unknown fields, mistyped literals and unsupported operators are rejected")
+    func rejects() {
+        for source in [
+            #"user == "alice""#,
+            #"status == "500""#,
+            "status startsWith 5",
+            "time == -1h",
+            #"actor.id == "not-a-uuid""#,
+            "adminBypass > true",
+            "time > -1 h",
+            "time > -30min",
+            "status < null",
+            #"type == "unterminated"#,
+            #"(type == "a""#,
+            #"type == "a" | sum"#,
+            "| count by time",
+            "type",
+        ] {
+            #expect(throws: AuditQuery.ParseError.self, "\(source)") { try AuditQuery(source) }
+        }
+    }
+
+    @Test("An event's actor is inferred when its recorder doesn't name one")
+    func actorInference() {
+        let userID = UUID()
+        let user = AuditRecord(eventType: "x", userID: userID, method: "POST").resolvingActor()
+        #expect(user.actorType == "user")
+        #expect(user.actorID == userID)
+        #expect(AuditRecord(eventType: "x", method: "POST").resolvingActor().actorType == "anonymous")
+        #expect(AuditRecord(eventType: "x").resolvingActor().actorType == "system")
+
+        let accountID = UUID()
+        let named = AuditRecord(
+            eventType: "x", actorType: AuditActorType.serviceAccount.rawValue, actorID: accountID
+        ).resolvingActor()
+        #expect(named.actorType == "service_account")
+        #expect(named.actorID == accountID)
+    }
+
+    // MARK: - Endpoints
+
+    @Test("A filter matches on actor, type prefix and time window")
+    func filters() async throws {
+        try await withOrgAdmin(systemAdmin: true) { app, org, token in
+            let accountID = UUID()
+            let recent = try await saveEvent(
+                AuditRecord(
+                    eventType: "iam.cross_org_grant", organizationID: org.id,
+                    actorType: AuditActorType.serviceAccount.rawValue, actorID: accountID),
+                on: app.db)
+            try await saveEvent(
+                AuditRecord(
+                    eventType: "iam.cross_org_revoke", organizationID: org.id,
+                    actorType: AuditActorType.serviceAccount.rawValue, actorID: accountID),
+                ageHours: 48, on: app.db)
+            try await saveEvent(AuditRecord(eventType: "iam.cross_org_grant", userID: UUID()), on: app.db)
+            try await saveEvent(AuditRecord(eventType: "auth.login", organizationID: org.id), on: app.db)
+
+            let matched = try await query(
+                #"actor.type == "service_account" and type startsWith "iam." and time > -24h"#,
+                path: "/api/audit-events/query", token: token, app: app)
+            #expect(matched.total == 1)
+            #expect(matched.events?.map(\.id) == [recent.id])
+            #expect(matched.events?.first?.actorID == accountID)
+
+            let byID = try await query(
+                #"actor.id in ["\#(accountID.uuidString)"]"#, path: "/api/audit-events/query", token: token,
+                app: app)
+            #expect(byID.total == 2)
+
+            // `%` and `_` in a prefix match literally.
+            let literal = try await query(
+                #"type startsWith "iam%""#, path: "/api/audit-events/query", token: token, app: app)
+            #expect(literal.total == 0)
+        }
+    }
+
+    @Test("A missing value differs from every value, under not as well")
+    func nullSemantics() async throws {
+        try await withOrgAdmin(systemAdmin: true) { app, _, token in
+            try await saveEvent(AuditRecord(eventType: "test.a", resourceType: "vms"), on: app.db)
+            try await saveEvent(AuditRecord(eventType: "test.a"), on: app.db)
+
+            for source in [
+                #"type == "test.a" and resource.type != "vms""#,
+                #"type == "test.a" and not resource.type == "vms""#,
+                #"type == "test.a" and resource.type == null"#,
+            ] {
+                let result = try await query(source, path: "/api/audit-events/query", token: token, app: app)
+                #expect(result.total == 1, "\(source)")
+                #expect(result.events?.first?.resourceType == nil, "\(source)")
+            }
+        }
+    }
+
+    @Test("count by groups the matching events, largest group first")
+    func countsBy() async throws {
+        try await withOrgAdmin(systemAdmin: true) { app, _, token in
+            let alice = UUID()
+            for _ in 0..<3 {
+                try await saveEvent(
+                    AuditRecord(
+                        eventType: "api.request", userID: alice, username: "alice", method: "POST", status: 403,
+                        metadata: ["error": "denied"]),
+                    on: app.db)
+            }
+            try await saveEvent(
+                AuditRecord(eventType: "api.request", method: "POST", status: 401, metadata: ["error": "denied"]),
+                on: app.db)
+            try await saveEvent(AuditRecord(eventType: "api.request", method: "GET", status: 200), on: app.db)
+
+            let byActor = try await query(
+                "status >= 400 | count by actor", path: "/api/audit-events/query", token: token, app: app)
+            #expect(byActor.total == 4)
+            #expect(byActor.events == nil)
+            #expect(byActor.groupBy == ["actor.type", "actor.id", "actor.name"])
+            let groups = try #require(byActor.groups)
+            #expect(groups.map(\.count) == [3, 1])
+            #expect(groups.first?.key == ["actor.type": "user", "actor.id": alice.uuidString, "actor.name": "alice"])
+            #expect(groups.last?.key == ["actor.type": "anonymous"])
+
+            let byMetadata = try await query(
+                #"metadata.error == "denied" | count by metadata.error, status"#, path: "/api/audit-events/query",
+                token: token, app: app)
+            #expect(byMetadata.groups?.first?.key == ["metadata.error": "denied", "status": "403"])
+
+            let bare = try await query(
+                #"method == "POST" | count"#, path: "/api/audit-events/query", token: token, app: app)
+            #expect(bare.groups?.map(\.count) == [4])
+        }
+    }
+
+    @Test("The organization query stays within the organization and rejects invalid queries")
+    func organizationScope() async throws {
+        try await withOrgAdmin { app, org, token in
+            try await saveEvent(AuditRecord(eventType: "test.scope", organizationID: org.id), on: app.db)
+            try await saveEvent(AuditRecord(eventType: "test.scope", organizationID: UUID()), on: app.db)
+
+            let path = "/api/organizations/\(org.id!)/audit-events/query"
+            let result = try await query(#"type == "test.scope""#, path: path, token: token, app: app)
+            #expect(result.total == 1)
+            #expect(result.events?.first?.organizationID == org.id)
+
+            try await app.test(.GET, path) { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                try req.query.encode(["q": "nonsense =="])
+            } afterResponse: { res in
+                #expect(res.status == .badRequest)
+            }
+
+            // Only system administrators query across organizations.
+            try await app.test(.GET, "/api/audit-events/query") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+            } afterResponse: { res in
+                #expect(res.status == .forbidden)
+            }
+        }
+    }
+
+    // MARK: - Saved searches
+
+    private struct CreateBody: Content {
+        let name: String
+        let query: String
+        var description: String? = nil
+    }
+
+    @Test("Saved searches are validated, unique by name and listed")
+    func savedSearches() async throws {
+        try await withOrgAdmin { app, org, token in
+            let path = "/api/organizations/\(org.id!)/audit-searches"
+            var created: AuditSavedSearchResponse?
+            try await app.test(.POST, path) { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                try req.content.encode(CreateBody(name: "Failures", query: "status >= 500 | count by actor"))
+            } afterResponse: { res in
+                #expect(res.status == .ok)
+                created = try res.content.decode(AuditSavedSearchResponse.self)
+            }
+            let search = try #require(created)
+            #expect(search.query == "status >= 500 | count by actor")
+
+            for (body, status) in [
+                (CreateBody(name: "Failures", query: "status >= 400"), HTTPStatus.conflict),
+                (CreateBody(name: "Broken", query: "status >= \"x\""), .badRequest),
+                (CreateBody(name: "  ", query: "status >= 400"), .badRequest),
+            ] {
+                try await app.test(.POST, path) { req in
+                    req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                    try req.content.encode(body)
+                } afterResponse: { res in
+                    #expect(res.status == status, "\(body.name)")
+                }
+            }
+
+            try await app.test(.PATCH, "\(path)/\(search.id)") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                try req.content.encode(["query": "status >= 400"])
+            } afterResponse: { res in
+                #expect(res.status == .ok)
+                #expect(try res.content.decode(AuditSavedSearchResponse.self).query == "status >= 400")
+            }
+
+            try await app.test(.GET, path) { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+            } afterResponse: { res in
+                #expect(res.status == .ok)
+                #expect(try res.content.decode([AuditSavedSearchResponse].self).map(\.name) == ["Failures"])
+            }
+        }
+    }
+}
@@ -0,0 +1,313 @@
+import Fluent
+import Foundation
+import StratoShared
+import Testing
+import Vapor
+import VaporTesting
+
+@testable import App
+
+/// Automation rules: the expression language, rule management over HTTP,
+/// and matching and running rules as their service account.
+@Suite("Automation Rule Tests", .serialized)
+struct AutomationRuleTests {
+
+    // MARK: - Expressions
+
+    @Test("Expressions compare paths and literals; missing paths are null")
+    func evaluatesExpressions() throws {
+        let scope: [String: CodableValue] = [
+            "event": .object([
+                "type": .string("vm.state_changed"),
+                "data": .object(["newStatus": .string("Shutdown"), "count": .int(3)]),
+            ]),
+            "resource": .object(["tags": .object(["env": .string("prod")])]),
+        ]
+        let roots = AutomationRule.conditionRoots
+        func holds(_ source: String) throws -> Bool {
+            try AutomationExpression(source, roots: roots).evaluate(scope)
+        }
+
+        #expect(try holds(#"event.data.newStatus == "Shutdown""#))
+        #expect(try holds(#"event.data.count >= 3 && event.data.count < 4.5"#))
+        #expect(try holds(#"resource.tags.env in ['prod', 'staging']"#))
+        #expect(try holds(#"event.type contains "state""#))
+        #expect(try holds(#"!(event.data.newStatus == "Running") || false"#))
+        #expect(try holds("event.data.missing == null"))
+        #expect(try holds("event.data.missing > 1") == false)
+        #expect(try holds("event.data.count") == false)
+    }
+
+    @Test("Malformed expressions and unknown roots are parse errors")
+    func rejectsMalformedExpressions() {
+        let roots = AutomationRule.filterRoots
+        for source in [
+            "event.data ==", #"event.data.x == "open"#, "(event.x", "resource.tags.env == 1", "event. == 1",
+            "event.x == 1 1", String(repeating: "!", count: 40) + "true",
+        ] {
+            #expect(throws: AutomationExpression.ParseError.self) {
+                try AutomationExpression(source, roots: roots)
+            }
+        }
+    }
+
+    // MARK: - Fixture
+
+    private struct Fixture {
+        let org: Organization
+        let project: Project
+        let vm: VM
+        let admin: User
+        let adminToken: String
+        let memberToken: String
+        let account: ServiceAccount
+    }
+
+    private func withFixture(_ test: (Application, Fixture) async throws -> Void) async throws {
+        try await withTestApp { app in
+            let builder = TestDataBuilder(db: app.db)
+            let org = try await builder.createOrganization(name: "Automation Org")
+            let project = try await builder.createProject(
+                name: "Automation Project", description: "d", organization: org)
+            let vm = try await builder.createVM(name: "automation-vm", project: project, environment: "production")
+            vm.setStatus(.running)
+            vm.setDesiredStatus(.running)
+            try await vm.save(on: app.db)
+
+            var users: [(User, String)] = []
+            for (name, role) in [("automationadmin", "admin"), ("automationmember", "member")] {
+                let user = try await builder.createUser(
+                    username: name, email: "\(name)@example.com", isSystemAdmin: false)
+                try await builder.addUserToOrganization(user: user, organization: org, role: role)
+                user.currentOrganizationId = org.id
+                try await user.save(on: app.db)
+                users.append((user, try await user.generateAPIKey(on: app.db)))
+            }
+
+            let account = ServiceAccount(name: "automation", projectID: try project.requireID())
+            try await account.save(on: app.db)
+            try await test(
+                app,
+                Fixture(
+                    org: org, project: project, vm: vm, admin: users[0].0, adminToken: users[0].1,
+                    memberToken: users[1].1, account: account))
+        }
+    }
+
+    private func grant(_ role: IAMRole, to account: ServiceAccount, on project: Project, _ app: Application)
+        async throws
+    {
+        try await RoleBindingService.grant(
+            principalType: .serviceAccount,
+            principalID: account.requireID(),
+            role: role,
+            nodeType: .project,
+            nodeID: project.requireID(),
+            createdBy: nil,
+            on: app.db)
+    }
+
+    private func makeRule(
+        _ app: Application, _ fixture: Fixture, filter: String = "", conditions: [String] = [],
+        actions: [AutomationAction], maxRunsPerHour: Int = AutomationRule.defaultMaxRunsPerHour
+    ) async throws -> AutomationRule {
+        let rule = AutomationRule(
+            projectID: try fixture.project.requireID(),
+            name: "rule-\(UUID().uuidString.prefix(8))",
+            triggerEventType: .vmStateChanged,
+            filter: filter,
+            conditions: conditions,
+            actions: actions,
+            serviceAccountID: try fixture.account.requireID(),
+            maxRunsPerHour: maxRunsPerHour,
+            signingSecret: try app.secretsEncryption.encrypt(WebhookSubscription.generateSigningSecret()),
+            createdByID: try fixture.admin.requireID())
+        try await rule.save(on: app.db)
+        return rule
+    }
+
+    private func stateChanged(_ fixture: Fixture, to status: VMStatus) throws -> WebhookEvent {
+        WebhookEvent(
+            type: .vmStateChanged, organizationID: try fixture.org.requireID(), projectID: fixture.project.id,
+            resource: .init(kind: "virtual_machine", id: try fixture.vm.requireID(), name: fixture.vm.name),
+            data: ["previousStatus": .string("Running"), "newStatus": .string(status.rawValue)])
+    }
+
+    private func runs(of rule: AutomationRule, _ app: Application) async throws -> [AutomationRun] {
+        try await AutomationRun.query(on: app.db)
+            .filter(\.$rule.$id == rule.requireID())
+            .sort(\.$createdAt)
+            .all()
+    }
+
+    // MARK: - HTTP
+
+    @Test("Rules are created with a one-time secret, validated, and need impersonation of their account")
+    func manageRules() async throws {
+        try await withFixture { app, fixture in
+            let projectID = try fixture.project.requireID()
+            let path = "/api/projects/\(projectID)/automation-rules"
+            let body = CreateAutomationRuleRequest(
+                name: "snapshot-on-stop", description: nil, triggerEventType: "vm.state_changed",
+                filter: #"event.data.newStatus == "Shutdown""#, conditions: [#"resource.environment == "production""#],
+                actions: [AutomationAction(type: .snapshot), AutomationAction(type: .notify, message: "stopped")],
+                serviceAccountId: try fixture.account.requireID(), maxRunsPerHour: nil)
+
+            var ruleID: UUID?
+            try await app.test(.POST, path) { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: fixture.adminToken)
+                try req.content.encode(body)
+            } afterResponse: { res in
+                #expect(res.status == .created)
+                let created = try res.content.decode(AutomationRuleWithSecretResponse.self)
+                #expect(!created.signingSecret.isEmpty)
+                #expect(created.rule.maxRunsPerHour == AutomationRule.defaultMaxRunsPerHour)
+                ruleID = created.rule.id
+            }
+            let id = try #require(ruleID)
+
+            try await app.test(.GET, "\(path)/\(id)") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: fixture.adminToken)
+            } afterResponse: { res in
+                #expect(res.status == .ok)
+                #expect(!res.body.string.contains("signingSecret"))
+            }
+
+            // A bare org member may neither read nor write the project's rules.
+            try await app.test(.GET, path) { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: fixture.memberToken)
+            } afterResponse: { res in
+                #expect(res.status == .forbidden)
+            }
+
+            let invalid: [CreateAutomationRuleRequest] = [
+                CreateAutomationRuleRequest(
+                    name: "bad-filter", description: nil, triggerEventType: "vm.state_changed",
+                    filter: "resource.status == 1", conditions: nil, actions: [AutomationAction(type: .stop)],
+                    serviceAccountId: try fixture.account.requireID(), maxRunsPerHour: nil),
+                CreateAutomationRuleRequest(
+                    name: "bad-trigger", description: nil, triggerEventType: "webhook.test",
+                    filter: nil, conditions: nil, actions: [AutomationAction(type: .stop)],
+                    serviceAccountId: try fixture.account.requireID(), maxRunsPerHour: nil),
+                CreateAutomationRuleRequest(
+                    name: "bad-action", description: nil, triggerEventType: "vm.state_changed",
+                    filter: nil, conditions: nil, actions: [AutomationAction(type: .notify)],
+                    serviceAccountId: try fixture.account.requireID(), maxRunsPerHour: nil),
+                CreateAutomationRuleRequest(
+                    name: "no-account", description: nil, triggerEventType: "vm.state_changed",
+                    filter: nil, conditions: nil, actions: [AutomationAction(type: .stop)],
+                    serviceAccountId: UUID(), maxRunsPerHour: nil),
+                CreateAutomationRuleRequest(
+                    name: "too-fast", description: nil, triggerEventType: "vm.state_changed",
+                    filter: nil, conditions: nil, actions: [AutomationAction(type: .stop)],
+                    serviceAccountId: try fixture.account.requireID(), maxRunsPerHour: 5000),
+            ]
+            for request in invalid {
+                try await app.test(.POST, path) { req in
+                    req.headers.bearerAuthorization = BearerAuthorization(token: fixture.adminToken)
+                    try req.content.encode(request)
+                } afterResponse: { res in
+                    #expect(res.status == .badRequest, "\(request.name)")
+                }
+            }
+
+            try await app.test(.POST, path) { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: fixture.adminToken)
+                try req.content.encode(body)
+            } afterResponse: { res in
+                #expect(res.status == .conflict)
+            }
+        }
+    }
+
+    // MARK: - Matching and running
+
+    @Test("A matching event runs the actions as the service account")
+    func runsActions() async throws {
+        try await withFixture { app, fixture in
+            try await grant(.editor, to: fixture.account, on: fixture.project, app)
+            let rule = try await makeRule(
+                app, fixture, filter: #"event.data.newStatus == "Paused""#,
+                conditions: [#"resource.environment == "production""#],
+                actions: [
+                    AutomationAction(type: .stop),
+                    AutomationAction(type: .tag, tags: ["stopped-by": "automation"]),
+                    AutomationAction(type: .notify, message: "VM paused and stopped"),
+                ])
+
+            // Filtered out: no run.
+            try await WebhookEvents.enqueue(try stateChanged(fixture, to: .shutdown), on: app.db)
+            #expect(try await runs(of: rule, app).isEmpty)
+
+            try await WebhookEvents.enqueue(try stateChanged(fixture, to: .paused), on: app.db)
+            await app.automation.sweepOnce(acquiringLock: false)
+
+            let run = try #require(try await runs(of: rule, app).first)
+            #expect(run.statusValue == .succeeded)
+            #expect(run.steps.map(\.action) == [.stop, .tag, .notify])
+            #expect(run.steps.allSatisfy { $0.status == .succeeded })
+
+            let vm = try #require(try await VM.find(fixture.vm.id, on: app.db))
+            #expect(vm.desiredStatus == .shutdown)
+            #expect(vm.tags == ["stopped-by": "automation"])
+
+            let operation = try #require(
+                try await ResourceOperation.find(try #require(run.steps.first?.operationId), on: app.db))
+            #expect(operation.userID == fixture.account.id)
+
+            let notification = try await ResourceEvent.query(on: app.db)
+                .filter(\.$type == WebhookEventType.automationNotification.rawValue)
+                .first()
+            #expect(notification != nil)
+
+            let audited = try await AuditEvent.query(on: app.db)
+                .filter(\.$eventType == AuditEventType.automationAction.rawValue)
+                .count()
+            #expect(audited == 3)
+        }
+    }
+
+    @Test("Actions the service account may not take fail the run; unmet conditions skip it")
+    func enforcesAuthorityAndConditions() async throws {
+        try await withFixture { app, fixture in
+            // No binding at all: the account can do nothing.
+            let denied = try await makeRule(
+                app, fixture, actions: [AutomationAction(type: .stop), AutomationAction(type: .notify, message: "x")])
+            let gated = try await makeRule(
+                app, fixture, conditions: [#"resource.tags.team == "payments""#],
+                actions: [AutomationAction(type: .stop)])
+
+            try await WebhookEvents.enqueue(try stateChanged(fixture, to: .paused), on: app.db)
+            await app.automation.sweepOnce(acquiringLock: false)
+
+            let deniedRun = try #require(try await runs(of: denied, app).first)
+            #expect(deniedRun.statusValue == .failed)
+            #expect(deniedRun.steps.count == 1)
+            #expect(deniedRun.error?.contains("not allowed") == true)
+
+            let gatedRun = try #require(try await runs(of: gated, app).first)
+            #expect(gatedRun.statusValue == .skipped)
+            #expect(gatedRun.steps.isEmpty)
+
+            let vm = try #require(try await VM.find(fixture.vm.id, on: app.db))
+            #expect(vm.desiredStatus == .running)
+        }
+    }
+
+    @Test("Matches past the hourly limit are recorded as rate limited and never run")
+    func rateLimits() async throws {
+        try await withFixture { app, fixture in
+            let rule = try await makeRule(
+                app, fixture, actions: [AutomationAction(type: .notify, message: "x")], maxRunsPerHour: 2)
+
+            for _ in 0..<3 {
+                try await WebhookEvents.enqueue(try stateChanged(fixture, to: .paused), on: app.db)
+            }
+            await app.automation.sweepOnce(acquiringLock: false)
+
+            let statuses = try await runs(of: rule, app).map(\.statusValue)
+            #expect(statuses.filter { $0 == .succeeded }.count == 2)
+            #expect(statuses.filter { $0 == .rateLimited }.count == 1)
+        }
+    }
+}
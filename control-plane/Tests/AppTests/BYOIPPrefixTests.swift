@@ -0,0 +1,207 @@
+import Crypto
+import Fluent
+import Foundation
+import Testing
+import Vapor
+import VaporTesting
+import X509
+
+@testable import App
+
+/// Bring-your-own IP prefixes: registering, proving control by ROA or by a
+/// signed challenge, the pool a verified prefix becomes, and withdrawing it.
+@Suite("BYOIP Prefix Tests", .serialized)
+struct BYOIPPrefixTests {
+
+    private struct StubEvidence: BYOIPEvidenceSource {
+        var validity: RouteOriginValidity = .notFound
+        var remarks: [String] = []
+
+        func routeOriginValidity(prefix: String, asn: Int) async throws -> RouteOriginValidity { validity }
+        func rdapRemarks(prefix: String) async throws -> [String] { remarks }
+    }
+
+    private func withOrgAdmin(_ test: (Application, Organization, String) async throws -> Void) async throws {
+        try await withTestApp { app in
+            app.byoipConfig = BYOIPConfig(
+                rpkiValidatorURL: "http://validator.invalid", originASN: 64500, rdapBaseURL: "http://rdap.invalid")
+            app.byoipEvidence = StubEvidence()
+            let builder = TestDataBuilder(db: app.db)
+            let user = try await builder.createUser(
+                username: "prefixadmin", email: "prefixadmin@example.com", isSystemAdmin: false)
+            let org = try await builder.createOrganization(name: "Prefix Org")
+            try await builder.addUserToOrganization(user: user, organization: org, role: "admin")
+            user.currentOrganizationId = org.id
+            try await user.save(on: app.db)
+            let token = try await user.generateAPIKey(on: app.db)
+            try await test(app, org, token)
+        }
+    }
+
+    private func register(
+        _ cidr: String, method: BYOIPVerificationMethod, org: Organization, token: String, app: Application
+    ) async throws -> (HTTPStatus, BYOIPPrefixResponse?) {
+        var result: (HTTPStatus, BYOIPPrefixResponse?) = (.internalServerError, nil)
+        try await app.test(.POST, "/api/byoip-prefixes") { req in
+            req.headers.bearerAuthorization = BearerAuthorization(token: token)
+            try req.content.encode(
+                CreateBYOIPPrefixRequest(
+                    organizationId: org.id!, cidr: cidr, verificationMethod: method, siteId: nil, poolName: nil))
+        } afterResponse: { res in
+            result = (res.status, res.status == .ok ? try res.content.decode(BYOIPPrefixResponse.self) : nil)
+        }
+        return result
+    }
+
+    private func verify(
+        _ prefix: BYOIPPrefixResponse, signature: String? = nil, token: String, app: Application
+    ) async throws -> BYOIPPrefixResponse {
+        var result: BYOIPPrefixResponse?
+        try await app.test(.POST, "/api/byoip-prefixes/\(prefix.id)/verify") { req in
+            req.headers.bearerAuthorization = BearerAuthorization(token: token)
+            try req.content.encode(VerifyBYOIPPrefixRequest(signature: signature))
+        } afterResponse: { res in
+            #expect(res.status == .ok)
+            result = try res.content.decode(BYOIPPrefixResponse.self)
+        }
+        return try #require(result)
+    }
+
+    @Test("A ROA for the platform's ASN and the challenge in RDAP turn the prefix into the organization's pool")
+    func roaVerification() async throws {
+        try await withOrgAdmin { app, org, token in
+            let tooLong = try await register("198.51.100.0/25", method: .roa, org: org, token: token, app: app)
+            #expect(tooLong.0 == .badRequest)
+            let registered = try await register("198.51.100.77/24", method: .roa, org: org, token: token, app: app)
+            let prefix = try #require(registered.1)
+            #expect(prefix.cidr == "198.51.100.0/24")
+            #expect(prefix.status == "pending")
+            #expect(prefix.originAsn == 64500)
+
+            let failed = try await verify(prefix, token: token, app: app)
+            #expect(failed.status == "failed")
+            #expect(failed.statusMessage?.contains("not-found") == true)
+            #expect(failed.poolId == nil)
+
+            // The ROA alone names the platform's AS, not the organization.
+            app.byoipEvidence = StubEvidence(validity: .valid)
+            let unbound = try await verify(prefix, token: token, app: app)
+            #expect(unbound.status == "failed")
+            #expect(unbound.statusMessage?.contains("challenge") == true)
+
+            app.byoipEvidence = StubEvidence(
+                validity: .valid, remarks: ["Strato BYOIP: \(prefix.challenge)", "Abuse: abuse@example.com"])
+            let verified = try await verify(prefix, token: token, app: app)
+            #expect(verified.status == "verified")
+            let poolID = try #require(verified.poolId)
+            let pool = try #require(try await FloatingIPPool.find(poolID, on: app.db))
+            #expect(pool.cidr == "198.51.100.0/24")
+            #expect(pool.$organization.id == org.id)
+            #expect(pool.$byoipPrefix.id == prefix.id)
+
+            // The space is taken now, and the pool goes only with its prefix.
+            let overlapping = try await register("198.51.100.128/25", method: .roa, org: org, token: token, app: app)
+            #expect(overlapping.0 == .conflict)
+            try await app.test(.DELETE, "/api/floating-ip-pools/\(poolID)") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+            } afterResponse: { res in
+                #expect(res.status == .conflict)
+            }
+            try await app.test(.DELETE, "/api/byoip-prefixes/\(prefix.id)") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+            } afterResponse: { res in
+                #expect(res.status == .noContent)
+            }
+            #expect(try await FloatingIPPool.find(poolID, on: app.db) == nil)
+        }
+    }
+
+    @Test("A signed challenge verifies against the certificate in the prefix's RDAP remarks")
+    func signedChallengeVerification() async throws {
+        try await withOrgAdmin { app, org, token in
+            let prefix = try #require(
+                try await register("192.0.2.0/24", method: .signedChallenge, org: org, token: token, app: app).1)
+            #expect(prefix.challenge.hasPrefix("strato-byoip:\(org.id!.uuidString.lowercased()):192.0.2.0/24:"))
+
+            let key = P256.Signing.PrivateKey()
+            let certificateKey = Certificate.PrivateKey(key)
+            let name = try DistinguishedName { CommonName("192.0.2.0/24") }
+            let certificate = try Certificate(
+                version: .v3, serialNumber: .init(), publicKey: certificateKey.publicKey,
+                notValidBefore: Date().addingTimeInterval(-60), notValidAfter: Date().addingTimeInterval(86400),
+                issuer: name, subject: name, signatureAlgorithm: .ecdsaWithSHA256,
+                extensions: Certificate.Extensions(), issuerPrivateKey: certificateKey)
+            // RIR databases reflow remarks; the certificate spans several.
+            let pem = try certificate.serializeAsPEM().pemString
+            app.byoipEvidence = StubEvidence(
+                remarks: ["Strato BYOIP authorization:"] + pem.split(separator: "\n").map { "  \($0)  " })
+
+            let challenge = Data(prefix.challenge.utf8)
+            let forged = try P256.Signing.PrivateKey().signature(for: challenge).derRepresentation
+            let rejected = try await verify(prefix, signature: forged.base64EncodedString(), token: token, app: app)
+            #expect(rejected.status == "failed")
+
+            let signature = try key.signature(for: challenge).derRepresentation
+            let verified = try await verify(prefix, signature: signature.base64EncodedString(), token: token, app: app)
+            #expect(verified.status == "verified")
+            #expect(verified.poolId != nil)
+        }
+    }
+
+    @Test("Only one registration of a prefix can be verified, even when both pass their checks at once")
+    func verifiedCIDRIsUnique() async throws {
+        try await withOrgAdmin { app, org, _ in
+            let builder = TestDataBuilder(db: app.db)
+            let rival = try await builder.createOrganization(name: "Rival Org")
+            var rows: [BYOIPPrefix] = []
+            for orgID in [try org.requireID(), try rival.requireID()] {
+                let row = BYOIPPrefix(
+                    organizationID: orgID, siteID: nil, cidr: "203.0.113.0/24", poolName: "byoip-\(orgID)",
+                    verificationMethod: .roa,
+                    challenge: BYOIPPrefix.makeChallenge(organizationID: orgID, cidr: "203.0.113.0/24"))
+                try await row.save(on: app.db)
+                rows.append(row)
+            }
+
+            // What both verify calls would write after passing the overlap
+            // check before either committed.
+            rows[0].status = BYOIPPrefixStatus.verified.rawValue
+            try await rows[0].save(on: app.db)
+            rows[1].status = BYOIPPrefixStatus.verified.rawValue
+            await #expect(throws: (any Error).self) { try await rows[1].save(on: app.db) }
+        }
+    }
+
+    @Test("A prefix overlapping a verified one cannot be verified, even when both pass their checks at once")
+    func verifiedPrefixesDoNotOverlap() async throws {
+        try await withOrgAdmin { app, org, _ in
+            let rival = try await TestDataBuilder(db: app.db).createOrganization(name: "Rival Org")
+            func verifiedRow(_ cidr: String, orgID: UUID) -> BYOIPPrefix {
+                let row = BYOIPPrefix(
+                    organizationID: orgID, siteID: nil, cidr: cidr, poolName: "byoip-\(UUID())",
+                    verificationMethod: .roa,
+                    challenge: BYOIPPrefix.makeChallenge(organizationID: orgID, cidr: cidr))
+                row.status = BYOIPPrefixStatus.verified.rawValue
+                return row
+            }
+
+            try await verifiedRow("203.0.113.0/24", orgID: try org.requireID()).save(on: app.db)
+
+            // A more-specific inside it is the same space under another name.
+            var thrown: (any Error)?
+            do {
+                try await verifiedRow("203.0.113.128/25", orgID: try rival.requireID()).save(on: app.db)
+            } catch {
+                thrown = error
+            }
+            #expect((thrown as? any DatabaseError)?.isConstraintFailure == true)
+
+            // The neighbouring /24 shares no address, and a pending overlap
+            // is only a claim.
+            try await verifiedRow("198.51.100.0/24", orgID: try rival.requireID()).save(on: app.db)
+            let pending = verifiedRow("203.0.112.0/23", orgID: try rival.requireID())
+            pending.status = BYOIPPrefixStatus.pending.rawValue
+            try await pending.save(on: app.db)
+        }
+    }
+}
@@ -0,0 +1,291 @@
+import Fluent
+import Foundation
+import StratoShared
+import Testing
+import Vapor
+import VaporTesting
+
+@testable import App
+
+/// S3 buckets: the desired-state entries with their grants compiled from
+/// Cedar policy per access key, the observed report moving status and
+/// confirming deletes, and the create and access-key APIs.
+@Suite("Bucket Tests", .serialized)
+struct BucketTests {
+
+    private struct Fixture {
+        let app: Application
+        let user: User
+        let token: String
+        let project: Project
+    }
+
+    private func withBucketApp(_ test: (Fixture) async throws -> Void) async throws {
+        try await withTestApp { app in
+            let builder = TestDataBuilder(db: app.db)
+            let user = try await builder.createUser(username: "bucket-user", email: "bucket-user@example.com")
+            let org = try await builder.createOrganization(name: "Bucket Org")
+            try await builder.addUserToOrganization(user: user, organization: org, role: "admin")
+            user.currentOrganizationId = org.id
+            try await user.save(on: app.db)
+            let project = try await builder.createProject(
+                name: "Bucket Project", description: "object storage", organization: org)
+
+            try await test(
+                Fixture(app: app, user: user, token: try await user.generateAPIKey(on: app.db), project: project))
+        }
+    }
+
+    private func registerAgent(
+        _ app: Application, name: String, protocolVersion: Int, capabilities: [String]
+    ) async throws -> String {
+        let message = AgentRegisterMessage(
+            agentId: name,
+            hostname: "\(name).example",
+            version: "1.0.0",
+            capabilities: capabilities,
+            resources: AgentResources(
+                totalCPU: 16, availableCPU: 16,
+                totalMemory: 1 << 34, availableMemory: 1 << 34,
+                totalDisk: 1 << 40, availableDisk: 1 << 40
+            ),
+            protocolVersion: protocolVersion
+        )
+        let orgID = try await Organization.query(on: app.db).sort(\.$createdAt).first()?.id
+        return try await app.agentService.registerAgent(
+            message, agentName: name, organizationScope: orgID.map { .organization($0) }
+        ).uuidString
+    }
+
+    private func placeBucket(
+        _ fixture: Fixture, name: String = "team-data", on agentId: String
+    ) async throws -> Bucket {
+        let bucket = Bucket(
+            name: name, projectID: try fixture.project.requireID(), environment: "development",
+            quotaBytes: 1 << 30)
+        bucket.hypervisorId = agentId
+        try await bucket.save(on: fixture.app.db)
+        return bucket
+    }
+
+    private func report(agentId: String, buckets: [ObservedBucketState]) -> ObservedStateReport {
+        ObservedStateReport(
+            agentId: agentId,
+            vms: [],
+            resources: AgentResources(
+                totalCPU: 16, availableCPU: 16,
+                totalMemory: 1 << 34, availableMemory: 1 << 34,
+                totalDisk: 1 << 40, availableDisk: 1 << 40
+            ),
+            buckets: buckets
+        )
+    }
+
+    // MARK: - Sync and report
+
+    @Test("the sync grants a key what its owner may do, and withholds keys with no grant")
+    func syncCompilesGrants() async throws {
+        try await withBucketApp { fixture in
+            let app = fixture.app
+            let agentId = try await registerAgent(
+                app, name: "gateway-host", protocolVersion: WireProtocol.currentVersion,
+                capabilities: [StorageCapability.objectGateway])
+            let bucket = try await placeBucket(fixture, on: agentId)
+
+            let ownKey = ObjectStorageAccessKey(
+                accessKeyId: "SKOWNER0000000000000", secret: "owner-secret", name: "ci",
+                userID: try fixture.user.requireID(), createdBy: try fixture.user.requireID())
+            try await ownKey.save(on: app.db)
+            // A user with no binding anywhere near the bucket.
+            let stranger = try await TestDataBuilder(db: app.db).createUser(
+                username: "stranger", email: "stranger@example.com")
+            let strangerKey = ObjectStorageAccessKey(
+                accessKeyId: "SKSTRANGER0000000000", secret: "stranger-secret", name: "nope",
+                userID: try stranger.requireID(), createdBy: try stranger.requireID())
+            try await strangerKey.save(on: app.db)
+
+            let message = try await app.desiredStateAssembler.assemble(agentId: agentId)
+            let storage = try #require(message.objectStorage)
+            let entry = try #require(storage.buckets.first)
+            #expect(entry.bucketId == bucket.id)
+            #expect(entry.name == "team-data")
+            #expect(entry.quotaBytes == 1 << 30)
+            #expect(entry.grants.map(\.accessKeyId) == ["SKOWNER0000000000000"])
+            #expect(Set(entry.grants.first?.permissions ?? []) == Set(ObjectPermission.allCases))
+            #expect(
+                storage.credentials
+                    == [ObjectGatewayCredential(accessKeyId: "SKOWNER0000000000000", secretAccessKey: "owner-secret")])
+        }
+    }
+
+    @Test("the sync only checks keys of candidate principals, until an authored permit widens it to all")
+    func syncScopesKeysToCandidates() async throws {
+        try await withBucketApp { fixture in
+            let app = fixture.app
+            let agentId = try await registerAgent(
+                app, name: "gateway-host", protocolVersion: WireProtocol.currentVersion,
+                capabilities: [StorageCapability.objectGateway])
+            let bucket = try await placeBucket(fixture, on: agentId)
+            let node = IAMNode(type: .bucket, id: try bucket.requireID())
+            let stranger = try await TestDataBuilder(db: app.db).createUser(
+                username: "outsider", email: "outsider@example.com")
+            try await ObjectStorageAccessKey(
+                accessKeyId: "SKOUTSIDER0000000000", secret: "outsider-secret", name: "reader",
+                userID: try stranger.requireID(), createdBy: try stranger.requireID()
+            ).save(on: app.db)
+
+            let actions = DesiredStateAssembler.objectPermissionActions.map(\.1)
+            let candidates = try #require(
+                try await WhoCanService.candidatePrincipals(actions: actions, nodes: [node], on: app.db))
+            #expect(candidates.contains(WhoCanPrincipalRef(type: .user, id: try fixture.user.requireID())))
+            #expect(!candidates.contains(WhoCanPrincipalRef(type: .user, id: try stranger.requireID())))
+
+            // An authored permit can name anyone, so the candidate set is
+            // unbounded and the stranger's key is checked — and granted.
+            let projectID = try fixture.project.requireID()
+            let id = UUID()
+            let text =
+                "permit(principal, action in [Action::\"bucket:getObject\"], resource in \(IAMNode(type: .project, id: projectID).cedarUID.cedarLiteral));"
+            let prepared = try await PolicyStore.prepare(
+                id: id, cedarText: text, ownerType: .project, ownerID: projectID,
+                engine: app.cedarEngine, on: app.db)
+            _ = try await PolicyStore.create(
+                id: id, name: "outsider-reads", description: nil, ownerType: .project,
+                ownerID: projectID, prepared: prepared, createdBy: nil, enabled: true, on: app.db)
+            await app.cedarPolicySet.rebuild(
+                version: try await PolicySetVersionService.current(on: app.db), on: app.db)
+
+            #expect(try await WhoCanService.candidatePrincipals(actions: actions, nodes: [node], on: app.db) == nil)
+            let message = try await app.desiredStateAssembler.assemble(agentId: agentId)
+            let grants = try #require(message.objectStorage?.buckets.first?.grants)
+            #expect(grants.first { $0.accessKeyId == "SKOUTSIDER0000000000" }?.permissions == [.read])
+        }
+    }
+
+    @Test("an agent below v25 gets no opinion on object storage")
+    func oldAgentGetsNil() async throws {
+        try await withBucketApp { fixture in
+            let agentId = try await registerAgent(
+                fixture.app, name: "old-host", protocolVersion: WireProtocol.objectStorageMinimumVersion - 1,
+                capabilities: [])
+            let message = try await fixture.app.desiredStateAssembler.assemble(agentId: agentId)
+            #expect(message.objectStorage == nil)
+        }
+    }
+
+    @Test("a converged report makes the bucket available; absence confirms a delete and removes the row")
+    func reportMovesStatus() async throws {
+        try await withBucketApp { fixture in
+            let app = fixture.app
+            let agentId = try await registerAgent(
+                app, name: "gateway-host", protocolVersion: WireProtocol.currentVersion,
+                capabilities: [StorageCapability.objectGateway])
+            let bucketID = try await placeBucket(fixture, on: agentId).requireID()
+
+            // Not yet received by the agent: absence is not a loss.
+            try await app.observedStateApplier.apply(report(agentId: agentId, buckets: []))
+            #expect(try await Bucket.find(bucketID, on: app.db)?.status == .creating)
+
+            try await app.observedStateApplier.apply(
+                report(
+                    agentId: agentId,
+                    buckets: [
+                        ObservedBucketState(
+                            bucketId: bucketID, status: .available, observedGeneration: 1, usedBytes: 2048,
+                            objectCount: 2, endpoint: "https://s3.example.com")
+                    ]))
+            let available = try #require(try await Bucket.find(bucketID, on: app.db))
+            #expect(available.status == .available)
+            #expect(available.usedBytes == 2048)
+            #expect(available.objectCount == 2)
+            #expect(available.endpoint == "https://s3.example.com")
+
+            available.setDesiredStatus(.absent)
+            available.setStatus(.deleting)
+            try await available.save(on: app.db)
+            try await app.observedStateApplier.apply(report(agentId: agentId, buckets: []))
+            #expect(try await Bucket.find(bucketID, on: app.db) == nil)
+        }
+    }
+
+    // MARK: - API
+
+    private func create(
+        _ fixture: Fixture, name: String, _ assertions: (TestingHTTPResponse) throws -> Void
+    ) async throws {
+        try await fixture.app.test(.POST, "/api/buckets") { req in
+            req.headers.bearerAuthorization = BearerAuthorization(token: fixture.token)
+            try req.content.encode(
+                CreateBucketRequest(
+                    name: name, description: nil, projectId: fixture.project.id, environment: nil,
+                    poolId: nil, quotaBytes: nil))
+        } afterResponse: { res in
+            try assertions(res)
+        }
+    }
+
+    @Test("creation places the bucket on a gateway agent and refuses invalid or taken names")
+    func createPlacesAndValidates() async throws {
+        try await withBucketApp { fixture in
+            let agentId = try await registerAgent(
+                fixture.app, name: "gateway-host", protocolVersion: WireProtocol.currentVersion,
+                capabilities: [StorageCapability.objectGateway])
+
+            try await create(fixture, name: "Not_Valid") { res in
+                #expect(res.status == .badRequest)
+            }
+            try await create(fixture, name: "team-data") { res in
+                #expect(res.status == .created)
+                let bucket = try res.content.decode(BucketResponse.self)
+                #expect(bucket.status == .creating)
+                #expect(bucket.hypervisorId == agentId)
+            }
+            try await create(fixture, name: "team-data") { res in
+                #expect(res.status == .conflict)
+            }
+            #expect(try await Bucket.query(on: fixture.app.db).count() == 1)
+        }
+    }
+
+    @Test("with no gateway agent, creation is refused before anything is written")
+    func noCapableAgent() async throws {
+        try await withBucketApp { fixture in
+            _ = try await registerAgent(
+                fixture.app, name: "plain-host", protocolVersion: WireProtocol.currentVersion, capabilities: [])
+
+            try await create(fixture, name: "team-data") { res in
+                #expect(res.status == .conflict)
+                #expect(res.body.string.contains(StorageCapability.objectGateway))
+            }
+            #expect(try await Bucket.query(on: fixture.app.db).count() == 0)
+        }
+    }
+
+    @Test("an access key's secret is returned once and never listed")
+    func accessKeySecretShownOnce() async throws {
+        try await withBucketApp { fixture in
+            var accessKeyId = ""
+            try await fixture.app.test(.POST, "/api/object-storage/access-keys") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: fixture.token)
+                try req.content.encode(CreateObjectStorageAccessKeyRequest(name: "ci", serviceAccountId: nil))
+            } afterResponse: { res in
+                #expect(res.status == .created)
+                let created = try res.content.decode(CreatedObjectStorageAccessKeyResponse.self)
+                #expect(created.key.accessKeyId.hasPrefix("SK"))
+                #expect(created.key.accessKeyId.count == 20)
+                #expect(created.secretAccessKey.count == 40)
+                #expect(created.key.userId == fixture.user.id)
+                accessKeyId = created.key.accessKeyId
+            }
+
+            try await fixture.app.test(.GET, "/api/object-storage/access-keys") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: fixture.token)
+            } afterResponse: { res in
+                #expect(res.status == .ok)
+                let keys = try res.content.decode([ObjectStorageAccessKeyResponse].self)
+                #expect(keys.map(\.accessKeyId) == [accessKeyId])
+                #expect(!res.body.string.contains("secret"))
+            }
+        }
+    }
+}
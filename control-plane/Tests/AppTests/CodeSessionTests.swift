@@ -0,0 +1,261 @@
+import Fluent
+import StratoShared
+import Testing
+import Vapor
+import VaporTesting
+
+@testable import App
+
+/// Code-interpreter sessions (`/api/code-sessions`): creation provisions a
+/// sandbox through the ordinary sandbox path, executions are refused until
+/// the session can run code, and the idle sweep tears down sessions it can
+/// no longer resume. No agent exists in these tests, so the exec path itself
+/// is covered by the `SandboxExecSessionManager` tests.
+@Suite("Code Session Tests", .serialized)
+final class CodeSessionTests {
+
+    private func withCodeSessionTestApp(
+        _ test: (Application, User, Project, String) async throws -> Void
+    ) async throws {
+        let app = try await Application.makeForTesting()
+
+        do {
+            try await configure(app)
+            try await app.autoMigrate()
+
+            let builder = TestDataBuilder(db: app.db)
+            let user = try await builder.createUser(
+                username: "codeuser",
+                email: "code@example.com",
+                displayName: "Code User",
+                isSystemAdmin: false
+            )
+            let org = try await builder.createOrganization(name: "Code Org")
+            try await builder.addUserToOrganization(user: user, organization: org, role: "admin")
+            user.currentOrganizationId = org.id
+            try await user.save(on: app.db)
+
+            let project = try await builder.createProject(
+                name: "Code Project",
+                description: "Project for code session tests",
+                organization: org
+            )
+            let token = try await user.generateAPIKey(on: app.db)
+            app.codeSessions.configuration.images = [.python: "ghcr.io/acme/code-python:v1"]
+
+            try await test(app, user, project, token)
+        } catch {
+            try await app.shutdownForTesting()
+            throw error
+        }
+
+        try await app.shutdownForTesting()
+    }
+
+    /// A session on a fresh sandbox with the given observed status.
+    private func makeSession(
+        app: Application,
+        user: User,
+        project: Project,
+        sandboxStatus: SandboxStatus,
+        state: CodeSessionState = .active,
+        lastActivityAt: Date = Date()
+    ) async throws -> (CodeSession, Sandbox) {
+        let sandbox = try await TestDataBuilder(db: app.db).createSandbox(name: "code-sandbox", project: project)
+        sandbox.setStatus(sandboxStatus)
+        try await sandbox.save(on: app.db)
+        let session = CodeSession(
+            sandboxID: try sandbox.requireID(), projectID: try project.requireID(), language: .python,
+            idleTimeoutSeconds: 60, createdByID: try user.requireID(), now: lastActivityAt)
+        session.state = state
+        if state == .checkpointed {
+            session.checkpointedAt = lastActivityAt
+        }
+        try await session.save(on: app.db)
+        return (session, sandbox)
+    }
+
+    private func deleteOperationCount(for sandbox: Sandbox, on db: any Database) async throws -> Int {
+        try await ResourceOperation.query(on: db)
+            .filter(\.$resourceKind == .sandbox)
+            .filter(\.$resourceID == sandbox.requireID())
+            .filter(\.$kind == .delete)
+            .count()
+    }
+
+    // MARK: - Create
+
+    @Test("POST /api/code-sessions provisions a running sandbox with the kernel")
+    func createProvisionsSandbox() async throws {
+        try await withCodeSessionTestApp { app, user, project, token in
+            var created: CodeSessionResponse?
+            try await app.test(.POST, "/api/code-sessions") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                try req.content.encode([
+                    "language": "python",
+                    "projectId": project.id!.uuidString,
+                ])
+            } afterResponse: { res in
+                #expect(res.status == .created)
+                created = try res.content.decode(CodeSessionResponse.self)
+            }
+
+            let response = try #require(created)
+            #expect(response.language == .python)
+            #expect(response.status == .starting)
+            #expect(response.idleTimeoutSeconds == CodeSession.defaultIdleTimeoutSeconds)
+
+            let session = try #require(await CodeSession.find(response.id, on: app.db))
+            #expect(session.$sandbox.id == response.sandboxId)
+            #expect(session.$createdBy.id == user.id)
+
+            let sandbox = try #require(await Sandbox.find(response.sandboxId, on: app.db))
+            #expect(sandbox.image == "ghcr.io/acme/code-python:v1")
+            #expect(sandbox.cmd == ["strato-kernel", "serve", "--language", "python"])
+            #expect(sandbox.desiredStatus == .running)
+            #expect(sandbox.$project.id == project.id)
+        }
+    }
+
+    @Test("A language without a configured image is refused")
+    func createRefusesUnconfiguredLanguage() async throws {
+        try await withCodeSessionTestApp { app, _, project, token in
+            try await app.test(.POST, "/api/code-sessions") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                try req.content.encode([
+                    "language": "node",
+                    "projectId": project.id!.uuidString,
+                ])
+            } afterResponse: { res in
+                #expect(res.status == .badRequest)
+            }
+            #expect(try await CodeSession.query(on: app.db).count() == 0)
+            #expect(try await Sandbox.query(on: app.db).count() == 0)
+        }
+    }
+
+    @Test("idleTimeoutSeconds outside its range is refused")
+    func createRefusesIdleTimeoutOutOfRange() async throws {
+        try await withCodeSessionTestApp { app, _, project, token in
+            struct Body: Content {
+                let language: String
+                let projectId: UUID
+                let idleTimeoutSeconds: Int
+            }
+            try await app.test(.POST, "/api/code-sessions") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                try req.content.encode(Body(language: "python", projectId: project.id!, idleTimeoutSeconds: 5))
+            } afterResponse: { res in
+                #expect(res.status == .badRequest)
+            }
+        }
+    }
+
+    // MARK: - Execute
+
+    @Test("Executing in a session whose sandbox is still starting asks the client to retry")
+    func executeWhileStarting() async throws {
+        try await withCodeSessionTestApp { app, user, project, token in
+            let (session, _) = try await makeSession(
+                app: app, user: user, project: project, sandboxStatus: .starting)
+
+            try await app.test(.POST, "/api/code-sessions/\(session.id!.uuidString)/execute") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                try req.content.encode(ExecuteCodeRequest(code: "print(1)", timeoutSeconds: nil))
+            } afterResponse: { res in
+                #expect(res.status == .conflict)
+                #expect(res.headers.first(name: "Retry-After") == "5")
+            }
+        }
+    }
+
+    @Test("Another user's session is not executable")
+    func executeRequiresSandboxExec() async throws {
+        try await withCodeSessionTestApp { app, user, project, _ in
+            let (session, _) = try await makeSession(
+                app: app, user: user, project: project, sandboxStatus: .running)
+            let other = try await TestDataBuilder(db: app.db).createUser(
+                username: "outsider", email: "outsider@example.com")
+            let otherToken = try await other.generateAPIKey(on: app.db)
+
+            try await app.test(.POST, "/api/code-sessions/\(session.id!.uuidString)/execute") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: otherToken)
+                try req.content.encode(ExecuteCodeRequest(code: "print(1)", timeoutSeconds: nil))
+            } afterResponse: { res in
+                #expect(res.status == .forbidden)
+            }
+        }
+    }
+
+    // MARK: - Idle lifecycle
+
+    @Test("An idle session whose sandbox exited is torn down")
+    func idleExitedSessionIsTornDown() async throws {
+        try await withCodeSessionTestApp { app, user, project, _ in
+            let (_, sandbox) = try await makeSession(
+                app: app, user: user, project: project, sandboxStatus: .exited,
+                lastActivityAt: Date().addingTimeInterval(-3600))
+
+            await app.codeSessions.sweepOnce(acquiringLock: false)
+
+            #expect(try await deleteOperationCount(for: sandbox, on: app.db) == 1)
+        }
+    }
+
+    @Test("A checkpointed session is kept until its retention elapses")
+    func checkpointRetention() async throws {
+        try await withCodeSessionTestApp { app, user, project, _ in
+            let retention = TimeInterval(app.codeSessions.configuration.checkpointRetentionHours) * 3600
+            let (session, sandbox) = try await makeSession(
+                app: app, user: user, project: project, sandboxStatus: .stopped, state: .checkpointed,
+                lastActivityAt: Date().addingTimeInterval(-60))
+
+            await app.codeSessions.advance(session, sandbox: sandbox, on: app.db)
+            #expect(try await deleteOperationCount(for: sandbox, on: app.db) == 0)
+
+            await app.codeSessions.advance(
+                session, sandbox: sandbox, now: Date().addingTimeInterval(retention), on: app.db)
+            #expect(try await deleteOperationCount(for: sandbox, on: app.db) == 1)
+        }
+    }
+
+    @Test("A checkpoint that failed tears the session down")
+    func failedCheckpointIsTornDown() async throws {
+        try await withCodeSessionTestApp { app, user, project, _ in
+            let (session, sandbox) = try await makeSession(
+                app: app, user: user, project: project, sandboxStatus: .running, state: .checkpointing)
+            session.checkpointSnapshotId = UUID()  // gone: no such snapshot
+            try await session.save(on: app.db)
+
+            await app.codeSessions.advance(session, sandbox: sandbox, on: app.db)
+
+            #expect(try await deleteOperationCount(for: sandbox, on: app.db) == 1)
+        }
+    }
+
+    // MARK: - Status
+
+    @Test("Client status folds the sandbox into the session state")
+    func statusMapping() {
+        let now = Date()
+        let session = CodeSession(
+            sandboxID: UUID(), projectID: UUID(), language: .bash, idleTimeoutSeconds: 60,
+            createdByID: UUID(), now: now)
+        let sandbox = Sandbox(
+            name: "s", projectID: UUID(), environment: "development", image: "img", cpus: 1, memory: 1)
+
+        sandbox.setStatus(.starting)
+        #expect(CodeSessionStatus(session: session, sandbox: sandbox, now: now) == .starting)
+        sandbox.setStatus(.running)
+        #expect(CodeSessionStatus(session: session, sandbox: sandbox, now: now) == .ready)
+        session.executingUntil = now.addingTimeInterval(30)
+        #expect(CodeSessionStatus(session: session, sandbox: sandbox, now: now) == .busy)
+        #expect(!session.isIdle(at: now.addingTimeInterval(20)))
+        session.executingUntil = nil
+        #expect(session.isIdle(at: now.addingTimeInterval(60)))
+        sandbox.setStatus(.exited)
+        #expect(CodeSessionStatus(session: session, sandbox: sandbox, now: now) == .failed)
+        session.state = .checkpointed
+        #expect(CodeSessionStatus(session: session, sandbox: sandbox, now: now) == .checkpointed)
+    }
+}
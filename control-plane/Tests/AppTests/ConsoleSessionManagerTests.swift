@@ -20,7 +20,7 @@ final class ConsoleSessionManagerTests: BaseTestCase {
                 vmId: vmId,
                 agentKey: agentKey("console-agent"),
                 userId: nil,
-                websocket: nil
+                terminal: nil
             )
 
             #expect(manager.hasSession(sessionId: sessionId))
@@ -53,14 +53,14 @@ final class ConsoleSessionManagerTests: BaseTestCase {
                 vmId: vmId,
                 agentKey: agentKey("console-agent"),
                 userId: nil,
-                websocket: nil
+                terminal: nil
             )
             manager.createSession(
                 sessionId: secondSession,
                 vmId: vmId,
                 agentKey: agentKey("console-agent"),
                 userId: nil,
-                websocket: nil
+                terminal: nil
             )
 
             // ...and a session on a different agent that must survive the
@@ -72,7 +72,7 @@ final class ConsoleSessionManagerTests: BaseTestCase {
                 vmId: otherVmId,
                 agentKey: agentKey("other-agent"),
                 userId: nil,
-                websocket: nil
+                terminal: nil
             )
 
             manager.closeAllSessions(forAgent: agentKey("console-agent"), reason: "agent disconnected")
@@ -88,4 +88,251 @@ final class ConsoleSessionManagerTests: BaseTestCase {
             #expect(otherIndex.count == 1)
         }
     }
+
+    @Test("Observers receive the session's output and are disconnected when it ends")
+    func observersFollowSession() async throws {
+        try await withApp { app in
+            let manager = app.consoleSessionManager
+            let sessionId = UUID().uuidString
+            let vmId = UUID().uuidString
+            let ownerId = UUID()
+            let watcherId = UUID()
+            let owner = RecordingTerminal()
+            let observer = RecordingTerminal()
+
+            manager.createSession(
+                sessionId: sessionId,
+                vmId: vmId,
+                agentKey: agentKey("console-agent"),
+                userId: ownerId.uuidString,
+                terminal: owner
+            )
+            #expect(throws: ConsoleSessionError.self) {
+                _ = try manager.addObserver(
+                    sessionId: UUID().uuidString, userId: watcherId, username: "watcher", terminal: observer)
+            }
+            _ = try manager.invite(
+                sessionId: sessionId, ownerId: ownerId, userId: watcherId, username: "watcher", access: .readOnly,
+                organizationID: nil)
+            let observerId = try manager.addObserver(
+                sessionId: sessionId, userId: watcherId, username: "watcher", terminal: observer)
+            #expect(manager.participantCount(sessionId: sessionId) == 1)
+            #expect(owner.notices == ["watcher is observing (read-only)"])
+
+            manager.routeToFrontend(
+                vmId: vmId, sessionId: sessionId, data: Data("login: ".utf8),
+                fromAgentKey: agentKey("console-agent"))
+            // Data claimed by another agent reaches no one.
+            manager.routeToFrontend(
+                vmId: vmId, sessionId: sessionId, data: Data("spoofed".utf8),
+                fromAgentKey: agentKey("other-agent"))
+            #expect(owner.output == "login: ")
+            #expect(observer.output == "login: ")
+
+            manager.removeSession(sessionId: sessionId)
+            #expect(observer.terminationReason == "console session ended")
+            #expect(owner.terminationReason == nil)
+            #expect(manager.participantCount(sessionId: sessionId) == 0)
+
+            // Removing an observer of a session that is gone is harmless.
+            manager.removeParticipant(sessionId: sessionId, participantId: observerId)
+        }
+    }
+
+    @Test("Observing takes the owner or an invitation, and revoking the invitation disconnects the observer")
+    func observersNeedInvitation() async throws {
+        try await withApp { app in
+            let manager = app.consoleSessionManager
+            let sessionId = UUID().uuidString
+            let ownerId = UUID()
+            let strangerId = UUID()
+            let owner = RecordingTerminal()
+            let observer = RecordingTerminal()
+
+            manager.createSession(
+                sessionId: sessionId,
+                vmId: UUID().uuidString,
+                agentKey: agentKey("console-agent"),
+                userId: ownerId.uuidString,
+                username: "alice",
+                terminal: owner
+            )
+
+            // Console access to the VM is not enough to watch someone else.
+            #expect(throws: ConsoleSessionError.self) {
+                _ = try manager.addObserver(
+                    sessionId: sessionId, userId: strangerId, username: "mallory", terminal: observer)
+            }
+            #expect(manager.participantCount(sessionId: sessionId) == 0)
+            #expect(owner.notices.isEmpty)
+
+            // The owner may watch their own session from elsewhere.
+            let ownView = try manager.addObserver(
+                sessionId: sessionId, userId: ownerId, username: "alice", terminal: RecordingTerminal())
+            manager.removeParticipant(sessionId: sessionId, participantId: ownView)
+
+            _ = try manager.invite(
+                sessionId: sessionId, ownerId: ownerId, userId: strangerId, username: "mallory", access: .readWrite,
+                organizationID: nil)
+            _ = try manager.addObserver(
+                sessionId: sessionId, userId: strangerId, username: "mallory", terminal: observer)
+            try manager.revoke(sessionId: sessionId, ownerId: ownerId, userId: strangerId)
+            #expect(observer.terminationReason == "access revoked by the session owner")
+            #expect(owner.notices.last == "mallory was removed from the session")
+            #expect(manager.participantCount(sessionId: sessionId) == 0)
+        }
+    }
+
+    @Test("Only invited users join; access changes and revocation apply live")
+    func invitedParticipants() async throws {
+        try await withApp { app in
+            let manager = app.consoleSessionManager
+            let sessionId = UUID().uuidString
+            let ownerId = UUID()
+            let guestId = UUID()
+            let owner = RecordingTerminal()
+            let guest = RecordingTerminal()
+
+            manager.createSession(
+                sessionId: sessionId,
+                vmId: UUID().uuidString,
+                agentKey: agentKey("console-agent"),
+                userId: ownerId.uuidString,
+                username: "alice",
+                terminal: owner
+            )
+
+            // Only the owner shares, and only the invited join.
+            #expect(throws: ConsoleSessionError.self) {
+                _ = try manager.invite(
+                    sessionId: sessionId, ownerId: guestId, userId: guestId, username: "bob",
+                    access: .readWrite, organizationID: nil)
+            }
+            #expect(throws: ConsoleSessionError.self) {
+                _ = try manager.join(sessionId: sessionId, userId: guestId, username: "bob", terminal: guest)
+            }
+
+            _ = try manager.invite(
+                sessionId: sessionId, ownerId: ownerId, userId: guestId, username: "bob", access: .readOnly,
+                organizationID: nil)
+            let (participantId, access) = try manager.join(
+                sessionId: sessionId, userId: guestId, username: "bob", terminal: guest)
+            #expect(access == .readOnly)
+            #expect(owner.notices == ["bob joined (read-only)"])
+            #expect(try manager.participants(sessionId: sessionId, ownerId: ownerId).map(\.connected) == [true])
+
+            // Read-only input goes nowhere — not even to the (absent) agent.
+            try await manager.routeParticipantInput(
+                sessionId: sessionId, participantId: participantId, data: Data("rm -rf /\r".utf8))
+
+            // Upgraded live, the same terminal's input now reaches for the agent.
+            _ = try manager.invite(
+                sessionId: sessionId, ownerId: ownerId, userId: guestId, username: "bob", access: .readWrite,
+                organizationID: nil)
+            #expect(guest.notices.last == "bob is now read-write")
+            await #expect(throws: ConsoleSessionError.self) {
+                try await manager.routeParticipantInput(
+                    sessionId: sessionId, participantId: participantId, data: Data("ls\r".utf8))
+            }
+
+            try manager.revoke(sessionId: sessionId, ownerId: ownerId, userId: guestId)
+            #expect(guest.terminationReason == "access revoked by the session owner")
+            #expect(owner.notices.last == "bob was removed from the session")
+            #expect(manager.participantCount(sessionId: sessionId) == 0)
+            #expect(throws: ConsoleSessionError.self) {
+                _ = try manager.join(sessionId: sessionId, userId: guestId, username: "bob", terminal: guest)
+            }
+        }
+    }
+
+    @Test("Input into a shared session is audited per user, a line at a time")
+    func sharedInputIsAudited() async throws {
+        try await withApp { app in
+            let manager = app.consoleSessionManager
+            let sessionId = UUID().uuidString
+            let ownerId = UUID()
+            let guestId = UUID()
+
+            manager.createSession(
+                sessionId: sessionId,
+                vmId: UUID().uuidString,
+                agentKey: agentKey("console-agent"),
+                userId: ownerId.uuidString,
+                username: "alice",
+                terminal: RecordingTerminal()
+            )
+
+            // Before the session is shared, nothing is recorded.
+            _ = try? await manager.routeToAgent(sessionId: sessionId, data: Data("private\r".utf8))
+
+            _ = try manager.invite(
+                sessionId: sessionId, ownerId: ownerId, userId: guestId, username: "bob", access: .readWrite,
+                organizationID: nil)
+            let (participantId, _) = try manager.join(
+                sessionId: sessionId, userId: guestId, username: "bob", terminal: RecordingTerminal())
+
+            // The agent is not connected, so each call fails after auditing.
+            for chunk in ["l", "s\r"] {
+                _ = try? await manager.routeParticipantInput(
+                    sessionId: sessionId, participantId: participantId, data: Data(chunk.utf8))
+            }
+            _ = try? await manager.routeToAgent(sessionId: sessionId, data: Data("whoami\r".utf8))
+
+            let events = try await AuditEvent.query(on: app.db)
+                .filter(\.$eventType == AuditEventType.sharedSessionInput.rawValue)
+                .sort(\.$username)
+                .all()
+            #expect(events.map(\.username) == ["alice", "bob"])
+            #expect(events.map(\.resourceType) == ["virtual_machine", "virtual_machine"])
+            #expect(events[0].metadataJSON?.contains("whoami") == true)
+            #expect(events[1].metadataJSON?.contains("ls") == true)
+            #expect(events.allSatisfy { $0.metadataJSON?.contains("private") == false })
+        }
+    }
+
+    @Test("Share input buffers complete lines and flush what is left")
+    func shareInputBuffering() {
+        var share = SessionShare<Int>()
+        let userId = UUID()
+
+        #expect(share.bufferInput(Data("ls\r".utf8), from: userId, username: "bob") == nil)
+
+        _ = share.invite(userId: userId, username: "bob", access: .readWrite, organizationID: nil)
+        #expect(share.bufferInput(Data("ec".utf8), from: userId, username: "bob") == nil)
+        #expect(share.bufferInput(Data("ho\n".utf8), from: userId, username: "bob") == "echo\n")
+
+        let long = String(repeating: "x", count: SessionShare<Int>.maxAuditedInputBytes)
+        #expect(share.bufferInput(Data(long.utf8), from: userId, username: "bob") == long)
+
+        #expect(share.bufferInput(Data("vi".utf8), from: userId, username: "bob") == nil)
+        let drained = share.drainInput(from: userId)
+        #expect(drained.map(\.text) == ["vi"])
+        #expect(share.drainInput().isEmpty)
+    }
+}
+
+/// A console terminal that records what it is sent.
+private final class RecordingTerminal: ConsoleTerminal, @unchecked Sendable {
+    private let lock = NSLock()
+    private var bytes: [UInt8] = []
+    private var reason: String?
+    private var noticeLines: [String] = []
+
+    var output: String { lock.withLock { String(decoding: bytes, as: UTF8.self) } }
+    var terminationReason: String? { lock.withLock { reason } }
+    var notices: [String] { lock.withLock { noticeLines } }
+
+    func write(_ bytes: [UInt8]) {
+        lock.withLock { self.bytes += bytes }
+    }
+
+    func consoleReady() {}
+
+    func terminate(reason: String) {
+        lock.withLock { self.reason = reason }
+    }
+
+    func notice(_ text: String) {
+        lock.withLock { noticeLines.append(text) }
+    }
 }
@@ -256,6 +256,124 @@ final class DesiredStateReconciliationTests {
         }
     }
 
+    @Test("A vTPM VM gets its state key when it is created, stored wrapped (v32)")
+    func createMintsTPMStateKey() async throws {
+        struct CreateVMBody: Content {
+            let name: String
+            let imageId: UUID?
+            let projectId: UUID?
+            let tpm: Bool
+        }
+
+        try await withVMTestApp { app, user, vm, token in
+            let key = try SecretsEncryptionService.parseKey(String(repeating: "5a", count: 32))
+            app.secretsEncryption = SecretsEncryptionService(key: key)
+            let project = try #require(try await Project.find(vm.$project.id, on: app.db))
+            let image = try await TestDataBuilder(db: app.db).createImage(project: project, uploadedBy: user)
+
+            var created: [Bool: UUID] = [:]
+            for tpm in [true, false] {
+                try await app.test(.POST, "/api/vms") { req in
+                    req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                    try req.content.encode(
+                        CreateVMBody(
+                            name: tpm ? "with-tpm" : "without-tpm", imageId: image.id, projectId: project.id,
+                            tpm: tpm))
+                } afterResponse: { res in
+                    #expect(res.status == .accepted)
+                    created[tpm] = try res.content.decode(OperationResponse.self).vmId
+                }
+            }
+
+            let stored = try #require(try await VM.find(created[true], on: app.db)?.tpmStateKey)
+            #expect(stored.hasPrefix(SecretsEncryptionService.encryptedPrefix))
+            let stateKey = try app.secretsEncryption.decrypt(stored)
+            #expect(stateKey.count == 64 && stateKey.allSatisfy(\.isHexDigit))
+            #expect(try await VM.find(created[false], on: app.db)?.tpmStateKey == nil)
+
+            // Without a secrets key the key could only be stored in plaintext,
+            // so a vTPM VM is created without one.
+            app.secretsEncryption = .disabled
+            try await app.test(.POST, "/api/vms") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                try req.content.encode(
+                    CreateVMBody(name: "unkeyed-tpm", imageId: image.id, projectId: project.id, tpm: true))
+            } afterResponse: { res in
+                #expect(res.status == .accepted)
+                let vmId = try res.content.decode(OperationResponse.self).vmId
+                #expect(try await VM.find(vmId, on: app.db)?.tpmStateKey == nil)
+            }
+        }
+    }
+
+    @Test("A vTPM VM's sync carries its stored state key, unwrapped (v32)")
+    func syncAssemblyCarriesTPMStateKey() async throws {
+        try await withVMTestApp { app, _, vm, _ in
+            let key = try SecretsEncryptionService.parseKey(String(repeating: "5a", count: 32))
+            app.secretsEncryption = SecretsEncryptionService(key: key)
+            let agentId = try await self.registerAgent(
+                app: app, vm: vm, protocolVersion: WireProtocol.currentVersion)
+            let stateKey = VM.generateTPMStateKey()
+            vm.tpmEnabled = true
+            vm.tpmStateKey = try app.secretsEncryption.encrypt(stateKey)
+            vm.setDesiredStatus(.running)
+            try await vm.save(on: app.db)
+
+            let entry = try #require(try await app.desiredStateAssembler.assemble(agentId: agentId).vms.first)
+            #expect(entry.tpmStateKey == stateKey)
+        }
+    }
+
+    @Test("No TPM state key goes to a VM without a TPM, or to an agent older than v32")
+    func syncAssemblyWithholdsTPMStateKey() async throws {
+        try await withVMTestApp { app, _, vm, _ in
+            let agentId = try await self.registerAgent(
+                app: app, vm: vm, protocolVersion: WireProtocol.tpmStateEncryptionMinimumVersion - 1)
+            vm.setDesiredStatus(.running)
+            try await vm.save(on: app.db)
+            #expect(try await app.desiredStateAssembler.assemble(agentId: agentId).vms.first?.tpmStateKey == nil)
+
+            vm.tpmEnabled = true
+            try await vm.save(on: app.db)
+            #expect(try await app.desiredStateAssembler.assemble(agentId: agentId).vms.first?.tpmStateKey == nil)
+        }
+    }
+
+    @Test("Startup mints wrapped state keys for unkeyed vTPM VMs, and none without a secrets key")
+    func startupMintsTPMStateKeysOnlyWrapped() async throws {
+        try await withVMTestApp { app, _, vm, _ in
+            vm.tpmEnabled = true
+            try await vm.save(on: app.db)
+
+            try await SecretsEncryptionService.disabled.mintTPMStateKeys(on: app.db, logger: app.logger)
+            #expect(try await VM.find(vm.requireID(), on: app.db)?.tpmStateKey == nil)
+
+            let key = try SecretsEncryptionService.parseKey(String(repeating: "5a", count: 32))
+            let encryption = SecretsEncryptionService(key: key)
+            try await encryption.mintTPMStateKeys(on: app.db, logger: app.logger)
+            let stored = try #require(try await VM.find(vm.requireID(), on: app.db)?.tpmStateKey)
+            #expect(stored.hasPrefix(SecretsEncryptionService.encryptedPrefix))
+
+            // Never replaced once minted: the agent's state is sealed with it.
+            try await encryption.mintTPMStateKeys(on: app.db, logger: app.logger)
+            #expect(try await VM.find(vm.requireID(), on: app.db)?.tpmStateKey == stored)
+        }
+    }
+
+    @Test("The sync never mints a TPM state key; a VM without one syncs without it")
+    func syncAssemblyDoesNotMintTPMStateKey() async throws {
+        try await withVMTestApp { app, _, vm, _ in
+            let agentId = try await self.registerAgent(
+                app: app, vm: vm, protocolVersion: WireProtocol.currentVersion)
+            vm.tpmEnabled = true
+            vm.setDesiredStatus(.running)
+            try await vm.save(on: app.db)
+
+            #expect(try await app.desiredStateAssembler.assemble(agentId: agentId).vms.first?.tpmStateKey == nil)
+            #expect(try await VM.find(vm.requireID(), on: app.db)?.tpmStateKey == nil)
+        }
+    }
+
     @Test("Sync assembly emits first-class network desired state for referenced networks")
     func syncAssemblyIncludesNetworks() async throws {
         try await withVMTestApp { app, _, vm, _ in
@@ -371,6 +489,33 @@ final class DesiredStateReconciliationTests {
         }
     }
 
+    @Test("Sync assembly sends IPv6-only networks without a subnet and omits them for pre-v30 agents")
+    func syncAssemblyIPv6OnlyNetworks() async throws {
+        try await withVMTestApp { app, _, vm, _ in
+            let network = LogicalNetwork(
+                name: "v6-net", subnet: nil, subnet6: "fd00:6:6:6::/64", gateway6: "fd00:6:6:6::1",
+                projectID: vm.$project.id, dnsServers: ["2001:db8::53"])
+            try await network.save(on: app.db)
+            let nic = VMNetworkInterface(
+                vmID: vm.id!, network: "v6-net", macAddress: VMNetworkInterface.generateMACAddress())
+            try await nic.save(on: app.db)
+
+            let agentId = try await self.registerAgent(
+                app: app, vm: vm, protocolVersion: WireProtocol.currentVersion)
+            let message = try await app.desiredStateAssembler.assemble(agentId: agentId)
+            let net = try #require(message.networks.first { $0.name == "v6-net" })
+            #expect(net.subnet == nil)
+            #expect(net.subnet6 == "fd00:6:6:6::/64")
+            #expect(net.dnsServers == ["2001:db8::53"])
+
+            let agent = try #require(try await Agent.find(UUID(uuidString: agentId), on: app.db))
+            agent.wireProtocolVersion = WireProtocol.ipv6OnlyNetworksMinimumVersion - 1
+            try await agent.save(on: app.db)
+            let old = try await app.desiredStateAssembler.assemble(agentId: agentId)
+            #expect(!old.networks.contains { $0.name == "v6-net" })
+        }
+    }
+
     // MARK: - Observed-state report application
 
     @Test("A converged report updates status, generation, and completes the operation")
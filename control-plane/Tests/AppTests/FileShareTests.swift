@@ -0,0 +1,315 @@
+import Fluent
+import Foundation
+import StratoShared
+import Testing
+import Vapor
+import VaporTesting
+
+@testable import App
+
+/// Managed NFS file shares: stuck-operation resolution, the desired-state
+/// entries (with the export's client list derived from the project's VM
+/// NICs), the observed report completing operations and confirming deletes,
+/// and the create API's placement and network refusals.
+@Suite("File Share Tests", .serialized)
+struct FileShareTests {
+
+    // MARK: - Stuck-operation resolution (pure logic)
+
+    private func makeShare(status: FileShareStatus, observedGeneration: Int64) -> FileShare {
+        let share = FileShare(
+            name: "team", projectID: UUID(), environment: "development", networkID: UUID(),
+            sizeBytes: 10 << 30, ipAddress: "10.20.0.9", netmask: "255.255.255.0",
+            macAddress: "52:54:00:12:34:56")
+        share.setStatus(status)
+        share.observedGeneration = observedGeneration
+        return share
+    }
+
+    @Test("a create no agent ever confirmed goes to error")
+    func unconfirmedCreateResolvesToError() {
+        let share = makeShare(status: .creating, observedGeneration: 0)
+        let operation = ResourceOperation(fileShareID: UUID(), userID: UUID(), kind: .create)
+
+        #expect(share.resolveForStuckOperation(operation))
+        #expect(share.status == .error)
+    }
+
+    @Test("a resize the agent never finished reverts the size and keeps the share available")
+    func stuckResizeReverts() {
+        let share = makeShare(status: .resizing, observedGeneration: 2)
+        share.observedSizeBytes = 10 << 30
+        share.sizeBytes = 20 << 30
+        share.generation = 3
+        let operation = ResourceOperation(fileShareID: UUID(), userID: UUID(), kind: .resize)
+
+        #expect(share.resolveForStuckOperation(operation))
+        #expect(share.status == .available)
+        #expect(share.sizeBytes == 10 << 30)
+        // The revert is itself a desired change the agent must see.
+        #expect(share.generation == 4)
+    }
+
+    @Test("a failed delete of a confirmed share no longer wants it absent")
+    func stuckDeleteRevertsDesired() {
+        let share = makeShare(status: .deleting, observedGeneration: 1)
+        share.setDesiredStatus(.absent)
+        let operation = ResourceOperation(fileShareID: UUID(), userID: UUID(), kind: .delete)
+
+        #expect(share.resolveForStuckOperation(operation))
+        #expect(share.desiredStatus == .present)
+        #expect(share.status == .available)
+    }
+
+    // MARK: - Sync and report
+
+    private struct Fixture {
+        let app: Application
+        let user: User
+        let token: String
+        let project: Project
+        let network: LogicalNetwork
+    }
+
+    private func withShareApp(_ test: (Fixture) async throws -> Void) async throws {
+        try await withTestApp { app in
+            let builder = TestDataBuilder(db: app.db)
+            let user = try await builder.createUser(username: "share-user", email: "share-user@example.com")
+            let org = try await builder.createOrganization(name: "Share Org")
+            try await builder.addUserToOrganization(user: user, organization: org, role: "admin")
+            user.currentOrganizationId = org.id
+            try await user.save(on: app.db)
+            let project = try await builder.createProject(
+                name: "Share Project", description: "file shares", organization: org)
+
+            let network = LogicalNetwork(
+                name: "team-net", subnet: "10.20.0.0/24", gateway: "10.20.0.1",
+                projectID: try project.requireID())
+            try await network.save(on: app.db)
+
+            try await test(
+                Fixture(
+                    app: app, user: user, token: try await user.generateAPIKey(on: app.db), project: project,
+                    network: network))
+        }
+    }
+
+    private func registerAgent(
+        _ app: Application, name: String, protocolVersion: Int, capabilities: [String]
+    ) async throws -> String {
+        let message = AgentRegisterMessage(
+            agentId: name,
+            hostname: "\(name).example",
+            version: "1.0.0",
+            capabilities: capabilities,
+            resources: AgentResources(
+                totalCPU: 16, availableCPU: 16,
+                totalMemory: 1 << 34, availableMemory: 1 << 34,
+                totalDisk: 1 << 40, availableDisk: 1 << 40
+            ),
+            protocolVersion: protocolVersion
+        )
+        let orgID = try await Organization.query(on: app.db).sort(\.$createdAt).first()?.id
+        return try await app.agentService.registerAgent(
+            message, agentName: name, organizationScope: orgID.map { .organization($0) }
+        ).uuidString
+    }
+
+    /// A share hosted on `agentId`, with a pending create operation.
+    private func placeShare(
+        _ fixture: Fixture, on agentId: String
+    ) async throws -> (FileShare, ResourceOperation) {
+        let share = FileShare(
+            name: "team", projectID: try fixture.project.requireID(), environment: "development",
+            networkID: try fixture.network.requireID(), sizeBytes: 10 << 30, ipAddress: "10.20.0.9",
+            netmask: "255.255.255.0", macAddress: "52:54:00:12:34:56")
+        share.hypervisorId = agentId
+        try await share.save(on: fixture.app.db)
+        let operation = ResourceOperation(
+            fileShareID: try share.requireID(), userID: try fixture.user.requireID(), kind: .create)
+        try await operation.save(on: fixture.app.db)
+        return (share, operation)
+    }
+
+    private func report(agentId: String, shares: [ObservedFileShareState]) -> ObservedStateReport {
+        ObservedStateReport(
+            agentId: agentId,
+            vms: [],
+            resources: AgentResources(
+                totalCPU: 16, availableCPU: 16,
+                totalMemory: 1 << 34, availableMemory: 1 << 34,
+                totalDisk: 1 << 40, availableDisk: 1 << 40
+            ),
+            fileShares: shares
+        )
+    }
+
+    @Test("the sync lists the share with the project's VM addresses on its network as clients")
+    func syncCarriesShareAndClients() async throws {
+        try await withShareApp { fixture in
+            let app = fixture.app
+            let agentId = try await registerAgent(
+                app, name: "share-host", protocolVersion: WireProtocol.currentVersion,
+                capabilities: [StorageCapability.nfsFileShare])
+            let (share, _) = try await placeShare(fixture, on: agentId)
+
+            // Two VMs of the project on the network, and one on another network.
+            let builder = TestDataBuilder(db: app.db)
+            for (name, network, address) in [
+                ("a", "team-net", "10.20.0.11"), ("b", "team-net", "10.20.0.10"), ("c", "other-net", "10.30.0.5"),
+            ] {
+                let vm = try await builder.createVM(name: "vm-\(name)", project: fixture.project)
+                let nic = VMNetworkInterface(
+                    vmID: try vm.requireID(), network: network, macAddress: VMNetworkInterface.generateMACAddress())
+                try await nic.save(on: app.db)
+                try await VMInterfaceAddress(
+                    interfaceID: try nic.requireID(), network: network, family: .ipv4, address: address,
+                    prefixLength: 24, gateway: nil
+                ).save(on: app.db)
+            }
+
+            let message = try await app.desiredStateAssembler.assemble(agentId: agentId)
+            let entry = try #require(message.fileShares?.first)
+            #expect(entry.shareId == share.id)
+            #expect(entry.desiredStatus == .present)
+            #expect(entry.endpoint.ipAddress == "10.20.0.9")
+            #expect(entry.endpoint.networkId == fixture.network.id)
+            #expect(entry.allowedClients == ["10.20.0.10", "10.20.0.11"])
+            // The share's network is realized on its host even with no VM there.
+            #expect(message.networks.contains { $0.name == "team-net" })
+        }
+    }
+
+    @Test("an agent below v24 gets no opinion on file shares")
+    func oldAgentGetsNil() async throws {
+        try await withShareApp { fixture in
+            let agentId = try await registerAgent(
+                fixture.app, name: "old-host", protocolVersion: WireProtocol.fileShareMinimumVersion - 1,
+                capabilities: [])
+            let message = try await fixture.app.desiredStateAssembler.assemble(agentId: agentId)
+            #expect(message.fileShares == nil)
+        }
+    }
+
+    @Test("a converged report completes the create; absence completes a delete and removes the row")
+    func reportCompletesOperations() async throws {
+        try await withShareApp { fixture in
+            let app = fixture.app
+            let agentId = try await registerAgent(
+                app, name: "share-host", protocolVersion: WireProtocol.currentVersion,
+                capabilities: [StorageCapability.nfsFileShare])
+            let (share, create) = try await placeShare(fixture, on: agentId)
+            let shareID = try share.requireID()
+
+            try await app.observedStateApplier.apply(
+                report(
+                    agentId: agentId,
+                    shares: [
+                        ObservedFileShareState(
+                            shareId: shareID, status: .available, observedGeneration: 1, sizeBytes: 10 << 30,
+                            usedBytes: 4096)
+                    ]))
+            let available = try #require(try await FileShare.find(shareID, on: app.db))
+            #expect(available.status == .available)
+            #expect(available.usedBytes == 4096)
+            #expect(try await ResourceOperation.find(create.id, on: app.db)?.status == .succeeded)
+
+            available.setDesiredStatus(.absent)
+            available.setStatus(.deleting)
+            try await available.save(on: app.db)
+            let delete = ResourceOperation(fileShareID: shareID, userID: try fixture.user.requireID(), kind: .delete)
+            try await delete.save(on: app.db)
+
+            try await app.observedStateApplier.apply(report(agentId: agentId, shares: []))
+            #expect(try await FileShare.find(shareID, on: app.db) == nil)
+            #expect(try await ResourceOperation.find(delete.id, on: app.db)?.status == .succeeded)
+        }
+    }
+
+    @Test("a failed resize reverts the size and fails the operation")
+    func failedResizeReverts() async throws {
+        try await withShareApp { fixture in
+            let app = fixture.app
+            let agentId = try await registerAgent(
+                app, name: "share-host", protocolVersion: WireProtocol.currentVersion,
+                capabilities: [StorageCapability.nfsFileShare])
+            let (share, create) = try await placeShare(fixture, on: agentId)
+            let shareID = try share.requireID()
+            try await app.observedStateApplier.apply(
+                report(
+                    agentId: agentId,
+                    shares: [
+                        ObservedFileShareState(
+                            shareId: shareID, status: .available, observedGeneration: 1, sizeBytes: 10 << 30)
+                    ]))
+            #expect(try await ResourceOperation.find(create.id, on: app.db)?.status == .succeeded)
+
+            let resizing = try #require(try await FileShare.find(shareID, on: app.db))
+            resizing.sizeBytes = 20 << 30
+            resizing.setStatus(.resizing)
+            resizing.bumpGeneration()
+            try await resizing.save(on: app.db)
+            let resize = ResourceOperation(fileShareID: shareID, userID: try fixture.user.requireID(), kind: .resize)
+            try await resize.save(on: app.db)
+
+            try await app.observedStateApplier.apply(
+                report(
+                    agentId: agentId,
+                    shares: [
+                        ObservedFileShareState(
+                            shareId: shareID, status: .error, observedGeneration: 1, sizeBytes: 10 << 30,
+                            lastError: "resize2fs failed", failedGeneration: 2)
+                    ]))
+            let reverted = try #require(try await FileShare.find(shareID, on: app.db))
+            #expect(reverted.sizeBytes == 10 << 30)
+            #expect(reverted.status == .available)
+            #expect(reverted.errorMessage == "resize2fs failed")
+            let failed = try #require(try await ResourceOperation.find(resize.id, on: app.db))
+            #expect(failed.status == .failed)
+        }
+    }
+
+    // MARK: - API
+
+    private func create(
+        _ fixture: Fixture, networkId: UUID, _ assertions: (TestingHTTPResponse) throws -> Void
+    ) async throws {
+        try await fixture.app.test(.POST, "/api/file-shares") { req in
+            req.headers.bearerAuthorization = BearerAuthorization(token: fixture.token)
+            try req.content.encode(
+                CreateFileShareRequest(
+                    name: "team", description: nil, projectId: fixture.project.id, environment: nil,
+                    networkId: networkId, poolId: nil, sizeBytes: 10 << 30))
+        } afterResponse: { res in
+            try assertions(res)
+        }
+    }
+
+    @Test("a share is only exported on a network its project owns")
+    func foreignNetworkIsRefused() async throws {
+        try await withShareApp { fixture in
+            let foreign = LogicalNetwork(name: "shared-net", subnet: "10.40.0.0/24", gateway: "10.40.0.1")
+            try await foreign.save(on: fixture.app.db)
+
+            try await create(fixture, networkId: try foreign.requireID()) { res in
+                #expect(res.status == .badRequest)
+            }
+            #expect(try await FileShare.query(on: fixture.app.db).count() == 0)
+        }
+    }
+
+    @Test("with no capable agent, creation is refused before anything is written")
+    func noCapableAgent() async throws {
+        try await withShareApp { fixture in
+            // Online and current, but without the NFS capability.
+            _ = try await registerAgent(
+                fixture.app, name: "plain-host", protocolVersion: WireProtocol.currentVersion, capabilities: [])
+
+            try await create(fixture, networkId: try fixture.network.requireID()) { res in
+                #expect(res.status == .conflict)
+                #expect(res.body.string.contains(StorageCapability.nfsFileShare))
+            }
+            #expect(try await FileShare.query(on: fixture.app.db).count() == 0)
+        }
+    }
+}
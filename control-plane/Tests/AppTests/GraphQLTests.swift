@@ -0,0 +1,279 @@
+import Fluent
+import Foundation
+import StratoShared
+import Testing
+import Vapor
+import VaporTesting
+
+@testable import App
+
+/// The GraphQL API: parsing and planning (fragments, directives, the cost
+/// and depth limits), per-object authorization over HTTP, and the event
+/// stream that feeds subscriptions.
+@Suite("GraphQL Tests", .serialized)
+struct GraphQLTests {
+
+    /// Follows `keys` (object keys, or array indexes as strings) into a
+    /// response.
+    private func lookup(_ value: CodableValue?, _ keys: String...) -> CodableValue? {
+        var current = value
+        for key in keys {
+            switch current {
+            case .object(let object)?: current = object[key]
+            case .array(let array)?:
+                guard let index = Int(key), array.indices.contains(index) else { return nil }
+                current = array[index]
+            default: return nil
+            }
+        }
+        return current
+    }
+
+    private func string(_ value: CodableValue?) -> String? {
+        if case .string(let string)? = value { return string }
+        return nil
+    }
+
+    private func count(_ value: CodableValue?) -> Int? {
+        if case .array(let array)? = value { return array.count }
+        return nil
+    }
+
+    private func isNull(_ value: CodableValue?) -> Bool {
+        if case .null? = value { return true }
+        return false
+    }
+
+    private let executor = GraphQLExecutor(
+        schema: StratoGraphQLSchema.schema, limits: GraphQLLimits(maxCost: 10_000, maxDepth: 10))
+
+    // MARK: - Parsing and planning
+
+    @Test("The parser reads operations, fragments, variables and block strings")
+    func parsesDocuments() throws {
+        let document = try GraphQLDocument.parse(
+            #"""
+            # A comment
+            query Fleet($id: ID!, $first: Int = 5) {
+              vm(id: $id) { ...VMFields label: name @include(if: true) }
+              agents(first: $first) { id }
+            }
+            fragment VMFields on VM { id status description(note: """
+                indented
+              """) }
+            subscription Events { resourceEvents { id } }
+            """#)
+
+        #expect(document.operations.count == 2)
+        #expect(document.fragments["VMFields"]?.typeCondition == "VM")
+        let fleet = try document.operation(named: "Fleet")
+        #expect(fleet.kind == .query)
+        #expect(fleet.variables.map(\.name) == ["id", "first"])
+        #expect(fleet.variables.last?.defaultValue == .int(5))
+        #expect(throws: GraphQLError.self) { try document.operation(named: nil) }
+        #expect(throws: GraphQLError.self) { try GraphQLDocument.parse("{ vm(id: ") }
+    }
+
+    @Test("Planning merges fragments, honors directives and validates fields")
+    func plansDocuments() throws {
+        let id = UUID().uuidString
+        let plan = try executor.plan(
+            """
+            query($skip: Boolean!) {
+              vm(id: "\(id)") { ...Fields ... on VM { status } cpu @skip(if: $skip) __typename }
+            }
+            fragment Fields on VM { id name }
+            """, operationName: nil, variables: ["skip": .bool(true)])
+
+        let vm = try #require(plan.fields.first)
+        #expect(vm.responseKey == "vm")
+        #expect(vm.children.map(\.responseKey) == ["id", "name", "status", "__typename"])
+
+        #expect(throws: GraphQLError.self) {
+            try executor.plan("{ vm(id: \"\(id)\") { nope } }", operationName: nil, variables: nil)
+        }
+        #expect(throws: GraphQLError.self) {
+            try executor.plan("{ vm(id: \"not-a-uuid\") { id } }", operationName: nil, variables: nil)
+        }
+        #expect(throws: GraphQLError.self) {
+            try executor.plan("{ ...A } fragment A on Query { ...A }", operationName: nil, variables: nil)
+        }
+        #expect(throws: GraphQLError.self) {
+            try executor.plan("mutation { vm(id: \"\(id)\") { id } }", operationName: nil, variables: nil)
+        }
+    }
+
+    @Test("Cost multiplies by page size and is capped; depth is capped")
+    func limitsCostAndDepth() throws {
+        let plan = try executor.plan(
+            "{ projects(first: 10) { vms(first: 10) { id } } }", operationName: nil, variables: nil)
+        #expect(plan.cost == 1 + 10 * (1 + 10 * 1))
+
+        let tight = GraphQLExecutor(
+            schema: StratoGraphQLSchema.schema, limits: GraphQLLimits(maxCost: 100, maxDepth: 3))
+        #expect(throws: GraphQLError.self) {
+            try tight.plan("{ projects(first: 10) { vms(first: 10) { id } } }", operationName: nil, variables: nil)
+        }
+        #expect(throws: GraphQLError.self) {
+            try tight.plan(
+                "{ projects(first: 1) { vms(first: 1) { project { id } } } }", operationName: nil, variables: nil)
+        }
+        #expect(throws: GraphQLError.self) {
+            try tight.plan("{ projects(first: 500) { id } }", operationName: nil, variables: nil)
+        }
+    }
+
+    // MARK: - HTTP
+
+    private struct Fixture {
+        let org: Organization
+        let project: Project
+        let vm: VM
+        let adminToken: String
+        let memberToken: String
+    }
+
+    private func withFixture(_ test: (Application, Fixture) async throws -> Void) async throws {
+        try await withTestApp { app in
+            let builder = TestDataBuilder(db: app.db)
+            let org = try await builder.createOrganization(name: "GraphQL Org")
+            let project = try await builder.createProject(
+                name: "GraphQL Project", description: "d", organization: org)
+            let vm = try await builder.createVM(name: "graphql-vm", project: project)
+
+            var tokens: [String] = []
+            for (name, role) in [("graphqladmin", "admin"), ("graphqlmember", "member")] {
+                let user = try await builder.createUser(
+                    username: name, email: "\(name)@example.com", isSystemAdmin: false)
+                try await builder.addUserToOrganization(user: user, organization: org, role: role)
+                user.currentOrganizationId = org.id
+                try await user.save(on: app.db)
+                tokens.append(try await user.generateAPIKey(on: app.db))
+            }
+            try await test(
+                app, Fixture(org: org, project: project, vm: vm, adminToken: tokens[0], memberToken: tokens[1]))
+        }
+    }
+
+    private func query(
+        _ app: Application, token: String, _ query: String, variables: [String: CodableValue]? = nil
+    ) async throws -> (status: HTTPStatus, body: CodableValue) {
+        var result: (HTTPStatus, CodableValue) = (.internalServerError, .null)
+        try await app.test(.POST, "/api/graphql") { req in
+            req.headers.bearerAuthorization = BearerAuthorization(token: token)
+            try req.content.encode(GraphQLRequest(query: query, operationName: nil, variables: variables))
+        } afterResponse: { res in
+            result = (res.status, try res.content.decode(CodableValue.self))
+        }
+        return result
+    }
+
+    @Test("A reader walks VM to project and its bindings in one request")
+    func resolvesTheGraph() async throws {
+        try await withFixture { app, fixture in
+            let (status, body) = try await query(
+                app, token: fixture.adminToken,
+                """
+                query($id: ID!) {
+                  vm(id: $id) { name project { name vms { id } } volumes { id } nics { id } operations { id } }
+                  projects { name iamBindings { role } }
+                }
+                """, variables: ["id": .string(fixture.vm.id!.uuidString)])
+
+            #expect(status == .ok)
+            #expect(lookup(body, "errors") == nil)
+            #expect(string(lookup(body, "data", "vm", "name")) == "graphql-vm")
+            #expect(string(lookup(body, "data", "vm", "project", "name")) == "GraphQL Project")
+            #expect(count(lookup(body, "data", "vm", "project", "vms")) == 1)
+            #expect(count(lookup(body, "data", "vm", "volumes")) == 0)
+            #expect(string(lookup(body, "data", "projects", "0", "name")) == "GraphQL Project")
+            #expect(count(lookup(body, "data", "projects", "0", "iamBindings")) != nil)
+        }
+    }
+
+    @Test("Objects the caller may not read come back null or are left out")
+    func filtersUnreadableObjects() async throws {
+        try await withFixture { app, fixture in
+            // Bare org membership grants org:read, not reads on projects or VMs.
+            let (status, body) = try await query(
+                app, token: fixture.memberToken,
+                "query($id: ID!) { vm(id: $id) { name } projects { id } }",
+                variables: ["id": .string(fixture.vm.id!.uuidString)])
+
+            #expect(status == .ok)
+            #expect(isNull(lookup(body, "data", "vm")))
+            #expect(count(lookup(body, "data", "projects")) == 0)
+        }
+    }
+
+    @Test("Rejected documents are a 400 with only errors")
+    func rejectsBeforeRunning() async throws {
+        try await withFixture { app, fixture in
+            app.graphQL = GraphQLExecutor(
+                schema: StratoGraphQLSchema.schema, limits: GraphQLLimits(maxCost: 5, maxDepth: 10))
+
+            let (status, body) = try await query(app, token: fixture.adminToken, "{ projects { id } }")
+            #expect(status == .badRequest)
+            #expect(lookup(body, "data") == nil || isNull(lookup(body, "data")))
+            #expect(string(lookup(body, "errors", "0", "message"))?.contains("exceeds the limit") == true)
+
+            let (subscriptionStatus, _) = try await query(
+                app, token: fixture.adminToken, "subscription { resourceEvents { id } }")
+            #expect(subscriptionStatus == .badRequest)
+        }
+    }
+
+    @Test("The schema endpoint serves SDL")
+    func servesSchema() async throws {
+        try await withFixture { app, fixture in
+            try await app.test(.GET, "/api/graphql/schema") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: fixture.adminToken)
+            } afterResponse: { res in
+                #expect(res.status == .ok)
+                #expect(res.body.string.contains("type VM"))
+                #expect(res.body.string.contains("type Subscription"))
+            }
+        }
+    }
+
+    // MARK: - Subscriptions
+
+    @Test("Committed events reach subscribers once, filtered per subscriber")
+    func streamsEvents() async throws {
+        try await withFixture { app, fixture in
+            let admin = try #require(try await User.query(on: app.db).filter(\.$username == "graphqladmin").first())
+            let member = try #require(
+                try await User.query(on: app.db).filter(\.$username == "graphqlmember").first())
+            let subscription = app.resourceEvents.subscribe()
+
+            let event = WebhookEvent(
+                type: .vmStateChanged, organizationID: fixture.org.id!, projectID: fixture.project.id,
+                resource: .init(kind: "virtual_machine", id: fixture.vm.id!, name: fixture.vm.name),
+                data: ["status": .string("running")])
+            try await WebhookEvents.enqueue(event, on: app.db)
+
+            // Re-polling inside the overlap window must not deliver it twice.
+            try await app.resourceEvents.pollOnce()
+            try await app.resourceEvents.pollOnce()
+            app.resourceEvents.unsubscribe(subscription.id)
+            var received: [ResourceEvent] = []
+            for await row in subscription.events { received.append(row) }
+            #expect(received.map(\.id) == [event.id])
+
+            let plan = try executor.plan(
+                "subscription { resourceEvents(types: [\"vm.state_changed\"]) { id resourceName data } }",
+                operationName: nil, variables: nil)
+            let request = Request(application: app, on: app.eventLoopGroup.next())
+            let row = try #require(received.first)
+
+            let seen = await executor.execute(
+                plan, root: row, context: .subscription(request, userID: admin.id!))
+            #expect(string(lookup(seen, "data", "resourceEvents", "resourceName")) == "graphql-vm")
+            #expect(string(lookup(seen, "data", "resourceEvents", "data", "status")) == "running")
+
+            let hidden = await executor.execute(
+                plan, root: row, context: .subscription(request, userID: member.id!))
+            #expect(isNull(lookup(hidden, "data", "resourceEvents")))
+        }
+    }
+}
@@ -564,6 +564,8 @@ final class IAMAuthorizerBackstopTests {
         #expect(M.classify(path: "/organizations/\(id)/scim/v2/Users") == .isPublic)
         #expect(M.classify(path: "/api/projects/\(id)/images/\(id)/download") == .isPublic)
         #expect(M.classify(path: "/api/sandboxes/\(id)/snapshots/\(id)/artifacts/rootfs") == .isPublic)
+        #expect(M.classify(path: "/api/volumes/\(id)/migrations/\(id)/data") == .isPublic)
+        #expect(M.classify(path: "/api/volumes/\(id)/migrations") != .isPublic)
         // Identity-plane.
         #expect(M.classify(path: "/api/api-keys") == .loginOnly)
         #expect(M.classify(path: "/api/authorization/check") == .loginOnly)
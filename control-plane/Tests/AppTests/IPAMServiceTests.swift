@@ -153,6 +153,53 @@ struct IPAMServiceTests {
         }
     }
 
+    // MARK: - Fixed addresses
+
+    @Test("a fixed IPv4 address is claimed canonically when free")
+    func claimFree() throws {
+        let allocation = try IPAMService.claimIP(
+            "10.0.0.050", networkName: "net", subnet: "10.0.0.0/24", gateway: "10.0.0.1", used: [])
+        #expect(allocation.ipAddress == "10.0.0.50")
+        #expect(allocation.netmask == "255.255.255.0")
+        #expect(allocation.prefixLength == 24)
+    }
+
+    @Test("a fixed address may not be the gateway, in use, or outside the host range")
+    func claimRefusals() {
+        let used: Set<UInt32> = [IPAMService.parseIPv4("10.0.0.7")!]
+        func claim(_ address: String) throws {
+            _ = try IPAMService.claimIP(
+                address, networkName: "net", subnet: "10.0.0.0/24", gateway: "10.0.0.1", used: used)
+        }
+        let gateway = IPAMService.IPAMError.addressUnavailable(
+            address: "10.0.0.1", network: "net", reason: "the gateway")
+        #expect(throws: gateway) { try claim("10.0.0.1") }
+        let inUse = IPAMService.IPAMError.addressUnavailable(address: "10.0.0.7", network: "net", reason: "in use")
+        #expect(throws: inUse) { try claim("10.0.0.7") }
+        for outside in ["10.0.0.0", "10.0.0.255", "10.0.1.5", "not-an-ip"] {
+            #expect(throws: IPAMService.IPAMError.invalidAddress(address: outside, subnet: "10.0.0.0/24")) {
+                try claim(outside)
+            }
+        }
+    }
+
+    @Test("a fixed IPv6 address must sit in the /64 and not collide by interface ID")
+    func claimIPv6() throws {
+        let subnet6 = "fd12:3456:789a::/64"
+        func claim(_ address: String) throws -> IPAMService.Allocation6 {
+            try IPAMService.claimIPv6(
+                address, networkName: "net", subnet6: subnet6, gateway6: "fd12:3456:789a::1",
+                usedInterfaceIDs: [0x100])
+        }
+        #expect(try claim("FD12:3456:789A::00AB").ipAddress == "fd12:3456:789a::ab")
+        let inUse = IPAMService.IPAMError.addressUnavailable(
+            address: "fd12:3456:789a::100", network: "net", reason: "in use")
+        #expect(throws: inUse) { try claim("fd12:3456:789a::100") }
+        #expect(throws: IPAMService.IPAMError.invalidAddress(address: "fd00::5", subnet: subnet6)) {
+            try claim("fd00::5")
+        }
+    }
+
     // MARK: - Helpers
 
     @Test("firstHostAddress returns the conventional gateway")
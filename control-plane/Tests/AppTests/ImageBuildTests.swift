@@ -0,0 +1,430 @@
+import Fluent
+import StratoShared
+import Testing
+import Vapor
+import VaporTesting
+
+@testable import App
+
+/// Plays the build VM's guest: answers each guest command with the next
+/// scripted response, records what it was asked to run, and hands the disk
+/// export to `onExport`.
+actor FakeImageBuildAgent: ImageBuildAgent {
+    private var responses: [VMGuestExecResponse]
+    private(set) var commands: [[String]] = []
+    private(set) var exports: [VMDiskExportMessage] = []
+    private let onExport: @Sendable (VMDiskExportMessage) async throws -> Void
+
+    init(
+        responses: [VMGuestExecResponse] = [],
+        onExport: @escaping @Sendable (VMDiskExportMessage) async throws -> Void = { _ in }
+    ) {
+        self.responses = responses
+        self.onExport = onExport
+    }
+
+    func guestExec(
+        _ message: VMGuestExecMessage, agentId: String, timeout: Duration
+    ) async throws -> VMGuestExecResponse {
+        commands.append(message.command)
+        guard !responses.isEmpty else {
+            throw ImageBuildError.agentOperationFailed("No scripted response", nil)
+        }
+        return responses.removeFirst()
+    }
+
+    func exportDisk(_ message: VMDiskExportMessage, agentId: String, timeout: Duration) async throws {
+        exports.append(message)
+        try await onExport(message)
+    }
+}
+
+/// Server-side image builds (`/api/projects/:projectID/image-builds`):
+/// creation validates the request and the base image, and the build service
+/// walks a build through provisioning and capture. The agent is a
+/// `FakeImageBuildAgent`; the disk upload route's mTLS path shares its
+/// trust model with the image download tests.
+@Suite("Image Build Tests", .serialized)
+final class ImageBuildTests {
+
+    private func withImageBuildTestApp(
+        _ test: (Application, User, Project, Image, String) async throws -> Void
+    ) async throws {
+        let app = try await Application.makeForTesting()
+
+        do {
+            try await configure(app)
+            try await app.autoMigrate()
+
+            let builder = TestDataBuilder(db: app.db)
+            let user = try await builder.createUser(
+                username: "builduser",
+                email: "build@example.com",
+                displayName: "Build User",
+                isSystemAdmin: false
+            )
+            let org = try await builder.createOrganization(name: "Build Org")
+            try await builder.addUserToOrganization(user: user, organization: org, role: "admin")
+            user.currentOrganizationId = org.id
+            try await user.save(on: app.db)
+
+            let project = try await builder.createProject(
+                name: "Build Project",
+                description: "Project for image build tests",
+                organization: org
+            )
+            let baseImage = try await builder.createImage(name: "ubuntu", project: project, uploadedBy: user)
+            let token = try await user.generateAPIKey(on: app.db)
+
+            try await test(app, user, project, baseImage, token)
+        } catch {
+            await app.backgroundTasks.drain(timeout: .seconds(10))
+            try await app.shutdownForTesting()
+            throw error
+        }
+
+        await app.backgroundTasks.drain(timeout: .seconds(10))
+        try await app.shutdownForTesting()
+    }
+
+    /// A build in `status` whose VM runs on "agent-1" with a responsive
+    /// guest agent.
+    private func makeBuild(
+        app: Application,
+        user: User,
+        project: Project,
+        baseImage: Image,
+        status: ImageBuildStatus,
+        userData: String? = nil,
+        provisioners: [ImageBuildProvisioner] = [.init(kind: .shell, script: "true", command: nil, timeoutSeconds: nil)]
+    ) async throws -> (ImageBuild, VM) {
+        let build = ImageBuild(
+            projectID: try project.requireID(), environment: "development", name: "golden",
+            baseImageID: try baseImage.requireID(), targetImageName: "ubuntu-golden", userData: userData,
+            provisioners: provisioners, cpu: 1, memory: 1 << 30, disk: 10 << 30, createdByID: try user.requireID())
+        try await build.save(on: app.db)
+
+        let vm = try await TestDataBuilder(db: app.db).createVM(name: "image-build-golden", project: project)
+        vm.setStatus(status == .capturing ? .shutdown : .running)
+        vm.qgaAvailable = true
+        vm.hypervisorId = "agent-1"
+        vm.$imageBuild.id = build.id
+        try await vm.save(on: app.db)
+
+        build.vmId = vm.id
+        build.enter(status)
+        try await build.save(on: app.db)
+        return (build, vm)
+    }
+
+    private func reload(_ build: ImageBuild, on app: Application) async throws -> ImageBuild {
+        try #require(await ImageBuild.find(build.requireID(), on: app.db))
+    }
+
+    // MARK: - Create
+
+    @Test("POST creates a pending build sized from the base image")
+    func createAcceptsBuild() async throws {
+        try await withImageBuildTestApp { app, user, project, baseImage, token in
+            var created: ImageBuildResponse?
+            try await app.test(.POST, "/api/projects/\(project.id!)/image-builds") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                try req.content.encode(
+                    CreateImageBuildRequest(
+                        name: "golden", baseImageId: baseImage.id!, targetImageName: "ubuntu-golden",
+                        targetImageDescription: nil, environment: nil, userData: "#cloud-config\n",
+                        provisioners: [
+                            .init(kind: .shell, script: "apt-get install -y nginx", command: nil, timeoutSeconds: nil)
+                        ],
+                        networkId: nil, cpu: nil, memory: nil, disk: nil))
+            } afterResponse: { res in
+                #expect(res.status == .created)
+                created = try res.content.decode(ImageBuildResponse.self)
+            }
+
+            let response = try #require(created)
+            #expect(response.status == .pending)
+            #expect(response.totalSteps == 2)
+            #expect(response.completedSteps == 0)
+            #expect(response.cpu == 1)
+            #expect(response.disk == 10 * 1024 * 1024 * 1024)
+
+            let build = try #require(await ImageBuild.find(response.id, on: app.db))
+            #expect(build.environment == project.defaultEnvironment)
+            #expect(build.$createdBy.id == user.id)
+            #expect(build.steps.first == ImageBuild.cloudInitWait)
+        }
+    }
+
+    @Test("A build with neither provisioners nor user data is refused")
+    func createRefusesEmptyBuild() async throws {
+        try await withImageBuildTestApp { app, _, project, baseImage, token in
+            try await app.test(.POST, "/api/projects/\(project.id!)/image-builds") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                try req.content.encode([
+                    "name": "golden",
+                    "baseImageId": baseImage.id!.uuidString,
+                    "targetImageName": "ubuntu-golden",
+                ])
+            } afterResponse: { res in
+                #expect(res.status == .badRequest)
+            }
+            #expect(try await ImageBuild.query(on: app.db).count() == 0)
+        }
+    }
+
+    @Test("A base image that is not ready is refused")
+    func createRefusesUnreadyBaseImage() async throws {
+        try await withImageBuildTestApp { app, user, project, _, token in
+            let pending = try await TestDataBuilder(db: app.db).createImage(
+                name: "still-downloading", project: project, status: .downloading, uploadedBy: user)
+            try await app.test(.POST, "/api/projects/\(project.id!)/image-builds") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                try req.content.encode(
+                    CreateImageBuildRequest(
+                        name: "golden", baseImageId: pending.id!, targetImageName: "ubuntu-golden",
+                        targetImageDescription: nil, environment: nil, userData: nil,
+                        provisioners: [.init(kind: .exec, script: nil, command: ["true"], timeoutSeconds: nil)],
+                        networkId: nil, cpu: nil, memory: nil, disk: nil))
+            } afterResponse: { res in
+                #expect(res.status == .badRequest)
+            }
+        }
+    }
+
+    @Test("Provisioners must match their kind and stay within limits")
+    func provisionerValidation() throws {
+        let controller = ImageBuildController()
+        let valid: [ImageBuildProvisioner] = [
+            .init(kind: .shell, script: "echo hi", command: nil, timeoutSeconds: 60),
+            .init(kind: .exec, script: nil, command: ["/usr/bin/true"], timeoutSeconds: nil),
+        ]
+        #expect(try controller.validateProvisioners(valid) == valid)
+
+        let invalid: [ImageBuildProvisioner] = [
+            .init(kind: .shell, script: nil, command: ["echo"], timeoutSeconds: nil),
+            .init(kind: .shell, script: "   ", command: nil, timeoutSeconds: nil),
+            .init(kind: .exec, script: "echo hi", command: nil, timeoutSeconds: nil),
+            .init(kind: .exec, script: nil, command: [], timeoutSeconds: nil),
+            .init(kind: .shell, script: "echo hi", command: nil, timeoutSeconds: 0),
+            .init(kind: .shell, script: "echo hi", command: nil, timeoutSeconds: 21_601),
+            .init(
+                kind: .shell, script: String(repeating: "x", count: ImageBuild.maxProvisionerBytes),
+                command: nil, timeoutSeconds: nil),
+        ]
+        for provisioner in invalid {
+            #expect(throws: (any Error).self) { try controller.validateProvisioners([provisioner]) }
+        }
+
+        let tooMany = Array(repeating: valid[0], count: ImageBuild.maxProvisioners + 1)
+        #expect(throws: (any Error).self) { try controller.validateProvisioners(tooMany) }
+    }
+
+    // MARK: - Build lifecycle
+
+    @Test("A pending build creates its VM, linked to the build, and boots it")
+    func pendingBuildCreatesVM() async throws {
+        try await withImageBuildTestApp { app, user, project, baseImage, _ in
+            let build = ImageBuild(
+                projectID: project.id!, environment: "development", name: "golden", baseImageID: baseImage.id!,
+                targetImageName: "ubuntu-golden",
+                provisioners: [.init(kind: .shell, script: "true", command: nil, timeoutSeconds: nil)],
+                cpu: 1, memory: 1 << 30, disk: 10 << 30, createdByID: user.id!)
+            try await build.save(on: app.db)
+
+            await app.imageBuilds.advance(build, on: app.db)
+
+            let stored = try await reload(build, on: app)
+            #expect(stored.status == .booting)
+            #expect(stored.startedAt != nil)
+            let vm = try #require(await VM.find(stored.vmId, on: app.db))
+            #expect(vm.$imageBuild.id == build.id)
+            #expect(vm.$sourceImage.id == baseImage.id)
+            #expect(vm.desiredStatus == .running)
+            #expect(vm.hypervisorType == .qemu)
+        }
+    }
+
+    @Test("Steps run in order and a failing step fails the build")
+    func stepsRunInOrder() async throws {
+        try await withImageBuildTestApp { app, user, project, baseImage, _ in
+            let fake = FakeImageBuildAgent(responses: [
+                VMGuestExecResponse(exitCode: 0, signal: nil, output: "installed"),
+                VMGuestExecResponse(exitCode: 3, signal: nil, output: "no such unit"),
+            ])
+            app.imageBuilds.agent = fake
+            let (build, _) = try await makeBuild(
+                app: app, user: user, project: project, baseImage: baseImage, status: .provisioning,
+                provisioners: [
+                    .init(kind: .shell, script: "apt-get install -y nginx", command: nil, timeoutSeconds: nil),
+                    .init(kind: .exec, script: nil, command: ["systemctl", "enable", "nginx"], timeoutSeconds: 30),
+                ])
+
+            await app.imageBuilds.advance(build, on: app.db)
+            await app.backgroundTasks.drain(timeout: .seconds(10))
+            var stored = try await reload(build, on: app)
+            #expect(stored.status == .provisioning)
+            #expect(stored.stepIndex == 1)
+            #expect(stored.stepDeadline == nil)
+
+            await app.imageBuilds.advance(stored, on: app.db)
+            await app.backgroundTasks.drain(timeout: .seconds(10))
+            stored = try await reload(build, on: app)
+            #expect(stored.status == .failed)
+            #expect(stored.errorMessage?.contains("exited with status 3") == true)
+            #expect(stored.log.contains("==> Step 1/2: shell: apt-get install -y nginx\ninstalled"))
+            #expect(stored.log.contains("no such unit"))
+
+            #expect(await fake.commands == [
+                ["/bin/sh", "-c", "apt-get install -y nginx"], ["systemctl", "enable", "nginx"],
+            ])
+        }
+    }
+
+    @Test("The cloud-init wait runs first and tolerates exit status 2")
+    func cloudInitWaitToleratesRecoverableErrors() async throws {
+        try await withImageBuildTestApp { app, user, project, baseImage, _ in
+            let fake = FakeImageBuildAgent(responses: [
+                VMGuestExecResponse(exitCode: 2, signal: nil, output: "status: done"),
+            ])
+            app.imageBuilds.agent = fake
+            let (build, _) = try await makeBuild(
+                app: app, user: user, project: project, baseImage: baseImage, status: .provisioning,
+                userData: "#cloud-config\npackages: [nginx]\n")
+
+            await app.imageBuilds.advance(build, on: app.db)
+            await app.backgroundTasks.drain(timeout: .seconds(10))
+
+            let stored = try await reload(build, on: app)
+            #expect(stored.status == .provisioning)
+            #expect(stored.stepIndex == 1)
+            #expect(await fake.commands == [["cloud-init", "status", "--wait"]])
+        }
+    }
+
+    @Test("A step whose lease expired without a result fails rather than repeats")
+    func expiredStepLeaseFailsBuild() async throws {
+        try await withImageBuildTestApp { app, user, project, baseImage, _ in
+            let fake = FakeImageBuildAgent()
+            app.imageBuilds.agent = fake
+            let (build, _) = try await makeBuild(
+                app: app, user: user, project: project, baseImage: baseImage, status: .provisioning)
+            build.stepDeadline = Date().addingTimeInterval(-1)
+            try await build.save(on: app.db)
+
+            await app.imageBuilds.advance(build, on: app.db)
+
+            let stored = try await reload(build, on: app)
+            #expect(stored.status == .failed)
+            #expect(stored.errorMessage?.contains("steps are not repeated") == true)
+            #expect(await fake.commands.isEmpty)
+        }
+    }
+
+    @Test("Capture adds the next version of the target image")
+    func captureAddsNextVersion() async throws {
+        try await withImageBuildTestApp { app, user, project, baseImage, _ in
+            let builder = TestDataBuilder(db: app.db)
+            _ = try await builder.createImage(name: "ubuntu-golden", project: project, uploadedBy: user)
+
+            // Stands in for the agent's upload, which marks the image ready.
+            let fake = FakeImageBuildAgent(onExport: { [app] message in
+                let buildID = try #require(UUID(uuidString: String(message.uploadURL.split(separator: "/")[2])))
+                let build = try #require(await ImageBuild.find(buildID, on: app.db))
+                let image = try #require(await build.$image.get(on: app.db))
+                image.status = .ready
+                try await image.save(on: app.db)
+            })
+            app.imageBuilds.agent = fake
+            let (build, vm) = try await makeBuild(
+                app: app, user: user, project: project, baseImage: baseImage, status: .capturing)
+
+            await app.imageBuilds.advance(build, on: app.db)
+            await app.backgroundTasks.drain(timeout: .seconds(10))
+
+            let stored = try await reload(build, on: app)
+            #expect(stored.status == .succeeded)
+            #expect(stored.finishedAt != nil)
+            let image = try #require(await stored.$image.get(on: app.db))
+            #expect(image.name == "ubuntu-golden")
+            #expect(image.version == 2)
+            #expect(image.$imageBuild.id == build.id)
+            #expect(image.filename == "ubuntu-golden-v2.qcow2")
+
+            let exports = await fake.exports
+            #expect(exports.map(\.vmId) == [vm.id!.uuidString])
+            #expect(exports.first?.uploadURL == "/api/image-builds/\(build.id!)/disk")
+        }
+    }
+
+    @Test("A capture that never uploads fails the build and drops the image")
+    func captureWithoutUploadFails() async throws {
+        try await withImageBuildTestApp { app, user, project, baseImage, _ in
+            app.imageBuilds.agent = FakeImageBuildAgent()
+            let (build, _) = try await makeBuild(
+                app: app, user: user, project: project, baseImage: baseImage, status: .capturing)
+
+            await app.imageBuilds.advance(build, on: app.db)
+            await app.backgroundTasks.drain(timeout: .seconds(10))
+
+            let stored = try await reload(build, on: app)
+            #expect(stored.status == .failed)
+            #expect(stored.$image.id == nil)
+            #expect(
+                try await Image.query(on: app.db).filter(\.$name == "ubuntu-golden").count() == 0)
+        }
+    }
+
+    // MARK: - Cancel and delete
+
+    @Test("Cancelling a running build ends it, and it can't be deleted until its VM is gone")
+    func cancelThenDelete() async throws {
+        try await withImageBuildTestApp { app, user, project, baseImage, token in
+            let (build, vm) = try await makeBuild(
+                app: app, user: user, project: project, baseImage: baseImage, status: .provisioning)
+            let path = "/api/projects/\(project.id!)/image-builds/\(build.id!)"
+
+            try await app.test(.DELETE, path) { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+            } afterResponse: { res in
+                #expect(res.status == .conflict)
+            }
+
+            try await app.test(.POST, "\(path)/cancel") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+            } afterResponse: { res in
+                #expect(res.status == .ok)
+                let response = try res.content.decode(ImageBuildResponse.self)
+                #expect(response.status == .cancelled)
+            }
+            await app.backgroundTasks.drain(timeout: .seconds(10))
+
+            // Its agent is offline, so the VM goes at once; the next pass
+            // forgets it.
+            #expect(try await VM.find(vm.id, on: app.db) == nil)
+            await app.imageBuilds.sweepOnce(acquiringLock: false)
+            #expect(try await reload(build, on: app).vmId == nil)
+
+            try await app.test(.DELETE, path) { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+            } afterResponse: { res in
+                #expect(res.status == .noContent)
+            }
+            #expect(try await ImageBuild.find(build.id, on: app.db) == nil)
+        }
+    }
+
+    @Test("The disk upload route requires agent mTLS")
+    func diskUploadRequiresMTLS() async throws {
+        try await withImageBuildTestApp { app, user, project, baseImage, token in
+            let (build, _) = try await makeBuild(
+                app: app, user: user, project: project, baseImage: baseImage, status: .capturing)
+            try await app.test(.PUT, "/api/image-builds/\(build.id!)/disk") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                req.body = ByteBuffer(string: "not a disk")
+            } afterResponse: { res in
+                #expect(res.status == .unauthorized)
+            }
+        }
+    }
+}
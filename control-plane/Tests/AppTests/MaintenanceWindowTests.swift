@@ -0,0 +1,165 @@
+import Fluent
+import Foundation
+import Testing
+import Vapor
+import VaporTesting
+
+@testable import App
+
+/// Project maintenance windows: when a policy is open, where its next
+/// opening falls (in the project's own zone, across DST), what it refuses
+/// to store, and the project endpoint that sets it.
+@Suite("Maintenance Window Tests", .serialized)
+struct MaintenanceWindowTests {
+
+    private static func date(_ iso: String) -> Date {
+        ISO8601DateFormatter().date(from: iso)!
+    }
+
+    /// Tuesdays 02:00–04:00 Berlin time: 00:00–02:00Z in summer, 01:00–03:00Z
+    /// in winter. 2026-10-13 and 2026-10-27 are Tuesdays either side of the
+    /// switch on 2026-10-25.
+    private static let berlinTuesdays = MaintenancePolicy(
+        timeZone: "Europe/Berlin",
+        windows: [.init(days: [.tuesday], startTime: "02:00", durationMinutes: 120)])
+
+    @Test("A window is read in the policy's zone")
+    func windowInItsZone() {
+        let policy = Self.berlinTuesdays
+        #expect(!policy.isOpen(at: Self.date("2026-10-12T23:59:00Z")))
+        #expect(policy.isOpen(at: Self.date("2026-10-13T00:30:00Z")))
+        #expect(!policy.isOpen(at: Self.date("2026-10-13T02:00:00Z")))
+        #expect(policy.nextOpening(atOrAfter: Self.date("2026-10-12T12:00:00Z")) == Self.date("2026-10-13T00:00:00Z"))
+    }
+
+    @Test("A window keeps its local time across daylight-saving changes")
+    func windowAcrossDST() {
+        #expect(
+            Self.berlinTuesdays.nextOpening(atOrAfter: Self.date("2026-10-21T00:00:00Z"))
+                == Self.date("2026-10-27T01:00:00Z"))
+    }
+
+    @Test("A window starting in the hour a DST change skips or repeats still occurs that day")
+    func windowOnDSTChangeDay() {
+        // New York springs forward at 02:00 on Sunday 2027-03-14 (02:30 never
+        // happens) and falls back at 02:00 on Sunday 2026-11-01 (01:30
+        // happens twice). A daily window at either time must occur exactly
+        // once on each of those days, neither dropped nor doubled.
+        let spring = MaintenancePolicy(
+            timeZone: "America/New_York",
+            windows: [.init(days: MaintenancePolicy.Weekday.allCases, startTime: "02:30", durationMinutes: 120)])
+        let springDay = spring.occurrences(
+            from: Self.date("2027-03-14T04:00:00Z"), through: Self.date("2027-03-15T03:59:00Z"))
+        #expect(springDay.count == 1)
+        // 04:00 EDT — inside the window whichever side of the gap it starts.
+        #expect(spring.isOpen(at: Self.date("2027-03-14T08:00:00Z")))
+        // The day after, the window is back at 02:30 EDT.
+        #expect(spring.isOpen(at: Self.date("2027-03-15T06:30:00Z")))
+        #expect(!spring.isOpen(at: Self.date("2027-03-15T06:29:00Z")))
+
+        let fall = MaintenancePolicy(
+            timeZone: "America/New_York",
+            windows: [.init(days: MaintenancePolicy.Weekday.allCases, startTime: "01:30", durationMinutes: 30)])
+        let fallDay = fall.occurrences(
+            from: Self.date("2026-11-01T04:00:00Z"), through: Self.date("2026-11-02T04:59:00Z"))
+        #expect(fallDay.count == 1)
+        // The day before in EDT and the day after in EST.
+        #expect(fall.isOpen(at: Self.date("2026-10-31T05:45:00Z")))
+        #expect(fall.isOpen(at: Self.date("2026-11-02T06:45:00Z")))
+        #expect(!fall.isOpen(at: Self.date("2026-11-02T05:45:00Z")))
+    }
+
+    @Test("A window may run past midnight into the next day")
+    func windowPastMidnight() {
+        let policy = MaintenancePolicy(
+            windows: [.init(days: [.saturday], startTime: "23:00", durationMinutes: 180)])
+        #expect(policy.isOpen(at: Self.date("2026-10-18T01:30:00Z")))
+        #expect(!policy.isOpen(at: Self.date("2026-10-18T02:00:00Z")))
+    }
+
+    @Test("Deny periods close windows, and their end can be the next opening")
+    func denyPeriods() {
+        var policy = Self.berlinTuesdays
+        policy.denyPeriods = [
+            .init(start: Self.date("2026-10-12T00:00:00Z"), end: Self.date("2026-10-14T00:00:00Z"), reason: "launch")
+        ]
+        #expect(!policy.isOpen(at: Self.date("2026-10-13T00:30:00Z")))
+        #expect(policy.nextOpening(atOrAfter: Self.date("2026-10-12T12:00:00Z")) == Self.date("2026-10-20T00:00:00Z"))
+
+        // Without windows a deny period is the only thing that closes.
+        let denyOnly = MaintenancePolicy(denyPeriods: policy.denyPeriods)
+        #expect(denyOnly.isOpen(at: Self.date("2026-10-11T12:00:00Z")))
+        #expect(denyOnly.nextOpening(atOrAfter: Self.date("2026-10-13T12:00:00Z")) == Self.date("2026-10-14T00:00:00Z"))
+    }
+
+    @Test("Malformed policies are refused")
+    func validation() {
+        #expect(MaintenancePolicy(timeZone: "Mars/Olympus").validationError != nil)
+        #expect(
+            MaintenancePolicy(windows: [.init(days: [.monday], startTime: "2:00", durationMinutes: 60)])
+                .validationError != nil)
+        #expect(
+            MaintenancePolicy(windows: [.init(days: [.monday], startTime: "02:00", durationMinutes: 10)])
+                .validationError != nil)
+        #expect(
+            MaintenancePolicy(windows: [.init(days: [], startTime: "02:00", durationMinutes: 60)])
+                .validationError != nil)
+        let backwards = MaintenancePolicy.DenyPeriod(
+            start: Self.date("2026-10-14T00:00:00Z"), end: Self.date("2026-10-12T00:00:00Z"))
+        #expect(MaintenancePolicy(denyPeriods: [backwards]).validationError != nil)
+        #expect(MaintenancePolicy(noticeHours: -1).validationError != nil)
+        #expect(Self.berlinTuesdays.validationError == nil)
+    }
+
+    @Test("Project admins set and clear the policy; bad ones are a 400")
+    func projectEndpoint() async throws {
+        try await withTestApp { app in
+            let builder = TestDataBuilder(db: app.db)
+            let user = try await builder.createUser(
+                username: "windowadmin", email: "windowadmin@example.com", isSystemAdmin: false)
+            let org = try await builder.createOrganization(name: "Window Org")
+            try await builder.addUserToOrganization(user: user, organization: org, role: "admin")
+            user.currentOrganizationId = org.id
+            try await user.save(on: app.db)
+            let project = try await builder.createProject(
+                name: "Window Project", description: "Project for maintenance windows", organization: org)
+            let token = try await user.generateAPIKey(on: app.db)
+            let path = "/api/projects/\(project.id!)/maintenance-policy"
+
+            try await app.test(.GET, path) { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+            } afterResponse: { res in
+                #expect(res.status == .ok)
+                let body = try res.content.decode(ProjectMaintenancePolicyResponse.self)
+                #expect(body.policy == nil)
+                #expect(body.openNow)
+            }
+
+            try await app.test(.PUT, path) { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                try req.content.encode(MaintenancePolicy(timeZone: "Nowhere/Special"))
+            } afterResponse: { res in
+                #expect(res.status == .badRequest)
+            }
+
+            try await app.test(.PUT, path) { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                try req.content.encode(Self.berlinTuesdays)
+            } afterResponse: { res in
+                #expect(res.status == .ok)
+                let body = try res.content.decode(ProjectMaintenancePolicyResponse.self)
+                #expect(body.policy == Self.berlinTuesdays)
+                #expect(body.nextOpening != nil)
+            }
+            let stored = try await Project.find(project.id, on: app.db)
+            #expect(stored?.maintenancePolicy?.noticeHours == MaintenancePolicy.defaultNoticeHours)
+
+            try await app.test(.DELETE, path) { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+            } afterResponse: { res in
+                #expect(res.status == .noContent)
+            }
+            #expect(try await Project.find(project.id, on: app.db)?.maintenancePolicy == nil)
+        }
+    }
+}
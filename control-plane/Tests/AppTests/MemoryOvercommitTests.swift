@@ -0,0 +1,125 @@
+import Fluent
+import Foundation
+import StratoShared
+import Testing
+import Vapor
+import VaporTesting
+
+@testable import App
+
+/// Memory overcommit: the agent PATCH storing and validating a policy, and
+/// the desired-state sync carrying it — explicitly, even once removed — to
+/// v26 agents only.
+@Suite("Memory Overcommit Tests", .serialized)
+struct MemoryOvercommitTests {
+
+    private func withOvercommitApp(_ test: (Application, Agent, String) async throws -> Void) async throws {
+        try await withTestApp { app in
+            let builder = TestDataBuilder(db: app.db)
+            let admin = try await builder.createUser(
+                username: "overcommit-admin", email: "overcommit-admin@example.com", isSystemAdmin: true)
+            let org = try await builder.createOrganization(name: "Overcommit Org")
+            try await builder.addUserToOrganization(user: admin, organization: org, role: "admin")
+
+            let agent = Agent(
+                name: "dense-host",
+                hostname: "dense-host.example",
+                version: "1.0.0",
+                capabilities: ["qemu"],
+                status: .online,
+                resources: AgentResources(
+                    totalCPU: 16, availableCPU: 16,
+                    totalMemory: 1 << 34, availableMemory: 1 << 34,
+                    totalDisk: 1 << 40, availableDisk: 1 << 40
+                ),
+                lastHeartbeat: Date()
+            )
+            agent.wireProtocolVersion = WireProtocol.memoryOvercommitMinimumVersion
+            agent.organizationScope = .organization(try org.requireID())
+            try await agent.save(on: app.db)
+
+            try await test(app, agent, try await admin.generateAPIKey(on: app.db))
+        }
+    }
+
+    private func patch(
+        _ app: Application, _ agent: Agent, token: String, body: String,
+        _ assertions: (TestingHTTPResponse) throws -> Void
+    ) async throws {
+        try await app.test(.PATCH, "/api/agents/\(try agent.requireID())") { req in
+            req.headers.bearerAuthorization = BearerAuthorization(token: token)
+            req.headers.contentType = .json
+            req.body = ByteBuffer(string: body)
+        } afterResponse: { res in
+            try assertions(res)
+        }
+    }
+
+    @Test("PATCH stores a policy, fills in defaults, and null removes it")
+    func patchSetsAndClearsPolicy() async throws {
+        try await withOvercommitApp { app, agent, token in
+            try await patch(app, agent, token: token, body: #"{"memoryOvercommit":{"ratio":1.5,"ksm":{}}}"#) { res in
+                #expect(res.status == .ok)
+                let body = try res.content.decode(AgentResponse.self)
+                #expect(body.memoryOvercommit == MemoryOvercommitPolicy(ratio: 1.5, ksm: KSMTuning()))
+            }
+
+            // Other fields leave the policy alone.
+            try await patch(app, agent, token: token, body: #"{"autoUpdate":true}"#) { res in
+                #expect(try res.content.decode(AgentResponse.self).memoryOvercommit?.ratio == 1.5)
+            }
+
+            try await patch(app, agent, token: token, body: #"{"memoryOvercommit":null}"#) { res in
+                #expect(res.status == .ok)
+                #expect(try res.content.decode(AgentResponse.self).memoryOvercommit == nil)
+            }
+            #expect(try await Agent.find(agent.requireID(), on: app.db)?.memoryOvercommit == nil)
+        }
+    }
+
+    @Test("PATCH refuses a ratio below 1 or above the maximum, and inverted thresholds")
+    func patchValidates() async throws {
+        try await withOvercommitApp { app, agent, token in
+            for body in [
+                #"{"memoryOvercommit":{"ratio":0.5}}"#,
+                #"{"memoryOvercommit":{"ratio":10}}"#,
+                #"{"memoryOvercommit":{"ratio":2,"pressureReclaim":"#
+                    + #"{"pressureThresholdPercent":1,"releaseThresholdPercent":5}}}"#,
+            ] {
+                try await patch(app, agent, token: token, body: body) { res in
+                    #expect(res.status == .badRequest)
+                }
+            }
+            #expect(try await Agent.find(agent.requireID(), on: app.db)?.memoryOvercommit == nil)
+        }
+    }
+
+    @Test("the sync carries the policy to a v26 agent, and an explicit ratio 1 once it is removed")
+    func syncCarriesPolicy() async throws {
+        try await withOvercommitApp { app, agent, _ in
+            let agentId = try agent.requireID().uuidString
+            let policy = MemoryOvercommitPolicy(
+                ratio: 2, freePageReporting: true, pressureReclaim: PressureReclaimPolicy())
+            agent.memoryOvercommit = policy
+            try await agent.save(on: app.db)
+            #expect(try await app.desiredStateAssembler.assemble(agentId: agentId).memoryOvercommit == policy)
+
+            agent.memoryOvercommit = nil
+            try await agent.save(on: app.db)
+            #expect(
+                try await app.desiredStateAssembler.assemble(agentId: agentId).memoryOvercommit
+                    == MemoryOvercommitPolicy(ratio: 1))
+        }
+    }
+
+    @Test("an agent below v26 gets no opinion on overcommit")
+    func oldAgentGetsNil() async throws {
+        try await withOvercommitApp { app, agent, _ in
+            agent.wireProtocolVersion = WireProtocol.memoryOvercommitMinimumVersion - 1
+            agent.memoryOvercommit = MemoryOvercommitPolicy(ratio: 2)
+            try await agent.save(on: app.db)
+            let message = try await app.desiredStateAssembler.assemble(agentId: agent.requireID().uuidString)
+            #expect(message.memoryOvercommit == nil)
+        }
+    }
+}
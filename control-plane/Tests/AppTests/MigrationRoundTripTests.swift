@@ -77,4 +77,24 @@ struct MigrationRoundTripTests {
             }
         }
     }
+
+    @Test("The transitional-volume index covers every status the stuck sweep watches")
+    func transitionalVolumeIndexCoversSweep() async throws {
+        try await withTestApp { app in
+            let sql = try #require(app.db as? SQLDatabase)
+
+            // A sweep query naming a status outside the partial predicate
+            // cannot use the index, so the two lists must move together.
+            let rows = try await sql.raw(
+                """
+                SELECT indexdef FROM pg_indexes
+                WHERE schemaname = current_schema() AND indexname = 'idx_volumes_transitional'
+                """
+            ).all()
+            let definition = try #require(rows.first).decode(column: "indexdef", as: String.self)
+            for status in AgentService.transitionalVolumeStatuses {
+                #expect(definition.contains("'\(status.rawValue)'"), "index predicate misses \(status.rawValue)")
+            }
+        }
+    }
 }
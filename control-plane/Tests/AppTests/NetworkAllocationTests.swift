@@ -0,0 +1,156 @@
+import Fluent
+import Foundation
+import Testing
+import Vapor
+import VaporTesting
+
+@testable import App
+
+/// Address reservations on logical networks and the allocation listing:
+/// reserving a named or next-free address, refusing taken ones, and listing
+/// who holds what.
+@Suite("Network Allocation Tests", .serialized)
+struct NetworkAllocationTests {
+
+    private struct Fixture {
+        let project: Project
+        let network: LogicalNetwork
+        let token: String
+    }
+
+    private func withFixture(_ test: (Application, Fixture) async throws -> Void) async throws {
+        try await withTestApp { app in
+            let builder = TestDataBuilder(db: app.db)
+            let user = try await builder.createUser(
+                username: "reserver", email: "reserver@example.com", isSystemAdmin: false)
+            let org = try await builder.createOrganization(name: "Reserve Org")
+            try await builder.addUserToOrganization(user: user, organization: org, role: "admin")
+            user.currentOrganizationId = org.id
+            try await user.save(on: app.db)
+            let project = try await builder.createProject(
+                name: "Reserve Project", description: "Project for reservations", organization: org)
+            let network = LogicalNetwork(
+                name: "reserve-net", subnet: "10.140.0.0/24", gateway: "10.140.0.1",
+                subnet6: "fd00:140::/64", gateway6: "fd00:140::1",
+                projectID: project.id!, createdByID: user.id!)
+            try await network.save(on: app.db)
+            let token = try await user.generateAPIKey(on: app.db)
+            try await test(app, Fixture(project: project, network: network, token: token))
+        }
+    }
+
+    private func reserve(
+        _ body: CreateIPReservationRequest, in fixture: Fixture, app: Application
+    ) async throws -> (HTTPStatus, IPReservationResponse?) {
+        var result: (HTTPStatus, IPReservationResponse?) = (.internalServerError, nil)
+        try await app.test(.POST, "/api/networks/\(fixture.network.id!)/reservations") { req in
+            req.headers.bearerAuthorization = BearerAuthorization(token: fixture.token)
+            try req.content.encode(body)
+        } afterResponse: { res in
+            result = (res.status, res.status == .ok ? try res.content.decode(IPReservationResponse.self) : nil)
+        }
+        return result
+    }
+
+    @Test("Reservations take a named address or the next free one, and refuse taken ones")
+    func reservations() async throws {
+        try await withFixture { app, fixture in
+            let named = try await reserve(
+                .init(address: "10.140.0.20", family: nil, projectId: nil, description: "db primary"),
+                in: fixture, app: app)
+            #expect(named.0 == .ok)
+            #expect(named.1?.address == "10.140.0.20")
+            #expect(named.1?.projectId == fixture.project.id)
+
+            let next = try await reserve(
+                .init(address: nil, family: nil, projectId: nil, description: nil), in: fixture, app: app)
+            #expect(next.1?.address == "10.140.0.2")
+
+            let v6 = try await reserve(
+                .init(address: nil, family: .ipv6, projectId: nil, description: nil), in: fixture, app: app)
+            #expect(v6.1?.family == "ipv6")
+            #expect(v6.1?.address == "fd00:140::100")
+
+            let again = try await reserve(
+                .init(address: "10.140.0.20", family: nil, projectId: nil, description: nil), in: fixture, app: app)
+            #expect(again.0 == .conflict)
+            let gateway = try await reserve(
+                .init(address: "10.140.0.1", family: nil, projectId: nil, description: nil), in: fixture, app: app)
+            #expect(gateway.0 == .conflict)
+            let outside = try await reserve(
+                .init(address: "10.9.9.9", family: nil, projectId: nil, description: nil), in: fixture, app: app)
+            #expect(outside.0 == .badRequest)
+
+            // Released reservations free their address.
+            let reservationID = try #require(named.1?.id)
+            try await app.test(.DELETE, "/api/networks/\(fixture.network.id!)/reservations/\(reservationID)") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: fixture.token)
+            } afterResponse: { res in
+                #expect(res.status == .noContent)
+            }
+            #expect(try await IPReservation.query(on: app.db).count() == 2)
+        }
+    }
+
+    @Test("An IPv6-only network reserves IPv6 by default and refuses IPv4")
+    func ipv6OnlyReservations() async throws {
+        try await withFixture { app, fixture in
+            let network = LogicalNetwork(
+                name: "reserve-v6", subnet: nil, subnet6: "fd00:141::/64", gateway6: "fd00:141::1",
+                projectID: fixture.project.id!)
+            try await network.save(on: app.db)
+            let path = "/api/networks/\(network.id!)/reservations"
+            let cases: [(CreateIPReservationRequest, HTTPStatus, String?)] = [
+                (.init(address: nil, family: nil, projectId: nil, description: nil), .ok, "fd00:141::100"),
+                (.init(address: nil, family: .ipv4, projectId: nil, description: nil), .badRequest, nil),
+                (.init(address: "10.0.0.5", family: nil, projectId: nil, description: nil), .badRequest, nil),
+            ]
+            for (body, status, address) in cases {
+                try await app.test(.POST, path) { req in
+                    req.headers.bearerAuthorization = BearerAuthorization(token: fixture.token)
+                    try req.content.encode(body)
+                } afterResponse: { res in
+                    #expect(res.status == status)
+                    if let address {
+                        #expect(try res.content.decode(IPReservationResponse.self).address == address)
+                    }
+                }
+            }
+            #expect(try await IPAMService.allocateIP(for: network, on: app.db) == nil)
+        }
+    }
+
+    @Test("Allocations list the router, workloads and reservations, each address once")
+    func allocations() async throws {
+        try await withFixture { app, fixture in
+            let vm = try await TestDataBuilder(db: app.db).createVM(name: "holder-vm", project: fixture.project)
+            let nic = VMNetworkInterface(vmID: vm.id!, network: "reserve-net", macAddress: "52:54:00:00:00:01")
+            try await nic.save(on: app.db)
+            try await VMInterfaceAddress(
+                interfaceID: nic.id!, network: "reserve-net", family: .ipv4, address: "10.140.0.5",
+                prefixLength: 24, gateway: "10.140.0.1"
+            ).save(on: app.db)
+            let taken = IPReservation(
+                networkID: fixture.network.id!, projectID: fixture.project.id!, family: .ipv4, address: "10.140.0.5")
+            try await taken.save(on: app.db)
+            try await IPReservation(
+                networkID: fixture.network.id!, projectID: fixture.project.id!, family: .ipv4, address: "10.140.0.30",
+                description: "spare"
+            ).save(on: app.db)
+
+            try await app.test(.GET, "/api/networks/\(fixture.network.id!)/allocations") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: fixture.token)
+            } afterResponse: { res in
+                #expect(res.status == .ok)
+                let body = try res.content.decode(NetworkAllocationsResponse.self)
+                #expect(body.allocations.map(\.address) == ["10.140.0.1", "10.140.0.5", "10.140.0.30", "fd00:140::1"])
+                #expect(body.allocations.map(\.kind) == [.router, .vm, .reservation, .router])
+                let held = body.allocations[1]
+                #expect(held.resourceId == vm.id)
+                #expect(held.resourceName == "holder-vm")
+                #expect(held.reservationId == taken.id)
+                #expect(body.allocations[2].resourceName == "spare")
+            }
+        }
+    }
+}
@@ -209,6 +209,56 @@ final class NetworkControllerTests {
         }
     }
 
+    @Test("POST /api/networks without a subnet creates an IPv6-only network")
+    func createIPv6Only() async throws {
+        try await withNetworkTestApp { app, _, project, token in
+            var created: NetworkResponse?
+            try await app.test(.POST, "/api/networks") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                try req.content.encode(
+                    CreateNetworkRequest(name: "v6only-net", subnet: nil, projectId: project.id!))
+            } afterResponse: { res in
+                #expect(res.status == .ok)
+                created = try res.content.decode(NetworkResponse.self)
+            }
+            let network = try #require(created)
+            #expect(network.subnet == nil)
+            #expect(network.gateway == nil)
+            #expect(network.subnet6 != nil)
+            // No resolvers are invented for it: there is no DNS64 to point at.
+            #expect(network.dnsServers.isEmpty)
+
+            // IPv6 is all it has, so it can't be turned off.
+            try await app.test(.PUT, "/api/networks/\(network.id!)") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                try req.content.encode(UpdateNetworkRequest(ipv6Enabled: false))
+            } afterResponse: { res in
+                #expect(res.status == .badRequest)
+            }
+            try await app.test(.PUT, "/api/networks/\(network.id!)") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                try req.content.encode(UpdateNetworkRequest(dnsServers: ["8.8.8.8"]))
+            } afterResponse: { res in
+                #expect(res.status == .badRequest)
+            }
+
+            let invalid: [CreateNetworkRequest] = [
+                CreateNetworkRequest(name: "gw-net", subnet: nil, gateway: "10.0.0.1", projectId: project.id!),
+                CreateNetworkRequest(name: "none-net", subnet: nil, ipv6Enabled: false, projectId: project.id!),
+                CreateNetworkRequest(
+                    name: "dns4-net", subnet: nil, projectId: project.id!, dnsServers: ["1.1.1.1"]),
+            ]
+            for body in invalid {
+                try await app.test(.POST, "/api/networks") { req in
+                    req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                    try req.content.encode(body)
+                } afterResponse: { res in
+                    #expect(res.status == .badRequest, "\(body.name) should be rejected")
+                }
+            }
+        }
+    }
+
     @Test("POST /api/networks rejects non-/64 and non-routable IPv6 subnets (400)")
     func createRejectsInvalidSubnet6() async throws {
         try await withNetworkTestApp { app, _, project, token in
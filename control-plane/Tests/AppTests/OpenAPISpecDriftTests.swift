@@ -27,6 +27,9 @@ struct OpenAPISpecDriftTests {
         "GET /api/vms/{}/console",
         "POST /api/sandboxes/{}/exec",
         "GET /api/sandboxes/{}/exec/{}/attach",
+        "GET /api/vms/{}/console/sessions/{}/join",
+        "GET /api/sandboxes/{}/exec/{}/join",
+        "GET /api/graphql/ws",
     ]
 
     /// Collapse every path parameter to `{}` so the spec's `{vmID}` and Vapor's
@@ -0,0 +1,347 @@
+import Fluent
+import Foundation
+import Testing
+import Vapor
+import VaporTesting
+
+@testable import App
+
+/// Verified organization domains: registration and the DNS challenge
+/// (`OrganizationDomainController`, answered by a stub resolver), and what a
+/// verified domain does at OIDC sign-in — auto-join with the domain's role and
+/// the consented account claim (`OIDCIdentityService`).
+@Suite("Organization Domain Tests", .serialized)
+final class OrganizationDomainTests {
+
+    private struct StubResolver: DomainTXTResolver {
+        var records: [String: [String]] = [:]
+
+        func txtRecords(for name: String) async throws -> [String] { records[name] ?? [] }
+    }
+
+    private func withOrgAdmin(_ test: (Application, Organization, String) async throws -> Void) async throws {
+        try await withTestApp { app in
+            app.domainTXTResolver = StubResolver()
+            let builder = TestDataBuilder(db: app.db)
+            let user = try await builder.createUser(
+                username: "domainadmin", email: "domainadmin@example.com", isSystemAdmin: false)
+            let org = try await builder.createOrganization(name: "Domain Org")
+            try await builder.addUserToOrganization(user: user, organization: org, role: "admin")
+            user.currentOrganizationId = org.id
+            try await user.save(on: app.db)
+            let token = try await user.generateAPIKey(on: app.db)
+            try await test(app, org, token)
+        }
+    }
+
+    private struct CreateBody: Content {
+        let domain: String
+        var autoJoin: Bool? = nil
+        var defaultRole: String? = nil
+        var claimAccounts: Bool? = nil
+    }
+
+    private func register(
+        _ body: CreateBody, org: Organization, token: String, app: Application
+    ) async throws -> OrganizationDomainResponse {
+        var created: OrganizationDomainResponse?
+        try await app.test(.POST, "/api/organizations/\(org.id!)/domains") { req in
+            req.headers.bearerAuthorization = BearerAuthorization(token: token)
+            try req.content.encode(body)
+        } afterResponse: { res in
+            #expect(res.status == .ok)
+            created = try res.content.decode(OrganizationDomainResponse.self)
+        }
+        return try #require(created)
+    }
+
+    private func verify(
+        _ domain: OrganizationDomainResponse, token: String, app: Application
+    ) async throws -> OrganizationDomainResponse {
+        var verified: OrganizationDomainResponse?
+        try await app.test(.POST, "/api/organizations/\(domain.organizationId)/domains/\(domain.id)/verify") { req in
+            req.headers.bearerAuthorization = BearerAuthorization(token: token)
+        } afterResponse: { res in
+            #expect(res.status == .ok)
+            verified = try res.content.decode(OrganizationDomainResponse.self)
+        }
+        return try #require(verified)
+    }
+
+    // MARK: - Registration and verification
+
+    @Test("A registered domain is pending and names the record to publish")
+    func registerIsPending() async throws {
+        try await withOrgAdmin { app, org, token in
+            let domain = try await register(CreateBody(domain: "Example.COM."), org: org, token: token, app: app)
+            #expect(domain.domain == "example.com")
+            #expect(domain.status == "pending")
+            #expect(domain.recordName == "_strato-challenge.example.com")
+            #expect(domain.recordValue.hasPrefix("strato-domain-verification="))
+            #expect(domain.defaultRole == "member")
+        }
+    }
+
+    @Test("Verification fails without the record and succeeds once it is published")
+    func verifyAgainstTheRecord() async throws {
+        try await withOrgAdmin { app, org, token in
+            let domain = try await register(CreateBody(domain: "example.com"), org: org, token: token, app: app)
+
+            let failed = try await verify(domain, token: token, app: app)
+            #expect(failed.status == "failed")
+            #expect(failed.statusMessage?.contains("No TXT record") == true)
+
+            app.domainTXTResolver = StubResolver(records: [
+                domain.recordName: ["v=spf1 -all", domain.recordValue]
+            ])
+            let verified = try await verify(domain, token: token, app: app)
+            #expect(verified.status == "verified")
+            #expect(verified.statusMessage == nil)
+            #expect(verified.verifiedAt != nil)
+        }
+    }
+
+    @Test("A domain another organization verified cannot be registered")
+    func verifiedElsewhereConflicts() async throws {
+        try await withOrgAdmin { app, org, token in
+            let other = try await TestDataBuilder(db: app.db).createOrganization(name: "Other Org")
+            let taken = OrganizationDomain(organizationID: other.id!, domain: "example.com")
+            taken.status = OrganizationDomainStatus.verified.rawValue
+            try await taken.save(on: app.db)
+
+            try await app.test(.POST, "/api/organizations/\(org.id!)/domains") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                try req.content.encode(CreateBody(domain: "example.com"))
+            } afterResponse: { res in
+                #expect(res.status == .conflict)
+            }
+        }
+    }
+
+    @Test("Malformed domains and unbindable default roles are rejected")
+    func invalidInput() async throws {
+        try await withOrgAdmin { app, org, token in
+            for body in [
+                CreateBody(domain: "localhost"), CreateBody(domain: "10.0.0.1"),
+                CreateBody(domain: "-bad-.com"), CreateBody(domain: "example.com", defaultRole: "no-such-role"),
+            ] {
+                try await app.test(.POST, "/api/organizations/\(org.id!)/domains") { req in
+                    req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                    try req.content.encode(body)
+                } afterResponse: { res in
+                    #expect(res.status == .badRequest)
+                }
+            }
+        }
+    }
+
+    @Test("TXT strings split by the resolver are rejoined")
+    func joinedStrings() {
+        #expect(
+            DNSOverHTTPSResolver.joinedStrings("\"strato-domain-\" \"verification=ab\"")
+                == "strato-domain-verification=ab")
+        #expect(DNSOverHTTPSResolver.joinedStrings("\"a \\\"quoted\\\" value\"") == "a \"quoted\" value")
+        #expect(DNSOverHTTPSResolver.joinedStrings("unquoted") == "unquoted")
+    }
+
+    // MARK: - Sign-in
+
+    private func withProvider(
+        autoJoin: Bool = false, defaultRole: String = "member", claimAccounts: Bool = false,
+        _ test: (Application, Organization, OIDCProvider, OrganizationDomain, OIDCIdentityService) async throws -> Void
+    ) async throws {
+        try await withTestApp { app in
+            let org = try await TestDataBuilder(db: app.db).createOrganization(name: "IdP Org")
+            let provider = OIDCProvider(
+                organizationID: org.id!, name: "Test IdP", clientID: "client", clientSecret: "secret",
+                groupsClaim: nil, groupMappings: [], adminClaimValues: [], roleMappings: [], defaultRole: "member")
+            try await provider.save(on: app.db)
+            let domain = OrganizationDomain(
+                organizationID: org.id!, domain: "example.com", autoJoin: autoJoin, defaultRole: defaultRole,
+                claimAccounts: claimAccounts)
+            domain.status = OrganizationDomainStatus.verified.rawValue
+            try await domain.save(on: app.db)
+            try await test(app, org, provider, domain, OIDCIdentityService(db: app.db, logger: app.logger))
+        }
+    }
+
+    private func userInfo(email: String, emailVerified: Bool = true) -> OIDCUserInfo {
+        OIDCUserInfo(
+            subject: "sub-\(email)", email: email, emailVerified: emailVerified, name: "Domain User",
+            preferredUsername: email)
+    }
+
+    private func membershipRole(_ userID: UUID, _ org: Organization, on db: Database) async throws -> String? {
+        try await UserOrganization.query(on: db)
+            .filter(\.$user.$id == userID)
+            .filter(\.$organization.$id == org.id!)
+            .first()?.role
+    }
+
+    @Test("Users provisioned at an auto-join domain get the domain's role")
+    func autoJoinRole() async throws {
+        try await withProvider(autoJoin: true, defaultRole: "admin") { app, org, provider, _, service in
+            let user = try await service.resolveUser(
+                userInfo: userInfo(email: "new@example.com"), provider: provider, organization: org, groupValues: [])
+            #expect(try await membershipRole(user.id!, org, on: app.db) == "admin")
+
+            // An unverified email doesn't count as the domain's.
+            let unverified = try await service.resolveUser(
+                userInfo: userInfo(email: "other@example.com", emailVerified: false), provider: provider,
+                organization: org, groupValues: [])
+            #expect(try await membershipRole(unverified.id!, org, on: app.db) == "member")
+        }
+    }
+
+    @Test("A linked user removed from the organization rejoins while auto-join is on")
+    func autoJoinRejoins() async throws {
+        try await withProvider(autoJoin: true) { app, org, provider, _, service in
+            let info = userInfo(email: "back@example.com")
+            let user = try await service.resolveUser(
+                userInfo: info, provider: provider, organization: org, groupValues: [])
+            try await UserOrganization.query(on: app.db).filter(\.$user.$id == user.id!).delete()
+
+            let joined = try await service.autoJoin(
+                user: user, userInfo: info, provider: provider, organizationID: org.id!, groupValues: [])
+            #expect(joined)
+            #expect(try await membershipRole(user.id!, org, on: app.db) == "member")
+
+            let again = try await service.autoJoin(
+                user: user, userInfo: info, provider: provider, organizationID: org.id!, groupValues: [])
+            #expect(!again)
+        }
+    }
+
+    @Test("An existing account at a claiming domain needs its holder's consent")
+    func claimRequiresConsent() async throws {
+        try await withProvider(claimAccounts: true) { app, org, provider, domain, service in
+            let existing = try await TestDataBuilder(db: app.db).createUser(
+                username: "personal", email: "personal@example.com")
+
+            do {
+                _ = try await service.resolveUser(
+                    userInfo: userInfo(email: "personal@example.com"), provider: provider,
+                    organization: org, groupValues: [])
+                Issue.record("Expected the sign-in to ask for consent")
+            } catch let claim as DomainAccountClaimRequired {
+                #expect(claim.userID == existing.id)
+                #expect(claim.domainID == domain.id)
+            }
+            #expect(try await membershipRole(existing.id!, org, on: app.db) == nil)
+
+            let claimed = try await service.claimAccount(
+                userID: existing.id!, domainID: domain.id!, provider: provider,
+                subject: "sub-personal@example.com", groupValues: [], confirmedUserID: existing.id!)
+            #expect(claimed.id == existing.id)
+            #expect(claimed.$oidcProvider.id == provider.id)
+            #expect(claimed.currentOrganizationId == org.id)
+            #expect(try await membershipRole(existing.id!, org, on: app.db) == "member")
+        }
+    }
+
+    @Test("Without account claiming an existing account's email still refuses the login")
+    func noClaimStillRefuses() async throws {
+        try await withProvider { app, org, provider, _, service in
+            _ = try await TestDataBuilder(db: app.db).createUser(username: "personal", email: "personal@example.com")
+            await #expect(throws: Abort.self) {
+                _ = try await service.resolveUser(
+                    userInfo: self.userInfo(email: "personal@example.com"), provider: provider,
+                    organization: org, groupValues: [])
+            }
+        }
+    }
+
+    @Test("A claim fails once the domain stops claiming accounts")
+    func claimRechecksTheDomain() async throws {
+        try await withProvider(claimAccounts: true) { app, _, provider, domain, service in
+            let existing = try await TestDataBuilder(db: app.db).createUser(
+                username: "personal", email: "personal@example.com")
+            domain.claimAccounts = false
+            try await domain.save(on: app.db)
+
+            await #expect(throws: Abort.self) {
+                _ = try await service.claimAccount(
+                    userID: existing.id!, domainID: domain.id!, provider: provider, subject: "sub", groupValues: [],
+                    confirmedUserID: existing.id!)
+            }
+        }
+    }
+
+    @Test("A claim needs the claimed account's own confirmation")
+    func claimNeedsTheHolder() async throws {
+        try await withProvider(claimAccounts: true) { app, org, provider, domain, service in
+            let builder = TestDataBuilder(db: app.db)
+            let existing = try await builder.createUser(username: "personal", email: "personal@example.com")
+            let someoneElse = try await builder.createUser(username: "intruder", email: "intruder@example.net")
+
+            var thrown: (any Error)?
+            do {
+                _ = try await service.claimAccount(
+                    userID: existing.id!, domainID: domain.id!, provider: provider,
+                    subject: "sub-personal@example.com", groupValues: [], confirmedUserID: someoneElse.id!)
+            } catch { thrown = error }
+            #expect((thrown as? any AbortError)?.status == .forbidden)
+            let untouched = try #require(try await User.find(existing.id, on: app.db))
+            #expect(untouched.$oidcProvider.id == nil)
+            #expect(try await membershipRole(existing.id!, org, on: app.db) == nil)
+        }
+    }
+
+    @Test("An account another identity provider signs in is never claimed")
+    func claimKeepsAnotherProvidersLink() async throws {
+        try await withProvider(claimAccounts: true) { app, org, provider, domain, service in
+            let other = try await TestDataBuilder(db: app.db).createOrganization(name: "Elsewhere Org")
+            let otherProvider = OIDCProvider(
+                organizationID: other.id!, name: "Other IdP", clientID: "client", clientSecret: "secret",
+                groupsClaim: nil, groupMappings: [], adminClaimValues: [], roleMappings: [], defaultRole: "member")
+            try await otherProvider.save(on: app.db)
+            let existing = try await TestDataBuilder(db: app.db).createUser(
+                username: "personal", email: "personal@example.com")
+            existing.$oidcProvider.id = otherProvider.id
+            existing.oidcSubject = "elsewhere"
+            try await existing.save(on: app.db)
+
+            // The sign-in is refused outright rather than offered as a claim.
+            var thrown: (any Error)?
+            do {
+                _ = try await service.resolveUser(
+                    userInfo: userInfo(email: "personal@example.com"), provider: provider,
+                    organization: org, groupValues: [])
+            } catch { thrown = error }
+            #expect(thrown is any AbortError)
+
+            thrown = nil
+            do {
+                _ = try await service.claimAccount(
+                    userID: existing.id!, domainID: domain.id!, provider: provider,
+                    subject: "sub-personal@example.com", groupValues: [], confirmedUserID: existing.id!)
+            } catch { thrown = error }
+            #expect((thrown as? any AbortError)?.status == .conflict)
+            let untouched = try #require(try await User.find(existing.id, on: app.db))
+            #expect(untouched.$oidcProvider.id == otherProvider.id)
+        }
+    }
+
+    @Test("Only one organization's registration of a domain can be verified")
+    func verifiedDomainIsUnique() async throws {
+        try await withTestApp { app in
+            let builder = TestDataBuilder(db: app.db)
+            let first = try await builder.createOrganization(name: "First Org")
+            let second = try await builder.createOrganization(name: "Second Org")
+            let verified = OrganizationDomain(organizationID: first.id!, domain: "example.com")
+            verified.status = OrganizationDomainStatus.verified.rawValue
+            try await verified.save(on: app.db)
+
+            // Pending registrations of the same domain are fine...
+            let pending = OrganizationDomain(organizationID: second.id!, domain: "example.com")
+            try await pending.save(on: app.db)
+
+            // ...but the index refuses a second verified one, as when two
+            // organizations pass `assertClaimable` at once.
+            pending.status = OrganizationDomainStatus.verified.rawValue
+            await #expect(throws: (any Error).self) {
+                try await pending.save(on: app.db)
+            }
+        }
+    }
+}
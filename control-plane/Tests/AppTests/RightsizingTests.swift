@@ -0,0 +1,201 @@
+import Fluent
+import Foundation
+import StratoShared
+import Testing
+import Vapor
+import VaporTesting
+
+@testable import App
+
+/// Rightsizing: the recorder folding observed usage into hourly rows on its
+/// own cadence, the analyzer's verdicts, and the endpoints — including apply,
+/// which resizes through the ordinary update path.
+@Suite("Rightsizing Tests", .serialized)
+struct RightsizingTests {
+
+    private static let gib: Int64 = 1024 * 1024 * 1024
+
+    private static func vm(cpu: Int, memory: Int64) -> VM {
+        let vm = VM(
+            name: "sized", description: "", image: "img", projectID: UUID(), environment: "development",
+            cpu: cpu, memory: memory, disk: 10 * gib)
+        vm.id = UUID()
+        return vm
+    }
+
+    /// `count` consecutive hours ending at `end`, each averaging `cpu` with
+    /// `memoryUsed` in use.
+    private static func hours(
+        _ count: Int, vmID: UUID, cpu: Double, memoryUsed: Int64, end: Date = Date()
+    ) -> [VMUsageSample] {
+        (0..<count).map { index in
+            let sample = VMUsageSample(
+                vmID: vmID, hour: VMUsageRecorder.hourStart(of: end.addingTimeInterval(-Double(index) * 3600)))
+            sample.cpuSamples = 12
+            sample.cpuUtilizationSum = cpu * 12
+            sample.cpuUtilizationPeak = cpu
+            sample.memorySamples = 12
+            sample.memoryUsedSum = memoryUsed * 12
+            sample.memoryUsedPeak = memoryUsed
+            return sample
+        }
+    }
+
+    // MARK: - Analysis
+
+    @Test("An idle, oversized VM is proposed a smaller CPU count and memory")
+    func overProvisioned() throws {
+        let vm = Self.vm(cpu: 4, memory: 8 * Self.gib)
+        let samples = Self.hours(200, vmID: vm.id!, cpu: 0.1, memoryUsed: Self.gib)
+
+        let recommendation = try RightsizingService.analyze(vm: vm, samples: samples)
+        #expect(recommendation.verdict == .overProvisioned)
+        #expect(recommendation.proposedCpu == 1)
+        // 1 GiB peak plus a quarter of headroom, on a 256 MiB boundary.
+        #expect(recommendation.proposedMemory == 1280 * 1024 * 1024)
+        #expect(recommendation.reclaimableCpu == 3)
+        #expect(recommendation.reasons.count == 2)
+    }
+
+    @Test("A VM running hot and near its memory is proposed more of both")
+    func underProvisioned() throws {
+        let vm = Self.vm(cpu: 2, memory: 2 * Self.gib)
+        let samples = Self.hours(200, vmID: vm.id!, cpu: 0.95, memoryUsed: Self.gib * 19 / 10)
+
+        let recommendation = try RightsizingService.analyze(vm: vm, samples: samples)
+        #expect(recommendation.verdict == .underProvisioned)
+        #expect(recommendation.proposedCpu == 4)
+        #expect(recommendation.proposedMemory == 5 * Self.gib / 2)
+        #expect(recommendation.reclaimableMemory < 0)
+    }
+
+    @Test("Usage near the size leaves it alone, and too little history is no verdict")
+    func rightSizedAndInsufficient() throws {
+        let vm = Self.vm(cpu: 2, memory: 4 * Self.gib)
+        let steady = try RightsizingService.analyze(
+            vm: vm, samples: Self.hours(200, vmID: vm.id!, cpu: 0.5, memoryUsed: 3 * Self.gib))
+        #expect(steady.verdict == .rightSized)
+        #expect(!steady.isActionable)
+
+        let young = try RightsizingService.analyze(
+            vm: vm, samples: Self.hours(24, vmID: vm.id!, cpu: 0.05, memoryUsed: Self.gib / 4))
+        #expect(young.verdict == .insufficientData)
+        #expect(young.proposedCpu == 2)
+        #expect(young.observedHours == 24)
+    }
+
+    @Test("Percentiles are nearest-rank")
+    func percentile() {
+        let values = (1...100).map(Double.init)
+        #expect(RightsizingService.percentile(values, 0.95) == 95)
+        #expect(RightsizingService.percentile([0.3], 0.95) == 0.3)
+        #expect(RightsizingService.percentile([], 0.95) == nil)
+    }
+
+    // MARK: - Endpoints
+
+    private func withRightsizingApp(
+        _ test: (Application, VM, Project, String) async throws -> Void
+    ) async throws {
+        try await withTestApp { app in
+            let builder = TestDataBuilder(db: app.db)
+            let user = try await builder.createUser(
+                username: "rightsizer", email: "rightsizer@example.com", isSystemAdmin: false)
+            let org = try await builder.createOrganization(name: "Rightsizing Org")
+            try await builder.addUserToOrganization(user: user, organization: org, role: "admin")
+            user.currentOrganizationId = org.id
+            try await user.save(on: app.db)
+            let project = try await builder.createProject(
+                name: "Rightsizing Project", description: "Project for rightsizing tests", organization: org)
+            _ = try await builder.createResourceQuota(
+                name: "Rightsizing Quota", maxVCPUs: 32, maxMemoryGB: 64, organization: org)
+
+            let vm = try await builder.createVM(name: "oversized-vm", project: project)
+            vm.cpu = 4
+            vm.memory = 8 * Self.gib
+            vm.maxCpu = 4
+            vm.maxMemory = 8 * Self.gib
+            try await vm.save(on: app.db)
+
+            try await test(app, vm, project, try await user.generateAPIKey(on: app.db))
+        }
+    }
+
+    @Test("GET on a VM without history reports insufficient data, and apply is a 409")
+    func endpointWithoutHistory() async throws {
+        try await withRightsizingApp { app, vm, _, token in
+            try await app.test(.GET, "/api/vms/\(vm.id!)/rightsizing") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+            } afterResponse: { res in
+                #expect(res.status == .ok)
+                let body = try res.content.decode(RightsizingRecommendation.self)
+                #expect(body.verdict == .insufficientData)
+            }
+
+            try await app.test(.POST, "/api/vms/\(vm.id!)/rightsizing/apply") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+            } afterResponse: { res in
+                #expect(res.status == .conflict)
+            }
+        }
+    }
+
+    @Test("Apply resizes a stopped VM to the recommendation and the project report sums the savings")
+    func applyAndProjectReport() async throws {
+        try await withRightsizingApp { app, vm, project, token in
+            for sample in Self.hours(200, vmID: vm.id!, cpu: 0.1, memoryUsed: Self.gib) {
+                try await sample.save(on: app.db)
+            }
+
+            try await app.test(.GET, "/api/projects/\(project.id!)/rightsizing") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+            } afterResponse: { res in
+                #expect(res.status == .ok)
+                let report = try res.content.decode(ProjectRightsizingReport.self)
+                #expect(report.recommendations.map(\.vmId) == [vm.id!])
+                #expect(report.reclaimableCpu == 3)
+                #expect(report.reclaimableMemory == 8 * Self.gib - 1280 * 1024 * 1024)
+                #expect(report.additionalCpu == 0)
+            }
+
+            try await app.test(.POST, "/api/vms/\(vm.id!)/rightsizing/apply") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+            } afterResponse: { res in
+                #expect(res.status == .ok)
+            }
+
+            let refreshed = try #require(try await VM.find(vm.id, on: app.db))
+            #expect(refreshed.cpu == 1)
+            #expect(refreshed.memory == 1280 * 1024 * 1024)
+            #expect(refreshed.generation > vm.generation)
+        }
+    }
+
+    // MARK: - Recording
+
+    @Test("The recorder samples running VMs at most every five minutes, one row per hour")
+    func recorderThrottlesAndRollsUp() async throws {
+        try await withRightsizingApp { app, vm, _, _ in
+            let observed = ObservedVMState(
+                vmId: vm.id!, status: .running, observedGeneration: 1,
+                memoryStats: VMMemoryStats(totalBytes: 4 * Self.gib, availableBytes: 3 * Self.gib),
+                cpuUtilization: 0.4)
+            let start = VMUsageRecorder.hourStart(of: Date()).addingTimeInterval(60)
+
+            try await VMUsageRecorder.record(vm: vm, observed: observed, at: start, on: app.db)
+            try await VMUsageRecorder.record(vm: vm, observed: observed, at: start.addingTimeInterval(60), on: app.db)
+            try await VMUsageRecorder.record(vm: vm, observed: observed, at: start.addingTimeInterval(400), on: app.db)
+            try await VMUsageRecorder.record(vm: vm, observed: observed, at: start.addingTimeInterval(3700), on: app.db)
+
+            let stopped = ObservedVMState(vmId: vm.id!, status: .shutdown, observedGeneration: 1, cpuUtilization: 0)
+            try await VMUsageRecorder.record(vm: vm, observed: stopped, at: start.addingTimeInterval(9000), on: app.db)
+
+            let rows = try await VMUsageSample.query(on: app.db).sort(\.$hour).all()
+            #expect(rows.count == 2)
+            #expect(rows.first?.cpuSamples == 2)
+            #expect(rows.first?.memoryUsedPeak == Self.gib)
+            #expect(rows.first?.cpuUtilizationMean == 0.4)
+            #expect(rows.last?.cpuSamples == 1)
+        }
+    }
+}
@@ -0,0 +1,152 @@
+import Crypto
+import Fluent
+import Foundation
+import NIOSSH
+import Testing
+import Vapor
+import VaporTesting
+
+@testable import App
+
+/// Self-service SSH keys (`/api/users/me/ssh-keys`) and how the console
+/// gateway maps a presented key back to its owner.
+@Suite("SSH Key Tests", .serialized)
+final class SSHKeyTests: BaseTestCase {
+
+    // MARK: - Helpers
+
+    private func makeKey() -> NIOSSHPublicKey {
+        NIOSSHPrivateKey(ed25519Key: Curve25519.Signing.PrivateKey()).publicKey
+    }
+
+    @discardableResult
+    private func addKey(
+        _ key: NIOSSHPublicKey,
+        name: String = "laptop",
+        token: String,
+        on app: Application
+    ) async throws -> HTTPStatus {
+        var status: HTTPStatus = .internalServerError
+        try await app.test(.POST, "/api/users/me/ssh-keys") { req in
+            req.headers.bearerAuthorization = BearerAuthorization(token: token)
+            try req.content.encode(
+                CreateSSHKeyRequest(name: name, publicKey: String(openSSHPublicKey: key) + " me@laptop"))
+        } afterResponse: { res in
+            status = res.status
+        }
+        return status
+    }
+
+    // MARK: - Management
+
+    @Test("add, list and delete a key")
+    func testLifecycle() async throws {
+        try await withApp { app in
+            try await setupCommonTestData(on: app.db)
+            let key = makeKey()
+
+            var created: SSHKeyResponse?
+            try await app.test(.POST, "/api/users/me/ssh-keys") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: authToken)
+                try req.content.encode(
+                    CreateSSHKeyRequest(name: "laptop", publicKey: String(openSSHPublicKey: key) + " me@laptop"))
+            } afterResponse: { res in
+                #expect(res.status == .created)
+                created = try res.content.decode(SSHKeyResponse.self)
+            }
+            let added = try #require(created)
+            // The comment is dropped and the fingerprint is ssh-keygen's.
+            #expect(added.publicKey == String(openSSHPublicKey: key))
+            #expect(added.fingerprint == UserSSHKey.fingerprint(of: key))
+            #expect(added.fingerprint.hasPrefix("SHA256:"))
+
+            try await app.test(.GET, "/api/users/me/ssh-keys") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: authToken)
+            } afterResponse: { res in
+                #expect(res.status == .ok)
+                let keys = try res.content.decode([SSHKeyResponse].self)
+                #expect(keys.map(\.id) == [added.id])
+            }
+
+            let keyID = try #require(added.id)
+            try await app.test(.DELETE, "/api/users/me/ssh-keys/\(keyID)") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: authToken)
+            } afterResponse: { res in
+                #expect(res.status == .noContent)
+            }
+            let remaining = try await UserSSHKey.query(on: app.db).count()
+            #expect(remaining == 0)
+        }
+    }
+
+    @Test("malformed keys are rejected")
+    func testMalformedKey() async throws {
+        try await withApp { app in
+            try await setupCommonTestData(on: app.db)
+
+            try await app.test(.POST, "/api/users/me/ssh-keys") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: authToken)
+                try req.content.encode(CreateSSHKeyRequest(name: "bad", publicKey: "ssh-rsa not-a-key"))
+            } afterResponse: { res in
+                #expect(res.status == .badRequest)
+            }
+        }
+    }
+
+    @Test("a key belongs to one account")
+    func testDuplicateAcrossUsers() async throws {
+        try await withApp { app in
+            try await setupCommonTestData(on: app.db)
+            let builder = TestDataBuilder(db: app.db)
+            let other = try await builder.createUser(username: "other", email: "other@example.com")
+            let otherToken = try await other.generateAPIKey(on: app.db)
+            let key = makeKey()
+
+            #expect(try await addKey(key, token: authToken, on: app) == .created)
+            #expect(try await addKey(key, token: otherToken, on: app) == .conflict)
+        }
+    }
+
+    @Test("another user's key cannot be deleted")
+    func testDeleteScopedToCaller() async throws {
+        try await withApp { app in
+            try await setupCommonTestData(on: app.db)
+            let builder = TestDataBuilder(db: app.db)
+            let other = try await builder.createUser(username: "other", email: "other@example.com")
+            let theirs = UserSSHKey(
+                userID: try other.requireID(), name: "theirs",
+                publicKey: String(openSSHPublicKey: makeKey()), fingerprint: "SHA256:theirs")
+            try await theirs.save(on: app.db)
+
+            try await app.test(.DELETE, "/api/users/me/ssh-keys/\(try theirs.requireID())") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: authToken)
+            } afterResponse: { res in
+                #expect(res.status == .notFound)
+            }
+        }
+    }
+
+    // MARK: - Gateway authentication
+
+    @Test("a registered key authenticates as its owner until the account is disabled")
+    func testGatewayAuthentication() async throws {
+        try await withApp { app in
+            try await setupCommonTestData(on: app.db)
+            let key = makeKey()
+            #expect(try await addKey(key, token: authToken, on: app) == .created)
+            let gateway = app.sshConsoleGateway
+
+            let identity = try await gateway.authenticate(publicKey: key, trustedCAs: [], remoteAddress: nil)
+            #expect(identity?.userID == testUser.id)
+            #expect(identity?.method == "key")
+
+            let unknown = try await gateway.authenticate(publicKey: makeKey(), trustedCAs: [], remoteAddress: nil)
+            #expect(unknown == nil)
+
+            testUser.disabledAt = Date()
+            try await testUser.save(on: app.db)
+            let disabled = try await gateway.authenticate(publicKey: key, trustedCAs: [], remoteAddress: nil)
+            #expect(disabled == nil)
+        }
+    }
+}
@@ -263,7 +263,7 @@ final class SandboxExecTests {
                     sessionId: session.sessionId,
                     sandboxId: session.sandboxId,
                     userId: session.userId,
-                    websocket: nil,
+                    frontend: nil,
                     now: later
                 )
                 Issue.record("Expected sessionExpired to be thrown")
@@ -288,7 +288,7 @@ final class SandboxExecTests {
                     sessionId: session.sessionId,
                     sandboxId: UUID().uuidString,
                     userId: session.userId,
-                    websocket: nil
+                    frontend: nil
                 )
                 Issue.record("Expected sessionMismatch for a foreign sandbox")
             } catch let error as SandboxExecSessionError {
@@ -300,7 +300,7 @@ final class SandboxExecTests {
                     sessionId: session.sessionId,
                     sandboxId: session.sandboxId,
                     userId: UUID().uuidString,
-                    websocket: nil
+                    frontend: nil
                 )
                 Issue.record("Expected sessionMismatch for a foreign user")
             } catch let error as SandboxExecSessionError {
@@ -324,7 +324,7 @@ final class SandboxExecTests {
                     sessionId: bogus,
                     sandboxId: UUID().uuidString,
                     userId: UUID().uuidString,
-                    websocket: nil
+                    frontend: nil
                 )
                 Issue.record("Expected sessionNotFound")
             } catch let error as SandboxExecSessionError {
@@ -343,7 +343,7 @@ final class SandboxExecTests {
                 sessionId: session.sessionId,
                 sandboxId: session.sandboxId,
                 userId: session.userId,
-                websocket: nil
+                frontend: nil
             )
             #expect(attached.command == session.command)
             let pendingAfterAttach = manager.hasPendingSession(sessionId: session.sessionId)
@@ -357,7 +357,7 @@ final class SandboxExecTests {
                     sessionId: session.sessionId,
                     sandboxId: session.sandboxId,
                     userId: session.userId,
-                    websocket: nil
+                    frontend: nil
                 )
                 Issue.record("Expected alreadyAttached")
             } catch let error as SandboxExecSessionError {
@@ -384,7 +384,7 @@ final class SandboxExecTests {
                 sessionId: session.sessionId,
                 sandboxId: session.sandboxId,
                 userId: session.userId,
-                websocket: nil
+                frontend: nil
             )
 
             // A spoofed exit from a different agent must not remove the session.
@@ -409,7 +409,7 @@ final class SandboxExecTests {
                 sessionId: attached.sessionId,
                 sandboxId: attached.sandboxId,
                 userId: attached.userId,
-                websocket: nil
+                frontend: nil
             )
             let pending = self.mintPendingSession(manager)
 
@@ -432,7 +432,7 @@ final class SandboxExecTests {
                 sessionId: other.sessionId,
                 sandboxId: otherSandboxId,
                 userId: otherUserId,
-                websocket: nil
+                frontend: nil
             )
 
             manager.closeAllSessions(forAgent: agentKey("exec-agent"), reason: "agent disconnected")
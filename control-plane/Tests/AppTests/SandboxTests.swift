@@ -975,7 +975,7 @@ final class SandboxTests {
             ).save(on: app.db)
 
             let allocation = try await IPAMService.allocateIP(for: network, on: app.db)
-            #expect(allocation.ipAddress == "192.168.1.4")
+            #expect(allocation?.ipAddress == "192.168.1.4")
         }
     }
 
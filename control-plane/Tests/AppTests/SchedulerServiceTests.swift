@@ -41,9 +41,16 @@ struct SchedulerServiceTests {
         supportedHypervisors: [HypervisorType] = [.qemu],
         architecture: CPUArchitecture? = nil,
         supportsInterVMNetworking: Bool = false,
+        wireProtocolVersion: Int? = nil,
         supportsSandboxWorkloads: Bool = false,
         supportsVTPM: Bool = false,
-        supportsMachineProfile: Bool = false
+        supportsMachineProfile: Bool = false,
+        supportsSecureBootKeys: Bool = false,
+        supportsImageBuilds: Bool = false,
+        supportsCPUModels: Bool = false,
+        cpuModels: Set<String> = [],
+        siteDefaultCPUModel: GuestCPUModel? = nil,
+        hasPendingMaintenance: Bool = false
     ) -> SchedulableAgent {
         return SchedulableAgent(
             id: id,
@@ -59,9 +66,16 @@ struct SchedulerServiceTests {
             supportedHypervisors: supportedHypervisors,
             architecture: architecture,
             supportsInterVMNetworking: supportsInterVMNetworking,
+            wireProtocolVersion: wireProtocolVersion,
             supportsSandboxWorkloads: supportsSandboxWorkloads,
             supportsVTPM: supportsVTPM,
-            supportsMachineProfile: supportsMachineProfile
+            supportsMachineProfile: supportsMachineProfile,
+            supportsSecureBootKeys: supportsSecureBootKeys,
+            supportsImageBuilds: supportsImageBuilds,
+            supportsCPUModels: supportsCPUModels,
+            cpuModels: cpuModels,
+            siteDefaultCPUModel: siteDefaultCPUModel,
+            hasPendingMaintenance: hasPendingMaintenance
         )
     }
 
@@ -568,6 +582,34 @@ struct SchedulerServiceTests {
         }
     }
 
+    @Test("A VM on an IPv6-only network only places on agents that can realize one")
+    func testIPv6OnlyNetworkConstraint() throws {
+        let scheduler = SchedulerService(logger: Logger(label: "test"))
+        let requirements = VMPlacementRequirements(
+            cpu: 1, memory: 1000, disk: 10000, requiresInterVMNetworking: true, requiresIPv6OnlyNetworks: true)
+
+        let agents = [
+            createTestAgent(
+                id: "old", name: "old", availableCPU: 8, supportsInterVMNetworking: true,
+                wireProtocolVersion: WireProtocol.ipv6OnlyNetworksMinimumVersion - 1),
+            createTestAgent(
+                id: "new", name: "new", availableCPU: 2, supportsInterVMNetworking: true,
+                wireProtocolVersion: WireProtocol.ipv6OnlyNetworksMinimumVersion),
+        ]
+        #expect(try scheduler.selectAgent(requirements: requirements, from: agents) == "new")
+
+        do {
+            _ = try scheduler.selectAgent(requirements: requirements, from: [agents[0]])
+            Issue.record("Expected ipv6OnlyNetworksUnsatisfied error")
+        } catch let error as SchedulerError {
+            guard case .ipv6OnlyNetworksUnsatisfied(let eligibleAgents) = error else {
+                Issue.record("Expected ipv6OnlyNetworksUnsatisfied, got \(error)")
+                return
+            }
+            #expect(eligibleAgents == 1)
+        }
+    }
+
     @Test("Sandbox placement only lands on agents advertising the sandbox runtime")
     func testSandboxRuntimeConstraintSelectsCapableAgent() throws {
         let logger = Logger(label: "test")
@@ -845,6 +887,204 @@ struct SchedulerServiceTests {
         let windowsRequirements = SchedulerService.placementRequirements(for: windows)
         #expect(windowsRequirements.requiresVTPM)
         #expect(windowsRequirements.requiresSecureBoot)
+        #expect(!windowsRequirements.requiresSecureBootKeys)
+    }
+
+    // MARK: - Custom Secure Boot keys (wire v29)
+
+    /// An agent without the enrollment tool would boot the guest trusting the
+    /// firmware template's keys — the ones its owner meant to replace.
+    @Test("Custom Secure Boot keys only place on an agent that can enroll them")
+    func testSecureBootKeysPlacement() throws {
+        let scheduler = SchedulerService(logger: Logger(label: "test"))
+        let requirements = VMPlacementRequirements(
+            cpu: 2, memory: 1000, disk: 0, hypervisorType: .qemu,
+            requiresSecureBoot: true, requiresSecureBootKeys: true)
+
+        let agents = [
+            createTestAgent(id: "template-only", name: "template-only", availableCPU: 8, supportsMachineProfile: true),
+            createTestAgent(
+                id: "enrolls", name: "enrolls", availableCPU: 2, supportsMachineProfile: true,
+                supportsSecureBootKeys: true),
+        ]
+        #expect(try scheduler.selectAgent(requirements: requirements, from: agents) == "enrolls")
+
+        do {
+            _ = try scheduler.selectAgent(requirements: requirements, from: [agents[0]])
+            Issue.record("Expected secureBootKeysUnsatisfied error")
+        } catch let error as SchedulerError {
+            guard case .secureBootKeysUnsatisfied(let eligibleAgents) = error else {
+                Issue.record("Expected secureBootKeysUnsatisfied, got \(error)")
+                return
+            }
+            #expect(eligibleAgents == 1)
+            #expect(error.description.contains("virt-fw-vars"))
+        }
+
+        let vm = createTestVM(cpu: 2)
+        vm.secureBoot = true
+        vm.secureBootKeys = SecureBootKeys(ownerGUID: UUID().uuidString, platformKey: "pk")
+        #expect(SchedulerService.placementRequirements(for: vm).requiresSecureBootKeys)
+    }
+
+    // MARK: - Image builds (wire v33)
+
+    /// A build's VM is driven through guest commands and captured with a
+    /// disk export, neither of which an older agent can decode.
+    @Test("An image build's VM only places on an agent that can host builds")
+    func testImageBuildPlacement() throws {
+        let scheduler = SchedulerService(logger: Logger(label: "test"))
+        let vm = createTestVM(cpu: 2)
+        #expect(!SchedulerService.placementRequirements(for: vm).requiresImageBuildSupport)
+        vm.$imageBuild.id = UUID()
+        let requirements = SchedulerService.placementRequirements(for: vm)
+        #expect(requirements.requiresImageBuildSupport)
+
+        let agents = [
+            createTestAgent(id: "old", name: "old", availableCPU: 8),
+            createTestAgent(id: "builds", name: "builds", availableCPU: 2, supportsImageBuilds: true),
+        ]
+        #expect(try scheduler.selectAgent(requirements: requirements, from: agents) == "builds")
+
+        do {
+            _ = try scheduler.selectAgent(requirements: requirements, from: [agents[0]])
+            Issue.record("Expected imageBuildUnsatisfied error")
+        } catch let error as SchedulerError {
+            guard case .imageBuildUnsatisfied(let eligibleAgents) = error else {
+                Issue.record("Expected imageBuildUnsatisfied, got \(error)")
+                return
+            }
+            #expect(eligibleAgents == 1)
+        }
+    }
+
+    // MARK: - Maintenance windows
+
+    /// A VM whose project keeps maintenance windows never lands on an agent
+    /// that is mid-update, even when that agent is the only one that fits.
+    @Test("Maintenance-window projects require agents without pending disruptive work")
+    func testMaintenanceWindowRequirement() throws {
+        let scheduler = SchedulerService(logger: Logger(label: "test"))
+        let agents = [
+            createTestAgent(id: "updating", name: "updating", availableCPU: 8, hasPendingMaintenance: true),
+            createTestAgent(id: "steady", name: "steady", availableCPU: 2),
+        ]
+
+        let sensitive = VMPlacementRequirements(cpu: 2, memory: 1000, disk: 0, requiresUndisturbedAgent: true)
+        #expect(try scheduler.selectAgent(requirements: sensitive, from: agents, strategy: .leastLoaded) == "steady")
+        do {
+            _ = try scheduler.selectAgent(requirements: sensitive, from: [agents[0]])
+            Issue.record("Expected maintenanceWindowUnsatisfied error")
+        } catch let error as SchedulerError {
+            guard case .maintenanceWindowUnsatisfied(let eligibleAgents) = error else {
+                Issue.record("Expected maintenanceWindowUnsatisfied, got \(error)")
+                return
+            }
+            #expect(eligibleAgents == 1)
+        }
+
+        let indifferent = VMPlacementRequirements(cpu: 2, memory: 1000, disk: 0)
+        #expect(
+            try scheduler.selectAgent(requirements: indifferent, from: agents, strategy: .leastLoaded) == "updating")
+
+        let vm = createTestVM(cpu: 2)
+        #expect(!SchedulerService.placementRequirements(for: vm).requiresUndisturbedAgent)
+        #expect(SchedulerService.placementRequirements(for: vm, maintenanceWindows: true).requiresUndisturbedAgent)
+    }
+
+    // MARK: - Guest CPU models (wire v28)
+
+    @Test("A named CPU model only places on an agent that reported it")
+    func testNamedCPUModelPlacement() throws {
+        let scheduler = SchedulerService(logger: Logger(label: "test"))
+        let requirements = VMPlacementRequirements(
+            cpu: 2, memory: 1000, disk: 0, cpuModel: .named("Icelake-Server"))
+
+        // The roomier agents would win on load: one runs only older
+        // baselines, the other predates v28 and would pass the host through.
+        let agents = [
+            createTestAgent(
+                id: "older", name: "older", availableCPU: 8, supportsCPUModels: true, cpuModels: ["Haswell"]),
+            createTestAgent(id: "pre-v28", name: "pre-v28", availableCPU: 8, cpuModels: ["Icelake-Server"]),
+            createTestAgent(
+                id: "icelake", name: "icelake", availableCPU: 2, supportsCPUModels: true,
+                cpuModels: ["Haswell", "Icelake-Server"]),
+        ]
+        #expect(try scheduler.selectAgent(requirements: requirements, from: agents) == "icelake")
+
+        do {
+            _ = try scheduler.selectAgent(requirements: requirements, from: Array(agents.prefix(2)))
+            Issue.record("Expected cpuModelUnsatisfied error")
+        } catch let error as SchedulerError {
+            guard case .cpuModelUnsatisfied(let model, let eligibleAgents) = error else {
+                Issue.record("Expected cpuModelUnsatisfied, got \(error)")
+                return
+            }
+            #expect(model == "Icelake-Server")
+            #expect(eligibleAgents == 2)
+        }
+    }
+
+    @Test("host-model needs a v28 agent; passthrough places anywhere")
+    func testHostModelAndPassthroughPlacement() throws {
+        let scheduler = SchedulerService(logger: Logger(label: "test"))
+        let agents = [
+            createTestAgent(id: "pre-v28", name: "pre-v28", availableCPU: 8),
+            createTestAgent(id: "v28", name: "v28", availableCPU: 2, supportsCPUModels: true),
+        ]
+
+        let hostModel = VMPlacementRequirements(cpu: 1, memory: 1000, disk: 0, cpuModel: .hostModel)
+        #expect(try scheduler.selectAgent(requirements: hostModel, from: agents) == "v28")
+
+        let passthrough = VMPlacementRequirements(cpu: 1, memory: 1000, disk: 0, cpuModel: .hostPassthrough)
+        #expect(try scheduler.selectAgent(requirements: passthrough, from: agents) == "pre-v28")
+    }
+
+    /// A site default applies only where the VM would land, so a site whose
+    /// default its hosts can't run drops out while other sites stay open.
+    @Test("A QEMU VM without a model is held to each candidate's site default")
+    func testSiteDefaultCPUModel() throws {
+        let scheduler = SchedulerService(logger: Logger(label: "test"))
+        let agents = [
+            createTestAgent(
+                id: "strict-site", name: "strict-site", availableCPU: 8, supportsCPUModels: true,
+                cpuModels: ["Haswell"], siteDefaultCPUModel: .named("Icelake-Server")),
+            createTestAgent(id: "open-site", name: "open-site", availableCPU: 2),
+        ]
+
+        let plain = VMPlacementRequirements(cpu: 1, memory: 1000, disk: 0)
+        #expect(try scheduler.selectAgent(requirements: plain, from: agents) == "open-site")
+
+        // An explicit model overrides the default.
+        let explicit = VMPlacementRequirements(cpu: 1, memory: 1000, disk: 0, cpuModel: .named("Haswell"))
+        #expect(try scheduler.selectAgent(requirements: explicit, from: agents) == "strict-site")
+
+        let vm = createTestVM(cpu: 1)
+        vm.cpuModel = "host"
+        #expect(SchedulerService.placementRequirements(for: vm).cpuModel == .hostPassthrough)
+    }
+
+    @Test("Volume reach confines placement to agents that can open the VM's disks")
+    func testStorageAgentConstraint() throws {
+        let logger = Logger(label: "test")
+        let scheduler = SchedulerService(logger: logger)
+
+        // The roomier agent would win on load alone; the volume's replica
+        // lives on the other one.
+        let agents = [
+            createTestAgent(id: "roomy", name: "roomy", availableCPU: 8),
+            createTestAgent(id: "holder", name: "holder", availableCPU: 4),
+        ]
+        let requirements = VMPlacementRequirements(
+            cpu: 2, memory: 1000, disk: 1000, storageAgentIDs: ["holder"])
+
+        #expect(try scheduler.selectAgent(requirements: requirements, from: agents) == "holder")
+
+        let unreachable = VMPlacementRequirements(
+            cpu: 2, memory: 1000, disk: 1000, storageAgentIDs: ["elsewhere"])
+        #expect(throws: SchedulerError.self) {
+            _ = try scheduler.selectAgent(requirements: unreachable, from: agents)
+        }
     }
 
     @Test("getSchedulingInfo returns nil for unknown agent")
@@ -0,0 +1,166 @@
+import Fluent
+import Foundation
+import StratoShared
+import Testing
+import Vapor
+import VaporTesting
+
+@testable import App
+
+/// Custom Secure Boot keys (wire v29): key set management under the
+/// organization, validation of what is uploaded, and a VM's own db/dbx,
+/// which only change while it is stopped.
+@Suite("Secure Boot Key Set Tests", .serialized)
+struct SecureBootKeySetTests {
+
+    private static let pem = "-----BEGIN CERTIFICATE-----\nAQIDBA==\n-----END CERTIFICATE-----\n"
+    private static let revokedHash = String(repeating: "ab", count: 32)
+
+    private func withKeySetApp(
+        _ test: (Application, Organization, Project, String) async throws -> Void
+    ) async throws {
+        try await withTestApp { app in
+            let builder = TestDataBuilder(db: app.db)
+            let user = try await builder.createUser(
+                username: "keyadmin", email: "keyadmin@example.com", isSystemAdmin: false)
+            let org = try await builder.createOrganization(name: "Secure Boot Org")
+            try await builder.addUserToOrganization(user: user, organization: org, role: "admin")
+            user.currentOrganizationId = org.id
+            try await user.save(on: app.db)
+            let project = try await builder.createProject(
+                name: "Secure Boot Project", description: "Project for Secure Boot tests", organization: org)
+
+            try await test(app, org, project, try await user.generateAPIKey(on: app.db))
+        }
+    }
+
+    @Test("An org admin creates, lists and edits a key set; malformed certificates are a 400")
+    func keySetCRUD() async throws {
+        try await withKeySetApp { app, org, project, token in
+            let path = "/api/organizations/\(org.id!)/secure-boot-key-sets"
+
+            try await app.test(.POST, path) { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                try req.content.encode(["name": "broken", "platformKey": "not a certificate"])
+            } afterResponse: { res in
+                #expect(res.status == .badRequest)
+            }
+
+            var keySetID: UUID?
+            try await app.test(.POST, path) { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                try req.content.encode(
+                    CreateSecureBootKeySetRequest(
+                        name: "corp", description: "Corporate signing keys", projectId: nil, ownerGuid: nil,
+                        platformKey: Self.pem, keyExchangeKeys: [Self.pem], signatureDatabase: [Self.pem],
+                        forbiddenSignatures: [Self.revokedHash], includeMicrosoftKeys: true))
+            } afterResponse: { res in
+                #expect(res.status == .created)
+                let body = try res.content.decode(SecureBootKeySetResponse.self)
+                #expect(UUID(uuidString: body.ownerGuid) != nil)
+                #expect(body.includeMicrosoftKeys)
+                keySetID = body.id
+            }
+
+            // Narrowed to another project: hidden from this project's list.
+            let other = try await TestDataBuilder(db: app.db).createProject(
+                name: "Other Project", description: "", organization: org)
+            try await SecureBootKeySet(
+                organizationID: org.id!, projectID: other.id, name: "other", platformKey: Self.pem
+            ).save(on: app.db)
+
+            try await app.test(.GET, "\(path)?projectId=\(project.id!)") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+            } afterResponse: { res in
+                #expect(res.status == .ok)
+                let sets = try res.content.decode([SecureBootKeySetResponse].self)
+                #expect(sets.map(\.name) == ["corp"])
+            }
+
+            try await app.test(.PUT, "\(path)/\(keySetID!)") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                try req.content.encode(["forbiddenSignatures": ["abcd"]])
+            } afterResponse: { res in
+                #expect(res.status == .badRequest)
+            }
+
+            try await app.test(.PUT, "\(path)/\(keySetID!)") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                try req.content.encode(["name": "other"])
+            } afterResponse: { res in
+                #expect(res.status == .conflict)
+            }
+        }
+    }
+
+    @Test("A VM's db and dbx change only while it is stopped, and the change bumps its generation")
+    func vmKeysUpdate() async throws {
+        try await withKeySetApp { app, org, project, token in
+            let keySet = SecureBootKeySet(organizationID: org.id!, name: "corp", platformKey: Self.pem)
+            try await keySet.save(on: app.db)
+
+            let vm = try await TestDataBuilder(db: app.db).createVM(name: "secure-vm", project: project)
+            vm.secureBoot = true
+            vm.secureBootKeys = keySet.keys
+            vm.$secureBootKeySet.id = keySet.id
+            vm.status = .running
+            try await vm.save(on: app.db)
+            let path = "/api/vms/\(vm.id!)/secure-boot/keys"
+
+            try await app.test(.GET, path) { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+            } afterResponse: { res in
+                #expect(res.status == .ok)
+                let body = try res.content.decode(VMSecureBootKeysResponse.self)
+                #expect(body.keySetId == keySet.id)
+                #expect(body.signatureDatabase.isEmpty)
+            }
+
+            let update = UpdateVMSecureBootKeysRequest(
+                signatureDatabase: [Self.pem], forbiddenSignatures: [Self.revokedHash])
+            try await app.test(.PUT, path) { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                try req.content.encode(update)
+            } afterResponse: { res in
+                #expect(res.status == .conflict)
+            }
+
+            vm.status = .shutdown
+            try await vm.save(on: app.db)
+            try await app.test(.PUT, path) { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                try req.content.encode(update)
+            } afterResponse: { res in
+                #expect(res.status == .ok)
+                let body = try res.content.decode(VMSecureBootKeysResponse.self)
+                #expect(body.forbiddenSignaturesSummary == [.init(kind: "sha256", sha256: Self.revokedHash)])
+                #expect(body.signatureDatabaseSummary.map(\.kind) == ["x509"])
+            }
+
+            let refreshed = try #require(try await VM.find(vm.id, on: app.db))
+            #expect(refreshed.secureBootKeys?.forbiddenSignatures == [Self.revokedHash])
+            #expect(refreshed.secureBootKeys?.platformKey == Self.pem)
+            #expect(refreshed.generation > vm.generation)
+            // The set itself is untouched: the VM edits its own copy.
+            #expect(try await SecureBootKeySet.find(keySet.id, on: app.db)?.forbiddenSignatures == [])
+        }
+    }
+
+    @Test("A VM without custom keys has none to show or edit")
+    func vmWithoutKeys() async throws {
+        try await withKeySetApp { app, _, project, token in
+            let vm = try await TestDataBuilder(db: app.db).createVM(name: "plain-vm", project: project)
+            try await app.test(.GET, "/api/vms/\(vm.id!)/secure-boot/keys") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+            } afterResponse: { res in
+                #expect(res.status == .notFound)
+            }
+            try await app.test(.PUT, "/api/vms/\(vm.id!)/secure-boot/keys") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                try req.content.encode(UpdateVMSecureBootKeysRequest(signatureDatabase: [], forbiddenSignatures: nil))
+            } afterResponse: { res in
+                #expect(res.status == .conflict)
+            }
+        }
+    }
+}
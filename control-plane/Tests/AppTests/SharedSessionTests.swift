@@ -0,0 +1,180 @@
+import Fluent
+import Testing
+import Vapor
+import VaporTesting
+
+@testable import App
+
+/// Sharing live sessions (`SharedSessionController`): only the owner manages
+/// participants, an invitee must be able to open the session themselves, and
+/// invitees find the sessions shared with them. The join WebSockets and the
+/// live fan-out are covered through the session managers, in
+/// `ConsoleSessionManagerTests`.
+@Suite("Shared Session Tests", .serialized)
+final class SharedSessionTests {
+
+    private func withSharingTestApp(
+        _ test: (Application, User, Project, Sandbox, String) async throws -> Void
+    ) async throws {
+        let app = try await Application.makeForTesting()
+
+        do {
+            try await configure(app)
+            try await app.autoMigrate()
+
+            let builder = TestDataBuilder(db: app.db)
+            let user = try await builder.createUser(
+                username: "shareowner",
+                email: "share@example.com",
+                displayName: "Share Owner",
+                isSystemAdmin: false
+            )
+            let org = try await builder.createOrganization(name: "Share Org")
+            try await builder.addUserToOrganization(user: user, organization: org, role: "admin")
+            user.currentOrganizationId = org.id
+            try await user.save(on: app.db)
+
+            let project = try await builder.createProject(
+                name: "Share Project",
+                description: "Project for session sharing tests",
+                organization: org
+            )
+            let sandbox = try await builder.createSandbox(name: "share-sandbox", project: project)
+            let token = try await user.generateAPIKey(on: app.db)
+
+            try await test(app, user, project, sandbox, token)
+        } catch {
+            try await app.shutdownForTesting()
+            throw error
+        }
+
+        try await app.shutdownForTesting()
+    }
+
+    /// An attached exec session on `sandbox` owned by `owner`.
+    private func attachedSession(app: Application, sandbox: Sandbox, owner: User) throws -> String {
+        let manager = app.sandboxExecSessionManager
+        let pending = manager.createPendingSession(
+            sandboxId: sandbox.id!.uuidString, agentKey: agentKey("exec-agent"), userId: owner.id!.uuidString,
+            command: ["/bin/sh"], env: nil, workingDir: nil, tty: true, rows: 24, cols: 80)
+        _ = try manager.attachSession(
+            sessionId: pending.sessionId, sandboxId: pending.sandboxId, userId: pending.userId,
+            username: owner.username, frontend: nil)
+        return pending.sessionId
+    }
+
+    /// A user holding `role` on the project, and their API key.
+    private func member(
+        _ username: String, role: IAMRole, project: Project, app: Application
+    ) async throws -> (User, String) {
+        let user = try await TestDataBuilder(db: app.db).createUser(
+            username: username, email: "\(username)@example.com")
+        try await RoleBindingService.grant(
+            principalType: .user, principalID: user.id!, role: role,
+            nodeType: .project, nodeID: project.id!, createdBy: nil, on: app.db)
+        return (user, try await user.generateAPIKey(on: app.db))
+    }
+
+    private struct InviteBody: Content {
+        let userId: UUID
+        let access: String
+    }
+
+    @Test("The owner invites and revokes; the invitee sees the session shared with them")
+    func inviteListRevoke() async throws {
+        try await withSharingTestApp { app, owner, project, sandbox, token in
+            let sessionId = try attachedSession(app: app, sandbox: sandbox, owner: owner)
+            let (guest, guestToken) = try await member("pairing-guest", role: .operator, project: project, app: app)
+            let participants = "/api/sandboxes/\(sandbox.id!)/exec/\(sessionId)/participants"
+
+            try await app.test(.POST, participants) { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                try req.content.encode(InviteBody(userId: guest.id!, access: "read_only"))
+            } afterResponse: { res in
+                #expect(res.status == .ok)
+                let invited = try res.content.decode(SessionParticipantResponse.self)
+                #expect(invited.username == "pairing-guest")
+                #expect(invited.access == .readOnly)
+                #expect(!invited.connected)
+            }
+
+            try await app.test(.GET, "/api/sandboxes/\(sandbox.id!)/exec/sessions") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: guestToken)
+            } afterResponse: { res in
+                #expect(res.status == .ok)
+                let sessions = try res.content.decode([SharedSessionResponse].self)
+                #expect(sessions.map(\.id) == [sessionId])
+                #expect(sessions.first?.access == .readOnly)
+                #expect(sessions.first?.ownerId == owner.id)
+            }
+
+            try await app.test(.DELETE, "\(participants)/\(guest.id!)") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+            } afterResponse: { res in
+                #expect(res.status == .noContent)
+            }
+
+            try await app.test(.GET, "/api/sandboxes/\(sandbox.id!)/exec/sessions") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: guestToken)
+            } afterResponse: { res in
+                #expect(try res.content.decode([SharedSessionResponse].self).isEmpty)
+            }
+        }
+    }
+
+    @Test("A user who could not open the session themselves cannot be invited")
+    func inviteeNeedsThePermission() async throws {
+        try await withSharingTestApp { app, owner, project, sandbox, token in
+            let sessionId = try attachedSession(app: app, sandbox: sandbox, owner: owner)
+            let (viewer, _) = try await member("share-viewer", role: .viewer, project: project, app: app)
+
+            try await app.test(.POST, "/api/sandboxes/\(sandbox.id!)/exec/\(sessionId)/participants") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                try req.content.encode(InviteBody(userId: viewer.id!, access: "read_write"))
+            } afterResponse: { res in
+                #expect(res.status == .forbidden)
+            }
+        }
+    }
+
+    @Test("Only the session's owner manages its participants")
+    func onlyOwnerManages() async throws {
+        try await withSharingTestApp { app, owner, project, sandbox, _ in
+            let sessionId = try attachedSession(app: app, sandbox: sandbox, owner: owner)
+            let (_, otherToken) = try await member("share-other", role: .operator, project: project, app: app)
+
+            try await app.test(.POST, "/api/sandboxes/\(sandbox.id!)/exec/\(sessionId)/participants") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: otherToken)
+                try req.content.encode(InviteBody(userId: owner.id!, access: "read_write"))
+            } afterResponse: { res in
+                #expect(res.status == .forbidden)
+            }
+            try await app.test(.GET, "/api/sandboxes/\(sandbox.id!)/exec/\(sessionId)/participants") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: otherToken)
+            } afterResponse: { res in
+                #expect(res.status == .forbidden)
+            }
+            try await app.test(.GET, "/api/sandboxes/\(sandbox.id!)/exec/sessions") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: otherToken)
+            } afterResponse: { res in
+                #expect(try res.content.decode([SharedSessionResponse].self).isEmpty)
+            }
+        }
+    }
+
+    @Test("Revoking needs the exec permission, not delete on the sandbox")
+    func revokeNeedsExecNotDelete() async throws {
+        try await withSharingTestApp { app, _, project, sandbox, _ in
+            // An operator may exec but not delete: the middleware lets the
+            // DELETE through, and the handler answers for the session.
+            let (_, operatorToken) = try await member("share-operator", role: .operator, project: project, app: app)
+            let path = "/api/sandboxes/\(sandbox.id!)/exec/\(UUID())/participants/\(UUID())"
+
+            try await app.test(.DELETE, path) { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: operatorToken)
+            } afterResponse: { res in
+                #expect(res.status == .notFound)
+            }
+        }
+    }
+}
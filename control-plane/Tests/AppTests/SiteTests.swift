@@ -231,6 +231,48 @@ final class SiteTests {
         }
     }
 
+    @Test("A site's default CPU model is validated, stored canonical, and cleared by a PUT without it")
+    func siteDefaultCPUModel() async throws {
+        try await withSiteTestApp { app, _, project, token in
+            let orgId = project.$organization.id
+            var siteId: UUID?
+
+            try await app.test(.POST, "/api/sites") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                try req.content.encode(
+                    CreateSiteRequest(name: "cpu-bad", organizationId: orgId, defaultCpuModel: "not a model!"))
+            } afterResponse: { res in
+                #expect(res.status == .badRequest)
+            }
+
+            try await app.test(.POST, "/api/sites") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                try req.content.encode(
+                    CreateSiteRequest(name: "cpu-dc", organizationId: orgId, defaultCpuModel: "host"))
+            } afterResponse: { res in
+                #expect(res.status == .ok)
+                let site = try res.content.decode(SiteResponse.self)
+                #expect(site.defaultCpuModel == "host-passthrough")
+                siteId = site.id
+            }
+            let id = try #require(siteId)
+
+            try await app.test(.PUT, "/api/sites/\(id.uuidString)") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                try req.content.encode(UpdateSiteRequest(defaultCpuModel: "Cascadelake-Server"))
+            } afterResponse: { res in
+                #expect(try res.content.decode(SiteResponse.self).defaultCpuModel == "Cascadelake-Server")
+            }
+
+            try await app.test(.PUT, "/api/sites/\(id.uuidString)") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                try req.content.encode(UpdateSiteRequest(description: "no default"))
+            } afterResponse: { res in
+                #expect(try res.content.decode(SiteResponse.self).defaultCpuModel == nil)
+            }
+        }
+    }
+
     @Test("Invalid site metadata is rejected")
     func siteMetadataValidation() async throws {
         try await withSiteTestApp { app, _, project, token in
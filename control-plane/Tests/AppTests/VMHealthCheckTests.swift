@@ -0,0 +1,182 @@
+import Fluent
+import Foundation
+import StratoShared
+import Testing
+import Vapor
+import VaporTesting
+
+@testable import App
+
+/// VM application health checks (wire v31): the per-VM endpoints, what they
+/// accept, and the observed-state applier recording verdicts and running the
+/// VM's action once per unhealthy spell.
+@Suite("VM Health Check Tests", .serialized)
+struct VMHealthCheckTests {
+
+    private func withHealthApp(
+        _ test: (Application, Organization, Project, String) async throws -> Void
+    ) async throws {
+        try await withTestApp { app in
+            let builder = TestDataBuilder(db: app.db)
+            let user = try await builder.createUser(
+                username: "healthadmin", email: "healthadmin@example.com", isSystemAdmin: false)
+            let org = try await builder.createOrganization(name: "Health Org")
+            try await builder.addUserToOrganization(user: user, organization: org, role: "admin")
+            user.currentOrganizationId = org.id
+            try await user.save(on: app.db)
+            let project = try await builder.createProject(
+                name: "Health Project", description: "Project for health check tests", organization: org)
+
+            try await test(app, org, project, try await user.generateAPIKey(on: app.db))
+        }
+    }
+
+    private static func request(
+        _ kind: VMHealthCheckKind, port: Int? = nil, command: [String]? = nil, interval: Int? = nil,
+        timeout: Int? = nil, action: VMHealthAction? = nil
+    ) -> SetVMHealthCheckRequest {
+        SetVMHealthCheckRequest(
+            kind: kind, port: port, path: nil, command: command, intervalSeconds: interval, timeoutSeconds: timeout,
+            failureThreshold: nil, gracePeriodSeconds: nil, action: action)
+    }
+
+    private func put(
+        _ body: SetVMHealthCheckRequest, vm: VM, token: String, app: Application
+    ) async throws -> (HTTPStatus, VMHealthCheckResponse?) {
+        var result: (HTTPStatus, VMHealthCheckResponse?) = (.internalServerError, nil)
+        try await app.test(.PUT, "/api/vms/\(vm.id!)/health-check") { req in
+            req.headers.bearerAuthorization = BearerAuthorization(token: token)
+            try req.content.encode(body)
+        } afterResponse: { res in
+            result = (res.status, res.status == .ok ? try res.content.decode(VMHealthCheckResponse.self) : nil)
+        }
+        return result
+    }
+
+    @Test("Checks are validated per kind and filled in with defaults")
+    func validation() throws {
+        let http = try VMHealthCheckController.validated(Self.request(.http, port: 8080))
+        #expect(http.path == "/")
+        #expect(http.intervalSeconds == 10)
+        #expect(http.failureThreshold == 3)
+        let exec = try VMHealthCheckController.validated(
+            Self.request(.exec, port: 22, command: ["/usr/bin/systemctl", "is-active", "app"]))
+        #expect(exec.port == nil)
+
+        let invalid = [
+            Self.request(.tcp),
+            Self.request(.tcp, port: 70000),
+            Self.request(.exec, command: ["systemctl", "is-active"]),
+            Self.request(.exec, command: []),
+            Self.request(.tcp, port: 22, interval: 2),
+            Self.request(.tcp, port: 22, interval: 10, timeout: 10),
+        ]
+        for request in invalid {
+            #expect(throws: Abort.self) { try VMHealthCheckController.validated(request) }
+        }
+    }
+
+    @Test("A VM's check is set, read and removed; replace needs an image and old agents are refused")
+    func endpoints() async throws {
+        try await withHealthApp { app, org, project, token in
+            let vm = try await TestDataBuilder(db: app.db).createVM(name: "health-vm", project: project)
+            let path = "/api/vms/\(vm.id!)/health-check"
+
+            try await app.test(.GET, path) { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+            } afterResponse: { res in
+                #expect(res.status == .notFound)
+            }
+
+            let replace = try await put(
+                Self.request(.http, port: 8080, action: .replace), vm: vm, token: token, app: app)
+            #expect(replace.0 == .badRequest)
+
+            let set = try await put(
+                Self.request(.http, port: 8080, action: .reboot), vm: vm, token: token, app: app)
+            #expect(set.0 == .ok)
+            #expect(set.1?.action == .reboot)
+            #expect(set.1?.status == nil)
+            let stored = try #require(try await VM.find(vm.id, on: app.db))
+            #expect(stored.healthCheck?.port == 8080)
+            #expect(stored.generation > vm.generation)
+
+            try await app.test(.DELETE, path) { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+            } afterResponse: { res in
+                #expect(res.status == .noContent)
+            }
+            #expect(try await VM.find(vm.id, on: app.db)?.healthCheck == nil)
+
+            // Placed on an agent that predates health checks.
+            let agent = try await app.agentService.registerAgent(
+                AgentRegisterMessage(
+                    agentId: "old-agent", hostname: "old-host", version: "1.0.0", capabilities: ["qemu"],
+                    resources: AgentResources(
+                        totalCPU: 8, availableCPU: 8, totalMemory: 1 << 33, availableMemory: 1 << 33,
+                        totalDisk: 1 << 39, availableDisk: 1 << 39),
+                    protocolVersion: WireProtocol.vmHealthChecksMinimumVersion - 1),
+                agentName: "old-agent", organizationScope: .organization(org.id!))
+            stored.hypervisorId = agent.uuidString
+            try await stored.save(on: app.db)
+            let refused = try await put(Self.request(.tcp, port: 22), vm: stored, token: token, app: app)
+            #expect(refused.0 == .conflict)
+        }
+    }
+
+    @Test("Turning unhealthy replaces the VM once per spell; stopping clears the verdict")
+    func applierRemediates() async throws {
+        try await withHealthApp { app, _, project, _ in
+            let vm = try await TestDataBuilder(db: app.db).createVM(name: "flaky-vm", project: project)
+            vm.hypervisorId = "health-agent"
+            vm.status = .running
+            vm.desiredStatus = .running
+            vm.healthCheck = VMHealthCheck(
+                kind: .tcp, port: 22, intervalSeconds: 10, timeoutSeconds: 2, failureThreshold: 3,
+                gracePeriodSeconds: 0)
+            vm.healthAction = VMHealthAction.replace.rawValue
+            try await vm.save(on: app.db)
+            let generation = vm.generation
+
+            func report(_ status: VMStatus, health: VMHealthObservation?) async throws {
+                try await app.observedStateApplier.apply(
+                    ObservedStateReport(
+                        agentId: "health-agent",
+                        vms: [
+                            ObservedVMState(
+                                vmId: vm.id!, status: status, observedGeneration: generation, health: health)
+                        ],
+                        resources: AgentResources(
+                            totalCPU: 8, availableCPU: 8, totalMemory: 1 << 33, availableMemory: 1 << 33,
+                            totalDisk: 1 << 39, availableDisk: 1 << 39)))
+            }
+            let unhealthy = VMHealthObservation(
+                status: .unhealthy, consecutiveFailures: 3, checkedAt: Date(), message: "connection refused")
+
+            let healthy = VMHealthObservation(status: .healthy, consecutiveFailures: 0, checkedAt: Date())
+            try await report(.running, health: healthy)
+            #expect(try await VM.find(vm.id, on: app.db)?.healthStatus == "healthy")
+
+            try await report(.running, health: unhealthy)
+            let replaced = try #require(try await VM.find(vm.id, on: app.db))
+            #expect(replaced.healthStatus == "unhealthy")
+            #expect(replaced.healthMessage == "connection refused")
+            #expect(replaced.replacementCount == 1)
+            #expect(replaced.generation == generation + 1)
+            let operations = try await ResourceOperation.query(on: app.db)
+                .filter(\.$resourceID == vm.id!)
+                .all()
+            #expect(operations.map(\.kind) == [.replace])
+            #expect(operations.first?.userID == ResourceOperation.systemUserID)
+
+            // Still unhealthy after the replacement: no second action.
+            try await report(.running, health: unhealthy)
+            #expect(try await VM.find(vm.id, on: app.db)?.replacementCount == 1)
+
+            try await report(.shutdown, health: nil)
+            let stopped = try #require(try await VM.find(vm.id, on: app.db))
+            #expect(stopped.healthStatus == nil)
+            #expect(stopped.healthCheckedAt == nil)
+        }
+    }
+}
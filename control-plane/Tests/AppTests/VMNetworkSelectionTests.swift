@@ -24,6 +24,7 @@ final class VMNetworkSelectionTests {
         let networkName: String?
         var userData: String? = nil
         var hypervisorType: String? = nil
+        var nics: [CreateVMNICRequest]? = nil
     }
 
     private func gb(_ value: Double) -> Int64 { Int64(value * 1024 * 1024 * 1024) }
@@ -343,6 +344,116 @@ final class VMNetworkSelectionTests {
         }
     }
 
+    @Test("POST /api/vms with nics creates each NIC in order, honoring fixed addresses and MACs")
+    func createWithMultipleNICs() async throws {
+        try await withApp { app, user, _, project, image, token in
+            let backend = LogicalNetwork(
+                name: "backend-net", subnet: "10.130.0.0/24", gateway: "10.130.0.1",
+                subnet6: "fd00:130::/64", gateway6: "fd00:130::1",
+                projectID: project.id!, createdByID: user.id!)
+            try await backend.save(on: app.db)
+
+            try await app.test(.POST, "/api/vms") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                try req.content.encode(
+                    CreateVMBody(
+                        name: "multi-vm", imageId: image.id, projectId: project.id,
+                        environment: "development", cpu: 1, memory: gb(1), disk: gb(10),
+                        networkId: nil, networkName: nil,
+                        nics: [
+                            CreateVMNICRequest(),
+                            CreateVMNICRequest(
+                                networkId: backend.id, ipAddress: "10.130.0.50", ipv6Address: "fd00:130::50",
+                                macAddress: "52:54:00:AB:CD:EF"),
+                        ]))
+            } afterResponse: { res in
+                #expect(res.status == .accepted)
+            }
+
+            let vm = try #require(try await VM.query(on: app.db).filter(\.$name == "multi-vm").first())
+            let nics = try await VMNetworkInterface.query(on: app.db)
+                .filter(\.$vm.$id == vm.id!)
+                .with(\.$addresses)
+                .sort(\.$orderIndex)
+                .all()
+            #expect(nics.map(\.deviceName) == ["net0", "net1"])
+            #expect(nics.map(\.network) == [LogicalNetwork.defaultNetworkName, "backend-net"])
+            #expect(nics[1].macAddress == "52:54:00:ab:cd:ef")
+            #expect(nics[1].ipv4Address?.address == "10.130.0.50")
+            #expect(nics[1].ipv6Address?.address == "fd00:130::50")
+        }
+    }
+
+    @Test("POST /api/vms refuses a fixed address that is taken or reserved by another project (409)")
+    func createRejectsUnavailableFixedAddress() async throws {
+        try await withApp { app, user, org, project, image, token in
+            let network = LogicalNetwork(
+                name: "fixed-net", subnet: "10.131.0.0/24", gateway: "10.131.0.1",
+                projectID: nil, createdByID: user.id!)
+            try await network.save(on: app.db)
+            let otherProject = try await TestDataBuilder(db: app.db).createProject(
+                name: "Reserving Project", description: "p", organization: org)
+            try await IPReservation(
+                networkID: network.id!, projectID: otherProject.id!, family: .ipv4, address: "10.131.0.2"
+            ).save(on: app.db)
+            try await IPReservation(
+                networkID: network.id!, projectID: project.id!, family: .ipv4, address: "10.131.0.3"
+            ).save(on: app.db)
+
+            func create(_ name: String, _ address: String) async throws -> HTTPStatus {
+                var status = HTTPStatus.internalServerError
+                try await app.test(.POST, "/api/vms") { req in
+                    req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                    try req.content.encode(
+                        CreateVMBody(
+                            name: name, imageId: image.id, projectId: project.id,
+                            environment: "development", cpu: 1, memory: gb(1), disk: gb(10),
+                            networkId: nil, networkName: nil,
+                            nics: [CreateVMNICRequest(networkId: network.id, ipAddress: address)]))
+                } afterResponse: { res in
+                    status = res.status
+                }
+                return status
+            }
+
+            #expect(try await create("elsewhere-vm", "10.131.0.2") == .conflict)
+            #expect(try await create("own-vm", "10.131.0.3") == .accepted)
+            #expect(try await create("again-vm", "10.131.0.3") == .conflict)
+            #expect(try await create("outside-vm", "10.200.0.10") == .badRequest)
+            #expect(try await VM.query(on: app.db).count() == 1)
+
+            // Automatic allocation never hands out a reserved address.
+            try await app.test(.POST, "/api/vms") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                try req.content.encode(
+                    CreateVMBody(
+                        name: "next-vm", imageId: image.id, projectId: project.id,
+                        environment: "development", cpu: 1, memory: gb(1), disk: gb(10),
+                        networkId: network.id, networkName: nil))
+            } afterResponse: { res in
+                #expect(res.status == .accepted)
+            }
+            #expect(try await nic(forVMNamed: "next-vm", on: app.db)?.ipv4Address?.address == "10.131.0.4")
+        }
+    }
+
+    @Test("POST /api/vms rejects nics combined with the single-NIC fields (400)")
+    func createRejectsMixedNICFields() async throws {
+        try await withApp { app, _, _, project, image, token in
+            try await app.test(.POST, "/api/vms") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: token)
+                try req.content.encode(
+                    CreateVMBody(
+                        name: "mixed-vm", imageId: image.id, projectId: project.id,
+                        environment: "development", cpu: 1, memory: gb(1), disk: gb(10),
+                        networkId: nil, networkName: LogicalNetwork.defaultNetworkName,
+                        nics: [CreateVMNICRequest()]))
+            } afterResponse: { res in
+                #expect(res.status == .badRequest)
+            }
+        }
+    }
+
     @Test("GET /api/vms/:id includes the VM's network interfaces")
     func showIncludesNetworkInterfaces() async throws {
         try await withApp { app, _, _, project, _, token in
@@ -395,4 +395,41 @@ final class VMResizeTests {
             #expect(refreshed?.balloonTarget == nil)
         }
     }
+
+    // MARK: - Memory floors (overcommit)
+
+    @Test("A memory floor is recorded, bumps the generation, and null clears it")
+    func memoryFloorSetAndCleared() async throws {
+        try await withResizeTestApp { app, _, vm, _, token in
+            let oneGB = Int64(1024 * 1024 * 1024)
+
+            try await put(app, vm, token: token, body: ["memoryFloor": oneGB]) { res in
+                #expect(res.status == .ok)
+                let detail = try res.content.decode(VMDetailResponse.self)
+                #expect(detail.memoryFloor == oneGB)
+            }
+
+            let refreshed = try #require(try await VM.find(vm.id, on: app.db))
+            #expect(refreshed.memoryFloor == oneGB)
+            #expect(refreshed.generation > vm.generation)
+
+            try await put(app, vm, token: token, body: ["memoryFloor": NSNull()]) { res in
+                #expect(res.status == .ok)
+            }
+            #expect(try await VM.find(vm.id, on: app.db)?.memoryFloor == nil)
+        }
+    }
+
+    @Test("A memory floor above the VM's memory is a 400")
+    func memoryFloorAboveMemoryRejected() async throws {
+        try await withResizeTestApp { app, _, vm, _, token in
+            try await put(app, vm, token: token, body: ["memoryFloor": Int64(10 * 1024 * 1024 * 1024)]) { res in
+                #expect(res.status == .badRequest)
+                #expect(res.body.string.contains("memoryFloor"))
+            }
+
+            let refreshed = try await VM.find(vm.id, on: app.db)
+            #expect(refreshed?.memoryFloor == nil)
+        }
+    }
 }
@@ -168,7 +168,7 @@ struct VMSpecBuilderTests {
         #expect(spec.diskBytes == 10_737_418_240)
 
         let specWithVolumes = VMSpecBuilder.buildVMSpecWithVolumes(
-            from: vm, image: image, volumes: [], networkInterfaces: [])
+            from: vm, image: image, attachments: [], networkInterfaces: [])
         #expect(specWithVolumes.diskBytes == 10_737_418_240)
     }
 
@@ -507,7 +507,7 @@ struct VMSpecBuilderTests {
         #expect(spec.userData == payload)
 
         let specWithVolumes = VMSpecBuilder.buildVMSpecWithVolumes(
-            from: vm, image: image, volumes: [], networkInterfaces: [])
+            from: vm, image: image, attachments: [], networkInterfaces: [])
         #expect(specWithVolumes.userData == payload)
     }
 
@@ -525,7 +525,7 @@ struct VMSpecBuilderTests {
         #expect(spec.machine?.tpm == true)
 
         let specWithVolumes = VMSpecBuilder.buildVMSpecWithVolumes(
-            from: vm, image: image, volumes: [], networkInterfaces: [])
+            from: vm, image: image, attachments: [], networkInterfaces: [])
         #expect(specWithVolumes.machine?.secureBoot == true)
         #expect(specWithVolumes.machine?.tpm == true)
     }
@@ -540,6 +540,36 @@ struct VMSpecBuilderTests {
         #expect(spec.machine?.secureBoot == false)
         #expect(spec.machine?.tpm == false)
     }
+
+    @Test("VMSpecBuilder carries the VM's CPU model, and none means passthrough")
+    func testCPUModel() throws {
+        let image = createTestImage()
+        let vm = createTestVM()
+        #expect(VMSpecBuilder.buildVMSpec(from: vm, image: image, networkInterfaces: []).cpuModel == nil)
+
+        vm.cpuModel = "Skylake-Server"
+        let spec = VMSpecBuilder.buildVMSpec(from: vm, image: image, networkInterfaces: [])
+        #expect(spec.cpuModel == .named("Skylake-Server"))
+        let specWithVolumes = VMSpecBuilder.buildVMSpecWithVolumes(
+            from: vm, image: image, attachments: [], networkInterfaces: [])
+        #expect(specWithVolumes.cpuModel == .named("Skylake-Server"))
+    }
+
+    @Test("VMSpecBuilder carries custom Secure Boot keys only with Secure Boot on")
+    func testSecureBootKeys() throws {
+        let image = createTestImage()
+        let vm = createTestVM()
+        let keys = SecureBootKeys(ownerGUID: UUID().uuidString, platformKey: "pk", signatureDatabase: ["db"])
+        vm.secureBootKeys = keys
+        #expect(VMSpecBuilder.buildVMSpec(from: vm, image: image, networkInterfaces: []).machine?.secureBootKeys == nil)
+
+        vm.secureBoot = true
+        let spec = VMSpecBuilder.buildVMSpec(from: vm, image: image, networkInterfaces: [])
+        #expect(spec.machine?.secureBootKeys == keys)
+        let specWithVolumes = VMSpecBuilder.buildVMSpecWithVolumes(
+            from: vm, image: image, attachments: [], networkInterfaces: [])
+        #expect(specWithVolumes.machine?.secureBootKeys == keys)
+    }
 }
 
 @Suite("VM create user-data validation")
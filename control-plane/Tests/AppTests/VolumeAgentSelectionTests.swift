@@ -18,14 +18,15 @@ struct VolumeAgentSelectionTests {
     private func makeAgent(
         id: String,
         hypervisors: [HypervisorSupport],
-        status: AgentStatus = .online
+        status: AgentStatus = .online,
+        capabilities: [String] = []
     ) -> Agent {
         Agent(
             id: UUID(),
             name: id,
             hostname: "host-\(id)",
             version: "1.0",
-            capabilities: [],
+            capabilities: capabilities,
             status: status,
             resources: AgentResources(
                 totalCPU: 8,
@@ -112,4 +113,18 @@ struct VolumeAgentSelectionTests {
 
         #expect(VolumeService.selectVolumeAgent(from: agents, memberAgentIds: [])?.name == "any")
     }
+
+    @Test("a volume type requiring encryption only lands on agents advertising encrypted storage")
+    func testEncryptionRequirement() {
+        let plain = makeAgent(id: "plain", hypervisors: [hypervisor(.qemu)])
+        let encrypted = makeAgent(
+            id: "encrypted", hypervisors: [hypervisor(.qemu)],
+            capabilities: [StorageCapability.encryptedVolumeStorage])
+
+        #expect(
+            VolumeService.selectVolumeAgent(from: [plain, encrypted], requiresEncryption: true)?.name
+                == "encrypted")
+        #expect(VolumeService.selectVolumeAgent(from: [plain], requiresEncryption: true) == nil)
+        #expect(VolumeService.selectVolumeAgent(from: [plain], requiresEncryption: false)?.name == "plain")
+    }
 }
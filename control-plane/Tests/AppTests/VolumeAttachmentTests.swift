@@ -0,0 +1,236 @@
+import Fluent
+import Foundation
+import Testing
+import Vapor
+import VaporTesting
+
+@testable import App
+
+/// Multi-attach volumes: which volumes admit another holder, how the legacy
+/// single-attachment columns follow the attachment rows, and the API's
+/// refusals for unsafe sharing.
+@Suite("Volume Attachment Tests", .serialized)
+struct VolumeAttachmentTests {
+
+    // MARK: - canAttach (pure logic)
+
+    private func makeVolume(status: VolumeStatus, multiAttach: Bool, format: VolumeFormat = .raw) -> Volume {
+        Volume(
+            name: "shared", description: "", projectID: UUID(), size: 1_073_741_824, format: format,
+            status: status, createdByID: UUID(), multiAttach: multiAttach)
+    }
+
+    @Test("only a multi-attach volume admits another holder while attached")
+    func canAttachRespectsMultiAttach() {
+        #expect(makeVolume(status: .available, multiAttach: false).canAttach)
+        #expect(!makeVolume(status: .attached, multiAttach: false).canAttach)
+        #expect(makeVolume(status: .attached, multiAttach: true).canAttach)
+        // Mid-transition is still off-limits, shared or not.
+        #expect(!makeVolume(status: .attaching, multiAttach: true).canAttach)
+        #expect(!makeVolume(status: .detaching, multiAttach: true).canAttach)
+    }
+
+    // MARK: - Database / API
+
+    private struct Fixture {
+        let app: Application
+        let token: String
+        let user: User
+        let project: Project
+    }
+
+    private func withAttachmentApp(_ test: (Fixture) async throws -> Void) async throws {
+        try await withTestApp { app in
+            let builder = TestDataBuilder(db: app.db)
+            let user = try await builder.createUser(username: "va-user", email: "va-user@example.com")
+            let org = try await builder.createOrganization(name: "Volume Attachment Org")
+            try await builder.addUserToOrganization(user: user, organization: org, role: "admin")
+            user.currentOrganizationId = org.id
+            try await user.save(on: app.db)
+            let project = try await builder.createProject(
+                name: "Volume Attachment Project", description: "multi-attach", organization: org)
+
+            try await test(
+                Fixture(
+                    app: app,
+                    token: try await user.generateAPIKey(on: app.db),
+                    user: user,
+                    project: project
+                ))
+        }
+    }
+
+    @Test("the volume mirrors its oldest holder, and returns to available when the last lets go")
+    func syncVolumeFollowsRows() async throws {
+        try await withAttachmentApp { fixture in
+            let db = fixture.app.db
+            let builder = TestDataBuilder(db: db)
+            let first = try await builder.createVM(name: "first-holder", project: fixture.project)
+            let second = try await builder.createVM(name: "second-holder", project: fixture.project)
+            let volume = Volume(
+                name: "shared", description: "", projectID: try fixture.project.requireID(), size: 1_073_741_824,
+                format: .raw, status: .available, createdByID: try fixture.user.requireID(), multiAttach: true)
+            try await volume.save(on: db)
+            let volumeID = try volume.requireID()
+
+            let firstRow = VolumeAttachment(
+                volumeID: volumeID, vmID: try first.requireID(), agentId: "agent-a", deviceName: "vdb",
+                status: .attached)
+            try await firstRow.save(on: db)
+            try await VolumeAttachment(
+                volumeID: volumeID, vmID: try second.requireID(), agentId: "agent-b", deviceName: "vdc",
+                readonly: true, status: .attached
+            ).save(on: db)
+
+            try await VolumeAttachment.syncVolume(volume, on: db)
+            #expect(volume.status == .attached)
+            #expect(volume.$vm.id == first.id)
+            #expect(volume.deviceName == "vdb")
+            #expect(volume.attachedAgentId == "agent-a")
+
+            // The first holder leaving promotes the second.
+            try await firstRow.delete(on: db)
+            try await VolumeAttachment.syncVolume(volume, on: db)
+            #expect(volume.status == .attached)
+            #expect(volume.$vm.id == second.id)
+            #expect(volume.deviceName == "vdc")
+
+            try await VolumeAttachment.query(on: db).filter(\.$volume.$id == volumeID).delete()
+            try await VolumeAttachment.syncVolume(volume, on: db)
+            #expect(volume.status == .available)
+            #expect(volume.$vm.id == nil)
+            #expect(volume.deviceName == nil)
+            #expect(volume.attachedAgentId == nil)
+        }
+    }
+
+    @Test("a boot volume cannot be created multi-attach")
+    func bootVolumeCannotBeShared() async throws {
+        try await withAttachmentApp { fixture in
+            try await fixture.app.test(.POST, "/api/volumes") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: fixture.token)
+                try req.content.encode(
+                    CreateVolumeRequest(
+                        name: "shared-boot", description: nil, projectId: try fixture.project.requireID(),
+                        sizeGB: 1, format: "raw", volumeType: "boot", sourceImageId: nil, volumeTypeId: nil,
+                        multiAttach: true))
+            } afterResponse: { res in
+                #expect(res.status == .badRequest)
+            }
+            #expect(try await Volume.query(on: fixture.app.db).count() == 0)
+        }
+    }
+
+    @Test("a qcow2 multi-attach volume is refused a writable holder")
+    func writableQcow2SharingRefused() async throws {
+        try await withAttachmentApp { fixture in
+            let db = fixture.app.db
+            let userID = try fixture.user.requireID()
+            let vm = try await TestDataBuilder(db: db).createVM(name: "writer", project: fixture.project)
+            let volume = Volume(
+                name: "shared-qcow2", description: "", projectID: try fixture.project.requireID(),
+                size: 1_073_741_824, format: .qcow2, status: .available, createdByID: userID, multiAttach: true)
+            try await volume.save(on: db)
+            try await RoleBindingService.grant(
+                principalType: .user, principalID: userID, role: .admin,
+                nodeType: .volume, nodeID: try volume.requireID(), createdBy: userID, on: db)
+            try await RoleBindingService.grant(
+                principalType: .user, principalID: userID, role: .admin,
+                nodeType: .virtualMachine, nodeID: try vm.requireID(), createdBy: userID, on: db)
+
+            try await fixture.app.test(.POST, "/api/volumes/\(volume.id!)/attach") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: fixture.token)
+                try req.content.encode(
+                    AttachVolumeRequest(vmId: vm.id!, deviceName: nil, bootOrder: nil, readonly: false))
+            } afterResponse: { res in
+                #expect(res.status == .badRequest)
+                #expect(res.body.string.contains("raw"))
+            }
+            #expect(try await VolumeAttachment.query(on: db).count() == 0)
+            #expect(try await Volume.find(volume.id, on: db)?.status == .available)
+        }
+    }
+
+    @Test("a failed detach leaves the volume's status to the holders, not to the request")
+    func failedDetachResyncsVolume() async throws {
+        try await withAttachmentApp { fixture in
+            let db = fixture.app.db
+            let userID = try fixture.user.requireID()
+            let builder = TestDataBuilder(db: db)
+            let first = try await builder.createVM(name: "holder-1", project: fixture.project)
+            let second = try await builder.createVM(name: "holder-2", project: fixture.project)
+            let volume = Volume(
+                name: "dataset", description: "", projectID: try fixture.project.requireID(),
+                size: 1_073_741_824, format: .raw, status: .attached, createdByID: userID, multiAttach: true)
+            try await volume.save(on: db)
+            try await RoleBindingService.grant(
+                principalType: .user, principalID: userID, role: .admin,
+                nodeType: .volume, nodeID: try volume.requireID(), createdBy: userID, on: db)
+            for (vm, device) in [(first, "vdb"), (second, "vdc")] {
+                try await VolumeAttachment(
+                    volumeID: try volume.requireID(), vmID: try vm.requireID(), agentId: nil, deviceName: device,
+                    status: .attached
+                ).save(on: db)
+            }
+            // The second holder is already on its way out, so the first is
+            // the last one left: its detach moves the volume to detaching.
+            try await VolumeAttachment.query(on: db)
+                .filter(\.$vm.$id == second.requireID())
+                .set(\.$status, to: .detaching)
+                .update()
+
+            // Neither VM is scheduled, so the hot-unplug fails.
+            try await fixture.app.test(.POST, "/api/volumes/\(volume.id!)/detach?vmId=\(first.id!)") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: fixture.token)
+            } afterResponse: { res in
+                #expect(res.status != .ok)
+            }
+
+            let reverted = try #require(
+                try await VolumeAttachment.query(on: db).filter(\.$vm.$id == first.requireID()).first())
+            #expect(reverted.status == .attached)
+            let stored = try #require(try await Volume.find(volume.id, on: db))
+            #expect(stored.status == .attached)
+
+            // A holder mid-detach can't be detached a second time.
+            try await fixture.app.test(.POST, "/api/volumes/\(volume.id!)/detach?vmId=\(second.id!)") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: fixture.token)
+            } afterResponse: { res in
+                #expect(res.status == .conflict)
+            }
+        }
+    }
+
+    @Test("attachments are listed per holder")
+    func listAttachments() async throws {
+        try await withAttachmentApp { fixture in
+            let db = fixture.app.db
+            let userID = try fixture.user.requireID()
+            let builder = TestDataBuilder(db: db)
+            let first = try await builder.createVM(name: "reader-1", project: fixture.project)
+            let second = try await builder.createVM(name: "reader-2", project: fixture.project)
+            let volume = Volume(
+                name: "dataset", description: "", projectID: try fixture.project.requireID(),
+                size: 1_073_741_824, format: .qcow2, status: .attached, createdByID: userID, multiAttach: true)
+            try await volume.save(on: db)
+            try await RoleBindingService.grant(
+                principalType: .user, principalID: userID, role: .admin,
+                nodeType: .volume, nodeID: try volume.requireID(), createdBy: userID, on: db)
+            for vm in [first, second] {
+                try await VolumeAttachment(
+                    volumeID: try volume.requireID(), vmID: try vm.requireID(), agentId: nil, deviceName: "vdb",
+                    readonly: true, status: .attached
+                ).save(on: db)
+            }
+
+            try await fixture.app.test(.GET, "/api/volumes/\(volume.id!)/attachments") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: fixture.token)
+            } afterResponse: { res in
+                #expect(res.status == .ok)
+                let attachments = try res.content.decode([VolumeAttachmentResponse].self)
+                #expect(Set(attachments.map(\.vmId)) == Set([first.id!, second.id!]))
+                #expect(attachments.allSatisfy(\.readonly))
+            }
+        }
+    }
+}
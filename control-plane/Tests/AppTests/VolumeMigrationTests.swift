@@ -0,0 +1,302 @@
+import Fluent
+import Foundation
+import StratoShared
+import Testing
+import Vapor
+import VaporTesting
+
+@testable import App
+
+/// Volume migration: target-agent gating, the NBD spec a migrated attached
+/// volume is served from, and the migrate API's refusals and outcomes. No
+/// agent is connected in these tests, so a migration that has to move bytes
+/// fails at its first agent call and must leave the volume where it was.
+@Suite("Volume Migration Tests", .serialized)
+struct VolumeMigrationTests {
+
+    // MARK: - Target gating (pure logic)
+
+    private func makeAgent(
+        name: String, wireVersion: Int?, capabilities: [String] = ["qemu"]
+    ) -> Agent {
+        let agent = Agent(
+            name: name,
+            hostname: "\(name).example",
+            version: "1.0.0",
+            capabilities: capabilities,
+            status: .online,
+            resources: AgentResources(
+                totalCPU: 16, availableCPU: 16,
+                totalMemory: 32_000_000_000, availableMemory: 32_000_000_000,
+                totalDisk: 500_000_000_000, availableDisk: 500_000_000_000
+            ),
+            hypervisors: [
+                HypervisorSupport(
+                    type: .qemu, available: true, accelerated: true, capabilities: .capabilities(for: .qemu))
+            ],
+            lastHeartbeat: Date()
+        )
+        agent.wireProtocolVersion = wireVersion
+        return agent
+    }
+
+    @Test("a copy needs the migration messages; a mirror also needs an NBD export")
+    func targetGating() {
+        let old = makeAgent(name: "old", wireVersion: WireProtocol.volumeMigrationMinimumVersion - 1)
+        let plain = makeAgent(name: "plain", wireVersion: WireProtocol.volumeMigrationMinimumVersion)
+        let nbd = makeAgent(
+            name: "nbd", wireVersion: WireProtocol.volumeMigrationMinimumVersion,
+            capabilities: ["qemu", StorageCapability.nbdExport])
+
+        #expect(!VolumeController.canReceiveMigration(old, mode: .copy))
+        #expect(VolumeController.canReceiveMigration(plain, mode: .copy))
+        #expect(!VolumeController.canReceiveMigration(plain, mode: .mirror))
+        #expect(VolumeController.canReceiveMigration(nbd, mode: .mirror))
+    }
+
+    // MARK: - Spec (pure logic)
+
+    private func attachedVolume(
+        status: VolumeStatus, replicaAgentId: String, endpoint: NBDExportEndpoint?
+    ) -> VolumeAttachment {
+        let volumeId = UUID()
+        let volume = Volume(
+            id: volumeId, name: "data", description: "data disk", projectID: UUID(), size: 1_073_741_824,
+            format: .raw, volumeType: .data, status: status, createdByID: UUID())
+        volume.storagePath = "/var/lib/strato/volumes/\(volumeId)/volume.raw"
+        let replica = VolumeReplica(
+            volumeID: volumeId, agentId: replicaAgentId, datasetPath: volume.storagePath, state: .healthy)
+        replica.nbdEndpoint = endpoint
+        volume.$replicas.value = [replica]
+
+        let attachment = VolumeAttachment(
+            volumeID: volumeId, vmID: UUID(), agentId: "vm-host", deviceName: "vdb", status: .attached)
+        attachment.$volume.value = volume
+        return attachment
+    }
+
+    @Test("a replica exported from another agent is attached over NBD; a local one is opened directly")
+    func specServesRemoteReplicaOverNBD() {
+        let endpoint = NBDExportEndpoint(host: "10.0.10.5", port: 10809, exportName: "vol")
+
+        let remote = VMSpecBuilder.volumeSpecs(
+            from: [attachedVolume(status: .attached, replicaAgentId: "storage-host", endpoint: endpoint)])
+        #expect(remote.count == 1)
+        #expect(remote.first?.nbd == endpoint)
+
+        // The VM has since moved to where the replica is.
+        let local = VMSpecBuilder.volumeSpecs(
+            from: [attachedVolume(status: .attached, replicaAgentId: "vm-host", endpoint: endpoint)])
+        #expect(local.count == 1)
+        #expect(local.first?.nbd == nil)
+
+        // Mid-migration the volume stays attached on its current disk.
+        let migrating = VMSpecBuilder.volumeSpecs(
+            from: [attachedVolume(status: .migrating, replicaAgentId: "vm-host", endpoint: nil)])
+        #expect(migrating.count == 1)
+        #expect(migrating.first?.nbd == nil)
+    }
+
+    // MARK: - API
+
+    private struct Fixture {
+        let app: Application
+        let adminToken: String
+        let userToken: String
+        let user: User
+        let volume: Volume
+        let source: Agent
+    }
+
+    private func withMigrationApp(_ test: (Fixture) async throws -> Void) async throws {
+        try await withTestApp { app in
+            let builder = TestDataBuilder(db: app.db)
+            let admin = try await builder.createUser(
+                username: "mig-admin", email: "mig-admin@example.com", isSystemAdmin: true)
+            let user = try await builder.createUser(username: "mig-user", email: "mig-user@example.com")
+            let org = try await builder.createOrganization(name: "Migration Org")
+            try await builder.addUserToOrganization(user: user, organization: org, role: "admin")
+            user.currentOrganizationId = org.id
+            try await user.save(on: app.db)
+            let project = try await builder.createProject(
+                name: "Migration Project", description: "volume migration", organization: org)
+
+            let source = makeAgent(name: "mig-source", wireVersion: WireProtocol.currentVersion)
+            try await source.save(on: app.db)
+
+            let defaultPool = try await StoragePool.defaultPool(on: app.db)
+            let volume = Volume(
+                name: "to-migrate", description: "migration source", projectID: try project.requireID(),
+                size: 1_073_741_824, format: .qcow2, volumeType: .data, status: .available,
+                createdByID: try user.requireID(), poolID: defaultPool.id)
+            volume.hypervisorId = source.id?.uuidString
+            volume.storagePath = "/var/lib/strato/volumes/to-migrate.qcow2"
+            try await volume.save(on: app.db)
+            try await RoleBindingService.grant(
+                principalType: .user, principalID: try user.requireID(), role: .admin,
+                nodeType: .volume, nodeID: try volume.requireID(), createdBy: user.id, on: app.db)
+            try await RoleBindingService.grant(
+                principalType: .user, principalID: try admin.requireID(), role: .admin,
+                nodeType: .volume, nodeID: try volume.requireID(), createdBy: admin.id, on: app.db)
+
+            try await test(
+                Fixture(
+                    app: app,
+                    adminToken: try await admin.generateAPIKey(on: app.db),
+                    userToken: try await user.generateAPIKey(on: app.db),
+                    user: user,
+                    volume: volume,
+                    source: source
+                ))
+        }
+    }
+
+    private func migrate(
+        _ fixture: Fixture, token: String? = nil, _ body: MigrateVolumeRequest,
+        _ assertions: (TestingHTTPResponse) throws -> Void
+    ) async throws {
+        try await fixture.app.test(.POST, "/api/volumes/\(fixture.volume.id!)/migrate") { req in
+            req.headers.bearerAuthorization = BearerAuthorization(token: token ?? fixture.userToken)
+            try req.content.encode(body)
+        } afterResponse: { res in
+            try assertions(res)
+        }
+    }
+
+    /// Migrations run detached; wait for this one to leave `.running`.
+    private func settled(_ migrationId: UUID, on db: any Database) async throws -> VolumeMigration {
+        for _ in 0..<100 {
+            if let migration = try await VolumeMigration.find(migrationId, on: db), migration.status != .running {
+                return migration
+            }
+            try await Task.sleep(for: .milliseconds(50))
+        }
+        return try #require(try await VolumeMigration.find(migrationId, on: db))
+    }
+
+    @Test("tenants pick a pool or type, not an agent")
+    func targetAgentIsAdminOnly() async throws {
+        try await withMigrationApp { fixture in
+            try await migrate(
+                fixture, MigrateVolumeRequest(targetAgentId: "any-agent", targetPoolId: nil, volumeTypeId: nil)
+            ) { res in
+                #expect(res.status == .forbidden)
+            }
+            let volume = try await Volume.find(fixture.volume.id, on: fixture.app.db)
+            #expect(volume?.status == .available)
+        }
+    }
+
+    @Test("a volume with snapshots is refused, since they would be left behind")
+    func snapshotsBlockMigration() async throws {
+        try await withMigrationApp { fixture in
+            let snapshot = VolumeSnapshot(
+                name: "before", description: "pinned", volumeID: try fixture.volume.requireID(),
+                projectID: fixture.volume.$project.id, size: fixture.volume.size, status: .available,
+                createdByID: try fixture.user.requireID())
+            try await snapshot.save(on: fixture.app.db)
+
+            try await migrate(fixture, MigrateVolumeRequest(targetAgentId: nil, targetPoolId: nil, volumeTypeId: nil)) {
+                res in
+                #expect(res.status == .conflict)
+                #expect(res.body.string.contains("snapshot"))
+            }
+        }
+    }
+
+    @Test("an agent too old for the migration messages is not a target")
+    func oldTargetIsRefused() async throws {
+        try await withMigrationApp { fixture in
+            let old = makeAgent(name: "mig-old", wireVersion: WireProtocol.volumeMigrationMinimumVersion - 1)
+            try await old.save(on: fixture.app.db)
+
+            try await migrate(fixture, MigrateVolumeRequest(targetAgentId: nil, targetPoolId: nil, volumeTypeId: nil)) {
+                res in
+                #expect(res.status == .conflict)
+            }
+            try await migrate(
+                fixture, token: fixture.adminToken,
+                MigrateVolumeRequest(targetAgentId: old.id?.uuidString, targetPoolId: nil, volumeTypeId: nil)
+            ) { res in
+                #expect(res.status == .conflict)
+                #expect(res.body.string.contains("too old"))
+            }
+            let volume = try await Volume.find(fixture.volume.id, on: fixture.app.db)
+            #expect(volume?.status == .available)
+        }
+    }
+
+    @Test("a failed copy leaves the volume available where it was, with the failure in its history")
+    func failedCopyLeavesVolumeInPlace() async throws {
+        try await withMigrationApp { fixture in
+            let target = makeAgent(name: "mig-target", wireVersion: WireProtocol.currentVersion)
+            try await target.save(on: fixture.app.db)
+
+            var accepted: VolumeMigrationResponse?
+            try await migrate(fixture, MigrateVolumeRequest(targetAgentId: nil, targetPoolId: nil, volumeTypeId: nil)) {
+                res in
+                #expect(res.status == .accepted)
+                accepted = try res.content.decode(VolumeMigrationResponse.self)
+            }
+            let response = try #require(accepted)
+            #expect(response.mode == .copy)
+            #expect(response.sourceAgentId == fixture.source.id?.uuidString)
+            #expect(response.targetAgentId == target.id?.uuidString)
+
+            // The source agent isn't connected, so the export never starts.
+            let migration = try await settled(try #require(response.id), on: fixture.app.db)
+            #expect(migration.status == .failed)
+            #expect(migration.errorMessage != nil)
+            let volume = try #require(try await Volume.find(fixture.volume.id, on: fixture.app.db))
+            #expect(volume.status == .available)
+            #expect(volume.hypervisorId == fixture.source.id?.uuidString)
+
+            try await fixture.app.test(.GET, "/api/volumes/\(fixture.volume.id!)/migrations") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: fixture.userToken)
+            } afterResponse: { res in
+                #expect(res.status == .ok)
+                let page = try res.content.decode(PagedResponse<VolumeMigrationResponse>.self)
+                #expect(page.items.map(\.id) == [response.id])
+                #expect(page.items.first?.status == .failed)
+            }
+        }
+    }
+
+    @Test("moving into a pool the current agent belongs to switches the pool without moving bytes")
+    func poolSwitchInPlace() async throws {
+        try await withMigrationApp { fixture in
+            let db = fixture.app.db
+            let pool = StoragePool(
+                name: "fast", mode: .local, memberAgentIds: [fixture.source.id!.uuidString], backing: .filesystem)
+            try await pool.save(on: db)
+
+            var accepted: VolumeMigrationResponse?
+            try await migrate(fixture, MigrateVolumeRequest(targetAgentId: nil, targetPoolId: pool.id, volumeTypeId: nil)) {
+                res in
+                #expect(res.status == .accepted)
+                accepted = try res.content.decode(VolumeMigrationResponse.self)
+            }
+            let response = try #require(accepted)
+            #expect(response.targetAgentId == response.sourceAgentId)
+
+            let migration = try await settled(try #require(response.id), on: db)
+            #expect(migration.status == .succeeded)
+            let volume = try #require(try await Volume.find(fixture.volume.id, on: db))
+            #expect(volume.status == .available)
+            #expect(volume.$pool.id == pool.id)
+            #expect(volume.hypervisorId == fixture.source.id?.uuidString)
+        }
+    }
+
+    @Test("the data route is for agents only")
+    func dataRouteRequiresAgentCertificate() async throws {
+        try await withMigrationApp { fixture in
+            let path = VolumeMigration.dataTransferPath(volumeId: fixture.volume.id!, migrationId: UUID())
+            try await fixture.app.test(.GET, path) { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: fixture.adminToken)
+            } afterResponse: { res in
+                #expect(res.status == .unauthorized)
+            }
+        }
+    }
+}
@@ -5,7 +5,7 @@ import Testing
 @Suite("Volume Status Tests")
 struct VolumeStatusTests {
 
-    @Test("canDelete allows every state except attached", arguments: VolumeStatus.allCases)
+    @Test("canDelete allows every state except attached and migrating", arguments: VolumeStatus.allCases)
     func testCanDelete(status: VolumeStatus) {
         let volume = Volume()
         volume.status = status
@@ -13,8 +13,9 @@ struct VolumeStatusTests {
         // Only an actively attached volume is undeletable. `.deleting` stays
         // deletable (agent-side directory removal is idempotent) and issue #644
         // extends the same escape hatch to every other transitional state so a
-        // crash mid-operation can't strand a volume with no recovery.
-        let expected = status != .attached
+        // crash mid-operation can't strand a volume with no recovery. A
+        // migration holds copies on two agents, so it waits for the sweep.
+        let expected = status != .attached && status != .migrating
         #expect(volume.canDelete == expected)
     }
 }
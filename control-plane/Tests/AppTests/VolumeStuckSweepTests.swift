@@ -140,6 +140,58 @@ final class VolumeStuckSweepTests {
         }
     }
 
+    @Test("A stuck detached .migrating volume is recovered to .available and its migration failed")
+    func sweepReturnsDetachedMigrationToAvailable() async throws {
+        try await withVolumeTestApp { app, user, project in
+            // A copy never touches the source before the replica switch, so
+            // the volume is whole where it was.
+            let volume = try await makeVolume(
+                status: .migrating, ageSeconds: 50_000, on: app, user: user, project: project)
+            let migration = VolumeMigration(
+                volumeID: volume.id!, mode: .copy, sourceAgentId: "agent-a", targetAgentId: "agent-b",
+                sourcePoolId: nil, targetPoolId: nil, targetVolumeTypeId: nil, createdByID: user.id!)
+            try await migration.create(on: app.db)
+
+            await app.agentService.sweepStuckOperations()
+
+            let swept = try await Volume.find(volume.id, on: app.db)
+            #expect(swept?.status == .available)
+            let failed = try await VolumeMigration.find(migration.id, on: app.db)
+            #expect(failed?.status == .failed)
+            #expect(failed?.completedAt != nil)
+        }
+    }
+
+    @Test("A stuck attached .migrating volume is recovered to .error")
+    func sweepErrorsAttachedMigration() async throws {
+        try await withVolumeTestApp { app, user, project in
+            // Mid-mirror the guest may already be on the destination's copy.
+            let builder = TestDataBuilder(db: app.db)
+            let vm = try await builder.createVM(name: "mirror-vm", project: project)
+            let volume = try await makeVolume(
+                status: .migrating, ageSeconds: 50_000, vmID: vm.id, on: app, user: user, project: project)
+
+            await app.agentService.sweepStuckOperations()
+
+            let swept = try await Volume.find(volume.id, on: app.db)
+            #expect(swept?.status == .error)
+            #expect(swept?.errorMessage?.contains("either copy") == true)
+        }
+    }
+
+    @Test("A .migrating volume is left alone for hours: a large copy is still in flight")
+    func sweepRespectsMigrationBudget() async throws {
+        try await withVolumeTestApp { app, user, project in
+            let volume = try await makeVolume(
+                status: .migrating, ageSeconds: 3600, on: app, user: user, project: project)
+
+            await app.agentService.sweepStuckOperations()
+
+            let swept = try await Volume.find(volume.id, on: app.db)
+            #expect(swept?.status == .migrating)
+        }
+    }
+
     // MARK: - The sweep leaves live and resting volumes alone
 
     @Test("A fresh transitional volume within budget is left alone")
@@ -186,4 +238,29 @@ final class VolumeStuckSweepTests {
             #expect(swept?.status == .deleting)
         }
     }
+
+    @Test("A stuck attachment row on a shared volume others still hold settles as .attached")
+    func sweepSettlesStuckSharedAttachment() async throws {
+        try await withVolumeTestApp { app, user, project in
+            let builder = TestDataBuilder(db: app.db)
+            let vm = try await builder.createVM(name: "shared-holder", project: project)
+            let volume = try await makeVolume(
+                status: .attached, ageSeconds: 0, vmID: vm.id, on: app, user: user, project: project)
+            let attachment = VolumeAttachment(
+                volumeID: volume.id!, vmID: vm.id!, agentId: nil, deviceName: "vdb", status: .detaching)
+            try await attachment.save(on: app.db)
+
+            let sql = try #require(app.db as? any SQLDatabase)
+            let past = Date().addingTimeInterval(-1000)
+            try await sql.raw(
+                "UPDATE volume_attachments SET updated_at = \(bind: past) WHERE id = \(bind: attachment.id!)"
+            ).run()
+
+            await app.agentService.sweepStuckOperations()
+
+            let swept = try await VolumeAttachment.find(attachment.id, on: app.db)
+            #expect(swept?.status == .attached)
+            #expect(try await Volume.find(volume.id, on: app.db)?.status == .attached)
+        }
+    }
 }
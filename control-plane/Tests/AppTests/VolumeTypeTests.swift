@@ -0,0 +1,271 @@
+import Fluent
+import Foundation
+import Testing
+import Vapor
+import VaporTesting
+
+@testable import App
+
+/// Volume types: admin-defined storage classes over storage pools. Covers the
+/// pure validation and quota arithmetic, the admin-only catalog API, quota
+/// enforcement on create, and in-place retype.
+@Suite("Volume Type Tests", .serialized)
+struct VolumeTypeTests {
+
+    // MARK: - Validation (pure logic)
+
+    private func makePool(mode: StoragePoolMode, factor: Int = 1, members: [String] = []) -> StoragePool {
+        StoragePool(
+            name: "test", mode: mode, replicationFactor: factor, memberAgentIds: members, backing: .filesystem)
+    }
+
+    @Test("a local pool only admits a replication factor of 1")
+    func localPoolReplication() {
+        let pool = makePool(mode: .local)
+
+        #expect(
+            VolumeTypeDefinition.validationFailure(
+                pool: pool, replicationFactor: 1, maxIOPS: nil, maxBytesPerSecond: nil) == nil)
+        #expect(
+            VolumeTypeDefinition.validationFailure(
+                pool: pool, replicationFactor: 2, maxIOPS: nil, maxBytesPerSecond: nil) != nil)
+    }
+
+    @Test("a replicated pool bounds the factor between 2 and its own factor")
+    func replicatedPoolReplication() {
+        let pool = makePool(mode: .replicated, factor: 3)
+
+        #expect(
+            VolumeTypeDefinition.validationFailure(
+                pool: pool, replicationFactor: 1, maxIOPS: nil, maxBytesPerSecond: nil) != nil)
+        #expect(
+            VolumeTypeDefinition.validationFailure(
+                pool: pool, replicationFactor: 3, maxIOPS: nil, maxBytesPerSecond: nil) == nil)
+        #expect(
+            VolumeTypeDefinition.validationFailure(
+                pool: pool, replicationFactor: 4, maxIOPS: nil, maxBytesPerSecond: nil) != nil)
+    }
+
+    @Test("QoS limits must be positive, and unset limits mean no QoS")
+    func qosLimits() {
+        let pool = makePool(mode: .local)
+        #expect(
+            VolumeTypeDefinition.validationFailure(
+                pool: pool, replicationFactor: 1, maxIOPS: 0, maxBytesPerSecond: nil) != nil)
+        #expect(
+            VolumeTypeDefinition.validationFailure(
+                pool: pool, replicationFactor: 1, maxIOPS: nil, maxBytesPerSecond: -1) != nil)
+
+        let unlimited = VolumeTypeDefinition(name: "std", poolID: UUID())
+        #expect(unlimited.qos == nil)
+        let limited = VolumeTypeDefinition(name: "slow", poolID: UUID(), maxIOPS: 500)
+        #expect(limited.qos?.maxIOPS == 500)
+        #expect(limited.qos?.maxBytesPerSecond == nil)
+    }
+
+    @Test("an agent qualifies through pool membership and, when required, encrypted storage")
+    func agentQualification() {
+        let pool = makePool(mode: .local, members: ["agent-a"])
+
+        #expect(
+            VolumeTypeDefinition.agentQualifies(
+                agentId: "agent-a", capabilities: [], pool: pool, requiresEncryption: false))
+        #expect(
+            !VolumeTypeDefinition.agentQualifies(
+                agentId: "agent-b", capabilities: [], pool: pool, requiresEncryption: false))
+        #expect(
+            !VolumeTypeDefinition.agentQualifies(
+                agentId: "agent-a", capabilities: [], pool: pool, requiresEncryption: true))
+        #expect(
+            VolumeTypeDefinition.agentQualifies(
+                agentId: "agent-a", capabilities: ["encrypted_volume_storage"], pool: pool,
+                requiresEncryption: true))
+    }
+
+    // MARK: - Quota arithmetic (pure logic)
+
+    @Test("a quota refuses the volume or the bytes that would exceed it")
+    func quotaExceededReason() {
+        let quota = VolumeTypeQuota(
+            volumeTypeID: UUID(), projectID: UUID(), maxVolumes: 2, maxStorageBytes: 100)
+
+        #expect(quota.exceededReason(currentVolumes: 1, currentBytes: 50, addingVolume: true, addingBytes: 50) == nil)
+        #expect(quota.exceededReason(currentVolumes: 2, currentBytes: 50, addingVolume: true, addingBytes: 1) != nil)
+        #expect(quota.exceededReason(currentVolumes: 1, currentBytes: 50, addingVolume: false, addingBytes: 51) != nil)
+        // Growth of an existing volume doesn't count against the volume cap.
+        #expect(quota.exceededReason(currentVolumes: 2, currentBytes: 50, addingVolume: false, addingBytes: 10) == nil)
+        // Overflowing the byte sum is an exceed, not a wrap-around.
+        #expect(
+            quota.exceededReason(currentVolumes: 0, currentBytes: .max, addingVolume: false, addingBytes: 1) != nil)
+    }
+
+    // MARK: - API
+
+    private struct Fixture {
+        let app: Application
+        let adminToken: String
+        let userToken: String
+        let user: User
+        let project: Project
+    }
+
+    private func withVolumeTypeApp(_ test: (Fixture) async throws -> Void) async throws {
+        try await withTestApp { app in
+            let builder = TestDataBuilder(db: app.db)
+            let admin = try await builder.createUser(
+                username: "vt-admin", email: "vt-admin@example.com", isSystemAdmin: true)
+            let user = try await builder.createUser(username: "vt-user", email: "vt-user@example.com")
+            let org = try await builder.createOrganization(name: "Volume Type Org")
+            try await builder.addUserToOrganization(user: user, organization: org, role: "admin")
+            user.currentOrganizationId = org.id
+            try await user.save(on: app.db)
+            let project = try await builder.createProject(
+                name: "Volume Type Project", description: "volume types", organization: org)
+
+            try await test(
+                Fixture(
+                    app: app,
+                    adminToken: try await admin.generateAPIKey(on: app.db),
+                    userToken: try await user.generateAPIKey(on: app.db),
+                    user: user,
+                    project: project
+                ))
+        }
+    }
+
+    private func createType(
+        _ fixture: Fixture, name: String, poolId: UUID? = nil
+    ) async throws -> VolumeTypeResponse {
+        var created: VolumeTypeResponse?
+        try await fixture.app.test(.POST, "/api/volume-types") { req in
+            req.headers.bearerAuthorization = BearerAuthorization(token: fixture.adminToken)
+            try req.content.encode(
+                CreateVolumeTypeRequest(
+                    name: name, description: nil, poolId: poolId, defaultFormat: "raw",
+                    replicationFactor: nil, maxIOPS: 1000, maxBytesPerSecond: nil, requiresEncryption: nil))
+        } afterResponse: { res in
+            #expect(res.status == .ok)
+            created = try res.content.decode(VolumeTypeResponse.self)
+        }
+        return try #require(created)
+    }
+
+    @Test("only system admins define volume types; everyone may list them")
+    func catalogIsAdminManaged() async throws {
+        try await withVolumeTypeApp { fixture in
+            try await fixture.app.test(.POST, "/api/volume-types") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: fixture.userToken)
+                try req.content.encode(
+                    CreateVolumeTypeRequest(
+                        name: "sneaky", description: nil, poolId: nil, defaultFormat: nil,
+                        replicationFactor: nil, maxIOPS: nil, maxBytesPerSecond: nil, requiresEncryption: nil))
+            } afterResponse: { res in
+                #expect(res.status == .forbidden)
+            }
+
+            let created = try await createType(fixture, name: "fast")
+            #expect(created.defaultFormat == .raw)
+            #expect(created.maxIOPS == 1000)
+
+            try await fixture.app.test(.GET, "/api/volume-types") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: fixture.userToken)
+            } afterResponse: { res in
+                #expect(res.status == .ok)
+                let page = try res.content.decode(PagedResponse<VolumeTypeResponse>.self)
+                #expect(page.items.map(\.name) == ["fast"])
+            }
+        }
+    }
+
+    @Test("a typed volume takes its type's pool and format, within the type's quota")
+    func createHonorsTypeAndQuota() async throws {
+        try await withVolumeTypeApp { fixture in
+            let volumeType = try await createType(fixture, name: "quota-limited")
+            let projectId = try fixture.project.requireID()
+
+            try await fixture.app.test(.PUT, "/api/volume-types/\(volumeType.id)/quotas/\(projectId)") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: fixture.userToken)
+                try req.content.encode(SetVolumeTypeQuotaRequest(maxVolumes: 0, maxStorageGB: nil))
+            } afterResponse: { res in
+                #expect(res.status == .ok)
+            }
+
+            let body = CreateVolumeRequest(
+                name: "typed", description: nil, projectId: projectId, sizeGB: 1, format: nil,
+                volumeType: nil, sourceImageId: nil, volumeTypeId: volumeType.id, multiAttach: nil)
+            try await fixture.app.test(.POST, "/api/volumes") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: fixture.userToken)
+                try req.content.encode(body)
+            } afterResponse: { res in
+                #expect(res.status == .forbidden)
+                #expect(res.body.string.contains("quota-limited"))
+            }
+            #expect(try await Volume.query(on: fixture.app.db).count() == 0)
+
+            // Lifting the quota admits the volume, with the type's settings.
+            try await fixture.app.test(.DELETE, "/api/volume-types/\(volumeType.id)/quotas/\(projectId)") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: fixture.userToken)
+            } afterResponse: { res in
+                #expect(res.status == .noContent)
+            }
+            try await fixture.app.test(.POST, "/api/volumes") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: fixture.userToken)
+                try req.content.encode(body)
+            } afterResponse: { res in
+                #expect(res.status == .ok)
+                let volume = try res.content.decode(VolumeResponse.self)
+                #expect(volume.volumeTypeId == volumeType.id)
+                #expect(volume.poolId == volumeType.poolId)
+                #expect(volume.format == .raw)
+            }
+
+            // Provisioning runs detached; let it settle (no agents → `.error`)
+            // before teardown.
+            for _ in 0..<100 {
+                if try await Volume.query(on: fixture.app.db).first()?.status == .error { break }
+                try await Task.sleep(for: .milliseconds(50))
+            }
+        }
+    }
+
+    @Test("retype is in place when the volume's agent qualifies, and refused when the data must move")
+    func retypeInPlace() async throws {
+        try await withVolumeTypeApp { fixture in
+            let db = fixture.app.db
+            let open = try await createType(fixture, name: "open")
+            let restrictedPool = StoragePool(
+                name: "restricted", mode: .local, memberAgentIds: ["some-other-agent"], backing: .filesystem)
+            try await restrictedPool.save(on: db)
+            let restricted = try await createType(fixture, name: "restricted", poolId: restrictedPool.id)
+
+            let defaultPool = try await StoragePool.defaultPool(on: db)
+            let volume = Volume(
+                name: "to-retype", description: "retype target", projectID: try fixture.project.requireID(), size: 1_073_741_824,
+                format: .qcow2, volumeType: .data, status: .available,
+                createdByID: try fixture.user.requireID(), poolID: defaultPool.id)
+            volume.hypervisorId = "agent-holding-it"
+            volume.storagePath = "/var/lib/strato/volumes/to-retype.qcow2"
+            try await volume.save(on: db)
+            try await RoleBindingService.grant(
+                principalType: .user, principalID: try fixture.user.requireID(), role: .admin,
+                nodeType: .volume, nodeID: try volume.requireID(), createdBy: fixture.user.id, on: db)
+
+            try await fixture.app.test(.POST, "/api/volumes/\(volume.id!)/retype") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: fixture.userToken)
+                try req.content.encode(RetypeVolumeRequest(volumeTypeId: restricted.id))
+            } afterResponse: { res in
+                #expect(res.status == .conflict)
+            }
+
+            try await fixture.app.test(.POST, "/api/volumes/\(volume.id!)/retype") { req in
+                req.headers.bearerAuthorization = BearerAuthorization(token: fixture.userToken)
+                try req.content.encode(RetypeVolumeRequest(volumeTypeId: open.id))
+            } afterResponse: { res in
+                #expect(res.status == .ok)
+                let retyped = try res.content.decode(VolumeResponse.self)
+                #expect(retyped.volumeTypeId == open.id)
+                #expect(retyped.format == .qcow2)
+            }
+        }
+    }
+}
@@ -1,7 +1,7 @@
 "use client";
 
 import { useMemo, useState } from "react";
-import { ChevronLeft, ChevronRight, ShieldAlert, X } from "lucide-react";
+import { ChevronLeft, ChevronRight, Search, ShieldAlert, X } from "lucide-react";
 import { Badge } from "@/components/ui/badge";
 import { Button } from "@/components/ui/button";
 import { Card, CardContent, CardHeader, CardTitle } from "@/components/ui/card";
@@ -16,7 +16,12 @@ import {
 } from "@/components/ui/select";
 import { Skeleton } from "@/components/ui/skeleton";
 import { AuditEventTable } from "@/components/audit/audit-event-table";
-import { auditErrorMessage, useAuditEvents } from "@/lib/hooks/use-audit-events";
+import { AuditQueryGroups } from "@/components/audit/audit-query-groups";
+import {
+  auditErrorMessage,
+  useAuditEvents,
+  useAuditQuery,
+} from "@/lib/hooks/use-audit-events";
 import { useAuth } from "@/providers";
 
 const PAGE_SIZE = 50;
@@ -30,10 +35,14 @@ const EVENT_TYPES = [
   { value: "auth.register", label: "Registration" },
   { value: "auth.oidc_login", label: "OIDC login" },
   { value: "auth.oidc_login_failed", label: "OIDC login failed" },
+  { value: "auth.domain_auto_join", label: "Domain auto-join" },
+  { value: "auth.domain_account_claimed", label: "Domain account claimed" },
 ];
 
 const ALL_EVENT_TYPES = "all";
 
+const QUERY_EXAMPLE = 'actor.type == "service_account" and time > -24h | count by actor';
+
 /** datetime-local input value → ISO8601 UTC for the API, or undefined. */
 function toISO(local: string): string | undefined {
   if (!local) return undefined;
@@ -52,6 +61,11 @@ export default function AdminAuditPage() {
   const [userID, setUserID] = useState<string | undefined>(undefined);
   const [offset, setOffset] = useState(0);
 
+  // The query card runs what was last submitted, not every keystroke.
+  const [queryInput, setQueryInput] = useState("");
+  const [submittedQuery, setSubmittedQuery] = useState<string | undefined>(undefined);
+  const [queryOffset, setQueryOffset] = useState(0);
+
   const filters = useMemo(
     () => ({
       eventType: eventType === ALL_EVENT_TYPES ? undefined : eventType,
@@ -70,6 +84,23 @@ export default function AdminAuditPage() {
     isSystemAdmin
   );
 
+  const queryPage = useMemo(
+    () => ({ limit: PAGE_SIZE, offset: queryOffset }),
+    [queryOffset]
+  );
+  const {
+    data: queryResult,
+    isLoading: isQueryLoading,
+    isPlaceholderData: isQueryPlaceholder,
+    error: queryError,
+  } = useAuditQuery(submittedQuery, queryPage, isSystemAdmin);
+  const queryRows = queryResult?.groups?.length ?? queryResult?.events?.length ?? 0;
+
+  const runQuery = () => {
+    setSubmittedQuery(queryInput.trim());
+    setQueryOffset(0);
+  };
+
   const events = data?.events ?? [];
   const total = data?.total ?? 0;
   const hasFilters =
@@ -116,6 +147,99 @@ export default function AdminAuditPage() {
         </p>
       </div>
 
+      <Card className="bg-card border-border">
+        <CardHeader>
+          <CardTitle className="text-lg font-semibold text-foreground">
+            Query
+          </CardTitle>
+        </CardHeader>
+        <CardContent className="space-y-4">
+          <form
+            className="flex items-center gap-3"
+            onSubmit={(e) => {
+              e.preventDefault();
+              runQuery();
+            }}
+          >
+            <Input
+              aria-label="Audit query"
+              value={queryInput}
+              onChange={(e) => setQueryInput(e.target.value)}
+              placeholder={QUERY_EXAMPLE}
+              className="flex-1 font-mono text-sm bg-background border-border text-foreground"
+            />
+            <Button type="submit">
+              <Search className="h-4 w-4" />
+              Run
+            </Button>
+            {submittedQuery !== undefined && (
+              <Button
+                type="button"
+                variant="ghost"
+                className="text-muted-foreground hover:text-foreground"
+                onClick={() => {
+                  setQueryInput("");
+                  setSubmittedQuery(undefined);
+                }}
+              >
+                Clear
+              </Button>
+            )}
+          </form>
+
+          {submittedQuery === undefined ? (
+            <p className="text-sm text-muted-foreground">
+              Filter on fields like <code>type</code>, <code>actor.type</code>,{" "}
+              <code>status</code> and <code>time</code>, and add{" "}
+              <code>| count by &lt;field&gt;</code> to aggregate.
+            </p>
+          ) : queryError ? (
+            <div className="text-center py-8 text-red-600">
+              {auditErrorMessage(queryError, "Failed to run the query")}
+            </div>
+          ) : isQueryLoading || !queryResult ? (
+            <Skeleton className="h-32 w-full bg-muted" />
+          ) : queryResult.groups ? (
+            <AuditQueryGroups
+              groupBy={queryResult.groupBy ?? []}
+              groups={queryResult.groups}
+            />
+          ) : (
+            <AuditEventTable events={queryResult.events ?? []} />
+          )}
+
+          {queryResult && queryResult.total > 0 && submittedQuery !== undefined && (
+            <div className="flex items-center justify-between pt-2">
+              <p className="text-sm text-muted-foreground">
+                {queryResult.total.toLocaleString()} matching events
+              </p>
+              <div className="flex items-center gap-2">
+                <Button
+                  variant="outline"
+                  size="sm"
+                  className="border-input text-foreground"
+                  disabled={queryOffset === 0 || isQueryPlaceholder}
+                  onClick={() => setQueryOffset(Math.max(0, queryOffset - PAGE_SIZE))}
+                >
+                  <ChevronLeft className="h-4 w-4" />
+                  Previous
+                </Button>
+                <Button
+                  variant="outline"
+                  size="sm"
+                  className="border-input text-foreground"
+                  disabled={queryRows < PAGE_SIZE || isQueryPlaceholder}
+                  onClick={() => setQueryOffset(queryOffset + PAGE_SIZE)}
+                >
+                  Next
+                  <ChevronRight className="h-4 w-4" />
+                </Button>
+              </div>
+            </div>
+          )}
+        </CardContent>
+      </Card>
+
       <Card className="bg-card border-border">
         <CardHeader>
           <CardTitle className="text-lg font-semibold text-foreground">
@@ -15,6 +15,7 @@ import { organizationsApi } from "@/lib/api/organizations";
 import { usePermissions } from "@/lib/hooks";
 import { SCIMTokensSection } from "@/components/scim-tokens";
 import { OIDCProvidersSection } from "@/components/oidc-providers";
+import { OrganizationDomainsSection } from "@/components/organization-domains";
 import { SSFStreamsSection } from "@/components/ssf-streams";
 import { useOrganization } from "@/providers";
 import { toast } from "sonner";
@@ -217,8 +218,9 @@ export default function OrganizationSettingsPage() {
         </TabsContent>
 
         {/* OIDC Tab */}
-        <TabsContent value="oidc">
+        <TabsContent value="oidc" className="space-y-6">
           <OIDCProvidersSection orgId={id} canManage={canManageMembers} />
+          <OrganizationDomainsSection orgId={id} canManage={canManageMembers} />
         </TabsContent>
 
         {/* SCIM Tab */}
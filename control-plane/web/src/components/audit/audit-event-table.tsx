@@ -40,6 +40,18 @@ function formatTimestamp(value?: string): string {
   });
 }
 
+/** Who acted when no user did: a service account, or nobody signed in. */
+function actorLabel(event: AuditEvent): string | undefined {
+  switch (event.actorType) {
+    case "service_account":
+      return event.actorID ? `service account ${event.actorID.slice(0, 8)}…` : "service account";
+    case "anonymous":
+      return "anonymous";
+    default:
+      return undefined;
+  }
+}
+
 /** "vm 4f2a…" when the event names a resource, otherwise the request line. */
 function resourceLabel(event: AuditEvent): { text: string; title?: string } {
   if (event.resourceType) {
@@ -109,7 +121,7 @@ export function AuditEventTable({
       <TableBody className="divide-y divide-border">
         {events.map((event) => {
           const resource = resourceLabel(event);
-          const actor = event.username ?? event.userID;
+          const actor = event.username ?? event.userID ?? actorLabel(event);
           return (
             <TableRow key={event.id} className="border-border hover:bg-accent/60">
               <TableCell className="text-muted-foreground text-sm whitespace-nowrap">
@@ -0,0 +1,59 @@
+"use client";
+
+import {
+  Table,
+  TableBody,
+  TableCell,
+  TableHead,
+  TableHeader,
+  TableRow,
+} from "@/components/ui/table";
+import type { AuditQueryGroup } from "@/types/api";
+
+interface AuditQueryGroupsProps {
+  /** The fields the query counted by, in order; empty for a bare `count`. */
+  groupBy: string[];
+  groups: AuditQueryGroup[];
+}
+
+/** The result of a `| count by …` audit query: one row per group. */
+export function AuditQueryGroups({ groupBy, groups }: AuditQueryGroupsProps) {
+  if (groups.length === 0) {
+    return (
+      <div className="text-center py-8 text-muted-foreground">
+        No audit events match the query.
+      </div>
+    );
+  }
+
+  return (
+    <Table>
+      <TableHeader className="bg-background">
+        <TableRow className="border-border hover:bg-transparent">
+          {groupBy.map((field) => (
+            <TableHead key={field} className="text-muted-foreground font-medium font-mono">
+              {field}
+            </TableHead>
+          ))}
+          <TableHead className="text-muted-foreground font-medium text-right">
+            Events
+          </TableHead>
+        </TableRow>
+      </TableHeader>
+      <TableBody className="divide-y divide-border">
+        {groups.map((group, index) => (
+          <TableRow key={index} className="border-border hover:bg-accent/60">
+            {groupBy.map((field) => (
+              <TableCell key={field} className="text-foreground/80 text-sm font-mono">
+                {group.key[field] ?? <span className="text-muted-foreground">—</span>}
+              </TableCell>
+            ))}
+            <TableCell className="text-foreground text-sm text-right tabular-nums">
+              {group.count.toLocaleString()}
+            </TableCell>
+          </TableRow>
+        ))}
+      </TableBody>
+    </Table>
+  );
+}
@@ -1,6 +1,6 @@
 "use client";
 
-import { useState } from "react";
+import { useEffect, useState } from "react";
 import { useRouter, useSearchParams } from "next/navigation";
 import Link from "next/link";
 import { Building2, KeyRound, Loader2 } from "lucide-react";
@@ -17,7 +17,8 @@ import {
 } from "@/components/ui/card";
 import { useAuth } from "@/providers";
 import { oidcProvidersApi } from "@/lib/api/oidc-providers";
-import type { PublicOIDCProvider } from "@/types/api";
+import { webAuthnClient } from "@/lib/webauthn/client";
+import type { DomainClaim, PublicOIDCProvider } from "@/types/api";
 import { toast } from "sonner";
 
 export function LoginForm() {
@@ -27,6 +28,7 @@ export function LoginForm() {
   const router = useRouter();
   const searchParams = useSearchParams();
   const ssoFailed = searchParams.get("error") === "oidc_failed";
+  const claimPending = searchParams.get("domain_claim") === "pending";
 
   // SSO discovery state: hidden → org-name input → provider buttons
   const [ssoOpen, setSsoOpen] = useState(false);
@@ -35,6 +37,42 @@ export function LoginForm() {
   const [ssoProviders, setSsoProviders] = useState<PublicOIDCProvider[]>([]);
   const [ssoOrgId, setSsoOrgId] = useState<string | null>(null);
 
+  // An SSO sign-in parked until the user consents to their organization's
+  // verified domain taking over their existing account.
+  const [domainClaim, setDomainClaim] = useState<DomainClaim | null>(null);
+  const [claimLoading, setClaimLoading] = useState(false);
+
+  useEffect(() => {
+    if (!claimPending) return;
+    oidcProvidersApi
+      .domainClaim()
+      .then(setDomainClaim)
+      .catch(() => {
+        toast.error("The sign-in request expired. Please sign in with SSO again.");
+        router.replace("/login");
+      });
+  }, [claimPending, router]);
+
+  const handleClaim = async (accept: boolean) => {
+    setClaimLoading(true);
+    try {
+      if (accept) {
+        await webAuthnClient.confirmDomainClaim();
+        // The session cookie is set; a full load picks it up.
+        window.location.assign("/");
+      } else {
+        await oidcProvidersApi.declineDomainClaim();
+        setDomainClaim(null);
+        router.replace("/login");
+      }
+    } catch (error) {
+      toast.error(
+        error instanceof Error ? error.message : "Could not complete sign-in"
+      );
+      setClaimLoading(false);
+    }
+  };
+
   const handleSubmit = async (e: React.FormEvent) => {
     e.preventDefault();
 
@@ -78,7 +116,7 @@ export function LoginForm() {
 
     const orgName = ssoOrgName.trim();
     if (!orgName) {
-      toast.error("Please enter your organization name");
+      toast.error("Please enter your organization name or email");
       return;
     }
 
@@ -118,6 +156,55 @@ export function LoginForm() {
     window.location.assign(oidcProvidersApi.authorizeUrl(ssoOrgId, provider.id));
   };
 
+  if (domainClaim) {
+    return (
+      <Card className="w-full max-w-md bg-card border-border">
+        <CardHeader className="space-y-1">
+          <CardTitle className="text-2xl font-bold text-foreground">
+            Join {domainClaim.organizationName}?
+          </CardTitle>
+          <CardDescription className="text-muted-foreground">
+            {domainClaim.organizationName} has verified that it owns{" "}
+            {domainClaim.domain}.
+          </CardDescription>
+        </CardHeader>
+        <CardContent className="space-y-4 text-sm text-foreground">
+          <p>
+            Your existing account <strong>{domainClaim.username}</strong> (
+            {domainClaim.email}) will join the organization and from now on
+            sign in through its single sign-on. Your other organizations and
+            resources are not affected.
+          </p>
+          <p className="text-muted-foreground">
+            Confirm with a passkey for {domainClaim.username} to continue.
+          </p>
+          <div className="flex gap-2">
+            <Button
+              type="button"
+              className="flex-1 bg-primary hover:bg-primary/90"
+              onClick={() => handleClaim(true)}
+              disabled={claimLoading}
+            >
+              {claimLoading ? (
+                <Loader2 className="h-4 w-4 mr-2 animate-spin" />
+              ) : null}
+              Continue
+            </Button>
+            <Button
+              type="button"
+              variant="outline"
+              className="flex-1 border-input"
+              onClick={() => handleClaim(false)}
+              disabled={claimLoading}
+            >
+              Not now
+            </Button>
+          </div>
+        </CardContent>
+      </Card>
+    );
+  }
+
   return (
     <Card className="w-full max-w-md bg-card border-border">
       <CardHeader className="space-y-1">
@@ -251,12 +338,12 @@ export function LoginForm() {
           <form onSubmit={handleSsoLookup} className="space-y-4">
             <div className="space-y-2">
               <Label htmlFor="ssoOrganization" className="text-foreground">
-                Organization
+                Organization or email
               </Label>
               <Input
                 id="ssoOrganization"
                 type="text"
-                placeholder="Enter your organization name"
+                placeholder="Enter your organization name or work email"
                 value={ssoOrgName}
                 onChange={(e) => setSsoOrgName(e.target.value)}
                 className="bg-background border-border text-foreground placeholder:text-muted-foreground"
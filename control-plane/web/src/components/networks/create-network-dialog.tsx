@@ -69,11 +69,17 @@ export function CreateNetworkDialog({
       return;
     }
 
+    // An empty subnet with IPv6 on asks for an IPv6-only network.
     const subnet = formData.subnet.trim();
-    if (!CIDR_PATTERN.test(subnet)) {
+    const gateway = formData.gateway.trim();
+    if (subnet ? !CIDR_PATTERN.test(subnet) : !ipv6Enabled) {
       toast.error("Subnet must be in CIDR notation, e.g. 10.0.0.0/24");
       return;
     }
+    if (!subnet && gateway) {
+      toast.error("A gateway needs an IPv4 subnet");
+      return;
+    }
 
     const subnet6 = formData.subnet6.trim();
     if (ipv6Enabled && subnet6 && !CIDR6_PATTERN.test(subnet6)) {
@@ -85,8 +91,8 @@ export function CreateNetworkDialog({
     try {
       await networksApi.create({
         name,
-        subnet,
-        gateway: formData.gateway.trim() || undefined,
+        subnet: subnet || undefined,
+        gateway: gateway || undefined,
         // Omitted subnet6 with IPv6 enabled → the server generates a ULA /64.
         subnet6: ipv6Enabled && subnet6 ? subnet6 : undefined,
         ipv6Enabled: ipv6Enabled ? undefined : false,
@@ -150,7 +156,8 @@ export function CreateNetworkDialog({
                 disabled={isLoading}
               />
               <p className="text-xs text-muted-foreground">
-                Prefix must be between /8 and /30.
+                Prefix must be between /8 and /30. Leave empty, with IPv6 on,
+                for an IPv6-only network; it cannot reach IPv4-only hosts.
               </p>
             </div>
             <div className="space-y-2">
@@ -111,28 +111,30 @@ function EditNetworkForm({
       <DialogHeader>
         <DialogTitle>Edit {network.name}</DialogTitle>
         <DialogDescription className="text-muted-foreground">
-          Update the gateway and DHCP configuration. Subnet {network.subnet} is
-          fixed here.
+          Update the gateway and DHCP configuration. Subnet{" "}
+          {network.subnet ?? network.subnet6} is fixed here.
         </DialogDescription>
       </DialogHeader>
       <form onSubmit={handleSubmit}>
         <div className="space-y-4 py-4">
-          <div className="space-y-2">
-            <Label htmlFor="editGateway" className="text-foreground">
-              Gateway
-            </Label>
-            <Input
-              id="editGateway"
-              placeholder="10.0.0.1"
-              value={gateway}
-              onChange={(e) => setGateway(e.target.value)}
-              className="bg-background border-border text-foreground font-mono"
-              disabled={isLoading}
-            />
-            <p className="text-xs text-muted-foreground">
-              Changing the gateway only affects VMs created afterward.
-            </p>
-          </div>
+          {network.subnet && (
+            <div className="space-y-2">
+              <Label htmlFor="editGateway" className="text-foreground">
+                Gateway
+              </Label>
+              <Input
+                id="editGateway"
+                placeholder="10.0.0.1"
+                value={gateway}
+                onChange={(e) => setGateway(e.target.value)}
+                className="bg-background border-border text-foreground font-mono"
+                disabled={isLoading}
+              />
+              <p className="text-xs text-muted-foreground">
+                Changing the gateway only affects VMs created afterward.
+              </p>
+            </div>
+          )}
           {network.subnet6 ? (
             <div className="space-y-2">
               <Label className="text-foreground">IPv6 subnet</Label>
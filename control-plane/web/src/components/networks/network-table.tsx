@@ -112,8 +112,9 @@ export function NetworkTable({
                 )}
               </TableCell>
               <TableCell className="text-foreground/80 font-mono text-sm">
-                <div>{network.subnet}</div>
-                {network.subnet6 && (
+                {/* An IPv6-only network shows its /64 in the primary line. */}
+                <div>{network.subnet ?? network.subnet6}</div>
+                {network.subnet && network.subnet6 && (
                   <div className="text-xs text-muted-foreground">
                     {network.subnet6}
                   </div>
@@ -0,0 +1,2 @@
+export { OrganizationDomainsSection } from "./organization-domains-section";
+export { OrganizationDomainDialog } from "./organization-domain-dialog";
@@ -0,0 +1,230 @@
+"use client";
+
+import { useState } from "react";
+import { Loader2 } from "lucide-react";
+import { Button } from "@/components/ui/button";
+import {
+  Dialog,
+  DialogContent,
+  DialogDescription,
+  DialogFooter,
+  DialogHeader,
+  DialogTitle,
+} from "@/components/ui/dialog";
+import { Input } from "@/components/ui/input";
+import { Label } from "@/components/ui/label";
+import {
+  useCreateOrganizationDomain,
+  useUpdateOrganizationDomain,
+  organizationDomainErrorMessage,
+} from "@/lib/hooks/use-organization-domains";
+import { toast } from "sonner";
+import type { OrganizationDomain } from "@/types/api";
+
+interface OrganizationDomainDialogProps {
+  orgId: string;
+  open: boolean;
+  onOpenChange: (open: boolean) => void;
+  /** When set, the dialog edits this domain's sign-in settings. */
+  domain?: OrganizationDomain | null;
+}
+
+export function OrganizationDomainDialog({
+  orgId,
+  open,
+  onOpenChange,
+  domain,
+}: OrganizationDomainDialogProps) {
+  return (
+    <Dialog open={open} onOpenChange={onOpenChange}>
+      <DialogContent className="bg-card border-border text-foreground">
+        {/* Mounted fresh on every open, so the initializers do the prefill. */}
+        <DomainForm
+          key={domain?.id ?? "create"}
+          orgId={orgId}
+          domain={domain}
+          onOpenChange={onOpenChange}
+        />
+      </DialogContent>
+    </Dialog>
+  );
+}
+
+function DomainForm({
+  orgId,
+  domain,
+  onOpenChange,
+}: {
+  orgId: string;
+  domain?: OrganizationDomain | null;
+  onOpenChange: (open: boolean) => void;
+}) {
+  const isEdit = !!domain;
+  const createDomain = useCreateOrganizationDomain(orgId);
+  const updateDomain = useUpdateOrganizationDomain(orgId);
+  const isPending = createDomain.isPending || updateDomain.isPending;
+
+  const [name, setName] = useState(domain?.domain ?? "");
+  const [autoJoin, setAutoJoin] = useState(domain?.autoJoin ?? false);
+  const [defaultRole, setDefaultRole] = useState(domain?.defaultRole ?? "member");
+  const [claimAccounts, setClaimAccounts] = useState(
+    domain?.claimAccounts ?? false
+  );
+
+  const handleSubmit = async (e: React.FormEvent) => {
+    e.preventDefault();
+
+    if (!isEdit && !name.trim()) {
+      toast.error("Please enter a domain");
+      return;
+    }
+
+    const settings = {
+      autoJoin,
+      defaultRole: defaultRole.trim() || "member",
+      claimAccounts,
+    };
+    try {
+      if (isEdit && domain) {
+        await updateDomain.mutateAsync({ domainId: domain.id, data: settings });
+        toast.success(`Updated ${domain.domain}`);
+      } else {
+        const created = await createDomain.mutateAsync({
+          domain: name.trim(),
+          ...settings,
+        });
+        toast.success(
+          `Registered ${created.domain}. Publish its TXT record, then verify it.`
+        );
+      }
+      onOpenChange(false);
+    } catch (error) {
+      toast.error(
+        organizationDomainErrorMessage(
+          error,
+          isEdit ? "Failed to update domain" : "Failed to register domain"
+        )
+      );
+    }
+  };
+
+  return (
+    <>
+      <DialogHeader>
+        <DialogTitle>{isEdit ? domain?.domain : "Add Domain"}</DialogTitle>
+        <DialogDescription className="text-muted-foreground">
+          Once verified, users signing in through this organization&apos;s SSO
+          providers with an address at the domain are recognized as its own.
+        </DialogDescription>
+      </DialogHeader>
+      <form onSubmit={handleSubmit} className="space-y-4">
+        {!isEdit && (
+          <div className="space-y-2">
+            <Label htmlFor="domainName" className="text-foreground">
+              Domain
+            </Label>
+            <Input
+              id="domainName"
+              placeholder="example.com"
+              value={name}
+              onChange={(e) => setName(e.target.value)}
+              className="bg-background border-border text-foreground font-mono"
+              disabled={isPending}
+              autoFocus
+            />
+          </div>
+        )}
+
+        <label
+          htmlFor="domainAutoJoin"
+          className="flex items-start gap-2 text-foreground"
+        >
+          <input
+            id="domainAutoJoin"
+            type="checkbox"
+            checked={autoJoin}
+            onChange={(e) => setAutoJoin(e.target.checked)}
+            disabled={isPending}
+            className="mt-0.5"
+          />
+          <span>
+            Auto-join
+            <span className="block text-xs text-muted-foreground font-normal">
+              Users at this domain join the organization when they sign in,
+              with the default role below. A removed member rejoins at their
+              next sign-in while this is on.
+            </span>
+          </span>
+        </label>
+
+        <div className="space-y-2">
+          <Label htmlFor="domainDefaultRole" className="text-foreground">
+            Default role
+          </Label>
+          <Input
+            id="domainDefaultRole"
+            placeholder="member"
+            value={defaultRole}
+            onChange={(e) => setDefaultRole(e.target.value)}
+            className="bg-background border-border text-foreground font-mono"
+            disabled={isPending}
+          />
+          <p className="text-xs text-muted-foreground">
+            member, admin, an IAM role name, or a role id. Roles mapped from
+            the provider&apos;s claims take precedence.
+          </p>
+        </div>
+
+        <label
+          htmlFor="domainClaimAccounts"
+          className="flex items-start gap-2 text-foreground"
+        >
+          <input
+            id="domainClaimAccounts"
+            type="checkbox"
+            checked={claimAccounts}
+            onChange={(e) => setClaimAccounts(e.target.checked)}
+            disabled={isPending}
+            className="mt-0.5"
+          />
+          <span>
+            Claim existing accounts
+            <span className="block text-xs text-muted-foreground font-normal">
+              An existing Strato account at this domain can be moved into the
+              organization. Its owner is asked to consent when they sign in
+              through your SSO provider.
+            </span>
+          </span>
+        </label>
+
+        <DialogFooter>
+          <Button
+            type="button"
+            variant="outline"
+            className="border-input"
+            onClick={() => onOpenChange(false)}
+            disabled={isPending}
+          >
+            Cancel
+          </Button>
+          <Button
+            type="submit"
+            className="bg-primary hover:bg-primary/90"
+            disabled={isPending}
+          >
+            {isPending ? (
+              <>
+                <Loader2 className="h-4 w-4 mr-2 animate-spin" />
+                {isEdit ? "Saving..." : "Adding..."}
+              </>
+            ) : isEdit ? (
+              "Save Changes"
+            ) : (
+              "Add Domain"
+            )}
+          </Button>
+        </DialogFooter>
+      </form>
+    </>
+  );
+}
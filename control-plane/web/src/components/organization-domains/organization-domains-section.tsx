@@ -0,0 +1,333 @@
+"use client";
+
+import { useState } from "react";
+import { Loader2, Pencil, Plus, ShieldCheck, Trash2 } from "lucide-react";
+import { Button } from "@/components/ui/button";
+import { Card, CardContent, CardHeader, CardTitle } from "@/components/ui/card";
+import {
+  Dialog,
+  DialogContent,
+  DialogDescription,
+  DialogFooter,
+  DialogHeader,
+  DialogTitle,
+} from "@/components/ui/dialog";
+import {
+  Table,
+  TableBody,
+  TableCell,
+  TableHead,
+  TableHeader,
+  TableRow,
+} from "@/components/ui/table";
+import { Badge } from "@/components/ui/badge";
+import { CopyButton } from "@/components/ui/copy-button";
+import { Skeleton } from "@/components/ui/skeleton";
+import { OrganizationDomainDialog } from "./organization-domain-dialog";
+import {
+  useOrganizationDomains,
+  useDeleteOrganizationDomain,
+  useVerifyOrganizationDomain,
+  organizationDomainErrorMessage,
+} from "@/lib/hooks/use-organization-domains";
+import { toast } from "sonner";
+import type { OrganizationDomain } from "@/types/api";
+
+interface OrganizationDomainsSectionProps {
+  orgId: string;
+  canManage: boolean;
+}
+
+function StatusBadge({ domain }: { domain: OrganizationDomain }) {
+  switch (domain.status) {
+    case "verified":
+      return (
+        <Badge className="bg-green-500/10 text-green-700 border-transparent">
+          Verified
+        </Badge>
+      );
+    case "failed":
+      return (
+        <Badge
+          className="bg-red-500/10 text-red-700 border-transparent"
+          title={domain.statusMessage ?? undefined}
+        >
+          Failed
+        </Badge>
+      );
+    default:
+      return (
+        <Badge className="bg-muted text-foreground/80 border-transparent">
+          Pending
+        </Badge>
+      );
+  }
+}
+
+export function OrganizationDomainsSection({
+  orgId,
+  canManage,
+}: OrganizationDomainsSectionProps) {
+  const [dialogOpen, setDialogOpen] = useState(false);
+  const [editTarget, setEditTarget] = useState<OrganizationDomain | null>(null);
+  const [deleteTarget, setDeleteTarget] = useState<OrganizationDomain | null>(
+    null
+  );
+  const { data: domains = [], isLoading } = useOrganizationDomains(orgId);
+  const deleteDomain = useDeleteOrganizationDomain(orgId);
+  const verifyDomain = useVerifyOrganizationDomain(orgId);
+  const [verifyPendingId, setVerifyPendingId] = useState<string | null>(null);
+
+  const handleVerify = async (domain: OrganizationDomain) => {
+    setVerifyPendingId(domain.id);
+    try {
+      const result = await verifyDomain.mutateAsync(domain.id);
+      if (result.status === "verified") {
+        toast.success(`${result.domain} verified`);
+      } else {
+        toast.error(result.statusMessage ?? `${result.domain} could not be verified`);
+      }
+    } catch (error) {
+      toast.error(organizationDomainErrorMessage(error, "Failed to verify domain"));
+    } finally {
+      setVerifyPendingId(null);
+    }
+  };
+
+  const handleDelete = async () => {
+    if (!deleteTarget) return;
+    try {
+      await deleteDomain.mutateAsync(deleteTarget.id);
+      toast.success(`${deleteTarget.domain} removed`);
+      setDeleteTarget(null);
+    } catch (error) {
+      toast.error(organizationDomainErrorMessage(error, "Failed to remove domain"));
+    }
+  };
+
+  const openCreate = () => {
+    setEditTarget(null);
+    setDialogOpen(true);
+  };
+
+  const openEdit = (domain: OrganizationDomain) => {
+    setEditTarget(domain);
+    setDialogOpen(true);
+  };
+
+  return (
+    <Card className="bg-card border-border">
+      <CardHeader className="flex flex-row items-center justify-between space-y-0">
+        <CardTitle className="text-lg font-semibold text-foreground">
+          Verified Domains
+        </CardTitle>
+        {canManage && (
+          <Button
+            size="sm"
+            className="bg-primary hover:bg-primary/90"
+            onClick={openCreate}
+          >
+            <Plus className="h-4 w-4 mr-2" />
+            Add Domain
+          </Button>
+        )}
+      </CardHeader>
+      <CardContent>
+        <p className="text-sm text-muted-foreground mb-4">
+          Email domains this organization owns. Publish each domain&apos;s TXT
+          record in DNS and verify it; users signing in through the SSO
+          providers above with an address at a verified domain can then join
+          automatically, and existing accounts there can be claimed with their
+          owner&apos;s consent. Users can also find your SSO providers by
+          entering their email on the login screen.
+        </p>
+
+        {isLoading ? (
+          <div className="space-y-2">
+            {[...Array(2)].map((_, i) => (
+              <Skeleton key={i} className="h-12 w-full bg-muted" />
+            ))}
+          </div>
+        ) : domains.length === 0 ? (
+          <div className="text-center py-8 text-muted-foreground">
+            No domains registered.
+          </div>
+        ) : (
+          <Table>
+            <TableHeader className="bg-background">
+              <TableRow className="border-border hover:bg-transparent">
+                <TableHead className="text-muted-foreground font-medium">
+                  Domain
+                </TableHead>
+                <TableHead className="text-muted-foreground font-medium">
+                  TXT record
+                </TableHead>
+                <TableHead className="text-muted-foreground font-medium">
+                  Sign-in
+                </TableHead>
+                <TableHead className="text-muted-foreground font-medium">
+                  Status
+                </TableHead>
+                {canManage && (
+                  <TableHead className="text-muted-foreground font-medium text-right">
+                    Actions
+                  </TableHead>
+                )}
+              </TableRow>
+            </TableHeader>
+            <TableBody className="divide-y divide-border">
+              {domains.map((domain) => (
+                <TableRow
+                  key={domain.id}
+                  className="border-border hover:bg-accent/60"
+                >
+                  <TableCell>
+                    <span className="font-medium text-foreground font-mono">
+                      {domain.domain}
+                    </span>
+                  </TableCell>
+                  <TableCell>
+                    <div className="space-y-1 text-sm font-mono">
+                      <div className="flex items-center gap-1">
+                        <span className="text-foreground/80 max-w-56 truncate">
+                          {domain.recordName}
+                        </span>
+                        <CopyButton
+                          value={domain.recordName}
+                          label={`Copy ${domain.domain} record name`}
+                          toastMessage="Record name copied to clipboard"
+                        />
+                      </div>
+                      <div className="flex items-center gap-1">
+                        <span className="text-muted-foreground max-w-56 truncate">
+                          {domain.recordValue}
+                        </span>
+                        <CopyButton
+                          value={domain.recordValue}
+                          label={`Copy ${domain.domain} record value`}
+                          toastMessage="Record value copied to clipboard"
+                        />
+                      </div>
+                    </div>
+                  </TableCell>
+                  <TableCell>
+                    <div className="flex flex-wrap gap-1">
+                      {domain.autoJoin && (
+                        <Badge className="bg-blue-500/10 text-blue-700 border-transparent">
+                          Auto-join as {domain.defaultRole}
+                        </Badge>
+                      )}
+                      {domain.claimAccounts && (
+                        <Badge className="bg-blue-500/10 text-blue-700 border-transparent">
+                          Claims accounts
+                        </Badge>
+                      )}
+                      {!domain.autoJoin && !domain.claimAccounts && (
+                        <span className="text-sm text-muted-foreground">—</span>
+                      )}
+                    </div>
+                  </TableCell>
+                  <TableCell>
+                    <StatusBadge domain={domain} />
+                  </TableCell>
+                  {canManage && (
+                    <TableCell className="text-right">
+                      <div className="flex items-center justify-end gap-1">
+                        {domain.status !== "verified" && (
+                          <Button
+                            size="icon-sm"
+                            variant="ghost"
+                            className="text-muted-foreground hover:text-foreground"
+                            onClick={() => handleVerify(domain)}
+                            disabled={verifyPendingId === domain.id}
+                            aria-label={`Verify ${domain.domain}`}
+                            title="Verify"
+                          >
+                            {verifyPendingId === domain.id ? (
+                              <Loader2 className="h-4 w-4 animate-spin" />
+                            ) : (
+                              <ShieldCheck className="h-4 w-4" />
+                            )}
+                          </Button>
+                        )}
+                        <Button
+                          size="icon-sm"
+                          variant="ghost"
+                          className="text-muted-foreground hover:text-foreground"
+                          onClick={() => openEdit(domain)}
+                          aria-label={`Edit ${domain.domain}`}
+                          title="Edit"
+                        >
+                          <Pencil className="h-4 w-4" />
+                        </Button>
+                        <Button
+                          size="icon-sm"
+                          variant="ghost"
+                          className="text-muted-foreground hover:text-red-600 hover:bg-red-500/10"
+                          onClick={() => setDeleteTarget(domain)}
+                          aria-label={`Remove ${domain.domain}`}
+                          title="Remove"
+                        >
+                          <Trash2 className="h-4 w-4" />
+                        </Button>
+                      </div>
+                    </TableCell>
+                  )}
+                </TableRow>
+              ))}
+            </TableBody>
+          </Table>
+        )}
+      </CardContent>
+
+      {canManage && (
+        <OrganizationDomainDialog
+          orgId={orgId}
+          open={dialogOpen}
+          onOpenChange={setDialogOpen}
+          domain={editTarget}
+        />
+      )}
+
+      <Dialog
+        open={!!deleteTarget}
+        onOpenChange={(open) => {
+          if (!open) setDeleteTarget(null);
+        }}
+      >
+        <DialogContent className="bg-card border-border text-foreground">
+          <DialogHeader>
+            <DialogTitle>Remove {deleteTarget?.domain}?</DialogTitle>
+            <DialogDescription className="text-muted-foreground">
+              Sign-ins at this domain will no longer auto-join or claim
+              accounts. Members who already joined stay members. To use the
+              domain again it has to be verified again.
+            </DialogDescription>
+          </DialogHeader>
+          <DialogFooter>
+            <Button
+              variant="outline"
+              className="border-input"
+              onClick={() => setDeleteTarget(null)}
+              disabled={deleteDomain.isPending}
+            >
+              Cancel
+            </Button>
+            <Button
+              variant="destructive"
+              onClick={handleDelete}
+              disabled={deleteDomain.isPending}
+            >
+              {deleteDomain.isPending ? (
+                <Loader2 className="h-4 w-4 animate-spin" />
+              ) : (
+                <Trash2 className="h-4 w-4" />
+              )}
+              Remove
+            </Button>
+          </DialogFooter>
+        </DialogContent>
+      </Dialog>
+    </Card>
+  );
+}
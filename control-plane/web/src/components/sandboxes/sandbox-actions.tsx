@@ -54,6 +54,7 @@ const kindToAction: Record<OperationKind, SandboxAction | null> = {
   delete: "delete",
   // VM-only, but the map stays total over OperationKind.
   resize: null,
+  replace: null,
   snapshot: null,
   snapshot_delete: null,
   restore: null,
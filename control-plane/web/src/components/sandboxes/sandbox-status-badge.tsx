@@ -49,6 +49,7 @@ const pendingOperationLabels: Record<OperationKind, string> = {
   resume: "Resuming",
   delete: "Deleting",
   resize: "Resizing",
+  replace: "Replacing",
   snapshot: "Snapshotting",
   snapshot_delete: "Deleting snapshot",
   restore: "Restoring",
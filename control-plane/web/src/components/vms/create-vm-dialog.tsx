@@ -374,7 +374,7 @@ export function CreateVMDialog({
                   .filter((network) => network.id && !network.isDefault)
                   .map((network) => (
                     <option key={network.id} value={network.id!}>
-                      {network.name} ({network.subnet})
+                      {network.name} ({network.subnet ?? network.subnet6})
                     </option>
                   ))}
               </select>
@@ -16,6 +16,7 @@ const verbs: Record<OperationKind, { succeeded: string; infinitive: string }> =
   resume: { succeeded: "Resumed", infinitive: "resume" },
   delete: { succeeded: "Deleted", infinitive: "delete" },
   resize: { succeeded: "Resized", infinitive: "resize" },
+  replace: { succeeded: "Replaced", infinitive: "replace" },
   snapshot: { succeeded: "Snapshotted", infinitive: "snapshot" },
   snapshot_delete: { succeeded: "Snapshot deleted", infinitive: "delete the snapshot of" },
   restore: { succeeded: "Restored", infinitive: "restore" },
@@ -54,6 +54,8 @@ const kindToAction: Record<OperationKind, VMAction | null> = {
   delete: "delete",
   // Resize is driven from the VM's settings form, not a lifecycle button.
   resize: null,
+  // Replacement is a health-check action, not a lifecycle button.
+  replace: null,
   // Sandbox-only kinds; VMs never carry them but the map stays total.
   snapshot: null,
   snapshot_delete: null,
@@ -54,6 +54,7 @@ const pendingOperationLabels: Record<OperationKind, string> = {
   resume: "Resuming",
   delete: "Deleting",
   resize: "Resizing",
+  replace: "Replacing",
   // Sandbox-only kinds; VMs never carry them but the map stays total.
   snapshot: "Snapshotting",
   snapshot_delete: "Deleting snapshot",
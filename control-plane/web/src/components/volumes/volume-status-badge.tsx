@@ -45,6 +45,11 @@ const statusConfig: Record<VolumeStatus, { label: string; className: string }> =
       label: "Deleting",
       className: "bg-red-500/20 text-red-600 border-red-500/30 animate-pulse",
     },
+    migrating: {
+      label: "Migrating",
+      className:
+        "bg-purple-500/20 text-purple-600 border-purple-500/30 animate-pulse",
+    },
     error: {
       label: "Error",
       className: "bg-red-500/20 text-red-600 border-red-500/30",
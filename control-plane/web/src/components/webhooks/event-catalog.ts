@@ -24,6 +24,11 @@ export const WEBHOOK_EVENT_TYPES: WebhookEventTypeInfo[] = [
     label: "VM state changed",
     description: "A VM's observed status transitioned.",
   },
+  {
+    type: "vm.health_changed",
+    label: "VM health changed",
+    description: "A VM's application health check turned it healthy or unhealthy.",
+  },
   {
     type: "agent.connected",
     label: "Agent connected",
@@ -39,6 +44,16 @@ export const WEBHOOK_EVENT_TYPES: WebhookEventTypeInfo[] = [
     label: "Quota threshold exceeded",
     description: "A quota pool crossed 80% or 100% of its limit.",
   },
+  {
+    type: "maintenance.scheduled",
+    label: "Maintenance scheduled",
+    description: "Disruptive platform work was scheduled into one of the project's maintenance windows.",
+  },
+  {
+    type: "automation.notification",
+    label: "Automation notification",
+    description: "An automation rule's notify action ran.",
+  },
 ];
 
 export function webhookEventLabel(type: string): string {
@@ -1,7 +1,13 @@
 // Audit event API endpoints (read-only trail)
 
 import { api } from "./client";
-import type { AuditEventListResponse } from "@/types/api";
+import type {
+  AuditEventListResponse,
+  AuditQueryResponse,
+  AuditSavedSearch,
+  CreateAuditSavedSearchRequest,
+  UpdateAuditSavedSearchRequest,
+} from "@/types/api";
 
 export interface AuditEventFilters {
   eventType?: string;
@@ -29,6 +35,18 @@ function toParams(filters: AuditEventFilters): Record<string, string> {
   return params;
 }
 
+export interface AuditQueryPage {
+  limit?: number;
+  offset?: number;
+}
+
+function toQueryParams(q: string, page: AuditQueryPage): Record<string, string> {
+  const params: Record<string, string> = { q };
+  if (page.limit !== undefined) params.limit = String(page.limit);
+  if (page.offset !== undefined) params.offset = String(page.offset);
+  return params;
+}
+
 export const auditEventsApi = {
   // System-admin only: the full, cross-organization trail.
   list(filters: AuditEventFilters = {}): Promise<AuditEventListResponse> {
@@ -45,4 +63,47 @@ export const auditEventsApi = {
       toParams(filters)
     );
   },
+
+  // An audit query (`status >= 400 | count by actor`) over the full trail.
+  query(q: string, page: AuditQueryPage = {}): Promise<AuditQueryResponse> {
+    return api.get<AuditQueryResponse>("/api/audit-events/query", toQueryParams(q, page));
+  },
+
+  // The same within one organization; the server pins the organization.
+  queryForOrganization(
+    organizationID: string,
+    q: string,
+    page: AuditQueryPage = {}
+  ): Promise<AuditQueryResponse> {
+    return api.get<AuditQueryResponse>(
+      `/api/organizations/${organizationID}/audit-events/query`,
+      toQueryParams(q, page)
+    );
+  },
+};
+
+const searchesBase = (orgId: string) => `/api/organizations/${orgId}/audit-searches`;
+
+// Queries an organization keeps by name. Running one is an ordinary
+// queryForOrganization with its `query`.
+export const auditSavedSearchesApi = {
+  list(orgId: string): Promise<AuditSavedSearch[]> {
+    return api.get<AuditSavedSearch[]>(searchesBase(orgId));
+  },
+
+  create(orgId: string, data: CreateAuditSavedSearchRequest): Promise<AuditSavedSearch> {
+    return api.post<AuditSavedSearch>(searchesBase(orgId), data);
+  },
+
+  update(
+    orgId: string,
+    searchId: string,
+    data: UpdateAuditSavedSearchRequest
+  ): Promise<AuditSavedSearch> {
+    return api.patch<AuditSavedSearch>(`${searchesBase(orgId)}/${searchId}`, data);
+  },
+
+  delete(orgId: string, searchId: string): Promise<void> {
+    return api.delete<void>(`${searchesBase(orgId)}/${searchId}`);
+  },
 };
@@ -25,6 +25,11 @@ function redirectToLoginOnSessionExpiry(endpoint: string) {
   window.location.assign("/login");
 }
 
+// The API version the dashboard is written against (`Strato-API-Version`).
+// The dashboard always asks for the one it speaks rather than relying on the
+// server's default for requests that name none.
+export const API_VERSION = "1";
+
 export async function apiClient<T>(
   endpoint: string,
   options: FetchOptions = {}
@@ -41,6 +46,7 @@ export async function apiClient<T>(
     credentials: "include", // Include session cookies
     headers: {
       "Content-Type": "application/json",
+      "Strato-API-Version": API_VERSION,
       ...init.headers,
     },
   });
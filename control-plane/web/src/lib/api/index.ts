@@ -17,6 +17,7 @@ export { apiKeysApi } from "./api-keys";
 export { oauthApi } from "./oauth";
 export { scimTokensApi } from "./scim-tokens";
 export { oidcProvidersApi } from "./oidc-providers";
+export { organizationDomainsApi } from "./organization-domains";
 export { ssfStreamsApi } from "./ssf-streams";
 export { webhooksApi } from "./webhooks";
 export { groupsApi } from "./groups";
@@ -25,6 +26,6 @@ export { quotasApi } from "./quotas";
 export { hierarchyApi } from "./hierarchy";
 export { networksApi } from "./networks";
 export { securityGroupsApi } from "./security-groups";
-export { auditEventsApi } from "./audit-events";
-export type { AuditEventFilters } from "./audit-events";
+export { auditEventsApi, auditSavedSearchesApi } from "./audit-events";
+export type { AuditEventFilters, AuditQueryPage } from "./audit-events";
 export { workloadIdentityApi } from "./workload-identity";
@@ -2,15 +2,17 @@
 //
 // Management routes live under /api/organizations (unlike SCIM tokens, which
 // use the /organizations/:id/settings prefix — the backend registered them
-// there first). The lookup route is public: the login page calls it before
-// any session exists.
+// there first). The lookup and domain-claim routes are public: the login page
+// calls them before any session exists.
 import { api } from "./client";
+import type { PublicKeyCredentialRequestOptionsJSON } from "@/lib/webauthn/types";
 import type {
   OIDCProvider,
   CreateOIDCProviderRequest,
   UpdateOIDCProviderRequest,
   OIDCProviderTestResult,
   SSOLookupResponse,
+  DomainClaim,
 } from "@/types/api";
 
 const base = (orgId: string) => `/api/organizations/${orgId}/oidc-providers`;
@@ -40,9 +42,33 @@ export const oidcProvidersApi = {
     return api.post<OIDCProviderTestResult>(`${base(orgId)}/${providerId}/test`);
   },
 
-  /** Resolve an organization name to its enabled SSO providers (no auth). */
-  ssoLookup(organization: string): Promise<SSOLookupResponse> {
-    return api.get<SSOLookupResponse>("/api/public/sso/lookup", { organization });
+  /**
+   * Resolve an organization name, or an email at a verified domain, to its
+   * enabled SSO providers (no auth).
+   */
+  ssoLookup(organizationOrEmail: string): Promise<SSOLookupResponse> {
+    const query = organizationOrEmail.includes("@")
+      ? { email: organizationOrEmail }
+      : { organization: organizationOrEmail };
+    return api.get<SSOLookupResponse>("/api/public/sso/lookup", query);
+  },
+
+  /** The sign-in parked for consent to a verified domain's account claim. */
+  domainClaim(): Promise<DomainClaim> {
+    return api.get<DomainClaim>("/auth/domain-claim");
+  },
+
+  /** Passkey challenge the claimed account signs to accept the claim. */
+  confirmDomainClaimBegin(): Promise<{ options: PublicKeyCredentialRequestOptionsJSON }> {
+    return api.post("/auth/domain-claim/confirm");
+  },
+
+  acceptDomainClaim(data: { challenge: string; response: unknown }): Promise<void> {
+    return api.post<void>("/auth/domain-claim/accept", data);
+  },
+
+  declineDomainClaim(): Promise<void> {
+    return api.post<void>("/auth/domain-claim/decline");
   },
 
   /**
@@ -0,0 +1,42 @@
+// Verified email domain API client.
+//
+// Org-scoped, under /api/organizations like the OIDC providers the domains
+// configure sign-in for. Verifying asks the control plane to look the
+// challenge TXT record up now.
+import { api } from "./client";
+import type {
+  OrganizationDomain,
+  CreateOrganizationDomainRequest,
+  UpdateOrganizationDomainRequest,
+} from "@/types/api";
+
+const base = (orgId: string) => `/api/organizations/${orgId}/domains`;
+
+export const organizationDomainsApi = {
+  list(orgId: string): Promise<OrganizationDomain[]> {
+    return api.get<OrganizationDomain[]>(base(orgId));
+  },
+
+  create(
+    orgId: string,
+    data: CreateOrganizationDomainRequest
+  ): Promise<OrganizationDomain> {
+    return api.post<OrganizationDomain>(base(orgId), data);
+  },
+
+  update(
+    orgId: string,
+    domainId: string,
+    data: UpdateOrganizationDomainRequest
+  ): Promise<OrganizationDomain> {
+    return api.patch<OrganizationDomain>(`${base(orgId)}/${domainId}`, data);
+  },
+
+  delete(orgId: string, domainId: string): Promise<void> {
+    return api.delete<void>(`${base(orgId)}/${domainId}`);
+  },
+
+  verify(orgId: string, domainId: string): Promise<OrganizationDomain> {
+    return api.post<OrganizationDomain>(`${base(orgId)}/${domainId}/verify`);
+  },
+};
@@ -82,6 +82,14 @@ export {
   useTestOIDCProvider,
   oidcProviderErrorMessage,
 } from "./use-oidc-providers";
+export {
+  useOrganizationDomains,
+  useCreateOrganizationDomain,
+  useUpdateOrganizationDomain,
+  useDeleteOrganizationDomain,
+  useVerifyOrganizationDomain,
+  organizationDomainErrorMessage,
+} from "./use-organization-domains";
 export {
   useSSFStreams,
   useCreateSSFStream,
@@ -171,7 +179,7 @@ export {
   useAttachSecurityGroup,
   useDetachSecurityGroup,
 } from "./use-security-groups";
-export { useAuditEvents, auditErrorMessage } from "./use-audit-events";
+export { useAuditEvents, useAuditQuery, auditErrorMessage } from "./use-audit-events";
 export {
   useWorkloadIdentity,
   isWorkloadIdentityForbidden,
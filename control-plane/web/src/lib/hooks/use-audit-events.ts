@@ -1,5 +1,9 @@
 import { keepPreviousData, useQuery } from "@tanstack/react-query";
-import { auditEventsApi, type AuditEventFilters } from "@/lib/api/audit-events";
+import {
+  auditEventsApi,
+  type AuditEventFilters,
+  type AuditQueryPage,
+} from "@/lib/api/audit-events";
 import { ApiError } from "@/lib/api/client";
 
 // System-admin only; gate callers on user.isSystemAdmin so the query
@@ -14,6 +18,22 @@ export function useAuditEvents(filters: AuditEventFilters, enabled: boolean = tr
   });
 }
 
+// An audit query across the full trail; system-admin only, like the list.
+// Disabled until there is a query to run.
+export function useAuditQuery(
+  q: string | undefined,
+  page: AuditQueryPage,
+  enabled: boolean = true
+) {
+  return useQuery({
+    queryKey: ["audit-query", q, page],
+    queryFn: () => auditEventsApi.query(q ?? "", page),
+    enabled: enabled && q !== undefined,
+    placeholderData: keepPreviousData,
+    retry: false,
+  });
+}
+
 export function auditErrorMessage(error: unknown, fallback: string): string {
   if (error instanceof ApiError && error.status === 403) {
     return "You need system administrator rights to view the audit log.";
@@ -83,6 +83,12 @@ export function useConsole({
             terminal.write(
               `\r\n\x1b[31m${event.data}\x1b[0m\r\n`
             );
+          } else if (event.data.startsWith("session:")) {
+            // The session's id, for sharing it; nothing to show.
+          } else if (event.data.startsWith("notice:")) {
+            // Someone joined or left a shared session, or access changed.
+            const notice = event.data.slice("notice:".length).trim();
+            terminal.write(`\r\n\x1b[36m[${notice}]\x1b[0m\r\n`);
           } else {
             terminal.write(event.data);
           }
@@ -0,0 +1,78 @@
+import { useMutation, useQuery, useQueryClient } from "@tanstack/react-query";
+import { organizationDomainsApi } from "@/lib/api/organization-domains";
+import { ApiError } from "@/lib/api/client";
+import type {
+  CreateOrganizationDomainRequest,
+  UpdateOrganizationDomainRequest,
+} from "@/types/api";
+
+export function useOrganizationDomains(orgId: string, enabled = true) {
+  return useQuery({
+    queryKey: ["organization-domains", orgId],
+    queryFn: () => organizationDomainsApi.list(orgId),
+    enabled: enabled && !!orgId,
+  });
+}
+
+export function useCreateOrganizationDomain(orgId: string) {
+  const queryClient = useQueryClient();
+  return useMutation({
+    mutationFn: (data: CreateOrganizationDomainRequest) =>
+      organizationDomainsApi.create(orgId, data),
+    onSuccess: () =>
+      queryClient.invalidateQueries({
+        queryKey: ["organization-domains", orgId],
+      }),
+  });
+}
+
+export function useUpdateOrganizationDomain(orgId: string) {
+  const queryClient = useQueryClient();
+  return useMutation({
+    mutationFn: ({
+      domainId,
+      data,
+    }: {
+      domainId: string;
+      data: UpdateOrganizationDomainRequest;
+    }) => organizationDomainsApi.update(orgId, domainId, data),
+    onSuccess: () =>
+      queryClient.invalidateQueries({
+        queryKey: ["organization-domains", orgId],
+      }),
+  });
+}
+
+export function useDeleteOrganizationDomain(orgId: string) {
+  const queryClient = useQueryClient();
+  return useMutation({
+    mutationFn: (domainId: string) =>
+      organizationDomainsApi.delete(orgId, domainId),
+    onSuccess: () =>
+      queryClient.invalidateQueries({
+        queryKey: ["organization-domains", orgId],
+      }),
+  });
+}
+
+export function useVerifyOrganizationDomain(orgId: string) {
+  const queryClient = useQueryClient();
+  return useMutation({
+    mutationFn: (domainId: string) =>
+      organizationDomainsApi.verify(orgId, domainId),
+    onSuccess: () =>
+      queryClient.invalidateQueries({
+        queryKey: ["organization-domains", orgId],
+      }),
+  });
+}
+
+export function organizationDomainErrorMessage(
+  error: unknown,
+  fallback: string
+): string {
+  if (error instanceof ApiError && error.status === 403) {
+    return "You need admin rights to manage domains.";
+  }
+  return error instanceof Error ? error.message : fallback;
+}
@@ -36,7 +36,8 @@ interface UseSandboxExecReturn {
 type ServerControlFrame =
   | { type: "ready" }
   | { type: "exit"; exitCode: number }
-  | { type: "error"; message: string };
+  | { type: "error"; message: string }
+  | { type: "notice"; message: string };
 
 type WSWithCleanup = WebSocket & {
   _termDisposables?: { dispose: () => void }[];
@@ -179,6 +180,10 @@ export function useSandboxExec({
             onErrorRef.current?.(err);
             break;
           }
+          case "notice":
+            // Someone joined or left a shared session, or access changed.
+            terminal.write(`\r\n\x1b[36m[${frame.message}]\x1b[0m\r\n`);
+            break;
         }
       };
 
@@ -8,6 +8,7 @@ import type {
 import { authApi } from "@/lib/api/auth";
 import { usersApi } from "@/lib/api/users";
 import { passkeysApi } from "@/lib/api/passkeys";
+import { oidcProvidersApi } from "@/lib/api/oidc-providers";
 import { ApiError } from "@/lib/api/client";
 import type { CreateUserRequest, Passkey, User } from "@/types/api";
 
@@ -209,6 +210,30 @@ export class WebAuthnClient {
     return passkeysApi.addFinish({ ...prepared, name });
   }
 
+  /**
+   * Accept a verified domain's claim on an existing account. The account's
+   * own passkey confirms it: the IdP vouching for the email is not enough.
+   */
+  async confirmDomainClaim(): Promise<void> {
+    const { options } = await oidcProvidersApi.confirmDomainClaimBegin();
+    const challenge = options.challenge;
+
+    const credential = (await navigator.credentials.get({
+      publicKey: this.prepareRequestOptions(options),
+    })) as PublicKeyCredential | null;
+
+    if (!credential) {
+      throw new Error("Failed to get credential");
+    }
+
+    await oidcProvidersApi.acceptDomainClaim(
+      this.prepareAuthenticationResponse(credential, challenge) as {
+        challenge: string;
+        response: unknown;
+      }
+    );
+  }
+
   /**
    * Authenticate with passkey
    */
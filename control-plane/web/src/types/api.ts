@@ -152,6 +152,14 @@ export interface VM {
    */
   secureBoot?: boolean;
   tpmEnabled?: boolean;
+  /** Guest CPU model (`host-passthrough`, `host-model` or a QEMU model name); absent is passthrough. */
+  cpuModel?: string;
+  /** Key set the guest's custom Secure Boot keys were copied from; null once the set is deleted. */
+  secureBootKeySetId?: string | null;
+  /** True when the guest boots with its own Secure Boot keys instead of the firmware's. */
+  customSecureBootKeys?: boolean;
+  /** Application health-check verdict; absent or null without a check or while the VM isn't running. */
+  healthStatus?: "healthy" | "unhealthy" | null;
   /**
    * Observed guest-agent (qga) view (issue #563). `qgaAvailable` is undefined
    * until the agent's slow poll first sees a responsive guest agent;
@@ -298,7 +306,9 @@ export type IAMNodeType =
   | "sandbox_snapshot"
   | "site"
   | "agent"
-  | "security_group";
+  | "security_group"
+  | "file_share"
+  | "bucket";
 
 export interface IAMNode {
   type: IAMNodeType;
@@ -449,6 +459,25 @@ export interface AgentResources {
   availableMemory: number;
   totalDisk: number;
   availableDisk: number;
+  // Memory granted to the host's VMs; unlike availableMemory it is not
+  // clamped at zero on an overcommitted node. Absent from pre-v26 agents.
+  committedMemory?: number;
+}
+
+// A node's memory overcommit policy. The scheduler admits VMs against
+// `ratio` times physical memory; KSM, free-page reporting and pressure-driven
+// ballooning are what let the host keep that promise.
+export interface MemoryOvercommitPolicy {
+  ratio: number;
+  ksm?: { pagesToScan: number; sleepMilliseconds: number };
+  freePageReporting: boolean;
+  pressureReclaim?: {
+    pressureThresholdPercent: number;
+    releaseThresholdPercent: number;
+    idleAvailableFraction: number;
+    defaultFloorFraction: number;
+    stepBytes: number;
+  };
 }
 
 export type HypervisorType = "qemu" | "firecracker";
@@ -498,6 +527,11 @@ export interface HostInfo {
   machineModel?: string;
   // ISO timestamp of the host's last boot.
   bootTime?: string;
+  // Host CPU feature flags, sorted.
+  cpuFlags?: string[];
+  // Named QEMU CPU models the host runs in full; placement of VMs naming a
+  // model reads this.
+  supportedCPUModels?: string[];
 }
 
 export interface Agent {
@@ -541,6 +575,8 @@ export interface Agent {
   updateBlockedReason?: string;
   // Terminal failure that halted the rollout at this agent, if any.
   updateFailureReason?: string;
+  // Absent when the node admits VMs against physical memory only.
+  memoryOvercommit?: MemoryOvercommitPolicy;
 }
 
 // Result of POST /api/agents/:id/actions/update — the agent has verified and
@@ -598,6 +634,8 @@ export interface Site {
   locationLabel?: string;
   regionCode?: string;
   labels: Record<string, string>;
+  /** CPU model for QEMU VMs placed here that name none; absent keeps passthrough. */
+  defaultCpuModel?: string;
   networkControllerAgentId?: string;
   organizationId?: string;
   organizationalUnitId?: string;
@@ -616,6 +654,7 @@ export interface CreateSiteRequest {
   locationLabel?: string;
   regionCode?: string;
   labels?: Record<string, string>;
+  defaultCpuModel?: string;
 }
 
 /**
@@ -631,6 +670,7 @@ export interface UpdateSiteRequest {
   locationLabel?: string;
   regionCode?: string;
   labels?: Record<string, string>;
+  defaultCpuModel?: string;
 }
 
 export interface APIKey {
@@ -768,6 +808,48 @@ export interface SSOLookupResponse {
   providers: PublicOIDCProvider[];
 }
 
+// Verified email domains (org-scoped; managed alongside the OIDC providers)
+export type OrganizationDomainStatus = "pending" | "verified" | "failed";
+
+export interface OrganizationDomain {
+  id: string;
+  organizationId: string;
+  domain: string;
+  status: OrganizationDomainStatus;
+  /** Why the last check failed. */
+  statusMessage?: string | null;
+  /** The TXT record to publish: its name and value. */
+  recordName: string;
+  recordValue: string;
+  autoJoin: boolean;
+  /** `member`, `admin`, an IAM role name, or a role id bindable at the org. */
+  defaultRole: string;
+  claimAccounts: boolean;
+  verifiedAt?: string | null;
+  createdAt?: string | null;
+}
+
+export interface CreateOrganizationDomainRequest {
+  domain: string;
+  autoJoin?: boolean;
+  defaultRole?: string;
+  claimAccounts?: boolean;
+}
+
+export interface UpdateOrganizationDomainRequest {
+  autoJoin?: boolean;
+  defaultRole?: string;
+  claimAccounts?: boolean;
+}
+
+/** A sign-in parked until the account holder consents to a domain claim. */
+export interface DomainClaim {
+  username: string;
+  email: string;
+  organizationName: string;
+  domain: string;
+}
+
 // Shared Signals Framework receiver streams (org-scoped; managed by org admins)
 export interface SSFStream {
   id: string;
@@ -929,11 +1011,42 @@ export interface CreateVMRequest {
    * agent whose `tpmCapable` is true.
    */
   tpm?: boolean;
+  /**
+   * Guest CPU model: `host-passthrough`, `host-model` or a QEMU model name.
+   * Omitted takes the site's default at placement. Rejected with 400 for
+   * Firecracker.
+   */
+  cpuModel?: string;
+  /**
+   * Enroll this organization key set instead of the firmware's default
+   * Secure Boot keys. Requires `secureBoot`; 404 unless the set is
+   * org-wide or narrowed to the VM's project.
+   */
+  secureBootKeySetId?: string;
   /**
    * Security groups for the VM's NIC (max 5, same project as the VM).
    * Omitted → the project's default group.
    */
   securityGroupIds?: string[];
+  /**
+   * Every NIC, in guest order. Replaces networkId and securityGroupIds,
+   * which describe a single NIC; combining them is a 400.
+   */
+  nics?: CreateVMNICRequest[];
+}
+
+/** Server-enforced cap (VMNetworkInterface.maxPerVM in the control plane). */
+export const MAX_NICS_PER_VM = 8;
+
+export interface CreateVMNICRequest {
+  networkId?: string;
+  networkName?: string;
+  /** Fixed IPv4; must be free or reserved by the VM's project. */
+  ipAddress?: string;
+  ipv6Address?: string;
+  /** Unicast MAC, unique on the network; omitted generates one. */
+  macAddress?: string;
+  securityGroupIds?: string[];
 }
 
 export interface UpdateVMRequest {
@@ -948,6 +1061,115 @@ export interface UpdateVMRequest {
   balloonTarget?: number | null;
 }
 
+// Custom UEFI Secure Boot keys. Certificates are PEM; dbx entries are PEM
+// certificates or SHA-256 digests in hex.
+export interface SecureBootKeySet {
+  id: string;
+  organizationId: string;
+  /** Set when the key set is narrowed to one project. */
+  projectId?: string | null;
+  name: string;
+  description: string;
+  ownerGuid: string;
+  platformKey: string;
+  keyExchangeKeys: string[];
+  signatureDatabase: string[];
+  forbiddenSignatures: string[];
+  /** Keep the firmware's Microsoft KEK and db beside these keys. */
+  includeMicrosoftKeys: boolean;
+  createdAt?: string;
+  updatedAt?: string;
+}
+
+export interface CreateSecureBootKeySetRequest {
+  name: string;
+  description?: string;
+  projectId?: string;
+  /** Omitted generates one. */
+  ownerGuid?: string;
+  platformKey: string;
+  keyExchangeKeys?: string[];
+  signatureDatabase?: string[];
+  forbiddenSignatures?: string[];
+  includeMicrosoftKeys?: boolean;
+}
+
+export type UpdateSecureBootKeySetRequest = Partial<Omit<CreateSecureBootKeySetRequest, "projectId" | "ownerGuid">>;
+
+export interface SecureBootKeyEntrySummary {
+  kind: "x509" | "sha256";
+  /** The certificate's DER fingerprint, or the digest itself. */
+  sha256: string;
+}
+
+/** A VM's own copy of its key set. db and dbx change only while it is stopped. */
+export interface VMSecureBootKeys {
+  vmId: string;
+  keySetId?: string | null;
+  ownerGuid: string;
+  includeMicrosoftKeys: boolean;
+  signatureDatabase: string[];
+  forbiddenSignatures: string[];
+  signatureDatabaseSummary: SecureBootKeyEntrySummary[];
+  forbiddenSignaturesSummary: SecureBootKeyEntrySummary[];
+}
+
+export interface UpdateVMSecureBootKeysRequest {
+  signatureDatabase?: string[];
+  forbiddenSignatures?: string[];
+}
+
+// Project maintenance windows. Windows are read in the policy's IANA zone;
+// deny periods are absolute.
+export type MaintenanceWeekday =
+  | "sunday"
+  | "monday"
+  | "tuesday"
+  | "wednesday"
+  | "thursday"
+  | "friday"
+  | "saturday";
+
+export interface MaintenanceWindow {
+  days: MaintenanceWeekday[];
+  /** Local start, "HH:mm". */
+  startTime: string;
+  durationMinutes: number;
+}
+
+export interface MaintenanceDenyPeriod {
+  start: string;
+  end: string;
+  reason?: string;
+}
+
+export interface MaintenancePolicy {
+  timeZone: string;
+  windows?: MaintenanceWindow[];
+  denyPeriods?: MaintenanceDenyPeriod[];
+  /** How far ahead scheduled work is announced. Defaults to 24. */
+  noticeHours?: number;
+}
+
+export interface MaintenanceNotice {
+  id?: string;
+  action: "agent_update";
+  subject: string;
+  summary: string;
+  scheduledFor: string;
+  createdAt?: string;
+}
+
+export interface ProjectMaintenancePolicy {
+  projectId: string;
+  /** Null when the project takes work at any time. */
+  policy?: MaintenancePolicy | null;
+  openNow: boolean;
+  nextOpening?: string | null;
+  /** Announced work that hasn't started yet, soonest first. */
+  scheduled: MaintenanceNotice[];
+}
+
 // Async VM operations: lifecycle mutations return 202 Accepted with an
 // Operation record, which the client polls until it reaches a terminal state.
 /// Mirrors `VMOperationKind` in shared/Sources/StratoShared/OperationModels.swift.
@@ -966,6 +1188,8 @@ export type OperationKind =
   | "delete"
   // Online vCPU/memory resize of a running VM (backend issue #568).
   | "resize"
+  // Recreation from the image as a health-check action.
+  | "replace"
   // Sandbox checkpoint/restore (backend issue #426).
   | "snapshot"
   | "snapshot_delete"
@@ -977,7 +1201,7 @@ export type OperationStatus = "pending" | "succeeded" | "failed";
 
 // The resource an operation targets. Operations are shared machinery across VMs
 // and sandboxes (backend issue #412), discriminated by `resourceKind`.
-export type OperationResourceKind = "virtual_machine" | "sandbox";
+export type OperationResourceKind = "virtual_machine" | "sandbox" | "file_share";
 
 export interface Operation {
   id: string;
@@ -1264,6 +1488,7 @@ export type VolumeStatus =
   | "snapshotting"
   | "cloning"
   | "deleting"
+  | "migrating"
   | "error";
 
 export type VolumeFormat = "qcow2" | "raw";
@@ -1524,7 +1749,8 @@ export interface HierarchySearchResponse {
 export interface Network {
   id?: string;
   name: string;
-  subnet: string;
+  /** IPv4 subnet; null on an IPv6-only network. */
+  subnet?: string | null;
   gateway?: string;
   /** IPv6 subnet (always a /64) when the network is dual-stack. */
   subnet6?: string;
@@ -1548,7 +1774,8 @@ export interface Network {
 
 export interface CreateNetworkRequest {
   name: string;
-  subnet: string;
+  /** Omitted → IPv6-only network (IPv6 egress only; no NAT64). */
+  subnet?: string;
   gateway?: string;
   /** Explicit IPv6 /64; omitted → the server generates a ULA (dual-stack default). */
   subnet6?: string;
@@ -1576,6 +1803,52 @@ export interface UpdateNetworkRequest {
   leaseTime?: number;
 }
 
+// Addresses held on a network ahead of a VM. Automatic allocation skips them;
+// the owning project takes one by naming it as a NIC's fixed address.
+export interface IPReservation {
+  id: string;
+  networkId: string;
+  projectId: string;
+  family: "ipv4" | "ipv6";
+  address: string;
+  description: string;
+  /** The VM NIC currently using the address, if any. */
+  interfaceId?: string | null;
+  createdAt?: string;
+}
+
+export interface CreateIPReservationRequest {
+  /** Omitted takes the next free address of `family`. */
+  address?: string;
+  family?: "ipv4" | "ipv6";
+  /** Required on global networks. */
+  projectId?: string;
+  description?: string;
+}
+
+export type NetworkAllocationKind = "router" | "vm" | "sandbox" | "file_share" | "floating_ip" | "reservation";
+
+export interface NetworkAllocation {
+  address: string;
+  family: "ipv4" | "ipv6";
+  kind: NetworkAllocationKind;
+  /** Null on a shared network for holders in projects the caller can't read. */
+  projectId?: string | null;
+  resourceId?: string | null;
+  resourceName?: string | null;
+  interfaceId?: string | null;
+  reservationId?: string | null;
+  /** For floating_ip: the fixed address the external one forwards to. */
+  natTarget?: string | null;
+}
+
+export interface NetworkAllocations {
+  networkId: string;
+  subnet?: string | null;
+  subnet6?: string | null;
+  allocations: NetworkAllocation[];
+}
+
 // Security groups (stateful NIC-level firewalls, realized as OVN ACLs)
 
 export type SecurityGroupRuleDirection = "ingress" | "egress";
@@ -1666,9 +1939,15 @@ export interface AuditEvent {
   /** True when the request was served via the system-admin permission bypass. */
   adminBypass: boolean;
   metadata?: Record<string, string>;
+  /** Who acted; `service_account` for an automation rule's actions. */
+  actorType: AuditActorType;
+  /** The user or service account that acted. */
+  actorID?: string;
   createdAt?: string;
 }
 
+export type AuditActorType = "user" | "service_account" | "anonymous" | "system";
+
 export interface AuditEventListResponse {
   events: AuditEvent[];
   total: number;
@@ -1676,6 +1955,50 @@ export interface AuditEventListResponse {
   offset: number;
 }
 
+// Audit query language — matches AuditEventController's query DTOs.
+
+export interface AuditQueryGroup {
+  /** Each grouped field's value; a field with none is left out. */
+  key: Record<string, string>;
+  count: number;
+}
+
+export interface AuditQueryResponse {
+  query: string;
+  /** Matching events, newest first; absent for a `count` query. */
+  events?: AuditEvent[];
+  /** Fields a `count by` grouped on (`actor` expanded); empty for a bare `count`. */
+  groupBy?: string[];
+  /** Event counts per group, largest first. */
+  groups?: AuditQueryGroup[];
+  total: number;
+  limit: number;
+  offset: number;
+}
+
+export interface AuditSavedSearch {
+  id: string;
+  organizationId: string;
+  name: string;
+  description: string;
+  query: string;
+  createdById?: string;
+  createdAt?: string;
+  updatedAt?: string;
+}
+
+export interface CreateAuditSavedSearchRequest {
+  name: string;
+  description?: string;
+  query: string;
+}
+
+export interface UpdateAuditSavedSearchRequest {
+  name?: string;
+  description?: string;
+  query?: string;
+}
+
 // Workload Identity (SPIFFE / SPIRE) — matches WorkloadIdentityController DTOs.
 
 /** SVID kinds an entry issues. */
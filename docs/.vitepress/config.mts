@@ -33,7 +33,8 @@ export default defineConfig({
       {
         text: 'Guides',
         items: [
-          { text: 'Windows Guests', link: '/guide/windows-guests' }
+          { text: 'Windows Guests', link: '/guide/windows-guests' },
+          { text: 'Image Builds', link: '/guide/image-builds' }
         ]
       },
       {
@@ -0,0 +1,157 @@
+import Foundation
+
+// MARK: - Desired File Share Status
+
+/// The state the control plane wants a file share to be in. Same contract as
+/// `DesiredSandboxStatus`: a goal, never a report, and strictly decoded — an
+/// unknown value fails the whole sync rather than risk reading it as
+/// "delete the share's data".
+public enum DesiredFileShareStatus: String, Codable, CaseIterable, Sendable {
+    /// The share should exist at the desired size and be exported.
+    case present = "Present"
+    /// The share, its snapshots and its export should not exist on the agent.
+    /// Rows are removed from the control-plane database only after the agent
+    /// confirms absence, exactly like sandbox deletes.
+    case absent = "Absent"
+}
+
+// MARK: - Observed File Share Status
+
+/// A file share's state as observed on its agent. Lenient decoding like
+/// `SandboxStatus`: unknown values map to `.unknown`.
+public enum ObservedFileShareStatus: String, Codable, CaseIterable, Sendable {
+    /// Storage or the NFS server is being set up.
+    case provisioning = "Provisioning"
+    /// Exported and serving clients.
+    case available = "Available"
+    /// The last convergence attempt failed; see `lastError`.
+    case error = "Error"
+    case unknown = "Unknown"
+
+    public init(from decoder: Decoder) throws {
+        let raw = try decoder.singleValueContainer().decode(String.self)
+        self = ObservedFileShareStatus(rawValue: raw) ?? .unknown
+    }
+}
+
+// MARK: - Desired File Share State
+
+/// One file share's authoritative desired state (wire protocol v24). A share
+/// is a filesystem on the agent's storage, served over NFS from an address on
+/// the owner project's logical network. Level-triggered and
+/// generation-guarded like `DesiredSandboxState`.
+public struct DesiredFileShareState: Codable, Sendable {
+    public let shareId: UUID
+    public let desiredStatus: DesiredFileShareStatus
+    /// Monotonic per-share counter, bumped on every desired change (size,
+    /// snapshots, status). Access-rule changes do not bump it: the allowed
+    /// client list is re-derived on every sync and applied whenever it
+    /// differs.
+    public let generation: Int64
+    /// Provisioned capacity. The filesystem is grown to this size when it is
+    /// raised; shrinking is refused by the control plane.
+    public let sizeBytes: Int64
+    /// The NFS server's own port on the project network: address, MAC and
+    /// switch, built exactly like a VM NIC's spec.
+    public let endpoint: NetworkSpec
+    /// IPv4 addresses allowed to mount the share — the NICs of the owner
+    /// project's VMs on the share's network. Everything else is refused by
+    /// the export, on top of the network being project-private.
+    public let allowedClients: [String]
+    /// Snapshots that should exist. A snapshot missing from the list is
+    /// deleted; each present one is exported read-only beside the share.
+    public let snapshots: [UUID]
+
+    public init(
+        shareId: UUID,
+        desiredStatus: DesiredFileShareStatus,
+        generation: Int64,
+        sizeBytes: Int64,
+        endpoint: NetworkSpec,
+        allowedClients: [String],
+        snapshots: [UUID] = []
+    ) {
+        self.shareId = shareId
+        self.desiredStatus = desiredStatus
+        self.generation = generation
+        self.sizeBytes = sizeBytes
+        self.endpoint = endpoint
+        self.allowedClients = allowedClients
+        self.snapshots = snapshots
+    }
+}
+
+// MARK: - Observed File Share State
+
+/// One file share as actually present on an agent. The generation and error
+/// fields follow the `ObservedVMState` contract.
+public struct ObservedFileShareState: Codable, Sendable, Equatable {
+    public let shareId: UUID
+    public let status: ObservedFileShareStatus
+    /// The desired-state generation this observation reflects (0 if none yet).
+    public let observedGeneration: Int64
+    /// Current filesystem capacity.
+    public let sizeBytes: Int64
+    /// Bytes in use inside the filesystem, when the agent could measure it.
+    public let usedBytes: Int64?
+    /// Snapshots present on the agent, with their sizes.
+    public let snapshots: [ObservedFileShareSnapshot]
+    /// Human-readable convergence stage (e.g. "resizing") while the agent is
+    /// still working toward a newer generation. Progress only.
+    public let convergencePhase: String?
+    /// The most recent convergence failure, if the last attempt failed.
+    public let lastError: String?
+    /// The generation whose convergence produced `lastError`.
+    public let failedGeneration: Int64?
+
+    public init(
+        shareId: UUID,
+        status: ObservedFileShareStatus,
+        observedGeneration: Int64,
+        sizeBytes: Int64,
+        usedBytes: Int64? = nil,
+        snapshots: [ObservedFileShareSnapshot] = [],
+        convergencePhase: String? = nil,
+        lastError: String? = nil,
+        failedGeneration: Int64? = nil
+    ) {
+        self.shareId = shareId
+        self.status = status
+        self.observedGeneration = observedGeneration
+        self.sizeBytes = sizeBytes
+        self.usedBytes = usedBytes
+        self.snapshots = snapshots
+        self.convergencePhase = convergencePhase
+        self.lastError = lastError
+        self.failedGeneration = failedGeneration
+    }
+}
+
+/// A snapshot of a file share present on the agent.
+public struct ObservedFileShareSnapshot: Codable, Sendable, Equatable {
+    public let snapshotId: UUID
+    /// Bytes the snapshot holds on disk.
+    public let sizeBytes: Int64
+
+    public init(snapshotId: UUID, sizeBytes: Int64) {
+        self.snapshotId = snapshotId
+        self.sizeBytes = sizeBytes
+    }
+}
+
+// MARK: - Export Paths
+
+/// Where a share is mounted from: the NFSv4 pseudo paths the agent exports
+/// and the control plane reports to users, defined once so the two cannot
+/// drift.
+public enum FileShareExport {
+    /// The read-write export of a share.
+    public static func path(shareId: UUID) -> String {
+        "/shares/\(shareId.uuidString.lowercased())"
+    }
+
+    /// The read-only export of one of a share's snapshots.
+    public static func snapshotPath(shareId: UUID, snapshotId: UUID) -> String {
+        "\(path(shareId: shareId))/.snapshots/\(snapshotId.uuidString.lowercased())"
+    }
+}
@@ -2,9 +2,10 @@ import Foundation
 
 /// Descriptive hardware, platform, and OS details for a hypervisor host,
 /// gathered by the agent at registration and surfaced on the agent object for
-/// operators. Purely informational — the scheduler keys placement on the typed
-/// `CPUArchitecture`, `HypervisorSupport`, and `AgentResources` fields, not on
-/// anything here.
+/// operators. Informational apart from `supportedCPUModels` — the scheduler
+/// keys placement on the typed `CPUArchitecture`, `HypervisorSupport`, and
+/// `AgentResources` fields, and reads this struct only for guests that ask
+/// for a named CPU model.
 ///
 /// Every field is optional: probes are best-effort and platform-specific (a
 /// value the agent couldn't read stays `nil`), and the whole struct is absent
@@ -46,6 +47,18 @@ public struct HostInfo: Codable, Sendable, Equatable {
     /// render a live "up for N days" from it.
     public let bootTime: Date?
 
+    /// The host CPU's feature flags, sorted (`flags` in `/proc/cpuinfo` on
+    /// x86, `Features` on ARM). Lets an operator see why a named CPU model is
+    /// or isn't on offer.
+    public let cpuFlags: [String]?
+
+    /// QEMU CPU models this host can give a guest with acceleration and
+    /// nothing missing (wire protocol v28), from QEMU's
+    /// `query-cpu-definitions`. A VM asking for a named model is only placed
+    /// on agents that list it. Nil when the probe couldn't run; such an agent
+    /// is offered only host passthrough and `host-model` guests.
+    public let supportedCPUModels: [String]?
+
     public init(
         osName: String? = nil,
         kernelVersion: String? = nil,
@@ -55,7 +68,9 @@ public struct HostInfo: Codable, Sendable, Equatable {
         logicalCoreCount: Int? = nil,
         totalMemoryBytes: Int64? = nil,
         machineModel: String? = nil,
-        bootTime: Date? = nil
+        bootTime: Date? = nil,
+        cpuFlags: [String]? = nil,
+        supportedCPUModels: [String]? = nil
     ) {
         self.osName = osName
         self.kernelVersion = kernelVersion
@@ -66,5 +81,7 @@ public struct HostInfo: Codable, Sendable, Equatable {
         self.totalMemoryBytes = totalMemoryBytes
         self.machineModel = machineModel
         self.bootTime = bootTime
+        self.cpuFlags = cpuFlags
+        self.supportedCPUModels = supportedCPUModels
     }
 }
@@ -0,0 +1,80 @@
+import Foundation
+
+// MARK: - Image Build Messages (protocol version >= 33)
+
+/// Ask the agent running `vmId` to run `command` inside the guest through the
+/// QEMU guest agent (`guest-exec`) and wait up to `timeoutSeconds` for it to
+/// exit. `command[0]` is the program and the rest its arguments; nothing is
+/// interpreted by a shell unless the command names one. Responds with a
+/// `VMGuestExecResponse` whenever the command ran, whatever its exit status —
+/// an `error` response means it could not be started or did not finish in
+/// time.
+public struct VMGuestExecMessage: WebSocketMessage {
+    public var type: MessageType { .vmGuestExec }
+    public let requestId: String
+    public let timestamp: Date
+    public let vmId: String
+    public let command: [String]
+    public let timeoutSeconds: Int
+
+    public init(
+        requestId: String = UUID().uuidString,
+        timestamp: Date = Date(),
+        vmId: String,
+        command: [String],
+        timeoutSeconds: Int
+    ) {
+        self.requestId = requestId
+        self.timestamp = timestamp
+        self.vmId = vmId
+        self.command = command
+        self.timeoutSeconds = timeoutSeconds
+    }
+}
+
+/// The agent's answer to `VMGuestExecMessage`, carried in the `success`
+/// response payload.
+public struct VMGuestExecResponse: Codable, Equatable, Sendable {
+    /// The command's exit status; nil when it was killed by a signal.
+    public let exitCode: Int?
+    public let signal: Int?
+    /// The start of the command's standard output, or of its standard error
+    /// when it wrote nothing to standard output.
+    public let output: String
+
+    public init(exitCode: Int?, signal: Int?, output: String) {
+        self.exitCode = exitCode
+        self.signal = signal
+        self.output = output
+    }
+
+    /// Whether the command exited on its own with status 0.
+    public var succeeded: Bool { exitCode == 0 && signal == nil }
+}
+
+/// Ask the agent holding the stopped VM `vmId` to flatten its boot disk —
+/// the overlay and the cached image beneath it — into one standalone qcow2
+/// and stream it to the control plane with an mTLS HTTP PUT to `uploadURL`
+/// (a control-plane-relative path, the v14 snapshot-export model). As with
+/// `VolumeExportMessage`, the control plane hashes and sizes the stream as it
+/// lands in object storage. Refused while the VM is running; the VM's own
+/// disk is left untouched.
+public struct VMDiskExportMessage: WebSocketMessage {
+    public var type: MessageType { .vmDiskExport }
+    public let requestId: String
+    public let timestamp: Date
+    public let vmId: String
+    public let uploadURL: String
+
+    public init(
+        requestId: String = UUID().uuidString,
+        timestamp: Date = Date(),
+        vmId: String,
+        uploadURL: String
+    ) {
+        self.requestId = requestId
+        self.timestamp = timestamp
+        self.vmId = vmId
+        self.uploadURL = uploadURL
+    }
+}
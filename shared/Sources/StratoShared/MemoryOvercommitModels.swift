@@ -0,0 +1,135 @@
+import Foundation
+
+// MARK: - Memory Overcommit Policy
+
+/// An agent's memory overcommit policy (wire protocol v26), set by an
+/// operator on the agent and carried on every desired-state sync.
+///
+/// Two halves that only make sense together. The control plane admits VMs
+/// against `ratio` times the host's physical memory rather than the memory
+/// itself; the agent makes that safe by deduplicating guest pages (KSM),
+/// letting guests hand freed pages back (free-page reporting), and — when
+/// the host is actually short — inflating the balloons of idle guests down
+/// to their floors (`pressureReclaim`). Nil on the message means "no
+/// opinion": the agent keeps whatever it last applied.
+public struct MemoryOvercommitPolicy: Codable, Sendable, Equatable {
+    /// Memory the scheduler may commit on this host, as a multiple of its
+    /// physical memory. 1.0 is no overcommit; the control plane refuses
+    /// anything below that or above `maximumRatio`.
+    public let ratio: Double
+    /// Kernel same-page merging. Nil turns KSM off (`run=0`): pages already
+    /// merged stay merged, and new ones are not scanned.
+    public let ksm: KSMTuning?
+    /// Whether new VMs get virtio-balloon free-page reporting, which lets the
+    /// guest return freed pages to the host as it frees them. A device
+    /// property, so it takes effect on each VM's next boot.
+    public let freePageReporting: Bool
+    /// Balloon reclaim under host memory pressure. Nil leaves every balloon
+    /// at its operator target, and releases anything a previous policy
+    /// reclaimed.
+    public let pressureReclaim: PressureReclaimPolicy?
+
+    /// Above this the scheduler would be committing memory the host could
+    /// only provide if nearly every guest sat idle at its floor.
+    public static let maximumRatio = 4.0
+
+    public init(
+        ratio: Double,
+        ksm: KSMTuning? = nil,
+        freePageReporting: Bool = false,
+        pressureReclaim: PressureReclaimPolicy? = nil
+    ) {
+        self.ratio = ratio
+        self.ksm = ksm
+        self.freePageReporting = freePageReporting
+        self.pressureReclaim = pressureReclaim
+    }
+
+    // Custom decode so `freePageReporting` tolerates absence, letting an
+    // operator's policy name only what it turns on. `encode(to:)` stays
+    // synthesized.
+    public init(from decoder: any Decoder) throws {
+        let c = try decoder.container(keyedBy: CodingKeys.self)
+        ratio = try c.decode(Double.self, forKey: .ratio)
+        ksm = try c.decodeIfPresent(KSMTuning.self, forKey: .ksm)
+        freePageReporting = try c.decodeIfPresent(Bool.self, forKey: .freePageReporting) ?? false
+        pressureReclaim = try c.decodeIfPresent(PressureReclaimPolicy.self, forKey: .pressureReclaim)
+    }
+}
+
+/// KSM scanner settings, written to `/sys/kernel/mm/ksm`. Defaults are the
+/// kernel's own, which are conservative: raise `pagesToScan` on hosts with
+/// many similar guests, at the cost of a scanner thread's CPU.
+public struct KSMTuning: Codable, Sendable, Equatable {
+    /// Pages scanned per wake-up (`pages_to_scan`).
+    public let pagesToScan: Int
+    /// Sleep between scans, in milliseconds (`sleep_millisecs`).
+    public let sleepMilliseconds: Int
+
+    public init(pagesToScan: Int = 100, sleepMilliseconds: Int = 20) {
+        self.pagesToScan = pagesToScan
+        self.sleepMilliseconds = sleepMilliseconds
+    }
+
+    // Absent keys take the defaults, so `"ksm": {}` means "on, kernel
+    // defaults".
+    public init(from decoder: any Decoder) throws {
+        let c = try decoder.container(keyedBy: CodingKeys.self)
+        let defaults = KSMTuning()
+        pagesToScan = try c.decodeIfPresent(Int.self, forKey: .pagesToScan) ?? defaults.pagesToScan
+        sleepMilliseconds =
+            try c.decodeIfPresent(Int.self, forKey: .sleepMilliseconds) ?? defaults.sleepMilliseconds
+    }
+}
+
+/// When and how far the agent inflates idle guests' balloons. Pressure is
+/// the host's memory PSI (`/proc/pressure/memory`, `some avg10`): the share
+/// of the last ten seconds in which some task stalled waiting for memory.
+public struct PressureReclaimPolicy: Codable, Sendable, Equatable {
+    /// PSI percentage at or above which the agent starts reclaiming.
+    public let pressureThresholdPercent: Double
+    /// PSI percentage at or below which reclaimed memory is handed back.
+    /// Between the two thresholds the balloons hold where they are, so the
+    /// controller does not oscillate around a single line.
+    public let releaseThresholdPercent: Double
+    /// A guest counts as idle when at least this fraction of its memory is
+    /// available (free or reclaimable cache). Only idle guests are squeezed.
+    public let idleAvailableFraction: Double
+    /// The floor for a VM without its own `VMSpec.memoryFloorBytes`, as a
+    /// fraction of its memory grant.
+    public let defaultFloorFraction: Double
+    /// How much one pass moves a balloon, in bytes — in either direction, so
+    /// a guest is never starved or flooded in one step.
+    public let stepBytes: Int64
+
+    public init(
+        pressureThresholdPercent: Double = 10,
+        releaseThresholdPercent: Double = 1,
+        idleAvailableFraction: Double = 0.5,
+        defaultFloorFraction: Double = 0.5,
+        stepBytes: Int64 = 256 * 1024 * 1024
+    ) {
+        self.pressureThresholdPercent = pressureThresholdPercent
+        self.releaseThresholdPercent = releaseThresholdPercent
+        self.idleAvailableFraction = idleAvailableFraction
+        self.defaultFloorFraction = defaultFloorFraction
+        self.stepBytes = stepBytes
+    }
+
+    // Absent keys take the defaults, like `KSMTuning`.
+    public init(from decoder: any Decoder) throws {
+        let c = try decoder.container(keyedBy: CodingKeys.self)
+        let defaults = PressureReclaimPolicy()
+        pressureThresholdPercent =
+            try c.decodeIfPresent(Double.self, forKey: .pressureThresholdPercent)
+            ?? defaults.pressureThresholdPercent
+        releaseThresholdPercent =
+            try c.decodeIfPresent(Double.self, forKey: .releaseThresholdPercent)
+            ?? defaults.releaseThresholdPercent
+        idleAvailableFraction =
+            try c.decodeIfPresent(Double.self, forKey: .idleAvailableFraction) ?? defaults.idleAvailableFraction
+        defaultFloorFraction =
+            try c.decodeIfPresent(Double.self, forKey: .defaultFloorFraction) ?? defaults.defaultFloorFraction
+        stepBytes = try c.decodeIfPresent(Int64.self, forKey: .stepBytes) ?? defaults.stepBytes
+    }
+}
@@ -0,0 +1,201 @@
+import Foundation
+
+// MARK: - Desired Bucket Status
+
+/// The state the control plane wants a bucket to be in. Strictly decoded,
+/// like `DesiredFileShareStatus`: an unknown value fails the whole sync
+/// rather than risk reading it as "delete every object".
+public enum DesiredBucketStatus: String, Codable, CaseIterable, Sendable {
+    /// The bucket should exist and be served by the agent's gateway.
+    case present = "Present"
+    /// The bucket and every object in it should not exist on the agent. The
+    /// control-plane row goes only after the agent confirms absence.
+    case absent = "Absent"
+}
+
+// MARK: - Observed Bucket Status
+
+/// A bucket's state as observed on its gateway agent. Lenient decoding like
+/// `ObservedFileShareStatus`: unknown values map to `.unknown`.
+public enum ObservedBucketStatus: String, Codable, CaseIterable, Sendable {
+    /// Being set up on the agent's storage.
+    case provisioning = "Provisioning"
+    /// Served by the gateway.
+    case available = "Available"
+    /// The last convergence attempt failed; see `lastError`.
+    case error = "Error"
+    case unknown = "Unknown"
+
+    public init(from decoder: Decoder) throws {
+        let raw = try decoder.singleValueContainer().decode(String.self)
+        self = ObservedBucketStatus(rawValue: raw) ?? .unknown
+    }
+}
+
+// MARK: - Access Grants
+
+/// One thing an access key may do to a bucket's contents. Each is the
+/// compiled outcome of a Cedar `bucket:*` action for the key's principal, so
+/// the gateway enforces policy without asking the control plane per request.
+/// Lenient decoding: a permission this agent does not know is dropped, which
+/// can only deny.
+public enum ObjectPermission: String, Codable, CaseIterable, Sendable {
+    /// List the bucket's objects.
+    case list = "List"
+    /// Read (GET/HEAD) objects.
+    case read = "Read"
+    /// Create and overwrite objects, including starting, uploading parts
+    /// to, completing and aborting multipart uploads.
+    case write = "Write"
+    /// Delete objects.
+    case delete = "Delete"
+}
+
+/// What one access key may do to one bucket.
+public struct ObjectAccessGrant: Codable, Sendable, Equatable {
+    public let accessKeyId: String
+    public let permissions: [ObjectPermission]
+
+    public init(accessKeyId: String, permissions: [ObjectPermission]) {
+        self.accessKeyId = accessKeyId
+        self.permissions = permissions
+    }
+
+    public init(from decoder: any Decoder) throws {
+        let c = try decoder.container(keyedBy: CodingKeys.self)
+        accessKeyId = try c.decode(String.self, forKey: .accessKeyId)
+        permissions = try c.decode([String].self, forKey: .permissions)
+            .compactMap(ObjectPermission.init(rawValue:))
+    }
+}
+
+/// An access key's SigV4 secret, as the gateway needs it to verify request
+/// signatures. Only keys holding at least one grant on the receiving agent's
+/// buckets are sent.
+public struct ObjectGatewayCredential: Codable, Sendable, Equatable {
+    public let accessKeyId: String
+    public let secretAccessKey: String
+
+    public init(accessKeyId: String, secretAccessKey: String) {
+        self.accessKeyId = accessKeyId
+        self.secretAccessKey = secretAccessKey
+    }
+}
+
+// MARK: - Desired Bucket State
+
+/// One bucket's authoritative desired state (wire protocol v25). A bucket is
+/// a directory of objects on the agent's object storage, served by the
+/// agent's S3-compatible gateway. Generation-guarded like
+/// `DesiredFileShareState`.
+public struct DesiredBucketState: Codable, Sendable {
+    public let bucketId: UUID
+    /// The S3 bucket name clients address. Globally unique, validated by the
+    /// control plane against the S3 naming rules.
+    public let name: String
+    public let desiredStatus: DesiredBucketStatus
+    /// Bumped on every desired change to the bucket itself (status, quota).
+    /// Grant changes do not bump it: grants are recompiled on every sync and
+    /// replace the previous set wholesale.
+    public let generation: Int64
+    /// Upper bound on the bytes the bucket may hold; nil is unlimited. Writes
+    /// that would cross it are refused with `QuotaExceeded`.
+    public let quotaBytes: Int64?
+    /// Which access keys may do what. A key absent here is denied everything.
+    public let grants: [ObjectAccessGrant]
+
+    public init(
+        bucketId: UUID,
+        name: String,
+        desiredStatus: DesiredBucketStatus,
+        generation: Int64,
+        quotaBytes: Int64? = nil,
+        grants: [ObjectAccessGrant] = []
+    ) {
+        self.bucketId = bucketId
+        self.name = name
+        self.desiredStatus = desiredStatus
+        self.generation = generation
+        self.quotaBytes = quotaBytes
+        self.grants = grants
+    }
+}
+
+/// Everything the object gateway on the receiving agent should serve: its
+/// full bucket list (full-list semantics, like `fileShares`) and the
+/// credentials the buckets' grants name.
+public struct DesiredObjectStorageState: Codable, Sendable {
+    public let buckets: [DesiredBucketState]
+    public let credentials: [ObjectGatewayCredential]
+
+    public init(buckets: [DesiredBucketState], credentials: [ObjectGatewayCredential]) {
+        self.buckets = buckets
+        self.credentials = credentials
+    }
+}
+
+// MARK: - Observed Bucket State
+
+/// One bucket as actually present on a gateway agent. The generation and
+/// error fields follow the `ObservedFileShareState` contract.
+public struct ObservedBucketState: Codable, Sendable, Equatable {
+    public let bucketId: UUID
+    public let status: ObservedBucketStatus
+    /// The desired-state generation this observation reflects (0 if none yet).
+    public let observedGeneration: Int64
+    /// Bytes held by the bucket's objects, excluding unfinished multipart
+    /// uploads.
+    public let usedBytes: Int64
+    public let objectCount: Int64
+    /// The gateway's base URL clients reach the bucket at, as the agent's
+    /// operator configured it. Nil when none is configured.
+    public let endpoint: String?
+    /// The most recent convergence failure, if the last attempt failed.
+    public let lastError: String?
+    /// The generation whose convergence produced `lastError`.
+    public let failedGeneration: Int64?
+
+    public init(
+        bucketId: UUID,
+        status: ObservedBucketStatus,
+        observedGeneration: Int64,
+        usedBytes: Int64 = 0,
+        objectCount: Int64 = 0,
+        endpoint: String? = nil,
+        lastError: String? = nil,
+        failedGeneration: Int64? = nil
+    ) {
+        self.bucketId = bucketId
+        self.status = status
+        self.observedGeneration = observedGeneration
+        self.usedBytes = usedBytes
+        self.objectCount = objectCount
+        self.endpoint = endpoint
+        self.lastError = lastError
+        self.failedGeneration = failedGeneration
+    }
+}
+
+// MARK: - Bucket Names
+
+/// The S3 bucket naming rules, defined once so the control plane's
+/// validation and the gateway's path parsing agree on what a name is.
+public enum BucketName {
+    /// Whether `name` is a valid bucket name: 3–63 characters of lowercase
+    /// letters, digits, `.` and `-`, starting and ending with a letter or
+    /// digit, with no `..`, and not shaped like an IPv4 address.
+    public static func isValid(_ name: String) -> Bool {
+        guard (3...63).contains(name.count) else { return false }
+        let allowed = Set("abcdefghijklmnopqrstuvwxyz0123456789.-")
+        guard name.allSatisfy(allowed.contains) else { return false }
+        guard let first = name.first, let last = name.last,
+            first.isLetter || first.isNumber, last.isLetter || last.isNumber
+        else { return false }
+        guard !name.contains("..") else { return false }
+        let octets = name.split(separator: ".", omittingEmptySubsequences: false)
+        if octets.count == 4, octets.allSatisfy({ UInt8($0) != nil }) {
+            return false
+        }
+        return true
+    }
+}
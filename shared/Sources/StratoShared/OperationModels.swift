@@ -15,6 +15,10 @@ public enum VMOperationKind: String, Codable, CaseIterable, Sendable {
     /// the agent's observed-state report, like the other desired-state
     /// mutations; resizing a stopped VM records no operation at all.
     case resize
+    /// Discarding a VM and its boot disk and recreating it from its image,
+    /// as a health-check action. Completed like `create`, by the observed
+    /// generation catching up.
+    case replace
     // Sandbox checkpoint/restore (issue #426). Snapshot deletion gets its own
     // kind so a failed cleanup is distinguishable from a failed delete of the
     // sandbox itself.
@@ -54,6 +54,23 @@ public struct DesiredVMState: Codable, Sendable {
     /// have the VM can materialize it. Download URLs are control-plane-relative
     /// paths fetched over SVID mTLS — no signature, so nothing here expires.
     public let imageInfo: ImageInfo?
+    /// The application health check to run while the VM is running, if it
+    /// has one. Sent only to agents at `WireProtocol.vmHealthChecksMinimumVersion`
+    /// or newer; older ones would ignore it and never report health.
+    public let healthCheck: VMHealthCheck?
+    /// How many times the VM has been replaced from its image. When this is
+    /// ahead of the count the agent recorded at create, the agent discards
+    /// the VM and its boot disk and recreates it from the image. Nil (older
+    /// control planes) reads as 0.
+    public let replacementCount: Int64?
+    /// The key the VM's TPM state is encrypted with at rest (wire v32): 32
+    /// bytes, hex-encoded, for swtpm's AES-256-CBC state encryption. The key
+    /// belongs to the VM, not the host — the control plane mints it once and
+    /// keeps it — so the state directory opens on whichever agent the VM
+    /// lands on. Carried here rather than in `spec` because specs are
+    /// persisted in the agent's manifest, next to the state the key protects.
+    /// Nil for a VM without a TPM, and from older control planes.
+    public let tpmStateKey: String?
 
     public init(
         vmId: UUID,
@@ -61,7 +78,10 @@ public struct DesiredVMState: Codable, Sendable {
         spec: VMSpec,
         desiredStatus: DesiredVMStatus,
         generation: Int64,
-        imageInfo: ImageInfo? = nil
+        imageInfo: ImageInfo? = nil,
+        healthCheck: VMHealthCheck? = nil,
+        replacementCount: Int64? = nil,
+        tpmStateKey: String? = nil
     ) {
         self.vmId = vmId
         self.hypervisorType = hypervisorType
@@ -69,6 +89,9 @@ public struct DesiredVMState: Codable, Sendable {
         self.desiredStatus = desiredStatus
         self.generation = generation
         self.imageInfo = imageInfo
+        self.healthCheck = healthCheck
+        self.replacementCount = replacementCount
+        self.tpmStateKey = tpmStateKey
     }
 }
 
@@ -217,6 +240,22 @@ public struct DesiredStateMessage: WebSocketMessage {
     /// groups": the authority skips security-group reconciliation entirely
     /// when the field is absent, exactly like the `networks` list before it.
     public let securityGroups: [DesiredSecurityGroup]?
+    /// The full authoritative set of file shares hosted by the receiving
+    /// agent (wire protocol v24; full-list, same semantics as `sandboxes`).
+    /// Nil means "no opinion" — from control planes that predate file shares,
+    /// and for agents below v24 — never "delete every share": the agent skips
+    /// file-share reconciliation entirely when the field is absent.
+    public let fileShares: [DesiredFileShareState]?
+    /// What the receiving agent's object gateway should serve (wire protocol
+    /// v25): its full bucket list plus the grants and credentials for them.
+    /// Nil means "no opinion", with the same rules as `fileShares`.
+    public let objectStorage: DesiredObjectStorageState?
+    /// The receiving agent's memory overcommit policy (wire protocol v26).
+    /// Nil means "no opinion" — from control planes that predate it, and for
+    /// agents below v26 — and the agent keeps what it last applied; an
+    /// operator who clears the policy gets an explicit ratio-1 policy here
+    /// instead, so KSM and reclaim are actually turned off.
+    public let memoryOvercommit: MemoryOvercommitPolicy?
 
     public init(
         requestId: String = UUID().uuidString,
@@ -227,7 +266,10 @@ public struct DesiredStateMessage: WebSocketMessage {
         networks: [DesiredNetworkState] = [],
         networksAuthoritative: Bool = true,
         desiredAgentUpdate: DesiredAgentUpdate? = nil,
-        securityGroups: [DesiredSecurityGroup]? = nil
+        securityGroups: [DesiredSecurityGroup]? = nil,
+        fileShares: [DesiredFileShareState]? = nil,
+        objectStorage: DesiredObjectStorageState? = nil,
+        memoryOvercommit: MemoryOvercommitPolicy? = nil
     ) {
         self.requestId = requestId
         self.timestamp = timestamp
@@ -238,6 +280,9 @@ public struct DesiredStateMessage: WebSocketMessage {
         self.networksAuthoritative = networksAuthoritative
         self.desiredAgentUpdate = desiredAgentUpdate
         self.securityGroups = securityGroups
+        self.fileShares = fileShares
+        self.objectStorage = objectStorage
+        self.memoryOvercommit = memoryOvercommit
     }
 
     // Custom decode so `networks` and `sandboxes` tolerate absence: a sync
@@ -258,6 +303,9 @@ public struct DesiredStateMessage: WebSocketMessage {
         networksAuthoritative = try c.decodeIfPresent(Bool.self, forKey: .networksAuthoritative) ?? true
         desiredAgentUpdate = try c.decodeIfPresent(DesiredAgentUpdate.self, forKey: .desiredAgentUpdate)
         securityGroups = try c.decodeIfPresent([DesiredSecurityGroup].self, forKey: .securityGroups)
+        fileShares = try c.decodeIfPresent([DesiredFileShareState].self, forKey: .fileShares)
+        objectStorage = try c.decodeIfPresent(DesiredObjectStorageState.self, forKey: .objectStorage)
+        memoryOvercommit = try c.decodeIfPresent(MemoryOvercommitPolicy.self, forKey: .memoryOvercommit)
     }
 }
 
@@ -355,12 +403,19 @@ public struct DesiredFloatingIP: Codable, Sendable, Equatable {
     /// The NIC's position in the VM's interface list (orderIndex), matching
     /// the index the agent used when naming the NIC's logical switch port.
     public let nicIndex: Int
-
-    public init(externalIP: String, logicalIP: String, vmId: UUID, nicIndex: Int) {
+    /// The BYOIP prefix the address belongs to, when its pool is one. The
+    /// agent announces the whole prefix from the router (a `discard` static
+    /// route under OVN dynamic routing) while any of its addresses is
+    /// attached there. Nil for operator pools, and from control planes that
+    /// predate the field; older agents ignore it.
+    public let advertisedPrefix: String?
+
+    public init(externalIP: String, logicalIP: String, vmId: UUID, nicIndex: Int, advertisedPrefix: String? = nil) {
         self.externalIP = externalIP
         self.logicalIP = logicalIP
         self.vmId = vmId
         self.nicIndex = nicIndex
+        self.advertisedPrefix = advertisedPrefix
     }
 }
 
@@ -380,9 +435,11 @@ public struct DesiredNetworkState: Codable, Sendable {
     public let networkId: UUID
     /// OVN logical switch name (matches `NetworkSpec.network` on VM NICs).
     public let name: String
-    /// The network's subnet in CIDR form, e.g. `192.168.1.0/24`. Used as the
-    /// SNAT `logical_ip` and to size the router port's address.
-    public let subnet: String
+    /// The network's IPv4 subnet in CIDR form, e.g. `192.168.1.0/24`. Used as
+    /// the SNAT `logical_ip` and to size the router port's address. Nil on
+    /// IPv6-only networks (wire v30), which a pre-v30 agent cannot decode —
+    /// the control plane never sends such a network to one.
+    public let subnet: String?
     /// The L3 gateway address the router presents on this network (the router
     /// port's IP). Already reserved by control-plane IPAM as a non-allocatable
     /// host address. Nil disables L3 for the network (switch only).
@@ -401,8 +458,10 @@ public struct DesiredNetworkState: Codable, Sendable {
     /// a `routerKey` share one router. Opaque to the agent — do not parse it.
     public let routerKey: String
     /// Whether the agent should program outbound SNAT to the site uplink for
-    /// this network. The uplink IP is auto-detected on the agent. IPv4-only:
-    /// IPv6 stays internal (no NAT66, no default route) in this phase.
+    /// this network, per family: IPv4 to the uplink's external address, IPv6
+    /// to its `external_cidr6` when the operator configured one. An
+    /// IPv6-only network gets the IPv6 half alone: nothing translates it to
+    /// IPv4.
     public let externalAccess: Bool
     /// Whether the network's guests are addressed by OVN's DHCP responder.
     /// Carried here — not only on per-NIC specs — because DHCP edits don't
@@ -436,7 +495,7 @@ public struct DesiredNetworkState: Codable, Sendable {
     public init(
         networkId: UUID,
         name: String,
-        subnet: String,
+        subnet: String?,
         gateway: String?,
         subnet6: String? = nil,
         gateway6: String? = nil,
@@ -507,6 +566,15 @@ public struct ObservedVMState: Codable, Sendable {
     /// `Optional` contract as `guestInfo`. Purely informational: it never
     /// participates in convergence.
     public let memoryStats: VMMemoryStats?
+    /// How busy the VM's vCPUs were since the agent's previous sample, as a
+    /// fraction of all of them (0 idle, 1 every vCPU saturated). Nil until
+    /// the agent has two samples to difference, and on hosts or hypervisors
+    /// that can't see per-vCPU time. Informational, like `memoryStats`.
+    public let cpuUtilization: Double?
+    /// The VM's application health, when it has a health check that has
+    /// decided either way. Unlike the informational fields above, the control
+    /// plane acts on a change here (see `VMHealthObservation`).
+    public let health: VMHealthObservation?
 
     public init(
         vmId: UUID,
@@ -516,7 +584,9 @@ public struct ObservedVMState: Codable, Sendable {
         lastError: String? = nil,
         failedGeneration: Int64? = nil,
         guestInfo: GuestInfo? = nil,
-        memoryStats: VMMemoryStats? = nil
+        memoryStats: VMMemoryStats? = nil,
+        cpuUtilization: Double? = nil,
+        health: VMHealthObservation? = nil
     ) {
         self.vmId = vmId
         self.status = status
@@ -526,6 +596,8 @@ public struct ObservedVMState: Codable, Sendable {
         self.failedGeneration = failedGeneration
         self.guestInfo = guestInfo
         self.memoryStats = memoryStats
+        self.cpuUtilization = cpuUtilization
+        self.health = health
     }
 }
 
@@ -632,6 +704,16 @@ public struct ObservedStateReport: WebSocketMessage {
     /// into the new build rather than reporting progress), and from agents
     /// older than the field.
     public let agentUpdateStatus: ObservedAgentUpdateStatus?
+    /// File shares actually present on this agent (wire protocol v24).
+    /// Full-list, like `sandboxes`: a share missing from the list does not
+    /// exist, which is how share deletions are confirmed. Decodes to `[]`
+    /// from older agents — safe, because shares are only placed on agents
+    /// advertising `StorageCapability.nfsFileShare` at v24 or later.
+    public let fileShares: [ObservedFileShareState]
+    /// Buckets actually present on this agent's gateway (wire protocol v25).
+    /// Full-list like `fileShares`, and decodes to `[]` from older agents
+    /// for the same reason.
+    public let buckets: [ObservedBucketState]
 
     public init(
         requestId: String = UUID().uuidString,
@@ -640,7 +722,9 @@ public struct ObservedStateReport: WebSocketMessage {
         vms: [ObservedVMState],
         sandboxes: [ObservedSandboxState] = [],
         resources: AgentResources,
-        agentUpdateStatus: ObservedAgentUpdateStatus? = nil
+        agentUpdateStatus: ObservedAgentUpdateStatus? = nil,
+        fileShares: [ObservedFileShareState] = [],
+        buckets: [ObservedBucketState] = []
     ) {
         self.requestId = requestId
         self.timestamp = timestamp
@@ -649,10 +733,13 @@ public struct ObservedStateReport: WebSocketMessage {
         self.sandboxes = sandboxes
         self.resources = resources
         self.agentUpdateStatus = agentUpdateStatus
+        self.fileShares = fileShares
+        self.buckets = buckets
     }
 
-    // Custom decode so `sandboxes` tolerates absence: a report produced by a
-    // pre-sandbox agent decodes to [] rather than throwing. `encode(to:)`
+    // Custom decode so `sandboxes`, `fileShares` and `buckets` tolerate
+    // absence: a report produced by an agent predating any of them decodes
+    // to [] rather than throwing. `encode(to:)`
     // stays synthesized; all other keys remain required.
     public init(from decoder: any Decoder) throws {
         let c = try decoder.container(keyedBy: CodingKeys.self)
@@ -663,5 +750,7 @@ public struct ObservedStateReport: WebSocketMessage {
         sandboxes = try c.decodeIfPresent([ObservedSandboxState].self, forKey: .sandboxes) ?? []
         resources = try c.decode(AgentResources.self, forKey: .resources)
         agentUpdateStatus = try c.decodeIfPresent(ObservedAgentUpdateStatus.self, forKey: .agentUpdateStatus)
+        fileShares = try c.decodeIfPresent([ObservedFileShareState].self, forKey: .fileShares) ?? []
+        buckets = try c.decodeIfPresent([ObservedBucketState].self, forKey: .buckets) ?? []
     }
 }
@@ -0,0 +1,89 @@
+import Foundation
+
+/// How an application health check probes a VM.
+public enum VMHealthCheckKind: String, Codable, Sendable, CaseIterable {
+    /// A TCP connect to `port` on the VM's address succeeds.
+    case tcp
+    /// An HTTP GET of `path` on `port` answers 2xx or 3xx.
+    case http
+    /// `command` run inside the guest through the QEMU guest agent exits 0.
+    case exec
+}
+
+/// An application health check the agent runs against one VM while it is
+/// running, carried on the VM's `DesiredVMState`. The control plane owns the
+/// policy (what to do when the VM turns unhealthy); the agent only probes and
+/// reports, so nothing here names an action.
+///
+/// TCP and HTTP checks dial the VM's allocated address from the host, so they
+/// need that address to be routable from the agent (bridged or OVN networks
+/// with the host on the path); `exec` checks go through qga and need only the
+/// guest agent.
+public struct VMHealthCheck: Codable, Sendable, Equatable {
+    public let kind: VMHealthCheckKind
+    /// Port for `tcp` and `http`.
+    public let port: Int?
+    /// Request path for `http`, starting with "/". Defaults to "/".
+    public let path: String?
+    /// Program and arguments for `exec`; `command[0]` is the guest path of the
+    /// program (no shell is involved).
+    public let command: [String]?
+    /// Seconds between probes.
+    public let intervalSeconds: Int
+    /// Seconds one probe may take before it counts as a failure.
+    public let timeoutSeconds: Int
+    /// Consecutive failures that turn the VM unhealthy. A single pass turns
+    /// it healthy again.
+    public let failureThreshold: Int
+    /// Seconds after the VM is seen running during which failures don't
+    /// count, so a guest still booting its application isn't declared
+    /// unhealthy. A pass ends the grace period early.
+    public let gracePeriodSeconds: Int
+
+    public init(
+        kind: VMHealthCheckKind,
+        port: Int? = nil,
+        path: String? = nil,
+        command: [String]? = nil,
+        intervalSeconds: Int,
+        timeoutSeconds: Int,
+        failureThreshold: Int,
+        gracePeriodSeconds: Int
+    ) {
+        self.kind = kind
+        self.port = port
+        self.path = path
+        self.command = command
+        self.intervalSeconds = intervalSeconds
+        self.timeoutSeconds = timeoutSeconds
+        self.failureThreshold = failureThreshold
+        self.gracePeriodSeconds = gracePeriodSeconds
+    }
+}
+
+/// The health condition of a VM with a health check.
+public enum VMHealthStatus: String, Codable, Sendable {
+    case healthy
+    case unhealthy
+}
+
+/// What the agent last concluded from a VM's health check, attached to the
+/// VM's `ObservedVMState`. Absent until the check has decided either way (a
+/// first pass, or `failureThreshold` failures), for VMs without a check, and
+/// for VMs that aren't running.
+public struct VMHealthObservation: Codable, Sendable, Equatable {
+    public let status: VMHealthStatus
+    /// Failures since the last pass.
+    public let consecutiveFailures: Int
+    /// When the most recent probe finished.
+    public let checkedAt: Date
+    /// Why the most recent probe failed; nil after a pass.
+    public let message: String?
+
+    public init(status: VMHealthStatus, consecutiveFailures: Int, checkedAt: Date, message: String? = nil) {
+        self.status = status
+        self.consecutiveFailures = consecutiveFailures
+        self.checkedAt = checkedAt
+        self.message = message
+    }
+}
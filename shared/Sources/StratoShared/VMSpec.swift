@@ -36,6 +36,13 @@ public struct VMSpec: Codable, Sendable {
     /// more memory than it was granted (that is `maxMemoryBytes` and
     /// virtio-mem).
     public let balloonTargetBytes: Int64?
+    /// The least memory the agent's pressure reclaim may leave this guest, in
+    /// bytes (wire protocol v26). Only the agent's own reclaim honors it — an
+    /// operator's `balloonTargetBytes` is a deliberate choice and may go
+    /// lower. Nil falls back to the agent policy's default floor fraction,
+    /// which is also what control planes predating the field imply. Always
+    /// at most `memoryBytes`.
+    public let memoryFloorBytes: Int64?
     /// Disk requirement in bytes — the figure the scheduler gated placement on
     /// (`vm.disk`), carried so agents can account committed disk without
     /// deriving it from volumes (which don't carry sizes). Nil from control
@@ -52,6 +59,11 @@ public struct VMSpec: Codable, Sendable {
     /// from callers that want today's behavior; consumers treat nil as
     /// `MachineProfile.default` (both off).
     public let machine: MachineProfile?
+    /// The CPU the guest sees (wire protocol v28). Nil means host
+    /// passthrough, which is also what control planes predating the field
+    /// imply and what agents predating it always do. Realized only by QEMU;
+    /// Firecracker sandboxes keep their own `cpuTemplate`.
+    public let cpuModel: GuestCPUModel?
     /// Volumes to attach, in boot order. May be empty when the boot volume is
     /// materialized agent-side from an image (see `ImageInfo`).
     public let volumes: [VolumeSpec]
@@ -76,11 +88,13 @@ public struct VMSpec: Codable, Sendable {
         memoryBytes: Int64,
         maxMemoryBytes: Int64? = nil,
         balloonTargetBytes: Int64? = nil,
+        memoryFloorBytes: Int64? = nil,
         diskBytes: Int64? = nil,
         sharedMemory: Bool = false,
         hugepages: Bool = false,
         boot: BootSource,
         machine: MachineProfile? = nil,
+        cpuModel: GuestCPUModel? = nil,
         volumes: [VolumeSpec] = [],
         networks: [NetworkSpec] = [],
         console: ConsoleSpec? = nil,
@@ -92,11 +106,13 @@ public struct VMSpec: Codable, Sendable {
         self.memoryBytes = memoryBytes
         self.maxMemoryBytes = max(maxMemoryBytes ?? memoryBytes, memoryBytes)
         self.balloonTargetBytes = balloonTargetBytes.map { min($0, memoryBytes) }
+        self.memoryFloorBytes = memoryFloorBytes.map { min($0, memoryBytes) }
         self.diskBytes = diskBytes
         self.sharedMemory = sharedMemory
         self.hugepages = hugepages
         self.boot = boot
         self.machine = machine
+        self.cpuModel = cpuModel
         self.volumes = volumes
         self.networks = networks
         self.console = console
@@ -109,9 +125,9 @@ public struct VMSpec: Codable, Sendable {
     public var effectiveMachine: MachineProfile { machine ?? .default }
 
     // Custom decode so `sshAuthorizedKeys`, `diskBytes`, `maxMemoryBytes`,
-    // `balloonTargetBytes`, `machine`, and `userData` tolerate absence: a spec produced by an older
-    // control plane (before these fields existed) decodes to []/nil rather
-    // than throwing, keeping
+    // `balloonTargetBytes`, `memoryFloorBytes`, `machine`, `cpuModel`, and
+    // `userData` tolerate absence: a spec produced by an older control plane (before
+    // these fields existed) decodes to []/nil rather than throwing, keeping
     // agent↔control-plane compatible across version skew. `encode(to:)` stays
     // synthesized. All other keys remain required, matching the existing wire
     // contract.
@@ -127,11 +143,13 @@ public struct VMSpec: Codable, Sendable {
         } else {
             balloonTargetBytes = nil
         }
+        memoryFloorBytes = try c.decodeIfPresent(Int64.self, forKey: .memoryFloorBytes).map { min($0, memoryBytes) }
         diskBytes = try c.decodeIfPresent(Int64.self, forKey: .diskBytes)
         sharedMemory = try c.decode(Bool.self, forKey: .sharedMemory)
         hugepages = try c.decode(Bool.self, forKey: .hugepages)
         boot = try c.decode(BootSource.self, forKey: .boot)
         machine = try c.decodeIfPresent(MachineProfile.self, forKey: .machine)
+        cpuModel = try c.decodeIfPresent(GuestCPUModel.self, forKey: .cpuModel)
         volumes = try c.decode([VolumeSpec].self, forKey: .volumes)
         networks = try c.decode([NetworkSpec].self, forKey: .networks)
         console = try c.decodeIfPresent(ConsoleSpec.self, forKey: .console)
@@ -162,13 +180,18 @@ public struct MachineProfile: Codable, Equatable, Sendable {
     /// host, which agents advertise as a capability so the scheduler never
     /// places a TPM VM where it cannot be realized.
     public let tpm: Bool
+    /// Keys to enroll in place of the firmware template's own (wire protocol
+    /// v29). Nil boots with whatever the template ships. Only meaningful with
+    /// `secureBoot`.
+    public let secureBootKeys: SecureBootKeys?
 
     /// Today's behavior: no Secure Boot, no vTPM.
     public static let `default` = MachineProfile(secureBoot: false, tpm: false)
 
-    public init(secureBoot: Bool = false, tpm: Bool = false) {
+    public init(secureBoot: Bool = false, tpm: Bool = false, secureBootKeys: SecureBootKeys? = nil) {
         self.secureBoot = secureBoot
         self.tpm = tpm
+        self.secureBootKeys = secureBootKeys
     }
 
     /// Tolerates a partial profile from a peer that carries only one of the
@@ -177,6 +200,128 @@ public struct MachineProfile: Codable, Equatable, Sendable {
         let c = try decoder.container(keyedBy: CodingKeys.self)
         secureBoot = try c.decodeIfPresent(Bool.self, forKey: .secureBoot) ?? false
         tpm = try c.decodeIfPresent(Bool.self, forKey: .tpm) ?? false
+        secureBootKeys = try c.decodeIfPresent(SecureBootKeys.self, forKey: .secureBootKeys)
+    }
+}
+
+/// The UEFI Secure Boot keys a guest's variable store is enrolled with:
+/// the platform key, the key exchange keys, and the allowed (`db`) and
+/// forbidden (`dbx`) signature databases. Certificates travel as PEM.
+public struct SecureBootKeys: Codable, Equatable, Sendable {
+    /// The GUID recorded as owner of every enrolled entry.
+    public let ownerGUID: String
+    /// The platform key (PK) certificate.
+    public let platformKey: String
+    /// Key exchange key (KEK) certificates.
+    public let keyExchangeKeys: [String]
+    /// Certificates in the allowed signature database (db).
+    public let signatureDatabase: [String]
+    /// Forbidden signature database (dbx) entries: certificates, or the
+    /// SHA-256 of a revoked binary as 64 hex digits.
+    public let forbiddenSignatures: [String]
+    /// Whether Microsoft's KEK and db certificates stay enrolled alongside
+    /// these, so stock Windows and shim-signed Linux keep booting.
+    public let includeMicrosoftKeys: Bool
+
+    public init(
+        ownerGUID: String,
+        platformKey: String,
+        keyExchangeKeys: [String] = [],
+        signatureDatabase: [String] = [],
+        forbiddenSignatures: [String] = [],
+        includeMicrosoftKeys: Bool = false
+    ) {
+        self.ownerGUID = ownerGUID
+        self.platformKey = platformKey
+        self.keyExchangeKeys = keyExchangeKeys
+        self.signatureDatabase = signatureDatabase
+        self.forbiddenSignatures = forbiddenSignatures
+        self.includeMicrosoftKeys = includeMicrosoftKeys
+    }
+
+    /// These keys with the signature databases replaced.
+    public func replacingDatabases(db: [String], dbx: [String]) -> SecureBootKeys {
+        SecureBootKeys(
+            ownerGUID: ownerGUID, platformKey: platformKey, keyExchangeKeys: keyExchangeKeys,
+            signatureDatabase: db, forbiddenSignatures: dbx, includeMicrosoftKeys: includeMicrosoftKeys)
+    }
+
+    /// The DER bytes of the first certificate in `pem`, or nil when it holds
+    /// none.
+    public static func certificateDER(fromPEM pem: String) -> Data? {
+        let begin = "-----BEGIN CERTIFICATE-----"
+        let end = "-----END CERTIFICATE-----"
+        guard let start = pem.range(of: begin), let stop = pem.range(of: end, range: start.upperBound..<pem.endIndex)
+        else { return nil }
+        let body = pem[start.upperBound..<stop.lowerBound].filter { !$0.isWhitespace }
+        guard let der = Data(base64Encoded: String(body)), !der.isEmpty else { return nil }
+        return der
+    }
+
+    /// The 32 bytes of a dbx hash entry (64 hex digits), or nil when `entry`
+    /// is not one.
+    public static func sha256Digest(fromHex entry: String) -> Data? {
+        let hex = entry.trimmingCharacters(in: .whitespacesAndNewlines).lowercased()
+        guard hex.count == 64 else { return nil }
+        var bytes = Data(capacity: 32)
+        var index = hex.startIndex
+        while index < hex.endIndex {
+            let next = hex.index(index, offsetBy: 2)
+            guard let byte = UInt8(hex[index..<next], radix: 16) else { return nil }
+            bytes.append(byte)
+            index = next
+        }
+        return bytes
+    }
+}
+
+// MARK: - CPU Model
+
+/// The CPU model a QEMU guest is given. Host passthrough is fastest but ties
+/// the guest to hosts of the same CPU generation; a named baseline hides the
+/// host's newer features so the guest can move between any hosts that
+/// provide it.
+///
+/// Travels as a plain string: `host-passthrough`, `host-model`, or a QEMU CPU
+/// model name (`EPYC-Rome`, `Skylake-Server`, ...).
+public enum GuestCPUModel: RawRepresentable, Codable, Hashable, Sendable {
+    /// Every host feature passed through (QEMU `-cpu host`).
+    case hostPassthrough
+    /// The newest named model the host can run, chosen by its agent at boot.
+    /// Portable across hosts of the same generation without naming one.
+    case hostModel
+    /// A QEMU CPU model by name. Agents list the ones their host can run in
+    /// `HostInfo.supportedCPUModels`.
+    case named(String)
+
+    public static let hostPassthroughName = "host-passthrough"
+    public static let hostModelName = "host-model"
+
+    /// Nil for anything that isn't one of the two keywords or a plausible
+    /// QEMU model name: 1-64 characters of letters, digits, `-`, `_` and `.`.
+    /// QEMU's own `host` is accepted as passthrough.
+    public init?(rawValue: String) {
+        switch rawValue {
+        case Self.hostPassthroughName, "host":
+            self = .hostPassthrough
+        case Self.hostModelName:
+            self = .hostModel
+        default:
+            let allowed = rawValue.unicodeScalars.allSatisfy {
+                ("a"..."z").contains($0) || ("A"..."Z").contains($0) || ("0"..."9").contains($0)
+                    || $0 == "-" || $0 == "_" || $0 == "."
+            }
+            guard (1...64).contains(rawValue.count), allowed else { return nil }
+            self = .named(rawValue)
+        }
+    }
+
+    public var rawValue: String {
+        switch self {
+        case .hostPassthrough: return Self.hostPassthroughName
+        case .hostModel: return Self.hostModelName
+        case .named(let name): return name
+        }
     }
 }
 
@@ -206,20 +351,98 @@ public struct VolumeSpec: Codable, Sendable {
     public let readonly: Bool
     /// Explicit boot order; volumes are sent pre-sorted, this is informational.
     public let bootOrder: Int?
+    /// I/O limits from the volume's type. Nil means unthrottled — today's
+    /// behavior, and what a pre-v21 control plane always sends.
+    public let qos: VolumeQoS?
+    /// The volume is multi-attach: other VMs may hold it open at the same
+    /// time, so the agent plugs it with QEMU's `share-rw=on` instead of
+    /// taking the image's exclusive write lock. Absent (false) from a pre-v22
+    /// control plane.
+    public let shared: Bool
+    /// The volume's replica lives on another agent, which serves it over NBD
+    /// (an attached volume migrated away from its VM's host). When set the
+    /// agent attaches the disk from this endpoint and ignores `storagePath`.
+    /// Absent (nil) from a pre-v23 control plane.
+    public let nbd: NBDExportEndpoint?
 
     public init(
         volumeId: UUID? = nil,
         deviceName: String,
         storagePath: String? = nil,
         readonly: Bool = false,
-        bootOrder: Int? = nil
+        bootOrder: Int? = nil,
+        qos: VolumeQoS? = nil,
+        shared: Bool = false,
+        nbd: NBDExportEndpoint? = nil
     ) {
         self.volumeId = volumeId
         self.deviceName = deviceName
         self.storagePath = storagePath
         self.readonly = readonly
         self.bootOrder = bootOrder
+        self.qos = qos
+        self.shared = shared
+        self.nbd = nbd
     }
+
+    public init(from decoder: Decoder) throws {
+        let c = try decoder.container(keyedBy: CodingKeys.self)
+        volumeId = try c.decodeIfPresent(UUID.self, forKey: .volumeId)
+        deviceName = try c.decode(String.self, forKey: .deviceName)
+        storagePath = try c.decodeIfPresent(String.self, forKey: .storagePath)
+        readonly = try c.decode(Bool.self, forKey: .readonly)
+        bootOrder = try c.decodeIfPresent(Int.self, forKey: .bootOrder)
+        qos = try c.decodeIfPresent(VolumeQoS.self, forKey: .qos)
+        shared = try c.decodeIfPresent(Bool.self, forKey: .shared) ?? false
+        nbd = try c.decodeIfPresent(NBDExportEndpoint.self, forKey: .nbd)
+    }
+}
+
+/// Per-volume I/O limits, realized by QEMU's block throttling
+/// (`throttling.*` drive options at spawn, `block_set_io_throttle` on
+/// hot-plug). Each limit is a combined read+write ceiling; nil leaves that
+/// dimension unlimited.
+public struct VolumeQoS: Codable, Sendable, Equatable {
+    /// Total I/O operations per second.
+    public let maxIOPS: Int?
+    /// Total throughput in bytes per second.
+    public let maxBytesPerSecond: Int64?
+
+    public init(maxIOPS: Int? = nil, maxBytesPerSecond: Int64? = nil) {
+        self.maxIOPS = maxIOPS
+        self.maxBytesPerSecond = maxBytesPerSecond
+    }
+
+    /// Whether any limit is set. An all-nil QoS is the same as none, so
+    /// callers can skip the throttle plumbing entirely.
+    public var isLimited: Bool {
+        maxIOPS != nil || maxBytesPerSecond != nil
+    }
+}
+
+/// Storage-related capability strings an agent advertises in
+/// `AgentRegisterMessage.capabilities`.
+public enum StorageCapability {
+    /// The agent's volume storage sits on operator-attested encrypted media.
+    /// Volume types that require encryption place only on such agents.
+    public static let encryptedVolumeStorage = "encrypted_volume_storage"
+    /// The agent can serve volumes over NBD on its storage network, so it
+    /// can be the destination of an attached-volume migration.
+    public static let nbdExport = "nbd_export"
+    /// The agent can host managed file shares: it has share storage and runs
+    /// an NFS server for them on tenant networks (wire protocol v24).
+    public static let nfsFileShare = "nfs_file_share"
+    /// The agent runs the S3-compatible object gateway and can host buckets
+    /// on its object storage (wire protocol v25).
+    public static let objectGateway = "object_gateway"
+}
+
+/// Machine-profile capability strings an agent advertises in
+/// `AgentRegisterMessage.capabilities`.
+public enum MachineCapability {
+    /// The agent can enroll `SecureBootKeys` into a VM's variable store
+    /// (wire protocol v29).
+    public static let secureBootKeyEnrollment = "secure_boot_key_enrollment"
 }
 
 // MARK: - Network Specification
@@ -0,0 +1,188 @@
+import Foundation
+
+// MARK: - Volume Migration Messages (protocol version >= 23)
+
+/// Where a volume's bytes are served over NBD: the destination agent of an
+/// attached-volume migration exports the new copy, the source VM's QEMU
+/// mirrors into it, and — because the VM keeps running on its original host —
+/// keeps reading and writing it there afterwards. `host`/`port` are the
+/// exporting agent's storage-network address; NBD itself is unauthenticated,
+/// so the export must never be reachable from tenant networks.
+public struct NBDExportEndpoint: Codable, Equatable, Sendable {
+    public let host: String
+    public let port: Int
+    public let exportName: String
+
+    public init(host: String, port: Int, exportName: String) {
+        self.host = host
+        self.port = port
+        self.exportName = exportName
+    }
+
+    /// The `nbd://` URI QEMU accepts as a drive `file=`. IPv6 literals are
+    /// bracketed.
+    public var uri: String {
+        let authority = host.contains(":") ? "[\(host)]" : host
+        return "nbd://\(authority):\(port)/\(exportName)"
+    }
+}
+
+/// Ask the agent holding a detached volume to stream its disk file to the
+/// control plane with an mTLS HTTP PUT to `uploadURL` (a control-plane-relative
+/// path, the v14 snapshot-export model). The control plane hashes and sizes
+/// the stream as it lands in object storage, so the integrity material the
+/// destination later verifies is never agent-supplied. The source copy is
+/// left untouched; the control plane deletes it only once the destination
+/// has imported the bytes and the replica records have switched.
+public struct VolumeExportMessage: WebSocketMessage {
+    public var type: MessageType { .volumeExport }
+    public let requestId: String
+    public let timestamp: Date
+    public let volumeId: String
+    public let volumePath: String
+    public let uploadURL: String
+
+    public init(
+        requestId: String = UUID().uuidString,
+        timestamp: Date = Date(),
+        volumeId: String,
+        volumePath: String,
+        uploadURL: String
+    ) {
+        self.requestId = requestId
+        self.timestamp = timestamp
+        self.volumeId = volumeId
+        self.volumePath = volumePath
+        self.uploadURL = uploadURL
+    }
+}
+
+/// Ask the destination agent of a detached-volume migration to fetch the
+/// exported disk from `downloadURL` over mTLS, verify it against the size and
+/// SHA-256 the control plane recorded, and adopt it as its own copy of the
+/// volume. Responds with a `VolumeStatusResponse` carrying the new path.
+public struct VolumeImportMessage: WebSocketMessage {
+    public var type: MessageType { .volumeImport }
+    public let requestId: String
+    public let timestamp: Date
+    public let volumeId: String
+    public let format: String
+    /// Control-plane-relative download path (same route as the upload,
+    /// method GET).
+    public let downloadURL: String
+    public let sizeBytes: Int64
+    /// Lowercase hex SHA-256 of the disk file.
+    public let sha256: String
+
+    public init(
+        requestId: String = UUID().uuidString,
+        timestamp: Date = Date(),
+        volumeId: String,
+        format: String,
+        downloadURL: String,
+        sizeBytes: Int64,
+        sha256: String
+    ) {
+        self.requestId = requestId
+        self.timestamp = timestamp
+        self.volumeId = volumeId
+        self.format = format
+        self.downloadURL = downloadURL
+        self.sizeBytes = sizeBytes
+        self.sha256 = sha256
+    }
+}
+
+/// Ask the destination agent of an attached-volume migration to create a
+/// blank raw volume of `size` bytes and serve it over NBD, as the target of
+/// the source VM's block mirror. Responds with a `VolumeNBDExportResponse`.
+/// Idempotent: a retry for a volume that is already exported returns the
+/// existing endpoint.
+public struct VolumeNBDExportMessage: WebSocketMessage {
+    public var type: MessageType { .volumeNBDExport }
+    public let requestId: String
+    public let timestamp: Date
+    public let volumeId: String
+    public let size: Int64
+
+    public init(
+        requestId: String = UUID().uuidString,
+        timestamp: Date = Date(),
+        volumeId: String,
+        size: Int64
+    ) {
+        self.requestId = requestId
+        self.timestamp = timestamp
+        self.volumeId = volumeId
+        self.size = size
+    }
+}
+
+/// Ask an agent to stop serving a volume over NBD. The volume's file is kept;
+/// deleting it is a separate `VolumeDeleteMessage` (which also unexports).
+/// Idempotent.
+public struct VolumeNBDUnexportMessage: WebSocketMessage {
+    public var type: MessageType { .volumeNBDUnexport }
+    public let requestId: String
+    public let timestamp: Date
+    public let volumeId: String
+
+    public init(
+        requestId: String = UUID().uuidString,
+        timestamp: Date = Date(),
+        volumeId: String
+    ) {
+        self.requestId = requestId
+        self.timestamp = timestamp
+        self.volumeId = volumeId
+    }
+}
+
+/// The exporting agent's answer to `VolumeNBDExportMessage`, carried in the
+/// `success` response payload.
+public struct VolumeNBDExportResponse: Codable, Sendable {
+    public let volumeId: String
+    /// The agent-owned path of the exported file.
+    public let storagePath: String
+    public let endpoint: NBDExportEndpoint
+
+    public init(volumeId: String, storagePath: String, endpoint: NBDExportEndpoint) {
+        self.volumeId = volumeId
+        self.storagePath = storagePath
+        self.endpoint = endpoint
+    }
+}
+
+/// Ask the agent running `vmId` to move the attached volume's disk onto
+/// `target` with QEMU's `blockdev-mirror`: a full copy while the guest keeps
+/// running, then a pivot so the guest's disk is the NBD export from then on.
+/// Responds only once the pivot has completed; on any failure the job is
+/// cancelled and the guest stays on its original disk.
+public struct VolumeMirrorMessage: WebSocketMessage {
+    public var type: MessageType { .volumeMirror }
+    public let requestId: String
+    public let timestamp: Date
+    public let vmId: String
+    public let volumeId: String
+    /// Where the guest's disk currently lives, used to find its block node:
+    /// a file path on this agent, or the `nbd://` URI of a replica already
+    /// served from another agent.
+    public let volumePath: String
+    public let target: NBDExportEndpoint
+
+    public init(
+        requestId: String = UUID().uuidString,
+        timestamp: Date = Date(),
+        vmId: String,
+        volumeId: String,
+        volumePath: String,
+        target: NBDExportEndpoint
+    ) {
+        self.requestId = requestId
+        self.timestamp = timestamp
+        self.vmId = vmId
+        self.volumeId = volumeId
+        self.volumePath = volumePath
+        self.target = target
+    }
+}
@@ -35,6 +35,12 @@ public enum MessageType: String, Codable, Sendable {
     case volumeSnapshotDelete = "volume_snapshot_delete"
     case volumeClone = "volume_clone"
     case volumeInfo = "volume_info"
+    // Volume migration between agents (protocol version >= 23)
+    case volumeExport = "volume_export"
+    case volumeImport = "volume_import"
+    case volumeNBDExport = "volume_nbd_export"
+    case volumeNBDUnexport = "volume_nbd_unexport"
+    case volumeMirror = "volume_mirror"
 
     // Console operations
     case consoleConnect = "console_connect"
@@ -78,6 +84,11 @@ public enum MessageType: String, Codable, Sendable {
     // Snapshot mobility (protocol version >= 14, issue #428): export a
     // checkpoint's artifacts off-node to control-plane object storage.
     case sandboxSnapshotExport = "sandbox_snapshot_export"
+
+    // Image builds (protocol version >= 33): run a provisioner inside a
+    // build VM through qga, and upload the stopped VM's boot disk.
+    case vmGuestExec = "vm_guest_exec"
+    case vmDiskExport = "vm_disk_export"
 }
 
 // MARK: - Base Message Protocol
@@ -369,6 +380,12 @@ public struct AgentResources: Codable, Sendable {
     public let availableMemory: Int64
     public let totalDisk: Int64
     public let availableDisk: Int64
+    /// Memory committed to workloads on this host, in bytes — unlike
+    /// `availableMemory`, not clamped at the host's size, so it stays exact
+    /// once an overcommit policy lets commitments exceed physical memory
+    /// (wire protocol v26). Nil from older agents, whose commitments never
+    /// could.
+    public let committedMemory: Int64?
 
     public init(
         totalCPU: Int,
@@ -376,7 +393,8 @@ public struct AgentResources: Codable, Sendable {
         totalMemory: Int64,
         availableMemory: Int64,
         totalDisk: Int64,
-        availableDisk: Int64
+        availableDisk: Int64,
+        committedMemory: Int64? = nil
     ) {
         self.totalCPU = totalCPU
         self.availableCPU = availableCPU
@@ -384,6 +402,7 @@ public struct AgentResources: Codable, Sendable {
         self.availableMemory = availableMemory
         self.totalDisk = totalDisk
         self.availableDisk = availableDisk
+        self.committedMemory = committedMemory
     }
 }
 
@@ -961,6 +980,13 @@ public struct VolumeAttachMessage: WebSocketMessage {
     public let volumePath: String
     public let deviceName: String  // e.g., "disk1", "disk2"
     public let readonly: Bool
+    /// I/O limits from the volume's type, applied right after the hot-plug
+    /// (see `WireProtocol.supportsVolumeQoS(_:)`). Nil means unthrottled.
+    public let qos: VolumeQoS?
+    /// Plug the disk with `share-rw=on` because the volume is multi-attach
+    /// (see `WireProtocol.supportsSharedVolumes(_:)`). Absent (false) from a
+    /// pre-v22 control plane.
+    public let shared: Bool
 
     public init(
         requestId: String = UUID().uuidString,
@@ -969,7 +995,9 @@ public struct VolumeAttachMessage: WebSocketMessage {
         volumeId: String,
         volumePath: String,
         deviceName: String,
-        readonly: Bool = false
+        readonly: Bool = false,
+        qos: VolumeQoS? = nil,
+        shared: Bool = false
     ) {
         self.requestId = requestId
         self.timestamp = timestamp
@@ -978,6 +1006,21 @@ public struct VolumeAttachMessage: WebSocketMessage {
         self.volumePath = volumePath
         self.deviceName = deviceName
         self.readonly = readonly
+        self.qos = qos
+        self.shared = shared
+    }
+
+    public init(from decoder: Decoder) throws {
+        let container = try decoder.container(keyedBy: CodingKeys.self)
+        requestId = try container.decode(String.self, forKey: .requestId)
+        timestamp = try container.decode(Date.self, forKey: .timestamp)
+        vmId = try container.decode(String.self, forKey: .vmId)
+        volumeId = try container.decode(String.self, forKey: .volumeId)
+        volumePath = try container.decode(String.self, forKey: .volumePath)
+        deviceName = try container.decode(String.self, forKey: .deviceName)
+        readonly = try container.decode(Bool.self, forKey: .readonly)
+        qos = try container.decodeIfPresent(VolumeQoS.self, forKey: .qos)
+        shared = try container.decodeIfPresent(Bool.self, forKey: .shared) ?? false
     }
 }
 
@@ -264,7 +264,123 @@ public enum WireProtocol {
     /// "tear down all port groups" — and a nil per-NIC list marks the port
     /// unmanaged: it joins no groups, drop group included, so legacy traffic
     /// keeps flowing during a mixed-version rollout.
-    public static let currentVersion = 20
+    ///
+    /// Version 21: volume types (admin-defined classes of storage backed by a
+    /// pool). `VolumeSpec.qos` and `VolumeAttachMessage.qos` (optional
+    /// `VolumeQoS`) carry the type's I/O limits, which the agent realizes as
+    /// QEMU block throttling. Additive and nil-tolerant on the wire, and
+    /// therefore v19's silent hazard: a pre-v21 agent decodes the message,
+    /// ignores the key, and attaches the volume unthrottled while the API
+    /// reports the type's limits. The control plane refuses to attach a
+    /// throttled volume to a VM whose agent registered pre-v21, and refuses
+    /// to place a VM that boots with one there (see `supportsVolumeQoS(_:)`).
+    /// Volumes whose type sets no limits — and every volume without a type —
+    /// are unaffected.
+    ///
+    /// Version 22: multi-attach volumes. `VolumeSpec.shared` and
+    /// `VolumeAttachMessage.shared` tell the agent to plug the disk with
+    /// QEMU's `share-rw=on`. Both default to false when absent, and a
+    /// pre-v22 agent that ignores them plugs the disk with QEMU's exclusive
+    /// image lock — so the *second* VM's attach or boot fails on the lock
+    /// rather than silently corrupting anything. That is still an attach the
+    /// API accepted and cannot honor, so the control plane refuses to attach
+    /// a multi-attach volume through a pre-v22 agent and keeps VMs booting
+    /// with one off such agents (see `supportsSharedVolumes(_:)`).
+    ///
+    /// Version 23: volume migration between agents. Adds the `volumeExport`,
+    /// `volumeImport`, `volumeNBDExport`, `volumeNBDUnexport` and
+    /// `volumeMirror` request types (new `MessageType` cases, so like v14 the
+    /// gate is load-bearing: a pre-v23 agent drops the undecodable envelope
+    /// and the request would burn its timeout against silence), and
+    /// `VolumeSpec.nbd`, which points a VM's disk at a replica another agent
+    /// serves over NBD once an attached volume has been mirrored away from
+    /// its VM's host. That field is additive but not tolerant: a pre-v23
+    /// agent ignores it and would boot the VM against a local path that no
+    /// longer exists. The control plane therefore only migrates a volume
+    /// between agents that are both v23+ — and, for an attached volume, only
+    /// when the VM's own agent is too (see `supportsVolumeMigration(_:)`).
+    ///
+    /// Version 24: managed NFS file shares. `DesiredStateMessage` gains an
+    /// optional `fileShares` list and `ObservedStateReport` a `fileShares`
+    /// list, both absence-tolerant. Nil desired shares are "no opinion" —
+    /// never "delete every share" — so a newer control plane can talk to an
+    /// older agent and the reverse without data loss. The gate is on
+    /// placement: shares are only placed on agents that are v24+ and
+    /// advertise `StorageCapability.nfsFileShare`, and sync assembly leaves
+    /// the field nil for anything older (see `supportsFileShares(_:)`).
+    ///
+    /// Version 25: object storage. `DesiredStateMessage` gains an optional
+    /// `objectStorage` (the buckets the agent's gateway serves, their access
+    /// grants, and the credentials those grants name) and
+    /// `ObservedStateReport` a `buckets` list, with the same absence rules
+    /// as v24's file shares. Buckets are only placed on v25+ agents that
+    /// advertise `StorageCapability.objectGateway` (see
+    /// `supportsObjectStorage(_:)`).
+    ///
+    /// Version 26: memory overcommit. `DesiredStateMessage` gains an optional
+    /// `memoryOvercommit` policy (KSM, free-page reporting, pressure reclaim),
+    /// `VMSpec` an optional `memoryFloorBytes`, and `AgentResources` an
+    /// optional `committedMemory` — the unclamped sum of committed memory the
+    /// scheduler needs once commitments can exceed the host. All additive and
+    /// absence-tolerant. The gate is on admission: the control plane only
+    /// schedules against an agent's overcommit ratio when the agent is v26+,
+    /// since an older one could never reclaim what the ratio promises away
+    /// (see `supportsMemoryOvercommit(_:)`).
+    ///
+    /// Version 27: guest CPU usage. `ObservedVMState.cpuUtilization`
+    /// (optional) carries how busy the VM's vCPUs were since the agent's
+    /// previous sample, feeding the control plane's rightsizing history.
+    /// Informational and nil-tolerant both ways, with v16's memory stats
+    /// contract, so there is no gate.
+    ///
+    /// Version 28: guest CPU models. `VMSpec` gains an optional `cpuModel`
+    /// (host passthrough, `host-model`, or a named QEMU baseline) and
+    /// `HostInfo` the host's `cpuFlags` and `supportedCPUModels`. All
+    /// additive and absence-tolerant, but a pre-v28 agent ignores the model
+    /// and passes the host CPU through, so a guest asking for a baseline
+    /// would silently lose the portability it asked for. The gate is on
+    /// placement: anything but host passthrough places only on v28+ agents,
+    /// and a named model only on those that list it (see
+    /// `supportsCPUModels(_:)`).
+    ///
+    /// Version 29: custom Secure Boot keys. `MachineProfile` gains an
+    /// optional `secureBootKeys` (PK, KEK, db, dbx) for the agent to enroll
+    /// into the VM's variable store in place of the template's. Additive and
+    /// absence-tolerant, but a pre-v29 agent would boot the guest with the
+    /// template's keys — trusting what the owner meant to replace — so the
+    /// gate is on placement: such VMs place only on v29+ agents that
+    /// advertise `MachineCapability.secureBootKeyEnrollment` (see
+    /// `supportsSecureBootKeys(_:)`).
+    ///
+    /// Version 30: IPv6-only networks. `DesiredNetworkState.subnet` becomes
+    /// optional — nil on a network with no IPv4 at all. Not tolerant: a
+    /// pre-v30 agent fails to decode a sync carrying a network without
+    /// `subnet`, taking every other entry in it down too. So sync assembly
+    /// leaves IPv6-only networks out for such agents, and workloads on them
+    /// place only on v30+ agents (see `supportsIPv6OnlyNetworks(_:)`).
+    ///
+    /// Version 31: VM application health checks. `DesiredVMState` gains an
+    /// optional `healthCheck` and `replacementCount`, and `ObservedVMState`
+    /// an optional `health`. All additive and absence-tolerant, but a pre-v31
+    /// agent would drop the check and never report health, and would ignore
+    /// a replacement — so the control plane refuses a health check on a VM
+    /// whose agent is older (see `supportsVMHealthChecks(_:)`).
+    ///
+    /// Version 32: encrypted vTPM state. `DesiredVMState` gains an optional
+    /// `tpmStateKey`, which the agent hands swtpm so the TPM's state is
+    /// encrypted at rest. Additive and absence-tolerant: a pre-v32 agent
+    /// keeps the state in plaintext, as before. The control plane sends the
+    /// key only to v32+ agents, so a host that cannot use it never learns it
+    /// (see `supportsTPMStateEncryption(_:)`).
+    ///
+    /// Version 33: image builds. Adds the `vmGuestExec` request/response pair
+    /// (run a command in a running VM through qga and return its exit status
+    /// and output) and `vmDiskExport` (stream a stopped VM's boot disk,
+    /// flattened to a standalone qcow2, to the control plane over mTLS). New
+    /// `MessageType`s, so a pre-v33 agent cannot decode them at all; the
+    /// gate is on placement — a build's VM places only on v33+ agents (see
+    /// `supportsImageBuilds(_:)`).
+    public static let currentVersion = 33
 
     /// The lowest protocol version that speaks reconciliation state sync
     /// (see `currentVersion` version 2 notes).
@@ -466,6 +582,134 @@ public enum WireProtocol {
         version >= securityGroupsMinimumVersion
     }
 
+    /// The lowest protocol version that realizes `VolumeQoS` (see
+    /// `currentVersion` version 21 notes).
+    public static let volumeQoSMinimumVersion = 21
+
+    /// Whether an agent registered with `version` throttles a volume to its
+    /// type's I/O limits. A pre-v21 agent ignores the field and attaches the
+    /// disk unthrottled, so throttled volumes are kept off such agents rather
+    /// than reported as limited while running without limits.
+    public static func supportsVolumeQoS(_ version: Int) -> Bool {
+        version >= volumeQoSMinimumVersion
+    }
+
+    /// The lowest protocol version that plugs shared disks (see
+    /// `currentVersion` version 22 notes).
+    public static let sharedVolumesMinimumVersion = 22
+
+    /// Whether an agent registered with `version` can hold a multi-attach
+    /// volume open alongside other VMs. A pre-v22 agent ignores `shared` and
+    /// takes QEMU's exclusive image lock, which the next attacher trips over.
+    public static func supportsSharedVolumes(_ version: Int) -> Bool {
+        version >= sharedVolumesMinimumVersion
+    }
+
+    /// The lowest protocol version that can export, import and mirror a
+    /// volume, and boot a VM against a replica served over NBD (see
+    /// `currentVersion` version 23 notes).
+    public static let volumeMigrationMinimumVersion = 23
+
+    /// Whether an agent registered with `version` can take part in a volume
+    /// migration — as its source, its destination, or the host of the VM
+    /// the volume is attached to.
+    public static func supportsVolumeMigration(_ version: Int) -> Bool {
+        version >= volumeMigrationMinimumVersion
+    }
+
+    /// The lowest protocol version that reconciles file shares (see
+    /// `currentVersion` version 24 notes).
+    public static let fileShareMinimumVersion = 24
+
+    /// Whether an agent registered with `version` can host file shares — the
+    /// desired-state sync carries them and its report confirms them.
+    public static func supportsFileShares(_ version: Int) -> Bool {
+        version >= fileShareMinimumVersion
+    }
+
+    /// The lowest protocol version that reconciles object-storage buckets
+    /// (see `currentVersion` version 25 notes).
+    public static let objectStorageMinimumVersion = 25
+
+    /// Whether an agent registered with `version` can host buckets — the
+    /// desired-state sync carries them and its report confirms them.
+    public static func supportsObjectStorage(_ version: Int) -> Bool {
+        version >= objectStorageMinimumVersion
+    }
+
+    /// The lowest protocol version that applies a memory overcommit policy
+    /// (see `currentVersion` version 26 notes).
+    public static let memoryOvercommitMinimumVersion = 26
+
+    /// Whether an agent registered with `version` can reclaim memory on its
+    /// own, and so may be admitted against an overcommit ratio.
+    public static func supportsMemoryOvercommit(_ version: Int) -> Bool {
+        version >= memoryOvercommitMinimumVersion
+    }
+
+    /// The lowest protocol version that realizes `VMSpec.cpuModel` (see
+    /// `currentVersion` version 28 notes).
+    public static let cpuModelMinimumVersion = 28
+
+    /// Whether an agent registered with `version` gives a guest the CPU model
+    /// its spec names rather than the host's own.
+    public static func supportsCPUModels(_ version: Int) -> Bool {
+        version >= cpuModelMinimumVersion
+    }
+
+    /// The lowest protocol version that enrolls
+    /// `MachineProfile.secureBootKeys` (see `currentVersion` version 29
+    /// notes).
+    public static let secureBootKeysMinimumVersion = 29
+
+    /// Whether an agent registered with `version` enrolls a VM's own Secure
+    /// Boot keys rather than booting it with the firmware template's.
+    public static func supportsSecureBootKeys(_ version: Int) -> Bool {
+        version >= secureBootKeysMinimumVersion
+    }
+
+    /// The lowest protocol version that decodes and realizes IPv6-only
+    /// networks (see `currentVersion` version 30 notes).
+    public static let ipv6OnlyNetworksMinimumVersion = 30
+
+    /// Whether an agent registered with `version` can be sent an IPv6-only
+    /// network. An older one cannot decode the network entry at all, so the
+    /// control plane omits such networks from its syncs and never places a
+    /// workload on one there.
+    public static func supportsIPv6OnlyNetworks(_ version: Int) -> Bool {
+        version >= ipv6OnlyNetworksMinimumVersion
+    }
+
+    /// The lowest protocol version that runs VM health checks and replaces
+    /// VMs from their image (see `currentVersion` version 31 notes).
+    public static let vmHealthChecksMinimumVersion = 31
+
+    /// Whether an agent registered with `version` probes a VM's health check
+    /// and honors `DesiredVMState.replacementCount`.
+    public static func supportsVMHealthChecks(_ version: Int) -> Bool {
+        version >= vmHealthChecksMinimumVersion
+    }
+
+    /// The lowest protocol version that encrypts vTPM state with
+    /// `DesiredVMState.tpmStateKey` (see `currentVersion` version 32 notes).
+    public static let tpmStateEncryptionMinimumVersion = 32
+
+    /// Whether an agent registered with `version` encrypts a VM's TPM state
+    /// with the key its sync carries, and so should be sent it.
+    public static func supportsTPMStateEncryption(_ version: Int) -> Bool {
+        version >= tpmStateEncryptionMinimumVersion
+    }
+
+    /// The lowest protocol version that runs guest commands and exports boot
+    /// disks for image builds (see `currentVersion` version 33 notes).
+    public static let imageBuildMinimumVersion = 33
+
+    /// Whether an agent registered with `version` can host an image build's
+    /// VM: run its provisioners through qga and upload its disk.
+    public static func supportsImageBuilds(_ version: Int) -> Bool {
+        version >= imageBuildMinimumVersion
+    }
+
     /// The JSON encoder for all wire messages. Dates are pinned — explicitly and
     /// from this single definition — to Foundation's `deferredToDate` numeric
     /// form, which is byte compatible with what pre-existing peers already
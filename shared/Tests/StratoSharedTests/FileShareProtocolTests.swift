@@ -0,0 +1,105 @@
+import Foundation
+import Testing
+
+@testable import StratoShared
+
+@Suite("File Share Protocol Tests")
+struct FileShareProtocolTests {
+
+    private func makeEndpoint() -> NetworkSpec {
+        NetworkSpec(
+            network: "team-net",
+            networkId: Fixtures.uuidB,
+            macAddress: "52:54:00:12:34:56",
+            ipAddress: "10.20.0.9",
+            netmask: "255.255.255.0",
+            gateway: "10.20.0.1"
+        )
+    }
+
+    @Test("DesiredStateMessage carries file shares through the envelope")
+    func desiredFileShareRoundTrip() throws {
+        let snapshotId = UUID()
+        let message = DesiredStateMessage(
+            syncId: "sync-fs",
+            vms: [],
+            fileShares: [
+                DesiredFileShareState(
+                    shareId: Fixtures.uuidA,
+                    desiredStatus: .present,
+                    generation: 4,
+                    sizeBytes: 10 << 30,
+                    endpoint: makeEndpoint(),
+                    allowedClients: ["10.20.0.10", "10.20.0.11"],
+                    snapshots: [snapshotId]
+                )
+            ]
+        )
+        let decoded = try throughEnvelope(message)
+
+        let share = try #require(decoded.fileShares?.first)
+        #expect(share.shareId == Fixtures.uuidA)
+        #expect(share.desiredStatus == .present)
+        #expect(share.generation == 4)
+        #expect(share.sizeBytes == 10 << 30)
+        #expect(share.endpoint.ipAddress == "10.20.0.9")
+        #expect(share.endpoint.networkId == Fixtures.uuidB)
+        #expect(share.allowedClients == ["10.20.0.10", "10.20.0.11"])
+        #expect(share.snapshots == [snapshotId])
+    }
+
+    @Test("A sync without file shares decodes to nil — no opinion, not 'delete every share'")
+    func desiredFileSharesAbsentMeansNoOpinion() throws {
+        let legacy = """
+            {"requestId":"r","timestamp":0,"syncId":"s","vms":[]}
+            """
+        let decoded = try decodeJSON(DesiredStateMessage.self, from: legacy)
+        #expect(decoded.fileShares == nil)
+
+        let empty = try throughEnvelope(DesiredStateMessage(vms: [], fileShares: []))
+        #expect(empty.fileShares?.isEmpty == true)
+    }
+
+    @Test("ObservedStateReport carries file shares, and decodes them to [] from older agents")
+    func observedFileShareRoundTrip() throws {
+        let report = ObservedStateReport(
+            agentId: "agent-1",
+            vms: [],
+            resources: Fixtures.resources,
+            fileShares: [
+                ObservedFileShareState(
+                    shareId: Fixtures.uuidA,
+                    status: .available,
+                    observedGeneration: 4,
+                    sizeBytes: 10 << 30,
+                    usedBytes: 1 << 20,
+                    snapshots: [ObservedFileShareSnapshot(snapshotId: Fixtures.uuidB, sizeBytes: 4096)]
+                )
+            ]
+        )
+        let decoded = try throughEnvelope(report)
+        #expect(decoded.fileShares == report.fileShares)
+
+        let legacy = """
+            {"requestId":"r","timestamp":0,"agentId":"agent-1","vms":[],
+             "resources":{"totalCPU":8,"availableCPU":4,"totalMemory":16,"availableMemory":8,
+                          "totalDisk":100,"availableDisk":50}}
+            """
+        #expect(try decodeJSON(ObservedStateReport.self, from: legacy).fileShares.isEmpty)
+    }
+
+    @Test("DesiredFileShareStatus decoding is strict; the observed status is tolerant")
+    func statusDecoding() throws {
+        #expect(throws: (any Error).self) {
+            _ = try decodeJSON(DesiredFileShareStatus.self, from: "\"Frozen\"")
+        }
+        #expect(try decodeJSON(ObservedFileShareStatus.self, from: "\"Replicating\"") == .unknown)
+    }
+
+    @Test("supportsFileShares gates on v24")
+    func fileShareVersionGate() {
+        #expect(!WireProtocol.supportsFileShares(23))
+        #expect(WireProtocol.supportsFileShares(24))
+        #expect(WireProtocol.supportsFileShares(WireProtocol.currentVersion))
+    }
+}
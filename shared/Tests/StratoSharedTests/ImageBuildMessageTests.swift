@@ -0,0 +1,44 @@
+import Foundation
+import Testing
+import StratoShared
+
+@Suite("Image build messages")
+struct ImageBuildMessageTests {
+    @Test func guestExecRoundTrip() throws {
+        let decoded = try throughEnvelope(
+            VMGuestExecMessage(
+                requestId: Fixtures.requestId, timestamp: Fixtures.timestamp, vmId: "vm-1",
+                command: ["/bin/sh", "-c", "apt-get update"], timeoutSeconds: 600)
+        )
+        #expect(decoded.type == .vmGuestExec)
+        #expect(decoded.vmId == "vm-1")
+        #expect(decoded.command == ["/bin/sh", "-c", "apt-get update"])
+        #expect(decoded.timeoutSeconds == 600)
+    }
+
+    @Test func guestExecResponseRoundTrip() throws {
+        let exited = try roundTrip(VMGuestExecResponse(exitCode: 0, signal: nil, output: "ok\n"))
+        #expect(exited == VMGuestExecResponse(exitCode: 0, signal: nil, output: "ok\n"))
+        #expect(exited.succeeded)
+        #expect(!VMGuestExecResponse(exitCode: 2, signal: nil, output: "").succeeded)
+        #expect(!VMGuestExecResponse(exitCode: nil, signal: 9, output: "").succeeded)
+    }
+
+    @Test func diskExportRoundTrip() throws {
+        let decoded = try throughEnvelope(
+            VMDiskExportMessage(
+                requestId: Fixtures.requestId, timestamp: Fixtures.timestamp, vmId: "vm-1",
+                uploadURL: "/api/image-builds/b-1/disk")
+        )
+        #expect(decoded.type == .vmDiskExport)
+        #expect(decoded.vmId == "vm-1")
+        #expect(decoded.uploadURL == "/api/image-builds/b-1/disk")
+    }
+
+    @Test("supportsImageBuilds gates on v33")
+    func imageBuildVersionGate() {
+        #expect(!WireProtocol.supportsImageBuilds(32))
+        #expect(WireProtocol.supportsImageBuilds(33))
+        #expect(WireProtocol.supportsImageBuilds(WireProtocol.currentVersion))
+    }
+}
@@ -0,0 +1,66 @@
+import Foundation
+import Testing
+
+@testable import StratoShared
+
+@Suite("Memory Overcommit Protocol Tests")
+struct MemoryOvercommitProtocolTests {
+
+    @Test("DesiredStateMessage carries the overcommit policy through the envelope")
+    func policyRoundTrip() throws {
+        let policy = MemoryOvercommitPolicy(
+            ratio: 1.5,
+            ksm: KSMTuning(pagesToScan: 1000, sleepMilliseconds: 50),
+            freePageReporting: true,
+            pressureReclaim: PressureReclaimPolicy(pressureThresholdPercent: 20, stepBytes: 128 << 20)
+        )
+        let decoded = try throughEnvelope(DesiredStateMessage(vms: [], memoryOvercommit: policy))
+        #expect(decoded.memoryOvercommit == policy)
+    }
+
+    @Test("A sync without a policy decodes to nil — no opinion")
+    func absentPolicyIsNoOpinion() throws {
+        let legacy = """
+            {"requestId":"r","timestamp":0,"syncId":"s","vms":[]}
+            """
+        #expect(try decodeJSON(DesiredStateMessage.self, from: legacy).memoryOvercommit == nil)
+    }
+
+    @Test("A partial policy fills in the defaults")
+    func partialPolicyTakesDefaults() throws {
+        let policy = try decodeJSON(
+            MemoryOvercommitPolicy.self, from: #"{"ratio":2,"ksm":{},"pressureReclaim":{"stepBytes":1024}}"#)
+        #expect(policy.ratio == 2)
+        #expect(policy.ksm == KSMTuning())
+        #expect(!policy.freePageReporting)
+        #expect(policy.pressureReclaim == PressureReclaimPolicy(stepBytes: 1024))
+    }
+
+    @Test("VMSpec.memoryFloorBytes tolerates absence and never exceeds the grant")
+    func memoryFloorDecoding() throws {
+        let spec = VMSpec(cpus: 1, memoryBytes: 1 << 30, memoryFloorBytes: 1 << 31, boot: .disk(firmware: nil))
+        #expect(spec.memoryFloorBytes == 1 << 30)
+        #expect(try decodeJSON(VMSpec.self, from: encodeJSON(spec)).memoryFloorBytes == 1 << 30)
+
+        let legacy = """
+            {"cpus":1,"maxCpus":1,"memoryBytes":1024,"sharedMemory":false,"hugepages":false,
+             "boot":{"disk":{}},"volumes":[],"networks":[]}
+            """
+        #expect(try decodeJSON(VMSpec.self, from: legacy).memoryFloorBytes == nil)
+    }
+
+    @Test("AgentResources.committedMemory is nil from older agents")
+    func committedMemoryAbsent() throws {
+        let legacy = """
+            {"totalCPU":8,"availableCPU":4,"totalMemory":16,"availableMemory":0,"totalDisk":100,"availableDisk":50}
+            """
+        #expect(try decodeJSON(AgentResources.self, from: legacy).committedMemory == nil)
+    }
+
+    @Test("supportsMemoryOvercommit gates on v26")
+    func memoryOvercommitVersionGate() {
+        #expect(!WireProtocol.supportsMemoryOvercommit(25))
+        #expect(WireProtocol.supportsMemoryOvercommit(26))
+        #expect(WireProtocol.supportsMemoryOvercommit(WireProtocol.currentVersion))
+    }
+}
@@ -30,6 +30,11 @@ struct MessageTypeTests {
         case .volumeSnapshotDelete: return "volume_snapshot_delete"
         case .volumeClone: return "volume_clone"
         case .volumeInfo: return "volume_info"
+        case .volumeExport: return "volume_export"
+        case .volumeImport: return "volume_import"
+        case .volumeNBDExport: return "volume_nbd_export"
+        case .volumeNBDUnexport: return "volume_nbd_unexport"
+        case .volumeMirror: return "volume_mirror"
         case .consoleConnect: return "console_connect"
         case .consoleDisconnect: return "console_disconnect"
         case .consoleData: return "console_data"
@@ -53,6 +58,8 @@ struct MessageTypeTests {
         case .sandboxSnapshotDelete: return "sandbox_snapshot_delete"
         case .sandboxRestore: return "sandbox_restore"
         case .sandboxSnapshotExport: return "sandbox_snapshot_export"
+        case .vmGuestExec: return "vm_guest_exec"
+        case .vmDiskExport: return "vm_disk_export"
         }
     }
 
@@ -62,6 +69,7 @@ struct MessageTypeTests {
         .networkCreate, .networkDelete, .networkList, .networkInfo, .networkAttach, .networkDetach,
         .volumeCreate, .volumeDelete, .volumeAttach, .volumeDetach, .volumeResize,
         .volumeSnapshot, .volumeSnapshotDelete, .volumeClone, .volumeInfo,
+        .volumeExport, .volumeImport, .volumeNBDExport, .volumeNBDUnexport, .volumeMirror,
         .consoleConnect, .consoleDisconnect, .consoleData, .consoleConnected, .consoleDisconnected,
         .desiredState, .observedState,
         .success, .error, .vmLog,
@@ -69,6 +77,7 @@ struct MessageTypeTests {
         .sandboxExecResize, .sandboxExecExit, .sandboxExecClose, .sandboxExecClosed,
         .sandboxLog,
         .sandboxSnapshotCreate, .sandboxSnapshotDelete, .sandboxRestore, .sandboxSnapshotExport,
+        .vmGuestExec, .vmDiskExport,
     ]
 
     @Test("every case keeps its wire string", arguments: allTypes)
@@ -0,0 +1,98 @@
+import Foundation
+import Testing
+
+@testable import StratoShared
+
+@Suite("Object Storage Protocol Tests")
+struct ObjectStorageProtocolTests {
+
+    @Test("DesiredStateMessage carries buckets, grants and credentials through the envelope")
+    func desiredObjectStorageRoundTrip() throws {
+        let message = DesiredStateMessage(
+            syncId: "sync-s3",
+            vms: [],
+            objectStorage: DesiredObjectStorageState(
+                buckets: [
+                    DesiredBucketState(
+                        bucketId: Fixtures.uuidA,
+                        name: "team-artifacts",
+                        desiredStatus: .present,
+                        generation: 2,
+                        quotaBytes: 1 << 30,
+                        grants: [ObjectAccessGrant(accessKeyId: "SKEXAMPLE", permissions: [.list, .read])]
+                    )
+                ],
+                credentials: [ObjectGatewayCredential(accessKeyId: "SKEXAMPLE", secretAccessKey: "secret")]
+            )
+        )
+        let decoded = try throughEnvelope(message)
+
+        let storage = try #require(decoded.objectStorage)
+        let bucket = try #require(storage.buckets.first)
+        #expect(bucket.bucketId == Fixtures.uuidA)
+        #expect(bucket.name == "team-artifacts")
+        #expect(bucket.generation == 2)
+        #expect(bucket.quotaBytes == 1 << 30)
+        #expect(bucket.grants == [ObjectAccessGrant(accessKeyId: "SKEXAMPLE", permissions: [.list, .read])])
+        #expect(storage.credentials == [ObjectGatewayCredential(accessKeyId: "SKEXAMPLE", secretAccessKey: "secret")])
+    }
+
+    @Test("A sync without object storage decodes to nil — no opinion, not 'delete every bucket'")
+    func desiredObjectStorageAbsentMeansNoOpinion() throws {
+        let legacy = """
+            {"requestId":"r","timestamp":0,"syncId":"s","vms":[]}
+            """
+        #expect(try decodeJSON(DesiredStateMessage.self, from: legacy).objectStorage == nil)
+    }
+
+    @Test("ObservedStateReport carries buckets, and decodes them to [] from older agents")
+    func observedBucketRoundTrip() throws {
+        let report = ObservedStateReport(
+            agentId: "agent-1",
+            vms: [],
+            resources: Fixtures.resources,
+            buckets: [
+                ObservedBucketState(
+                    bucketId: Fixtures.uuidA, status: .available, observedGeneration: 2,
+                    usedBytes: 4096, objectCount: 3, endpoint: "https://s3.host-1.example:9000")
+            ]
+        )
+        #expect(try throughEnvelope(report).buckets == report.buckets)
+
+        let legacy = """
+            {"requestId":"r","timestamp":0,"agentId":"agent-1","vms":[],
+             "resources":{"totalCPU":8,"availableCPU":4,"totalMemory":16,"availableMemory":8,
+                          "totalDisk":100,"availableDisk":50}}
+            """
+        #expect(try decodeJSON(ObservedStateReport.self, from: legacy).buckets.isEmpty)
+    }
+
+    @Test("An unknown permission is dropped rather than failing the sync")
+    func unknownPermissionIsDropped() throws {
+        let grant = try decodeJSON(
+            ObjectAccessGrant.self, from: #"{"accessKeyId":"SK1","permissions":["Read","Administer"]}"#)
+        #expect(grant.permissions == [.read])
+        #expect(throws: (any Error).self) {
+            _ = try decodeJSON(DesiredBucketStatus.self, from: "\"Archived\"")
+        }
+    }
+
+    @Test("Bucket names follow the S3 rules")
+    func bucketNames() {
+        #expect(BucketName.isValid("team-artifacts"))
+        #expect(BucketName.isValid("logs.2026"))
+        #expect(!BucketName.isValid("ab"))
+        #expect(!BucketName.isValid("Team"))
+        #expect(!BucketName.isValid("-leading"))
+        #expect(!BucketName.isValid("double..dot"))
+        #expect(!BucketName.isValid("192.168.1.10"))
+        #expect(!BucketName.isValid(String(repeating: "a", count: 64)))
+    }
+
+    @Test("supportsObjectStorage gates on v25")
+    func objectStorageVersionGate() {
+        #expect(!WireProtocol.supportsObjectStorage(24))
+        #expect(WireProtocol.supportsObjectStorage(25))
+        #expect(WireProtocol.supportsObjectStorage(WireProtocol.currentVersion))
+    }
+}
@@ -119,6 +119,28 @@ struct ReconciliationProtocolTests {
         #expect(decoded.subnet == "192.168.1.0/24")
     }
 
+    @Test("An IPv6-only network omits its subnet (wire v30)")
+    func desiredNetworkStateIPv6Only() throws {
+        let network = DesiredNetworkState(
+            networkId: UUID(),
+            name: "fleet",
+            subnet: nil,
+            gateway: nil,
+            subnet6: "fd00:64::/64",
+            gateway6: "fd00:64::1",
+            routerKey: "project-x",
+            externalAccess: true,
+            generation: 1)
+        let encoded = String(decoding: try WireProtocol.makeEncoder().encode(network), as: UTF8.self)
+        #expect(!encoded.contains("\"subnet\":"))
+
+        let decoded = try decodeJSON(DesiredNetworkState.self, from: encoded)
+        #expect(decoded.subnet == nil)
+        #expect(decoded.subnet6 == "fd00:64::/64")
+        #expect(!WireProtocol.supportsIPv6OnlyNetworks(29))
+        #expect(WireProtocol.supportsIPv6OnlyNetworks(WireProtocol.currentVersion))
+    }
+
     @Test("DesiredStateMessage carries topology authority through the envelope")
     func desiredStateAuthorityRoundTrip() throws {
         let peer = DesiredStateMessage(syncId: "sync-peer", vms: [], networksAuthoritative: false)
@@ -295,6 +317,61 @@ struct ReconciliationProtocolTests {
         #expect(decoded.memoryStats == nil)
     }
 
+    @Test("A health check, replacement count and health observation survive the envelope (v31)")
+    func healthCheckRoundTrip() throws {
+        let vmId = UUID()
+        let check = VMHealthCheck(
+            kind: .exec, command: ["/usr/bin/systemctl", "is-active", "nginx"], intervalSeconds: 15,
+            timeoutSeconds: 5, failureThreshold: 3, gracePeriodSeconds: 120)
+        let spec = VMSpec(cpus: 1, memoryBytes: 1 << 30, boot: .disk(firmware: nil))
+        let sync = DesiredStateMessage(
+            syncId: "sync-health",
+            vms: [
+                DesiredVMState(
+                    vmId: vmId, hypervisorType: .qemu, spec: spec, desiredStatus: .running, generation: 7,
+                    healthCheck: check, replacementCount: 2)
+            ])
+        let desired = try #require(try MessageEnvelope(message: sync).decode(as: DesiredStateMessage.self).vms.first)
+        #expect(desired.healthCheck == check)
+        #expect(desired.replacementCount == 2)
+
+        let checkedAt = Date(timeIntervalSince1970: 1_800_000_000)
+        let observed = ObservedStateReport(
+            agentId: "agent-1",
+            vms: [
+                ObservedVMState(
+                    vmId: vmId, status: .running, observedGeneration: 7,
+                    health: VMHealthObservation(
+                        status: .unhealthy, consecutiveFailures: 3, checkedAt: checkedAt, message: "Command exited 3"))
+            ],
+            resources: AgentResources(
+                totalCPU: 8, availableCPU: 4, totalMemory: 16, availableMemory: 8, totalDisk: 100, availableDisk: 50))
+        let health = try #require(
+            try MessageEnvelope(message: observed).decode(as: ObservedStateReport.self).vms.first?.health)
+        #expect(health == VMHealthObservation(
+            status: .unhealthy, consecutiveFailures: 3, checkedAt: checkedAt, message: "Command exited 3"))
+        #expect(!WireProtocol.supportsVMHealthChecks(30))
+        #expect(WireProtocol.supportsVMHealthChecks(WireProtocol.currentVersion))
+    }
+
+    @Test("A TPM state key survives the envelope, and its absence decodes as nil (v32)")
+    func tpmStateKeyRoundTrip() throws {
+        let key = String(repeating: "ab", count: 32)
+        let spec = VMSpec(cpus: 2, memoryBytes: 4 << 30, boot: .disk(firmware: nil))
+        let sync = DesiredStateMessage(
+            syncId: "sync-tpm",
+            vms: [
+                DesiredVMState(
+                    vmId: UUID(), hypervisorType: .qemu, spec: spec, desiredStatus: .running, generation: 1,
+                    tpmStateKey: key),
+                DesiredVMState(vmId: UUID(), hypervisorType: .qemu, spec: spec, desiredStatus: .running, generation: 1),
+            ])
+        let decoded = try MessageEnvelope(message: sync).decode(as: DesiredStateMessage.self).vms
+        #expect(decoded.map(\.tpmStateKey) == [key, nil])
+        #expect(!WireProtocol.supportsTPMStateEncryption(31))
+        #expect(WireProtocol.supportsTPMStateEncryption(WireProtocol.currentVersion))
+    }
+
     @Test("DesiredVMStatus decoding is strict: unknown values fail the sync")
     func desiredStatusStrictDecoding() throws {
         let decoder = WireProtocol.makeDecoder()
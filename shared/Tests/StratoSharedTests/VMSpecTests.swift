@@ -286,6 +286,60 @@ struct VMSpecTests {
         #expect(!decoded.secureBoot)
     }
 
+    // MARK: - Secure Boot keys (wire v29)
+
+    @Test func secureBootKeysRoundTripAndStayOptional() throws {
+        let keys = SecureBootKeys(
+            ownerGUID: "8be4df61-93ca-11d2-aa0d-00e098032b8c", platformKey: "pk",
+            keyExchangeKeys: ["kek"], signatureDatabase: ["db"],
+            forbiddenSignatures: [String(repeating: "ab", count: 32)])
+        let spec = VMSpec(
+            cpus: 1, memoryBytes: 1, boot: .disk(firmware: nil),
+            machine: MachineProfile(secureBoot: true, secureBootKeys: keys))
+        #expect(try roundTrip(spec).machine?.secureBootKeys == keys)
+        #expect(try decodeJSON(MachineProfile.self, from: #"{"secureBoot":true}"#).secureBootKeys == nil)
+    }
+
+    @Test func secureBootKeyEntriesParse() {
+        let pem = "-----BEGIN CERTIFICATE-----\nAQID\nBA==\n-----END CERTIFICATE-----\n"
+        #expect(SecureBootKeys.certificateDER(fromPEM: pem) == Data([1, 2, 3, 4]))
+        #expect(SecureBootKeys.certificateDER(fromPEM: "not a certificate") == nil)
+
+        let digest = SecureBootKeys.sha256Digest(fromHex: String(repeating: "0F", count: 32))
+        #expect(digest == Data(repeating: 0x0f, count: 32))
+        #expect(SecureBootKeys.sha256Digest(fromHex: "abcd") == nil)
+        #expect(SecureBootKeys.sha256Digest(fromHex: String(repeating: "zz", count: 32)) == nil)
+    }
+
+    // MARK: - CPU model (wire v28)
+
+    @Test func cpuModelRoundTripsAsAString() throws {
+        let spec = VMSpec(
+            cpus: 2, memoryBytes: 1 << 32, boot: .disk(firmware: nil), cpuModel: .named("EPYC-Rome"))
+        #expect(String(decoding: try encodeJSON(spec), as: UTF8.self).contains(#""cpuModel":"EPYC-Rome""#))
+        #expect(try roundTrip(spec).cpuModel == .named("EPYC-Rome"))
+        let hostModel = VMSpec(cpus: 1, memoryBytes: 1, boot: .disk(firmware: nil), cpuModel: .hostModel)
+        #expect(try roundTrip(hostModel).cpuModel == .hostModel)
+    }
+
+    @Test func specWithoutCPUModelDecodesToNil() throws {
+        let json = """
+            {"cpus":1,"maxCpus":1,"memoryBytes":1,"sharedMemory":false,"hugepages":false,
+             "boot":{"disk":{}},"volumes":[],"networks":[]}
+            """
+        #expect(try decodeJSON(VMSpec.self, from: json).cpuModel == nil)
+    }
+
+    @Test func cpuModelNames() {
+        #expect(GuestCPUModel(rawValue: "host-passthrough") == .hostPassthrough)
+        #expect(GuestCPUModel(rawValue: "host") == .hostPassthrough)
+        #expect(GuestCPUModel(rawValue: "host-model") == .hostModel)
+        #expect(GuestCPUModel(rawValue: "Skylake-Server-v4") == .named("Skylake-Server-v4"))
+        #expect(GuestCPUModel(rawValue: "") == nil)
+        #expect(GuestCPUModel(rawValue: "host,+avx") == nil)
+        #expect(GuestCPUModel(rawValue: String(repeating: "a", count: 65)) == nil)
+    }
+
     /// An unknown boot-source case from a newer peer must fail loudly (there
     /// is no tolerant fallback for BootSource) — pin that so a change here is
     /// a deliberate decision, not an accident.
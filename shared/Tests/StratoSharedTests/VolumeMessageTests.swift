@@ -196,4 +196,127 @@ struct VolumeMessageTests {
         #expect(decoded.status == "creating")
         #expect(decoded.storagePath == nil)
     }
+
+    @Test func volumeAttachCarriesQoS() throws {
+        let decoded = try throughEnvelope(
+            VolumeAttachMessage(
+                requestId: Fixtures.requestId,
+                timestamp: Fixtures.timestamp,
+                vmId: "vm-1",
+                volumeId: "vol-1",
+                volumePath: "/var/lib/strato/vol-1.qcow2",
+                deviceName: "disk1",
+                qos: VolumeQoS(maxIOPS: 500, maxBytesPerSecond: 50_000_000)
+            )
+        )
+        #expect(decoded.qos == VolumeQoS(maxIOPS: 500, maxBytesPerSecond: 50_000_000))
+    }
+
+    /// A pre-v21 control plane never sends the key; it decodes as unthrottled.
+    @Test func volumeAttachWithoutQoSDecodesAsUnthrottled() throws {
+        let json = """
+            {"requestId":"r","timestamp":0,"vmId":"vm-1","volumeId":"vol-1",
+             "volumePath":"/v","deviceName":"disk1","readonly":false}
+            """
+        let decoded = try decodeJSON(VolumeAttachMessage.self, from: json)
+        #expect(decoded.qos == nil)
+        #expect(decoded.shared == false)
+    }
+
+    @Test func volumeAttachCarriesSharedFlag() throws {
+        let decoded = try throughEnvelope(
+            VolumeAttachMessage(
+                requestId: Fixtures.requestId,
+                timestamp: Fixtures.timestamp,
+                vmId: "vm-2",
+                volumeId: "vol-1",
+                volumePath: "/var/lib/strato/vol-1.raw",
+                deviceName: "disk1",
+                readonly: true,
+                shared: true
+            )
+        )
+        #expect(decoded.shared)
+        #expect(decoded.readonly)
+    }
+
+    /// A pre-v22 control plane's spec has no `shared` key; the disk is
+    /// exclusive, as it always was.
+    @Test func volumeSpecWithoutSharedDecodesAsExclusive() throws {
+        let json = """
+            {"deviceName":"disk1","storagePath":"/v","readonly":false}
+            """
+        let decoded = try decodeJSON(VolumeSpec.self, from: json)
+        #expect(decoded.shared == false)
+        #expect(decoded.qos == nil)
+    }
+
+    @Test("supportsVolumeQoS gates on v21")
+    func volumeQoSVersionGate() {
+        #expect(!WireProtocol.supportsVolumeQoS(20))
+        #expect(WireProtocol.supportsVolumeQoS(21))
+        #expect(!VolumeQoS().isLimited)
+        #expect(VolumeQoS(maxIOPS: 100).isLimited)
+    }
+
+    @Test("supportsSharedVolumes gates on v22")
+    func sharedVolumesVersionGate() {
+        #expect(!WireProtocol.supportsSharedVolumes(21))
+        #expect(WireProtocol.supportsSharedVolumes(22))
+    }
+
+    // MARK: - Migration
+
+    @Test func volumeImportRoundTrip() throws {
+        let decoded = try throughEnvelope(
+            VolumeImportMessage(
+                requestId: Fixtures.requestId,
+                timestamp: Fixtures.timestamp,
+                volumeId: "vol-1",
+                format: "qcow2",
+                downloadURL: "/api/volumes/vol-1/migrations/m-1/data",
+                sizeBytes: 4096,
+                sha256: String(repeating: "a", count: 64)
+            )
+        )
+        #expect(decoded.type == .volumeImport)
+        #expect(decoded.downloadURL == "/api/volumes/vol-1/migrations/m-1/data")
+        #expect(decoded.sizeBytes == 4096)
+    }
+
+    @Test func volumeMirrorCarriesTarget() throws {
+        let target = NBDExportEndpoint(host: "10.0.0.7", port: 10809, exportName: "vol-1")
+        let decoded = try throughEnvelope(
+            VolumeMirrorMessage(
+                requestId: Fixtures.requestId,
+                timestamp: Fixtures.timestamp,
+                vmId: "vm-1",
+                volumeId: "vol-1",
+                volumePath: "/var/lib/strato/volumes/vol-1/disk.raw",
+                target: target
+            )
+        )
+        #expect(decoded.type == .volumeMirror)
+        #expect(decoded.target == target)
+    }
+
+    @Test("NBD endpoints render as QEMU nbd:// URIs, bracketing IPv6 literals")
+    func nbdEndpointURI() {
+        #expect(NBDExportEndpoint(host: "10.0.0.7", port: 10809, exportName: "v").uri == "nbd://10.0.0.7:10809/v")
+        #expect(NBDExportEndpoint(host: "fd00::7", port: 10810, exportName: "v").uri == "nbd://[fd00::7]:10810/v")
+    }
+
+    /// A pre-v23 control plane's spec has no `nbd` key; the disk is local.
+    @Test func volumeSpecWithoutNBDDecodesAsLocal() throws {
+        let json = """
+            {"deviceName":"disk1","storagePath":"/v","readonly":false}
+            """
+        #expect(try decodeJSON(VolumeSpec.self, from: json).nbd == nil)
+    }
+
+    @Test("supportsVolumeMigration gates on v23")
+    func volumeMigrationVersionGate() {
+        #expect(!WireProtocol.supportsVolumeMigration(22))
+        #expect(WireProtocol.supportsVolumeMigration(23))
+    }
 }